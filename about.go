@@ -0,0 +1,219 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/jwt"
+	"net/http"
+	"runtime"
+)
+
+// The version of skipper, reported by the about document. It can be
+// set at build time, e.g.:
+//
+//     go build -ldflags "-X github.com/zalando/skipper.Version=v0.9.42" ./cmd/skipper
+var Version = "dev"
+
+// the filters authenticating or authorizing the clients
+var authFilters = []string{
+	builtin.BasicAuthName,
+	builtin.ClientIPName,
+	builtin.DenyClientIPName,
+	jwt.FilterName}
+
+// Describes a filter in the about document.
+type AboutFilter struct {
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Signature string   `json:"signature,omitempty"`
+}
+
+// The features enabled in a skipper instance.
+type AboutFeatures struct {
+
+	// "registry", when the metrics are exposed by the metrics
+	// listener, "custom", when they are reported to a custom
+	// implementation, or "disabled".
+	Metrics string `json:"metrics"`
+
+	// Tells whether the access log is enabled.
+	AccessLog bool `json:"accessLog"`
+
+	// The filters in the registry authenticating or authorizing the
+	// clients.
+	AuthFilters []string `json:"authFilters"`
+
+	// The names of the custom filters.
+	CustomFilters []string `json:"customFilters"`
+
+	// The store of the rate limit counters, "local" or "redis".
+	RatelimitStore string `json:"ratelimitStore"`
+
+	// The global trailing slash policy.
+	TrailingSlash string `json:"trailingSlash"`
+
+	// Tells whether the chaos experiments of the routes are currently
+	// enabled.
+	Chaos bool `json:"chaos"`
+
+	// Tell whether the discovery of the cloud backends, the shadow
+	// routing, the quotas and the linting of the routes are enabled.
+	CloudBackends bool `json:"cloudBackends"`
+	ShadowRouting bool `json:"shadowRouting"`
+	Quota         bool `json:"quota"`
+	LintRoutes    bool `json:"lintRoutes"`
+}
+
+// Describes the capabilities of a skipper instance, so that the
+// differences between the instances of a fleet can be detected.
+type About struct {
+	Version   string        `json:"version"`
+	GoVersion string        `json:"goVersion"`
+	Features  AboutFeatures `json:"features"`
+
+	// The filters supported by the instance, with their aliases.
+	Filters []AboutFilter `json:"filters"`
+
+	// The route conditions supported by the instance.
+	Predicates []string `json:"predicates"`
+
+	// The types of the route sources, e.g. "etcd", or the Go type of
+	// the custom data clients.
+	DataClients []string `json:"dataClients"`
+}
+
+func metricsFlavor(o Options) string {
+	switch {
+	case o.CustomMetrics != nil:
+		return "custom"
+	case o.MetricsListener != "":
+		return "registry"
+	default:
+		return "disabled"
+	}
+}
+
+func dataClientTypes(o Options) []string {
+	t := []string{}
+	if o.RoutesFile != "" {
+		t = append(t, "eskipfile")
+	}
+
+	if o.RoutesDirectory != "" {
+		t = append(t, "eskipdir")
+	}
+
+	if o.RoutesURL != "" {
+		t = append(t, "eskipurl")
+	}
+
+	if o.InnkeeperUrl != "" {
+		t = append(t, "innkeeper")
+	}
+
+	if len(o.EtcdUrls) > 0 {
+		t = append(t, "etcd")
+	}
+
+	if o.ConsulAddress != "" {
+		t = append(t, "consul")
+	}
+
+	if o.DynamoDBTable != "" {
+		t = append(t, "dynamodb")
+	}
+
+	for _, c := range o.CustomDataClients {
+		t = append(t, fmt.Sprintf("%T", c))
+	}
+
+	return t
+}
+
+// Returns the description of the capabilities of the handler.
+func (h *Handler) About() *About {
+	o := h.options
+	a := &About{
+		Version:     Version,
+		GoVersion:   runtime.Version(),
+		Filters:     []AboutFilter{},
+		Predicates:  append([]string(nil), eskip.Predicates...),
+		DataClients: dataClientTypes(o),
+		Features: AboutFeatures{
+			Metrics:        metricsFlavor(o),
+			AccessLog:      !o.AccessLogDisabled,
+			AuthFilters:    []string{},
+			CustomFilters:  []string{},
+			RatelimitStore: "local",
+			TrailingSlash:  o.TrailingSlash,
+			Chaos:          h.chaos.Enabled(),
+			CloudBackends:  o.CloudBackends != "",
+			ShadowRouting:  o.ShadowRoutesFile != "",
+			Quota:          o.QuotaFile != "",
+			LintRoutes:     o.LintRoutes}}
+
+	if o.RatelimitRedisAddress != "" {
+		a.Features.RatelimitStore = "redis"
+	}
+
+	if a.Features.TrailingSlash == "" {
+		a.Features.TrailingSlash = "strict"
+	}
+
+	registry := h.routingOptions.FilterRegistry
+	for _, s := range registry.Specs() {
+		a.Filters = append(a.Filters, AboutFilter{
+			Name:      s.Name,
+			Aliases:   s.Aliases,
+			Signature: s.Signature})
+	}
+
+	for _, name := range authFilters {
+		if _, ok := registry[name]; ok {
+			a.Features.AuthFilters = append(a.Features.AuthFilters, name)
+		}
+	}
+
+	for _, p := range o.CustomPredicates {
+		a.Predicates = append(a.Predicates, p.Name())
+	}
+
+	for _, f := range o.CustomFilters {
+		a.Features.CustomFilters = append(a.Features.CustomFilters, f.Name())
+	}
+
+	return a
+}
+
+// Returns a handler responding to GET requests with the about document
+// of the handler, in JSON format.
+func (h *Handler) AboutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(h.About())
+		}
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func hasString(l []string, s string) bool {
+	for _, li := range l {
+		if li == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestAbout(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`Any() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHandler(Options{
+		CustomDataClients:     []routing.DataClient{dc},
+		CustomFilters:         []filters.Spec{&filtertest.Filter{FilterName: "hello"}},
+		RatelimitRedisAddress: "localhost:6379",
+		TrailingSlash:         "redirect",
+		LintRoutes:            true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer h.Close()
+
+	r, _ := http.NewRequest("GET", "http://localhost:9911/about", nil)
+	w := httptest.NewRecorder()
+	h.AboutHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("failed to serve the about document", w.Code)
+	}
+
+	var a About
+	if err := json.Unmarshal(w.Body.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Version != Version || a.GoVersion == "" {
+		t.Error("invalid version", a.Version, a.GoVersion)
+	}
+
+	f := a.Features
+	if f.Metrics != "disabled" || !f.AccessLog || f.RatelimitStore != "redis" ||
+		f.TrailingSlash != "redirect" || !f.LintRoutes || f.CloudBackends || f.ShadowRouting || f.Quota {
+		t.Error("invalid features", f)
+	}
+
+	if !hasString(f.AuthFilters, "basicAuth") || !hasString(f.AuthFilters, "jwtValidation") {
+		t.Error("missing auth filters", f.AuthFilters)
+	}
+
+	if len(f.CustomFilters) != 1 || f.CustomFilters[0] != "hello" {
+		t.Error("invalid custom filters", f.CustomFilters)
+	}
+
+	var filterNames []string
+	for _, fi := range a.Filters {
+		filterNames = append(filterNames, fi.Name)
+	}
+
+	if !hasString(filterNames, "hello") || !hasString(filterNames, "cors") {
+		t.Error("missing filters", filterNames)
+	}
+
+	if !hasString(a.Predicates, "Path") || !hasString(a.Predicates, "ClientIP") {
+		t.Error("missing predicates", a.Predicates)
+	}
+
+	if len(a.DataClients) != 1 || a.DataClients[0] != "*testdataclient.Client" {
+		t.Error("invalid data clients", a.DataClients)
+	}
+}
+
+func TestAboutMethodNotAllowed(t *testing.T) {
+	h, err := NewHandler(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer h.Close()
+
+	r, _ := http.NewRequest("POST", "http://localhost:9911/about", nil)
+	w := httptest.NewRecorder()
+	h.AboutHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Error("failed to reject the request", w.Code)
+	}
+}
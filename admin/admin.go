@@ -0,0 +1,368 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package admin implements an authenticated HTTP API for inspecting the
+live routing table of a skipper instance, and optionally, for changing
+it temporarily, e.g. during the mitigation of an incident.
+
+Skipper serves the API on the /admin/ endpoint of the support listener,
+when an admin token is set:
+
+	skipper -support-listener :9911 -admin-token $TOKEN -routes-file routes.eskip
+
+Every request needs to present the token as a bearer token:
+
+	curl -H "Authorization: Bearer $TOKEN" http://localhost:9911/admin/routes
+
+The endpoints:
+
+	GET    /admin/routes          the active routes
+	GET    /admin/routes/<id>     a single active route
+	PUT    /admin/routes          upserts the routes in the eskip request body
+	DELETE /admin/routes/<id>     removes a route
+	GET    /admin/overrides       the routes changed on the admin API
+	DELETE /admin/overrides/<id>  drops the change of a route
+	GET    /admin/healthchecks    the state of the actively checked backends
+	GET    /admin/chaos           the state of the chaos experiments switch
+	PUT    /admin/chaos           switches the chaos experiments on or off
+
+The routes are returned in eskip format by default, or in JSON format,
+with the number of the responses served by each route, when the format
+query parameter is set to json, or the Accept header of the request
+contains application/json. The number of the responses is available only
+when the built-in metrics are enabled.
+
+The upserts and the deletes are accepted only when skipper is started
+with the -admin-mutable-routes flag. They are kept only in memory, and
+take precedence over the routes with the same id from all the other
+sources, until they are dropped on the overrides endpoint, or until the
+process exits. The deleted routes are masked with an expired definition,
+so they are logged as expired.
+
+The state of the backends checked by the active health checks is
+returned in JSON format, ordered by the backend address, with whether
+they are healthy, the number of their consecutive successful or failed
+probes, and the time and the error of their last probe.
+
+The chaos experiments of the routes can be stopped and started again
+on the chaos endpoint, e.g. during incidents:
+
+	curl -X PUT -H "Authorization: Bearer $TOKEN" -d '{"enabled": false}' http://localhost:9911/admin/chaos
+
+See the chaos package.
+*/
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/zalando/skipper/chaos"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Options of the admin API.
+type Options struct {
+
+	// The routing whose active routes are served. Required.
+	Routing *routing.Routing
+
+	// The bearer token expected in the Authorization header of the
+	// requests. When empty, all requests are rejected.
+	Token string
+
+	// The temporary routes, set in the data clients of the routing.
+	// When nil, the upserts and the deletes are rejected.
+	Overrides *Overrides
+
+	// Returns the response statistics of the routes. Default:
+	// metrics.ResponseStats.
+	Stats func() map[string]metrics.RouteStats
+
+	// The active health checks of the backends, whose state is served.
+	// When nil, no backends are listed.
+	HealthChecks *healthcheck.Checker
+
+	// The global switch of the chaos experiments. When nil, the chaos
+	// endpoint is not served.
+	Chaos *chaos.Switch
+}
+
+// API is an http.Handler serving the admin endpoints. It expects the
+// paths without the mount prefix, e.g. /routes instead of
+// /admin/routes.
+type API struct {
+	options Options
+}
+
+// JSON representation of a route.
+type routeInfo struct {
+	Id        string `json:"id"`
+	Route     string `json:"route"`
+	Responses int64  `json:"responses"`
+	Override  bool   `json:"override,omitempty"`
+}
+
+// JSON representation of the overrides.
+type overridesInfo struct {
+	Routes  []routeInfo `json:"routes"`
+	Deleted []string    `json:"deleted"`
+}
+
+// Creates the admin API.
+func New(o Options) *API {
+	if o.Stats == nil {
+		o.Stats = metrics.ResponseStats
+	}
+
+	return &API{options: o}
+}
+
+func (a *API) authenticated(r *http.Request) bool {
+	if a.options.Token == "" {
+		return false
+	}
+
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(h[len("Bearer "):]), []byte(a.options.Token)) == 1
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeEskip(w http.ResponseWriter, routes []*eskip.Route) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(eskip.String(routes...)))
+}
+
+func (a *API) writeRoutes(w http.ResponseWriter, r *http.Request, routes []*eskip.Route) {
+	if !acceptsJSON(r) {
+		writeEskip(w, routes)
+		return
+	}
+
+	overridden := make(map[string]bool)
+	if a.options.Overrides != nil {
+		o, _ := a.options.Overrides.Routes()
+		for _, ri := range o {
+			overridden[ri.Id] = true
+		}
+	}
+
+	stats := a.options.Stats()
+	info := []routeInfo{}
+	for _, ri := range routes {
+		info = append(info, routeInfo{
+			Id:        ri.Id,
+			Route:     ri.String(),
+			Responses: stats[ri.Id].Count,
+			Override:  overridden[ri.Id]})
+	}
+
+	writeJSON(w, info)
+}
+
+func (a *API) findRoute(id string) *eskip.Route {
+	for _, r := range a.options.Routing.Routes() {
+		if r.Id == id {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// checks whether the routes can be changed, and responds with an error
+// if not
+func (a *API) mutable(w http.ResponseWriter) bool {
+	if a.options.Overrides == nil {
+		http.Error(w, "route changes are disabled", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func (a *API) upsert(w http.ResponseWriter, r *http.Request) {
+	if !a.mutable(w) {
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	routes, err := eskip.Parse(string(b))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, ri := range routes {
+		if ri.Id == "" {
+			http.Error(w, "route id expected", http.StatusBadRequest)
+			return
+		}
+	}
+
+	a.options.Overrides.Upsert(routes...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) serveRoutes(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == "GET":
+		a.writeRoutes(w, r, a.options.Routing.Routes())
+	case id == "" && (r.Method == "PUT" || r.Method == "POST"):
+		a.upsert(w, r)
+	case id == "":
+		methodNotAllowed(w, "GET, PUT, POST")
+	case r.Method == "GET":
+		route := a.findRoute(id)
+		if route == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		a.writeRoutes(w, r, []*eskip.Route{route})
+	case r.Method == "DELETE":
+		if !a.mutable(w) {
+			return
+		}
+
+		a.options.Overrides.Delete(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "GET, DELETE")
+	}
+}
+
+func (a *API) serveOverrides(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id == "" && r.Method == "GET":
+		var routes []*eskip.Route
+		deleted := []string{}
+		if a.options.Overrides != nil {
+			var masked []string
+			routes, masked = a.options.Overrides.Routes()
+			deleted = append(deleted, masked...)
+		}
+
+		if !acceptsJSON(r) {
+			writeEskip(w, routes)
+			return
+		}
+
+		info := overridesInfo{Routes: []routeInfo{}, Deleted: deleted}
+		for _, ri := range routes {
+			info.Routes = append(info.Routes, routeInfo{Id: ri.Id, Route: ri.String(), Override: true})
+		}
+
+		writeJSON(w, info)
+	case id == "":
+		methodNotAllowed(w, "GET")
+	case r.Method == "DELETE":
+		if !a.mutable(w) {
+			return
+		}
+
+		if !a.options.Overrides.Reset(id) {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, "DELETE")
+	}
+}
+
+func (a *API) serveHealthChecks(w http.ResponseWriter, r *http.Request, id string) {
+	switch {
+	case id != "":
+		http.NotFound(w, r)
+	case r.Method != "GET":
+		methodNotAllowed(w, "GET")
+	default:
+		states := a.options.HealthChecks.States()
+		if states == nil {
+			states = []healthcheck.State{}
+		}
+
+		writeJSON(w, states)
+	}
+}
+
+// Serves the admin endpoints, after checking the bearer token of the
+// request.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id string
+	switch len(segments) {
+	case 1:
+	case 2:
+		id = segments[1]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch segments[0] {
+	case "routes":
+		a.serveRoutes(w, r, id)
+	case "overrides":
+		a.serveOverrides(w, r, id)
+	case "healthchecks":
+		a.serveHealthChecks(w, r, id)
+	case "chaos":
+		if id != "" || a.options.Chaos == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		a.options.Chaos.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/chaos"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testToken   = "secret"
+	pollTimeout = 6 * time.Millisecond
+)
+
+func testAPI(t *testing.T, overrides *Overrides) (*API, func()) {
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := []routing.DataClient{dc}
+	if overrides != nil {
+		clients = append(clients, overrides)
+	}
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    clients,
+		PollTimeout:    pollTimeout})
+	waitForRoutes(rt, func(ids string) bool { return ids == "bar,foo" })
+
+	stats := func() map[string]metrics.RouteStats {
+		return map[string]metrics.RouteStats{"foo": {Count: 42}}
+	}
+
+	return New(Options{Routing: rt, Token: testToken, Overrides: overrides, Stats: stats}), rt.Close
+}
+
+func routeIds(rt *routing.Routing) string {
+	var ids []string
+	for _, r := range rt.Routes() {
+		ids = append(ids, r.Id)
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func waitForRoutes(rt *routing.Routing, check func(string) bool) bool {
+	for i := 0; i < 60; i++ {
+		if check(routeIds(rt)) {
+			return true
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	return false
+}
+
+func request(t *testing.T, a *API, method, path, token, body string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	a, done := testAPI(t, nil)
+	defer done()
+
+	for _, token := range []string{"", "wrong"} {
+		if w := request(t, a, "GET", "/routes", token, ""); w.Code != http.StatusUnauthorized {
+			t.Error("failed to reject the request", token, w.Code)
+		}
+	}
+
+	if w := request(t, a, "GET", "/routes", testToken, ""); w.Code != http.StatusOK {
+		t.Error("failed to accept the request", w.Code)
+	}
+
+	noToken := New(Options{Routing: a.options.Routing})
+	if w := request(t, noToken, "GET", "/routes", "", ""); w.Code != http.StatusUnauthorized {
+		t.Error("failed to reject the request without a configured token", w.Code)
+	}
+}
+
+func TestListRoutes(t *testing.T) {
+	a, done := testAPI(t, nil)
+	defer done()
+
+	w := request(t, a, "GET", "/routes", testToken, "")
+	if !strings.Contains(w.Body.String(), `foo: Path("/foo")`) || !strings.Contains(w.Body.String(), `bar: Path("/bar")`) {
+		t.Error("invalid eskip response", w.Body.String())
+	}
+
+	w = request(t, a, "GET", "/routes?format=json", testToken, "")
+	var info []routeInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info) != 2 || info[0].Id != "bar" || info[1].Id != "foo" || info[1].Responses != 42 {
+		t.Error("invalid json response", info)
+	}
+
+	w = request(t, a, "GET", "/routes/foo", testToken, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "foo.example.org") || strings.Contains(w.Body.String(), "bar") {
+		t.Error("invalid single route", w.Code, w.Body.String())
+	}
+
+	if w := request(t, a, "GET", "/routes/baz", testToken, ""); w.Code != http.StatusNotFound {
+		t.Error("invalid status for missing route", w.Code)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	a, done := testAPI(t, nil)
+	defer done()
+
+	if w := request(t, a, "PUT", "/routes", testToken, `baz: Any() -> <shunt>`); w.Code != http.StatusForbidden {
+		t.Error("failed to reject upsert", w.Code)
+	}
+
+	if w := request(t, a, "DELETE", "/routes/foo", testToken, ""); w.Code != http.StatusForbidden {
+		t.Error("failed to reject delete", w.Code)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	a, done := testAPI(t, NewOverrides())
+	defer done()
+	rt := a.options.Routing
+
+	if w := request(t, a, "PUT", "/routes", testToken, `Any() -> <shunt>`); w.Code != http.StatusBadRequest {
+		t.Error("failed to reject route without id", w.Code)
+	}
+
+	if w := request(t, a, "PUT", "/routes", testToken, `
+		foo: Path("/foo") -> setResponseHeader("X-Mitigation", "on") -> <shunt>;
+		baz: Path("/baz") -> <shunt>`); w.Code != http.StatusNoContent {
+		t.Fatal("failed to upsert", w.Code)
+	}
+
+	if !waitForRoutes(rt, func(ids string) bool { return ids == "bar,baz,foo" }) {
+		t.Fatal("failed to apply the upsert", routeIds(rt))
+	}
+
+	if w := request(t, a, "DELETE", "/routes/bar", testToken, ""); w.Code != http.StatusNoContent {
+		t.Fatal("failed to delete", w.Code)
+	}
+
+	if !waitForRoutes(rt, func(ids string) bool { return ids == "baz,foo" }) {
+		t.Fatal("failed to apply the delete", routeIds(rt))
+	}
+
+	w := request(t, a, "GET", "/overrides?format=json", testToken, "")
+	var info overridesInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Routes) != 2 || info.Routes[0].Id != "baz" || info.Routes[1].Id != "foo" ||
+		len(info.Deleted) != 1 || info.Deleted[0] != "bar" {
+		t.Error("invalid overrides", info)
+	}
+
+	for _, id := range []string{"foo", "bar", "baz"} {
+		if w := request(t, a, "DELETE", "/overrides/"+id, testToken, ""); w.Code != http.StatusNoContent {
+			t.Error("failed to reset override", id, w.Code)
+		}
+	}
+
+	if !waitForRoutes(rt, func(ids string) bool { return ids == "bar,foo" }) {
+		t.Fatal("failed to restore the routes", routeIds(rt))
+	}
+
+	if r := a.findRoute("foo"); r == nil || r.Backend != "https://foo.example.org" {
+		t.Error("failed to restore the original route", r)
+	}
+
+	if w := request(t, a, "DELETE", "/overrides/foo", testToken, ""); w.Code != http.StatusNotFound {
+		t.Error("invalid status for missing override", w.Code)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	a, done := testAPI(t, nil)
+	defer done()
+
+	w := request(t, a, "GET", "/healthchecks", testToken, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Error("invalid response without health checks", w.Code, w.Body.String())
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	hc := healthcheck.New(healthcheck.Options{
+		Path:               "/health",
+		Interval:           3 * time.Millisecond,
+		UnhealthyThreshold: 1})
+	defer hc.Close()
+
+	a.options.HealthChecks = hc
+	hc.Healthy(healthcheck.Target{Backend: backend.URL})
+	for i := 0; i < 60 && hc.Healthy(healthcheck.Target{Backend: backend.URL}); i++ {
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	w = request(t, a, "GET", "/healthchecks", testToken, "")
+	var states []healthcheck.State
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 || states[0].Backend != backend.URL || states[0].Path != "/health" || states[0].Healthy {
+		t.Error("invalid health check states", states)
+	}
+
+	if w := request(t, a, "DELETE", "/healthchecks", testToken, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Error("failed to reject delete", w.Code)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	a, done := testAPI(t, nil)
+	defer done()
+
+	if w := request(t, a, "GET", "/chaos", testToken, ""); w.Code != http.StatusNotFound {
+		t.Error("failed to reject the chaos endpoint without switch", w.Code)
+	}
+
+	s := chaos.NewSwitch(true)
+	a.options.Chaos = s
+	if w := request(t, a, "PUT", "/chaos", "", `{"enabled": false}`); w.Code != http.StatusUnauthorized || !s.Enabled() {
+		t.Error("failed to reject the unauthenticated request", w.Code, s.Enabled())
+	}
+
+	if w := request(t, a, "PUT", "/chaos", testToken, `{"enabled": false}`); w.Code != http.StatusOK || s.Enabled() {
+		t.Error("failed to disable the chaos experiments", w.Code, s.Enabled())
+	}
+
+	w := request(t, a, "GET", "/chaos", testToken, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"enabled":false}` {
+		t.Error("invalid state", w.Code, w.Body.String())
+	}
+
+	if w := request(t, a, "GET", "/chaos/foo", testToken, ""); w.Code != http.StatusNotFound {
+		t.Error("failed to reject invalid path", w.Code)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the validity of the definitions masking the deleted routes, making
+// them expire immediately
+var maskValidUntil = time.Unix(1, 0)
+
+// Overrides is an in-memory data client, holding the temporary route
+// definitions set on the admin API. It is meant to be the last one in
+// the list of the data clients of the routing, so that its definitions
+// take precedence over the ones from the other sources with the same
+// route id. The deleted routes are masked with an already expired
+// definition. The overrides are lost when the process exits.
+type Overrides struct {
+	mx       sync.Mutex
+	routes   map[string]*eskip.Route
+	upserted map[string]*eskip.Route
+	deleted  map[string]bool
+}
+
+// Creates an empty set of overrides.
+func NewOverrides() *Overrides {
+	o := &Overrides{routes: make(map[string]*eskip.Route)}
+	o.resetPending()
+	return o
+}
+
+func (o *Overrides) resetPending() {
+	o.upserted = make(map[string]*eskip.Route)
+	o.deleted = make(map[string]bool)
+}
+
+func (o *Overrides) upsert(r *eskip.Route) {
+	o.routes[r.Id] = r
+	o.upserted[r.Id] = r
+	delete(o.deleted, r.Id)
+}
+
+// Returns all the overrides, including the masks of the deleted routes.
+func (o *Overrides) LoadAll() ([]*eskip.Route, error) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	o.resetPending()
+	var routes []*eskip.Route
+	for _, r := range o.routes {
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+// Returns the overrides changed since the previous call.
+func (o *Overrides) LoadUpdate() ([]*eskip.Route, []string, error) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	var (
+		routes     []*eskip.Route
+		deletedIds []string
+	)
+
+	for _, r := range o.upserted {
+		routes = append(routes, r)
+	}
+
+	for id := range o.deleted {
+		deletedIds = append(deletedIds, id)
+	}
+
+	o.resetPending()
+	return routes, deletedIds, nil
+}
+
+// Sets temporary definitions for the routes, replacing the ones with
+// the same id from any source.
+func (o *Overrides) Upsert(routes ...*eskip.Route) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for _, r := range routes {
+		o.upsert(r)
+	}
+}
+
+// Removes routes from the routing table, regardless of their source,
+// by masking them with an expired definition.
+func (o *Overrides) Delete(ids ...string) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for _, id := range ids {
+		o.upsert(&eskip.Route{
+			Id:    id,
+			Shunt: true,
+			CustomPredicates: []*eskip.Predicate{{
+				Name: routing.ValidUntilName,
+				Args: []interface{}{maskValidUntil.Format(time.RFC3339)}}}})
+	}
+}
+
+// Drops the override or the mask of a route, restoring the definition
+// from the other sources, if any. It returns false, if there was no
+// override for the route.
+func (o *Overrides) Reset(id string) bool {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	if _, ok := o.routes[id]; !ok {
+		return false
+	}
+
+	delete(o.routes, id)
+	delete(o.upserted, id)
+	o.deleted[id] = true
+	return true
+}
+
+// Returns the overrides sorted by the route id. The masks of the deleted
+// routes are returned separately, by their ids.
+func (o *Overrides) Routes() ([]*eskip.Route, []string) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	var (
+		routes []*eskip.Route
+		masked []string
+	)
+
+	for id, r := range o.routes {
+		if isMask(r) {
+			masked = append(masked, id)
+			continue
+		}
+
+		routes = append(routes, r)
+	}
+
+	sort.Sort(byId(routes))
+	sort.Strings(masked)
+	return routes, masked
+}
+
+func isMask(r *eskip.Route) bool {
+	v, err := routing.ValidUntil(r)
+	return err == nil && v.Equal(maskValidUntil)
+}
+
+type byId []*eskip.Route
+
+func (r byId) Len() int           { return len(r) }
+func (r byId) Less(i, j int) bool { return r[i].Id < r[j].Id }
+func (r byId) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
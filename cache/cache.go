@@ -0,0 +1,214 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package cache implements a filter caching the backend responses, as a
+shared HTTP cache.
+
+The routes enable caching with the cache filter, optionally setting the
+freshness of the responses that don't declare their own:
+
+    assets: Path("/assets/**") -> cache() -> "https://assets.example.org";
+
+    catalog: Path("/catalog") -> cache("30s") -> "https://catalog.example.org";
+
+The responses to the GET requests are stored, when the backend allows
+it with the Cache-Control and the Expires headers, and they are served
+to the following GET and HEAD requests for the same host and URI, while
+they are fresh, without forwarding the requests to the backend. The
+s-maxage and max-age directives take precedence over the Expires
+header. The responses with the no-store, no-cache or private
+directives, with a Set-Cookie header, or with Vary: * are not stored,
+and neither are the responses to the requests with an Authorization
+header, unless the response is marked public, or it sets s-maxage. The
+Vary header of the responses is honored: the responses are stored
+separately for the values of the request headers that they vary by.
+The requests with Cache-Control: no-store bypass the cache, while the
+ones with no-cache or max-age=0 are forwarded to the backend, and their
+responses are stored.
+
+When a response sets the stale-while-revalidate directive, after it
+expired, it is served stale for the set time, while it is refreshed in
+the background with a request to the backend of the route. When an
+expired response has an ETag or a Last-Modified header, the forwarded
+request is made conditional, and when the backend responds with 304
+Not Modified, the stored response is served and refreshed. The cached
+responses are served with the Age header, and the conditional requests
+of the clients are answered with 304 Not Modified, when the ETag of the
+stored response matches. The X-Skipper-Cache header of the responses
+tells whether they were served from the cache: HIT, STALE, REVALIDATED
+or MISS.
+
+The responses are kept by a Store. The default one keeps them in
+memory, evicting the least recently used ones above a size limit, while
+custom stores can keep them in external systems, e.g. Redis or
+memcached. The bodies larger than 1MB are not stored. The served
+responses are counted per route in the metrics, by the result.
+*/
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The default size limit of the local store, in bytes.
+const DefaultLocalStoreSize = 64 << 20
+
+// A stored response. The stores must not modify the entries, and the
+// entries returned by the stores are not modified by the filter.
+type Entry struct {
+
+	// The status code of the response.
+	StatusCode int
+
+	// The headers of the response, without the hop-by-hop headers.
+	Header http.Header
+
+	// The body of the response.
+	Body []byte
+
+	// The time when the response was generated by the backend: the
+	// time when it was received, minus its Age.
+	Date time.Time
+
+	// The response is fresh until this time.
+	Expires time.Time
+
+	// The response can be served stale, while it is refreshed in the
+	// background, until this time.
+	StaleUntil time.Time
+
+	// When set, the entry only records the request headers that the
+	// responses of a URI vary by, while the responses themselves are
+	// stored with keys that include the values of these headers.
+	Vary []string
+}
+
+// A Store keeps the cached responses. Implementations must be safe for
+// concurrent use.
+type Store interface {
+
+	// Returns the entry of a key, or nil, when the key is not found,
+	// or the entry expired.
+	Get(key string) (*Entry, error)
+
+	// Stores the entry of a key. The entry can be dropped after the
+	// ttl.
+	Set(key string, e *Entry, ttl time.Duration) error
+}
+
+type localItem struct {
+	key     string
+	entry   *Entry
+	expires time.Time
+	size    int64
+}
+
+type localStore struct {
+	mx       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	items    map[string]*list.Element
+	lru      *list.List
+}
+
+// Returns a store keeping the responses in memory, up to maxBytes,
+// evicting the least recently used ones. When maxBytes is not positive,
+// DefaultLocalStoreSize is used.
+func NewLocalStore(maxBytes int64) Store {
+	if maxBytes <= 0 {
+		maxBytes = DefaultLocalStoreSize
+	}
+
+	return &localStore{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		lru:      list.New()}
+}
+
+// the approximate memory used by an entry
+func entrySize(key string, e *Entry) int64 {
+	size := int64(len(key) + len(e.Body))
+	for k, v := range e.Header {
+		size += int64(len(k))
+		for _, vi := range v {
+			size += int64(len(vi))
+		}
+	}
+
+	for _, v := range e.Vary {
+		size += int64(len(v))
+	}
+
+	return size
+}
+
+// expects the lock to be held
+func (s *localStore) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*localItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size
+}
+
+// Returns the entry from memory.
+func (s *localStore) Get(key string) (*Entry, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+
+	item := el.Value.(*localItem)
+	if !time.Now().Before(item.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+
+	s.lru.MoveToFront(el)
+	return item.entry, nil
+}
+
+// Stores the entry in memory, and evicts the least recently used
+// entries above the size limit. The entries larger than the limit are
+// not stored.
+func (s *localStore) Set(key string, e *Entry, ttl time.Duration) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+
+	size := entrySize(key, e)
+	if ttl <= 0 || size > s.maxBytes {
+		return nil
+	}
+
+	s.items[key] = s.lru.PushFront(&localItem{
+		key:     key,
+		entry:   e,
+		expires: time.Now().Add(ttl),
+		size:    size})
+	s.bytes += size
+	for s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+
+	return nil
+}
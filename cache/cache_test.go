@@ -0,0 +1,62 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreGetSet(t *testing.T) {
+	s := NewLocalStore(1024)
+	if e, err := s.Get("foo"); e != nil || err != nil {
+		t.Error("unexpected entry", e, err)
+	}
+
+	e := &Entry{StatusCode: 200, Body: []byte("foo")}
+	s.Set("foo", e, time.Minute)
+	if got, err := s.Get("foo"); got != e || err != nil {
+		t.Error("failed to get the entry", got, err)
+	}
+
+	s.Set("foo", e, time.Millisecond)
+	time.Sleep(3 * time.Millisecond)
+	if got, _ := s.Get("foo"); got != nil {
+		t.Error("failed to expire the entry")
+	}
+}
+
+func TestLocalStoreEviction(t *testing.T) {
+	s := NewLocalStore(100)
+	body := []byte(strings.Repeat("x", 40))
+	s.Set("a", &Entry{Body: body}, time.Minute)
+	s.Set("b", &Entry{Body: body}, time.Minute)
+
+	// makes b the least recently used
+	s.Get("a")
+	s.Set("c", &Entry{Body: body}, time.Minute)
+
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if e, _ := s.Get(key); (e != nil) != expected {
+			t.Error("invalid eviction", key, expected)
+		}
+	}
+
+	s.Set("d", &Entry{Body: []byte(strings.Repeat("x", 101))}, time.Minute)
+	if e, _ := s.Get("d"); e != nil {
+		t.Error("entry larger than the limit stored")
+	}
+}
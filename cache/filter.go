@@ -0,0 +1,624 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CacheName = "cache"
+
+	// The response header telling whether the response was served from
+	// the cache.
+	CacheHeader = "X-Skipper-Cache"
+
+	// the bodies larger than this are not stored
+	maxEntrySize = 1 << 20
+
+	// the entries with an ETag or Last-Modified header are kept after
+	// they became stale, to revalidate them with conditional requests
+	revalidationRetention = time.Hour
+
+	// the timeout of the background refresh requests
+	refreshTimeout = 10 * time.Second
+)
+
+// the statuses cacheable by default, RFC 7231, section 6.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// not stored, because they apply only to a single connection
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+	"Age",
+	CacheHeader,
+}
+
+type spec struct {
+	store      Store
+	clock      clock.Clock
+	client     *http.Client
+	mx         sync.Mutex
+	refreshing map[string]bool
+}
+
+type filter struct {
+	spec       *spec
+	defaultTTL time.Duration
+}
+
+// reads the body of a response, and stores it, when it was read to the
+// end, and it didn't exceed the size limit
+type captureBody struct {
+	body     io.ReadCloser
+	buf      bytes.Buffer
+	overflow bool
+	done     bool
+	store    func([]byte)
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if !b.overflow && n > 0 {
+		if b.buf.Len()+n > maxEntrySize {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF && !b.overflow && !b.done {
+		b.done = true
+		b.store(b.buf.Bytes())
+	}
+
+	return n, err
+}
+
+func (b *captureBody) Close() error { return b.body.Close() }
+
+// Returns a filter specification whose instances cache the responses
+// of the routes, e.g.:
+//
+//     cache()
+//     cache("30s")
+//
+// The optional argument is the time that the responses are fresh for,
+// when they don't set it themselves with Cache-Control or Expires.
+// Without it, these responses are not stored. When the store is nil,
+// the responses are kept in memory, with the default size limit.
+//
+// Name: "cache".
+func NewCache(s Store) filters.Spec {
+	return newSpec(s, clock.System)
+}
+
+func newSpec(s Store, c clock.Clock) *spec {
+	if s == nil {
+		s = NewLocalStore(DefaultLocalStoreSize)
+	}
+
+	return &spec{
+		store: s,
+		clock: c,
+		client: &http.Client{
+			Timeout: refreshTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}},
+		refreshing: make(map[string]bool)}
+}
+
+// "cache"
+func (s *spec) Name() string { return CacheName }
+
+func (s *spec) Description() string {
+	return "Caches the responses of the route, as a shared HTTP cache."
+}
+
+func (s *spec) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "defaultTTL", Type: filters.DurationType, Optional: true}}
+}
+
+func (s *spec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{spec: s}
+	if len(config) == 1 {
+		d, ok := filters.DurationArg(config[0])
+		if !ok || d < 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.defaultTTL = d
+	}
+
+	return f, nil
+}
+
+// parses the Cache-Control directives, with the names in lower case
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+
+			kv := strings.SplitN(d, "=", 2)
+			name := strings.ToLower(strings.TrimSpace(kv[0]))
+			if len(kv) == 2 {
+				directives[name] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			} else {
+				directives[name] = ""
+			}
+		}
+	}
+
+	return directives
+}
+
+// returns the value of a directive in seconds
+func seconds(directives map[string]string, name string) (time.Duration, bool) {
+	v, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+
+	s, err := strconv.Atoi(v)
+	if err != nil || s < 0 {
+		return 0, false
+	}
+
+	return time.Duration(s) * time.Second, true
+}
+
+// the request headers that the response varies by, canonicalized and
+// sorted
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h["Vary"] {
+		for _, n := range strings.Split(v, ",") {
+			n = strings.TrimSpace(n)
+			if n != "" {
+				names = append(names, http.CanonicalHeaderKey(n))
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func primaryKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// the key of the response for the values of the request headers that it
+// varies by
+func variantKey(key string, vary []string, r *http.Request) string {
+	k := key
+	for _, n := range vary {
+		k += "\x00" + n + ":" + strings.Join(r.Header[n], ",")
+	}
+
+	return k
+}
+
+func hasValidators(e *Entry) bool {
+	return e.Header.Get("Etag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// creates the entry of a response, when it can be stored, without the
+// body, and returns it with the time to keep it
+func (f *filter) newEntry(r *http.Request, rsp *http.Response, now time.Time) (*Entry, time.Duration) {
+	if !cacheableStatus[rsp.StatusCode] || rsp.ContentLength > maxEntrySize {
+		return nil, 0
+	}
+
+	cc := parseCacheControl(rsp.Header)
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return nil, 0
+		}
+	}
+
+	if len(rsp.Header["Set-Cookie"]) > 0 {
+		return nil, 0
+	}
+
+	_, public := cc["public"]
+	_, shared := cc["s-maxage"]
+	if r.Header.Get("Authorization") != "" && !public && !shared {
+		return nil, 0
+	}
+
+	vary := varyHeaders(rsp.Header)
+	for _, n := range vary {
+		if n == "*" {
+			return nil, 0
+		}
+	}
+
+	date := now
+	if age, err := strconv.Atoi(rsp.Header.Get("Age")); err == nil && age > 0 {
+		date = now.Add(-time.Duration(age) * time.Second)
+	}
+
+	freshness, ok := seconds(cc, "s-maxage")
+	if !ok {
+		freshness, ok = seconds(cc, "max-age")
+	}
+
+	if !ok {
+		if exp := rsp.Header.Get("Expires"); exp != "" {
+			ok = true
+			if t, err := http.ParseTime(exp); err == nil {
+				served := now
+				if d, err := http.ParseTime(rsp.Header.Get("Date")); err == nil {
+					served = d
+				}
+
+				freshness = t.Sub(served)
+			}
+		}
+	}
+
+	if !ok {
+		if f.defaultTTL <= 0 {
+			return nil, 0
+		}
+
+		freshness = f.defaultTTL
+	}
+
+	header := make(http.Header)
+	for k, v := range rsp.Header {
+		header[k] = append([]string(nil), v...)
+	}
+
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+
+	swr, _ := seconds(cc, "stale-while-revalidate")
+	e := &Entry{
+		StatusCode: rsp.StatusCode,
+		Header:     header,
+		Date:       date,
+		Expires:    date.Add(freshness),
+		StaleUntil: date.Add(freshness + swr)}
+
+	ttl := e.StaleUntil.Sub(now)
+	if hasValidators(e) {
+		ttl += revalidationRetention
+	}
+
+	if ttl <= 0 {
+		return nil, 0
+	}
+
+	return e, ttl
+}
+
+// stores an entry, and, when the response varies by request headers,
+// the entry recording them
+func (s *spec) put(key string, r *http.Request, e *Entry, ttl time.Duration) {
+	vary := varyHeaders(e.Header)
+	if len(vary) > 0 {
+		if err := s.store.Set(key, &Entry{Vary: vary}, ttl); err != nil {
+			log.Errorf("failed to store the cached response of %s: %v", key, err)
+			return
+		}
+
+		key = variantKey(key, vary, r)
+	}
+
+	if err := s.store.Set(key, e, ttl); err != nil {
+		log.Errorf("failed to store the cached response of %s: %v", key, err)
+	}
+}
+
+// returns the stored response matching the request, or nil
+func (s *spec) get(key string, r *http.Request) *Entry {
+	e, err := s.store.Get(key)
+	if err == nil && e != nil && len(e.Vary) > 0 {
+		e, err = s.store.Get(variantKey(key, e.Vary, r))
+	}
+
+	if err != nil {
+		log.Errorf("failed to get the cached response of %s: %v", key, err)
+		return nil
+	}
+
+	return e
+}
+
+// tells whether the request has an If-None-Match header matching the
+// ETag of the stored response
+func notModified(r *http.Request, e *Entry) bool {
+	inm := r.Header.Get("If-None-Match")
+	etag := e.Header.Get("Etag")
+	if inm == "" || etag == "" {
+		return false
+	}
+
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responds with a stored response
+func (f *filter) serve(ctx filters.FilterContext, e *Entry, result string, now time.Time) {
+	r := ctx.Request()
+	w := ctx.ResponseWriter()
+	h := w.Header()
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+
+	h.Set("Age", strconv.Itoa(int(now.Sub(e.Date)/time.Second)))
+	h.Set(CacheHeader, result)
+	ctx.MarkServed()
+
+	if notModified(r, e) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	w.WriteHeader(e.StatusCode)
+	if r.Method != "HEAD" {
+		w.Write(e.Body)
+	}
+}
+
+// refreshes a stale response in the background, with a request to the
+// backend of the route. Only one refresh of a key runs at a time.
+func (f *filter) refresh(key, backendUrl string, r *http.Request) {
+	s := f.spec
+	s.mx.Lock()
+	if s.refreshing[key] {
+		s.mx.Unlock()
+		return
+	}
+
+	s.refreshing[key] = true
+	s.mx.Unlock()
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(backendUrl, "/")+r.URL.RequestURI(), nil)
+	if err != nil {
+		s.mx.Lock()
+		delete(s.refreshing, key)
+		s.mx.Unlock()
+		return
+	}
+
+	for k, v := range r.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	req.Host = r.Host
+
+	go func() {
+		defer func() {
+			s.mx.Lock()
+			delete(s.refreshing, key)
+			s.mx.Unlock()
+		}()
+
+		rsp, err := s.client.Do(req)
+		if err != nil {
+			log.Errorf("failed to refresh the cached response of %s: %v", key, err)
+			return
+		}
+
+		defer rsp.Body.Close()
+		e, ttl := f.newEntry(req, rsp, s.clock.Now())
+		if e == nil {
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxEntrySize+1))
+		if err != nil || len(body) > maxEntrySize {
+			return
+		}
+
+		e.Body = body
+		s.put(key, req, e, ttl)
+	}()
+}
+
+// Serves the fresh stored responses, and the stale ones while they are
+// refreshed. When the stored response expired, but it can be
+// revalidated, it makes the request conditional.
+func (f *filter) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return
+	}
+
+	cc := parseCacheControl(r.Header)
+	if _, ok := cc["no-store"]; ok {
+		return
+	}
+
+	key := primaryKey(r)
+	state := ctx.FilterState(f)
+	state["key"] = key
+
+	routeId, _ := ctx.StateBag()[filters.RouteIdKey].(string)
+	_, noCache := cc["no-cache"]
+	maxAge, hasMaxAge := seconds(cc, "max-age")
+	if noCache || hasMaxAge && maxAge == 0 || r.Header.Get("Pragma") == "no-cache" {
+		metrics.IncCache(routeId, "miss")
+		return
+	}
+
+	e := f.spec.get(key, r)
+	if e == nil {
+		metrics.IncCache(routeId, "miss")
+		return
+	}
+
+	now := f.spec.clock.Now()
+	backendUrl := ctx.BackendUrl()
+	switch {
+	case now.Before(e.Expires):
+		metrics.IncCache(routeId, "hit")
+		f.serve(ctx, e, "HIT", now)
+	case now.Before(e.StaleUntil) && backendUrl != "":
+		metrics.IncCache(routeId, "stale")
+		f.serve(ctx, e, "STALE", now)
+		f.refresh(key, backendUrl, r)
+	case hasValidators(e) && r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "":
+		if etag := e.Header.Get("Etag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+
+		if lm := e.Header.Get("Last-Modified"); lm != "" {
+			r.Header.Set("If-Modified-Since", lm)
+		}
+
+		state["revalidate"] = e
+	default:
+		metrics.IncCache(routeId, "miss")
+	}
+}
+
+// Stores the cacheable responses, and replaces the 304 Not Modified
+// responses of the revalidation requests with the stored response.
+func (f *filter) Response(ctx filters.FilterContext) {
+	state := ctx.FilterState(f)
+	key, ok := state["key"].(string)
+	if !ok {
+		return
+	}
+
+	r := ctx.Request()
+	rsp := ctx.Response()
+	now := f.spec.clock.Now()
+	routeId, _ := ctx.StateBag()[filters.RouteIdKey].(string)
+
+	if stored, ok := state["revalidate"].(*Entry); ok {
+		r.Header.Del("If-None-Match")
+		r.Header.Del("If-Modified-Since")
+		if rsp.StatusCode != http.StatusNotModified {
+			metrics.IncCache(routeId, "miss")
+		} else {
+			metrics.IncCache(routeId, "revalidated")
+			f.revalidated(key, r, rsp, stored, now)
+			return
+		}
+	}
+
+	rsp.Header.Set(CacheHeader, "MISS")
+	if r.Method != "GET" {
+		return
+	}
+
+	e, ttl := f.newEntry(r, rsp, now)
+	if e == nil {
+		return
+	}
+
+	rsp.Body = &captureBody{body: rsp.Body, store: func(body []byte) {
+		e.Body = append([]byte(nil), body...)
+		f.spec.put(key, r, e, ttl)
+	}}
+}
+
+// replaces the 304 response with the stored one, updated with the
+// headers of the 304 response, and stores it again
+func (f *filter) revalidated(key string, r *http.Request, rsp *http.Response, stored *Entry, now time.Time) {
+	updated := &http.Response{StatusCode: stored.StatusCode, Header: make(http.Header)}
+	for k, v := range stored.Header {
+		updated.Header[k] = append([]string(nil), v...)
+	}
+
+	for k, v := range rsp.Header {
+		updated.Header[k] = append([]string(nil), v...)
+	}
+
+	e, ttl := f.newEntry(r, updated, now)
+	if e == nil {
+		e = &Entry{StatusCode: stored.StatusCode, Header: updated.Header, Date: now}
+		for _, h := range hopHeaders {
+			e.Header.Del(h)
+		}
+	}
+
+	e.Body = stored.Body
+	if ttl > 0 {
+		f.spec.put(key, r, e, ttl)
+	}
+
+	rsp.Body.Close()
+	rsp.StatusCode = e.StatusCode
+	for k := range rsp.Header {
+		delete(rsp.Header, k)
+	}
+
+	for k, v := range e.Header {
+		rsp.Header[k] = append([]string(nil), v...)
+	}
+
+	rsp.Header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	rsp.Header.Set(CacheHeader, "REVALIDATED")
+	rsp.ContentLength = int64(len(e.Body))
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(e.Body))
+}
@@ -0,0 +1,368 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testBackend struct {
+	requests int64
+	handler  http.HandlerFunc
+}
+
+type testResult struct {
+	status int
+	header http.Header
+	body   string
+}
+
+func (b *testBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&b.requests, 1)
+	b.handler(w, r)
+}
+
+func (b *testBackend) count() int64 { return atomic.LoadInt64(&b.requests) }
+
+func testFilter(t *testing.T, c clock.Clock, args ...interface{}) filters.Filter {
+	f, err := newSpec(nil, c).CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// executes a request through the filter, and, when it was not served
+// from the cache, through the backend
+func serve(f filters.Filter, b http.Handler, r *http.Request) testResult {
+	w := httptest.NewRecorder()
+	ctx := &filtertest.Context{
+		FResponseWriter: w,
+		FRequest:        r,
+		FStateBag:       map[string]interface{}{filters.RouteIdKey: "route1"}}
+	f.Request(ctx)
+	if ctx.FServed {
+		return testResult{w.Code, w.Header(), w.Body.String()}
+	}
+
+	bw := httptest.NewRecorder()
+	b.ServeHTTP(bw, r)
+	ctx.FResponse = &http.Response{
+		StatusCode:    bw.Code,
+		Header:        bw.Header(),
+		Body:          ioutil.NopCloser(bw.Body),
+		ContentLength: -1}
+	f.Response(ctx)
+
+	body, _ := ioutil.ReadAll(ctx.FResponse.Body)
+	ctx.FResponse.Body.Close()
+	return testResult{ctx.FResponse.StatusCode, ctx.FResponse.Header, string(body)}
+}
+
+func get(path string, header ...string) *http.Request {
+	r, _ := http.NewRequest("GET", "https://www.example.org"+path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	return r
+}
+
+func TestCacheArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{"foo"},
+		{"1m", "1m"},
+		{-1.0},
+	} {
+		if _, err := NewCache(nil).CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestCacheFreshResponse(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	f := testFilter(t, c)
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("Hello, world!"))
+	}}
+
+	if rs := serve(f, b, get("/foo")); rs.body != "Hello, world!" || rs.header.Get(CacheHeader) != "MISS" {
+		t.Error("invalid first response", rs)
+	}
+
+	c.Add(30 * time.Second)
+	rs := serve(f, b, get("/foo"))
+	if rs.body != "Hello, world!" || rs.header.Get(CacheHeader) != "HIT" || rs.header.Get("Age") != "30" {
+		t.Error("invalid cached response", rs)
+	}
+
+	if b.count() != 1 {
+		t.Error("cached response forwarded to the backend", b.count())
+	}
+
+	head, _ := http.NewRequest("HEAD", "https://www.example.org/foo", nil)
+	if rs := serve(f, b, head); rs.status != http.StatusOK || rs.body != "" || b.count() != 1 {
+		t.Error("invalid HEAD response", rs)
+	}
+
+	c.Add(31 * time.Second)
+	if rs := serve(f, b, get("/foo")); rs.header.Get(CacheHeader) != "MISS" || b.count() != 2 {
+		t.Error("expired response served", rs)
+	}
+}
+
+func TestCacheNotStored(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		header  map[string]string
+		request []string
+		status  int
+		args    []interface{}
+	}{{
+		msg:    "no freshness",
+		header: map[string]string{},
+	}, {
+		msg:    "no-store",
+		header: map[string]string{"Cache-Control": "no-store, max-age=60"},
+	}, {
+		msg:    "private",
+		header: map[string]string{"Cache-Control": "private, max-age=60"},
+	}, {
+		msg:    "set-cookie",
+		header: map[string]string{"Cache-Control": "max-age=60", "Set-Cookie": "session=1"},
+	}, {
+		msg:    "vary all",
+		header: map[string]string{"Cache-Control": "max-age=60", "Vary": "*"},
+	}, {
+		msg:     "authorization",
+		header:  map[string]string{"Cache-Control": "max-age=60"},
+		request: []string{"Authorization", "Bearer token"},
+	}, {
+		msg:    "not cacheable status",
+		header: map[string]string{"Cache-Control": "max-age=60"},
+		status: http.StatusInternalServerError,
+	}, {
+		msg:    "expired",
+		header: map[string]string{"Expires": "Thu, 01 Jan 1970 00:00:00 GMT"},
+		args:   []interface{}{"1m"},
+	}} {
+		f := testFilter(t, clock.NewFake(time.Now()), ti.args...)
+		b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range ti.header {
+				w.Header().Set(k, v)
+			}
+
+			if ti.status != 0 {
+				w.WriteHeader(ti.status)
+			}
+		}}
+
+		serve(f, b, get("/foo", ti.request...))
+		serve(f, b, get("/foo", ti.request...))
+		if b.count() != 2 {
+			t.Error(ti.msg, "response stored")
+		}
+	}
+}
+
+func TestCacheDefaultTTL(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	f := testFilter(t, c, "10s")
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {}}
+
+	serve(f, b, get("/foo"))
+	c.Add(5 * time.Second)
+	serve(f, b, get("/foo"))
+	c.Add(6 * time.Second)
+	serve(f, b, get("/foo"))
+	if b.count() != 2 {
+		t.Error("default ttl not applied", b.count())
+	}
+}
+
+func TestCacheRequestDirectives(t *testing.T) {
+	f := testFilter(t, clock.NewFake(time.Now()))
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	}}
+
+	serve(f, b, get("/foo", "Cache-Control", "no-store"))
+	serve(f, b, get("/foo"))
+	if b.count() != 2 {
+		t.Error("response of a no-store request stored")
+	}
+
+	serve(f, b, get("/foo", "Cache-Control", "no-cache"))
+	if b.count() != 3 {
+		t.Error("no-cache request served from the cache")
+	}
+
+	if rs := serve(f, b, get("/foo")); rs.header.Get(CacheHeader) != "HIT" {
+		t.Error("response not cached", rs)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	f := testFilter(t, clock.NewFake(time.Now()))
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}}
+
+	serve(f, b, get("/foo", "Accept-Language", "en"))
+	serve(f, b, get("/foo", "Accept-Language", "de"))
+	if rs := serve(f, b, get("/foo", "Accept-Language", "en")); rs.body != "en" || rs.header.Get(CacheHeader) != "HIT" {
+		t.Error("invalid variant", rs)
+	}
+
+	if rs := serve(f, b, get("/foo", "Accept-Language", "de")); rs.body != "de" || rs.header.Get(CacheHeader) != "HIT" {
+		t.Error("invalid variant", rs)
+	}
+
+	if b.count() != 2 {
+		t.Error("variants not cached", b.count())
+	}
+}
+
+func TestCacheConditionalRequest(t *testing.T) {
+	f := testFilter(t, clock.NewFake(time.Now()))
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Etag", `"v1"`)
+		w.Write([]byte("Hello, world!"))
+	}}
+
+	serve(f, b, get("/foo"))
+	if rs := serve(f, b, get("/foo", "If-None-Match", `"v1"`)); rs.status != http.StatusNotModified || rs.body != "" {
+		t.Error("failed to respond with not modified", rs)
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	f := testFilter(t, c)
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Etag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("Hello, world!"))
+	}}
+
+	serve(f, b, get("/foo"))
+	c.Add(2 * time.Minute)
+
+	r := get("/foo")
+	rs := serve(f, b, r)
+	if rs.status != http.StatusOK || rs.body != "Hello, world!" || rs.header.Get(CacheHeader) != "REVALIDATED" {
+		t.Error("invalid revalidated response", rs)
+	}
+
+	if r.Header.Get("If-None-Match") != "" {
+		t.Error("conditional header of the revalidation left on the request")
+	}
+
+	if rs := serve(f, b, get("/foo")); rs.header.Get(CacheHeader) != "HIT" || rs.body != "Hello, world!" {
+		t.Error("revalidated response not refreshed", rs)
+	}
+
+	if b.count() != 2 {
+		t.Error("invalid number of backend requests", b.count())
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var version int64 = 1
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=30")
+		if atomic.LoadInt64(&version) == 1 {
+			w.Write([]byte("v1"))
+		} else {
+			w.Write([]byte("v2"))
+		}
+	}}
+
+	backend := httptest.NewServer(b)
+	defer backend.Close()
+
+	c := clock.NewFake(time.Now())
+	f := testFilter(t, c)
+	serveStale := func() testResult {
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{
+			FResponseWriter: w,
+			FRequest:        get("/foo"),
+			FStateBag:       map[string]interface{}{},
+			FBackendUrl:     backend.URL}
+		f.Request(ctx)
+		if !ctx.FServed {
+			return testResult{}
+		}
+
+		return testResult{w.Code, w.Header(), w.Body.String()}
+	}
+
+	serve(f, b, get("/foo"))
+	atomic.StoreInt64(&version, 2)
+	c.Add(70 * time.Second)
+
+	rs := serveStale()
+	if rs.body != "v1" || rs.header.Get(CacheHeader) != "STALE" {
+		t.Fatal("stale response not served", rs)
+	}
+
+	var refreshed bool
+	for i := 0; i < 60; i++ {
+		if rs := serveStale(); rs.header.Get(CacheHeader) == "HIT" && rs.body == "v2" {
+			refreshed = true
+			break
+		}
+
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	if !refreshed {
+		t.Error("stale response not refreshed")
+	}
+}
+
+func TestCacheLargeBody(t *testing.T) {
+	f := testFilter(t, clock.NewFake(time.Now()))
+	b := &testBackend{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", maxEntrySize+1)))
+	}}
+
+	serve(f, b, get("/foo"))
+	if rs := serve(f, b, get("/foo")); len(rs.body) != maxEntrySize+1 || b.count() != 2 {
+		t.Error("large response stored")
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package certs implements the TLS certificates of the proxy listener.
+
+A Store holds multiple certificate and key pairs, and selects the one
+presented to a client by the server name that the client sent in the
+TLS handshake (SNI). The names of a certificate are taken from its
+subject alternative names, or, when it has none, from its common name.
+Wildcard names, e.g. *.example.org, match a single label. When no
+certificate matches the server name, or the client didn't send one,
+the first pair is used.
+
+The certificate and key files are checked for changes periodically, by
+their modification time and size, and the changed pairs are reloaded.
+The new certificates are used for the new TLS handshakes, while the
+open connections are not affected. When a changed pair fails to load,
+the error is logged, and the previous certificate remains in use, until
+the files are fixed. To avoid loading partially written files, the
+files should be replaced by renaming.
+
+Optionally, the store obtains and renews the certificates of a list of
+hosts automatically with ACME, e.g. from Let's Encrypt, using the
+tls-alpn-01 challenge on the same listener. These certificates are used
+for the hosts that don't have a matching certificate pair.
+
+The listener can request or require certificates from the clients, too.
+The client certificates are verified against the configured certificate
+authorities, and the verified ones are available to the routing and to
+the filters, e.g. with the ClientCert predicate.
+*/
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default interval of checking the certificate and key files for
+// changes.
+const DefaultReloadInterval = time.Minute
+
+// Error returned by New, when neither certificate pairs nor ACME hosts
+// are set.
+var ErrNoCertificates = errors.New("no certificates configured")
+
+var errNoCertificate = errors.New("no certificate for the server name")
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert}
+
+// A certificate and key file pair, in PEM format.
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// Options of a certificate store.
+type Options struct {
+
+	// The certificate and key file pairs. The first one is used when
+	// no certificate matches the server name of a client.
+	Pairs []Pair
+
+	// The interval of checking the files for changes. Defaults to
+	// DefaultReloadInterval. Negative values disable the reloading.
+	ReloadInterval time.Duration
+
+	// The hosts whose certificates are obtained and renewed
+	// automatically with ACME.
+	ACMEHosts []string
+
+	// Directory where the ACME account key and certificates are
+	// stored across restarts. When not set, they are kept only in
+	// memory.
+	ACMECacheDir string
+
+	// Contact email address of the ACME account, optional.
+	ACMEEmail string
+
+	// The directory URL of the ACME server. Defaults to the one of
+	// Let's Encrypt.
+	ACMEDirectoryURL string
+
+	// Defines whether the listener requests or requires certificates
+	// from the clients, and whether it verifies them. Defaults to
+	// tls.NoClientCert.
+	ClientAuth tls.ClientAuthType
+
+	// Files of the certificate authorities, in PEM format, used to
+	// verify the client certificates. When not set, the system roots
+	// are used.
+	ClientCAFiles []string
+}
+
+// the state of the files of a pair, to detect changes
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// the last loaded version of a pair
+type loadedPair struct {
+	pair      Pair
+	certState fileState
+	keyState  fileState
+	cert      *tls.Certificate
+	names     []string
+}
+
+// A Store holds the certificates of a TLS listener, and selects them by
+// the server name of the clients.
+type Store struct {
+	mx     sync.Mutex
+	pairs  []*loadedPair
+	byName map[string]*tls.Certificate
+	acme   *autocert.Manager
+	quit   chan struct{}
+	once   sync.Once
+
+	clientAuth tls.ClientAuthType
+	clientCAs  *x509.CertPool
+}
+
+func statFile(name string) (fileState, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	return fileState{fi.ModTime(), fi.Size()}, nil
+}
+
+// returns the names that a certificate is valid for
+func certNames(cert *tls.Certificate) ([]string, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("empty certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Leaf = leaf
+	names := leaf.DNSNames
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = []string{leaf.Subject.CommonName}
+	}
+
+	for i := range names {
+		names[i] = strings.ToLower(names[i])
+	}
+
+	return names, nil
+}
+
+// loads a pair, when its files changed since the last load. It returns
+// false, when the pair didn't change.
+func (lp *loadedPair) load() (bool, error) {
+	cs, err := statFile(lp.pair.CertFile)
+	if err != nil {
+		return false, err
+	}
+
+	ks, err := statFile(lp.pair.KeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	if lp.cert != nil && cs == lp.certState && ks == lp.keyState {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(lp.pair.CertFile, lp.pair.KeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	names, err := certNames(&cert)
+	if err != nil {
+		return false, err
+	}
+
+	lp.certState, lp.keyState = cs, ks
+	lp.cert, lp.names = &cert, names
+	return true, nil
+}
+
+// ParseClientAuth parses the name of a client certificate mode: none,
+// request, require, verify-if-given or require-and-verify. Only the
+// certificates of the last two modes are verified.
+func ParseClientAuth(name string) (tls.ClientAuthType, error) {
+	if t, ok := clientAuthTypes[name]; ok {
+		return t, nil
+	}
+
+	return tls.NoClientCert, fmt.Errorf("invalid client certificate mode: %s", name)
+}
+
+// loads the certificate authorities used to verify the client
+// certificates
+func loadClientCAs(files []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", f)
+		}
+	}
+
+	return pool, nil
+}
+
+// Creates a certificate store, loading the certificate pairs, and, when
+// the reloading is not disabled, starts checking the files for changes.
+// It fails when a pair cannot be loaded.
+func New(o Options) (*Store, error) {
+	if len(o.Pairs) == 0 && len(o.ACMEHosts) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	s := &Store{quit: make(chan struct{}), clientAuth: o.ClientAuth}
+	if len(o.ClientCAFiles) > 0 {
+		pool, err := loadClientCAs(o.ClientCAFiles)
+		if err != nil {
+			return nil, err
+		}
+
+		s.clientCAs = pool
+	}
+
+	for _, p := range o.Pairs {
+		lp := &loadedPair{pair: p}
+		if _, err := lp.load(); err != nil {
+			return nil, err
+		}
+
+		s.pairs = append(s.pairs, lp)
+	}
+
+	s.index()
+
+	if len(o.ACMEHosts) > 0 {
+		s.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.ACMEHosts...),
+			Email:      o.ACMEEmail}
+		if o.ACMECacheDir != "" {
+			s.acme.Cache = autocert.DirCache(o.ACMECacheDir)
+		}
+
+		if o.ACMEDirectoryURL != "" {
+			s.acme.Client = &acme.Client{DirectoryURL: o.ACMEDirectoryURL}
+		}
+	}
+
+	interval := o.ReloadInterval
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+
+	if interval > 0 && len(s.pairs) > 0 {
+		go s.watch(interval)
+	}
+
+	return s, nil
+}
+
+// builds the lookup of the certificates by name. When multiple pairs
+// have the same name, the first one is used.
+func (s *Store) index() {
+	byName := make(map[string]*tls.Certificate)
+	for _, lp := range s.pairs {
+		for _, n := range lp.names {
+			if _, exists := byName[n]; !exists {
+				byName[n] = lp.cert
+			}
+		}
+	}
+
+	s.byName = byName
+}
+
+func (s *Store) watch(interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+			s.Reload()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Reload checks the certificate and key files, and reloads the changed
+// pairs. The pairs failing to load keep their previous certificate.
+func (s *Store) Reload() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var changed bool
+	for _, lp := range s.pairs {
+		c, err := lp.load()
+		if err != nil {
+			log.Errorf("failed to reload the certificate %s: %v", lp.pair.CertFile, err)
+			continue
+		}
+
+		if c {
+			log.Infof("certificate reloaded: %s, names: %s", lp.pair.CertFile, strings.Join(lp.names, ", "))
+			changed = true
+		}
+	}
+
+	if changed {
+		s.index()
+	}
+}
+
+// returns the certificate of a pair matching the server name, exactly or
+// by a wildcard, or nil
+func (s *Store) lookup(name string) *tls.Certificate {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if cert, ok := s.byName[name]; ok {
+		return cert
+	}
+
+	if i := strings.Index(name, "."); i > 0 {
+		if cert, ok := s.byName["*"+name[i:]]; ok {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+// returns the certificate of the first pair, or nil
+func (s *Store) defaultCertificate() *tls.Certificate {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.pairs) == 0 {
+		return nil
+	}
+
+	return s.pairs[0].cert
+}
+
+func isACMEChallenge(hello *tls.ClientHelloInfo) bool {
+	for _, p := range hello.SupportedProtos {
+		if p == acme.ALPNProto {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCertificate selects the certificate for a TLS handshake, meant to
+// be used as the GetCertificate function of a tls.Config.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if s.acme != nil && isACMEChallenge(hello) {
+		return s.acme.GetCertificate(hello)
+	}
+
+	if name != "" {
+		if cert := s.lookup(name); cert != nil {
+			return cert, nil
+		}
+
+		if s.acme != nil && s.acme.HostPolicy(context.Background(), name) == nil {
+			return s.acme.GetCertificate(hello)
+		}
+	}
+
+	if cert := s.defaultCertificate(); cert != nil {
+		return cert, nil
+	}
+
+	return nil, errNoCertificate
+}
+
+// TLSConfig returns a TLS configuration for a listener, that selects the
+// certificates from the store, and handles the client certificates as
+// set in the options.
+func (s *Store) TLSConfig() *tls.Config {
+	c := &tls.Config{
+		GetCertificate: s.GetCertificate,
+		ClientAuth:     s.clientAuth,
+		ClientCAs:      s.clientCAs}
+	if s.acme != nil {
+		c.NextProtos = []string{"http/1.1", acme.ALPNProto}
+	}
+
+	return c
+}
+
+// Close stops checking the files for changes.
+func (s *Store) Close() {
+	s.once.Do(func() { close(s.quit) })
+}
@@ -0,0 +1,282 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writes a self-signed certificate and its key to the directory, and
+// returns the pair
+func writePair(t *testing.T, dir, name string, serial int64, names ...string) Pair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := Pair{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key")}
+	if err := ioutil.WriteFile(p.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(p.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "skipper-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func serial(t *testing.T, s *Store, serverName string) int64 {
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestNoCertificates(t *testing.T) {
+	if _, err := New(Options{}); err != ErrNoCertificates {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestInvalidPair(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := New(Options{Pairs: []Pair{{filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key")}}}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestSelectBySNI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Options{
+		Pairs: []Pair{
+			writePair(t, dir, "default", 1, "www.example.org"),
+			writePair(t, dir, "api", 2, "api.example.org", "API2.example.org"),
+			writePair(t, dir, "wildcard", 3, "*.apps.example.org"),
+		},
+		ReloadInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for _, ti := range []struct {
+		serverName string
+		serial     int64
+	}{
+		{"", 1},
+		{"www.example.org", 1},
+		{"api.example.org", 2},
+		{"api2.example.org", 2},
+		{"API.example.org.", 2},
+		{"foo.apps.example.org", 3},
+		{"foo.bar.apps.example.org", 1},
+		{"unknown.example.org", 1},
+	} {
+		if s := serial(t, s, ti.serverName); s != ti.serial {
+			t.Error("unexpected certificate", ti.serverName, s)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Options{
+		Pairs:          []Pair{writePair(t, dir, "api", 1, "api.example.org")},
+		ReloadInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	// invalid content keeps the previous certificate
+	p := s.pairs[0].pair
+	if err := ioutil.WriteFile(p.CertFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Reload()
+	if serial(t, s, "api.example.org") != 1 {
+		t.Error("failed to keep the previous certificate")
+	}
+
+	writePair(t, dir, "api", 2, "api.example.org", "www.example.org")
+	s.Reload()
+	if serial(t, s, "api.example.org") != 2 || serial(t, s, "www.example.org") != 2 {
+		t.Error("failed to reload the certificate")
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Options{
+		Pairs: []Pair{
+			writePair(t, dir, "www", 1, "www.example.org"),
+			writePair(t, dir, "api", 2, "api.example.org"),
+		},
+		ReloadInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", s.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "api.example.org", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+	if peer := conn.ConnectionState().PeerCertificates; len(peer) == 0 || peer[0].SerialNumber.Int64() != 2 {
+		t.Error("failed to select the certificate by the server name")
+	}
+}
+
+func TestInvalidClientCA(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	p := writePair(t, dir, "www", 1, "www.example.org")
+	if _, err := New(Options{
+		Pairs:          []Pair{p},
+		ReloadInterval: -1,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAFiles:  []string{p.KeyFile}}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	client := writePair(t, dir, "client", 3, "client.example.org")
+	s, err := New(Options{
+		Pairs:          []Pair{writePair(t, dir, "www", 1, "www.example.org")},
+		ReloadInterval: -1,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAFiles:  []string{client.CertFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", s.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	verified := make(chan bool, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			verified <- false
+			return
+		}
+
+		defer c.Close()
+		tc := c.(*tls.Conn)
+		verified <- tc.Handshake() == nil && len(tc.ConnectionState().VerifiedChains) > 0
+	}()
+
+	cert, err := tls.LoadX509KeyPair(client.CertFile, client.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+		ServerName:         "www.example.org",
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+	if !<-verified {
+		t.Error("failed to verify the client certificate")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"strconv"
+	"strings"
+)
+
+// data client inserting the chaos filters configured in the
+// annotations of the routes
+type client struct {
+	routing.DataClient
+}
+
+// Wraps a data client, inserting the chaos filters configured in the
+// annotations of the loaded routes in front of their other filters.
+// The annotations have the name of the filters, and their values are
+// the comma separated arguments of the filters, e.g.:
+//
+//     @chaosLatency("5, 800ms") @chaosError("1, 500")
+//     checkout: Path("/checkout") -> "https://checkout.example.org";
+//
+// The routes with invalid arguments in the annotations are rejected by
+// the routing, the same way as the routes with invalid filters.
+func Client(c routing.DataClient) routing.DataClient {
+	return &client{c}
+}
+
+// parses the value of an annotation as filter arguments
+func annotationArgs(v string) []interface{} {
+	var args []interface{}
+	for _, a := range strings.Split(v, ",") {
+		a = strings.TrimSpace(a)
+		if n, err := strconv.ParseFloat(a, 64); err == nil {
+			args = append(args, n)
+		} else {
+			args = append(args, a)
+		}
+	}
+
+	return args
+}
+
+// returns a copy of the route with the chaos filters inserted, or the
+// route itself, when it has no chaos annotations
+func annotated(r *eskip.Route) *eskip.Route {
+	var fs []*eskip.Filter
+	for _, name := range []string{LatencyName, ErrorName} {
+		if v, ok := r.Metadata[name]; ok {
+			fs = append(fs, &eskip.Filter{Name: name, Args: annotationArgs(v)})
+		}
+	}
+
+	if len(fs) == 0 {
+		return r
+	}
+
+	c := *r
+	c.Filters = append(fs, r.Filters...)
+	return &c
+}
+
+func annotatedRoutes(routes []*eskip.Route) []*eskip.Route {
+	var a []*eskip.Route
+	for _, r := range routes {
+		a = append(a, annotated(r))
+	}
+
+	return a
+}
+
+func (c *client) LoadAll() ([]*eskip.Route, error) {
+	routes, err := c.DataClient.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return annotatedRoutes(routes), nil
+}
+
+func (c *client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	routes, deletedIds, err := c.DataClient.LoadUpdate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return annotatedRoutes(routes), deletedIds, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		@chaosLatency("5, 800ms") @chaosError("1")
+		both: Path("/both") -> requestHeader("X-Foo", "bar") -> "https://www.example.org";
+
+		@chaosError("10, 500")
+		errors: Path("/errors") -> "https://www.example.org";
+
+		@owner("team")
+		none: Path("/none") -> "https://www.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := dc.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := Client(dc).LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := make(map[string][]*eskip.Filter)
+	for _, r := range routes {
+		filters[r.Id] = r.Filters
+	}
+
+	for id, expected := range map[string][]*eskip.Filter{
+		"both": {
+			{Name: LatencyName, Args: []interface{}{float64(5), "800ms"}},
+			{Name: ErrorName, Args: []interface{}{float64(1)}},
+			{Name: "requestHeader", Args: []interface{}{"X-Foo", "bar"}},
+		},
+		"errors": {{Name: ErrorName, Args: []interface{}{float64(10), float64(500)}}},
+		"none":   nil,
+	} {
+		if !reflect.DeepEqual(filters[id], expected) {
+			t.Error("invalid filters", id, filters[id])
+		}
+	}
+
+	for _, r := range original {
+		if r.Id == "both" && len(r.Filters) != 1 {
+			t.Error("the original route was changed")
+		}
+	}
+}
+
+func TestAnnotationsUpdate(t *testing.T) {
+	dc := testdataclient.New(nil)
+	c := Client(dc)
+	if _, err := c.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := eskip.Parse(`@chaosError("1") route1: Any() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go dc.Update(update, []string{"route2"})
+	routes, deleted, err := c.LoadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 1 || len(routes[0].Filters) != 1 || routes[0].Filters[0].Name != ErrorName {
+		t.Error("failed to insert the filter into the updated route", routes)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "route2" {
+		t.Error("failed to pass the deleted ids", deleted)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package chaos implements filters injecting faults into the requests of
+the routes, for chaos experiments, and a global switch to stop all the
+experiments at once, e.g. during incidents.
+
+The experiments are configured per route, by adding the chaosLatency or
+the chaosError filter to the route definitions, with the percentage of
+the affected requests, e.g.:
+
+	checkout: Path("/checkout") -> chaosLatency(5, "800ms") -> "https://checkout.example.org";
+	search: Path("/search") -> chaosError(1, 503) -> "https://search.example.org";
+
+The experiments can be configured also with route annotations, having
+the name of the filters, and the comma separated arguments of the
+filters as their value. See Client.
+
+	@chaosLatency("5, 800ms")
+	checkout: Path("/checkout") -> "https://checkout.example.org";
+
+When the switch is turned off, the filters pass all the requests
+unchanged, without requiring a change of the routes. Skipper exposes the
+switch on the token-authenticated /admin/chaos endpoint of the support
+listener, see the admin package:
+
+	curl -H "Authorization: Bearer $TOKEN" localhost:9911/admin/chaos
+	curl -X PUT -H "Authorization: Bearer $TOKEN" -d '{"enabled": false}' localhost:9911/admin/chaos
+
+The injected faults are counted in the metrics, by route and by the kind
+of the fault, latency or error.
+*/
+package chaos
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"sync/atomic"
+)
+
+// Global switch of the chaos experiments. A nil switch is always
+// enabled.
+type Switch struct {
+	disabled int32
+}
+
+type switchState struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Creates a switch, initially enabled or disabled.
+func NewSwitch(enabled bool) *Switch {
+	s := &Switch{}
+	if !enabled {
+		s.disabled = 1
+	}
+
+	return s
+}
+
+// Tells whether the experiments are enabled.
+func (s *Switch) Enabled() bool {
+	return s == nil || atomic.LoadInt32(&s.disabled) == 0
+}
+
+// Enables the experiments.
+func (s *Switch) Enable() {
+	atomic.StoreInt32(&s.disabled, 0)
+	log.Info("chaos experiments enabled")
+}
+
+// Disables the experiments. The filters pass the requests unchanged,
+// until the switch is enabled again.
+func (s *Switch) Disable() {
+	atomic.StoreInt32(&s.disabled, 1)
+	log.Info("chaos experiments disabled")
+}
+
+// Responds with the state of the switch to the GET requests, and sets
+// it on the PUT requests, whose body is the JSON state, e.g.:
+//
+//     {"enabled": false}
+//
+// The endpoint doesn't authenticate the clients, so it should be
+// exposed only behind authentication, e.g. on the admin API.
+func (s *Switch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var state switchState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if state.Enabled {
+			s.Enable()
+		} else {
+			s.Disable()
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(switchState{Enabled: s.Enabled()})
+}
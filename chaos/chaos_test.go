@@ -0,0 +1,119 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	var nilSwitch *Switch
+	if !nilSwitch.Enabled() {
+		t.Error("nil switch should be enabled")
+	}
+
+	s := NewSwitch(false)
+	if s.Enabled() {
+		t.Error("failed to create disabled switch")
+	}
+
+	s.Enable()
+	if !s.Enabled() {
+		t.Error("failed to enable switch")
+	}
+
+	s.Disable()
+	if s.Enabled() {
+		t.Error("failed to disable switch")
+	}
+}
+
+func TestSwitchEndpoint(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		method  string
+		body    string
+		status  int
+		enabled bool
+	}{{
+		"get state",
+		"GET",
+		"",
+		http.StatusOK,
+		true,
+	}, {
+		"disable",
+		"PUT",
+		`{"enabled": false}`,
+		http.StatusOK,
+		false,
+	}, {
+		"enable",
+		"PUT",
+		`{"enabled": true}`,
+		http.StatusOK,
+		true,
+	}, {
+		"invalid body",
+		"PUT",
+		`{"enabled":`,
+		http.StatusBadRequest,
+		true,
+	}, {
+		"method not allowed",
+		"POST",
+		`{"enabled": false}`,
+		http.StatusMethodNotAllowed,
+		true,
+	}} {
+		s := NewSwitch(true)
+		r, err := http.NewRequest(ti.method, "http://www.example.org/chaos", bytes.NewBufferString(ti.body))
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		if w.Code != ti.status {
+			t.Error(ti.msg, "invalid status", w.Code, ti.status)
+			continue
+		}
+
+		if s.Enabled() != ti.enabled {
+			t.Error(ti.msg, "invalid switch state")
+			continue
+		}
+
+		if ti.status != http.StatusOK {
+			continue
+		}
+
+		var state switchState
+		if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if state.Enabled != ti.enabled {
+			t.Error(ti.msg, "invalid state in the response")
+		}
+	}
+}
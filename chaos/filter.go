@@ -0,0 +1,175 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	// The name of the filter delaying the requests.
+	LatencyName = "chaosLatency"
+
+	// The name of the filter failing the requests.
+	ErrorName = "chaosError"
+)
+
+type faultType int
+
+const (
+	latencyFault faultType = iota
+	errorFault
+)
+
+type spec struct {
+	typ    faultType
+	sw     *Switch
+	random func() float64
+}
+
+type filter struct {
+	typ        faultType
+	sw         *Switch
+	random     func() float64
+	percentage float64
+	latency    time.Duration
+	status     int
+}
+
+// Returns a filter specification whose instances delay a percentage of
+// the requests, before they are forwarded to the backend, while the
+// switch is enabled. Instances expect the percentage, 0-100, and the
+// delay, e.g.:
+//
+//     chaosLatency(5, "800ms")
+//
+// The delay ends early, when the deadline of the request filters
+// expires.
+//
+// Name: "chaosLatency".
+func NewLatency(s *Switch) filters.Spec {
+	return &spec{typ: latencyFault, sw: s, random: rand.Float64}
+}
+
+// Returns a filter specification whose instances respond to a
+// percentage of the requests with an error, instead of forwarding them
+// to the backend, while the switch is enabled. Instances expect the
+// percentage, 0-100, and optionally the status code of the error
+// responses, 500-599, that defaults to 503, e.g.:
+//
+//     chaosError(1)
+//     chaosError(10, 500)
+//
+// Name: "chaosError".
+func NewError(s *Switch) filters.Spec {
+	return &spec{typ: errorFault, sw: s, random: rand.Float64}
+}
+
+// "chaosLatency" or "chaosError"
+func (s *spec) Name() string {
+	if s.typ == latencyFault {
+		return LatencyName
+	}
+
+	return ErrorName
+}
+
+func (s *spec) Description() string {
+	if s.typ == latencyFault {
+		return "Delays a percentage of the requests, as a chaos experiment."
+	}
+
+	return "Fails a percentage of the requests, as a chaos experiment."
+}
+
+func (s *spec) Schema() []filters.Arg {
+	if s.typ == latencyFault {
+		return []filters.Arg{
+			{Name: "percentage", Type: filters.NumberType},
+			{Name: "latency", Type: filters.DurationType},
+		}
+	}
+
+	return []filters.Arg{
+		{Name: "percentage", Type: filters.NumberType},
+		{Name: "status", Type: filters.NumberType, Optional: true},
+	}
+}
+
+func (s *spec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	percentage, ok := config[0].(float64)
+	if !ok || percentage < 0 || percentage > 100 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{typ: s.typ, sw: s.sw, random: s.random, percentage: percentage}
+	if s.typ == latencyFault {
+		if len(config) != 2 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if f.latency, ok = filters.DurationArg(config[1]); !ok || f.latency <= 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		return f, nil
+	}
+
+	f.status = http.StatusServiceUnavailable
+	if len(config) == 2 {
+		status, ok := config[1].(float64)
+		if !ok || status < 500 || status > 599 || status != float64(int(status)) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.status = int(status)
+	}
+
+	return f, nil
+}
+
+// Injects the fault into the selected requests.
+func (f *filter) Request(ctx filters.FilterContext) {
+	if !f.sw.Enabled() || f.random()*100 >= f.percentage {
+		return
+	}
+
+	routeId, _ := ctx.StateBag()[filters.RouteIdKey].(string)
+	if f.typ == errorFault {
+		metrics.IncChaosInjected(routeId, "error")
+		ctx.ResponseWriter().WriteHeader(f.status)
+		ctx.MarkServed()
+		return
+	}
+
+	metrics.IncChaosInjected(routeId, "latency")
+	t := time.NewTimer(f.latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Context().Done():
+	}
+}
+
+// Noop.
+func (f *filter) Response(filters.FilterContext) {}
@@ -0,0 +1,197 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type canceledContext struct {
+	done chan struct{}
+}
+
+func (c *canceledContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (c *canceledContext) Done() <-chan struct{}       { return c.done }
+func (c *canceledContext) Err() error                  { return filters.ErrDeadlineExceeded }
+
+func constRandom(v float64) func() float64 {
+	return func() float64 { return v }
+}
+
+func testContext() *filtertest.Context {
+	r, _ := http.NewRequest("GET", "https://www.example.org", nil)
+	return &filtertest.Context{
+		FRequest:        r,
+		FResponseWriter: httptest.NewRecorder(),
+		FStateBag:       map[string]interface{}{filters.RouteIdKey: "testRoute"},
+	}
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, ti := range []struct {
+		msg  string
+		spec filters.Spec
+		args []interface{}
+		err  bool
+	}{{
+		"latency, no args",
+		NewLatency(nil),
+		nil,
+		true,
+	}, {
+		"latency, missing latency",
+		NewLatency(nil),
+		[]interface{}{float64(5)},
+		true,
+	}, {
+		"latency, percentage out of range",
+		NewLatency(nil),
+		[]interface{}{float64(120), "100ms"},
+		true,
+	}, {
+		"latency, invalid latency",
+		NewLatency(nil),
+		[]interface{}{float64(5), "foo"},
+		true,
+	}, {
+		"latency",
+		NewLatency(nil),
+		[]interface{}{float64(5), "100ms"},
+		false,
+	}, {
+		"error, no args",
+		NewError(nil),
+		nil,
+		true,
+	}, {
+		"error, invalid percentage",
+		NewError(nil),
+		[]interface{}{"5"},
+		true,
+	}, {
+		"error, status not a server error",
+		NewError(nil),
+		[]interface{}{float64(5), float64(404)},
+		true,
+	}, {
+		"error, too many args",
+		NewError(nil),
+		[]interface{}{float64(5), float64(500), float64(1)},
+		true,
+	}, {
+		"error, default status",
+		NewError(nil),
+		[]interface{}{float64(5)},
+		false,
+	}, {
+		"error",
+		NewError(nil),
+		[]interface{}{float64(5), float64(502)},
+		false,
+	}} {
+		_, err := ti.spec.CreateFilter(ti.args)
+		if ti.err && err == nil {
+			t.Error(ti.msg, "failed to fail")
+		} else if !ti.err && err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
+
+func TestInjectError(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		random  float64
+		enabled bool
+		served  bool
+	}{{
+		"selected",
+		0.01,
+		true,
+		true,
+	}, {
+		"not selected",
+		0.99,
+		true,
+		false,
+	}, {
+		"disabled",
+		0.01,
+		false,
+		false,
+	}} {
+		s := &spec{typ: errorFault, sw: NewSwitch(ti.enabled), random: constRandom(ti.random)}
+		f, err := s.CreateFilter([]interface{}{float64(10), float64(502)})
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		ctx := testContext()
+		f.Request(ctx)
+		if ctx.FServed != ti.served {
+			t.Error(ti.msg, "invalid served state")
+			continue
+		}
+
+		if ti.served && ctx.FResponseWriter.(*httptest.ResponseRecorder).Code != http.StatusBadGateway {
+			t.Error(ti.msg, "invalid status")
+		}
+	}
+}
+
+func TestInjectLatency(t *testing.T) {
+	s := &spec{typ: latencyFault, random: constRandom(0)}
+	f, err := s.CreateFilter([]interface{}{float64(50), "30ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	f.Request(testContext())
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("failed to delay the request")
+	}
+}
+
+func TestLatencyCanceled(t *testing.T) {
+	s := &spec{typ: latencyFault, random: constRandom(0)}
+	f, err := s.CreateFilter([]interface{}{float64(50), "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := testContext()
+	done := make(chan struct{})
+	close(done)
+	ctx.FContext = &canceledContext{done}
+
+	finished := make(chan struct{})
+	go func() {
+		f.Request(ctx)
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Error("failed to cancel the delay")
+	}
+}
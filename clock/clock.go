@@ -0,0 +1,126 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package clock provides the time source used by the time based features
+of skipper, e.g. the expiration of the routes, or the error windows of
+the failover filter.
+
+Reading the time through the Clock interface, instead of calling the
+time package directly, lets these features be tested deterministically
+with the Fake clock, and keeps the handling of the system clock in a
+single place.
+*/
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time and of the timers.
+type Clock interface {
+
+	// Returns the current time.
+	Now() time.Time
+
+	// Returns a channel that receives the current time, after the
+	// duration d elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type system struct{}
+
+// The clock based on the system time.
+var System Clock = system{}
+
+func (system) Now() time.Time                         { return time.Now() }
+func (system) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Returns the system clock, when c is nil, otherwise c.
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+
+	return c
+}
+
+type timer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// Fake is a clock whose time changes only when it is advanced
+// explicitly, meant for tests.
+type Fake struct {
+	mx     sync.Mutex
+	now    time.Time
+	timers []timer
+}
+
+// Creates a fake clock, set to the time now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Returns the current time of the fake clock.
+func (f *Fake) Now() time.Time {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.now
+}
+
+// Returns a channel that receives the time, when the fake clock is
+// advanced by at least d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+
+	f.timers = append(f.timers, timer{f.now.Add(d), c})
+	return c
+}
+
+// Returns the number of the timers waiting for the fake clock to be
+// advanced.
+func (f *Fake) Timers() int {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return len(f.timers)
+}
+
+// Advances the fake clock by d, and fires the timers that are due.
+func (f *Fake) Add(d time.Duration) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.now = f.now.Add(d)
+	var waiting []timer
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			waiting = append(waiting, t)
+			continue
+		}
+
+		t.c <- f.now
+	}
+
+	f.timers = waiting
+}
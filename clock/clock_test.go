@@ -0,0 +1,77 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrSystem(t *testing.T) {
+	if OrSystem(nil) != System {
+		t.Error("failed to default to the system clock")
+	}
+
+	f := NewFake(time.Now())
+	if OrSystem(f) != f {
+		t.Error("failed to keep the clock")
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Error("invalid time", f.Now())
+	}
+
+	select {
+	case <-f.After(0):
+	default:
+		t.Error("failed to fire the elapsed timer")
+	}
+
+	short, long := f.After(time.Second), f.After(time.Minute)
+	if f.Timers() != 2 {
+		t.Error("invalid number of timers", f.Timers())
+	}
+
+	f.Add(time.Second)
+	select {
+	case now := <-short:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Error("invalid time received", now)
+		}
+	default:
+		t.Error("failed to fire the timer")
+	}
+
+	select {
+	case <-long:
+		t.Error("the timer fired too early")
+	default:
+	}
+
+	f.Add(time.Minute)
+	select {
+	case <-long:
+	default:
+		t.Error("failed to fire the timer")
+	}
+
+	if f.Timers() != 0 || !f.Now().Equal(start.Add(time.Minute+time.Second)) {
+		t.Error("invalid state", f.Timers(), f.Now())
+	}
+}
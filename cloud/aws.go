@@ -0,0 +1,527 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	awsMetadataUrl      = "http://169.254.169.254/latest"
+	awsTokenPath        = "/api/token"
+	awsCredentialsPath  = "/meta-data/iam/security-credentials/"
+	awsRegionPath       = "/meta-data/placement/region"
+	awsEC2Version       = "2016-11-15"
+	awsELBVersion       = "2015-12-01"
+	awsTimeFormat       = "20060102T150405Z"
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+
+	// the credentials are renewed this long before they expire
+	awsCredentialsMargin = 5 * time.Minute
+
+	// the headers of the session tokens of the instance metadata
+	// service, version 2
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// the lifetime of the metadata session tokens, and the margin of
+	// renewing them
+	awsTokenTTL    = 6 * time.Hour
+	awsTokenMargin = time.Minute
+)
+
+var errAWSNoSource = errors.New("either a target group or a tag is required")
+
+type awsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// the relevant parts of the DescribeInstances response
+type awsInstancesResponse struct {
+	Reservations []struct {
+		Instances []struct {
+			Id               string `xml:"instanceId"`
+			PrivateIpAddress string `xml:"privateIpAddress"`
+			State            string `xml:"instanceState>name"`
+		} `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+// the relevant parts of the DescribeTargetHealth response
+type awsTargetHealthResponse struct {
+	Targets []struct {
+		Id    string `xml:"Target>Id"`
+		Port  int    `xml:"Target>Port"`
+		State string `xml:"TargetHealth>State"`
+	} `xml:"DescribeTargetHealthResult>TargetHealthDescriptions>member"`
+}
+
+type awsDiscovery struct {
+	region      string
+	targetGroup string
+	tags        map[string]string
+	port        int
+
+	metadataUrl string
+	ec2Url      string
+	elbUrl      string
+	now         func() time.Time
+
+	mx          sync.Mutex
+	credentials *awsCredentials
+	token       string
+	tokenExpiry time.Time
+}
+
+func newAWSDiscovery(options map[string]string) (*awsDiscovery, error) {
+	d := &awsDiscovery{
+		region:      os.Getenv("AWS_REGION"),
+		tags:        make(map[string]string),
+		metadataUrl: awsMetadataUrl,
+		now:         time.Now}
+
+	for k, v := range options {
+		switch {
+		case k == "region":
+			d.region = v
+		case k == "target-group":
+			d.targetGroup = v
+		case k == "port":
+		case strings.HasPrefix(k, "tag.") && len(k) > len("tag."):
+			d.tags[k[len("tag."):]] = v
+		default:
+			return nil, fmt.Errorf("unknown option: %s", k)
+		}
+	}
+
+	if d.targetGroup == "" && len(d.tags) == 0 {
+		return nil, errAWSNoSource
+	}
+
+	port, err := parsePort(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if port == 0 && d.targetGroup == "" {
+		return nil, errMissingOption
+	}
+
+	d.port = port
+	return d, nil
+}
+
+// escapes the query values as expected by the AWS signature
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// returns the query string in the canonical form, with the keys sorted
+func awsQuery(params map[string]string) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var q []string
+	for _, k := range keys {
+		q = append(q, awsEscape(k)+"="+awsEscape(params[k]))
+	}
+
+	return strings.Join(q, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Signs a request with the AWS signature version 4. All the headers set
+// on the request are signed, together with the host. The query of the
+// request URL is expected in the canonical form.
+func awsSign(r *http.Request, body []byte, c *awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(awsTimeFormat)
+	date := amzDate[:8]
+
+	r.Header.Set("X-Amz-Date", amzDate)
+	if c.Token != "" {
+		r.Header.Set("X-Amz-Security-Token", c.Token)
+	}
+
+	headers := map[string]string{"host": r.URL.Host}
+	for k, v := range r.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, n := range names {
+		canonicalHeaders += n + ":" + headers[n] + "\n"
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		path,
+		r.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	r.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm,
+		c.AccessKeyId,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func readResponse(rsp *http.Response, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		const maxErrorBody = 512
+		if len(b) > maxErrorBody {
+			b = b[:maxErrorBody]
+		}
+
+		return nil, fmt.Errorf("%s: %s", rsp.Status, strings.TrimSpace(string(b)))
+	}
+
+	return b, nil
+}
+
+// returns a session token of the instance metadata service (IMDSv2),
+// renewed before it expires. When the token cannot be requested, e.g.
+// because only IMDSv1 is available, it returns an empty token, and the
+// metadata is requested without it. Expects the lock to be held.
+func (d *awsDiscovery) metadataToken() string {
+	now := d.now()
+	if d.token != "" && now.Add(awsTokenMargin).Before(d.tokenExpiry) {
+		return d.token
+	}
+
+	req, err := http.NewRequest("PUT", d.metadataUrl+awsTokenPath, nil)
+	if err != nil {
+		return ""
+	}
+
+	req.Header.Set(awsTokenTTLHeader, strconv.Itoa(int(awsTokenTTL/time.Second)))
+	b, err := readResponse(httpClient.Do(req))
+	if err != nil {
+		d.token = ""
+		return ""
+	}
+
+	d.token = strings.TrimSpace(string(b))
+	d.tokenExpiry = now.Add(awsTokenTTL)
+	return d.token
+}
+
+// requests the instance metadata, with a session token, when available.
+// Expects the lock to be held.
+func (d *awsDiscovery) metadata(path string) (string, error) {
+	req, err := http.NewRequest("GET", d.metadataUrl+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if token := d.metadataToken(); token != "" {
+		req.Header.Set(awsTokenHeader, token)
+	}
+
+	b, err := readResponse(httpClient.Do(req))
+	return strings.TrimSpace(string(b)), err
+}
+
+// returns the configured region, or the region of the current instance
+func (d *awsDiscovery) getRegion() (string, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.region != "" {
+		return d.region, nil
+	}
+
+	region, err := d.metadata(awsRegionPath)
+	if err != nil {
+		return "", err
+	}
+
+	if region == "" {
+		return "", errors.New("empty region in the instance metadata")
+	}
+
+	d.region = region
+	return d.region, nil
+}
+
+// returns the credentials from the environment, or the credentials of
+// the instance profile, renewed before they expire
+func (d *awsDiscovery) getCredentials() (*awsCredentials, error) {
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		return &awsCredentials{
+			AccessKeyId:     key,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.credentials != nil && d.now().Add(awsCredentialsMargin).Before(d.credentials.Expiration) {
+		return d.credentials, nil
+	}
+
+	role, err := d.metadata(awsCredentialsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if i := strings.Index(role, "\n"); i >= 0 {
+		role = role[:i]
+	}
+
+	b, err := d.metadata(awsCredentialsPath + role)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &awsCredentials{}
+	if err := json.Unmarshal([]byte(b), c); err != nil {
+		return nil, err
+	}
+
+	d.credentials = c
+	return c, nil
+}
+
+// makes a signed query API call, and decodes the XML response
+func (d *awsDiscovery) call(service, endpoint string, params map[string]string, rsp interface{}) error {
+	region, err := d.getRegion()
+	if err != nil {
+		return err
+	}
+
+	c, err := d.getCredentials()
+	if err != nil {
+		return err
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, region)
+	}
+
+	req, err := http.NewRequest("GET", endpoint+"/?"+awsQuery(params), nil)
+	if err != nil {
+		return err
+	}
+
+	awsSign(req, nil, c, region, service, d.now())
+	b, err := readResponse(httpClient.Do(req))
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(b, rsp)
+}
+
+// returns the running instances matching the filters, mapped from their
+// id to their private IP
+func (d *awsDiscovery) describeInstances(filters map[string][]string) (map[string]string, error) {
+	params := map[string]string{"Action": "DescribeInstances", "Version": awsEC2Version}
+
+	var names []string
+	for n := range filters {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+	for i, n := range names {
+		prefix := "Filter." + strconv.Itoa(i+1)
+		params[prefix+".Name"] = n
+		for j, v := range filters[n] {
+			params[prefix+".Value."+strconv.Itoa(j+1)] = v
+		}
+	}
+
+	ips := make(map[string]string)
+	for {
+		var rsp awsInstancesResponse
+		if err := d.call("ec2", d.ec2Url, params, &rsp); err != nil {
+			return nil, err
+		}
+
+		for _, r := range rsp.Reservations {
+			for _, i := range r.Instances {
+				if i.State == "running" && i.PrivateIpAddress != "" {
+					ips[i.Id] = i.PrivateIpAddress
+				}
+			}
+		}
+
+		if rsp.NextToken == "" {
+			return ips, nil
+		}
+
+		params["NextToken"] = rsp.NextToken
+	}
+}
+
+func (d *awsDiscovery) taggedInstances() ([]string, error) {
+	filters := map[string][]string{"instance-state-name": {"running"}}
+	for k, v := range d.tags {
+		filters["tag:"+k] = []string{v}
+	}
+
+	ips, err := d.describeInstances(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, ip := range ips {
+		addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(d.port)))
+	}
+
+	// keep the order stable between the polls
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+// returns the healthy targets of the target group. The targets not
+// attached to a load balancer are not health checked, so these are
+// returned, too.
+func (d *awsDiscovery) targetGroupInstances() ([]string, error) {
+	var rsp awsTargetHealthResponse
+	if err := d.call("elasticloadbalancing", d.elbUrl, map[string]string{
+		"Action":         "DescribeTargetHealth",
+		"Version":        awsELBVersion,
+		"TargetGroupArn": d.targetGroup,
+	}, &rsp); err != nil {
+		return nil, err
+	}
+
+	var instanceIds []string
+	for _, t := range rsp.Targets {
+		if strings.HasPrefix(t.Id, "i-") {
+			instanceIds = append(instanceIds, t.Id)
+		}
+	}
+
+	var ips map[string]string
+	if len(instanceIds) > 0 {
+		var err error
+		if ips, err = d.describeInstances(map[string][]string{"instance-id": instanceIds}); err != nil {
+			return nil, err
+		}
+	}
+
+	var addresses []string
+	for _, t := range rsp.Targets {
+		if t.State != "healthy" && t.State != "unused" {
+			continue
+		}
+
+		ip := t.Id
+		if strings.HasPrefix(t.Id, "i-") {
+			if ip = ips[t.Id]; ip == "" {
+				continue
+			}
+		}
+
+		port := d.port
+		if port == 0 {
+			port = t.Port
+		}
+
+		addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(port)))
+	}
+
+	return addresses, nil
+}
+
+// Returns the addresses of the registered targets of the target group,
+// or of the running instances matching the tags.
+func (d *awsDiscovery) Instances() ([]string, error) {
+	if d.targetGroup != "" {
+		return d.targetGroupInstances()
+	}
+
+	return d.taggedInstances()
+}
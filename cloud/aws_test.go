@@ -0,0 +1,291 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testTargetGroup = "arn:aws:elasticloadbalancing:eu-central-1:123456789012:targetgroup/api/73e2d6bc24d8a067"
+
+	testTargetHealth = `<DescribeTargetHealthResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTargetHealthResult>
+    <TargetHealthDescriptions>
+      <member>
+        <Target><Id>i-0f76fade</Id><Port>8080</Port></Target>
+        <TargetHealth><State>healthy</State></TargetHealth>
+      </member>
+      <member>
+        <Target><Id>i-0f76fadf</Id><Port>8080</Port></Target>
+        <TargetHealth><State>unhealthy</State></TargetHealth>
+      </member>
+      <member>
+        <Target><Id>10.0.1.7</Id><Port>9090</Port></Target>
+        <TargetHealth><State>unused</State></TargetHealth>
+      </member>
+    </TargetHealthDescriptions>
+  </DescribeTargetHealthResult>
+</DescribeTargetHealthResponse>`
+
+	testInstancesPage1 = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0f76fade</instanceId>
+          <instanceState><name>running</name></instanceState>
+          <privateIpAddress>10.0.1.5</privateIpAddress>
+        </item>
+        <item>
+          <instanceId>i-0f76fadf</instanceId>
+          <instanceState><name>running</name></instanceState>
+          <privateIpAddress>10.0.1.6</privateIpAddress>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+  <nextToken>page2</nextToken>
+</DescribeInstancesResponse>`
+
+	testInstancesPage2 = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0f76fae0</instanceId>
+          <instanceState><name>stopping</name></instanceState>
+          <privateIpAddress>10.0.1.8</privateIpAddress>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`
+)
+
+// serves the metadata, the EC2 and the ELB API, recording the queries.
+// Unless imdsV1 is set, the metadata requires a session token.
+type testAWS struct {
+	server       *httptest.Server
+	queries      []string
+	imdsV1       bool
+	tokenQueries int
+}
+
+func newTestAWS() *testAWS {
+	a := &testAWS{}
+	a.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == awsTokenPath {
+			if a.imdsV1 || r.Method != "PUT" || r.Header.Get(awsTokenTTLHeader) == "" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			a.tokenQueries++
+			fmt.Fprint(w, "metadata-token")
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/meta-data/") && !a.imdsV1 && r.Header.Get(awsTokenHeader) != "metadata-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == awsRegionPath:
+			fmt.Fprint(w, "eu-central-1")
+			return
+		case r.URL.Path == awsCredentialsPath:
+			fmt.Fprint(w, "skipper-role")
+			return
+		case r.URL.Path == awsCredentialsPath+"skipper-role":
+			fmt.Fprintf(w, `{"AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret", "Token": "token", "Expiration": "%s"}`,
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") ||
+			r.Header.Get("X-Amz-Security-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		q := r.URL.Query()
+		a.queries = append(a.queries, r.URL.RawQuery)
+		switch q.Get("Action") {
+		case "DescribeTargetHealth":
+			if q.Get("TargetGroupArn") != testTargetGroup {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprint(w, testTargetHealth)
+		case "DescribeInstances":
+			if q.Get("NextToken") == "page2" {
+				fmt.Fprint(w, testInstancesPage2)
+			} else {
+				fmt.Fprint(w, testInstancesPage1)
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	return a
+}
+
+func (a *testAWS) discovery(t *testing.T, options map[string]string) *awsDiscovery {
+	d, err := newAWSDiscovery(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.metadataUrl = a.server.URL
+	d.ec2Url = a.server.URL
+	d.elbUrl = a.server.URL
+	return d
+}
+
+func checkAddresses(t *testing.T, got []string, expected ...string) {
+	sort.Strings(got)
+	sort.Strings(expected)
+	if !sameEndpoints(got, expected) {
+		t.Error("invalid addresses", got, expected)
+	}
+}
+
+// the example from the AWS documentation of the signature version 4
+func TestAWSSign(t *testing.T) {
+	r, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	now, _ := time.Parse(awsTimeFormat, "20150830T123600Z")
+	awsSign(r, nil, &awsCredentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "iam", now)
+
+	const expected = "AWS4-HMAC-SHA256 " +
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if a := r.Header.Get("Authorization"); a != expected {
+		t.Error("invalid signature", a)
+	}
+}
+
+func TestAWSQuery(t *testing.T) {
+	q := awsQuery(map[string]string{"Filter.1.Value.1": "a b~c", "Action": "DescribeInstances"})
+	if q != "Action=DescribeInstances&Filter.1.Value.1=a%20b~c" {
+		t.Error("invalid query", q)
+	}
+}
+
+func TestAWSTargetGroup(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	a := newTestAWS()
+	defer a.server.Close()
+
+	d := a.discovery(t, map[string]string{"target-group": testTargetGroup})
+	addresses, err := d.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAddresses(t, addresses, "10.0.1.5:8080", "10.0.1.7:9090")
+	if d.region != "eu-central-1" {
+		t.Error("failed to detect the region", d.region)
+	}
+
+	if a.tokenQueries != 1 {
+		t.Error("failed to reuse the metadata token", a.tokenQueries)
+	}
+}
+
+func TestAWSMetadataV1(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	a := newTestAWS()
+	a.imdsV1 = true
+	defer a.server.Close()
+
+	d := a.discovery(t, map[string]string{"target-group": testTargetGroup})
+	addresses, err := d.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAddresses(t, addresses, "10.0.1.5:8080", "10.0.1.7:9090")
+	if d.region != "eu-central-1" {
+		t.Error("failed to detect the region", d.region)
+	}
+}
+
+func TestAWSTargetGroupPort(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	a := newTestAWS()
+	defer a.server.Close()
+
+	d := a.discovery(t, map[string]string{"target-group": testTargetGroup, "port": "80"})
+	addresses, err := d.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAddresses(t, addresses, "10.0.1.5:80", "10.0.1.7:80")
+}
+
+func TestAWSTags(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	a := newTestAWS()
+	defer a.server.Close()
+
+	d := a.discovery(t, map[string]string{"region": "eu-west-1", "tag.Role": "worker", "port": "8080"})
+	addresses, err := d.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameEndpoints(addresses, []string{"10.0.1.5:8080", "10.0.1.6:8080"}) {
+		t.Error("invalid order of the addresses", addresses)
+	}
+
+	if len(a.queries) != 2 ||
+		!strings.Contains(a.queries[0], "Filter.2.Name=tag%3ARole&Filter.2.Value.1=worker") {
+		t.Error("invalid queries", a.queries)
+	}
+}
+
+func TestAWSEnvironmentCredentials(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+
+	a := newTestAWS()
+	defer a.server.Close()
+
+	d := a.discovery(t, map[string]string{"region": "eu-west-1", "target-group": testTargetGroup})
+	if _, err := d.Instances(); err == nil {
+		t.Error("failed to use the environment credentials")
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package cloud implements the discovery of backend instances from the
+metadata APIs of cloud providers, for setups where skipper runs in
+front of autoscaling groups, without an internal load balancer.
+
+The instances can be discovered from an AWS target group, from AWS
+instances matching a set of tags, or from a GCP instance group. The
+membership of the discovered groups is refreshed periodically, and the
+routes can forward the requests to the current members with the
+cloudBackend filter, referencing the groups by name, e.g.:
+
+	api: Path("/api") -> cloudBackend("api") -> <shunt>
+
+The groups are configured with a list of definitions separated by
+semicolons or whitespace, where each definition consists of a name, a
+provider, and the comma separated options of the provider, e.g.:
+
+	api=aws:region=eu-central-1,target-group=arn:aws:elasticloadbalancing:...
+	workers=aws:tag.Role=worker,tag.Stage=live,port=8080
+	search=gcp:project=acme,zone=europe-west1-b,group=search,port=9200
+
+The AWS options are region, target-group, port, and the tags to match,
+prefixed with "tag.". Either a target group or at least one tag is
+required. The port defaults to the port of the registered targets, and
+it is required when the instances are matched by tags. The credentials
+are taken from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+AWS_SESSION_TOKEN environment variables, or, when these are not set,
+from the instance profile. The region defaults to AWS_REGION, or to the
+region of the instance running skipper. The instance metadata is
+requested with the session tokens of IMDSv2, falling back to IMDSv1,
+when the tokens are not available.
+
+The GCP options are project, zone, group and port, where group and port
+are required, while the project and the zone default to the ones of
+the instance running skipper. The access token is taken from the
+service account of the instance.
+*/
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default interval of refreshing the discovered instances.
+const DefaultRefreshInterval = 30 * time.Second
+
+const (
+	awsProvider = "aws"
+	gcpProvider = "gcp"
+)
+
+var (
+	errInvalidDefinition = errors.New("invalid cloud backend definition")
+	errUnknownProvider   = errors.New("unknown cloud provider")
+	errMissingOption     = errors.New("missing cloud backend option")
+	errInvalidPort       = errors.New("invalid port")
+)
+
+// A Discovery returns the network addresses, in the form of host:port,
+// of the current members of a group of instances.
+type Discovery interface {
+	Instances() ([]string, error)
+}
+
+// Backends refreshes the instances of a set of named discoveries
+// periodically, and provides the last successfully discovered
+// addresses.
+type Backends struct {
+	interval    time.Duration
+	clock       clock.Clock
+	discoveries map[string]Discovery
+	endpoints   map[string]*atomic.Value
+	mx          sync.Mutex
+	started     bool
+	quit        chan struct{}
+}
+
+// Parses the definitions of the discovered groups, returning the
+// discoveries mapped by the group names. See the package documentation
+// for the format.
+func Parse(definitions string) (map[string]Discovery, error) {
+	d := make(map[string]Discovery)
+	for _, def := range strings.FieldsFunc(definitions, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		name, provider, options, err := parseDefinition(def)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exists := d[name]; exists {
+			return nil, fmt.Errorf("duplicate cloud backend: %s", name)
+		}
+
+		var di Discovery
+		switch provider {
+		case awsProvider:
+			di, err = newAWSDiscovery(options)
+		case gcpProvider:
+			di, err = newGCPDiscovery(options)
+		default:
+			err = errUnknownProvider
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		d[name] = di
+	}
+
+	return d, nil
+}
+
+// splits a definition like name=provider:key=value,key=value
+func parseDefinition(def string) (string, string, map[string]string, error) {
+	nameAndRest := strings.SplitN(def, "=", 2)
+	if len(nameAndRest) != 2 || nameAndRest[0] == "" {
+		return "", "", nil, errInvalidDefinition
+	}
+
+	providerAndOptions := strings.SplitN(nameAndRest[1], ":", 2)
+	if len(providerAndOptions) != 2 {
+		return "", "", nil, errInvalidDefinition
+	}
+
+	options := make(map[string]string)
+	for _, o := range strings.Split(providerAndOptions[1], ",") {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return "", "", nil, errInvalidDefinition
+		}
+
+		options[kv[0]] = kv[1]
+	}
+
+	return nameAndRest[0], providerAndOptions[0], options, nil
+}
+
+// parses the optional port option
+func parsePort(options map[string]string) (int, error) {
+	p, ok := options["port"]
+	if !ok {
+		return 0, nil
+	}
+
+	port, err := strconv.Atoi(p)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, errInvalidPort
+	}
+
+	return port, nil
+}
+
+// Creates a Backends instance refreshing the instances of the provided
+// discoveries in the given interval. When the interval is not greater
+// than zero, DefaultRefreshInterval is used.
+func NewBackends(discoveries map[string]Discovery, interval time.Duration) *Backends {
+	return newBackends(discoveries, interval, clock.System)
+}
+
+func newBackends(discoveries map[string]Discovery, interval time.Duration, c clock.Clock) *Backends {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	endpoints := make(map[string]*atomic.Value)
+	for name := range discoveries {
+		endpoints[name] = &atomic.Value{}
+	}
+
+	return &Backends{
+		interval:    interval,
+		clock:       c,
+		discoveries: discoveries,
+		endpoints:   endpoints,
+		quit:        make(chan struct{})}
+}
+
+// Tells whether a group with the given name is configured.
+func (b *Backends) Has(name string) bool {
+	_, ok := b.endpoints[name]
+	return ok
+}
+
+// Returns the addresses of the last successful discovery of a group.
+// Until the first successful discovery, it returns nil.
+func (b *Backends) Endpoints(name string) []string {
+	v, ok := b.endpoints[name]
+	if !ok {
+		return nil
+	}
+
+	e, _ := v.Load().([]string)
+	return e
+}
+
+func sameEndpoints(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *Backends) refresh(name string) {
+	e, err := b.discoveries[name].Instances()
+	if err != nil {
+		log.Errorf("cloud backend %s: %v", name, err)
+		return
+	}
+
+	sort.Strings(e)
+	if !sameEndpoints(e, b.Endpoints(name)) {
+		log.Infof("cloud backend %s: %d instances discovered", name, len(e))
+	}
+
+	b.endpoints[name].Store(e)
+}
+
+func (b *Backends) run(name string) {
+	for {
+		select {
+		case <-b.quit:
+			return
+		default:
+		}
+
+		b.refresh(name)
+
+		select {
+		case <-b.clock.After(b.interval):
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Starts refreshing the instances. Calling it again, or after Close, has
+// no effect.
+func (b *Backends) Start() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.started {
+		return
+	}
+
+	b.started = true
+	for name := range b.discoveries {
+		go b.run(name)
+	}
+}
+
+// Stops refreshing the instances. The last discovered addresses are
+// kept.
+func (b *Backends) Close() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	select {
+	case <-b.quit:
+	default:
+		b.started = true
+		close(b.quit)
+	}
+}
+
+// the http client used by the discoveries
+var httpClient = &http.Client{Timeout: 10 * time.Second}
@@ -0,0 +1,231 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"errors"
+	"github.com/zalando/skipper/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testInterval = time.Second
+
+// discovery returning the instances set by the test
+type testDiscovery struct {
+	mx        sync.Mutex
+	instances []string
+	err       error
+}
+
+func (d *testDiscovery) set(err error, instances ...string) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.instances, d.err = instances, err
+}
+
+func (d *testDiscovery) Instances() ([]string, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.instances, d.err
+}
+
+func waitForEndpoints(t *testing.T, b *Backends, name string, expected ...string) {
+	to := time.After(120 * time.Millisecond)
+	for {
+		if sameEndpoints(b.Endpoints(name), expected) {
+			return
+		}
+
+		select {
+		case <-to:
+			t.Fatal("timeout", b.Endpoints(name), expected)
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
+
+func waitForTimer(t *testing.T, c *clock.Fake) {
+	to := time.After(120 * time.Millisecond)
+	for c.Timers() == 0 {
+		select {
+		case <-to:
+			t.Fatal("timeout")
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, ti := range []struct {
+		msg         string
+		definitions string
+		names       []string
+		fail        bool
+	}{{
+		"empty",
+		"",
+		nil,
+		false,
+	}, {
+		"missing provider",
+		"api=region=eu-central-1",
+		nil,
+		true,
+	}, {
+		"missing options",
+		"api=aws:",
+		nil,
+		true,
+	}, {
+		"unknown provider",
+		"api=azure:group=api,port=80",
+		nil,
+		true,
+	}, {
+		"unknown option",
+		"api=aws:target-group=arn,foo=bar",
+		nil,
+		true,
+	}, {
+		"aws without target group or tags",
+		"api=aws:region=eu-central-1,port=80",
+		nil,
+		true,
+	}, {
+		"aws tags without port",
+		"api=aws:tag.Name=api",
+		nil,
+		true,
+	}, {
+		"invalid port",
+		"api=aws:tag.Name=api,port=http",
+		nil,
+		true,
+	}, {
+		"gcp without port",
+		"api=gcp:group=api",
+		nil,
+		true,
+	}, {
+		"duplicate name",
+		"api=gcp:group=api,port=80;api=gcp:group=api2,port=80",
+		nil,
+		true,
+	}, {
+		"multiple definitions",
+		`api=aws:region=eu-central-1,target-group=arn:aws:elasticloadbalancing:eu-central-1:123456789012:targetgroup/api/73e2d6bc24d8a067;
+		workers=aws:tag.Role=worker,tag.Stage=live,port=8080
+		search=gcp:project=acme,zone=europe-west1-b,group=search,port=9200`,
+		[]string{"api", "workers", "search"},
+		false,
+	}} {
+		d, err := Parse(ti.definitions)
+		if ti.fail {
+			if err == nil {
+				t.Error(ti.msg, "failed to fail")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if len(d) != len(ti.names) {
+			t.Error(ti.msg, "invalid number of definitions", len(d))
+			continue
+		}
+
+		for _, n := range ti.names {
+			if d[n] == nil {
+				t.Error(ti.msg, "missing definition", n)
+			}
+		}
+	}
+}
+
+func TestParseAWSOptions(t *testing.T) {
+	d, err := Parse("workers=aws:region=eu-west-1,tag.Role=worker,tag.Stage=live,port=8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := d["workers"].(*awsDiscovery)
+	if a.region != "eu-west-1" || a.port != 8080 || len(a.tags) != 2 ||
+		a.tags["Role"] != "worker" || a.tags["Stage"] != "live" {
+		t.Error("failed to parse the options", a.region, a.port, a.tags)
+	}
+}
+
+func TestBackendsRefresh(t *testing.T) {
+	d := &testDiscovery{}
+	d.set(nil, "10.0.0.2:80", "10.0.0.1:80")
+
+	c := clock.NewFake(time.Now())
+	b := newBackends(map[string]Discovery{"api": d}, testInterval, c)
+	if b.Endpoints("api") != nil {
+		t.Error("unexpected endpoints before start")
+	}
+
+	b.Start()
+	defer b.Close()
+
+	waitForEndpoints(t, b, "api", "10.0.0.1:80", "10.0.0.2:80")
+
+	d.set(nil, "10.0.0.3:80")
+	waitForTimer(t, c)
+	c.Add(testInterval)
+	waitForEndpoints(t, b, "api", "10.0.0.3:80")
+
+	d.set(errors.New("discovery failed"))
+	waitForTimer(t, c)
+	c.Add(testInterval)
+	waitForTimer(t, c)
+	if e := b.Endpoints("api"); !sameEndpoints(e, []string{"10.0.0.3:80"}) {
+		t.Error("failed to keep the endpoints on failure", e)
+	}
+}
+
+func TestBackendsClose(t *testing.T) {
+	d := &testDiscovery{}
+	d.set(nil, "10.0.0.1:80")
+
+	c := clock.NewFake(time.Now())
+	b := newBackends(map[string]Discovery{"api": d}, testInterval, c)
+	b.Start()
+	waitForEndpoints(t, b, "api", "10.0.0.1:80")
+	waitForTimer(t, c)
+
+	b.Close()
+	b.Close()
+
+	d.set(nil, "10.0.0.2:80")
+	c.Add(testInterval)
+	time.Sleep(15 * time.Millisecond)
+	if e := b.Endpoints("api"); !sameEndpoints(e, []string{"10.0.0.1:80"}) {
+		t.Error("failed to stop refreshing", e)
+	}
+}
+
+func TestBackendsUnknownName(t *testing.T) {
+	b := newBackends(nil, testInterval, clock.NewFake(time.Now()))
+	if b.Has("api") || b.Endpoints("api") != nil {
+		t.Error("unexpected group")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"github.com/zalando/skipper/filters"
+	"math/rand"
+	"net/http"
+)
+
+// The name of the filter forwarding the requests to the discovered
+// instances.
+const FilterName = "cloudBackend"
+
+type filterSpec struct {
+	backends *Backends
+}
+
+type filter struct {
+	backends *Backends
+	name     string
+	scheme   string
+}
+
+// Returns a filter specification whose instances forward the requests
+// to the instances discovered by the provided Backends, selected
+// randomly. Instances expect the name of a configured group, and
+// optionally the scheme of the backends, http or https, which defaults
+// to http, e.g.:
+//
+//     cloudBackend("api")
+//     cloudBackend("search", "https")
+//
+// Until the first successful discovery, or when the group has no
+// instances, the requests are answered with 503 Service Unavailable.
+//
+// Name: "cloudBackend".
+func NewFilter(b *Backends) filters.Spec {
+	return &filterSpec{b}
+}
+
+// "cloudBackend"
+func (spec *filterSpec) Name() string { return FilterName }
+
+func (spec *filterSpec) Description() string {
+	return "Forwards the requests to the backends discovered in the cloud for a group."
+}
+
+func (spec *filterSpec) Signature() string { return "group string, [scheme string]" }
+
+func (spec *filterSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[0].(string)
+	if !ok || !spec.backends.Has(name) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	scheme := "http"
+	if len(config) == 2 {
+		if scheme, ok = config[1].(string); !ok || scheme != "http" && scheme != "https" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &filter{backends: spec.backends, name: name, scheme: scheme}, nil
+}
+
+// Sets the backend to one of the discovered instances.
+func (f *filter) Request(ctx filters.FilterContext) {
+	e := f.backends.Endpoints(f.name)
+	if len(e) == 0 {
+		ctx.ResponseWriter().WriteHeader(http.StatusServiceUnavailable)
+		ctx.MarkServed()
+		return
+	}
+
+	ctx.StateBag()[filters.BackendUrlKey] = f.scheme + "://" + e[rand.Intn(len(e))]
+}
+
+// Noop.
+func (f *filter) Response(ctx filters.FilterContext) {}
@@ -0,0 +1,98 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreateFilter(t *testing.T) {
+	spec := NewFilter(newBackends(map[string]Discovery{"api": &testDiscovery{}}, testInterval, clock.NewFake(time.Now())))
+	for _, ti := range []struct {
+		msg    string
+		config []interface{}
+		fail   bool
+	}{{
+		"no args",
+		nil,
+		true,
+	}, {
+		"unknown group",
+		[]interface{}{"search"},
+		true,
+	}, {
+		"invalid scheme",
+		[]interface{}{"api", "ftp"},
+		true,
+	}, {
+		"too many args",
+		[]interface{}{"api", "http", "foo"},
+		true,
+	}, {
+		"group",
+		[]interface{}{"api"},
+		false,
+	}, {
+		"group and scheme",
+		[]interface{}{"api", "https"},
+		false,
+	}} {
+		_, err := spec.CreateFilter(ti.config)
+		if ti.fail && err == nil {
+			t.Error(ti.msg, "failed to fail")
+		} else if !ti.fail && err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
+
+func TestFilterRequest(t *testing.T) {
+	d := &testDiscovery{}
+	c := clock.NewFake(time.Now())
+	b := newBackends(map[string]Discovery{"api": d}, testInterval, c)
+	f, err := NewFilter(b).CreateFilter([]interface{}{"api", "https"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() (string, bool) {
+		ctx := &filtertest.Context{
+			FResponseWriter: httptest.NewRecorder(),
+			FRequest:        &http.Request{},
+			FStateBag:       make(map[string]interface{})}
+		f.Request(ctx)
+		backend, _ := ctx.FStateBag[filters.BackendUrlKey].(string)
+		return backend, ctx.FServed
+	}
+
+	if _, served := request(); !served {
+		t.Error("failed to respond without instances")
+	}
+
+	d.set(nil, "10.0.0.1:443")
+	b.Start()
+	defer b.Close()
+	waitForEndpoints(t, b, "api", "10.0.0.1:443")
+
+	if backend, served := request(); served || backend != "https://10.0.0.1:443" {
+		t.Error("failed to set the backend", backend, served)
+	}
+}
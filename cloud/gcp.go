@@ -0,0 +1,257 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcpMetadataUrl = "http://metadata.google.internal/computeMetadata/v1"
+	gcpTokenPath   = "/instance/service-accounts/default/token"
+	gcpProjectPath = "/project/project-id"
+	gcpZonePath    = "/instance/zone"
+	gcpComputeUrl  = "https://www.googleapis.com/compute/v1"
+
+	// the token is renewed this long before it expires
+	gcpTokenMargin = time.Minute
+)
+
+type gcpToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	expires     time.Time
+}
+
+type gcpGroupInstances struct {
+	Items []struct {
+		Instance string `json:"instance"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type gcpInstances struct {
+	Items []struct {
+		SelfLink          string `json:"selfLink"`
+		NetworkInterfaces []struct {
+			NetworkIP string `json:"networkIP"`
+		} `json:"networkInterfaces"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+type gcpDiscovery struct {
+	project string
+	zone    string
+	group   string
+	port    int
+
+	metadataUrl string
+	computeUrl  string
+	now         func() time.Time
+
+	mx    sync.Mutex
+	token *gcpToken
+}
+
+func newGCPDiscovery(options map[string]string) (*gcpDiscovery, error) {
+	d := &gcpDiscovery{
+		metadataUrl: gcpMetadataUrl,
+		computeUrl:  gcpComputeUrl,
+		now:         time.Now}
+
+	for k, v := range options {
+		switch k {
+		case "project":
+			d.project = v
+		case "zone":
+			d.zone = v
+		case "group":
+			d.group = v
+		case "port":
+		default:
+			return nil, fmt.Errorf("unknown option: %s", k)
+		}
+	}
+
+	port, err := parsePort(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.group == "" || port == 0 {
+		return nil, errMissingOption
+	}
+
+	d.port = port
+	return d, nil
+}
+
+func (d *gcpDiscovery) metadata(p string) ([]byte, error) {
+	req, err := http.NewRequest("GET", d.metadataUrl+p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+	return readResponse(httpClient.Do(req))
+}
+
+// returns the configured project and zone, or the ones of the current
+// instance
+func (d *gcpDiscovery) location() (string, string, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.project == "" {
+		b, err := d.metadata(gcpProjectPath)
+		if err != nil {
+			return "", "", err
+		}
+
+		d.project = strings.TrimSpace(string(b))
+	}
+
+	if d.zone == "" {
+		b, err := d.metadata(gcpZonePath)
+		if err != nil {
+			return "", "", err
+		}
+
+		// the zone is returned as projects/<number>/zones/<zone>
+		d.zone = path.Base(strings.TrimSpace(string(b)))
+	}
+
+	return d.project, d.zone, nil
+}
+
+// returns the access token of the service account of the instance,
+// renewed before it expires
+func (d *gcpDiscovery) getToken() (string, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.token != nil && d.now().Add(gcpTokenMargin).Before(d.token.expires) {
+		return d.token.AccessToken, nil
+	}
+
+	b, err := d.metadata(gcpTokenPath)
+	if err != nil {
+		return "", err
+	}
+
+	t := &gcpToken{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return "", err
+	}
+
+	t.expires = d.now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	d.token = t
+	return t.AccessToken, nil
+}
+
+// makes an authenticated compute API call, and decodes the JSON response
+func (d *gcpDiscovery) call(method, u string, body []byte, rsp interface{}) error {
+	token, err := d.getToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	b, err := readResponse(httpClient.Do(req))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, rsp)
+}
+
+func withPageToken(u, pageToken string) string {
+	if pageToken == "" {
+		return u
+	}
+
+	return u + "?pageToken=" + url.QueryEscape(pageToken)
+}
+
+// Returns the addresses of the running members of the instance group.
+// The network IPs of the members are taken from the list of the
+// instances of the zone, to avoid requesting each instance.
+func (d *gcpDiscovery) Instances() ([]string, error) {
+	project, zone, err := d.location()
+	if err != nil {
+		return nil, err
+	}
+
+	zoneUrl := fmt.Sprintf("%s/projects/%s/zones/%s", d.computeUrl, project, zone)
+
+	members := make(map[string]bool)
+	listUrl := fmt.Sprintf("%s/instanceGroups/%s/listInstances", zoneUrl, d.group)
+	for pageToken := ""; ; {
+		var rsp gcpGroupInstances
+		if err := d.call("POST", withPageToken(listUrl, pageToken), []byte(`{"instanceState":"RUNNING"}`), &rsp); err != nil {
+			return nil, err
+		}
+
+		for _, i := range rsp.Items {
+			members[i.Instance] = true
+		}
+
+		if pageToken = rsp.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	var addresses []string
+	for pageToken := ""; ; {
+		var rsp gcpInstances
+		if err := d.call("GET", withPageToken(zoneUrl+"/instances", pageToken), nil, &rsp); err != nil {
+			return nil, err
+		}
+
+		for _, i := range rsp.Items {
+			if members[i.SelfLink] && len(i.NetworkInterfaces) > 0 && i.NetworkInterfaces[0].NetworkIP != "" {
+				addresses = append(addresses, net.JoinHostPort(i.NetworkInterfaces[0].NetworkIP, strconv.Itoa(d.port)))
+			}
+		}
+
+		if pageToken = rsp.NextPageToken; pageToken == "" {
+			return addresses, nil
+		}
+	}
+}
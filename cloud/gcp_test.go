@@ -0,0 +1,117 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testZoneUrl = "/projects/acme/zones/europe-west1-b"
+
+// serves the metadata and the compute API
+func newTestGCP() *httptest.Server {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case gcpTokenPath:
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600, "token_type": "Bearer"}`)
+			return
+		case gcpProjectPath:
+			fmt.Fprint(w, "acme")
+			return
+		case gcpZonePath:
+			fmt.Fprint(w, "projects/123456789012/zones/europe-west1-b")
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case testZoneUrl + "/instanceGroups/search/listInstances":
+			b, _ := ioutil.ReadAll(r.Body)
+			if r.Method != "POST" || string(b) != `{"instanceState":"RUNNING"}` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if r.URL.Query().Get("pageToken") == "" {
+				fmt.Fprintf(w, `{"items": [{"instance": "%s/instances/search-1", "status": "RUNNING"}], "nextPageToken": "page2"}`,
+					s.URL+testZoneUrl)
+			} else {
+				fmt.Fprintf(w, `{"items": [{"instance": "%s/instances/search-2", "status": "RUNNING"}]}`,
+					s.URL+testZoneUrl)
+			}
+		case testZoneUrl + "/instances":
+			fmt.Fprintf(w, `{"items": [
+				{"selfLink": "%[1]s/instances/search-1", "networkInterfaces": [{"networkIP": "10.132.0.2"}]},
+				{"selfLink": "%[1]s/instances/search-2", "networkInterfaces": [{"networkIP": "10.132.0.3"}]},
+				{"selfLink": "%[1]s/instances/other", "networkInterfaces": [{"networkIP": "10.132.0.4"}]}
+			]}`, s.URL+testZoneUrl)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return s
+}
+
+func testGCPDiscovery(t *testing.T, s *httptest.Server, options map[string]string) *gcpDiscovery {
+	d, err := newGCPDiscovery(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.metadataUrl = s.URL
+	d.computeUrl = s.URL
+	return d
+}
+
+func TestGCPInstanceGroup(t *testing.T) {
+	s := newTestGCP()
+	defer s.Close()
+
+	d := testGCPDiscovery(t, s, map[string]string{"group": "search", "port": "9200"})
+	addresses, err := d.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkAddresses(t, addresses, "10.132.0.2:9200", "10.132.0.3:9200")
+	if d.project != "acme" || d.zone != "europe-west1-b" {
+		t.Error("failed to detect the location", d.project, d.zone)
+	}
+}
+
+func TestGCPUnknownGroup(t *testing.T) {
+	s := newTestGCP()
+	defer s.Close()
+
+	d := testGCPDiscovery(t, s, map[string]string{"project": "acme", "zone": "europe-west1-b", "group": "foo", "port": "9200"})
+	if _, err := d.Instances(); err == nil {
+		t.Error("failed to fail")
+	}
+}
@@ -24,10 +24,19 @@ import (
 )
 
 const (
-	etcdUrlsFlag     = "etcd-urls"
-	etcdPrefixFlag   = "etcd-prefix"
-	inlineRoutesFlag = "routes"
-	inlineIdsFlag    = "ids"
+	etcdUrlsFlag       = "etcd-urls"
+	etcdPrefixFlag     = "etcd-prefix"
+	inlineRoutesFlag   = "routes"
+	inlineIdsFlag      = "ids"
+	defaultFiltersFlag = "default-filters"
+	fmtCheckFlag       = "check"
+	fmtWriteFlag       = "write"
+	captureFlag        = "capture"
+	mockBackendsFlag   = "mock-backends"
+	formatFlag         = "format"
+	knownBackendsFlag  = "backends"
+	instancesFlag      = "instances"
+	dryRunFlag         = "dry-run"
 
 	defaultEtcdUrls   = "http://127.0.0.1:2379,http://127.0.0.1:4001"
 	defaultEtcdPrefix = "/skipper"
@@ -48,6 +57,19 @@ var (
 	etcdPrefix     string
 	inlineRoutes   string
 	inlineRouteIds string
+	defaultFilters string
+	fmtCheck       bool
+	fmtWrite       bool
+
+	replayCapture      string
+	replayMockBackends bool
+
+	outputFormat  string
+	knownBackends string
+
+	fleetInstances string
+
+	dryRun bool
 )
 
 var (
@@ -68,6 +90,21 @@ func initFlags() {
 
 	flags.StringVar(&inlineRoutes, inlineRoutesFlag, "", inlineRoutesUsage)
 	flags.StringVar(&inlineRouteIds, inlineIdsFlag, "", inlineIdsUsage)
+
+	flags.StringVar(&defaultFilters, defaultFiltersFlag, "", defaultFiltersUsage)
+
+	flags.BoolVar(&fmtCheck, fmtCheckFlag, false, fmtCheckUsage)
+	flags.BoolVar(&fmtWrite, fmtWriteFlag, false, fmtWriteUsage)
+
+	flags.StringVar(&replayCapture, captureFlag, "", captureUsage)
+	flags.BoolVar(&replayMockBackends, mockBackendsFlag, false, mockBackendsUsage)
+
+	flags.StringVar(&outputFormat, formatFlag, "", formatUsage)
+	flags.StringVar(&knownBackends, knownBackendsFlag, "", knownBackendsUsage)
+
+	flags.StringVar(&fleetInstances, instancesFlag, "", instancesUsage)
+
+	flags.BoolVar(&dryRun, dryRunFlag, false, dryRunUsage)
 }
 
 func init() {
@@ -0,0 +1,89 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"os"
+	"regexp"
+)
+
+// returns the source of the regular expressions in the conditions of
+// the route expression
+func expressionRegexps(e *eskip.PredicateExpression) []string {
+	if e == nil {
+		return nil
+	}
+
+	var rx []string
+	if p := e.Predicate; p != nil {
+		var i int
+		switch p.Name {
+		case "Host", "PathRegexp":
+		case "HeaderRegexp":
+			i = 1
+		default:
+			return nil
+		}
+
+		if i < len(p.Args) {
+			if s, ok := p.Args[i].(string); ok {
+				rx = append(rx, s)
+			}
+		}
+	}
+
+	for _, o := range e.Operands {
+		rx = append(rx, expressionRegexps(o)...)
+	}
+
+	return rx
+}
+
+// checks that the regular expressions of the route compile, so that the
+// invalid routes are rejected when compiling the table, instead of
+// ignored by the routing when loading it.
+func checkRegexps(r *eskip.Route) error {
+	rx := append(append([]string(nil), r.HostRegexps...), r.PathRegexps...)
+	for _, h := range r.HeaderRegexps {
+		rx = append(rx, h...)
+	}
+
+	rx = append(rx, expressionRegexps(r.Predicate)...)
+	for _, s := range rx {
+		if _, err := regexp.Compile(s); err != nil {
+			return fmt.Errorf("%s: %v", r.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// command executed for compile.
+func compileCmd(in, _ *medium) error {
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		if err := checkRegexps(r); err != nil {
+			return err
+		}
+	}
+
+	return eskip.WriteCompiled(os.Stdout, routes)
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"testing"
+)
+
+func TestCheckRegexps(t *testing.T) {
+	for _, ti := range []struct {
+		routes string
+		fail   bool
+	}{{
+		`Host(/^www[.]/) && PathRegexp(/^\/api/) && HeaderRegexp("Accept", /json/) -> <shunt>`,
+		false,
+	}, {
+		`Host(/(/) -> <shunt>`,
+		true,
+	}, {
+		`HeaderRegexp("Accept", /[/) -> <shunt>`,
+		true,
+	}, {
+		`Path("/foo") && (Host(/a/) || !PathRegexp(/(/)) -> <shunt>`,
+		true,
+	}} {
+		r, err := eskip.Parse(ti.routes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = checkRegexps(r[0])
+		if ti.fail && err == nil || !ti.fail && err != nil {
+			t.Error(ti.routes, err)
+		}
+	}
+}
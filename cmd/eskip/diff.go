@@ -0,0 +1,81 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"io"
+	"strings"
+)
+
+// take items from 'routes' that fulfil 'cond'.
+func filterRoutes(routes routeList, cond routePredicate) routeList {
+	var filtered routeList
+	for _, r := range routes {
+		if cond(r) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
+
+// print a route prefixed with the diff marker, on every line, to keep
+// the comments of the route in the diff.
+func printDiffRoute(w io.Writer, marker string, r *eskip.Route) error {
+	for _, l := range strings.Split(eskip.String(r)+";", "\n") {
+		if _, err := fmt.Fprintf(w, "%s %s\n", marker, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// print the changes that writing the routes to the output would make,
+// in a diff format. The routes in 'upsert' that don't exist in
+// 'existing' are printed with '+', the ones that are different with
+// both their current version with '-' and their new version with '+',
+// while the routes in 'del' that exist in 'existing' are printed with
+// '-'. The unchanged routes are not printed.
+func printDiff(w io.Writer, existing, upsert, del routeList) error {
+	mex := mapRoutes(existing)
+	for _, r := range upsert {
+		if current, exists := mex[r.Id]; exists {
+			if !routesDiffer(current, r) {
+				continue
+			}
+
+			if err := printDiffRoute(w, "-", current); err != nil {
+				return err
+			}
+		}
+
+		if err := printDiffRoute(w, "+", r); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range del {
+		if current, exists := mex[r.Id]; exists {
+			if err := printDiffRoute(w, "-", current); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
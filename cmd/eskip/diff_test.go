@@ -0,0 +1,77 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"github.com/zalando/skipper/eskip"
+	"testing"
+)
+
+func TestPrintDiff(t *testing.T) {
+	parse := func(doc string) routeList {
+		routes, err := eskip.Parse(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return routes
+	}
+
+	existing := parse(`
+		route1: Method("GET") -> <shunt>;
+		route2: Method("POST") -> <shunt>;
+		route3: Method("PUT") -> <shunt>`)
+
+	upsert := parse(`
+		route1: Method("GET") -> <shunt>;
+		route2: Method("HEAD") -> <shunt>;
+		route4: Method("DELETE") -> <shunt>`)
+
+	del := parse(`route3: * -> <shunt>; route5: * -> <shunt>`)
+
+	var buf bytes.Buffer
+	if err := printDiff(&buf, existing, upsert, del); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `- route2: Method("POST") -> <shunt>;
++ route2: Method("HEAD") -> <shunt>;
++ route4: Method("DELETE") -> <shunt>;
+- route3: Method("PUT") -> <shunt>;
+`
+
+	if buf.String() != expected {
+		t.Error("invalid diff")
+		t.Log("got:     ", buf.String())
+		t.Log("expected:", expected)
+	}
+}
+
+func TestPrintDiffNoChanges(t *testing.T) {
+	routes, err := eskip.Parse(`route1: Method("GET") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := printDiff(&buf, routes, routes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Error("unexpected diff", buf.String())
+	}
+}
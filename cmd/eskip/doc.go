@@ -38,10 +38,21 @@ Sync routes from an eskip file to etcd:
 
     eskip reset routes.eskip
 
+Replace all routes in etcd atomically with the routes from an eskip
+file, as a new generation, and roll back to the previous generation:
+
+    eskip publish routes.eskip
+    eskip rollback
+
 Delete routes from etcd:
 
     eskip delete -ids route1,route2,route3
 
+Print the changes that syncing the routes from an eskip file to etcd
+would make, without applying them:
+
+    eskip reset -dry-run routes.eskip
+
 Delete all routes from etcd:
 
     eskip print | eskip delete
@@ -50,8 +61,58 @@ Copy all routes in etcd under a different prefix:
 
     eskip print | eskip upsert -etcd-prefix /skipper-backup
 
-(Where -etcd-urls is not set for write operations like upsert, reset and
-delete, the default etcd cluster urls are used:
+Print the routes from a file as the proxy uses them, with the default
+filters of the proxy prepended:
+
+    eskip effective -default-filters 'flowId("reuse")' routes.eskip
+
+Check the routes in a file for likely configuration problems:
+
+    eskip lint routes.eskip
+
+Format a route file in the canonical format, or check if it is
+formatted, e.g. in a pre-commit hook:
+
+    eskip fmt -write routes.eskip
+    eskip fmt -check routes.eskip
+
+Replay captured requests against a route file, and report the
+differences in the matched routes and the response statuses:
+
+    eskip replay -capture requests.jsonl -mock-backends routes.eskip
+
+Compile a route file into a binary route table, that the proxy loads
+without parsing:
+
+    eskip compile routes.eskip > routes.eskipc
+
+Generate the documentation of the routes in a file, in Markdown or HTML:
+
+    eskip doc routes.eskip > routes.md
+    eskip doc -format html routes.eskip > routes.html
+
+Export the graph of the hosts, the routes and the backends, in the DOT
+format of Graphviz or as JSON, and report the known backends not used by
+any route:
+
+    eskip graph routes.eskip | dot -Tsvg > routes.svg
+    eskip graph -format json -backends backends.txt routes.eskip
+
+Experiment with routes interactively, entering routes and requests, and
+checking which route matches and what request is sent to the backend:
+
+    eskip repl routes.eskip
+    > foo: Path("/foo") -> modPath("^/foo", "/bar") -> "https://backend.example.org";
+    > GET /foo X-Foo:bar
+
+Compare the active routes and the options of a fleet of skipper
+instances, through their support listeners, to detect the instances
+that diverge from the rest:
+
+    eskip fleet-check -instances http://10.0.0.1:9911,http://10.0.0.2:9911
+
+(Where -etcd-urls is not set for write operations like upsert, reset,
+delete, publish and rollback, the default etcd cluster urls are used:
 http://127.0.0.1:2379,http://127.0.0.1:4001)
 
 On the roadmap: Innkeeper support.
@@ -68,14 +129,23 @@ const (
 	helpHint = "To print eskip usage, enter: eskip -help"
 
 	// flag usage strings:
-	etcdUrlsUsage     = "urls of nodes in an etcd cluster"
-	etcdPrefixUsage   = "path prefix for routes in etcd"
-	inlineRoutesUsage = "inline: routes in eskip format"
-	inlineIdsUsage    = "inline ids: comma separated route ids"
+	etcdUrlsUsage       = "urls of nodes in an etcd cluster"
+	etcdPrefixUsage     = "path prefix for routes in etcd"
+	inlineRoutesUsage   = "inline: routes in eskip format"
+	inlineIdsUsage      = "inline ids: comma separated route ids"
+	defaultFiltersUsage = "default filters of the proxy, in eskip format (only for effective, lint, replay and repl)"
+	fmtCheckUsage       = "fail when the input is not formatted, instead of printing it (only for fmt)"
+	fmtWriteUsage       = "write the formatted routes back to the input file (only for fmt)"
+	captureUsage        = "file containing the captured requests to replay (only for replay)"
+	mockBackendsUsage   = "replace the backends with a mock responding with the captured status (only for replay)"
+	formatUsage         = "format of the output, markdown (default) or html for doc, dot (default) or json for graph (only for doc and graph)"
+	knownBackendsUsage  = "file containing the known backends, one per line, to report the ones not used by any route (only for graph)"
+	instancesUsage      = "comma separated urls of the support listeners of the skipper instances (only for fleet-check)"
+	dryRunUsage         = "print the changes to the routes in the output as a diff, without applying them (only for upsert, reset and delete)"
 
 	// command line help (1):
 	help1 = `Usage: eskip <command> [media flags] [--] [file]
-Commands: check|print|upsert|reset|delete
+Commands: check|print|effective|lint|fmt|replay|compile|doc|graph|repl|fleet-check|upsert|reset|delete|publish|rollback
 Verify, print, update or delete skipper routes.
 See more: https://github.com/zalando/skipper
 
@@ -104,19 +174,117 @@ check    verifies the syntax of routes. Accepts one input medium
 
 print    same as check, but also prints the routes.
 
+effective
+         same as print, but prints the routes as the proxy uses them:
+         with the filters set by -default-filters prepended, without
+         the expired routes, and with the filters ordered by their
+         phase. Example:
+         eskip effective -default-filters 'flowId("reuse")' routes.eskip
+
+lint     same as check, but also checks the routes for likely
+         configuration problems, e.g. missing deadline, and prints
+         the findings. The routes are checked with the filters set
+         by -default-filters prepended. Exits with non-0 when any of
+         the findings is a warning or an error. Example:
+         eskip lint routes.eskip
+
+fmt      prints the routes in the canonical format, keeping the
+         comments and the templates. Accepts one input medium of the
+         following types: stdin, file, inline. With -write, the file
+         is overwritten with the formatted routes, while with -check,
+         nothing is printed, but it exits with non-0 when the input is
+         not formatted. Example:
+         eskip fmt -write routes.eskip
+
+replay   replays captured requests through an in-process proxy
+         with the input routes, and prints the requests where the
+         matched route or the response status differs from the
+         captured one. The capture file, set by -capture, contains
+         one JSON object per line, with the fields: method, url,
+         header, body, route and status. With -mock-backends, the
+         network backends are replaced by a mock responding with the
+         captured status. Exits with non-0 when any of the requests
+         differs. Example:
+         eskip replay -capture requests.jsonl routes.eskip
+
+compile  same as check, but also checks the regular expressions of
+         the routes, and prints the routes as a compiled route table
+         to the standard output. The compiled table can be used as
+         the routes file of the proxy, and it is loaded without
+         parsing, which makes starting instances with large route
+         tables faster. Example:
+         eskip compile routes.eskip > routes.eskipc
+
+doc      same as check, but also prints a human readable catalog of
+         the routes: their conditions in plain language, their
+         filters with the description of the built-in filters, and
+         their backends. The format is set by -format, markdown
+         (default) or html. Example:
+         eskip doc -format html routes.eskip > routes.html
+
+graph    same as check, but also prints the graph of the hosts, the
+         routes and the backends, including the loopback routes and
+         the backends set by filters. The format is set by -format,
+         dot (default) or json. With -backends, the known backends,
+         listed one per line in the file, that are not used by any
+         route, are added to the graph as orphans, and printed to the
+         standard error. Example:
+         eskip graph routes.eskip | dot -Tsvg > routes.svg
+
+repl     starts an interactive session, reading routes in eskip
+         format and requests from the standard input. For the
+         requests, it prints the matched route, the request as sent
+         to the backend and the response. The backends are replaced
+         by a mock. Optionally accepts one input medium of the
+         following types: etcd, file, inline, for the initial routes.
+         The requests are entered in the format:
+         <method> <url> [<header>:<value> ...]. Enter :help for the
+         commands of the session. Example:
+         eskip repl routes.eskip
+
+fleet-check
+         queries the /fingerprint endpoint of the support listener of
+         the skipper instances set by -instances, prints the hashes
+         of their active routes and options, and reports the
+         instances whose version, routes or options diverge. Accepts
+         no input medium. Exits with non-0 when the instances diverge
+         or any of them cannot be queried. Example:
+         eskip fleet-check -instances http://10.0.0.1:9911,http://10.0.0.2:9911
+
 upsert   insert/update routes from input to output. Expects one input
          medium of the following types: stdin, file, inline.
-         Automatically selects etcd as output. Example:
+         Automatically selects etcd as output. With -dry-run, the
+         output is not changed, but the changes are printed as a diff:
+         the added routes prefixed with +, the deleted ones with -,
+         and the updated ones with both their current and new
+         version. Example:
          eskip upsert routes.eskip
 
 reset    same as upsert, but also deletes the routes from the output
-         that are not found in the input.
+         that are not found in the input. Example:
+         eskip reset -dry-run routes.eskip
 
 delete   deletes routes from the output that are specified in the input.
          Expects one input medium of the following types: stdin, file,
          inline, inline ids. Automatically selects etcd as output.
+         Accepts -dry-run, like upsert. Example:
+         eskip delete -ids route1,route2,route3
+
+publish  replaces all the routes in the output with the routes from the
+         input atomically: stores them as a new generation, and
+         switches the output to it with a single write, keeping the
+         previous generation for rollback. Prints the name of the new
+         generation. Expects one input medium of the following types:
+         stdin, file, inline. Automatically selects etcd as output.
          Example:
-         eskip delete -ids route1,route2,route3`
+         eskip publish routes.eskip
+
+rollback switches the output back to the previous generation of the
+         routes, stored by publish. Calling it again restores the
+         generation that was rolled back. Prints the name of the
+         restored generation. Accepts only an etcd medium, and
+         automatically selects etcd, when not set. Example:
+         eskip rollback -etcd-prefix /skipper`
 )
 
 // simplified check for help request:
@@ -0,0 +1,74 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"sort"
+	"time"
+)
+
+// sorts the filters of a route by their phase, keeping the order of
+// the definitions within the same phase, the same way as the routing
+type filtersByPhase struct {
+	filters  []*eskip.Filter
+	registry filters.Registry
+}
+
+func (fp filtersByPhase) Len() int      { return len(fp.filters) }
+func (fp filtersByPhase) Swap(i, j int) { fp.filters[i], fp.filters[j] = fp.filters[j], fp.filters[i] }
+
+func (fp filtersByPhase) Less(i, j int) bool {
+	return fp.registry.Phase(fp.filters[i].Name) < fp.registry.Phase(fp.filters[j].Name)
+}
+
+// returns the routes as the proxy uses them: with the default filters
+// prepended, without the routes expired at the provided time, and with
+// the filters ordered by their phase.
+func effectiveRoutes(routes routeList, defaultFilters []*eskip.Filter, registry filters.Registry, now time.Time) routeList {
+	var effective routeList
+	for _, r := range eskip.PrependFilters(routes, defaultFilters) {
+		if v, err := routing.ValidUntil(r); err == nil && !v.IsZero() && !now.Before(v) {
+			continue
+		}
+
+		sort.Stable(filtersByPhase{r.Filters, registry})
+		effective = append(effective, r)
+	}
+
+	return effective
+}
+
+// command executed for effective.
+func effectiveCmd(in, _ *medium) error {
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	fs, err := eskip.ParseFilters(defaultFilters)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range effectiveRoutes(routes, fs, builtin.MakeRegistry(), time.Now()) {
+		printRoute(r)
+	}
+
+	return nil
+}
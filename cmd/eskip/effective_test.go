@@ -0,0 +1,54 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"testing"
+	"time"
+)
+
+func TestEffectiveRoutes(t *testing.T) {
+	now := time.Now()
+	routes := eskip.MustParse(`
+		route1: Path("/one") -> modPath("^/one", "/") -> websocketOrigin("https://www.example.org") -> "https://one.example.org";
+		route2: Path("/two") -> <shunt>`)
+	routes = append(routes, eskip.NewRoute().Id("expired").ValidUntil(now.Add(-time.Hour)).Shunt().Route())
+
+	effective := effectiveRoutes(
+		routes,
+		eskip.MustParseFilters(`flowId("reuse")`),
+		builtin.MakeRegistry(),
+		now)
+
+	expected := eskip.MustParse(`
+		route1: Path("/one") ->
+			websocketOrigin("https://www.example.org") -> flowId("reuse") -> modPath("^/one", "/") ->
+			"https://one.example.org";
+		route2: Path("/two") -> flowId("reuse") -> <shunt>`)
+	if !eskip.EqLists(effective, expected) {
+		t.Error("invalid effective routes", eskip.String(effective...))
+	}
+}
+
+func TestEffectiveRoutesNoDefaultFilters(t *testing.T) {
+	routes := eskip.MustParse(`route1: Path("/one") -> modPath("^/one", "/") -> "https://one.example.org"`)
+	effective := effectiveRoutes(routes, nil, make(filters.Registry), time.Now())
+	if !eskip.EqLists(effective, routes) {
+		t.Error("invalid effective routes", eskip.String(effective...))
+	}
+}
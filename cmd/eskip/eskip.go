@@ -17,6 +17,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/zalando/skipper/eskip"
 	"os"
 )
 
@@ -26,20 +27,42 @@ type (
 )
 
 const (
-	check  command = "check"
-	print  command = "print"
-	upsert command = "upsert"
-	reset  command = "reset"
-	delete command = "delete"
+	check      command = "check"
+	print      command = "print"
+	upsert     command = "upsert"
+	reset      command = "reset"
+	delete     command = "delete"
+	publish    command = "publish"
+	rollback   command = "rollback"
+	effective  command = "effective"
+	lintRoutes command = "lint"
+	fmtRoutes  command = "fmt"
+	replay     command = "replay"
+	compile    command = "compile"
+	docRoutes  command = "doc"
+	repl       command = "repl"
+	graph      command = "graph"
+	fleetCheck command = "fleet-check"
 )
 
 // map command string to command function
 var commands = map[command]commandFunc{
-	check:  checkCmd,
-	print:  printCmd,
-	upsert: upsertCmd,
-	reset:  resetCmd,
-	delete: deleteCmd}
+	check:      checkCmd,
+	print:      printCmd,
+	upsert:     upsertCmd,
+	reset:      resetCmd,
+	delete:     deleteCmd,
+	publish:    publishCmd,
+	rollback:   rollbackCmd,
+	effective:  effectiveCmd,
+	lintRoutes: lintCmd,
+	fmtRoutes:  fmtCmd,
+	replay:     replayCmd,
+	compile:    compileCmd,
+	docRoutes:  docCmd,
+	repl:       replCmd,
+	graph:      graphCmd,
+	fleetCheck: fleetCheckCmd}
 
 var (
 	missingCommand = errors.New("missing command")
@@ -51,14 +74,18 @@ func printStderr(args ...interface{}) {
 }
 
 // exit with 0 if no error.
-// print error, print hint if set and exit with
-// non-0.
+// print error, and the location of parse errors,
+// print hint if set and exit with non-0.
 func exitErrHint(err error, hint bool) {
 	if err == nil {
 		os.Exit(0)
 	}
 
 	printStderr(err)
+	if perr, ok := err.(*eskip.ParseError); ok {
+		printStderr(perr.Snippet)
+	}
+
 	if hint {
 		printStderr()
 		printStderr(helpHint)
@@ -0,0 +1,190 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fleetCheckTimeout = 10 * time.Second
+
+	// the length of the hashes printed in the report
+	shortHash = 12
+)
+
+var (
+	missingInstances = errors.New("missing instances")
+	fleetDiverges    = errors.New("the instances diverge")
+	fleetUnreachable = errors.New("failed to query all instances")
+)
+
+// the fingerprint document of the skipper instances, served by the
+// support listener
+type fingerprint struct {
+	Version      string `json:"version"`
+	Routes       string `json:"routes"`
+	RouteCount   int    `json:"routeCount"`
+	TableVersion int    `json:"tableVersion"`
+	Options      string `json:"options"`
+}
+
+// the fingerprint of an instance, or the error of querying it
+type instanceFingerprint struct {
+	url         string
+	fingerprint *fingerprint
+	err         error
+}
+
+func short(h string) string {
+	if len(h) > shortHash {
+		return h[:shortHash]
+	}
+
+	return h
+}
+
+func getFingerprint(c *http.Client, instance string) (*fingerprint, error) {
+	rsp, err := c.Get(strings.TrimSuffix(instance, "/") + "/fingerprint")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", rsp.Status)
+	}
+
+	var f fingerprint
+	if err := json.NewDecoder(rsp.Body).Decode(&f); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// queries the instances concurrently, and returns their fingerprints in
+// the order of the instances
+func getFingerprints(c *http.Client, instances []string) []instanceFingerprint {
+	fs := make([]instanceFingerprint, len(instances))
+	done := make(chan struct{})
+	for i, instance := range instances {
+		go func(i int, instance string) {
+			f, err := getFingerprint(c, instance)
+			fs[i] = instanceFingerprint{url: instance, fingerprint: f, err: err}
+			done <- struct{}{}
+		}(i, instance)
+	}
+
+	for range instances {
+		<-done
+	}
+
+	return fs
+}
+
+// prints the groups of the instances, when they have different values
+// of a field of the fingerprint, and tells whether they diverge
+func reportDivergence(w io.Writer, name string, fs []instanceFingerprint, value func(*fingerprint) string) bool {
+	groups := make(map[string][]string)
+	for _, f := range fs {
+		if f.err == nil {
+			v := value(f.fingerprint)
+			groups[v] = append(groups[v], f.url)
+		}
+	}
+
+	if len(groups) < 2 {
+		return false
+	}
+
+	var values []string
+	for v := range groups {
+		values = append(values, v)
+	}
+
+	sort.Strings(values)
+	fmt.Fprintf(w, "%s diverge:\n", name)
+	for _, v := range values {
+		fmt.Fprintf(w, "  %s: %s\n", v, strings.Join(groups[v], ", "))
+	}
+
+	return true
+}
+
+// queries the fingerprints of the instances, prints them, and reports
+// the divergence of the versions, the routes and the options
+func checkFleet(w io.Writer, c *http.Client, instances []string) error {
+	if len(instances) == 0 {
+		return missingInstances
+	}
+
+	fs := getFingerprints(c, instances)
+	var failed bool
+	for _, f := range fs {
+		if f.err != nil {
+			fmt.Fprintf(w, "%s error: %v\n", f.url, f.err)
+			failed = true
+			continue
+		}
+
+		fp := f.fingerprint
+		fmt.Fprintf(w, "%s version=%s routes=%s (%d) options=%s table=%d\n",
+			f.url, fp.Version, short(fp.Routes), fp.RouteCount, short(fp.Options), fp.TableVersion)
+	}
+
+	diverges := reportDivergence(w, "versions", fs, func(f *fingerprint) string { return f.Version })
+	if reportDivergence(w, "routes", fs, func(f *fingerprint) string { return short(f.Routes) }) {
+		diverges = true
+	}
+
+	if reportDivergence(w, "options", fs, func(f *fingerprint) string { return short(f.Options) }) {
+		diverges = true
+	}
+
+	switch {
+	case diverges:
+		return fleetDiverges
+	case failed:
+		return fleetUnreachable
+	default:
+		return nil
+	}
+}
+
+func splitInstances(s string) []string {
+	var instances []string
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			instances = append(instances, i)
+		}
+	}
+
+	return instances
+}
+
+// command executed for fleet-check.
+func fleetCheckCmd(_, _ *medium) error {
+	c := &http.Client{Timeout: fleetCheckTimeout}
+	return checkFleet(os.Stdout, c, splitInstances(fleetInstances))
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func fingerprintServer(f fingerprint) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fingerprint" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewEncoder(w).Encode(f)
+	}))
+}
+
+func TestFleetCheck(t *testing.T) {
+	f := fingerprint{Version: "v1", Routes: "aaaaaaaaaaaaaaaa", RouteCount: 3, TableVersion: 7, Options: "cccccccccccccccc"}
+	s1 := fingerprintServer(f)
+	defer s1.Close()
+
+	f.TableVersion = 9
+	s2 := fingerprintServer(f)
+	defer s2.Close()
+
+	var out bytes.Buffer
+	if err := checkFleet(&out, http.DefaultClient, []string{s1.URL, s2.URL + "/"}); err != nil {
+		t.Error(err, out.String())
+	}
+
+	if !strings.Contains(out.String(), s1.URL+" version=v1 routes=aaaaaaaaaaaa (3) options=cccccccccccc table=7") {
+		t.Error("invalid report", out.String())
+	}
+}
+
+func TestFleetCheckDiverges(t *testing.T) {
+	f := fingerprint{Version: "v1", Routes: "aaaaaaaaaaaaaaaa", Options: "cccccccccccccccc"}
+	s1 := fingerprintServer(f)
+	defer s1.Close()
+
+	s2 := fingerprintServer(f)
+	defer s2.Close()
+
+	f.Routes = "bbbbbbbbbbbbbbbb"
+	s3 := fingerprintServer(f)
+	defer s3.Close()
+
+	var out bytes.Buffer
+	if err := checkFleet(&out, http.DefaultClient, []string{s1.URL, s2.URL, s3.URL}); err != fleetDiverges {
+		t.Error("failed to detect the divergence", err)
+	}
+
+	report := out.String()
+	if !strings.Contains(report, "routes diverge:\n  aaaaaaaaaaaa: "+s1.URL+", "+s2.URL+"\n  bbbbbbbbbbbb: "+s3.URL+"\n") {
+		t.Error("invalid report", report)
+	}
+
+	if strings.Contains(report, "options diverge") || strings.Contains(report, "versions diverge") {
+		t.Error("invalid report", report)
+	}
+}
+
+func TestFleetCheckUnreachable(t *testing.T) {
+	s := fingerprintServer(fingerprint{Version: "v1"})
+	defer s.Close()
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	var out bytes.Buffer
+	if err := checkFleet(&out, http.DefaultClient, []string{s.URL, notFound.URL}); err != fleetUnreachable {
+		t.Error("failed to report the unreachable instance", err)
+	}
+
+	if !strings.Contains(out.String(), notFound.URL+" error: unexpected status: 404") {
+		t.Error("invalid report", out.String())
+	}
+}
+
+func TestFleetCheckMissingInstances(t *testing.T) {
+	if err := checkFleet(&bytes.Buffer{}, http.DefaultClient, splitInstances(" , ")); err != missingInstances {
+		t.Error("failed to fail", err)
+	}
+}
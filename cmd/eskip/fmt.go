@@ -0,0 +1,72 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"github.com/zalando/skipper/eskip"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	notFormatted      = errors.New("routes not formatted")
+	writeRequiresFile = errors.New("-write requires a file input")
+)
+
+// reads the raw document from a local input medium.
+func readDocument(in *medium) ([]byte, error) {
+	switch in.typ {
+	case stdin:
+		return ioutil.ReadAll(os.Stdin)
+	case file:
+		return ioutil.ReadFile(in.path)
+	case inline:
+		return []byte(in.eskip), nil
+	default:
+		return nil, invalidInputType
+	}
+}
+
+// command executed for fmt.
+func fmtCmd(in, _ *medium) error {
+	if fmtWrite && in.typ != file {
+		return writeRequiresFile
+	}
+
+	doc, err := readDocument(in)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := eskip.Fmt(doc)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case fmtCheck:
+		if string(formatted) != string(doc) {
+			return notFormatted
+		}
+
+		return nil
+	case fmtWrite:
+		return ioutil.WriteFile(in.path, formatted, 0644)
+	default:
+		_, err = os.Stdout.Write(formatted)
+		return err
+	}
+}
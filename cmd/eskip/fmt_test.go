@@ -0,0 +1,78 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	testFmtFile      = "testFmt.eskip"
+	testUnformatted  = `route1:Path("/")-><shunt>`
+	testFormattedDoc = `route1: Path("/") -> <shunt>;` + "\n"
+)
+
+func withFmtFlags(check, write bool, action func()) {
+	fmtCheck, fmtWrite = check, write
+	defer func() { fmtCheck, fmtWrite = false, false }()
+	action()
+}
+
+func TestFmtCheck(t *testing.T) {
+	withFmtFlags(true, false, func() {
+		if err := fmtCmd(&medium{typ: inline, eskip: testUnformatted}, nil); err != notFormatted {
+			t.Error("failed to detect unformatted routes", err)
+		}
+
+		if err := fmtCmd(&medium{typ: inline, eskip: testFormattedDoc}, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestFmtWrite(t *testing.T) {
+	withFmtFlags(false, true, func() {
+		if err := fmtCmd(&medium{typ: inline, eskip: testUnformatted}, nil); err != writeRequiresFile {
+			t.Error("failed to fail", err)
+		}
+
+		if err := ioutil.WriteFile(testFmtFile, []byte(testUnformatted), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.Remove(testFmtFile)
+
+		if err := fmtCmd(&medium{typ: file, path: testFmtFile}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(testFmtFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != testFormattedDoc {
+			t.Error("failed to format the file", string(b))
+		}
+	})
+}
+
+func TestFmtInvalid(t *testing.T) {
+	if err := fmtCmd(&medium{typ: inline, eskip: `route1: Path("/") ->`}, nil); err == nil {
+		t.Error("failed to fail")
+	}
+}
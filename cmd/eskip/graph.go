@@ -0,0 +1,88 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"github.com/zalando/skipper/routegraph"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	dotFormat  = "dot"
+	jsonFormat = "json"
+)
+
+var invalidGraphFormat = errors.New("invalid graph format")
+
+// reads the known backends, one per line, skipping the empty lines and
+// the comments starting with #
+func readKnownBackends(r io.Reader) ([]string, error) {
+	var backends []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l != "" && !strings.HasPrefix(l, "#") {
+			backends = append(backends, l)
+		}
+	}
+
+	return backends, s.Err()
+}
+
+func loadKnownBackends(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return readKnownBackends(f)
+}
+
+// command executed for graph.
+func graphCmd(in, _ *medium) error {
+	var write func(*routegraph.Graph, io.Writer) error
+	switch outputFormat {
+	case "", dotFormat:
+		write = (*routegraph.Graph).WriteDOT
+	case jsonFormat:
+		write = (*routegraph.Graph).WriteJSON
+	default:
+		return invalidGraphFormat
+	}
+
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	g := routegraph.Build(routes)
+	if knownBackends != "" {
+		known, err := loadKnownBackends(knownBackends)
+		if err != nil {
+			return err
+		}
+
+		for _, o := range g.AddOrphans(known) {
+			printStderr("orphaned backend:", o)
+		}
+	}
+
+	return write(g, os.Stdout)
+}
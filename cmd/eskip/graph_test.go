@@ -0,0 +1,44 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadKnownBackends(t *testing.T) {
+	b, err := readKnownBackends(strings.NewReader(`
+		# the services of the team
+		https://api.internal
+
+		https://old.internal
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 2 || b[0] != "https://api.internal" || b[1] != "https://old.internal" {
+		t.Error("failed to read the backends", b)
+	}
+}
+
+func TestGraphInvalidFormat(t *testing.T) {
+	outputFormat = "svg"
+	defer func() { outputFormat = "" }()
+	if err := graphCmd(&medium{typ: inline, eskip: `Any() -> <shunt>`}, nil); err != invalidGraphFormat {
+		t.Error("failed to fail", err)
+	}
+}
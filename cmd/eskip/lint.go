@@ -0,0 +1,53 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/lint"
+)
+
+var lintFailed = errors.New("lint failed")
+
+// returns an error, when any of the findings is a warning or an error.
+func checkFindings(findings []lint.Finding) error {
+	if s, ok := lint.MaxSeverity(findings); ok && s >= lint.Warning {
+		return lintFailed
+	}
+
+	return nil
+}
+
+// command executed for lint.
+func lintCmd(in, _ *medium) error {
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	fs, err := eskip.ParseFilters(defaultFilters)
+	if err != nil {
+		return err
+	}
+
+	findings := lint.Lint(eskip.PrependFilters(routes, fs), nil)
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+
+	return checkFindings(findings)
+}
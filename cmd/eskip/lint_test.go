@@ -0,0 +1,49 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/zalando/skipper/lint"
+	"testing"
+)
+
+func TestCheckFindings(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		findings []lint.Finding
+		fail     bool
+	}{{
+		"no findings",
+		nil,
+		false,
+	}, {
+		"info only",
+		[]lint.Finding{{Severity: lint.Info}},
+		false,
+	}, {
+		"warning",
+		[]lint.Finding{{Severity: lint.Info}, {Severity: lint.Warning}},
+		true,
+	}, {
+		"error",
+		[]lint.Finding{{Severity: lint.Error}},
+		true,
+	}} {
+		err := checkFindings(ti.findings)
+		if ti.fail && err != lintFailed || !ti.fail && err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
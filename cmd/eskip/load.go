@@ -20,6 +20,7 @@ import (
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/eskipfile"
 	etcdclient "github.com/zalando/skipper/etcd"
+	"github.com/zalando/skipper/routestore"
 	"io"
 	"io/ioutil"
 	"net/url"
@@ -37,7 +38,7 @@ var invalidRouteExpression = errors.New("one or more invalid route expressions")
 
 // store all loaded routes, even if invalid, and store the
 // parse errors if any.
-func mapRouteInfo(allInfo []*etcdclient.RouteInfo) loadResult {
+func mapRouteInfo(allInfo []*routestore.RouteInfo) loadResult {
 	lr := loadResult{make(routeList, len(allInfo)), make(map[string]error)}
 	for i, info := range allInfo {
 		lr.routes[i] = &info.Route
@@ -80,7 +81,7 @@ func loadFile(path string) (loadResult, error) {
 // load and parse routes from etcd.
 func loadEtcd(urls []*url.URL, prefix string) (loadResult, error) {
 	client := etcdclient.New(urlsToStrings(urls), prefix)
-	info, err := client.LoadAndParseAll()
+	info, err := client.GetInitial()
 	return mapRouteInfo(info), err
 }
 
@@ -154,6 +155,15 @@ func checkCmd(in, _ *medium) error {
 	return err
 }
 
+// print a route in eskip format, with its id and comments, if any.
+func printRoute(r *eskip.Route) {
+	if r.Id == "" {
+		fmt.Println(eskip.String(r))
+	} else {
+		fmt.Printf("%s;\n", eskip.String(r))
+	}
+}
+
 // command executed for print.
 func printCmd(in, _ *medium) error {
 	lr, err := loadRoutes(in)
@@ -165,11 +175,7 @@ func printCmd(in, _ *medium) error {
 		if perr, hasError := lr.parseErrors[r.Id]; hasError {
 			printStderr(r.Id, perr)
 		} else {
-			if r.Id == "" {
-				fmt.Println(r.String())
-			} else {
-				fmt.Printf("%s: %s;\n", r.Id, r.String())
-			}
+			printRoute(r)
 		}
 	}
 
@@ -64,9 +64,27 @@ func validateSelectRead(media []*medium) (input, _ *medium, err error) {
 	return media[0], nil, nil
 }
 
+// validate media from args, and check if exactly one local input was
+// specified. (fmt)
+func validateSelectFmt(media []*medium) (input, _ *medium, err error) {
+	if len(media) == 0 {
+		return nil, nil, missingInput
+	}
+
+	if len(media) > 1 {
+		return nil, nil, tooManyInputs
+	}
+
+	if media[0].typ == etcd || media[0].typ == inlineIds {
+		return nil, nil, invalidInputType
+	}
+
+	return media[0], nil, nil
+}
+
 // validate media from args, and check if input was specified.
 // Select default etcd if no output etcd was specified.
-// (upsert, reset, delete)
+// (upsert, reset, delete, publish)
 func validateSelectWrite(cmd command, media []*medium) (input, output *medium, err error) {
 	if len(media) == 0 {
 		return nil, nil, missingInput
@@ -104,13 +122,84 @@ func validateSelectWrite(cmd command, media []*medium) (input, output *medium, e
 	return in, out, nil
 }
 
+// validate media from args, and check that at most one etcd medium was
+// specified, other than stdin, which is ignored. Select default etcd, if
+// no medium specified. (rollback)
+func validateSelectStore(media []*medium) (_, output *medium, err error) {
+	var out *medium
+	for _, m := range media {
+		switch {
+		case m.typ == stdin:
+		case m.typ != etcd:
+			return nil, nil, invalidInputType
+		case out != nil:
+			return nil, nil, tooManyInputs
+		default:
+			out = m
+		}
+	}
+
+	if out == nil {
+		m, err := processEtcdArgs(defaultEtcdUrls, defaultEtcdPrefix)
+		return nil, m, err
+	}
+
+	return nil, out, nil
+}
+
+// validate media from args, and check that at most one input was
+// specified, other than stdin, which is used for the interactive
+// session. No input means starting without routes. (repl)
+func validateSelectRepl(media []*medium) (input, _ *medium, err error) {
+	var in []*medium
+	for _, m := range media {
+		if m.typ != stdin {
+			in = append(in, m)
+		}
+	}
+
+	if len(in) > 1 {
+		return nil, nil, tooManyInputs
+	}
+
+	if len(in) == 0 {
+		return nil, nil, nil
+	}
+
+	if in[0].typ == inlineIds {
+		return nil, nil, invalidInputType
+	}
+
+	return in[0], nil, nil
+}
+
+// validate media from args, and check that no input was specified,
+// other than stdin, which is ignored. (fleet-check)
+func validateSelectNone(media []*medium) (_, _ *medium, err error) {
+	for _, m := range media {
+		if m.typ != stdin {
+			return nil, nil, invalidInputType
+		}
+	}
+
+	return nil, nil, nil
+}
+
 // Validate media from args for the current command, and select input and/or output.
 func validateSelectMedia(cmd command, media []*medium) (input, output *medium, err error) {
 	switch cmd {
-	case check, print:
+	case check, print, effective, lintRoutes, replay, compile, docRoutes, graph:
 		return validateSelectRead(media)
-	case upsert, reset, delete:
+	case upsert, reset, delete, publish:
 		return validateSelectWrite(cmd, media)
+	case rollback:
+		return validateSelectStore(media)
+	case fmtRoutes:
+		return validateSelectFmt(media)
+	case repl:
+		return validateSelectRepl(media)
+	case fleetCheck:
+		return validateSelectNone(media)
 	default:
 		return nil, nil, invalidCommand
 	}
@@ -124,6 +124,42 @@ func TestValidateSelectMedia(t *testing.T) {
 		nil,
 	}, {
 
+		// missing input for fmt
+		"fmt",
+		nil,
+		true,
+		missingInput,
+		nil,
+		nil,
+	}, {
+
+		// etcd for fmt
+		"fmt",
+		[]*medium{{typ: etcd}},
+		true,
+		invalidInputType,
+		nil,
+		nil,
+	}, {
+
+		// returns input for fmt
+		"fmt",
+		[]*medium{{typ: file, path: "routes.eskip"}},
+		false,
+		nil,
+		&medium{typ: file, path: "routes.eskip"},
+		nil,
+	}, {
+
+		// returns input for replay
+		"replay",
+		[]*medium{{typ: file, path: "routes.eskip"}},
+		false,
+		nil,
+		&medium{typ: file, path: "routes.eskip"},
+		nil,
+	}, {
+
 		// missing input
 		"upsert",
 		nil,
@@ -200,6 +236,56 @@ func TestValidateSelectMedia(t *testing.T) {
 				{Scheme: "https", Host: "etcd2.example.org:4545"}},
 			path: "/skipper",
 		},
+	}, {
+
+		// output defaults to etcd when rolling back
+		"rollback",
+		[]*medium{{typ: stdin}},
+		false,
+		nil,
+		nil,
+		&medium{
+			typ: etcd,
+			urls: []*url.URL{
+				{Scheme: "http", Host: "127.0.0.1:2379"},
+				{Scheme: "http", Host: "127.0.0.1:4001"}},
+			path: "/skipper"},
+	}, {
+
+		// rollback accepts only etcd
+		"rollback",
+		[]*medium{{typ: file, path: "routes.eskip"}},
+		true,
+		invalidInputType,
+		nil,
+		nil,
+	}, {
+
+		// repl reads the session from stdin
+		"repl",
+		[]*medium{{typ: stdin}},
+		false,
+		nil,
+		nil,
+		nil,
+	}, {
+
+		// repl with initial routes
+		"repl",
+		[]*medium{{typ: stdin}, {typ: file, path: "routes.eskip"}},
+		false,
+		nil,
+		&medium{typ: file, path: "routes.eskip"},
+		nil,
+	}, {
+
+		// repl doesn't accept ids
+		"repl",
+		[]*medium{{typ: inlineIds, ids: []string{"route1"}}},
+		true,
+		invalidInputType,
+		nil,
+		nil,
 	}} {
 		in, out, err := validateSelectMedia(item.command, item.media)
 		if item.fail {
@@ -0,0 +1,496 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	replPrompt         = "> "
+	replContinuePrompt = "... "
+	replDefaultHost    = "localhost"
+
+	replHelp = `Enter routes in eskip format, to add them or replace the ones with the
+same id, or requests in the format:
+
+    <method> <url> [<header>:<value> ...]
+
+e.g.:
+
+    GET https://www.example.org/foo?bar=baz Accept:application/json
+
+to print the matched route, the request sent to the backend and the
+response. The backends of the routes are replaced by a mock, so no
+request leaves the process, except for the dynamic backends.
+
+Commands:
+
+    :routes          print the current routes
+    :delete <id>...  delete routes
+    :clear           delete all routes
+    :help            print this help
+    :quit            exit`
+)
+
+var (
+	invalidRequestLine = errors.New("invalid request line, expected: <method> <url> [<header>:<value> ...]")
+	errQuit            = errors.New("quit")
+)
+
+var replMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+	"CONNECT": true,
+	"TRACE":   true,
+}
+
+// the request received by the mock backend
+type recordedRequest struct {
+	backend string
+	method  string
+	uri     string
+	host    string
+	header  http.Header
+}
+
+// records the requests received in place of a backend
+type recordingBackend struct {
+	backend string
+	server  *httptest.Server
+	mx      *sync.Mutex
+	last    **recordedRequest
+}
+
+func (b *recordingBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	*b.last = &recordedRequest{
+		backend: b.backend,
+		method:  r.Method,
+		uri:     r.URL.RequestURI(),
+		host:    r.Host,
+		header:  r.Header}
+}
+
+// the state of an interactive session: the current routes, and the
+// routing and the proxy serving them
+type replSession struct {
+	out            io.Writer
+	defaultFilters []*eskip.Filter
+	registry       filters.Registry
+	routes         []*eskip.Route
+	mocks          map[string]*recordingBackend
+	mx             sync.Mutex
+	last           *recordedRequest
+	routing        *routing.Routing
+	proxy          http.Handler
+}
+
+func newReplSession(out io.Writer, routes []*eskip.Route, defaultFilters []*eskip.Filter) *replSession {
+	s := &replSession{
+		out:            out,
+		defaultFilters: defaultFilters,
+		registry:       builtin.MakeRegistry(),
+		mocks:          make(map[string]*recordingBackend)}
+	s.setRoutes(routes)
+	return s
+}
+
+// returns the mock backend in place of a backend, creating it when
+// necessary
+func (s *replSession) mock(backend string) string {
+	if m, ok := s.mocks[backend]; ok {
+		return m.server.URL
+	}
+
+	m := &recordingBackend{backend: backend, mx: &s.mx, last: &s.last}
+	m.server = httptest.NewServer(m)
+	s.mocks[backend] = m
+	return m.server.URL
+}
+
+// replaces the network backends of the routes with recording mocks
+func (s *replSession) mockBackends(routes []*eskip.Route) []*eskip.Route {
+	var mocked []*eskip.Route
+	for _, r := range routes {
+		c := r.Copy()
+		switch {
+		case c.Shunt, c.Loopback, c.Dynamic:
+		case len(c.SplitBackends) > 0:
+			for _, b := range c.SplitBackends {
+				b.Backend = s.mock(b.Backend)
+			}
+		default:
+			c.Backend = s.mock(c.Backend)
+		}
+
+		mocked = append(mocked, c)
+	}
+
+	return mocked
+}
+
+// replaces the routing with one serving the routes
+func (s *replSession) setRoutes(routes []*eskip.Route) {
+	if s.routing != nil {
+		s.routing.Close()
+	}
+
+	s.routes = routes
+	s.routing = replayRouting(s.mockBackends(eskip.PrependFilters(routes, s.defaultFilters)))
+	s.proxy = proxy.New(s.routing, proxy.OptionsNone)
+}
+
+func (s *replSession) close() {
+	s.routing.Close()
+	for _, m := range s.mocks {
+		m.server.Close()
+	}
+}
+
+// checks that the filters of the routes exist and accept their args,
+// because the routing would drop the invalid routes silently
+func (s *replSession) checkFilters(routes []*eskip.Route) error {
+	for _, r := range routes {
+		for _, f := range r.Filters {
+			spec, ok := s.registry[f.Name]
+			if !ok {
+				return fmt.Errorf("%s: unknown filter: %s", r.Id, f.Name)
+			}
+
+			if _, err := spec.CreateFilter(f.Args); err != nil {
+				return fmt.Errorf("%s: invalid filter: %s: %v", r.Id, f.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// adds the routes, or replaces the ones with the same id
+func (s *replSession) upsert(routes []*eskip.Route) error {
+	if err := s.checkFilters(routes); err != nil {
+		return err
+	}
+
+	byId := make(map[string]*eskip.Route)
+	for _, r := range routes {
+		byId[r.Id] = r
+	}
+
+	// the "delete" builtin is shadowed by the command
+	replaced := make(map[string]bool)
+
+	var updated []*eskip.Route
+	for _, r := range s.routes {
+		if nr, ok := byId[r.Id]; ok {
+			updated = append(updated, nr)
+			replaced[r.Id] = true
+		} else {
+			updated = append(updated, r)
+		}
+	}
+
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+		if !replaced[r.Id] {
+			updated = append(updated, r)
+		}
+	}
+
+	s.setRoutes(updated)
+	fmt.Fprintf(s.out, "updated: %s\n", strings.Join(ids, ", "))
+	return nil
+}
+
+func (s *replSession) deleteRoutes(ids []string) {
+	del := make(map[string]bool)
+	for _, id := range ids {
+		del[id] = true
+	}
+
+	var remaining []*eskip.Route
+	for _, r := range s.routes {
+		if !del[r.Id] {
+			remaining = append(remaining, r)
+		}
+	}
+
+	s.setRoutes(remaining)
+	fmt.Fprintf(s.out, "%d routes\n", len(remaining))
+}
+
+// executes a command starting with a colon
+func (s *replSession) command(line string) error {
+	args := strings.Fields(line)
+	switch args[0] {
+	case ":routes":
+		for _, r := range s.routes {
+			fmt.Fprintf(s.out, "%s;\n", eskip.String(r))
+		}
+	case ":delete":
+		s.deleteRoutes(args[1:])
+	case ":clear":
+		s.setRoutes(nil)
+		fmt.Fprintln(s.out, "0 routes")
+	case ":help":
+		fmt.Fprintln(s.out, replHelp)
+	case ":quit", ":exit":
+		return errQuit
+	default:
+		return fmt.Errorf("invalid command: %s", args[0])
+	}
+
+	return nil
+}
+
+// creates the request from a request line
+func parseRequestLine(line string) (*http.Request, error) {
+	args := strings.Fields(line)
+	if len(args) < 2 {
+		return nil, invalidRequestLine
+	}
+
+	u := args[1]
+	if strings.HasPrefix(u, "/") {
+		u = "http://" + replDefaultHost + u
+	}
+
+	r, err := http.NewRequest(args[0], u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range args[2:] {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, invalidRequestLine
+		}
+
+		r.Header.Add(h[:i], h[i+1:])
+	}
+
+	if h := r.Header.Get("Host"); h != "" {
+		r.Host = h
+	}
+
+	return r, nil
+}
+
+func printHeader(w io.Writer, h http.Header, skip ...string) {
+	var keys []string
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if contains(skip, k) {
+			continue
+		}
+
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "    %s: %s\n", k, v)
+		}
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, si := range s {
+		if si == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prints the request received by the mock, with the host of the
+// original backend in place of the mock
+func (s *replSession) printBackendRequest(rr *recordedRequest) {
+	b, err := url.Parse(rr.backend)
+	if err != nil {
+		b = &url.URL{}
+	}
+
+	host := rr.host
+	if m, ok := s.mocks[rr.backend]; ok && strings.TrimPrefix(m.server.URL, "http://") == host {
+		host = b.Host
+	}
+
+	fmt.Fprintln(s.out, "backend request:")
+	fmt.Fprintf(s.out, "    %s %s://%s%s\n", rr.method, b.Scheme, b.Host, rr.uri)
+	fmt.Fprintf(s.out, "    Host: %s\n", host)
+	printHeader(s.out, rr.header, "Accept-Encoding", "User-Agent")
+}
+
+// routes a request through the proxy, and prints the matched route, the
+// request received by the backend and the response
+func (s *replSession) request(line string) error {
+	r, err := parseRequestLine(line)
+	if err != nil {
+		return err
+	}
+
+	rt, _ := s.routing.Route(r)
+	if rt == nil {
+		fmt.Fprintln(s.out, "route: no match")
+	} else {
+		fmt.Fprintf(s.out, "route: %s\n", rt.Id)
+		for _, ri := range s.routes {
+			if ri.Id == rt.Id {
+				fmt.Fprintf(s.out, "    %s\n", ri.String())
+				break
+			}
+		}
+	}
+
+	s.mx.Lock()
+	s.last = nil
+	s.mx.Unlock()
+
+	w := httptest.NewRecorder()
+	s.proxy.ServeHTTP(w, r)
+
+	s.mx.Lock()
+	rr := s.last
+	s.mx.Unlock()
+
+	if rr != nil {
+		s.printBackendRequest(rr)
+	}
+
+	fmt.Fprintf(s.out, "response: %d %s\n", w.Code, http.StatusText(w.Code))
+	printHeader(s.out, w.HeaderMap, "Date", "Content-Length", "Server", "X-Powered-By")
+	return nil
+}
+
+func isRequestLine(line string) bool {
+	args := strings.Fields(line)
+	return len(args) > 0 && replMethods[args[0]]
+}
+
+func (s *replSession) printError(err error) {
+	fmt.Fprintln(s.out, "error:", err)
+	if perr, ok := err.(*eskip.ParseError); ok {
+		fmt.Fprintln(s.out, perr.Snippet)
+	}
+}
+
+// reads the input line by line, until EOF or :quit. The lines that are
+// not commands or requests are collected until they can be parsed as
+// routes. When the collected lines can't be parsed, and the last line
+// ends with a semicolon, or an empty line is entered, the parse error
+// is printed.
+func (s *replSession) run(in io.Reader) error {
+	var (
+		buffer string
+		prompt = replPrompt
+	)
+
+	r := bufio.NewReader(in)
+	for {
+		fmt.Fprint(s.out, prompt)
+		l, rerr := r.ReadString('\n')
+		line := strings.TrimSpace(l)
+
+		var err error
+		switch {
+		case buffer == "" && line == "":
+		case buffer == "" && strings.HasPrefix(line, ":"):
+			err = s.command(line)
+		case buffer == "" && isRequestLine(line):
+			err = s.request(line)
+		default:
+			buffer += l
+			if !strings.HasSuffix(buffer, "\n") {
+				buffer += "\n"
+			}
+
+			routes, perr := eskip.Parse(buffer)
+			switch {
+			case perr == nil:
+				buffer = ""
+				if len(routes) > 0 {
+					err = s.upsert(routes)
+				}
+			case line == "" || strings.HasSuffix(line, ";") || rerr == io.EOF:
+				buffer = ""
+				err = perr
+			}
+		}
+
+		if err == errQuit {
+			return nil
+		} else if err != nil {
+			s.printError(err)
+		}
+
+		if buffer == "" {
+			prompt = replPrompt
+		} else {
+			prompt = replContinuePrompt
+		}
+
+		if rerr == io.EOF {
+			fmt.Fprintln(s.out)
+			return nil
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// command executed for repl.
+func replCmd(in, _ *medium) error {
+	var routes []*eskip.Route
+	if in != nil {
+		var err error
+		if routes, err = loadRoutesChecked(in); err != nil {
+			return err
+		}
+	}
+
+	fs, err := eskip.ParseFilters(defaultFilters)
+	if err != nil {
+		return err
+	}
+
+	s := newReplSession(os.Stdout, routes, fs)
+	defer s.close()
+	return s.run(os.Stdin)
+}
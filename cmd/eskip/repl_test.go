@@ -0,0 +1,112 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runRepl(t *testing.T, input string) string {
+	var out bytes.Buffer
+	s := newReplSession(&out, nil, nil)
+	defer s.close()
+	if err := s.run(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func checkOutput(t *testing.T, out string, expected ...string) {
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing from the output: %q\n%s", e, out)
+		}
+	}
+}
+
+func TestReplRequest(t *testing.T) {
+	out := runRepl(t, `
+		foo: Path("/foo")
+		  -> modPath("^/foo", "/bar")
+		  -> requestHeader("X-Bar", "baz")
+		  -> "https://backend.example.org";
+		GET /foo?q=1 X-Foo:qux
+		GET /other
+	`)
+
+	checkOutput(t, out,
+		"updated: foo",
+		"route: foo",
+		"GET https://backend.example.org/bar?q=1",
+		"Host: localhost",
+		"X-Bar: baz",
+		"X-Foo: qux",
+		"response: 200 OK",
+		"route: no match",
+		"response: 404 Not Found")
+}
+
+func TestReplShunt(t *testing.T) {
+	out := runRepl(t, `redirect: Host("^www[.]example[.]org$") -> redirect(302, "https://example.org") -> <shunt>;
+GET https://www.example.org/foo
+`)
+
+	checkOutput(t, out,
+		"route: redirect",
+		"response: 302 Found",
+		"Location: https://example.org/foo")
+	if strings.Contains(out, "backend request:") {
+		t.Error("unexpected backend request", out)
+	}
+}
+
+func TestReplReplaceAndDelete(t *testing.T) {
+	out := runRepl(t, `foo: Path("/foo") -> "https://foo.example.org";
+foo: Path("/foo") -> "https://bar.example.org";
+GET /foo
+:delete foo
+GET /foo
+`)
+
+	checkOutput(t, out,
+		"GET https://bar.example.org/foo",
+		"0 routes",
+		"route: no match")
+}
+
+func TestReplErrors(t *testing.T) {
+	out := runRepl(t, `foo: Path("/foo") -> ;
+foo: Path("/foo") -> unknownFilter() -> <shunt>;
+GET
+:unknown
+:quit
+GET /foo
+`)
+
+	checkOutput(t, out,
+		"unknown filter: unknownFilter",
+		invalidRequestLine.Error(),
+		"invalid command: :unknown")
+	if strings.Count(out, "error:") != 4 {
+		t.Error("failed to report the errors", out)
+	}
+
+	if strings.Contains(out, "route:") {
+		t.Error("failed to quit", out)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	replayPollTimeout = 30 * time.Millisecond
+	replayLoadTimeout = 3 * time.Second
+)
+
+var (
+	missingCapture = errors.New("missing capture file")
+	replayFailed   = errors.New("replay found differences")
+)
+
+// A captured request, with the route that it matched, and the status of
+// the response that it received. The capture file contains one JSON
+// object per line, in this format.
+type capturedRequest struct {
+	Method string      `json:"method"`
+	Url    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+	Route  string      `json:"route"`
+	Status int         `json:"status"`
+}
+
+// the result of replaying a captured request
+type replayResult struct {
+	route  string
+	status int
+}
+
+// data client returning the routes only when the listener of the route
+// changes was registered, so that the first update is not missed
+type replayDataClient struct {
+	routes []*eskip.Route
+	ready  chan struct{}
+}
+
+func (c *replayDataClient) LoadAll() ([]*eskip.Route, error) {
+	<-c.ready
+	return c.routes, nil
+}
+
+func (c *replayDataClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return nil, nil, nil
+}
+
+// reads the captured requests from a file
+func readCapture(path string) ([]*capturedRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var (
+		requests []*capturedRequest
+		line     int
+	)
+
+	r := bufio.NewReader(f)
+	for {
+		l, err := r.ReadString('\n')
+		line++
+		if strings.TrimSpace(l) != "" {
+			c := &capturedRequest{}
+			if err := json.Unmarshal([]byte(l), c); err != nil {
+				return nil, fmt.Errorf("%s: line %d: %v", path, line, err)
+			}
+
+			requests = append(requests, c)
+		}
+
+		if err == io.EOF {
+			return requests, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// responds with the status of the currently replayed request, used in
+// place of the backends of the routes
+type mockBackend struct {
+	status int32
+}
+
+func (b *mockBackend) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(int(atomic.LoadInt32(&b.status)))
+}
+
+// replaces the network backends of the routes with the mock backend
+func mockBackends(routes []*eskip.Route, url string) []*eskip.Route {
+	var mocked []*eskip.Route
+	for _, r := range routes {
+		c := r.Copy()
+		switch {
+		case c.Shunt, c.Loopback, c.Dynamic:
+		case len(c.SplitBackends) > 0:
+			for _, b := range c.SplitBackends {
+				b.Backend = url
+			}
+		default:
+			c.Backend = url
+		}
+
+		mocked = append(mocked, c)
+	}
+
+	return mocked
+}
+
+// creates a routing with the routes, and waits until the routes are
+// loaded
+func replayRouting(routes []*eskip.Route) *routing.Routing {
+	dc := &replayDataClient{routes: routes, ready: make(chan struct{})}
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    replayPollTimeout,
+		DataClients:    []routing.DataClient{dc}})
+
+	loaded := make(chan struct{})
+	var once sync.Once
+	rt.NotifyRouteChanges(func(routing.RouteChanges) {
+		once.Do(func() { close(loaded) })
+	})
+
+	close(dc.ready)
+	if len(routes) > 0 {
+		select {
+		case <-loaded:
+		case <-time.After(replayLoadTimeout):
+		}
+	}
+
+	return rt
+}
+
+// replays a captured request through the proxy, and returns the id of
+// the matched route and the status of the response
+func replayRequest(rt *routing.Routing, p http.Handler, c *capturedRequest) (*replayResult, error) {
+	req, err := http.NewRequest(c.Method, c.Url, strings.NewReader(c.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+
+	if h := req.Header.Get("Host"); h != "" {
+		req.Host = h
+	}
+
+	result := &replayResult{}
+	if r, _ := rt.Route(req); r != nil {
+		result.route = r.Id
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	result.status = w.Code
+	return result, nil
+}
+
+// returns the differences between the captured and the replayed request
+func replayDiff(c *capturedRequest, r *replayResult) []string {
+	var diff []string
+	if r.route != c.Route {
+		diff = append(diff, fmt.Sprintf("route: %q, captured: %q", r.route, c.Route))
+	}
+
+	if r.status != c.Status {
+		diff = append(diff, fmt.Sprintf("status: %d, captured: %d", r.status, c.Status))
+	}
+
+	return diff
+}
+
+// command executed for replay.
+func replayCmd(in, _ *medium) error {
+	if replayCapture == "" {
+		return missingCapture
+	}
+
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	fs, err := eskip.ParseFilters(defaultFilters)
+	if err != nil {
+		return err
+	}
+
+	requests, err := readCapture(replayCapture)
+	if err != nil {
+		return err
+	}
+
+	routes = eskip.PrependFilters(routes, fs)
+
+	var mock *mockBackend
+	if replayMockBackends {
+		mock = &mockBackend{}
+		s := httptest.NewServer(mock)
+		defer s.Close()
+		routes = mockBackends(routes, s.URL)
+	}
+
+	rt := replayRouting(routes)
+	defer rt.Close()
+
+	p := proxy.New(rt, proxy.OptionsNone)
+
+	var differences int
+	for _, c := range requests {
+		if mock != nil {
+			atomic.StoreInt32(&mock.status, int32(c.Status))
+		}
+
+		r, err := replayRequest(rt, p, c)
+		if err != nil {
+			return err
+		}
+
+		if d := replayDiff(c, r); len(d) > 0 {
+			differences++
+			fmt.Printf("%s %s: %s\n", c.Method, c.Url, strings.Join(d, ", "))
+		}
+	}
+
+	fmt.Printf("replayed %d requests, %d with differences\n", len(requests), differences)
+	if differences > 0 {
+		return replayFailed
+	}
+
+	return nil
+}
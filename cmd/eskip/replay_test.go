@@ -0,0 +1,99 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const (
+	testCaptureFile  = "testCapture.jsonl"
+	testReplayRoutes = `
+		foo: Path("/foo") -> <shunt>;
+		bar: Path("/bar") -> "https://bar.example.org"`
+)
+
+func withReplayFlags(capture string, mock bool, action func()) {
+	replayCapture, replayMockBackends = capture, mock
+	defer func() { replayCapture, replayMockBackends = "", false }()
+	action()
+}
+
+func withCapture(t *testing.T, capture string, action func()) {
+	if err := ioutil.WriteFile(testCaptureFile, []byte(capture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(testCaptureFile)
+	action()
+}
+
+func TestReplayMissingCapture(t *testing.T) {
+	if err := replayCmd(&medium{typ: inline, eskip: testReplayRoutes}, nil); err != missingCapture {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestReplayInvalidCapture(t *testing.T) {
+	withCapture(t, `{"method": "GET"`, func() {
+		withReplayFlags(testCaptureFile, false, func() {
+			if err := replayCmd(&medium{typ: inline, eskip: testReplayRoutes}, nil); err == nil {
+				t.Error("failed to fail")
+			}
+		})
+	})
+}
+
+func TestReplayMatches(t *testing.T) {
+	withCapture(t, `
+		{"method": "GET", "url": "http://www.example.org/foo", "route": "foo", "status": 404}
+		{"method": "GET", "url": "http://www.example.org/bar", "route": "bar", "status": 200}
+		{"method": "GET", "url": "http://www.example.org/baz", "status": 404}`,
+		func() {
+			withReplayFlags(testCaptureFile, true, func() {
+				if err := replayCmd(&medium{typ: inline, eskip: testReplayRoutes}, nil); err != nil {
+					t.Error(err)
+				}
+			})
+		})
+}
+
+func TestReplayDifferences(t *testing.T) {
+	for _, capture := range []string{
+		`{"method": "GET", "url": "http://www.example.org/foo", "route": "bar", "status": 404}`,
+		`{"method": "GET", "url": "http://www.example.org/foo", "route": "foo", "status": 200}`,
+	} {
+		withCapture(t, capture, func() {
+			withReplayFlags(testCaptureFile, true, func() {
+				if err := replayCmd(&medium{typ: inline, eskip: testReplayRoutes}, nil); err != replayFailed {
+					t.Error("failed to detect differences", capture, err)
+				}
+			})
+		})
+	}
+}
+
+func TestReplayDiff(t *testing.T) {
+	c := &capturedRequest{Route: "foo", Status: 200}
+	if d := replayDiff(c, &replayResult{route: "foo", status: 200}); len(d) != 0 {
+		t.Error("unexpected differences", d)
+	}
+
+	if d := replayDiff(c, &replayResult{route: "bar", status: 404}); len(d) != 2 {
+		t.Error("failed to report differences", d)
+	}
+}
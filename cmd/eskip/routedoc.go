@@ -0,0 +1,386 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	markdownFormat = "markdown"
+	htmlFormat     = "html"
+)
+
+var invalidDocFormat = errors.New("invalid documentation format")
+
+// an argument of a filter, with its name, when the filter declares a
+// schema
+type argDoc struct {
+	Name  string
+	Value string
+}
+
+type filterDoc struct {
+	Call        string
+	Description string
+	Args        []argDoc
+}
+
+// the human readable description of a route
+type routeDoc struct {
+	Id         string
+	Comments   []string
+	Metadata   []string
+	Conditions string
+	Filters    []filterDoc
+	Backend    string
+}
+
+// formats an argument of a predicate or a filter
+func docValue(v interface{}) string {
+	switch vt := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", vt)
+	case float64:
+		return fmt.Sprintf("%g", vt)
+	default:
+		return fmt.Sprint(vt)
+	}
+}
+
+func stringArgs(args []interface{}) []string {
+	s := make([]string, len(args))
+	for i, a := range args {
+		s[i] = fmt.Sprint(a)
+	}
+
+	return s
+}
+
+// describes a single condition in plain language
+func describePredicate(name string, args []interface{}) string {
+	a := stringArgs(args)
+	switch {
+	case name == "Any":
+		return "any request"
+	case name == "ClientCertificate":
+		return "the client presents a TLS certificate"
+	case len(a) == 1 && name == "Path":
+		if strings.Contains(a[0], "/:") || strings.Contains(a[0], "/*") {
+			return fmt.Sprintf("the path matches the pattern %s", a[0])
+		}
+
+		return fmt.Sprintf("the path is %s", a[0])
+	case len(a) == 1 && name == "PathRegexp":
+		return fmt.Sprintf("the path matches /%s/", a[0])
+	case len(a) == 1 && name == "Host":
+		return fmt.Sprintf("the host matches /%s/", a[0])
+	case len(a) == 1 && name == "Method":
+		return fmt.Sprintf("the method is %s", a[0])
+	case len(a) == 1 && name == "ClientTLSVersion":
+		return fmt.Sprintf("the client connection uses TLS %s", a[0])
+	case len(a) > 0 && name == "ClientIP":
+		return fmt.Sprintf("the client address is in %s", strings.Join(a, ", "))
+	case len(a) == 1 && name == "ValidUntil":
+		return fmt.Sprintf("the time is before %s", a[0])
+	case len(a) == 1 && name == "TrailingSlash":
+		return fmt.Sprintf("the trailing slash policy is %s", a[0])
+	case len(a) == 2 && name == "Header":
+		return fmt.Sprintf("the %s header is %q", a[0], a[1])
+	case len(a) == 2 && name == "HeaderRegexp":
+		return fmt.Sprintf("the %s header matches /%s/", a[0], a[1])
+	default:
+		v := make([]string, len(args))
+		for i, arg := range args {
+			v[i] = docValue(arg)
+		}
+
+		return fmt.Sprintf("the %s(%s) condition matches", name, strings.Join(v, ", "))
+	}
+}
+
+// describes a predicate expression in plain language
+func describeExpression(e *eskip.PredicateExpression) string {
+	switch e.Operator {
+	case eskip.PredicateMatch:
+		return describePredicate(e.Predicate.Name, e.Predicate.Args)
+	case eskip.PredicateNot:
+		return fmt.Sprintf("not (%s)", describeExpression(e.Operands[0]))
+	}
+
+	join := " and "
+	if e.Operator == eskip.PredicateOr {
+		join = " or "
+	}
+
+	d := make([]string, len(e.Operands))
+	for i, o := range e.Operands {
+		d[i] = describeExpression(o)
+		if o.Operator == eskip.PredicateAnd || o.Operator == eskip.PredicateOr {
+			d[i] = "(" + d[i] + ")"
+		}
+	}
+
+	return strings.Join(d, join)
+}
+
+// describes the conditions of a route in plain language
+func describeConditions(r *eskip.Route) string {
+	var c []string
+	if r.Path != "" {
+		c = append(c, describePredicate("Path", []interface{}{r.Path}))
+	}
+
+	for _, rx := range r.HostRegexps {
+		c = append(c, describePredicate("Host", []interface{}{rx}))
+	}
+
+	for _, rx := range r.PathRegexps {
+		c = append(c, describePredicate("PathRegexp", []interface{}{rx}))
+	}
+
+	if r.Method != "" {
+		c = append(c, describePredicate("Method", []interface{}{r.Method}))
+	}
+
+	var keys []string
+	for k := range r.Headers {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		c = append(c, describePredicate("Header", []interface{}{k, r.Headers[k]}))
+	}
+
+	keys = nil
+	for k := range r.HeaderRegexps {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, rx := range r.HeaderRegexps[k] {
+			c = append(c, describePredicate("HeaderRegexp", []interface{}{k, rx}))
+		}
+	}
+
+	for _, p := range r.CustomPredicates {
+		c = append(c, describePredicate(p.Name, p.Args))
+	}
+
+	if r.Predicate != nil {
+		d := describeExpression(r.Predicate)
+		if r.Predicate.Operator == eskip.PredicateOr && len(c) > 0 {
+			d = "(" + d + ")"
+		}
+
+		c = append(c, d)
+	}
+
+	if len(c) == 0 {
+		return "all requests"
+	}
+
+	return "requests where " + strings.Join(c, ", and ")
+}
+
+func describeBackend(r *eskip.Route) string {
+	switch {
+	case r.Shunt:
+		return "none, the response is created by the filters"
+	case r.Loopback:
+		return "loopback, the request is matched again against the routes"
+	case r.Dynamic:
+		return "dynamic, the address is set by the filters"
+	case len(r.SplitBackends) > 0:
+		var b []string
+		for _, wb := range r.SplitBackends {
+			b = append(b, fmt.Sprintf("%s with weight %d", wb.Backend, wb.Weight))
+		}
+
+		return "split between " + strings.Join(b, ", ")
+	default:
+		return r.Backend
+	}
+}
+
+// maps the filter names and aliases to the filter specifications
+func specsByName(specs []filters.SpecInfo) map[string]filters.SpecInfo {
+	m := make(map[string]filters.SpecInfo)
+	for _, s := range specs {
+		m[s.Name] = s
+		for _, a := range s.Aliases {
+			m[a] = s
+		}
+	}
+
+	return m
+}
+
+func describeFilter(f *eskip.Filter, specs map[string]filters.SpecInfo) filterDoc {
+	d := filterDoc{Call: f.String()}
+	s, ok := specs[f.Name]
+	if !ok {
+		d.Description = "Unknown filter."
+		return d
+	}
+
+	d.Description = s.Description
+	if len(s.Args) == 0 {
+		return d
+	}
+
+	for i, a := range f.Args {
+		arg := s.Args[len(s.Args)-1]
+		if i < len(s.Args) {
+			arg = s.Args[i]
+		} else if !arg.Variadic {
+			break
+		}
+
+		d.Args = append(d.Args, argDoc{arg.Name, docValue(a)})
+	}
+
+	return d
+}
+
+// creates the human readable description of the routes, using the
+// documentation of the filter specifications
+func describeRoutes(routes []*eskip.Route, specs []filters.SpecInfo) []*routeDoc {
+	m := specsByName(specs)
+	docs := make([]*routeDoc, len(routes))
+	for i, r := range routes {
+		d := &routeDoc{
+			Id:         r.Id,
+			Comments:   r.Comments,
+			Conditions: describeConditions(r),
+			Backend:    describeBackend(r)}
+
+		for k, v := range r.Metadata {
+			d.Metadata = append(d.Metadata, fmt.Sprintf("%s: %s", k, v))
+		}
+
+		sort.Strings(d.Metadata)
+		for _, f := range r.Filters {
+			d.Filters = append(d.Filters, describeFilter(f, m))
+		}
+
+		docs[i] = d
+	}
+
+	return docs
+}
+
+func writeMarkdown(w io.Writer, docs []*routeDoc) error {
+	var lines []string
+	lines = append(lines, "# Routes")
+	for _, d := range docs {
+		lines = append(lines, "", "## "+d.Id)
+		if len(d.Comments) > 0 {
+			lines = append(lines, "", strings.Join(d.Comments, "\n"))
+		}
+
+		if len(d.Metadata) > 0 {
+			lines = append(lines, "")
+			for _, m := range d.Metadata {
+				lines = append(lines, "- "+m)
+			}
+		}
+
+		lines = append(lines, "", "**Matches:** "+d.Conditions)
+		if len(d.Filters) > 0 {
+			lines = append(lines, "", "**Filters:**", "")
+			for i, f := range d.Filters {
+				l := fmt.Sprintf("%d. `%s`", i+1, f.Call)
+				if f.Description != "" {
+					l += ": " + f.Description
+				}
+
+				if len(f.Args) > 0 {
+					var a []string
+					for _, ai := range f.Args {
+						a = append(a, fmt.Sprintf("%s: `%s`", ai.Name, ai.Value))
+					}
+
+					l += " (" + strings.Join(a, ", ") + ")"
+				}
+
+				lines = append(lines, l)
+			}
+		}
+
+		lines = append(lines, "", "**Backend:** "+d.Backend)
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+var htmlDoc = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Routes</title></head>
+<body>
+<h1>Routes</h1>
+{{range .}}<section id="{{.Id}}">
+<h2>{{.Id}}</h2>
+{{range .Comments}}<p>{{.}}</p>
+{{end}}{{if .Metadata}}<ul>
+{{range .Metadata}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<p><strong>Matches:</strong> {{.Conditions}}</p>
+{{if .Filters}}<p><strong>Filters:</strong></p>
+<ol>
+{{range .Filters}}<li><code>{{.Call}}</code>{{if .Description}}: {{.Description}}{{end}}{{if .Args}}
+<ul>{{range .Args}}<li>{{.Name}}: <code>{{.Value}}</code></li>{{end}}</ul>{{end}}</li>
+{{end}}</ol>
+{{end}}<p><strong>Backend:</strong> {{.Backend}}</p>
+</section>
+{{end}}</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, docs []*routeDoc) error {
+	return htmlDoc.Execute(w, docs)
+}
+
+// command executed for doc.
+func docCmd(in, _ *medium) error {
+	var write func(io.Writer, []*routeDoc) error
+	switch outputFormat {
+	case "", markdownFormat:
+		write = writeMarkdown
+	case htmlFormat:
+		write = writeHTML
+	default:
+		return invalidDocFormat
+	}
+
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	return write(os.Stdout, describeRoutes(routes, builtin.MakeRegistry().Specs()))
+}
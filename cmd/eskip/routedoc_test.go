@@ -0,0 +1,124 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"strings"
+	"testing"
+)
+
+var testSpecs = []filters.SpecInfo{{
+	Name:        "redirect",
+	Aliases:     []string{"moved"},
+	Description: "Responds with a redirect to a location.",
+	Args: []filters.Arg{
+		{Name: "code", Type: filters.NumberType},
+		{Name: "location", Type: filters.StringType},
+	},
+}}
+
+func TestDescribeConditions(t *testing.T) {
+	for _, ti := range []struct {
+		route       string
+		description string
+	}{{
+		`Any() -> <shunt>`,
+		"all requests",
+	}, {
+		`Path("/users/:id") && Method("GET") && Header("Accept", "application/json") -> <shunt>`,
+		`requests where the path matches the pattern /users/:id, and the method is GET, ` +
+			`and the Accept header is "application/json"`,
+	}, {
+		`Path("/foo") && (Host(/^a[.]/) || !Method("POST")) -> <shunt>`,
+		"requests where the path is /foo, and (the host matches /^a[.]/ or not (the method is POST))",
+	}} {
+		r, err := eskip.Parse(ti.route)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d := describeConditions(r[0]); d != ti.description {
+			t.Error("unexpected description", d)
+		}
+	}
+}
+
+func TestDescribeRoutes(t *testing.T) {
+	r, err := eskip.Parse(`
+		// moves the old path
+		@owner("team-a")
+		old: Path("/old") -> moved(301, "/new") -> custom() -> <shunt>;
+		split: Any() -> <split 90 "https://stable.example.org", 10 "https://canary.example.org">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := describeRoutes(r, testSpecs)
+	if len(docs) != 2 {
+		t.Fatal("invalid number of routes", len(docs))
+	}
+
+	d := docs[0]
+	if d.Id != "old" || len(d.Comments) != 1 || len(d.Metadata) != 1 || d.Metadata[0] != "owner: team-a" {
+		t.Error("invalid route documentation", d)
+	}
+
+	if len(d.Filters) != 2 ||
+		d.Filters[0].Description != "Responds with a redirect to a location." ||
+		len(d.Filters[0].Args) != 2 || d.Filters[0].Args[1].Name != "location" ||
+		d.Filters[0].Args[1].Value != `"/new"` ||
+		d.Filters[1].Description != "Unknown filter." {
+		t.Error("invalid filter documentation", d.Filters)
+	}
+
+	if d.Backend != "none, the response is created by the filters" {
+		t.Error("invalid backend", d.Backend)
+	}
+
+	if docs[1].Backend != "split between https://stable.example.org with weight 90, https://canary.example.org with weight 10" {
+		t.Error("invalid backend", docs[1].Backend)
+	}
+}
+
+func TestWriteDocs(t *testing.T) {
+	r, err := eskip.Parse(`old: Path("/old") -> redirect(301, "/<new>") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs := describeRoutes(r, testSpecs)
+
+	var md bytes.Buffer
+	if err := writeMarkdown(&md, docs); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(md.String(), "## old") ||
+		!strings.Contains(md.String(), "1. `redirect(301, \"/<new>\")`: Responds with a redirect to a location.") {
+		t.Error("invalid markdown", md.String())
+	}
+
+	var html bytes.Buffer
+	if err := writeHTML(&html, docs); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(html.String(), "<h2>old</h2>") || !strings.Contains(html.String(), "&lt;new&gt;") {
+		t.Error("invalid html", html.String())
+	}
+}
@@ -15,9 +15,11 @@
 package main
 
 import (
+	"fmt"
 	"github.com/zalando/skipper/eskip"
 	etcdclient "github.com/zalando/skipper/etcd"
 	"github.com/zalando/skipper/filters/flowid"
+	"os"
 	"regexp"
 )
 
@@ -124,6 +126,15 @@ func upsertCmd(in, out *medium) error {
 		return err
 	}
 
+	// only print the changes:
+	if dryRun {
+		for _, r := range routes {
+			ensureId(r)
+		}
+
+		return printDiff(os.Stdout, loadRoutesUnchecked(out), routes, nil)
+	}
+
 	// upsert routes:
 	return upsertAll(routes, out)
 }
@@ -139,6 +150,18 @@ func resetCmd(in, out *medium) error {
 	// take existing routes from output:
 	existing := loadRoutesUnchecked(out)
 
+	// routes from existing that are not in the input:
+	rm := mapRoutes(routes)
+	notSet := func(r *eskip.Route) bool {
+		_, set := rm[r.Id]
+		return !set
+	}
+
+	// only print the changes:
+	if dryRun {
+		return printDiff(os.Stdout, existing, routes, filterRoutes(existing, notSet))
+	}
+
 	// upsert routes that don't exist or are different:
 	err = upsertDifferent(existing, routes, out)
 	if err != nil {
@@ -146,12 +169,6 @@ func resetCmd(in, out *medium) error {
 	}
 
 	// delete routes from existing that were not upserted:
-	rm := mapRoutes(routes)
-	notSet := func(r *eskip.Route) bool {
-		_, set := rm[r.Id]
-		return !set
-	}
-
 	return deleteAllIf(existing, out, notSet)
 }
 
@@ -163,6 +180,46 @@ func deleteCmd(in, out *medium) error {
 		return err
 	}
 
+	// only print the changes:
+	if dryRun {
+		return printDiff(os.Stdout, loadRoutesUnchecked(out), nil, routes)
+	}
+
 	// delete them:
 	return deleteAllIf(routes, out, any)
 }
+
+// command executed for publish.
+func publishCmd(in, out *medium) error {
+	// take input routes:
+	routes, err := loadRoutesChecked(in)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		ensureId(r)
+	}
+
+	// store them as a new generation, and activate it:
+	client := etcdclient.New(urlsToStrings(out.urls), out.path)
+	g, err := client.Publish(routes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(g)
+	return nil
+}
+
+// command executed for rollback.
+func rollbackCmd(_, out *medium) error {
+	client := etcdclient.New(urlsToStrings(out.urls), out.path)
+	g, err := client.Rollback()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(g)
+	return nil
+}
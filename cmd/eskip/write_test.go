@@ -242,3 +242,68 @@ func TestDeleteFromRoutes(t *testing.T) {
 		t.Error("delete failed")
 	}
 }
+
+func TestPublishRollback(t *testing.T) {
+	deleteRoutesFrom(defaultEtcdPrefix)
+
+	out := &medium{typ: etcd, urls: testEtcdUrls, path: defaultEtcdPrefix}
+	for _, doc := range []string{
+		`route1: Method("GET") -> <shunt>; route2: Method("POST") -> <shunt>`,
+		`route2: Method("PUT") -> <shunt>`,
+	} {
+		if err := publishCmd(&medium{typ: inline, eskip: doc}, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routes, err := loadRoutesChecked(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 1 || routes[0].Method != "PUT" {
+		t.Error("failed to publish routes")
+	}
+
+	if err := rollbackCmd(nil, out); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err = loadRoutesChecked(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 2 {
+		t.Error("failed to roll back routes")
+	}
+}
+
+func TestDryRunDoesNotWrite(t *testing.T) {
+	deleteRoutesFrom(defaultEtcdPrefix)
+
+	out := &medium{typ: etcd, urls: testEtcdUrls, path: defaultEtcdPrefix}
+	err := upsertCmd(&medium{typ: inline, eskip: `route1: Method("GET") -> <shunt>`}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun = true
+	defer func() { dryRun = false }()
+
+	for _, cmd := range []commandFunc{upsertCmd, resetCmd, deleteCmd} {
+		err := cmd(&medium{typ: inline, eskip: `route1: Method("PUT") -> <shunt>; route2: Method("POST") -> <shunt>`}, out)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	routes, err := loadRoutesChecked(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 1 || routes[0].Id != "route1" || routes[0].Method != "GET" {
+		t.Error("routes changed in dry run")
+	}
+}
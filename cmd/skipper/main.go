@@ -24,15 +24,26 @@ For details about the usage and extensibility of skipper, please see the
 documentation of the root skipper package.
 
 To see which built-in filters are available, see the skipper/filters
-package documentation.
+package documentation, or run:
+
+    skipper -list-filters
 */
 package main
 
 import (
 	"flag"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/zalando/skipper"
+	"github.com/zalando/skipper/cache"
+	"github.com/zalando/skipper/certs"
+	"github.com/zalando/skipper/cloud"
+	"github.com/zalando/skipper/consul"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/jwt"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/upgrade"
 	"strings"
 	"time"
 )
@@ -49,6 +60,12 @@ const (
 	addressUsage                   = "network address that skipper should listen on"
 	etcdUrlsUsage                  = "urls of nodes in an etcd cluster, storing route definitions"
 	etcdPrefixUsage                = "path prefix for skipper related data in etcd"
+	consulAddressUsage             = "address of the Consul HTTP API, e.g. http://localhost:8500, storing route definitions in its key/value store"
+	consulPrefixUsage              = "key prefix for skipper related data in Consul"
+	consulTokenUsage               = "ACL token for Consul"
+	dynamoDBTableUsage             = "DynamoDB table storing route definitions, using the AWS credentials from the environment"
+	dynamoDBRegionUsage            = "AWS region of the DynamoDB table, defaults to AWS_REGION"
+	dynamoDBEndpointUsage          = "endpoint of the DynamoDB API, defaults to the endpoint of the region"
 	innkeeperUrlUsage              = "API endpoint of the Innkeeper service, storing route definitions"
 	innkeeperAuthTokenUsage        = "fixed token for innkeeper authentication"
 	innkeeperPreRouteFiltersUsage  = "filters to be prepended to each route loaded from Innkeeper"
@@ -56,11 +73,17 @@ const (
 	oauthUrlUsage                  = "OAuth2 URL for Innkeeper authentication"
 	oauthCredentialsDirUsage       = "directory where oauth credentials are stored: client.json and user.json"
 	oauthScopeUsage                = "the whitespace separated list of oauth scopes"
-	routesFileUsage                = "file containing static route definitions"
+	routesFileUsage                = "file containing static route definitions, or a compiled route table"
+	routesDirUsage                 = "directory containing route files, *.eskip or compiled *.eskipc, reloaded when they change"
+	routesURLUsage                 = "HTTP or HTTPS URL of an eskip document, polled for changes with its ETag"
+	routesURLHeaderUsage           = "header sent with the requests for the -routes-url document, in the form of 'Name: value', e.g. Authorization. Can be repeated"
+	shadowRoutesFileUsage          = "file containing candidate route definitions, evaluated for every request only for comparison with the live routes, and the differences reported in the metrics"
 	sourcePollTimeoutUsage         = "polling timeout of the routing data sources, in milliseconds"
 	insecureUsage                  = "flag indicating to ignore the verification of the TLS certificates of the backend services"
 	devModeUsage                   = "enables developer time behavior, like ubuffered routing updates"
 	metricsListenerUsage           = "network address used for exposing the /metrics endpoint. An empty value disables metrics."
+	prometheusListenerUsage        = "network address used for exposing the /metrics endpoint in the Prometheus text exposition format. An empty value disables it."
+	supportListenerUsage           = "network address used for exposing the /about endpoint, describing the version and the capabilities of the instance, the /fingerprint endpoint, identifying the active routes and the options, and the /routes/match endpoint, explaining which route matches a synthetic request. An empty value disables it."
 	metricsPrefixUsage             = "allows setting a custom path prefix for metrics export"
 	debugGcMetricsUsage            = "enables reporting of the Go garbage collector statistics exported in debug.GCStats"
 	runtimeMetricsUsage            = "enables reporting of the Go runtime statistics exported in runtime and specifically runtime.MemStats"
@@ -68,16 +91,102 @@ const (
 	applicationLogPrefixUsage      = "prefix for each log entry"
 	accessLogUsage                 = "output file for the access log, When not set, /dev/stderr is used"
 	accessLogDisabledUsage         = "when this flag is set, no access log is printed"
+	accessLogFormatUsage           = "format of the access log entries: combined, extended, with the route details, or json"
+	accessLogHeadersUsage          = "comma separated list of request headers whose values are included in the access log"
+	accessLogMaxSizeUsage          = "when the access log is written to a file, it is rotated when its size would exceed this many megabytes. Zero disables rotation"
+	accessLogMaxBackupsUsage       = "the number of rotated access log files to keep"
+	responseChecksumUsage          = "enables calculating a CRC-32 checksum of the response bodies, printed in the access log"
+	drainRemovedBackendsUsage      = "when this flag is set, the idle connections are closed when a backend is removed from the routing table"
+	cancelRemovedAfterUsage        = "grace period, in milliseconds, after which the requests in-flight to removed backends are canceled, when draining is enabled. Zero disables canceling"
+	noCanonicalizationUsage        = "when this flag is set, the raw host and path of the requests are used for route matching, without stripping the port, lowercasing the host or cleaning the path"
+	trailingSlashUsage             = "how the requests are treated whose path differs from the route path only in a trailing slash, for the routes not setting it: strict, match or redirect"
+	hostAliasesUsage               = "comma separated list of host aliases replaced with the host they stand for before the route matching, e.g. 'www.example.org=example.org,*.example.net=example.net'"
+	defaultBackendUsage            = "address of a backend, in the form of scheme://host, where the requests are forwarded when they don't match any route"
+	defaultFiltersUsage            = "filters, in eskip format, prepended to the filters of every route, e.g. 'flowId(\"reuse\") -> stripExpect()'"
+	lintRoutesUsage                = "check the loaded routes for likely configuration problems, and log the findings"
+	quotaFileUsage                 = "JSON file containing the route and filter quotas of the tenants, rejecting the routes that violate them"
+	listFiltersUsage               = "print the supported filters with their expected parameters, and exit"
+	cloudBackendsUsage             = "groups of backend instances discovered from AWS or GCP, e.g. 'api=aws:tag.Role=api,port=8080', referenced by the cloudBackend filter"
+	cloudRefreshIntervalUsage      = "interval of refreshing the discovered cloud backends"
+	jwksRefreshIntervalUsage       = "interval of refreshing the JSON web key sets used to validate the tokens by the jwtValidation filter"
+	chaosDisabledUsage             = "disables the chaos experiments of the routes at startup, they can be enabled on the /admin/chaos endpoint of the support listener"
+	dashboardUsage                 = "enables the web UI on the /dashboard/ endpoint of the support listener, listing the routes with their traffic statistics"
+	adminTokenUsage                = "enables the admin API on the /admin/ endpoint of the support listener, accepting the requests with this bearer token"
+	adminMutableRoutesUsage        = "allows temporary route upserts and deletes on the admin API, kept only in memory"
+	gracefulUpgradeUsage           = "enables the in-place upgrades: on SIGUSR2, the listener is passed to a new process started from the same binary path"
+	drainTimeoutUsage              = "time to wait for the open connections when draining on SIGTERM, before closing them"
+	shutdownDelayUsage             = "time to keep accepting new connections after SIGTERM, before draining, while the healthcheck filter responds with 503"
+	reusePortUsage                 = "opens the proxy listener with SO_REUSEPORT, so that a new instance can listen on the same address while the old one is draining"
+	tlsCertUsage                   = "comma separated list of certificate files of the proxy listener, in PEM format. When set, the listener serves TLS, selecting the certificate by the server name of the clients"
+	tlsKeyUsage                    = "comma separated list of key files of the proxy listener, in the order of the certificate files"
+	tlsReloadIntervalUsage         = "interval of checking the certificate and key files for changes and reloading them. Negative values disable the reloading"
+	acmeHostsUsage                 = "comma separated list of hosts whose certificates are obtained automatically with ACME, e.g. from Let's Encrypt"
+	acmeCacheDirUsage              = "directory where the ACME account and certificates are kept across restarts"
+	acmeEmailUsage                 = "contact email address of the ACME account"
+	tlsClientAuthUsage             = "client certificate mode of the TLS listener: none, request, require, verify-if-given or require-and-verify. Only the verified certificates are matched by the ClientCert predicate"
+	tlsClientCAUsage               = "comma separated list of certificate authority files, in PEM format, used to verify the client certificates. When not set, the system roots are used"
+	ratelimitRedisUsage            = "address of a Redis server, host:port, keeping the counters of the rate limit filters shared by the skipper instances. When not set, the counters are kept in memory"
+	cacheSizeUsage                 = "size limit of the responses stored in memory by the cache filter, in bytes"
+	localContinueUsage             = "when this flag is set, the proxy answers the 'Expect: 100-continue' requests itself, and doesn't forward the Expect header to the backends"
+	errorEnvelopeUsage             = "when this flag is set, the errors generated by the proxy are answered with a JSON body containing the status, an error code, the flow id and the route id"
+	autoOptionsUsage               = "when this flag is set, the proxy answers the OPTIONS requests not matching any route, listing the methods of the routes with the same path in the Allow header"
+	slowRequestThresholdUsage      = "latency budget, in milliseconds, after which the requests still in progress are logged with the timings of the route lookup, the filters and the backend. Zero disables the logging"
+	slowRequestProfileUsage        = "when this flag is set, the log entries of the slow requests include the stacks of the goroutines"
+	bodyBufferingThresholdUsage    = "number of bytes of a request or response body that a filter can read before it is reported as buffering the body. Zero disables the reporting"
+	bodyBufferingLimitUsage        = "number of bytes of a request or response body that a filter can read, before the request is aborted with 413, or the response with 502. Zero disables the limit"
+	maxInFlightRequestsUsage       = "maximum number of requests in progress in the proxy, further requests are rejected with 503. Zero disables the limit"
+	maxBackendConnectionsUsage     = "maximum number of open backend connections, including the idle ones, requests needing further connections are rejected with 503. Zero disables the limit"
+	maxResponseBandwidthUsage      = "bandwidth in bytes per second shared by the response bodies sent to the clients, divided fairly between the concurrent streams. Zero disables the limit"
+	upgradeIdleTimeoutUsage        = "the upgraded connections, e.g. websocket connections, are closed, when no data was sent in either direction for this duration. Zero means no timeout"
+	loopbackHeadersUsage           = "comma separated list of the request headers passed to the next hop of the loopback routes. When not set, all headers are passed"
+	loopbackStateBagUsage          = "comma separated list of the state bag entries passed to the next hop of the loopback routes"
+	circuitBreakerFailuresUsage    = "number of consecutive failed requests to a backend host, after which the requests to it are rejected with 503, until the circuit breaker timeout. Zero disables the default circuit breaker"
+	circuitBreakerTimeoutUsage     = "time that the default circuit breaker stays open, before it lets a probe request through"
+	retryAttemptsUsage             = "maximum number of retries of the GET and HEAD requests without a body, when the backend roundtrip fails. Zero disables the default retries"
+	retryStatusesUsage             = "comma separated list of backend response status codes, or classes like 5xx, on which the requests are retried"
+	retryBudgetRatioUsage          = "share of the retries to the retried requests, that the retry budget allows"
+	backendDialTimeoutUsage        = "timeout of establishing the backend connections, unless overridden by the routes. Zero means no timeout"
+	backendHeaderTimeoutUsage      = "timeout of waiting for the backend response headers, unless overridden by the routes. Zero means no timeout"
+	backendTimeoutUsage            = "total timeout of the backend requests, including the response body, unless overridden by the routes. Zero means no timeout"
+	maxIdleConnsPerHostUsage       = "maximum number of the idle backend connections kept per backend host. Zero means the default of the Go HTTP transport, 2"
+	idleConnTimeoutUsage           = "time after which the idle backend connections are closed. Zero means no limit"
+	backendKeepAliveUsage          = "period of the TCP keep-alive probes of the backend connections. Zero means the system default, negative values disable them"
+	disableKeepAlivesUsage         = "when this flag is set, the backend connections are not reused"
+	healthCheckPathUsage           = "path of the active health checks of the backends. The backends of the split routes and the load balancer members marked down are skipped. Empty disables the checks, except for the load balancers with their own path"
+	healthCheckIntervalUsage       = "interval of the active health checks of the backends"
+	healthCheckTimeoutUsage        = "timeout of the active health checks of the backends. Zero means the interval"
+	healthyThresholdUsage          = "number of the consecutive successful health checks, after which a backend marked down is healthy again"
+	unhealthyThresholdUsage        = "number of the consecutive failed health checks, after which a backend is marked down"
+	requestFiltersTimeoutUsage     = "time budget of the request filters of a route, after which the remaining filters are skipped and the request is rejected with 503. Zero means no budget"
+	backendPhaseTimeoutUsage       = "time budget of the backend request of a route, including the retries. Zero means no budget"
+	responseFiltersTimeoutUsage    = "time budget of the response filters of a route, after which the remaining filters are skipped and the request is answered with 503. Zero means no budget"
+	tableRolloutPercentageUsage    = "percentage of the requests, consistent by flow id, routed with a new version of the routing table, before it is activated for all requests. Zero activates the updates immediately"
+	tableRolloutDurationUsage      = "time after which a new version of the routing table, activated for a percentage of the requests, is activated for all requests. Zero means no automatic activation"
+	tablePinningHeaderUsage        = "request header pinning the requests of the trusted clients to a retained version of the routing table, e.g. 42, 'previous' or 'candidate', for debugging. Empty disables the pinning"
+	tablePinningRetainUsage        = "number of the previous routing table versions retained for pinning"
+	tablePinningTrustedUsage       = "comma separated list of IP addresses and CIDR ranges of the clients allowed to pin their requests to a routing table version"
+	trustedProxyHopsUsage          = "number of the proxies, e.g. load balancers, in front of skipper, whose addresses are skipped when taking the client address from the X-Forwarded-For header. Zero means that the client address is the remote address of the connection"
+	trustedProxiesUsage            = "comma separated list of IP addresses and CIDR ranges of the proxies in front of skipper, whose addresses are skipped when taking the client address from the X-Forwarded-For header"
 )
 
 var (
 	address                   string
 	etcdUrls                  string
 	etcdPrefix                string
+	consulAddress             string
+	consulPrefix              string
+	consulToken               string
+	dynamoDBTable             string
+	dynamoDBRegion            string
+	dynamoDBEndpoint          string
 	insecure                  bool
 	innkeeperUrl              string
 	sourcePollTimeout         int64
 	routesFile                string
+	routesDir                 string
+	routesURL                 string
+	routesURLHeaders          = make(headerFlags)
+	shadowRoutesFile          string
 	oauthUrl                  string
 	oauthScope                string
 	oauthCredentialsDir       string
@@ -86,6 +195,8 @@ var (
 	innkeeperPostRouteFilters string
 	devMode                   bool
 	metricsListener           string
+	prometheusListener        string
+	supportListener           string
 	metricsPrefix             string
 	debugGcMetrics            bool
 	runtimeMetrics            bool
@@ -93,16 +204,125 @@ var (
 	applicationLogPrefix      string
 	accessLog                 string
 	accessLogDisabled         bool
+	accessLogFormat           string
+	accessLogHeaders          string
+	accessLogMaxSize          int64
+	accessLogMaxBackups       int
+	responseChecksum          bool
+	drainRemovedBackends      bool
+	cancelRemovedAfter        int64
+	localContinue             bool
+	autoOptions               bool
+	errorEnvelope             bool
+	slowRequestThreshold      int64
+	slowRequestProfile        bool
+	bodyBufferingThreshold    int64
+	bodyBufferingLimit        int64
+	maxInFlightRequests       int
+	maxBackendConnections     int
+	maxResponseBandwidth      int64
+	upgradeIdleTimeout        time.Duration
+	loopbackHeaders           string
+	loopbackStateBag          string
+	circuitBreakerFailures    int
+	circuitBreakerTimeout     time.Duration
+	retryAttempts             int
+	retryStatuses             string
+	retryBudgetRatio          float64
+	backendDialTimeout        time.Duration
+	backendHeaderTimeout      time.Duration
+	backendTimeout            time.Duration
+	maxIdleConnsPerHost       int
+	idleConnTimeout           time.Duration
+	backendKeepAlive          time.Duration
+	disableKeepAlives         bool
+	healthCheckPath           string
+	healthCheckInterval       time.Duration
+	healthCheckTimeout        time.Duration
+	healthyThreshold          int
+	unhealthyThreshold        int
+	requestFiltersTimeout     time.Duration
+	backendPhaseTimeout       time.Duration
+	responseFiltersTimeout    time.Duration
+	noCanonicalization        bool
+	trailingSlash             string
+	hostAliases               string
+	defaultBackend            string
+	defaultFilters            string
+	lintRoutes                bool
+	quotaFile                 string
+	listFilters               bool
+	cloudBackends             string
+	cloudRefreshInterval      time.Duration
+	jwksRefreshInterval       time.Duration
+	chaosDisabled             bool
+	enableDashboard           bool
+	adminToken                string
+	adminMutableRoutes        bool
+	gracefulUpgrade           bool
+	drainTimeout              time.Duration
+	shutdownDelay             time.Duration
+	reusePort                 bool
+	tlsCert                   string
+	tlsKey                    string
+	tlsReloadInterval         time.Duration
+	acmeHosts                 string
+	acmeCacheDir              string
+	acmeEmail                 string
+	tlsClientAuth             string
+	tlsClientCA               string
+	ratelimitRedis            string
+	cacheSize                 int64
+	tableRolloutPercentage    float64
+	tableRolloutDuration      time.Duration
+	tablePinningHeader        string
+	tablePinningRetain        int
+	tablePinningTrusted       string
+	trustedProxyHops          int
+	trustedProxies            string
 )
 
+// collects the repeated header flags, in the form of 'Name: value'
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	var s []string
+	for name := range h {
+		// the values can be secrets
+		s = append(s, name)
+	}
+
+	return strings.Join(s, ",")
+}
+
+func (h headerFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("invalid header: %s", value)
+	}
+
+	h[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
 func init() {
 	flag.StringVar(&address, "address", defaultAddress, addressUsage)
 	flag.StringVar(&etcdUrls, "etcd-urls", "", etcdUrlsUsage)
 	flag.BoolVar(&insecure, "insecure", false, insecureUsage)
 	flag.StringVar(&etcdPrefix, "etcd-prefix", defaultEtcdPrefix, etcdPrefixUsage)
+	flag.StringVar(&consulAddress, "consul-address", "", consulAddressUsage)
+	flag.StringVar(&consulPrefix, "consul-prefix", consul.DefaultPrefix, consulPrefixUsage)
+	flag.StringVar(&consulToken, "consul-token", "", consulTokenUsage)
+	flag.StringVar(&dynamoDBTable, "dynamodb-table", "", dynamoDBTableUsage)
+	flag.StringVar(&dynamoDBRegion, "dynamodb-region", "", dynamoDBRegionUsage)
+	flag.StringVar(&dynamoDBEndpoint, "dynamodb-endpoint", "", dynamoDBEndpointUsage)
 	flag.StringVar(&innkeeperUrl, "innkeeper-url", "", innkeeperUrlUsage)
 	flag.Int64Var(&sourcePollTimeout, "source-poll-timeout", defaultSourcePollTimeout, sourcePollTimeoutUsage)
 	flag.StringVar(&routesFile, "routes-file", "", routesFileUsage)
+	flag.StringVar(&routesDir, "routes-dir", "", routesDirUsage)
+	flag.StringVar(&routesURL, "routes-url", "", routesURLUsage)
+	flag.Var(routesURLHeaders, "routes-url-header", routesURLHeaderUsage)
+	flag.StringVar(&shadowRoutesFile, "shadow-routes-file", "", shadowRoutesFileUsage)
 	flag.StringVar(&oauthUrl, "oauth-url", "", oauthUrlUsage)
 	flag.StringVar(&oauthScope, "oauth-scope", "", oauthScopeUsage)
 	flag.StringVar(&oauthCredentialsDir, "oauth-credentials-dir", "", oauthCredentialsDirUsage)
@@ -111,6 +331,8 @@ func init() {
 	flag.StringVar(&innkeeperPostRouteFilters, "innkeeper-post-route-filters", "", innkeeperPostRouteFiltersUsage)
 	flag.BoolVar(&devMode, "dev-mode", false, devModeUsage)
 	flag.StringVar(&metricsListener, "metrics-listener", defaultMetricsListener, metricsListenerUsage)
+	flag.StringVar(&prometheusListener, "prometheus-listener", "", prometheusListenerUsage)
+	flag.StringVar(&supportListener, "support-listener", "", supportListenerUsage)
 	flag.StringVar(&metricsPrefix, "metrics-prefix", defaultMetricsPrefix, metricsPrefixUsage)
 	flag.BoolVar(&debugGcMetrics, "debug-gc-metrics", false, debugGcMetricsUsage)
 	flag.BoolVar(&runtimeMetrics, "runtime-metrics", defaultRuntimeMetrics, runtimeMetricsUsage)
@@ -118,6 +340,82 @@ func init() {
 	flag.StringVar(&applicationLogPrefix, "application-log-prefix", defaultApplicationLogPrefix, applicationLogPrefixUsage)
 	flag.StringVar(&accessLog, "access-log", "", accessLogUsage)
 	flag.BoolVar(&accessLogDisabled, "access-log-disabled", false, accessLogDisabledUsage)
+	flag.StringVar(&accessLogFormat, "access-log-format", "combined", accessLogFormatUsage)
+	flag.StringVar(&accessLogHeaders, "access-log-headers", "", accessLogHeadersUsage)
+	flag.Int64Var(&accessLogMaxSize, "access-log-max-size", 0, accessLogMaxSizeUsage)
+	flag.IntVar(&accessLogMaxBackups, "access-log-max-backups", 5, accessLogMaxBackupsUsage)
+	flag.BoolVar(&responseChecksum, "response-checksum", false, responseChecksumUsage)
+	flag.BoolVar(&drainRemovedBackends, "drain-removed-backends", false, drainRemovedBackendsUsage)
+	flag.Int64Var(&cancelRemovedAfter, "cancel-removed-after", 0, cancelRemovedAfterUsage)
+	flag.BoolVar(&localContinue, "local-continue", false, localContinueUsage)
+	flag.BoolVar(&autoOptions, "auto-options", false, autoOptionsUsage)
+	flag.BoolVar(&errorEnvelope, "error-envelope", false, errorEnvelopeUsage)
+	flag.Int64Var(&slowRequestThreshold, "slow-request-threshold", 0, slowRequestThresholdUsage)
+	flag.BoolVar(&slowRequestProfile, "slow-request-profile", false, slowRequestProfileUsage)
+	flag.Int64Var(&bodyBufferingThreshold, "body-buffering-threshold", 0, bodyBufferingThresholdUsage)
+	flag.Int64Var(&bodyBufferingLimit, "body-buffering-limit", 0, bodyBufferingLimitUsage)
+	flag.IntVar(&maxInFlightRequests, "max-inflight-requests", 0, maxInFlightRequestsUsage)
+	flag.IntVar(&maxBackendConnections, "max-backend-connections", 0, maxBackendConnectionsUsage)
+	flag.Int64Var(&maxResponseBandwidth, "max-response-bandwidth", 0, maxResponseBandwidthUsage)
+	flag.DurationVar(&upgradeIdleTimeout, "upgrade-idle-timeout", 0, upgradeIdleTimeoutUsage)
+	flag.StringVar(&loopbackHeaders, "loopback-headers", "", loopbackHeadersUsage)
+	flag.StringVar(&loopbackStateBag, "loopback-state-bag", "", loopbackStateBagUsage)
+	flag.IntVar(&circuitBreakerFailures, "circuit-breaker-failures", 0, circuitBreakerFailuresUsage)
+	flag.DurationVar(&circuitBreakerTimeout, "circuit-breaker-timeout", 30*time.Second, circuitBreakerTimeoutUsage)
+	flag.IntVar(&retryAttempts, "retry-attempts", 0, retryAttemptsUsage)
+	flag.StringVar(&retryStatuses, "retry-statuses", "", retryStatusesUsage)
+	flag.Float64Var(&retryBudgetRatio, "retry-budget-ratio", 0.2, retryBudgetRatioUsage)
+	flag.DurationVar(&backendDialTimeout, "backend-dial-timeout", 0, backendDialTimeoutUsage)
+	flag.DurationVar(&backendHeaderTimeout, "backend-response-header-timeout", 0, backendHeaderTimeoutUsage)
+	flag.DurationVar(&backendTimeout, "backend-timeout", 0, backendTimeoutUsage)
+	flag.IntVar(&maxIdleConnsPerHost, "backend-max-idle-conns-per-host", 0, maxIdleConnsPerHostUsage)
+	flag.DurationVar(&idleConnTimeout, "backend-idle-conn-timeout", 0, idleConnTimeoutUsage)
+	flag.DurationVar(&backendKeepAlive, "backend-keep-alive", 0, backendKeepAliveUsage)
+	flag.BoolVar(&disableKeepAlives, "backend-disable-keep-alives", false, disableKeepAlivesUsage)
+	flag.StringVar(&healthCheckPath, "health-check-path", "", healthCheckPathUsage)
+	flag.DurationVar(&healthCheckInterval, "health-check-interval", healthcheck.DefaultInterval, healthCheckIntervalUsage)
+	flag.DurationVar(&healthCheckTimeout, "health-check-timeout", 0, healthCheckTimeoutUsage)
+	flag.IntVar(&healthyThreshold, "health-check-healthy-threshold", healthcheck.DefaultHealthyThreshold, healthyThresholdUsage)
+	flag.IntVar(&unhealthyThreshold, "health-check-unhealthy-threshold", healthcheck.DefaultUnhealthyThreshold, unhealthyThresholdUsage)
+	flag.DurationVar(&requestFiltersTimeout, "request-filters-timeout", 0, requestFiltersTimeoutUsage)
+	flag.DurationVar(&backendPhaseTimeout, "backend-phase-timeout", 0, backendPhaseTimeoutUsage)
+	flag.DurationVar(&responseFiltersTimeout, "response-filters-timeout", 0, responseFiltersTimeoutUsage)
+	flag.BoolVar(&noCanonicalization, "no-canonicalization", false, noCanonicalizationUsage)
+	flag.StringVar(&trailingSlash, "trailing-slash", "strict", trailingSlashUsage)
+	flag.StringVar(&hostAliases, "host-aliases", "", hostAliasesUsage)
+	flag.StringVar(&defaultBackend, "default-backend", "", defaultBackendUsage)
+	flag.StringVar(&defaultFilters, "default-filters", "", defaultFiltersUsage)
+	flag.BoolVar(&lintRoutes, "lint-routes", false, lintRoutesUsage)
+	flag.StringVar(&quotaFile, "quota-file", "", quotaFileUsage)
+	flag.BoolVar(&listFilters, "list-filters", false, listFiltersUsage)
+	flag.StringVar(&cloudBackends, "cloud-backends", "", cloudBackendsUsage)
+	flag.DurationVar(&cloudRefreshInterval, "cloud-refresh-interval", cloud.DefaultRefreshInterval, cloudRefreshIntervalUsage)
+	flag.DurationVar(&jwksRefreshInterval, "jwks-refresh-interval", jwt.DefaultRefreshInterval, jwksRefreshIntervalUsage)
+	flag.BoolVar(&chaosDisabled, "chaos-disabled", false, chaosDisabledUsage)
+	flag.BoolVar(&enableDashboard, "dashboard", false, dashboardUsage)
+	flag.StringVar(&adminToken, "admin-token", "", adminTokenUsage)
+	flag.BoolVar(&adminMutableRoutes, "admin-mutable-routes", false, adminMutableRoutesUsage)
+	flag.BoolVar(&gracefulUpgrade, "graceful-upgrade", false, gracefulUpgradeUsage)
+	flag.DurationVar(&drainTimeout, "drain-timeout", upgrade.DefaultDrainTimeout, drainTimeoutUsage)
+	flag.DurationVar(&shutdownDelay, "shutdown-delay", 0, shutdownDelayUsage)
+	flag.BoolVar(&reusePort, "reuse-port", false, reusePortUsage)
+	flag.StringVar(&tlsCert, "tls-cert", "", tlsCertUsage)
+	flag.StringVar(&tlsKey, "tls-key", "", tlsKeyUsage)
+	flag.DurationVar(&tlsReloadInterval, "tls-reload-interval", certs.DefaultReloadInterval, tlsReloadIntervalUsage)
+	flag.StringVar(&acmeHosts, "acme-hosts", "", acmeHostsUsage)
+	flag.StringVar(&acmeCacheDir, "acme-cache-dir", "", acmeCacheDirUsage)
+	flag.StringVar(&acmeEmail, "acme-email", "", acmeEmailUsage)
+	flag.StringVar(&tlsClientAuth, "tls-client-auth", "none", tlsClientAuthUsage)
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", tlsClientCAUsage)
+	flag.StringVar(&ratelimitRedis, "ratelimit-redis", "", ratelimitRedisUsage)
+	flag.Int64Var(&cacheSize, "cache-size", cache.DefaultLocalStoreSize, cacheSizeUsage)
+	flag.Float64Var(&tableRolloutPercentage, "table-rollout-percentage", 0, tableRolloutPercentageUsage)
+	flag.DurationVar(&tableRolloutDuration, "table-rollout-duration", 0, tableRolloutDurationUsage)
+	flag.StringVar(&tablePinningHeader, "table-pinning-header", "", tablePinningHeaderUsage)
+	flag.IntVar(&tablePinningRetain, "table-pinning-retain", 3, tablePinningRetainUsage)
+	flag.StringVar(&tablePinningTrusted, "table-pinning-trusted-clients", "127.0.0.1,::1", tablePinningTrustedUsage)
+	flag.IntVar(&trustedProxyHops, "trusted-proxy-hops", 0, trustedProxyHopsUsage)
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", trustedProxiesUsage)
 	flag.Parse()
 }
 
@@ -127,32 +425,218 @@ func main() {
 		eus = strings.Split(etcdUrls, ",")
 	}
 
+	var alh []string
+	if len(accessLogHeaders) > 0 {
+		alh = strings.Split(accessLogHeaders, ",")
+	}
+
 	options := skipper.Options{
-		Address:                   address,
-		EtcdUrls:                  eus,
-		EtcdPrefix:                etcdPrefix,
-		InnkeeperUrl:              innkeeperUrl,
-		SourcePollTimeout:         time.Duration(sourcePollTimeout) * time.Millisecond,
-		RoutesFile:                routesFile,
-		IgnoreTrailingSlash:       false,
-		OAuthUrl:                  oauthUrl,
-		OAuthScope:                oauthScope,
-		OAuthCredentialsDir:       oauthCredentialsDir,
-		InnkeeperAuthToken:        innkeeperAuthToken,
-		InnkeeperPreRouteFilters:  innkeeperPreRouteFilters,
-		InnkeeperPostRouteFilters: innkeeperPostRouteFilters,
-		DevMode:                   devMode,
-		MetricsListener:           metricsListener,
-		MetricsPrefix:             metricsPrefix,
-		EnableDebugGcMetrics:      debugGcMetrics,
-		EnableRuntimeMetrics:      runtimeMetrics,
-		ApplicationLogOutput:      applicationLog,
-		ApplicationLogPrefix:      applicationLogPrefix,
-		AccessLogOutput:           accessLog,
-		AccessLogDisabled:         accessLogDisabled}
+		Address:                    address,
+		EtcdUrls:                   eus,
+		EtcdPrefix:                 etcdPrefix,
+		ConsulAddress:              consulAddress,
+		ConsulPrefix:               consulPrefix,
+		ConsulToken:                consulToken,
+		DynamoDBTable:              dynamoDBTable,
+		DynamoDBRegion:             dynamoDBRegion,
+		DynamoDBEndpoint:           dynamoDBEndpoint,
+		InnkeeperUrl:               innkeeperUrl,
+		SourcePollTimeout:          time.Duration(sourcePollTimeout) * time.Millisecond,
+		RoutesFile:                 routesFile,
+		RoutesDirectory:            routesDir,
+		RoutesURL:                  routesURL,
+		RoutesURLHeaders:           routesURLHeaders,
+		ShadowRoutesFile:           shadowRoutesFile,
+		IgnoreTrailingSlash:        false,
+		OAuthUrl:                   oauthUrl,
+		OAuthScope:                 oauthScope,
+		OAuthCredentialsDir:        oauthCredentialsDir,
+		InnkeeperAuthToken:         innkeeperAuthToken,
+		InnkeeperPreRouteFilters:   innkeeperPreRouteFilters,
+		InnkeeperPostRouteFilters:  innkeeperPostRouteFilters,
+		DevMode:                    devMode,
+		MetricsListener:            metricsListener,
+		PrometheusListener:         prometheusListener,
+		SupportListener:            supportListener,
+		MetricsPrefix:              metricsPrefix,
+		EnableDebugGcMetrics:       debugGcMetrics,
+		EnableRuntimeMetrics:       runtimeMetrics,
+		ApplicationLogOutput:       applicationLog,
+		ApplicationLogPrefix:       applicationLogPrefix,
+		AccessLogOutput:            accessLog,
+		AccessLogDisabled:          accessLogDisabled,
+		AccessLogFormat:            accessLogFormat,
+		AccessLogHeaders:           alh,
+		AccessLogMaxSize:           accessLogMaxSize << 20,
+		AccessLogMaxBackups:        accessLogMaxBackups,
+		NoCanonicalization:         noCanonicalization,
+		TrailingSlash:              trailingSlash,
+		HostAliases:                hostAliases,
+		DefaultBackend:             defaultBackend,
+		DefaultFilters:             defaultFilters,
+		LintRoutes:                 lintRoutes,
+		QuotaFile:                  quotaFile,
+		CloudBackends:              cloudBackends,
+		CloudRefreshInterval:       cloudRefreshInterval,
+		JwksRefreshInterval:        jwksRefreshInterval,
+		ChaosDisabled:              chaosDisabled,
+		Dashboard:                  enableDashboard,
+		AdminToken:                 adminToken,
+		AdminMutableRoutes:         adminMutableRoutes,
+		GracefulUpgrade:            gracefulUpgrade,
+		DrainTimeout:               drainTimeout,
+		ShutdownDelay:              shutdownDelay,
+		ReusePort:                  reusePort,
+		TLSReloadInterval:          tlsReloadInterval,
+		ACMECacheDir:               acmeCacheDir,
+		ACMEEmail:                  acmeEmail,
+		RatelimitRedisAddress:      ratelimitRedis,
+		CacheSize:                  cacheSize,
+		TableRolloutPercentage:     tableRolloutPercentage,
+		TableRolloutDuration:       tableRolloutDuration,
+		TablePinningHeader:         tablePinningHeader,
+		TablePinningRetain:         tablePinningRetain,
+		TablePinningTrustedClients: tablePinningTrusted,
+		TrustedProxyHops:           trustedProxyHops,
+		TrustedProxies:             trustedProxies,
+		CancelRemovedBackendsAfter: time.Duration(cancelRemovedAfter) * time.Millisecond,
+		SlowRequestThreshold:       time.Duration(slowRequestThreshold) * time.Millisecond,
+		BodyBufferingThreshold:     bodyBufferingThreshold,
+		BodyBufferingLimit:         bodyBufferingLimit,
+		MaxInFlightRequests:        maxInFlightRequests,
+		MaxBackendConnections:      maxBackendConnections,
+		MaxResponseBandwidth:       maxResponseBandwidth,
+		UpgradeIdleTimeout:         upgradeIdleTimeout,
+		RetryBudgetRatio:           retryBudgetRatio,
+		BackendTimeouts: filters.BackendTimeouts{
+			Dial:           backendDialTimeout,
+			ResponseHeader: backendHeaderTimeout,
+			Total:          backendTimeout},
+		BackendConnectionPool: proxy.ConnectionPool{
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			IdleConnTimeout:     idleConnTimeout,
+			KeepAlive:           backendKeepAlive,
+			DisableKeepAlives:   disableKeepAlives},
+		BackendHealthCheck: healthcheck.Options{
+			Path:               healthCheckPath,
+			Interval:           healthCheckInterval,
+			Timeout:            healthCheckTimeout,
+			HealthyThreshold:   healthyThreshold,
+			UnhealthyThreshold: unhealthyThreshold},
+		PhaseTimeouts: filters.PhaseTimeouts{
+			RequestFilters:  requestFiltersTimeout,
+			Backend:         backendPhaseTimeout,
+			ResponseFilters: responseFiltersTimeout}}
 	if insecure {
 		options.ProxyOptions |= proxy.OptionsInsecure
 	}
 
-	log.Fatal(skipper.Run(options))
+	if responseChecksum {
+		options.ProxyOptions |= proxy.OptionsResponseChecksum
+	}
+
+	if drainRemovedBackends {
+		options.ProxyOptions |= proxy.OptionsDrainRemovedBackends
+	}
+
+	if localContinue {
+		options.ProxyOptions |= proxy.OptionsLocalContinue
+	}
+
+	if autoOptions {
+		options.ProxyOptions |= proxy.OptionsAutoOptions
+	}
+
+	if errorEnvelope {
+		options.ProxyOptions |= proxy.OptionsErrorEnvelope
+	}
+
+	if slowRequestProfile {
+		options.ProxyOptions |= proxy.OptionsSlowRequestProfile
+	}
+
+	if circuitBreakerFailures > 0 {
+		options.CircuitBreaker = filters.CircuitBreakerSettings{
+			Type:     filters.ConsecutiveBreaker,
+			Failures: circuitBreakerFailures,
+			Timeout:  circuitBreakerTimeout}
+	}
+
+	if retryAttempts > 0 {
+		statuses, err := filters.ParseStatusCodes(retryStatuses)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		options.Retry = filters.RetrySettings{Attempts: retryAttempts, Statuses: statuses}
+	}
+
+	if tlsCert != "" || tlsKey != "" {
+		certFiles, keyFiles := strings.Split(tlsCert, ","), strings.Split(tlsKey, ",")
+		if len(certFiles) != len(keyFiles) {
+			log.Fatal("the number of the TLS certificate and key files doesn't match")
+		}
+
+		for i := range certFiles {
+			options.TLSCertificates = append(options.TLSCertificates, certs.Pair{
+				CertFile: certFiles[i],
+				KeyFile:  keyFiles[i]})
+		}
+	}
+
+	if acmeHosts != "" {
+		options.ACMEHosts = strings.Split(acmeHosts, ",")
+	}
+
+	clientAuth, err := certs.ParseClientAuth(tlsClientAuth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options.TLSClientAuth = clientAuth
+
+	if tlsClientCA != "" {
+		options.TLSClientCAFiles = strings.Split(tlsClientCA, ",")
+	}
+
+	if loopbackHeaders != "" {
+		options.LoopbackHeaders = strings.Split(loopbackHeaders, ",")
+	}
+
+	if loopbackStateBag != "" {
+		options.LoopbackStateBag = strings.Split(loopbackStateBag, ",")
+	}
+
+	if listFilters {
+		if err := printFilters(options); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if err := skipper.Run(options); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// prints the supported filters, one per line, e.g.:
+//
+//	redirect(code number, location string)
+func printFilters(o skipper.Options) error {
+	specs, err := skipper.Filters(o)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range specs {
+		line := fmt.Sprintf("%s(%s)", s.Name, s.Signature)
+		if len(s.Aliases) > 0 {
+			line += fmt.Sprintf(" aliases: %s", strings.Join(s.Aliases, ", "))
+		}
+
+		fmt.Println(line)
+	}
+
+	return nil
 }
@@ -0,0 +1,268 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package consul implements a DataClient for reading the skipper route
+definitions from the key/value store of Consul.
+
+(See the DataClient interface in the skipper/routing package.)
+
+Consul is a service discovery and configuration service:
+https://www.consul.io. The route definitions are stored under individual
+keys, below the routes key of the configured prefix, as eskip route
+expressions, e.g. skipper/routes/pdp. When loaded from Consul, the
+routes get the last segment of the key as id.
+
+The updates are received with the blocking queries of Consul, and only
+the added, changed and deleted routes are passed to the routing.
+
+In addition to the DataClient implementation, type Client provides
+methods to Upsert and Delete routes, implementing the RouteStore
+interface of the routestore package.
+*/
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routestore"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The default key prefix.
+	DefaultPrefix = "skipper"
+
+	// The default maximum time of waiting for a change in Consul.
+	DefaultWaitTime = time.Minute
+
+	routesKey   = "routes"
+	tokenHeader = "X-Consul-Token"
+	indexHeader = "X-Consul-Index"
+)
+
+// Initialization options for the Consul client.
+type Options struct {
+
+	// The address of the Consul HTTP API, e.g. http://localhost:8500.
+	Address string
+
+	// The key prefix, under which the routes are stored. Defaults to
+	// DefaultPrefix.
+	Prefix string
+
+	// ACL token, sent with every request.
+	Token string
+
+	// The maximum time of a blocking query waiting for a change.
+	// Defaults to DefaultWaitTime.
+	WaitTime time.Duration
+}
+
+// A Client is used to load the whole set of routes and the updates
+// from Consul.
+type Client struct {
+	opts       Options
+	routesRoot string
+	httpClient *http.Client
+	index      uint64
+	data       map[string]string
+}
+
+// a key/value entry returned by Consul
+type kvPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// Creates a new Client, connecting to the Consul agent reachable at
+// the configured address.
+func New(o Options) *Client {
+	if o.Prefix == "" {
+		o.Prefix = DefaultPrefix
+	}
+
+	if o.WaitTime <= 0 {
+		o.WaitTime = DefaultWaitTime
+	}
+
+	return &Client{
+		opts:       o,
+		routesRoot: strings.Trim(o.Prefix, "/") + "/" + routesKey + "/",
+		// Consul adds a random jitter of up to WaitTime/16 to the
+		// blocking queries
+		httpClient: &http.Client{Timeout: o.WaitTime + o.WaitTime/16 + 15*time.Second}}
+}
+
+func (c *Client) url(key string, query string) string {
+	u := strings.TrimRight(c.opts.Address, "/") + "/v1/kv/" + key
+	if query != "" {
+		u += "?" + query
+	}
+
+	return u
+}
+
+func (c *Client) do(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.opts.Token != "" {
+		req.Header.Set(tokenHeader, c.opts.Token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// Loads all the route expressions, when the index is not zero, waiting
+// for a change after it. Returns the route expressions by the route ids
+// and the new index.
+func (c *Client) load(index uint64) (map[string]string, uint64, error) {
+	query := "recurse=true"
+	if index > 0 {
+		query += fmt.Sprintf("&index=%d&wait=%dms", index, c.opts.WaitTime/time.Millisecond)
+	}
+
+	rsp, err := c.do("GET", c.url(c.routesRoot, query), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rsp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(rsp.Header.Get(indexHeader), 10, 64)
+
+	// the routes key doesn't exist, yet
+	if rsp.StatusCode == http.StatusNotFound {
+		return map[string]string{}, newIndex, nil
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul request failed: %s", rsp.Status)
+	}
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pairs []*kvPair
+	if err := json.Unmarshal(b, &pairs); err != nil {
+		return nil, 0, err
+	}
+
+	data := make(map[string]string)
+	for _, p := range pairs {
+		// only the direct children are routes, and the routes key
+		// itself can exist as an empty folder
+		id := strings.TrimPrefix(p.Key, c.routesRoot)
+		if id == "" || strings.Contains(id, "/") {
+			continue
+		}
+
+		data[id] = string(p.Value)
+	}
+
+	return data, newIndex, nil
+}
+
+// Returns all the route definitions currently stored in Consul, or the
+// parsing error in case of failure.
+func (c *Client) GetInitial() ([]*routestore.RouteInfo, error) {
+	data, index, err := c.load(0)
+	if err != nil {
+		return nil, err
+	}
+
+	c.data, c.index = data, index
+	return routestore.ParseRoutes(data), nil
+}
+
+// Returns the updates (upserts and deletes) since the last initial
+// request or update, including the parsing errors.
+//
+// It uses the blocking queries of Consul, that results in blocking
+// this call until the next change is detected, or the configured wait
+// time passes.
+func (c *Client) GetUpdates() ([]*routestore.RouteInfo, []string, error) {
+	if c.data == nil {
+		c.data = make(map[string]string)
+	}
+
+	data, index, err := c.load(c.index)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// when the index goes backwards, e.g. after restoring a snapshot,
+	// the next query needs to start from the current state
+	if index < c.index {
+		index = 0
+	}
+
+	c.index = index
+	changed, deleted := routestore.Diff(c.data, data)
+	c.data = data
+	return routestore.ParseRoutes(changed), deleted, nil
+}
+
+// Returns all the route definitions currently stored in Consul.
+func (c *Client) LoadAll() ([]*eskip.Route, error) {
+	return routestore.LoadAll(c)
+}
+
+// Returns the updates (upserts and deletes) since the last initial request
+// or update.
+func (c *Client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return routestore.LoadUpdate(c)
+}
+
+func (c *Client) write(method, id string, body []byte) error {
+	if id == "" {
+		return routestore.ErrMissingRouteId
+	}
+
+	rsp, err := c.do(method, c.url(c.routesRoot+id, ""), body)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul request failed: %s", rsp.Status)
+	}
+
+	return nil
+}
+
+// Inserts or updates a route in Consul. The route expression is stored
+// with a document header containing the format version and the checksum
+// of the expression.
+func (c *Client) Upsert(r *eskip.Route) error {
+	return c.write("PUT", r.Id, []byte(eskip.WithHeader(r.String())))
+}
+
+// Deletes a route from Consul.
+func (c *Client) Delete(id string) error {
+	return c.write("DELETE", id, nil)
+}
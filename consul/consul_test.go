@@ -0,0 +1,173 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routestore"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a minimal in-memory implementation of the Consul KV API
+type kvStore struct {
+	mx       sync.Mutex
+	index    uint64
+	data     map[string]*kvPair
+	token    string
+	lastWait string
+}
+
+func newKVStore() *kvStore {
+	return &kvStore{index: 1, data: make(map[string]*kvPair)}
+}
+
+func (s *kvStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.token = r.Header.Get(tokenHeader)
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case "GET":
+		s.lastWait = r.URL.Query().Get("wait")
+		var pairs []*kvPair
+		for k, p := range s.data {
+			if strings.HasPrefix(k, key) {
+				pairs = append(pairs, p)
+			}
+		}
+
+		w.Header().Set(indexHeader, strconv.FormatUint(s.index, 10))
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		b, _ := json.Marshal(pairs)
+		w.Write(b)
+	case "PUT":
+		b, _ := ioutil.ReadAll(r.Body)
+		s.index++
+		s.data[key] = &kvPair{Key: key, Value: b, ModifyIndex: s.index}
+		w.Write([]byte("true"))
+	case "DELETE":
+		s.index++
+		delete(s.data, key)
+		w.Write([]byte("true"))
+	}
+}
+
+func routeIds(routes []*eskip.Route) []string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func TestConsul(t *testing.T) {
+	kv := newKVStore()
+	s := httptest.NewServer(kv)
+	defer s.Close()
+
+	c := New(Options{Address: s.URL, Token: "secret"})
+
+	routes, err := c.LoadAll()
+	if err != nil || len(routes) != 0 {
+		t.Fatal("failed to load the empty routes", routes, err)
+	}
+
+	if kv.token != "secret" {
+		t.Error("failed to send the token")
+	}
+
+	foo := &eskip.Route{Id: "foo", Path: "/foo", Backend: "https://foo.example.org"}
+	bar := &eskip.Route{Id: "bar", Path: "/bar", Shunt: true}
+	for _, r := range []*eskip.Route{foo, bar} {
+		if err := c.Upsert(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// invalid entries are skipped
+	kv.data["skipper/routes/baz"] = &kvPair{Key: "skipper/routes/baz", Value: []byte(`Path("/baz") ->`)}
+	kv.data["skipper/routes/nested/qux"] = &kvPair{Key: "skipper/routes/nested/qux", Value: []byte(eskip.WithHeader(`* -> <shunt>`))}
+
+	routes, deleted, err := c.LoadUpdate()
+	if err != nil || len(deleted) != 0 || !reflect.DeepEqual(routeIds(routes), []string{"bar", "foo"}) {
+		t.Fatal("failed to load the update", routeIds(routes), deleted, err)
+	}
+
+	if kv.lastWait != "60000ms" {
+		t.Error("failed to send a blocking query", kv.lastWait)
+	}
+
+	foo.Backend = "https://foo2.example.org"
+	if err := c.Upsert(foo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete("bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, deleted, err = c.LoadUpdate()
+	if err != nil || !reflect.DeepEqual(routeIds(routes), []string{"foo"}) || !reflect.DeepEqual(deleted, []string{"bar"}) {
+		t.Fatal("failed to load the update", routeIds(routes), deleted, err)
+	}
+
+	if routes[0].Backend != "https://foo2.example.org" {
+		t.Error("failed to update the route", routes[0].Backend)
+	}
+
+	routes, deleted, err = c.LoadUpdate()
+	if err != nil || len(routes) != 0 || len(deleted) != 0 {
+		t.Error("unexpected update", routes, deleted, err)
+	}
+}
+
+func TestMissingRouteId(t *testing.T) {
+	c := New(Options{Address: "http://localhost:8500"})
+	if err := c.Upsert(&eskip.Route{}); err != routestore.ErrMissingRouteId {
+		t.Error("failed to fail", err)
+	}
+
+	if err := c.Delete(""); err != routestore.ErrMissingRouteId {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer s.Close()
+
+	c := New(Options{Address: s.URL})
+	if _, err := c.LoadAll(); err == nil {
+		t.Error("failed to fail")
+	}
+}
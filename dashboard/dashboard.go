@@ -0,0 +1,283 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package dashboard implements a web UI for browsing the active routes of
+a skipper instance, together with their live traffic statistics.
+
+Skipper serves the dashboard on the /dashboard/ endpoint of the support
+listener, when started with the -dashboard flag:
+
+	skipper -support-listener :9911 -dashboard -routes-file routes.eskip
+
+The page lists the routes of the active routing table, and it can be
+filtered by a search term matching the id, the host, the path, the
+filters or the backend of the routes, e.g.:
+
+	http://localhost:9911/dashboard/?q=checkout
+
+For every route, it shows the number of the responses, the current rate
+and the mean response time, and sparklines of the responses and the mean
+response time over the recent samples. The statistics are collected from
+the built-in metrics, so they are available only when the metrics
+listener is set, and not with a custom metrics implementation.
+
+Every route links to the explain endpoint, with a sample request derived
+from the route, showing which route matches the request, and why the
+routes evaluated before it didn't. The sample request can be changed in
+the query, e.g.:
+
+	http://localhost:9911/dashboard/explain?method=POST&url=https://www.example.org/api&header=X-Tenant:foo
+
+The same data is available in JSON format from
+/dashboard/routes.json. The dashboard doesn't authenticate the clients,
+so the support listener should be exposed only internally.
+*/
+package dashboard
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The default interval of sampling the traffic statistics.
+	DefaultInterval = 10 * time.Second
+
+	// The default number of the samples shown in the sparklines.
+	DefaultSamples = 60
+)
+
+// Options of the dashboard.
+type Options struct {
+
+	// The routing whose active routes are shown. Required.
+	Routing *routing.Routing
+
+	// The interval of sampling the traffic statistics. Default:
+	// DefaultInterval.
+	Interval time.Duration
+
+	// The number of the samples kept for the sparklines. Default:
+	// DefaultSamples.
+	Samples int
+
+	// Returns the response statistics of the routes. Default:
+	// metrics.ResponseStats.
+	Stats func() map[string]metrics.RouteStats
+}
+
+// a traffic sample of a route
+type sample struct {
+	hits int64
+	mean time.Duration
+}
+
+// the samples of a route, and the last statistics
+type history struct {
+	last    metrics.RouteStats
+	samples []sample
+}
+
+// Dashboard is an http.Handler serving the web UI, the routes in JSON
+// format, and the explain endpoint.
+type Dashboard struct {
+	options   Options
+	mx        sync.Mutex
+	histories map[string]*history
+	quit      chan struct{}
+	closeOnce sync.Once
+}
+
+// JSON representation of a route and its statistics.
+type routeInfo struct {
+	Id               string    `json:"id"`
+	Route            string    `json:"route"`
+	Responses        int64     `json:"responses"`
+	Rate             float64   `json:"rate"`
+	MeanMs           float64   `json:"meanMs"`
+	ResponsesHistory []int64   `json:"responsesHistory"`
+	MeanMsHistory    []float64 `json:"meanMsHistory"`
+	Explain          string    `json:"explain"`
+}
+
+// Creates a dashboard, and starts sampling the traffic statistics. The
+// sampling is stopped by calling Close.
+func New(o Options) *Dashboard {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+
+	if o.Samples <= 0 {
+		o.Samples = DefaultSamples
+	}
+
+	if o.Stats == nil {
+		o.Stats = metrics.ResponseStats
+	}
+
+	d := &Dashboard{
+		options:   o,
+		histories: make(map[string]*history),
+		quit:      make(chan struct{})}
+	go d.run()
+	return d
+}
+
+func (d *Dashboard) run() {
+	for {
+		select {
+		case <-time.After(d.options.Interval):
+			d.sample()
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// records a sample for each active route, and drops the samples of the
+// removed routes
+func (d *Dashboard) sample() {
+	stats := d.options.Stats()
+	routes := d.options.Routing.Routes()
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	active := make(map[string]*history)
+	for _, r := range routes {
+		h := d.histories[r.Id]
+		if h == nil {
+			h = &history{}
+		}
+
+		s, ok := stats[r.Id]
+		if ok {
+			hits := s.Count - h.last.Count
+			if hits < 0 {
+				hits = 0
+			}
+
+			h.samples = append(h.samples, sample{hits: hits, mean: s.Mean})
+			h.last = s
+		} else {
+			h.samples = append(h.samples, sample{})
+		}
+
+		if len(h.samples) > d.options.Samples {
+			h.samples = h.samples[len(h.samples)-d.options.Samples:]
+		}
+
+		active[r.Id] = h
+	}
+
+	d.histories = active
+}
+
+// returns the routes matching the search term, with their statistics
+func (d *Dashboard) routes(q string) []*routeInfo {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	var infos []*routeInfo
+	for _, r := range d.options.Routing.Routes() {
+		if !matches(r, q) {
+			continue
+		}
+
+		info := &routeInfo{
+			Id:               r.Id,
+			Route:            r.String(),
+			ResponsesHistory: []int64{},
+			MeanMsHistory:    []float64{},
+			Explain:          explainLink(r)}
+		if h := d.histories[r.Id]; h != nil {
+			info.Responses = h.last.Count
+			info.Rate = h.last.Rate
+			info.MeanMs = milliseconds(h.last.Mean)
+			for _, s := range h.samples {
+				info.ResponsesHistory = append(info.ResponsesHistory, s.hits)
+				info.MeanMsHistory = append(info.MeanMsHistory, milliseconds(s.mean))
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// tells whether the id, the host, the path, the filters or the backend
+// of a route contain the search term, ignoring the case
+func matches(r *eskip.Route, q string) bool {
+	if q == "" {
+		return true
+	}
+
+	fields := []string{r.Id, r.Path, r.Backend}
+	fields = append(fields, r.HostRegexps...)
+	fields = append(fields, r.PathRegexps...)
+	for _, f := range r.Filters {
+		fields = append(fields, f.Name)
+	}
+
+	q = strings.ToLower(q)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Serves the web UI on the mount path, the routes in JSON format on
+// routes.json, and the explain endpoint on explain, relative to the
+// mount path. Only GET and HEAD requests are accepted.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/routes.json"):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.routes(r.URL.Query().Get("q")))
+	case strings.HasSuffix(r.URL.Path, "/explain"):
+		d.explain(w, r)
+	case strings.HasSuffix(r.URL.Path, "/"):
+		d.page(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Stops sampling the traffic statistics.
+func (d *Dashboard) Close() {
+	d.closeOnce.Do(func() {
+		close(d.quit)
+	})
+}
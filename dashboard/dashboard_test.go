@@ -0,0 +1,248 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRoutes = `
+	api: Host("^api[.]example[.]org$") && Path("/users/:id") -> modPath("^/users", "/") -> "https://api.example.org";
+	static: Path("/static/*file") -> static("/", "/var/www") -> <shunt>;
+	catchAll: Any() -> "https://www.example.org";
+`
+
+type testStats struct {
+	stats map[string]metrics.RouteStats
+}
+
+func (s *testStats) get() map[string]metrics.RouteStats { return s.stats }
+
+func testDashboard(t *testing.T, stats *testStats) (*Dashboard, func()) {
+	dc, err := testdataclient.NewDoc(testRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{dc},
+		PollTimeout:    6 * time.Millisecond})
+	for i := 0; i < 30 && rt.TableFingerprint().Version == 0; i++ {
+		time.Sleep(6 * time.Millisecond)
+	}
+
+	d := New(Options{Routing: rt, Interval: time.Hour, Samples: 3, Stats: stats.get})
+	return d, func() {
+		d.Close()
+		rt.Close()
+	}
+}
+
+func get(t *testing.T, h http.Handler, u string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutesJSON(t *testing.T) {
+	stats := &testStats{}
+	d, done := testDashboard(t, stats)
+	defer done()
+
+	for i := int64(1); i <= 4; i++ {
+		stats.stats = map[string]metrics.RouteStats{
+			"api": {Count: i * i, Rate: 1.5, Mean: time.Duration(i) * time.Millisecond}}
+		d.sample()
+	}
+
+	w := get(t, d, "http://localhost/dashboard/routes.json?q=API")
+	if w.Code != http.StatusOK {
+		t.Fatal("invalid status", w.Code)
+	}
+
+	var routes []*routeInfo
+	if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 1 || routes[0].Id != "api" {
+		t.Fatal("invalid routes", routes)
+	}
+
+	r := routes[0]
+	if r.Responses != 16 || r.Rate != 1.5 || r.MeanMs != 4 {
+		t.Error("invalid stats", r.Responses, r.Rate, r.MeanMs)
+	}
+
+	if len(r.ResponsesHistory) != 3 || r.ResponsesHistory[0] != 3 || r.ResponsesHistory[2] != 7 {
+		t.Error("invalid responses history", r.ResponsesHistory)
+	}
+
+	if len(r.MeanMsHistory) != 3 || r.MeanMsHistory[2] != 4 {
+		t.Error("invalid latency history", r.MeanMsHistory)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	d, done := testDashboard(t, &testStats{})
+	defer done()
+
+	for _, ti := range []struct {
+		q   string
+		ids []string
+	}{
+		{"", []string{"api", "catchAll", "static"}},
+		{"static", []string{"static"}},
+		{"modpath", []string{"api"}},
+		{"www.example", []string{"catchAll"}},
+		{"/users", []string{"api"}},
+		{"missing", nil},
+	} {
+		var ids []string
+		for _, r := range d.routes(ti.q) {
+			ids = append(ids, r.Id)
+		}
+
+		if strings.Join(ids, ",") != strings.Join(ti.ids, ",") {
+			t.Error("invalid search result", ti.q, ids)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	d, done := testDashboard(t, &testStats{})
+	defer done()
+
+	d.sample()
+	d.sample()
+	w := get(t, d, "http://localhost/dashboard/?q=%3Cscript%3E")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "&lt;script&gt;") {
+		t.Error("failed to escape the query", w.Code)
+	}
+
+	w = get(t, d, "http://localhost/dashboard/")
+	body := w.Body.String()
+	if !strings.Contains(body, "3 routes") || strings.Count(body, "<svg") != 6 {
+		t.Error("invalid page", body)
+	}
+
+	if w := get(t, d, "http://localhost/dashboard/foo"); w.Code != http.StatusNotFound {
+		t.Error("invalid status", w.Code)
+	}
+
+	r, _ := http.NewRequest("POST", "http://localhost/dashboard/", nil)
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("invalid status", w.Code)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	d, done := testDashboard(t, &testStats{})
+	defer done()
+
+	var links []string
+	for _, r := range d.routes("") {
+		links = append(links, r.Explain)
+	}
+
+	for i, expected := range []string{
+		"explain?method=GET&url=" + url.QueryEscape("http://api.example.org/users/id"),
+		"explain?method=GET&url=" + url.QueryEscape("http://www.example.org/"),
+		"explain?method=GET&url=" + url.QueryEscape("http://www.example.org/static/file"),
+	} {
+		if links[i] != expected {
+			t.Error("invalid explain link", links[i])
+		}
+	}
+
+	for i, link := range links {
+		w := get(t, d, "http://localhost/dashboard/"+link)
+		var e explanation
+		if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Match != []string{"api", "catchAll", "static"}[i] {
+			t.Error("invalid match", link, e.Match)
+		}
+	}
+
+	w := get(t, d, "http://localhost/dashboard/explain?url="+url.QueryEscape("http://www.example.org/users/42"))
+	var e explanation
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match != "catchAll" || len(e.Candidates) != 2 || e.Candidates[0].Mismatch == "" {
+		t.Error("invalid explanation", e)
+	}
+
+	for _, q := range []string{"", "url=/foo", "url=http://www.example.org&header=foo"} {
+		if w := get(t, d, "http://localhost/dashboard/explain?"+q); w.Code != http.StatusBadRequest {
+			t.Error("invalid status", q, w.Code)
+		}
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	d, done := testDashboard(t, &testStats{})
+	defer done()
+
+	h := ExplainHandler(d.options.Routing)
+	w := get(t, h, "http://localhost/routes/match?method=GET&path=/users/42&header=Host:api.example.org")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("failed to explain", w.Code)
+	}
+
+	var e explanation
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match != "api" || e.Params["id"] != "42" || e.Request != "GET api.example.org/users/42" ||
+		len(e.Filters) != 1 || !strings.HasPrefix(e.Filters[0], "modPath(") {
+		t.Error("invalid explanation", e)
+	}
+
+	if len(e.Candidates) != 1 || len(e.Candidates[0].Conditions) != 2 ||
+		e.Candidates[0].Conditions[1].Name != "Host" || !e.Candidates[0].Conditions[1].Passed {
+		t.Error("invalid conditions", e.Candidates)
+	}
+
+	r, _ := http.NewRequest("POST", "http://localhost/routes/match?path=/", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("invalid status", w.Code)
+	}
+}
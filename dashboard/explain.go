@@ -0,0 +1,242 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// the host of the sample requests, when it cannot be derived from the
+// route
+const defaultSampleHost = "www.example.org"
+
+var (
+	plainHost      = regexp.MustCompile("^[a-zA-Z0-9.-]+$")
+	errRelativeURL = errors.New("absolute url expected")
+	errNoRequest   = errors.New("url or path expected")
+)
+
+type condition struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+}
+
+type candidate struct {
+	Id         string      `json:"id"`
+	Route      string      `json:"route"`
+	Mismatch   string      `json:"mismatch,omitempty"`
+	Conditions []condition `json:"conditions"`
+}
+
+// JSON representation of routing.Explanation
+type explanation struct {
+	Request    string            `json:"request"`
+	Match      string            `json:"match,omitempty"`
+	Route      string            `json:"route,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+	Filters    []string          `json:"filters,omitempty"`
+	Candidates []candidate       `json:"candidates"`
+}
+
+// returns the host of the first host condition, that is a plain host
+// name, apart from the anchors and the escaped dots
+func sampleHost(r *eskip.Route) string {
+	for _, h := range r.HostRegexps {
+		h = strings.TrimSuffix(strings.TrimPrefix(h, "^"), "$")
+		h = strings.Replace(h, "[.]", ".", -1)
+		h = strings.Replace(h, `\.`, ".", -1)
+		if plainHost.MatchString(h) {
+			return h
+		}
+	}
+
+	return defaultSampleHost
+}
+
+// returns the path of the route, with the wildcards replaced by their
+// names
+func samplePath(r *eskip.Route) string {
+	if r.Path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(r.Path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = s[1:]
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// returns the relative link to the explain endpoint, with a sample
+// request derived from the method, the host, the path and the exact
+// header conditions of the route
+func explainLink(r *eskip.Route) string {
+	method := r.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	q := url.Values{
+		"method": {method},
+		"url":    {"http://" + sampleHost(r) + samplePath(r)}}
+
+	var names []string
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		q.Add("header", name+":"+r.Headers[name])
+	}
+
+	return "explain?" + q.Encode()
+}
+
+// creates the sample request from the method and the header query
+// parameters, and either from the url, or from the path parameter. When
+// only the path is set, the host is taken from the Host header
+// parameter, if any.
+func explainRequest(r *http.Request) (*http.Request, error) {
+	q := r.URL.Query()
+	rawurl := q.Get("url")
+	switch {
+	case rawurl == "" && q.Get("path") == "":
+		return nil, errNoRequest
+	case rawurl == "":
+		rawurl = "http://" + defaultSampleHost + q.Get("path")
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, errRelativeURL
+	}
+
+	method := q.Get("method")
+	if method == "" {
+		method = "GET"
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range q["header"] {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header: %s", h)
+		}
+
+		name, value := strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:])
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+
+		req.Header.Add(name, value)
+	}
+
+	return req, nil
+}
+
+// responds with the explanation of which route matches the sample
+// request, in JSON format
+func explain(rt *routing.Routing, w http.ResponseWriter, r *http.Request) {
+	req, err := explainRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e, err := rt.Explain(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ex := &explanation{
+		Request:    req.Method + " " + req.Host + req.URL.RequestURI(),
+		Params:     e.Params,
+		Candidates: []candidate{}}
+	if e.Match != nil {
+		ex.Match = e.Match.Id
+		ex.Route = e.Match.String()
+	}
+
+	for _, f := range e.Filters {
+		ex.Filters = append(ex.Filters, f.String())
+	}
+
+	for _, c := range e.Candidates {
+		cj := candidate{
+			Id:         c.Route.Id,
+			Route:      c.Route.String(),
+			Mismatch:   c.Mismatch,
+			Conditions: []condition{}}
+		for _, ci := range c.Conditions {
+			cj.Conditions = append(cj.Conditions, condition{ci.Name, ci.Passed})
+		}
+
+		ex.Candidates = append(ex.Candidates, cj)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ex)
+}
+
+func (d *Dashboard) explain(w http.ResponseWriter, r *http.Request) {
+	explain(d.options.Routing, w, r)
+}
+
+// Returns a handler responding to GET requests with the explanation of
+// which route of the active routing table matches a sample request, in
+// JSON format. The sample request is set by the query parameters: the
+// method, the url or the path, and the repeatable header parameter in
+// the Name:value format, e.g.:
+//
+// 	/routes/match?method=GET&path=/foo&header=Host:www.example.org
+//
+// The response lists the evaluated routes with the result of each of
+// their conditions, and the filters of the matching route in the order
+// of their execution. The filters are not executed, and the request is
+// not forwarded.
+func ExplainHandler(rt *routing.Routing) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		explain(rt, w, r)
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"html/template"
+	"net/http"
+)
+
+const (
+	sparklineWidth  = 120
+	sparklineHeight = 24
+)
+
+var pageTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"sparkline": sparkline,
+	"responses": responsesValues,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>skipper routes</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 24px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.route { font-family: monospace; white-space: pre-wrap; word-break: break-all; }
+td.number { text-align: right; }
+</style>
+</head>
+<body>
+<form method="GET" action="">
+<input type="text" name="q" value="{{.Query}}" placeholder="host, path, filter or id" size="40">
+<input type="submit" value="Search">
+<a href="routes.json?q={{.Query}}">json</a>
+</form>
+<p>{{len .Routes}} routes</p>
+<table>
+<tr><th>id</th><th>route</th><th>responses</th><th>rate/s</th><th>mean ms</th><th>responses</th><th>mean ms</th><th></th></tr>
+{{range .Routes}}<tr>
+<td>{{.Id}}</td>
+<td class="route">{{.Route}}</td>
+<td class="number">{{.Responses}}</td>
+<td class="number">{{printf "%.2f" .Rate}}</td>
+<td class="number">{{printf "%.1f" .MeanMs}}</td>
+<td>{{sparkline (responses .ResponsesHistory)}}</td>
+<td>{{sparkline .MeanMsHistory}}</td>
+<td><a href="{{.Explain}}">explain</a></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type pageData struct {
+	Query   string
+	Refresh int
+	Routes  []*routeInfo
+}
+
+func responsesValues(h []int64) []float64 {
+	v := make([]float64, len(h))
+	for i, hi := range h {
+		v[i] = float64(hi)
+	}
+
+	return v
+}
+
+// renders the values as an inline SVG polyline, scaled to the maximum
+// value
+func sparkline(values []float64) template.HTML {
+	if len(values) < 2 {
+		return ""
+	}
+
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	var points bytes.Buffer
+	for i, v := range values {
+		y := float64(sparklineHeight)
+		if max > 0 {
+			y -= v / max * sparklineHeight
+		}
+
+		fmt.Fprintf(&points, "%.1f,%.1f ", float64(i)*sparklineWidth/float64(len(values)-1), y)
+	}
+
+	// only numbers are rendered, it is safe to skip the escaping
+	return template.HTML(fmt.Sprintf(
+		`<svg width="%d" height="%d"><polyline fill="none" stroke="#36c" points="%s"/></svg>`,
+		sparklineWidth, sparklineHeight, points.String()))
+}
+
+// renders the routes matching the search term, refreshing the page with
+// the sampling interval
+func (d *Dashboard) page(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	data := &pageData{
+		Query:   q,
+		Refresh: int(d.options.Interval.Seconds()),
+		Routes:  d.routes(q)}
+	if data.Refresh < 1 {
+		data.Refresh = 1
+	}
+
+	var b bytes.Buffer
+	if err := pageTemplate.Execute(&b, data); err != nil {
+		log.Error("dashboard: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+)
+
+// data client prepending the default filters to the routes of the
+// wrapped client
+type defaultFiltersClient struct {
+	routing.DataClient
+	filters []*eskip.Filter
+}
+
+func (c *defaultFiltersClient) LoadAll() ([]*eskip.Route, error) {
+	routes, err := c.DataClient.LoadAll()
+	return eskip.PrependFilters(routes, c.filters), err
+}
+
+func (c *defaultFiltersClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	routes, deletedIds, err := c.DataClient.LoadUpdate()
+	return eskip.PrependFilters(routes, c.filters), deletedIds, err
+}
@@ -148,9 +148,20 @@ https://github.com/zalando/innkeeper.
 - etcd: skipper can load routes and receive updates from etcd clusters
 (https://github.com/coreos/etcd). See the etcd subdirectory.
 
+- Consul and DynamoDB: skipper can load routes and receive updates from
+the Consul key/value store or from a DynamoDB table. See the consul and
+the dynamodb subdirectories. The storage clients implement the common
+RouteStore interface of the routestore package, together with etcd.
+
 - static file: package eskipfile implements a simple data client, which
 can load route definitions from a static file in eskip format.
-Currently, it supports only loading on startup and no updates.
+The static file is loaded only on startup. The same package provides a
+client for a directory of eskip files, which applies the changes of the
+files as incremental updates (-routes-dir).
+
+- remote file: package eskipurl implements a data client, which polls an
+eskip document served over HTTP or HTTPS, using its ETag, and applies the
+changes as incremental updates (-routes-url).
 
 Skipper accepts additional data sources, when extended. Sources must
 implement the DataClient interface in the routing package.
@@ -177,7 +188,8 @@ cmd/eskip command package, and/or enter in the command line:
 Extending Skipper
 
 Skipper doesn't use dynamically loaded plugins, but it can be used as a
-library and extended with custom filters and/or custom data sources.
+library and extended with custom filters, custom predicates and/or
+custom data sources.
 
 
 Custom Filters
@@ -229,6 +241,27 @@ a route definition as:
 
     Any() -> hello("world") -> "https://www.example.org"
 
+The name of a custom filter cannot be the same as the name of a built-in
+filter, otherwise skipper fails to start. Optionally, the specification
+can describe the expected parameters by implementing the
+filters.SignatureSpec interface, and these are printed, together with
+the built-in filters, by the -list-filters flag of the skipper command,
+or by the skipper.Filters function.
+
+
+Custom Predicates
+
+Custom matching conditions, e.g. based on the claims of a token, or on
+the country of the client, can be implemented with the PredicateSpec
+interface of the routing package, and passed to skipper in the
+CustomPredicates option. The specification creates the predicate
+instances for each route that references it by its name, e.g.:
+
+    Path("/shop") && Country("DE", "AT") -> "https://shop.example.de"
+
+The name of a custom predicate cannot be the same as the name of a
+built-in predicate.
+
 
 Custom Build
 
@@ -262,22 +295,148 @@ Start the custom router:
     go run hello.go
 
 
-Proxy Package Used Individually
+Embedding Skipper
 
 The Run function in the root skipper package starts its own listener and
-doesn't provide the best composability. The proxy package, however,
-provides a standard http.Handler, so it is possible to use it in a more
-complex solution as a building block for routing.
+doesn't provide the best composability. To embed skipper's routing in
+another server or in a test harness, the NewHandler function can be
+used. It accepts the same options as Run, and returns a standard
+http.Handler, with an explicit lifecycle: it starts polling the data
+clients when Start is called, and stops when Close is called. Additional
+data sources can be passed in with the CustomDataClients option:
+
+    h, err := skipper.NewHandler(skipper.Options{
+        RoutesFile: "routes.eskip",
+        CustomFilters: []filters.Spec{&helloSpec{}}})
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    h.Start()
+    defer h.Close()
+
+    http.Handle("/", h)
+
+The logging and the metrics are not initialized by the handler, these
+are left to the embedding application.
+
+The filters available to the routes can be replaced with a custom
+registry, set in the FilterRegistry option, e.g. one containing only a
+subset of the built-in filters and the proprietary filters of the
+application. When the embedding application creates the listener
+itself, e.g. to share it, or to listen on a unix socket, it can pass it
+to Run in the Listener option:
+
+    l, err := net.Listen("unix", "/run/skipper.sock")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    registry := make(filters.Registry)
+    registry.Register(builtin.NewModPath())
+    registry.Register(&helloSpec{})
+
+    log.Fatal(skipper.Run(skipper.Options{
+        Listener: l,
+        RoutesFile: "routes.eskip",
+        FilterRegistry: registry}))
+
+
+Proxy Package Used Individually
+
+The proxy package, too, provides a standard http.Handler, so it is
+possible to use it in a more complex solution as a building block for
+routing.
 
 
 Logging and Metrics
 
 Skipper provides detailed logging about unexpected failures, access logs
-in the Apache combined log format. If set up so, Skipper also collects
+in the Apache combined log format or in JSON format, optionally
+containing the backend, the upstream latency and selected request
+headers, written to stderr, stdout, a size-rotated file, or a custom
+io.Writer. If set up so, Skipper also collects
 detailed performance metrics, and exposes them on a separate listener
 endpoint for pulling snapshots. For more details, see the documentation
 of the logging and metrics subdirectories.
 
+With the SupportListener option, Skipper exposes the /about endpoint,
+returning its version, the enabled features, the supported filters and
+route conditions, and the types of the route sources, in JSON format,
+so that the differences between the instances of a fleet can be
+detected. The embedding applications can serve the same document with
+the AboutHandler of the Handler.
+
+The /fingerprint endpoint of the same listener returns the hash of the
+active routes and the hash of the startup options, which are equal on
+the instances with the same configuration, independent of the order in
+which they received the routes. The eskip fleet-check command compares
+them across a list of instances, and reports the divergence, e.g.:
+
+    eskip fleet-check -instances http://10.0.0.1:9911,http://10.0.0.2:9911
+
+The /routes/match endpoint reports which route of the active routing
+table would match a synthetic request, the result of each condition of
+the routes evaluated before, and the filters that would be executed,
+without executing them or forwarding the request. The request is set in
+the query, e.g.:
+
+    curl 'http://localhost:9911/routes/match?method=GET&path=/foo&header=Host:www.example.org'
+
+The same explanation is available to the embedding applications from
+the Explain method of the routing.
+
+With the Dashboard option, the support listener serves a web UI on
+/dashboard/, listing the active routes with their response counts and
+latencies, and linking to the explanation of how a sample request is
+matched. For details, see the dashboard package.
+
+With the AdminToken option, the support listener serves an authenticated
+API on /admin/, listing the active routes in eskip or JSON format, with
+their response counts. With the AdminMutableRoutes option, the API also
+accepts temporary route upserts and deletes, kept only in memory, that
+take precedence over all the route sources. For details, see the admin
+package.
+
+
+In-place Upgrades
+
+With the GracefulUpgrade option, a single instance of Skipper can be
+upgraded without dropping the connections of the clients. After
+replacing the binary, sending SIGUSR2 to the running process starts a
+new process from the same path, which takes over the listener socket.
+The old process then stops accepting connections, and exits after it
+has drained the open ones, or when the DrainTimeout has passed. For
+more details, see the documentation of the upgrade subdirectory.
+
+Independent of the in-place upgrades, Skipper drains the connections
+when it receives SIGTERM, e.g. during a rolling deployment, finishing
+the requests in flight before exiting. With the ShutdownDelay option, it
+keeps accepting new connections for a while after SIGTERM, while the
+healthcheck filter responds with 503 Service Unavailable, so that the
+load balancers can take the instance out of rotation before it stops
+listening. With the ReusePort option, a new instance can listen on the
+same address, while the old one is still draining.
+
+
+TLS Termination
+
+With the TLSCertificates option, the proxy listener serves TLS, with
+multiple certificate and key pairs, selected by the server name sent by
+the clients (SNI). The certificate files are checked for changes
+periodically, and reloaded without dropping the open connections. With
+the ACMEHosts option, the certificates of the listed hosts are obtained
+and renewed automatically with ACME, e.g. from Let's Encrypt. For more
+details, see the documentation of the certs subdirectory.
+
+With the TLSClientAuth option, the listener requests or requires client
+certificates (mutual TLS), verified against the TLSClientCAFiles. The
+routes can match the verified certificates with the ClientCert
+predicate, and forward their details to the backends with the
+clientCertHeaders filter:
+
+    partners: ClientCert("cn", /^partner-/) -> clientCertHeaders() -> "https://partners.internal";
+
 
 Performance Considerations
 
@@ -0,0 +1,323 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package dynamodb implements a DataClient for reading the skipper route
+definitions from an Amazon DynamoDB table.
+
+(See the DataClient interface in the skipper/routing package.)
+
+The routes are stored as items of the table, with the route id in the
+string partition key 'id', and the eskip route expression in the string
+attribute 'route'. E.g. the table can be created with:
+
+	aws dynamodb create-table --table-name skipper-routes \
+		--attribute-definitions AttributeName=id,AttributeType=S \
+		--key-schema AttributeName=id,KeyType=HASH \
+		--billing-mode PAY_PER_REQUEST
+
+DynamoDB doesn't provide a way to wait for changes without consuming
+its streams, so the updates are detected by scanning the table on every
+poll of the routing, and only the added, changed and deleted routes are
+passed to the routing. The scans use strongly consistent reads, and the
+size of the table determines their cost, so the poll timeout of the
+routing should be chosen accordingly.
+
+The requests are signed with the AWS Signature Version 4, using the
+credentials from the options or from the standard AWS environment
+variables.
+
+In addition to the DataClient implementation, type Client provides
+methods to Upsert and Delete routes, implementing the RouteStore
+interface of the routestore package.
+*/
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routestore"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// The default timeout of the requests to DynamoDB.
+	DefaultTimeout = 30 * time.Second
+
+	idAttribute    = "id"
+	routeAttribute = "route"
+
+	targetPrefix = "DynamoDB_20120810."
+	contentType  = "application/x-amz-json-1.0"
+)
+
+// Initialization options for the DynamoDB client.
+type Options struct {
+
+	// The name of the table containing the routes.
+	Table string
+
+	// The AWS region of the table. Defaults to the AWS_REGION or the
+	// AWS_DEFAULT_REGION environment variable.
+	Region string
+
+	// The endpoint of the DynamoDB API, e.g. http://localhost:8000 for
+	// DynamoDB local. Defaults to the endpoint of the region.
+	Endpoint string
+
+	// The credentials used to sign the requests. Defaults to the
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	// environment variables.
+	Credentials Credentials
+
+	// The timeout of the requests. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// A Client is used to load the whole set of routes and the updates
+// from a DynamoDB table.
+type Client struct {
+	opts       Options
+	endpoint   string
+	httpClient *http.Client
+	data       map[string]string
+	now        func() time.Time
+}
+
+// attribute value in the DynamoDB JSON format, only strings are used
+type attributeValue struct {
+	S string `json:"S"`
+}
+
+type item map[string]attributeValue
+
+type scanRequest struct {
+	TableName         string `json:"TableName"`
+	ConsistentRead    bool   `json:"ConsistentRead"`
+	ExclusiveStartKey item   `json:"ExclusiveStartKey,omitempty"`
+}
+
+type scanResponse struct {
+	Items            []item `json:"Items"`
+	LastEvaluatedKey item   `json:"LastEvaluatedKey"`
+}
+
+type putItemRequest struct {
+	TableName string `json:"TableName"`
+	Item      item   `json:"Item"`
+}
+
+type deleteItemRequest struct {
+	TableName string `json:"TableName"`
+	Key       item   `json:"Key"`
+}
+
+type errorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+var (
+	errMissingTable  = errors.New("missing dynamodb table")
+	errMissingRegion = errors.New("missing dynamodb region")
+)
+
+// Creates a new Client. It fails when the table or the region is not
+// specified.
+func New(o Options) (*Client, error) {
+	if o.Table == "" {
+		return nil, errMissingTable
+	}
+
+	if o.Region == "" {
+		o.Region = os.Getenv("AWS_REGION")
+	}
+
+	if o.Region == "" {
+		o.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if o.Region == "" {
+		return nil, errMissingRegion
+	}
+
+	if o.Credentials.AccessKeyId == "" {
+		o.Credentials = Credentials{
+			AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN")}
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+
+	endpoint := o.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://dynamodb.%s.amazonaws.com", o.Region)
+	}
+
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		opts:       o,
+		endpoint:   strings.TrimRight(endpoint, "/") + "/",
+		httpClient: &http.Client{Timeout: o.Timeout},
+		now:        time.Now}, nil
+}
+
+// calls an operation of the DynamoDB API
+func (c *Client) call(operation string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Target", targetPrefix+operation)
+	sign(req, body, c.opts.Credentials, c.opts.Region, "dynamodb", c.now())
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if json.Unmarshal(b, &e) == nil && e.Type != "" {
+			t := e.Type
+			if i := strings.LastIndex(t, "#"); i >= 0 {
+				t = t[i+1:]
+			}
+
+			return fmt.Errorf("dynamodb %s failed: %s: %s", operation, t, e.Message)
+		}
+
+		return fmt.Errorf("dynamodb %s failed: %s", operation, rsp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// scans the whole table, and returns the route expressions by the ids
+func (c *Client) scan() (map[string]string, error) {
+	data := make(map[string]string)
+	req := &scanRequest{TableName: c.opts.Table, ConsistentRead: true}
+	for {
+		var rsp scanResponse
+		if err := c.call("Scan", req, &rsp); err != nil {
+			return nil, err
+		}
+
+		for _, i := range rsp.Items {
+			if id := i[idAttribute].S; id != "" {
+				data[id] = i[routeAttribute].S
+			}
+		}
+
+		if len(rsp.LastEvaluatedKey) == 0 {
+			return data, nil
+		}
+
+		req.ExclusiveStartKey = rsp.LastEvaluatedKey
+	}
+}
+
+// Returns all the route definitions currently stored in the table, or
+// the parsing error in case of failure.
+func (c *Client) GetInitial() ([]*routestore.RouteInfo, error) {
+	data, err := c.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	c.data = data
+	return routestore.ParseRoutes(data), nil
+}
+
+// Returns the updates (upserts and deletes) since the last initial
+// request or update, including the parsing errors, by scanning the
+// table.
+func (c *Client) GetUpdates() ([]*routestore.RouteInfo, []string, error) {
+	data, err := c.scan()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changed, deleted := routestore.Diff(c.data, data)
+	c.data = data
+	return routestore.ParseRoutes(changed), deleted, nil
+}
+
+// Returns all the route definitions currently stored in the table.
+func (c *Client) LoadAll() ([]*eskip.Route, error) {
+	return routestore.LoadAll(c)
+}
+
+// Returns the updates (upserts and deletes) since the last initial request
+// or update.
+func (c *Client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return routestore.LoadUpdate(c)
+}
+
+// Inserts or updates a route in the table. The route expression is
+// stored with a document header containing the format version and the
+// checksum of the expression.
+func (c *Client) Upsert(r *eskip.Route) error {
+	if r.Id == "" {
+		return routestore.ErrMissingRouteId
+	}
+
+	return c.call("PutItem", &putItemRequest{
+		TableName: c.opts.Table,
+		Item: item{
+			idAttribute:    {r.Id},
+			routeAttribute: {eskip.WithHeader(r.String())}}}, nil)
+}
+
+// Deletes a route from the table.
+func (c *Client) Delete(id string) error {
+	if id == "" {
+		return routestore.ErrMissingRouteId
+	}
+
+	return c.call("DeleteItem", &deleteItemRequest{
+		TableName: c.opts.Table,
+		Key:       item{idAttribute: {id}}}, nil)
+}
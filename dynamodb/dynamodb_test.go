@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routestore"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a minimal in-memory implementation of the used DynamoDB operations,
+// returning the scan results in pages of two items
+type table struct {
+	mx    sync.Mutex
+	name  string
+	items map[string]string
+}
+
+func (tb *table) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type": "com.amazon.coral.service#MissingAuthenticationTokenException", "message": "missing"}`))
+		return
+	}
+
+	b, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		TableName         string
+		ExclusiveStartKey item
+		Item              item
+		Key               item
+	}
+
+	json.Unmarshal(b, &req)
+	if req.TableName != tb.name {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type": "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException", "message": "not found"}`))
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "DynamoDB_20120810.Scan":
+		var ids []string
+		for id := range tb.items {
+			if id > req.ExclusiveStartKey[idAttribute].S {
+				ids = append(ids, id)
+			}
+		}
+
+		sort.Strings(ids)
+		var rsp scanResponse
+		for i, id := range ids {
+			if i == 2 {
+				rsp.LastEvaluatedKey = item{idAttribute: {ids[1]}}
+				break
+			}
+
+			rsp.Items = append(rsp.Items, item{idAttribute: {id}, routeAttribute: {tb.items[id]}})
+		}
+
+		b, _ := json.Marshal(rsp)
+		w.Write(b)
+	case "DynamoDB_20120810.PutItem":
+		tb.items[req.Item[idAttribute].S] = req.Item[routeAttribute].S
+		w.Write([]byte("{}"))
+	case "DynamoDB_20120810.DeleteItem":
+		delete(tb.items, req.Key[idAttribute].S)
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func routeIds(routes []*eskip.Route) []string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func testClient(t *testing.T, tb *table) (*Client, func()) {
+	s := httptest.NewServer(tb)
+	c, err := New(Options{
+		Table:       "routes",
+		Region:      "eu-central-1",
+		Endpoint:    s.URL,
+		Credentials: Credentials{AccessKeyId: "key", SecretAccessKey: "secret"}})
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+
+	return c, s.Close
+}
+
+func TestInvalidOptions(t *testing.T) {
+	if _, err := New(Options{Region: "eu-central-1"}); err != errMissingTable {
+		t.Error("failed to fail on missing table", err)
+	}
+
+	if os.Getenv("AWS_REGION") != "" || os.Getenv("AWS_DEFAULT_REGION") != "" {
+		return
+	}
+
+	if _, err := New(Options{Table: "routes", Endpoint: "http://localhost:8000"}); err != errMissingRegion {
+		t.Error("failed to fail on missing region", err)
+	}
+}
+
+func TestDynamoDB(t *testing.T) {
+	tb := &table{name: "routes", items: make(map[string]string)}
+	c, done := testClient(t, tb)
+	defer done()
+
+	for _, r := range []*eskip.Route{
+		{Id: "r1", Path: "/r1", Shunt: true},
+		{Id: "r2", Path: "/r2", Shunt: true},
+		{Id: "r3", Path: "/r3", Shunt: true},
+		{Id: "r4", Path: "/r4", Shunt: true},
+		{Id: "r5", Path: "/r5", Shunt: true},
+	} {
+		if err := c.Upsert(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tb.items["invalid"] = `Path("/invalid") ->`
+
+	routes, err := c.LoadAll()
+	if err != nil || !reflect.DeepEqual(routeIds(routes), []string{"r1", "r2", "r3", "r4", "r5"}) {
+		t.Fatal("failed to load all pages", routeIds(routes), err)
+	}
+
+	routes, deleted, err := c.LoadUpdate()
+	if err != nil || len(routes) != 0 || len(deleted) != 0 {
+		t.Error("unexpected update", routes, deleted, err)
+	}
+
+	if err := c.Upsert(&eskip.Route{Id: "r2", Path: "/r2", Backend: "https://www.example.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete("r4"); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, deleted, err = c.LoadUpdate()
+	if err != nil || !reflect.DeepEqual(routeIds(routes), []string{"r2"}) || !reflect.DeepEqual(deleted, []string{"r4"}) {
+		t.Fatal("failed to load the update", routeIds(routes), deleted, err)
+	}
+
+	if routes[0].Backend != "https://www.example.org" {
+		t.Error("failed to update the route", routes[0].Backend)
+	}
+}
+
+func TestDynamoDBError(t *testing.T) {
+	tb := &table{name: "other", items: make(map[string]string)}
+	c, done := testClient(t, tb)
+	defer done()
+
+	_, err := c.LoadAll()
+	if err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException: not found") {
+		t.Error("failed to report the error", err)
+	}
+}
+
+func TestMissingRouteId(t *testing.T) {
+	tb := &table{name: "routes", items: make(map[string]string)}
+	c, done := testClient(t, tb)
+	defer done()
+
+	if err := c.Upsert(&eskip.Route{}); err != routestore.ErrMissingRouteId {
+		t.Error("failed to fail", err)
+	}
+
+	if err := c.Delete(""); err != routestore.ErrMissingRouteId {
+		t.Error("failed to fail", err)
+	}
+}
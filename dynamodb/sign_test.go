@@ -0,0 +1,56 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the example request of the AWS Signature Version 4 documentation
+func TestSignExample(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sign(req, nil, Credentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if a := req.Header.Get("Authorization"); a != expected {
+		t.Error("invalid signature", a)
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, err := http.NewRequest("POST", "https://dynamodb.eu-central-1.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign(req, nil, Credentials{"key", "secret", "token"}, "eu-central-1", "dynamodb", time.Now())
+	if req.Header.Get("X-Amz-Security-Token") != "token" ||
+		!strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Error("failed to sign the session token", req.Header)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	r, err := Parse(`
+		@owner("team-checkout") @description("legacy redirect")
+		legacy: Path("/x") -> <shunt>;
+		plain: Any() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 2 || r[0].Id != "legacy" || len(r[0].Metadata) != 2 ||
+		r[0].Metadata["owner"] != "team-checkout" ||
+		r[0].Metadata["description"] != "legacy redirect" {
+		t.Error("failed to parse the annotations", r[0].Metadata)
+	}
+
+	if r[1].Metadata != nil {
+		t.Error("unexpected metadata", r[1].Metadata)
+	}
+}
+
+func TestParseAnnotationsWithTemplatesVariablesAndMacros(t *testing.T) {
+	r, err := Parse(`
+		let team = "team-checkout";
+		@t: Method("GET");
+		def service(backend) = Path("/service") -> $backend;
+		@owner($team) route1: @t && Path("/foo") -> <shunt>;
+		@owner("team-service") route2: service("https://service.example.org")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 2 {
+		t.Fatal("invalid number of routes", len(r))
+	}
+
+	if r[0].Metadata["owner"] != "team-checkout" || r[0].Method != "GET" {
+		t.Error("failed to parse annotations with variables and templates", r[0].Metadata)
+	}
+
+	if r[1].Metadata["owner"] != "team-service" || r[1].Path != "/service" {
+		t.Error("failed to parse annotations of a macro invocation", r[1].Metadata)
+	}
+}
+
+func TestParseAnnotationErrors(t *testing.T) {
+	for _, code := range []string{
+		`@owner("a") @owner("b") route1: Any() -> <shunt>`,
+		`@owner() route1: Any() -> <shunt>`,
+		`@owner("a", "b") route1: Any() -> <shunt>`,
+		`@owner(42) route1: Any() -> <shunt>`,
+		`@owner("a") Any() -> <shunt>`,
+		`@owner($undefined) route1: Any() -> <shunt>`,
+	} {
+		if _, err := Parse(code); err == nil {
+			t.Error("failed to fail", code)
+		}
+	}
+}
+
+func TestSerializeAnnotations(t *testing.T) {
+	r, err := Parse(`@owner("team \"checkout\"") @description("legacy redirect") legacy: Path("/x") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := String(r...)
+	expected := `@description("legacy redirect") @owner("team \"checkout\"") legacy: Path("/x") -> <shunt>`
+	if s != expected {
+		t.Errorf("failed to serialize the annotations: %s", s)
+	}
+
+	rr, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Eq(r[0], rr[0]) {
+		t.Error("failed to round trip the annotations")
+	}
+}
+
+func TestAnnotationsEqAndCopy(t *testing.T) {
+	r, err := Parse(`@owner("a") route1: Any() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := r[0].Copy()
+	c.Metadata["owner"] = "b"
+	if r[0].Metadata["owner"] != "a" {
+		t.Error("failed to copy the metadata")
+	}
+
+	if Eq(r[0], c) {
+		t.Error("failed to compare the metadata")
+	}
+}
+
+func TestAnnotationsJSON(t *testing.T) {
+	r, err := Parse(`@owner("a") route1: Any() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(r[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rr Route
+	if err := json.Unmarshal(b, &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Metadata["owner"] != "a" {
+		t.Error("failed to round trip the metadata", string(b))
+	}
+}
+
+func TestFmtAnnotations(t *testing.T) {
+	out, err := Fmt([]byte(`@owner("a")   @description("b") route1: Any() -> <shunt>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != `@owner("a") @description("b") route1: Any() -> <shunt>;`+"\n" {
+		t.Errorf("invalid format: %q", out)
+	}
+}
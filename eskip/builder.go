@@ -0,0 +1,249 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"time"
+)
+
+// RouteBuilder can be used to create route definitions programmatically,
+// without formatting and parsing route expressions. E.g.:
+//
+//     r := eskip.NewRoute().
+//         Id("route1").
+//         Path("/some/path").
+//         Filter("modPath", "^/some", "/other").
+//         BackendUrl("https://www.example.org").
+//         Route()
+type RouteBuilder struct {
+	route *Route
+}
+
+// Creates a route builder.
+func NewRoute() *RouteBuilder {
+	return &RouteBuilder{&Route{}}
+}
+
+// Sets the id of the route.
+func (b *RouteBuilder) Id(id string) *RouteBuilder {
+	b.route.Id = id
+	return b
+}
+
+// Adds a comment line, serialized before the route definition.
+func (b *RouteBuilder) Comment(c string) *RouteBuilder {
+	b.route.Comments = append(b.route.Comments, c)
+	return b
+}
+
+// Sets the exact path to be matched.
+func (b *RouteBuilder) Path(p string) *RouteBuilder {
+	b.route.Path = p
+	return b
+}
+
+// Adds a path regular expression to be matched.
+func (b *RouteBuilder) PathRegexp(rx string) *RouteBuilder {
+	b.route.PathRegexps = append(b.route.PathRegexps, rx)
+	return b
+}
+
+// Adds a host regular expression to be matched.
+func (b *RouteBuilder) Host(rx string) *RouteBuilder {
+	b.route.HostRegexps = append(b.route.HostRegexps, rx)
+	return b
+}
+
+// Sets the method to be matched.
+func (b *RouteBuilder) Method(m string) *RouteBuilder {
+	b.route.Method = m
+	return b
+}
+
+// Sets an exact header value to be matched.
+func (b *RouteBuilder) Header(name, value string) *RouteBuilder {
+	if b.route.Headers == nil {
+		b.route.Headers = make(map[string]string)
+	}
+
+	b.route.Headers[name] = value
+	return b
+}
+
+// Adds a header regular expression to be matched.
+func (b *RouteBuilder) HeaderRegexp(name, rx string) *RouteBuilder {
+	if b.route.HeaderRegexps == nil {
+		b.route.HeaderRegexps = make(map[string][]string)
+	}
+
+	b.route.HeaderRegexps[name] = append(b.route.HeaderRegexps[name], rx)
+	return b
+}
+
+// Sets the TLS version of the client connection to be matched.
+func (b *RouteBuilder) ClientTLSVersion(v string) *RouteBuilder {
+	return b.Predicate("ClientTLSVersion", v)
+}
+
+// Sets that the client needs to present a certificate.
+func (b *RouteBuilder) ClientCertificate() *RouteBuilder {
+	return b.Predicate("ClientCertificate")
+}
+
+// Sets the IP addresses and CIDR ranges, one of which needs to contain
+// the address of the client.
+func (b *RouteBuilder) ClientIP(ips ...string) *RouteBuilder {
+	return b.Predicate("ClientIP", stringArgs(ips)...)
+}
+
+// Sets the trailing slash policy of the route: "strict", "match" or
+// "redirect".
+func (b *RouteBuilder) TrailingSlash(policy string) *RouteBuilder {
+	return b.Predicate("TrailingSlash", policy)
+}
+
+// Sets the time after which the route is not valid anymore.
+func (b *RouteBuilder) ValidUntil(t time.Time) *RouteBuilder {
+	return b.Predicate("ValidUntil", t.Format(time.RFC3339Nano))
+}
+
+// converts the numeric arguments to float64, the same way as the parser
+// represents them
+func normalizeArg(a interface{}) interface{} {
+	switch v := a.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return a
+	}
+}
+
+// Appends a condition without a dedicated field to the route, e.g. a
+// Cookie or a custom predicate. Numeric arguments are converted to
+// float64, the same as in the parsed routes.
+func (b *RouteBuilder) Predicate(name string, args ...interface{}) *RouteBuilder {
+	p := &Predicate{Name: name}
+	for _, a := range args {
+		p.Args = append(p.Args, normalizeArg(a))
+	}
+
+	b.route.CustomPredicates = append(b.route.CustomPredicates, p)
+	return b
+}
+
+// Appends a filter to the route. Numeric arguments are converted to
+// float64, the same as in the parsed routes.
+func (b *RouteBuilder) Filter(name string, args ...interface{}) *RouteBuilder {
+	f := &Filter{Name: name}
+	for _, a := range args {
+		f.Args = append(f.Args, normalizeArg(a))
+	}
+
+	b.route.Filters = append(b.route.Filters, f)
+	return b
+}
+
+// clears the backend of the route, before setting a new one
+func (b *RouteBuilder) resetBackend() {
+	b.route.Backend = ""
+	b.route.Shunt = false
+	b.route.Loopback = false
+	b.route.Dynamic = false
+	b.route.SplitBackends = nil
+}
+
+// Sets the address of the backend.
+func (b *RouteBuilder) BackendUrl(u string) *RouteBuilder {
+	b.resetBackend()
+	b.route.Backend = u
+	return b
+}
+
+// Sets a shunt backend.
+func (b *RouteBuilder) Shunt() *RouteBuilder {
+	b.resetBackend()
+	b.route.Shunt = true
+	return b
+}
+
+// Sets a loopback backend.
+func (b *RouteBuilder) Loopback() *RouteBuilder {
+	b.resetBackend()
+	b.route.Loopback = true
+	return b
+}
+
+// Sets a dynamic backend.
+func (b *RouteBuilder) Dynamic() *RouteBuilder {
+	b.resetBackend()
+	b.route.Dynamic = true
+	return b
+}
+
+// Adds a weighted backend to the split backend of the route.
+func (b *RouteBuilder) SplitBackend(weight int, u string) *RouteBuilder {
+	split := b.route.SplitBackends
+	b.resetBackend()
+	b.route.SplitBackends = append(split, &WeightedBackend{Weight: weight, Backend: u})
+	return b
+}
+
+// Returns the route definition. The builder should not be used after
+// calling this method.
+func (b *RouteBuilder) Route() *Route {
+	return b.route
+}
+
+// Parses a route expression or a routing document, like Parse, and panics
+// on error. It is meant for routes defined in the code, and for tests.
+func MustParse(code string) []*Route {
+	r, err := Parse(code)
+	if err != nil {
+		panic(fmt.Sprintf("eskip: MustParse: %v", err))
+	}
+
+	return r
+}
+
+// Parses a filter chain, like ParseFilters, and panics on error.
+func MustParseFilters(f string) []*Filter {
+	filters, err := ParseFilters(f)
+	if err != nil {
+		panic(fmt.Sprintf("eskip: MustParseFilters: %v", err))
+	}
+
+	return filters
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	validUntil := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRoute().
+		Id("route1").
+		Path("/some/path").
+		PathRegexp("^/some").
+		Host("[.]example[.]org$").
+		Method("GET").
+		Header("Accept", "application/json").
+		HeaderRegexp("X-Foo", "^bar").
+		ValidUntil(validUntil).
+		Filter("setRequestHeader", "X-Bar", 42).
+		BackendUrl("https://www.example.org").
+		Route()
+
+	expected := `Path("/some/path") && Host(/[.]example[.]org$/) && PathRegexp(/^\/some/) && Method("GET") && ` +
+		`Header("Accept", "application/json") && HeaderRegexp("X-Foo", /^bar/) && ValidUntil("2016-01-01T00:00:00Z") -> ` +
+		`setRequestHeader("X-Bar", 42) -> "https://www.example.org"`
+	if r.Id != "route1" || r.String() != expected {
+		t.Error("failed to build route", r.Id, r.String())
+	}
+
+	p := MustParse("route1: " + r.String())
+	if p[0].Filters[0].Args[1] != float64(42) || !Eq(p[0], r) {
+		t.Error("failed to build route with parsed representation")
+	}
+}
+
+func TestBuilderPredicates(t *testing.T) {
+	r := NewRoute().
+		Path("/admin").
+		ClientTLSVersion("1.2").
+		ClientCertificate().
+		Predicate("Traffic", 0.5).
+		BackendUrl("https://www.example.org").
+		Route()
+
+	expected := `Path("/admin") && ClientTLSVersion("1.2") && ClientCertificate() && Traffic(0.5) -> "https://www.example.org"`
+	if r.String() != expected {
+		t.Error("failed to build route with predicates", r.String())
+	}
+
+	p := MustParse(r.String())
+	if !Eq(p[0], r) {
+		t.Error("failed to build route with the parsed representation")
+	}
+}
+
+func TestBuilderShunt(t *testing.T) {
+	r := NewRoute().BackendUrl("https://www.example.org").Shunt().Route()
+	if !r.Shunt || r.Backend != "" || r.String() != "Any() -> <shunt>" {
+		t.Error("failed to build shunt route", r.String())
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("failed to panic")
+		}
+	}()
+
+	MustParse("invalid")
+}
+
+func TestMustParseFilters(t *testing.T) {
+	f := MustParseFilters(`modPath("^/a", "/b") -> static("/", "/var/www")`)
+	if len(f) != 2 || f[0].Name != "modPath" || f[1].Name != "static" {
+		t.Error("failed to parse filters")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+)
+
+// The latest version of the compiled route table format.
+const CompiledVersion = 1
+
+// the leading bytes of a compiled route table, that can't be the start
+// of an eskip document
+const compiledMagic = "\x00eskip-compiled\n"
+
+// Returned when reading a compiled route table, whose leading bytes
+// don't identify it as one.
+var ErrNotCompiled = errors.New("not a compiled route table")
+
+// the encoded content following the leading bytes
+type compiledTable struct {
+	Version int
+	Routes  []*Route
+}
+
+// Tells whether the data starts like a compiled route table.
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(compiledMagic))
+}
+
+// Writes the route definitions as a compiled route table. The table
+// contains the routes as they result from parsing a document: with the
+// imports resolved, and the templates, the variables and the macros
+// expanded, so loading it doesn't require parsing. The regular
+// expressions are stored in their source form, because the compiled
+// ones can't be serialized, and the routing tree is built after
+// loading, the same way as for the parsed routes.
+func WriteCompiled(w io.Writer, routes []*Route) error {
+	if _, err := io.WriteString(w, compiledMagic); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(&compiledTable{Version: CompiledVersion, Routes: routes})
+}
+
+// Reads the route definitions from a compiled route table, created with
+// WriteCompiled. Returns ErrUnsupportedVersion when the table was
+// written in a newer format.
+func ReadCompiled(r io.Reader) ([]*Route, error) {
+	magic := make([]byte, len(compiledMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !IsCompiled(magic) {
+		return nil, ErrNotCompiled
+	}
+
+	var t compiledTable
+	if err := gob.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	if t.Version > CompiledVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	return t.Routes, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompiledRoundTrip(t *testing.T) {
+	r, err := Parse(`
+		let backend = "https://www.example.org";
+		@owner("team") route1: Path("/foo") && (Host(/^a[.]/) || !Method("GET"))
+			-> setPath("/bar")
+			-> rollout(10, "requestHeader", "X-Canary", "true")
+			-> $backend;
+		route2: HeaderRegexp("Accept", /json/) && ValidUntil("2030-01-01T00:00:00Z") -> <shunt>;
+		route3: Any() -> <split 90 "https://a.example.org", 10 "https://b.example.org">;
+		route4: Any() -> <loopback>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCompiled(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsCompiled(buf.Bytes()) {
+		t.Error("failed to identify the compiled table")
+	}
+
+	rc, err := ReadCompiled(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc) != len(r) {
+		t.Fatal("invalid number of routes", len(rc))
+	}
+
+	for i := range r {
+		if !Eq(r[i], rc[i]) {
+			t.Error("failed to round trip", String(r[i]), String(rc[i]))
+		}
+	}
+}
+
+func TestReadCompiledErrors(t *testing.T) {
+	if _, err := ReadCompiled(bytes.NewBufferString(`route1: Any() -> <shunt>`)); err != ErrNotCompiled {
+		t.Error("failed to reject a text document", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCompiled(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadCompiled(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("failed to fail on a truncated table")
+	}
+}
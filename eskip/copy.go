@@ -0,0 +1,305 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"reflect"
+	"sort"
+)
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string(nil), s...)
+}
+
+// Returns a copy of the filter. The arguments are copied into a new
+// slice, so that changing them doesn't affect the original filter.
+func (f *Filter) Copy() *Filter {
+	c := &Filter{Name: f.Name}
+	if f.Args != nil {
+		c.Args = append([]interface{}(nil), f.Args...)
+	}
+
+	return c
+}
+
+// Returns a copy of the predicate, with a copy of its arguments.
+func (p *Predicate) Copy() *Predicate {
+	c := &Predicate{Name: p.Name}
+	if p.Args != nil {
+		c.Args = append([]interface{}(nil), p.Args...)
+	}
+
+	return c
+}
+
+// Returns a deep copy of the route, that shares no slices, maps or
+// filters with the original route.
+func (r *Route) Copy() *Route {
+	c := *r
+	c.HostRegexps = copyStrings(r.HostRegexps)
+	c.PathRegexps = copyStrings(r.PathRegexps)
+	c.Comments = copyStrings(r.Comments)
+	c.Predicate = r.Predicate.Copy()
+
+	if r.CustomPredicates != nil {
+		c.CustomPredicates = make([]*Predicate, len(r.CustomPredicates))
+		for i, p := range r.CustomPredicates {
+			c.CustomPredicates[i] = p.Copy()
+		}
+	}
+
+	if r.SplitBackends != nil {
+		c.SplitBackends = make([]*WeightedBackend, len(r.SplitBackends))
+		for i, b := range r.SplitBackends {
+			cb := *b
+			c.SplitBackends[i] = &cb
+		}
+	}
+
+	if r.Headers != nil {
+		c.Headers = make(map[string]string)
+		for k, v := range r.Headers {
+			c.Headers[k] = v
+		}
+	}
+
+	if r.Metadata != nil {
+		c.Metadata = make(map[string]string)
+		for k, v := range r.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+
+	if r.HeaderRegexps != nil {
+		c.HeaderRegexps = make(map[string][]string)
+		for k, v := range r.HeaderRegexps {
+			c.HeaderRegexps[k] = copyStrings(v)
+		}
+	}
+
+	if r.Filters != nil {
+		c.Filters = make([]*Filter, len(r.Filters))
+		for i, f := range r.Filters {
+			c.Filters[i] = f.Copy()
+		}
+	}
+
+	return &c
+}
+
+// Returns copies of the routes, with copies of the provided filters
+// prepended to the filters of each route. The original routes are not
+// modified. When there are no filters to prepend, the routes are
+// returned as they are.
+func PrependFilters(routes []*Route, filters []*Filter) []*Route {
+	if len(filters) == 0 {
+		return routes
+	}
+
+	prepended := make([]*Route, len(routes))
+	for i, r := range routes {
+		c := r.Copy()
+		fs := make([]*Filter, 0, len(filters)+len(c.Filters))
+		for _, f := range filters {
+			fs = append(fs, f.Copy())
+		}
+
+		c.Filters = append(fs, c.Filters...)
+		prepended[i] = c
+	}
+
+	return prepended
+}
+
+// compares string lists ignoring their order
+func eqStringSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	as, bs := copyStrings(a), copyStrings(b)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns the numeric arguments as float64, the way the parser returns
+// them, so that e.g. 1 and 1.0 are considered equal
+func numericArg(a interface{}) (float64, bool) {
+	switch v := a.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func eqArgs(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if na, ok := numericArg(a[i]); ok {
+			if nb, ok := numericArg(b[i]); !ok || na != nb {
+				return false
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func eqCustomPredicates(a, b []*Predicate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Name != b[i].Name || !eqArgs(a[i].Args, b[i].Args) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func eqFilters(a, b []*Filter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Name != b[i].Name || !eqArgs(a[i].Args, b[i].Args) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Tells whether two route definitions are equal, meaning that they would
+// result in the same route. Nil and empty lists and maps are considered
+// equal, the order of the host, path and header regular expressions is
+// ignored, while the order of the filters, the custom predicates and the
+// split backends is significant. The filter and predicate arguments are
+// compared structurally, with the numbers compared by value regardless
+// of their type. The metadata is compared, too, while
+// the comments are ignored.
+func Eq(a, b *Route) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Id != b.Id ||
+		a.Path != b.Path ||
+		a.Method != b.Method ||
+		a.Shunt != b.Shunt ||
+		a.Loopback != b.Loopback ||
+		a.Dynamic != b.Dynamic ||
+		a.Backend != b.Backend ||
+		!eqStringSets(a.HostRegexps, b.HostRegexps) ||
+		!eqStringSets(a.PathRegexps, b.PathRegexps) ||
+		!eqPredicateExpressions(a.Predicate, b.Predicate) ||
+		!eqCustomPredicates(a.CustomPredicates, b.CustomPredicates) ||
+		len(a.Headers) != len(b.Headers) ||
+		len(a.HeaderRegexps) != len(b.HeaderRegexps) ||
+		len(a.Metadata) != len(b.Metadata) ||
+		len(a.SplitBackends) != len(b.SplitBackends) {
+		return false
+	}
+
+	for i, sb := range a.SplitBackends {
+		if *sb != *b.SplitBackends[i] {
+			return false
+		}
+	}
+
+	for k, v := range a.Headers {
+		if bv, ok := b.Headers[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	for k, v := range a.Metadata {
+		if bv, ok := b.Metadata[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	for k, v := range a.HeaderRegexps {
+		if bv, ok := b.HeaderRegexps[k]; !ok || !eqStringSets(v, bv) {
+			return false
+		}
+	}
+
+	return eqFilters(a.Filters, b.Filters)
+}
+
+// Tells whether two lists of route definitions contain the same routes,
+// regardless of the order. The routes are compared with Eq.
+func EqLists(a, b []*Route) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	byId := make(map[string][]*Route)
+	for _, r := range b {
+		byId[r.Id] = append(byId[r.Id], r)
+	}
+
+	for _, r := range a {
+		candidates := byId[r.Id]
+		found := -1
+		for i, c := range candidates {
+			if Eq(r, c) {
+				found = i
+				break
+			}
+		}
+
+		if found < 0 {
+			return false
+		}
+
+		byId[r.Id] = append(candidates[:found], candidates[found+1:]...)
+	}
+
+	return true
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+const testCopyRoute = `route1: Path("/some/path") &&
+	Host(/^www[.]/) && Host(/[.]org$/) &&
+	Header("Accept", "application/json") &&
+	HeaderRegexp("X-Foo", /^bar/) ->
+	modPath("^/some", "/other") -> static("/", "/var/www") ->
+	"https://www.example.org"`
+
+func TestCopyRoute(t *testing.T) {
+	r := MustParse(testCopyRoute)[0]
+	c := r.Copy()
+	if !Eq(r, c) {
+		t.Error("copy not equal to the original")
+	}
+
+	c.HostRegexps[0] = "changed"
+	c.Headers["Accept"] = "changed"
+	c.HeaderRegexps["X-Foo"][0] = "changed"
+	c.Filters[0].Args[0] = "changed"
+	if r.HostRegexps[0] == "changed" ||
+		r.Headers["Accept"] == "changed" ||
+		r.HeaderRegexps["X-Foo"][0] == "changed" ||
+		r.Filters[0].Args[0] == "changed" {
+		t.Error("copy shares data with the original")
+	}
+}
+
+func TestCopyEmptyRoute(t *testing.T) {
+	r := &Route{Shunt: true}
+	c := r.Copy()
+	if c == r || !Eq(r, c) || c.Headers != nil || c.Filters != nil {
+		t.Error("failed to copy empty route")
+	}
+}
+
+func TestEq(t *testing.T) {
+	for _, ti := range []struct {
+		msg string
+		a   string
+		b   string
+		eq  bool
+	}{{
+		"same",
+		testCopyRoute,
+		testCopyRoute,
+		true,
+	}, {
+		"formatting and host order",
+		`route1: Host(/a/) && Host(/b/) -> f(1, "x") -> <shunt>`,
+		`route1:
+			Host(/b/) &&
+			Host(/a/)
+			-> f(1.0, "x")
+			-> <shunt>`,
+		true,
+	}, {
+		"any and no conditions",
+		`route1: Any() -> <shunt>`,
+		`route1: Any() && Any() -> <shunt>`,
+		true,
+	}, {
+		"different id",
+		`route1: Any() -> <shunt>`,
+		`route2: Any() -> <shunt>`,
+		false,
+	}, {
+		"different filter order",
+		`route1: Any() -> f1() -> f2() -> <shunt>`,
+		`route1: Any() -> f2() -> f1() -> <shunt>`,
+		false,
+	}, {
+		"different filter args",
+		`route1: Any() -> f(1) -> <shunt>`,
+		`route1: Any() -> f("1") -> <shunt>`,
+		false,
+	}, {
+		"different backend",
+		`route1: Any() -> "https://www.example.org"`,
+		`route1: Any() -> <shunt>`,
+		false,
+	}, {
+		"different headers",
+		`route1: Header("Accept", "text/html") -> <shunt>`,
+		`route1: Header("Accept", "application/json") -> <shunt>`,
+		false,
+	}} {
+		if Eq(MustParse(ti.a)[0], MustParse(ti.b)[0]) != ti.eq {
+			t.Error(ti.msg, "failed to compare")
+		}
+	}
+}
+
+func TestEqNumericArgs(t *testing.T) {
+	a := &Route{Id: "route1", Shunt: true, Filters: []*Filter{{Name: "f", Args: []interface{}{1, "x"}}}}
+	b := &Route{Id: "route1", Shunt: true, Filters: []*Filter{{Name: "f", Args: []interface{}{float64(1), "x"}}}}
+	if !Eq(a, b) {
+		t.Error("failed to compare int and float args")
+	}
+
+	b.Filters[0].Args[0] = "1"
+	if Eq(a, b) {
+		t.Error("failed to compare numeric and string args")
+	}
+}
+
+func TestEqNil(t *testing.T) {
+	if !Eq(nil, nil) || Eq(nil, &Route{}) || Eq(&Route{}, nil) {
+		t.Error("failed to compare nil routes")
+	}
+}
+
+func TestEqLists(t *testing.T) {
+	a := MustParse(`route1: Any() -> <shunt>; route2: Path("/") -> <shunt>`)
+	b := MustParse(`route2: Path("/") -> <shunt>; route1: Any() -> <shunt>`)
+	if !EqLists(a, b) {
+		t.Error("failed to compare lists")
+	}
+
+	c := MustParse(`route2: Path("/") -> <shunt>; route1: Path("/") -> <shunt>`)
+	if EqLists(a, c) {
+		t.Error("failed to compare lists")
+	}
+}
+
+func TestPrependFilters(t *testing.T) {
+	routes := MustParse(`
+		route1: Path("/one") -> modPath("^/one", "/") -> "https://one.example.org";
+		route2: Path("/two") -> <shunt>`)
+	fs := MustParseFilters(`flowId("reuse") -> stripExpect()`)
+
+	prepended := PrependFilters(routes, fs)
+	if len(prepended) != 2 {
+		t.Error("failed to prepend filters")
+		return
+	}
+
+	expected := MustParse(`
+		route1: Path("/one") -> flowId("reuse") -> stripExpect() -> modPath("^/one", "/") -> "https://one.example.org";
+		route2: Path("/two") -> flowId("reuse") -> stripExpect() -> <shunt>`)
+	if !EqLists(prepended, expected) {
+		t.Error("failed to prepend filters", String(prepended...))
+	}
+
+	if len(routes[0].Filters) != 1 || len(routes[1].Filters) != 0 {
+		t.Error("the original routes were modified")
+	}
+
+	prepended[0].Filters[0].Args[0] = "create"
+	if fs[0].Args[0] != "reuse" {
+		t.Error("the filters were not copied")
+	}
+}
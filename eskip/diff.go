@@ -0,0 +1,58 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+// Compares two sets of routes by their id, and returns the routes that
+// need to be inserted or updated, and the routes that need to be
+// deleted, in order to get from the old set to the new one, e.g. when
+// applying the routes from a file to etcd incrementally. The routes are
+// compared with Eq, so the formatting, the comments, the order of the
+// conditions and the representation of the numeric arguments are
+// ignored. The returned upserts are in the order of the new routes, and
+// the deletes in the order of the old ones. When an id occurs multiple
+// times in a set, the last occurrence is used.
+func Diff(old, new []*Route) (upsert, delete []*Route) {
+	oldById := make(map[string]*Route)
+	for _, r := range old {
+		oldById[r.Id] = r
+	}
+
+	newById := make(map[string]*Route)
+	for _, r := range new {
+		newById[r.Id] = r
+	}
+
+	for _, r := range new {
+		if newById[r.Id] != r {
+			continue
+		}
+
+		if o, exists := oldById[r.Id]; !exists || !Eq(o, r) {
+			upsert = append(upsert, r)
+		}
+	}
+
+	for _, r := range old {
+		if oldById[r.Id] != r {
+			continue
+		}
+
+		if _, exists := newById[r.Id]; !exists {
+			delete = append(delete, r)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	old := MustParse(`
+		unchanged: Host(/a/) && Host(/b/) -> f(1, "x") -> <shunt>;
+		changed: Path("/changed") -> "https://old.example.org";
+		deleted1: Path("/deleted1") -> <shunt>;
+		deleted2: Path("/deleted2") -> <shunt>`)
+
+	new := MustParse(`
+		// comments are ignored
+		inserted: Path("/inserted") -> <shunt>;
+		changed: Path("/changed") -> "https://new.example.org";
+		unchanged:
+			Host(/b/) &&
+			Host(/a/)
+			-> f(1.0, "x")
+			-> <shunt>`)
+
+	upsert, delete := Diff(old, new)
+	if routeIds(upsert) != "inserted,changed" {
+		t.Error("invalid upserts", routeIds(upsert))
+	}
+
+	if routeIds(delete) != "deleted1,deleted2" {
+		t.Error("invalid deletes", routeIds(delete))
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	routes := MustParse(`route1: Any() -> <shunt>; route2: Path("/") -> <shunt>`)
+
+	if upsert, delete := Diff(nil, nil); len(upsert) != 0 || len(delete) != 0 {
+		t.Error("unexpected diff of empty sets")
+	}
+
+	if upsert, delete := Diff(routes, routes); len(upsert) != 0 || len(delete) != 0 {
+		t.Error("unexpected diff of the same sets")
+	}
+
+	if upsert, delete := Diff(nil, routes); routeIds(upsert) != "route1,route2" || len(delete) != 0 {
+		t.Error("invalid diff from empty set")
+	}
+
+	if upsert, delete := Diff(routes, nil); len(upsert) != 0 || routeIds(delete) != "route1,route2" {
+		t.Error("invalid diff to empty set")
+	}
+}
+
+func TestDiffDuplicateIds(t *testing.T) {
+	old := MustParse(`route1: Path("/a") -> <shunt>; route1: Path("/b") -> <shunt>`)
+	new := MustParse(`route1: Path("/b") -> <shunt>`)
+	if upsert, delete := Diff(old, new); len(upsert) != 0 || len(delete) != 0 {
+		t.Error("failed to use the last occurrence")
+	}
+
+	new = MustParse(`route1: Path("/b") -> <shunt>; route1: Path("/c") -> <shunt>`)
+	if upsert, _ := Diff(old, new); len(upsert) != 1 || upsert[0].Path != "/c" {
+		t.Error("failed to upsert the last occurrence")
+	}
+}
@@ -94,10 +94,142 @@ header value to match.
 The header regexp condition works similar to the header expression, but
 the value to be matched is a regular expression.
 
+    ClientTLSVersion("1.2")
+
+The client TLS version condition matches the TLS version of the client
+connection, one of "1.0", "1.1" or "1.2". Requests received over plain
+HTTP don't match it. E.g. the clients on obsolete TLS versions can be
+routed to an upgrade page:
+
+    upgrade: ClientTLSVersion("1.0") || ClientTLSVersion("1.1") -> <shunt>;
+
+    ClientCertificate()
+
+The client certificate condition matches the requests, whose client
+presented a certificate on the TLS connection, e.g. to allow the admin
+routes only for mutual TLS:
+
+    admin: Path("/admin") && ClientCertificate() -> "https://admin.example.org";
+
+    ClientCert("san", /[.]partners[.]example[.]org$/)
+
+The client cert condition matches a field of the verified client
+certificate, the common name (cn), the subject, the issuer or the
+subject alternative names (san), with a regular expression. Unlike the
+client certificate condition, it doesn't match the certificates that
+were not verified by the TLS server:
+
+    partners: Path("/partners") && ClientCert("cn", /^partner-/) -> clientCertHeaders() -> "https://partners.example.org";
+
+    ClientIP("10.0.0.0/8", "192.168.1.5")
+
+The client IP condition matches the requests whose client address is
+in one of the IP addresses or CIDR ranges. The client address is the
+remote address of the connection, or, when skipper is configured with
+trusted proxies, the right-most address of the X-Forwarded-For header
+that doesn't belong to a trusted proxy. Combined with the ! operator, it
+denies the listed clients:
+
+    admin: Path("/admin") && !ClientIP("203.0.113.0/24") -> "https://admin.example.org";
+
+    TrailingSlash("redirect")
+
+The trailing slash condition sets how the route treats the requests
+whose path differs from the route path only in a trailing slash. With
+"strict", only the exact path matches. With "match", both forms match.
+With "redirect", the other form is redirected to the route path, with
+301 for GET and HEAD requests, and 308 for the other methods. When not
+set, the global policy of the routing applies, which is strict by
+default:
+
+    docs: Path("/docs/") && TrailingSlash("redirect") -> "https://docs.example.org";
+
+    ValidUntil("2016-01-01T00:00:00Z")
+
+The valid until condition sets an expiration time for the route, in
+RFC3339 format. After this time, the route is dropped by the routing.
+It is meant to be used with temporary routes, e.g. campaigns or incident
+mitigations, so that they clean themselves up.
+
+    Cookie("session", /^a/)
+
+The cookie condition matches the requests having a cookie with the
+given name, and, when the regular expression is set, whose value
+matches it. With only the name, the presence of the cookie is checked.
+
+    QueryParam("debug", "1")
+
+The query parameter condition matches the requests having a query
+parameter with the given name, and, when the value is set, one of
+whose values is equal to it.
+
+    Traffic(0.05)
+
+The traffic condition matches a random share of the requests, with the
+given chance between 0 and 1. Combined with a route without it, it
+routes a part of the traffic to a canary backend:
+
+    canary: Path("/api") && Traffic(0.05) -> "https://canary.example.org";
+    stable: Path("/api") -> "https://stable.example.org";
+
+    Schedule("Europe/Berlin", "Mon-Fri 09:00-18:00", "Sat,Sun 10:00-14:00")
+
+The schedule condition matches the requests received during one of the
+recurring weekly windows, in the local time of the given IANA timezone,
+e.g. the opening hours of a store. The daylight saving time changes are
+taken into account. A window without weekdays applies to every day, and
+a window whose end is not after its start ends on the next day:
+
+    night: Path("/orders") && Schedule("America/New_York", "Fri 22:00-06:00") -> "https://maintenance.example.org";
+
+    Between("2024-11-29T00:00Z", "2024-12-02T00:00Z")
+
+The between condition matches the requests received from the start of
+the time window until its end, e.g. for a campaign:
+
+    campaign: Path("/") && Between("2024-11-29T00:00Z", "2024-12-02T00:00Z") -> "https://campaign.example.org";
+
+    Cron("0 2 * * SUN", "30m", "Europe/Berlin")
+
+The cron condition matches the requests received during the minutes
+matching the cron expression, or, when a duration is set, for the
+duration after them. The timezone of the expression is UTC, unless set:
+
+    maintenance: Path("/checkout") && Cron("0 2 * * SUN", "30m", "Europe/Berlin") -> "https://maintenance.example.org";
+
+The Cookie, QueryParam, Traffic, Schedule, Between, Cron, ClientCert,
+ClientTLSVersion, ClientCertificate, ClientIP, TrailingSlash and
+ValidUntil conditions don't have a dedicated field in the parsed route,
+they are stored in its CustomPredicates field, together with the custom
+predicates registered in the routing.
+
     Any()
 
 Catch all condition.
 
+The conditions can be combined with the || and ! operators, and grouped
+with parentheses, where ! binds the strongest, and && binds stronger
+than ||:
+
+    Path("/api") && (Host(/^a[.]example[.]org$/) || Host(/^b[.]example[.]org$/)) && !Method("DELETE")
+
+The negation can be written with the Not wrapper, too, taking a single
+condition or expression, e.g. to match all the hosts except an
+allowlist:
+
+    Not(Host(/^a[.]example[.]org$/) || Host(/^b[.]example[.]org$/))
+
+When formatted, the Not wrapper is printed with the ! operator.
+
+The conditions in the top level conjunction are set in the fields of
+the parsed route, as before, while the rest of the expression is stored
+in its Predicate field, as a tree of PredicateExpression objects. The
+Path, Host, PathRegexp, Method, Header, HeaderRegexp, ClientTLSVersion,
+ClientCertificate, ClientIP, Cookie, QueryParam, Traffic, Schedule,
+Between, Cron, ClientCert and Any conditions can be used in the expressions, where the Path condition matches the path exactly, without
+wildcards. The templates can be referenced only in the top level
+conjunction.
+
 
 Filters
 
@@ -107,6 +239,15 @@ numbers of parameters depending on the implementation of the particular
 filter. The parameters can be of type string ("a string"), number
 (3.1415) or regular expression (/[.]html$/ or "[.]html$").
 
+Strings between backticks are raw literals: they can span multiple lines,
+and their content is taken without any unescaping, which is practical
+for embedding JSON payloads or long regular expressions, e.g. in the
+arguments of a custom filter:
+
+    customConfig(`{
+        "status": "ok"
+    }`)
+
 A filter example:
 
     responseHeader("max-age", "86400") -> static("/", "/var/www/public")
@@ -128,8 +269,106 @@ filters:
 
     static("/images", "/var/www/images")
 
+    static("/files", "/var/www/files", "listing")
+
     stripQuery("true")
 
+    deadline(3000)
+
+    compressRequest(1024)
+
+    consistentHash("header:X-Tenant", "http://cache1", "http://cache2")
+
+    failover("eu-central=https://eu.example.org", "eu-west=https://west.example.org")
+
+    socketOptions("dscp", 46, "tcpNoDelay", "false")
+
+    stripExpect()
+
+    websocketOrigin("https://www.example.org")
+
+    websocketLimits("lifetime", 3600000, "bandwidth", 65536)
+
+    rollout(10, "requestHeader", "X-New-Auth", "true")
+
+    pathTemplate("/users/:id/orders/:oid")
+
+    negotiate("Accept", "application/json", "https://api.example.org", "text/html", "https://ui.example.org")
+
+    backendScheme("https")
+
+    backendHost("internal.cluster.local:8443")
+
+    tlsServerName("public.example.org")
+
+    backendProtocol("http2")
+
+    grpcWeb()
+
+    canary("checkout", 10, "https://checkout-canary.example.org", "rollback")
+
+    srvBackend("_http._tcp.api.service.consul")
+
+    compressDictionary("/etc/skipper/api.dict")
+
+    stripTrackingParams("ref", "pk_*")
+
+    extract("userId", "header:X-User")
+
+    auditSignature("/etc/skipper/audit.key")
+
+    sample(0.01, "auditSignature", "/etc/skipper/audit.key")
+
+    when(`Method("POST")`, `requestHeader("X-Write", "true")`)
+
+    rewriteResponseBody("http://legacy.example.org", "https://www.example.org")
+
+    maxRequestBodySize(1048576)
+
+    maxResponseBodySize(10485760)
+
+    responseBandwidth(1048576)
+
+    clientRatelimit("api", 100, "1m")
+
+    circuitBreaker("consecutive", "failures", 5, "timeout", "10s")
+
+    retry(2, "502,503,504")
+
+    backendTimeout("2s")
+
+    responseHeaderTimeout("500ms")
+
+    compress("text/html", "application/json")
+
+    verifyContentType("json", "multipart")
+
+    basicAuth("/etc/skipper/htpasswd", "admin")
+
+    clientIP("10.0.0.0/8", "192.168.1.5")
+
+    denyClientIP("203.0.113.0/24")
+
+    cors("https://www.example.org, https://*.example.org", "GET, POST")
+
+    setRequestHeader("X-Forwarded-Host", "${request.host}")
+
+    setResponseHeader("X-Route", "${route.id}")
+
+    dropResponseHeader("Server")
+
+    redirectTo(301, /^\/promo\/(.*)$/, "https://shop.example.org/campaigns/$1")
+
+    setQuery("lang", "${request.header.Accept-Language}")
+
+    dropQuery("sessionId")
+
+    normalizeEncoding("gzip", "deflate")
+
+    detectDevice("/etc/skipper/devices.json")
+
+    classify("checkout", "path:/checkout", "search", "method:GET && path:/search", "other")
+
 For details about the built-in filters, please, refer to the
 documentation of the skipper/filters package. Skipper is designed to be
 extendable primarily by implementing custom filters, for details about
@@ -139,7 +378,9 @@ root skipper package.
 
 Backend
 
-There are two types of backends: a network endpoint address or a shunt.
+There are five types of backends: a network endpoint address, a shunt,
+a loopback, a dynamic backend, or a split between multiple network
+endpoints.
 
 A network endpoint address example:
 
@@ -158,6 +399,37 @@ network endpoint, but the router will handle the request itself. By
 default, the response is in this case 404 Not found, unless a filter in
 the route does not change it.
 
+A loopback backend:
+
+    <loopback>
+
+The loopback backend means that the request, as modified by the filters
+of the route, is matched again against the routes, e.g. to implement
+internal redirects by changing the path:
+
+    legacy: Path("/old") -> modPath(".*", "/new") -> <loopback>;
+
+A dynamic backend:
+
+    <dynamic>
+
+The dynamic backend means that the address of the network endpoint is
+set by the filters of the route at request time, e.g. based on service
+discovery. The request fails, when none of the filters sets it:
+
+    api: Path("/api") -> srvBackend("_http._tcp.api.service.consul") -> <dynamic>;
+
+A split backend:
+
+    <split 90 "https://stable.example.org", 10 "https://canary.example.org">
+
+The split backend lists multiple network endpoints with their relative
+weights, and the proxy picks one of them for each request, according to
+the weights, e.g. to send a small portion of the traffic to a canary
+deployment. The weights need to be non-negative integers, with at least
+one of them positive. A weight of 0 disables an endpoint without
+removing it from the route.
+
 
 Comments
 
@@ -171,6 +443,109 @@ Example with comments:
     route1: Path("/api") -> "https://api.example.org";
     route2: Any() -> <shunt> // everything else 404
 
+The block of comment lines directly preceding a route definition, not
+separated from it by an empty line, is kept in the Comments field of the
+parsed route, and the eskip.String function serializes it back, so that
+the documentation of the routes survives the round-trip through Parse
+and String. In the above example, route1 gets the comment "forwards to
+the API endpoint". The other comments, e.g. the ones following the
+routes, and the comments of the templates, are dropped.
+
+
+Annotations
+
+Route definitions can be preceded by annotations, that attach metadata
+to the routes, e.g. the owning team, without affecting the routing:
+
+    @owner("team-checkout") @description("legacy redirect")
+    legacy: Path("/x") -> <shunt>;
+
+Each annotation takes a single string argument, or a variable, and an
+annotation can appear only once per route. The annotations are stored
+in the Metadata field of the parsed route, and eskip.String serializes
+them back, ordered by name.
+
+
+Templates
+
+When many routes share the same conditions or the same leading filters,
+e.g. for authentication or logging, these can be defined once, in a
+template. A template definition looks like a route definition without a
+backend, and its name starts with '@'. The filters are optional, when
+only the conditions are shared, while the Any() condition can be used
+when only the filters are shared:
+
+    @auth: Header("Authorization", /^Bearer /) -> requestHeader("X-Authenticated", "true");
+    @logged: Any() -> responseHeader("X-Logged", "true");
+
+Routes, and other templates, can extend a template by referencing it
+among their conditions:
+
+    api: @auth && @logged && Path("/api") -> "https://api.example.org";
+
+The conditions of the referenced templates are added to the conditions
+of the route, and their filters are prepended to the filters of the
+route, in the order of the references. The templates can be defined
+anywhere in the same document, and they don't appear among the parsed
+routes.
+
+
+Variables
+
+The values repeated across many routes, e.g. timeouts or backend
+addresses, can be defined once, as variables, and referenced by their
+name prefixed with '$', among the arguments of the conditions and the
+filters, and as the backend:
+
+    let backendTimeout = 2000;
+    let api = "https://api.example.org";
+
+    orders: Path("/orders") -> timeout($backendTimeout) -> $api;
+    users: Path("/users") -> timeout($backendTimeout) -> $api;
+
+The value of a variable is a number, a string or a regular expression,
+and the variables can be defined anywhere in the same document. The
+references to undefined variables are reported as parse errors, with
+the position of the reference.
+
+
+Macros
+
+When many routes differ only in a few values, e.g. the host and the
+backend of the services, the whole route expression can be defined once,
+as a macro with parameters, and the routes can invoke it with the
+actual values:
+
+    def standardService(host, backend) = Host($host) -> ratelimit(100) -> $backend;
+
+    orders: standardService("^orders[.]example[.]org$", "https://orders.internal");
+    users: standardService("^users[.]example[.]org$", "https://users.internal");
+
+The parameters are referenced in the body of the macro the same way as
+the variables, and the arguments of the invocations can reference
+variables, too. The macros are expanded during parsing, so the parsed
+routes are the same as if the expanded route expressions were written
+in the document. The macros can be defined anywhere in the same
+document, and the body of a macro can reference templates.
+
+Large routing configurations can be split into multiple files, e.g. one
+per team, with import directives, placed among the route definitions:
+
+    import "teams/checkout.eskip";
+    import "teams/search.eskip";
+
+    catchAll: Any() -> "https://www.example.org";
+
+The include keyword can be used instead of import. The imports are
+resolved only when parsing files with the eskip.ParseFile function,
+which is used by the eskipfile data client, too. The relative paths are
+resolved from the directory of the importing file, every file is
+imported only once, and the import cycles are reported as errors. The
+templates defined in any of the imported files can be referenced from
+all of them, while the variables are visible only in the file defining
+them. The parse errors tell the file containing the error. The
+eskip.Parse function rejects the documents containing imports.
+
 
 Regular expressions
 
@@ -186,23 +561,155 @@ The eskip.ParseFilters method can be used to parse a chain of filters,
 without the matcher and backend part of a full route expression.
 
 
+JSON and YAML
+
+To exchange routes with non-Go tooling, or to store and diff them as
+structured data, the routes can be encoded as JSON objects, with the
+matching conditions represented as a list of predicates:
+
+    {
+      "id": "api",
+      "predicates": [{"name": "Path", "args": ["/api"]}],
+      "filters": [{"name": "modPath", "args": ["^/api", ""]}],
+      "backend": "https://api.example.org"
+    }
+
+The eskip.ParseJSON function parses a JSON array of routes, while the
+eskip.Serialize function returns the same in-memory routes either in
+eskip syntax or as JSON. The routes, the filters and the predicates
+implement the Marshaler and the Unmarshaler interfaces of the common
+YAML packages, e.g. gopkg.in/yaml.v2, using the same structure.
+
+
+Tokens
+
+For editor tooling, e.g. syntax highlighting, the eskip.Tokenizer splits
+a document into tokens, with their kind, raw text and position, using
+the same token expressions as the parser. It returns the comments, too,
+and it continues after the invalid characters:
+
+    t := eskip.NewTokenizer(doc)
+    for {
+        token, err := t.Next()
+        if err == io.EOF {
+            break
+        }
+
+        highlight(token.Kind, token.Start, token.End)
+    }
+
+
 Parsing
 
 Parsing a routing table or a route expression happens with the
-eskip.Parse function. In case of grammar error, it returns an error with
-the approximate position of the invalid syntax element, otherwise it
-returns a list of structured, in-memory route definitions.
+eskip.Parse function. In case of grammar error, it returns an
+*eskip.ParseError, telling the offset, the line and the column of the
+invalid syntax element, together with a snippet of the document marking
+its location, otherwise it returns a list of structured, in-memory route
+definitions.
 
 The eskip parser does not validate the routes against semantic rules,
 e.g., whether a match expression is valid, or a filter implementation
 is available. This validation happens during processing the parsed
 definitions.
 
+To catch typos before the routes are deployed, the eskip.ParseStrict
+function can be used. It takes the names of the available filters, e.g.
+from a filter registry, and optionally the names of the predicates, and
+rejects the documents referencing unknown names, suggesting the most
+similar known name:
+
+    routes, err := eskip.ParseStrict(doc, builtin.MakeRegistry().Names(), nil)
+
+While eskip.Parse stops at the first error, the eskip.ValidateAll
+function continues with the next definition after the failing one, and
+returns all the syntax and semantic errors of the document, e.g. to
+report every broken route in a CI check in one pass:
+
+    for _, err := range eskip.ValidateAll(doc) {
+        fmt.Println(err.Error())
+    }
+
+Large routing documents, e.g. backups of the routes stored in etcd, can
+be parsed incrementally, without loading the whole document into memory,
+with the eskip.ParseReader function. The returned stream yields the
+routes one by one, and io.EOF at the end of the document:
+
+    s := eskip.ParseReader(f)
+    for {
+        r, err := s.Next()
+        if err == io.EOF {
+            break
+        } else if err != nil {
+            return err
+        }
+
+        process(r)
+    }
+
+In the streamed documents, the templates need to be defined before the
+routes referencing them.
+
+
+Document Header
+
+A routing document can start with a header of special comment lines,
+containing the version of the eskip format and the checksum of the rest
+of the document:
+
+    // eskip-version: 1
+    // eskip-checksum: c7bfd0ccb0716068cabdcdaab16f1ffcfcddd6c353755070a4882e22f9f94b14
+    route1: Path("/") -> "https://www.example.org";
+
+The eskip.ParseDocument function verifies the header, when present, and
+fails with eskip.ErrUnsupportedVersion or eskip.ErrChecksumMismatch, so
+that the data clients can detect format version mismatches and partially
+written documents. The eskip.WithHeader function prepends a document with
+the header. Since the header consists of comments, it is ignored by the
+eskip.Parse function.
+
+
+Formatting
+
+The eskip.Fmt function formats a routing document in a canonical
+format, similar to gofmt, keeping the comments and the templates. The
+eskip fmt command uses it to format route files, or to check whether
+they are formatted:
+
+    eskip fmt -check routes.eskip
+
+
+Building Routes
+
+Routes can be created programmatically with the eskip.RouteBuilder,
+without formatting route expressions:
+
+    r := eskip.NewRoute().Id("route1").Path("/a").Filter("modPath", "^/a", "/b").BackendUrl("https://www.example.org").Route()
+
+For route expressions defined in the code, the eskip.MustParse and
+eskip.MustParseFilters functions can be used, that panic on error.
+
 
 Serializing
 
 Serializing a single route happens by calling its String method.
 Serializing a complete routing table happens by calling the
-eskip.String method.
+eskip.String method. To include the document header, the result can be
+passed to eskip.WithHeader.
+
+
+Compiled Route Tables
+
+For large routing tables, parsing can dominate the startup time of the
+proxy. The eskip.WriteCompiled function stores the parsed routes in a
+binary format, with the imports, the templates, the variables and the
+macros already resolved, and eskip.ReadCompiled loads them without
+parsing. The regular expressions are kept in their source form, since
+they can't be stored compiled. The eskip compile command creates such a
+table from a route file, and the eskipfile data client accepts it in
+place of an eskip file:
+
+    eskip compile routes.eskip > routes.eskipc
+    skipper -routes-file routes.eskipc
 */
 package eskip
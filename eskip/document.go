@@ -0,0 +1,156 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The latest version of the eskip format supported by the parser.
+const DocumentVersion = 1
+
+const (
+	headerPrefix      = "// eskip-"
+	versionHeaderKey  = "version"
+	checksumHeaderKey = "checksum"
+)
+
+var (
+	// Returned when the checksum in the document header doesn't match
+	// the content, e.g. because of a partial write.
+	ErrChecksumMismatch = errors.New("document checksum mismatch")
+
+	// Returned when the version in the document header is higher than
+	// the supported version.
+	ErrUnsupportedVersion = errors.New("unsupported document version")
+)
+
+// A routing document with the metadata from its header.
+//
+// The header consists of the comment lines at the start of the document,
+// in the form of:
+//
+//     // eskip-version: 1
+//     // eskip-checksum: c7bfd0ccb0716068cabdcdaab16f1ffcfcddd6c353755070a4882e22f9f94b14
+//
+// The checksum is the hex encoded SHA-256 sum of the document content
+// following the header.
+type Document struct {
+
+	// The version of the eskip format, zero when not set.
+	Version int
+
+	// The checksum of the content, empty when not set.
+	Checksum string
+
+	// Other, unrecognized header values, by their keys.
+	Header map[string]string
+
+	// The routes in the document.
+	Routes []*Route
+}
+
+// splits the header lines from the beginning of the document
+func splitHeader(code string) (map[string]string, string) {
+	header := make(map[string]string)
+	for strings.HasPrefix(code, headerPrefix) {
+		line := code
+		rest := ""
+		if i := strings.Index(code, "\n"); i >= 0 {
+			line, rest = code[:i], code[i+1:]
+		}
+
+		kv := strings.SplitN(strings.TrimPrefix(line, headerPrefix), ":", 2)
+		if len(kv) != 2 {
+			break
+		}
+
+		header[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		code = rest
+	}
+
+	return header, code
+}
+
+// Returns the checksum of a document content, as used in the document
+// header.
+func Checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Prepends a document with a header containing the current version and
+// the checksum of the document.
+func WithHeader(doc string) string {
+	return fmt.Sprintf("%s%s: %d\n%s%s: %s\n%s",
+		headerPrefix, versionHeaderKey, DocumentVersion,
+		headerPrefix, checksumHeaderKey, Checksum(doc),
+		doc)
+}
+
+// verifies the version and the checksum in the header of a document,
+// and returns the document without the routes, and the content
+// following the header
+func parseHeader(code string) (*Document, string, error) {
+	header, content := splitHeader(code)
+	d := &Document{Header: header}
+
+	if v, ok := header[versionHeaderKey]; ok {
+		var err error
+		if d.Version, err = strconv.Atoi(v); err != nil || d.Version < 0 {
+			return nil, "", fmt.Errorf("invalid document version: %s", v)
+		}
+
+		if d.Version > DocumentVersion {
+			return nil, "", ErrUnsupportedVersion
+		}
+
+		delete(header, versionHeaderKey)
+	}
+
+	if c, ok := header[checksumHeaderKey]; ok {
+		if c != Checksum(content) {
+			return nil, "", ErrChecksumMismatch
+		}
+
+		d.Checksum = c
+		delete(header, checksumHeaderKey)
+	}
+
+	return d, content, nil
+}
+
+// Parses a routing document, like Parse, and verifies the version and
+// the checksum in its header, if set. It returns ErrUnsupportedVersion,
+// when the version is higher than DocumentVersion, and
+// ErrChecksumMismatch, when the checksum doesn't match the content.
+func ParseDocument(code string) (*Document, error) {
+	d, content, err := parseHeader(code)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Routes, err = Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+const testDocumentContent = `route1: Path("/") -> "https://www.example.org";
+`
+
+func TestParseDocumentWithoutHeader(t *testing.T) {
+	d, err := ParseDocument(testDocumentContent)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if d.Version != 0 || d.Checksum != "" || len(d.Routes) != 1 || d.Routes[0].Id != "route1" {
+		t.Error("failed to parse document", d)
+	}
+}
+
+func TestParseDocumentWithHeader(t *testing.T) {
+	d, err := ParseDocument(WithHeader(testDocumentContent))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if d.Version != DocumentVersion || d.Checksum != Checksum(testDocumentContent) ||
+		len(d.Routes) != 1 || d.Routes[0].Id != "route1" {
+		t.Error("failed to parse document", d)
+	}
+}
+
+func TestParseDocumentCustomHeader(t *testing.T) {
+	d, err := ParseDocument("// eskip-owner: team-a\n" + testDocumentContent)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if d.Header["owner"] != "team-a" || len(d.Routes) != 1 {
+		t.Error("failed to parse header", d)
+	}
+}
+
+func TestParseDocumentChecksumMismatch(t *testing.T) {
+	doc := WithHeader(testDocumentContent + `route2: Any() -> <shunt>;`)
+	_, err := ParseDocument(doc[:len(doc)-8])
+	if err != ErrChecksumMismatch {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestParseDocumentUnsupportedVersion(t *testing.T) {
+	_, err := ParseDocument("// eskip-version: 2\n" + testDocumentContent)
+	if err != ErrUnsupportedVersion {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestParseDocumentInvalidVersion(t *testing.T) {
+	_, err := ParseDocument("// eskip-version: foo\n" + testDocumentContent)
+	if err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestParseHeaderedDocument(t *testing.T) {
+	r, err := Parse(WithHeader(testDocumentContent))
+	if err != nil || len(r) != 1 || r[0].Id != "route1" {
+		t.Error("failed to parse document with header", err)
+	}
+}
@@ -35,21 +35,74 @@ type matcher struct {
 // Route definition used during the parser processes the raw routing
 // document.
 type parsedRoute struct {
-	id       string
-	matchers []*matcher
-	filters  []*Filter
-	shunt    bool
-	backend  string
+	id        string
+	template  bool
+	templates []string
+	matchers  []*matcher
+	predicate *predicateNode
+
+	// the annotations preceding the route id, e.g. @owner("team")
+	annotations []*matcher
+	filters     []*Filter
+	shunt       bool
+	loopback    bool
+	dynamic     bool
+	backend     string
+	comments    *definitionComments
+
+	// the variable referenced as the backend
+	backendRef *variableRef
+
+	// the weights and the addresses of a split backend, in pairs
+	split []interface{}
+
+	// the path of an import directive
+	importPath string
+
+	// the value of a variable definition, where the id is the name of
+	// the variable
+	variable bool
+	value    interface{}
+
+	// the parameters of a macro definition, where the id is the name of
+	// the macro
+	macro  bool
+	params []string
+
+	// the macro invoked by a route definition, with its arguments
+	call *matcher
+
+	// the position of the path of an import directive, the name of a
+	// variable or macro definition, or the macro invoked by a route, in
+	// the parsed code
+	position int
+}
+
+// a reference to a variable, e.g. $timeout, among the arguments or as
+// the backend, substituted with the value of the variable
+type variableRef struct {
+	name     string
+	position int
 }
 
 // A Filter object represents a parsed, in-memory filter expression.
 type Filter struct {
 
 	// name of the filter specification
-	Name string
+	Name string `json:"name" yaml:"name"`
 
 	// filter parameters applied withing a particular route
-	Args []interface{}
+	Args []interface{} `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// A backend of a route with a split backend, with its relative weight.
+type WeightedBackend struct {
+
+	// The relative weight of the backend, e.g. 90.
+	Weight int `json:"weight" yaml:"weight"`
+
+	// The address of the backend, e.g. "https://canary.example.org".
+	Backend string `json:"backend" yaml:"backend"`
 }
 
 // A Route object represents a parsed, in-memory route definition.
@@ -83,6 +136,20 @@ type Route struct {
 	// E.g. HeaderRegexp("Accept", /\Wapplication\/json\W/)
 	HeaderRegexps map[string][]string
 
+	// The conditions without a dedicated field, the built-in ones, like
+	// Cookie or ClientTLSVersion, and the custom predicates registered
+	// in the routing, in the order of their appearance.
+	// E.g. Cookie("session", /^a/) or JWTClaim("tenant", "acme")
+	CustomPredicates []*Predicate
+
+	// The conditions combined with the || or the ! operators, that
+	// need to match in addition to the above conditions. Nil when the
+	// route has only a conjunction of conditions.
+	// E.g. for Path("/foo") && (Host(/^a[.]/) || Host(/^b[.]/)), the
+	// Path field is set, and the host conditions are in the
+	// expression.
+	Predicate *PredicateExpression
+
 	// Set of filters in a particular route.
 	// E.g. redirect(302, "https://www.example.org/hello")
 	Filters []*Filter
@@ -91,9 +158,37 @@ type Route struct {
 	// (<shunt>, no forwarding to a backend)
 	Shunt bool
 
+	// Indicates that the parsed route has a loopback backend. The
+	// request, as modified by the filters, is matched again against
+	// the routes.
+	// (<loopback>, no forwarding to a backend)
+	Loopback bool
+
+	// Indicates that the parsed route has a dynamic backend, whose
+	// address is set by the filters of the route.
+	// (<dynamic>)
+	Dynamic bool
+
 	// The address of a backend for a parsed route.
 	// E.g. "https://www.example.org"
 	Backend string
+
+	// The weighted backends of a route with a split backend. The proxy
+	// picks one of them for each request, according to their weights.
+	// When set, the Backend is empty, and Shunt, Loopback and Dynamic
+	// are false.
+	// E.g. <split 90 "https://stable.example.org", 10 "https://canary.example.org">
+	SplitBackends []*WeightedBackend
+
+	// The comment lines directly preceding the route definition in
+	// the document, without the leading '//' and the first space.
+	// E.g. []string{"forwards to the API endpoint"}
+	Comments []string
+
+	// Annotations of the route, that don't affect the routing, e.g.
+	// the owner of the route.
+	// E.g. @owner("team-checkout") @description("legacy redirect")
+	Metadata map[string]string
 }
 
 // Returns the first parameter of a matcher with the given name.
@@ -154,6 +249,82 @@ func getMatcherArgMap(r *parsedRoute, name string) (map[string][]string, error)
 	return argMap, nil
 }
 
+// returns the matchers that don't have a dedicated field in the route as
+// custom predicates
+func customPredicates(r *parsedRoute) []*Predicate {
+	var p []*Predicate
+	for _, m := range r.matchers {
+		if !isFieldPredicate(m.name) {
+			p = append(p, &Predicate{Name: m.name, Args: append([]interface{}(nil), m.args...)})
+		}
+	}
+
+	return p
+}
+
+// returns the weighted backends of a split backend. The weights need to
+// be non-negative integers, and at least one of them needs to be
+// positive.
+func splitBackends(args []interface{}) ([]*WeightedBackend, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	var (
+		backends []*WeightedBackend
+		total    int
+	)
+
+	for i := 0; i+1 < len(args); i += 2 {
+		w, ok := args[i].(float64)
+		if !ok || w < 0 || w != float64(int(w)) {
+			return nil, fmt.Errorf("invalid split backend weight: %v", args[i])
+		}
+
+		b, ok := args[i+1].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid split backend address: %v", args[i+1])
+		}
+
+		backends = append(backends, &WeightedBackend{Weight: int(w), Backend: b})
+		total += int(w)
+	}
+
+	if total == 0 {
+		return nil, errors.New("split backend without positive weight")
+	}
+
+	return backends, nil
+}
+
+// returns the annotations as metadata. The annotations need to have a
+// single string argument, and their names need to be unique.
+func annotationMetadata(annotations []*matcher) (map[string]string, error) {
+	if len(annotations) == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string)
+	for _, a := range annotations {
+		if len(a.args) != 1 {
+			return nil, fmt.Errorf("invalid number of arguments for annotation %s: %d, expected: 1", a.name, len(a.args))
+		}
+
+		v, ok := a.args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid argument for annotation %s: %v", a.name, a.args[0])
+		}
+
+		if _, exists := m[a.name]; exists {
+			return nil, fmt.Errorf("duplicate annotation: %s", a.name)
+		}
+
+		m[a.name] = v
+	}
+
+	return m, nil
+}
+
 // Converts a parsing route objects to the exported route definition with
 // pre-processed but not validated matchers.
 func newRouteDefinition(r *parsedRoute) (*Route, error) {
@@ -171,13 +342,22 @@ func newRouteDefinition(r *parsedRoute) (*Route, error) {
 	rd.Id = r.id
 	rd.Filters = r.filters
 	rd.Shunt = r.shunt
+	rd.Loopback = r.loopback
+	rd.Dynamic = r.dynamic
 	rd.Backend = r.backend
+	rd.Predicate = r.predicate.expression()
+	if r.comments != nil {
+		rd.Comments = r.comments.leading
+	}
 
+	withError(func() { rd.Metadata, err = annotationMetadata(r.annotations) })
+	withError(func() { rd.SplitBackends, err = splitBackends(r.split) })
 	withError(func() { rd.Path, err = getFirstMatcherString(r, "Path") })
 	withError(func() { rd.HostRegexps, err = getMatcherStrings(r, "Host") })
 	withError(func() { rd.PathRegexps, err = getMatcherStrings(r, "PathRegexp") })
 	withError(func() { rd.Method, err = getFirstMatcherString(r, "Method") })
 	withError(func() { rd.HeaderRegexps, err = getMatcherArgMap(r, "HeaderRegexp") })
+	rd.CustomPredicates = customPredicates(r)
 
 	withError(func() {
 		var h map[string][]string
@@ -193,11 +373,67 @@ func newRouteDefinition(r *parsedRoute) (*Route, error) {
 	return rd, err
 }
 
-// executes the parser.
-func parse(code string) ([]*parsedRoute, error) {
-	l := newLexer(code)
+// returns the matchers of the route, including the ones in the
+// predicate expression
+func (r *parsedRoute) allMatchers() []*matcher {
+	return append(append([]*matcher(nil), r.matchers...), r.predicate.matchers()...)
+}
+
+// executes the parser, and returns the lexer holding the results. The
+// start position is used to report the location of the parse errors in
+// the document.
+func lexAndParse(code string, start position) (*eskipLex, error) {
+	l := newLexer(code, start)
 	eskipParse(l)
-	return l.routes, l.err
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	// every definition starts with a new token, so the comments
+	// collected by the lexer are in the order of the definitions
+	if len(l.comments) == len(l.routes) {
+		for i, r := range l.routes {
+			r.comments = l.comments[i]
+		}
+	}
+
+	return l, nil
+}
+
+// executes the parser, and resolves the variables and the macros,
+// collecting their definitions into s. The start position is used to report
+// the location of the parse errors in the document. The import
+// directives are rejected, because without a file, their path can't be
+// resolved.
+func parseRoutes(code string, start position, s *symbols) ([]*parsedRoute, error) {
+	l, err := lexAndParse(code, start)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range l.routes {
+		if r.importPath != "" {
+			l.lastToken = r.importPath
+			l.errorAt(r.position, "import directives are supported only in files")
+			return nil, l.err
+		}
+	}
+
+	if err := l.resolveSymbols(s); err != nil {
+		return nil, err
+	}
+
+	return l.routes, nil
+}
+
+// executes the parser, and expands the route templates.
+func parse(code string) ([]*parsedRoute, error) {
+	routes, err := parseRoutes(code, documentStart, newSymbols())
+	if err != nil {
+		return nil, err
+	}
+
+	return expandTemplates(routes)
 }
 
 // hacks a filter expression into a route expression for parsing.
@@ -210,13 +446,8 @@ func filtersToRoute(f string) string {
 	return fmt.Sprintf("Any() -> %s -> <shunt>", f)
 }
 
-// Parses a route expression or a routing document to a set of route definitions.
-func Parse(code string) ([]*Route, error) {
-	parsedRoutes, err := parse(code)
-	if err != nil {
-		return nil, err
-	}
-
+// converts the parsed routes to route definitions.
+func newRouteDefinitions(parsedRoutes []*parsedRoute) ([]*Route, error) {
 	routeDefinitions := make([]*Route, len(parsedRoutes))
 	for i, r := range parsedRoutes {
 		rd, err := newRouteDefinition(r)
@@ -230,6 +461,16 @@ func Parse(code string) ([]*Route, error) {
 	return routeDefinitions, nil
 }
 
+// Parses a route expression or a routing document to a set of route definitions.
+func Parse(code string) ([]*Route, error) {
+	parsedRoutes, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRouteDefinitions(parsedRoutes)
+}
+
 // Parses a filter chain into a list of parsed filter definitions.
 func ParseFilters(f string) ([]*Filter, error) {
 	rs, err := parse(filtersToRoute(f))
@@ -14,7 +14,10 @@
 
 package eskip
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestParsePathMatcher(t *testing.T) {
 	r, err := Parse(`Path("/some/path") -> "https://www.example.org"`)
@@ -99,6 +102,179 @@ func TestParseHeaders(t *testing.T) {
 	}
 }
 
+func TestParseValidUntil(t *testing.T) {
+	r, err := Parse(`Path("/campaign") && ValidUntil("2016-01-01T12:00:00+01:00") -> "https://www.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 || len(r[0].CustomPredicates) != 1 || r[0].CustomPredicates[0].Name != "ValidUntil" ||
+		r[0].CustomPredicates[0].Args[0] != "2016-01-01T12:00:00+01:00" {
+		t.Error("failed to parse valid until")
+	}
+}
+
+func TestParseClientTLS(t *testing.T) {
+	r, err := Parse(`Path("/admin") && ClientTLSVersion("1.2") && ClientCertificate() -> "https://www.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 || len(r[0].CustomPredicates) != 2 ||
+		r[0].CustomPredicates[0].Name != "ClientTLSVersion" || r[0].CustomPredicates[0].Args[0] != "1.2" ||
+		r[0].CustomPredicates[1].Name != "ClientCertificate" || len(r[0].CustomPredicates[1].Args) != 0 {
+		t.Error("failed to parse the client TLS conditions")
+		return
+	}
+
+	s := r[0].String()
+	if s != `Path("/admin") && ClientTLSVersion("1.2") && ClientCertificate() -> "https://www.example.org"` {
+		t.Error("failed to serialize the client TLS conditions", s)
+	}
+
+	rj, err := json.Marshal(r[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var rr Route
+	if err := json.Unmarshal(rj, &rr); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !Eq(r[0], &rr) {
+		t.Error("failed to round trip the client TLS conditions in JSON", string(rj))
+	}
+}
+
+func TestParseTrailingSlash(t *testing.T) {
+	r, err := Parse(`Path("/docs/") && TrailingSlash("redirect") -> "https://www.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 || len(r[0].CustomPredicates) != 1 || r[0].CustomPredicates[0].Name != "TrailingSlash" ||
+		r[0].CustomPredicates[0].Args[0] != "redirect" {
+		t.Error("failed to parse the trailing slash condition")
+		return
+	}
+
+	s := r[0].String()
+	if s != `Path("/docs/") && TrailingSlash("redirect") -> "https://www.example.org"` {
+		t.Error("failed to serialize the trailing slash condition", s)
+	}
+
+	rj, err := json.Marshal(r[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var rr Route
+	if err := json.Unmarshal(rj, &rr); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !Eq(r[0], &rr) {
+		t.Error("failed to round trip the trailing slash condition in JSON", string(rj))
+	}
+}
+
+func TestParseClientIP(t *testing.T) {
+	r, err := Parse(`Path("/admin") && ClientIP("10.0.0.0/8", "192.168.1.5") -> "https://admin.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 || len(r[0].CustomPredicates) != 1 || r[0].CustomPredicates[0].Name != "ClientIP" ||
+		len(r[0].CustomPredicates[0].Args) != 2 ||
+		r[0].CustomPredicates[0].Args[0] != "10.0.0.0/8" || r[0].CustomPredicates[0].Args[1] != "192.168.1.5" {
+		t.Error("failed to parse the client IP condition")
+		return
+	}
+
+	s := r[0].String()
+	if s != `Path("/admin") && ClientIP("10.0.0.0/8", "192.168.1.5") -> "https://admin.example.org"` {
+		t.Error("failed to serialize the client IP condition", s)
+	}
+
+	rj, err := json.Marshal(r[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var rr Route
+	if err := json.Unmarshal(rj, &rr); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !Eq(r[0], &rr) {
+		t.Error("failed to round trip the client IP condition in JSON", string(rj))
+	}
+}
+
+func TestParseLoopbackAndDynamicBackends(t *testing.T) {
+	r, err := Parse(`
+		legacy: Path("/old") -> modPath(".*", "/new") -> <loopback>;
+		def discovered(service) = Path("/api") -> srvBackend($service) -> <dynamic>;
+		api: discovered("_http._tcp.api.service.consul")`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 2 || !r[0].Loopback || r[0].Dynamic || r[0].Shunt || r[0].Backend != "" ||
+		!r[1].Dynamic || r[1].Loopback || r[1].Shunt || r[1].Backend != "" {
+		t.Error("failed to parse the loopback and dynamic backends")
+		return
+	}
+
+	for i, expected := range []string{
+		`Path("/old") -> modPath(".*", "/new") -> <loopback>`,
+		`Path("/api") -> srvBackend("_http._tcp.api.service.consul") -> <dynamic>`,
+	} {
+		if s := r[i].String(); s != expected {
+			t.Error("failed to serialize the backend", s)
+		}
+
+		b, err := json.Marshal(r[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var rr Route
+		if err := json.Unmarshal(b, &rr); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !Eq(r[i], &rr) {
+			t.Error("failed to round trip the backend in JSON", string(b))
+		}
+	}
+
+	for _, s := range []string{
+		`{"id": "r", "loopback": true, "dynamic": true}`,
+		`{"id": "r", "loopback": true, "backend": "https://www.example.org"}`,
+		`{"id": "r", "dynamic": true, "split": [{"weight": 1, "backend": "https://a.example.org"}]}`,
+	} {
+		var r Route
+		if err := json.Unmarshal([]byte(s), &r); err == nil {
+			t.Error("failed to fail", s)
+		}
+	}
+}
+
 func TestParseFiltersEmpty(t *testing.T) {
 	fs, err := ParseFilters(" \t")
 	if err != nil || len(fs) != 0 {
@@ -124,9 +300,95 @@ func TestParseFilters(t *testing.T) {
 	}
 }
 
+func TestParseRawStrings(t *testing.T) {
+	for _, ti := range []struct {
+		msg  string
+		code string
+		arg  string
+	}{{
+		"simple",
+		"f(`foo`)",
+		"foo",
+	}, {
+		"double quotes",
+		"f(`{\"key\": \"value\"}`)",
+		`{"key": "value"}`,
+	}, {
+		"no escaping",
+		"f(`\\d+\\.\\\"`)",
+		`\d+\.\"`,
+	}, {
+		"multiline",
+		"f(`{\n    \"key\": [\n        1, 2\n    ]\n}`)",
+		"{\n    \"key\": [\n        1, 2\n    ]\n}",
+	}, {
+		"multiple raw strings",
+		"f(`a\nb`, `c\nd`)",
+		"a\nb",
+	}} {
+		fs, err := ParseFilters(ti.code)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if len(fs) != 1 || len(fs[0].Args) == 0 || fs[0].Args[0] != ti.arg {
+			t.Error(ti.msg, "failed to parse raw string", fs)
+		}
+	}
+}
+
+func TestParseMultilineRawStringRoute(t *testing.T) {
+	r, err := Parse("route1: Path(\"/foo\") -> f(`line1\nline2`) -> <shunt>;\nroute2: Any() -> g(`x`) -> <shunt>")
+	if err != nil || len(r) != 2 {
+		t.Fatal("failed to parse routes with a multiline raw string", err, len(r))
+	}
+
+	if r[0].Filters[0].Args[0] != "line1\nline2" || r[1].Filters[0].Args[0] != "x" {
+		t.Error("failed to parse multiline raw string")
+	}
+}
+
 func TestParseCommentAsLastToken(t *testing.T) {
 	r, err := Parse("route: Any() -> <shunt>; // some comment")
 	if err != nil || len(r) != 1 {
 		t.Error("failed to parse comment as last token", err, len(r))
 	}
 }
+
+func TestCustomPredicates(t *testing.T) {
+	r, err := Parse(`Path("/foo") && JWTClaim("tenant", "acme") && Header("X-Foo", "bar") && Country("DE") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := r[0].CustomPredicates
+	if len(cp) != 2 ||
+		cp[0].Name != "JWTClaim" || len(cp[0].Args) != 2 || cp[0].Args[1] != "acme" ||
+		cp[1].Name != "Country" || len(cp[1].Args) != 1 || cp[1].Args[0] != "DE" {
+		t.Fatal("failed to parse the custom predicates", cp)
+	}
+
+	if r[0].Path != "/foo" || r[0].Headers["X-Foo"] != "bar" {
+		t.Error("failed to parse the built-in predicates")
+	}
+
+	reparsed, err := Parse(r[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Eq(r[0], reparsed[0]) {
+		t.Error("failed to round trip", r[0].String(), reparsed[0].String())
+	}
+
+	c := r[0].Copy()
+	c.CustomPredicates[1].Args[0] = "AT"
+	if r[0].CustomPredicates[1].Args[0] != "DE" {
+		t.Error("copy shares the predicate arguments")
+	}
+
+	if Eq(r[0], c) {
+		t.Error("failed to compare the custom predicates")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// the state of resolving the imports of a file
+type importState struct {
+
+	// the absolute paths of the files being imported, starting with
+	// the parsed file
+	stack []string
+
+	// the absolute paths of the files already imported
+	imported map[string]bool
+}
+
+// sets the file in the parse errors, or prefixes the other errors with
+// it
+func fileError(path string, err error) error {
+	if perr, ok := err.(*ParseError); ok {
+		if perr.File == "" {
+			perr.File = path
+		}
+
+		return perr
+	}
+
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+// parses the content of a file, and replaces the import directives with
+// the definitions of the imported files
+func parseFile(path, code string, s *importState) ([]*parsedRoute, error) {
+	_, content, err := parseHeader(code)
+	if err != nil {
+		return nil, fileError(path, err)
+	}
+
+	l, err := lexAndParse(content, documentStart)
+	if err != nil {
+		return nil, fileError(path, err)
+	}
+
+	if err := l.resolveSymbols(newSymbols()); err != nil {
+		return nil, fileError(path, err)
+	}
+
+	var routes []*parsedRoute
+	for _, r := range l.routes {
+		if r.importPath == "" {
+			routes = append(routes, r)
+			continue
+		}
+
+		importRoutes, err := importFile(l, r, filepath.Dir(path), s)
+		if err != nil {
+			return nil, fileError(path, err)
+		}
+
+		routes = append(routes, importRoutes...)
+	}
+
+	return routes, nil
+}
+
+// resolves an import directive relative to the directory of the
+// importing file. The errors of reading the imported file, and the
+// import cycles, are reported at the position of the directive.
+func importFile(l *eskipLex, r *parsedRoute, dir string, s *importState) ([]*parsedRoute, error) {
+	fail := func(msg string) error {
+		l.lastToken = r.importPath
+		l.errorAt(r.position, msg)
+		return l.err
+	}
+
+	path := r.importPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fail(err.Error())
+	}
+
+	for i, p := range s.stack {
+		if p == abs {
+			cycle := append(append([]string(nil), s.stack[i:]...), abs)
+			return nil, fail("import cycle: " + strings.Join(cycle, " -> "))
+		}
+	}
+
+	if s.imported[abs] {
+		return nil, nil
+	}
+
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fail(err.Error())
+	}
+
+	s.imported[abs] = true
+	s.stack = append(s.stack, abs)
+	defer func() { s.stack = s.stack[:len(s.stack)-1] }()
+
+	return parseFile(path, string(code), s)
+}
+
+// Parses a routing file, like ParseDocument, and resolves the import
+// directives in it. The import directives can appear in place of the
+// route definitions, in the form of:
+//
+//     import "common.eskip";
+//
+// where include can be used instead of import. The relative paths are
+// resolved from the directory of the importing file. Every file is
+// imported only once, even when it is referenced from multiple files,
+// while the import cycles are reported as errors. The route templates
+// defined in any of the files can be referenced from all of them.
+//
+// The parse errors returned by ParseFile are of type *ParseError, with
+// the File field set to the file containing the error.
+func ParseFile(path string) ([]*Route, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedRoutes, err := parseFile(path, string(code), &importState{
+		stack:    []string{abs},
+		imported: map[string]bool{abs: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	parsedRoutes, err = expandTemplates(parsedRoutes)
+	if err != nil {
+		return nil, fileError(path, err)
+	}
+
+	return newRouteDefinitions(parsedRoutes)
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writes the files to a temporary directory, and returns the directory
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "eskip-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func routeIds(routes []*Route) string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestParseFileImports(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"routes.eskip": `
+			import "teams/checkout.eskip";
+			include "teams/search.eskip";
+			@auth: Header("Authorization", /^Bearer /);
+			catchAll: Any() -> "https://www.example.org"`,
+		"teams/checkout.eskip": `
+			import "../common.eskip";
+			checkout: @auth && Path("/checkout") -> "https://checkout.example.org"`,
+		"common.eskip": `health: Path("/health") -> status(200) -> <shunt>`,
+	})
+	defer os.RemoveAll(dir)
+
+	// imports the common file with an absolute path
+	search := WithHeader(`import "` + filepath.Join(dir, "common.eskip") + `";
+		search: Path("/search") -> "https://search.example.org"`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "teams/search.eskip"), []byte(search), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := ParseFile(filepath.Join(dir, "routes.eskip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := routeIds(routes); ids != "health,checkout,search,catchAll" {
+		t.Error("invalid routes", ids)
+	}
+
+	if routes[1].Headers["Authorization"] != "^Bearer " {
+		t.Error("failed to apply the template from the importing file")
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		files    map[string]string
+		file     string
+		line     int
+		contains string
+	}{{
+		"missing file",
+		map[string]string{"routes.eskip": `route1: Any() -> <shunt>;` + "\n" + `import "missing.eskip"`},
+		"routes.eskip",
+		2,
+		"no such file",
+	}, {
+		"cycle",
+		map[string]string{
+			"routes.eskip": `import "a.eskip"`,
+			"a.eskip":      `import "b.eskip"`,
+			"b.eskip":      "\n" + `import "a.eskip"`,
+		},
+		"b.eskip",
+		2,
+		"import cycle",
+	}, {
+		"self import",
+		map[string]string{"routes.eskip": `import "./routes.eskip"`},
+		"routes.eskip",
+		1,
+		"import cycle",
+	}, {
+		"syntax error in imported file",
+		map[string]string{
+			"routes.eskip":  `import "teams/a.eskip"`,
+			"teams/a.eskip": "route1: Any() -> <shunt>;\n\nroute2: Any() <shunt>",
+		},
+		"teams/a.eskip",
+		3,
+		"syntax error",
+	}} {
+		dir := writeTestFiles(t, ti.files)
+		_, err := ParseFile(filepath.Join(dir, "routes.eskip"))
+		os.RemoveAll(dir)
+
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Error(ti.msg, "failed to return a parse error", err)
+			continue
+		}
+
+		if perr.File != filepath.Join(dir, ti.file) || perr.Line != ti.line {
+			t.Error(ti.msg, "invalid location", perr.File, perr.Line)
+		}
+
+		if !strings.Contains(perr.Message, ti.contains) || !strings.HasPrefix(err.Error(), perr.File+": ") {
+			t.Error(ti.msg, "invalid error", err)
+		}
+	}
+}
+
+func TestParseFileChecksumMismatch(t *testing.T) {
+	dir := writeTestFiles(t, map[string]string{
+		"routes.eskip": `import "other.eskip"`,
+		"other.eskip":  "// eskip-checksum: 0123\nroute1: Any() -> <shunt>",
+	})
+	defer os.RemoveAll(dir)
+
+	if _, err := ParseFile(filepath.Join(dir, "routes.eskip")); err == nil ||
+		!strings.Contains(err.Error(), ErrChecksumMismatch.Error()) {
+		t.Error("failed to verify the checksum of the imported file", err)
+	}
+}
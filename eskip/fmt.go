@@ -0,0 +1,335 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// the definitions longer than this are split into multiple lines,
+	// one filter per line
+	fmtLineLength = 80
+
+	fmtIndent = "    "
+)
+
+// the canonical order of the conditions, the same as in the serialized
+// routes. The unknown conditions follow these, in the order of their
+// names.
+var conditionOrder = map[string]int{
+	"Path":              1,
+	"Host":              2,
+	"PathRegexp":        3,
+	"Method":            4,
+	"Header":            5,
+	"HeaderRegexp":      6,
+	"ClientTLSVersion":  7,
+	"ClientCertificate": 8,
+	"ClientIP":          9,
+	"TrailingSlash":     10,
+	"ValidUntil":        11}
+
+func regexpArg(a interface{}) string {
+	if s, ok := a.(string); ok {
+		return "/" + escape(s, "/") + "/"
+	}
+
+	return argsString([]interface{}{a})
+}
+
+func (m *matcher) String() string {
+	switch {
+	case (m.name == "Host" || m.name == "PathRegexp") && len(m.args) == 1:
+		return fmt.Sprintf("%s(%s)", m.name, regexpArg(m.args[0]))
+	case m.name == "HeaderRegexp" && len(m.args) == 2:
+		return fmt.Sprintf("%s(%s, %s)", m.name, argsString(m.args[:1]), regexpArg(m.args[1]))
+	default:
+		return fmt.Sprintf("%s(%s)", m.name, argsString(m.args))
+	}
+}
+
+type matchersByOrder []*matcher
+
+func (ms matchersByOrder) Len() int      { return len(ms) }
+func (ms matchersByOrder) Swap(i, j int) { ms[i], ms[j] = ms[j], ms[i] }
+
+func (ms matchersByOrder) Less(i, j int) bool {
+	oi, oj := conditionOrder[ms[i].name], conditionOrder[ms[j].name]
+	switch {
+	case oi == 0 && oj == 0 && ms[i].name != ms[j].name:
+		return ms[i].name < ms[j].name
+	case oi == 0 || oj == 0:
+		return oi != 0
+	case oi != oj:
+		return oi < oj
+	default:
+		return ms[i].String() < ms[j].String()
+	}
+}
+
+// formats the conditions with the template references first, in their
+// original order, followed by the sorted matchers, and the predicate
+// expression. Any() is kept only when there are no other conditions.
+func (r *parsedRoute) formatConditions() string {
+	var conds []string
+	for _, t := range r.templates {
+		conds = append(conds, "@"+t)
+	}
+
+	var matchers []*matcher
+	for _, m := range r.matchers {
+		if m.name != "Any" {
+			matchers = append(matchers, m)
+		}
+	}
+
+	sort.Stable(matchersByOrder(matchers))
+	for _, m := range matchers {
+		conds = append(conds, m.String())
+	}
+
+	if r.predicate != nil {
+		precedence := 0
+		if len(conds) > 0 {
+			precedence = operatorPrecedence[PredicateAnd]
+		}
+
+		conds = append(conds, r.predicate.format(precedence))
+	}
+
+	if len(conds) == 0 {
+		conds = append(conds, "Any()")
+	}
+
+	return strings.Join(conds, " && ")
+}
+
+// formats the annotations of a route in their original order, followed
+// by a space
+func (r *parsedRoute) formatAnnotations() string {
+	var s []string
+	for _, a := range r.annotations {
+		s = append(s, fmt.Sprintf("@%s(%s) ", a.name, argsString(a.args)))
+	}
+
+	return strings.Join(s, "")
+}
+
+// formats a definition, in a single line when it fits, otherwise with
+// one filter per line
+func (r *parsedRoute) format() string {
+	switch {
+	case r.importPath != "":
+		return fmt.Sprintf(`import "%s"`, escape(r.importPath, `"`))
+	case r.variable:
+		return fmt.Sprintf("let %s = %s", r.id, argsString([]interface{}{r.value}))
+	case r.call != nil:
+		return fmt.Sprintf("%s%s: %s(%s)", r.formatAnnotations(), r.id, r.call.name, argsString(r.call.args))
+	}
+
+	var head string
+	switch {
+	case r.macro:
+		head = fmt.Sprintf("def %s(%s) = ", r.id, strings.Join(r.params, ", "))
+	case r.template:
+		head = "@" + r.id + ": "
+	case r.id != "":
+		head = r.formatAnnotations() + r.id + ": "
+	}
+
+	parts := []string{r.formatConditions()}
+	for _, f := range r.filters {
+		parts = append(parts, fmt.Sprintf("%s(%s)", f.Name, argsString(f.Args)))
+	}
+
+	switch {
+	case r.template:
+	case r.shunt:
+		parts = append(parts, "<shunt>")
+	case r.loopback:
+		parts = append(parts, "<loopback>")
+	case r.dynamic:
+		parts = append(parts, "<dynamic>")
+	case r.backendRef != nil:
+		parts = append(parts, "$"+r.backendRef.name)
+	case len(r.split) > 0:
+		parts = append(parts, splitString(r.split))
+	default:
+		parts = append(parts, fmt.Sprintf(`"%s"`, escape(r.backend, `"`)))
+	}
+
+	line := head + strings.Join(parts, " -> ")
+	if len(line) <= fmtLineLength || len(parts) == 1 {
+		return line
+	}
+
+	return head + strings.Join(parts, " ->\n"+fmtIndent)
+}
+
+// formats the comments preceding a definition, and the definition
+func formatDefinition(r *parsedRoute) string {
+	var b []string
+	if r.comments != nil {
+		for _, block := range r.comments.detached {
+			b = append(b, commentLines(block)+"\n")
+		}
+
+		b = append(b, commentLines(r.comments.leading), commentLines(r.comments.inner))
+	}
+
+	b = append(b, r.format())
+	if r.id != "" || r.importPath != "" {
+		b = append(b, ";")
+	}
+
+	return strings.Join(b, "")
+}
+
+// validates a document like Parse, but accepting the import directives
+func validateFmt(code string) error {
+	l, err := lexAndParse(code, documentStart)
+	if err != nil {
+		return err
+	}
+
+	if err := l.resolveSymbols(newSymbols()); err != nil {
+		return err
+	}
+
+	var (
+		routes     []*parsedRoute
+		hasImports bool
+	)
+
+	for _, r := range l.routes {
+		switch {
+		case r.importPath != "":
+			hasImports = true
+		case !r.template:
+			routes = append(routes, r)
+		}
+	}
+
+	if !hasImports {
+		if _, err := expandTemplates(l.routes); err != nil {
+			return err
+		}
+	}
+
+	_, err = newRouteDefinitions(routes)
+	return err
+}
+
+// formats the header of a document, recalculating the checksum, when
+// it was set
+func formatHeader(header map[string]string, content string) string {
+	var keys []string
+	for k := range header {
+		if k != versionHeaderKey && k != checksumHeaderKey {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	if _, ok := header[versionHeaderKey]; ok {
+		keys = append([]string{versionHeaderKey}, keys...)
+	}
+
+	if _, ok := header[checksumHeaderKey]; ok {
+		header[checksumHeaderKey] = Checksum(content)
+		keys = append(keys, checksumHeaderKey)
+	}
+
+	var h []string
+	for _, k := range keys {
+		h = appendFmt(h, "%s%s: %s\n", headerPrefix, k, header[k])
+	}
+
+	return strings.Join(h, "")
+}
+
+// Formats a routing document in the canonical format, the same way as
+// gofmt formats Go code, so that the route files can be kept formatted
+// consistently, e.g. checked by pre-commit hooks.
+//
+// The conditions are sorted, with the template references first, the
+// strings are quoted with '"', and the regular expressions of the
+// conditions with '/'. The definitions that don't fit in 80 characters
+// are split to multiple lines, with one filter per line, indented by
+// four spaces. Every named definition is terminated by a semicolon.
+// The definitions spanning multiple lines, or having comments, are
+// separated by an empty line.
+//
+// The comments are kept, but the comments inside the definitions, and
+// following them in the same line, are moved before the definitions.
+// When the document has a header, it is kept, with the checksum updated
+// to the formatted content.
+//
+// The document needs to be valid, otherwise Fmt returns the same error
+// as Parse. The import directives are kept, and formatted as import,
+// while the references to the templates are not checked in the
+// documents containing imports, because the templates may be defined
+// in the imported files.
+func Fmt(doc []byte) ([]byte, error) {
+	header, code := splitHeader(string(doc))
+	if err := validateFmt(code); err != nil {
+		return nil, err
+	}
+
+	l, err := lexAndParse(code, documentStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		defs      []string
+		multiline bool
+	)
+
+	for _, r := range l.routes {
+		d := formatDefinition(r)
+		m := strings.Contains(d, "\n")
+		if len(defs) > 0 && (m || multiline) {
+			defs = append(defs, "")
+		}
+
+		defs = append(defs, d)
+		multiline = m
+	}
+
+	if len(l.trailer) > 0 {
+		if len(defs) > 0 {
+			defs = append(defs, "")
+		}
+
+		for i, block := range l.trailer {
+			if i > 0 {
+				defs = append(defs, "")
+			}
+
+			defs = append(defs, strings.TrimSuffix(commentLines(block), "\n"))
+		}
+	}
+
+	content := ""
+	if len(defs) > 0 {
+		content = strings.Join(defs, "\n") + "\n"
+	}
+
+	return []byte(formatHeader(header, content) + content), nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		doc      string
+		expected string
+	}{{
+		"empty",
+		"",
+		"",
+	}, {
+		"single route",
+		`  Method("GET")&&Path("/")->"https://www.example.org"`,
+		`Path("/") && Method("GET") -> "https://www.example.org"` + "\n",
+	}, {
+		"sorted conditions",
+		`r: Header("X", "b") && Method("GET") && Any() && Custom("a") && Path("/") -> <shunt>`,
+		`r: Path("/") && Method("GET") && Header("X", "b") && Custom("a") -> <shunt>;` + "\n",
+	}, {
+		"normalized quoting",
+		`r: PathRegexp("/a") && HeaderRegexp("X", "[a-z]+") -> setPath(/c/) -> <shunt>`,
+		`r: PathRegexp(/\/a/) && HeaderRegexp("X", /[a-z]+/) -> setPath("c") -> <shunt>;` + "\n",
+	}, {
+		"long route",
+		`route1: Path("/") -> requestHeader("X-Very-Long-Header-Name", "with a very long value") -> "https://www.example.org";
+		route2: Path("/b") -> <shunt>`,
+		`route1: Path("/") ->
+    requestHeader("X-Very-Long-Header-Name", "with a very long value") ->
+    "https://www.example.org";
+
+route2: Path("/b") -> <shunt>;
+`,
+	}, {
+		"variables",
+		`let api="https://api.example.org";route1: Path($path) -> timeout($timeout) -> $api; let path = "/"; let timeout = 2000`,
+		`let api = "https://api.example.org";
+route1: Path($path) -> timeout($timeout) -> $api;
+let path = "/";
+let timeout = 2000;
+`,
+	}, {
+		"macros",
+		`def svc(host,backend)=Host($host)->ratelimit(100)->$backend; api:svc("api[.]example[.]org", "https://api.internal")`,
+		`def svc(host, backend) = Host($host) -> ratelimit(100) -> $backend;
+api: svc("api[.]example[.]org", "https://api.internal");
+`,
+	}, {
+		"imports",
+		`include "common.eskip"; route1: @auth && Path("/") -> "https://www.example.org"`,
+		`import "common.eskip";
+route1: @auth && Path("/") -> "https://www.example.org";
+`,
+	}, {
+		"templates",
+		`route1: Path("/") && @auth -> "https://www.example.org";
+		@auth: Header("Authorization", /^Bearer /)`,
+		`route1: @auth && Path("/") -> "https://www.example.org";
+@auth: Header("Authorization", "^Bearer ");
+`,
+	}, {
+		"comments",
+		`// about the document
+
+		// the first route
+		route1: Path("/a") -> <shunt>; // same line
+		route2: Path("/b") // inner
+			-> <shunt>;
+		route3: Path("/c") -> <shunt>
+
+		// the end`,
+		`// about the document
+
+// the first route
+// same line
+route1: Path("/a") -> <shunt>;
+
+// inner
+route2: Path("/b") -> <shunt>;
+
+route3: Path("/c") -> <shunt>;
+
+// the end
+`,
+	}, {
+		"header",
+		"// eskip-version: 1\n// eskip-checksum: 0000\nroute1:Path(\"/\")-><shunt>",
+		"// eskip-version: 1\n// eskip-checksum: " + Checksum("route1: Path(\"/\") -> <shunt>;\n") + "\n" +
+			"route1: Path(\"/\") -> <shunt>;\n",
+	}} {
+		out, err := Fmt([]byte(ti.doc))
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if string(out) != ti.expected {
+			t.Errorf("%s: invalid format\n%s\nexpected:\n%s", ti.msg, out, ti.expected)
+			continue
+		}
+
+		again, err := Fmt(out)
+		if err != nil || string(again) != string(out) {
+			t.Error(ti.msg, "failed to keep the formatted document", err)
+		}
+
+		if _, err := lexAndParse(string(out), documentStart); err != nil {
+			t.Error(ti.msg, "failed to parse the formatted document", err)
+		}
+	}
+}
+
+func TestFmtKeepsRoutes(t *testing.T) {
+	doc := testTemplates + `route1: @auth && Path("/api") -> modPath("^/api", "") -> "https://api.example.org";
+		route2: Path("/") && @authLogged -> "https://www.example.org"`
+
+	out, err := Fmt([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !EqLists(MustParse(doc), MustParse(string(out))) {
+		t.Error("failed to keep the routes", string(out))
+	}
+}
+
+func TestFmtInvalid(t *testing.T) {
+	for _, doc := range []string{
+		`route1: Path("/") ->`,
+		`route1: Method(42) -> <shunt>`,
+		`route1: @missing -> <shunt>`,
+	} {
+		if _, err := Fmt([]byte(doc)); err == nil {
+			t.Error("failed to fail", doc)
+		}
+	}
+}
+
+func TestFmtLineLength(t *testing.T) {
+	out, err := Fmt([]byte(`route1: Path("/") -> modPath("^/a", "/b") -> "https://www.example.org"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > fmtLineLength {
+			t.Error("line too long", line)
+		}
+	}
+}
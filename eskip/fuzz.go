@@ -0,0 +1,44 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package eskip
+
+// Fuzz target for go-fuzz (https://github.com/dvyukov/go-fuzz):
+//
+//     go-fuzz-build github.com/zalando/skipper/eskip
+//     go-fuzz -bin=./eskip-fuzz.zip -workdir=fuzz
+//
+// Besides that the lexer and the parser must not crash or hang on any
+// input, it verifies that the successfully parsed routes can be
+// serialized and parsed again, and that the filter parser accepts the
+// same input without crashing. For the native fuzzing of the go tool,
+// see FuzzParse.
+func Fuzz(data []byte) int {
+	code := string(data)
+	ParseFilters(code)
+
+	routes, err := Parse(code)
+	if err != nil {
+		return 0
+	}
+
+	if _, err := Parse(String(routes...)); err != nil {
+		panic(err)
+	}
+
+	return 1
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	pathologicalSize    = 1 << 16
+	pathologicalTimeout = 3 * time.Second
+)
+
+// inputs that malformed or hostile route documents can contain. None of
+// them may crash or hang the parser.
+var pathologicalInputs = map[string]string{
+	"deep nesting":          strings.Repeat("(", pathologicalSize),
+	"deep nested args":      "Any() -> f" + strings.Repeat("(", pathologicalSize) + " -> <shunt>",
+	"huge string":           `Path("` + strings.Repeat("a", pathologicalSize) + `") -> <shunt>`,
+	"huge raw string":       "Path(`" + strings.Repeat("a", pathologicalSize) + "`) -> <shunt>",
+	"unterminated string":   `Path("` + strings.Repeat("a", pathologicalSize),
+	"unterminated regexp":   `PathRegexp(/` + strings.Repeat("a", pathologicalSize),
+	"escapes":               `Path("` + strings.Repeat(`\\`, pathologicalSize) + `") -> <shunt>`,
+	"escaped quotes":        `Path("` + strings.Repeat(`\"`, pathologicalSize) + `") -> <shunt>`,
+	"pathological regexp":   `PathRegexp(/` + strings.Repeat("(a*)*", pathologicalSize/5) + `/) -> <shunt>`,
+	"escaped slashes":       `PathRegexp(/` + strings.Repeat(`\/`, pathologicalSize) + `/) -> <shunt>`,
+	"many args":             `Any() -> f(` + strings.Repeat(`1, "a", /b/, `, pathologicalSize/12) + `0) -> <shunt>`,
+	"many conditions":       strings.Repeat(`Header("a", "b") && `, pathologicalSize/20) + `Any() -> <shunt>`,
+	"many filters":          `Any() -> ` + strings.Repeat(`f() -> `, pathologicalSize/7) + `<shunt>`,
+	"many semicolons":       `r: Any() -> <shunt>` + strings.Repeat(";", pathologicalSize),
+	"whitespace":            strings.Repeat(" \t\r\n", pathologicalSize/4),
+	"comments":              strings.Repeat("// comment\n", pathologicalSize/11),
+	"unterminated comment":  "r: Any() -> <shunt>; //" + strings.Repeat("/", pathologicalSize),
+	"numbers":               `Any() -> f(` + strings.Repeat("9", pathologicalSize) + `) -> <shunt>`,
+	"number dots":           `Any() -> f(` + strings.Repeat(".", pathologicalSize) + `) -> <shunt>`,
+	"arrows":                strings.Repeat("->", pathologicalSize),
+	"shunts":                strings.Repeat("<shunt>", pathologicalSize/7),
+	"invalid characters":    strings.Repeat("\x00\xff", pathologicalSize/2),
+	"long symbol":           strings.Repeat("a", pathologicalSize) + `: Any() -> <shunt>`,
+	"empty":                 "",
+	"only arrow":            "->",
+	"only colon":            ":",
+	"missing backend":       "Any() ->",
+	"missing matcher":       "-> <shunt>",
+	"incomplete shunt":      "Any() -> <shunt",
+	"backtick in backticks": "Any() -> f(`a`b`) -> <shunt>",
+}
+
+func parseWithTimeout(code string) (err error, done bool) {
+	c := make(chan error, 1)
+	go func() {
+		_, perr := Parse(code)
+		if _, ferr := ParseFilters(code); perr == nil {
+			perr = ferr
+		}
+
+		c <- perr
+	}()
+
+	select {
+	case err = <-c:
+		return err, true
+	case <-time.After(pathologicalTimeout):
+		return nil, false
+	}
+}
+
+func TestParsePathologicalInputs(t *testing.T) {
+	for name, code := range pathologicalInputs {
+		if _, done := parseWithTimeout(code); !done {
+			t.Error("parser timeout:", name)
+		}
+	}
+}
+
+func TestParseSerializedPathologicalInputs(t *testing.T) {
+	for name, code := range pathologicalInputs {
+		routes, err := Parse(code)
+		if err != nil {
+			continue
+		}
+
+		if _, err := Parse(String(routes...)); err != nil {
+			t.Error("failed to parse serialized routes:", name, err)
+		}
+	}
+}
+
+// Native fuzz target, e.g.:
+//
+//	go test -run FuzzParse -fuzz FuzzParse ./eskip
+//
+// Without -fuzz, only the seeds are checked. The successfully parsed
+// routes must be serialized, parsed again, and serialized to the same
+// document.
+func FuzzParse(f *testing.F) {
+	f.Add(singleRouteExample)
+	f.Add(routingDocumentExample)
+	for _, code := range pathologicalInputs {
+		if len(code) <= 1024 {
+			f.Add(code)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, code string) {
+		ParseFilters(code)
+		routes, err := Parse(code)
+		if err != nil {
+			return
+		}
+
+		serialized := String(routes...)
+		parsed, err := Parse(serialized)
+		if err != nil {
+			t.Fatalf("failed to parse serialized routes: %v\n%s", err, serialized)
+		}
+
+		if again := String(parsed...); again != serialized {
+			t.Fatalf("serialized routes changed after parsing:\n%s\n%s", serialized, again)
+		}
+	})
+}
+
+func benchmarkParse(b *testing.B, code string) {
+	b.SetBytes(int64(len(code)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(code); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDocument(n int) string {
+	routes := make([]string, n)
+	for i := 0; i < n; i++ {
+		routes[i] = fmt.Sprintf(
+			`route%d: Path("/api/%d/:id") && Method("GET") && Header("Accept", "application/json") ->
+			requestHeader("X-Route", "%d") -> modPath(/^\/api/, "") -> "https://backend-%d.example.org"`,
+			i, i, i, i)
+	}
+
+	return strings.Join(routes, ";\n")
+}
+
+func BenchmarkParseSingleRoute(b *testing.B) {
+	benchmarkParse(b, singleRouteExample)
+}
+
+func BenchmarkParseDocument(b *testing.B) {
+	benchmarkParse(b, routingDocumentExample)
+}
+
+func BenchmarkParseDocument100(b *testing.B) {
+	benchmarkParse(b, benchmarkDocument(100))
+}
+
+func BenchmarkParseDocument1000(b *testing.B) {
+	benchmarkParse(b, benchmarkDocument(1000))
+}
+
+func BenchmarkParseHugeString(b *testing.B) {
+	benchmarkParse(b, pathologicalInputs["huge string"])
+}
+
+func BenchmarkParseEscapes(b *testing.B) {
+	benchmarkParse(b, pathologicalInputs["escapes"])
+}
+
+func BenchmarkParsePathologicalRegexp(b *testing.B) {
+	benchmarkParse(b, pathologicalInputs["pathological regexp"])
+}
+
+func BenchmarkParseManyArgs(b *testing.B) {
+	benchmarkParse(b, pathologicalInputs["many args"])
+}
+
+func BenchmarkParseManyFilters(b *testing.B) {
+	benchmarkParse(b, pathologicalInputs["many filters"])
+}
+
+func BenchmarkParseFilters(b *testing.B) {
+	code := `filter1(3.14) -> filter2("key", 42) -> filter3(/^\/api/, "")`
+	b.SetBytes(int64(len(code)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFilters(code); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A Predicate object represents a matching condition of a route, e.g.
+// Path("/foo"), in the structured, JSON or YAML representation of the
+// routes.
+type Predicate struct {
+
+	// name of the predicate, e.g. Path or HeaderRegexp
+	Name string `json:"name" yaml:"name"`
+
+	// predicate arguments, the regular expressions without the
+	// delimiting slashes
+	Args []interface{} `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// the structured representation of a route, used for JSON and YAML
+type structuredRoute struct {
+	Id         string               `json:"id,omitempty" yaml:"id,omitempty"`
+	Predicates []*Predicate         `json:"predicates,omitempty" yaml:"predicates,omitempty"`
+	Expression *PredicateExpression `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Filters    []*Filter            `json:"filters,omitempty" yaml:"filters,omitempty"`
+	Shunt      bool                 `json:"shunt,omitempty" yaml:"shunt,omitempty"`
+	Loopback   bool                 `json:"loopback,omitempty" yaml:"loopback,omitempty"`
+	Dynamic    bool                 `json:"dynamic,omitempty" yaml:"dynamic,omitempty"`
+	Backend    string               `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Split      []*WeightedBackend   `json:"split,omitempty" yaml:"split,omitempty"`
+	Comments   []string             `json:"comments,omitempty" yaml:"comments,omitempty"`
+	Metadata   map[string]string    `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// The serialization formats of the routes.
+type Format int
+
+const (
+
+	// eskip syntax, as returned by String
+	EskipFormat Format = iota
+
+	// JSON array of route objects, as accepted by ParseJSON
+	JSONFormat
+)
+
+var (
+	errMissingBackend   = errors.New("missing backend")
+	errShuntWithBackend = errors.New("shunt route with backend")
+	errSplitWithBackend = errors.New("split route with backend")
+	errInvalidSplit     = errors.New("invalid split backend weights")
+	errMultipleBackends = errors.New("multiple backends")
+)
+
+// the arguments of the filters and the predicates can be strings or
+// numbers. The numbers are converted to float64, as returned by the eskip
+// parser, because the YAML decoders may return integers.
+func normalizeArgs(args []interface{}) error {
+	for i, a := range args {
+		switch v := a.(type) {
+		case string, float64:
+		case int:
+			args[i] = float64(v)
+		case int64:
+			args[i] = float64(v)
+		case uint64:
+			args[i] = float64(v)
+		case float32:
+			args[i] = float64(v)
+		default:
+			return fmt.Errorf("invalid argument: %v", a)
+		}
+	}
+
+	return nil
+}
+
+type plainFilter Filter
+
+// Decodes a filter from JSON, accepting only strings and numbers as
+// arguments.
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*plainFilter)(f)); err != nil {
+		return err
+	}
+
+	return normalizeArgs(f.Args)
+}
+
+// Decodes a filter from YAML, accepting only strings and numbers as
+// arguments. It implements the Unmarshaler interface of the YAML
+// decoders, e.g. gopkg.in/yaml.v2.
+func (f *Filter) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal((*plainFilter)(f)); err != nil {
+		return err
+	}
+
+	return normalizeArgs(f.Args)
+}
+
+type plainPredicate Predicate
+
+// Decodes a predicate from JSON, accepting only strings and numbers as
+// arguments.
+func (p *Predicate) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*plainPredicate)(p)); err != nil {
+		return err
+	}
+
+	return normalizeArgs(p.Args)
+}
+
+// Decodes a predicate from YAML, accepting only strings and numbers as
+// arguments.
+func (p *Predicate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal((*plainPredicate)(p)); err != nil {
+		return err
+	}
+
+	return normalizeArgs(p.Args)
+}
+
+func newPredicate(name string, args ...string) *Predicate {
+	p := &Predicate{Name: name}
+	for _, a := range args {
+		p.Args = append(p.Args, a)
+	}
+
+	return p
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedRegexpKeys(m map[string][]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the matching conditions of the route as predicates, in the
+// same order as in the eskip syntax, with the headers ordered by name. An
+// empty list means that the route matches any request.
+func (r *Route) Predicates() []*Predicate {
+	var p []*Predicate
+
+	if r.Path != "" {
+		p = append(p, newPredicate("Path", r.Path))
+	}
+
+	for _, h := range r.HostRegexps {
+		p = append(p, newPredicate("Host", h))
+	}
+
+	for _, rx := range r.PathRegexps {
+		p = append(p, newPredicate("PathRegexp", rx))
+	}
+
+	if r.Method != "" {
+		p = append(p, newPredicate("Method", r.Method))
+	}
+
+	for _, k := range sortedKeys(r.Headers) {
+		p = append(p, newPredicate("Header", k, r.Headers[k]))
+	}
+
+	for _, k := range sortedRegexpKeys(r.HeaderRegexps) {
+		for _, rx := range r.HeaderRegexps[k] {
+			p = append(p, newPredicate("HeaderRegexp", k, rx))
+		}
+	}
+
+	for _, cp := range r.CustomPredicates {
+		p = append(p, cp.Copy())
+	}
+
+	return p
+}
+
+// returns the arguments of a predicate when they are the expected number
+// of strings
+func predicateStrings(p *Predicate, n int) ([]string, error) {
+	if len(p.Args) != n {
+		return nil, fmt.Errorf("invalid number of arguments for predicate %s: %d, expected: %d", p.Name, len(p.Args), n)
+	}
+
+	s := make([]string, n)
+	for i, a := range p.Args {
+		var ok bool
+		if s[i], ok = a.(string); !ok {
+			return nil, fmt.Errorf("invalid argument for predicate %s: %v", p.Name, a)
+		}
+	}
+
+	return s, nil
+}
+
+// sets the matching conditions of the route from predicates. Like the
+// eskip parser, only the first Path, Method and Header with the same
+// name are used.
+func (r *Route) setPredicates(predicates []*Predicate) error {
+	for _, p := range predicates {
+		n := 1
+		switch p.Name {
+		case "Any":
+			n = 0
+		case "Header", "HeaderRegexp":
+			n = 2
+		case "Path", "Host", "PathRegexp", "Method":
+		default:
+			r.CustomPredicates = append(r.CustomPredicates, p.Copy())
+			continue
+		}
+
+		args, err := predicateStrings(p, n)
+		if err != nil {
+			return err
+		}
+
+		switch p.Name {
+		case "Path":
+			if r.Path == "" {
+				r.Path = args[0]
+			}
+		case "Host":
+			r.HostRegexps = append(r.HostRegexps, args[0])
+		case "PathRegexp":
+			r.PathRegexps = append(r.PathRegexps, args[0])
+		case "Method":
+			if r.Method == "" {
+				r.Method = args[0]
+			}
+		case "Header":
+			if r.Headers == nil {
+				r.Headers = make(map[string]string)
+			}
+
+			if _, exists := r.Headers[args[0]]; !exists {
+				r.Headers[args[0]] = args[1]
+			}
+		case "HeaderRegexp":
+			if r.HeaderRegexps == nil {
+				r.HeaderRegexps = make(map[string][]string)
+			}
+
+			r.HeaderRegexps[args[0]] = append(r.HeaderRegexps[args[0]], args[1])
+		}
+	}
+
+	return nil
+}
+
+func (r *Route) structured() *structuredRoute {
+	return &structuredRoute{
+		Id:         r.Id,
+		Predicates: r.Predicates(),
+		Expression: r.Predicate,
+		Filters:    r.Filters,
+		Shunt:      r.Shunt,
+		Loopback:   r.Loopback,
+		Dynamic:    r.Dynamic,
+		Backend:    r.Backend,
+		Split:      r.SplitBackends,
+		Comments:   r.Comments,
+		Metadata:   r.Metadata}
+}
+
+// returns the number of the backends set in a structured route, where
+// only one is allowed
+func countBackends(s *structuredRoute) int {
+	var n int
+	for _, set := range []bool{s.Shunt, s.Loopback, s.Dynamic, s.Backend != "", len(s.Split) > 0} {
+		if set {
+			n++
+		}
+	}
+
+	return n
+}
+
+// the weights of a split backend need to be non-negative, with at least
+// one of them positive
+func validSplit(backends []*WeightedBackend) bool {
+	var total int
+	for _, b := range backends {
+		if b == nil || b.Weight < 0 {
+			return false
+		}
+
+		total += b.Weight
+	}
+
+	return total > 0
+}
+
+func (r *Route) setStructured(s *structuredRoute) error {
+	switch {
+	case s.Shunt && (s.Backend != "" || len(s.Split) > 0):
+		return errShuntWithBackend
+	case s.Backend != "" && len(s.Split) > 0:
+		return errSplitWithBackend
+	case countBackends(s) > 1:
+		return errMultipleBackends
+	case countBackends(s) == 0:
+		return errMissingBackend
+	case len(s.Split) > 0 && !validSplit(s.Split):
+		return errInvalidSplit
+	}
+
+	*r = Route{
+		Id:            s.Id,
+		Predicate:     s.Expression,
+		Filters:       s.Filters,
+		Shunt:         s.Shunt,
+		Loopback:      s.Loopback,
+		Dynamic:       s.Dynamic,
+		Backend:       s.Backend,
+		SplitBackends: s.Split,
+		Comments:      s.Comments,
+		Metadata:      s.Metadata}
+
+	return r.setPredicates(s.Predicates)
+}
+
+// Encodes the route as a JSON object, with the fields: id, predicates,
+// expression, filters, shunt, loopback, dynamic, backend or split,
+// comments and metadata. The predicates and the filters are objects with
+// a name and the args, and the split backends are objects with a weight
+// and a backend.
+func (r *Route) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.structured())
+}
+
+// Decodes a route from the JSON object returned by MarshalJSON.
+func (r *Route) UnmarshalJSON(data []byte) error {
+	var s structuredRoute
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return r.setStructured(&s)
+}
+
+// Returns the route in the same structure as MarshalJSON. It implements
+// the Marshaler interface of the YAML encoders, e.g. gopkg.in/yaml.v2.
+func (r *Route) MarshalYAML() (interface{}, error) {
+	return r.structured(), nil
+}
+
+// Decodes a route from the structure returned by MarshalYAML. It
+// implements the Unmarshaler interface of the YAML decoders, e.g.
+// gopkg.in/yaml.v2.
+func (r *Route) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s structuredRoute
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return r.setStructured(&s)
+}
+
+// Parses a JSON array of routes, in the format returned by Serialize with
+// JSONFormat.
+func ParseJSON(data []byte) ([]*Route, error) {
+	var routes []*Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+// Serializes the routes in the requested format. With EskipFormat, the
+// result is the same as the one of String, while with JSONFormat, it is
+// an indented JSON array of the routes.
+func Serialize(routes []*Route, f Format) ([]byte, error) {
+	switch f {
+	case EskipFormat:
+		return []byte(String(routes...)), nil
+	case JSONFormat:
+		if routes == nil {
+			routes = []*Route{}
+		}
+
+		return json.MarshalIndent(routes, "", "  ")
+	default:
+		return nil, fmt.Errorf("invalid format: %d", f)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testJSONRoutes = `
+	// the api
+	api: Path("/api") && Host(/^api[.]example[.]org$/) && Method("GET") &&
+		Header("Accept", "application/json") && HeaderRegexp("X-Version", /^v[12]$/) &&
+		ValidUntil("2030-01-01T00:00:00Z")
+		-> modPath("^/api", "") -> deadline(300)
+		-> "https://api.example.org";
+	geo: Path("/shop") && Country("DE", "AT") && Weight(2) -> <shunt>;
+	catchAll: Any() -> <shunt>`
+
+func TestJSONRoundTrip(t *testing.T) {
+	routes, err := Parse(testJSONRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Serialize(routes, JSONFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if String(parsed...) != String(routes...) {
+		t.Error("failed to round trip", String(parsed...), String(routes...))
+	}
+
+	if len(parsed[0].Comments) != 1 || parsed[0].Comments[0] != "the api" {
+		t.Error("failed to keep the comments", parsed[0].Comments)
+	}
+}
+
+func TestMarshalRouteJSON(t *testing.T) {
+	r := &Route{
+		Id:      "route1",
+		Path:    "/foo",
+		Headers: map[string]string{"X-B": "b", "X-A": "a"},
+		Filters: []*Filter{{Name: "deadline", Args: []interface{}{float64(300)}}},
+		Backend: "https://www.example.org"}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"id":"route1","predicates":[` +
+		`{"name":"Path","args":["/foo"]},` +
+		`{"name":"Header","args":["X-A","a"]},` +
+		`{"name":"Header","args":["X-B","b"]}],` +
+		`"filters":[{"name":"deadline","args":[300]}],` +
+		`"backend":"https://www.example.org"}`
+	if string(b) != expected {
+		t.Error("invalid json", string(b))
+	}
+}
+
+func TestUnmarshalRouteJSON(t *testing.T) {
+	var r Route
+	if err := json.Unmarshal([]byte(`{
+		"id": "route1",
+		"predicates": [
+			{"name": "Any"},
+			{"name": "PathRegexp", "args": ["^/foo"]},
+			{"name": "Header", "args": ["Accept", "text/html"]}],
+		"filters": [{"name": "redirect", "args": [302, "https://www.example.org"]}],
+		"shunt": true}`), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Id != "route1" || !r.Shunt ||
+		len(r.PathRegexps) != 1 || r.PathRegexps[0] != "^/foo" ||
+		r.Headers["Accept"] != "text/html" ||
+		len(r.Filters) != 1 || r.Filters[0].Args[0] != float64(302) {
+		t.Error("failed to unmarshal the route", r.String())
+	}
+}
+
+func TestUnmarshalRouteJSONInvalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"id": "route1"}`,
+		`{"id": "route1", "shunt": true, "backend": "https://www.example.org"}`,
+		`{"shunt": true, "predicates": [{"name": "Custom", "args": [true]}]}`,
+		`{"shunt": true, "predicates": [{"name": "Path"}]}`,
+		`{"shunt": true, "predicates": [{"name": "Path", "args": [42]}]}`,
+		`{"shunt": true, "predicates": [{"name": "Any", "args": ["foo"]}]}`,
+		`{"shunt": true, "predicates": [{"name": "Header", "args": ["X-Foo"]}]}`,
+		`{"shunt": true, "filters": [{"name": "foo", "args": [true]}]}`,
+		`{"shunt": true, "filters": [{"name": "foo", "args": [{"bar": "baz"}]}]}`,
+	} {
+		var r Route
+		if err := json.Unmarshal([]byte(doc), &r); err == nil {
+			t.Error("failed to fail", doc)
+		}
+	}
+}
+
+func TestUnmarshalYAMLNormalizesNumbers(t *testing.T) {
+	var f Filter
+	if err := f.UnmarshalYAML(func(v interface{}) error {
+		p := v.(*plainFilter)
+		p.Name, p.Args = "deadline", []interface{}{300}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Args[0] != float64(300) {
+		t.Error("failed to normalize the number", f.Args[0])
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	routes, err := Parse(testJSONRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Serialize(routes, EskipFormat)
+	if err != nil || string(b) != String(routes...) {
+		t.Error("failed to serialize to eskip", err, string(b))
+	}
+
+	if b, err := Serialize(nil, JSONFormat); err != nil || string(b) != "[]" {
+		t.Error("failed to serialize empty routes", err, string(b))
+	}
+
+	if _, err := Serialize(routes, Format(42)); err == nil {
+		t.Error("failed to fail")
+	}
+}
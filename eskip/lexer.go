@@ -15,11 +15,13 @@
 package eskip
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // used for wrapping tokenizer expressions and extending
@@ -31,23 +33,95 @@ type tokenRx struct {
 	matchIndex    int
 }
 
+// the position of the parsed code in the document, the line and the
+// column start from 1
+type position struct {
+	offset, line, column int
+}
+
+var documentStart = position{0, 1, 1}
+
+// ParseError is returned when parsing fails. It tells the location of
+// the error in the document.
+type ParseError struct {
+
+	// The file containing the error, when parsing files with
+	// ParseFile.
+	File string
+
+	// The byte offset of the error in the document.
+	Offset int
+
+	// The line and the column of the error, starting from 1. The
+	// column is counted in characters.
+	Line, Column int
+
+	// The last token read before the error. In case of syntax errors,
+	// this is the unexpected token.
+	Token string
+
+	// The description of the error.
+	Message string
+
+	// The lines of the document preceding and containing the error,
+	// with a marker pointing to the error.
+	Snippet string
+}
+
 // implements the lexer instance
 type eskipLex struct {
-	tokenRxs     []*tokenRx
-	rx           *regexp.Regexp
-	code         string
-	routes       []*parsedRoute
-	filters      []*Filter
-	lastToken    string
-	lastRaw      string
-	lastPosition int
-	err          error
+	tokenRxs      []*tokenRx
+	rx            *regexp.Regexp
+	code          string
+	source        string
+	start         position
+	routes        []*parsedRoute
+	filters       []*Filter
+	lastToken     string
+	lastType      int
+	lastTrailing  string
+	lastRaw       string
+	lastPosition  int
+	tokenPosition int
+	comments      []*definitionComments
+	trailer       [][]string
+	pending       [][]string
+	err           error
 }
 
+// the comments around a route definition, collected by the lexer
+type definitionComments struct {
+
+	// the comment blocks preceding the definition, separated from it
+	// by empty lines
+	detached [][]string
+
+	// the comment block directly preceding the definition
+	leading []string
+
+	// the comments inside the definition, and the one following it in
+	// the same line
+	inner []string
+}
+
+// the token expressions are compiled only once, and shared by the lexer
+// instances
+var lexerTokenRxs, lexerRx = compileTokenRxs()
+
 // creates and initializes a lexer instance
-func newLexer(code string) *eskipLex {
+func newLexer(code string, start position) *eskipLex {
+	return &eskipLex{
+		tokenRxs: lexerTokenRxs,
+		rx:       lexerRx,
+		code:     code,
+		source:   code,
+		start:    start}
+}
+
+// compiles the token expressions into a single expression
+func compileTokenRxs() ([]*tokenRx, *regexp.Regexp) {
 	const (
-		rxFmt                = "^(\\s*|//.*\r?\n|//.*$)*(%s)(\\s*|//.*\r?\n|//.*$)*"
+		rxFmt                = "^(\\s+|//.*\r?\n|//.*$)*(%s)(\\s+|//.*\r?\n|//.*$)*"
 		initialCaptureGroups = 3
 	)
 
@@ -62,6 +136,11 @@ func newLexer(code string) *eskipLex {
 			expression:    "->",
 			captureGroups: 0},
 
+		&tokenRx{
+			token:         closeangle,
+			expression:    ">",
+			captureGroups: 0},
+
 		&tokenRx{
 			token:         closeparen,
 			expression:    "\\)",
@@ -77,6 +156,26 @@ func newLexer(code string) *eskipLex {
 			expression:    ",",
 			captureGroups: 0},
 
+		&tokenRx{
+			token:         dynamic,
+			expression:    "<dynamic>",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         equals,
+			expression:    "=",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         loopback,
+			expression:    "<loopback>",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         not,
+			expression:    "!",
+			captureGroups: 0},
+
 		&tokenRx{
 			token:         number,
 			expression:    "[0-9]*[.]?[0-9]+",
@@ -87,6 +186,16 @@ func newLexer(code string) *eskipLex {
 			expression:    "\\(",
 			captureGroups: 0},
 
+		&tokenRx{
+			token:         opensplit,
+			expression:    "<split",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         or,
+			expression:    "[|][|]",
+			captureGroups: 0},
+
 		&tokenRx{
 			token:         regexpliteral,
 			expression:    "/(\\\\\\\\|\\\\/|[^/])*/",
@@ -109,12 +218,22 @@ func newLexer(code string) *eskipLex {
 
 		&tokenRx{
 			token:         stringliteral,
-			expression:    "`(\\\\\\\\|\\\\`|[^\"])*`",
-			captureGroups: 1},
+			expression:    "`[^`]*`",
+			captureGroups: 0},
 
 		&tokenRx{
 			token:         symbol,
 			expression:    "[a-zA-Z_]\\w*",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         templateref,
+			expression:    "@[a-zA-Z_]\\w*",
+			captureGroups: 0},
+
+		&tokenRx{
+			token:         variableref,
+			expression:    "[$][a-zA-Z_]\\w*",
 			captureGroups: 0}}
 
 	// mapping between the token expressions and the related capture groups
@@ -131,7 +250,7 @@ func newLexer(code string) *eskipLex {
 	// let it panic, expression not coming from external source
 	rx := regexp.MustCompile(fmt.Sprintf(rxFmt, strings.Join(tokenRxss, "|")))
 
-	return &eskipLex{tokenRxs: tokenRxs, rx: rx, code: code}
+	return tokenRxs, rx
 }
 
 // unescape tokens
@@ -157,13 +276,14 @@ func unescape(s string, chars string) string {
 	return strings.Join(r, "")
 }
 
-// conversion error ignored, tokenizer expression already checked format
+// conversion error ignored, the lexer already checked the number
 func convertNumber(s string) float64 {
 	n, _ := strconv.ParseFloat(s, 64)
 	return n
 }
 
-// unescaping only '"' and '\'
+// unescaping only '"' and '\', the raw strings between backticks are
+// taken as they are
 func convertString(s string) string {
 	if s[0:1] == "`" {
 		return s[1 : len(s)-1]
@@ -177,17 +297,26 @@ func convertRegexp(s string) string {
 	return unescape(s[1:len(s)-1], "/")
 }
 
-// match a token at the current position
-func (l *eskipLex) matchToken() []string {
-	m := l.rx.FindStringSubmatch(l.code)
-	if len(m) == 0 {
+// match a token at the current position. It returns the submatches,
+// and the whitespace and the comments matched after the token.
+func (l *eskipLex) matchToken() ([]string, string) {
+	mi := l.rx.FindStringSubmatchIndex(l.code)
+	if len(mi) == 0 {
 		l.lastRaw = ""
-		return m
+		return nil, ""
 	}
 
+	m := make([]string, len(mi)/2)
+	for i := range m {
+		if mi[2*i] >= 0 {
+			m[i] = l.code[mi[2*i]:mi[2*i+1]]
+		}
+	}
+
+	// the token is the second capture group
 	l.lastRaw = m[0]
 	l.code = l.code[len(m[0]):]
-	return m
+	return m, m[0][mi[5]:]
 }
 
 // get the matched token based on the matched capture group
@@ -206,12 +335,19 @@ func (l *eskipLex) getToken(m []string) (int, string) {
 func (l *eskipLex) Lex(lval *eskipSymType) int {
 	// done
 	if len(l.code) == 0 {
+		if l.lastType != 0 {
+			l.collectComments(-1, l.lastTrailing)
+			l.lastType = 0
+		}
+
 		return -1
 	}
 
 	// step position
 	l.lastPosition += len(l.lastRaw)
-	m := l.matchToken()
+	space := l.code[:leadingSpace(l.code)]
+	l.tokenPosition = l.lastPosition + len(space)
+	m, trailing := l.matchToken()
 
 	// no match, error, done
 	if len(m) == 0 {
@@ -221,14 +357,267 @@ func (l *eskipLex) Lex(lval *eskipSymType) int {
 
 	t, s := l.getToken(m)
 	lval.token = s
+	lval.position = l.tokenPosition
 	l.lastToken = s
 
+	if l.lastType == 0 {
+		l.collectComments(t, space)
+	} else {
+		l.collectComments(t, l.lastTrailing)
+	}
+
+	l.lastType = t
+	l.lastTrailing = trailing
+
+	// numbers that cannot be represented, e.g. overflowing ones, would
+	// result in route definitions that cannot be serialized
+	if t == number {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			l.Error("invalid number")
+			return -1
+		}
+	}
+
 	return t
 }
 
-// error with approximate position
+// returns the length of the whitespace and the comments at the start
+// of the code
+func leadingSpace(code string) int {
+	n := 0
+	for n < len(code) {
+		switch {
+		case unicode.IsSpace(rune(code[n])):
+			n++
+		case strings.HasPrefix(code[n:], "//"):
+			if nl := strings.Index(code[n:], "\n"); nl >= 0 {
+				n += nl + 1
+			} else {
+				n = len(code)
+			}
+		default:
+			return n
+		}
+	}
+
+	return n
+}
+
+// returns the text of a comment line, without the leading '//' and the
+// first space, and false, if the line is not a comment
+func commentText(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "//") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(line[2:], " "), true
+}
+
+// splits the whitespace and the comments between two tokens. It returns
+// the comment continuing the line of the previous token, when afterCode
+// is true, the blocks of comment lines separated by empty lines, and
+// whether the last block directly precedes the next token. The document
+// header lines are not included.
+func commentBlocks(space string, afterCode bool) (sameLine []string, blocks [][]string, attached bool) {
+	lines := strings.Split(space, "\n")
+	if afterCode {
+		if c, ok := commentText(lines[0]); ok {
+			sameLine = []string{c}
+		}
+
+		lines = lines[1:]
+	}
+
+	var block []string
+	for i, line := range lines {
+		c, ok := commentText(line)
+
+		// the last line is the indentation of the next token
+		if i == len(lines)-1 {
+			attached = !ok && len(block) > 0
+		}
+
+		switch {
+		case ok && strings.HasPrefix(strings.TrimSpace(line), headerPrefix):
+		case ok:
+			block = append(block, c)
+		case len(block) > 0:
+			blocks = append(blocks, block)
+			block = nil
+		}
+	}
+
+	// comment at the end of the document
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	return
+}
+
+func (l *eskipLex) addInnerComments(c []string) {
+	if len(l.comments) > 0 {
+		last := l.comments[len(l.comments)-1]
+		last.inner = append(last.inner, c...)
+	}
+}
+
+// collects the comments in the space preceding a token, or preceding
+// the end of the document, when t is negative.
+func (l *eskipLex) collectComments(t int, space string) {
+	if l.lastType != 0 && l.lastType != semicolon {
+		// inside a definition, or at the end of the last one
+		sameLine, blocks, _ := commentBlocks(space, true)
+		l.addInnerComments(sameLine)
+		if t < 0 {
+			l.trailer = blocks
+			return
+		}
+
+		for _, b := range blocks {
+			l.addInnerComments(b)
+		}
+
+		return
+	}
+
+	sameLine, blocks, attached := commentBlocks(space, l.lastType != 0 || l.start.column > 1)
+	l.addInnerComments(sameLine)
+	blocks = append(l.pending, blocks...)
+	switch {
+	case t < 0:
+		l.trailer = blocks
+	case t == semicolon:
+		// empty definition
+		l.pending = blocks
+	default:
+		c := &definitionComments{detached: blocks}
+		if attached {
+			c.detached, c.leading = blocks[:len(blocks)-1], blocks[len(blocks)-1]
+		}
+
+		l.comments = append(l.comments, c)
+		l.pending = nil
+	}
+}
+
+// renders the line of the error, and the line preceding it, with a
+// marker under the error
+func renderSnippet(source string, pos int, line int, firstColumn int) string {
+	lines := strings.Split(source, "\n")
+	index := strings.Count(source[:pos], "\n")
+	lineStart := strings.LastIndex(source[:pos], "\n") + 1
+
+	// the first line of a streamed definition may start in the middle
+	// of the line in the document
+	indent := func(i int) string {
+		if i == 0 {
+			return strings.Repeat(" ", firstColumn-1)
+		}
+
+		return ""
+	}
+
+	width := len(strconv.Itoa(line))
+	var b bytes.Buffer
+	for i := index - 1; i <= index; i++ {
+		if i < 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "%*d | %s%s\n", width, line-index+i, indent(i), strings.TrimRight(lines[i], "\r"))
+	}
+
+	marker := []rune(source[lineStart:pos])
+	for i, r := range marker {
+		if r != '\t' {
+			marker[i] = ' '
+		}
+	}
+
+	fmt.Fprintf(&b, "%*s | %s%s^", width, "", indent(index), string(marker))
+	return b.String()
+}
+
+// sets the error at a position of the parsed code
+func (l *eskipLex) errorAt(pos int, msg string) {
+	if pos > len(l.source) {
+		pos = len(l.source)
+	}
+
+	prefix := l.source[:pos]
+	lines := strings.Count(prefix, "\n")
+	column := utf8.RuneCountInString(prefix[strings.LastIndex(prefix, "\n")+1:]) + 1
+	if lines == 0 {
+		column += l.start.column - 1
+	}
+
+	line := l.start.line + lines
+	l.err = &ParseError{
+		Offset:  l.start.offset + pos,
+		Line:    line,
+		Column:  column,
+		Token:   l.lastToken,
+		Message: msg,
+		Snippet: renderSnippet(l.source, pos, line, l.start.column)}
+}
+
+// sets the error at the position of the last token. Only the first error
+// is kept.
 func (l *eskipLex) Error(err string) {
-	l.err = errors.New(fmt.Sprintf(
-		"parse failed after token %s, position %d: %s",
-		l.lastToken, l.lastPosition, err))
+	if l.err != nil {
+		return
+	}
+
+	l.errorAt(l.tokenPosition, err)
+}
+
+// sets the error at the position of an unknown directive keyword, e.g.
+// when a route definition looks like an import, but it starts with a
+// different word
+func (l *eskipLex) invalidDirective(name string, pos int) {
+	if l.err != nil {
+		return
+	}
+
+	l.lastToken = name
+	l.errorAt(pos, "invalid directive: "+name)
+}
+
+func (l *eskipLex) nestedTemplate(name string, pos int) {
+	if l.err != nil {
+		return
+	}
+
+	l.lastToken = "@" + name
+	l.errorAt(pos, "templates can be referenced only in the top level conjunction: "+name)
+}
+
+// sets the error at the position of a predicate receiving other
+// predicates as arguments, when it is not the Not predicate, or of the
+// Not predicate receiving other arguments
+func (l *eskipLex) invalidNegation(name string, pos int) {
+	if l.err != nil {
+		return
+	}
+
+	l.lastToken = name
+	if name == notPredicate {
+		l.errorAt(pos, "the Not predicate accepts a single predicate expression")
+		return
+	}
+
+	l.errorAt(pos, "only the Not predicate accepts predicates as arguments: "+name)
+}
+
+func (err *ParseError) Error() string {
+	msg := fmt.Sprintf(
+		"parse failed after token %s, position %d, line %d, column %d: %s",
+		err.Token, err.Offset, err.Line, err.Column, err.Message)
+	if err.File != "" {
+		msg = err.File + ": " + msg
+	}
+
+	return msg
 }
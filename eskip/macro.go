@@ -0,0 +1,160 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "fmt"
+
+// returns the variable references in the arguments
+func argRefs(args []interface{}) []*variableRef {
+	var refs []*variableRef
+	for _, a := range args {
+		if ref, ok := a.(*variableRef); ok {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+// returns the variable references in the body of a macro
+func macroRefs(m *parsedRoute) []*variableRef {
+	var refs []*variableRef
+	for _, mi := range m.allMatchers() {
+		refs = append(refs, argRefs(mi.args)...)
+	}
+
+	for _, f := range m.filters {
+		refs = append(refs, argRefs(f.Args)...)
+	}
+
+	refs = append(refs, argRefs(m.split)...)
+	if m.backendRef != nil {
+		refs = append(refs, m.backendRef)
+	}
+
+	return refs
+}
+
+// checks that the parameters of a macro are unique, and that its body
+// references only its parameters and the defined variables
+func (l *eskipLex) checkMacro(m *parsedRoute, s *symbols) error {
+	params := make(map[string]bool)
+	for _, p := range m.params {
+		if params[p] {
+			l.lastToken = m.id
+			l.errorAt(m.position, fmt.Sprintf("duplicate parameter of macro %s: %s", m.id, p))
+			return l.err
+		}
+
+		params[p] = true
+	}
+
+	for _, ref := range macroRefs(m) {
+		if params[ref.name] {
+			continue
+		}
+
+		if _, err := l.variableValue(ref, s.variables); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copies the body of a macro, keeping the variable references
+func copyMacroBody(m *parsedRoute) *parsedRoute {
+	c := &parsedRoute{
+		templates:  append([]string(nil), m.templates...),
+		shunt:      m.shunt,
+		loopback:   m.loopback,
+		dynamic:    m.dynamic,
+		backend:    m.backend,
+		backendRef: m.backendRef,
+		split:      append([]interface{}(nil), m.split...),
+		predicate:  m.predicate.copy()}
+
+	for _, mi := range m.matchers {
+		c.matchers = append(c.matchers, &matcher{mi.name, append([]interface{}(nil), mi.args...)})
+	}
+
+	for _, f := range m.filters {
+		c.filters = append(c.filters, &Filter{Name: f.Name, Args: append([]interface{}(nil), f.Args...)})
+	}
+
+	return c
+}
+
+// expands the macro invoked by a route, substituting the parameters of
+// the macro with the arguments of the invocation. The arguments can
+// reference variables, too. The errors of the expansion are reported at
+// the position of the invocation.
+func (l *eskipLex) expandMacro(r *parsedRoute, s *symbols) (*parsedRoute, error) {
+	fail := func(msg string) (*parsedRoute, error) {
+		l.lastToken = r.call.name
+		l.errorAt(r.position, msg)
+		return nil, l.err
+	}
+
+	m, ok := s.macros[r.call.name]
+	if !ok {
+		return fail("undefined macro: " + r.call.name)
+	}
+
+	if len(r.call.args) != len(m.params) {
+		return fail(fmt.Sprintf(
+			"invalid number of arguments for macro %s: %d, expected: %d",
+			m.id, len(r.call.args), len(m.params)))
+	}
+
+	if err := l.substituteArgs(r.call.args, s.variables); err != nil {
+		return nil, err
+	}
+
+	scope := make(map[string]interface{})
+	for k, v := range s.variables {
+		scope[k] = v
+	}
+
+	for i, p := range m.params {
+		scope[p] = r.call.args[i]
+	}
+
+	// the annotations of the route can reference only the variables
+	for _, a := range r.annotations {
+		if err := l.substituteArgs(a.args, s.variables); err != nil {
+			return nil, err
+		}
+	}
+
+	e := copyMacroBody(m)
+	e.id = r.id
+	e.comments = r.comments
+	e.annotations = r.annotations
+
+	// the body was checked with the lexer of the macro, so the only
+	// possible error here is an invalid backend argument
+	if b := e.backendRef; b != nil {
+		if _, isString := scope[b.name].(string); !isString {
+			return fail(fmt.Sprintf("macro %s: backend argument is not a string: %s", m.id, b.name))
+		}
+	}
+
+	if err := l.substituteVariables(e, scope); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMacros = `
+	let limit = 100;
+	def standardService(host, backend) = Host($host) -> ratelimit($limit) -> $backend;
+	def internal() = @auth && Path("/internal") -> <shunt>;
+	@auth: Header("Authorization", /^Bearer /);
+
+	// the API
+	api: standardService("^api[.]example[.]org$", "https://api.internal");
+	shop: standardService($shopHost, "https://shop.internal");
+	internal: internal();
+	let shopHost = "^shop[.]example[.]org$"`
+
+func TestParseMacros(t *testing.T) {
+	r, err := Parse(testMacros)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := Parse(`
+		// the API
+		api: Host("^api[.]example[.]org$") -> ratelimit(100) -> "https://api.internal";
+		shop: Host("^shop[.]example[.]org$") -> ratelimit(100) -> "https://shop.internal";
+		internal: Header("Authorization", /^Bearer /) && Path("/internal") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != len(expected) {
+		t.Fatal("invalid number of routes", len(r))
+	}
+
+	for i := range r {
+		if r[i].String() != expected[i].String() || r[i].Id != expected[i].Id {
+			t.Error("invalid expansion", r[i], expected[i])
+		}
+	}
+
+	if len(r[0].Comments) != 1 || r[0].Comments[0] != "the API" {
+		t.Error("failed to keep the comments", r[0].Comments)
+	}
+}
+
+func TestParseMacroExpandsCopies(t *testing.T) {
+	r, err := Parse(`
+		def svc(b) = Path("/") -> setPath("/") -> $b;
+		a: svc("https://a.example.org");
+		b: svc("https://b.example.org")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r[0].Filters[0].Args[0] = "/changed"
+	if r[0].Backend != "https://a.example.org" || r[1].Backend != "https://b.example.org" ||
+		r[1].Filters[0].Args[0] != "/" {
+		t.Error("failed to expand independent copies", r[0], r[1])
+	}
+}
+
+func TestParseMacroErrors(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		code    string
+		line    int
+		column  int
+		message string
+	}{{
+		"undefined macro",
+		"route1: svc(\"a\")",
+		1, 9, "undefined macro: svc",
+	}, {
+		"invalid number of arguments",
+		"def svc(a) = Path($a) -> <shunt>;\nroute1: svc(\"a\", \"b\")",
+		2, 9, "invalid number of arguments for macro svc: 2, expected: 1",
+	}, {
+		"undefined variable in the body",
+		"def svc(a) = Path($b) -> <shunt>",
+		1, 19, "undefined variable: b",
+	}, {
+		"duplicate macro",
+		"def svc() = Any() -> <shunt>;\ndef svc() = Any() -> <shunt>",
+		2, 5, "duplicate macro: svc",
+	}, {
+		"duplicate parameter",
+		"def svc(a, a) = Path($a) -> <shunt>",
+		1, 5, "duplicate parameter of macro svc: a",
+	}, {
+		"backend argument not a string",
+		"def svc(b) = Any() -> $b;\nroute1: svc(42)",
+		2, 9, "macro svc: backend argument is not a string: b",
+	}, {
+		"invalid directive",
+		"macro svc() = Any() -> <shunt>",
+		1, 1, "invalid directive: macro",
+	}} {
+		_, err := Parse(ti.code)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Error(ti.msg, "failed to return a parse error", err)
+			continue
+		}
+
+		if perr.Line != ti.line || perr.Column != ti.column || perr.Message != ti.message {
+			t.Error(ti.msg, "invalid error", perr.Line, perr.Column, perr.Message)
+		}
+	}
+}
+
+func TestParseReaderMacros(t *testing.T) {
+	s := ParseReader(strings.NewReader(`
+		def svc(b) = Path("/") -> $b;
+		route1: svc("https://www.example.org")`))
+
+	r, err := s.Next()
+	if err != nil || r.Backend != "https://www.example.org" || r.Path != "/" {
+		t.Error("failed to expand the macro", r, err)
+	}
+}
@@ -19,16 +19,24 @@ package eskip
 
 %union {
 	token string
+	position int
 	route *parsedRoute
 	routes []*parsedRoute
 	matchers []*matcher
+	annotations []*matcher
+	templates []string
+	params []string
 	matcher *matcher
+	predicate *predicateNode
 	filter *Filter
 	filters []*Filter
 	args []interface{}
 	arg interface{}
+	ref *variableRef
 	backend string
 	shunt bool
+	loopback bool
+	dynamic bool
 	numval float64
 	stringval string
 	regexpval string
@@ -36,16 +44,25 @@ package eskip
 
 %token and
 %token arrow
+%token closeangle
 %token closeparen
 %token colon
 %token comma
+%token dynamic
+%token equals
+%token loopback
+%token not
 %token number
 %token openparen
+%token opensplit
+%token or
 %token regexpliteral
 %token semicolon
 %token shunt
 %token stringliteral
 %token symbol
+%token templateref
+%token variableref
 
 %%
 
@@ -66,11 +83,47 @@ routes:
 		$$.routes = []*parsedRoute{$1.route}
 	}
 	|
+	templatedef {
+		$$.routes = []*parsedRoute{$1.route}
+	}
+	|
+	importdef {
+		$$.routes = []*parsedRoute{$1.route}
+	}
+	|
+	letdef {
+		$$.routes = []*parsedRoute{$1.route}
+	}
+	|
+	macrodef {
+		$$.routes = []*parsedRoute{$1.route}
+	}
+	|
 	routes semicolon routedef {
 		$$.routes = $1.routes
 		$$.routes = append($$.routes, $3.route)
 	}
 	|
+	routes semicolon templatedef {
+		$$.routes = $1.routes
+		$$.routes = append($$.routes, $3.route)
+	}
+	|
+	routes semicolon importdef {
+		$$.routes = $1.routes
+		$$.routes = append($$.routes, $3.route)
+	}
+	|
+	routes semicolon letdef {
+		$$.routes = $1.routes
+		$$.routes = append($$.routes, $3.route)
+	}
+	|
+	routes semicolon macrodef {
+		$$.routes = $1.routes
+		$$.routes = append($$.routes, $3.route)
+	}
+	|
 	routes semicolon {
 		$$.routes = $1.routes
 	}
@@ -80,42 +133,240 @@ routedef:
 		$$.route = $3.route
 		$$.route.id = $1.token
 	}
+	|
+	routeid colon macrocall {
+		$$.route = $3.route
+		$$.route.id = $1.token
+	}
+	|
+	annotations routeid colon route {
+		$$.route = $4.route
+		$$.route.id = $2.token
+		$$.route.annotations = $1.annotations
+		$1.annotations = nil
+	}
+	|
+	annotations routeid colon macrocall {
+		$$.route = $4.route
+		$$.route.id = $2.token
+		$$.route.annotations = $1.annotations
+		$1.annotations = nil
+	}
+
+annotations:
+	annotation {
+		$$.annotations = []*matcher{$1.matcher}
+	}
+	|
+	annotations annotation {
+		$$.annotations = $1.annotations
+		$$.annotations = append($$.annotations, $2.matcher)
+	}
+
+annotation:
+	templateref openparen args closeparen {
+		$$.matcher = &matcher{$1.token[1:], $3.args}
+		$3.args = nil
+	}
+
+macrocall:
+	symbol openparen args closeparen {
+		$$.route = &parsedRoute{
+			call: &matcher{$1.token, $3.args},
+			position: $1.position}
+		$3.args = nil
+	}
 
 routeid:
 	symbol {
 		$$.token = $1.token
 	}
 
+templatedef:
+	templatename colon frontend {
+		$$.route = &parsedRoute{
+			id: $1.token,
+			template: true,
+			matchers: $3.matchers,
+			templates: $3.templates,
+			predicate: $3.predicate}
+		$3.matchers = nil
+		$3.templates = nil
+		$3.predicate = nil
+	}
+	|
+	templatename colon frontend arrow filters {
+		$$.route = &parsedRoute{
+			id: $1.token,
+			template: true,
+			matchers: $3.matchers,
+			templates: $3.templates,
+			predicate: $3.predicate,
+			filters: $5.filters}
+		$3.matchers = nil
+		$3.templates = nil
+		$3.predicate = nil
+		$5.filters = nil
+	}
+
+importdef:
+	symbol stringliteral {
+		if $1.token != "import" && $1.token != "include" {
+			eskiplex.(*eskipLex).invalidDirective($1.token, $1.position)
+		}
+
+		$$.route = &parsedRoute{
+			importPath: convertString($2.token),
+			position: $2.position}
+	}
+
+letdef:
+	symbol symbol equals literal {
+		if $1.token != "let" {
+			eskiplex.(*eskipLex).invalidDirective($1.token, $1.position)
+		}
+
+		$$.route = &parsedRoute{
+			id: $2.token,
+			variable: true,
+			value: $4.arg,
+			position: $2.position}
+	}
+
+macrodef:
+	symbol symbol openparen params closeparen equals route {
+		if $1.token != "def" {
+			eskiplex.(*eskipLex).invalidDirective($1.token, $1.position)
+		}
+
+		$$.route = $7.route
+		$$.route.id = $2.token
+		$$.route.macro = true
+		$$.route.params = $4.params
+		$$.route.position = $2.position
+		$4.params = nil
+	}
+
+params:
+	{
+		$$.params = nil
+	}
+	|
+	symbol {
+		$$.params = []string{$1.token}
+	}
+	|
+	params comma symbol {
+		$$.params = $1.params
+		$$.params = append($$.params, $3.token)
+	}
+
+templatename:
+	templateref {
+		$$.token = $1.token[1:]
+		$$.position = $1.position
+	}
+
 route:
 	frontend arrow backend {
 		$$.route = &parsedRoute{
 			matchers: $1.matchers,
+			templates: $1.templates,
+			predicate: $1.predicate,
 			backend: $3.backend,
-			shunt: $3.shunt}
+			backendRef: $3.ref,
+			shunt: $3.shunt,
+			loopback: $3.loopback,
+			dynamic: $3.dynamic,
+			split: $3.args}
+		$1.matchers = nil
+		$1.templates = nil
+		$1.predicate = nil
 	}
 	|
 	frontend arrow filters arrow backend {
 		$$.route = &parsedRoute{
 			matchers: $1.matchers,
+			templates: $1.templates,
+			predicate: $1.predicate,
 			filters: $3.filters,
 			backend: $5.backend,
-			shunt: $5.shunt}
+			backendRef: $5.ref,
+			shunt: $5.shunt,
+			loopback: $5.loopback,
+			dynamic: $5.dynamic,
+			split: $5.args}
 		$1.matchers = nil
+		$1.templates = nil
+		$1.predicate = nil
 		$3.filters = nil
 	}
 
 frontend:
+	orexpr {
+		var nested *predicateNode
+		$$.matchers, $$.templates, $$.predicate, nested = splitFrontend($1.predicate)
+		if nested != nil {
+			eskiplex.(*eskipLex).nestedTemplate(nested.template, nested.position)
+		}
+	}
+
+orexpr:
+	andexpr {
+		$$.predicate = $1.predicate
+	}
+	|
+	orexpr or andexpr {
+		$$.predicate = newPredicateNode(PredicateOr, $1.predicate, $3.predicate)
+	}
+
+andexpr:
+	unaryexpr {
+		$$.predicate = $1.predicate
+	}
+	|
+	andexpr and unaryexpr {
+		$$.predicate = newPredicateNode(PredicateAnd, $1.predicate, $3.predicate)
+	}
+
+unaryexpr:
 	matcher {
-		$$.matchers = []*matcher{$1.matcher}
+		$$.predicate = &predicateNode{op: PredicateMatch, matcher: $1.matcher}
 	}
 	|
-	frontend and matcher {
-		$$.matchers = $1.matchers
-		$$.matchers = append($$.matchers, $3.matcher)
+	templatename {
+		$$.predicate = &predicateNode{
+			op: PredicateMatch,
+			template: $1.token,
+			position: $1.position}
+	}
+	|
+	not unaryexpr {
+		$$.predicate = &predicateNode{
+			op: PredicateNot,
+			operands: []*predicateNode{$2.predicate}}
+	}
+	|
+	symbol openparen orexpr closeparen {
+		if $1.token != notPredicate {
+			eskiplex.(*eskipLex).invalidNegation($1.token, $1.position)
+		}
+
+		$$.predicate = &predicateNode{
+			op: PredicateNot,
+			operands: []*predicateNode{$3.predicate}}
+	}
+	|
+	openparen orexpr closeparen {
+		$$.predicate = $2.predicate
 	}
 
 matcher:
 	symbol openparen args closeparen {
+		if $1.token == notPredicate {
+			eskiplex.(*eskipLex).invalidNegation($1.token, $1.position)
+		}
+
         $$.matcher = &matcher{$1.token, $3.args}
 		$3.args = nil
 	}
@@ -150,6 +401,17 @@ args:
 	}
 
 arg:
+	literal {
+		$$.arg = $1.arg
+	}
+	|
+	variableref {
+		$$.arg = &variableRef{
+			name: $1.token[1:],
+			position: $1.position}
+	}
+
+literal:
 	numval {
 		$$.arg = $1.numval
 	}
@@ -165,11 +427,68 @@ arg:
 backend:
 	stringval {
 		$$.backend = $1.stringval
+		$$.ref = nil
+		$$.shunt = false
+		$$.loopback = false
+		$$.dynamic = false
+		$$.args = nil
+	}
+	|
+	variableref {
+		$$.ref = &variableRef{
+			name: $1.token[1:],
+			position: $1.position}
 		$$.shunt = false
+		$$.loopback = false
+		$$.dynamic = false
+		$$.args = nil
 	}
 	|
 	shunt {
+		$$.backend = ""
+		$$.ref = nil
 		$$.shunt = true
+		$$.loopback = false
+		$$.dynamic = false
+		$$.args = nil
+	}
+	|
+	loopback {
+		$$.backend = ""
+		$$.ref = nil
+		$$.shunt = false
+		$$.loopback = true
+		$$.dynamic = false
+		$$.args = nil
+	}
+	|
+	dynamic {
+		$$.backend = ""
+		$$.ref = nil
+		$$.shunt = false
+		$$.loopback = false
+		$$.dynamic = true
+		$$.args = nil
+	}
+	|
+	opensplit splitbackends closeangle {
+		$$.backend = ""
+		$$.ref = nil
+		$$.shunt = false
+		$$.loopback = false
+		$$.dynamic = false
+		$$.args = $2.args
+		$2.args = nil
+	}
+
+splitbackends:
+	arg arg {
+		$$.args = []interface{}{$1.arg, $2.arg}
+	}
+	|
+	splitbackends comma arg arg {
+		$$.args = $1.args
+		$$.args = append($$.args, $3.arg, $4.arg)
 	}
 
 numval:
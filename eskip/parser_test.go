@@ -15,6 +15,8 @@
 package eskip
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -160,3 +162,136 @@ func TestParseDocument(t *testing.T) {
 		t.Error("failed to parse route definition ids")
 	}
 }
+
+func TestParseNumberOutOfRange(t *testing.T) {
+	_, err := Parse(`Any() -> f(1` + strings.Repeat("0", 400) + `) -> <shunt>`)
+	if err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		code    string
+		offset  int
+		line    int
+		column  int
+		token   string
+		message string
+		snippet string
+	}{{
+		"syntax error",
+		"route1: Path(\"/\") -> <shunt>;\nroute2: Path(\"/\") <shunt>",
+		48, 2, 19, "<shunt>", "syntax error",
+		"1 | route1: Path(\"/\") -> <shunt>;\n2 | route2: Path(\"/\") <shunt>\n  |                   ^",
+	}, {
+		"invalid token",
+		"// comment\n\troute1: Path(\"ü\") -> #",
+		34, 2, 23, "->", "invalid token",
+		"1 | // comment\n2 | \troute1: Path(\"ü\") -> #\n  | \t                     ^",
+	}, {
+		"first token",
+		"  # -> <shunt>",
+		2, 1, 3, "", "invalid token",
+		"1 |   # -> <shunt>\n  |   ^",
+	}, {
+		"import without file",
+		"route1: Path(\"/\") -> <shunt>;\nimport \"other.eskip\"",
+		37, 2, 8, "other.eskip", "import directives are supported only in files",
+		"1 | route1: Path(\"/\") -> <shunt>;\n2 | import \"other.eskip\"\n  |        ^",
+	}, {
+		"invalid directive",
+		"export \"other.eskip\"",
+		0, 1, 1, "export", "invalid directive: export",
+		"1 | export \"other.eskip\"\n  | ^",
+	}} {
+		_, err := Parse(ti.code)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Error(ti.msg, "failed to return a parse error", err)
+			continue
+		}
+
+		if perr.Offset != ti.offset || perr.Line != ti.line || perr.Column != ti.column {
+			t.Error(ti.msg, "invalid position", perr.Offset, perr.Line, perr.Column)
+		}
+
+		if perr.Token != ti.token || perr.Message != ti.message {
+			t.Error(ti.msg, "invalid error", perr.Token, perr.Message)
+		}
+
+		if perr.Snippet != ti.snippet {
+			t.Errorf("%s: invalid snippet:\n%s\nexpected:\n%s", ti.msg, perr.Snippet, ti.snippet)
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		doc      string
+		expected [][]string
+	}{{
+		"no comments",
+		`route1: Any() -> <shunt>; route2: Any() -> <shunt>`,
+		[][]string{nil, nil},
+	}, {
+		"leading comments",
+		`// the first route
+		//   indented
+		route1: Any() -> <shunt>;
+
+		//the second route
+		route2: Any() -> <shunt>`,
+		[][]string{{"the first route", "  indented"}, {"the second route"}},
+	}, {
+		"separated by an empty line",
+		`// about the document
+
+		route1: Any() -> <shunt>`,
+		[][]string{nil},
+	}, {
+		"trailing comment",
+		`route1: Any() -> <shunt>; // about route1
+		route2: Any() -> <shunt>`,
+		[][]string{nil, nil},
+	}, {
+		"comment inside the definition",
+		`route1: Any() // about the condition
+		-> <shunt>`,
+		[][]string{nil},
+	}, {
+		"document header",
+		"// eskip-version: 1\n// the route\nroute1: Any() -> <shunt>",
+		[][]string{{"the route"}},
+	}, {
+		"template",
+		`// the template
+		@t: Any() -> filter();
+		// the route
+		route1: @t -> <shunt>`,
+		[][]string{{"the route"}},
+	}, {
+		"single route",
+		"// the route\nAny() -> <shunt>",
+		[][]string{{"the route"}},
+	}} {
+		routes, err := Parse(ti.doc)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if len(routes) != len(ti.expected) {
+			t.Error(ti.msg, "invalid number of routes", len(routes))
+			continue
+		}
+
+		for i, r := range routes {
+			if !reflect.DeepEqual(r.Comments, ti.expected[i]) {
+				t.Errorf("%s: invalid comments of route %d: %q", ti.msg, i, r.Comments)
+			}
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The operator of a node in a predicate expression.
+type PredicateOperator int
+
+const (
+
+	// A single predicate, e.g. Host(/^www[.]example[.]org$/).
+	PredicateMatch PredicateOperator = iota
+
+	// All the operands need to match, e.g. Path("/foo") && Method("GET").
+	PredicateAnd
+
+	// Any of the operands needs to match, e.g. Host("a") || Host("b").
+	PredicateOr
+
+	// The single operand must not match, e.g. !Method("GET").
+	PredicateNot
+)
+
+// A PredicateExpression represents the matching conditions of a route
+// that are combined with the || or the ! operators. The expressions are
+// trees, whose leaves are single predicates.
+type PredicateExpression struct {
+
+	// The operator of the node.
+	Operator PredicateOperator
+
+	// The predicate of a PredicateMatch node.
+	Predicate *Predicate
+
+	// The operands of a PredicateAnd or PredicateOr node, or the single
+	// operand of a PredicateNot node.
+	Operands []*PredicateExpression
+}
+
+// the structured representation of a predicate expression, used for
+// JSON and YAML. The leaves are the predicate objects, while the
+// operators are objects with a single and, or or not field.
+type structuredExpression struct {
+	Name string                 `json:"name,omitempty" yaml:"name,omitempty"`
+	Args []interface{}          `json:"args,omitempty" yaml:"args,omitempty"`
+	And  []*PredicateExpression `json:"and,omitempty" yaml:"and,omitempty"`
+	Or   []*PredicateExpression `json:"or,omitempty" yaml:"or,omitempty"`
+	Not  *PredicateExpression   `json:"not,omitempty" yaml:"not,omitempty"`
+}
+
+// the name of the predicate wrapper negating its argument, an
+// alternative to the ! operator, e.g. Not(Host("a") || Host("b"))
+const notPredicate = "Not"
+
+var errInvalidExpression = errors.New("invalid predicate expression")
+
+var errTemplateInExpression = errors.New("template references are not allowed in standalone predicate expressions")
+
+// a node of the parsed predicate expressions. The leaves are matchers, or
+// template references, that are allowed only in the top level
+// conjunction of a route.
+type predicateNode struct {
+	op       PredicateOperator
+	matcher  *matcher
+	template string
+	position int
+	operands []*predicateNode
+}
+
+// the precedence of the operators in the eskip syntax, used to decide
+// where the parentheses are needed
+var operatorPrecedence = map[PredicateOperator]int{
+	PredicateOr:    1,
+	PredicateAnd:   2,
+	PredicateNot:   3,
+	PredicateMatch: 4}
+
+// creates an and or or node, merging the operands with the same operator
+func newPredicateNode(op PredicateOperator, operands ...*predicateNode) *predicateNode {
+	n := &predicateNode{op: op}
+	for _, o := range operands {
+		if o.op == op && op != PredicateNot {
+			n.operands = append(n.operands, o.operands...)
+		} else {
+			n.operands = append(n.operands, o)
+		}
+	}
+
+	return n
+}
+
+// joins the nodes with an and node, when there are more than one
+func conjunction(nodes []*predicateNode) *predicateNode {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	default:
+		return newPredicateNode(PredicateAnd, nodes...)
+	}
+}
+
+// splits the conditions of a route into the matchers and the template
+// references of the top level conjunction, and the rest of the
+// expression. When a template is referenced elsewhere, it is returned as
+// the last value.
+func splitFrontend(n *predicateNode) (matchers []*matcher, templates []string, rest *predicateNode, nestedTemplate *predicateNode) {
+	operands := []*predicateNode{n}
+	if n.op == PredicateAnd {
+		operands = n.operands
+	}
+
+	var restOperands []*predicateNode
+	for _, o := range operands {
+		switch {
+		case o.op != PredicateMatch:
+			restOperands = append(restOperands, o)
+		case o.matcher != nil:
+			matchers = append(matchers, o.matcher)
+		default:
+			templates = append(templates, o.template)
+		}
+	}
+
+	rest = conjunction(restOperands)
+	if rest != nil {
+		rest.visit(func(o *predicateNode) {
+			if o.op == PredicateMatch && o.matcher == nil && nestedTemplate == nil {
+				nestedTemplate = o
+			}
+		})
+	}
+
+	return
+}
+
+// calls f with every node of the expression
+func (n *predicateNode) visit(f func(*predicateNode)) {
+	f(n)
+	for _, o := range n.operands {
+		o.visit(f)
+	}
+}
+
+// returns the matchers of the leaves
+func (n *predicateNode) matchers() []*matcher {
+	if n == nil {
+		return nil
+	}
+
+	var m []*matcher
+	n.visit(func(o *predicateNode) {
+		if o.matcher != nil {
+			m = append(m, o.matcher)
+		}
+	})
+
+	return m
+}
+
+// copies the expression, with copies of the matcher arguments
+func (n *predicateNode) copy() *predicateNode {
+	if n == nil {
+		return nil
+	}
+
+	c := &predicateNode{op: n.op, template: n.template, position: n.position}
+	if n.matcher != nil {
+		c.matcher = &matcher{n.matcher.name, append([]interface{}(nil), n.matcher.args...)}
+	}
+
+	for _, o := range n.operands {
+		c.operands = append(c.operands, o.copy())
+	}
+
+	return c
+}
+
+// formats the expression, with parentheses when the operator has lower
+// precedence than the context
+func (n *predicateNode) format(precedence int) string {
+	var s string
+	switch n.op {
+	case PredicateMatch:
+		if n.matcher == nil {
+			return "@" + n.template
+		}
+
+		return n.matcher.String()
+	case PredicateNot:
+		s = "!" + n.operands[0].format(operatorPrecedence[PredicateNot])
+	default:
+		separator := " && "
+		if n.op == PredicateOr {
+			separator = " || "
+		}
+
+		operands := make([]string, len(n.operands))
+		for i, o := range n.operands {
+			operands[i] = o.format(operatorPrecedence[n.op])
+		}
+
+		s = strings.Join(operands, separator)
+	}
+
+	if operatorPrecedence[n.op] < precedence {
+		s = "(" + s + ")"
+	}
+
+	return s
+}
+
+// converts the parsed expression into the exported representation
+func (n *predicateNode) expression() *PredicateExpression {
+	if n == nil {
+		return nil
+	}
+
+	e := &PredicateExpression{Operator: n.op}
+	if n.matcher != nil {
+		e.Predicate = &Predicate{Name: n.matcher.name, Args: n.matcher.args}
+	}
+
+	for _, o := range n.operands {
+		e.Operands = append(e.Operands, o.expression())
+	}
+
+	return e
+}
+
+// Parses a standalone predicate expression, e.g. the condition of a
+// filter: Method("POST") && Header("X-Debug", "true"). The expression
+// has the same syntax as the conditions of a route, but it cannot
+// reference templates.
+func ParsePredicateExpression(p string) (*PredicateExpression, error) {
+	p = strings.TrimSpace(p)
+	if p == "" {
+		return nil, errInvalidExpression
+	}
+
+	rs, err := parseRoutes(fmt.Sprintf("%s -> <shunt>", p), documentStart, newSymbols())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs) != 1 || rs[0].id != "" || len(rs[0].filters) > 0 {
+		return nil, errInvalidExpression
+	}
+
+	r := rs[0]
+	if len(r.templates) > 0 {
+		return nil, errTemplateInExpression
+	}
+
+	var nodes []*predicateNode
+	for _, m := range r.matchers {
+		nodes = append(nodes, &predicateNode{op: PredicateMatch, matcher: m})
+	}
+
+	if r.predicate != nil {
+		var nestedTemplate bool
+		r.predicate.visit(func(n *predicateNode) {
+			nestedTemplate = nestedTemplate || n.op == PredicateMatch && n.matcher == nil
+		})
+
+		if nestedTemplate {
+			return nil, errTemplateInExpression
+		}
+
+		nodes = append(nodes, r.predicate)
+	}
+
+	return conjunction(nodes).expression(), nil
+}
+
+// converts the expression into the parsed representation
+func (e *PredicateExpression) node() *predicateNode {
+	n := &predicateNode{op: e.Operator}
+	if e.Predicate != nil {
+		n.matcher = &matcher{e.Predicate.Name, e.Predicate.Args}
+	}
+
+	for _, o := range e.Operands {
+		n.operands = append(n.operands, o.node())
+	}
+
+	return n
+}
+
+// Serializes the expression in the eskip syntax, e.g.
+// Host(/^a[.]example[.]org$/) || !Method("GET").
+func (e *PredicateExpression) String() string {
+	return e.node().format(0)
+}
+
+// Returns a deep copy of the expression.
+func (e *PredicateExpression) Copy() *PredicateExpression {
+	if e == nil {
+		return nil
+	}
+
+	c := &PredicateExpression{Operator: e.Operator}
+	if e.Predicate != nil {
+		c.Predicate = &Predicate{Name: e.Predicate.Name, Args: append([]interface{}(nil), e.Predicate.Args...)}
+	}
+
+	for _, o := range e.Operands {
+		c.Operands = append(c.Operands, o.Copy())
+	}
+
+	return c
+}
+
+func eqPredicateExpressions(a, b *PredicateExpression) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Operator != b.Operator || len(a.Operands) != len(b.Operands) || (a.Predicate == nil) != (b.Predicate == nil) {
+		return false
+	}
+
+	if a.Predicate != nil && (a.Predicate.Name != b.Predicate.Name || !eqArgs(a.Predicate.Args, b.Predicate.Args)) {
+		return false
+	}
+
+	for i := range a.Operands {
+		if !eqPredicateExpressions(a.Operands[i], b.Operands[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *PredicateExpression) structured() *structuredExpression {
+	s := &structuredExpression{}
+	switch e.Operator {
+	case PredicateMatch:
+		if e.Predicate != nil {
+			s.Name, s.Args = e.Predicate.Name, e.Predicate.Args
+		}
+	case PredicateAnd:
+		s.And = e.Operands
+	case PredicateOr:
+		s.Or = e.Operands
+	case PredicateNot:
+		if len(e.Operands) > 0 {
+			s.Not = e.Operands[0]
+		}
+	}
+
+	return s
+}
+
+func (e *PredicateExpression) setStructured(s *structuredExpression) error {
+	set := 0
+	*e = PredicateExpression{}
+	if s.Name != "" {
+		set++
+		if err := normalizeArgs(s.Args); err != nil {
+			return err
+		}
+
+		e.Operator = PredicateMatch
+		e.Predicate = &Predicate{Name: s.Name, Args: s.Args}
+	}
+
+	if len(s.And) > 0 {
+		set++
+		e.Operator, e.Operands = PredicateAnd, s.And
+	}
+
+	if len(s.Or) > 0 {
+		set++
+		e.Operator, e.Operands = PredicateOr, s.Or
+	}
+
+	if s.Not != nil {
+		set++
+		e.Operator, e.Operands = PredicateNot, []*PredicateExpression{s.Not}
+	}
+
+	if set != 1 {
+		return errInvalidExpression
+	}
+
+	return nil
+}
+
+// Encodes the expression as JSON. The leaves are predicate objects with
+// a name and args, while the operators are objects with a single and,
+// or or not field, e.g. {"or": [{"name": "Host", "args": ["a"]}, {"not":
+// {"name": "Method", "args": ["GET"]}}]}.
+func (e *PredicateExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.structured())
+}
+
+// Decodes an expression from the JSON object returned by MarshalJSON.
+func (e *PredicateExpression) UnmarshalJSON(data []byte) error {
+	var s structuredExpression
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return e.setStructured(&s)
+}
+
+// Returns the expression in the same structure as MarshalJSON.
+func (e *PredicateExpression) MarshalYAML() (interface{}, error) {
+	return e.structured(), nil
+}
+
+// Decodes an expression from the structure returned by MarshalYAML.
+func (e *PredicateExpression) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s structuredExpression
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return e.setStructured(&s)
+}
+
+// returns the route conditions in the eskip syntax, combining the
+// conditions in the route fields with the expression
+func appendExpression(conds []string, e *PredicateExpression) []string {
+	if e == nil {
+		return conds
+	}
+
+	precedence := 0
+	if len(conds) > 0 {
+		precedence = operatorPrecedence[PredicateAnd]
+	}
+
+	return append(conds, e.node().format(precedence))
+}
+
+func (op PredicateOperator) String() string {
+	switch op {
+	case PredicateMatch:
+		return "match"
+	case PredicateAnd:
+		return "and"
+	case PredicateOr:
+		return "or"
+	case PredicateNot:
+		return "not"
+	default:
+		return fmt.Sprintf("PredicateOperator(%d)", int(op))
+	}
+}
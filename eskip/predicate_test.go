@@ -0,0 +1,314 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePredicateExpressions(t *testing.T) {
+	for _, ti := range []struct {
+		msg        string
+		code       string
+		path       string
+		hosts      int
+		expression string
+	}{{
+		"conjunction only",
+		`Path("/foo") && Host(/a/) -> <shunt>`,
+		"/foo",
+		1,
+		"",
+	}, {
+		"or",
+		`Host(/a/) || Host(/b/) -> <shunt>`,
+		"",
+		0,
+		"Host(/a/) || Host(/b/)",
+	}, {
+		"or in conjunction",
+		`Path("/foo") && (Host(/a/) || Host(/b/)) -> <shunt>`,
+		"/foo",
+		0,
+		"Host(/a/) || Host(/b/)",
+	}, {
+		"not",
+		`Path("/foo") && !Method("GET") -> <shunt>`,
+		"/foo",
+		0,
+		`!Method("GET")`,
+	}, {
+		"precedence of and over or",
+		`Path("/foo") && Host(/a/) || Host(/b/) -> <shunt>`,
+		"",
+		0,
+		`Path("/foo") && Host(/a/) || Host(/b/)`,
+	}, {
+		"nested",
+		`!(Method("GET") || Method("HEAD")) && (Host(/a/) || !Header("X-Foo", "bar")) -> <shunt>`,
+		"",
+		0,
+		`!(Method("GET") || Method("HEAD")) && (Host(/a/) || !Header("X-Foo", "bar"))`,
+	}, {
+		"redundant parentheses",
+		`((Path("/foo"))) && ((Host(/a/))) -> <shunt>`,
+		"/foo",
+		1,
+		"",
+	}, {
+		"double negation",
+		`!!Method("GET") -> <shunt>`,
+		"",
+		0,
+		`!!Method("GET")`,
+	}, {
+		"not wrapper",
+		`Path("/foo") && Not(Host(/a/) || Host(/b/)) -> <shunt>`,
+		"/foo",
+		0,
+		"!(Host(/a/) || Host(/b/))",
+	}, {
+		"nested not wrapper",
+		`Not(Method("GET") && Not(Header("X-Foo", "bar"))) -> <shunt>`,
+		"",
+		0,
+		`!(Method("GET") && !Header("X-Foo", "bar"))`,
+	}} {
+		r, err := Parse(ti.code)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if r[0].Path != ti.path || len(r[0].HostRegexps) != ti.hosts {
+			t.Error(ti.msg, "invalid conditions", r[0].Path, r[0].HostRegexps)
+		}
+
+		if ti.expression == "" {
+			if r[0].Predicate != nil {
+				t.Error(ti.msg, "unexpected expression", r[0].Predicate)
+			}
+
+			continue
+		}
+
+		if r[0].Predicate == nil || r[0].Predicate.String() != ti.expression {
+			t.Error(ti.msg, "invalid expression", r[0].Predicate)
+		}
+	}
+}
+
+func TestPredicateExpressionTree(t *testing.T) {
+	r, err := Parse(`Host(/a/) || Host(/b/) || !Method("GET") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := r[0].Predicate
+	if e.Operator != PredicateOr || len(e.Operands) != 3 {
+		t.Fatal("failed to merge the operands of the same operator", e.Operator, len(e.Operands))
+	}
+
+	if e.Operands[0].Operator != PredicateMatch || e.Operands[0].Predicate.Name != "Host" || e.Operands[0].Predicate.Args[0] != "a" {
+		t.Error("invalid leaf", e.Operands[0])
+	}
+
+	not := e.Operands[2]
+	if not.Operator != PredicateNot || len(not.Operands) != 1 || not.Operands[0].Predicate.Name != "Method" {
+		t.Error("invalid negation", not)
+	}
+}
+
+func TestPredicateExpressionRoundTrip(t *testing.T) {
+	for _, code := range []string{
+		`Host(/a/) || Host(/b/) -> <shunt>`,
+		`Path("/foo") && (Host(/a/) || Host(/b/)) && !Method("GET") -> "https://www.example.org"`,
+		`(Method("GET") || Method("HEAD")) && !(Header("X-Foo", "bar") || HeaderRegexp("X-Bar", /baz/)) -> <shunt>`,
+	} {
+		r, err := Parse(code)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		rr, err := Parse(r[0].String())
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !Eq(r[0], rr[0]) {
+			t.Error("failed to round trip", code, r[0].String())
+		}
+	}
+}
+
+func TestPredicateExpressionErrors(t *testing.T) {
+	for _, code := range []string{
+		`Host(/a/) || -> <shunt>`,
+		`!-> <shunt>`,
+		`(Host(/a/) -> <shunt>`,
+		`Host(/a/) ||| Host(/b/) -> <shunt>`,
+		`@t: Method("GET"); r: @t || Host(/a/) -> <shunt>`,
+		`@t: Method("GET"); r: !@t -> <shunt>`,
+		`Not() -> <shunt>`,
+		`Not("foo") -> <shunt>`,
+		`Not(Method("GET"), Host(/a/)) -> <shunt>`,
+		`Foo(Method("GET")) -> <shunt>`,
+		`@t: Method("GET"); r: Not(@t) -> <shunt>`,
+	} {
+		if _, err := Parse(code); err == nil {
+			t.Error("failed to fail", code)
+		}
+	}
+}
+
+func TestPredicateExpressionTemplates(t *testing.T) {
+	r, err := Parse(`
+		@hosts: Host(/a/) || Host(/b/);
+		route1: @hosts && Path("/foo") && (Method("GET") || Method("HEAD")) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 1 || r[0].Path != "/foo" {
+		t.Fatal("failed to parse route", r)
+	}
+
+	expected := `(Host(/a/) || Host(/b/)) && (Method("GET") || Method("HEAD"))`
+	if r[0].Predicate.String() != expected {
+		t.Error("failed to combine the expressions", r[0].Predicate)
+	}
+}
+
+func TestPredicateExpressionVariablesAndMacros(t *testing.T) {
+	r, err := Parse(`
+		let a = "a.example.org";
+		def hosts(b, backend) = Host($a) || Host($b) -> $backend;
+		route1: hosts("b.example.org", "https://www.example.org")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r[0].Predicate.String() != `Host(/a.example.org/) || Host(/b.example.org/)` {
+		t.Error("failed to substitute the variables", r[0].Predicate)
+	}
+}
+
+func TestPredicateExpressionStrict(t *testing.T) {
+	if _, err := ParseStrict(`Host(/a/) || Hots(/b/) -> <shunt>`, nil, nil); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestParseStandalonePredicateExpression(t *testing.T) {
+	e, err := ParsePredicateExpression(`Path("/foo") && (Method("GET") || Method("HEAD"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Path("/foo") && (Method("GET") || Method("HEAD"))`
+	if e.String() != expected {
+		t.Error("failed to parse the expression", e)
+	}
+
+	for _, code := range []string{
+		``,
+		`Method("GET") ||`,
+		`Method("GET") -> requestHeader("X-Foo", "bar")`,
+		`r: Method("GET")`,
+		`@t && Method("GET")`,
+		`!@t`,
+	} {
+		if _, err := ParsePredicateExpression(code); err == nil {
+			t.Error("failed to fail", code)
+		}
+	}
+}
+
+func TestPredicateExpressionEqAndCopy(t *testing.T) {
+	r, err := Parse(`
+		r1: Host(/a/) || Host(/b/) -> <shunt>;
+		r2: Host(/a/) || Host(/c/) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2 := r[1].Copy()
+	r2.Id = r[0].Id
+	if Eq(r[0], r2) {
+		t.Error("failed to compare expressions")
+	}
+
+	c := r[0].Copy()
+	if !Eq(r[0], c) {
+		t.Error("failed to copy the expression")
+	}
+
+	c.Predicate.Operands[0].Predicate.Args[0] = "x"
+	if Eq(r[0], c) || r[0].Predicate.Operands[0].Predicate.Args[0] != "a" {
+		t.Error("failed to copy the expression")
+	}
+}
+
+func TestPredicateExpressionJSON(t *testing.T) {
+	r, err := Parse(`r1: Path("/foo") && (Host(/a/) || !Method("GET")) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(r[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rr Route
+	if err := json.Unmarshal(b, &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Eq(r[0], &rr) {
+		t.Error("failed to round trip", string(b))
+	}
+
+	var e PredicateExpression
+	if err := json.Unmarshal([]byte(`{"or": [{"name": "Host", "args": ["a"]}], "not": {"name": "Any"}}`), &e); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestTokenizePredicateOperators(t *testing.T) {
+	var kinds []TokenKind
+	for _, tk := range Tokenize(`!Host(/a/) || Any()`) {
+		kinds = append(kinds, tk.Kind)
+	}
+
+	if len(kinds) < 6 || kinds[0] != TokenNot || kinds[5] != TokenOr {
+		t.Error("failed to tokenize the operators", kinds)
+	}
+}
+
+func TestFmtPredicateExpressions(t *testing.T) {
+	out, err := Fmt([]byte(`r1: ( Host(/a/)||Host(/b/) )&&Path("/foo") -> <shunt>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `r1: Path("/foo") && (Host(/a/) || Host(/b/)) -> <shunt>;` + "\n"
+	if string(out) != expected {
+		t.Errorf("invalid format: %q", out)
+	}
+}
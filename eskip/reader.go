@@ -0,0 +1,226 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the states of the scanner splitting the route definitions
+const (
+	scanCode = iota
+	scanString
+	scanRawString
+	scanRegexp
+	scanComment
+)
+
+var errUnnamedRoute = errors.New("unnamed route in a document with multiple routes")
+
+// RouteStream parses routes incrementally from a reader, without loading
+// the whole document into memory. Create it with ParseReader.
+type RouteStream struct {
+	reader    *bufio.Reader
+	position  position
+	templates map[string]*parsedRoute
+	symbols   *symbols
+	routes    int
+	unnamed   bool
+	err       error
+}
+
+// Returns a stream of the routes in the routing document read from r.
+// The routes are parsed one by one, as they are read. The templates, the
+// variables and the macros need to be defined before the routes
+// referencing them.
+func ParseReader(r io.Reader) *RouteStream {
+	return &RouteStream{
+		reader:    bufio.NewReader(r),
+		position:  documentStart,
+		templates: make(map[string]*parsedRoute),
+		symbols:   newSymbols()}
+}
+
+// returns the character closing a literal
+func closingQuote(state int) byte {
+	switch state {
+	case scanString:
+		return '"'
+	case scanRawString:
+		return '`'
+	default:
+		return '/'
+	}
+}
+
+// steps the position in the document, counting the columns in
+// characters
+func (s *RouteStream) advance(c byte) {
+	s.position.offset++
+	switch {
+	case c == '\n':
+		s.position.line++
+		s.position.column = 1
+	case !utf8.RuneStart(c):
+	default:
+		s.position.column++
+	}
+}
+
+// reads the next definition, until a semicolon outside of the literals
+// and the comments, or the end of the document. It returns the position
+// of the definition, and true when it is the last one. The definitions
+// containing only whitespace and comments are returned empty.
+func (s *RouteStream) readDefinition() (string, position, bool, error) {
+	var (
+		def     bytes.Buffer
+		state   = scanCode
+		escaped bool
+		hasCode bool
+	)
+
+	start := s.position
+	result := func(last bool) (string, position, bool, error) {
+		if !hasCode {
+			return "", start, last, nil
+		}
+
+		return def.String(), start, last, nil
+	}
+
+	for {
+		c, err := s.reader.ReadByte()
+		if err == io.EOF {
+			return result(true)
+		} else if err != nil {
+			return "", start, false, err
+		}
+
+		s.advance(c)
+
+		if state == scanCode && c == ';' {
+			return result(false)
+		}
+
+		def.WriteByte(c)
+
+		switch state {
+		case scanCode:
+			if c != '/' && !unicode.IsSpace(rune(c)) {
+				hasCode = true
+			}
+
+			switch c {
+			case '"':
+				state = scanString
+			case '`':
+				state = scanRawString
+			case '/':
+				if next, err := s.reader.Peek(1); err == nil && next[0] == '/' {
+					state = scanComment
+				} else {
+					state = scanRegexp
+					hasCode = true
+				}
+			}
+		case scanComment:
+			if c == '\n' {
+				state = scanCode
+			}
+		default:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == closingQuote(state):
+				state = scanCode
+			}
+		}
+	}
+}
+
+// parses the next route definition, returns nil at the end of the
+// document, or when the definition is empty or a template
+func (s *RouteStream) parseNext() (*Route, bool, error) {
+	def, start, last, err := s.readDefinition()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if def == "" {
+		return nil, last, nil
+	}
+
+	routes, err := parseRoutes(def, start, s.symbols)
+	if err != nil || len(routes) == 0 {
+		return nil, last, err
+	}
+
+	r := routes[0]
+	if r.template {
+		if _, exists := s.templates[r.id]; exists {
+			return nil, false, fmt.Errorf("duplicate template: %s", r.id)
+		}
+
+		s.templates[r.id] = r
+		return nil, last, nil
+	}
+
+	// a route without an id is accepted only as the single route of
+	// the document
+	if s.unnamed || r.id == "" && s.routes > 0 {
+		return nil, false, errUnnamedRoute
+	}
+
+	s.unnamed = r.id == ""
+	s.routes++
+
+	if err := applyTemplates(r, s.templates); err != nil {
+		return nil, false, err
+	}
+
+	rd, err := newRouteDefinition(r)
+	return rd, last, err
+}
+
+// Returns the next route of the document. At the end of the document,
+// it returns io.EOF. After an error, the same error is returned by the
+// subsequent calls.
+func (s *RouteStream) Next() (*Route, error) {
+	for s.err == nil {
+		r, last, err := s.parseNext()
+		switch {
+		case err != nil:
+			s.err = err
+		case r != nil:
+			if last {
+				s.err = io.EOF
+			}
+
+			return r, nil
+		case last:
+			s.err = io.EOF
+		}
+	}
+
+	return nil, s.err
+}
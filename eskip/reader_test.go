@@ -0,0 +1,164 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(s *RouteStream) ([]*Route, error) {
+	var routes []*Route
+	for {
+		r, err := s.Next()
+		if err == io.EOF {
+			return routes, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		routes = append(routes, r)
+	}
+}
+
+func TestParseReaderMatchesParse(t *testing.T) {
+	for _, doc := range []string{
+		``,
+		`Path("/") -> "https://www.example.org"`,
+		`route1: Path("/") -> "https://www.example.org"`,
+		`route1: Path("/") -> "https://www.example.org";`,
+		`route1: Path("/semi;colon") -> setPath("/a;b") -> "https://www.example.org";
+		route2: PathRegexp(/[;]\/x/) -> <shunt>;;
+		// a comment; with a semicolon
+		route3: Header("X-Quote", "\";") -> "https://www.example.org"`,
+		testTemplates + `route1: @auth && Path("/api") -> modPath("^/api", "") -> "https://api.example.org";
+		route2: Path("/") && @authLogged -> "https://www.example.org"`,
+		`// the first route
+		route1: Path("/") -> <shunt>; // trailing
+
+		// the second route
+		// on two lines
+		route2: Path("/b") -> <shunt>`,
+	} {
+		expected, err := Parse(doc)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		routes, err := readAll(ParseReader(strings.NewReader(doc)))
+		if err != nil {
+			t.Error(doc, err)
+			continue
+		}
+
+		if len(routes) != len(expected) {
+			t.Error("invalid number of routes", doc, len(routes), len(expected))
+			continue
+		}
+
+		for i := range routes {
+			if routes[i].String() != expected[i].String() {
+				t.Error("invalid route", routes[i].String(), expected[i].String())
+			}
+
+			if !reflect.DeepEqual(routes[i].Comments, expected[i].Comments) {
+				t.Error("invalid comments", routes[i].Comments, expected[i].Comments)
+			}
+		}
+	}
+}
+
+func TestParseReaderEmpty(t *testing.T) {
+	for _, doc := range []string{"", "\n\t", "// a comment\n;\n;"} {
+		routes, err := readAll(ParseReader(strings.NewReader(doc)))
+		if err != nil || len(routes) != 0 {
+			t.Error("failed to read the empty document", doc, len(routes), err)
+		}
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	for _, doc := range []string{
+		`route1: Path("/") -> <shunt>; route2: Path("/") -> `,
+		`route1: Path("/") -> <shunt>; Path("/") -> <shunt>`,
+		`Path("/") -> <shunt>; route1: Path("/") -> <shunt>`,
+		`route1: @missing -> <shunt>`,
+		`@t: Any(); @t: Any()`,
+	} {
+		s := ParseReader(strings.NewReader(doc))
+		_, err := readAll(s)
+		if err == nil {
+			t.Error("failed to fail", doc)
+			continue
+		}
+
+		if _, nextErr := s.Next(); nextErr != err {
+			t.Error("failed to keep the error", doc, nextErr)
+		}
+	}
+}
+
+func TestParseReaderErrorPosition(t *testing.T) {
+	_, err := readAll(ParseReader(strings.NewReader(`route1: Path("/") -> <shunt>; route2: Path("/") -> #`)))
+	if err == nil || !strings.Contains(err.Error(), "position 51") {
+		t.Error("invalid error position", err)
+	}
+
+	_, err = readAll(ParseReader(strings.NewReader("r1: Path(\"/\") -> <shunt>;\nr2: Path(\"/\")\n  -> #")))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatal("failed to return a parse error", err)
+	}
+
+	if perr.Offset != 45 || perr.Line != 3 || perr.Column != 6 {
+		t.Error("invalid error position", perr.Offset, perr.Line, perr.Column)
+	}
+
+	if perr.Snippet != "2 | r2: Path(\"/\")\n3 |   -> #\n  |      ^" {
+		t.Errorf("invalid snippet:\n%s", perr.Snippet)
+	}
+}
+
+func TestParseReaderStreams(t *testing.T) {
+	const count = 3000
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(pw, "route%d: Path(\"/%d\") -> \"https://www.example.org\";\n", i, i)
+		}
+
+		pw.Close()
+	}()
+
+	s := ParseReader(pr)
+	for i := 0; i < count; i++ {
+		r, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r.Id != fmt.Sprintf("route%d", i) {
+			t.Fatal("invalid route", r.Id)
+		}
+	}
+
+	if _, err := s.Next(); err != io.EOF {
+		t.Error("failed to reach the end", err)
+	}
+}
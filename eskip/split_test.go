@@ -0,0 +1,144 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSplitBackend(t *testing.T) {
+	r, err := Parse(`canary: Path("/foo") -> <split 90 "https://stable.example.org", 10 "https://canary.example.org">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 1 || r[0].Shunt || r[0].Backend != "" || len(r[0].SplitBackends) != 2 ||
+		*r[0].SplitBackends[0] != (WeightedBackend{90, "https://stable.example.org"}) ||
+		*r[0].SplitBackends[1] != (WeightedBackend{10, "https://canary.example.org"}) {
+		t.Error("failed to parse the split backend", r[0].SplitBackends)
+	}
+}
+
+func TestParseSplitBackendWithVariablesAndMacros(t *testing.T) {
+	r, err := Parse(`
+		let stable = "https://stable.example.org";
+		def canary(backend, weight) = Path("/foo") -> <split 90 $stable, $weight $backend>;
+		route1: canary("https://canary.example.org", 10)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 1 || len(r[0].SplitBackends) != 2 ||
+		*r[0].SplitBackends[0] != (WeightedBackend{90, "https://stable.example.org"}) ||
+		*r[0].SplitBackends[1] != (WeightedBackend{10, "https://canary.example.org"}) {
+		t.Error("failed to parse the split backend", r[0].SplitBackends)
+	}
+}
+
+func TestParseSplitBackendErrors(t *testing.T) {
+	for _, code := range []string{
+		`Any() -> <split>`,
+		`Any() -> <split 90>`,
+		`Any() -> <split "https://www.example.org">`,
+		`Any() -> <split 90 "https://a.example.org" 10 "https://b.example.org">`,
+		`Any() -> <split 90 "https://a.example.org", >`,
+		`Any() -> <split 90 "https://a.example.org"`,
+		`Any() -> <split 1.5 "https://a.example.org">`,
+		`Any() -> <split -1 "https://a.example.org">`,
+		`Any() -> <split 0 "https://a.example.org", 0 "https://b.example.org">`,
+		`Any() -> <split "90" "https://a.example.org">`,
+		`Any() -> <split 90 42>`,
+		`Any() -> <split 90 $undefined>`,
+	} {
+		if _, err := Parse(code); err == nil {
+			t.Error("failed to fail", code)
+		}
+	}
+}
+
+func TestSerializeSplitBackend(t *testing.T) {
+	code := `Path("/foo") -> <split 90 "https://stable.example.org", 0 "https://canary.example.org">`
+	r, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := r[0].String(); s != code {
+		t.Error("failed to serialize the split backend", s)
+	}
+
+	rr, err := Parse(r[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Eq(r[0], rr[0]) {
+		t.Error("failed to round trip the split backend")
+	}
+
+	c := r[0].Copy()
+	c.SplitBackends[1].Weight = 10
+	if r[0].SplitBackends[1].Weight != 0 || Eq(r[0], c) {
+		t.Error("failed to copy and compare the split backend")
+	}
+}
+
+func TestFmtSplitBackend(t *testing.T) {
+	out, err := Fmt([]byte("let b = \"https://b.example.org\";\n" +
+		`route1: Any() -> <split  90 "https://a.example.org" ,10 $b>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "let b = \"https://b.example.org\";\n"+
+		`route1: Any() -> <split 90 "https://a.example.org", 10 $b>;`+"\n" {
+		t.Errorf("invalid format: %q", out)
+	}
+}
+
+func TestSplitBackendJSON(t *testing.T) {
+	r := NewRoute().
+		Id("canary").
+		SplitBackend(90, "https://stable.example.org").
+		SplitBackend(10, "https://canary.example.org").
+		Route()
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rr Route
+	if err := json.Unmarshal(b, &rr); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Eq(r, &rr) {
+		t.Error("failed to round trip the split backend", string(b))
+	}
+
+	for _, s := range []string{
+		`{"id": "r", "shunt": true, "split": [{"weight": 1, "backend": "https://a.example.org"}]}`,
+		`{"id": "r", "backend": "https://b.example.org", "split": [{"weight": 1, "backend": "https://a.example.org"}]}`,
+		`{"id": "r", "split": [{"weight": 0, "backend": "https://a.example.org"}]}`,
+		`{"id": "r", "split": [{"weight": -1, "backend": "https://a.example.org"}, {"weight": 2, "backend": "https://b.example.org"}]}`,
+	} {
+		var r Route
+		if err := json.Unmarshal([]byte(s), &r); err == nil {
+			t.Error("failed to fail", s)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the predicates stored in the dedicated fields of the routes
+var fieldPredicates = []string{
+	"Path",
+	"PathRegexp",
+	"Host",
+	"Method",
+	"Header",
+	"HeaderRegexp",
+	"Any"}
+
+// The names of the built-in conditions, predicates. The ones without a
+// dedicated field in the Route, e.g. Cookie, are stored with the custom
+// predicates.
+var Predicates = append(append([]string(nil), fieldPredicates...), "Cookie", "QueryParam", "Traffic", "Schedule", "Between", "Cron", "ClientCert", "ClientTLSVersion", "ClientCertificate", "ClientIP", "TrailingSlash", "ValidUntil")
+
+func isFieldPredicate(name string) bool {
+	for _, p := range fieldPredicates {
+		if p == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Error returned in strict mode, when a route references an unknown
+// filter or predicate.
+type UnknownNameError struct {
+
+	// "filter" or "predicate".
+	Kind string
+
+	// The unknown name.
+	Name string
+
+	// The id of the route, if any.
+	RouteId string
+
+	// The most similar known name, if there is one similar enough.
+	Suggestion string
+}
+
+func (err *UnknownNameError) Error() string {
+	msg := fmt.Sprintf("unknown %s: %s", err.Kind, err.Name)
+	if err.RouteId != "" {
+		msg += fmt.Sprintf(", in route: %s", err.RouteId)
+	}
+
+	if err.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %s?", err.Suggestion)
+	}
+
+	return msg
+}
+
+func minInt(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
+
+// the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// returns the most similar name, when the distance is small enough
+// compared to the length of the name. The comparison is case
+// insensitive.
+func suggest(name string, known []string) string {
+	var (
+		best         string
+		bestDistance int
+	)
+
+	lname := strings.ToLower(name)
+	for _, k := range known {
+		d := editDistance(lname, strings.ToLower(k))
+		if best == "" || d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+
+	if best == "" || bestDistance > len(name)/3+1 {
+		return ""
+	}
+
+	return best
+}
+
+func checkName(kind, name, routeId string, known map[string]bool, names []string) error {
+	if known[name] {
+		return nil
+	}
+
+	return &UnknownNameError{kind, name, routeId, suggest(name, names)}
+}
+
+func nameSet(names []string) map[string]bool {
+	s := make(map[string]bool)
+	for _, n := range names {
+		s[n] = true
+	}
+
+	return s
+}
+
+// Parses a route expression or a routing document, like Parse, but
+// returns an error when a route references a filter or a predicate that
+// is not in the provided lists, suggesting the most similar known name.
+// It is meant to catch typos before the routes are deployed. The filter
+// names can be taken from a filter registry. When the predicate names
+// are nil, the names in Predicates are used.
+func ParseStrict(code string, filterNames, predicateNames []string) ([]*Route, error) {
+	parsedRoutes, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if predicateNames == nil {
+		predicateNames = Predicates
+	}
+
+	knownFilters, knownPredicates := nameSet(filterNames), nameSet(predicateNames)
+	for _, r := range parsedRoutes {
+		for _, m := range r.allMatchers() {
+			if err := checkName("predicate", m.name, r.id, knownPredicates, predicateNames); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, f := range r.filters {
+			if err := checkName("filter", f.Name, r.id, knownFilters, filterNames); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return newRouteDefinitions(parsedRoutes)
+}
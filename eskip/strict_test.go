@@ -0,0 +1,108 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+var strictFilterNames = []string{"requestHeader", "responseHeader", "modPath", "static"}
+
+func TestEditDistance(t *testing.T) {
+	for _, ti := range []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"path", "path", 0},
+		{"kitten", "sitting", 3},
+		{"requestHeadr", "requestHeader", 1},
+	} {
+		if d := editDistance(ti.a, ti.b); d != ti.distance {
+			t.Error("invalid edit distance", ti.a, ti.b, d, ti.distance)
+		}
+	}
+}
+
+func TestParseStrictAcceptsKnownNames(t *testing.T) {
+	r, err := ParseStrict(
+		`route1: Path("/some") && Method("GET") -> requestHeader("X-Foo", "bar") -> static("/", "/var/www") -> <shunt>;
+		route2: Any() -> "https://www.example.org"`,
+		strictFilterNames, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 2 || r[0].Path != "/some" || len(r[0].Filters) != 2 {
+		t.Error("failed to parse routes")
+	}
+}
+
+func TestParseStrictRejectsUnknownNames(t *testing.T) {
+	for _, ti := range []struct {
+		doc        string
+		kind       string
+		name       string
+		suggestion string
+	}{{
+		`route1: Path("/some") -> requestHeadr("X-Foo", "bar") -> <shunt>`,
+		"filter", "requestHeadr", "requestHeader",
+	}, {
+		`route1: path("/some") -> <shunt>`,
+		"predicate", "path", "Path",
+	}, {
+		`route1: Mehtod("GET") -> <shunt>`,
+		"predicate", "Mehtod", "Method",
+	}, {
+		`route1: Any() -> completelyUnrelated() -> <shunt>`,
+		"filter", "completelyUnrelated", "",
+	}} {
+		_, err := ParseStrict(ti.doc, strictFilterNames, nil)
+		nerr, ok := err.(*UnknownNameError)
+		if !ok {
+			t.Error("failed to fail", ti.doc, err)
+			continue
+		}
+
+		if nerr.Kind != ti.kind || nerr.Name != ti.name ||
+			nerr.Suggestion != ti.suggestion || nerr.RouteId != "route1" {
+			t.Error("invalid error", ti.doc, nerr)
+		}
+	}
+}
+
+func TestParseStrictCustomPredicates(t *testing.T) {
+	if _, err := ParseStrict(`Path("/some") -> <shunt>`, nil, []string{"Method"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestParseStrictBuiltinPredicates(t *testing.T) {
+	r, err := ParseStrict(`Cookie("session", /^a/) && QueryParam("debug", "1") && Traffic(0.05) -> <shunt>`, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 1 || len(r[0].CustomPredicates) != 3 || r[0].CustomPredicates[2].Name != "Traffic" {
+		t.Error("failed to parse the predicates", r)
+	}
+}
+
+func TestParseStrictSyntaxError(t *testing.T) {
+	if _, err := ParseStrict(`Path("/some") -> `, strictFilterNames, nil); err == nil {
+		t.Error("failed to fail")
+	}
+}
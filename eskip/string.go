@@ -15,6 +15,30 @@ func escape(s string, chars string) string {
 	return s
 }
 
+// escapes the slashes of a regular expression, as expected by the
+// lexer of the regexp literals. The escape sequences of the expression
+// are kept as they are, because the lexer unescapes only the slashes.
+func escapeRegexp(rx string) string {
+	var b []byte
+	for i := 0; i < len(rx); i++ {
+		switch {
+		case rx[i] == '\\' && i+1 < len(rx) && rx[i+1] != '/':
+			b = append(b, rx[i], rx[i+1])
+			i++
+		case rx[i] == '\\' && i+1 == len(rx):
+			b = append(b, '\\', '\\')
+		case rx[i] == '\\':
+			// an escaped slash, the same as a slash in the expression
+		case rx[i] == '/':
+			b = append(b, '\\', '/')
+		default:
+			b = append(b, rx[i])
+		}
+	}
+
+	return string(b)
+}
+
 func appendFmt(s []string, format string, args ...interface{}) []string {
 	return append(s, fmt.Sprintf(format, args...))
 }
@@ -36,11 +60,11 @@ func (r *Route) condString() string {
 	}
 
 	for _, h := range r.HostRegexps {
-		conds = appendFmtEscape(conds, "Host(/%s/)", "/", h)
+		conds = appendFmt(conds, "Host(/%s/)", escapeRegexp(h))
 	}
 
 	for _, p := range r.PathRegexps {
-		conds = appendFmtEscape(conds, "PathRegexp(/%s/)", "/", p)
+		conds = appendFmt(conds, "PathRegexp(/%s/)", escapeRegexp(p))
 	}
 
 	if r.Method != "" {
@@ -53,10 +77,15 @@ func (r *Route) condString() string {
 
 	for k, rxs := range r.HeaderRegexps {
 		for _, rx := range rxs {
-			conds = appendFmt(conds, `HeaderRegexp("%s", /%s/)`, escape(k, `"`), escape(rx, "/"))
+			conds = appendFmt(conds, `HeaderRegexp("%s", /%s/)`, escape(k, `"`), escapeRegexp(rx))
 		}
 	}
 
+	for _, p := range r.CustomPredicates {
+		conds = appendFmt(conds, "%s(%s)", p.Name, argsString(p.Args))
+	}
+
+	conds = appendExpression(conds, r.Predicate)
 	if len(conds) == 0 {
 		conds = append(conds, "Any()")
 	}
@@ -64,6 +93,15 @@ func (r *Route) condString() string {
 	return strings.Join(conds, " && ")
 }
 
+func stringArgs(s []string) []interface{} {
+	args := make([]interface{}, len(s))
+	for i, si := range s {
+		args[i] = si
+	}
+
+	return args
+}
+
 func argsString(args []interface{}) string {
 	var sargs []string
 	for _, a := range args {
@@ -72,30 +110,63 @@ func argsString(args []interface{}) string {
 			sargs = appendFmt(sargs, "%g", a)
 		case string:
 			sargs = appendFmtEscape(sargs, `"%s"`, `"`, a)
+		case *variableRef:
+			sargs = append(sargs, "$"+a.(*variableRef).name)
 		}
 	}
 
 	return strings.Join(sargs, ", ")
 }
 
+// Serializes a filter, e.g. redirect(302, "https://www.example.org").
+func (f *Filter) String() string {
+	return fmt.Sprintf("%s(%s)", f.Name, argsString(f.Args))
+}
+
 func (r *Route) filterString() string {
 	var sfilters []string
 	for _, f := range r.Filters {
-		sfilters = appendFmt(sfilters, "%s(%s)", f.Name, argsString(f.Args))
+		sfilters = append(sfilters, f.String())
 	}
 
 	return strings.Join(sfilters, " -> ")
 }
 
+// formats the weights and the addresses of a split backend, e.g.
+// <split 90 "https://stable.example.org", 10 "https://canary.example.org">
+func splitString(args []interface{}) string {
+	var backends []string
+	for i := 0; i+1 < len(args); i += 2 {
+		backends = append(backends, argsString(args[i:i+1])+" "+argsString(args[i+1:i+2]))
+	}
+
+	return "<split " + strings.Join(backends, ", ") + ">"
+}
+
 func (r *Route) backendString() string {
-	if r.Shunt {
+	switch {
+	case r.Shunt:
 		return "<shunt>"
+	case r.Loopback:
+		return "<loopback>"
+	case r.Dynamic:
+		return "<dynamic>"
+	}
+
+	if len(r.SplitBackends) > 0 {
+		var args []interface{}
+		for _, b := range r.SplitBackends {
+			args = append(args, float64(b.Weight), b.Backend)
+		}
+
+		return splitString(args)
 	}
 
-	return fmt.Sprintf(`"%s"`, r.Backend)
+	return fmt.Sprintf(`"%s"`, escape(r.Backend, `"`))
 }
 
-// Serializes a route expression. Omits the route id if any.
+// Serializes a route expression. Omits the route id and the comments,
+// if any.
 func (r *Route) String() string {
 	s := []string{r.condString()}
 
@@ -108,15 +179,47 @@ func (r *Route) String() string {
 	return strings.Join(s, " -> ")
 }
 
-// Serializes a set of routes.
+// Serializes comments, one comment line per line.
+func commentLines(comments []string) string {
+	var s []string
+	for _, c := range comments {
+		for _, line := range strings.Split(c, "\n") {
+			if line == "" {
+				s = append(s, "//\n")
+			} else {
+				s = appendFmt(s, "// %s\n", line)
+			}
+		}
+	}
+
+	return strings.Join(s, "")
+}
+
+// Serializes the comments of a route.
+func (r *Route) commentString() string {
+	return commentLines(r.Comments)
+}
+
+// Serializes the metadata of a route as annotations, ordered by name,
+// each followed by a space.
+func (r *Route) metadataString() string {
+	var s []string
+	for _, k := range sortedKeys(r.Metadata) {
+		s = appendFmtEscape(s, `@%s("%s") `, `"`, k, r.Metadata[k])
+	}
+
+	return strings.Join(s, "")
+}
+
+// Serializes a set of routes, with their comments.
 func String(routes ...*Route) string {
 	if len(routes) == 1 && routes[0].Id == "" {
-		return routes[0].String()
+		return routes[0].commentString() + routes[0].String()
 	}
 
 	rs := make([]string, len(routes))
 	for i, r := range routes {
-		rs[i] = fmt.Sprintf("%s: %s", r.Id, r.String())
+		rs[i] = fmt.Sprintf("%s%s%s: %s", r.commentString(), r.metadataString(), r.Id, r.String())
 	}
 
 	return strings.Join(rs, ";\n")
@@ -71,6 +71,12 @@ func TestRouteString(t *testing.T) {
 			Filters: []*Filter{{"static", []interface{}{"/some", "/file"}}},
 			Shunt:   true},
 		`Method("GET") -> static("/some", "/file") -> <shunt>`,
+	}, {
+		&Route{
+			Path:             "/campaign",
+			CustomPredicates: []*Predicate{{"ValidUntil", []interface{}{"2016-01-01T12:00:00Z"}}},
+			Backend:          "https://www.example.org"},
+		`Path("/campaign") && ValidUntil("2016-01-01T12:00:00Z") -> "https://www.example.org"`,
 	}} {
 		rstring := item.route.String()
 		if rstring != item.string {
@@ -87,6 +93,13 @@ func TestRouteExpression(t *testing.T) {
 	}
 }
 
+func TestFilterString(t *testing.T) {
+	f := &Filter{Name: "redirect", Args: []interface{}{float64(302), `https://www.example.org/"q"`}}
+	if f.String() != `redirect(302, "https://www.example.org/\"q\"")` {
+		t.Error("failed to serialize a filter", f.String())
+	}
+}
+
 func TestDocString(t *testing.T) {
 	testDoc(t, `route1: Method("GET") -> filter("expression") -> <shunt>;`+"\n"+
 		`route2: Path("/some/path") -> "https://www.example.org"`)
@@ -99,3 +112,23 @@ func TestParseAndStringAndParse(t *testing.T) {
 	doc = testDoc(t, doc)
 	doc = testDoc(t, doc)
 }
+
+func TestRegexpAndBackendEscaping(t *testing.T) {
+	testDoc(t, `route1: Host(/^www[.]example\/[a-z]+\\/) && PathRegexp(/\.html$/) -> "https://www.example.org/\"q\""`)
+}
+
+func TestDocStringWithComments(t *testing.T) {
+	testDoc(t, "// serves the static content\n//\n// owned by team-a\n"+
+		`route1: Method("GET") -> filter("expression") -> <shunt>;`+"\n"+
+		`route2: Path("/some/path") -> "https://www.example.org";`+"\n"+
+		"// the API\n"+
+		`route3: Path("/api") -> "https://api.example.org"`)
+}
+
+func TestSingleRouteStringWithComments(t *testing.T) {
+	r := NewRoute().Comment("the API").Comment("multiple\nlines").Path("/api").BackendUrl("https://api.example.org").Route()
+	expected := "// the API\n// multiple\n// lines\n" + `Path("/api") -> "https://api.example.org"`
+	if s := String(r); s != expected {
+		t.Error("failed to serialize the comments", s)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "fmt"
+
+func copyFilters(f []*Filter) []*Filter {
+	c := make([]*Filter, len(f))
+	for i, fi := range f {
+		c[i] = fi.Copy()
+	}
+
+	return c
+}
+
+// collects the matchers, the predicate expressions and the filters of
+// the referenced templates, including the templates referenced by the
+// templates, in the order of the references
+func resolveTemplates(names []string, templates map[string]*parsedRoute, visiting map[string]bool) ([]*matcher, []*predicateNode, []*Filter, error) {
+	var (
+		matchers   []*matcher
+		predicates []*predicateNode
+		filters    []*Filter
+	)
+
+	for _, name := range names {
+		t, ok := templates[name]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("unknown template: %s", name)
+		}
+
+		if visiting[name] {
+			return nil, nil, nil, fmt.Errorf("circular template reference: %s", name)
+		}
+
+		visiting[name] = true
+		m, p, f, err := resolveTemplates(t.templates, templates, visiting)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		delete(visiting, name)
+
+		matchers = append(matchers, m...)
+		matchers = append(matchers, t.matchers...)
+		predicates = append(predicates, p...)
+		if t.predicate != nil {
+			predicates = append(predicates, t.predicate.copy())
+		}
+
+		filters = append(filters, f...)
+		filters = append(filters, copyFilters(t.filters)...)
+	}
+
+	return matchers, predicates, filters, nil
+}
+
+// applies the referenced templates to the routes, and returns the routes
+// without the template definitions. The matchers and the predicate
+// expressions of the templates are added to the ones of the route, and the filters of the templates
+// are prepended to the filters of the route.
+func expandTemplates(parsedRoutes []*parsedRoute) ([]*parsedRoute, error) {
+	var routes []*parsedRoute
+	templates := make(map[string]*parsedRoute)
+	for _, r := range parsedRoutes {
+		if !r.template {
+			routes = append(routes, r)
+			continue
+		}
+
+		if _, exists := templates[r.id]; exists {
+			return nil, fmt.Errorf("duplicate template: %s", r.id)
+		}
+
+		templates[r.id] = r
+	}
+
+	for _, r := range routes {
+		if err := applyTemplates(r, templates); err != nil {
+			return nil, err
+		}
+	}
+
+	return routes, nil
+}
+
+// adds the matchers and the filters of the referenced templates to a
+// route
+func applyTemplates(r *parsedRoute, templates map[string]*parsedRoute) error {
+	if len(r.templates) == 0 {
+		return nil
+	}
+
+	m, p, f, err := resolveTemplates(r.templates, templates, make(map[string]bool))
+	if err != nil {
+		return err
+	}
+
+	r.matchers = append(m, r.matchers...)
+	if r.predicate != nil {
+		p = append(p, r.predicate)
+	}
+
+	r.predicate = conjunction(p)
+	r.filters = append(f, r.filters...)
+	r.templates = nil
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+const testTemplates = `
+	@auth: Header("Authorization", "Basic dGVzdDp0ZXN0") -> requestHeader("X-Authenticated", "true");
+	@logged: Any() -> responseHeader("X-Logged", "true");
+	@authLogged: @logged && @auth -> responseHeader("X-Template", "authLogged");
+`
+
+func TestTemplatePredicatesAndFilters(t *testing.T) {
+	r, err := Parse(testTemplates + `
+		route1: @auth && Path("/api") -> modPath("^/api", "") -> "https://api.example.org";
+	`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 {
+		t.Error("failed to parse routes", len(r))
+		return
+	}
+
+	if r[0].Path != "/api" || r[0].Headers["Authorization"] != "Basic dGVzdDp0ZXN0" {
+		t.Error("failed to apply template predicates")
+	}
+
+	if len(r[0].Filters) != 2 ||
+		r[0].Filters[0].Name != "requestHeader" ||
+		r[0].Filters[1].Name != "modPath" {
+		t.Error("failed to apply template filters")
+	}
+}
+
+func TestTemplateExtendsTemplates(t *testing.T) {
+	r, err := Parse(testTemplates + `
+		route1: Path("/") && @authLogged -> "https://www.example.org";
+	`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(r) != 1 || r[0].Headers["Authorization"] == "" {
+		t.Error("failed to apply templates")
+		return
+	}
+
+	var names []string
+	for _, f := range r[0].Filters {
+		names = append(names, f.Name)
+	}
+
+	if len(names) != 3 ||
+		names[0] != "responseHeader" ||
+		names[1] != "requestHeader" ||
+		names[2] != "responseHeader" ||
+		r[0].Filters[2].Args[1] != "authLogged" {
+		t.Error("invalid filter order", names)
+	}
+}
+
+func TestTemplateFiltersNotShared(t *testing.T) {
+	r, err := Parse(testTemplates + `
+		route1: @auth && Path("/a") -> <shunt>;
+		route2: @auth && Path("/b") -> <shunt>;
+	`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	r[0].Filters[0].Args[0] = "X-Changed"
+	if r[1].Filters[0].Args[0] != "X-Authenticated" {
+		t.Error("filters shared between routes")
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for _, ti := range []struct {
+		msg  string
+		code string
+	}{{
+		"unknown template",
+		`route1: @auth && Path("/") -> <shunt>`,
+	}, {
+		"duplicate template",
+		`@t: Any(); @t: Path("/"); route1: @t -> <shunt>`,
+	}, {
+		"circular reference",
+		`@t1: @t2 -> f1(); @t2: @t1 -> f2(); route1: @t1 -> <shunt>`,
+	}, {
+		"template with backend",
+		`@t: Any() -> "https://www.example.org"`,
+	}} {
+		if _, err := Parse(ti.code); err == nil {
+			t.Error(ti.msg, "failed to fail")
+		}
+	}
+}
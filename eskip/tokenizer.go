@@ -0,0 +1,224 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The kind of a token returned by the Tokenizer.
+type TokenKind int
+
+const (
+
+	// A character that doesn't start any valid token.
+	TokenInvalid TokenKind = iota
+
+	// A comment, from '//' until the end of the line, without the line
+	// break.
+	TokenComment
+
+	TokenAnd         // &&
+	TokenArrow       // ->
+	TokenCloseAngle  // >
+	TokenCloseParen  // )
+	TokenColon       // :
+	TokenComma       // ,
+	TokenDynamic     // <dynamic>
+	TokenEquals      // =
+	TokenLoopback    // <loopback>
+	TokenNot         // !
+	TokenNumber      // e.g. 3.14
+	TokenOpenParen   // (
+	TokenOpenSplit   // <split
+	TokenOr          // ||
+	TokenRegexp      // e.g. /^\/api/
+	TokenSemicolon   // ;
+	TokenShunt       // <shunt>
+	TokenString      // e.g. "https://www.example.org" or `raw`
+	TokenSymbol      // e.g. route ids, predicate and filter names
+	TokenTemplateRef // e.g. @auth
+	TokenVariableRef // e.g. $backend
+)
+
+var tokenKindNames = map[TokenKind]string{
+	TokenInvalid:     "invalid",
+	TokenComment:     "comment",
+	TokenAnd:         "and",
+	TokenArrow:       "arrow",
+	TokenCloseAngle:  "closeangle",
+	TokenCloseParen:  "closeparen",
+	TokenColon:       "colon",
+	TokenComma:       "comma",
+	TokenDynamic:     "dynamic",
+	TokenEquals:      "equals",
+	TokenLoopback:    "loopback",
+	TokenNot:         "not",
+	TokenNumber:      "number",
+	TokenOpenParen:   "openparen",
+	TokenOpenSplit:   "opensplit",
+	TokenOr:          "or",
+	TokenRegexp:      "regexp",
+	TokenSemicolon:   "semicolon",
+	TokenShunt:       "shunt",
+	TokenString:      "string",
+	TokenSymbol:      "symbol",
+	TokenTemplateRef: "templateref",
+	TokenVariableRef: "variableref"}
+
+// maps the tokens of the parser to the public token kinds
+var parserTokenKinds = map[int]TokenKind{
+	and:           TokenAnd,
+	arrow:         TokenArrow,
+	closeangle:    TokenCloseAngle,
+	closeparen:    TokenCloseParen,
+	colon:         TokenColon,
+	comma:         TokenComma,
+	dynamic:       TokenDynamic,
+	equals:        TokenEquals,
+	loopback:      TokenLoopback,
+	not:           TokenNot,
+	number:        TokenNumber,
+	openparen:     TokenOpenParen,
+	opensplit:     TokenOpenSplit,
+	or:            TokenOr,
+	regexpliteral: TokenRegexp,
+	semicolon:     TokenSemicolon,
+	shunt:         TokenShunt,
+	stringliteral: TokenString,
+	symbol:        TokenSymbol,
+	templateref:   TokenTemplateRef,
+	variableref:   TokenVariableRef}
+
+func (k TokenKind) String() string {
+	if n, ok := tokenKindNames[k]; ok {
+		return n
+	}
+
+	return "unknown"
+}
+
+// The position of a token in the document. The line and the column start
+// from 1, and the column is counted in characters, the same way as in
+// ParseError.
+type Position struct {
+	Offset, Line, Column int
+}
+
+// A Token returned by the Tokenizer.
+type Token struct {
+	Kind TokenKind
+
+	// The raw text of the token, e.g. a string literal with its quotes
+	// and escape sequences.
+	Text string
+
+	// The position of the first character of the token, and the
+	// position following its last character.
+	Start, End Position
+}
+
+// Tokenizer splits an eskip document into tokens, e.g. for syntax
+// highlighting or editor tooling. It uses the same token expressions as
+// the parser, but unlike the parser, it returns the comments, too, and
+// it doesn't stop at the invalid characters: they are returned as
+// TokenInvalid, one character at a time, and the tokenization continues
+// with the next character. The whitespace is skipped.
+type Tokenizer struct {
+	code     string
+	position Position
+}
+
+// Creates a tokenizer for an eskip document.
+func NewTokenizer(code string) *Tokenizer {
+	return &Tokenizer{code: code, position: Position{Offset: 0, Line: 1, Column: 1}}
+}
+
+// steps the position over the text
+func (t *Tokenizer) advance(text string) {
+	for _, r := range text {
+		if r == '\n' {
+			t.position.Line++
+			t.position.Column = 1
+		} else {
+			t.position.Column++
+		}
+	}
+
+	t.position.Offset += len(text)
+}
+
+// returns the kind and the length of the token at the start of the code
+func matchTokenAt(code string) (TokenKind, int) {
+	if strings.HasPrefix(code, "//") {
+		n := strings.IndexByte(code, '\n')
+		if n < 0 {
+			n = len(code)
+		}
+
+		return TokenComment, len(strings.TrimSuffix(code[:n], "\r"))
+	}
+
+	// the leading whitespace was already skipped, so the token is the
+	// second capture group of the merged token expression
+	mi := lexerRx.FindStringSubmatchIndex(code)
+	if len(mi) > 0 && mi[4] == 0 && mi[5] > 0 {
+		for _, trx := range lexerTokenRxs {
+			if mi[2*trx.matchIndex] >= 0 && mi[2*trx.matchIndex+1] > mi[2*trx.matchIndex] {
+				return parserTokenKinds[trx.token], mi[5]
+			}
+		}
+	}
+
+	_, n := utf8.DecodeRuneInString(code)
+	return TokenInvalid, n
+}
+
+// Returns the next token of the document, or io.EOF at the end of the
+// document.
+func (t *Tokenizer) Next() (Token, error) {
+	rest := t.code[t.position.Offset:]
+	space := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+	if space < 0 {
+		t.advance(rest)
+		return Token{}, io.EOF
+	}
+
+	t.advance(rest[:space])
+	rest = rest[space:]
+
+	kind, n := matchTokenAt(rest)
+	token := Token{Kind: kind, Text: rest[:n], Start: t.position}
+	t.advance(token.Text)
+	token.End = t.position
+	return token, nil
+}
+
+// Returns all the tokens of a document.
+func Tokenize(code string) []Token {
+	var tokens []Token
+	t := NewTokenizer(code)
+	for {
+		token, err := t.Next()
+		if err == io.EOF {
+			return tokens
+		}
+
+		tokens = append(tokens, token)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"io"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	doc := "// the api\n" +
+		"api: Path(\"/api\") && @auth && PathRegexp(/^\\/v[12]/) -> setTimeout(3.5, $t) -> <shunt>;\n" +
+		"let t = `raw`;\n" +
+		"canary: Any() -> <split 90 \"https://a.example.org\", 10 $b>;\n" +
+		"internal: Any() -> <loopback>; discovered: Any() -> <dynamic>"
+
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenComment, "// the api"},
+		{TokenSymbol, "api"},
+		{TokenColon, ":"},
+		{TokenSymbol, "Path"},
+		{TokenOpenParen, "("},
+		{TokenString, `"/api"`},
+		{TokenCloseParen, ")"},
+		{TokenAnd, "&&"},
+		{TokenTemplateRef, "@auth"},
+		{TokenAnd, "&&"},
+		{TokenSymbol, "PathRegexp"},
+		{TokenOpenParen, "("},
+		{TokenRegexp, `/^\/v[12]/`},
+		{TokenCloseParen, ")"},
+		{TokenArrow, "->"},
+		{TokenSymbol, "setTimeout"},
+		{TokenOpenParen, "("},
+		{TokenNumber, "3.5"},
+		{TokenComma, ","},
+		{TokenVariableRef, "$t"},
+		{TokenCloseParen, ")"},
+		{TokenArrow, "->"},
+		{TokenShunt, "<shunt>"},
+		{TokenSemicolon, ";"},
+		{TokenSymbol, "let"},
+		{TokenSymbol, "t"},
+		{TokenEquals, "="},
+		{TokenString, "`raw`"},
+		{TokenSemicolon, ";"},
+		{TokenSymbol, "canary"},
+		{TokenColon, ":"},
+		{TokenSymbol, "Any"},
+		{TokenOpenParen, "("},
+		{TokenCloseParen, ")"},
+		{TokenArrow, "->"},
+		{TokenOpenSplit, "<split"},
+		{TokenNumber, "90"},
+		{TokenString, `"https://a.example.org"`},
+		{TokenComma, ","},
+		{TokenNumber, "10"},
+		{TokenVariableRef, "$b"},
+		{TokenCloseAngle, ">"},
+		{TokenSemicolon, ";"},
+		{TokenSymbol, "internal"},
+		{TokenColon, ":"},
+		{TokenSymbol, "Any"},
+		{TokenOpenParen, "("},
+		{TokenCloseParen, ")"},
+		{TokenArrow, "->"},
+		{TokenLoopback, "<loopback>"},
+		{TokenSemicolon, ";"},
+		{TokenSymbol, "discovered"},
+		{TokenColon, ":"},
+		{TokenSymbol, "Any"},
+		{TokenOpenParen, "("},
+		{TokenCloseParen, ")"},
+		{TokenArrow, "->"},
+		{TokenDynamic, "<dynamic>"},
+	}
+
+	tokens := Tokenize(doc)
+	if len(tokens) != len(expected) {
+		t.Fatal("invalid number of tokens", len(tokens), tokens)
+	}
+
+	for i, e := range expected {
+		if tokens[i].Kind != e.kind || tokens[i].Text != e.text {
+			t.Error("invalid token", i, tokens[i].Kind, tokens[i].Text, e.kind, e.text)
+		}
+
+		if doc[tokens[i].Start.Offset:tokens[i].End.Offset] != e.text {
+			t.Error("invalid token offsets", i, tokens[i].Start, tokens[i].End)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	tokens := Tokenize("route1: Path(\"/ü\")\r\n\t-> <shunt> // done\r\n")
+	expected := []struct {
+		start, end Position
+	}{
+		{Position{0, 1, 1}, Position{6, 1, 7}},
+		{Position{6, 1, 7}, Position{7, 1, 8}},
+		{Position{8, 1, 9}, Position{12, 1, 13}},
+		{Position{12, 1, 13}, Position{13, 1, 14}},
+		{Position{13, 1, 14}, Position{18, 1, 18}},
+		{Position{18, 1, 18}, Position{19, 1, 19}},
+		{Position{22, 2, 2}, Position{24, 2, 4}},
+		{Position{25, 2, 5}, Position{32, 2, 12}},
+		{Position{33, 2, 13}, Position{40, 2, 20}},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatal("invalid number of tokens", len(tokens), tokens)
+	}
+
+	for i, e := range expected {
+		if tokens[i].Start != e.start || tokens[i].End != e.end {
+			t.Error("invalid position", i, tokens[i].Text, tokens[i].Start, tokens[i].End, e.start, e.end)
+		}
+	}
+}
+
+func TestTokenizeInvalid(t *testing.T) {
+	tokens := Tokenize(`route1: Path("/") -> #ü -> <shunt>`)
+	var invalid []string
+	for _, token := range tokens {
+		if token.Kind == TokenInvalid {
+			invalid = append(invalid, token.Text)
+		}
+	}
+
+	if len(invalid) != 2 || invalid[0] != "#" || invalid[1] != "ü" {
+		t.Error("failed to return the invalid characters", invalid)
+	}
+
+	if last := tokens[len(tokens)-1]; last.Kind != TokenShunt {
+		t.Error("failed to continue after the invalid characters", last.Kind)
+	}
+}
+
+func TestTokenizerEOF(t *testing.T) {
+	tz := NewTokenizer("  \n ")
+	for i := 0; i < 2; i++ {
+		if _, err := tz.Next(); err != io.EOF {
+			t.Error("failed to return EOF", err)
+		}
+	}
+}
+
+func TestTokenKindString(t *testing.T) {
+	if TokenArrow.String() != "arrow" || TokenKind(-1).String() != "unknown" {
+		t.Error("invalid token kind names")
+	}
+}
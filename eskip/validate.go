@@ -0,0 +1,229 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// a definition of the validated document, with the lexer that parsed
+// it, so that the errors are reported at their position in the
+// document
+type validatedDefinition struct {
+	lexer *eskipLex
+	route *parsedRoute
+}
+
+type parseErrors []ParseError
+
+func (e parseErrors) Len() int           { return len(e) }
+func (e parseErrors) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e parseErrors) Less(i, j int) bool { return e[i].Offset < e[j].Offset }
+
+// the errors of the lexer are always parse errors
+func toParseError(err error) ParseError {
+	return *err.(*ParseError)
+}
+
+// returns the offset of the first token in a definition, skipping the
+// whitespace and the comments
+func codeStart(def string) int {
+	for i := 0; i < len(def); i++ {
+		switch {
+		case strings.HasPrefix(def[i:], "//"):
+			n := strings.IndexByte(def[i:], '\n')
+			if n < 0 {
+				return len(def)
+			}
+
+			i += n
+		case !unicode.IsSpace(rune(def[i])):
+			return i
+		}
+	}
+
+	return len(def)
+}
+
+// creates an error at the start of the definition
+func (d *validatedDefinition) errorf(msg string) ParseError {
+	d.lexer.lastToken = d.route.id
+	d.lexer.errorAt(codeStart(d.lexer.source), msg)
+	return toParseError(d.lexer.err)
+}
+
+// parses the definitions of the document one by one, continuing after
+// the syntax errors with the next definition
+func parseDefinitions(code string) ([]*validatedDefinition, []ParseError) {
+	var (
+		defs []*validatedDefinition
+		errs []ParseError
+	)
+
+	s := ParseReader(strings.NewReader(code))
+	for {
+		def, start, last, _ := s.readDefinition()
+		if def != "" {
+
+			// the terminating semicolon is kept, so that the
+			// incomplete definitions fail at the same token as with
+			// Parse
+			if !last {
+				def += ";"
+			}
+
+			if l, err := lexAndParse(def, start); err != nil {
+				errs = append(errs, toParseError(err))
+			} else {
+				for _, r := range l.routes {
+					defs = append(defs, &validatedDefinition{lexer: l, route: r})
+				}
+			}
+		}
+
+		if last {
+			return defs, errs
+		}
+	}
+}
+
+// collects the variables and the macros, and resolves them in the
+// routes. The definitions failing to resolve are dropped.
+func resolveDefinitions(defs []*validatedDefinition) ([]*validatedDefinition, []ParseError) {
+	var (
+		routes, macros []*validatedDefinition
+		errs           []ParseError
+	)
+
+	s := newSymbols()
+	for _, d := range defs {
+		r := d.route
+		switch {
+		case r.importPath != "":
+			d.lexer.lastToken = r.importPath
+			d.lexer.errorAt(r.position, "import directives are supported only in files")
+			errs = append(errs, toParseError(d.lexer.err))
+		case r.variable:
+			if _, exists := s.variables[r.id]; exists {
+				d.lexer.lastToken = r.id
+				d.lexer.errorAt(r.position, "duplicate variable: "+r.id)
+				errs = append(errs, toParseError(d.lexer.err))
+				continue
+			}
+
+			s.variables[r.id] = r.value
+		case r.macro:
+			if _, exists := s.macros[r.id]; exists {
+				d.lexer.lastToken = r.id
+				d.lexer.errorAt(r.position, "duplicate macro: "+r.id)
+				errs = append(errs, toParseError(d.lexer.err))
+				continue
+			}
+
+			s.macros[r.id] = r
+			macros = append(macros, d)
+		default:
+			routes = append(routes, d)
+		}
+	}
+
+	for _, m := range macros {
+		if err := m.lexer.checkMacro(m.route, s); err != nil {
+			errs = append(errs, toParseError(m.lexer.err))
+		}
+	}
+
+	var resolved []*validatedDefinition
+	for _, d := range routes {
+		if d.route.call != nil {
+			e, err := d.lexer.expandMacro(d.route, s)
+			if err != nil {
+				errs = append(errs, toParseError(d.lexer.err))
+				continue
+			}
+
+			d.route = e
+		} else if err := d.lexer.substituteVariables(d.route, s.variables); err != nil {
+			errs = append(errs, toParseError(d.lexer.err))
+			continue
+		}
+
+		resolved = append(resolved, d)
+	}
+
+	return resolved, errs
+}
+
+// applies the templates, and checks the route definitions
+func checkDefinitions(defs []*validatedDefinition) []ParseError {
+	var (
+		routes []*validatedDefinition
+		errs   []ParseError
+	)
+
+	templates := make(map[string]*parsedRoute)
+	for _, d := range defs {
+		if !d.route.template {
+			routes = append(routes, d)
+			continue
+		}
+
+		if _, exists := templates[d.route.id]; exists {
+			errs = append(errs, d.errorf("duplicate template: "+d.route.id))
+			continue
+		}
+
+		templates[d.route.id] = d.route
+	}
+
+	for _, d := range routes {
+		if d.route.id == "" && len(routes) > 1 {
+			errs = append(errs, d.errorf(errUnnamedRoute.Error()))
+			continue
+		}
+
+		if err := applyTemplates(d.route, templates); err != nil {
+			errs = append(errs, d.errorf(err.Error()))
+			continue
+		}
+
+		if _, err := newRouteDefinition(d.route); err != nil {
+			errs = append(errs, d.errorf(err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// ValidateAll checks a routing document, and returns all the syntax and
+// semantic errors found in it, ordered by their position in the
+// document. Unlike Parse, it doesn't stop at the first error: after a
+// definition with a syntax error, it continues with the next definition,
+// starting after the next semicolon. The definitions with errors are
+// skipped in the further checks, e.g. a route referencing a variable
+// with an invalid definition is reported as referencing an undefined
+// variable. It returns nil when the document is valid.
+func ValidateAll(code string) []ParseError {
+	defs, errs := parseDefinitions(code)
+
+	defs, resolveErrs := resolveDefinitions(defs)
+	errs = append(errs, resolveErrs...)
+	errs = append(errs, checkDefinitions(defs)...)
+
+	sort.Stable(parseErrors(errs))
+	return errs
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import "testing"
+
+func TestValidateAllValid(t *testing.T) {
+	for _, doc := range []string{
+		"",
+		"// only a comment",
+		`Path("/") -> "https://www.example.org"`,
+		`
+			let backend = "https://www.example.org";
+			def api(p) = Path($p) -> $backend;
+			@common: Method("GET") -> requestHeader("X-Common", "true");
+			foo: @common && Path("/foo") -> "https://foo.example.org";
+			bar: api("/bar");`,
+	} {
+		if errs := ValidateAll(doc); len(errs) != 0 {
+			t.Error("unexpected errors", doc, errs)
+		}
+	}
+}
+
+func TestValidateAllSyntaxErrors(t *testing.T) {
+	doc := `
+		route1: Path("/foo") -> <shunt>;
+		route2: Path("/bar") -> ;
+		route3: Path("/baz") -> "https://www.example.org";
+		route4: Path("/qux" -> <shunt>;
+		route5: Path("/quux") -> <shunt>`
+
+	errs := ValidateAll(doc)
+	if len(errs) != 2 {
+		t.Fatal("failed to collect the errors", errs)
+	}
+
+	if errs[0].Line != 3 || errs[1].Line != 5 {
+		t.Error("invalid error lines", errs[0].Line, errs[1].Line)
+	}
+
+	if errs[0].Offset >= errs[1].Offset {
+		t.Error("errors not ordered by offset")
+	}
+
+	if _, err := Parse(doc); err == nil || err.(*ParseError).Offset != errs[0].Offset {
+		t.Error("the first error differs from the error of Parse", err, errs[0])
+	}
+}
+
+func TestValidateAllSemicolonInLiteral(t *testing.T) {
+	errs := ValidateAll(`
+		route1: Path("/foo;bar") -> ;
+		route2: PathRegexp(/a;b/) -> <shunt>;
+		route3: Path("/baz") -> "https://www.example.org" // no; error here
+		-> ;`)
+	if len(errs) != 2 {
+		t.Fatal("failed to collect the errors", errs)
+	}
+
+	if errs[0].Line != 2 || errs[1].Line != 5 {
+		t.Error("invalid error lines", errs[0].Line, errs[1].Line)
+	}
+}
+
+func TestValidateAllSemanticErrors(t *testing.T) {
+	errs := ValidateAll(`
+		let backend = "https://www.example.org";
+		let backend = "https://www.example.com";
+		def api(p) = Path($p) -> $backend;
+		@common: Method("GET") -> requestHeader("X-Common", "true");
+		@common: Method("POST") -> requestHeader("X-Common", "true");
+		route1: Path("/foo") -> $missing;
+		route2: api("/bar", "/baz");
+		route3: undefinedMacro();
+		route4: Method(42) -> <shunt>;
+		route5: Path(42) -> <shunt>;
+		import "other.eskip";
+		route6: @unknown && Path("/ok") -> <shunt>`)
+
+	expect := []struct {
+		line    int
+		message string
+	}{
+		{3, "duplicate variable: backend"},
+		{6, "duplicate template: common"},
+		{7, "undefined variable: missing"},
+		{8, "invalid number of arguments for macro api: 2, expected: 1"},
+		{9, "undefined macro: undefinedMacro"},
+		{10, "invalid matcher parameter"},
+		{11, "invalid matcher parameter"},
+		{12, "import directives are supported only in files"},
+		{13, "unknown template: unknown"},
+	}
+
+	if len(errs) != len(expect) {
+		t.Fatal("invalid number of errors", len(errs), errs)
+	}
+
+	for i, e := range expect {
+		if errs[i].Line != e.line {
+			t.Error("invalid line", i, errs[i].Line, e.line)
+		}
+
+		if e.message != "" && errs[i].Message != e.message {
+			t.Error("invalid message", i, errs[i].Message, e.message)
+		}
+	}
+}
+
+func TestValidateAllUnnamedRoute(t *testing.T) {
+	errs := ValidateAll(`
+		route1: Path("/foo") -> <shunt>;
+		Path("/bar") -> <shunt>`)
+	if len(errs) != 1 || errs[0].Message != errUnnamedRoute.Error() || errs[0].Line != 3 || errs[0].Column != 3 {
+		t.Error("failed to report the unnamed route", errs)
+	}
+}
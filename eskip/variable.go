@@ -0,0 +1,161 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+// the variables and the macros defined in a document
+type symbols struct {
+	variables map[string]interface{}
+	macros    map[string]*parsedRoute
+}
+
+func newSymbols() *symbols {
+	return &symbols{
+		variables: make(map[string]interface{}),
+		macros:    make(map[string]*parsedRoute)}
+}
+
+// returns the value of a referenced variable
+func (l *eskipLex) variableValue(ref *variableRef, vars map[string]interface{}) (interface{}, error) {
+	v, ok := vars[ref.name]
+	if !ok {
+		l.lastToken = "$" + ref.name
+		l.errorAt(ref.position, "undefined variable: "+ref.name)
+		return nil, l.err
+	}
+
+	return v, nil
+}
+
+// replaces the variable references among the arguments with the values
+// of the variables
+func (l *eskipLex) substituteArgs(args []interface{}, vars map[string]interface{}) error {
+	for i, a := range args {
+		ref, ok := a.(*variableRef)
+		if !ok {
+			continue
+		}
+
+		v, err := l.variableValue(ref, vars)
+		if err != nil {
+			return err
+		}
+
+		args[i] = v
+	}
+
+	return nil
+}
+
+// substitutes the variable references in a route or a template
+func (l *eskipLex) substituteVariables(r *parsedRoute, vars map[string]interface{}) error {
+	for _, m := range append(r.allMatchers(), r.annotations...) {
+		if err := l.substituteArgs(m.args, vars); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.filters {
+		if err := l.substituteArgs(f.Args, vars); err != nil {
+			return err
+		}
+	}
+
+	if err := l.substituteArgs(r.split, vars); err != nil {
+		return err
+	}
+
+	if r.backendRef == nil {
+		return nil
+	}
+
+	v, err := l.variableValue(r.backendRef, vars)
+	if err != nil {
+		return err
+	}
+
+	backend, ok := v.(string)
+	if !ok {
+		l.lastToken = "$" + r.backendRef.name
+		l.errorAt(r.backendRef.position, "backend variable is not a string: "+r.backendRef.name)
+		return l.err
+	}
+
+	r.backend = backend
+	r.backendRef = nil
+	return nil
+}
+
+// collects the variable and the macro definitions of the parsed code
+// into s, expands the macro invocations, and substitutes the variable
+// references in the routes and the templates. The variables and the
+// macros can be referenced anywhere in the parsed code, and their
+// definitions are removed from the parsed routes.
+func (l *eskipLex) resolveSymbols(s *symbols) error {
+	var (
+		routes []*parsedRoute
+		macros []*parsedRoute
+	)
+
+	for _, r := range l.routes {
+		switch {
+		case r.variable:
+			if _, exists := s.variables[r.id]; exists {
+				l.lastToken = r.id
+				l.errorAt(r.position, "duplicate variable: "+r.id)
+				return l.err
+			}
+
+			s.variables[r.id] = r.value
+		case r.macro:
+			if _, exists := s.macros[r.id]; exists {
+				l.lastToken = r.id
+				l.errorAt(r.position, "duplicate macro: "+r.id)
+				return l.err
+			}
+
+			s.macros[r.id] = r
+			macros = append(macros, r)
+		default:
+			routes = append(routes, r)
+		}
+	}
+
+	// the macros are checked with the lexer of their source, so that
+	// the errors in their body are reported at the right position
+	for _, m := range macros {
+		if err := l.checkMacro(m, s); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range routes {
+		if r.call != nil {
+			e, err := l.expandMacro(r, s)
+			if err != nil {
+				return err
+			}
+
+			routes[i] = e
+			continue
+		}
+
+		if err := l.substituteVariables(r, s.variables); err != nil {
+			return err
+		}
+	}
+
+	l.routes = routes
+	return nil
+}
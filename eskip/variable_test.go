@@ -0,0 +1,113 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskip
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+const testVariables = `
+	let timeout = 2000;
+	let api = "https://api.example.org";
+	route1: Path("/a") -> timeout($timeout) -> $api;
+	@slow: Any() -> timeout($slowTimeout);
+	route2: @slow && Path($path) -> $api;
+	let slowTimeout = 6000;
+	let path = "/b"`
+
+func TestParseVariables(t *testing.T) {
+	r, err := Parse(testVariables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 2 {
+		t.Fatal("invalid number of routes", len(r))
+	}
+
+	if r[0].Backend != "https://api.example.org" || r[0].Filters[0].Args[0] != float64(2000) {
+		t.Error("failed to substitute the variables", r[0])
+	}
+
+	if r[1].Path != "/b" || r[1].Filters[0].Args[0] != float64(6000) {
+		t.Error("failed to substitute the variables in the template", r[1])
+	}
+}
+
+func TestParseVariableErrors(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		code    string
+		line    int
+		column  int
+		message string
+	}{{
+		"undefined",
+		"let a = 1;\nroute1: Path(\"/\") -> timeout($b) -> <shunt>",
+		2, 30, "undefined variable: b",
+	}, {
+		"undefined backend",
+		"route1: Path(\"/\") -> $backend",
+		1, 22, "undefined variable: backend",
+	}, {
+		"duplicate",
+		"let a = 1;\nlet a = 2",
+		2, 5, "duplicate variable: a",
+	}, {
+		"backend not a string",
+		"let backend = 42;\nroute1: Path(\"/\") -> $backend",
+		2, 22, "backend variable is not a string: backend",
+	}, {
+		"invalid directive",
+		"var a = 1",
+		1, 1, "invalid directive: var",
+	}} {
+		_, err := Parse(ti.code)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Error(ti.msg, "failed to return a parse error", err)
+			continue
+		}
+
+		if perr.Line != ti.line || perr.Column != ti.column || perr.Message != ti.message {
+			t.Error(ti.msg, "invalid error", perr.Line, perr.Column, perr.Message)
+		}
+	}
+}
+
+func TestParseVariableNotValue(t *testing.T) {
+	if _, err := Parse("let a = 1;\nlet b = $a"); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestParseReaderVariables(t *testing.T) {
+	s := ParseReader(strings.NewReader(`
+		let api = "https://api.example.org";
+		route1: Path("/") -> $api;
+		route2: Path("/b") -> $b;
+		let b = "https://b.example.org"`))
+
+	r, err := s.Next()
+	if err != nil || r.Backend != "https://api.example.org" {
+		t.Error("failed to substitute the variable", r, err)
+	}
+
+	if _, err := s.Next(); err == nil || err == io.EOF {
+		t.Error("failed to fail on a variable defined after the route", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskipfile
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the extensions of the route files read from a directory, the eskip
+// files and the compiled route tables
+var routeFileExtensions = []string{".eskip", ".eskipc"}
+
+// the last loaded version of a route file
+type dirFile struct {
+	modTime time.Time
+	size    int64
+	routes  []*eskip.Route
+}
+
+// A DirClient contains the route definitions from the route files of a
+// directory, and reloads them when they change.
+type DirClient struct {
+	dir    string
+	files  map[string]*dirFile
+	routes map[string]*eskip.Route
+}
+
+// Opens a directory containing eskip files, with the .eskip extension,
+// or compiled route tables, with the .eskipc extension, and returns a
+// DataClient serving the routes of all of them. The subdirectories and
+// the other files are ignored, so the imported files can be placed in a
+// subdirectory.
+//
+// The files are checked for changes, by their modification time and
+// size, whenever the routing polls the client for updates, and the
+// changed, added and removed files are applied to the routing table as
+// incremental updates. The files are applied atomically: when a file
+// cannot be parsed, the error is logged with the name of the file and
+// the position of the error, and the previous routes of the file remain
+// active, until it is fixed. To avoid loading partially written files,
+// the files should be replaced by renaming.
+//
+// The route ids need to be unique across the files. When multiple files
+// define the same id, the route from the first file, in the order of the
+// file names, is used, and the duplicates are logged.
+//
+// Returns an error when the directory cannot be read. The invalid files
+// don't prevent opening the directory.
+func OpenDir(dir string) (*DirClient, error) {
+	c := &DirClient{dir: dir, files: make(map[string]*dirFile)}
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+
+	c.routes = c.merge()
+	return c, nil
+}
+
+func isRouteFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	for _, ext := range routeFileExtensions {
+		if filepath.Ext(name) == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loads the new and changed files of the directory, and forgets the
+// removed ones
+func (c *DirClient) scan() error {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, entry := range infos {
+		name := entry.Name()
+		if !isRouteFile(name) {
+			continue
+		}
+
+		// following the symlinks, to detect when only their targets
+		// change, e.g. in a mounted Kubernetes ConfigMap
+		path := filepath.Join(c.dir, name)
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		current[name] = true
+		f, ok := c.files[name]
+		if ok && f.modTime.Equal(fi.ModTime()) && f.size == fi.Size() {
+			continue
+		}
+
+		if !ok {
+			f = &dirFile{}
+			c.files[name] = f
+		}
+
+		// the version is recorded also when the file is invalid, so
+		// that the error is logged only once per change
+		f.modTime, f.size = fi.ModTime(), fi.Size()
+		routes, err := readRoutes(path)
+		if err != nil {
+			log.Errorf("failed to load route file, keeping its previous routes: %v", err)
+			continue
+		}
+
+		f.routes = routes
+	}
+
+	for name := range c.files {
+		if !current[name] {
+			delete(c.files, name)
+		}
+	}
+
+	return nil
+}
+
+// merges the routes of the files, in the order of the file names
+func (c *DirClient) merge() map[string]*eskip.Route {
+	var names []string
+	for name := range c.files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	routes := make(map[string]*eskip.Route)
+	from := make(map[string]string)
+	for _, name := range names {
+		for _, r := range c.files[name].routes {
+			if first, exists := from[r.Id]; exists {
+				log.Errorf("duplicate route id %s in %s, using the route from %s", r.Id, name, first)
+				continue
+			}
+
+			routes[r.Id], from[r.Id] = r, name
+		}
+	}
+
+	return routes
+}
+
+func sortedRoutes(routes map[string]*eskip.Route) []*eskip.Route {
+	var ids []string
+	for id := range routes {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	r := make([]*eskip.Route, len(ids))
+	for i, id := range ids {
+		r[i] = routes[id]
+	}
+
+	return r
+}
+
+// Returns the route definitions of all the files in the directory,
+// reloading the changed files.
+func (c *DirClient) LoadAll() ([]*eskip.Route, error) {
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+
+	c.routes = c.merge()
+	return sortedRoutes(c.routes), nil
+}
+
+// Returns the routes that were added or changed, and the ids of the
+// routes that were removed, since the last call, due to changes of the
+// files in the directory.
+func (c *DirClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	if err := c.scan(); err != nil {
+		return nil, nil, err
+	}
+
+	next := c.merge()
+	upsert := make(map[string]*eskip.Route)
+	for id, r := range next {
+		if previous, ok := c.routes[id]; !ok || !eskip.Eq(previous, r) {
+			upsert[id] = r
+		}
+	}
+
+	var deleted []string
+	for id := range c.routes {
+		if _, ok := next[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+
+	sort.Strings(deleted)
+	c.routes = next
+	return sortedRoutes(upsert), deleted, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskipfile
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeRouteFile(t *testing.T, dir, name, content string, mod time.Time) {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the modification time is set explicitly, because the file system
+	// may not have a fine enough resolution
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func routeIds(routes []*eskip.Route) []string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	return ids
+}
+
+func TestDirClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eskipdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	t0 := time.Now().Add(-time.Hour)
+	writeRouteFile(t, dir, "a.eskip", `foo: Path("/foo") -> "https://foo.example.org";`, t0)
+	writeRouteFile(t, dir, "b.eskip", `bar: Path("/bar") -> "https://bar.example.org";`, t0)
+	writeRouteFile(t, dir, "notes.txt", `not routes`, t0)
+	if err := os.Mkdir(filepath.Join(dir, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := OpenDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := c.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := routeIds(routes); !reflect.DeepEqual(ids, []string{"bar", "foo"}) {
+		t.Fatal("failed to load the routes", ids)
+	}
+
+	// no change
+	{
+		upsert, deleted, err := c.LoadUpdate()
+		if err != nil || len(upsert) != 0 || len(deleted) != 0 {
+			t.Error("unexpected update", upsert, deleted, err)
+		}
+	}
+
+	// changed, added and removed files
+	{
+		t1 := t0.Add(time.Minute)
+		writeRouteFile(t, dir, "a.eskip", `
+			foo: Path("/foo") -> "https://foo.example.org";
+			baz: Path("/baz") -> "https://baz.example.org";`, t1)
+		writeRouteFile(t, dir, "c.eskip", `qux: Path("/qux") -> <shunt>;`, t1)
+		if err := os.Remove(filepath.Join(dir, "b.eskip")); err != nil {
+			t.Fatal(err)
+		}
+
+		upsert, deleted, err := c.LoadUpdate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := routeIds(upsert); !reflect.DeepEqual(ids, []string{"baz", "qux"}) {
+			t.Error("invalid upserts", ids)
+		}
+
+		if !reflect.DeepEqual(deleted, []string{"bar"}) {
+			t.Error("invalid deletes", deleted)
+		}
+	}
+
+	// invalid file keeps its previous routes
+	{
+		writeRouteFile(t, dir, "a.eskip", `
+			foo: Path("/foo") -> "https://foo.example.org";
+			baz: Path("/baz") ->`, t0.Add(2*time.Minute))
+
+		upsert, deleted, err := c.LoadUpdate()
+		if err != nil || len(upsert) != 0 || len(deleted) != 0 {
+			t.Error("unexpected update", upsert, deleted, err)
+		}
+
+		routes, err := c.LoadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := routeIds(routes); !reflect.DeepEqual(ids, []string{"baz", "foo", "qux"}) {
+			t.Error("failed to keep the previous routes", ids)
+		}
+	}
+
+	// duplicate ids, first file wins
+	{
+		writeRouteFile(t, dir, "d.eskip", `foo: Path("/other") -> <shunt>;`, t0.Add(3*time.Minute))
+		upsert, deleted, err := c.LoadUpdate()
+		if err != nil || len(upsert) != 0 || len(deleted) != 0 {
+			t.Error("unexpected update", upsert, deleted, err)
+		}
+	}
+}
+
+func TestDirClientMissingDirectory(t *testing.T) {
+	if _, err := OpenDir("/no/such/directory"); err == nil {
+		t.Error("failed to fail")
+	}
+}
@@ -14,7 +14,13 @@
 
 /*
 Package eskipfile implements a DataClient for reading the skipper route
-definitions from an eskip formatted file when opened.
+definitions from an eskip formatted file when opened. The file can also
+be a compiled route table, created by the eskip compile command, that
+is loaded without parsing.
+
+It also implements a DataClient reading the route files of a directory,
+which detects the changes of the files, and updates the routes without
+restarting the process. See OpenDir.
 
 (See the DataClient interface in the skipper/routing package and the eskip
 format in the skipper/eskip package.)
@@ -22,6 +28,7 @@ format in the skipper/eskip package.)
 package eskipfile
 
 import (
+	"bytes"
 	"github.com/zalando/skipper/eskip"
 	"io/ioutil"
 )
@@ -30,19 +37,33 @@ import (
 type Client struct{ routes []*eskip.Route }
 
 // Opens an eskip file and parses it, returning a DataClient implementation.
-// If reading or parsing the file fails, returns an error.
+// If reading or parsing the file fails, returns an error. When the file
+// starts with a document header, it fails on unsupported format versions
+// and on checksum mismatch. The import directives in the file are
+// resolved. When the file is a compiled route table, it is decoded
+// instead of parsed. (See eskip.ParseDocument, eskip.ParseFile and
+// eskip.ReadCompiled.)
 func Open(path string) (*Client, error) {
-	content, err := ioutil.ReadFile(path)
+	routes, err := readRoutes(path)
 	if err != nil {
 		return nil, err
 	}
 
-	routes, err := eskip.Parse(string(content))
+	return &Client{routes}, nil
+}
+
+// reads the routes of an eskip file or of a compiled route table
+func readRoutes(path string) ([]*eskip.Route, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{routes}, nil
+	if eskip.IsCompiled(data) {
+		return eskip.ReadCompiled(bytes.NewReader(data))
+	}
+
+	return eskip.ParseFile(path)
 }
 
 // Returns the parsed route definitions found in the file.
@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package eskipurl implements a DataClient for reading the skipper route
+definitions from an eskip document, or a compiled route table, served
+over HTTP or HTTPS, e.g. by a configuration service.
+
+The client polls the document with conditional requests, sending the
+ETag of the last received version in the If-None-Match header, so an
+unchanged document is not transferred. When the document changes, only
+the added, changed and removed routes are passed to the routing as an
+incremental update.
+
+When the document cannot be loaded or parsed, the routing keeps the
+previous routes active, and retries loading it on the next poll.
+*/
+package eskipurl
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// The default timeout of the requests for the route document.
+const DefaultTimeout = 30 * time.Second
+
+// Initialization options for the client.
+type Options struct {
+
+	// The URL of the eskip document.
+	URL string
+
+	// Additional headers sent with every request, e.g. the
+	// Authorization header.
+	Headers map[string]string
+
+	// When true, TLS certificate verification is skipped.
+	Insecure bool
+
+	// The timeout of the requests. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// A Client loads the routes from a remote eskip document.
+type Client struct {
+	opts       Options
+	httpClient *http.Client
+	etag       string
+	routes     map[string]*eskip.Route
+}
+
+// Returns a new client. It fails when the URL is not a valid HTTP or
+// HTTPS URL.
+func New(o Options) (*Client, error) {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid route document url: %s", o.URL)
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+
+	return &Client{
+		opts: o,
+		httpClient: &http.Client{
+			Timeout: o.Timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: o.Insecure}}}}, nil
+}
+
+func parseDocument(data []byte) ([]*eskip.Route, error) {
+	if eskip.IsCompiled(data) {
+		return eskip.ReadCompiled(bytes.NewReader(data))
+	}
+
+	return eskip.Parse(string(data))
+}
+
+// requests the document, and returns false when it was not modified
+// since the last request
+func (c *Client) load() (map[string]*eskip.Route, bool, error) {
+	req, err := http.NewRequest("GET", c.opts.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for name, value := range c.opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if c.etag != "" && c.routes != nil {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotModified && c.routes != nil {
+		return c.routes, false, nil
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to load routes from %s: %s", c.opts.URL, rsp.Status)
+	}
+
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	routes, err := parseDocument(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid routes from %s: %v", c.opts.URL, err)
+	}
+
+	m := make(map[string]*eskip.Route)
+	for _, r := range routes {
+		m[r.Id] = r
+	}
+
+	// the ETag is stored only after the document was accepted, so that
+	// an invalid version is requested again
+	c.etag = rsp.Header.Get("ETag")
+	return m, true, nil
+}
+
+func sortedRoutes(routes map[string]*eskip.Route) []*eskip.Route {
+	var ids []string
+	for id := range routes {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	r := make([]*eskip.Route, len(ids))
+	for i, id := range ids {
+		r[i] = routes[id]
+	}
+
+	return r
+}
+
+// Returns all the routes of the document.
+func (c *Client) LoadAll() ([]*eskip.Route, error) {
+	routes, _, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.routes = routes
+	return sortedRoutes(routes), nil
+}
+
+// Returns the added and changed routes, and the ids of the removed
+// routes, since the last received version of the document.
+func (c *Client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	next, changed, err := c.load()
+	if err != nil || !changed {
+		return nil, nil, err
+	}
+
+	upsert := make(map[string]*eskip.Route)
+	for id, r := range next {
+		if previous, ok := c.routes[id]; !ok || !eskip.Eq(previous, r) {
+			upsert[id] = r
+		}
+	}
+
+	var deleted []string
+	for id := range c.routes {
+		if _, ok := next[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+
+	sort.Strings(deleted)
+	c.routes = next
+	return sortedRoutes(upsert), deleted, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eskipurl
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type document struct {
+	mx       sync.Mutex
+	version  int
+	content  string
+	requests int
+	auth     string
+}
+
+func (d *document) set(content string) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.version++
+	d.content = content
+}
+
+func (d *document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.requests++
+	d.auth = r.Header.Get("Authorization")
+
+	etag := fmt.Sprintf(`"v%d"`, d.version)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(d.content))
+}
+
+func routeIds(routes []*eskip.Route) []string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	return ids
+}
+
+func TestInvalidUrl(t *testing.T) {
+	for _, u := range []string{"", "routes.eskip", "ftp://example.org/routes.eskip", "http://"} {
+		if _, err := New(Options{URL: u}); err == nil {
+			t.Error("failed to fail", u)
+		}
+	}
+}
+
+func TestLoadAndUpdate(t *testing.T) {
+	d := &document{}
+	d.set(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";`)
+
+	s := httptest.NewServer(d)
+	defer s.Close()
+
+	c, err := New(Options{URL: s.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := c.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := routeIds(routes); !reflect.DeepEqual(ids, []string{"bar", "foo"}) {
+		t.Error("failed to load the routes", ids)
+	}
+
+	if d.auth != "Bearer secret" {
+		t.Error("failed to send the authentication header", d.auth)
+	}
+
+	// not modified
+	upsert, deleted, err := c.LoadUpdate()
+	if err != nil || len(upsert) != 0 || len(deleted) != 0 {
+		t.Error("unexpected update", upsert, deleted, err)
+	}
+
+	// changed
+	d.set(`
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar2.example.org";
+		baz: Path("/baz") -> <shunt>;`)
+	upsert, deleted, err = c.LoadUpdate()
+	if err != nil || len(deleted) != 0 {
+		t.Fatal("unexpected update", deleted, err)
+	}
+
+	if ids := routeIds(upsert); !reflect.DeepEqual(ids, []string{"bar", "baz"}) {
+		t.Error("invalid upserts", ids)
+	}
+
+	// removed
+	d.set(`baz: Path("/baz") -> <shunt>;`)
+	upsert, deleted, err = c.LoadUpdate()
+	if err != nil || len(upsert) != 0 || !reflect.DeepEqual(deleted, []string{"bar", "foo"}) {
+		t.Error("unexpected update", upsert, deleted, err)
+	}
+
+	// not modified, after reset
+	routes, err = c.LoadAll()
+	if err != nil || !reflect.DeepEqual(routeIds(routes), []string{"baz"}) {
+		t.Error("failed to load the cached routes", routeIds(routes), err)
+	}
+}
+
+func TestInvalidDocument(t *testing.T) {
+	d := &document{}
+	d.set(`foo: Path("/foo") -> <shunt>;`)
+
+	s := httptest.NewServer(d)
+	defer s.Close()
+
+	c, err := New(Options{URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.set(`foo: Path("/foo") ->`)
+	if _, _, err := c.LoadUpdate(); err == nil {
+		t.Error("failed to fail")
+	}
+
+	// the invalid version is requested again
+	requests := d.requests
+	if _, _, err := c.LoadUpdate(); err == nil || d.requests != requests+1 {
+		t.Error("failed to retry the invalid document", err)
+	}
+
+	d.set(`bar: Path("/bar") -> <shunt>;`)
+	upsert, deleted, err := c.LoadUpdate()
+	if err != nil || !reflect.DeepEqual(routeIds(upsert), []string{"bar"}) || !reflect.DeepEqual(deleted, []string{"foo"}) {
+		t.Error("failed to recover", routeIds(upsert), deleted, err)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	c, err := New(Options{URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.LoadAll(); err == nil {
+		t.Error("failed to fail")
+	}
+}
@@ -24,7 +24,33 @@ individual keys as eskip route expressions. When loaded from etcd, the
 routes will get the etcd key as id.
 
 In addition to the DataClient implementation, type Client provides
-methods to Upsert and Delete routes.
+methods to Upsert and Delete routes, implementing the RouteStore
+interface of the routestore package.
+
+Generations
+
+Updating a large set of routes key by key leaves the routing tables of
+the clients in a mixed state, until all the keys are written. To avoid
+this, the complete set of routes can be published as a new generation,
+with the Publish method, or with the eskip publish command. The routes
+of a generation are written to a staging directory first:
+
+	/v2/keys/skipper/generations/<generation>/<route id>
+
+and then the generation pointer, /v2/keys/skipper/generation, is
+switched to the new generation with a single compare-and-swap. The
+clients receive the differences between the two generations as a single
+update. The pointer holds the name of the current generation, followed
+by the name of the previous one, separated by a space. The previous
+generation is kept, so that it can be restored with the Rollback method,
+or the eskip rollback command, while the older generations are deleted.
+
+When the generation pointer is set, the routes are read from the
+current generation, and Upsert and Delete modify the routes of the
+current generation. Otherwise, the routes are read from the routes
+directory:
+
+	/v2/keys/skipper/routes/<route id>
 */
 package etcd
 
@@ -33,107 +59,164 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routestore"
 	"net/http"
 	"path"
+	"strings"
+	"time"
 )
 
-const routesPath = "/routes"
+const (
+	routesPath      = "/routes"
+	generationsPath = "/generations"
+	generationPath  = "/generation"
+
+	generationFormat = "20060102T150405.000000000Z"
 
-// RouteInfo contains a route id, plus the loaded and parsed route or
-// the parse error in case of failure.
-type RouteInfo struct {
+	// etcd error codes
+	errKeyNotFound       = 100
+	errTestFailed        = 101
+	errNodeExist         = 105
+	errEventIndexCleared = 401
+)
 
-	// The route id plus the route data or if parsing was successful.
-	eskip.Route
+var (
+	// Returned by Rollback, when there is no previous generation of
+	// the routes.
+	ErrNoPreviousGeneration = errors.New("no previous generation")
 
-	// The parsing error if the parsing failed.
-	ParseError error
-}
+	// Returned by Publish and Rollback, when the generation pointer was
+	// changed by another client during the operation.
+	ErrGenerationChanged = errors.New("generation changed concurrently")
+)
 
 // A Client is used to load the whole set of routes and the updates from an
 // etcd store.
 type Client struct {
+	root       string
 	routesRoot string
 	etcd       *etcd.Client
 	etcdIndex  uint64
+
+	// the generation and the route definitions last received
+	generation string
+	current    map[string]string
 }
 
-var missingRouteId = errors.New("missing route id")
+// the state of the generation pointer
+type generation struct {
+	exists            bool
+	value             string
+	current, previous string
+	etcdIndex         uint64
+}
 
 // Creates a new Client, connecting to an etcd cluster reachable at 'urls'.
 // The prefix argument specifies the etcd node under which the skipper
 // routes are stored. E.g. if prefix is '/skipper-dev', the route
 // definitions should be stored under /v2/keys/skipper-dev/routes/...
 func New(urls []string, prefix string) *Client {
-	return &Client{prefix + routesPath, etcd.NewClient(urls), 0}
+	return &Client{
+		root:       prefix,
+		routesRoot: prefix + routesPath,
+		etcd:       etcd.NewClient(urls),
+		current:    make(map[string]string)}
 }
 
-// Finds all route expressions in the containing directory node.
-// Prepends the expressions with the etcd key as the route id.
-// Returns a map where the keys are the etcd keys and the values are the
-// eskip route definitions.
-func (c *Client) iterateDefs(n *etcd.Node, highestIndex uint64) (map[string]string, uint64) {
-	if n.ModifiedIndex > highestIndex {
-		highestIndex = n.ModifiedIndex
+func hasErrorCode(err error, code int) bool {
+	eerr, ok := err.(*etcd.EtcdError)
+	return ok && eerr.ErrorCode == code
+}
+
+func (c *Client) generationKey() string {
+	return c.root + generationPath
+}
+
+// returns the directory of the routes of a generation, or the routes
+// directory, when the generation is not set
+func (c *Client) generationRoot(g string) string {
+	if g == "" {
+		return c.routesRoot
 	}
 
-	routes := make(map[string]string)
-	if n.Key == c.routesRoot {
-		for _, ni := range n.Nodes {
-			routesi, hi := c.iterateDefs(ni, highestIndex)
-			for id, r := range routesi {
-				routes[id] = r
-			}
+	return c.root + generationsPath + "/" + g
+}
 
-			highestIndex = hi
-		}
+// reads the generation pointer
+func (c *Client) getGeneration() (*generation, error) {
+	response, err := c.etcd.Get(c.generationKey(), false, false)
+	if hasErrorCode(err, errKeyNotFound) {
+		return &generation{etcdIndex: err.(*etcd.EtcdError).Index}, nil
 	}
 
-	if path.Dir(n.Key) != c.routesRoot {
-		return routes, highestIndex
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generation{exists: true, value: response.Node.Value, etcdIndex: response.EtcdIndex}
+	f := strings.Fields(g.value)
+	if len(f) > 0 {
+		g.current = f[0]
 	}
 
-	id := path.Base(n.Key)
-	r := id + ": " + n.Value
-	return map[string]string{id: r}, highestIndex
+	if len(f) > 1 {
+		g.previous = f[1]
+	}
+
+	return g, nil
 }
 
-// Parses a single route expression, fails if more than one
-// expressions in the data.
-func parseOne(data string) (*eskip.Route, error) {
-	r, err := eskip.Parse(data)
-	if err != nil {
-		return nil, err
+// sets the generation pointer, when it was not changed since it was read
+func (c *Client) setGeneration(g *generation, value string) error {
+	var err error
+	if g.exists {
+		_, err = c.etcd.CompareAndSwap(c.generationKey(), value, 0, g.value, 0)
+	} else {
+		_, err = c.etcd.Create(c.generationKey(), value, 0)
 	}
 
-	if len(r) != 1 {
-		return nil, errors.New("invalid route entry: multiple route expressions")
+	if hasErrorCode(err, errTestFailed) || hasErrorCode(err, errNodeExist) {
+		return ErrGenerationChanged
 	}
 
-	return r[0], nil
+	return err
 }
 
-// Parses a set of eskip routes.
-func parseRoutes(data map[string]string) []*RouteInfo {
-	allInfo := make([]*RouteInfo, len(data))
-	index := 0
-	for id, d := range data {
-		info := &RouteInfo{}
-
-		r, err := parseOne(d)
-		if err == nil {
-			info.Route = *r
-		} else {
-			info.ParseError = err
-		}
+// returns the directory of the routes in the current generation
+func (c *Client) activeRoot() (string, error) {
+	g, err := c.getGeneration()
+	if err != nil {
+		return "", err
+	}
 
-		info.Id = id
+	return c.generationRoot(g.current), nil
+}
 
-		allInfo[index] = info
-		index++
+// Finds all route expressions in the containing directory node.
+// Returns a map where the keys are the etcd keys, used as the route ids,
+// and the values are the eskip route definitions.
+func iterateDefs(root string, n *etcd.Node, highestIndex uint64) (map[string]string, uint64) {
+	if n.ModifiedIndex > highestIndex {
+		highestIndex = n.ModifiedIndex
 	}
 
-	return allInfo
+	routes := make(map[string]string)
+	if n.Key == root {
+		for _, ni := range n.Nodes {
+			routesi, hi := iterateDefs(root, ni, highestIndex)
+			for id, r := range routesi {
+				routes[id] = r
+			}
+
+			highestIndex = hi
+		}
+	}
+
+	if path.Dir(n.Key) != root {
+		return routes, highestIndex
+	}
+
+	return map[string]string{path.Base(n.Key): n.Value}, highestIndex
 }
 
 // Collects all the ids from a set of routes.
@@ -148,101 +231,217 @@ func getRouteIds(data map[string]string) []string {
 	return ids
 }
 
-// Converts route info to route objects logging those whose
-// parsing failed.
-func infoToRoutesLogged(info []*RouteInfo) []*eskip.Route {
-	var routes []*eskip.Route
-	for _, ri := range info {
-		if ri.ParseError == nil {
-			routes = append(routes, &ri.Route)
-		} else {
-			log.Println("error while parsing routes", ri.Id, ri.ParseError)
-		}
-	}
-
-	return routes
-}
-
 // Returns all the route definitions currently stored in etcd,
 // or the parsing error in case of failure.
-func (c *Client) LoadAndParseAll() ([]*RouteInfo, error) {
-	response, err := c.etcd.Get(c.routesRoot, false, true)
+func (c *Client) GetInitial() ([]*routestore.RouteInfo, error) {
+	g, err := c.getGeneration()
 	if err != nil {
 		return nil, err
 	}
 
-	data, etcdIndex := c.iterateDefs(response.Node, 0)
-	if response.EtcdIndex > etcdIndex {
-		etcdIndex = response.EtcdIndex
+	root := c.generationRoot(g.current)
+	response, err := c.etcd.Get(root, false, true)
+	if err != nil {
+		return nil, err
 	}
 
-	c.etcdIndex = etcdIndex
-	return parseRoutes(data), nil
+	// watching from the index of the generation pointer, the changes
+	// made since reading it are received again as updates
+	data, _ := iterateDefs(root, response.Node, 0)
+	c.etcdIndex, c.generation, c.current = g.etcdIndex, g.current, data
+	return routestore.ParseRoutes(data), nil
 }
 
-// Returns all the route definitions currently stored in etcd.
-func (c *Client) LoadAll() ([]*eskip.Route, error) {
-	routeInfo, err := c.LoadAndParseAll()
-	if err != nil {
-		return nil, err
+// Same as GetInitial.
+func (c *Client) LoadAndParseAll() ([]*routestore.RouteInfo, error) {
+	return c.GetInitial()
+}
+
+// reloads all the routes, and returns the differences to the last
+// received ones
+func (c *Client) reload() ([]*routestore.RouteInfo, []string, error) {
+	previous := c.current
+	if _, err := c.GetInitial(); err != nil {
+		return nil, nil, err
 	}
 
-	return infoToRoutesLogged(routeInfo), nil
+	changed, deleted := routestore.Diff(previous, c.current)
+	return routestore.ParseRoutes(changed), deleted, nil
 }
 
-// Returns the updates (upserts and deletes) since the last initial request
-// or update.
+// Returns the updates (upserts and deletes) since the last initial
+// request or update, including the parsing errors.
 //
 // It uses etcd's watch functionality that results in blocking this call
-// until the next change is detected in etcd.
-func (c *Client) LoadUpdate() ([]*eskip.Route, []string, error) {
-	response, err := c.etcd.Watch(c.routesRoot, c.etcdIndex+1, true, nil, nil)
-	if err != nil {
-		return nil, nil, err
-	}
+// until the next change is detected in etcd. The changes of the
+// generations other than the current one are skipped. When the
+// generation pointer changes, the differences between the two
+// generations are returned.
+func (c *Client) GetUpdates() ([]*routestore.RouteInfo, []string, error) {
+	root := c.generationRoot(c.generation)
+	for {
+		response, err := c.etcd.Watch(c.root, c.etcdIndex+1, true, nil, nil)
+		if hasErrorCode(err, errEventIndexCleared) {
+			return c.reload()
+		}
 
-	data, etcdIndex := c.iterateDefs(response.Node, c.etcdIndex)
-	if response.EtcdIndex > etcdIndex {
-		etcdIndex = response.EtcdIndex
-	}
+		if err != nil {
+			return nil, nil, err
+		}
 
-	c.etcdIndex = etcdIndex
+		key := response.Node.Key
+		if key == c.generationKey() || key == root {
+			return c.reload()
+		}
 
-	var (
-		routes     []*eskip.Route
-		deletedIds []string
-	)
+		data, etcdIndex := iterateDefs(root, response.Node, c.etcdIndex)
+		c.etcdIndex = etcdIndex
+		if path.Dir(key) != root {
+			continue
+		}
 
-	if response.Action == "delete" {
-		deletedIds = getRouteIds(data)
-	} else {
-		routeInfo := parseRoutes(data)
-		routes = infoToRoutesLogged(routeInfo)
+		switch response.Action {
+		case "delete", "compareAndDelete", "expire":
+			for id := range data {
+				delete(c.current, id)
+			}
+
+			return nil, getRouteIds(data), nil
+		default:
+			for id, r := range data {
+				c.current[id] = r
+			}
+
+			return routestore.ParseRoutes(data), nil, nil
+		}
 	}
+}
 
-	return routes, deletedIds, nil
+// Returns all the route definitions currently stored in etcd.
+func (c *Client) LoadAll() ([]*eskip.Route, error) {
+	return routestore.LoadAll(c)
+}
+
+// Returns the updates (upserts and deletes) since the last initial request
+// or update.
+//
+// It uses etcd's watch functionality that results in blocking this call
+// until the next change is detected in etcd.
+func (c *Client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return routestore.LoadUpdate(c)
 }
 
-// Inserts or updates a routes in etcd.
+// Inserts or updates a routes in etcd, in the current generation. The
+// route expression is stored with a document header containing the
+// format version and the checksum of the expression.
 func (c *Client) Upsert(r *eskip.Route) error {
 	if r.Id == "" {
-		return missingRouteId
+		return routestore.ErrMissingRouteId
 	}
 
-	_, err := c.etcd.Set(c.routesRoot+"/"+r.Id, r.String(), 0)
+	root, err := c.activeRoot()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.etcd.Set(root+"/"+r.Id, eskip.WithHeader(r.String()), 0)
 	return err
 }
 
-// Deletes a route from etcd.
+// Deletes a route from etcd, from the current generation.
 func (c *Client) Delete(id string) error {
 	if id == "" {
-		return missingRouteId
+		return routestore.ErrMissingRouteId
 	}
 
-	response, err := c.etcd.RawDelete(c.routesRoot+"/"+id, false, false)
+	root, err := c.activeRoot()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.etcd.RawDelete(root+"/"+id, false, false)
 	if response.StatusCode == http.StatusNotFound {
 		return nil
 	}
 
 	return err
 }
+
+// Publishes a complete set of routes as a new generation, and switches
+// the generation pointer to it, keeping the current generation as the
+// previous one, and deleting the older ones. The clients receive the
+// differences between the two generations as a single update. When the
+// pointer was changed by another client in the meantime, the new
+// generation is discarded, and ErrGenerationChanged is returned. Returns
+// the name of the new generation.
+func (c *Client) Publish(routes []*eskip.Route) (string, error) {
+	for _, r := range routes {
+		if r.Id == "" {
+			return "", routestore.ErrMissingRouteId
+		}
+	}
+
+	g, err := c.getGeneration()
+	if err != nil {
+		return "", err
+	}
+
+	name := time.Now().UTC().Format(generationFormat)
+	root := c.generationRoot(name)
+	if err := c.stage(root, routes); err != nil {
+		c.deleteGeneration(root)
+		return "", err
+	}
+
+	if err := c.setGeneration(g, strings.TrimSpace(name+" "+g.current)); err != nil {
+		c.deleteGeneration(root)
+		return "", err
+	}
+
+	if g.previous != "" {
+		c.deleteGeneration(c.generationRoot(g.previous))
+	}
+
+	return name, nil
+}
+
+// writes the routes of a generation to its staging directory
+func (c *Client) stage(root string, routes []*eskip.Route) error {
+	if _, err := c.etcd.CreateDir(root, 0); err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		if _, err := c.etcd.Set(root+"/"+r.Id, eskip.WithHeader(r.String()), 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) deleteGeneration(root string) {
+	if _, err := c.etcd.Delete(root, true); err != nil && !hasErrorCode(err, errKeyNotFound) {
+		log.Errorf("failed to delete generation %s: %v", root, err)
+	}
+}
+
+// Switches the generation pointer back to the previous generation,
+// keeping the current one as the previous, so that calling Rollback
+// again restores it. Returns the name of the restored generation.
+func (c *Client) Rollback() (string, error) {
+	g, err := c.getGeneration()
+	if err != nil {
+		return "", err
+	}
+
+	if g.previous == "" {
+		return "", ErrNoPreviousGeneration
+	}
+
+	if err := c.setGeneration(g, g.previous+" "+g.current); err != nil {
+		return "", err
+	}
+
+	return g.previous, nil
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/etcd/etcdtest"
+	"github.com/zalando/skipper/routestore"
 	"log"
 	"testing"
 )
@@ -231,7 +232,7 @@ func TestReceiveDelete(t *testing.T) {
 func TestUpsertNoId(t *testing.T) {
 	c := New(etcdtest.Urls, "/skippertest")
 	err := c.Upsert(&eskip.Route{})
-	if err != missingRouteId {
+	if err != routestore.ErrMissingRouteId {
 		t.Error("failed to fail")
 	}
 }
@@ -283,7 +284,7 @@ func TestUpsertExisting(t *testing.T) {
 func TestDeleteNoId(t *testing.T) {
 	c := New(etcdtest.Urls, "/skippertest")
 	err := c.Delete("")
-	if err != missingRouteId {
+	if err != routestore.ErrMissingRouteId {
 		t.Error("failed to fail")
 	}
 }
@@ -373,3 +374,124 @@ func TestLoadWithParseFailures(t *testing.T) {
 		t.Error("failed to detect parse error")
 	}
 }
+
+func TestPublishGeneration(t *testing.T) {
+	resetData(t)
+
+	c := New(etcdtest.Urls, "/skippertest")
+	if _, err := c.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(etcdtest.Urls, "/skippertest")
+	g, err := p.Publish([]*eskip.Route{
+		{Id: "catalog", Path: "/catalog", Backend: "https://catalog.example.org"},
+		{Id: "cart", Path: "/cart", Backend: "https://cart.example.org"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g == "" {
+		t.Error("missing generation name")
+	}
+
+	rs, ds, err := c.LoadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) != 2 || !checkBackend(rs, "catalog", "https://catalog.example.org") ||
+		!checkBackend(rs, "cart", "https://cart.example.org") {
+		t.Error("failed to receive the new generation", rs)
+	}
+
+	if !checkDeleted(ds, "pdp") || len(ds) != 1 {
+		t.Error("failed to receive the deleted routes", ds)
+	}
+
+	routes, err := New(etcdtest.Urls, "/skippertest").LoadAll()
+	if err != nil || len(routes) != 2 {
+		t.Error("failed to load the current generation", err, len(routes))
+	}
+}
+
+func TestPublishMissingId(t *testing.T) {
+	deleteData()
+	c := New(etcdtest.Urls, "/skippertest")
+	if _, err := c.Publish([]*eskip.Route{{Path: "/"}}); err != routestore.ErrMissingRouteId {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestUpsertCurrentGeneration(t *testing.T) {
+	deleteData()
+	c := New(etcdtest.Urls, "/skippertest")
+	if _, err := c.Publish([]*eskip.Route{{Id: "route1", Method: "POST", Shunt: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Upsert(&eskip.Route{Id: "route2", Method: "PUT", Shunt: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete("route1"); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := c.LoadAll()
+	if err != nil || len(routes) != 1 || routes[0].Id != "route2" {
+		t.Error("failed to modify the current generation", err, routes)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	deleteData()
+	c := New(etcdtest.Urls, "/skippertest")
+	if _, err := c.Rollback(); err != ErrNoPreviousGeneration {
+		t.Error("failed to fail", err)
+	}
+
+	var generations []string
+	for _, backend := range []string{
+		"https://one.example.org",
+		"https://two.example.org",
+		"https://three.example.org",
+	} {
+		g, err := c.Publish([]*eskip.Route{{Id: "route1", Backend: backend}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generations = append(generations, g)
+	}
+
+	e := etcd.NewClient(etcdtest.Urls)
+	if _, err := e.Get("/skippertest/generations/"+generations[0], false, false); err == nil {
+		t.Error("failed to delete the old generation")
+	}
+
+	l := New(etcdtest.Urls, "/skippertest")
+	if _, err := l.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := c.Rollback()
+	if err != nil || g != generations[1] {
+		t.Fatal("failed to roll back", err, g)
+	}
+
+	rs, _, err := l.LoadUpdate()
+	if err != nil || !checkBackend(rs, "route1", "https://two.example.org") {
+		t.Error("failed to receive the previous generation", err, rs)
+	}
+
+	g, err = c.Rollback()
+	if err != nil || g != generations[2] {
+		t.Fatal("failed to restore the generation", err, g)
+	}
+
+	rs, _, err = l.LoadUpdate()
+	if err != nil || !checkBackend(rs, "route1", "https://three.example.org") {
+		t.Error("failed to receive the restored generation", err, rs)
+	}
+}
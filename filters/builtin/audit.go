@@ -0,0 +1,210 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The header set by the auditSignature filter.
+const AuditHeader = "X-Skipper-Audit"
+
+var (
+	// Returned by VerifyAuditSignature, when the audit header is
+	// missing, malformed or its signature doesn't match.
+	ErrInvalidAuditSignature = errors.New("invalid audit signature")
+
+	// Returned by VerifyAuditSignature, when the audit header is older
+	// than the accepted age.
+	ErrExpiredAuditSignature = errors.New("expired audit signature")
+)
+
+// The verified content of an audit header.
+type AuditInfo struct {
+
+	// The id of the route that forwarded the request.
+	RouteId string
+
+	// The name of the proxy instance that forwarded the request.
+	Instance string
+
+	// The time when the request was forwarded.
+	Time time.Time
+}
+
+type auditSignature struct {
+	key      []byte
+	instance string
+	clock    clock.Clock
+}
+
+// Returns a filter specification whose instances set a signed audit
+// header on the forwarded requests, so that the backends can verify that
+// the request was forwarded by the proxy, and which route forwarded it.
+// The header contains the route id, the time, the name of the proxy
+// instance and an HMAC-SHA256 signature of these together with the
+// method and the URI of the request, e.g.:
+//
+//	X-Skipper-Audit: route=api; ts=1450000000; instance=skipper-1; sig=...
+//
+// Instances expect one or two parameters: the path of a file containing
+// the signature key, and optionally the name of the proxy instance,
+// that defaults to the hostname. An audit header received from the
+// client is replaced. Since the URI of the request is signed, the
+// filter needs to be the last one that changes the path or the query.
+// The backends can check the header with VerifyAuditSignature.
+//
+// Name: "auditSignature".
+func NewAuditSignature() filters.Spec { return &auditSignature{clock: clock.System} }
+
+// "auditSignature"
+func (spec *auditSignature) Name() string { return AuditSignatureName }
+
+func (spec *auditSignature) Description() string {
+	return "Sets a signed audit header on the forwarded requests."
+}
+
+func (spec *auditSignature) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "keyFile", Type: filters.StringType},
+		{Name: "instance", Type: filters.StringType, Optional: true},
+	}
+}
+
+func (spec *auditSignature) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	path, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var instance string
+	if len(config) == 2 {
+		if instance, ok = config[1].(string); !ok || instance == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	} else {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+
+		instance = h
+	}
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s: empty signature key: %s", AuditSignatureName, path)
+	}
+
+	return &auditSignature{key: key, instance: instance, clock: spec.clock}, nil
+}
+
+// the signed content, binding the audit fields to the request
+func auditSignatureOf(key []byte, routeId string, ts int64, instance string, r *http.Request) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d\n%s\n%s\n%s", routeId, ts, instance, r.Method, r.URL.RequestURI())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sets the audit header.
+func (f *auditSignature) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	routeId, _ := ctx.StateBag()[filters.RouteIdKey].(string)
+	ts := f.clock.Now().Unix()
+	r.Header.Set(AuditHeader, fmt.Sprintf(
+		"route=%s; ts=%d; instance=%s; sig=%s",
+		url.QueryEscape(routeId),
+		ts,
+		url.QueryEscape(f.instance),
+		auditSignatureOf(f.key, routeId, ts, f.instance, r)))
+}
+
+// Noop.
+func (f *auditSignature) Response(filters.FilterContext) {}
+
+// parses the fields of an audit header
+func parseAuditHeader(h string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, p := range strings.Split(h, ";") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidAuditSignature
+		}
+
+		v, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			return nil, ErrInvalidAuditSignature
+		}
+
+		fields[kv[0]] = v
+	}
+
+	return fields, nil
+}
+
+// Verifies the audit header of a request received from the proxy, set
+// by the auditSignature filter with the same key. When maxAge is not
+// zero, the headers older than maxAge are rejected. The request needs
+// to have the same method and URI as when it was forwarded.
+func VerifyAuditSignature(key []byte, r *http.Request, maxAge time.Duration) (*AuditInfo, error) {
+	h := r.Header.Get(AuditHeader)
+	if h == "" {
+		return nil, ErrInvalidAuditSignature
+	}
+
+	fields, err := parseAuditHeader(h)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := strconv.ParseInt(fields["ts"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidAuditSignature
+	}
+
+	expected := auditSignatureOf(key, fields["route"], ts, fields["instance"], r)
+	if !hmac.Equal([]byte(expected), []byte(fields["sig"])) {
+		return nil, ErrInvalidAuditSignature
+	}
+
+	t := time.Unix(ts, 0)
+	if maxAge > 0 && time.Since(t) > maxAge {
+		return nil, ErrExpiredAuditSignature
+	}
+
+	return &AuditInfo{RouteId: fields["route"], Instance: fields["instance"], Time: t}, nil
+}
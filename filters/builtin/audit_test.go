@@ -0,0 +1,172 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeAuditKey(t *testing.T, key string) string {
+	f, err := ioutil.TempFile("", "audit-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+	if _, err := f.WriteString(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestAuditSignatureInvalidArgs(t *testing.T) {
+	key := writeAuditKey(t, "secret\n")
+	defer os.Remove(key)
+
+	empty := writeAuditKey(t, " \n")
+	defer os.Remove(empty)
+
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{key, 42},
+		{key, ""},
+		{key, "skipper-1", "foo"},
+		{"/no/such/file", "skipper-1"},
+		{empty, "skipper-1"},
+	} {
+		if _, err := NewAuditSignature().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestAuditSignatureDefaultInstance(t *testing.T) {
+	key := writeAuditKey(t, "secret")
+	defer os.Remove(key)
+
+	f, err := NewAuditSignature().CreateFilter([]interface{}{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h, _ := os.Hostname(); f.(*auditSignature).instance != h {
+		t.Error("failed to use the hostname as the instance", f.(*auditSignature).instance)
+	}
+}
+
+func signedAuditRequest(t *testing.T, c clock.Clock) *http.Request {
+	key := writeAuditKey(t, "secret\n")
+	defer os.Remove(key)
+
+	spec := &auditSignature{clock: c}
+	f, err := spec.CreateFilter([]interface{}{key, "skipper-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "https://www.example.org/api/orders?page=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set(AuditHeader, "route=spoofed; ts=0; instance=client; sig=foo")
+	f.Request(&filtertest.Context{
+		FRequest:  r,
+		FStateBag: map[string]interface{}{filters.RouteIdKey: "orders api"}})
+	return r
+}
+
+func TestAuditSignatureVerify(t *testing.T) {
+	now := time.Now()
+	r := signedAuditRequest(t, clock.NewFake(now))
+
+	if strings.Contains(r.Header.Get(AuditHeader), "spoofed") {
+		t.Error("failed to replace the audit header of the client")
+	}
+
+	info, err := VerifyAuditSignature([]byte("secret"), r, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.RouteId != "orders api" || info.Instance != "skipper-1" || info.Time.Unix() != now.Unix() {
+		t.Error("invalid audit info", info)
+	}
+}
+
+func TestAuditSignatureTampered(t *testing.T) {
+	for _, ti := range []struct {
+		msg    string
+		key    string
+		modify func(*http.Request)
+	}{{
+		"different key",
+		"other",
+		func(*http.Request) {},
+	}, {
+		"different path",
+		"secret",
+		func(r *http.Request) { r.URL.Path = "/api/users" },
+	}, {
+		"different query",
+		"secret",
+		func(r *http.Request) { r.URL.RawQuery = "page=3" },
+	}, {
+		"different method",
+		"secret",
+		func(r *http.Request) { r.Method = "DELETE" },
+	}, {
+		"different route",
+		"secret",
+		func(r *http.Request) {
+			r.Header.Set(AuditHeader, strings.Replace(r.Header.Get(AuditHeader), "route=orders", "route=admin", 1))
+		},
+	}, {
+		"missing header",
+		"secret",
+		func(r *http.Request) { r.Header.Del(AuditHeader) },
+	}, {
+		"malformed header",
+		"secret",
+		func(r *http.Request) { r.Header.Set(AuditHeader, "foo") },
+	}} {
+		r := signedAuditRequest(t, clock.System)
+		ti.modify(r)
+		if _, err := VerifyAuditSignature([]byte(ti.key), r, 0); err != ErrInvalidAuditSignature {
+			t.Error(ti.msg, "failed to detect the invalid signature", err)
+		}
+	}
+}
+
+func TestAuditSignatureExpired(t *testing.T) {
+	r := signedAuditRequest(t, clock.NewFake(time.Now().Add(-time.Hour)))
+	if _, err := VerifyAuditSignature([]byte("secret"), r, time.Minute); err != ErrExpiredAuditSignature {
+		t.Error("failed to detect the expired signature", err)
+	}
+
+	if _, err := VerifyAuditSignature([]byte("secret"), r, 0); err != nil {
+		t.Error("failed to accept the signature without max age", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/url"
+	"strings"
+)
+
+// sets a single string value in the state bag, used by the proxy to
+// override the settings of the backend request
+type backendOverride struct {
+	name  string
+	key   string
+	valid func(string) bool
+	value string
+}
+
+func validBackendScheme(s string) bool {
+	return s == "http" || s == "https" || s == "h2c" || s == "grpc"
+}
+
+func validBackendHost(h string) bool {
+	u, err := url.Parse("//" + h)
+	return err == nil && h != "" && u.Host == h
+}
+
+func validTlsServerName(n string) bool {
+	return n != "" && !strings.ContainsAny(n, ":/ ")
+}
+
+func validBackendProtocol(p string) bool {
+	return p == "http1" || p == "http2"
+}
+
+// Returns a filter specification whose instances override the scheme
+// of the backend request, e.g. to use https for a backend defined with
+// an http address. Besides http and https, it accepts h2c, for
+// cleartext HTTP/2, and grpc, for HTTP/2 with TLS:
+//
+//     backendScheme("https")
+//
+// Name: "backendScheme".
+func NewBackendScheme() filters.Spec {
+	return &backendOverride{
+		name:  BackendSchemeName,
+		key:   filters.BackendSchemeKey,
+		valid: validBackendScheme}
+}
+
+// Returns a filter specification whose instances override the network
+// address that the backend request is sent to, without changing the
+// Host header of the request, e.g. when fronting shared ingress
+// endpoints:
+//
+//     backendHost("internal.cluster.local:8443")
+//
+// Name: "backendHost".
+func NewBackendHost() filters.Spec {
+	return &backendOverride{
+		name:  BackendHostName,
+		key:   filters.BackendHostKey,
+		valid: validBackendHost}
+}
+
+// Returns a filter specification whose instances override the TLS
+// server name of the backend connections. It is sent as SNI, and the
+// certificate of the backend is verified against it, instead of the
+// backend host:
+//
+//     tlsServerName("public.example.org")
+//
+// Name: "tlsServerName".
+func NewTlsServerName() filters.Spec {
+	return &backendOverride{
+		name:  TlsServerNameName,
+		key:   filters.TlsServerNameKey,
+		valid: validTlsServerName}
+}
+
+// Returns a filter specification whose instances select the protocol
+// of the backend request, http1 or http2, regardless of the scheme of
+// the backend address. With http2, the https backends are requested
+// over HTTP/2 with TLS, and the http backends over cleartext HTTP/2
+// (h2c), e.g. for gRPC services:
+//
+//     backendProtocol("http2")
+//
+// Name: "backendProtocol".
+func NewBackendProtocol() filters.Spec {
+	return &backendOverride{
+		name:  BackendProtocolName,
+		key:   filters.BackendProtocolKey,
+		valid: validBackendProtocol}
+}
+
+func (spec *backendOverride) Name() string { return spec.name }
+
+func (spec *backendOverride) Description() string {
+	switch spec.name {
+	case BackendSchemeName:
+		return "Overrides the scheme of the backend request."
+	case BackendHostName:
+		return "Overrides the network address of the backend request, keeping the Host header."
+	case BackendProtocolName:
+		return "Selects the protocol of the backend request, HTTP/1.1 or HTTP/2."
+	default:
+		return "Overrides the TLS server name of the backend connections."
+	}
+}
+
+func (spec *backendOverride) Signature() string {
+	switch spec.name {
+	case BackendSchemeName:
+		return "scheme string"
+	case BackendHostName:
+		return "host string"
+	case BackendProtocolName:
+		return "protocol string"
+	default:
+		return "serverName string"
+	}
+}
+
+func (spec *backendOverride) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	v, ok := config[0].(string)
+	if !ok || !spec.valid(v) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &backendOverride{name: spec.name, key: spec.key, value: v}, nil
+}
+
+// Sets the override in the state bag.
+func (f *backendOverride) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[f.key] = f.value
+}
+
+// Noop.
+func (f *backendOverride) Response(ctx filters.FilterContext) {}
@@ -0,0 +1,70 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+)
+
+func TestBackendOverrideInvalidConfig(t *testing.T) {
+	for _, ti := range []struct {
+		spec   filters.Spec
+		config []interface{}
+	}{
+		{NewBackendScheme(), nil},
+		{NewBackendScheme(), []interface{}{"ftp"}},
+		{NewBackendScheme(), []interface{}{"https", "http"}},
+		{NewBackendHost(), []interface{}{""}},
+		{NewBackendHost(), []interface{}{"https://internal.example.org"}},
+		{NewBackendHost(), []interface{}{"internal.example.org/path"}},
+		{NewBackendHost(), []interface{}{42}},
+		{NewTlsServerName(), []interface{}{""}},
+		{NewTlsServerName(), []interface{}{"www.example.org:443"}},
+		{NewBackendProtocol(), []interface{}{"spdy"}},
+	} {
+		if _, err := ti.spec.CreateFilter(ti.config); err == nil {
+			t.Error("failed to fail", ti.spec.Name(), ti.config)
+		}
+	}
+}
+
+func TestBackendOverride(t *testing.T) {
+	for _, ti := range []struct {
+		spec  filters.Spec
+		value string
+		key   string
+	}{
+		{NewBackendScheme(), "https", filters.BackendSchemeKey},
+		{NewBackendHost(), "internal.example.org:8443", filters.BackendHostKey},
+		{NewBackendHost(), "10.0.0.1", filters.BackendHostKey},
+		{NewTlsServerName(), "public.example.org", filters.TlsServerNameKey},
+		{NewBackendScheme(), "grpc", filters.BackendSchemeKey},
+		{NewBackendProtocol(), "http2", filters.BackendProtocolKey},
+	} {
+		f, err := ti.spec.CreateFilter([]interface{}{ti.value})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		c := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(c)
+		if v, _ := c.FStateBag[ti.key].(string); v != ti.value {
+			t.Error("failed to set the override", ti.spec.Name(), v)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import "github.com/zalando/skipper/filters"
+
+type responseBandwidth struct {
+	rate int64
+}
+
+// Returns a filter specification whose instances limit the bandwidth
+// shared by the response bodies of a route. The proxy divides the
+// bandwidth fairly between the responses of the route streamed at the
+// same time, so that a few large downloads over slow links can't take
+// it all. The limit applies in addition to the global response
+// bandwidth of the proxy.
+//
+// Instances expect one parameter, the bandwidth in bytes per second,
+// e.g.:
+//
+//     responseBandwidth(1048576)
+//
+// Name: "responseBandwidth".
+func NewResponseBandwidth() filters.Spec { return &responseBandwidth{} }
+
+// "responseBandwidth"
+func (spec *responseBandwidth) Name() string { return ResponseBandwidthName }
+
+func (spec *responseBandwidth) Description() string {
+	return "Limits the bandwidth shared by the response bodies of the route."
+}
+
+func (spec *responseBandwidth) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "bytesPerSecond", Type: filters.NumberType}}
+}
+
+func (spec *responseBandwidth) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	rate, ok := config[0].(float64)
+	if !ok || rate < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &responseBandwidth{rate: int64(rate)}, nil
+}
+
+// Sets the bandwidth of the route for the proxy.
+func (f *responseBandwidth) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.ResponseBandwidthKey] = f.rate
+}
+
+// Noop.
+func (f *responseBandwidth) Response(filters.FilterContext) {}
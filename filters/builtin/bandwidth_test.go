@@ -0,0 +1,47 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+)
+
+func TestResponseBandwidthInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"1024"},
+		{0.0},
+		{1024.0, 2048.0},
+	} {
+		if _, err := NewResponseBandwidth().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestResponseBandwidth(t *testing.T) {
+	f, err := NewResponseBandwidth().CreateFilter([]interface{}{1024.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	if ctx.StateBag()[filters.ResponseBandwidthKey] != int64(1024) {
+		t.Error("failed to set the bandwidth")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBasicAuthRealm = "skipper"
+
+	// the time after which the password file is checked for changes
+	basicAuthCheckInterval = 10 * time.Second
+)
+
+// the users of a password file, reloaded when the file changes
+type htpasswd struct {
+	path      string
+	mx        sync.Mutex
+	users     map[string][]byte
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+
+	// incremented on every reload
+	generation int
+
+	// the credentials verified with the current users, to avoid the
+	// cost of bcrypt on every request
+	verified map[[sha256.Size]byte]bool
+}
+
+type basicAuth struct {
+	clock clock.Clock
+	mx    sync.Mutex
+	files map[string]*htpasswd
+}
+
+type basicAuthFilter struct {
+	clock     clock.Clock
+	passwords *htpasswd
+	challenge string
+}
+
+// Returns a filter specification whose instances authenticate the
+// requests with HTTP basic authentication, against the users of an
+// htpasswd file, and reject the unauthenticated requests with 401
+// Unauthorized. Instances expect the path of the file, and optionally
+// the realm sent to the clients, e.g.:
+//
+//     basicAuth("/etc/skipper/htpasswd", "admin")
+//
+// Only the bcrypt hashes are supported, as created with htpasswd -B,
+// the lines with other hashes are ignored. The file is checked for
+// changes at most every 10 seconds, and reloaded when it has changed.
+// When the reload fails, the previous users are kept.
+//
+// Name: "basicAuth".
+func NewBasicAuth() filters.Spec {
+	return &basicAuth{clock: clock.System, files: make(map[string]*htpasswd)}
+}
+
+// "basicAuth"
+func (spec *basicAuth) Name() string { return BasicAuthName }
+
+func (spec *basicAuth) Description() string {
+	return "Authenticates the requests with basic authentication against an htpasswd file."
+}
+
+func (spec *basicAuth) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "file", Type: filters.StringType},
+		{Name: "realm", Type: filters.StringType, Optional: true},
+	}
+}
+
+// parses an htpasswd file, keeping only the bcrypt hashes
+func parseHtpasswd(data []byte) map[string][]byte {
+	users := make(map[string][]byte)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		userAndHash := strings.SplitN(line, ":", 2)
+		if len(userAndHash) != 2 || !strings.HasPrefix(userAndHash[1], "$2") {
+			continue
+		}
+
+		users[userAndHash[0]] = []byte(userAndHash[1])
+	}
+
+	return users
+}
+
+// reloads the file when it has changed since the last load
+func (h *htpasswd) load(fi os.FileInfo) error {
+	if !h.modTime.IsZero() && fi.ModTime().Equal(h.modTime) && fi.Size() == h.size {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+
+	h.users = parseHtpasswd(data)
+	h.generation++
+	h.verified = make(map[[sha256.Size]byte]bool)
+	h.modTime, h.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// checks the file for changes, unless it was checked recently
+func (h *htpasswd) check(now time.Time) error {
+	if !h.lastCheck.IsZero() && now.Sub(h.lastCheck) < basicAuthCheckInterval {
+		return nil
+	}
+
+	h.lastCheck = now
+	fi, err := os.Stat(h.path)
+	if err != nil {
+		return err
+	}
+
+	return h.load(fi)
+}
+
+// verifies the credentials with the current users. The bcrypt hashes
+// are compared without holding the lock, so that the concurrent
+// requests don't wait for each other.
+func (h *htpasswd) verify(now time.Time, user, password string) bool {
+	h.mx.Lock()
+	if err := h.check(now); err != nil {
+		log.Errorf("failed to load password file %s: %v", h.path, err)
+	}
+
+	hash, ok := h.users[user]
+	key := sha256.Sum256([]byte(strconv.Itoa(len(user)) + ":" + user + password))
+	verified, generation := h.verified[key], h.generation
+	h.mx.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	if verified {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+
+	h.mx.Lock()
+	if h.generation == generation {
+		h.verified[key] = true
+	}
+
+	h.mx.Unlock()
+	return true
+}
+
+func (spec *basicAuth) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	path, ok := config[0].(string)
+	if !ok || path == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	realm := defaultBasicAuthRealm
+	if len(config) == 2 {
+		if realm, ok = config[1].(string); !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	spec.mx.Lock()
+	h, ok := spec.files[path]
+	if !ok {
+		h = &htpasswd{path: path}
+		spec.files[path] = h
+	}
+
+	spec.mx.Unlock()
+
+	return &basicAuthFilter{
+		clock:     spec.clock,
+		passwords: h,
+		challenge: `Basic realm="` + strings.Replace(realm, `"`, `\"`, -1) + `"`,
+	}, nil
+}
+
+// Rejects the requests without valid credentials.
+func (f *basicAuthFilter) Request(ctx filters.FilterContext) {
+	user, password, ok := ctx.Request().BasicAuth()
+	if ok && f.passwords.verify(f.clock.Now(), user, password) {
+		return
+	}
+
+	w := ctx.ResponseWriter()
+	w.Header().Set("WWW-Authenticate", f.challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+	ctx.MarkServed()
+}
+
+// Noop.
+func (f *basicAuthFilter) Response(filters.FilterContext) {}
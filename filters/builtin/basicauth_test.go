@@ -0,0 +1,191 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters/filtertest"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func htpasswdLine(t *testing.T, user, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user + ":" + string(hash) + "\n"
+}
+
+func writeHtpasswd(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func testBasicAuth(t *testing.T, spec *basicAuth, args []interface{}, user, password string) *filtertest.Context {
+	f, err := spec.CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	ctx := &filtertest.Context{
+		FRequest:        req,
+		FResponseWriter: httptest.NewRecorder(),
+		FStateBag:       make(map[string]interface{}),
+	}
+
+	f.Request(ctx)
+	return ctx
+}
+
+func TestBasicAuthInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{nil, {""}, {42}, {"/etc/htpasswd", 42}, {"/etc/htpasswd", "realm", "foo"}} {
+		if _, err := NewBasicAuth().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	path := writeHtpasswd(t,
+		"# comment\n"+
+			htpasswdLine(t, "alice", "secret")+
+			"bob:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=\n")
+	defer os.Remove(path)
+
+	for _, ti := range []struct {
+		title    string
+		args     []interface{}
+		user     string
+		password string
+		rejected bool
+		realm    string
+	}{{
+		title: "valid credentials",
+		user:  "alice", password: "secret",
+	}, {
+		title: "invalid password",
+		user:  "alice", password: "wrong",
+		rejected: true,
+		realm:    `Basic realm="skipper"`,
+	}, {
+		title: "unknown user",
+		user:  "carol", password: "secret",
+		rejected: true,
+		realm:    `Basic realm="skipper"`,
+	}, {
+		title: "unsupported hash",
+		user:  "bob", password: "123456",
+		rejected: true,
+		realm:    `Basic realm="skipper"`,
+	}, {
+		title:    "missing credentials",
+		rejected: true,
+		realm:    `Basic realm="skipper"`,
+	}, {
+		title:    "custom realm",
+		args:     []interface{}{"admin"},
+		rejected: true,
+		realm:    `Basic realm="admin"`,
+	}} {
+		spec := NewBasicAuth().(*basicAuth)
+		ctx := testBasicAuth(t, spec, append([]interface{}{path}, ti.args...), ti.user, ti.password)
+		if ctx.FServed != ti.rejected {
+			t.Error(ti.title, "failed to reject or accept the request", ctx.FServed)
+			continue
+		}
+
+		if !ti.rejected {
+			continue
+		}
+
+		rsp := ctx.FResponseWriter.(*httptest.ResponseRecorder)
+		if rsp.Code != http.StatusUnauthorized {
+			t.Error(ti.title, "invalid status code", rsp.Code)
+		}
+
+		if rsp.Header().Get("WWW-Authenticate") != ti.realm {
+			t.Error(ti.title, "invalid challenge", rsp.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBasicAuthMissingFile(t *testing.T) {
+	ctx := testBasicAuth(t, NewBasicAuth().(*basicAuth), []interface{}{"/no/such/htpasswd"}, "alice", "secret")
+	if !ctx.FServed {
+		t.Error("failed to reject the request")
+	}
+}
+
+func TestBasicAuthReload(t *testing.T) {
+	path := writeHtpasswd(t, htpasswdLine(t, "alice", "secret"))
+	defer os.Remove(path)
+
+	c := clock.NewFake(time.Now())
+	spec := &basicAuth{clock: c, files: make(map[string]*htpasswd)}
+	if ctx := testBasicAuth(t, spec, []interface{}{path}, "alice", "secret"); ctx.FServed {
+		t.Fatal("failed to accept the request")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(htpasswdLine(t, "bob", "secret")+"# bob only\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if ctx := testBasicAuth(t, spec, []interface{}{path}, "alice", "secret"); ctx.FServed {
+		t.Error("failed to keep the users until the next check")
+	}
+
+	c.Add(basicAuthCheckInterval)
+	if ctx := testBasicAuth(t, spec, []interface{}{path}, "alice", "secret"); !ctx.FServed {
+		t.Error("failed to reload the removed user")
+	}
+
+	if ctx := testBasicAuth(t, spec, []interface{}{path}, "bob", "secret"); ctx.FServed {
+		t.Error("failed to reload the added user")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Add(basicAuthCheckInterval)
+	if ctx := testBasicAuth(t, spec, []interface{}{path}, "bob", "secret"); ctx.FServed {
+		t.Error("failed to keep the previous users")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+)
+
+type bodySizeType int
+
+const (
+	requestBodySize bodySizeType = iota
+	responseBodySize
+)
+
+type maxBodySize struct {
+	typ   bodySizeType
+	limit int64
+}
+
+// Returns a filter specification whose instances limit the size of the
+// request bodies forwarded to the backend. The requests whose
+// Content-Length exceeds the limit are rejected right away, with 413
+// Request Entity Too Large, while for the requests of unknown length,
+// the proxy counts the bytes read from the body, aborts the backend
+// request when the limit is exceeded, and responds with 413. The
+// filters run in the pre-auth phase, before the route specific filters.
+//
+// Instances expect one parameter, the maximum size in bytes, e.g.:
+//
+//     maxRequestBodySize(1048576)
+//
+// Name: "maxRequestBodySize".
+func NewMaxRequestBodySize() filters.Spec { return &maxBodySize{typ: requestBodySize} }
+
+// Returns a filter specification whose instances limit the size of the
+// response bodies sent to the client. When the Content-Length of the
+// response exceeds the limit, the proxy responds with 502 Bad Gateway,
+// while for the responses of unknown length, it counts the bytes while
+// streaming the body, and aborts the response when the limit is
+// exceeded.
+//
+// Instances expect one parameter, the maximum size in bytes, e.g.:
+//
+//     maxResponseBodySize(10485760)
+//
+// Name: "maxResponseBodySize".
+func NewMaxResponseBodySize() filters.Spec { return &maxBodySize{typ: responseBodySize} }
+
+// "maxRequestBodySize" or "maxResponseBodySize"
+func (spec *maxBodySize) Name() string {
+	if spec.typ == requestBodySize {
+		return MaxRequestBodySizeName
+	}
+
+	return MaxResponseBodySizeName
+}
+
+func (spec *maxBodySize) Description() string {
+	if spec.typ == requestBodySize {
+		return "Limits the size of the request bodies forwarded to the backend."
+	}
+
+	return "Limits the size of the response bodies sent to the client."
+}
+
+func (spec *maxBodySize) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "bytes", Type: filters.NumberType}}
+}
+
+// The request body limit needs to be set before the route specific
+// filters, that may read the body.
+func (spec *maxBodySize) Phase() filters.Phase {
+	if spec.typ == requestBodySize {
+		return filters.PhasePreAuth
+	}
+
+	return filters.PhaseRoute
+}
+
+func (spec *maxBodySize) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	limit, ok := config[0].(float64)
+	if !ok || limit < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &maxBodySize{typ: spec.typ, limit: int64(limit)}, nil
+}
+
+// Rejects the requests with a known, too large body, or sets the limit
+// for the proxy.
+func (f *maxBodySize) Request(ctx filters.FilterContext) {
+	if f.typ == responseBodySize {
+		ctx.StateBag()[filters.MaxResponseBodySizeKey] = f.limit
+		return
+	}
+
+	if ctx.Request().ContentLength > f.limit {
+		w := ctx.ResponseWriter()
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		ctx.MarkServed()
+		return
+	}
+
+	ctx.StateBag()[filters.MaxRequestBodySizeKey] = f.limit
+}
+
+// Noop.
+func (f *maxBodySize) Response(filters.FilterContext) {}
@@ -0,0 +1,88 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaxBodySizeInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"1024"},
+		{-1.0},
+		{1024.0, 2048.0},
+	} {
+		if _, err := NewMaxRequestBodySize().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func maxBodySizeContext(contentLength int64) *filtertest.Context {
+	return &filtertest.Context{
+		FResponseWriter: httptest.NewRecorder(),
+		FRequest:        &http.Request{ContentLength: contentLength},
+		FStateBag:       make(map[string]interface{})}
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	f, err := NewMaxRequestBodySize().CreateFilter([]interface{}{1024.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := maxBodySizeContext(2048)
+	f.Request(ctx)
+	if !ctx.Served() || ctx.FResponseWriter.(*httptest.ResponseRecorder).Code != http.StatusRequestEntityTooLarge {
+		t.Error("failed to reject the request")
+	}
+
+	for _, l := range []int64{-1, 1024} {
+		ctx = maxBodySizeContext(l)
+		f.Request(ctx)
+		if ctx.Served() || ctx.StateBag()[filters.MaxRequestBodySizeKey] != int64(1024) {
+			t.Error("failed to set the limit", l)
+		}
+	}
+}
+
+func TestMaxResponseBodySize(t *testing.T) {
+	f, err := NewMaxResponseBodySize().CreateFilter([]interface{}{1024.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := maxBodySizeContext(2048)
+	f.Request(ctx)
+	if ctx.Served() || ctx.StateBag()[filters.MaxResponseBodySizeKey] != int64(1024) {
+		t.Error("failed to set the limit")
+	}
+
+	if _, ok := ctx.StateBag()[filters.MaxRequestBodySizeKey]; ok {
+		t.Error("unexpected request body limit")
+	}
+}
+
+func TestMaxBodySizePhase(t *testing.T) {
+	if NewMaxRequestBodySize().(filters.PhasedSpec).Phase() != filters.PhasePreAuth ||
+		NewMaxResponseBodySize().(filters.PhasedSpec).Phase() != filters.PhaseRoute {
+		t.Error("invalid phase")
+	}
+}
@@ -5,17 +5,78 @@ package builtin
 
 import (
 	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/chain"
 	"github.com/zalando/skipper/filters/flowid"
 )
 
 const (
-	RequestHeaderName  = "requestHeader"
-	ResponseHeaderName = "responseHeader"
-	HealthCheckName    = "healthcheck"
-	ModPathName        = "modPath"
-	RedirectName       = "redirect"
-	StaticName         = "static"
-	StripQueryName     = "stripQuery"
+	RequestHeaderName   = "requestHeader"
+	ResponseHeaderName  = "responseHeader"
+	HealthCheckName     = "healthcheck"
+	ModPathName         = "modPath"
+	RedirectName        = "redirect"
+	StaticName          = "static"
+	StripQueryName      = "stripQuery"
+	DeadlineName        = "deadline"
+	CompressRequestName = "compressRequest"
+	ConsistentHashName  = "consistentHash"
+	FailoverName        = "failover"
+	SocketOptionsName   = "socketOptions"
+	StripExpectName     = "stripExpect"
+	WebsocketOriginName = "websocketOrigin"
+	WebsocketLimitsName = "websocketLimits"
+	RolloutName         = "rollout"
+	PathTemplateName    = "pathTemplate"
+	NegotiateName       = "negotiate"
+	BackendSchemeName   = "backendScheme"
+	BackendHostName     = "backendHost"
+	TlsServerNameName   = "tlsServerName"
+	BackendProtocolName = "backendProtocol"
+	GrpcWebName         = "grpcWeb"
+	CanaryName          = "canary"
+	SrvBackendName      = "srvBackend"
+
+	CompressDictionaryName  = "compressDictionary"
+	StripTrackingParamsName = "stripTrackingParams"
+	ExtractName             = "extract"
+	AuditSignatureName      = "auditSignature"
+	SampleName              = "sample"
+	WhenName                = "when"
+	RewriteResponseBodyName = "rewriteResponseBody"
+	MaxRequestBodySizeName  = "maxRequestBodySize"
+	MaxResponseBodySizeName = "maxResponseBodySize"
+	ResponseBandwidthName   = "responseBandwidth"
+	CircuitBreakerName      = "circuitBreaker"
+	RetryName               = "retry"
+	LoadBalancerName        = "loadBalancer"
+	MirrorName              = "mirror"
+
+	BackendTimeoutName        = "backendTimeout"
+	DialTimeoutName           = "dialTimeout"
+	ResponseHeaderTimeoutName = "responseHeaderTimeout"
+	CompressName              = "compress"
+	VerifyContentTypeName     = "verifyContentType"
+	BasicAuthName             = "basicAuth"
+	ClientIPName              = "clientIP"
+	DenyClientIPName          = "denyClientIP"
+	CorsName                  = "cors"
+	ClientCertHeadersName     = "clientCertHeaders"
+
+	SetRequestHeaderName     = "setRequestHeader"
+	AppendRequestHeaderName  = "appendRequestHeader"
+	DropRequestHeaderName    = "dropRequestHeader"
+	SetResponseHeaderName    = "setResponseHeader"
+	AppendResponseHeaderName = "appendResponseHeader"
+	DropResponseHeaderName   = "dropResponseHeader"
+
+	RedirectToName = "redirectTo"
+	SetQueryName   = "setQuery"
+	DropQueryName  = "dropQuery"
+
+	NormalizeEncodingName = "normalizeEncoding"
+
+	DetectDeviceName = "detectDevice"
+	ClassifyName     = "classify"
 )
 
 // Returns a Registry object initialized with the default set of filter
@@ -31,10 +92,65 @@ func MakeRegistry() filters.Registry {
 		NewStatic(),
 		NewRedirect(),
 		NewStripQuery(),
+		NewDeadline(),
+		NewCompressRequest(),
+		NewConsistentHash(),
+		NewFailover(),
+		NewSocketOptions(),
+		NewStripExpect(),
+		NewWebsocketOrigin(),
+		NewWebsocketLimits(),
+		NewPathTemplate(),
+		NewNegotiate(),
+		NewBackendScheme(),
+		NewBackendHost(),
+		NewTlsServerName(),
+		NewBackendProtocol(),
+		NewGrpcWeb(),
+		NewCanary(),
+		NewSrvBackend(),
+		NewCompressDictionary(),
+		NewStripTrackingParams(),
+		NewExtract(),
+		NewAuditSignature(),
+		NewRewriteResponseBody(),
+		NewMaxRequestBodySize(),
+		NewMaxResponseBodySize(),
+		NewResponseBandwidth(),
+		NewCircuitBreaker(),
+		NewRetry(),
+		NewLoadBalancer(),
+		NewMirror(),
+		NewBackendTimeout(),
+		NewDialTimeout(),
+		NewResponseHeaderTimeout(),
+		NewCompress(),
+		NewVerifyContentType(),
+		NewBasicAuth(),
+		NewClientIP(),
+		NewDenyClientIP(),
+		NewCors(),
+		NewClientCertHeaders(),
+		NewSetRequestHeader(),
+		NewAppendRequestHeader(),
+		NewDropRequestHeader(),
+		NewSetResponseHeader(),
+		NewAppendResponseHeader(),
+		NewDropResponseHeader(),
+		NewRedirectTo(),
+		NewSetQuery(),
+		NewDropQuery(),
+		NewNormalizeEncoding(),
+		NewDetectDevice(),
+		NewClassify(),
 		flowid.New(),
 	} {
 		r.Register(s)
 	}
 
+	r.Register(NewRollout(r))
+	r.Register(NewSample(r))
+	r.Register(NewWhen(r))
+	r.Register(chain.NewSpec(r))
 	return r
 }
@@ -0,0 +1,34 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"testing"
+)
+
+func TestBuiltinSignatures(t *testing.T) {
+	for name, spec := range MakeRegistry() {
+		_, signature := spec.(filters.SignatureSpec)
+		_, schema := spec.(filters.SpecWithSchema)
+		if !signature && !schema {
+			t.Error("missing signature", name)
+		}
+
+		if _, ok := spec.(filters.DescribedSpec); !ok {
+			t.Error("missing description", name)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	canaryStateKey = "canary:request"
+
+	canaryRollbackArg = "rollback"
+
+	defaultCanaryWindow             = time.Minute
+	defaultCanaryMinRequests        = 100
+	defaultCanaryMaxSuccessRateDrop = 0.01
+	defaultCanaryMaxLatencyRatio    = 1.5
+)
+
+type canaryVerdict int64
+
+const (
+	canaryFail         canaryVerdict = -1
+	canaryInconclusive canaryVerdict = 0
+	canaryPass         canaryVerdict = 1
+)
+
+type canarySettings struct {
+	window             time.Duration
+	minRequests        int
+	maxSuccessRateDrop float64
+	maxLatencyRatio    float64
+}
+
+// the responses of a variant in the current analysis window
+type variantStats struct {
+	requests  int
+	successes int
+	latency   time.Duration
+}
+
+// the analysis of a canary group, shared by the filter instances
+// created for the same group, so that it survives the route updates
+type canaryAnalysis struct {
+	group       string
+	config      string
+	mx          sync.Mutex
+	windowStart time.Time
+	stable      variantStats
+	canary      variantStats
+	verdict     canaryVerdict
+	rolledBack  bool
+}
+
+type canarySpec struct {
+	clock    clock.Clock
+	settings canarySettings
+	mx       sync.Mutex
+	analyses map[string]*canaryAnalysis
+}
+
+type canary struct {
+	clock    clock.Clock
+	settings canarySettings
+	weight   float64
+	backend  string
+	rollback bool
+	analysis *canaryAnalysis
+}
+
+// the variant selected for a single request
+type canaryRequest struct {
+	canary bool
+	start  time.Time
+}
+
+func (s variantStats) successRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+
+	return float64(s.successes) / float64(s.requests)
+}
+
+func (s variantStats) meanLatency() time.Duration {
+	if s.requests == 0 {
+		return 0
+	}
+
+	return s.latency / time.Duration(s.requests)
+}
+
+// compares the canary to the stable variant
+func (a *canaryAnalysis) evaluate(s canarySettings) canaryVerdict {
+	if a.stable.requests < s.minRequests || a.canary.requests < s.minRequests {
+		return canaryInconclusive
+	}
+
+	if a.canary.successRate() < a.stable.successRate()-s.maxSuccessRateDrop {
+		return canaryFail
+	}
+
+	if float64(a.canary.meanLatency()) > float64(a.stable.meanLatency())*s.maxLatencyRatio {
+		return canaryFail
+	}
+
+	return canaryPass
+}
+
+// closes the current window, when it elapsed, and reports the verdict
+func (a *canaryAnalysis) closeWindow(now time.Time, s canarySettings, rollback bool) {
+	if now.Sub(a.windowStart) < s.window {
+		return
+	}
+
+	if !a.rolledBack {
+		a.verdict = a.evaluate(s)
+		metrics.UpdateCanaryVerdict(a.group, int64(a.verdict))
+		metrics.UpdateCanaryVariant(a.group, "stable", a.stable.successRate(), a.stable.meanLatency())
+		metrics.UpdateCanaryVariant(a.group, "canary", a.canary.successRate(), a.canary.meanLatency())
+		if a.verdict == canaryFail && rollback {
+			a.rolledBack = true
+			metrics.IncCanaryRollback(a.group)
+		}
+	}
+
+	a.windowStart = now
+	a.stable = variantStats{}
+	a.canary = variantStats{}
+}
+
+func (a *canaryAnalysis) record(isCanary, success bool, latency time.Duration, now time.Time, s canarySettings, rollback bool) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if a.windowStart.IsZero() {
+		a.windowStart = now
+	}
+
+	a.closeWindow(now, s, rollback)
+
+	v := &a.stable
+	if isCanary {
+		v = &a.canary
+	}
+
+	v.requests++
+	v.latency += latency
+	if success {
+		v.successes++
+	}
+}
+
+func (a *canaryAnalysis) isRolledBack() bool {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.rolledBack
+}
+
+func (a *canaryAnalysis) lastVerdict() canaryVerdict {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.verdict
+}
+
+// Returns a filter specification whose instances split the traffic of
+// a route between the stable backend of the route and a canary
+// backend, and compare the two variants, so that a new version of a
+// backend can be verified on live traffic. Blue/green deployments can
+// be verified the same way, using the green deployment as the canary
+// backend.
+//
+// The responses of the variants are collected in analysis windows of
+// one minute. At the end of each window, the canary fails when its
+// success rate, the rate of the non-5xx responses, is lower by more
+// than one percentage point than the success rate of the stable
+// variant, or when its mean latency is higher by more than 50%. When
+// either variant received less than 100 requests during the window,
+// the verdict is inconclusive. The verdict of the last window and the
+// measurements of the variants are exposed as metrics, under the
+// canary.<group> keys.
+//
+// Instances expect the name of the canary group, the percentage of the
+// requests forwarded to the canary, 0-100, the address of the canary
+// backend, and optionally the "rollback" flag, e.g.:
+//
+//     canary("checkout", 10, "https://checkout-canary.example.org", "rollback")
+//
+// When the rollback flag is set, and the canary fails, all the requests
+// are forwarded to the stable backend, until the percentage or the
+// canary backend is changed in the route. The group identifies the
+// analysis across the route updates, and it needs to be unique for
+// every route.
+//
+// Name: "canary".
+func NewCanary() filters.Spec {
+	return newCanary(canarySettings{
+		window:             defaultCanaryWindow,
+		minRequests:        defaultCanaryMinRequests,
+		maxSuccessRateDrop: defaultCanaryMaxSuccessRateDrop,
+		maxLatencyRatio:    defaultCanaryMaxLatencyRatio}, clock.System)
+}
+
+func newCanary(settings canarySettings, c clock.Clock) *canarySpec {
+	return &canarySpec{
+		clock:    c,
+		settings: settings,
+		analyses: make(map[string]*canaryAnalysis)}
+}
+
+// "canary"
+func (spec *canarySpec) Name() string { return CanaryName }
+
+func (spec *canarySpec) Description() string {
+	return "Splits the traffic between the backend of the route and a canary backend, and compares their success rates and latencies."
+}
+
+func (spec *canarySpec) Signature() string {
+	return "group string, percentage number, backend string, [rollback string]"
+}
+
+// returns the analysis of a group, or starts a new one, when the group
+// is new or its configuration changed
+func (spec *canarySpec) analysis(group, config string) *canaryAnalysis {
+	spec.mx.Lock()
+	defer spec.mx.Unlock()
+
+	if a, ok := spec.analyses[group]; ok && a.config == config {
+		return a
+	}
+
+	a := &canaryAnalysis{group: group, config: config}
+	spec.analyses[group] = a
+	return a
+}
+
+func (spec *canarySpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 3 || len(config) > 4 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	group, ok := config[0].(string)
+	if !ok || group == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	weight, ok := config[1].(float64)
+	if !ok || weight < 0 || weight > 100 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	backend, ok := config[2].(string)
+	if !ok || !isBackendUrl(backend) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var rollback bool
+	if len(config) == 4 {
+		if a, ok := config[3].(string); !ok || a != canaryRollbackArg {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		rollback = true
+	}
+
+	return &canary{
+		clock:    spec.clock,
+		settings: spec.settings,
+		weight:   weight,
+		backend:  backend,
+		rollback: rollback,
+		analysis: spec.analysis(group, fmt.Sprint(weight, backend, rollback))}, nil
+}
+
+// Forwards the request to the canary backend, according to the
+// configured percentage, unless the canary was rolled back.
+func (f *canary) Request(ctx filters.FilterContext) {
+	isCanary := !f.analysis.isRolledBack() && rand.Float64()*100 < f.weight
+	if isCanary {
+		ctx.StateBag()[filters.BackendUrlKey] = f.backend
+	}
+
+	ctx.StateBag()[canaryStateKey] = &canaryRequest{canary: isCanary, start: f.clock.Now()}
+}
+
+// Records the outcome of the request for the variant that served it.
+func (f *canary) Response(ctx filters.FilterContext) {
+	r, ok := ctx.StateBag()[canaryStateKey].(*canaryRequest)
+	if !ok {
+		return
+	}
+
+	now := f.clock.Now()
+	rsp := ctx.Response()
+	success := rsp != nil && rsp.StatusCode < http.StatusInternalServerError
+	f.analysis.record(r.canary, success, now.Sub(r.start), now, f.settings, f.rollback)
+}
@@ -0,0 +1,212 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testCanaryBackend = "https://canary.example.org"
+
+var testCanarySettings = canarySettings{
+	window:             time.Minute,
+	minRequests:        10,
+	maxSuccessRateDrop: 0.01,
+	maxLatencyRatio:    1.5}
+
+func createCanary(t *testing.T, spec *canarySpec, config ...interface{}) *canary {
+	f, err := spec.CreateFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f.(*canary)
+}
+
+// sends n requests through the filter, responding with the status and
+// after the latency returned for the selected variant, and returns the
+// number of requests forwarded to the canary
+func canaryRequests(f filters.Filter, c *clock.Fake, n int, respond func(isCanary bool) (int, time.Duration)) int {
+	var canaries int
+	for i := 0; i < n; i++ {
+		ctx := &filtertest.Context{
+			FRequest:  &http.Request{Header: http.Header{}},
+			FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+
+		isCanary := ctx.FStateBag[filters.BackendUrlKey] == testCanaryBackend
+		if isCanary {
+			canaries++
+		}
+
+		status, latency := respond(isCanary)
+		c.Add(latency)
+		ctx.FResponse = &http.Response{StatusCode: status}
+		f.Response(ctx)
+	}
+
+	return canaries
+}
+
+func respondOk(bool) (int, time.Duration) { return http.StatusOK, time.Millisecond }
+
+func TestCanaryInvalidConfig(t *testing.T) {
+	spec := NewCanary()
+	for _, config := range [][]interface{}{
+		nil,
+		{"checkout", 10.0},
+		{"", 10.0, testCanaryBackend},
+		{"checkout", "10", testCanaryBackend},
+		{"checkout", 101.0, testCanaryBackend},
+		{"checkout", 10.0, "canary.example.org"},
+		{"checkout", 10.0, testCanaryBackend, "revert"},
+		{"checkout", 10.0, testCanaryBackend, "rollback", "now"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestCanaryWeight(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	spec := newCanary(testCanarySettings, c)
+
+	f := createCanary(t, spec, "none", 0.0, testCanaryBackend)
+	if n := canaryRequests(f, c, 100, respondOk); n != 0 {
+		t.Error("failed to keep the requests on the stable backend", n)
+	}
+
+	f = createCanary(t, spec, "all", 100.0, testCanaryBackend)
+	if n := canaryRequests(f, c, 100, respondOk); n != 100 {
+		t.Error("failed to forward the requests to the canary", n)
+	}
+}
+
+func TestCanaryVerdict(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		requests int
+		respond  func(bool) (int, time.Duration)
+		expected canaryVerdict
+	}{{
+		"pass",
+		100,
+		respondOk,
+		canaryPass,
+	}, {
+		"not enough requests",
+		10,
+		respondOk,
+		canaryInconclusive,
+	}, {
+		"failing canary",
+		100,
+		func(isCanary bool) (int, time.Duration) {
+			if isCanary {
+				return http.StatusInternalServerError, time.Millisecond
+			}
+
+			return http.StatusOK, time.Millisecond
+		},
+		canaryFail,
+	}, {
+		"slow canary",
+		100,
+		func(isCanary bool) (int, time.Duration) {
+			if isCanary {
+				return http.StatusOK, 3 * time.Millisecond
+			}
+
+			return http.StatusOK, time.Millisecond
+		},
+		canaryFail,
+	}, {
+		"failing stable",
+		100,
+		func(isCanary bool) (int, time.Duration) {
+			if isCanary {
+				return http.StatusOK, time.Millisecond
+			}
+
+			return http.StatusServiceUnavailable, time.Millisecond
+		},
+		canaryPass,
+	}} {
+		c := clock.NewFake(time.Now())
+		f := createCanary(t, newCanary(testCanarySettings, c), "checkout", 50.0, testCanaryBackend)
+		canaryRequests(f, c, ti.requests, ti.respond)
+
+		c.Add(testCanarySettings.window)
+		canaryRequests(f, c, 1, respondOk)
+		if v := f.analysis.lastVerdict(); v != ti.expected {
+			t.Error(ti.msg, "invalid verdict", v, ti.expected)
+		}
+	}
+}
+
+func respondCanaryError(isCanary bool) (int, time.Duration) {
+	if isCanary {
+		return http.StatusInternalServerError, time.Millisecond
+	}
+
+	return http.StatusOK, time.Millisecond
+}
+
+func TestCanaryRollback(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	spec := newCanary(testCanarySettings, c)
+	f := createCanary(t, spec, "checkout", 50.0, testCanaryBackend, "rollback")
+	canaryRequests(f, c, 100, respondCanaryError)
+	c.Add(testCanarySettings.window)
+	canaryRequests(f, c, 1, respondOk)
+
+	if n := canaryRequests(f, c, 100, respondOk); n != 0 {
+		t.Error("failed to roll back the canary", n)
+	}
+
+	// the rollback survives the route updates with the same configuration
+	f = createCanary(t, spec, "checkout", 50.0, testCanaryBackend, "rollback")
+	if n := canaryRequests(f, c, 100, respondOk); n != 0 {
+		t.Error("failed to keep the canary rolled back", n)
+	}
+
+	// changing the configuration starts a new analysis
+	f = createCanary(t, spec, "checkout", 20.0, testCanaryBackend, "rollback")
+	if n := canaryRequests(f, c, 100, respondOk); n == 0 {
+		t.Error("failed to restart the canary")
+	}
+}
+
+func TestCanaryNoRollback(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	f := createCanary(t, newCanary(testCanarySettings, c), "checkout", 50.0, testCanaryBackend)
+	canaryRequests(f, c, 100, respondCanaryError)
+	c.Add(testCanarySettings.window)
+	canaryRequests(f, c, 1, respondOk)
+
+	if f.analysis.lastVerdict() != canaryFail {
+		t.Error("failed to fail the canary")
+	}
+
+	if n := canaryRequests(f, c, 100, respondOk); n == 0 {
+		t.Error("unexpected rollback")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import "github.com/zalando/skipper/filters"
+
+type circuitBreaker struct {
+	settings filters.CircuitBreakerSettings
+}
+
+// Returns a filter specification whose instances set the circuit
+// breaker of the route, overriding the default circuit breaker of the
+// proxy.
+//
+// The first parameter is the type of the breaker:
+//
+//     consecutive - opens after a number of consecutive failed requests
+//     rate        - opens when a number of the last requests failed
+//     disabled    - disables the default circuit breaker for the route
+//
+// followed by pairs of the name and the value of the settings:
+//
+//     failures         - the number of the failures opening the breaker,
+//                        required for the consecutive and the rate type
+//     window           - the number of the last requests, in which the
+//                        rate breaker counts the failures, required for
+//                        the rate type
+//     timeout          - the time the breaker stays open, in milliseconds
+//                        or as a duration string, default: 30s
+//     halfOpenRequests - the number of the probe requests let through
+//                        after the timeout, default: 1
+//     scope            - "host", to count the failures per backend host,
+//                        shared by all the routes, or "route", default:
+//                        host
+//
+// E.g.:
+//
+//     circuitBreaker("consecutive", "failures", 5, "timeout", "10s")
+//     circuitBreaker("rate", "failures", 30, "window", 100, "scope", "route")
+//
+// Name: "circuitBreaker".
+func NewCircuitBreaker() filters.Spec { return &circuitBreaker{} }
+
+// "circuitBreaker"
+func (spec *circuitBreaker) Name() string { return CircuitBreakerName }
+
+func (spec *circuitBreaker) Description() string {
+	return "Sets the circuit breaker of the backend of the route."
+}
+
+func (spec *circuitBreaker) Signature() string { return "type string, name string, value, ..." }
+
+func (spec *circuitBreaker) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 || len(config)%2 != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &circuitBreaker{}
+	switch config[0] {
+	case "consecutive":
+		f.settings.Type = filters.ConsecutiveBreaker
+	case "rate":
+		f.settings.Type = filters.RateBreaker
+	case "disabled":
+		if len(config) > 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		return f, nil
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	for i := 1; i < len(config); i += 2 {
+		name, ok := config[i].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if name == "timeout" {
+			if f.settings.Timeout, ok = filters.DurationArg(config[i+1]); !ok || f.settings.Timeout <= 0 {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			continue
+		}
+
+		if name == "scope" {
+			switch config[i+1] {
+			case "host":
+				f.settings.Scope = filters.HostBreaker
+			case "route":
+				f.settings.Scope = filters.RouteBreaker
+			default:
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			continue
+		}
+
+		value, ok := config[i+1].(float64)
+		if !ok || value < 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch name {
+		case "failures":
+			f.settings.Failures = int(value)
+		case "window":
+			f.settings.Window = int(value)
+		case "halfOpenRequests":
+			f.settings.HalfOpenRequests = int(value)
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	if f.settings.Failures == 0 ||
+		f.settings.Type == filters.RateBreaker && f.settings.Window < f.settings.Failures ||
+		f.settings.Type == filters.ConsecutiveBreaker && f.settings.Window != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return f, nil
+}
+
+// Sets the circuit breaker in the state bag.
+func (f *circuitBreaker) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.CircuitBreakerKey] = f.settings
+}
+
+// Noop.
+func (f *circuitBreaker) Response(filters.FilterContext) {}
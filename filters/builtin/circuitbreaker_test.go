@@ -0,0 +1,76 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"foo"},
+		{"consecutive"},
+		{"consecutive", "failures"},
+		{"consecutive", "failures", 0.0},
+		{"consecutive", "failures", 5.0, "window", 10.0},
+		{"consecutive", "failures", 5.0, "foo", 10.0},
+		{"consecutive", "failures", 5.0, "timeout", "foo"},
+		{"consecutive", "failures", 5.0, "scope", "foo"},
+		{"rate", "failures", 5.0},
+		{"rate", "failures", 5.0, "window", 4.0},
+		{"disabled", "failures", 5.0},
+	} {
+		if _, err := NewCircuitBreaker().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	for _, ti := range []struct {
+		args     []interface{}
+		settings filters.CircuitBreakerSettings
+	}{{
+		[]interface{}{"consecutive", "failures", 5.0, "timeout", "10s"},
+		filters.CircuitBreakerSettings{Type: filters.ConsecutiveBreaker, Failures: 5, Timeout: 10 * time.Second},
+	}, {
+		[]interface{}{"rate", "failures", 30.0, "window", 100.0, "halfOpenRequests", 3.0, "scope", "route"},
+		filters.CircuitBreakerSettings{
+			Type:             filters.RateBreaker,
+			Scope:            filters.RouteBreaker,
+			Failures:         30,
+			Window:           100,
+			HalfOpenRequests: 3},
+	}, {
+		[]interface{}{"disabled"},
+		filters.CircuitBreakerSettings{},
+	}} {
+		f, err := NewCircuitBreaker().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		if ctx.StateBag()[filters.CircuitBreakerKey] != ti.settings {
+			t.Error("invalid settings", ti.args, ctx.StateBag()[filters.CircuitBreakerKey])
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// the category names are used in the metrics keys and in the access
+// log, so they are restricted to a safe set of characters
+var categoryName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// a single condition of a classification rule
+type classifyCondition func(*http.Request) bool
+
+type classifyRule struct {
+	category   string
+	conditions []classifyCondition
+}
+
+type classify struct {
+	rules    []classifyRule
+	fallback string
+}
+
+// Returns a filter specification whose instances classify the requests
+// into named categories, e.g. checkout, search or partner traffic, by an
+// ordered list of rules. The category of the first matching rule is set
+// in the state bag, and the proxy reports it in the metrics, as
+// response.<code>.<method>.category.<category>, and in the access log,
+// so that the traffic can be broken down by business level categories
+// without post-processing the logs.
+//
+// Instances expect pairs of a category name and a rule, optionally
+// followed by a fallback category, used when no rule matches. A rule is
+// one or more conditions joined by '&&':
+//
+//	path:/prefix             the path starts with the prefix
+//	method:GET,POST          the method is one of the listed ones
+//	header:X-Partner-Id      the header is present
+//	header:X-Client=mobile   the header has the exact value
+//
+// E.g.:
+//
+//	classify("checkout", "path:/checkout", "search", "method:GET && path:/search", "other")
+//
+// Name: "classify".
+func NewClassify() filters.Spec { return &classify{} }
+
+// "classify"
+func (spec *classify) Name() string { return ClassifyName }
+
+func (spec *classify) Description() string {
+	return "Classifies the requests into categories reported in the metrics and the access log."
+}
+
+func (spec *classify) Signature() string { return "category string, rule string, ..., fallback string" }
+
+func parseClassifyCondition(s string) (classifyCondition, bool) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, false
+	}
+
+	value := parts[1]
+	switch parts[0] {
+	case "path":
+		if !strings.HasPrefix(value, "/") {
+			return nil, false
+		}
+
+		return func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, value)
+		}, true
+	case "method":
+		methods := make(map[string]bool)
+		for _, m := range strings.Split(value, ",") {
+			m = strings.ToUpper(strings.TrimSpace(m))
+			if m == "" {
+				return nil, false
+			}
+
+			methods[m] = true
+		}
+
+		return func(r *http.Request) bool {
+			return methods[r.Method]
+		}, true
+	case "header":
+		nv := strings.SplitN(value, "=", 2)
+		name := http.CanonicalHeaderKey(strings.TrimSpace(nv[0]))
+		if name == "" {
+			return nil, false
+		}
+
+		if len(nv) == 1 {
+			return func(r *http.Request) bool {
+				_, ok := r.Header[name]
+				return ok
+			}, true
+		}
+
+		expected := nv[1]
+		return func(r *http.Request) bool {
+			return r.Header.Get(name) == expected
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+func parseClassifyRule(category, rule string) (classifyRule, bool) {
+	if !categoryName.MatchString(category) {
+		return classifyRule{}, false
+	}
+
+	var conditions []classifyCondition
+	for _, s := range strings.Split(rule, "&&") {
+		c, ok := parseClassifyCondition(s)
+		if !ok {
+			return classifyRule{}, false
+		}
+
+		conditions = append(conditions, c)
+	}
+
+	return classifyRule{category, conditions}, true
+}
+
+func (spec *classify) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var args []string
+	for _, c := range config {
+		s, ok := c.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		args = append(args, s)
+	}
+
+	f := &classify{}
+	if len(args)%2 == 1 {
+		f.fallback = args[len(args)-1]
+		if !categoryName.MatchString(f.fallback) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		args = args[:len(args)-1]
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		r, ok := parseClassifyRule(args[i], args[i+1])
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.rules = append(f.rules, r)
+	}
+
+	return f, nil
+}
+
+func (r classifyRule) match(req *http.Request) bool {
+	for _, c := range r.conditions {
+		if !c(req) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Sets the category of the first matching rule, or the fallback, in the
+// state bag.
+func (f *classify) Request(ctx filters.FilterContext) {
+	category := f.fallback
+	for _, r := range f.rules {
+		if r.match(ctx.Request()) {
+			category = r.category
+			break
+		}
+	}
+
+	if category != "" {
+		ctx.StateBag()[filters.CategoryKey] = category
+	}
+}
+
+// Noop.
+func (f *classify) Response(filters.FilterContext) {}
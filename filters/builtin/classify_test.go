@@ -0,0 +1,127 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestClassifyInvalidArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"checkout"},
+		{"checkout", 42},
+		{"check out", "path:/checkout"},
+		{"checkout", "path:checkout"},
+		{"checkout", "query:foo"},
+		{"checkout", "path:/checkout &&"},
+		{"checkout", "method:"},
+		{"checkout", "header:"},
+		{"checkout", "path:/checkout", "other.category"},
+	} {
+		if _, err := NewClassify().CreateFilter(args); err != filters.ErrInvalidFilterParameters {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	args := []interface{}{
+		"checkout", "path:/checkout",
+		"search", "method:GET,HEAD && path:/search",
+		"partner", "header:X-Partner-Id",
+		"mobile", "header:X-Client=mobile",
+	}
+
+	for _, ti := range []struct {
+		msg      string
+		fallback bool
+		method   string
+		path     string
+		header   http.Header
+		category string
+	}{{
+		msg:      "path prefix",
+		path:     "/checkout/cart",
+		category: "checkout",
+	}, {
+		msg:      "method and path",
+		path:     "/search",
+		category: "search",
+	}, {
+		msg:    "method does not match",
+		method: "POST",
+		path:   "/search",
+	}, {
+		msg:      "header present",
+		path:     "/orders",
+		header:   http.Header{"X-Partner-Id": []string{"acme"}},
+		category: "partner",
+	}, {
+		msg:      "header value",
+		path:     "/orders",
+		header:   http.Header{"X-Client": []string{"mobile"}},
+		category: "mobile",
+	}, {
+		msg:    "header value does not match",
+		path:   "/orders",
+		header: http.Header{"X-Client": []string{"desktop"}},
+	}, {
+		msg:      "first rule wins",
+		path:     "/checkout",
+		header:   http.Header{"X-Partner-Id": []string{"acme"}},
+		category: "checkout",
+	}, {
+		msg:      "fallback",
+		fallback: true,
+		path:     "/orders",
+		category: "other",
+	}} {
+		a := args
+		if ti.fallback {
+			a = append(append([]interface{}{}, args...), "other")
+		}
+
+		f, err := NewClassify().CreateFilter(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		method := ti.method
+		if method == "" {
+			method = "GET"
+		}
+
+		req, err := http.NewRequest(method, "https://www.example.org"+ti.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k, v := range ti.header {
+			req.Header[k] = v
+		}
+
+		ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+
+		category, ok := ctx.StateBag()[filters.CategoryKey].(string)
+		if ti.category == "" && ok || category != ti.category {
+			t.Error(ti.msg, "invalid category", category, ti.category)
+		}
+	}
+}
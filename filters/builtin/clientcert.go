@@ -0,0 +1,110 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"strings"
+	"time"
+)
+
+// The default prefix of the headers set by the clientCertHeaders filter.
+const DefaultClientCertHeaderPrefix = "X-Client-Cert-"
+
+type clientCertHeaders struct {
+	prefix string
+}
+
+// Returns a filter specification whose instances forward the details of
+// the verified client certificate to the backend, in request headers.
+// The filter takes an optional header prefix argument, defaulting to
+// X-Client-Cert-, and sets the following headers:
+//
+//     X-Client-Cert-Subject: the distinguished name of the subject
+//     X-Client-Cert-Issuer: the distinguished name of the issuer
+//     X-Client-Cert-San: the subject alternative names, comma separated
+//     X-Client-Cert-Serial: the serial number, in hex
+//     X-Client-Cert-Fingerprint: the SHA-256 fingerprint, in hex
+//     X-Client-Cert-Not-After: the expiration time, in RFC 3339
+//
+// The incoming headers with the prefix are always removed, so the
+// clients cannot set them. When the client didn't present a verified
+// certificate, no headers are set. E.g.:
+//
+//     ClientCert("cn", /^partner-/) -> clientCertHeaders() -> "https://partners.internal"
+//
+// Name: "clientCertHeaders".
+func NewClientCertHeaders() filters.Spec { return &clientCertHeaders{} }
+
+// "clientCertHeaders"
+func (spec *clientCertHeaders) Name() string { return ClientCertHeadersName }
+
+func (spec *clientCertHeaders) Description() string {
+	return "Forwards the details of the verified client certificate to the backend in request headers."
+}
+
+func (spec *clientCertHeaders) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "prefix", Type: filters.StringType, Optional: true}}
+}
+
+func (spec *clientCertHeaders) CreateFilter(config []interface{}) (filters.Filter, error) {
+	switch len(config) {
+	case 0:
+		return &clientCertHeaders{prefix: DefaultClientCertHeaderPrefix}, nil
+	case 1:
+		prefix, ok := config[0].(string)
+		if !ok || prefix == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		return &clientCertHeaders{prefix: prefix}, nil
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+}
+
+// Removes the incoming headers with the prefix, and sets them from the
+// verified client certificate.
+func (f *clientCertHeaders) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	lp := strings.ToLower(f.prefix)
+	for k := range req.Header {
+		if strings.HasPrefix(strings.ToLower(k), lp) {
+			delete(req.Header, k)
+		}
+	}
+
+	c := routing.VerifiedClientCertificate(req)
+	if c == nil {
+		return
+	}
+
+	fingerprint := sha256.Sum256(c.Raw)
+	req.Header.Set(f.prefix+"Subject", routing.FormatDistinguishedName(c.Subject))
+	req.Header.Set(f.prefix+"Issuer", routing.FormatDistinguishedName(c.Issuer))
+	req.Header.Set(f.prefix+"Serial", fmt.Sprintf("%x", c.SerialNumber))
+	req.Header.Set(f.prefix+"Fingerprint", hex.EncodeToString(fingerprint[:]))
+	req.Header.Set(f.prefix+"Not-After", c.NotAfter.UTC().Format(time.RFC3339))
+	if san := routing.SubjectAltNames(c); len(san) > 0 {
+		req.Header.Set(f.prefix+"San", strings.Join(san, ","))
+	}
+}
+
+// Noop.
+func (f *clientCertHeaders) Response(filters.FilterContext) {}
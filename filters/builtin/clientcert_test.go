@@ -0,0 +1,100 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/zalando/skipper/filters/filtertest"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClientCertHeadersInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{{42}, {""}, {"X-Foo-", "X-Bar-"}} {
+		if _, err := NewClientCertHeaders().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestClientCertHeaders(t *testing.T) {
+	cert := &x509.Certificate{
+		Raw:          []byte("certificate"),
+		SerialNumber: big.NewInt(255),
+		Subject:      pkix.Name{CommonName: "partner-a", Organization: []string{"Example"}},
+		Issuer:       pkix.Name{CommonName: "Example CA"},
+		DNSNames:     []string{"a.partners.example.org", "b.partners.example.org"},
+		NotAfter:     time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	for _, ti := range []struct {
+		title    string
+		args     []interface{}
+		verified bool
+		expected map[string]string
+	}{{
+		title: "no verified certificate",
+		expected: map[string]string{
+			"X-Client-Cert-Subject": "",
+			"X-Client-Cert-Other":   ""},
+	}, {
+		title:    "verified certificate",
+		verified: true,
+		expected: map[string]string{
+			"X-Client-Cert-Subject":     "CN=partner-a,O=Example",
+			"X-Client-Cert-Issuer":      "CN=Example CA",
+			"X-Client-Cert-San":         "a.partners.example.org,b.partners.example.org",
+			"X-Client-Cert-Serial":      "ff",
+			"X-Client-Cert-Fingerprint": "03d66dd08835c1ca3f128cceacd1f31ac94163096b20f445ae84285bc0832d72",
+			"X-Client-Cert-Not-After":   "2030-01-02T03:04:05Z",
+			"X-Client-Cert-Other":       ""},
+	}, {
+		title:    "custom prefix",
+		args:     []interface{}{"X-Ssl-"},
+		verified: true,
+		expected: map[string]string{
+			"X-Ssl-Subject":         "CN=partner-a,O=Example",
+			"X-Client-Cert-Subject": "spoofed"},
+	}} {
+		f, err := NewClientCertHeaders().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "https://www.example.org", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-Client-Cert-Subject", "spoofed")
+		req.Header.Set("X-Client-Cert-Other", "spoofed")
+		req.Header.Set("X-Ssl-Subject", "spoofed")
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if ti.verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+
+		f.Request(&filtertest.Context{FRequest: req})
+		for k, v := range ti.expected {
+			if h := req.Header.Get(k); h != v {
+				t.Error(ti.title, "invalid header", k, h, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+)
+
+type clientIPType int
+
+const (
+	allowClientIP clientIPType = iota
+	denyClientIP
+)
+
+type clientIP struct {
+	typ    clientIPType
+	ranges routing.IPRanges
+}
+
+// Returns a filter specification whose instances allow only the
+// requests from the clients whose address is in one of the IP
+// addresses or CIDR ranges, and reject the others with 403 Forbidden.
+// The client address is the remote address of the connection, or, when
+// trusted proxies are set, the right-most address of the
+// X-Forwarded-For header not belonging to a trusted proxy, see
+// routing.ClientIP. E.g.:
+//
+//     clientIP("10.0.0.0/8", "192.168.1.5")
+//
+// Unlike the ClientIP condition, that makes the requests of the other
+// clients fall through to the other routes, the filter rejects them.
+//
+// Name: "clientIP".
+func NewClientIP() filters.Spec { return &clientIP{typ: allowClientIP} }
+
+// Returns a filter specification whose instances reject the requests
+// from the clients whose address is in one of the IP addresses or CIDR
+// ranges with 403 Forbidden, e.g.:
+//
+//     denyClientIP("203.0.113.0/24")
+//
+// Name: "denyClientIP".
+func NewDenyClientIP() filters.Spec { return &clientIP{typ: denyClientIP} }
+
+// "clientIP" or "denyClientIP"
+func (spec *clientIP) Name() string {
+	if spec.typ == denyClientIP {
+		return DenyClientIPName
+	}
+
+	return ClientIPName
+}
+
+func (spec *clientIP) Description() string {
+	if spec.typ == denyClientIP {
+		return "Rejects the requests from the listed IP addresses and CIDR ranges."
+	}
+
+	return "Allows only the requests from the listed IP addresses and CIDR ranges."
+}
+
+func (spec *clientIP) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "ip", Type: filters.StringType, Variadic: true}}
+}
+
+func (spec *clientIP) CreateFilter(config []interface{}) (filters.Filter, error) {
+	ips := make([]string, len(config))
+	for i, c := range config {
+		s, ok := c.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		ips[i] = s
+	}
+
+	ranges, err := routing.ParseIPRanges(ips)
+	if err != nil {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &clientIP{typ: spec.typ, ranges: ranges}, nil
+}
+
+// Rejects the requests of the not allowed clients. The requests whose
+// client address cannot be parsed are rejected by both filters.
+func (f *clientIP) Request(ctx filters.FilterContext) {
+	ip := routing.ClientIP(ctx.Request())
+	if ip != nil && f.ranges.Contains(ip) == (f.typ == allowClientIP) {
+		return
+	}
+
+	ctx.ResponseWriter().WriteHeader(http.StatusForbidden)
+	ctx.MarkServed()
+}
+
+// Noop.
+func (f *clientIP) Response(filters.FilterContext) {}
@@ -0,0 +1,139 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPInvalidConfig(t *testing.T) {
+	for _, spec := range []filters.Spec{NewClientIP(), NewDenyClientIP()} {
+		for _, args := range [][]interface{}{nil, {42}, {"10.0.0.0/33"}, {"10.0.0.1", "foo"}} {
+			if _, err := spec.CreateFilter(args); err == nil {
+				t.Error("failed to fail", spec.Name(), args)
+			}
+		}
+	}
+}
+
+func TestClientIPFilters(t *testing.T) {
+	defer routing.SetTrustedProxies(routing.TrustedProxies{})
+	for _, ti := range []struct {
+		title      string
+		spec       filters.Spec
+		args       []interface{}
+		hops       int
+		remoteAddr string
+		forwarded  string
+		rejected   bool
+	}{{
+		title:      "allowed range",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8", "192.168.1.5"},
+		remoteAddr: "10.1.2.3:38123",
+	}, {
+		title:      "allowed address",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8", "192.168.1.5"},
+		remoteAddr: "192.168.1.5:38123",
+	}, {
+		title:      "not allowed",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8"},
+		remoteAddr: "203.0.113.7:38123",
+		rejected:   true,
+	}, {
+		title:      "allowed by forwarded address",
+		spec:       NewClientIP(),
+		args:       []interface{}{"203.0.113.0/24"},
+		hops:       2,
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "203.0.113.7, 10.0.0.2",
+	}, {
+		title:      "not allowed by forwarded address",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8"},
+		hops:       1,
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "203.0.113.7",
+		rejected:   true,
+	}, {
+		title:      "spoofed forwarded address without trusted proxies",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8"},
+		remoteAddr: "203.0.113.7:38123",
+		forwarded:  "10.0.0.1",
+		rejected:   true,
+	}, {
+		title:      "allow rejects invalid address",
+		spec:       NewClientIP(),
+		args:       []interface{}{"10.0.0.0/8"},
+		remoteAddr: "pipe",
+		rejected:   true,
+	}, {
+		title:      "denied",
+		spec:       NewDenyClientIP(),
+		args:       []interface{}{"203.0.113.0/24"},
+		remoteAddr: "203.0.113.7:38123",
+		rejected:   true,
+	}, {
+		title:      "not denied",
+		spec:       NewDenyClientIP(),
+		args:       []interface{}{"203.0.113.0/24"},
+		remoteAddr: "10.1.2.3:38123",
+	}, {
+		title:      "deny rejects invalid address",
+		spec:       NewDenyClientIP(),
+		args:       []interface{}{"203.0.113.0/24"},
+		hops:       1,
+		remoteAddr: "10.1.2.3:38123",
+		forwarded:  "unknown",
+		rejected:   true,
+	}} {
+		f, err := ti.spec.CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "https://www.example.org", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		routing.SetTrustedProxies(routing.TrustedProxies{Hops: ti.hops})
+		req.RemoteAddr = ti.remoteAddr
+		if ti.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", ti.forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: req, FResponseWriter: w}
+		f.Request(ctx)
+		if ctx.FServed != ti.rejected {
+			t.Error(ti.title, "failed to reject or accept the request", ctx.FServed)
+			continue
+		}
+
+		if ti.rejected && w.Code != http.StatusForbidden {
+			t.Error(ti.title, "invalid status code", w.Code)
+		}
+	}
+}
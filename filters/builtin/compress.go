@@ -0,0 +1,226 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// the responses with a known length shorter than this are not
+	// compressed, because the overhead outweighs the gain
+	minCompressLength = 256
+
+	gzipEncoding    = "gzip"
+	deflateEncoding = "deflate"
+)
+
+// the compressed content types, when not set in the filter
+var defaultCompressTypes = []string{
+	"text/plain",
+	"text/html",
+	"text/css",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// the supported content codings, in the order of preference, when the
+// client accepts them with the same quality
+var compressEncodings = []string{gzipEncoding, deflateEncoding}
+
+type compress struct {
+	level int
+	types map[string]bool
+}
+
+// Returns a filter specification whose instances compress the response
+// bodies, negotiating the content coding with the Accept-Encoding
+// header of the request. The supported codings are gzip and deflate.
+// Brotli is not available in the dependencies. When the client accepts
+// both with the same quality, gzip is preferred.
+//
+// Only the responses with the configured content types are compressed.
+// The responses that already have a Content-Encoding, the responses
+// with Cache-Control: no-transform, the responses to HEAD requests, and
+// the responses without a body, e.g. 204 or 304, are not compressed,
+// neither the ones with a known length below 256 bytes. The body is
+// compressed while streaming, the Content-Length is dropped, and the
+// strong ETag of the response is made weak. The Vary header is set to
+// include Accept-Encoding, for all the responses with the matching
+// content types, compressed or not.
+//
+// Instances accept an optional compression level, 1-9, as the first
+// parameter, followed by the content types to compress. Without the
+// content types, the common text based types are compressed, e.g.
+// text/html, application/json and image/svg+xml:
+//
+//     compress()
+//     compress(9)
+//     compress("text/html", "application/json")
+//     compress(1, "text/csv")
+//
+// Name: "compress".
+func NewCompress() filters.Spec { return &compress{} }
+
+// "compress"
+func (spec *compress) Name() string { return CompressName }
+
+func (spec *compress) Description() string {
+	return "Compresses the response bodies with gzip or deflate, as accepted by the client."
+}
+
+func (spec *compress) Signature() string { return "[level number], [contentType string, ...]" }
+
+func (spec *compress) CreateFilter(config []interface{}) (filters.Filter, error) {
+	f := &compress{level: gzip.DefaultCompression, types: make(map[string]bool)}
+	if len(config) > 0 {
+		if level, ok := config[0].(float64); ok {
+			if level < gzip.BestSpeed || level > gzip.BestCompression || level != float64(int(level)) {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			f.level = int(level)
+			config = config[1:]
+		}
+	}
+
+	for _, c := range config {
+		t, ok := c.(string)
+		if !ok || t == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.types[strings.ToLower(t)] = true
+	}
+
+	if len(f.types) == 0 {
+		for _, t := range defaultCompressTypes {
+			f.types[t] = true
+		}
+	}
+
+	return f, nil
+}
+
+// returns the preferred content coding accepted by the client, or
+// false, when none of the supported ones is accepted
+func selectEncoding(h http.Header) (string, bool) {
+	var (
+		selected string
+		quality  float64
+	)
+
+	for _, e := range compressEncodings {
+		if q := encodingQuality(h, e); q > quality {
+			selected, quality = e, q
+		}
+	}
+
+	return selected, selected != ""
+}
+
+func hasVary(h http.Header, name string) bool {
+	for _, v := range h["Vary"] {
+		for _, vi := range strings.Split(v, ",") {
+			vi = strings.TrimSpace(vi)
+			if vi == "*" || strings.EqualFold(vi, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (f *compress) compressedType(rsp *http.Response) bool {
+	mt, _, err := mime.ParseMediaType(rsp.Header.Get("Content-Type"))
+	return err == nil && f.types[strings.ToLower(mt)]
+}
+
+func noTransform(h http.Header) bool {
+	for _, v := range h["Cache-Control"] {
+		for _, vi := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(vi), "no-transform") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (f *compress) compressible(req *http.Request, rsp *http.Response) bool {
+	switch {
+	case req.Method == "HEAD",
+		rsp.Body == nil,
+		rsp.StatusCode < http.StatusOK,
+		rsp.StatusCode == http.StatusNoContent,
+		rsp.StatusCode == http.StatusNotModified,
+		rsp.Header.Get("Content-Encoding") != "",
+		rsp.ContentLength >= 0 && rsp.ContentLength < minCompressLength,
+		noTransform(rsp.Header):
+		return false
+	default:
+		return true
+	}
+}
+
+func (f *compress) writer(encoding string) func(io.Writer) (io.WriteCloser, error) {
+	if encoding == deflateEncoding {
+		return func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, f.level) }
+	}
+
+	return func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, f.level) }
+}
+
+// Noop.
+func (f *compress) Request(filters.FilterContext) {}
+
+// Replaces the response body with the compressed one, when the client
+// accepts one of the supported content codings.
+func (f *compress) Response(ctx filters.FilterContext) {
+	rsp := ctx.Response()
+	if !f.compressedType(rsp) {
+		return
+	}
+
+	// the representation depends on the header, even when not compressed
+	if !hasVary(rsp.Header, "Accept-Encoding") {
+		rsp.Header.Add("Vary", "Accept-Encoding")
+	}
+
+	req := ctx.Request()
+	encoding, ok := selectEncoding(req.Header)
+	if !ok || !f.compressible(req, rsp) {
+		return
+	}
+
+	rsp.Body = compressBody(rsp.Body, f.writer(encoding))
+	rsp.ContentLength = -1
+	rsp.Header.Del("Content-Length")
+	rsp.Header.Set("Content-Encoding", encoding)
+	if etag := rsp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		rsp.Header.Set("ETag", "W/"+etag)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var testCompressContent = strings.Repeat(`{"id": "42", "name": "foo", "status": "active"}`, 32)
+
+func compressResponse(t *testing.T, args []interface{}, req *http.Request, rsp *http.Response) *http.Response {
+	f, err := NewCompress().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	f.Response(&filtertest.Context{FRequest: req, FResponse: rsp})
+	return rsp
+}
+
+func testCompressResponse(contentType string) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{contentType}, "Etag": []string{`"v1"`}},
+		ContentLength: int64(len(testCompressContent)),
+		Body:          ioutil.NopCloser(strings.NewReader(testCompressContent))}
+}
+
+func acceptEncoding(v string) *http.Request {
+	return &http.Request{Header: http.Header{"Accept-Encoding": []string{v}}}
+}
+
+func TestCompressInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{float64(0)},
+		{float64(10)},
+		{1.5},
+		{""},
+		{"text/html", float64(1)},
+	} {
+		if _, err := NewCompress().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	for _, ti := range []struct {
+		accept   string
+		encoding string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, *", "deflate"},
+		{"*", "gzip"},
+		{"br, *;q=0", ""},
+	} {
+		rsp := compressResponse(t, nil, acceptEncoding(ti.accept), testCompressResponse("application/json"))
+		if e := rsp.Header.Get("Content-Encoding"); e != ti.encoding {
+			t.Errorf("invalid content coding for %q: %q, expected: %q", ti.accept, e, ti.encoding)
+		}
+
+		if rsp.Header.Get("Vary") != "Accept-Encoding" {
+			t.Error("failed to set the Vary header", ti.accept)
+		}
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		rsp := compressResponse(t, []interface{}{float64(9)}, acceptEncoding(encoding), testCompressResponse("application/json; charset=utf-8"))
+		if rsp.ContentLength != -1 || rsp.Header.Get("Content-Length") != "" {
+			t.Error("failed to drop the content length")
+		}
+
+		if rsp.Header.Get("Etag") != `W/"v1"` {
+			t.Error("failed to weaken the etag", rsp.Header.Get("Etag"))
+		}
+
+		var r io.Reader
+		if encoding == "gzip" {
+			var err error
+			if r, err = gzip.NewReader(rsp.Body); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			r = flate.NewReader(rsp.Body)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, []byte(testCompressContent)) {
+			t.Error("invalid content", encoding)
+		}
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	short := testCompressResponse("text/html")
+	short.ContentLength = 42
+
+	encoded := testCompressResponse("text/html")
+	encoded.Header.Set("Content-Encoding", "gzip")
+
+	noTransform := testCompressResponse("text/html")
+	noTransform.Header.Set("Cache-Control", "public, no-transform")
+
+	notModified := testCompressResponse("text/html")
+	notModified.StatusCode = http.StatusNotModified
+
+	head := acceptEncoding("gzip")
+	head.Method = "HEAD"
+
+	for _, ti := range []struct {
+		msg  string
+		args []interface{}
+		req  *http.Request
+		rsp  *http.Response
+		vary bool
+	}{
+		{"type", nil, acceptEncoding("gzip"), testCompressResponse("image/png"), false},
+		{"configured type", []interface{}{"text/csv"}, acceptEncoding("gzip"), testCompressResponse("text/html"), false},
+		{"short", nil, acceptEncoding("gzip"), short, true},
+		{"encoded", nil, acceptEncoding("gzip"), encoded, true},
+		{"no transform", nil, acceptEncoding("gzip"), noTransform, true},
+		{"not modified", nil, acceptEncoding("gzip"), notModified, true},
+		{"head", nil, head, testCompressResponse("text/html"), true},
+	} {
+		encoding := ti.rsp.Header.Get("Content-Encoding")
+		rsp := compressResponse(t, ti.args, ti.req, ti.rsp)
+		if rsp.Header.Get("Content-Encoding") != encoding || rsp.Header.Get("Etag") != `"v1"` {
+			t.Error("unexpected compression", ti.msg)
+		}
+
+		if (rsp.Header.Get("Vary") != "") != ti.vary {
+			t.Error("invalid Vary header", ti.msg)
+		}
+	}
+}
+
+func TestCompressKeepsVary(t *testing.T) {
+	rsp := testCompressResponse("text/html")
+	rsp.Header.Set("Vary", "Origin, accept-encoding")
+	compressResponse(t, nil, acceptEncoding("gzip"), rsp)
+	if len(rsp.Header["Vary"]) != 1 {
+		t.Error("failed to keep the Vary header", rsp.Header["Vary"])
+	}
+}
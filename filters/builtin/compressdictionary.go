@@ -0,0 +1,228 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the content coding of the responses compressed with the shared
+	// dictionary
+	dictionaryEncoding = "deflate-dict"
+
+	availableDictionaryHeader = "Available-Dictionary"
+
+	// the deflate window, only this many bytes at the end of the
+	// dictionary are used
+	maxDictionaryWindow = 32 << 10
+)
+
+type compressDictionary struct {
+	dictionary []byte
+	hash       string
+	minLength  int64
+}
+
+// Returns a filter specification whose instances compress the response
+// bodies with a shared dictionary, for the clients that have the same
+// dictionary, e.g. in case of highly repetitive JSON APIs, where the
+// dictionary contains the common keys and values of the responses.
+//
+// The negotiation follows the compression dictionary transport: the
+// clients advertise the dictionary they have in the
+// Available-Dictionary request header, containing the SHA-256 hash of
+// the dictionary as a structured field byte sequence, e.g.
+// ":pZGm1Av0IEBKARczz7exkNYsZb8LzaMrV7J32a2fFG4=:", and they advertise
+// the deflate-dict content coding in the Accept-Encoding header.
+//
+// Since Brotli and Zstandard are not available in the dependencies, the
+// responses are compressed with the zlib format using the dictionary as
+// a preset dictionary, and sent with the deflate-dict content coding,
+// which is specific to skipper. The clients can decompress them with any
+// zlib implementation supporting preset dictionaries, e.g. with
+// zlib.NewReaderDict in Go. Only the last 32KB of the dictionary are
+// used.
+//
+// The responses that already have a Content-Encoding header, and the
+// responses with a status other than 200, are not compressed.
+//
+// Instances expect the path of the dictionary file, and optionally the
+// minimum content length in bytes, under which the responses with a
+// known content length are not compressed:
+//
+//     compressDictionary("/etc/skipper/api.dict")
+//     compressDictionary("/etc/skipper/api.dict", 512)
+//
+// Name: "compressDictionary".
+func NewCompressDictionary() filters.Spec { return &compressDictionary{} }
+
+// "compressDictionary"
+func (spec *compressDictionary) Name() string { return CompressDictionaryName }
+
+func (spec *compressDictionary) Description() string {
+	return "Compresses the response bodies with a shared dictionary, for the clients that have the dictionary."
+}
+
+func (spec *compressDictionary) Signature() string { return "path string, [minLength number]" }
+
+func (spec *compressDictionary) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	path, ok := config[0].(string)
+	if !ok || path == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var minLength float64
+	if len(config) == 2 {
+		if minLength, ok = config[1].(float64); !ok || minLength < 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	dictionary, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(dictionary)
+	if len(dictionary) > maxDictionaryWindow {
+		dictionary = dictionary[len(dictionary)-maxDictionaryWindow:]
+	}
+
+	return &compressDictionary{
+		dictionary: dictionary,
+		hash:       ":" + base64.StdEncoding.EncodeToString(sum[:]) + ":",
+		minLength:  int64(minLength)}, nil
+}
+
+// returns the quality of a content coding in an Accept-Encoding header,
+// or, when the coding is not listed, the quality of the "*" wildcard.
+// Returns -1 when neither is listed.
+func encodingQuality(h http.Header, encoding string) float64 {
+	quality, wildcard := -1.0, -1.0
+	for _, v := range h["Accept-Encoding"] {
+		for _, e := range strings.Split(v, ",") {
+			parts := strings.Split(e, ";")
+			name := strings.TrimSpace(parts[0])
+			if !strings.EqualFold(name, encoding) && name != "*" {
+				continue
+			}
+
+			q := 1.0
+			for _, p := range parts[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if pq, err := strconv.ParseFloat(p[2:], 64); err == nil {
+						q = pq
+					}
+				}
+			}
+
+			if name == "*" {
+				wildcard = q
+			} else {
+				quality = q
+			}
+		}
+	}
+
+	if quality < 0 {
+		return wildcard
+	}
+
+	return quality
+}
+
+// tells whether a content coding is listed in an Accept-Encoding header
+// with a non-zero quality
+func acceptsEncoding(h http.Header, encoding string) bool {
+	for _, v := range h["Accept-Encoding"] {
+		for _, e := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(strings.Split(e, ";")[0]), encoding) {
+				return encodingQuality(h, encoding) > 0
+			}
+		}
+	}
+
+	return false
+}
+
+// compresses the content of the reader with the writer into a pipe, and
+// returns the reading end of the pipe
+func compressBody(body io.ReadCloser, newWriter func(io.Writer) (io.WriteCloser, error)) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := newWriter(pw)
+		if err == nil {
+			_, err = io.Copy(w, body)
+		}
+
+		if err == nil {
+			err = w.Close()
+		}
+
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+func (f *compressDictionary) compress(req *http.Request, rsp *http.Response) bool {
+	if req.Header.Get(availableDictionaryHeader) != f.hash || !acceptsEncoding(req.Header, dictionaryEncoding) {
+		return false
+	}
+
+	if rsp.StatusCode != http.StatusOK || rsp.Body == nil || rsp.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	return rsp.ContentLength < 0 || rsp.ContentLength >= f.minLength && rsp.ContentLength > 0
+}
+
+// Noop.
+func (f *compressDictionary) Request(filters.FilterContext) {}
+
+// Replaces the response body with the compressed one, when the client
+// has the dictionary.
+func (f *compressDictionary) Response(ctx filters.FilterContext) {
+	rsp := ctx.Response()
+
+	// the response depends on these headers, even when not compressed
+	rsp.Header.Add("Vary", "Accept-Encoding, "+availableDictionaryHeader)
+
+	if !f.compress(ctx.Request(), rsp) {
+		return
+	}
+
+	rsp.Body = compressBody(rsp.Body, func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevelDict(w, zlib.DefaultCompression, f.dictionary)
+	})
+	rsp.ContentLength = -1
+	rsp.Header.Del("Content-Length")
+	rsp.Header.Set("Content-Encoding", dictionaryEncoding)
+}
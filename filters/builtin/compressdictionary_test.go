@@ -0,0 +1,156 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testDictionaryContent = `{"id": "", "name": "", "status": "active", "created_at": "", "tags": []}`
+
+func withTestDictionary(t *testing.T, test func(path, hash string)) {
+	f, err := ioutil.TempFile("", "skipper-dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testDictionaryContent); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	sum := sha256.Sum256([]byte(testDictionaryContent))
+	test(f.Name(), ":"+base64.StdEncoding.EncodeToString(sum[:])+":")
+}
+
+func compressDictionaryResponse(t *testing.T, path string, reqHeader http.Header, rsp *http.Response) *http.Response {
+	f, err := NewCompressDictionary().CreateFilter([]interface{}{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.Header == nil {
+		rsp.Header = make(http.Header)
+	}
+
+	f.Response(&filtertest.Context{
+		FRequest:  &http.Request{Header: reqHeader},
+		FResponse: rsp})
+	return rsp
+}
+
+func TestCompressDictionaryInvalidConfig(t *testing.T) {
+	withTestDictionary(t, func(path, _ string) {
+		for _, args := range [][]interface{}{
+			nil,
+			{float64(1)},
+			{"/no/such/dictionary"},
+			{path, "512"},
+			{path, float64(-1)},
+			{path, float64(1), float64(2)},
+		} {
+			if _, err := NewCompressDictionary().CreateFilter(args); err == nil {
+				t.Error("failed to fail", args)
+			}
+		}
+	})
+}
+
+func TestCompressDictionary(t *testing.T) {
+	withTestDictionary(t, func(path, hash string) {
+		content := `[{"id": "42", "name": "foo", "status": "active", "created_at": "2016-01-01", "tags": []}]`
+		rsp := compressDictionaryResponse(t, path, http.Header{
+			"Accept-Encoding":         []string{"gzip, deflate-dict"},
+			availableDictionaryHeader: []string{hash}},
+			&http.Response{
+				StatusCode:    http.StatusOK,
+				ContentLength: int64(len(content)),
+				Header:        http.Header{"Content-Length": []string{"85"}},
+				Body:          ioutil.NopCloser(strings.NewReader(content))})
+
+		if rsp.Header.Get("Content-Encoding") != "deflate-dict" || rsp.ContentLength != -1 || rsp.Header.Get("Content-Length") != "" {
+			t.Error("failed to set the compression headers", rsp.Header)
+		}
+
+		if rsp.Header.Get("Vary") != "Accept-Encoding, Available-Dictionary" {
+			t.Error("failed to set the vary header", rsp.Header)
+		}
+
+		z, err := zlib.NewReaderDict(rsp.Body, []byte(testDictionaryContent))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(z)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != content {
+			t.Error("failed to compress the content", string(b))
+		}
+	})
+}
+
+func TestCompressDictionaryNotApplied(t *testing.T) {
+	withTestDictionary(t, func(path, hash string) {
+		for _, ti := range []struct {
+			msg       string
+			reqHeader http.Header
+			rsp       *http.Response
+		}{{
+			"no dictionary",
+			http.Header{"Accept-Encoding": []string{"deflate-dict"}},
+			&http.Response{StatusCode: http.StatusOK, ContentLength: -1},
+		}, {
+			"different dictionary",
+			http.Header{"Accept-Encoding": []string{"deflate-dict"}, availableDictionaryHeader: []string{":YWJj:"}},
+			&http.Response{StatusCode: http.StatusOK, ContentLength: -1},
+		}, {
+			"encoding not accepted",
+			http.Header{"Accept-Encoding": []string{"gzip, deflate-dict;q=0"}, availableDictionaryHeader: []string{hash}},
+			&http.Response{StatusCode: http.StatusOK, ContentLength: -1},
+		}, {
+			"already encoded",
+			http.Header{"Accept-Encoding": []string{"deflate-dict"}, availableDictionaryHeader: []string{hash}},
+			&http.Response{StatusCode: http.StatusOK, ContentLength: -1, Header: http.Header{"Content-Encoding": []string{"gzip"}}},
+		}, {
+			"not ok",
+			http.Header{"Accept-Encoding": []string{"deflate-dict"}, availableDictionaryHeader: []string{hash}},
+			&http.Response{StatusCode: http.StatusNotFound, ContentLength: -1},
+		}, {
+			"empty",
+			http.Header{"Accept-Encoding": []string{"deflate-dict"}, availableDictionaryHeader: []string{hash}},
+			&http.Response{StatusCode: http.StatusOK, ContentLength: 0},
+		}} {
+			ti.rsp.Body = ioutil.NopCloser(bytes.NewBufferString("Hello, world!"))
+			rsp := compressDictionaryResponse(t, path, ti.reqHeader, ti.rsp)
+			if rsp.Header.Get("Content-Encoding") == "deflate-dict" {
+				t.Error(ti.msg, "unexpected compression")
+			}
+		}
+	})
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"compress/gzip"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// the value of the optional mode argument that enables the compression
+// regardless of the advertised support of the backend
+const compressRequestAlways = "always"
+
+type compressRequest struct {
+	minLength int64
+	always    bool
+	backends  *acceptedEncodings
+}
+
+// the backends that advertised the support of gzip request bodies
+type acceptedEncodings struct {
+	mx   sync.Mutex
+	gzip map[string]bool
+}
+
+// compresses the body lazily, on the first read, so that no goroutine
+// is started, when the request is never sent to the backend
+type gzipBody struct {
+	mx     sync.Mutex
+	body   io.ReadCloser
+	reader *io.PipeReader
+	closed bool
+}
+
+// Returns a filter specification whose instances compress the request
+// body with gzip before it is forwarded to the backend, when the backend
+// advertises the support of gzip request bodies.
+//
+// A backend advertises the support, as described in RFC 7694, with an
+// Accept-Encoding header containing gzip in its responses. The filter
+// learns it from the responses of the backend, so the requests are
+// compressed starting from the first request after such a response,
+// and stop being compressed when the backend responds with 415
+// Unsupported Media Type, or with an Accept-Encoding header not
+// containing gzip. With the "always"
+// mode argument, the requests are compressed without checking the
+// support of the backend:
+//
+//     compressRequest(1024, "always")
+//
+// The body is compressed while it is streamed to the backend, and it is
+// sent with chunked transfer encoding. Requests without body, and
+// requests that already have a Content-Encoding header are not changed.
+//
+// Instances accept an optional parameter: the minimum content length in
+// bytes. Requests with a known content length below it are not
+// compressed.
+//
+// Name: "compressRequest".
+func NewCompressRequest() filters.Spec {
+	return &compressRequest{backends: &acceptedEncodings{gzip: make(map[string]bool)}}
+}
+
+// "compressRequest"
+func (spec *compressRequest) Name() string { return CompressRequestName }
+
+func (spec *compressRequest) Description() string {
+	return "Compresses the request bodies with gzip before forwarding them to the backends advertising the support."
+}
+
+func (spec *compressRequest) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "minLength", Type: filters.NumberType, Optional: true},
+		{Name: "mode", Type: filters.StringType, Optional: true},
+	}
+}
+
+func (spec *compressRequest) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &compressRequest{backends: spec.backends}
+	if len(config) >= 1 {
+		minLength, ok := config[0].(float64)
+		if !ok || minLength < 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.minLength = int64(minLength)
+	}
+
+	if len(config) == 2 {
+		if mode, ok := config[1].(string); !ok || mode != compressRequestAlways {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.always = true
+	}
+
+	return f, nil
+}
+
+func (a *acceptedEncodings) supported(backend string) bool {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.gzip[backend]
+}
+
+// records whether the backend accepts gzip request bodies, based on the
+// Accept-Encoding header of its response. The responses without the
+// header don't change it, except for 415 Unsupported Media Type.
+func (a *acceptedEncodings) update(backend string, rsp *http.Response) {
+	values, set := rsp.Header["Accept-Encoding"]
+	if !set && rsp.StatusCode != http.StatusUnsupportedMediaType {
+		return
+	}
+
+	var accepted bool
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.TrimSpace(strings.SplitN(e, ";", 2)[0])
+			if strings.EqualFold(e, "gzip") {
+				accepted = true
+			}
+		}
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if accepted {
+		a.gzip[backend] = true
+	} else {
+		delete(a.gzip, backend)
+	}
+}
+
+// starts the compression, when it was not started or closed yet, and
+// returns the reader of the compressed content
+func (b *gzipBody) start() *io.PipeReader {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.closed || b.reader != nil {
+		return b.reader
+	}
+
+	pr, pw := io.Pipe()
+	b.reader = pr
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, b.body)
+		if err == nil {
+			err = gz.Close()
+		}
+
+		b.body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	r := b.start()
+	if r == nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	return r.Read(p)
+}
+
+// Closes the original body, and, when the compression was started,
+// stops it.
+func (b *gzipBody) Close() error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	if b.reader == nil {
+		return b.body.Close()
+	}
+
+	return b.reader.Close()
+}
+
+func (f *compressRequest) compress(ctx filters.FilterContext) bool {
+	r := ctx.Request()
+	if r.Body == nil || r.ContentLength == 0 || r.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	if r.ContentLength > 0 && r.ContentLength < f.minLength {
+		return false
+	}
+
+	return f.always || f.backends.supported(ctx.BackendUrl())
+}
+
+// Replaces the request body with the compressed one.
+func (f *compressRequest) Request(ctx filters.FilterContext) {
+	if !f.compress(ctx) {
+		return
+	}
+
+	r := ctx.Request()
+	r.Body = &gzipBody{body: r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+	r.Header.Set("Content-Encoding", "gzip")
+}
+
+// Records whether the backend advertised the support of gzip request
+// bodies.
+func (f *compressRequest) Response(ctx filters.FilterContext) {
+	if f.always || ctx.Response() == nil {
+		return
+	}
+
+	f.backends.update(ctx.BackendUrl(), ctx.Response())
+}
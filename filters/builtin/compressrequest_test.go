@@ -0,0 +1,236 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var compressAlways = []interface{}{float64(0), "always"}
+
+// an endless request body, recording when it was closed
+type endlessBody struct {
+	mx     sync.Mutex
+	closed bool
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *endlessBody) isClosed() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.closed
+}
+
+func compressRequestWith(t *testing.T, args []interface{}, r *http.Request) {
+	f, err := NewCompressRequest().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Request(&filtertest.Context{FRequest: r})
+}
+
+func TestCompressRequestInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{"1024"},
+		{float64(-1)},
+		{float64(1), float64(2)},
+		{float64(1), "sometimes"},
+		{float64(1), "always", "always"},
+	} {
+		if _, err := NewCompressRequest().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestCompressRequest(t *testing.T) {
+	content := strings.Repeat("Hello, world! ", 1<<10)
+	r, err := http.NewRequest("POST", "https://www.example.org", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressRequestWith(t, compressAlways, r)
+	if r.Header.Get("Content-Encoding") != "gzip" || r.ContentLength != -1 {
+		t.Error("failed to set compression headers")
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != content {
+		t.Error("invalid content")
+	}
+}
+
+func TestCompressRequestBelowMinLength(t *testing.T) {
+	r, err := http.NewRequest("POST", "https://www.example.org", bytes.NewBufferString("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressRequestWith(t, []interface{}{float64(1024)}, r)
+	if r.Header.Get("Content-Encoding") != "" || r.ContentLength != 13 {
+		t.Error("failed to skip compression")
+	}
+}
+
+func TestCompressRequestAlreadyEncoded(t *testing.T) {
+	r, err := http.NewRequest("POST", "https://www.example.org", bytes.NewBufferString("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Content-Encoding", "deflate")
+	compressRequestWith(t, compressAlways, r)
+	if r.Header.Get("Content-Encoding") != "deflate" {
+		t.Error("failed to skip compression")
+	}
+}
+
+func TestCompressRequestNoBody(t *testing.T) {
+	r, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressRequestWith(t, compressAlways, r)
+	if r.Header.Get("Content-Encoding") != "" || r.Body != nil {
+		t.Error("failed to skip compression")
+	}
+}
+
+func TestCompressRequestAdvertised(t *testing.T) {
+	spec := NewCompressRequest()
+	f, err := spec.CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the instances of the same spec share the advertised support
+	other, err := spec.CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundtrip := func(rsp *http.Response) bool {
+		r, _ := http.NewRequest("POST", "https://www.example.org", bytes.NewBufferString("Hello, world!"))
+		ctx := &filtertest.Context{FRequest: r, FBackendUrl: "https://backend.example.org"}
+		f.Request(ctx)
+		ctx.FResponse = rsp
+		other.Response(ctx)
+		return r.Header.Get("Content-Encoding") == "gzip"
+	}
+
+	for i, step := range []struct {
+		status         int
+		acceptEncoding string
+		compressed     bool
+	}{
+		{http.StatusOK, "", false},
+		{http.StatusOK, "", false},
+		{http.StatusOK, "deflate, gzip", false},
+		{http.StatusOK, "", true},
+		{http.StatusUnsupportedMediaType, "", true},
+		{http.StatusOK, "identity", false},
+		{http.StatusOK, "", false},
+	} {
+		rsp := &http.Response{StatusCode: step.status, Header: make(http.Header)}
+		if step.acceptEncoding != "" {
+			rsp.Header.Set("Accept-Encoding", step.acceptEncoding)
+		}
+
+		if roundtrip(rsp) != step.compressed {
+			t.Error("invalid compression", i, step.compressed)
+		}
+	}
+}
+
+func TestCompressRequestNotSent(t *testing.T) {
+	body := &endlessBody{}
+	r, err := http.NewRequest("POST", "https://www.example.org", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.ContentLength = -1
+	compressRequestWith(t, compressAlways, r)
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("failed to compress")
+	}
+
+	r.Body.Close()
+	if !body.isClosed() {
+		t.Error("failed to close the original body")
+	}
+
+	if _, err := r.Body.Read(make([]byte, 8)); err == nil {
+		t.Error("failed to fail reading the closed body")
+	}
+}
+
+func TestCompressRequestClosedWhileSending(t *testing.T) {
+	body := &endlessBody{}
+	r, err := http.NewRequest("POST", "https://www.example.org", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.ContentLength = -1
+	compressRequestWith(t, compressAlways, r)
+	if _, err := r.Body.Read(make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Body.Close()
+	to := time.After(3 * time.Second)
+	for !body.isClosed() {
+		select {
+		case <-to:
+			t.Fatal("failed to stop the compression")
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
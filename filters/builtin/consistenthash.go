@@ -0,0 +1,247 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the number of points on the hash ring per backend, to get an even
+// distribution of the keys
+const hashRingReplicas = 128
+
+// returns a part of the hash key from the request, and false, if the
+// attribute is not present
+type hashKeyTerm func(ctx filters.FilterContext) (string, bool)
+
+type hashRingPoint struct {
+	hash    uint32
+	backend string
+}
+
+type hashRing []hashRingPoint
+
+type consistentHash struct {
+	key  []hashKeyTerm
+	ring hashRing
+}
+
+func (r hashRing) Len() int           { return len(r) }
+func (r hashRing) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r hashRing) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func newHashRing(backends []string) hashRing {
+	var r hashRing
+	for _, b := range backends {
+		for i := 0; i < hashRingReplicas; i++ {
+			r = append(r, hashRingPoint{hashString(b + "#" + strconv.Itoa(i)), b})
+		}
+	}
+
+	sort.Sort(r)
+	return r
+}
+
+// returns the backend owning the first point on the ring at or after
+// the hash of the key
+func (r hashRing) backend(key string) string {
+	h := hashString(key)
+	i := sort.Search(len(r), func(i int) bool { return r[i].hash >= h })
+	if i == len(r) {
+		i = 0
+	}
+
+	return r[i].backend
+}
+
+func headerTerm(name string) hashKeyTerm {
+	return func(ctx filters.FilterContext) (string, bool) {
+		v, ok := ctx.Request().Header[http.CanonicalHeaderKey(name)]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+
+		return v[0], true
+	}
+}
+
+func cookieTerm(name string) hashKeyTerm {
+	return func(ctx filters.FilterContext) (string, bool) {
+		c, err := ctx.Request().Cookie(name)
+		if err != nil {
+			return "", false
+		}
+
+		return c.Value, true
+	}
+}
+
+// path segments are indexed from zero, not counting the leading slash
+func pathSegmentTerm(index int) hashKeyTerm {
+	return func(ctx filters.FilterContext) (string, bool) {
+		segments := strings.Split(strings.TrimPrefix(ctx.Request().URL.Path, "/"), "/")
+		if index >= len(segments) || segments[index] == "" {
+			return "", false
+		}
+
+		return segments[index], true
+	}
+}
+
+func pathParamTerm(name string) hashKeyTerm {
+	return func(ctx filters.FilterContext) (string, bool) {
+		v := ctx.PathParam(name)
+		return v, v != ""
+	}
+}
+
+func parseHashKeyTerm(expression string) (hashKeyTerm, bool) {
+	parts := strings.SplitN(expression, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, false
+	}
+
+	switch parts[0] {
+	case "header":
+		return headerTerm(parts[1]), true
+	case "cookie":
+		return cookieTerm(parts[1]), true
+	case "path":
+		index, err := strconv.Atoi(parts[1])
+		if err != nil || index < 0 {
+			return nil, false
+		}
+
+		return pathSegmentTerm(index), true
+	case "param":
+		return pathParamTerm(parts[1]), true
+	default:
+		return nil, false
+	}
+}
+
+func parseHashKey(expression string) ([]hashKeyTerm, bool) {
+	var key []hashKeyTerm
+	for _, e := range strings.Split(expression, "+") {
+		term, ok := parseHashKeyTerm(strings.TrimSpace(e))
+		if !ok {
+			return nil, false
+		}
+
+		key = append(key, term)
+	}
+
+	return key, true
+}
+
+func isBackendUrl(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// Returns a filter specification whose instances select the backend of
+// the request from a set of backends, using consistent hashing, so that
+// the requests with the same key are always forwarded to the same
+// backend, and when a backend is added or removed, only a small portion
+// of the keys are mapped to a different backend. It is meant to be used
+// with cache-sharded backends.
+//
+// The first parameter of the filter is the expression of the hash key,
+// a list of request attributes joined by '+', where the attributes can
+// be:
+//
+//     header:<name>  - the value of a request header
+//     cookie:<name>  - the value of a cookie
+//     path:<index>   - a segment of the request path, indexed from 0
+//     param:<name>   - a wildcard parameter of the path condition
+//
+// The rest of the parameters are the backend addresses, e.g.:
+//
+//     consistentHash("header:X-Tenant+path:1", "http://cache1", "http://cache2")
+//
+// When none of the attributes are present in a request, the request is
+// forwarded to the backend of the route.
+//
+// Name: "consistentHash".
+func NewConsistentHash() filters.Spec { return &consistentHash{} }
+
+// "consistentHash"
+func (spec *consistentHash) Name() string { return ConsistentHashName }
+
+func (spec *consistentHash) Description() string {
+	return "Selects the backend from a set of backends by the consistent hash of a request key."
+}
+
+func (spec *consistentHash) Signature() string { return "key string, backend string, ..." }
+
+func (spec *consistentHash) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	expression, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	key, ok := parseHashKey(expression)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var backends []string
+	for _, c := range config[1:] {
+		b, ok := c.(string)
+		if !ok || !isBackendUrl(b) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		backends = append(backends, b)
+	}
+
+	return &consistentHash{key, newHashRing(backends)}, nil
+}
+
+// Selects the backend for the request by the hash key.
+func (f *consistentHash) Request(ctx filters.FilterContext) {
+	values := make([]string, len(f.key))
+	var found bool
+	for i, term := range f.key {
+		var ok bool
+		values[i], ok = term(ctx)
+		found = found || ok
+	}
+
+	if !found {
+		return
+	}
+
+	ctx.StateBag()[filters.BackendUrlKey] = f.ring.backend(strings.Join(values, "\x00"))
+}
+
+// Noop.
+func (f *consistentHash) Response(filters.FilterContext) {}
@@ -0,0 +1,156 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+var hashBackends = []interface{}{"http://cache1", "http://cache2", "http://cache3", "http://cache4"}
+
+func hashBackend(t *testing.T, config []interface{}, req *http.Request, params map[string]string) string {
+	f, err := NewConsistentHash().CreateFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &filtertest.Context{
+		FRequest:  req,
+		FParams:   params,
+		FStateBag: make(map[string]interface{})}
+	f.Request(c)
+
+	b, _ := c.FStateBag[filters.BackendUrlKey].(string)
+	return b
+}
+
+func hashConfig(key string, backends []interface{}) []interface{} {
+	return append([]interface{}{key}, backends...)
+}
+
+func TestConsistentHashInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{"header:X-Tenant"},
+		{42, "http://cache1"},
+		{"", "http://cache1"},
+		{"header:", "http://cache1"},
+		{"query:id", "http://cache1"},
+		{"path:-1", "http://cache1"},
+		{"path:one", "http://cache1"},
+		{"header:X-Tenant+", "http://cache1"},
+		{"header:X-Tenant", 42},
+		{"header:X-Tenant", "cache1"},
+	} {
+		if _, err := NewConsistentHash().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestConsistentHashKeyTerms(t *testing.T) {
+	for _, ti := range []struct {
+		msg    string
+		key    string
+		found  func(*http.Request)
+		params map[string]string
+	}{{
+		"header",
+		"header:X-Tenant",
+		func(r *http.Request) { r.Header.Set("X-Tenant", "tenant1") },
+		nil,
+	}, {
+		"cookie",
+		"cookie:session",
+		func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "abc"}) },
+		nil,
+	}, {
+		"path segment",
+		"path:1",
+		func(r *http.Request) { r.URL.Path = "/shards/42/items" },
+		nil,
+	}, {
+		"path param",
+		"param:id",
+		func(*http.Request) {},
+		map[string]string{"id": "42"},
+	}} {
+		req, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		if b := hashBackend(t, hashConfig(ti.key, hashBackends), req, nil); b != "" {
+			t.Error(ti.msg, "unexpected backend for missing attribute", b)
+		}
+
+		ti.found(req)
+		b := hashBackend(t, hashConfig(ti.key, hashBackends), req, ti.params)
+		if b == "" {
+			t.Error(ti.msg, "failed to select backend")
+		}
+
+		if bb := hashBackend(t, hashConfig(ti.key, hashBackends), req, ti.params); bb != b {
+			t.Error(ti.msg, "inconsistent backend", b, bb)
+		}
+	}
+}
+
+func TestConsistentHashCombinedKey(t *testing.T) {
+	config := hashConfig("header:X-Tenant+path:0", hashBackends)
+	selected := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("https://www.example.org/%d", i), nil)
+		req.Header.Set("X-Tenant", "tenant1")
+		selected[hashBackend(t, config, req, nil)] = true
+	}
+
+	if len(selected) < 2 {
+		t.Error("failed to use all key terms")
+	}
+}
+
+func TestConsistentHashDistributionAndStability(t *testing.T) {
+	const keys = 4096
+
+	all := make([]string, keys)
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		req, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		req.Header.Set("X-Tenant", fmt.Sprintf("tenant%d", i))
+		all[i] = hashBackend(t, hashConfig("header:X-Tenant", hashBackends), req, nil)
+		counts[all[i]]++
+	}
+
+	for _, b := range hashBackends {
+		if c := counts[b.(string)]; c < keys/len(hashBackends)/2 {
+			t.Error("uneven distribution", b, c)
+		}
+	}
+
+	var moved int
+	for i := 0; i < keys; i++ {
+		req, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		req.Header.Set("X-Tenant", fmt.Sprintf("tenant%d", i))
+		b := hashBackend(t, hashConfig("header:X-Tenant", hashBackends[:3]), req, nil)
+		if all[i] != "http://cache4" && b != all[i] {
+			moved++
+		}
+	}
+
+	if moved > 0 {
+		t.Error("keys of remaining backends moved", moved)
+	}
+}
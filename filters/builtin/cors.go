@@ -0,0 +1,265 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCorsMethods = "GET, HEAD, PUT, PATCH, POST, DELETE"
+
+type cors struct {
+	anyOrigin bool
+	origins   []*regexp.Regexp
+	methods   []string
+	headers   []string
+	maxAge    time.Duration
+}
+
+// Returns a filter specification whose instances handle the cross-origin
+// requests of the browsers. The preflight requests, OPTIONS requests
+// with the Access-Control-Request-Method header, are answered directly
+// by the filter, and they are not forwarded to the backend. The
+// responses of the other requests from the allowed origins get the
+// Access-Control-Allow-Origin header.
+//
+// Instances expect a comma separated list of the allowed origins, and
+// optionally the allowed methods, the allowed request headers, and the
+// time for which the browsers can cache the preflight responses, e.g.:
+//
+//     cors("*")
+//     cors("https://www.example.org, https://*.example.org", "GET, POST", "Authorization, Content-Type", "10m")
+//     cors("^https://[a-z]+\\.example\\.(org|com)$")
+//
+// In the origins, "*" allows any origin, the * in the other entries
+// matches a single label of a host name, and the entries starting with
+// ^ are regular expressions, that cannot contain commas. The default
+// methods are GET, HEAD, PUT, PATCH, POST and DELETE. When the headers
+// are not set, or empty, the headers requested by the browser are
+// allowed.
+// Preflight requests from other origins, or requesting other methods or
+// headers, are rejected with 403 Forbidden.
+//
+// Name: "cors".
+func NewCors() filters.Spec { return &cors{} }
+
+// "cors"
+func (spec *cors) Name() string { return CorsName }
+
+func (spec *cors) Description() string {
+	return "Answers the CORS preflight requests, and allows the cross-origin requests from the listed origins."
+}
+
+func (spec *cors) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "origins", Type: filters.StringType},
+		{Name: "methods", Type: filters.StringType, Optional: true},
+		{Name: "headers", Type: filters.StringType, Optional: true},
+		{Name: "maxAge", Type: filters.DurationType, Optional: true},
+	}
+}
+
+// splits a comma separated list, dropping the empty items
+func splitCommaList(s string) []string {
+	var l []string
+	for _, si := range strings.Split(s, ",") {
+		if si = strings.TrimSpace(si); si != "" {
+			l = append(l, si)
+		}
+	}
+
+	return l
+}
+
+// compiles an origin to a regular expression. The * matches any part
+// of a host name.
+func compileOrigin(o string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(o, "^") {
+		return regexp.Compile(o)
+	}
+
+	parts := strings.Split(o, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	return regexp.Compile("^" + strings.Join(parts, "[^./:]+") + "$")
+}
+
+func (spec *cors) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 4 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	s := make([]string, 3)
+	for i := 0; i < len(config) && i < 3; i++ {
+		si, ok := config[i].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		s[i] = si
+	}
+
+	f := &cors{}
+	origins := splitCommaList(s[0])
+	if len(origins) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	for _, o := range origins {
+		if o == "*" {
+			f.anyOrigin = true
+			continue
+		}
+
+		rx, err := compileOrigin(o)
+		if err != nil {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.origins = append(f.origins, rx)
+	}
+
+	if s[1] == "" {
+		s[1] = defaultCorsMethods
+	}
+
+	for _, m := range splitCommaList(s[1]) {
+		f.methods = append(f.methods, strings.ToUpper(m))
+	}
+
+	for _, h := range splitCommaList(s[2]) {
+		f.headers = append(f.headers, http.CanonicalHeaderKey(h))
+	}
+
+	if len(config) == 4 {
+		var ok bool
+		if f.maxAge, ok = filters.DurationArg(config[3]); !ok || f.maxAge < 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return f, nil
+}
+
+func (f *cors) allowedOrigin(origin string) bool {
+	if f.anyOrigin {
+		return true
+	}
+
+	for _, rx := range f.origins {
+		if rx.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *cors) allowedMethod(method string) bool {
+	for _, m := range f.methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the requested headers, or false, when any of them is not
+// allowed
+func (f *cors) allowedHeaders(requested string) ([]string, bool) {
+	headers := splitCommaList(requested)
+	if len(f.headers) == 0 {
+		return headers, true
+	}
+
+	for _, h := range headers {
+		allowed := false
+		for _, ah := range f.headers {
+			if strings.EqualFold(h, ah) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return nil, false
+		}
+	}
+
+	return f.headers, true
+}
+
+// sets the allowed origin. When not any origin is allowed, the response
+// depends on the origin, and the caches are notified with the Vary
+// header.
+func (f *cors) setAllowOrigin(h http.Header, origin string) {
+	if f.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+}
+
+// Answers the preflight requests.
+func (f *cors) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	method := r.Header.Get("Access-Control-Request-Method")
+	origin := r.Header.Get("Origin")
+	if r.Method != "OPTIONS" || method == "" || origin == "" {
+		return
+	}
+
+	w := ctx.ResponseWriter()
+	ctx.MarkServed()
+
+	headers, ok := f.allowedHeaders(r.Header.Get("Access-Control-Request-Headers"))
+	if !ok || !f.allowedOrigin(origin) || !f.allowedMethod(strings.ToUpper(method)) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	h := w.Header()
+	f.setAllowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(f.methods, ", "))
+	if len(headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+
+	if f.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(f.maxAge/time.Second)))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Allows the responses of the requests from the allowed origins.
+func (f *cors) Response(ctx filters.FilterContext) {
+	origin := ctx.Request().Header.Get("Origin")
+	if origin == "" || !f.allowedOrigin(origin) {
+		return
+	}
+
+	f.setAllowOrigin(ctx.Response().Header, origin)
+}
@@ -0,0 +1,242 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCorsInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{""},
+		{42},
+		{"^https://(", "GET"},
+		{"*", 42},
+		{"*", "GET", 42},
+		{"*", "GET", "", "foo"},
+		{"*", "GET", "", -1.0},
+		{"*", "GET", "", "1m", "foo"},
+	} {
+		if _, err := NewCors().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	for _, ti := range []struct {
+		title         string
+		args          []interface{}
+		method        string
+		origin        string
+		requestMethod string
+		headers       string
+		served        bool
+		code          int
+		allowOrigin   string
+		allowMethods  string
+		allowHeaders  string
+		maxAge        string
+	}{{
+		title:  "not a preflight",
+		args:   []interface{}{"*"},
+		method: "GET",
+		origin: "https://www.example.org",
+	}, {
+		title:  "options without request method",
+		args:   []interface{}{"*"},
+		method: "OPTIONS",
+		origin: "https://www.example.org",
+	}, {
+		title:         "any origin",
+		args:          []interface{}{"*"},
+		method:        "OPTIONS",
+		origin:        "https://www.example.org",
+		requestMethod: "PUT",
+		served:        true,
+		code:          http.StatusNoContent,
+		allowOrigin:   "*",
+		allowMethods:  defaultCorsMethods,
+	}, {
+		title:         "listed origin",
+		args:          []interface{}{"https://www.example.org, https://app.example.com", "GET, post", "Authorization, content-type", "10m"},
+		method:        "OPTIONS",
+		origin:        "https://app.example.com",
+		requestMethod: "POST",
+		headers:       "content-type",
+		served:        true,
+		code:          http.StatusNoContent,
+		allowOrigin:   "https://app.example.com",
+		allowMethods:  "GET, POST",
+		allowHeaders:  "Authorization, Content-Type",
+		maxAge:        "600",
+	}, {
+		title:         "wildcard origin",
+		args:          []interface{}{"https://*.example.org"},
+		method:        "OPTIONS",
+		origin:        "https://api.example.org",
+		requestMethod: "GET",
+		headers:       "X-Foo, X-Bar",
+		served:        true,
+		code:          http.StatusNoContent,
+		allowOrigin:   "https://api.example.org",
+		allowMethods:  defaultCorsMethods,
+		allowHeaders:  "X-Foo, X-Bar",
+	}, {
+		title:         "wildcard matches a single label",
+		args:          []interface{}{"https://*.example.org"},
+		method:        "OPTIONS",
+		origin:        "https://evil.com/.example.org",
+		requestMethod: "GET",
+		served:        true,
+		code:          http.StatusForbidden,
+	}, {
+		title:         "regexp origin",
+		args:          []interface{}{`^https://[a-z]+\.example\.(org|com)$`},
+		method:        "OPTIONS",
+		origin:        "https://app.example.com",
+		requestMethod: "GET",
+		served:        true,
+		code:          http.StatusNoContent,
+		allowOrigin:   "https://app.example.com",
+		allowMethods:  defaultCorsMethods,
+	}, {
+		title:         "origin not allowed",
+		args:          []interface{}{"https://www.example.org"},
+		method:        "OPTIONS",
+		origin:        "https://www.example.com",
+		requestMethod: "GET",
+		served:        true,
+		code:          http.StatusForbidden,
+	}, {
+		title:         "method not allowed",
+		args:          []interface{}{"*", "GET"},
+		method:        "OPTIONS",
+		origin:        "https://www.example.org",
+		requestMethod: "DELETE",
+		served:        true,
+		code:          http.StatusForbidden,
+	}, {
+		title:         "header not allowed",
+		args:          []interface{}{"*", "GET", "Authorization"},
+		method:        "OPTIONS",
+		origin:        "https://www.example.org",
+		requestMethod: "GET",
+		headers:       "Authorization, X-Foo",
+		served:        true,
+		code:          http.StatusForbidden,
+	}} {
+		f, err := NewCors().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		req, err := http.NewRequest(ti.method, "https://api.example.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Origin", ti.origin)
+		if ti.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", ti.requestMethod)
+		}
+
+		if ti.headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", ti.headers)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: req, FResponseWriter: w}
+		f.Request(ctx)
+		if ctx.FServed != ti.served {
+			t.Error(ti.title, "failed to serve the preflight request", ctx.FServed)
+			continue
+		}
+
+		if !ti.served {
+			continue
+		}
+
+		h := w.Header()
+		if w.Code != ti.code ||
+			h.Get("Access-Control-Allow-Origin") != ti.allowOrigin ||
+			h.Get("Access-Control-Allow-Methods") != ti.allowMethods ||
+			h.Get("Access-Control-Allow-Headers") != ti.allowHeaders ||
+			h.Get("Access-Control-Max-Age") != ti.maxAge {
+			t.Error(ti.title, "invalid response", w.Code, h)
+		}
+	}
+}
+
+func TestCorsResponse(t *testing.T) {
+	for _, ti := range []struct {
+		title       string
+		args        []interface{}
+		origin      string
+		allowOrigin string
+		vary        string
+	}{{
+		title: "not a cross-origin request",
+		args:  []interface{}{"*"},
+	}, {
+		title:       "any origin",
+		args:        []interface{}{"*"},
+		origin:      "https://www.example.org",
+		allowOrigin: "*",
+	}, {
+		title:       "listed origin",
+		args:        []interface{}{"https://www.example.org"},
+		origin:      "https://www.example.org",
+		allowOrigin: "https://www.example.org",
+		vary:        "Origin",
+	}, {
+		title:  "origin not allowed",
+		args:   []interface{}{"https://www.example.org"},
+		origin: "https://www.example.com",
+	}} {
+		f, err := NewCors().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "https://api.example.org/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ti.origin != "" {
+			req.Header.Set("Origin", ti.origin)
+		}
+
+		ctx := &filtertest.Context{FRequest: req, FResponse: &http.Response{Header: make(http.Header)}}
+		f.Request(ctx)
+		if ctx.FServed {
+			t.Error(ti.title, "unexpectedly served")
+			continue
+		}
+
+		f.Response(ctx)
+		h := ctx.FResponse.Header
+		if h.Get("Access-Control-Allow-Origin") != ti.allowOrigin || h.Get("Vary") != ti.vary {
+			t.Error(ti.title, "invalid response headers", h)
+		}
+	}
+}
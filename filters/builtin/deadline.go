@@ -0,0 +1,108 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"strconv"
+	"time"
+)
+
+// Default header used to forward the remaining time budget to the
+// backends.
+const DeadlineHeader = "X-Request-Deadline"
+
+type deadline struct {
+	timeout time.Duration
+	header  string
+}
+
+// Returns a filter specification whose instances forward the remaining
+// time budget of the request to the backend, in milliseconds, in a
+// header. The budget is calculated from the configured route timeout
+// minus the time elapsed since the request was received. When the
+// incoming request already contains a budget in the same header, e.g.
+// set by a previous hop, and it is lower than the configured timeout,
+// that one is used. The budget doesn't go below zero.
+//
+// Instances expect one or two parameters: the route timeout, either in
+// milliseconds or as a duration string, e.g. "3s", and optionally the
+// name of the header. The default header is X-Request-Deadline.
+//
+// Name: "deadline".
+func NewDeadline() filters.Spec { return &deadline{} }
+
+// "deadline"
+func (spec *deadline) Name() string { return DeadlineName }
+
+func (spec *deadline) Description() string {
+	return "Forwards the remaining time budget of the request to the backend in a header."
+}
+
+func (spec *deadline) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "timeout", Type: filters.DurationType},
+		{Name: "header", Type: filters.StringType, Optional: true},
+	}
+}
+
+func (spec *deadline) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	timeout, ok := filters.DurationArg(config[0])
+	if !ok || timeout < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	header := DeadlineHeader
+	if len(config) == 2 {
+		if header, ok = config[1].(string); !ok || header == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &deadline{timeout, header}, nil
+}
+
+func requestStart(ctx filters.FilterContext) time.Time {
+	if start, ok := ctx.StateBag()[filters.RequestStartKey].(time.Time); ok {
+		return start
+	}
+
+	return time.Now()
+}
+
+// Sets the remaining time budget in the request header.
+func (f *deadline) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+
+	budget := f.timeout
+	if incoming, err := strconv.ParseInt(req.Header.Get(f.header), 10, 64); err == nil &&
+		time.Duration(incoming)*time.Millisecond < budget {
+		budget = time.Duration(incoming) * time.Millisecond
+	}
+
+	budget -= time.Since(requestStart(ctx))
+	if budget < 0 {
+		budget = 0
+	}
+
+	req.Header.Set(f.header, strconv.FormatInt(int64(budget/time.Millisecond), 10))
+}
+
+// Noop.
+func (f *deadline) Response(filters.FilterContext) {}
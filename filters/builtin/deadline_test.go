@@ -0,0 +1,111 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func deadlineBudget(t *testing.T, args []interface{}, header string, incoming string, elapsed time.Duration) int {
+	f, err := NewDeadline().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &http.Request{Header: make(http.Header)}
+	if incoming != "" {
+		req.Header.Set(header, incoming)
+	}
+
+	c := &filtertest.Context{
+		FRequest:  req,
+		FStateBag: map[string]interface{}{filters.RequestStartKey: time.Now().Add(-elapsed)}}
+	f.Request(c)
+
+	budget, err := strconv.Atoi(req.Header.Get(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return budget
+}
+
+func TestDeadlineInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"3000"},
+		{"3 seconds"},
+		{float64(-1)},
+		{float64(3000), 42},
+		{float64(3000), ""},
+		{float64(3000), "X-Budget", "more"},
+	} {
+		if _, err := NewDeadline().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestDeadlineSubtractsElapsed(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{float64(3000)}, DeadlineHeader, "", 1000*time.Millisecond)
+	if b > 2000 || b < 1900 {
+		t.Error("invalid budget", b)
+	}
+}
+
+func TestDeadlineDurationString(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{"3s"}, DeadlineHeader, "", 1000*time.Millisecond)
+	if b > 2000 || b < 1900 {
+		t.Error("invalid budget", b)
+	}
+}
+
+func TestDeadlineUsesLowerIncomingBudget(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{float64(3000)}, DeadlineHeader, "500", 0)
+	if b > 500 || b < 400 {
+		t.Error("invalid budget", b)
+	}
+
+	b = deadlineBudget(t, []interface{}{float64(3000)}, DeadlineHeader, "5000", 0)
+	if b > 3000 || b < 2900 {
+		t.Error("invalid budget", b)
+	}
+}
+
+func TestDeadlineIgnoresInvalidIncomingBudget(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{float64(3000)}, DeadlineHeader, "soon", 0)
+	if b > 3000 || b < 2900 {
+		t.Error("invalid budget", b)
+	}
+}
+
+func TestDeadlineExhausted(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{float64(300)}, DeadlineHeader, "", time.Second)
+	if b != 0 {
+		t.Error("invalid budget", b)
+	}
+}
+
+func TestDeadlineCustomHeader(t *testing.T) {
+	b := deadlineBudget(t, []interface{}{float64(3000), "X-Budget"}, "X-Budget", "1000", 0)
+	if b > 1000 || b < 900 {
+		t.Error("invalid budget", b)
+	}
+}
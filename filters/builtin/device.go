@@ -0,0 +1,441 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The request headers set by the detectDevice filter. The headers sent
+// by the clients with the same names are removed.
+const (
+	DeviceClassHeader        = "X-Device-Class"
+	DeviceOSHeader           = "X-Device-Os"
+	DeviceBrowserHeader      = "X-Device-Browser"
+	DeviceBrowserMajorHeader = "X-Device-Browser-Major"
+)
+
+const (
+	// the time after which the rules file is checked for changes
+	deviceRulesCheckInterval = 10 * time.Second
+
+	clientHintMobile   = "Sec-Ch-Ua-Mobile"
+	clientHintPlatform = "Sec-Ch-Ua-Platform"
+	clientHintBrands   = "Sec-Ch-Ua"
+)
+
+// The ruleset used when the detectDevice filter is created without a
+// rules file. The rules of each list are evaluated in order, and the
+// first matching one wins. The first submatch of the browser patterns is
+// taken as the major version. The brands map the entries of the
+// Sec-CH-UA client hint to browser names, in order of preference.
+const defaultDeviceRules = `{
+	"devices": [
+		{"name": "bot", "pattern": "(?i)bot|crawl|spider|slurp|facebookexternalhit|curl/|wget/"},
+		{"name": "tv", "pattern": "(?i)smart-?tv|googletv|appletv|hbbtv|roku|crkey|tizen.+tv|webos.+tv"},
+		{"name": "tablet", "pattern": "(?i)ipad|tablet|kindle|silk/|playbook"},
+		{"name": "mobile", "pattern": "(?i)mobi|iphone|ipod|windows phone|blackberry|opera mini"},
+		{"name": "tablet", "pattern": "(?i)android"},
+		{"name": "desktop", "pattern": "(?i)windows nt|macintosh|x11|cros|linux"}
+	],
+	"os": [
+		{"name": "iOS", "pattern": "iPhone|iPad|iPod"},
+		{"name": "Android", "pattern": "Android"},
+		{"name": "Chrome OS", "pattern": "CrOS"},
+		{"name": "Windows", "pattern": "Windows"},
+		{"name": "macOS", "pattern": "Mac OS X|Macintosh"},
+		{"name": "Linux", "pattern": "Linux|X11"}
+	],
+	"browsers": [
+		{"name": "Edge", "pattern": "Edg(?:e|A|iOS)?/(\\d+)"},
+		{"name": "Opera", "pattern": "(?:OPR|Opera)/(\\d+)"},
+		{"name": "Samsung Internet", "pattern": "SamsungBrowser/(\\d+)"},
+		{"name": "Firefox", "pattern": "(?:Firefox|FxiOS)/(\\d+)"},
+		{"name": "Chrome", "pattern": "(?:Chrome|CriOS)/(\\d+)"},
+		{"name": "Safari", "pattern": "Version/(\\d+).*Safari/"}
+	],
+	"brands": [
+		{"brand": "Microsoft Edge", "name": "Edge"},
+		{"brand": "Opera", "name": "Opera"},
+		{"brand": "Samsung Internet", "name": "Samsung Internet"},
+		{"brand": "Google Chrome", "name": "Chrome"},
+		{"brand": "Chromium", "name": "Chromium"}
+	]
+}`
+
+var errMissingDevicePattern = errors.New("missing device rule name or pattern")
+
+// a rule matching the User-Agent header
+type deviceRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	rx      *regexp.Regexp
+}
+
+// maps a brand of the Sec-CH-UA client hint to a browser name
+type deviceBrandRule struct {
+	Brand string `json:"brand"`
+	Name  string `json:"name"`
+}
+
+type deviceRules struct {
+	Devices  []*deviceRule      `json:"devices"`
+	OS       []*deviceRule      `json:"os"`
+	Browsers []*deviceRule      `json:"browsers"`
+	Brands   []*deviceBrandRule `json:"brands"`
+}
+
+// the normalized properties of the client device, empty when unknown
+type deviceInfo struct {
+	class, os, browser, major string
+}
+
+// the rules of a rules file, reloaded when the file changes
+type deviceRulesFile struct {
+	path      string
+	mx        sync.Mutex
+	rules     *deviceRules
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+type detectDeviceSpec struct {
+	clock    clock.Clock
+	defaults *deviceRules
+	mx       sync.Mutex
+	files    map[string]*deviceRulesFile
+}
+
+type detectDevice struct {
+	clock    clock.Clock
+	defaults *deviceRules
+	file     *deviceRulesFile
+}
+
+// Returns a filter specification whose instances detect the class of
+// the client device, its operating system and its browser, from the
+// User-Agent header and the Client Hints, and set them in normalized
+// request headers, so that the backends don't need to parse the
+// User-Agent themselves:
+//
+//     X-Device-Class: mobile
+//     X-Device-Os: Android
+//     X-Device-Browser: Chrome
+//     X-Device-Browser-Major: 112
+//
+// The device classes of the embedded ruleset are bot, tv, tablet, mobile
+// and desktop. The Sec-CH-UA-Mobile, Sec-CH-UA-Platform and Sec-CH-UA
+// client hints take precedence over the User-Agent, when the client
+// sends them. The headers of the unknown properties are not set, and the
+// headers with the same names sent by the client are always removed.
+//
+// Instances optionally expect the path of a JSON rules file, replacing
+// the embedded ruleset, in the same format, e.g.:
+//
+//     detectDevice("/etc/skipper/devices.json")
+//
+// The file is checked for changes at most every 10 seconds, and reloaded
+// when it has changed. When the reload fails, the previous rules are
+// kept.
+//
+// To route the requests by the detected properties, the filter can be
+// used in a loopback route, whose request is matched again by the routes
+// with the header conditions, e.g.:
+//
+//     detect: * -> detectDevice() -> <loopback>;
+//     mobile: Header("X-Device-Class", "mobile") -> "https://m.example.org";
+//
+// Name: "detectDevice".
+func NewDetectDevice() filters.Spec {
+	rules, err := parseDeviceRules([]byte(defaultDeviceRules))
+	if err != nil {
+		panic(err)
+	}
+
+	return &detectDeviceSpec{
+		clock:    clock.System,
+		defaults: rules,
+		files:    make(map[string]*deviceRulesFile)}
+}
+
+// "detectDevice"
+func (spec *detectDeviceSpec) Name() string { return DetectDeviceName }
+
+func (spec *detectDeviceSpec) Description() string {
+	return "Detects the device, the OS and the browser of the client, and sets them in request headers."
+}
+
+func (spec *detectDeviceSpec) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "rules", Type: filters.StringType, Optional: true}}
+}
+
+func compileDeviceRules(rules []*deviceRule) error {
+	for _, r := range rules {
+		if r == nil || r.Name == "" || r.Pattern == "" {
+			return errMissingDevicePattern
+		}
+
+		rx, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return err
+		}
+
+		r.rx = rx
+	}
+
+	return nil
+}
+
+func parseDeviceRules(data []byte) (*deviceRules, error) {
+	var rules deviceRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	for _, rs := range [][]*deviceRule{rules.Devices, rules.OS, rules.Browsers} {
+		if err := compileDeviceRules(rs); err != nil {
+			return nil, fmt.Errorf("invalid device rules: %v", err)
+		}
+	}
+
+	for _, b := range rules.Brands {
+		if b == nil || b.Brand == "" || b.Name == "" {
+			return nil, errors.New("invalid device rules: missing brand or name")
+		}
+	}
+
+	return &rules, nil
+}
+
+// reloads the file when it has changed since the last load
+func (f *deviceRulesFile) load(fi os.FileInfo) error {
+	if f.rules != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	rules, err := parseDeviceRules(data)
+	if err != nil {
+		return err
+	}
+
+	f.rules = rules
+	f.modTime, f.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// checks the file for changes, unless it was checked recently
+func (f *deviceRulesFile) check(now time.Time) error {
+	if !f.lastCheck.IsZero() && now.Sub(f.lastCheck) < deviceRulesCheckInterval {
+		return nil
+	}
+
+	f.lastCheck = now
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	return f.load(fi)
+}
+
+// returns the current rules of the file, or nil when it was never
+// loaded
+func (f *deviceRulesFile) current(now time.Time) *deviceRules {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	if err := f.check(now); err != nil {
+		log.Errorf("failed to load device rules file %s: %v", f.path, err)
+	}
+
+	return f.rules
+}
+
+func (spec *detectDeviceSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &detectDevice{clock: spec.clock, defaults: spec.defaults}
+	if len(config) == 0 {
+		return f, nil
+	}
+
+	path, ok := config[0].(string)
+	if !ok || path == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	spec.mx.Lock()
+	defer spec.mx.Unlock()
+	rf, ok := spec.files[path]
+	if !ok {
+		// the file is loaded once when it is first referenced, so that
+		// the routes with a missing or invalid rules file are rejected
+		rf = &deviceRulesFile{path: path}
+		if err := rf.check(spec.clock.Now()); err != nil {
+			return nil, err
+		}
+
+		spec.files[path] = rf
+	}
+
+	f.file = rf
+	return f, nil
+}
+
+// returns the name of the first matching rule, and its first submatch,
+// if any
+func matchDeviceRules(rules []*deviceRule, ua string) (string, string) {
+	for _, r := range rules {
+		m := r.rx.FindStringSubmatch(ua)
+		if m == nil {
+			continue
+		}
+
+		if len(m) > 1 {
+			return r.Name, m[1]
+		}
+
+		return r.Name, ""
+	}
+
+	return "", ""
+}
+
+// removes the quotes of a structured header string, e.g. "Android"
+func unquoteHint(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// parses the brand list of the Sec-CH-UA client hint, e.g.
+// "Chromium";v="112", "Google Chrome";v="112", mapping the brands to
+// their major version
+func parseBrandHint(h string) map[string]string {
+	brands := make(map[string]string)
+	for _, item := range strings.Split(h, ",") {
+		parts := strings.Split(item, ";")
+		brand := unquoteHint(parts[0])
+		if brand == "" {
+			continue
+		}
+
+		var version string
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "v=") {
+				version = unquoteHint(p[2:])
+			}
+		}
+
+		brands[brand] = strings.SplitN(version, ".", 2)[0]
+	}
+
+	return brands
+}
+
+// detects the properties of the client device, first from the
+// User-Agent, then overriding them with the client hints
+func detectDeviceInfo(rules *deviceRules, h http.Header) deviceInfo {
+	var d deviceInfo
+	ua := h.Get("User-Agent")
+	d.class, _ = matchDeviceRules(rules.Devices, ua)
+	d.os, _ = matchDeviceRules(rules.OS, ua)
+	d.browser, d.major = matchDeviceRules(rules.Browsers, ua)
+
+	switch h.Get(clientHintMobile) {
+	case "?1":
+		if d.class != "bot" && d.class != "tablet" {
+			d.class = "mobile"
+		}
+	case "?0":
+		if d.class == "" || d.class == "mobile" {
+			d.class = "desktop"
+		}
+	}
+
+	if p := unquoteHint(h.Get(clientHintPlatform)); p != "" && p != "Unknown" {
+		d.os = p
+	}
+
+	if bh := h.Get(clientHintBrands); bh != "" {
+		brands := parseBrandHint(bh)
+		for _, b := range rules.Brands {
+			if v, ok := brands[b.Brand]; ok {
+				d.browser, d.major = b.Name, v
+				break
+			}
+		}
+	}
+
+	return d
+}
+
+func setDeviceHeader(h http.Header, name, value string) {
+	if value != "" {
+		h.Set(name, value)
+	}
+}
+
+// Sets the detected properties in the request headers.
+func (f *detectDevice) Request(ctx filters.FilterContext) {
+	rules := f.defaults
+	if f.file != nil {
+		if r := f.file.current(f.clock.Now()); r != nil {
+			rules = r
+		}
+	}
+
+	h := ctx.Request().Header
+	d := detectDeviceInfo(rules, h)
+	for _, name := range []string{
+		DeviceClassHeader,
+		DeviceOSHeader,
+		DeviceBrowserHeader,
+		DeviceBrowserMajorHeader,
+	} {
+		h.Del(name)
+	}
+
+	setDeviceHeader(h, DeviceClassHeader, d.class)
+	setDeviceHeader(h, DeviceOSHeader, d.os)
+	setDeviceHeader(h, DeviceBrowserHeader, d.browser)
+	setDeviceHeader(h, DeviceBrowserMajorHeader, d.major)
+}
+
+// Noop.
+func (f *detectDevice) Response(filters.FilterContext) {}
@@ -0,0 +1,239 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	uaAndroidChrome = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36"
+	uaAndroidTablet = "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36"
+	uaIPhoneSafari  = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Mobile/15E148 Safari/604.1"
+	uaIPadSafari    = "Mozilla/5.0 (iPad; CPU OS 16_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.4 Mobile/15E148 Safari/604.1"
+	uaWindowsEdge   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36 Edg/112.0.1722.48"
+	uaMacFirefox    = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/111.0"
+	uaLinuxChrome   = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Safari/537.36"
+	uaGooglebot     = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	uaSmartTV       = "Mozilla/5.0 (SMART-TV; Linux; Tizen 6.0) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/4.0 Chrome/76.0.3809.146 TV Safari/537.36"
+)
+
+func testDetectDevice(t *testing.T, spec filters.Spec, args []interface{}, h http.Header) http.Header {
+	f, err := spec.CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range h {
+		req.Header[k] = v
+	}
+
+	f.Request(&filtertest.Context{FRequest: req})
+	return req.Header
+}
+
+func TestDetectDevice(t *testing.T) {
+	for _, ti := range []struct {
+		msg                       string
+		header                    http.Header
+		class, os, browser, major string
+	}{{
+		msg:    "no user agent",
+		header: http.Header{},
+	}, {
+		msg:     "android phone",
+		header:  http.Header{"User-Agent": []string{uaAndroidChrome}},
+		class:   "mobile",
+		os:      "Android",
+		browser: "Chrome",
+		major:   "112",
+	}, {
+		msg:     "android tablet",
+		header:  http.Header{"User-Agent": []string{uaAndroidTablet}},
+		class:   "tablet",
+		os:      "Android",
+		browser: "Chrome",
+		major:   "112",
+	}, {
+		msg:     "iphone",
+		header:  http.Header{"User-Agent": []string{uaIPhoneSafari}},
+		class:   "mobile",
+		os:      "iOS",
+		browser: "Safari",
+		major:   "16",
+	}, {
+		msg:     "ipad",
+		header:  http.Header{"User-Agent": []string{uaIPadSafari}},
+		class:   "tablet",
+		os:      "iOS",
+		browser: "Safari",
+		major:   "16",
+	}, {
+		msg:     "windows edge",
+		header:  http.Header{"User-Agent": []string{uaWindowsEdge}},
+		class:   "desktop",
+		os:      "Windows",
+		browser: "Edge",
+		major:   "112",
+	}, {
+		msg:     "mac firefox",
+		header:  http.Header{"User-Agent": []string{uaMacFirefox}},
+		class:   "desktop",
+		os:      "macOS",
+		browser: "Firefox",
+		major:   "111",
+	}, {
+		msg:    "bot",
+		header: http.Header{"User-Agent": []string{uaGooglebot}},
+		class:  "bot",
+	}, {
+		msg:     "smart tv",
+		header:  http.Header{"User-Agent": []string{uaSmartTV}},
+		class:   "tv",
+		os:      "Linux",
+		browser: "Samsung Internet",
+		major:   "4",
+	}, {
+		msg: "client hints override the user agent",
+		header: http.Header{
+			"User-Agent":         []string{uaLinuxChrome},
+			"Sec-Ch-Ua-Mobile":   []string{"?1"},
+			"Sec-Ch-Ua-Platform": []string{`"Android"`},
+			"Sec-Ch-Ua":          []string{`"Chromium";v="113", "Not-A.Brand";v="24", "Google Chrome";v="113"`},
+		},
+		class:   "mobile",
+		os:      "Android",
+		browser: "Chrome",
+		major:   "113",
+	}, {
+		msg: "not mobile client hint",
+		header: http.Header{
+			"User-Agent":       []string{uaAndroidChrome},
+			"Sec-Ch-Ua-Mobile": []string{"?0"},
+		},
+		class:   "desktop",
+		os:      "Android",
+		browser: "Chrome",
+		major:   "112",
+	}, {
+		msg: "unknown platform and brands",
+		header: http.Header{
+			"User-Agent":         []string{uaWindowsEdge},
+			"Sec-Ch-Ua-Platform": []string{`"Unknown"`},
+			"Sec-Ch-Ua":          []string{`"Not-A.Brand";v="24"`},
+		},
+		class:   "desktop",
+		os:      "Windows",
+		browser: "Edge",
+		major:   "112",
+	}, {
+		msg: "spoofed headers removed",
+		header: http.Header{
+			"User-Agent":             []string{uaGooglebot},
+			"X-Device-Class":         []string{"desktop"},
+			"X-Device-Os":            []string{"Windows"},
+			"X-Device-Browser-Major": []string{"99"},
+		},
+		class: "bot",
+	}} {
+		h := testDetectDevice(t, NewDetectDevice(), nil, ti.header)
+		if h.Get(DeviceClassHeader) != ti.class ||
+			h.Get(DeviceOSHeader) != ti.os ||
+			h.Get(DeviceBrowserHeader) != ti.browser ||
+			h.Get(DeviceBrowserMajorHeader) != ti.major {
+			t.Error(ti.msg, "invalid headers", h)
+		}
+	}
+}
+
+func writeDeviceRules(t *testing.T, path, rules string) {
+	if err := ioutil.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectDeviceInvalidConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+	defer os.Remove(f.Name())
+	writeDeviceRules(t, f.Name(), `{"devices": [{"name": "mobile", "pattern": "("}]}`)
+
+	for _, args := range [][]interface{}{
+		{42},
+		{""},
+		{"/no/such/devices.json"},
+		{f.Name()},
+		{f.Name(), "foo"},
+	} {
+		if _, err := NewDetectDevice().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestDetectDeviceRulesReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+	path := f.Name()
+	defer os.Remove(path)
+	writeDeviceRules(t, path, `{"devices": [{"name": "phone", "pattern": "(?i)mobile"}]}`)
+
+	c := clock.NewFake(time.Now())
+	spec := NewDetectDevice().(*detectDeviceSpec)
+	spec.clock = c
+	header := http.Header{"User-Agent": []string{uaAndroidChrome}}
+	h := testDetectDevice(t, spec, []interface{}{path}, header)
+	if h.Get(DeviceClassHeader) != "phone" || h.Get(DeviceOSHeader) != "" {
+		t.Fatal("failed to apply the rules file", h)
+	}
+
+	// the modification time may not change within the resolution of
+	// the file system, so the size is changed, too
+	writeDeviceRules(t, path, `{"devices": [{"name": "handheld", "pattern": "(?i)android"}]}`)
+	if h := testDetectDevice(t, spec, []interface{}{path}, header); h.Get(DeviceClassHeader) != "phone" {
+		t.Error("failed to keep the rules until the next check", h)
+	}
+
+	c.Add(deviceRulesCheckInterval)
+	if h := testDetectDevice(t, spec, []interface{}{path}, header); h.Get(DeviceClassHeader) != "handheld" {
+		t.Error("failed to reload the rules", h)
+	}
+
+	writeDeviceRules(t, path, `{"devices": [{"name": "broken", "pattern": "("}]}`)
+	c.Add(deviceRulesCheckInterval)
+	if h := testDetectDevice(t, spec, []interface{}{path}, header); h.Get(DeviceClassHeader) != "handheld" {
+		t.Error("failed to keep the previous rules", h)
+	}
+}
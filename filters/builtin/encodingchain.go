@@ -0,0 +1,229 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxDecodedEncodings = 3
+
+type normalizeEncoding struct {
+	maxDecoded int
+	encodings  []string
+}
+
+// decoders of the content codings that the filter can remove from the
+// request bodies
+var encodingDecoders = map[string]func(io.Reader) (io.Reader, error){
+	gzipEncoding: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"x-gzip":     func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+
+	// in HTTP, deflate means the zlib format
+	deflateEncoding: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+}
+
+// creates the decoder on the first read, so that the body of the
+// client is not read before the request is forwarded
+type lazyDecoder struct {
+	source  io.Reader
+	create  func(io.Reader) (io.Reader, error)
+	decoder io.Reader
+}
+
+type decodedBody struct {
+	io.Reader
+	original io.Closer
+}
+
+// Returns a filter specification whose instances normalize the content
+// codings of the requests for the backends that understand only some
+// of the codings, and only a single coding at a time.
+//
+// The Accept-Encoding header is replaced with the single coding, among
+// the ones supported by the backend, that the client accepts with the
+// highest quality, or it is removed, when the client accepts none of
+// them.
+//
+// When the request body has a chain of content codings, e.g.
+// 'Content-Encoding: gzip, deflate', the codings applied last are
+// decoded, until the remaining chain is a single coding supported by
+// the backend, or no coding at all. The identity coding is dropped from
+// the chain. The decoding happens while the body is streamed to the
+// backend, and the Content-Length header is removed. The requests whose
+// chain contains codings that cannot be decoded, the ones other than
+// gzip and deflate, or which would require decoding more codings than
+// the limit, are rejected with 415 Unsupported Media Type.
+//
+// Instances accept an optional limit of the decoded codings as the
+// first parameter, by default 3, followed by the codings supported by
+// the backend, by default gzip:
+//
+//     normalizeEncoding()
+//     normalizeEncoding("gzip", "deflate")
+//     normalizeEncoding(1, "deflate")
+//
+// Name: "normalizeEncoding".
+func NewNormalizeEncoding() filters.Spec { return &normalizeEncoding{} }
+
+// "normalizeEncoding"
+func (spec *normalizeEncoding) Name() string { return NormalizeEncodingName }
+
+func (spec *normalizeEncoding) Description() string {
+	return "Reduces the accepted and the applied content codings of the requests to a single one supported by the backend."
+}
+
+func (spec *normalizeEncoding) Signature() string {
+	return "[maxDecoded number], [encoding string, ...]"
+}
+
+func (spec *normalizeEncoding) CreateFilter(config []interface{}) (filters.Filter, error) {
+	f := &normalizeEncoding{maxDecoded: defaultMaxDecodedEncodings}
+	if len(config) > 0 {
+		if maxDecoded, ok := config[0].(float64); ok {
+			if maxDecoded < 0 || maxDecoded != float64(int(maxDecoded)) {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			f.maxDecoded = int(maxDecoded)
+			config = config[1:]
+		}
+	}
+
+	for _, c := range config {
+		e, ok := c.(string)
+		if !ok || e == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.encodings = append(f.encodings, strings.ToLower(e))
+	}
+
+	if len(f.encodings) == 0 {
+		f.encodings = []string{gzipEncoding}
+	}
+
+	return f, nil
+}
+
+func (f *normalizeEncoding) supports(encoding string) bool {
+	for _, e := range f.encodings {
+		if e == encoding {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *normalizeEncoding) normalizeAccept(h http.Header) {
+	if len(h["Accept-Encoding"]) == 0 {
+		return
+	}
+
+	var (
+		selected string
+		quality  float64
+	)
+
+	for _, e := range f.encodings {
+		if q := encodingQuality(h, e); q > quality {
+			selected, quality = e, q
+		}
+	}
+
+	if selected == "" {
+		h.Del("Accept-Encoding")
+		return
+	}
+
+	h.Set("Accept-Encoding", selected)
+}
+
+// returns the content codings of the request in the order they were
+// applied, without the identity coding
+func encodingChain(h http.Header) []string {
+	var chain []string
+	for _, v := range h["Content-Encoding"] {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e != "" && e != "identity" {
+				chain = append(chain, e)
+			}
+		}
+	}
+
+	return chain
+}
+
+func (d *lazyDecoder) Read(p []byte) (int, error) {
+	if d.decoder == nil {
+		decoder, err := d.create(d.source)
+		if err != nil {
+			return 0, err
+		}
+
+		d.decoder = decoder
+	}
+
+	return d.decoder.Read(p)
+}
+
+func (b decodedBody) Close() error { return b.original.Close() }
+
+func (f *normalizeEncoding) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	f.normalizeAccept(r.Header)
+
+	chain := encodingChain(r.Header)
+	remaining := len(chain)
+	for remaining > 1 || remaining == 1 && !f.supports(chain[0]) {
+		if len(chain)-remaining == f.maxDecoded || encodingDecoders[chain[remaining-1]] == nil {
+			ctx.ResponseWriter().WriteHeader(http.StatusUnsupportedMediaType)
+			ctx.MarkServed()
+			return
+		}
+
+		remaining--
+	}
+
+	if remaining == 0 {
+		r.Header.Del("Content-Encoding")
+	} else {
+		r.Header.Set("Content-Encoding", chain[0])
+	}
+
+	if remaining == len(chain) || r.Body == nil {
+		return
+	}
+
+	// the coding applied last is decoded first
+	var body io.Reader = r.Body
+	for i := len(chain) - 1; i >= remaining; i-- {
+		body = &lazyDecoder{source: body, create: encodingDecoders[chain[i]]}
+	}
+
+	r.Body = decodedBody{body, r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+}
+
+// Noop.
+func (f *normalizeEncoding) Response(filters.FilterContext) {}
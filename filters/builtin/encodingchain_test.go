@@ -0,0 +1,272 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testEncodedContent = "Hello, world!"
+
+func encodeContent(t *testing.T, content []byte, encoding string) []byte {
+	var (
+		b bytes.Buffer
+		w io.WriteCloser
+	)
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	default:
+		return append([]byte(encoding+":"), content...)
+	}
+
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestNormalizeEncodingInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{float64(-1)},
+		{float64(1.5)},
+		{"gzip", float64(2)},
+		{""},
+	} {
+		if _, err := NewNormalizeEncoding().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestNormalizeAcceptEncoding(t *testing.T) {
+	for _, ti := range []struct {
+		msg    string
+		args   []interface{}
+		accept []string
+		check  string
+	}{{
+		"not set",
+		nil,
+		nil,
+		"",
+	}, {
+		"single supported",
+		nil,
+		[]string{"gzip"},
+		"gzip",
+	}, {
+		"chain reduced to supported",
+		nil,
+		[]string{"br, gzip"},
+		"gzip",
+	}, {
+		"highest quality",
+		[]interface{}{"gzip", "deflate"},
+		[]string{"gzip;q=0.5", "deflate, br"},
+		"deflate",
+	}, {
+		"wildcard",
+		[]interface{}{"deflate"},
+		[]string{"br, *;q=0.1"},
+		"deflate",
+	}, {
+		"refused",
+		nil,
+		[]string{"gzip;q=0, *"},
+		"",
+	}, {
+		"none supported",
+		nil,
+		[]string{"br"},
+		"",
+	}} {
+		f, err := NewNormalizeEncoding().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		r, _ := http.NewRequest("GET", "https://www.example.org", nil)
+		r.Header["Accept-Encoding"] = ti.accept
+		f.Request(&filtertest.Context{FRequest: r})
+
+		if ae := r.Header.Get("Accept-Encoding"); ae != ti.check {
+			t.Error(ti.msg, "invalid accept encoding", ae, ti.check)
+		}
+	}
+}
+
+func TestNormalizeContentEncoding(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		args     []interface{}
+		chain    []string
+		status   int
+		encoding string
+		decoded  []string
+	}{{
+		"no encoding",
+		nil,
+		nil,
+		0,
+		"",
+		nil,
+	}, {
+		"identity dropped",
+		nil,
+		[]string{"identity"},
+		0,
+		"",
+		nil,
+	}, {
+		"single supported",
+		nil,
+		[]string{"gzip"},
+		0,
+		"gzip",
+		nil,
+	}, {
+		"single not supported, decoded",
+		nil,
+		[]string{"deflate"},
+		0,
+		"",
+		[]string{"deflate"},
+	}, {
+		"stacked, decoded to supported",
+		nil,
+		[]string{"gzip", "deflate"},
+		0,
+		"gzip",
+		[]string{"deflate"},
+	}, {
+		"stacked, fully decoded",
+		[]interface{}{"br"},
+		[]string{"deflate, gzip", "gzip"},
+		0,
+		"",
+		[]string{"deflate", "gzip", "gzip"},
+	}, {
+		"stacked, over the limit",
+		[]interface{}{float64(1), "br"},
+		[]string{"gzip, gzip"},
+		http.StatusUnsupportedMediaType,
+		"",
+		nil,
+	}, {
+		"unknown coding in the chain",
+		nil,
+		[]string{"br, gzip"},
+		http.StatusUnsupportedMediaType,
+		"",
+		nil,
+	}, {
+		"unknown coding passed, when supported",
+		[]interface{}{"br"},
+		[]string{"br, gzip"},
+		0,
+		"br",
+		[]string{"gzip"},
+	}} {
+		f, err := NewNormalizeEncoding().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		content := []byte(testEncodedContent)
+		remaining := []byte(testEncodedContent)
+		encodings := encodingChain(http.Header{"Content-Encoding": ti.chain})
+		for i, e := range encodings {
+			content = encodeContent(t, content, e)
+			if i < len(encodings)-len(ti.decoded) {
+				remaining = content
+			}
+		}
+
+		r, _ := http.NewRequest("POST", "https://www.example.org", bytes.NewBuffer(content))
+		r.Header["Content-Encoding"] = ti.chain
+		r.Header.Set("Content-Length", "42")
+		ctx := &filtertest.Context{FRequest: r, FResponseWriter: httptest.NewRecorder()}
+		f.Request(ctx)
+
+		if ti.status != 0 {
+			if !ctx.FServed || ctx.FResponseWriter.(*httptest.ResponseRecorder).Code != ti.status {
+				t.Error(ti.msg, "failed to reject the request")
+			}
+
+			continue
+		}
+
+		if ctx.FServed {
+			t.Error(ti.msg, "unexpectedly served")
+			continue
+		}
+
+		if ce := r.Header.Get("Content-Encoding"); ce != ti.encoding {
+			t.Error(ti.msg, "invalid content encoding", ce, ti.encoding)
+		}
+
+		if len(ti.decoded) > 0 && (r.ContentLength != -1 || r.Header.Get("Content-Length") != "") {
+			t.Error(ti.msg, "failed to drop the content length")
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if !bytes.Equal(b, remaining) {
+			t.Error(ti.msg, "invalid body", string(b))
+		}
+
+		if err := r.Body.Close(); err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
+
+func TestNormalizeContentEncodingInvalidBody(t *testing.T) {
+	f, err := NewNormalizeEncoding().CreateFilter([]interface{}{"br"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("POST", "https://www.example.org", bytes.NewBufferString("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	f.Request(&filtertest.Context{FRequest: r, FResponseWriter: httptest.NewRecorder()})
+
+	if _, err := ioutil.ReadAll(r.Body); err == nil {
+		t.Error("failed to fail")
+	}
+}
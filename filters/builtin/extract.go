@@ -0,0 +1,160 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"regexp"
+	"strings"
+)
+
+type extractSource int
+
+const (
+	extractHeader extractSource = iota
+	extractQuery
+	extractCookie
+	extractPath
+)
+
+type extract struct {
+	name   string
+	source extractSource
+	key    string
+	rx     *regexp.Regexp
+}
+
+var extractName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Returns a filter specification whose instances extract a value from
+// the request, and store it under a name, so that the filters following
+// them in the route can reference it in their template arguments as
+// ${name}, e.g.:
+//
+//	extract("userId", "header:X-User") -> requestHeader("X-Backend-User", "${userId}")
+//
+// Instances expect two parameters: the name, and the source of the value
+// in the form of kind:key, where the kind is one of:
+//
+//	header: the value of a request header, e.g. header:X-User
+//	query:  the value of a query parameter, e.g. query:page
+//	cookie: the value of a cookie, e.g. cookie:session
+//	path:   a regular expression matched against the path, e.g.
+//	        path:^/users/([^/]+), where the value is the first capturing
+//	        group, or the whole match without groups
+//
+// When the value is not found, the name is set to an empty string. The
+// values are stored in the state bag under filters.ExtractedValuesKey,
+// and they can be substituted with filters.ExpandTemplate. The built-in
+// filters accepting template arguments are requestHeader and
+// responseHeader.
+//
+// Name: "extract".
+func NewExtract() filters.Spec { return &extract{} }
+
+// "extract"
+func (spec *extract) Name() string { return ExtractName }
+
+func (spec *extract) Description() string {
+	return "Extracts a value from the request, for the template arguments of the following filters."
+}
+
+func (spec *extract) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "name", Type: filters.StringType},
+		{Name: "source", Type: filters.StringType},
+	}
+}
+
+func (spec *extract) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[0].(string)
+	if !ok || !extractName.MatchString(name) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	source, ok := config[1].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	parts := strings.SplitN(source, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &extract{name: name, key: parts[1]}
+	switch parts[0] {
+	case "header":
+		f.source = extractHeader
+	case "query":
+		f.source = extractQuery
+	case "cookie":
+		f.source = extractCookie
+	case "path":
+		rx, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.source = extractPath
+		f.rx = rx
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return f, nil
+}
+
+func (f *extract) value(ctx filters.FilterContext) string {
+	req := ctx.Request()
+	switch f.source {
+	case extractHeader:
+		return req.Header.Get(f.key)
+	case extractQuery:
+		return req.URL.Query().Get(f.key)
+	case extractCookie:
+		if c, err := req.Cookie(f.key); err == nil {
+			return c.Value
+		}
+	case extractPath:
+		m := f.rx.FindStringSubmatch(req.URL.Path)
+		switch {
+		case len(m) > 1:
+			return m[1]
+		case len(m) == 1:
+			return m[0]
+		}
+	}
+
+	return ""
+}
+
+// Stores the extracted value in the state bag.
+func (f *extract) Request(ctx filters.FilterContext) {
+	values, ok := ctx.StateBag()[filters.ExtractedValuesKey].(map[string]string)
+	if !ok {
+		values = make(map[string]string)
+		ctx.StateBag()[filters.ExtractedValuesKey] = values
+	}
+
+	values[f.name] = f.value(ctx)
+}
+
+// Noop.
+func (f *extract) Response(filters.FilterContext) {}
@@ -0,0 +1,158 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestExtractInvalidArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"userId"},
+		{"userId", "header:X-User", "foo"},
+		{42, "header:X-User"},
+		{"user-id", "header:X-User"},
+		{"userId", 42},
+		{"userId", "header"},
+		{"userId", "header:"},
+		{"userId", "body:foo"},
+		{"userId", "path:[invalid"},
+	} {
+		if _, err := NewExtract().CreateFilter(args); err != filters.ErrInvalidFilterParameters {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	for _, ti := range []struct {
+		msg    string
+		source string
+		value  string
+	}{{
+		"header",
+		"header:X-User",
+		"alice",
+	}, {
+		"missing header",
+		"header:X-Missing",
+		"",
+	}, {
+		"query",
+		"query:page",
+		"2",
+	}, {
+		"cookie",
+		"cookie:session",
+		"abc",
+	}, {
+		"missing cookie",
+		"cookie:missing",
+		"",
+	}, {
+		"path with group",
+		"path:^/users/([^/]+)",
+		"42",
+	}, {
+		"path without group",
+		"path:/orders/[0-9]+",
+		"/orders/7",
+	}, {
+		"path not matching",
+		"path:^/products/([^/]+)",
+		"",
+	}} {
+		f, err := NewExtract().CreateFilter([]interface{}{"value", ti.source})
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "https://www.example.org/users/42/orders/7?page=2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-User", "alice")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+		ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+
+		values, ok := ctx.FStateBag[filters.ExtractedValuesKey].(map[string]string)
+		if !ok {
+			t.Error(ti.msg, "failed to store the values")
+			continue
+		}
+
+		if v, ok := values["value"]; !ok || v != ti.value {
+			t.Error(ti.msg, "invalid value", v, ti.value)
+		}
+	}
+}
+
+func TestExtractedValuesInHeaders(t *testing.T) {
+	create := func(s filters.Spec, args ...interface{}) filters.Filter {
+		f, err := s.CreateFilter(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return f
+	}
+
+	chain := []filters.Filter{
+		create(NewExtract(), "userId", "header:X-User"),
+		create(NewExtract(), "orderId", "path:^/orders/([0-9]+)"),
+		create(NewRequestHeader(), "X-Backend-User", "user: ${userId}, order: ${orderId}"),
+		create(NewRequestHeader(), "X-Unknown", "${unknown}"),
+		create(NewResponseHeader(), "X-Order", "${orderId}"),
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org/orders/7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-User", "alice")
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FResponse: &http.Response{Header: make(http.Header)},
+		FStateBag: make(map[string]interface{})}
+
+	for _, f := range chain {
+		f.Request(ctx)
+	}
+
+	for _, f := range chain {
+		f.Response(ctx)
+	}
+
+	if h := req.Header.Get("X-Backend-User"); h != "user: alice, order: 7" {
+		t.Error("failed to expand the request header", h)
+	}
+
+	if h := req.Header.Get("X-Unknown"); h != "${unknown}" {
+		t.Error("failed to keep the unknown placeholder", h)
+	}
+
+	if h := ctx.FResponse.Header.Get("X-Order"); h != "7" {
+		t.Error("failed to expand the response header", h)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Header that can be used to force a region in the failover filter,
+// e.g. for testing. It is honored only from the clients on the
+// loopback interface, and it is removed from the forwarded requests.
+const ForceRegionHeader = "X-Force-Region"
+
+const (
+	defaultErrorWindow      = 10 * time.Second
+	defaultFailoverCooldown = 30 * time.Second
+	defaultMinRequests      = 10
+	defaultMaxErrorRate     = 0.5
+)
+
+// error statistics of a region, used for the passive failover
+type regionStats struct {
+	mx          sync.Mutex
+	windowStart time.Time
+	requests    int
+	errors      int
+	downUntil   time.Time
+}
+
+type region struct {
+	name     string
+	backends []string
+	targets  []healthcheck.Target
+	next     uint32
+	stats    *regionStats
+}
+
+type failoverSettings struct {
+	errorWindow  time.Duration
+	cooldown     time.Duration
+	minRequests  int
+	maxErrorRate float64
+}
+
+type failoverSpec struct {
+	checker  *healthcheck.Checker
+	settings failoverSettings
+	clock    clock.Clock
+}
+
+type failover struct {
+	checker  *healthcheck.Checker
+	settings failoverSettings
+	clock    clock.Clock
+	regions  []*region
+}
+
+func (s *regionStats) record(failed bool, now time.Time, settings failoverSettings) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if now.Sub(s.windowStart) > settings.errorWindow {
+		s.windowStart = now
+		s.requests = 0
+		s.errors = 0
+	}
+
+	s.requests++
+	if failed {
+		s.errors++
+	}
+
+	if s.requests >= settings.minRequests &&
+		float64(s.errors)/float64(s.requests) >= settings.maxErrorRate {
+		s.downUntil = now.Add(settings.cooldown)
+		s.requests = 0
+		s.errors = 0
+	}
+}
+
+func (s *regionStats) down(now time.Time) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return now.Before(s.downUntil)
+}
+
+var defaultFailoverSettings = failoverSettings{
+	errorWindow:  defaultErrorWindow,
+	cooldown:     defaultFailoverCooldown,
+	minRequests:  defaultMinRequests,
+	maxErrorRate: defaultMaxErrorRate}
+
+// Returns a filter specification whose instances forward the requests
+// to groups of backends in different regions, with automatic failover.
+// The first group is the primary, and the rest are the secondaries, in
+// the order of preference. The requests are forwarded, in round-robin,
+// to the healthy backends of the first region that is not failed.
+//
+// A region is failed, when none of its backends pass the active health
+// checks, or when the rate of the failed backend requests of the region,
+// connection errors and 5xx responses, exceeds 50% over a short period.
+// In the latter case, the region is skipped during a cooldown period.
+// When all the regions are failed, the requests are forwarded to the
+// primary region.
+//
+// The active health checks send a GET request to the path of the
+// backend addresses, or to the root path, and fail on connection errors
+// and 5xx responses. The instances created by this spec use their own
+// health checker, see NewFailoverWithHealthChecks.
+//
+// When the X-Force-Region header is set in a request from the loopback
+// interface to the name of a region, the request is forwarded to that
+// region regardless of the failures. The header is not forwarded to the
+// backends.
+//
+// Instances expect one or more parameters, the backend groups, in the
+// form of the region name and a comma separated list of backend
+// addresses, e.g.:
+//
+//     failover("eu-central=https://eu-1.example.org,https://eu-2.example.org", "eu-west=https://west.example.org")
+//
+// Name: "failover".
+func NewFailover() filters.Spec {
+	return NewFailoverWithHealthChecks(healthcheck.New(healthcheck.Options{}))
+}
+
+// Returns a failover filter specification, whose instances check the
+// health of the backends with the provided health checker, e.g. the one
+// shared with the proxy.
+func NewFailoverWithHealthChecks(c *healthcheck.Checker) filters.Spec {
+	return newFailover(c, defaultFailoverSettings, clock.System)
+}
+
+func newFailover(checker *healthcheck.Checker, settings failoverSettings, c clock.Clock) *failoverSpec {
+	return &failoverSpec{checker: checker, settings: settings, clock: c}
+}
+
+// "failover"
+func (spec *failoverSpec) Name() string { return FailoverName }
+
+func (spec *failoverSpec) Description() string {
+	return "Forwards the requests to regional backend groups, failing over to the next region when a region fails."
+}
+
+func (spec *failoverSpec) Signature() string { return "group string, ..." }
+
+// returns the health check target of a backend, checked on the path of
+// the backend address, or on the root path
+func healthCheckTarget(backend string) healthcheck.Target {
+	u, _ := url.Parse(backend)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return healthcheck.Target{Backend: u.Scheme + "://" + u.Host, Path: path}
+}
+
+func parseRegion(config interface{}) (*region, bool) {
+	s, ok := config.(string)
+	if !ok {
+		return nil, false
+	}
+
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, false
+	}
+
+	r := &region{name: parts[0], stats: &regionStats{}}
+	for _, b := range strings.Split(parts[1], ",") {
+		b = strings.TrimSpace(b)
+		if !isBackendUrl(b) {
+			return nil, false
+		}
+
+		r.backends = append(r.backends, b)
+		r.targets = append(r.targets, healthCheckTarget(b))
+	}
+
+	return r, true
+}
+
+func (spec *failoverSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	names := make(map[string]bool)
+	f := &failover{checker: spec.checker, settings: spec.settings, clock: spec.clock}
+	for _, c := range config {
+		r, ok := parseRegion(c)
+		if !ok || names[r.name] {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		names[r.name] = true
+		f.regions = append(f.regions, r)
+	}
+
+	return f, nil
+}
+
+// returns the index of the i-th backend of a region, counted from the
+// next one in round-robin. The modulo is calculated on the unsigned
+// counter, because converting it to int can result in negative indexes.
+func (r *region) index(n uint32, i int) int {
+	return int((n + uint32(i)) % uint32(len(r.backends)))
+}
+
+// selects the next healthy backend of a region in round-robin, or
+// returns false, if none of them are healthy
+func (f *failover) healthyBackend(r *region) (string, bool) {
+	n := atomic.AddUint32(&r.next, 1)
+	for i := range r.backends {
+		bi := r.index(n, i)
+		if f.checker.Healthy(r.targets[bi]) {
+			return r.backends[bi], true
+		}
+	}
+
+	return "", false
+}
+
+// returns the region forced by the request header, when the request was
+// received from the loopback interface
+func (f *failover) forcedRegion(req *http.Request) *region {
+	name := req.Header.Get(ForceRegionHeader)
+	if name == "" {
+		return nil
+	}
+
+	if ip := routing.ClientIP(req); ip == nil || !ip.IsLoopback() {
+		return nil
+	}
+
+	for _, r := range f.regions {
+		if r.name == name {
+			return r
+		}
+	}
+
+	return nil
+}
+
+func (f *failover) selectBackend(req *http.Request) (*region, string) {
+	if r := f.forcedRegion(req); r != nil {
+		return r, r.backends[r.index(atomic.AddUint32(&r.next, 1), 0)]
+	}
+
+	now := f.clock.Now()
+	for _, r := range f.regions {
+		if r.stats.down(now) {
+			continue
+		}
+
+		if b, ok := f.healthyBackend(r); ok {
+			return r, b
+		}
+	}
+
+	r := f.regions[0]
+	return r, r.backends[r.index(atomic.AddUint32(&r.next, 1), 0)]
+}
+
+// Sets the backend selected from the first available region, and
+// observes the backend requests of the region, to detect high error
+// rates.
+func (f *failover) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	r, b := f.selectBackend(req)
+	req.Header.Del(ForceRegionHeader)
+
+	ctx.StateBag()[filters.BackendUrlKey] = b
+	ctx.StateBag()[filters.BackendObserverKey] = filters.BackendObserver(func(rsp *http.Response, err error) {
+		failed := err != nil || rsp.StatusCode >= http.StatusInternalServerError
+		r.stats.record(failed, f.clock.Now(), f.settings)
+	})
+}
+
+// Noop.
+func (f *failover) Response(filters.FilterContext) {}
@@ -0,0 +1,265 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"errors"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/healthcheck"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testHealthCheckInterval = 3 * time.Millisecond
+
+var testFailoverSettings = failoverSettings{
+	errorWindow:  time.Minute,
+	cooldown:     time.Minute,
+	minRequests:  4,
+	maxErrorRate: 0.5}
+
+func okServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+}
+
+func testHealthChecker() *healthcheck.Checker {
+	return healthcheck.New(healthcheck.Options{
+		Interval:           testHealthCheckInterval,
+		UnhealthyThreshold: 1})
+}
+
+func createFailoverWithClock(t *testing.T, c clock.Clock, config ...interface{}) filters.Filter {
+	checker := testHealthChecker()
+	f, err := newFailover(checker, testFailoverSettings, c).CreateFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func createFailover(t *testing.T, config ...interface{}) filters.Filter {
+	return createFailoverWithClock(t, clock.System, config...)
+}
+
+// executes the filter with a request from remote, and calls the backend
+// observer with the response status, or with a connection error, when
+// the status is zero
+func failoverRequestFrom(f filters.Filter, remote string, header http.Header, status int) (string, *http.Request) {
+	c := &filtertest.Context{
+		FRequest:  &http.Request{Header: header, RemoteAddr: remote},
+		FStateBag: make(map[string]interface{})}
+	f.Request(c)
+
+	if observe, ok := c.FStateBag[filters.BackendObserverKey].(filters.BackendObserver); ok {
+		if status == 0 {
+			observe(nil, &url.Error{Op: "Get", URL: "https://www.example.org", Err: errors.New("connection refused")})
+		} else {
+			observe(&http.Response{StatusCode: status}, nil)
+		}
+	}
+
+	f.Response(c)
+	b, _ := c.FStateBag[filters.BackendUrlKey].(string)
+	return b, c.FRequest
+}
+
+func failoverRequest(f filters.Filter, header http.Header, status int) string {
+	b, _ := failoverRequestFrom(f, "192.0.2.1:42000", header, status)
+	return b
+}
+
+func TestFailoverInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{42},
+		{"eu-central"},
+		{"=https://eu.example.org"},
+		{"eu-central=eu.example.org"},
+		{"eu-central=https://eu.example.org,"},
+		{"eu-central=https://eu.example.org", "eu-central=https://west.example.org"},
+	} {
+		if _, err := NewFailover().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestFailoverRoundRobinInPrimary(t *testing.T) {
+	p1, p2, s := okServer(), okServer(), okServer()
+	defer p1.Close()
+	defer p2.Close()
+	defer s.Close()
+
+	f := createFailover(t, "primary="+p1.URL+","+p2.URL, "secondary="+s.URL)
+	selected := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		selected[failoverRequest(f, http.Header{}, http.StatusOK)]++
+	}
+
+	if len(selected) != 2 || selected[p1.URL] != 4 || selected[p2.URL] != 4 {
+		t.Error("failed to balance the primary region", selected)
+	}
+}
+
+func TestFailoverOnHealthCheck(t *testing.T) {
+	p, s := okServer(), okServer()
+	defer s.Close()
+
+	f := createFailover(t, "primary="+p.URL, "secondary="+s.URL)
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != p.URL {
+		t.Error("failed to select the primary region", b)
+	}
+
+	p.Close()
+	time.Sleep(6 * testHealthCheckInterval)
+
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != s.URL {
+		t.Error("failed to fail over", b)
+	}
+}
+
+func TestFailoverOnErrorRate(t *testing.T) {
+	p, s := okServer(), okServer()
+	defer p.Close()
+	defer s.Close()
+
+	f := createFailover(t, "primary="+p.URL, "secondary="+s.URL)
+	for i := 0; i < testFailoverSettings.minRequests; i++ {
+		if b := failoverRequest(f, http.Header{}, http.StatusServiceUnavailable); b != p.URL {
+			t.Error("failed to select the primary region", b)
+		}
+	}
+
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != s.URL {
+		t.Error("failed to fail over", b)
+	}
+}
+
+func TestFailoverCooldown(t *testing.T) {
+	p, s := okServer(), okServer()
+	defer p.Close()
+	defer s.Close()
+
+	c := clock.NewFake(time.Now())
+	f := createFailoverWithClock(t, c, "primary="+p.URL, "secondary="+s.URL)
+	for i := 0; i < testFailoverSettings.minRequests; i++ {
+		failoverRequest(f, http.Header{}, http.StatusServiceUnavailable)
+	}
+
+	c.Add(testFailoverSettings.cooldown - time.Second)
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != s.URL {
+		t.Error("failed to skip the primary region during the cooldown", b)
+	}
+
+	c.Add(time.Second)
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != p.URL {
+		t.Error("failed to return to the primary region after the cooldown", b)
+	}
+}
+
+func TestFailoverToPrimaryWhenAllFailed(t *testing.T) {
+	p, s := okServer(), okServer()
+	p.Close()
+	s.Close()
+
+	// the health checks of the secondary region start only when the
+	// primary failed
+	f := createFailover(t, "primary="+p.URL, "secondary="+s.URL)
+	for i := 0; i < 2; i++ {
+		failoverRequest(f, http.Header{}, http.StatusOK)
+		time.Sleep(6 * testHealthCheckInterval)
+	}
+
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != p.URL {
+		t.Error("failed to fall back to the primary region", b)
+	}
+}
+
+func TestFailoverOnConnectionErrors(t *testing.T) {
+	p, s := okServer(), okServer()
+	defer p.Close()
+	defer s.Close()
+
+	f := createFailover(t, "primary="+p.URL, "secondary="+s.URL)
+	for i := 0; i < testFailoverSettings.minRequests; i++ {
+		if b := failoverRequest(f, http.Header{}, 0); b != p.URL {
+			t.Error("failed to select the primary region", b)
+		}
+	}
+
+	if b := failoverRequest(f, http.Header{}, http.StatusOK); b != s.URL {
+		t.Error("failed to fail over", b)
+	}
+}
+
+func TestFailoverRoundRobinOverflow(t *testing.T) {
+	b1, b2, b3 := okServer(), okServer(), okServer()
+	defer b1.Close()
+	defer b2.Close()
+	defer b3.Close()
+
+	f := createFailover(t, "primary="+b1.URL+","+b2.URL+","+b3.URL)
+	f.(*failover).regions[0].next = 1<<32 - 2
+	for i := 0; i < 6; i++ {
+		if b := failoverRequest(f, http.Header{}, http.StatusOK); b == "" {
+			t.Error("failed to select a backend")
+		}
+	}
+}
+
+func TestFailoverForceRegion(t *testing.T) {
+	p, s := okServer(), okServer()
+	defer p.Close()
+	defer s.Close()
+
+	f := createFailover(t, "primary="+p.URL, "secondary="+s.URL)
+	for _, test := range []struct {
+		msg      string
+		remote   string
+		region   string
+		expected string
+	}{{
+		"forced region",
+		"127.0.0.1:42000",
+		"secondary",
+		s.URL,
+	}, {
+		"unknown region",
+		"127.0.0.1:42000",
+		"unknown",
+		p.URL,
+	}, {
+		"untrusted client",
+		"192.0.2.1:42000",
+		"secondary",
+		p.URL,
+	}} {
+		h := http.Header{ForceRegionHeader: []string{test.region}}
+		b, req := failoverRequestFrom(f, test.remote, h, http.StatusOK)
+		if b != test.expected {
+			t.Error(test.msg, "failed to select the right region", b)
+		}
+
+		if _, ok := req.Header[ForceRegionHeader]; ok {
+			t.Error(test.msg, "failed to remove the header")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// the flag of the frame carrying the trailers in the gRPC-Web body
+	grpcWebTrailerFlag = 0x80
+
+	grpcWebModeKey = "grpcWeb:mode"
+)
+
+type grpcWeb struct{}
+
+// the response body of the backend, followed by a frame containing the
+// trailers of the response, once the body was read
+type grpcWebBody struct {
+	body     io.ReadCloser
+	trailer  http.Header
+	trailers *bytes.Reader
+}
+
+// the response body encoded in base64, for the text mode
+type grpcWebTextBody struct {
+	*io.PipeReader
+	body io.Closer
+}
+
+// Returns a filter specification whose instances translate gRPC-Web
+// requests, e.g. from browsers, into gRPC requests toward the backend,
+// and the gRPC responses back to gRPC-Web. Both the binary
+// (application/grpc-web) and the text (application/grpc-web-text)
+// formats are supported. The trailers of the gRPC response are sent in
+// the last frame of the gRPC-Web response body. The requests that are
+// not gRPC-Web requests are not affected.
+//
+// Native gRPC servers require HTTP/2, so their routes need a grpc or
+// h2c backend address, or the backendProtocol("http2") filter.
+//
+// The filter doesn't expect any parameters:
+//
+//     grpcWeb()
+//
+// Name: "grpcWeb".
+func NewGrpcWeb() filters.Spec { return &grpcWeb{} }
+
+// "grpcWeb"
+func (spec *grpcWeb) Name() string { return GrpcWebName }
+
+func (spec *grpcWeb) Description() string {
+	return "Translates the gRPC-Web requests to gRPC, and the responses back to gRPC-Web."
+}
+
+func (spec *grpcWeb) Signature() string { return "" }
+
+func (spec *grpcWeb) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &grpcWeb{}, nil
+}
+
+// returns the gRPC-Web content type prefix of a content type, or empty
+// if it is not a gRPC-Web content type. The suffix, e.g. +proto, is
+// kept by the translation.
+func grpcWebMode(contentType string) (string, string) {
+	for _, m := range []string{grpcWebTextContentType, grpcWebContentType} {
+		if strings.HasPrefix(contentType, m) {
+			return m, strings.TrimPrefix(contentType, m)
+		}
+	}
+
+	return "", ""
+}
+
+// Translates the gRPC-Web requests to gRPC.
+func (f *grpcWeb) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	mode, suffix := grpcWebMode(r.Header.Get("Content-Type"))
+	if mode == "" {
+		return
+	}
+
+	ctx.StateBag()[grpcWebModeKey] = mode
+	r.Header.Set("Content-Type", grpcContentType+suffix)
+	r.Header.Set("Te", "trailers")
+
+	if mode == grpcWebTextContentType && r.Body != nil {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+	}
+}
+
+// encodes the trailers as a gRPC-Web frame
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	var keys []string
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var payload bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			fmt.Fprintf(&payload, "%s: %s\r\n", strings.ToLower(k), v)
+		}
+	}
+
+	frame := make([]byte, 5, 5+payload.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(payload.Len()))
+	return append(frame, payload.Bytes()...)
+}
+
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	if b.trailers == nil {
+		n, err := b.body.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		// the trailers are available after the body was read
+		b.trailers = bytes.NewReader(grpcWebTrailerFrame(b.trailer))
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	return b.trailers.Read(p)
+}
+
+func (b *grpcWebBody) Close() error {
+	return b.body.Close()
+}
+
+func newGrpcWebTextBody(body io.ReadCloser) *grpcWebTextBody {
+	pr, pw := io.Pipe()
+	go func() {
+		enc := base64.NewEncoder(base64.StdEncoding, pw)
+		_, err := io.Copy(enc, body)
+		if err == nil {
+			err = enc.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return &grpcWebTextBody{pr, body}
+}
+
+func (b *grpcWebTextBody) Close() error {
+	b.PipeReader.Close()
+	return b.body.Close()
+}
+
+// Translates the gRPC responses to gRPC-Web.
+func (f *grpcWeb) Response(ctx filters.FilterContext) {
+	mode, _ := ctx.StateBag()[grpcWebModeKey].(string)
+	if mode == "" {
+		return
+	}
+
+	rsp := ctx.Response()
+	contentType := rsp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, grpcContentType) {
+		return
+	}
+
+	rsp.Header.Set("Content-Type", mode+strings.TrimPrefix(contentType, grpcContentType))
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+
+	if rsp.Trailer == nil {
+		rsp.Trailer = make(http.Header)
+	}
+
+	// the trailers are sent in the body, and not as http trailers
+	var body io.ReadCloser = &grpcWebBody{body: rsp.Body, trailer: rsp.Trailer}
+	rsp.Trailer = nil
+
+	if mode == grpcWebTextContentType {
+		body = newGrpcWebTextBody(body)
+	}
+
+	rsp.Body = body
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// a gRPC message frame with a two byte payload
+var grpcWebTestMessage = []byte{0, 0, 0, 0, 2, 8, 1}
+
+func grpcWebTestContext(contentType string, body []byte) *filtertest.Context {
+	r, _ := http.NewRequest("POST", "https://www.example.org/service/Method", bytes.NewBuffer(body))
+	r.Header.Set("Content-Type", contentType)
+	return &filtertest.Context{FRequest: r, FStateBag: make(map[string]interface{})}
+}
+
+func grpcWebTestResponse(ctx *filtertest.Context) {
+	ctx.FResponse = &http.Response{
+		Header:  http.Header{"Content-Type": []string{"application/grpc+proto"}},
+		Body:    ioutil.NopCloser(bytes.NewBuffer(grpcWebTestMessage)),
+		Trailer: http.Header{"Grpc-Status": []string{"0"}, "Grpc-Message": []string{"OK"}}}
+}
+
+func TestGrpcWebInvalidConfig(t *testing.T) {
+	if _, err := NewGrpcWeb().CreateFilter([]interface{}{"text"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestGrpcWebIgnoresOtherRequests(t *testing.T) {
+	f, err := NewGrpcWeb().CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := grpcWebTestContext("application/json", []byte("{}"))
+	f.Request(ctx)
+	if ctx.FRequest.Header.Get("Content-Type") != "application/json" || ctx.FRequest.Header.Get("Te") != "" {
+		t.Error("unexpected request modification")
+	}
+
+	ctx.FResponse = &http.Response{
+		Header: http.Header{"Content-Type": []string{"application/json"}},
+		Body:   ioutil.NopCloser(bytes.NewBufferString("{}"))}
+	f.Response(ctx)
+	if b, err := ioutil.ReadAll(ctx.FResponse.Body); err != nil || string(b) != "{}" {
+		t.Error("unexpected response modification", string(b), err)
+	}
+}
+
+func TestGrpcWeb(t *testing.T) {
+	trailerFrame := append([]byte{0x80, 0, 0, 0, 34}, "grpc-message: OK\r\ngrpc-status: 0\r\n"...)
+	expectedBody := append(append([]byte{}, grpcWebTestMessage...), trailerFrame...)
+
+	for _, ti := range []struct {
+		msg                 string
+		contentType         string
+		body                []byte
+		responseContentType string
+		responseBody        []byte
+	}{{
+		"binary",
+		"application/grpc-web+proto",
+		grpcWebTestMessage,
+		"application/grpc-web+proto",
+		expectedBody,
+	}, {
+		"text",
+		"application/grpc-web-text+proto",
+		[]byte(base64.StdEncoding.EncodeToString(grpcWebTestMessage)),
+		"application/grpc-web-text+proto",
+		[]byte(base64.StdEncoding.EncodeToString(expectedBody)),
+	}} {
+		f, err := NewGrpcWeb().CreateFilter(nil)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		ctx := grpcWebTestContext(ti.contentType, ti.body)
+		f.Request(ctx)
+
+		r := ctx.FRequest
+		if r.Header.Get("Content-Type") != "application/grpc+proto" || r.Header.Get("Te") != "trailers" {
+			t.Error(ti.msg, "failed to translate the request headers", r.Header)
+		}
+
+		if b, err := ioutil.ReadAll(r.Body); err != nil || !bytes.Equal(b, grpcWebTestMessage) {
+			t.Error(ti.msg, "failed to translate the request body", b, err)
+		}
+
+		grpcWebTestResponse(ctx)
+		f.Response(ctx)
+
+		rsp := ctx.FResponse
+		if rsp.Header.Get("Content-Type") != ti.responseContentType {
+			t.Error(ti.msg, "invalid response content type", rsp.Header.Get("Content-Type"))
+		}
+
+		if rsp.Trailer != nil {
+			t.Error(ti.msg, "failed to remove the trailers")
+		}
+
+		b, err := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if err != nil || !bytes.Equal(b, ti.responseBody) {
+			t.Error(ti.msg, "invalid response body", b, ti.responseBody, err)
+		}
+	}
+}
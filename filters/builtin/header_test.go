@@ -15,6 +15,7 @@
 package builtin
 
 import (
+	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/filtertest"
 	"net/http"
 	"testing"
@@ -109,3 +110,161 @@ func TestResponseHeaderInvalidConfigValue(t *testing.T) {
 		t.Error("failed to fail")
 	}
 }
+
+func TestHeaderFilterFamilyInvalidConfig(t *testing.T) {
+	for _, ti := range []struct {
+		spec filters.Spec
+		args []interface{}
+	}{
+		{NewSetRequestHeader(), []interface{}{"X-Foo"}},
+		{NewAppendResponseHeader(), []interface{}{"X-Foo", 42}},
+		{NewDropRequestHeader(), nil},
+		{NewDropRequestHeader(), []interface{}{""}},
+		{NewDropResponseHeader(), []interface{}{"X-Foo", "bar"}},
+		{NewDropResponseHeader(), []interface{}{42}},
+	} {
+		if _, err := ti.spec.CreateFilter(ti.args); err == nil {
+			t.Error("failed to fail", ti.spec.Name(), ti.args)
+		}
+	}
+}
+
+func TestHeaderFilterFamily(t *testing.T) {
+	for _, ti := range []struct {
+		title    string
+		spec     filters.Spec
+		args     []interface{}
+		expected []string
+	}{{
+		title:    "set request header",
+		spec:     NewSetRequestHeader(),
+		args:     []interface{}{"X-Foo", "baz"},
+		expected: []string{"baz"},
+	}, {
+		title:    "append request header",
+		spec:     NewAppendRequestHeader(),
+		args:     []interface{}{"X-Foo", "baz"},
+		expected: []string{"bar", "baz"},
+	}, {
+		title: "drop request header",
+		spec:  NewDropRequestHeader(),
+		args:  []interface{}{"X-Foo"},
+	}, {
+		title:    "set response header",
+		spec:     NewSetResponseHeader(),
+		args:     []interface{}{"X-Foo", "baz"},
+		expected: []string{"baz"},
+	}, {
+		title:    "append response header",
+		spec:     NewAppendResponseHeader(),
+		args:     []interface{}{"X-Foo", "baz"},
+		expected: []string{"bar", "baz"},
+	}, {
+		title: "drop response header",
+		spec:  NewDropResponseHeader(),
+		args:  []interface{}{"X-Foo"},
+	}} {
+		f, err := ti.spec.CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		req := &http.Request{Header: http.Header{"X-Foo": []string{"bar"}}}
+		rsp := &http.Response{Header: http.Header{"X-Foo": []string{"bar"}}}
+		ctx := &filtertest.Context{FRequest: req, FResponse: rsp}
+		f.Request(ctx)
+		f.Response(ctx)
+
+		h, other := req.Header, rsp.Header
+		if ti.spec.(*headerFilter).typ == responseHeader {
+			h, other = other, h
+		}
+
+		if len(other["X-Foo"]) != 1 || other.Get("X-Foo") != "bar" {
+			t.Error(ti.title, "unexpected change", other)
+		}
+
+		values := h["X-Foo"]
+		if len(values) != len(ti.expected) {
+			t.Error(ti.title, "invalid header", values)
+			continue
+		}
+
+		for i, v := range values {
+			if v != ti.expected[i] {
+				t.Error(ti.title, "invalid header", values)
+				break
+			}
+		}
+	}
+}
+
+func TestSetRequestHeaderHost(t *testing.T) {
+	f, err := NewSetRequestHeader().CreateFilter([]interface{}{"Host", "${request.host}.internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Request(&filtertest.Context{FRequest: req})
+	if req.Host != "www.example.org.internal" || req.Header.Get("Host") != "www.example.org.internal" {
+		t.Error("failed to set the host", req.Host)
+	}
+}
+
+func TestHeaderTemplates(t *testing.T) {
+	req, err := http.NewRequest("POST", "https://www.example.org/users/42?page=2&sort=name", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-User", "alice")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	ctx := &filtertest.Context{
+		FRequest:    req,
+		FParams:     map[string]string{"id": "42", "userId": "from-path"},
+		FBackendUrl: "https://users.example.org",
+		FStateBag: map[string]interface{}{
+			filters.RouteIdKey:         "users",
+			filters.ExtractedValuesKey: map[string]string{"userId": "from-extract"}}}
+
+	for _, ti := range []struct {
+		template string
+		expected string
+	}{
+		{"${request.host}", "www.example.org"},
+		{"${request.method}", "POST"},
+		{"${request.path}", "/users/42"},
+		{"${request.query}", "page=2&sort=name"},
+		{"${request.query.page}", "2"},
+		{"${request.query.missing}", ""},
+		{"${request.header.X-User}", "alice"},
+		{"${request.header.x-user}", "alice"},
+		{"${request.cookie.session}", "abc"},
+		{"${request.cookie.missing}", ""},
+		{"${route.id}", "users"},
+		{"${route.backend}", "https://users.example.org"},
+		{"user ${id}", "user 42"},
+		{"${userId}", "from-extract"},
+		{"${unknown}", "${unknown}"},
+		{"${request.unknown}", "${request.unknown}"},
+		{"${route.id}: ${request.method} ${request.path}", "users: POST /users/42"},
+		{"no placeholders", "no placeholders"},
+	} {
+		f, err := NewSetRequestHeader().CreateFilter([]interface{}{"X-Result", ti.template})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Request(ctx)
+		if v := req.Header.Get("X-Result"); v != ti.expected {
+			t.Errorf("failed to expand %s: %s, expected: %s", ti.template, v, ti.expected)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package builtin
 
 import (
 	"github.com/zalando/skipper/filters"
+	"net/http"
 	"strings"
 )
 
@@ -26,10 +27,18 @@ const (
 	responseHeader
 )
 
-// common structure for requestHeader, responseHeader specifications and
-// filters
+type headerOp int
+
+const (
+	appendHeader headerOp = iota
+	setHeader
+	dropHeader
+)
+
+// common structure for the header specifications and filters
 type headerFilter struct {
 	typ              headerType
+	op               headerOp
 	name, key, value string
 }
 
@@ -54,38 +63,161 @@ func headerFilterConfig(config []interface{}) (string, string, error) {
 
 // Returns a filter specification that is used to set headers for requests.
 // Instances expect two parameters: the header name and the header value.
+// The ${name} placeholders in the value are substituted with the values
+// from the request context, see filters.ExpandTemplate.
 // Name: "requestHeader".
 func NewRequestHeader() filters.Spec {
-	return &headerFilter{typ: requestHeader, name: RequestHeaderName}
+	return &headerFilter{typ: requestHeader, op: appendHeader, name: RequestHeaderName}
 }
 
 // Returns a filter specification that is used to set headers for responses.
 // Instances expect two parameters: the header name and the header value.
+// The ${name} placeholders in the value are substituted with the values
+// from the request context, see filters.ExpandTemplate.
 // Name: "responseHeader".
 func NewResponseHeader() filters.Spec {
-	return &headerFilter{typ: responseHeader, name: ResponseHeaderName}
+	return &headerFilter{typ: responseHeader, op: appendHeader, name: ResponseHeaderName}
+}
+
+// Returns a filter specification whose instances set a header of the
+// request, replacing its existing values. Instances expect the name of
+// the header and the value, that can contain the placeholders of
+// filters.ExpandTemplate, e.g.:
+//
+//     setRequestHeader("X-Forwarded-Host", "${request.host}")
+//     setRequestHeader("X-User-Id", "${id}")
+//
+// Name: "setRequestHeader".
+func NewSetRequestHeader() filters.Spec {
+	return &headerFilter{typ: requestHeader, op: setHeader, name: SetRequestHeaderName}
+}
+
+// Returns a filter specification whose instances add a value to a
+// header of the request, keeping its existing values. Instances expect
+// the name of the header and the value, that can contain the
+// placeholders of filters.ExpandTemplate.
+//
+// Name: "appendRequestHeader".
+func NewAppendRequestHeader() filters.Spec {
+	return &headerFilter{typ: requestHeader, op: appendHeader, name: AppendRequestHeaderName}
+}
+
+// Returns a filter specification whose instances remove a header from
+// the request. Instances expect the name of the header.
+//
+// Name: "dropRequestHeader".
+func NewDropRequestHeader() filters.Spec {
+	return &headerFilter{typ: requestHeader, op: dropHeader, name: DropRequestHeaderName}
+}
+
+// Returns a filter specification whose instances set a header of the
+// response, replacing its existing values. Instances expect the name of
+// the header and the value, that can contain the placeholders of
+// filters.ExpandTemplate, e.g.:
+//
+//     setResponseHeader("X-Route", "${route.id}")
+//
+// Name: "setResponseHeader".
+func NewSetResponseHeader() filters.Spec {
+	return &headerFilter{typ: responseHeader, op: setHeader, name: SetResponseHeaderName}
+}
+
+// Returns a filter specification whose instances add a value to a
+// header of the response, keeping its existing values. Instances expect
+// the name of the header and the value, that can contain the
+// placeholders of filters.ExpandTemplate.
+//
+// Name: "appendResponseHeader".
+func NewAppendResponseHeader() filters.Spec {
+	return &headerFilter{typ: responseHeader, op: appendHeader, name: AppendResponseHeaderName}
+}
+
+// Returns a filter specification whose instances remove a header from
+// the response. Instances expect the name of the header.
+//
+// Name: "dropResponseHeader".
+func NewDropResponseHeader() filters.Spec {
+	return &headerFilter{typ: responseHeader, op: dropHeader, name: DropResponseHeaderName}
 }
 
 func (spec *headerFilter) Name() string { return spec.name }
 
+func (spec *headerFilter) Description() string {
+	target := "request forwarded to the backend"
+	if spec.typ == responseHeader {
+		target = "response"
+	}
+
+	switch spec.op {
+	case dropHeader:
+		return "Removes a header of the " + target + "."
+	case setHeader:
+		return "Sets a header of the " + target + ", replacing its values."
+	default:
+		return "Adds a value to a header of the " + target + "."
+	}
+}
+
+func (spec *headerFilter) Schema() []filters.Arg {
+	if spec.op == dropHeader {
+		return []filters.Arg{{Name: "name", Type: filters.StringType}}
+	}
+
+	return []filters.Arg{
+		{Name: "name", Type: filters.StringType},
+		{Name: "value", Type: filters.StringType},
+	}
+}
+
 func (spec *headerFilter) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if spec.op == dropHeader {
+		if len(config) != 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		key, ok := config[0].(string)
+		if !ok || key == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		return &headerFilter{typ: spec.typ, op: dropHeader, key: key}, nil
+	}
+
 	key, value, err := headerFilterConfig(config)
-	return &headerFilter{typ: spec.typ, key: key, value: value}, err
+	return &headerFilter{typ: spec.typ, op: spec.op, key: key, value: value}, err
+}
+
+// applies the operation to the headers, and returns the set value
+func (f *headerFilter) apply(ctx filters.FilterContext, h http.Header) string {
+	if f.op == dropHeader {
+		h.Del(f.key)
+		return ""
+	}
+
+	value := filters.ExpandTemplate(ctx, f.value)
+	if f.op == setHeader {
+		h.Set(f.key, value)
+	} else {
+		h.Add(f.key, value)
+	}
+
+	return value
 }
 
 func (f *headerFilter) Request(ctx filters.FilterContext) {
-	if f.typ == requestHeader {
-		req := ctx.Request()
-		if strings.ToLower(f.key) == "host" {
-			req.Host = f.value
-		}
+	if f.typ != requestHeader {
+		return
+	}
 
-		req.Header.Add(f.key, f.value)
+	req := ctx.Request()
+	value := f.apply(ctx, req.Header)
+	if f.op != dropHeader && strings.ToLower(f.key) == "host" {
+		req.Host = value
 	}
 }
 
 func (f *headerFilter) Response(ctx filters.FilterContext) {
 	if f.typ == responseHeader {
-		ctx.Response().Header.Add(f.key, f.value)
+		f.apply(ctx, ctx.Response().Header)
 	}
 }
@@ -19,15 +19,38 @@ import (
 	"net/http"
 )
 
-type healthCheck struct{}
+type healthCheck struct {
+	shutdown <-chan struct{}
+}
 
 // Creates a new filter Spec, whose instances set the status code of the
 // response to 200 OK. Name: "healthcheck".
 func NewHealthCheck() filters.Spec { return &healthCheck{} }
 
+// Creates a health check filter Spec, whose instances set the status
+// code of the response to 200 OK, until the shutdown channel is closed,
+// and to 503 Service Unavailable after it, to let the load balancers
+// stop sending requests to the proxy before it stops listening. Name:
+// "healthcheck".
+func NewShutdownHealthCheck(shutdown <-chan struct{}) filters.Spec {
+	return &healthCheck{shutdown: shutdown}
+}
+
 // "healthcheck"
 func (h *healthCheck) Name() string { return HealthCheckName }
 
+func (h *healthCheck) Description() string { return "Responds with 200 OK when the proxy is healthy." }
+
+func (h *healthCheck) Signature() string { return "" }
+
 func (h *healthCheck) CreateFilter(_ []interface{}) (filters.Filter, error) { return h, nil }
 func (h *healthCheck) Request(ctx filters.FilterContext)                    {}
-func (h *healthCheck) Response(ctx filters.FilterContext)                   { ctx.Response().StatusCode = http.StatusOK }
+
+func (h *healthCheck) Response(ctx filters.FilterContext) {
+	select {
+	case <-h.shutdown:
+		ctx.Response().StatusCode = http.StatusServiceUnavailable
+	default:
+		ctx.Response().StatusCode = http.StatusOK
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestShutdownHealthCheck(t *testing.T) {
+	shutdown := make(chan struct{})
+	f, err := NewShutdownHealthCheck(shutdown).CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(expected int) {
+		ctx := &filtertest.Context{FResponse: &http.Response{StatusCode: http.StatusNotFound}}
+		f.Response(ctx)
+		if ctx.FResponse.StatusCode != expected {
+			t.Error("invalid status", ctx.FResponse.StatusCode, expected)
+		}
+	}
+
+	check(http.StatusOK)
+	close(shutdown)
+	check(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,109 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"strings"
+)
+
+type loadBalancer struct {
+	settings filters.LoadBalancerSettings
+}
+
+// Returns a filter specification whose instances forward the requests
+// to a group of backends, selected by the proxy with a load balancing
+// algorithm:
+//
+//     roundRobin        - selects the members in turns
+//     powerOfTwoChoices - selects two random members, and takes the one
+//                         with less requests in progress
+//
+// The first parameter is the algorithm, optionally followed by the path
+// of the active health checks, starting with a slash, and the backend
+// addresses of the members. When the host of a member is a DNS name, it
+// is resolved periodically, and each of its IP addresses is a separate
+// member, verified with the name in case of TLS. E.g.:
+//
+//     loadBalancer("roundRobin", "http://10.0.0.1:8080", "http://10.0.0.2:8080")
+//     loadBalancer("powerOfTwoChoices", "/health", "https://api.internal")
+//
+// A member is ejected for 30 seconds after three consecutive failed
+// requests, connection errors or 5xx responses, and it is skipped while
+// the active health checks mark it down, checked on the health check
+// path, or on the default one of skipper. When all the members are
+// unavailable, the requests are forwarded to all of them.
+//
+// Name: "loadBalancer".
+func NewLoadBalancer() filters.Spec { return &loadBalancer{} }
+
+// "loadBalancer"
+func (spec *loadBalancer) Name() string { return LoadBalancerName }
+
+func (spec *loadBalancer) Description() string {
+	return "Forwards the requests to a group of backends, with round-robin or power of two choices load balancing."
+}
+
+func (spec *loadBalancer) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "algorithm", Type: filters.StringType},
+		{Name: "healthCheckPath", Type: filters.StringType, Optional: true},
+		{Name: "backend", Type: filters.StringType, Variadic: true}}
+}
+
+func (spec *loadBalancer) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &loadBalancer{}
+	switch config[0] {
+	case "roundRobin":
+		f.settings.Algorithm = filters.RoundRobin
+	case "powerOfTwoChoices":
+		f.settings.Algorithm = filters.PowerOfTwoChoices
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	members := config[1:]
+	if p, ok := members[0].(string); ok && strings.HasPrefix(p, "/") {
+		f.settings.HealthCheckPath = p
+		members = members[1:]
+	}
+
+	if len(members) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	for _, m := range members {
+		s, ok := m.(string)
+		if !ok || !isBackendUrl(s) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.settings.Members = append(f.settings.Members, s)
+	}
+
+	return f, nil
+}
+
+// Sets the load balancer in the state bag.
+func (f *loadBalancer) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.LoadBalancerKey] = f.settings
+}
+
+// Noop.
+func (f *loadBalancer) Response(filters.FilterContext) {}
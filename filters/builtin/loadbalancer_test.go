@@ -0,0 +1,91 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"reflect"
+	"testing"
+)
+
+func TestLoadBalancerArgs(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		args     []interface{}
+		settings filters.LoadBalancerSettings
+		err      bool
+	}{{
+		"no args",
+		nil,
+		filters.LoadBalancerSettings{},
+		true,
+	}, {
+		"no members",
+		[]interface{}{"roundRobin"},
+		filters.LoadBalancerSettings{},
+		true,
+	}, {
+		"invalid algorithm",
+		[]interface{}{"random", "http://10.0.0.1"},
+		filters.LoadBalancerSettings{},
+		true,
+	}, {
+		"health check path without members",
+		[]interface{}{"roundRobin", "/health"},
+		filters.LoadBalancerSettings{},
+		true,
+	}, {
+		"invalid member",
+		[]interface{}{"roundRobin", "http://10.0.0.1", "10.0.0.2"},
+		filters.LoadBalancerSettings{},
+		true,
+	}, {
+		"round robin",
+		[]interface{}{"roundRobin", "http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+		filters.LoadBalancerSettings{
+			Algorithm: filters.RoundRobin,
+			Members:   []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}},
+		false,
+	}, {
+		"power of two choices with health checks",
+		[]interface{}{"powerOfTwoChoices", "/health", "https://api.internal"},
+		filters.LoadBalancerSettings{
+			Algorithm:       filters.PowerOfTwoChoices,
+			HealthCheckPath: "/health",
+			Members:         []string{"https://api.internal"}},
+		false,
+	}} {
+		f, err := NewLoadBalancer().CreateFilter(ti.args)
+		if ti.err {
+			if err == nil {
+				t.Error(ti.msg, "failed to fail")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		if s := ctx.FStateBag[filters.LoadBalancerKey]; !reflect.DeepEqual(s, ti.settings) {
+			t.Error(ti.msg, "invalid settings", s)
+		}
+	}
+}
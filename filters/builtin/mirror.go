@@ -0,0 +1,319 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMirrorConcurrency = 32
+	defaultMirrorTimeout     = 10 * time.Second
+
+	// the part of the request body, that was read by the proxy, but
+	// not yet sent to the mirror backend
+	mirrorBodyBufferSize = 1 << 20
+)
+
+var (
+	errMirrorAborted      = errors.New("mirrored request aborted")
+	errMirrorBodyOverflow = errors.New("mirrored request body overflow")
+)
+
+type mirrorSpec struct {
+	client *http.Client
+}
+
+type mirror struct {
+	scheme   string
+	host     string
+	rate     float64
+	max      int64
+	inFlight int64
+	random   func() float64
+	client   *http.Client
+}
+
+// the body of a mirrored request, fed by the tee of the original
+// request body through a bounded buffer. Writing to it never blocks:
+// when the mirror backend doesn't keep up with the original backend,
+// and the buffer is full, the mirrored request fails.
+type mirrorBody struct {
+	mx     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	err    error
+	closed bool
+}
+
+// copies the original request body to the mirrored request, while the
+// proxy reads it
+type mirrorTee struct {
+	body   io.ReadCloser
+	mirror *mirrorBody
+}
+
+func newMirrorBody() *mirrorBody {
+	b := &mirrorBody{}
+	b.cond = sync.NewCond(&b.mx)
+	return b
+}
+
+func (b *mirrorBody) write(p []byte) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.err != nil || b.closed {
+		return
+	}
+
+	if b.buf.Len()+len(p) > mirrorBodyBufferSize {
+		b.err = errMirrorBodyOverflow
+		b.buf.Reset()
+	} else {
+		b.buf.Write(p)
+	}
+
+	b.cond.Signal()
+}
+
+// ends the body with io.EOF, or with an error
+func (b *mirrorBody) finish(err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+
+	b.cond.Signal()
+}
+
+func (b *mirrorBody) Read(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for b.buf.Len() == 0 && b.err == nil && !b.closed {
+		b.cond.Wait()
+	}
+
+	switch {
+	case b.closed:
+		return 0, errMirrorAborted
+	case b.err != nil && b.err != io.EOF:
+		return 0, b.err
+	case b.buf.Len() > 0:
+		return b.buf.Read(p)
+	default:
+		return 0, io.EOF
+	}
+}
+
+func (b *mirrorBody) Close() error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.closed = true
+	b.buf.Reset()
+	b.cond.Signal()
+	return nil
+}
+
+func (t *mirrorTee) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 {
+		t.mirror.write(p[:n])
+	}
+
+	if err != nil {
+		t.mirror.finish(err)
+	}
+
+	return n, err
+}
+
+// when the original request body is closed before it was read to the
+// end, the mirrored request fails
+func (t *mirrorTee) Close() error {
+	t.mirror.finish(errMirrorAborted)
+	return t.body.Close()
+}
+
+// Returns a filter specification whose instances copy a sampled share
+// of the requests to a shadow backend, e.g. to validate a new version
+// of a service with real traffic. The copies are sent asynchronously,
+// and the responses of the shadow backend are discarded, so they don't
+// affect the responses to the clients.
+//
+// Instances expect the address of the shadow backend, in the form of
+// scheme://host, optionally the share of the mirrored requests, 0-1,
+// defaulting to 1, and optionally the maximum number of the mirrored
+// requests of the route in progress, defaulting to 32, e.g.:
+//
+//     mirror("https://staging.example.org", 0.1)
+//
+// The requests are copied as they are when the filter is executed, with
+// the path, the query and the headers, and the host of the shadow
+// backend. The request bodies are copied while the proxy forwards them
+// to the backend of the route, through a limited buffer. Mirroring
+// never slows down the original requests: when the maximum number of
+// the mirrored requests is in progress, the request is not mirrored,
+// and when the shadow backend doesn't receive the body fast enough, the
+// mirrored request is aborted. The mirrored requests time out after 10
+// seconds, and they don't follow redirects.
+//
+// The mirrored requests are counted per route in the metrics, by their
+// result: sent, skipped or failed.
+//
+// Name: "mirror".
+func NewMirror() filters.Spec {
+	return &mirrorSpec{client: &http.Client{
+		Timeout: defaultMirrorTimeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: defaultMirrorConcurrency},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}}
+}
+
+// "mirror"
+func (spec *mirrorSpec) Name() string { return MirrorName }
+
+func (spec *mirrorSpec) Description() string {
+	return "Copies a sampled share of the requests to a shadow backend, discarding its responses."
+}
+
+func (spec *mirrorSpec) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "backend", Type: filters.StringType},
+		{Name: "rate", Type: filters.NumberType, Optional: true},
+		{Name: "maxConcurrency", Type: filters.NumberType, Optional: true}}
+}
+
+func (spec *mirrorSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	backend, ok := config[0].(string)
+	if !ok || !isBackendUrl(backend) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	u, _ := url.Parse(backend)
+	f := &mirror{
+		scheme: u.Scheme,
+		host:   u.Host,
+		rate:   1,
+		max:    defaultMirrorConcurrency,
+		random: rand.Float64,
+		client: spec.client}
+
+	if len(config) > 1 {
+		if f.rate, ok = config[1].(float64); !ok || f.rate < 0 || f.rate > 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	if len(config) > 2 {
+		max, ok := config[2].(float64)
+		if !ok || max < 1 || max != float64(int64(max)) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.max = int64(max)
+	}
+
+	return f, nil
+}
+
+// creates the mirrored copy of a request. When the request has a body,
+// it replaces it with the tee feeding the copy.
+func (f *mirror) mirrorRequest(r *http.Request) (*http.Request, error) {
+	u := *r.URL
+	u.Scheme, u.Host = f.scheme, f.host
+	mr, err := http.NewRequest(r.Method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.Header {
+		mr.Header[k] = append([]string(nil), v...)
+	}
+
+	if r.Body != nil && r.ContentLength != 0 {
+		mb := newMirrorBody()
+		r.Body = &mirrorTee{body: r.Body, mirror: mb}
+		mr.Body = mb
+		mr.ContentLength = r.ContentLength
+	}
+
+	return mr, nil
+}
+
+func (f *mirror) send(routeId string, r *http.Request) {
+	defer atomic.AddInt64(&f.inFlight, -1)
+
+	rsp, err := f.client.Do(r)
+	if err != nil {
+		log.Debugf("mirrored request of route %s failed: %v", routeId, err)
+		metrics.IncMirror(routeId, "failed")
+		return
+	}
+
+	io.Copy(ioutil.Discard, rsp.Body)
+	rsp.Body.Close()
+	metrics.IncMirror(routeId, "sent")
+}
+
+// Sends the copy of the sampled requests to the shadow backend.
+func (f *mirror) Request(ctx filters.FilterContext) {
+	if f.random() >= f.rate {
+		return
+	}
+
+	routeId, _ := ctx.StateBag()[filters.RouteIdKey].(string)
+	if atomic.AddInt64(&f.inFlight, 1) > f.max {
+		atomic.AddInt64(&f.inFlight, -1)
+		metrics.IncMirror(routeId, "skipped")
+		return
+	}
+
+	mr, err := f.mirrorRequest(ctx.Request())
+	if err != nil {
+		atomic.AddInt64(&f.inFlight, -1)
+		log.Errorf("failed to create the mirrored request of route %s: %v", routeId, err)
+		metrics.IncMirror(routeId, "failed")
+		return
+	}
+
+	go f.send(routeId, mr)
+}
+
+// Noop.
+func (f *mirror) Response(filters.FilterContext) {}
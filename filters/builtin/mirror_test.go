@@ -0,0 +1,240 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mirroredRequest struct {
+	method, uri, host, header, body string
+}
+
+// a shadow backend reporting the received requests
+func shadowBackend() (*httptest.Server, chan mirroredRequest) {
+	received := make(chan mirroredRequest, 16)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received <- mirroredRequest{r.Method, r.URL.RequestURI(), r.Host, r.Header.Get("X-Test"), string(b)}
+		w.Write([]byte("discarded"))
+	}))
+
+	return s, received
+}
+
+func mirrorContext(r *http.Request) *filtertest.Context {
+	return &filtertest.Context{
+		FRequest:  r,
+		FStateBag: map[string]interface{}{filters.RouteIdKey: "route1"}}
+}
+
+func waitForMirror(f filters.Filter) bool {
+	for i := 0; i < 120; i++ {
+		if atomic.LoadInt64(&f.(*mirror).inFlight) == 0 {
+			return true
+		}
+
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestMirrorArgs(t *testing.T) {
+	for _, ti := range []struct {
+		msg  string
+		args []interface{}
+		err  bool
+	}{{
+		"no args",
+		nil,
+		true,
+	}, {
+		"invalid backend",
+		[]interface{}{"staging.example.org"},
+		true,
+	}, {
+		"invalid rate",
+		[]interface{}{"https://staging.example.org", 1.5},
+		true,
+	}, {
+		"invalid concurrency",
+		[]interface{}{"https://staging.example.org", 0.1, 2.5},
+		true,
+	}, {
+		"too many args",
+		[]interface{}{"https://staging.example.org", 0.1, 3.0, 4.0},
+		true,
+	}, {
+		"backend only",
+		[]interface{}{"https://staging.example.org"},
+		false,
+	}, {
+		"all args",
+		[]interface{}{"https://staging.example.org", 0.1, 3.0},
+		false,
+	}} {
+		_, err := NewMirror().CreateFilter(ti.args)
+		if ti.err && err == nil {
+			t.Error(ti.msg, "failed to fail")
+		} else if !ti.err && err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
+
+func TestMirrorRequest(t *testing.T) {
+	shadow, received := shadowBackend()
+	defer shadow.Close()
+
+	f, err := NewMirror().CreateFilter([]interface{}{shadow.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("POST", "https://www.example.org/foo?bar=baz", strings.NewReader("Hello, world!"))
+	r.Header.Set("X-Test", "test-value")
+	f.Request(mirrorContext(r))
+
+	// the proxy forwarding the original request
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil || string(b) != "Hello, world!" {
+		t.Fatal("failed to read the original body", string(b), err)
+	}
+
+	r.Body.Close()
+
+	select {
+	case m := <-received:
+		if m.method != "POST" || m.uri != "/foo?bar=baz" || m.host != shadow.Listener.Addr().String() ||
+			m.header != "test-value" || m.body != "Hello, world!" {
+			t.Error("invalid mirrored request", m)
+		}
+	case <-time.After(120 * time.Millisecond):
+		t.Fatal("request not mirrored")
+	}
+
+	if !waitForMirror(f) {
+		t.Error("mirrored request not finished")
+	}
+}
+
+func TestMirrorSampling(t *testing.T) {
+	shadow, received := shadowBackend()
+	defer shadow.Close()
+
+	f, err := NewMirror().CreateFilter([]interface{}{shadow.URL, 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.(*mirror).random = func() float64 { return 0.5 }
+	r, _ := http.NewRequest("GET", "https://www.example.org/foo", nil)
+	f.Request(mirrorContext(r))
+
+	f.(*mirror).random = func() float64 { return 0.05 }
+	r, _ = http.NewRequest("GET", "https://www.example.org/bar", nil)
+	f.Request(mirrorContext(r))
+
+	select {
+	case m := <-received:
+		if m.uri != "/bar" {
+			t.Error("request mirrored outside of the sample", m.uri)
+		}
+	case <-time.After(120 * time.Millisecond):
+		t.Fatal("sampled request not mirrored")
+	}
+
+	select {
+	case m := <-received:
+		t.Error("unexpected mirrored request", m.uri)
+	case <-time.After(12 * time.Millisecond):
+	}
+}
+
+func TestMirrorConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	var count int64
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		<-release
+	}))
+	defer shadow.Close()
+
+	f, err := NewMirror().CreateFilter([]interface{}{shadow.URL, 1.0, 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		f.Request(mirrorContext(r))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	close(release)
+	if !waitForMirror(f) {
+		t.Fatal("mirrored requests not finished")
+	}
+
+	if c := atomic.LoadInt64(&count); c != 1 {
+		t.Error("concurrency limit not applied", c)
+	}
+}
+
+func TestMirrorDoesNotBlockOriginal(t *testing.T) {
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	f, err := NewMirror().CreateFilter([]interface{}{shadow.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a body larger than the buffer, not read by the shadow backend
+	body := strings.Repeat("x", 3*mirrorBodyBufferSize)
+	r, _ := http.NewRequest("PUT", "https://www.example.org/", strings.NewReader(body))
+	f.Request(mirrorContext(r))
+
+	done := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("reading the original body blocked by the mirrored request")
+	}
+}
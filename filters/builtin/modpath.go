@@ -34,6 +34,17 @@ func NewModPath() filters.Spec { return &modPath{} }
 // "modPath"
 func (spec *modPath) Name() string { return ModPathName }
 
+func (spec *modPath) Description() string {
+	return "Rewrites the request path by replacing the matches of a regular expression."
+}
+
+func (spec *modPath) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "expression", Type: filters.RegexpType},
+		{Name: "replacement", Type: filters.StringType},
+	}
+}
+
 func invalidConfig(config []interface{}) error {
 	return fmt.Errorf("invalid filter config in %s, expecting regexp and string, got: %v", ModPathName, config)
 }
@@ -0,0 +1,208 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type variant struct {
+	value   string
+	backend string
+}
+
+type negotiate struct {
+	header   string
+	variants []variant
+}
+
+// a value from an Accept or Accept-Language header, with its quality
+type acceptValue struct {
+	value   string
+	quality float64
+}
+
+type byQuality []acceptValue
+
+func (q byQuality) Len() int           { return len(q) }
+func (q byQuality) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q byQuality) Less(i, j int) bool { return q[i].quality > q[j].quality }
+
+// Returns a filter specification whose instances select the backend of
+// the request based on its Accept or Accept-Language header, so that
+// e.g. the clients accepting application/json can be forwarded to an
+// API backend, and the ones accepting text/html to a UI backend, on the
+// same path.
+//
+// The first parameter of the filter is the name of the header, Accept
+// or Accept-Language, and the rest of the parameters are pairs of a
+// media type or language tag and the address of the backend serving it,
+// e.g.:
+//
+//     negotiate("Accept", "application/json", "https://api.example.org", "text/html", "https://ui.example.org")
+//
+// The variant preferred by the client is selected, considering the
+// quality values, the wildcards and, for languages, the tag prefixes.
+// When the header is missing, or none of the variants is acceptable,
+// the request is forwarded to the backend of the route. The filter
+// adds the header name to the Vary header of the response.
+//
+// Name: "negotiate".
+func NewNegotiate() filters.Spec { return &negotiate{} }
+
+// "negotiate"
+func (spec *negotiate) Name() string { return NegotiateName }
+
+func (spec *negotiate) Description() string {
+	return "Selects the backend based on the Accept or Accept-Language header of the request."
+}
+
+func (spec *negotiate) Signature() string { return "header string, type string, backend string, ..." }
+
+func (spec *negotiate) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 3 || len(config)%2 != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	header, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	header = http.CanonicalHeaderKey(header)
+	if header != "Accept" && header != "Accept-Language" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &negotiate{header: header}
+	for i := 1; i < len(config); i += 2 {
+		value, ok := config[i].(string)
+		if !ok || value == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		backend, ok := config[i+1].(string)
+		if !ok || !isBackendUrl(backend) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.variants = append(f.variants, variant{strings.ToLower(value), backend})
+	}
+
+	return f, nil
+}
+
+// parses the header values with their quality, ordered by the quality,
+// keeping the original order of the values with the same quality. The
+// values not acceptable, with zero quality, are dropped.
+func parseAccept(h string) []acceptValue {
+	var values []acceptValue
+	for _, v := range strings.Split(h, ",") {
+		parts := strings.Split(v, ";")
+		av := acceptValue{value: strings.ToLower(strings.TrimSpace(parts[0])), quality: 1}
+		if av.value == "" {
+			continue
+		}
+
+		for _, p := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					av.quality = q
+				}
+			}
+		}
+
+		if av.quality > 0 {
+			values = append(values, av)
+		}
+	}
+
+	sort.Stable(byQuality(values))
+	return values
+}
+
+// the media type without its parameters
+func mediaType(v string) string {
+	return strings.TrimSpace(strings.Split(v, ";")[0])
+}
+
+// tells whether a media range, e.g. text/*, matches a media type
+func matchMediaType(mediaRange, typ string) bool {
+	mediaRange, typ = mediaType(mediaRange), mediaType(typ)
+	if mediaRange == "*/*" || mediaRange == typ {
+		return true
+	}
+
+	return strings.HasSuffix(mediaRange, "/*") &&
+		strings.HasPrefix(typ, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// tells whether a language range matches a language tag, either when
+// one is the prefix of the other, e.g. en and en-us
+func matchLanguage(languageRange, tag string) bool {
+	return languageRange == "*" ||
+		languageRange == tag ||
+		strings.HasPrefix(tag, languageRange+"-") ||
+		strings.HasPrefix(languageRange, tag+"-")
+}
+
+// selects the backend of the variant preferred by the client
+func (f *negotiate) selectBackend(h string) (string, bool) {
+	match := matchMediaType
+	if f.header == "Accept-Language" {
+		match = matchLanguage
+	}
+
+	for _, av := range parseAccept(h) {
+		for _, v := range f.variants {
+			if match(av.value, v.value) {
+				return v.backend, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Selects the backend of the preferred variant.
+func (f *negotiate) Request(ctx filters.FilterContext) {
+	h := ctx.Request().Header.Get(f.header)
+	if h == "" {
+		return
+	}
+
+	if b, ok := f.selectBackend(h); ok {
+		ctx.StateBag()[filters.BackendUrlKey] = b
+	}
+}
+
+// Adds the negotiated header to the Vary header.
+func (f *negotiate) Response(ctx filters.FilterContext) {
+	rh := ctx.Response().Header
+	for _, v := range rh["Vary"] {
+		for _, vi := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(vi), f.header) {
+				return
+			}
+		}
+	}
+
+	rh.Add("Vary", f.header)
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestNegotiateInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{"Accept"},
+		{"Accept", "application/json"},
+		{"Accept", "application/json", "https://api.example.org", "text/html"},
+		{"Content-Type", "application/json", "https://api.example.org"},
+		{42, "application/json", "https://api.example.org"},
+		{"Accept", "", "https://api.example.org"},
+		{"Accept", "application/json", "api.example.org"},
+		{"Accept", 42, "https://api.example.org"},
+	} {
+		if _, err := NewNegotiate().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	accept := []interface{}{
+		"Accept",
+		"application/json", "https://api.example.org",
+		"text/html", "https://ui.example.org"}
+	language := []interface{}{
+		"accept-language",
+		"de", "https://de.example.org",
+		"en-GB", "https://en.example.org"}
+
+	for _, ti := range []struct {
+		config  []interface{}
+		header  string
+		value   string
+		backend string
+	}{
+		{accept, "Accept", "", ""},
+		{accept, "Accept", "application/json", "https://api.example.org"},
+		{accept, "Accept", "text/html,application/xhtml+xml,*/*;q=0.8", "https://ui.example.org"},
+		{accept, "Accept", "text/html;q=0.5, application/json", "https://api.example.org"},
+		{accept, "Accept", "application/*", "https://api.example.org"},
+		{accept, "Accept", "text/*;q=0.9, */*;q=0.1", "https://ui.example.org"},
+		{accept, "Accept", "*/*", "https://api.example.org"},
+		{accept, "Accept", "image/png", ""},
+		{accept, "Accept", "application/json;q=0, text/plain", ""},
+		{accept, "Accept", "Application/JSON; charset=utf-8", "https://api.example.org"},
+		{language, "Accept-Language", "de-CH, de;q=0.9", "https://de.example.org"},
+		{language, "Accept-Language", "fr, en;q=0.5", "https://en.example.org"},
+		{language, "Accept-Language", "en-US, de;q=0.7", "https://de.example.org"},
+		{language, "Accept-Language", "fr", ""},
+	} {
+		f, err := NewNegotiate().CreateFilter(ti.config)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		req, _ := http.NewRequest("GET", "https://www.example.org", nil)
+		if ti.value != "" {
+			req.Header.Set(ti.header, ti.value)
+		}
+
+		c := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+		f.Request(c)
+
+		b, _ := c.FStateBag[filters.BackendUrlKey].(string)
+		if b != ti.backend {
+			t.Error("invalid backend", ti.value, b, ti.backend)
+		}
+	}
+}
+
+func TestNegotiateVary(t *testing.T) {
+	f, err := NewNegotiate().CreateFilter([]interface{}{"Accept", "application/json", "https://api.example.org"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ti := range []struct {
+		vary, expected []string
+	}{
+		{nil, []string{"Accept"}},
+		{[]string{"Accept-Encoding"}, []string{"Accept-Encoding", "Accept"}},
+		{[]string{"accept-encoding, accept"}, []string{"accept-encoding, accept"}},
+	} {
+		rsp := &http.Response{Header: make(http.Header)}
+		if ti.vary != nil {
+			rsp.Header["Vary"] = ti.vary
+		}
+
+		f.Response(&filtertest.Context{FResponse: rsp})
+
+		vary := rsp.Header["Vary"]
+		if len(vary) != len(ti.expected) {
+			t.Error("invalid vary header", vary)
+			continue
+		}
+
+		for i, v := range vary {
+			if v != ti.expected[i] {
+				t.Error("invalid vary header", vary)
+			}
+		}
+	}
+}
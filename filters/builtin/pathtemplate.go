@@ -0,0 +1,70 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"strings"
+)
+
+type pathTemplate struct {
+	template string
+}
+
+// Returns a filter specification whose instances set the path template
+// of the route, e.g. /users/:id/orders/:oid, that is used in the metrics
+// and the access log instead of the raw path, to keep their cardinality
+// low. It is meant to be used in routes without a path condition, e.g.
+// with a regexp path condition, where the path template cannot be taken
+// from the route.
+//
+// Instances expect one parameter, the path template, starting with '/'.
+//
+// Name: "pathTemplate".
+func NewPathTemplate() filters.Spec { return &pathTemplate{} }
+
+// "pathTemplate"
+func (spec *pathTemplate) Name() string { return PathTemplateName }
+
+func (spec *pathTemplate) Description() string {
+	return "Sets the path template of the route, used in the metrics and the access log."
+}
+
+func (spec *pathTemplate) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "template", Type: filters.StringType},
+	}
+}
+
+func (spec *pathTemplate) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	t, ok := config[0].(string)
+	if !ok || !strings.HasPrefix(t, "/") {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &pathTemplate{t}, nil
+}
+
+// Sets the path template in the state bag.
+func (f *pathTemplate) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.PathTemplateKey] = f.template
+}
+
+// Noop.
+func (f *pathTemplate) Response(filters.FilterContext) {}
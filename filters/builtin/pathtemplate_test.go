@@ -0,0 +1,48 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+)
+
+func TestPathTemplateInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{"users/:id"},
+		{float64(42)},
+		{"/users/:id", "/orders/:id"},
+	} {
+		if _, err := NewPathTemplate().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	f, err := NewPathTemplate().CreateFilter([]interface{}{"/users/:id"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	if ctx.StateBag()[filters.PathTemplateKey] != "/users/:id" {
+		t.Error("failed to set the path template")
+	}
+}
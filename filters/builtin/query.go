@@ -0,0 +1,114 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+)
+
+type queryOp int
+
+const (
+	setQuery queryOp = iota
+	dropQuery
+)
+
+type queryFilter struct {
+	op         queryOp
+	key, value string
+}
+
+// Returns a filter specification whose instances set a query parameter
+// of the request, replacing its existing values. Instances expect two
+// parameters: the name and the value of the query parameter. The
+// ${name} placeholders in the value are substituted with the values
+// from the request context, see filters.ExpandTemplate.
+// Name: "setQuery".
+func NewSetQuery() filters.Spec { return &queryFilter{op: setQuery} }
+
+// Returns a filter specification whose instances remove a query
+// parameter from the request. Instances expect the name of the query
+// parameter as their only parameter.
+// Name: "dropQuery".
+func NewDropQuery() filters.Spec { return &queryFilter{op: dropQuery} }
+
+func (spec *queryFilter) Name() string {
+	if spec.op == setQuery {
+		return SetQueryName
+	}
+
+	return DropQueryName
+}
+
+func (spec *queryFilter) Description() string {
+	if spec.op == setQuery {
+		return "Sets a query parameter of the request."
+	}
+
+	return "Removes a query parameter from the request."
+}
+
+func (spec *queryFilter) Schema() []filters.Arg {
+	if spec.op == setQuery {
+		return []filters.Arg{
+			{Name: "name", Type: filters.StringType},
+			{Name: "value", Type: filters.StringType},
+		}
+	}
+
+	return []filters.Arg{{Name: "name", Type: filters.StringType}}
+}
+
+func (spec *queryFilter) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if spec.op == dropQuery {
+		if len(config) != 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		key, ok := config[0].(string)
+		if !ok || key == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		return &queryFilter{op: dropQuery, key: key}, nil
+	}
+
+	key, value, err := headerFilterConfig(config)
+	if err != nil || key == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &queryFilter{op: setQuery, key: key, value: value}, nil
+}
+
+// Sets or removes the query parameter.
+func (f *queryFilter) Request(ctx filters.FilterContext) {
+	u := ctx.Request().URL
+	q := u.Query()
+	if f.op == setQuery {
+		q.Set(f.key, filters.ExpandTemplate(ctx, f.value))
+	} else {
+		if _, ok := q[f.key]; !ok {
+			return
+		}
+
+		q.Del(f.key)
+	}
+
+	u.RawQuery = q.Encode()
+}
+
+// Noop.
+func (f *queryFilter) Response(ctx filters.FilterContext) {}
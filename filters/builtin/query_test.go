@@ -0,0 +1,108 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestQueryFilterInvalidConfig(t *testing.T) {
+	for _, ti := range []struct {
+		name string
+		args []interface{}
+	}{
+		{SetQueryName, nil},
+		{SetQueryName, []interface{}{"foo"}},
+		{SetQueryName, []interface{}{"", "bar"}},
+		{SetQueryName, []interface{}{"foo", float64(1)}},
+		{DropQueryName, nil},
+		{DropQueryName, []interface{}{""}},
+		{DropQueryName, []interface{}{"foo", "bar"}},
+	} {
+		spec := NewSetQuery()
+		if ti.name == DropQueryName {
+			spec = NewDropQuery()
+		}
+
+		if _, err := spec.CreateFilter(ti.args); err == nil {
+			t.Error("failed to fail", ti.name, ti.args)
+		}
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	for _, ti := range []struct {
+		msg   string
+		name  string
+		args  []interface{}
+		query string
+		check string
+	}{{
+		"set new",
+		SetQueryName,
+		[]interface{}{"foo", "bar"},
+		"baz=qux",
+		"baz=qux&foo=bar",
+	}, {
+		"replace",
+		SetQueryName,
+		[]interface{}{"foo", "bar"},
+		"foo=1&foo=2",
+		"foo=bar",
+	}, {
+		"template",
+		SetQueryName,
+		[]interface{}{"lang", "${request.header.X-Lang}"},
+		"",
+		"lang=de",
+	}, {
+		"drop",
+		DropQueryName,
+		[]interface{}{"sessionId"},
+		"sessionId=42&foo=bar",
+		"foo=bar",
+	}, {
+		"drop missing keeps the query",
+		DropQueryName,
+		[]interface{}{"sessionId"},
+		"b=2&a=1",
+		"b=2&a=1",
+	}} {
+		spec := NewSetQuery()
+		if ti.name == DropQueryName {
+			spec = NewDropQuery()
+		}
+
+		f, err := spec.CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		r, err := http.NewRequest("GET", "https://www.example.org/?"+ti.query, nil)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		r.Header.Set("X-Lang", "de")
+		f.Request(&filtertest.Context{FRequest: r, FStateBag: make(map[string]interface{})})
+		if r.URL.RawQuery != ti.check {
+			t.Error(ti.msg, "invalid query", r.URL.RawQuery, ti.check)
+		}
+	}
+}
@@ -35,6 +35,15 @@ func NewRedirect() filters.Spec { return &redirect{} }
 // "redirect"
 func (spec *redirect) Name() string { return RedirectName }
 
+func (spec *redirect) Description() string { return "Responds with a redirect to a location." }
+
+func (spec *redirect) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "code", Type: filters.NumberType},
+		{Name: "location", Type: filters.StringType},
+	}
+}
+
 // Creates an instance of the redirect filter.
 func (spec *redirect) CreateFilter(config []interface{}) (filters.Filter, error) {
 	invalidArgs := func() (filters.Filter, error) {
@@ -85,13 +94,9 @@ func getRequestHost(r *http.Request) string {
 	return h
 }
 
-// Sets the status code and the location header of the response. Marks the
-// request served.
-func (f *redirect) Response(ctx filters.FilterContext) {
-	r := ctx.Request()
-	w := ctx.ResponseWriter()
-	u := f.copyOfLocation()
-
+// completes the location with the parts missing from it, taken from the
+// request.
+func completeLocation(r *http.Request, u *url.URL) {
 	if u.Scheme == "" {
 		if r.URL.Scheme != "" {
 			u.Scheme = r.URL.Scheme
@@ -113,7 +118,15 @@ func (f *redirect) Response(ctx filters.FilterContext) {
 	if u.RawQuery == "" {
 		u.RawQuery = r.URL.RawQuery
 	}
+}
 
+// Sets the status code and the location header of the response. Marks the
+// request served.
+func (f *redirect) Response(ctx filters.FilterContext) {
+	r := ctx.Request()
+	w := ctx.ResponseWriter()
+	u := f.copyOfLocation()
+	completeLocation(r, u)
 	w.Header().Set("Location", u.String())
 	w.WriteHeader(f.code)
 	ctx.MarkServed()
@@ -0,0 +1,130 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+type redirectTo struct {
+	code     int
+	location string
+	rx       *regexp.Regexp
+}
+
+// Returns a new filter Spec, whose instances respond with a redirect
+// already in the request phase, so the routes don't need a <shunt>
+// backend. Instances expect the redirect status code and the location,
+// in which the ${name} placeholders are substituted with the values from
+// the request context, see filters.ExpandTemplate, e.g:
+//
+//     redirectTo(301, "https://www.example.org/products/${id}")
+//
+// Alternatively, they accept the status code, a regular expression
+// matched against the request path, and the location as the replacement
+// of the match, referencing the capture groups as $1, $2 or ${name},
+// like in regexp.Expand, e.g.:
+//
+//     redirectTo(302, /^\/promo\/([^\/]+)$/, "https://shop.example.org/campaigns/$1")
+//
+// In this form, the requests whose path doesn't match the expression
+// are not redirected. Like with the redirect filter, the scheme, the
+// host, the path and the query missing from the location are taken from
+// the request.
+//
+// Name: "redirectTo".
+func NewRedirectTo() filters.Spec { return &redirectTo{} }
+
+// "redirectTo"
+func (spec *redirectTo) Name() string { return RedirectToName }
+
+func (spec *redirectTo) Description() string {
+	return "Responds with a redirect to a location, optionally built from the captures of a regular expression matched against the path."
+}
+
+func (spec *redirectTo) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "code", Type: filters.NumberType},
+		{Name: "location or expression", Type: filters.StringType},
+		{Name: "replacement", Type: filters.StringType, Optional: true},
+	}
+}
+
+func (spec *redirectTo) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 2 && len(config) != 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	code, ok := config[0].(float64)
+	if !ok || code < 300 || code > 399 || code != float64(int(code)) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &redirectTo{code: int(code)}
+	if f.location, ok = config[len(config)-1].(string); !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if len(config) == 3 {
+		expr, ok := config[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		rx, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		f.rx = rx
+	}
+
+	return f, nil
+}
+
+// Responds with the redirect, and marks the request as served.
+func (f *redirectTo) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	var location string
+	if f.rx == nil {
+		location = filters.ExpandTemplate(ctx, f.location)
+	} else {
+		m := f.rx.FindStringSubmatchIndex(r.URL.Path)
+		if m == nil {
+			return
+		}
+
+		location = string(f.rx.ExpandString(nil, f.location, r.URL.Path, m))
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		ctx.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+		ctx.MarkServed()
+		return
+	}
+
+	completeLocation(r, u)
+	w := ctx.ResponseWriter()
+	w.Header().Set("Location", u.String())
+	w.WriteHeader(f.code)
+	ctx.MarkServed()
+}
+
+// Noop.
+func (f *redirectTo) Response(ctx filters.FilterContext) {}
@@ -0,0 +1,127 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{float64(302)},
+		{"302", "https://www.example.org"},
+		{float64(200), "https://www.example.org"},
+		{float64(302), float64(1)},
+		{float64(302), "(", "https://www.example.org"},
+		{float64(302), "^/a", "https://www.example.org", "b"},
+	} {
+		if _, err := NewRedirectTo().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestRedirectTo(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		args     []interface{}
+		url      string
+		params   map[string]string
+		served   bool
+		location string
+	}{{
+		"absolute location",
+		[]interface{}{float64(301), "https://www.example.org/"},
+		"https://legacy.example.org/foo",
+		nil,
+		true,
+		"https://www.example.org/",
+	}, {
+		"relative location",
+		[]interface{}{float64(302), "/bar"},
+		"https://www.example.org/foo?q=1",
+		nil,
+		true,
+		"https://www.example.org/bar?q=1",
+	}, {
+		"template",
+		[]interface{}{float64(302), "https://shop.example.org/products/${id}"},
+		"https://www.example.org/p/42",
+		map[string]string{"id": "42"},
+		true,
+		"https://shop.example.org/products/42",
+	}, {
+		"regexp captures",
+		[]interface{}{float64(301), `^/promo/([^/]+)$`, "https://shop.example.org/campaigns/$1"},
+		"https://www.example.org/promo/summer",
+		nil,
+		true,
+		"https://shop.example.org/campaigns/summer",
+	}, {
+		"named capture",
+		[]interface{}{float64(301), `^/docs/(?P<page>.+)\.html$`, "/documentation/${page}"},
+		"https://www.example.org/docs/intro.html",
+		nil,
+		true,
+		"https://www.example.org/documentation/intro",
+	}, {
+		"regexp not matching",
+		[]interface{}{float64(301), `^/promo/([^/]+)$`, "https://shop.example.org/campaigns/$1"},
+		"https://www.example.org/other",
+		nil,
+		false,
+		"",
+	}} {
+		f, err := NewRedirectTo().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		r, err := http.NewRequest("GET", ti.url, nil)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		ctx := &filtertest.Context{
+			FResponseWriter: httptest.NewRecorder(),
+			FRequest:        r,
+			FParams:         ti.params,
+			FStateBag:       make(map[string]interface{})}
+		f.Request(ctx)
+
+		if ctx.FServed != ti.served {
+			t.Error(ti.msg, "invalid served state")
+			continue
+		}
+
+		if !ti.served {
+			continue
+		}
+
+		if ctx.FResponseWriter.(*httptest.ResponseRecorder).Code != int(ti.args[0].(float64)) {
+			t.Error(ti.msg, "invalid status code")
+		}
+
+		if l := ctx.FResponseWriter.Header().Get("Location"); l != ti.location {
+			t.Error(ti.msg, "invalid location", l, ti.location)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import "github.com/zalando/skipper/filters"
+
+type retry struct {
+	settings filters.RetrySettings
+}
+
+// Returns a filter specification whose instances set the retries of the
+// route, overriding the default retries of the proxy. Only the GET and
+// HEAD requests without a body are retried, when the backend roundtrip
+// fails, or, optionally, when the backend responds with one of the
+// listed status codes. The retries are limited by the retry budget of
+// the proxy, and with split backends, they prefer another backend.
+//
+// The first parameter is the maximum number of the retries, zero
+// disables the default retries for the route. The optional second
+// parameter is a comma separated list of status codes, or classes of
+// status codes, e.g.:
+//
+//     retry(2)
+//     retry(2, "502,503,504")
+//     retry(1, "5xx")
+//
+// Name: "retry".
+func NewRetry() filters.Spec { return &retry{} }
+
+// "retry"
+func (spec *retry) Name() string { return RetryName }
+
+func (spec *retry) Description() string {
+	return "Sets the retries of the idempotent requests of the route."
+}
+
+func (spec *retry) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "attempts", Type: filters.NumberType},
+		{Name: "statuses", Type: filters.StringType, Optional: true}}
+}
+
+func (spec *retry) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	attempts, ok := config[0].(float64)
+	if !ok || attempts < 0 || attempts != float64(int(attempts)) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &retry{settings: filters.RetrySettings{Attempts: int(attempts)}}
+	if len(config) == 2 {
+		s, ok := config[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		codes, err := filters.ParseStatusCodes(s)
+		if err != nil {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.settings.Statuses = codes
+	}
+
+	return f, nil
+}
+
+// Sets the retry settings in the state bag.
+func (f *retry) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.RetryKey] = f.settings
+}
+
+// Noop.
+func (f *retry) Response(filters.FilterContext) {}
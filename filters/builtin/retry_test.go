@@ -0,0 +1,86 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"reflect"
+	"testing"
+)
+
+func TestRetryArgs(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		args     []interface{}
+		settings filters.RetrySettings
+		err      bool
+	}{{
+		"no args",
+		nil,
+		filters.RetrySettings{},
+		true,
+	}, {
+		"negative attempts",
+		[]interface{}{float64(-1)},
+		filters.RetrySettings{},
+		true,
+	}, {
+		"fractional attempts",
+		[]interface{}{1.5},
+		filters.RetrySettings{},
+		true,
+	}, {
+		"invalid statuses",
+		[]interface{}{float64(2), "foo"},
+		filters.RetrySettings{},
+		true,
+	}, {
+		"disabled",
+		[]interface{}{float64(0)},
+		filters.RetrySettings{},
+		false,
+	}, {
+		"connection errors",
+		[]interface{}{float64(2)},
+		filters.RetrySettings{Attempts: 2},
+		false,
+	}, {
+		"statuses",
+		[]interface{}{float64(1), "502, 503"},
+		filters.RetrySettings{Attempts: 1, Statuses: []int{502, 503}},
+		false,
+	}} {
+		f, err := NewRetry().CreateFilter(ti.args)
+		if ti.err {
+			if err == nil {
+				t.Error(ti.msg, "failed to fail")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		if s := ctx.FStateBag[filters.RetryKey]; !reflect.DeepEqual(s, ti.settings) {
+			t.Error(ti.msg, "invalid settings", s)
+		}
+	}
+}
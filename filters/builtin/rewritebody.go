@@ -0,0 +1,180 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"io"
+	"regexp"
+)
+
+const (
+	defaultMaxMatchLength = 4096
+	rewriteReadSize       = 8192
+)
+
+type rewriteResponseBody struct {
+	rx             *regexp.Regexp
+	replacement    []byte
+	maxMatchLength int
+}
+
+// rewrites a body stream, holding back the last maxMatchLength bytes of
+// the input, until more data arrives, so that the matches spanning
+// multiple reads are found, too
+type bodyRewriter struct {
+	body   io.ReadCloser
+	filter *rewriteResponseBody
+	chunk  []byte
+	buf    []byte
+	out    []byte
+	err    error
+}
+
+// Returns a filter specification whose instances rewrite the response
+// bodies, replacing the matches of a regular expression, while the body
+// is streamed to the client, without buffering the whole body, e.g. to
+// rewrite the URLs in the HTML pages of a legacy backend.
+//
+// Instances expect two or three parameters: the regular expression, the
+// replacement, that can refer to the submatches the same way as in
+// modPath, e.g. $1, and optionally the maximum length of a match in
+// bytes. The default maximum length is 4096. Longer matches may not be
+// found, when they span multiple reads from the backend. The expression
+// must not match the empty string. E.g.:
+//
+//     rewriteResponseBody("http://legacy.example.org(/[^\"]*)", "https://www.example.org$1")
+//
+// The responses with a Content-Encoding other than identity are not
+// rewritten.
+//
+// Name: "rewriteResponseBody".
+func NewRewriteResponseBody() filters.Spec { return &rewriteResponseBody{} }
+
+// "rewriteResponseBody"
+func (spec *rewriteResponseBody) Name() string { return RewriteResponseBodyName }
+
+func (spec *rewriteResponseBody) Description() string {
+	return "Replaces the matches of a regular expression in the response body, while streaming it."
+}
+
+func (spec *rewriteResponseBody) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "expression", Type: filters.RegexpType},
+		{Name: "replacement", Type: filters.StringType},
+		{Name: "maxMatchLength", Type: filters.NumberType, Optional: true},
+	}
+}
+
+func (spec *rewriteResponseBody) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 || len(config) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	expr, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	rx, err := regexp.Compile(expr)
+	if err != nil || rx.MatchString("") {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	replacement, ok := config[1].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	maxMatchLength := defaultMaxMatchLength
+	if len(config) == 3 {
+		l, ok := config[2].(float64)
+		if !ok || l < 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		maxMatchLength = int(l)
+	}
+
+	return &rewriteResponseBody{rx, []byte(replacement), maxMatchLength}, nil
+}
+
+// Noop.
+func (f *rewriteResponseBody) Request(filters.FilterContext) {}
+
+// Wraps the response body with the rewriting stream.
+func (f *rewriteResponseBody) Response(ctx filters.FilterContext) {
+	if e := ctx.Response().Header.Get("Content-Encoding"); e != "" && e != "identity" {
+		return
+	}
+
+	filters.TransformResponseBody(ctx, func(body io.ReadCloser) io.ReadCloser {
+		return &bodyRewriter{body: body, filter: f, chunk: make([]byte, rewriteReadSize)}
+	})
+}
+
+// reads from the body, and rewrites the input that cannot be part of a
+// match reaching into the next read
+func (r *bodyRewriter) fill() {
+	r.out = r.out[:0]
+	n, err := r.body.Read(r.chunk)
+	r.buf = append(r.buf, r.chunk[:n]...)
+	r.err = err
+
+	safe := len(r.buf) - r.filter.maxMatchLength
+	if r.err != nil {
+		safe = len(r.buf)
+	}
+
+	if safe <= 0 {
+		return
+	}
+
+	var pos int
+	for _, m := range r.filter.rx.FindAllSubmatchIndex(r.buf, -1) {
+		if m[0] >= safe {
+			break
+		}
+
+		r.out = append(r.out, r.buf[pos:m[0]]...)
+		r.out = r.filter.rx.Expand(r.out, r.filter.replacement, r.buf, m)
+		pos = m[1]
+	}
+
+	if pos < safe {
+		r.out = append(r.out, r.buf[pos:safe]...)
+		pos = safe
+	}
+
+	r.buf = append(r.buf[:0], r.buf[pos:]...)
+}
+
+func (r *bodyRewriter) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		r.fill()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *bodyRewriter) Close() error {
+	return r.body.Close()
+}
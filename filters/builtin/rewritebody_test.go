@@ -0,0 +1,103 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"github.com/zalando/skipper/filters/filtertest"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRewriteResponseBodyInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"foo"},
+		{"(", "bar"},
+		{"x*", "bar"},
+		{"foo", 42.0},
+		{"foo", "bar", "4096"},
+		{"foo", "bar", 0.0},
+		{"foo", "bar", 4096.0, "baz"},
+	} {
+		if _, err := NewRewriteResponseBody().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func rewriteBody(t *testing.T, args []interface{}, header http.Header, body string, oneByte bool) (string, *http.Response) {
+	f, err := NewRewriteResponseBody().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	header.Set("Content-Length", "42")
+	rsp := &http.Response{
+		Header:        header,
+		ContentLength: 42,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body))}
+	if oneByte {
+		rsp.Body = ioutil.NopCloser(iotest.OneByteReader(rsp.Body))
+	}
+
+	f.Response(&filtertest.Context{FResponse: rsp})
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b), rsp
+}
+
+func TestRewriteResponseBody(t *testing.T) {
+	body := strings.Repeat(`<a href="http://legacy.example.org/foo">foo</a>`, 600)
+	expected := strings.Repeat(`<a href="https://www.example.org/foo">foo</a>`, 600)
+	args := []interface{}{`http://legacy\.example\.org(/[^"]*)`, "https://www.example.org$1"}
+
+	for _, oneByte := range []bool{false, true} {
+		b, rsp := rewriteBody(t, args, nil, body, oneByte)
+		if b != expected {
+			t.Error("failed to rewrite the body", oneByte)
+		}
+
+		if rsp.ContentLength != -1 || rsp.Header.Get("Content-Length") != "" {
+			t.Error("failed to remove the content length")
+		}
+	}
+}
+
+func TestRewriteResponseBodyMatchAcrossReads(t *testing.T) {
+	b, _ := rewriteBody(t, []interface{}{"foobar", "baz", 6.0}, nil, "xxfoobarxxfoobar", true)
+	if b != "xxbazxxbaz" {
+		t.Error("failed to rewrite the body", b)
+	}
+}
+
+func TestRewriteResponseBodySkipsEncoded(t *testing.T) {
+	h := make(http.Header)
+	h.Set("Content-Encoding", "gzip")
+	b, rsp := rewriteBody(t, []interface{}{"foo", "bar"}, h, "foo", false)
+	if b != "foo" || rsp.ContentLength != 42 {
+		t.Error("failed to skip the encoded body", b)
+	}
+}
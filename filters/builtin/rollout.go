@@ -0,0 +1,157 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+const (
+	rolloutCookiePrefix = "skipper-rollout-"
+	rolloutCookieMaxAge = 30 * 24 * 60 * 60
+	rolloutBuckets      = 100
+)
+
+type rolloutSpec struct {
+	registry filters.Registry
+}
+
+type rollout struct {
+	percentage float64
+	cookieName string
+	filter     filters.Filter
+}
+
+// the decision about a single request
+type rolloutState struct {
+	enabled   bool
+	newBucket int
+}
+
+// Returns a filter specification whose instances apply an inner filter
+// only to a percentage of the requests, so that risky filters can be
+// rolled out gradually on a live route. The inner filter is created
+// using the provided registry.
+//
+// Instances expect the percentage, 0-100, the name of the inner filter,
+// and optionally the parameters of the inner filter, e.g.:
+//
+//     rollout(10, "requestHeader", "X-New-Auth", "true")
+//
+// The clients are assigned to buckets, 0-99, stored in the
+// skipper-rollout-<filter name> cookie, and the inner filter is applied
+// to the clients whose bucket is lower than the percentage. This way,
+// the same clients keep getting the inner filter applied, also when the
+// percentage is increased.
+//
+// Name: "rollout".
+func NewRollout(registry filters.Registry) filters.Spec {
+	return &rolloutSpec{registry}
+}
+
+// "rollout"
+func (spec *rolloutSpec) Name() string { return RolloutName }
+
+func (spec *rolloutSpec) Description() string {
+	return "Applies an inner filter to a percentage of the clients."
+}
+
+func (spec *rolloutSpec) Signature() string { return "percentage number, filter string, args..." }
+
+func (spec *rolloutSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	percentage, ok := config[0].(float64)
+	if !ok || percentage < 0 || percentage > 100 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[1].(string)
+	if !ok || name == RolloutName {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	innerSpec, ok := spec.registry[name]
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	inner, err := innerSpec.CreateFilter(config[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	f := &rollout{
+		percentage: percentage,
+		cookieName: rolloutCookiePrefix + name,
+		filter:     inner}
+	return f, nil
+}
+
+// returns the bucket of the client from the cookie, or assigns a new one
+func (f *rollout) bucket(r *http.Request) (int, bool) {
+	if c, err := r.Cookie(f.cookieName); err == nil {
+		if b, err := strconv.Atoi(c.Value); err == nil && b >= 0 && b < rolloutBuckets {
+			return b, false
+		}
+	}
+
+	return rand.Intn(rolloutBuckets), true
+}
+
+// Applies the inner filter, when the bucket of the client is in the
+// rollout percentage.
+func (f *rollout) Request(ctx filters.FilterContext) {
+	b, isNew := f.bucket(ctx.Request())
+	s := &rolloutState{enabled: float64(b) < f.percentage, newBucket: -1}
+	if isNew {
+		s.newBucket = b
+	}
+
+	ctx.FilterState(f)["decision"] = s
+	if s.enabled {
+		f.filter.Request(ctx)
+	}
+}
+
+// Applies the inner filter to the response, when it was applied to the
+// request, and sets the cookie, when a new bucket was assigned.
+func (f *rollout) Response(ctx filters.FilterContext) {
+	s, ok := ctx.FilterState(f)["decision"].(*rolloutState)
+	if !ok {
+		return
+	}
+
+	if s.enabled {
+		f.filter.Response(ctx)
+	}
+
+	rsp := ctx.Response()
+	if s.newBucket < 0 || rsp == nil {
+		return
+	}
+
+	c := &http.Cookie{
+		Name:   f.cookieName,
+		Value:  strconv.Itoa(s.newBucket),
+		Path:   "/",
+		MaxAge: rolloutCookieMaxAge}
+	rsp.Header.Add("Set-Cookie", c.String())
+}
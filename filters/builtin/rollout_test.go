@@ -0,0 +1,143 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRolloutInvalidConfig(t *testing.T) {
+	spec := NewRollout(MakeRegistry())
+	for _, config := range [][]interface{}{
+		nil,
+		{float64(10)},
+		{"10", "requestHeader", "X-Foo", "bar"},
+		{float64(101), "requestHeader", "X-Foo", "bar"},
+		{float64(10), "noSuchFilter"},
+		{float64(10), "requestHeader", "X-Foo"},
+		{float64(10), "rollout", float64(10), "requestHeader", "X-Foo", "bar"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func rolloutRequest(t *testing.T, f filters.Filter, bucket int) (*http.Request, *http.Response) {
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bucket >= 0 {
+		req.AddCookie(&http.Cookie{Name: "skipper-rollout-requestHeader", Value: strconv.Itoa(bucket)})
+	}
+
+	rsp := &http.Response{Header: make(http.Header)}
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FResponse: rsp,
+		FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	f.Response(ctx)
+	return req, rsp
+}
+
+func TestRolloutSticky(t *testing.T) {
+	f, err := NewRollout(MakeRegistry()).CreateFilter([]interface{}{
+		float64(30), "requestHeader", "X-Foo", "bar"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ti := range []struct {
+		bucket  int
+		applied bool
+	}{
+		{0, true},
+		{29, true},
+		{30, false},
+		{99, false},
+	} {
+		req, rsp := rolloutRequest(t, f, ti.bucket)
+		if (req.Header.Get("X-Foo") == "bar") != ti.applied {
+			t.Error("invalid rollout decision", ti.bucket, ti.applied)
+		}
+
+		if rsp.Header.Get("Set-Cookie") != "" {
+			t.Error("unexpected cookie", ti.bucket)
+		}
+	}
+}
+
+func TestRolloutAssignsBucket(t *testing.T) {
+	f, err := NewRollout(MakeRegistry()).CreateFilter([]interface{}{
+		float64(50), "requestHeader", "X-Foo", "bar"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	applied := 0
+	for i := 0; i < 1000; i++ {
+		req, rsp := rolloutRequest(t, f, -1)
+		c := (&http.Response{Header: rsp.Header}).Cookies()
+		if len(c) != 1 || c[0].Name != "skipper-rollout-requestHeader" {
+			t.Error("failed to set the cookie")
+			return
+		}
+
+		b, err := strconv.Atoi(c[0].Value)
+		if err != nil || (b < 50) != (req.Header.Get("X-Foo") == "bar") {
+			t.Error("cookie doesn't match the decision", c[0].Value)
+			return
+		}
+
+		if b < 50 {
+			applied++
+		}
+	}
+
+	if applied < 400 || applied > 600 {
+		t.Error("invalid distribution", applied)
+	}
+}
+
+func TestRolloutZeroAndFull(t *testing.T) {
+	for _, ti := range []struct {
+		percentage float64
+		applied    bool
+	}{{0, false}, {100, true}} {
+		f, err := NewRollout(MakeRegistry()).CreateFilter([]interface{}{
+			ti.percentage, "requestHeader", "X-Foo", "bar"})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		for i := 0; i < 100; i++ {
+			req, _ := rolloutRequest(t, f, i)
+			if (req.Header.Get("X-Foo") == "bar") != ti.applied {
+				t.Error("invalid rollout decision", ti.percentage, i)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"math/rand"
+)
+
+type sampleSpec struct {
+	registry filters.Registry
+}
+
+type sample struct {
+	rate   float64
+	filter filters.Filter
+	random func() float64
+}
+
+// Returns a filter specification whose instances apply an inner filter
+// only to a sampled fraction of the requests, so that expensive
+// diagnostic filters, e.g. capturing or validating the body, have a
+// predictable overhead. The inner filter is created using the provided
+// registry.
+//
+// Instances expect the sampling rate, 0-1, the name of the inner
+// filter, and optionally the parameters of the inner filter, e.g.:
+//
+//     sample(0.01, "auditSignature", "/etc/skipper/audit.key")
+//
+// Unlike with the rollout filter, the decision is made independently
+// for every request, and the inner filter is applied to the response
+// only when it was applied to the request.
+//
+// Name: "sample".
+func NewSample(registry filters.Registry) filters.Spec {
+	return &sampleSpec{registry}
+}
+
+// "sample"
+func (spec *sampleSpec) Name() string { return SampleName }
+
+func (spec *sampleSpec) Description() string {
+	return "Applies an inner filter to a sampled fraction of the requests."
+}
+
+func (spec *sampleSpec) Signature() string { return "rate number, filter string, args..." }
+
+func (spec *sampleSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	rate, ok := config[0].(float64)
+	if !ok || rate < 0 || rate > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[1].(string)
+	if !ok || name == SampleName {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	innerSpec, ok := spec.registry[name]
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	inner, err := innerSpec.CreateFilter(config[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &sample{rate: rate, filter: inner, random: rand.Float64}, nil
+}
+
+// Applies the inner filter to the sampled requests.
+func (f *sample) Request(ctx filters.FilterContext) {
+	sampled := f.random() < f.rate
+	ctx.FilterState(f)["sampled"] = sampled
+	if sampled {
+		f.filter.Request(ctx)
+	}
+}
+
+// Applies the inner filter to the response, when it was applied to the
+// request.
+func (f *sample) Response(ctx filters.FilterContext) {
+	if sampled, _ := ctx.FilterState(f)["sampled"].(bool); sampled {
+		f.filter.Response(ctx)
+	}
+}
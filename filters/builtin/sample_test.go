@@ -0,0 +1,100 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func sampleRequest(t *testing.T, f filters.Filter) (*http.Request, *http.Response) {
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp := &http.Response{Header: make(http.Header)}
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FResponse: rsp,
+		FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	f.Response(ctx)
+	return req, rsp
+}
+
+func TestSampleInvalidConfig(t *testing.T) {
+	spec := NewSample(MakeRegistry())
+	for _, config := range [][]interface{}{
+		nil,
+		{0.1},
+		{"0.1", "requestHeader", "X-Foo", "bar"},
+		{1.1, "requestHeader", "X-Foo", "bar"},
+		{-0.1, "requestHeader", "X-Foo", "bar"},
+		{0.1, "noSuchFilter"},
+		{0.1, "requestHeader", "X-Foo"},
+		{0.1, "sample", 0.1, "requestHeader", "X-Foo", "bar"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestSampleDecision(t *testing.T) {
+	f, err := NewSample(MakeRegistry()).CreateFilter([]interface{}{
+		0.3, "responseHeader", "X-Foo", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		random  float64
+		applied bool
+	}{
+		{0, true},
+		{0.29, true},
+		{0.3, false},
+		{0.99, false},
+	} {
+		f.(*sample).random = func() float64 { return ti.random }
+		_, rsp := sampleRequest(t, f)
+		if (rsp.Header.Get("X-Foo") == "bar") != ti.applied {
+			t.Error("invalid sampling decision", ti.random, ti.applied)
+		}
+	}
+}
+
+func TestSampleDistribution(t *testing.T) {
+	f, err := MakeRegistry()[SampleName].CreateFilter([]interface{}{
+		0.5, "requestHeader", "X-Foo", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := 0
+	for i := 0; i < 1000; i++ {
+		req, _ := sampleRequest(t, f)
+		if req.Header.Get("X-Foo") == "bar" {
+			applied++
+		}
+	}
+
+	if applied < 400 || applied > 600 {
+		t.Error("invalid distribution", applied)
+	}
+}
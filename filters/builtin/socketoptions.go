@@ -0,0 +1,96 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import "github.com/zalando/skipper/filters"
+
+const maxDSCP = 63
+
+type socketOptions struct {
+	options filters.SocketOptions
+}
+
+// Returns a filter specification whose instances set the socket options
+// of the backend connections used by the route. It is meant to be used
+// in networks that do QoS based on packet marking.
+//
+// Instances expect pairs of parameters, the name and the value of the
+// option:
+//
+//     dscp       - the DSCP value, 0-63, set in the IP packets
+//     tcpNoDelay - "true" or "false", the default is "true"
+//
+// E.g.:
+//
+//     socketOptions("dscp", 46, "tcpNoDelay", "false")
+//
+// The connections with different socket options are pooled separately.
+//
+// Name: "socketOptions".
+func NewSocketOptions() filters.Spec { return &socketOptions{} }
+
+// "socketOptions"
+func (spec *socketOptions) Name() string { return SocketOptionsName }
+
+func (spec *socketOptions) Description() string {
+	return "Sets the socket options of the backend connections."
+}
+
+func (spec *socketOptions) Signature() string { return "name string, value, ..." }
+
+func (spec *socketOptions) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 || len(config)%2 != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &socketOptions{}
+	for i := 0; i < len(config); i += 2 {
+		name, ok := config[i].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch name {
+		case "dscp":
+			dscp, ok := config[i+1].(float64)
+			if !ok || dscp < 0 || dscp > maxDSCP || dscp != float64(int(dscp)) {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			f.options.DSCP = int(dscp)
+		case "tcpNoDelay":
+			switch config[i+1] {
+			case "true":
+				f.options.DisableNoDelay = false
+			case "false":
+				f.options.DisableNoDelay = true
+			default:
+				return nil, filters.ErrInvalidFilterParameters
+			}
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return f, nil
+}
+
+// Sets the socket options in the state bag.
+func (f *socketOptions) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.SocketOptionsKey] = f.options
+}
+
+// Noop.
+func (f *socketOptions) Response(filters.FilterContext) {}
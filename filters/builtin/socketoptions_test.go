@@ -0,0 +1,67 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+)
+
+func TestSocketOptionsInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{"dscp"},
+		{"dscp", "46"},
+		{"dscp", float64(-1)},
+		{"dscp", float64(64)},
+		{"dscp", 4.6},
+		{"tcpNoDelay", "no"},
+		{"ttl", float64(64)},
+		{42, float64(46)},
+	} {
+		if _, err := NewSocketOptions().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	for _, ti := range []struct {
+		config   []interface{}
+		expected filters.SocketOptions
+	}{{
+		[]interface{}{"dscp", float64(46)},
+		filters.SocketOptions{DSCP: 46},
+	}, {
+		[]interface{}{"tcpNoDelay", "false"},
+		filters.SocketOptions{DisableNoDelay: true},
+	}, {
+		[]interface{}{"dscp", float64(10), "tcpNoDelay", "true"},
+		filters.SocketOptions{DSCP: 10},
+	}} {
+		f, err := NewSocketOptions().CreateFilter(ti.config)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		c := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(c)
+		if o, ok := c.FStateBag[filters.SocketOptionsKey].(filters.SocketOptions); !ok || o != ti.expected {
+			t.Error("invalid socket options", ti.config, o)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSrvRefreshInterval = 30 * time.Second
+
+	// the refresh of a name stops when it was not used for this many
+	// intervals
+	srvIdleIntervals = 30
+)
+
+// the signature of net.LookupSRV
+type srvLookup func(service, proto, name string) (string, []*net.SRV, error)
+
+// the resolved records of a single name
+type srvEntry struct {
+	ready    chan struct{}
+	records  atomic.Value
+	lastUsed int64
+}
+
+// resolves and refreshes the SRV records, shared by all the srvBackend
+// filters
+type srvResolver struct {
+	interval time.Duration
+	clock    clock.Clock
+	lookup   srvLookup
+	mx       sync.Mutex
+	entries  map[string]*srvEntry
+}
+
+type srvSpec struct {
+	resolver *srvResolver
+}
+
+type srvBackend struct {
+	resolver *srvResolver
+	name     string
+	scheme   string
+}
+
+func newSrvResolver(interval time.Duration, lookup srvLookup, c clock.Clock) *srvResolver {
+	return &srvResolver{
+		interval: interval,
+		clock:    c,
+		lookup:   lookup,
+		entries:  make(map[string]*srvEntry)}
+}
+
+// looks up the records of a name. On failure, the previous records are
+// kept.
+func (r *srvResolver) resolve(name string, e *srvEntry) {
+	if _, records, err := r.lookup("", "", name); err == nil && len(records) > 0 {
+		e.records.Store(records)
+	}
+}
+
+func (r *srvResolver) run(name string, e *srvEntry) {
+	r.resolve(name, e)
+	close(e.ready)
+
+	for {
+		<-r.clock.After(r.interval)
+
+		idle := time.Duration(r.clock.Now().UnixNano() - atomic.LoadInt64(&e.lastUsed))
+		if idle > srvIdleIntervals*r.interval {
+			r.mx.Lock()
+			delete(r.entries, name)
+			r.mx.Unlock()
+			return
+		}
+
+		r.resolve(name, e)
+	}
+}
+
+// returns the records of a name. The name is resolved on the first
+// query, and refreshed periodically, until it is not queried for a
+// while. When done is closed before the first resolution completes, it
+// returns nil.
+func (r *srvResolver) records(name string, done <-chan struct{}) []*net.SRV {
+	r.mx.Lock()
+	e, ok := r.entries[name]
+	if !ok {
+		e = &srvEntry{ready: make(chan struct{})}
+		r.entries[name] = e
+		go r.run(name, e)
+	}
+	r.mx.Unlock()
+
+	atomic.StoreInt64(&e.lastUsed, r.clock.Now().UnixNano())
+	select {
+	case <-e.ready:
+	case <-done:
+		return nil
+	}
+
+	records, _ := e.records.Load().([]*net.SRV)
+	return records
+}
+
+// selects a record from the ones with the lowest priority value,
+// randomly, proportionally to their weights. The records with zero
+// weight are selected only when all the weights are zero.
+func selectSrv(records []*net.SRV, random func(int) int) *net.SRV {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var (
+		group []*net.SRV
+		sum   int
+	)
+
+	for _, r := range records {
+		switch {
+		case len(group) == 0 || r.Priority < group[0].Priority:
+			group = []*net.SRV{r}
+			sum = int(r.Weight)
+		case r.Priority == group[0].Priority:
+			group = append(group, r)
+			sum += int(r.Weight)
+		}
+	}
+
+	if sum == 0 {
+		return group[random(len(group))]
+	}
+
+	n := random(sum)
+	for _, r := range group {
+		if n < int(r.Weight) {
+			return r
+		}
+
+		n -= int(r.Weight)
+	}
+
+	return group[len(group)-1]
+}
+
+// Returns a filter specification whose instances forward the requests
+// to the backends discovered via DNS SRV records, e.g. in environments
+// using Consul DNS, or Kubernetes headless services. The records are
+// resolved on the first request, and refreshed every 30 seconds, while
+// the route receives requests. When the refresh fails, the previously
+// resolved records are used.
+//
+// The requests are forwarded to the targets with the lowest priority
+// value, distributed randomly, proportionally to the weights of the
+// records. When the name can't be resolved, the requests are answered
+// with 503 Service Unavailable.
+//
+// Instances expect the full name of the SRV records, and optionally the
+// scheme of the backends, http or https, which defaults to http, e.g.:
+//
+//     srvBackend("_http._tcp.api.service.consul")
+//     srvBackend("_api._tcp.api.default.svc.cluster.local", "https")
+//
+// Name: "srvBackend".
+func NewSrvBackend() filters.Spec {
+	return newSrvBackend(defaultSrvRefreshInterval, net.LookupSRV, clock.System)
+}
+
+func newSrvBackend(interval time.Duration, lookup srvLookup, c clock.Clock) *srvSpec {
+	return &srvSpec{newSrvResolver(interval, lookup, c)}
+}
+
+// "srvBackend"
+func (spec *srvSpec) Name() string { return SrvBackendName }
+
+func (spec *srvSpec) Description() string {
+	return "Forwards the requests to the backends discovered via DNS SRV records."
+}
+
+func (spec *srvSpec) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "name", Type: filters.StringType},
+		{Name: "scheme", Type: filters.StringType, Optional: true},
+	}
+}
+
+func (spec *srvSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 || len(config) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[0].(string)
+	if !ok || name == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	scheme := "http"
+	if len(config) == 2 {
+		if scheme, ok = config[1].(string); !ok || !validBackendScheme(scheme) {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &srvBackend{resolver: spec.resolver, name: name, scheme: scheme}, nil
+}
+
+// Sets the backend selected from the resolved records. When the
+// deadline of the request filters expires while waiting for the first
+// resolution of the name, the request is rejected.
+func (f *srvBackend) Request(ctx filters.FilterContext) {
+	r := selectSrv(f.resolver.records(f.name, ctx.Context().Done()), rand.Intn)
+	if r == nil {
+		ctx.ResponseWriter().WriteHeader(http.StatusServiceUnavailable)
+		ctx.MarkServed()
+		return
+	}
+
+	host := strings.TrimSuffix(r.Target, ".")
+	ctx.StateBag()[filters.BackendUrlKey] = fmt.Sprintf("%s://%s", f.scheme, net.JoinHostPort(host, fmt.Sprint(r.Port)))
+}
+
+// Noop.
+func (f *srvBackend) Response(ctx filters.FilterContext) {}
@@ -0,0 +1,255 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"errors"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSrvInterval = time.Second
+
+// DNS lookup returning the records set by the test
+type testSrvDns struct {
+	mx      sync.Mutex
+	records map[string][]*net.SRV
+	lookups int
+}
+
+func (d *testSrvDns) set(name string, records ...*net.SRV) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.records[name] = records
+}
+
+func (d *testSrvDns) count() int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.lookups
+}
+
+func (d *testSrvDns) lookup(_, _, name string) (string, []*net.SRV, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	d.lookups++
+	records, ok := d.records[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+
+	return name, records, nil
+}
+
+func newTestSrvDns() *testSrvDns {
+	return &testSrvDns{records: make(map[string][]*net.SRV)}
+}
+
+func srvRequest(t *testing.T, f filters.Filter) (string, int) {
+	w := httptest.NewRecorder()
+	ctx := &filtertest.Context{
+		FResponseWriter: w,
+		FRequest:        &http.Request{},
+		FStateBag:       make(map[string]interface{})}
+	f.Request(ctx)
+	b, _ := ctx.FStateBag[filters.BackendUrlKey].(string)
+	if ctx.FServed {
+		return b, w.Code
+	}
+
+	return b, 0
+}
+
+func TestSrvBackendInvalidConfig(t *testing.T) {
+	spec := NewSrvBackend()
+	for _, config := range [][]interface{}{
+		nil,
+		{""},
+		{42},
+		{"_http._tcp.api.service.consul", "ftp"},
+		{"_http._tcp.api.service.consul", "http", "https"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestSrvBackend(t *testing.T) {
+	dns := newTestSrvDns()
+	dns.set("_http._tcp.api.service.consul", &net.SRV{Target: "node1.service.consul.", Port: 8080, Priority: 1, Weight: 1})
+	spec := newSrvBackend(testSrvInterval, dns.lookup, clock.NewFake(time.Now()))
+
+	f, err := spec.CreateFilter([]interface{}{"_http._tcp.api.service.consul"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := srvRequest(t, f); b != "http://node1.service.consul:8080" {
+		t.Error("invalid backend", b)
+	}
+
+	f, err = spec.CreateFilter([]interface{}{"_http._tcp.api.service.consul", "https"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := srvRequest(t, f); b != "https://node1.service.consul:8080" {
+		t.Error("invalid backend", b)
+	}
+
+	if n := dns.count(); n != 1 {
+		t.Error("failed to share the records", n)
+	}
+}
+
+func TestSrvBackendNotResolved(t *testing.T) {
+	spec := newSrvBackend(testSrvInterval, newTestSrvDns().lookup, clock.NewFake(time.Now()))
+	f, err := spec.CreateFilter([]interface{}{"_http._tcp.unknown.service.consul"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, status := srvRequest(t, f); b != "" || status != http.StatusServiceUnavailable {
+		t.Error("failed to reject the request", b, status)
+	}
+}
+
+func TestSrvBackendRefresh(t *testing.T) {
+	const name = "_http._tcp.api.service.consul"
+
+	dns := newTestSrvDns()
+	dns.set(name, &net.SRV{Target: "node1.", Port: 80})
+	c := clock.NewFake(time.Now())
+	f, err := newSrvBackend(testSrvInterval, dns.lookup, c).CreateFilter([]interface{}{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srvRequest(t, f)
+	dns.set(name, &net.SRV{Target: "node2.", Port: 80})
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Add(testSrvInterval)
+	for dns.count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the records are updated after the lookup returned
+	deadline := time.Now().Add(time.Second)
+	for {
+		b, _ := srvRequest(t, f)
+		if b == "http://node2:80" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("failed to refresh the records", b)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// failed lookups keep the previous records
+	dns.set(name)
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Add(testSrvInterval)
+	for dns.count() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if b, _ := srvRequest(t, f); b != "http://node2:80" {
+		t.Error("failed to keep the records", b)
+	}
+}
+
+func TestSelectSrv(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "backup", Priority: 2, Weight: 100},
+		{Target: "a", Priority: 1, Weight: 1},
+		{Target: "b", Priority: 1, Weight: 3},
+		{Target: "c", Priority: 1, Weight: 0},
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		counts[selectSrv(records, func(int) int { return i }).Target]++
+	}
+
+	if counts["a"] != 1 || counts["b"] != 3 {
+		t.Error("invalid distribution", counts)
+	}
+
+	zero := []*net.SRV{{Target: "a", Priority: 1}, {Target: "b", Priority: 1}}
+	if r := selectSrv(zero, func(n int) int { return n - 1 }); r.Target != "b" {
+		t.Error("failed to select from zero weights", r.Target)
+	}
+
+	if selectSrv(nil, rand0) != nil {
+		t.Error("failed to handle no records")
+	}
+}
+
+func rand0(int) int { return 0 }
+
+// context whose deadline has already expired
+type expiredContext struct{ done chan struct{} }
+
+func (c expiredContext) Deadline() (time.Time, bool) { return time.Now(), true }
+func (c expiredContext) Done() <-chan struct{}       { return c.done }
+func (c expiredContext) Err() error                  { return filters.ErrDeadlineExceeded }
+
+func TestSrvBackendCanceled(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	lookup := func(_, _, name string) (string, []*net.SRV, error) {
+		<-block
+		return name, []*net.SRV{{Target: "node1.service.consul.", Port: 8080}}, nil
+	}
+
+	spec := newSrvBackend(testSrvInterval, lookup, clock.NewFake(time.Now()))
+	f, err := spec.CreateFilter([]interface{}{"_http._tcp.api.service.consul"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	close(done)
+
+	w := httptest.NewRecorder()
+	ctx := &filtertest.Context{
+		FResponseWriter: w,
+		FRequest:        &http.Request{},
+		FStateBag:       make(map[string]interface{}),
+		FContext:        expiredContext{done}}
+	f.Request(ctx)
+	if !ctx.FServed || w.Code != http.StatusServiceUnavailable {
+		t.Error("failed to give up waiting for the resolution", ctx.FServed, w.Code)
+	}
+}
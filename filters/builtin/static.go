@@ -17,12 +17,20 @@ package builtin
 import (
 	"fmt"
 	"github.com/zalando/skipper/filters"
+	"html"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
+	"sort"
+	"strings"
 )
 
+const staticListingArg = "listing"
+
 type static struct {
 	webRoot, root string
+	listing       bool
 }
 
 // Returns a filter Spec to serve static content from a file system
@@ -32,7 +40,21 @@ type static struct {
 // request path prefix and a local directory path. When processing a
 // request, it clips the prefix from the request path, and appends the
 // rest of the path to the directory path. Then, it uses the resulting
-// path to serve static content from the file system.
+// path to serve static content from the file system. The requests not
+// starting with the prefix are not served.
+//
+// The content type is detected from the file extension, or, when it
+// is unknown, from the content. Range requests are supported, and the
+// responses carry a weak ETag and the Last-Modified header, so the
+// conditional requests are answered with 304.
+//
+// When the path points to a directory, the index.html file in it is
+// served. When the directory has no index.html, and the optional third
+// argument is "listing", a listing of the directory is served,
+// otherwise the response is 404. The paths of the directories without
+// a trailing slash are redirected to the path with the slash. E.g.:
+//
+//     static("/files", "/var/www/files", "listing")
 //
 // Name: "static".
 func NewStatic() filters.Spec { return &static{} }
@@ -40,11 +62,23 @@ func NewStatic() filters.Spec { return &static{} }
 // "static"
 func (spec *static) Name() string { return StaticName }
 
+func (spec *static) Description() string {
+	return "Serves static files from a directory, optionally with directory listings."
+}
+
+func (spec *static) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "prefix", Type: filters.StringType},
+		{Name: "root", Type: filters.StringType},
+		{Name: "listing", Type: filters.StringType, Optional: true},
+	}
+}
+
 // Creates instances of the static filter. Expects two parameters: request path
-// prefix and file system root.
+// prefix and file system root, and optionally "listing".
 func (spec *static) CreateFilter(config []interface{}) (filters.Filter, error) {
-	if len(config) != 2 {
-		return nil, fmt.Errorf("invalid number of args: %d, expected 1", len(config))
+	if len(config) != 2 && len(config) != 3 {
+		return nil, fmt.Errorf("invalid number of args: %d, expected 2 or 3", len(config))
 	}
 
 	webRoot, ok := config[0].(string)
@@ -57,21 +91,147 @@ func (spec *static) CreateFilter(config []interface{}) (filters.Filter, error) {
 		return nil, fmt.Errorf("invalid parameter type, expected string for path to root dir")
 	}
 
-	return &static{webRoot, root}, nil
+	var listing bool
+	if len(config) == 3 {
+		if l, ok := config[2].(string); !ok || l != staticListingArg {
+			return nil, fmt.Errorf("invalid parameter, expected %q", staticListingArg)
+		}
+
+		listing = true
+	}
+
+	return &static{webRoot: webRoot, root: root, listing: listing}, nil
 }
 
 // Noop.
 func (f *static) Request(filters.FilterContext) {}
 
+// returns the error response matching a file system error
+func staticError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// a weak ETag derived from the modification time and the size of a file
+func staticETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+// serves a regular file, leaving the content type detection, the range
+// and the conditional requests to http.ServeContent
+func serveStaticFile(w http.ResponseWriter, r *http.Request, file http.File, fi os.FileInfo) {
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", staticETag(fi))
+	}
+
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), file)
+}
+
+// writes an HTML listing of a directory, without the hidden entries
+func serveStaticListing(w http.ResponseWriter, r *http.Request, dir http.File) {
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		staticError(w, err)
+		return
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if e.IsDir() {
+			name += "/"
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == "HEAD" {
+		return
+	}
+
+	title := html.EscapeString(r.URL.Path)
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<pre>\n", title, title)
+	for _, name := range names {
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(name))
+	}
+
+	fmt.Fprint(w, "</pre>\n</body>\n</html>\n")
+}
+
+// serves a directory: redirects to the path with the trailing slash,
+// serves the index.html, or the listing when enabled
+func (f *static) serveDir(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string, dir http.File) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		u := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return
+	}
+
+	index, err := fs.Open(path.Join(name, "index.html"))
+	if err == nil {
+		defer index.Close()
+		if fi, err := index.Stat(); err == nil && !fi.IsDir() {
+			serveStaticFile(w, r, index, fi)
+			return
+		}
+	}
+
+	if !f.listing {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	serveStaticListing(w, r, dir)
+}
+
 // Serves content from the file system and marks the request served.
 func (f *static) Response(ctx filters.FilterContext) {
 	r := ctx.Request()
 	p := r.URL.Path
 
-	if len(p) < len(f.webRoot) {
+	if !strings.HasPrefix(p, f.webRoot) {
 		return
 	}
 
 	ctx.MarkServed()
-	http.ServeFile(ctx.ResponseWriter(), ctx.Request(), path.Join(f.root, p[len(f.webRoot):]))
+	w := ctx.ResponseWriter()
+
+	// http.Dir cleans the path, so that it cannot point outside of the
+	// root directory
+	fs := http.Dir(f.root)
+	name := "/" + strings.TrimPrefix(p[len(f.webRoot):], "/")
+	file, err := fs.Open(name)
+	if err != nil {
+		staticError(w, err)
+		return
+	}
+
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		staticError(w, err)
+		return
+	}
+
+	if fi.IsDir() {
+		f.serveDir(w, r, fs, name, file)
+		return
+	}
+
+	serveStaticFile(w, r, file, fi)
 }
@@ -22,6 +22,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -52,3 +54,239 @@ func TestStatic(t *testing.T) {
 		t.Error("failed to write response", string(b))
 	}
 }
+
+// creates a directory tree for the static tests, returns its root
+func staticTestDir(t *testing.T) string {
+	root, err := ioutil.TempDir("", "static-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{
+		"style.css":         "body {}",
+		"data.txt":          "0123456789",
+		"docs/index.html":   "<h1>docs</h1>",
+		"files/a.txt":       "a",
+		"files/.hidden":     "hidden",
+		"files/sub/b.txt":   "b",
+		"files/<x>&y.txt":   "escaped",
+		"files/sub/.keep":   "",
+		"outside/other.txt": "other",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// serves a request with a static filter
+func serveStatic(t *testing.T, args []interface{}, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	f, err := NewStatic().CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	ctx := &filtertest.Context{FResponseWriter: w, FRequest: r}
+	f.Response(ctx)
+	return w, ctx.FServed
+}
+
+func TestStaticServing(t *testing.T) {
+	root := staticTestDir(t)
+	defer os.RemoveAll(root)
+
+	for _, ti := range []struct {
+		title    string
+		listing  bool
+		method   string
+		path     string
+		header   http.Header
+		served   bool
+		status   int
+		location string
+		contains string
+		excludes string
+	}{{
+		title: "prefix not matching",
+		path:  "/other/style.css",
+	}, {
+		title:    "content type by extension",
+		path:     "/static/style.css",
+		served:   true,
+		status:   http.StatusOK,
+		contains: "body {}",
+	}, {
+		title:    "range",
+		path:     "/static/data.txt",
+		header:   http.Header{"Range": []string{"bytes=2-4"}},
+		served:   true,
+		status:   http.StatusPartialContent,
+		contains: "234",
+	}, {
+		title:  "not found",
+		path:   "/static/missing.txt",
+		served: true,
+		status: http.StatusNotFound,
+	}, {
+		title:  "no traversal",
+		path:   "/static/../../" + filepath.Base(root) + "/outside/other.txt",
+		served: true,
+		status: http.StatusNotFound,
+	}, {
+		title:    "directory redirect",
+		path:     "/static/docs",
+		served:   true,
+		status:   http.StatusMovedPermanently,
+		location: "/static/docs/",
+	}, {
+		title:    "index",
+		path:     "/static/docs/",
+		served:   true,
+		status:   http.StatusOK,
+		contains: "<h1>docs</h1>",
+	}, {
+		title:  "listing disabled",
+		path:   "/static/files/",
+		served: true,
+		status: http.StatusNotFound,
+	}, {
+		title:    "listing",
+		listing:  true,
+		path:     "/static/files/",
+		served:   true,
+		status:   http.StatusOK,
+		contains: `<a href="sub/">sub/</a>`,
+		excludes: ".hidden",
+	}, {
+		title:    "listing escaped",
+		listing:  true,
+		path:     "/static/files/",
+		served:   true,
+		status:   http.StatusOK,
+		contains: "&lt;x&gt;&amp;y.txt",
+	}, {
+		title:    "listing head",
+		listing:  true,
+		method:   "HEAD",
+		path:     "/static/files/sub/",
+		served:   true,
+		status:   http.StatusOK,
+		excludes: "b.txt",
+	}} {
+		args := []interface{}{"/static", root}
+		if ti.listing {
+			args = append(args, "listing")
+		}
+
+		method := ti.method
+		if method == "" {
+			method = "GET"
+		}
+
+		r, err := http.NewRequest(method, "https://www.example.org", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.URL.Path = ti.path
+		if ti.header != nil {
+			r.Header = ti.header
+		}
+
+		w, served := serveStatic(t, args, r)
+		if served != ti.served {
+			t.Error(ti.title, "served", served, ti.served)
+			continue
+		}
+
+		if !served {
+			continue
+		}
+
+		if w.Code != ti.status {
+			t.Error(ti.title, "invalid status", w.Code, ti.status)
+		}
+
+		if ti.location != "" && w.Header().Get("Location") != ti.location {
+			t.Error(ti.title, "invalid location", w.Header().Get("Location"))
+		}
+
+		body := w.Body.String()
+		if ti.contains != "" && !strings.Contains(body, ti.contains) {
+			t.Error(ti.title, "missing content", body)
+		}
+
+		if ti.excludes != "" && strings.Contains(body, ti.excludes) {
+			t.Error(ti.title, "unexpected content", body)
+		}
+	}
+}
+
+func TestStaticContentType(t *testing.T) {
+	root := staticTestDir(t)
+	defer os.RemoveAll(root)
+
+	r, err := http.NewRequest("GET", "https://www.example.org/static/style.css", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := serveStatic(t, []interface{}{"/static", root}, r)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Error("invalid content type", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestStaticConditional(t *testing.T) {
+	root := staticTestDir(t)
+	defer os.RemoveAll(root)
+
+	args := []interface{}{"/static", root}
+	r, err := http.NewRequest("GET", "https://www.example.org/static/data.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := serveStatic(t, args, r)
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if !strings.HasPrefix(etag, `W/"`) || lastModified == "" {
+		t.Fatal("missing validators", etag, lastModified)
+	}
+
+	for _, h := range []http.Header{
+		{"If-None-Match": []string{etag}},
+		{"If-Modified-Since": []string{lastModified}},
+	} {
+		r, err := http.NewRequest("GET", "https://www.example.org/static/data.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header = h
+		w, _ := serveStatic(t, args, r)
+		if w.Code != http.StatusNotModified {
+			t.Error("failed to validate", h, w.Code)
+		}
+	}
+}
+
+func TestStaticInvalidArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{"/static"},
+		{"/static", 42},
+		{"/static", "/var/www", "list"},
+		{"/static", "/var/www", "listing", "more"},
+	} {
+		if _, err := NewStatic().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import "github.com/zalando/skipper/filters"
+
+type stripExpect struct{}
+
+// Returns a filter specification whose instances remove the Expect header
+// from the requests before they are forwarded to the backend. It is meant
+// to be used with backends that don't handle the "Expect: 100-continue"
+// requests correctly, e.g. stall large uploads. The 100 Continue response
+// is sent to the client by the proxy, when it starts reading the request
+// body.
+//
+// Name: "stripExpect".
+func NewStripExpect() filters.Spec { return &stripExpect{} }
+
+// "stripExpect"
+func (spec *stripExpect) Name() string { return StripExpectName }
+
+func (spec *stripExpect) Description() string {
+	return "Removes the Expect header from the forwarded requests."
+}
+
+func (spec *stripExpect) Signature() string { return "" }
+
+func (spec *stripExpect) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &stripExpect{}, nil
+}
+
+// Removes the Expect header.
+func (f *stripExpect) Request(ctx filters.FilterContext) {
+	ctx.Request().Header.Del("Expect")
+}
+
+// Noop.
+func (f *stripExpect) Response(filters.FilterContext) {}
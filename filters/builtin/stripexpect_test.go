@@ -0,0 +1,48 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestStripExpectInvalidConfig(t *testing.T) {
+	if _, err := NewStripExpect().CreateFilter([]interface{}{"100-continue"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestStripExpect(t *testing.T) {
+	f, err := NewStripExpect().CreateFilter(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", "https://www.example.org", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req.Header.Set("Expect", "100-continue")
+	ctx := &filtertest.Context{FRequest: req}
+	f.Request(ctx)
+	if _, ok := req.Header["Expect"]; ok {
+		t.Error("failed to strip the Expect header")
+	}
+}
@@ -41,6 +41,12 @@ func NewStripQuery() filters.Spec { return &stripQuery{} }
 // "stripQuery"
 func (spec *stripQuery) Name() string { return StripQueryName }
 
+func (spec *stripQuery) Description() string {
+	return "Removes the query parameters from the request, optionally preserving them as headers."
+}
+
+func (spec *stripQuery) Signature() string { return "[preserveAsHeaders string]" }
+
 // copied from textproto/reader
 func validHeaderFieldByte(b byte) bool {
 	return ('A' <= b && b <= 'Z') ||
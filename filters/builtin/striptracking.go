@@ -0,0 +1,169 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// The query parameters removed by default by the stripTrackingParams
+// filter. A trailing '*' matches any parameter with the given prefix.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"igshid"}
+
+type stripTrackingParams struct {
+	names    map[string]bool
+	prefixes []string
+}
+
+// sorts the raw query pairs by their key, keeping the order of the
+// repeated keys
+type queryPairs []string
+
+func (p queryPairs) Len() int           { return len(p) }
+func (p queryPairs) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p queryPairs) Less(i, j int) bool { return queryKey(p[i]) < queryKey(p[j]) }
+
+// Returns a filter Spec to remove tracking query parameters from the
+// request, e.g. utm_source or gclid, and to normalize the order of the
+// remaining ones, so that the URLs differing only in tracking
+// parameters become identical for the backends, for caching and for
+// the access log.
+//
+// Without arguments, the parameters in DefaultTrackingParams are
+// removed. The arguments extend this list with further parameter
+// names, where a trailing '*' matches the parameters by prefix:
+//
+//	stripTrackingParams("ref", "pk_*")
+//
+// Name: "stripTrackingParams".
+func NewStripTrackingParams() filters.Spec { return &stripTrackingParams{} }
+
+// "stripTrackingParams"
+func (s *stripTrackingParams) Name() string { return StripTrackingParamsName }
+
+func (s *stripTrackingParams) Description() string {
+	return "Removes the tracking query parameters from the request."
+}
+
+func (s *stripTrackingParams) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "param", Type: filters.StringType, Optional: true, Variadic: true},
+	}
+}
+
+// Creates instances of the stripTrackingParams filter. Accepts any
+// number of string arguments, the additional parameter names.
+func (s *stripTrackingParams) CreateFilter(args []interface{}) (filters.Filter, error) {
+	f := &stripTrackingParams{names: make(map[string]bool)}
+	for _, n := range DefaultTrackingParams {
+		f.add(n)
+	}
+
+	for _, a := range args {
+		n, ok := a.(string)
+		if !ok || n == "" || n == "*" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.add(n)
+	}
+
+	return f, nil
+}
+
+func (f *stripTrackingParams) add(name string) {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "*") {
+		f.prefixes = append(f.prefixes, name[:len(name)-1])
+	} else {
+		f.names[name] = true
+	}
+}
+
+func (f *stripTrackingParams) tracking(key string) bool {
+	key = strings.ToLower(key)
+	if f.names[key] {
+		return true
+	}
+
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the decoded key of a raw query pair
+func queryKey(pair string) string {
+	if i := strings.IndexByte(pair, '='); i >= 0 {
+		pair = pair[:i]
+	}
+
+	if k, err := url.QueryUnescape(pair); err == nil {
+		return k
+	}
+
+	return pair
+}
+
+// removes the tracking parameters and sorts the remaining ones, while
+// keeping their original encoding
+func (f *stripTrackingParams) normalize(rawQuery string) string {
+	var pairs queryPairs
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p != "" && !f.tracking(queryKey(p)) {
+			pairs = append(pairs, p)
+		}
+	}
+
+	sort.Stable(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// Removes the tracking parameters from the request URL and from the
+// request URI.
+func (f *stripTrackingParams) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	if r == nil || r.URL == nil || r.URL.RawQuery == "" {
+		return
+	}
+
+	r.URL.RawQuery = f.normalize(r.URL.RawQuery)
+
+	if i := strings.IndexByte(r.RequestURI, '?'); i >= 0 {
+		r.RequestURI = r.RequestURI[:i]
+		if r.URL.RawQuery != "" {
+			r.RequestURI += "?" + r.URL.RawQuery
+		}
+	}
+}
+
+// Noop.
+func (f *stripTrackingParams) Response(filters.FilterContext) {}
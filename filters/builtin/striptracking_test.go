@@ -0,0 +1,110 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestStripTrackingParamsInvalidArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{42},
+		{""},
+		{"*"},
+		{"ref", 3.14},
+	} {
+		if _, err := NewStripTrackingParams().CreateFilter(args); err != filters.ErrInvalidFilterParameters {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestStripTrackingParams(t *testing.T) {
+	for _, ti := range []struct {
+		msg        string
+		args       []interface{}
+		requestUri string
+		query      string
+		expectUri  string
+	}{{
+		"no query",
+		nil,
+		"/foo",
+		"",
+		"/foo",
+	}, {
+		"no tracking parameters, sorted",
+		nil,
+		"/foo?b=2&a=1",
+		"a=1&b=2",
+		"/foo?a=1&b=2",
+	}, {
+		"default tracking parameters",
+		nil,
+		"/foo?utm_source=news&q=skipper&gclid=abc&UTM_Medium=mail&fbclid=def",
+		"q=skipper",
+		"/foo?q=skipper",
+	}, {
+		"only tracking parameters",
+		nil,
+		"/foo?utm_source=news&gclid=abc",
+		"",
+		"/foo",
+	}, {
+		"repeated keys keep their order, encoding preserved",
+		nil,
+		"/foo?q=b%20c&p=1&q=a&utm_campaign=x",
+		"p=1&q=b%20c&q=a",
+		"/foo?p=1&q=b%20c&q=a",
+	}, {
+		"custom parameters",
+		[]interface{}{"ref", "pk_*"},
+		"/foo?ref=home&pk_campaign=x&pk_kwd=y&page=2&referrer=z",
+		"page=2&referrer=z",
+		"/foo?page=2&referrer=z",
+	}, {
+		"encoded key",
+		nil,
+		"/foo?utm%5Fsource=news&q=1",
+		"q=1",
+		"/foo?q=1",
+	}} {
+		f, err := NewStripTrackingParams().CreateFilter(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "http://www.example.org"+ti.requestUri, nil)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		req.RequestURI = ti.requestUri
+		f.Request(&filtertest.Context{FRequest: req})
+
+		if req.URL.RawQuery != ti.query {
+			t.Error(ti.msg, "invalid query", req.URL.RawQuery, ti.query)
+		}
+
+		if req.RequestURI != ti.expectUri {
+			t.Error(ti.msg, "invalid request uri", req.RequestURI, ti.expectUri)
+		}
+	}
+}
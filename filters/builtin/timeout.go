@@ -0,0 +1,125 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"time"
+)
+
+type timeoutType int
+
+const (
+	backendTimeout timeoutType = iota
+	dialTimeout
+	responseHeaderTimeout
+)
+
+type timeout struct {
+	typ     timeoutType
+	timeout time.Duration
+}
+
+// Returns a filter specification whose instances set the total timeout
+// of the backend requests of the route, including the streaming of the
+// response body, overriding the default of the proxy. When the timeout
+// expires before the response headers were received, the proxy
+// responds with 504 Gateway Timeout, otherwise the response is
+// aborted.
+//
+// Instances expect one parameter, the timeout in milliseconds or as a
+// duration string, e.g.:
+//
+//     backendTimeout("2s")
+//
+// Name: "backendTimeout".
+func NewBackendTimeout() filters.Spec { return &timeout{typ: backendTimeout} }
+
+// Returns a filter specification whose instances set the timeout of
+// establishing the backend connections of the route, overriding the
+// default of the proxy, e.g.:
+//
+//     dialTimeout("300ms")
+//
+// Name: "dialTimeout".
+func NewDialTimeout() filters.Spec { return &timeout{typ: dialTimeout} }
+
+// Returns a filter specification whose instances set the timeout of
+// waiting for the response headers of the backend, after the request
+// was sent, overriding the default of the proxy, e.g.:
+//
+//     responseHeaderTimeout("500ms")
+//
+// Name: "responseHeaderTimeout".
+func NewResponseHeaderTimeout() filters.Spec { return &timeout{typ: responseHeaderTimeout} }
+
+// "backendTimeout", "dialTimeout" or "responseHeaderTimeout"
+func (spec *timeout) Name() string {
+	switch spec.typ {
+	case dialTimeout:
+		return DialTimeoutName
+	case responseHeaderTimeout:
+		return ResponseHeaderTimeoutName
+	default:
+		return BackendTimeoutName
+	}
+}
+
+func (spec *timeout) Description() string {
+	switch spec.typ {
+	case dialTimeout:
+		return "Sets the timeout of establishing the backend connections of the route."
+	case responseHeaderTimeout:
+		return "Sets the timeout of waiting for the backend response headers."
+	default:
+		return "Sets the total timeout of the backend requests of the route."
+	}
+}
+
+func (spec *timeout) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "timeout", Type: filters.DurationType}}
+}
+
+func (spec *timeout) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	d, ok := filters.DurationArg(config[0])
+	if !ok || d <= 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &timeout{typ: spec.typ, timeout: d}, nil
+}
+
+// Sets the timeout in the state bag, keeping the ones set by the other
+// timeout filters.
+func (f *timeout) Request(ctx filters.FilterContext) {
+	t, _ := ctx.StateBag()[filters.BackendTimeoutsKey].(filters.BackendTimeouts)
+	switch f.typ {
+	case dialTimeout:
+		t.Dial = f.timeout
+	case responseHeaderTimeout:
+		t.ResponseHeader = f.timeout
+	default:
+		t.Total = f.timeout
+	}
+
+	ctx.StateBag()[filters.BackendTimeoutsKey] = t
+}
+
+// Noop.
+func (f *timeout) Response(filters.FilterContext) {}
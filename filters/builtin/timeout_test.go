@@ -0,0 +1,62 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"foo"},
+		{"-1s"},
+		{float64(0)},
+		{"1s", "2s"},
+	} {
+		if _, err := NewBackendTimeout().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestTimeoutsCombined(t *testing.T) {
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	for _, ti := range []struct {
+		spec filters.Spec
+		arg  interface{}
+	}{
+		{NewBackendTimeout(), "2s"},
+		{NewDialTimeout(), float64(300)},
+		{NewResponseHeaderTimeout(), "500ms"},
+	} {
+		f, err := ti.spec.CreateFilter([]interface{}{ti.arg})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Request(ctx)
+	}
+
+	if to := ctx.FStateBag[filters.BackendTimeoutsKey]; to != (filters.BackendTimeouts{
+		Dial:           300 * time.Millisecond,
+		ResponseHeader: 500 * time.Millisecond,
+		Total:          2 * time.Second}) {
+		t.Error("failed to set the timeouts", to)
+	}
+}
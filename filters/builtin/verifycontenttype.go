@@ -0,0 +1,241 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"bytes"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// the maximum number of bytes read from the request body to verify it
+const verifyContentTypeSniffLen = 512
+
+// the kinds of content verified by the filter
+const (
+	verifyJSON      = "json"
+	verifyXML       = "xml"
+	verifyMultipart = "multipart"
+)
+
+type verifyContentType struct {
+	kinds map[string]bool
+}
+
+// Returns a filter specification whose instances verify that the
+// leading bytes of the request body match the declared Content-Type,
+// and reject the mismatching requests with 400 Bad Request, before
+// they reach the backend. This blocks the content type confusion
+// attacks, where a backend parses the body differently than the
+// security controls in front of it expect:
+//
+// - json: for application/json and the +json types, the body needs to
+// start with { or [, after the optional whitespace and byte order mark.
+//
+// - xml: for application/xml, text/xml and the +xml types, the body
+// needs to start with <, after the optional whitespace and byte order
+// mark.
+//
+// - multipart: for the multipart types, the boundary parameter needs to
+// be set, and the body needs to contain the boundary in its first 512
+// bytes.
+//
+// Instances accept the kinds of content to verify as optional
+// arguments. Without arguments, all of them are verified. The requests
+// without body, or without a Content-Type, or with a different type,
+// are not checked, while the requests with an invalid Content-Type are
+// rejected. The read bytes are forwarded to the backend unchanged.
+// E.g.:
+//
+//     verifyContentType("json", "multipart")
+//
+// Name: "verifyContentType".
+func NewVerifyContentType() filters.Spec { return &verifyContentType{} }
+
+// "verifyContentType"
+func (spec *verifyContentType) Name() string { return VerifyContentTypeName }
+
+func (spec *verifyContentType) Description() string {
+	return "Rejects the requests whose body doesn't match the declared Content-Type."
+}
+
+func (spec *verifyContentType) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "kind", Type: filters.StringType, Optional: true, Variadic: true},
+	}
+}
+
+func (spec *verifyContentType) CreateFilter(config []interface{}) (filters.Filter, error) {
+	kinds := make(map[string]bool)
+	if len(config) == 0 {
+		config = []interface{}{verifyJSON, verifyXML, verifyMultipart}
+	}
+
+	for _, c := range config {
+		k, ok := c.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch k {
+		case verifyJSON, verifyXML, verifyMultipart:
+			kinds[k] = true
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &verifyContentType{kinds: kinds}, nil
+}
+
+// returns the kind of content to verify for a media type, or empty
+// string when it is not verified
+func (f *verifyContentType) kind(mediaType string) string {
+	var k string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		k = verifyJSON
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		k = verifyXML
+	case strings.HasPrefix(mediaType, "multipart/"):
+		k = verifyMultipart
+	}
+
+	if !f.kinds[k] {
+		return ""
+	}
+
+	return k
+}
+
+// returns the first byte of the body after the byte order mark and the
+// whitespace, or false if it's not in the sniffed bytes
+func firstContentByte(b []byte) (byte, bool) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	return b[0], true
+}
+
+// tells whether the sniffed bytes are enough to verify the body, or
+// whether more need to be read
+func sniffComplete(kind string, b []byte, boundary string) bool {
+	if kind == verifyMultipart {
+		return bytes.Contains(b, []byte("--"+boundary))
+	}
+
+	_, ok := firstContentByte(b)
+	return ok
+}
+
+// tells whether the sniffed bytes match the kind of content
+func sniffMatches(kind string, b []byte, boundary string) bool {
+	if kind == verifyMultipart {
+		return boundary != "" && bytes.Contains(b, []byte("--"+boundary))
+	}
+
+	c, ok := firstContentByte(b)
+	if !ok {
+		return false
+	}
+
+	if kind == verifyJSON {
+		return c == '{' || c == '['
+	}
+
+	return c == '<'
+}
+
+// reads the leading bytes of the body, until they are enough to verify
+// it, or the sniffing limit is reached
+func sniffBody(body io.Reader, kind, boundary string) ([]byte, error) {
+	b := make([]byte, 0, verifyContentTypeSniffLen)
+	for len(b) < cap(b) {
+		n, err := body.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if sniffComplete(kind, b, boundary) {
+			return b, nil
+		}
+
+		if err == io.EOF {
+			return b, nil
+		}
+
+		if err != nil {
+			return b, err
+		}
+	}
+
+	return b, nil
+}
+
+func (f *verifyContentType) reject(ctx filters.FilterContext) {
+	ctx.ResponseWriter().WriteHeader(http.StatusBadRequest)
+	ctx.MarkServed()
+}
+
+// Verifies the leading bytes of the request body, and rejects the
+// request when they don't match the Content-Type.
+func (f *verifyContentType) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	if r.Body == nil || r.ContentLength == 0 {
+		return
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		f.reject(ctx)
+		return
+	}
+
+	kind := f.kind(mediaType)
+	if kind == "" {
+		return
+	}
+
+	boundary := params["boundary"]
+	if kind == verifyMultipart && boundary == "" {
+		f.reject(ctx)
+		return
+	}
+
+	// when reading the body fails, or the body of unknown length is
+	// empty, the request is left to the proxy, the same way as without
+	// the filter
+	b, err := sniffBody(r.Body, kind, boundary)
+	if err == nil && len(b) > 0 && !sniffMatches(kind, b, boundary) {
+		f.reject(ctx)
+		return
+	}
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+}
+
+// Noop.
+func (f *verifyContentType) Response(filters.FilterContext) {}
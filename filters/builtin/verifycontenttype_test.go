@@ -0,0 +1,189 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reader returning the content one byte at a time
+type byteReader struct {
+	content string
+}
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	if r.content == "" {
+		return 0, io.EOF
+	}
+
+	p[0], r.content = r.content[0], r.content[1:]
+	return 1, nil
+}
+
+func TestVerifyContentTypeInvalidConfig(t *testing.T) {
+	for _, args := range [][]interface{}{{"yaml"}, {42}, {"json", "csv"}} {
+		if _, err := NewVerifyContentType().CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestVerifyContentType(t *testing.T) {
+	for _, ti := range []struct {
+		title       string
+		args        []interface{}
+		contentType string
+		body        string
+		chunked     bool
+		rejected    bool
+	}{{
+		title:       "json object",
+		contentType: "application/json",
+		body:        `{"foo": 42}`,
+	}, {
+		title:       "json array with whitespace and bom",
+		contentType: "application/json; charset=utf-8",
+		body:        "\xef\xbb\xbf \r\n\t[1, 2]",
+	}, {
+		title:       "json suffix",
+		contentType: "application/problem+json",
+		body:        `{"status": 400}`,
+	}, {
+		title:       "json mismatch",
+		contentType: "application/json",
+		body:        `<foo/>`,
+		rejected:    true,
+	}, {
+		title:       "json form confusion",
+		contentType: "application/json",
+		body:        "foo=bar&baz=qux",
+		rejected:    true,
+	}, {
+		title:       "only whitespace",
+		contentType: "application/json",
+		body:        "   ",
+		rejected:    true,
+	}, {
+		title:       "xml",
+		contentType: "text/xml",
+		body:        `<?xml version="1.0"?><foo/>`,
+	}, {
+		title:       "xml mismatch",
+		contentType: "application/soap+xml",
+		body:        `{"foo": 42}`,
+		rejected:    true,
+	}, {
+		title:       "multipart",
+		contentType: "multipart/form-data; boundary=xyz",
+		body:        "--xyz\r\nContent-Disposition: form-data; name=\"foo\"\r\n\r\nbar\r\n--xyz--\r\n",
+	}, {
+		title:       "multipart without boundary",
+		contentType: "multipart/form-data",
+		body:        "--xyz\r\n",
+		rejected:    true,
+	}, {
+		title:       "multipart boundary missing from body",
+		contentType: "multipart/form-data; boundary=xyz",
+		body:        `{"foo": 42}`,
+		rejected:    true,
+	}, {
+		title:       "invalid content type",
+		contentType: "application/json; =",
+		body:        `{"foo": 42}`,
+		rejected:    true,
+	}, {
+		title:       "other type",
+		contentType: "text/plain",
+		body:        "foo",
+	}, {
+		title: "no content type",
+		body:  "foo",
+	}, {
+		title:       "not verified kind",
+		args:        []interface{}{"xml"},
+		contentType: "application/json",
+		body:        "foo",
+	}, {
+		title:       "chunked",
+		contentType: "application/json",
+		body:        `   {"foo": 42}`,
+		chunked:     true,
+	}, {
+		title:       "chunked mismatch",
+		contentType: "application/json",
+		body:        "   foo",
+		chunked:     true,
+		rejected:    true,
+	}, {
+		title:       "chunked empty",
+		contentType: "application/json",
+		chunked:     true,
+	}} {
+		var body io.Reader = strings.NewReader(ti.body)
+		if ti.chunked {
+			body = &byteReader{ti.body}
+		}
+
+		r, err := http.NewRequest("POST", "https://www.example.org", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ti.chunked {
+			r.ContentLength = -1
+		}
+
+		if ti.contentType != "" {
+			r.Header.Set("Content-Type", ti.contentType)
+		}
+
+		f, err := NewVerifyContentType().CreateFilter(ti.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: r, FResponseWriter: w}
+		f.Request(ctx)
+		if ctx.FServed != ti.rejected {
+			t.Error(ti.title, "invalid verification", ctx.FServed)
+			continue
+		}
+
+		if ti.rejected {
+			if w.Code != http.StatusBadRequest {
+				t.Error(ti.title, "invalid status", w.Code)
+			}
+
+			continue
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		if string(b) != ti.body {
+			t.Error(ti.title, "failed to preserve the body", string(b))
+		}
+	}
+}
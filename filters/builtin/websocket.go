@@ -0,0 +1,172 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type websocketOrigin struct {
+	origins map[string]bool
+}
+
+type websocketLimits struct {
+	limits filters.UpgradeLimits
+}
+
+// tells whether a request is a websocket upgrade request
+func isWebsocketUpgrade(r *http.Request) bool {
+	for _, u := range strings.Split(r.Header.Get("Upgrade"), ",") {
+		if strings.EqualFold(strings.TrimSpace(u), "websocket") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a filter specification whose instances reject the websocket
+// upgrade requests, whose Origin header is not in the allowed list, with
+// 403 Forbidden. Other requests are not affected. The filters run in the
+// pre-auth phase, before the route specific filters.
+//
+// Instances expect one or more parameters, the allowed origins, e.g.:
+//
+//     websocketOrigin("https://www.example.org", "https://app.example.org")
+//
+// Name: "websocketOrigin".
+func NewWebsocketOrigin() filters.Spec { return &websocketOrigin{} }
+
+// "websocketOrigin"
+func (spec *websocketOrigin) Name() string { return WebsocketOriginName }
+
+func (spec *websocketOrigin) Description() string {
+	return "Rejects the websocket upgrade requests from origins that are not allowed."
+}
+
+func (spec *websocketOrigin) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "origin", Type: filters.StringType, Variadic: true},
+	}
+}
+
+// Admission control, runs before authentication.
+func (spec *websocketOrigin) Phase() filters.Phase { return filters.PhasePreAuth }
+
+func (spec *websocketOrigin) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &websocketOrigin{origins: make(map[string]bool)}
+	for _, c := range config {
+		o, ok := c.(string)
+		if !ok || o == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.origins[strings.ToLower(o)] = true
+	}
+
+	return f, nil
+}
+
+// Rejects the websocket upgrade requests from origins that are not
+// allowed, and marks them served.
+func (f *websocketOrigin) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	if !isWebsocketUpgrade(r) || f.origins[strings.ToLower(r.Header.Get("Origin"))] {
+		return
+	}
+
+	w := ctx.ResponseWriter()
+	w.WriteHeader(http.StatusForbidden)
+	ctx.MarkServed()
+}
+
+// Noop.
+func (f *websocketOrigin) Response(filters.FilterContext) {}
+
+// Returns a filter specification whose instances set the limits of the
+// upgraded, e.g. websocket, connections of the route.
+//
+// Instances expect pairs of parameters, the name and the value of the
+// limit:
+//
+//     lifetime    - the maximum lifetime of the connection in milliseconds
+//     bandwidth   - the maximum bandwidth of the connection in bytes per
+//                   second, applied separately in both directions
+//     connections - the maximum number of the concurrent upgraded
+//                   connections of the route, the proxy rejects the
+//                   upgrade requests above it with 503
+//
+// E.g.:
+//
+//     websocketLimits("lifetime", 3600000, "bandwidth", 65536, "connections", 1000)
+//
+// Name: "websocketLimits".
+func NewWebsocketLimits() filters.Spec { return &websocketLimits{} }
+
+// "websocketLimits"
+func (spec *websocketLimits) Name() string { return WebsocketLimitsName }
+
+func (spec *websocketLimits) Description() string {
+	return "Sets the limits of the upgraded, e.g. websocket, connections of the route."
+}
+
+func (spec *websocketLimits) Signature() string { return "name string, value number, ..." }
+
+func (spec *websocketLimits) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 || len(config)%2 != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &websocketLimits{}
+	for i := 0; i < len(config); i += 2 {
+		name, ok := config[i].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		value, ok := config[i+1].(float64)
+		if !ok || value <= 0 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch name {
+		case "lifetime":
+			f.limits.MaxLifetime = time.Duration(value) * time.Millisecond
+		case "bandwidth":
+			f.limits.MaxBandwidth = int64(value)
+		case "connections":
+			f.limits.MaxConnections = int(value)
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return f, nil
+}
+
+// Sets the limits in the state bag.
+func (f *websocketLimits) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.UpgradeLimitsKey] = f.limits
+}
+
+// Noop.
+func (f *websocketLimits) Response(filters.FilterContext) {}
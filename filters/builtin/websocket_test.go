@@ -0,0 +1,131 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebsocketOriginInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{""},
+		{float64(42)},
+	} {
+		if _, err := NewWebsocketOrigin().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestWebsocketOrigin(t *testing.T) {
+	f, err := NewWebsocketOrigin().CreateFilter([]interface{}{"https://www.example.org"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ti := range []struct {
+		msg     string
+		upgrade string
+		origin  string
+		served  bool
+	}{{
+		"not an upgrade",
+		"",
+		"https://evil.example.org",
+		false,
+	}, {
+		"allowed origin",
+		"websocket",
+		"https://www.example.org",
+		false,
+	}, {
+		"allowed origin, case insensitive",
+		"WebSocket",
+		"https://WWW.example.org",
+		false,
+	}, {
+		"missing origin",
+		"websocket",
+		"",
+		true,
+	}, {
+		"not allowed origin",
+		"websocket",
+		"https://evil.example.org",
+		true,
+	}} {
+		req, err := http.NewRequest("GET", "https://www.example.org/socket", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if ti.upgrade != "" {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", ti.upgrade)
+		}
+
+		if ti.origin != "" {
+			req.Header.Set("Origin", ti.origin)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: req, FResponseWriter: w}
+		f.Request(ctx)
+		if ctx.Served() != ti.served || ti.served && w.Code != http.StatusForbidden {
+			t.Error(ti.msg, "failed to check origin", ctx.Served(), w.Code)
+		}
+	}
+}
+
+func TestWebsocketLimitsInvalidConfig(t *testing.T) {
+	for _, config := range [][]interface{}{
+		nil,
+		{"lifetime"},
+		{"lifetime", "1000"},
+		{"lifetime", float64(0)},
+		{"bandwidth", float64(-1)},
+		{"messageSize", float64(1024)},
+	} {
+		if _, err := NewWebsocketLimits().CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestWebsocketLimits(t *testing.T) {
+	f, err := NewWebsocketLimits().CreateFilter([]interface{}{
+		"lifetime", float64(60000),
+		"bandwidth", float64(1024),
+		"connections", float64(100)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	l, ok := ctx.StateBag()[filters.UpgradeLimitsKey].(filters.UpgradeLimits)
+	if !ok || l.MaxLifetime != time.Minute || l.MaxBandwidth != 1024 || l.MaxConnections != 100 {
+		t.Error("failed to set the limits", l)
+	}
+}
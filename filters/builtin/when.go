@@ -0,0 +1,143 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+)
+
+type whenSpec struct {
+	registry filters.Registry
+}
+
+type when struct {
+	match   func(*http.Request) bool
+	filters []filters.Filter
+}
+
+// Returns a filter specification whose instances apply a chain of inner
+// filters only to the requests matching a predicate expression. It
+// allows varying a few filters of a route without splitting it into
+// multiple routes. The inner filters are created using the provided
+// registry.
+//
+// Instances expect the predicate expression, in the same syntax as the
+// conditions of a route, and the inner filter chain, e.g.:
+//
+//     when(`Method("POST") && Header("X-Debug", "true")`,
+//          `requestHeader("X-Trace", "on") -> responseHeader("X-Traced", "true")`)
+//
+// The condition is evaluated once per request, and the inner filters
+// are applied to the response only when they were applied to the
+// request. Templates cannot be referenced in the expression.
+//
+// Name: "when".
+func NewWhen(registry filters.Registry) filters.Spec {
+	return &whenSpec{registry}
+}
+
+// "when"
+func (spec *whenSpec) Name() string { return WhenName }
+
+func (spec *whenSpec) Description() string {
+	return "Applies a chain of inner filters to the requests matching a predicate expression."
+}
+
+func (spec *whenSpec) Signature() string { return "predicate string, filters string" }
+
+func (spec *whenSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	expression, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	chain, ok := config[1].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	e, err := eskip.ParsePredicateExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := routing.CompileExpression(e)
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := eskip.ParseFilters(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(defs) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &when{match: match}
+	for _, d := range defs {
+		innerSpec, ok := spec.registry[d.Name]
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		inner, err := innerSpec.CreateFilter(d.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		f.filters = append(f.filters, inner)
+	}
+
+	return f, nil
+}
+
+// Applies the inner filters to the matching requests, until one of
+// them marks the request as served.
+func (f *when) Request(ctx filters.FilterContext) {
+	matched := f.match(ctx.Request())
+	ctx.FilterState(f)["matched"] = matched
+	if !matched {
+		return
+	}
+
+	for _, fi := range f.filters {
+		if ctx.Served() {
+			return
+		}
+
+		fi.Request(ctx)
+	}
+}
+
+// Applies the inner filters to the response in reverse order, when the
+// request matched the condition.
+func (f *when) Response(ctx filters.FilterContext) {
+	if matched, _ := ctx.FilterState(f)["matched"].(bool); !matched {
+		return
+	}
+
+	for i := len(f.filters) - 1; i >= 0; i-- {
+		f.filters[i].Response(ctx)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"testing"
+)
+
+func TestWhenInvalidConfig(t *testing.T) {
+	spec := NewWhen(MakeRegistry())
+	for _, config := range [][]interface{}{
+		nil,
+		{`Method("POST")`},
+		{42, `requestHeader("X-Foo", "bar")`},
+		{`Method("POST")`, 42},
+		{``, `requestHeader("X-Foo", "bar")`},
+		{`Method(`, `requestHeader("X-Foo", "bar")`},
+		{`Path("/foo/:id")`, `requestHeader("X-Foo", "bar")`},
+		{`@t && Method("POST")`, `requestHeader("X-Foo", "bar")`},
+		{`Method("POST")`, ``},
+		{`Method("POST")`, `noSuchFilter()`},
+		{`Method("POST")`, `requestHeader("X-Foo")`},
+		{`Method("POST")`, `requestHeader("X-Foo", "bar")`, "extra"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestWhen(t *testing.T) {
+	f, err := NewWhen(MakeRegistry()).CreateFilter([]interface{}{
+		`Method("POST") && (Header("X-Debug", "true") || Path("/debug"))`,
+		`requestHeader("X-Foo", "bar") -> responseHeader("X-Baz", "qux")`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		header       http.Header
+		expected     bool
+	}{{
+		method: "GET",
+		path:   "/debug",
+	}, {
+		method: "POST",
+		path:   "/foo",
+	}, {
+		method:   "POST",
+		path:     "/debug",
+		expected: true,
+	}, {
+		method:   "POST",
+		path:     "/foo",
+		header:   http.Header{"X-Debug": []string{"true"}},
+		expected: true,
+	}} {
+		req, err := http.NewRequest(test.method, "https://www.example.org"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.header != nil {
+			req.Header = test.header
+		}
+
+		rsp := &http.Response{Header: make(http.Header)}
+		ctx := &filtertest.Context{
+			FRequest:  req,
+			FResponse: rsp,
+			FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		f.Response(ctx)
+
+		if applied := req.Header.Get("X-Foo") == "bar"; applied != test.expected {
+			t.Error("unexpected request decision", test.method, test.path, applied)
+		}
+
+		if applied := rsp.Header.Get("X-Baz") == "qux"; applied != test.expected {
+			t.Error("unexpected response decision", test.method, test.path, applied)
+		}
+	}
+}
+
+func TestWhenSkipsServedRequests(t *testing.T) {
+	f, err := NewWhen(MakeRegistry()).CreateFilter([]interface{}{
+		`Any()`,
+		`requestHeader("X-Foo", "bar")`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FResponse: &http.Response{Header: make(http.Header)},
+		FStateBag: make(map[string]interface{}),
+		FServed:   true}
+	f.Request(ctx)
+	if req.Header.Get("X-Foo") != "" {
+		t.Error("failed to stop applying the filters")
+	}
+}
+
+func TestWhenInstancesKeepSeparateState(t *testing.T) {
+	spec := NewWhen(MakeRegistry())
+	post, err := spec.CreateFilter([]interface{}{`Method("POST")`, `responseHeader("X-Post", "true")`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get, err := spec.CreateFilter([]interface{}{`Method("GET")`, `responseHeader("X-Get", "true")`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp := &http.Response{Header: make(http.Header)}
+	ctx := &filtertest.Context{
+		FRequest:  req,
+		FResponse: rsp,
+		FStateBag: make(map[string]interface{})}
+	post.Request(ctx)
+	get.Request(ctx)
+	get.Response(ctx)
+	post.Response(ctx)
+
+	if rsp.Header.Get("X-Get") != "true" || rsp.Header.Get("X-Post") != "" {
+		t.Error("failed to keep the state of the instances separate", rsp.Header)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package chain implements a filter that executes an ordered chain of
+other registered filters as a single filter.
+
+Each argument of the filter is a string, containing a single filter
+expression in the eskip format, that defines an inner filter:
+
+	chain("compress()", `setResponseHeader("X-A", "1")`)
+
+The above is the same as:
+
+	compress() -> setResponseHeader("X-A", "1")
+
+The inner filters are applied to the request in the order of the
+arguments, until one of them marks the request as served, and to the
+response in reverse order, the same way as the filters of a route.
+
+The inner filters are created using the filter registry. The chain
+filter itself cannot be nested.
+*/
+package chain
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+)
+
+// Name of the chain filter.
+const Name = "chain"
+
+type spec struct {
+	registry filters.Registry
+}
+
+type chain struct {
+	filters []filters.Filter
+}
+
+// Returns a filter specification whose instances execute a chain of
+// inner filters. The inner filters are created using the provided
+// registry.
+func NewSpec(registry filters.Registry) filters.Spec {
+	return &spec{registry}
+}
+
+// "chain"
+func (s *spec) Name() string { return Name }
+
+func (s *spec) Description() string {
+	return "Executes a chain of inner filters as a single filter."
+}
+
+func (s *spec) Signature() string { return "filter string, [filter string]..." }
+
+// creates an inner filter from an argument containing a single filter
+// expression
+func (s *spec) createInner(arg interface{}) (filters.Filter, error) {
+	expression, ok := arg.(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	fs, err := eskip.ParseFilters(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fs) != 1 || fs[0].Name == Name {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	innerSpec, ok := s.registry[fs[0].Name]
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return innerSpec.CreateFilter(fs[0].Args)
+}
+
+func (s *spec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	c := &chain{}
+	for _, arg := range config {
+		inner, err := s.createInner(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		c.filters = append(c.filters, inner)
+	}
+
+	return c, nil
+}
+
+// Applies the inner filters to the request, until one of them marks
+// the request as served.
+func (c *chain) Request(ctx filters.FilterContext) {
+	for _, f := range c.filters {
+		if ctx.Served() {
+			return
+		}
+
+		f.Request(ctx)
+	}
+}
+
+// Applies the inner filters to the response in reverse order.
+func (c *chain) Response(ctx filters.FilterContext) {
+	for i := len(c.filters) - 1; i >= 0; i-- {
+		c.filters[i].Response(ctx)
+	}
+}
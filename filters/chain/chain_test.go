@@ -0,0 +1,159 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chain
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// records the calls in the X-Trace header of the request, in the form
+// of <name>:<args>:<request|response>
+type traceSpec struct {
+	name  string
+	serve bool
+}
+
+type trace struct {
+	spec *traceSpec
+	args []string
+}
+
+func (s *traceSpec) Name() string { return s.name }
+
+func (s *traceSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	f := &trace{spec: s}
+	for _, c := range config {
+		a, ok := c.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.args = append(f.args, a)
+	}
+
+	return f, nil
+}
+
+func (f *trace) record(ctx filters.FilterContext, phase string) {
+	ctx.Request().Header.Add("X-Trace", f.spec.name+":"+strings.Join(f.args, ",")+":"+phase)
+}
+
+func (f *trace) Request(ctx filters.FilterContext) {
+	f.record(ctx, "request")
+	if f.spec.serve {
+		ctx.MarkServed()
+	}
+}
+
+func (f *trace) Response(ctx filters.FilterContext) { f.record(ctx, "response") }
+
+func testRegistry() filters.Registry {
+	r := make(filters.Registry)
+	r.Register(&traceSpec{name: "a"})
+	r.Register(&traceSpec{name: "b"})
+	r.Register(&traceSpec{name: "c"})
+	r.Register(&traceSpec{name: "serve", serve: true})
+	r.Register(NewSpec(r))
+	return r
+}
+
+func apply(t *testing.T, config ...interface{}) []string {
+	f, err := NewSpec(testRegistry()).CreateFilter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FRequest: r}
+	f.Request(ctx)
+	f.Response(ctx)
+	return r.Header["X-Trace"]
+}
+
+func TestInvalidConfig(t *testing.T) {
+	spec := NewSpec(testRegistry())
+	for _, config := range [][]interface{}{
+		nil,
+		{"noSuchFilter()"},
+		{"a", "b()"},
+		{42, "a()"},
+		{`chain("a()")`},
+		{"a(42)"},
+		{"a() -> b()"},
+		{"a()", "b()", "c(42)"},
+		{"a(", "b()"},
+	} {
+		if _, err := spec.CreateFilter(config); err == nil {
+			t.Error("failed to fail", config)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	trace := apply(t, `a("X-Foo", "bar")`, "b()", `c("baz")`)
+	expected := []string{
+		"a:X-Foo,bar:request",
+		"b::request",
+		"c:baz:request",
+		"c:baz:response",
+		"b::response",
+		"a:X-Foo,bar:response",
+	}
+
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("invalid order", trace)
+	}
+}
+
+func TestSameFilterMultipleTimes(t *testing.T) {
+	trace := apply(t, `a("1")`, `a("2")`)
+	expected := []string{"a:1:request", "a:2:request", "a:2:response", "a:1:response"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("invalid order", trace)
+	}
+}
+
+func TestNestedNameIsArgument(t *testing.T) {
+	trace := apply(t, `a("chain")`)
+	expected := []string{"a:chain:request", "a:chain:response"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("invalid arguments", trace)
+	}
+}
+
+func TestFilterNameIsArgument(t *testing.T) {
+	trace := apply(t, `a("b", "c")`, `b("a")`)
+	expected := []string{"a:b,c:request", "b:a:request", "b:a:response", "a:b,c:response"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("invalid arguments", trace)
+	}
+}
+
+func TestStopsWhenServed(t *testing.T) {
+	trace := apply(t, "a()", "serve()", "b()")
+	expected := []string{"a::request", "serve::request", "b::response", "serve::response", "a::response"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Error("invalid order", trace)
+	}
+}
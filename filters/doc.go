@@ -44,6 +44,47 @@ their position in the route definition, and once for the response in reverse
 order.
 
 
+Filter Phases
+
+Filter specifications can implement the PhasedSpec interface, to place their
+filters in an earlier phase than the route specific filters: PhasePreAuth,
+PhaseAuth or PhasePostAuth. When the routes are processed, the filters are
+ordered by their phase, and only the filters of the same phase keep the order
+of their position in the route definition. This way, e.g. an authentication
+filter always runs before the filters that read the request body, even when
+a route lists it later.
+
+
+Argument Schemas
+
+Filter specifications can implement the SpecWithSchema interface, to declare
+the names, the types and the optionality of the arguments of their filters.
+When the routes are processed, the arguments are validated against the schema
+before the filters are created, and invalid routes are rejected with a precise
+error, e.g. "deadline: arg 1 must be duration, got bool". The schemas are also
+used to document the filters, e.g. by skipper -list-filters.
+
+
+Response Trailers
+
+The trailers received from the backend are available to the response filters
+in the Trailer field of the response, with their keys only, since their
+values arrive after the body. Filters can add trailers by setting them in
+this field, allocating it when it is nil. The proxy sends the trailers to the
+client after the body, e.g. for gRPC-web bridging.
+
+
+Streaming Body Transformation
+
+Response filters can rewrite the response body without buffering it, by
+replacing it with a stream wrapping the original body, with the
+TransformResponseBody function. The transformation happens while the proxy
+copies the body to the client, and, since the length of the body may
+change, the Content-Length header is removed. Multiple filters can chain
+their transformations. The rewriteResponseBody filter uses this to replace
+the matches of a regular expression in the response body.
+
+
 Handling Requests with Filters
 
 Filters can handle the requests themselves, meaning that they can set the
@@ -2,7 +2,14 @@ package filters
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Context object providing state and information that is unique to a request.
@@ -39,7 +46,9 @@ type FilterContext interface {
 	Served() bool
 
 	// Marks a request served. Used by filters that handle the requests
-	// themselves.
+	// themselves. When a request is marked served by a request filter,
+	// the rest of the request filters, the backend roundtrip and the
+	// response filters are skipped.
 	MarkServed()
 
 	// Provides the wildcard parameter values from the request path by their
@@ -50,9 +59,70 @@ type FilterContext interface {
 	// the filters in the route.
 	StateBag() map[string]interface{}
 
+	// Provides a read-write state map, unique to a request and to the
+	// filter instance passed in, typically the calling filter itself.
+	// Unlike the keys of the state bag, the state of one instance
+	// cannot collide with the state of another instance of the same
+	// filter in the route, or with the state of the filters wrapped by
+	// a composite filter. The filter instance is used as a map key, so
+	// it needs to be comparable, e.g. a pointer.
+	FilterState(Filter) map[string]interface{}
+
 	// Gives filters access to the backend url specified in the route or an empty
 	// value in case it's a shunt
 	BackendUrl() string
+
+	// Provides the deadline of the current phase of the request, the
+	// request filters or the response filters, as configured in the
+	// proxy. Filters that wait, e.g. for a lookup or a remote call,
+	// should give up, when the channel returned by Done is closed, so
+	// that a single slow filter cannot consume the time budget of the
+	// whole route.
+	Context() Context
+}
+
+// Carries the deadline of a processing phase of a request. Its methods
+// match the ones of context.Context in the later Go versions.
+type Context interface {
+
+	// Returns the time when the phase expires, or false, when the
+	// phase has no deadline.
+	Deadline() (deadline time.Time, ok bool)
+
+	// Returns a channel that is closed when the phase expired, or nil,
+	// when the phase has no deadline.
+	Done() <-chan struct{}
+
+	// Returns ErrDeadlineExceeded after Done is closed, otherwise nil.
+	Err() error
+}
+
+type background struct{}
+
+func (background) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (background) Done() <-chan struct{}       { return nil }
+func (background) Err() error                  { return nil }
+
+// Context without a deadline, that is never done.
+var Background Context = background{}
+
+// Returned by Context.Err, when the deadline of the phase expired.
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+// Time budgets of the processing phases of a request. The zero fields
+// mean no budget.
+type PhaseTimeouts struct {
+
+	// The budget of running all the request filters of a route.
+	RequestFilters time.Duration
+
+	// The budget of the backend request, including the retries. When
+	// the total timeout of the backend request is not set, or it is
+	// longer, the remaining budget is used as the total timeout.
+	Backend time.Duration
+
+	// The budget of running all the response filters of a route.
+	ResponseFilters time.Duration
 }
 
 // Filters are created by the Spec components, optionally using filter
@@ -83,13 +153,595 @@ type Spec interface {
 	CreateFilter(config []interface{}) (Filter, error)
 }
 
-// Registry used to lookup Spec objects while initializing routes.
+// The phase of a filter determines its position in the filter chain of
+// the routes. The filters in an earlier phase run before the filters in
+// a later phase, regardless of their position in the route definition.
+type Phase int
+
+const (
+
+	// Filters that need to run before authentication, e.g. admission
+	// control.
+	PhasePreAuth Phase = iota
+
+	// Authentication and authorization filters.
+	PhaseAuth
+
+	// Filters that need to run right after authentication, before the
+	// route specific filters.
+	PhasePostAuth
+
+	// The default phase, of the filters whose specification doesn't
+	// implement PhasedSpec. The filters in this phase run in the order
+	// of their position in the route definition.
+	PhaseRoute
+)
+
+// Optional interface for filter specifications, whose filters need to
+// run in a fixed phase, e.g. security filters that must run before any
+// body reading filter defined by the route.
+type PhasedSpec interface {
+	Spec
+
+	// The phase of the filters created by the specification.
+	Phase() Phase
+}
+
+// Optional interface for filter specifications, that describe the
+// parameters expected by their filters, e.g. for listing the filters
+// supported by a skipper build.
+type SignatureSpec interface {
+	Spec
+
+	// The expected parameters, e.g. "code number, location string".
+	// Optional parameters are in brackets, and repeated ones are
+	// followed by "...".
+	Signature() string
+}
+
+// Optional interface for filter specifications, that describe the
+// effect of their filters, e.g. for generating the documentation of
+// the routes.
+type DescribedSpec interface {
+	Spec
+
+	// A short, one sentence description of the filters, e.g. "Responds
+	// with a redirect to a location."
+	Description() string
+}
+
+// Registry used to lookup Spec objects while initializing routes. The
+// keys are the names used in the route definitions, that are either the
+// names of the specifications, or their aliases.
 type Registry map[string]Spec
 
+// Describes a registered filter specification.
+type SpecInfo struct {
+
+	// The name of the specification.
+	Name string
+
+	// The alternative names registered for the specification, e.g.
+	// old names kept for backward compatibility.
+	Aliases []string
+
+	// The expected parameters, when the specification implements
+	// SignatureSpec or SpecWithSchema.
+	Signature string
+
+	// The declared arguments, when the specification implements
+	// SpecWithSchema.
+	Args []Arg
+
+	// The description of the filters, when the specification
+	// implements DescribedSpec.
+	Description string
+}
+
+// State bag key, where the proxy stores the time when the request was
+// received, as a time.Time value.
+const RequestStartKey = "filters:requestStart"
+
+// State bag key, where the proxy stores the id of the route matching the
+// request, as a string value.
+const RouteIdKey = "filters:routeId"
+
+// State bag key, where filters can set a backend address, as a string
+// value in the form of scheme://host, that the proxy forwards the
+// request to instead of the backend of the route. It has no effect in
+// shunt and loopback routes. The routes with a dynamic backend need it,
+// or both the scheme and the host overrides below.
+const BackendUrlKey = "filters:backendUrl"
+
+// State bag key, where filters can set the scheme, http, https, h2c or
+// grpc, used for the backend request, as a string value, overriding the
+// scheme of the backend address.
+const BackendSchemeKey = "filters:backendScheme"
+
+// State bag key, where filters can set a BackendObserver, that the proxy
+// calls with the result of every backend request of the route,
+// including the retried ones.
+const BackendObserverKey = "filters:backendObserver"
+
+// Receives the result of a backend request: the response, or the error,
+// e.g. a connection error, when the request failed. It must not read or
+// close the response body.
+type BackendObserver func(*http.Response, error)
+
+// State bag key, where filters can set the protocol of the backend
+// request, "http1" or "http2", as a string value, overriding the
+// protocol selected by the scheme of the backend address. With http2,
+// the https backends are requested over HTTP/2 with TLS, and the http
+// backends over cleartext HTTP/2 (h2c), without an upgrade.
+const BackendProtocolKey = "filters:backendProtocol"
+
+// State bag key, where filters can set the network address, host or
+// host:port, that the backend request is sent to, as a string value,
+// overriding the host of the backend address. The Host header of the
+// request is not affected.
+const BackendHostKey = "filters:backendHost"
+
+// State bag key, where filters can set the TLS server name of the
+// backend connections, as a string value. It is sent as SNI, and it is
+// used to verify the certificate of the backend, instead of the backend
+// host. The requests with different server names use different
+// connection pools.
+const TlsServerNameKey = "filters:tlsServerName"
+
+// State bag key, where filters can set the socket options of the backend
+// connections, as a SocketOptions value. The requests with different
+// socket options use different connection pools.
+const SocketOptionsKey = "filters:socketOptions"
+
+// Socket options of the backend connections.
+type SocketOptions struct {
+
+	// The DSCP value, 0-63, set in the traffic class field of the IP
+	// packets. Zero leaves the system default.
+	DSCP int
+
+	// When set, Nagle's algorithm is enabled, i.e. TCP_NODELAY is not
+	// set on the connections.
+	DisableNoDelay bool
+}
+
+// State bag key, where filters can set the timeouts of the backend
+// requests of a route, as a BackendTimeouts value. The zero fields leave
+// the defaults of the proxy. The requests with different dial or
+// response header timeouts use different connection pools.
+const BackendTimeoutsKey = "filters:backendTimeouts"
+
+// Timeouts of the backend requests.
+type BackendTimeouts struct {
+
+	// The timeout of establishing a backend connection.
+	Dial time.Duration
+
+	// The timeout of waiting for the response headers, after the
+	// request was sent.
+	ResponseHeader time.Duration
+
+	// The timeout of the whole backend request, including the
+	// streaming of the response body.
+	Total time.Duration
+}
+
+// State bag key, where filters can set the path template of the route,
+// e.g. /users/:id, as a string value. The proxy uses it in the metrics
+// and the access log instead of the raw path. When not set, the path
+// condition of the route is used.
+const PathTemplateKey = "filters:pathTemplate"
+
+// State bag key, where the classify filter sets the category of the
+// request as a string value. The proxy reports it in the metrics and the
+// access log.
+const CategoryKey = "filters:category"
+
+// State bag key, where filters can set the limits of the connections
+// upgraded by the proxy, e.g. websocket connections, as an UpgradeLimits
+// value.
+const UpgradeLimitsKey = "filters:upgradeLimits"
+
+// Limits of an upgraded connection.
+type UpgradeLimits struct {
+
+	// The maximum lifetime of the connection, after which it is
+	// closed. Zero means no limit.
+	MaxLifetime time.Duration
+
+	// The maximum bandwidth of the connection, in bytes per second,
+	// applied separately in both directions. Zero means no limit.
+	MaxBandwidth int64
+
+	// The maximum number of the concurrent upgraded connections of the
+	// route. The upgrade requests exceeding it are rejected. Zero
+	// means no limit.
+	MaxConnections int
+}
+
+// The resource budget of the filters of a sandboxed route, per request.
+type SandboxLimits struct {
+
+	// The total time that the sandboxed filters may spend processing a
+	// request and its response. Zero means no limit.
+	FilterTime time.Duration
+
+	// The number of bytes that the filters may read from the request
+	// or the response body. Zero means no limit.
+	BodyBytes int64
+}
+
+// Implemented by the filters marking the start of the sandboxed part of
+// a filter chain, e.g. the filter inserted by the quota package into the
+// routes of the untrusted tenants. The proxy enforces the limits on the
+// filters following it, and reports the violations to it.
+type SandboxFilter interface {
+	Filter
+
+	// Returns the limits of the filters following the sandbox filter.
+	SandboxLimits() SandboxLimits
+
+	// Called by the proxy when a request exceeded the limits.
+	SandboxViolation(routeId, reason string)
+}
+
+// Transforms a body stream, e.g. rewrites its content while it is
+// copied to the client. The returned body is closed instead of the
+// original one, so it needs to close the original.
+type BodyTransformer func(io.ReadCloser) io.ReadCloser
+
+// Replaces the body of the response with the transformed stream, without
+// reading it. Since the transformation may change the length of the
+// body, the Content-Length header is removed. When called multiple
+// times, e.g. by multiple response filters, the transformations are
+// chained, and the last one receives the output of the previous ones.
+func TransformResponseBody(ctx FilterContext, t BodyTransformer) {
+	rsp := ctx.Response()
+	rsp.Body = t(rsp.Body)
+	rsp.ContentLength = -1
+	rsp.Header.Del("Content-Length")
+}
+
+// State bag key, where filters can set the maximum size of the request
+// body forwarded to the backend, in bytes, as an int64 value. When the
+// body is longer, the proxy aborts the backend request, and responds
+// with 413 Request Entity Too Large.
+const MaxRequestBodySizeKey = "filters:maxRequestBodySize"
+
+// State bag key, where filters can set the maximum size of the response
+// body sent to the client, in bytes, as an int64 value. When the
+// Content-Length of the response is larger, the proxy responds with 502
+// Bad Gateway, otherwise it aborts the stream when the limit is
+// exceeded.
+const MaxResponseBodySizeKey = "filters:maxResponseBodySize"
+
+// State bag key, where filters can set the bandwidth shared by the
+// response bodies of a route, in bytes per second, as an int64 value.
+// The proxy divides it fairly between the responses of the route
+// streamed at the same time.
+const ResponseBandwidthKey = "filters:responseBandwidth"
+
+// State bag key, where filters can set the circuit breaker applied to
+// the backend of the route, as a CircuitBreakerSettings value. It
+// overrides the default circuit breaker of the proxy.
+const CircuitBreakerKey = "filters:circuitBreaker"
+
+// The policy deciding when a circuit breaker opens.
+type BreakerType int
+
+const (
+
+	// No circuit breaker.
+	BreakerDisabled BreakerType = iota
+
+	// Opens after a number of consecutive failed requests.
+	ConsecutiveBreaker
+
+	// Opens when a number of the last requests, in a sliding window of
+	// requests, failed.
+	RateBreaker
+)
+
+// The scope of the failures counted by a circuit breaker.
+type BreakerScope int
+
+const (
+
+	// The failures are counted per backend host, shared by all the
+	// routes forwarding to it.
+	HostBreaker BreakerScope = iota
+
+	// The failures are counted per route.
+	RouteBreaker
+)
+
+// Settings of a circuit breaker.
+type CircuitBreakerSettings struct {
+	Type  BreakerType
+	Scope BreakerScope
+
+	// The number of the failed requests opening the breaker.
+	Failures int
+
+	// The number of the last requests, in which the failures are
+	// counted by the rate breaker.
+	Window int
+
+	// The time that the breaker stays open, before it lets through
+	// the probe requests.
+	Timeout time.Duration
+
+	// The number of the probe requests let through by the half-open
+	// breaker. When all of them succeed, the breaker closes.
+	HalfOpenRequests int
+}
+
+// State bag key, where filters can set the load balancer of the backend
+// of the route, as a LoadBalancerSettings value. The proxy forwards the
+// request to one of the members of the load balancer, instead of the
+// backend of the route.
+const LoadBalancerKey = "filters:loadBalancer"
+
+// The algorithm selecting the member of a load balancer receiving a
+// request.
+type LoadBalancerAlgorithm int
+
+const (
+
+	// Selects the members in turns.
+	RoundRobin LoadBalancerAlgorithm = iota
+
+	// Selects two random members, and takes the one with less backend
+	// requests in progress.
+	PowerOfTwoChoices
+)
+
+// Settings of a load balancer.
+type LoadBalancerSettings struct {
+	Algorithm LoadBalancerAlgorithm
+
+	// The backend addresses of the members, in the form of
+	// scheme://host. When the host of a member is a DNS name, it is
+	// resolved periodically, and each of its IP addresses is a separate
+	// member.
+	Members []string
+
+	// When set, the members are checked periodically by the active
+	// health checks with GET requests on this path, instead of the
+	// default path of the health checks, and the members marked down
+	// are skipped.
+	HealthCheckPath string
+
+	// The number of the consecutive failed requests, connection errors
+	// or 5xx responses, ejecting a member. Defaults to 3.
+	MaxFails int
+
+	// The time that a member stays ejected after the failed requests.
+	// Defaults to 30 seconds.
+	EjectTimeout time.Duration
+}
+
+// State bag key, where filters can set the retries of the backend
+// requests of the route, as a RetrySettings value. It overrides the
+// default retries of the proxy.
+const RetryKey = "filters:retry"
+
+// Settings of the retries of the idempotent backend requests.
+type RetrySettings struct {
+
+	// The maximum number of the retries of a request. Zero disables
+	// the retries.
+	Attempts int
+
+	// The response status codes, besides the connection errors, on
+	// which the requests are retried.
+	Statuses []int
+}
+
+// Parses a comma separated list of status codes, or classes of status
+// codes, e.g. "502,503,504" or "5xx".
+func ParseStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, si := range strings.Split(s, ",") {
+		si = strings.ToLower(strings.TrimSpace(si))
+		if si == "" {
+			continue
+		}
+
+		if len(si) == 3 && si[1:] == "xx" && si[0] >= '1' && si[0] <= '5' {
+			from := int(si[0]-'0') * 100
+			for code := from; code < from+100; code++ {
+				codes = append(codes, code)
+			}
+
+			continue
+		}
+
+		code, err := strconv.Atoi(si)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code: %s", si)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// State bag key, where the extract filter stores the values extracted
+// from the request, as a map[string]string value.
+const ExtractedValuesKey = "filters:extractedValues"
+
+// State bag key, where the jwtValidation filter stores the claims of the
+// validated token, as a map[string]interface{} value.
+const JwtClaimsKey = "filters:jwtClaims"
+
+var templatePlaceholder = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z0-9_-]+)*)\}`)
+
+// returns the value of a template placeholder
+func templateValue(ctx FilterContext, name string) (string, bool) {
+	r := ctx.Request()
+	switch {
+	case strings.HasPrefix(name, "request.") && r == nil:
+		return "", false
+	case name == "request.host":
+		return r.Host, true
+	case name == "request.method":
+		return r.Method, true
+	case name == "request.path":
+		return r.URL.Path, true
+	case name == "request.query":
+		return r.URL.RawQuery, true
+	case strings.HasPrefix(name, "request.header."):
+		return r.Header.Get(strings.TrimPrefix(name, "request.header.")), true
+	case strings.HasPrefix(name, "request.query."):
+		return r.URL.Query().Get(strings.TrimPrefix(name, "request.query.")), true
+	case strings.HasPrefix(name, "request.cookie."):
+		if c, err := r.Cookie(strings.TrimPrefix(name, "request.cookie.")); err == nil {
+			return c.Value, true
+		}
+
+		return "", true
+	case name == "route.id":
+		id, _ := ctx.StateBag()[RouteIdKey].(string)
+		return id, true
+	case name == "route.backend":
+		return ctx.BackendUrl(), true
+	}
+
+	if values, ok := ctx.StateBag()[ExtractedValuesKey].(map[string]string); ok {
+		if v, ok := values[name]; ok {
+			return v, true
+		}
+	}
+
+	if v := ctx.PathParam(name); v != "" {
+		return v, true
+	}
+
+	return "", false
+}
+
+// Substitutes the ${name} placeholders in a filter argument with values
+// from the context of the current request:
+//
+//     ${request.host}, ${request.method}, ${request.path}, ${request.query}
+//     ${request.header.<name>}, ${request.query.<name>}, ${request.cookie.<name>}
+//     ${route.id}, ${route.backend}
+//
+// The other names are substituted with the values extracted from the
+// current request by the extract filters preceding the calling filter,
+// or, when there is no such value, with the wildcard parameters of the
+// path, e.g. ${id} for Path("/users/:id"). The missing headers, query
+// parameters and cookies are substituted with empty strings, while the
+// other placeholders without a value are left unchanged.
+func ExpandTemplate(ctx FilterContext, s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	return templatePlaceholder.ReplaceAllStringFunc(s, func(p string) string {
+		if v, ok := templateValue(ctx, p[2:len(p)-1]); ok {
+			return v
+		}
+
+		return p
+	})
+}
+
 // Error used in case of invalid filter parameters.
 var ErrInvalidFilterParameters = errors.New("invalid filter parameters")
 
-// Registers a filter specification.
+// Registers a filter specification. An already registered
+// specification with the same name is replaced.
 func (r Registry) Register(s Spec) {
 	r[s.Name()] = s
 }
+
+// Registers a filter specification, and fails when the name is already
+// taken by another specification or alias.
+func (r Registry) Add(s Spec) error {
+	if _, exists := r[s.Name()]; exists {
+		return fmt.Errorf("duplicate filter name: %s", s.Name())
+	}
+
+	r[s.Name()] = s
+	return nil
+}
+
+// Registers an alternative name for an already registered filter
+// specification, e.g. to keep the routes using an old name working. It
+// fails when the name is not registered, or the alias is already taken.
+func (r Registry) Alias(alias, name string) error {
+	s, ok := r[name]
+	if !ok {
+		return fmt.Errorf("filter not found: %s", name)
+	}
+
+	if _, exists := r[alias]; exists {
+		return fmt.Errorf("duplicate filter name: %s", alias)
+	}
+
+	r[alias] = s
+	return nil
+}
+
+// Returns the registered filter specifications, ordered by their names,
+// with their aliases and signatures.
+func (r Registry) Specs() []SpecInfo {
+	aliases := make(map[string][]string)
+	for name, s := range r {
+		if name != s.Name() {
+			aliases[s.Name()] = append(aliases[s.Name()], name)
+		}
+	}
+
+	var specs []SpecInfo
+	for _, name := range r.Names() {
+		s := r[name]
+		if name != s.Name() {
+			continue
+		}
+
+		info := SpecInfo{Name: name, Aliases: aliases[name]}
+		sort.Strings(info.Aliases)
+		if ss, ok := s.(SpecWithSchema); ok {
+			info.Args = ss.Schema()
+			info.Signature = FormatSchema(info.Args)
+		}
+
+		if ss, ok := s.(SignatureSpec); ok {
+			info.Signature = ss.Signature()
+		}
+
+		if ds, ok := s.(DescribedSpec); ok {
+			info.Description = ds.Description()
+		}
+
+		specs = append(specs, info)
+	}
+
+	return specs
+}
+
+// Returns the phase of the filters created by the named specification.
+// It is PhaseRoute, unless the specification implements PhasedSpec.
+func (r Registry) Phase(name string) Phase {
+	if ps, ok := r[name].(PhasedSpec); ok {
+		return ps.Phase()
+	}
+
+	return PhaseRoute
+}
+
+// Returns the names of the registered filter specifications, e.g. to
+// validate route documents in strict mode.
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
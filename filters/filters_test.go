@@ -0,0 +1,34 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filters
+
+import "testing"
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := ParseStatusCodes("502, 4xx,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != 101 || codes[0] != 502 || codes[1] != 400 || codes[100] != 499 {
+		t.Error("failed to parse the status codes", len(codes))
+	}
+
+	for _, s := range []string{"foo", "600", "6xx", "50x"} {
+		if _, err := ParseStatusCodes(s); err == nil {
+			t.Error("failed to fail", s)
+		}
+	}
+}
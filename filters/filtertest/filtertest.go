@@ -38,7 +38,9 @@ type Context struct {
 	FServed         bool
 	FParams         map[string]string
 	FStateBag       map[string]interface{}
+	FFilterState    map[filters.Filter]map[string]interface{}
 	FBackendUrl     string
+	FContext        filters.Context
 }
 
 func (spec *Filter) Name() string                    { return spec.FilterName }
@@ -56,6 +58,28 @@ func (fc *Context) OriginalRequest() *http.Request      { return nil }
 func (fc *Context) OriginalResponse() *http.Response    { return nil }
 func (fc *Context) BackendUrl() string                  { return fc.FBackendUrl }
 
+func (fc *Context) Context() filters.Context {
+	if fc.FContext == nil {
+		return filters.Background
+	}
+
+	return fc.FContext
+}
+
+func (fc *Context) FilterState(f filters.Filter) map[string]interface{} {
+	if fc.FFilterState == nil {
+		fc.FFilterState = make(map[filters.Filter]map[string]interface{})
+	}
+
+	s, ok := fc.FFilterState[f]
+	if !ok {
+		s = make(map[string]interface{})
+		fc.FFilterState[f] = s
+	}
+
+	return s
+}
+
 func (spec *Filter) CreateFilter(config []interface{}) (filters.Filter, error) {
 	return &Filter{spec.FilterName, config}, nil
 }
@@ -67,3 +67,9 @@ func (spec *flowIdSpec) CreateFilter(fc []interface{}) (filters.Filter, error) {
 }
 
 func (spec *flowIdSpec) Name() string { return Name }
+
+func (spec *flowIdSpec) Description() string {
+	return "Sets the X-Flow-Id header of the request, generating a new flow id or reusing the incoming one."
+}
+
+func (spec *flowIdSpec) Signature() string { return "[reuse string], [length number]" }
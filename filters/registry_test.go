@@ -0,0 +1,104 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filters
+
+import "testing"
+
+type testSpec struct{ name, signature string }
+
+func (s *testSpec) Name() string                                 { return s.name }
+func (s *testSpec) Signature() string                            { return s.signature }
+func (s *testSpec) CreateFilter(_ []interface{}) (Filter, error) { return nil, nil }
+
+type noSignatureSpec struct{ name string }
+
+func (s *noSignatureSpec) Name() string                                 { return s.name }
+func (s *noSignatureSpec) CreateFilter(_ []interface{}) (Filter, error) { return nil, nil }
+
+func TestAddRejectsDuplicates(t *testing.T) {
+	r := make(Registry)
+	if err := r.Add(&testSpec{name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Add(&testSpec{name: "foo"}); err == nil {
+		t.Error("failed to reject a duplicate name")
+	}
+
+	if err := r.Alias("bar", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Add(&testSpec{name: "bar"}); err == nil {
+		t.Error("failed to reject a name taken by an alias")
+	}
+}
+
+func TestAlias(t *testing.T) {
+	r := make(Registry)
+	foo := &testSpec{name: "foo"}
+	r.Register(foo)
+	r.Register(&testSpec{name: "baz"})
+
+	if err := r.Alias("bar", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if r["bar"] != foo {
+		t.Error("failed to register the alias")
+	}
+
+	if err := r.Alias("qux", "missing"); err == nil {
+		t.Error("failed to fail on a missing filter")
+	}
+
+	if err := r.Alias("baz", "foo"); err == nil {
+		t.Error("failed to fail on a taken name")
+	}
+}
+
+func TestSpecs(t *testing.T) {
+	r := make(Registry)
+	r.Register(&testSpec{"redirect", "code number, location string"})
+	r.Register(&noSignatureSpec{"custom"})
+	r.Alias("moved", "redirect")
+	r.Alias("forward", "redirect")
+
+	specs := r.Specs()
+	if len(specs) != 2 {
+		t.Fatal("invalid number of specs", len(specs))
+	}
+
+	if specs[0].Name != "custom" || specs[0].Signature != "" || len(specs[0].Aliases) != 0 {
+		t.Error("invalid spec info", specs[0])
+	}
+
+	if specs[1].Name != "redirect" || specs[1].Signature != "code number, location string" ||
+		len(specs[1].Aliases) != 2 || specs[1].Aliases[0] != "forward" || specs[1].Aliases[1] != "moved" {
+		t.Error("invalid spec info", specs[1])
+	}
+}
+
+type describedSpec struct{ noSignatureSpec }
+
+func (s *describedSpec) Description() string { return "Does something." }
+
+func TestSpecsWithDescription(t *testing.T) {
+	r := make(Registry)
+	r.Register(&describedSpec{noSignatureSpec{"custom"}})
+	if specs := r.Specs(); specs[0].Description != "Does something." {
+		t.Error("invalid spec info", specs[0])
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The type of a filter argument, as declared by the schema of a filter
+// specification.
+type ArgType int
+
+const (
+	// Arguments of any type.
+	AnyType ArgType = iota
+
+	// String arguments.
+	StringType
+
+	// Number arguments.
+	NumberType
+
+	// Duration arguments, either numbers, taken as milliseconds, or
+	// strings in the format accepted by time.ParseDuration, e.g. "1.5s".
+	DurationType
+
+	// String arguments containing a valid regular expression.
+	RegexpType
+)
+
+// Describes a filter argument.
+type Arg struct {
+	// The name of the argument, used in the error messages and in the
+	// documentation.
+	Name string
+
+	// The type of the argument.
+	Type ArgType
+
+	// Optional arguments can be omitted. Only the arguments after the
+	// last required argument can be optional.
+	Optional bool
+
+	// The last argument of a schema can be repeated when it is
+	// variadic.
+	Variadic bool
+}
+
+// Optional interface for filter specifications, that declare the
+// arguments expected by their filters. When a specification implements
+// it, the arguments of the filters in the route definitions are
+// validated against the schema before the filters are created, and the
+// errors tell which argument is invalid, e.g.:
+//
+//     deadline: arg 1 must be duration, got string
+//
+// The schema also provides the signature of the filters, when the
+// specification doesn't implement SignatureSpec.
+type SpecWithSchema interface {
+	Spec
+
+	// The arguments of the filters.
+	Schema() []Arg
+}
+
+func (t ArgType) String() string {
+	switch t {
+	case StringType:
+		return "string"
+	case NumberType:
+		return "number"
+	case DurationType:
+		return "duration"
+	case RegexpType:
+		return "regexp"
+	default:
+		return "any"
+	}
+}
+
+func (a Arg) String() string {
+	s := a.Name
+	if a.Type != AnyType {
+		s += " " + a.Type.String()
+	}
+
+	if a.Variadic {
+		s += ", ..."
+	}
+
+	if a.Optional {
+		s = "[" + s + "]"
+	}
+
+	return s
+}
+
+// Returns the signature of the filters described by a schema, in the
+// format of SignatureSpec, e.g. "timeout duration, [header string]".
+func FormatSchema(schema []Arg) string {
+	s := make([]string, len(schema))
+	for i, a := range schema {
+		s[i] = a.String()
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func argTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case nil:
+		return "nil"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Returns the duration value of an argument, a number taken as
+// milliseconds, or a string in the format of time.ParseDuration.
+func DurationArg(v interface{}) (time.Duration, bool) {
+	switch vt := v.(type) {
+	case float64:
+		return time.Duration(vt * float64(time.Millisecond)), true
+	case string:
+		d, err := time.ParseDuration(vt)
+		return d, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func checkArg(a Arg, v interface{}) bool {
+	switch a.Type {
+	case StringType:
+		_, ok := v.(string)
+		return ok
+	case NumberType:
+		_, ok := v.(float64)
+		return ok
+	case DurationType:
+		_, ok := DurationArg(v)
+		return ok
+	case RegexpType:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+
+		_, err := regexp.Compile(s)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// Validates the arguments of a filter against a schema. The positions
+// in the error messages start from 1.
+func ValidateArgs(name string, schema []Arg, args []interface{}) error {
+	var required int
+	for _, a := range schema {
+		if !a.Optional {
+			required++
+		}
+	}
+
+	variadic := len(schema) > 0 && schema[len(schema)-1].Variadic
+	if len(args) < required {
+		return fmt.Errorf(
+			"%s: missing arg %d (%v), expected at least %d args, got %d",
+			name, len(args)+1, schema[len(args)], required, len(args))
+	}
+
+	if !variadic && len(args) > len(schema) {
+		return fmt.Errorf("%s: expected at most %d args, got %d", name, len(schema), len(args))
+	}
+
+	for i, v := range args {
+		a := schema[len(schema)-1]
+		if i < len(schema) {
+			a = schema[i]
+		}
+
+		if checkArg(a, v) {
+			continue
+		}
+
+		if a.Type == RegexpType {
+			if _, ok := v.(string); ok {
+				return fmt.Errorf("%s: arg %d must be regexp, got invalid expression: %s", name, i+1, v)
+			}
+		}
+
+		if a.Type == DurationType {
+			if _, ok := v.(string); ok {
+				return fmt.Errorf("%s: arg %d must be duration, got invalid duration: %s", name, i+1, v)
+			}
+		}
+
+		return fmt.Errorf("%s: arg %d must be %v, got %s", name, i+1, a.Type, argTypeName(v))
+	}
+
+	return nil
+}
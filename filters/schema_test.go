@@ -0,0 +1,121 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filters
+
+import (
+	"testing"
+	"time"
+)
+
+var testSchema = []Arg{
+	{Name: "timeout", Type: DurationType},
+	{Name: "expression", Type: RegexpType},
+	{Name: "rate", Type: NumberType, Optional: true},
+	{Name: "name", Type: StringType, Optional: true, Variadic: true},
+}
+
+func TestValidateArgs(t *testing.T) {
+	for _, ti := range []struct {
+		msg  string
+		args []interface{}
+		err  string
+	}{{
+		"missing args",
+		[]interface{}{"3s"},
+		"test: missing arg 2 (expression regexp), expected at least 2 args, got 1",
+	}, {
+		"invalid type",
+		[]interface{}{"3s", 42.0},
+		"test: arg 2 must be regexp, got number",
+	}, {
+		"invalid duration",
+		[]interface{}{"soon", "^/foo"},
+		"test: arg 1 must be duration, got invalid duration: soon",
+	}, {
+		"invalid expression",
+		[]interface{}{3000.0, "("},
+		"test: arg 2 must be regexp, got invalid expression: (",
+	}, {
+		"invalid optional",
+		[]interface{}{3000.0, "^/foo", "fast"},
+		"test: arg 3 must be number, got string",
+	}, {
+		"invalid variadic",
+		[]interface{}{3000.0, "^/foo", 0.5, "foo", true},
+		"test: arg 5 must be string, got bool",
+	}, {
+		"required only",
+		[]interface{}{3000.0, "^/foo"},
+		"",
+	}, {
+		"all",
+		[]interface{}{"3s", "^/foo", 0.5, "foo", "bar"},
+		"",
+	}} {
+		err := ValidateArgs("test", testSchema, ti.args)
+		if ti.err == "" && err != nil {
+			t.Error(ti.msg, err)
+		} else if ti.err != "" && (err == nil || err.Error() != ti.err) {
+			t.Error(ti.msg, "unexpected error", err)
+		}
+	}
+}
+
+func TestValidateArgsTooMany(t *testing.T) {
+	err := ValidateArgs("test", []Arg{{Name: "name", Type: StringType}}, []interface{}{"foo", "bar"})
+	if err == nil || err.Error() != "test: expected at most 1 args, got 2" {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestDurationArg(t *testing.T) {
+	for _, ti := range []struct {
+		arg      interface{}
+		duration time.Duration
+		ok       bool
+	}{
+		{1500.0, 1500 * time.Millisecond, true},
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"1500", 0, false},
+		{true, 0, false},
+	} {
+		d, ok := DurationArg(ti.arg)
+		if d != ti.duration || ok != ti.ok {
+			t.Error("unexpected duration", ti.arg, d, ok)
+		}
+	}
+}
+
+func TestFormatSchema(t *testing.T) {
+	s := FormatSchema(testSchema)
+	if s != "timeout duration, expression regexp, [rate number], [name string, ...]" {
+		t.Error("unexpected signature", s)
+	}
+}
+
+type schemaSpec struct{ name string }
+
+func (s *schemaSpec) Name() string                                 { return s.name }
+func (s *schemaSpec) Schema() []Arg                                { return testSchema[:2] }
+func (s *schemaSpec) CreateFilter(_ []interface{}) (Filter, error) { return nil, nil }
+
+func TestSpecsWithSchema(t *testing.T) {
+	r := make(Registry)
+	r.Register(&schemaSpec{"custom"})
+	specs := r.Specs()
+	if specs[0].Signature != "timeout duration, expression regexp" || len(specs[0].Args) != 2 {
+		t.Error("invalid spec info", specs[0])
+	}
+}
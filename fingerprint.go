@@ -0,0 +1,124 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"reflect"
+)
+
+// the options left out of the fingerprint, because they are secret
+var secretOptions = map[string]bool{"InnkeeperAuthToken": true, "RoutesURLHeaders": true, "ConsulToken": true, "AdminToken": true}
+
+// Identifies the active routes and the configuration of a skipper
+// instance, so that the drift between the instances of a fleet can be
+// detected, e.g. with the eskip fleet-check command.
+type Fingerprint struct {
+
+	// The version of skipper. See Version.
+	Version string `json:"version"`
+
+	// The SHA-256 hash of the active routes, in hex format.
+	Routes string `json:"routes"`
+
+	// The number of the active routes.
+	RouteCount int `json:"routeCount"`
+
+	// The version of the routing table in the instance, incremented
+	// with every update. It is expected to differ between the
+	// instances.
+	TableVersion int `json:"tableVersion"`
+
+	// The SHA-256 hash of the startup options and the capabilities of
+	// the instance, in hex format. Only the options with plain values
+	// are included, the custom implementations, e.g. the custom
+	// filters, are taken into account by their names.
+	Options string `json:"options"`
+}
+
+// writes the plain values of the options, recursing into the nested
+// structs, and skipping the fields of other kinds, e.g. interfaces
+func writeOptionValues(h hash.Hash, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.PkgPath != "" || secretOptions[f.Name] {
+			continue
+		}
+
+		name := prefix + f.Name
+		switch fv.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fmt.Fprintf(h, "%s=%v\n", name, fv.Interface())
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.String {
+				fmt.Fprintf(h, "%s=%q\n", name, fv.Interface())
+			}
+		case reflect.Struct:
+			writeOptionValues(h, name+".", fv)
+		}
+	}
+}
+
+// calculates the hash of the options and of the about document, which
+// lists the filters and the predicates, including the custom ones
+func optionsHash(o Options, a *About) string {
+	h := sha256.New()
+	writeOptionValues(h, "", reflect.ValueOf(o))
+
+	// the chaos switch can be toggled at runtime
+	a.Features.Chaos = false
+	json.NewEncoder(h).Encode(a)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the fingerprint of the handler. Before the handler is started,
+// it reports the empty routing table.
+func (h *Handler) Fingerprint() *Fingerprint {
+	f := &Fingerprint{
+		Version: Version,
+		Options: optionsHash(h.options, h.About())}
+
+	if rt := h.Routing(); rt != nil {
+		tf := rt.TableFingerprint()
+		f.Routes, f.RouteCount, f.TableVersion = tf.Hash, tf.Routes, tf.Version
+	}
+
+	return f
+}
+
+// Returns a handler responding to GET requests with the fingerprint of
+// the handler, in JSON format.
+func (h *Handler) FingerprintHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(h.Fingerprint())
+		}
+	})
+}
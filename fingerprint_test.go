@@ -0,0 +1,119 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startFingerprintHandler(t *testing.T, doc string, o Options) *Handler {
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.CustomDataClients = []routing.DataClient{dc}
+	h, err := NewHandler(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Start()
+	if !waitForStatus(h, "/ready", http.StatusFound) {
+		t.Fatal("failed to load the routes")
+	}
+
+	return h
+}
+
+func getFingerprint(t *testing.T, h *Handler) *Fingerprint {
+	r, _ := http.NewRequest("GET", "http://localhost:9911/fingerprint", nil)
+	w := httptest.NewRecorder()
+	h.FingerprintHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("failed to serve the fingerprint", w.Code)
+	}
+
+	var f Fingerprint
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	return &f
+}
+
+func TestFingerprint(t *testing.T) {
+	const (
+		routes = `
+			foo: Path("/foo") -> "https://foo.example.org";
+			ready: Path("/ready") -> redirectTo(302, "/") -> <shunt>`
+		reordered = `
+			ready: Path("/ready") -> redirectTo(302, "/") -> <shunt>;
+			foo: Path("/foo") -> "https://foo.example.org"`
+		changed = `
+			foo: Path("/foo") -> "https://bar.example.org";
+			ready: Path("/ready") -> redirectTo(302, "/") -> <shunt>`
+	)
+
+	o := Options{TrailingSlash: "redirect", SourcePollTimeout: 3 * time.Millisecond}
+	h1 := startFingerprintHandler(t, routes, o)
+	defer h1.Close()
+
+	h2 := startFingerprintHandler(t, reordered, o)
+	defer h2.Close()
+
+	h3 := startFingerprintHandler(t, changed, Options{TrailingSlash: "match", SourcePollTimeout: 3 * time.Millisecond})
+	defer h3.Close()
+
+	f1, f2, f3 := getFingerprint(t, h1), getFingerprint(t, h2), getFingerprint(t, h3)
+	if f1.Version != Version || f1.RouteCount != 2 || f1.TableVersion != 1 || f1.Routes == "" || f1.Options == "" {
+		t.Error("invalid fingerprint", f1)
+	}
+
+	if f1.Routes != f2.Routes || f1.Options != f2.Options {
+		t.Error("the fingerprints of the same configuration differ", f1, f2)
+	}
+
+	if f1.Routes == f3.Routes || f1.Options == f3.Options {
+		t.Error("failed to detect the different configuration", f1, f3)
+	}
+
+	h1.ChaosSwitch().Disable()
+	if f := getFingerprint(t, h1); f.Options != f1.Options {
+		t.Error("the chaos switch changed the options hash")
+	}
+}
+
+func TestFingerprintSecretOptions(t *testing.T) {
+	h1, err := NewHandler(Options{InnkeeperAuthToken: "secret1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2, err := NewHandler(Options{InnkeeperAuthToken: "secret2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h1.Fingerprint().Options != h2.Fingerprint().Options {
+		t.Error("the secret options changed the options hash")
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/admin"
+	"github.com/zalando/skipper/cache"
+	"github.com/zalando/skipper/chaos"
+	"github.com/zalando/skipper/cloud"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/jwt"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/quota"
+	"github.com/zalando/skipper/ratelimit"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/synthetic"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Handler is the skipper proxy, composed of the routing and the filters,
+// as a plain http.Handler, that can be embedded in other servers and
+// test harnesses. The routing starts polling the data clients, and the
+// discovery of the cloud backends starts, when Start is called, and
+// both stop when Close is called. Until started, the
+// handler responds with 503 Service Unavailable.
+type Handler struct {
+	routingOptions routing.Options
+	shadowOptions  *routing.Options
+	hostAliases    routing.HostAliases
+	tablePinning   routing.TablePinning
+	trustedProxies routing.TrustedProxies
+	options        Options
+
+	cloudBackends *cloud.Backends
+	overrides     *admin.Overrides
+	keySets       *jwt.KeySets
+	chaos         *chaos.Switch
+	healthChecks  *healthcheck.Checker
+	shutdown      chan struct{}
+	shutdownOnce  sync.Once
+
+	mx      sync.Mutex
+	routing *routing.Routing
+	shadow  *routing.Routing
+	closed  bool
+
+	proxy atomic.Value
+}
+
+// Creates a handler with the provided options. The listener, logging
+// and metrics related options are ignored, since these are set up by
+// the embedding application, or by the Run function.
+func NewHandler(o Options) (*Handler, error) {
+	if o.DefaultBackend != "" {
+		u, err := url.Parse(o.DefaultBackend)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid default backend: %s", o.DefaultBackend)
+		}
+	}
+
+	// create authentication for Innkeeper
+	auth := createInnkeeperAuthentication(o)
+
+	policy, err := createQuotaPolicy(o)
+	if err != nil {
+		return nil, err
+	}
+
+	// the temporary routes set on the admin API take precedence over
+	// the other sources
+	var overrides *admin.Overrides
+	if o.AdminToken != "" && o.AdminMutableRoutes {
+		overrides = admin.NewOverrides()
+		o.CustomDataClients = append(o.CustomDataClients[:len(o.CustomDataClients):len(o.CustomDataClients)], overrides)
+	}
+
+	// create data client
+	dataClients, err := createDataClients(o, auth, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dataClients) == 0 {
+		log.Warning("no route source specified")
+	}
+
+	// create the backends discovered in the cloud, used by the
+	// cloudBackend filter
+	discoveries, err := cloud.Parse(o.CloudBackends)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudBackends := cloud.NewBackends(discoveries, o.CloudRefreshInterval)
+
+	// the cached key sets, used by the jwtValidation filter
+	keySets := jwt.NewKeySets(o.JwksRefreshInterval)
+
+	// the global switch of the chaos experiments
+	chaosSwitch := chaos.NewSwitch(!o.ChaosDisabled)
+
+	// the synthetic checks make their internal requests through the
+	// handler itself
+	var h *Handler
+	monitor := synthetic.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+
+	// the counters of the rate limits
+	var ratelimitStore ratelimit.Store
+	if o.RatelimitRedisAddress != "" {
+		ratelimitStore = ratelimit.NewRedisStore(ratelimit.RedisOptions{Address: o.RatelimitRedisAddress})
+	} else {
+		ratelimitStore = ratelimit.NewLocalStore()
+	}
+
+	// the responses stored by the cache filter
+	cacheStore := o.CacheStore
+	if cacheStore == nil {
+		cacheStore = cache.NewLocalStore(o.CacheSize)
+	}
+
+	// closed when the proxy is shutting down, failing the health checks
+	shutdown := make(chan struct{})
+
+	// the active health checks of the backends, shared by the proxy
+	// instances and the failover filter, and served on the admin API
+	hco := o.BackendHealthCheck
+	hco.Insecure = hco.Insecure || o.ProxyOptions.Insecure()
+	healthChecks := healthcheck.New(hco)
+
+	registry, err := createRegistry(o, cloudBackends, keySets, chaosSwitch, monitor, ratelimitStore, cacheStore, policy, healthChecks, shutdown)
+	if err != nil {
+		return nil, err
+	}
+
+	predicates, err := createPredicateRegistry(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var mo routing.MatchingOptions
+	if o.IgnoreTrailingSlash {
+		mo = routing.IgnoreTrailingSlash
+	}
+
+	switch o.TrailingSlash {
+	case "", "strict":
+	case "match":
+		mo |= routing.IgnoreTrailingSlash
+	case "redirect":
+		mo |= routing.RedirectTrailingSlash
+	default:
+		return nil, fmt.Errorf("invalid trailing slash policy: %s", o.TrailingSlash)
+	}
+
+	if o.NoCanonicalization {
+		mo |= routing.NoCanonicalization
+	}
+
+	hostAliases, err := routing.ParseHostAliases(o.HostAliases)
+	if err != nil {
+		return nil, err
+	}
+
+	tablePinning, err := createTablePinning(o)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := createTrustedProxies(o)
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure a non-zero poll timeout
+	if o.SourcePollTimeout <= 0 {
+		o.SourcePollTimeout = defaultSourcePollTimeout
+	}
+
+	// check for dev mode, and set update buffer of the routes
+	updateBuffer := defaultRoutingUpdateBuffer
+	if o.DevMode {
+		updateBuffer = 0
+	}
+
+	h = &Handler{
+		routingOptions: routing.Options{
+			FilterRegistry:    registry,
+			MatchingOptions:   mo,
+			PollTimeout:       o.SourcePollTimeout,
+			DataClients:       dataClients,
+			UpdateBuffer:      updateBuffer,
+			PredicateRegistry: predicates},
+		hostAliases:    hostAliases,
+		tablePinning:   tablePinning,
+		trustedProxies: trustedProxies,
+		cloudBackends:  cloudBackends,
+		overrides:      overrides,
+		keySets:        keySets,
+		chaos:          chaosSwitch,
+		healthChecks:   healthChecks,
+		shutdown:       shutdown,
+		options:        o}
+
+	// create the candidate routing evaluated only for comparison
+	if o.ShadowRoutesFile != "" {
+		shadowClients, err := createDataClients(Options{
+			RoutesFile:     o.ShadowRoutesFile,
+			DefaultFilters: o.DefaultFilters}, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		so := h.routingOptions
+		so.DataClients = shadowClients
+		h.shadowOptions = &so
+	}
+
+	return h, nil
+}
+
+// creates a filter registry with the built-in filters, or with the
+// filters of the base registry from the options, the filter forwarding
+// to the discovered cloud backends, the token validation filter, the
+// chaos filters, the synthetic check filters, the rate limit filters,
+// the cache filter, the sandbox filter of the quota policy, when set,
+// and the custom filters. The custom filters cannot take the name of
+// another filter. The health check filter fails after the shutdown
+// channel was closed, and the failover filter uses the shared health
+// checks of the backends.
+func createRegistry(o Options, cloudBackends *cloud.Backends, keySets *jwt.KeySets, chaosSwitch *chaos.Switch, monitor *synthetic.Monitor, rs ratelimit.Store, cs cache.Store, policy *quota.Policy, healthChecks *healthcheck.Checker, shutdown <-chan struct{}) (filters.Registry, error) {
+	var registry filters.Registry
+	if o.FilterRegistry != nil {
+		registry = make(filters.Registry)
+		for name, spec := range o.FilterRegistry {
+			registry[name] = spec
+		}
+	} else {
+		registry = builtin.MakeRegistry()
+	}
+
+	// replaced with the one failing during the shutdown, unless the
+	// base registry doesn't have it
+	if _, ok := registry[builtin.HealthCheckName]; ok {
+		registry.Register(builtin.NewShutdownHealthCheck(shutdown))
+	}
+
+	// replaced with the one using the shared health checks
+	if _, ok := registry[builtin.FailoverName]; ok && healthChecks != nil {
+		registry.Register(builtin.NewFailoverWithHealthChecks(healthChecks))
+	}
+
+	for _, spec := range []filters.Spec{
+		cloud.NewFilter(cloudBackends),
+		jwt.NewFilter(keySets),
+		chaos.NewLatency(chaosSwitch),
+		chaos.NewError(chaosSwitch),
+		synthetic.NewCheck(monitor),
+		synthetic.NewStatus(monitor),
+		ratelimit.NewRatelimit(rs),
+		ratelimit.NewClientRatelimit(rs),
+		ratelimit.NewHeaderRatelimit(rs),
+		cache.NewCache(cs),
+	} {
+		if err := registry.Add(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if policy != nil {
+		if err := registry.Add(policy.SandboxSpec()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range o.CustomFilters {
+		if err := registry.Add(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// creates a registry with the custom predicates. They cannot take the
+// name of a built-in predicate or of another custom predicate.
+func createPredicateRegistry(o Options) (routing.PredicateRegistry, error) {
+	registry := make(routing.PredicateRegistry)
+	for _, p := range o.CustomPredicates {
+		if _, exists := registry[p.Name()]; exists {
+			return nil, fmt.Errorf("duplicate predicate name: %s", p.Name())
+		}
+
+		for _, b := range eskip.Predicates {
+			if p.Name() == b {
+				return nil, fmt.Errorf("predicate name taken by a built-in predicate: %s", p.Name())
+			}
+		}
+
+		registry.Register(p)
+	}
+
+	return registry, nil
+}
+
+// creates the pinning settings of the routing table versions, when the
+// pinning header is set
+func createTablePinning(o Options) (routing.TablePinning, error) {
+	if o.TablePinningHeader == "" {
+		return routing.TablePinning{}, nil
+	}
+
+	if o.TablePinningRetain <= 0 || o.TablePinningTrustedClients == "" {
+		return routing.TablePinning{}, errors.New("table pinning requires the retained versions and the trusted clients")
+	}
+
+	var clients []string
+	for _, c := range strings.Split(o.TablePinningTrustedClients, ",") {
+		clients = append(clients, strings.TrimSpace(c))
+	}
+
+	trusted, err := routing.ParseIPRanges(clients)
+	if err != nil {
+		return routing.TablePinning{}, err
+	}
+
+	return routing.TablePinning{
+		Header:         o.TablePinningHeader,
+		Retain:         o.TablePinningRetain,
+		TrustedClients: trusted}, nil
+}
+
+// creates the trusted proxies, whose addresses are skipped when taking
+// the client address from the X-Forwarded-For header
+func createTrustedProxies(o Options) (routing.TrustedProxies, error) {
+	tp := routing.TrustedProxies{Hops: o.TrustedProxyHops}
+	if o.TrustedProxies == "" {
+		return tp, nil
+	}
+
+	var proxies []string
+	for _, p := range strings.Split(o.TrustedProxies, ",") {
+		proxies = append(proxies, strings.TrimSpace(p))
+	}
+
+	ranges, err := routing.ParseIPRanges(proxies)
+	if err != nil {
+		return routing.TrustedProxies{}, err
+	}
+
+	tp.Ranges = ranges
+	return tp, nil
+}
+
+// Returns the filters supported with the provided options: the built-in
+// filters and the custom filters, with their aliases and the expected
+// parameters.
+func Filters(o Options) ([]filters.SpecInfo, error) {
+	r, err := createRegistry(o, nil, nil, nil, synthetic.New(nil), nil, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Specs(), nil
+}
+
+// Returns the global switch of the chaos experiments of the routes. It
+// can be exposed as an http.Handler on an internal listener.
+func (h *Handler) ChaosSwitch() *chaos.Switch {
+	return h.chaos
+}
+
+// Starts polling the data clients and creates the proxy. Calling it
+// again, or after Close, has no effect.
+func (h *Handler) Start() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.routing != nil || h.closed {
+		return
+	}
+
+	h.cloudBackends.Start()
+	h.keySets.Start()
+	h.routing = routing.New(h.routingOptions)
+	h.routing.SetTableRollout(routing.TableRollout{
+		Percentage: h.options.TableRolloutPercentage,
+		Duration:   h.options.TableRolloutDuration})
+	h.routing.SetHostAliases(h.hostAliases)
+	h.routing.SetTablePinning(h.tablePinning)
+	routing.SetTrustedProxies(h.trustedProxies)
+	if h.shadowOptions != nil {
+		h.shadow = routing.New(*h.shadowOptions)
+		h.shadow.SetHostAliases(h.hostAliases)
+	}
+
+	h.proxy.Store(proxy.WithParams(proxy.Params{
+		Routing:                h.routing,
+		Options:                h.options.ProxyOptions,
+		PriorityRoutes:         h.options.PriorityRoutes,
+		CancelRemovedAfter:     h.options.CancelRemovedBackendsAfter,
+		DefaultBackend:         h.options.DefaultBackend,
+		ErrorHandler:           h.options.ProxyErrorHandler,
+		SlowRequestThreshold:   h.options.SlowRequestThreshold,
+		BodyBufferingThreshold: h.options.BodyBufferingThreshold,
+		BodyBufferingLimit:     h.options.BodyBufferingLimit,
+		MaxInFlightRequests:    h.options.MaxInFlightRequests,
+		MaxBackendConnections:  h.options.MaxBackendConnections,
+		MaxResponseBandwidth:   h.options.MaxResponseBandwidth,
+		UpgradeIdleTimeout:     h.options.UpgradeIdleTimeout,
+		LoopbackHeaders:        h.options.LoopbackHeaders,
+		LoopbackStateBag:       h.options.LoopbackStateBag,
+		CircuitBreaker:         h.options.CircuitBreaker,
+		Retry:                  h.options.Retry,
+		RetryBudgetRatio:       h.options.RetryBudgetRatio,
+		BackendTimeouts:        h.options.BackendTimeouts,
+		ConnectionPool:         h.options.BackendConnectionPool,
+		HealthChecks:           h.healthChecks,
+		PhaseTimeouts:          h.options.PhaseTimeouts,
+		ShadowRouting:          h.shadow}))
+}
+
+// Returns the routing instance, or nil, if the handler was not started.
+func (h *Handler) Routing() *routing.Routing {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.routing
+}
+
+// Shutdown marks the handler as shutting down: the healthcheck filter
+// responds with 503 Service Unavailable from then on, while the rest of
+// the routes are served unchanged. Run calls it when receiving SIGTERM,
+// before the shutdown delay.
+func (h *Handler) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+// Stops polling the data clients and the health checks of the backends.
+// The handler keeps serving the requests with the last received routes.
+func (h *Handler) Close() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.closed = true
+	h.cloudBackends.Close()
+	h.keySets.Close()
+	h.healthChecks.Close()
+	if h.routing != nil {
+		h.routing.Close()
+	}
+
+	if h.shadow != nil {
+		h.shadow.Close()
+	}
+}
+
+// http.Handler implementation
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, _ := h.proxy.Load().(http.Handler)
+	if p == nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	p.ServeHTTP(w, r)
+}
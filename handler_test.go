@@ -0,0 +1,243 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	"errors"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingClient struct {
+	routing.DataClient
+	mx      sync.Mutex
+	updates int
+}
+
+func (c *countingClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	c.mx.Lock()
+	c.updates++
+	c.mx.Unlock()
+	return c.DataClient.LoadUpdate()
+}
+
+func (c *countingClient) updateCount() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.updates
+}
+
+func serveStatus(h http.Handler, path string) int {
+	r, _ := http.NewRequest("GET", "https://www.example.org"+path, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func waitForStatus(h http.Handler, path string, code int) bool {
+	timeout := time.After(3 * time.Second)
+	for {
+		if serveStatus(h, path) == code {
+			return true
+		}
+
+		select {
+		case <-timeout:
+			return false
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
+
+func TestHandlerLifecycle(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(`hello: Path("/hello") -> "` + backend.URL + `"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cc := &countingClient{DataClient: dc}
+	h, err := NewHandler(Options{CustomDataClients: []routing.DataClient{cc}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if code := serveStatus(h, "/hello"); code != http.StatusServiceUnavailable {
+		t.Error("failed to respond with unavailable before start", code)
+	}
+
+	h.Start()
+	if !waitForStatus(h, "/hello", http.StatusTeapot) {
+		t.Error("failed to receive the routes")
+	}
+
+	if h.Routing() == nil {
+		t.Error("failed to expose the routing")
+	}
+
+	h.Close()
+	time.Sleep(3 * defaultSourcePollTimeout)
+	updates := cc.updateCount()
+	time.Sleep(9 * defaultSourcePollTimeout)
+	if cc.updateCount() != updates {
+		t.Error("failed to stop polling the data clients")
+	}
+
+	if code := serveStatus(h, "/hello"); code != http.StatusTeapot {
+		t.Error("failed to keep the last routes after close", code)
+	}
+}
+
+func TestHandlerInvalidDefaultBackend(t *testing.T) {
+	if _, err := NewHandler(Options{DefaultBackend: "invalid"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestHandlerInvalidTablePinning(t *testing.T) {
+	for _, o := range []Options{
+		{TablePinningHeader: "X-Routing-Table", TablePinningTrustedClients: "127.0.0.1"},
+		{TablePinningHeader: "X-Routing-Table", TablePinningRetain: 3},
+		{TablePinningHeader: "X-Routing-Table", TablePinningRetain: 3, TablePinningTrustedClients: "localhost"},
+	} {
+		if _, err := NewHandler(o); err == nil {
+			t.Error("failed to fail", o.TablePinningRetain, o.TablePinningTrustedClients)
+		}
+	}
+}
+
+func TestHandlerInvalidTrustedProxies(t *testing.T) {
+	if _, err := NewHandler(Options{TrustedProxies: "10.0.0.0/8,lb.example.org"}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+type tenantPredicateSpec struct{ name string }
+
+type tenantPredicate string
+
+func (s *tenantPredicateSpec) Name() string { return s.name }
+
+func (s *tenantPredicateSpec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) != 1 {
+		return nil, errors.New("invalid number of arguments")
+	}
+
+	tenant, _ := args[0].(string)
+	return tenantPredicate(tenant), nil
+}
+
+func (p tenantPredicate) Match(r *http.Request) bool {
+	return r.Header.Get("X-Tenant") == string(p)
+}
+
+func TestHandlerCustomPredicates(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		acme: Path("/foo") && Tenant("acme") -> redirectTo(302, "/acme") -> <shunt>;
+		foo: Path("/foo") -> <shunt>;
+		ready: Path("/ready") -> redirectTo(302, "/") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHandler(Options{
+		CustomDataClients: []routing.DataClient{dc},
+		CustomPredicates:  []routing.PredicateSpec{&tenantPredicateSpec{"Tenant"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Start()
+	defer h.Close()
+
+	if !waitForStatus(h, "/ready", http.StatusFound) {
+		t.Fatal("failed to load the routes")
+	}
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/foo", nil)
+	r.Header.Set("X-Tenant", "acme")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Error("failed to match the custom predicate", w.Code)
+	}
+
+	if code := serveStatus(h, "/foo"); code != http.StatusNotFound {
+		t.Error("failed to match the route without the custom predicate", code)
+	}
+
+	a := h.About()
+	if !hasString(a.Predicates, "Tenant") {
+		t.Error("missing custom predicate", a.Predicates)
+	}
+}
+
+func TestHandlerInvalidCustomPredicates(t *testing.T) {
+	for _, specs := range [][]routing.PredicateSpec{
+		{&tenantPredicateSpec{"Path"}},
+		{&tenantPredicateSpec{"Tenant"}, &tenantPredicateSpec{"Tenant"}},
+	} {
+		if _, err := NewHandler(Options{CustomPredicates: specs}); err == nil {
+			t.Error("failed to fail", specs[0].Name())
+		}
+	}
+}
+
+func TestHandlerFilterRegistry(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		ready: Path("/ready") -> redirectTo(302, "/") -> <shunt>;
+		mod: Path("/mod") -> modPath("^/mod", "/foo") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := make(filters.Registry)
+	registry.Register(builtin.NewRedirectTo())
+	h, err := NewHandler(Options{
+		CustomDataClients: []routing.DataClient{dc},
+		FilterRegistry:    registry})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Start()
+	defer h.Close()
+
+	if !waitForStatus(h, "/ready", http.StatusFound) {
+		t.Fatal("failed to load the routes")
+	}
+
+	if code := serveStatus(h, "/mod"); code != http.StatusNotFound {
+		t.Error("route with a filter missing from the registry accepted", code)
+	}
+
+	if len(registry) != 1 {
+		t.Error("base registry modified", registry.Names())
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package healthcheck implements the active health checking of the
+backends.
+
+A Checker probes the backends periodically, with a GET request to a
+health check path, and tracks whether they are healthy. A probe
+succeeds when the backend responds with a status code below 500 within
+the timeout. A healthy backend is marked down after a configured number
+of consecutive failed probes, and a down backend is marked healthy again
+after a configured number of consecutive successful ones.
+
+The backends are registered on demand: the proxy asks the checker about
+the health of a backend, e.g. when selecting one of the backends of a
+split route or of a load balancer, and the checker starts probing it. A
+new backend is considered healthy until its probes fail. The probing of
+a backend stops when it was not asked about for a while, and starts
+again with the next request.
+
+The state of the checked backends is reported by the
+healthcheck.<host>.healthy gauges, 1 when healthy, 0 when down, and the
+backends marked down are counted by healthcheck.<host>.down. It is also
+served on the /admin/healthchecks endpoint of the admin API.
+*/
+package healthcheck
+
+import (
+	"crypto/tls"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/metrics"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// The default interval of the probes.
+	DefaultInterval = 10 * time.Second
+
+	// The default number of the consecutive successful probes, after
+	// which a down backend is marked healthy.
+	DefaultHealthyThreshold = 2
+
+	// The default number of the consecutive failed probes, after which
+	// a healthy backend is marked down.
+	DefaultUnhealthyThreshold = 3
+
+	// the probing of a backend stops when it was not asked about for
+	// this many intervals
+	idleIntervals = 30
+)
+
+// Options of the health checks.
+type Options struct {
+
+	// The path of the health check requests, used for the backends
+	// that don't have their own, e.g. set by the loadBalancer filter.
+	// When empty, only the backends with their own path are checked.
+	Path string
+
+	// The interval of the probes. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// The timeout of a probe. Defaults to the interval.
+	Timeout time.Duration
+
+	// The number of the consecutive successful probes, after which a
+	// down backend is marked healthy. Defaults to
+	// DefaultHealthyThreshold.
+	HealthyThreshold int
+
+	// The number of the consecutive failed probes, after which a
+	// healthy backend is marked down. Defaults to
+	// DefaultUnhealthyThreshold.
+	UnhealthyThreshold int
+
+	// When set, the certificates of the backends are not verified.
+	Insecure bool
+}
+
+// Target identifies a checked backend.
+type Target struct {
+
+	// The address of the backend, in the form of scheme://host. The
+	// backends with the https or the grpc scheme are probed over TLS.
+	Backend string
+
+	// When set, it is used as the Host header and as the TLS server
+	// name of the probes, e.g. when the host of the backend is an IP
+	// address resolved from a DNS name.
+	ServerName string
+
+	// The path of the health check requests. When empty, the path set
+	// in the options is used.
+	Path string
+}
+
+// State of a checked backend.
+type State struct {
+	Backend    string    `json:"backend"`
+	ServerName string    `json:"serverName,omitempty"`
+	Path       string    `json:"path"`
+	Healthy    bool      `json:"healthy"`
+	Successes  int       `json:"consecutiveSuccesses"`
+	Failures   int       `json:"consecutiveFailures"`
+	LastCheck  time.Time `json:"lastCheck"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// the state of a backend. The health and the time of the last use are
+// accessed atomically, the rest is protected by the lock of the checker.
+type target struct {
+	Target
+	host      string
+	healthy   int32
+	lastUsed  int64
+	successes int
+	failures  int
+	lastCheck time.Time
+	lastError string
+}
+
+// Checker probes the backends and tracks their health.
+type Checker struct {
+	options Options
+
+	// the current map of the checked targets, replaced on change
+	// while holding the lock, so that it can be read without locking
+	targets atomic.Value
+
+	mx         sync.Mutex
+	transports map[string]*http.Transport
+	quit       chan struct{}
+	closed     bool
+}
+
+// Creates a health checker. The backends are checked only after they
+// were asked about.
+func New(o Options) *Checker {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = o.Interval
+	}
+
+	if o.HealthyThreshold <= 0 {
+		o.HealthyThreshold = DefaultHealthyThreshold
+	}
+
+	if o.UnhealthyThreshold <= 0 {
+		o.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+
+	c := &Checker{
+		options:    o,
+		transports: make(map[string]*http.Transport),
+		quit:       make(chan struct{})}
+	c.targets.Store(map[Target]*target{})
+	return c
+}
+
+func (c *Checker) currentTargets() map[Target]*target {
+	return c.targets.Load().(map[Target]*target)
+}
+
+// stores a copy of the current targets, with the target added, or, when
+// s is nil, removed. Expects the lock to be held.
+func (c *Checker) updateTargets(t Target, s *target) {
+	current := c.currentTargets()
+	next := make(map[Target]*target, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+
+	if s == nil {
+		delete(next, t)
+	} else {
+		next[t] = s
+	}
+
+	c.targets.Store(next)
+}
+
+func (s *target) isHealthy() bool {
+	return atomic.LoadInt32(&s.healthy) != 0
+}
+
+func (s *target) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+
+	atomic.StoreInt32(&s.healthy, v)
+}
+
+func (s *target) used(now time.Time) {
+	atomic.StoreInt64(&s.lastUsed, now.UnixNano())
+}
+
+func (s *target) idle(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastUsed)))
+}
+
+// CheckedByDefault tells whether the backends without their own health
+// check path are checked, i.e. whether a default path is configured.
+// It accepts a nil checker.
+func (c *Checker) CheckedByDefault() bool {
+	return c != nil && c.options.Path != ""
+}
+
+// Healthy tells whether a backend is healthy, and starts checking it,
+// if it is not checked yet. The backends without a health check path,
+// and the ones not checked yet, are considered healthy. It accepts a
+// nil checker, in which case all the backends are healthy. The already
+// checked backends are looked up without locking.
+func (c *Checker) Healthy(t Target) bool {
+	if c == nil || t.Backend == "" {
+		return true
+	}
+
+	if t.Path == "" {
+		t.Path = c.options.Path
+	}
+
+	if t.Path == "" {
+		return true
+	}
+
+	now := time.Now()
+	if s, ok := c.currentTargets()[t]; ok {
+		s.used(now)
+		return s.isHealthy()
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.closed {
+		return true
+	}
+
+	s, ok := c.currentTargets()[t]
+	if !ok {
+		u, err := url.Parse(t.Backend)
+		if err != nil || u.Host == "" {
+			return true
+		}
+
+		s = &target{Target: t, host: u.Host, healthy: 1}
+		c.updateTargets(t, s)
+		go c.check(s)
+	}
+
+	s.used(now)
+	return s.isHealthy()
+}
+
+// returns the transport of the probes with a TLS server name. Expects
+// the lock to be held.
+func (c *Checker) transport(serverName string) *http.Transport {
+	if tr, ok := c.transports[serverName]; ok {
+		return tr
+	}
+
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: c.options.Timeout,
+		TLSClientConfig: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: c.options.Insecure}}
+	c.transports[serverName] = tr
+	return tr
+}
+
+// executes a single probe
+func (c *Checker) probe(t Target) error {
+	scheme := "http"
+	u, err := url.Parse(t.Backend)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme == "https" || u.Scheme == "grpc" {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequest("GET", scheme+"://"+u.Host+t.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", "skipper-healthcheck")
+	if t.ServerName != "" {
+		req.Host = t.ServerName
+	}
+
+	c.mx.Lock()
+	client := &http.Client{Transport: c.transport(t.ServerName), Timeout: c.options.Timeout}
+	c.mx.Unlock()
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	rsp.Body.Close()
+	if rsp.StatusCode >= http.StatusInternalServerError {
+		return errStatus(rsp.StatusCode)
+	}
+
+	return nil
+}
+
+type errStatus int
+
+func (s errStatus) Error() string {
+	return fmt.Sprintf("unexpected status: %d", int(s))
+}
+
+func gaugeValue(healthy bool) int64 {
+	if healthy {
+		return 1
+	}
+
+	return 0
+}
+
+// records the result of a probe, and marks the backend healthy or down,
+// when the threshold is reached
+func (c *Checker) record(s *target, err error, now time.Time) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	s.lastCheck = now
+	healthy := s.isHealthy()
+	if err == nil {
+		s.lastError = ""
+		s.failures = 0
+		s.successes++
+		if !healthy && s.successes >= c.options.HealthyThreshold {
+			healthy = true
+			s.setHealthy(true)
+			log.Infof("backend %s is healthy", s.Backend)
+		}
+	} else {
+		s.lastError = err.Error()
+		s.successes = 0
+		s.failures++
+		if healthy && s.failures >= c.options.UnhealthyThreshold {
+			healthy = false
+			s.setHealthy(false)
+			metrics.IncHealthCheckDown(s.host)
+			log.Warnf("backend %s is down: %v", s.Backend, err)
+		}
+	}
+
+	metrics.UpdateHealthCheck(s.host, gaugeValue(healthy))
+}
+
+// probes a backend, until the checker is closed, or the backend is not
+// asked about for a while
+func (c *Checker) check(s *target) {
+	for {
+		c.record(s, c.probe(s.Target), time.Now())
+
+		select {
+		case <-c.quit:
+			return
+		case <-time.After(c.options.Interval):
+		}
+
+		if s.idle(time.Now()) > idleIntervals*c.options.Interval {
+			c.mx.Lock()
+			if c.currentTargets()[s.Target] == s {
+				c.updateTargets(s.Target, nil)
+			}
+
+			c.mx.Unlock()
+			return
+		}
+	}
+}
+
+// States returns the state of the checked backends, ordered by the
+// backend address.
+func (c *Checker) States() []State {
+	if c == nil {
+		return nil
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	targets := c.currentTargets()
+	states := make([]State, 0, len(targets))
+	for _, s := range targets {
+		states = append(states, State{
+			Backend:    s.Backend,
+			ServerName: s.ServerName,
+			Path:       s.Path,
+			Healthy:    s.isHealthy(),
+			Successes:  s.successes,
+			Failures:   s.failures,
+			LastCheck:  s.lastCheck,
+			LastError:  s.lastError})
+	}
+
+	sort.Sort(byBackend(states))
+	return states
+}
+
+type byBackend []State
+
+func (s byBackend) Len() int      { return len(s) }
+func (s byBackend) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s byBackend) Less(i, j int) bool {
+	if s[i].Backend != s[j].Backend {
+		return s[i].Backend < s[j].Backend
+	}
+
+	if s[i].ServerName != s[j].ServerName {
+		return s[i].ServerName < s[j].ServerName
+	}
+
+	return s[i].Path < s[j].Path
+}
+
+// Close stops the probes. The backends are considered healthy from then
+// on.
+func (c *Checker) Close() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.closed = true
+	close(c.quit)
+	c.targets.Store(map[Target]*target{})
+}
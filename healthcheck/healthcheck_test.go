@@ -0,0 +1,211 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testInterval = 3 * time.Millisecond
+
+// a backend responding on /health with the status stored in the
+// returned value
+func testBackend() (*httptest.Server, *int64) {
+	status := int64(http.StatusOK)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(int(atomic.LoadInt64(&status)))
+	}))
+
+	return s, &status
+}
+
+func waitForHealth(c *Checker, t Target, healthy bool) bool {
+	for i := 0; i < 120; i++ {
+		if c.Healthy(t) == healthy {
+			return true
+		}
+
+		time.Sleep(testInterval)
+	}
+
+	return false
+}
+
+func TestNoPath(t *testing.T) {
+	c := New(Options{Interval: testInterval})
+	defer c.Close()
+
+	if !c.Healthy(Target{Backend: "http://127.0.0.1:1"}) {
+		t.Error("backend without health check path reported down")
+	}
+
+	if len(c.States()) != 0 {
+		t.Error("backend without health check path checked")
+	}
+
+	var nilChecker *Checker
+	if !nilChecker.Healthy(Target{Backend: "http://127.0.0.1:1", Path: "/health"}) {
+		t.Error("nil checker reported a backend down")
+	}
+}
+
+func TestMarkDownAndUp(t *testing.T) {
+	backend, status := testBackend()
+	defer backend.Close()
+
+	c := New(Options{
+		Path:               "/health",
+		Interval:           testInterval,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2})
+	defer c.Close()
+
+	target := Target{Backend: backend.URL}
+	if !c.Healthy(target) {
+		t.Error("new backend reported down")
+	}
+
+	atomic.StoreInt64(status, http.StatusServiceUnavailable)
+	if !waitForHealth(c, target, false) {
+		t.Fatal("failed to mark the backend down")
+	}
+
+	states := c.States()
+	if len(states) != 1 || states[0].Healthy || states[0].Failures < 2 || states[0].LastError == "" {
+		t.Error("invalid state of the backend marked down", states)
+	}
+
+	atomic.StoreInt64(status, http.StatusOK)
+	if !waitForHealth(c, target, true) {
+		t.Fatal("failed to mark the backend healthy")
+	}
+
+	states = c.States()
+	if len(states) != 1 || !states[0].Healthy || states[0].Successes < 2 || states[0].LastError != "" {
+		t.Error("invalid state of the healthy backend", states)
+	}
+}
+
+func TestTargetPath(t *testing.T) {
+	backend, _ := testBackend()
+	defer backend.Close()
+
+	c := New(Options{Path: "/missing", Interval: testInterval, UnhealthyThreshold: 1})
+	defer c.Close()
+
+	own := Target{Backend: backend.URL, Path: "/health"}
+	c.Healthy(own)
+	time.Sleep(12 * testInterval)
+	if !c.Healthy(own) {
+		t.Error("backend checked with its own path reported down")
+	}
+
+	// the 404 responses of the default path are not failures
+	def := Target{Backend: backend.URL}
+	c.Healthy(def)
+	time.Sleep(12 * testInterval)
+	if !c.Healthy(def) {
+		t.Error("backend checked with the default path reported down")
+	}
+
+	if states := c.States(); len(states) != 2 || states[0].Path != "/health" || states[1].Path != "/missing" {
+		t.Error("invalid states", states)
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	backend, _ := testBackend()
+	url := backend.URL
+	backend.Close()
+
+	c := New(Options{Path: "/health", Interval: testInterval, Timeout: 30 * time.Millisecond, UnhealthyThreshold: 1})
+	defer c.Close()
+
+	if !waitForHealth(c, Target{Backend: url}, false) {
+		t.Error("failed to mark the unreachable backend down")
+	}
+}
+
+func TestClose(t *testing.T) {
+	backend, status := testBackend()
+	defer backend.Close()
+	atomic.StoreInt64(status, http.StatusInternalServerError)
+
+	c := New(Options{Path: "/health", Interval: testInterval, UnhealthyThreshold: 1})
+	target := Target{Backend: backend.URL}
+	if !waitForHealth(c, target, false) {
+		t.Fatal("failed to mark the backend down")
+	}
+
+	c.Close()
+	if !c.Healthy(target) || len(c.States()) != 0 {
+		t.Error("closed checker still checking")
+	}
+}
+
+func TestCheckedByDefault(t *testing.T) {
+	var nilChecker *Checker
+	if nilChecker.CheckedByDefault() {
+		t.Error("nil checker checks by default")
+	}
+
+	c := New(Options{Interval: testInterval})
+	defer c.Close()
+	if c.CheckedByDefault() {
+		t.Error("checker without path checks by default")
+	}
+
+	cp := New(Options{Path: "/health", Interval: testInterval})
+	defer cp.Close()
+	if !cp.CheckedByDefault() {
+		t.Error("checker with path doesn't check by default")
+	}
+}
+
+func TestConcurrentHealthy(t *testing.T) {
+	backend, status := testBackend()
+	defer backend.Close()
+	atomic.StoreInt64(status, http.StatusInternalServerError)
+
+	c := New(Options{Path: "/health", Interval: testInterval, UnhealthyThreshold: 1})
+	defer c.Close()
+
+	target := Target{Backend: backend.URL}
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func() {
+			done <- waitForHealth(c, target, false)
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		if !<-done {
+			t.Error("failed to mark the backend down")
+		}
+	}
+
+	if states := c.States(); len(states) != 1 {
+		t.Error("the backend registered more than once", states)
+	}
+}
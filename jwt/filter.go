@@ -0,0 +1,206 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The name of the filter validating the bearer tokens.
+const FilterName = "jwtValidation"
+
+// the prefix of the claims in the extracted values
+const templatePrefix = "jwt_"
+
+var templateName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type filterSpec struct {
+	keySets *KeySets
+	clock   clock.Clock
+}
+
+type filter struct {
+	keySets  *KeySets
+	clock    clock.Clock
+	url      string
+	issuer   string
+	audience string
+	scopes   []string
+}
+
+// Returns a filter specification whose instances validate the bearer
+// tokens of the requests with the keys of a JWKS URL. Instances expect
+// the JWKS URL, and optionally the required issuer, the required
+// audience, and the required scopes, where an empty issuer or audience
+// is not checked, e.g.:
+//
+//     jwtValidation("https://id.example.org/jwks")
+//     jwtValidation("https://id.example.org/jwks", "https://id.example.org", "api", "read", "write")
+//
+// The requests without a valid token are rejected with 401 Unauthorized,
+// while the requests with a valid token, but without all the required
+// scopes, with 403 Forbidden.
+//
+// Name: "jwtValidation".
+func NewFilter(ks *KeySets) filters.Spec {
+	return &filterSpec{keySets: ks, clock: clock.System}
+}
+
+// "jwtValidation"
+func (spec *filterSpec) Name() string { return FilterName }
+
+func (spec *filterSpec) Description() string {
+	return "Validates the bearer tokens with the keys of a JWKS URL, checking the issuer, the audience and the scopes."
+}
+
+func (spec *filterSpec) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "jwksUrl", Type: filters.StringType},
+		{Name: "issuer", Type: filters.StringType, Optional: true},
+		{Name: "audience", Type: filters.StringType, Optional: true},
+		{Name: "scope", Type: filters.StringType, Optional: true, Variadic: true},
+	}
+}
+
+func (spec *filterSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	args := make([]string, len(config))
+	for i, c := range config {
+		s, ok := c.(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		args[i] = s
+	}
+
+	if !strings.HasPrefix(args[0], "http://") && !strings.HasPrefix(args[0], "https://") {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{keySets: spec.keySets, clock: spec.clock, url: args[0]}
+	if len(args) > 1 {
+		f.issuer = args[1]
+	}
+
+	if len(args) > 2 {
+		f.audience = args[2]
+	}
+
+	if len(args) > 3 {
+		f.scopes = args[3:]
+	}
+
+	spec.keySets.get(f.url)
+	return f, nil
+}
+
+// returns the bearer token from the Authorization header
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(h[7:])
+}
+
+func (f *filter) reject(ctx filters.FilterContext, status int, challenge string) {
+	w := ctx.ResponseWriter()
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(status)
+	ctx.MarkServed()
+}
+
+// tells whether all the required scopes are granted
+func (f *filter) hasScopes(c Claims) bool {
+	granted := make(map[string]bool)
+	for _, s := range c.Scopes() {
+		granted[s] = true
+	}
+
+	for _, s := range f.scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stores the claims with string, number or boolean values in the
+// extracted values, for the template arguments of the following filters
+func extractClaims(ctx filters.FilterContext, c Claims) {
+	values, ok := ctx.StateBag()[filters.ExtractedValuesKey].(map[string]string)
+	if !ok {
+		values = make(map[string]string)
+		ctx.StateBag()[filters.ExtractedValuesKey] = values
+	}
+
+	for name, v := range c {
+		if !templateName.MatchString(name) {
+			continue
+		}
+
+		switch vi := v.(type) {
+		case string:
+			values[templatePrefix+name] = vi
+		case float64:
+			values[templatePrefix+name] = strconv.FormatFloat(vi, 'f', -1, 64)
+		case bool:
+			values[templatePrefix+name] = strconv.FormatBool(vi)
+		}
+	}
+}
+
+// Validates the bearer token, and stores its claims in the state bag.
+func (f *filter) Request(ctx filters.FilterContext) {
+	token := bearerToken(ctx.Request())
+	if token == "" {
+		f.reject(ctx, http.StatusUnauthorized, "Bearer")
+		return
+	}
+
+	c, err := f.keySets.Verify(f.url, token)
+	if err == nil {
+		err = c.Validate(f.clock.Now(), f.issuer, f.audience)
+	}
+
+	if err != nil {
+		log.Debugf("invalid token: %v", err)
+		f.reject(ctx, http.StatusUnauthorized, `Bearer error="invalid_token"`)
+		return
+	}
+
+	if !f.hasScopes(c) {
+		f.reject(ctx, http.StatusForbidden, `Bearer error="insufficient_scope", scope="`+strings.Join(f.scopes, " ")+`"`)
+		return
+	}
+
+	ctx.StateBag()[filters.JwtClaimsKey] = map[string]interface{}(c)
+	extractClaims(ctx, c)
+}
+
+// Noop.
+func (f *filter) Response(filters.FilterContext) {}
@@ -0,0 +1,168 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFilterArgs(t *testing.T) {
+	spec := NewFilter(newKeySets(time.Hour, clock.System))
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{"id.example.org/jwks"},
+		{"https://id.example.org/jwks", "https://id.example.org", 42},
+	} {
+		if _, err := spec.CreateFilter(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	server := httptest.NewServer(&keySetServer{keySet: testKeySet()})
+	defer server.Close()
+
+	now := time.Now()
+	ks := newKeySets(time.Hour, clock.NewFake(now))
+	defer ks.Close()
+
+	spec := &filterSpec{keySets: ks, clock: clock.NewFake(now)}
+	args := []interface{}{server.URL, "https://id.example.org", "api", "read"}
+
+	valid := map[string]interface{}{
+		"iss":   "https://id.example.org",
+		"aud":   "api",
+		"sub":   "foo",
+		"uid":   float64(42),
+		"scope": "read write",
+		"exp":   float64(now.Add(time.Minute).Unix())}
+
+	claims := func(update map[string]interface{}) map[string]interface{} {
+		c := make(map[string]interface{})
+		for k, v := range valid {
+			c[k] = v
+		}
+
+		for k, v := range update {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+
+		return c
+	}
+
+	for _, ti := range []struct {
+		title     string
+		auth      string
+		status    int
+		challenge string
+	}{{
+		title: "valid",
+		auth:  "Bearer " + sign("RS256", "rsa", valid),
+	}, {
+		title: "case insensitive scheme",
+		auth:  "bearer " + sign("ES256", "ec", valid),
+	}, {
+		title:     "missing token",
+		status:    http.StatusUnauthorized,
+		challenge: "Bearer",
+	}, {
+		title:     "basic auth",
+		auth:      "Basic Zm9vOmJhcg==",
+		status:    http.StatusUnauthorized,
+		challenge: "Bearer",
+	}, {
+		title:     "invalid token",
+		auth:      "Bearer foo.bar.baz",
+		status:    http.StatusUnauthorized,
+		challenge: `Bearer error="invalid_token"`,
+	}, {
+		title:     "expired",
+		auth:      "Bearer " + sign("RS256", "rsa", claims(map[string]interface{}{"exp": float64(now.Add(-time.Hour).Unix())})),
+		status:    http.StatusUnauthorized,
+		challenge: `Bearer error="invalid_token"`,
+	}, {
+		title:     "invalid issuer",
+		auth:      "Bearer " + sign("RS256", "rsa", claims(map[string]interface{}{"iss": "https://other.example.org"})),
+		status:    http.StatusUnauthorized,
+		challenge: `Bearer error="invalid_token"`,
+	}, {
+		title:     "invalid audience",
+		auth:      "Bearer " + sign("RS256", "rsa", claims(map[string]interface{}{"aud": "web"})),
+		status:    http.StatusUnauthorized,
+		challenge: `Bearer error="invalid_token"`,
+	}, {
+		title:     "missing scope",
+		auth:      "Bearer " + sign("RS256", "rsa", claims(map[string]interface{}{"scope": "write"})),
+		status:    http.StatusForbidden,
+		challenge: `Bearer error="insufficient_scope", scope="read"`,
+	}} {
+		f, err := spec.CreateFilter(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := http.NewRequest("GET", "https://www.example.org", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ti.auth != "" {
+			r.Header.Set("Authorization", ti.auth)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: r, FResponseWriter: w, FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+
+		if ti.status == 0 {
+			if ctx.FServed {
+				t.Error(ti.title, "unexpected rejection", w.Code, w.Header())
+				continue
+			}
+
+			c, ok := ctx.FStateBag[filters.JwtClaimsKey].(map[string]interface{})
+			if !ok || c["sub"] != "foo" {
+				t.Error(ti.title, "failed to store the claims", c)
+			}
+
+			values, ok := ctx.FStateBag[filters.ExtractedValuesKey].(map[string]string)
+			if !ok || values["jwt_sub"] != "foo" || values["jwt_uid"] != "42" {
+				t.Error(ti.title, "failed to extract the claims", values)
+			}
+
+			if filters.ExpandTemplate(ctx, "user-${jwt_sub}") != "user-foo" {
+				t.Error(ti.title, "failed to expand the claim")
+			}
+
+			continue
+		}
+
+		if !ctx.FServed || w.Code != ti.status || w.Header().Get("WWW-Authenticate") != ti.challenge {
+			t.Error(ti.title, "invalid rejection", ctx.FServed, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
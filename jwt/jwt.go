@@ -0,0 +1,402 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package jwt implements the validation of JSON Web Tokens, signed with
+the keys published by the identity providers as JSON Web Key Sets
+(JWKS).
+
+The jwtValidation filter verifies the bearer token of the requests
+against the keys fetched from a JWKS URL, and checks its issuer,
+audience and scopes, e.g.:
+
+	api: Path("/api") -> jwtValidation("https://id.example.org/jwks", "https://id.example.org", "api", "read") -> "https://api.example.org"
+
+The key sets are cached, and refreshed periodically in the background.
+When a token references a key that is not in the cache, e.g. after a
+key rotation, the key set is fetched again, at most once in a minute.
+
+The supported signing algorithms are RS256, RS384, RS512, PS256, PS384,
+PS512, ES256, ES384 and ES512. The tokens with the "none" algorithm, or
+with the HMAC algorithms, are rejected, since these can't be verified
+with public keys.
+
+The claims of the valid tokens are stored in the state bag under
+filters.JwtClaimsKey, and the claims with string or number values are
+available for the template arguments of the following filters as
+${jwt_<claim>}, e.g. to forward the subject to the backend:
+
+	jwtValidation("https://id.example.org/jwks", "", "api") -> requestHeader("X-User", "${jwt_sub}")
+*/
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	errMalformedToken       = errors.New("malformed token")
+	errUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	errUnknownKey           = errors.New("unknown signing key")
+	errInvalidSignature     = errors.New("invalid signature")
+	errExpired              = errors.New("token expired")
+	errNotYetValid          = errors.New("token not yet valid")
+	errInvalidIssuer        = errors.New("invalid issuer")
+	errInvalidAudience      = errors.New("invalid audience")
+	errInvalidKey           = errors.New("invalid key")
+)
+
+// the time tolerated between the clocks of the identity provider and
+// the proxy, when checking the expiration and the not before claims
+const clockSkew = 30 * time.Second
+
+// The claims of a token.
+type Claims map[string]interface{}
+
+// A public key from a key set.
+type Key struct {
+	Id        string
+	Algorithm string
+	Public    crypto.PublicKey
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySetDoc struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// the signing algorithms, by their name
+type algorithm struct {
+	hash  crypto.Hash
+	kind  string
+	pss   bool
+	curve elliptic.Curve
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256, kind: "RSA"},
+	"RS384": {hash: crypto.SHA384, kind: "RSA"},
+	"RS512": {hash: crypto.SHA512, kind: "RSA"},
+	"PS256": {hash: crypto.SHA256, kind: "RSA", pss: true},
+	"PS384": {hash: crypto.SHA384, kind: "RSA", pss: true},
+	"PS512": {hash: crypto.SHA512, kind: "RSA", pss: true},
+	"ES256": {hash: crypto.SHA256, kind: "EC", curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, kind: "EC", curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, kind: "EC", curve: elliptic.P521()},
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeSegment(s)
+	if err != nil || len(b) == 0 {
+		return nil, errInvalidKey
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// converts a JSON web key to a public key
+func (k *jwk) key() (*Key, error) {
+	key := &Key{Id: k.Kid, Algorithm: k.Alg}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil || e.BitLen() > 31 {
+			return nil, errInvalidKey
+		}
+
+		key.Public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		c, ok := curves[k.Crv]
+		if !ok {
+			return nil, errInvalidKey
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !c.IsOnCurve(x, y) {
+			return nil, errInvalidKey
+		}
+
+		key.Public = &ecdsa.PublicKey{Curve: c, X: x, Y: y}
+	default:
+		return nil, errInvalidKey
+	}
+
+	return key, nil
+}
+
+// Parses a JSON web key set. The keys of unsupported types, and the keys
+// meant for encryption, are skipped.
+func ParseKeySet(data []byte) ([]*Key, error) {
+	var doc keySetDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if key, err := k.key(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// tells whether a key can verify the signatures of an algorithm
+func keyFits(k *Key, name string, a algorithm) bool {
+	if k.Algorithm != "" && k.Algorithm != name {
+		return false
+	}
+
+	switch pk := k.Public.(type) {
+	case *rsa.PublicKey:
+		return a.kind == "RSA"
+	case *ecdsa.PublicKey:
+		return a.kind == "EC" && pk.Curve == a.curve
+	default:
+		return false
+	}
+}
+
+func verifySignature(k *Key, a algorithm, signed, signature []byte) bool {
+	h := a.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pk := k.Public.(type) {
+	case *rsa.PublicKey:
+		if a.pss {
+			return rsa.VerifyPSS(pk, a.hash, digest, signature, nil) == nil
+		}
+
+		return rsa.VerifyPKCS1v15(pk, a.hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pk, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// returns the header of a token without verifying it, used to find the
+// signing key
+func parseHeader(token string) (*header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+
+	b, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+
+	var h header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, errMalformedToken
+	}
+
+	return &h, nil
+}
+
+// Verifies the signature of a token with the matching key from the
+// provided keys, and returns its claims. The keys are matched by the key
+// id of the token, or, when the token doesn't have one, every key
+// fitting the algorithm is tried. It doesn't check the time based
+// claims, see Claims.Validate.
+func Verify(token string, keys []*Key) (Claims, error) {
+	h, err := parseHeader(token)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := algorithms[h.Algorithm]
+	if !ok {
+		return nil, errUnsupportedAlgorithm
+	}
+
+	parts := strings.Split(token, ".")
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	var found bool
+	for _, k := range keys {
+		if h.KeyId != "" && k.Id != h.KeyId || !keyFits(k, h.Algorithm, a) {
+			continue
+		}
+
+		found = true
+		if verifySignature(k, a, signed, signature) {
+			payload, err := decodeSegment(parts[1])
+			if err != nil {
+				return nil, errMalformedToken
+			}
+
+			var c Claims
+			if err := json.Unmarshal(payload, &c); err != nil || c == nil {
+				return nil, errMalformedToken
+			}
+
+			return c, nil
+		}
+	}
+
+	if !found {
+		return nil, errUnknownKey
+	}
+
+	return nil, errInvalidSignature
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(v), 0), true
+}
+
+// Returns the string values of a claim, that can be a single string or
+// an array of strings.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var s []string
+		for _, vi := range v {
+			if si, ok := vi.(string); ok {
+				s = append(s, si)
+			}
+		}
+
+		return s
+	default:
+		return nil
+	}
+}
+
+// Returns the scopes of a token, from the space separated scope claim,
+// or from the scp claim, that can be an array, too.
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+
+	var scopes []string
+	for _, s := range c.Strings("scp") {
+		scopes = append(scopes, strings.Fields(s)...)
+	}
+
+	return scopes
+}
+
+// Checks the expiration and the not before claims at the given time, and
+// the issuer and the audience, when they are not empty.
+func (c Claims) Validate(now time.Time, issuer, audience string) error {
+	if exp, ok := c.time("exp"); ok && !now.Before(exp.Add(clockSkew)) {
+		return errExpired
+	}
+
+	if nbf, ok := c.time("nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return errNotYetValid
+	}
+
+	if issuer != "" {
+		if iss, _ := c["iss"].(string); iss != issuer {
+			return errInvalidIssuer
+		}
+	}
+
+	if audience != "" {
+		var found bool
+		for _, aud := range c.Strings("aud") {
+			if aud == audience {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errInvalidAudience
+		}
+	}
+
+	return nil
+}
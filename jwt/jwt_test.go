@@ -0,0 +1,259 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testRSAKey *rsa.PrivateKey
+	testECKey  *ecdsa.PrivateKey
+)
+
+func init() {
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+
+	if testECKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return encodeSegment(b)
+}
+
+// creates a signed token with the test keys
+func sign(alg, kid string, claims map[string]interface{}) string {
+	h := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+
+	signed := encodeJSON(h) + "." + encodeJSON(claims)
+	a, ok := algorithms[alg]
+	if !ok {
+		return signed + "."
+	}
+
+	hash := a.hash.New()
+	hash.Write([]byte(signed))
+	digest := hash.Sum(nil)
+
+	var (
+		signature []byte
+		err       error
+	)
+
+	switch {
+	case a.kind == "EC":
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, testECKey, digest); err == nil {
+			signature = make([]byte, 64)
+			rb, sb := r.Bytes(), s.Bytes()
+			copy(signature[32-len(rb):], rb)
+			copy(signature[64-len(sb):], sb)
+		}
+	case a.pss:
+		signature, err = rsa.SignPSS(rand.Reader, testRSAKey, a.hash, digest, nil)
+	default:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, testRSAKey, a.hash, digest)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + encodeSegment(signature)
+}
+
+// returns the key set document of the test keys
+func testKeySet() []byte {
+	b, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "rsa",
+		"use": "sig",
+		"n":   encodeSegment(testRSAKey.N.Bytes()),
+		"e":   encodeSegment(big.NewInt(int64(testRSAKey.E)).Bytes()),
+	}, {
+		"kty": "EC",
+		"kid": "ec",
+		"crv": "P-256",
+		"x":   encodeSegment(testECKey.X.Bytes()),
+		"y":   encodeSegment(testECKey.Y.Bytes()),
+	}, {
+		"kty": "RSA",
+		"kid": "enc",
+		"use": "enc",
+		"n":   encodeSegment(testRSAKey.N.Bytes()),
+		"e":   encodeSegment(big.NewInt(int64(testRSAKey.E)).Bytes()),
+	}, {
+		"kty": "oct",
+		"kid": "hmac",
+		"k":   "c2VjcmV0",
+	}}})
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestParseKeySet(t *testing.T) {
+	keys, err := ParseKeySet(testKeySet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0].Id != "rsa" || keys[1].Id != "ec" {
+		t.Fatal("failed to parse the key set", keys)
+	}
+
+	if _, err := ParseKeySet([]byte("{")); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys, err := ParseKeySet(testKeySet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "foo"}
+	for _, ti := range []struct {
+		title string
+		token string
+		err   error
+	}{
+		{"RS256", sign("RS256", "rsa", claims), nil},
+		{"RS512", sign("RS512", "rsa", claims), nil},
+		{"PS384", sign("PS384", "rsa", claims), nil},
+		{"ES256", sign("ES256", "ec", claims), nil},
+		{"without key id", sign("RS256", "", claims), nil},
+		{"unknown key", sign("RS256", "other", claims), errUnknownKey},
+		{"key of other type", sign("RS256", "ec", claims), errUnknownKey},
+		{"curve mismatch", sign("ES384", "ec", claims), errUnknownKey},
+		{"none", sign("none", "", claims), errUnsupportedAlgorithm},
+		{"hmac", sign("HS256", "hmac", claims), errUnsupportedAlgorithm},
+		{"malformed", "foo.bar", errMalformedToken},
+	} {
+		c, err := Verify(ti.token, keys)
+		if err != ti.err {
+			t.Error(ti.title, "unexpected error", err, ti.err)
+			continue
+		}
+
+		if err == nil && c["sub"] != "foo" {
+			t.Error(ti.title, "invalid claims", c)
+		}
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	keys, err := ParseKeySet(testKeySet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payload of one token with the signature of another
+	token := strings.Split(sign("RS256", "rsa", map[string]interface{}{"sub": "foo"}), ".")
+	other := strings.Split(sign("RS256", "rsa", map[string]interface{}{"sub": "bar"}), ".")
+	forged := token[0] + "." + token[1] + "." + other[2]
+	if _, err := Verify(forged, keys); err != errInvalidSignature {
+		t.Error("failed to detect the invalid signature", err)
+	}
+}
+
+func TestValidateClaims(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, ti := range []struct {
+		title    string
+		claims   Claims
+		issuer   string
+		audience string
+		err      error
+	}{
+		{"no claims", Claims{}, "", "", nil},
+		{"not expired", Claims{"exp": float64(now.Add(time.Minute).Unix())}, "", "", nil},
+		{"within clock skew", Claims{"exp": float64(now.Add(-10 * time.Second).Unix())}, "", "", nil},
+		{"expired", Claims{"exp": float64(now.Add(-time.Minute).Unix())}, "", "", errExpired},
+		{"not yet valid", Claims{"nbf": float64(now.Add(time.Minute).Unix())}, "", "", errNotYetValid},
+		{"issuer", Claims{"iss": "https://id.example.org"}, "https://id.example.org", "", nil},
+		{"invalid issuer", Claims{"iss": "https://other.example.org"}, "https://id.example.org", "", errInvalidIssuer},
+		{"audience", Claims{"aud": "api"}, "", "api", nil},
+		{"audience list", Claims{"aud": []interface{}{"web", "api"}}, "", "api", nil},
+		{"invalid audience", Claims{"aud": []interface{}{"web"}}, "", "api", errInvalidAudience},
+		{"missing audience", Claims{}, "", "api", errInvalidAudience},
+	} {
+		if err := ti.claims.Validate(now, ti.issuer, ti.audience); err != ti.err {
+			t.Error(ti.title, "unexpected error", err, ti.err)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	for _, ti := range []struct {
+		claims   Claims
+		expected []string
+	}{
+		{Claims{"scope": "read write"}, []string{"read", "write"}},
+		{Claims{"scp": "read write"}, []string{"read", "write"}},
+		{Claims{"scp": []interface{}{"read", "write"}}, []string{"read", "write"}},
+		{Claims{}, nil},
+	} {
+		s := ti.claims.Scopes()
+		if len(s) != len(ti.expected) {
+			t.Error("invalid scopes", s, ti.expected)
+			continue
+		}
+
+		for i := range s {
+			if s[i] != ti.expected[i] {
+				t.Error("invalid scopes", s, ti.expected)
+			}
+		}
+	}
+}
+
+// make sure that the hashes of the algorithms are available
+func TestAlgorithmHashes(t *testing.T) {
+	for name, a := range algorithms {
+		if !a.hash.Available() {
+			t.Error("hash not available", name)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Default interval of refreshing the key sets.
+	DefaultRefreshInterval = 10 * time.Minute
+
+	// The minimum time between fetching a key set on demand, when a
+	// token references an unknown key.
+	minFetchInterval = time.Minute
+)
+
+var errKeySetStatus = errors.New("unexpected key set response status")
+
+// the cached keys of a JWKS URL
+type keySet struct {
+	url       string
+	mx        sync.Mutex
+	keys      []*Key
+	lastFetch time.Time
+}
+
+// KeySets caches the keys fetched from the JWKS URLs, referenced by the
+// filters, and refreshes them periodically.
+type KeySets struct {
+	interval time.Duration
+	clock    clock.Clock
+	client   *http.Client
+	mx       sync.Mutex
+	sets     map[string]*keySet
+	started  bool
+	quit     chan struct{}
+}
+
+// Creates a KeySets instance refreshing the key sets in the given
+// interval. When the interval is not greater than zero,
+// DefaultRefreshInterval is used.
+func NewKeySets(interval time.Duration) *KeySets {
+	return newKeySets(interval, clock.System)
+}
+
+func newKeySets(interval time.Duration, c clock.Clock) *KeySets {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	return &KeySets{
+		interval: interval,
+		clock:    c,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sets:     make(map[string]*keySet),
+		quit:     make(chan struct{})}
+}
+
+// returns the key set of a URL, registering it, when it is new. The new
+// key sets are fetched in the background, when the refresh is running.
+func (ks *KeySets) get(url string) *keySet {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+
+	s, ok := ks.sets[url]
+	if !ok {
+		s = &keySet{url: url}
+		ks.sets[url] = s
+		if ks.started && !ks.closed() {
+			go ks.fetch(s)
+		}
+	}
+
+	return s
+}
+
+func (ks *KeySets) load(url string) ([]*Key, error) {
+	rsp, err := ks.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errKeySetStatus
+	}
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeySet(b)
+}
+
+// fetches the keys of a key set. On failure, the previous keys are kept.
+func (ks *KeySets) fetch(s *keySet) {
+	s.mx.Lock()
+	s.lastFetch = ks.clock.Now()
+	s.mx.Unlock()
+
+	ks.update(s)
+}
+
+// loads and stores the keys of a key set. On failure, the previous keys
+// are kept.
+func (ks *KeySets) update(s *keySet) {
+	keys, err := ks.load(s.url)
+	if err != nil {
+		log.Errorf("failed to fetch key set %s: %v", s.url, err)
+		return
+	}
+
+	s.mx.Lock()
+	s.keys = keys
+	s.mx.Unlock()
+}
+
+// returns the current keys of a key set
+func (s *keySet) current() []*Key {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.keys
+}
+
+// fetches the keys of a key set, unless they were fetched recently, and
+// returns the current keys. The fetch time is checked and set under the
+// same lock, so that from concurrent calls, only one fetches the keys.
+func (ks *KeySets) fetchOnDemand(s *keySet) []*Key {
+	s.mx.Lock()
+	now := ks.clock.Now()
+	recent := !s.lastFetch.IsZero() && now.Sub(s.lastFetch) < minFetchInterval
+	if !recent {
+		s.lastFetch = now
+	}
+
+	s.mx.Unlock()
+
+	if !recent {
+		ks.update(s)
+	}
+
+	return s.current()
+}
+
+// Verifies a token with the keys of a JWKS URL. When the token
+// references a key that is not known, the key set is fetched again,
+// unless it was fetched within the last minute.
+func (ks *KeySets) Verify(url, token string) (Claims, error) {
+	s := ks.get(url)
+	c, err := Verify(token, s.current())
+	if err != errUnknownKey {
+		return c, err
+	}
+
+	c, err = Verify(token, ks.fetchOnDemand(s))
+	if err != nil {
+		return nil, fmt.Errorf("%v, key set: %s", err, url)
+	}
+
+	return c, nil
+}
+
+func (ks *KeySets) refresh() {
+	ks.mx.Lock()
+	sets := make([]*keySet, 0, len(ks.sets))
+	for _, s := range ks.sets {
+		sets = append(sets, s)
+	}
+
+	ks.mx.Unlock()
+
+	for _, s := range sets {
+		ks.fetch(s)
+	}
+}
+
+func (ks *KeySets) run() {
+	for {
+		select {
+		case <-ks.clock.After(ks.interval):
+		case <-ks.quit:
+			return
+		}
+
+		ks.refresh()
+	}
+}
+
+// Starts refreshing the key sets, and fetches the ones already
+// referenced. Calling it again, or after Close, has no effect.
+func (ks *KeySets) Start() {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+
+	if ks.started {
+		return
+	}
+
+	ks.started = true
+	for _, s := range ks.sets {
+		go ks.fetch(s)
+	}
+
+	go ks.run()
+}
+
+func (ks *KeySets) closed() bool {
+	select {
+	case <-ks.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stops refreshing the key sets. The cached keys are kept, and fetched
+// on demand when a token references an unknown key.
+func (ks *KeySets) Close() {
+	ks.mx.Lock()
+	defer ks.mx.Unlock()
+
+	if !ks.closed() {
+		ks.started = true
+		close(ks.quit)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"github.com/zalando/skipper/clock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serves the key set set by the test, and counts the requests
+type keySetServer struct {
+	mx       sync.Mutex
+	keySet   []byte
+	requests int
+}
+
+func (s *keySetServer) set(keySet []byte) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.keySet = keySet
+}
+
+func (s *keySetServer) count() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests
+}
+
+func (s *keySetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.requests++
+	if s.keySet == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(s.keySet)
+}
+
+func waitForRequests(t *testing.T, s *keySetServer, n int) {
+	to := time.After(120 * time.Millisecond)
+	for s.count() < n {
+		select {
+		case <-to:
+			t.Fatal("timeout", s.count(), n)
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
+
+func TestFetchOnDemand(t *testing.T) {
+	s := &keySetServer{keySet: testKeySet()}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := clock.NewFake(time.Now())
+	ks := newKeySets(time.Hour, c)
+	defer ks.Close()
+
+	token := sign("RS256", "rsa", map[string]interface{}{"sub": "foo"})
+	if _, err := ks.Verify(server.URL, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.count() != 1 {
+		t.Fatal("failed to fetch the key set on demand", s.count())
+	}
+
+	if _, err := ks.Verify(server.URL, token); err != nil || s.count() != 1 {
+		t.Error("failed to use the cached keys", err, s.count())
+	}
+
+	unknown := sign("RS256", "rotated", map[string]interface{}{"sub": "foo"})
+	if _, err := ks.Verify(server.URL, unknown); err == nil || s.count() != 1 {
+		t.Error("failed to limit fetching on demand", err, s.count())
+	}
+
+	c.Add(minFetchInterval)
+	if _, err := ks.Verify(server.URL, unknown); err == nil || s.count() != 2 {
+		t.Error("failed to fetch on demand", err, s.count())
+	}
+}
+
+func TestFetchOnDemandConcurrently(t *testing.T) {
+	s := &keySetServer{keySet: testKeySet()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		s.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ks := newKeySets(time.Hour, clock.NewFake(time.Now()))
+	defer ks.Close()
+
+	unknown := sign("RS256", "rotated", map[string]interface{}{"sub": "foo"})
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ks.Verify(server.URL, unknown)
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	if s.count() != 1 {
+		t.Error("failed to fetch the key set once", s.count())
+	}
+}
+
+func TestKeepKeysOnFailure(t *testing.T) {
+	s := &keySetServer{keySet: testKeySet()}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := clock.NewFake(time.Now())
+	ks := newKeySets(time.Hour, c)
+	defer ks.Close()
+
+	ks.get(server.URL)
+	ks.Start()
+	waitForRequests(t, s, 1)
+
+	s.set(nil)
+	c.Add(time.Hour)
+	waitForRequests(t, s, 2)
+
+	token := sign("ES256", "ec", map[string]interface{}{"sub": "foo"})
+	if _, err := ks.Verify(server.URL, token); err != nil {
+		t.Error("failed to keep the keys", err)
+	}
+}
+
+func TestRefreshKeySets(t *testing.T) {
+	s := &keySetServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := clock.NewFake(time.Now())
+	ks := newKeySets(time.Hour, c)
+	defer ks.Close()
+
+	ks.Start()
+	ks.get(server.URL)
+	waitForRequests(t, s, 1)
+
+	token := sign("RS256", "rsa", map[string]interface{}{"sub": "foo"})
+	if _, err := ks.Verify(server.URL, token); err == nil {
+		t.Fatal("failed to fail")
+	}
+
+	s.set(testKeySet())
+	c.Add(time.Hour)
+	waitForRequests(t, s, 2)
+
+	// wait for the response to be processed
+	to := time.After(120 * time.Millisecond)
+	for {
+		if _, err := ks.Verify(server.URL, token); err == nil {
+			break
+		}
+
+		select {
+		case <-to:
+			t.Fatal("failed to refresh the key set")
+		case <-time.After(3 * time.Millisecond):
+		}
+	}
+}
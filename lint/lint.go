@@ -0,0 +1,325 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package lint checks route definitions for configuration that is valid
+eskip, but is likely to cause problems when serving requests, e.g. a
+route forwarding to a backend without a deadline, or a shunt route that
+always responds with 404.
+
+The checks are defined as rules. Each rule examines a single route, and
+reports its problems as findings, tagged with the rule name and the
+severity of the rule. The default rule set is used both by the eskip
+lint command, and by the optional startup check of skipper, that logs
+the findings of the routes loaded from the data clients.
+*/
+package lint
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+)
+
+// Severity of the findings.
+type Severity int
+
+const (
+
+	// The finding is worth a look, but it is not necessarily wrong.
+	Info Severity = iota
+
+	// The route is likely to misbehave.
+	Warning
+
+	// The route fails to be loaded or it doesn't work as expected.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// A Finding describes a problem of a route.
+type Finding struct {
+
+	// Id of the affected route.
+	RouteId string
+
+	// Name of the rule reporting the problem.
+	Rule string
+
+	// Severity of the rule reporting the problem.
+	Severity Severity
+
+	// Description of the problem.
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", f.RouteId, f.Severity, f.Message, f.Rule)
+}
+
+// A Rule checks a single route, and returns the description of each
+// problem found.
+type Rule struct {
+	Name     string
+	Severity Severity
+	Check    func(r *eskip.Route) []string
+}
+
+const (
+	MissingTimeoutName       = "missing-timeout"
+	InvalidRegexpName        = "invalid-regexp"
+	BacktrackingRegexpName   = "backtracking-regexp"
+	ShuntWithoutResponseName = "shunt-without-response"
+)
+
+// The filters that produce a response on their own, and make a shunt
+// route meaningful.
+var responseFilters = []string{
+	builtin.StaticName,
+	builtin.RedirectName,
+	builtin.HealthCheckName,
+}
+
+// The default rule set.
+var DefaultRules = []Rule{{
+	Name:     MissingTimeoutName,
+	Severity: Warning,
+	Check:    checkMissingTimeout,
+}, {
+	Name:     InvalidRegexpName,
+	Severity: Error,
+	Check:    checkInvalidRegexp,
+}, {
+	Name:     BacktrackingRegexpName,
+	Severity: Warning,
+	Check:    checkBacktrackingRegexp,
+}, {
+	Name:     ShuntWithoutResponseName,
+	Severity: Info,
+	Check:    checkShuntWithoutResponse,
+}}
+
+func hasFilter(r *eskip.Route, names ...string) bool {
+	for _, f := range r.Filters {
+		for _, n := range names {
+			if f.Name == n {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// returns the regular expressions of a route, with a short description
+// of where they are used
+func regexps(r *eskip.Route) (rxs []string, where []string) {
+	for _, rx := range r.HostRegexps {
+		rxs = append(rxs, rx)
+		where = append(where, "Host")
+	}
+
+	for _, rx := range r.PathRegexps {
+		rxs = append(rxs, rx)
+		where = append(where, "PathRegexp")
+	}
+
+	var names []string
+	for name := range r.HeaderRegexps {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		for _, rx := range r.HeaderRegexps[name] {
+			rxs = append(rxs, rx)
+			where = append(where, fmt.Sprintf("HeaderRegexp(%q)", name))
+		}
+	}
+
+	return
+}
+
+// Routes with a network backend are expected to set a deadline for the
+// backend requests, otherwise a hanging backend holds the connections
+// of the clients.
+func checkMissingTimeout(r *eskip.Route) []string {
+	if r.Shunt || r.Loopback || hasFilter(r, builtin.DeadlineName) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("route forwarding to a backend without a %s filter", builtin.DeadlineName)}
+}
+
+// The routing drops the routes with invalid regular expressions.
+func checkInvalidRegexp(r *eskip.Route) []string {
+	var messages []string
+	rxs, where := regexps(r)
+	for i, rx := range rxs {
+		if _, err := regexp.Compile(rx); err != nil {
+			messages = append(messages, fmt.Sprintf("invalid regular expression in %s: %v", where[i], err))
+		}
+	}
+
+	return messages
+}
+
+func unbounded(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max < 0
+	default:
+		return false
+	}
+}
+
+// checks if an expression can be matched only by repeating an
+// unbounded repetition, without any mandatory separator, e.g. a+ in
+// (a+)+ or (a|b+)*
+func repetitionOnly(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpCapture:
+		return repetitionOnly(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if repetitionOnly(sub) {
+				return true
+			}
+		}
+
+		return false
+	case syntax.OpConcat:
+		var found bool
+		for _, sub := range re.Sub {
+			switch {
+			case repetitionOnly(sub):
+				found = true
+			case sub.Op == syntax.OpQuest, sub.Op == syntax.OpEmptyMatch:
+			default:
+				return false
+			}
+		}
+
+		return found
+	default:
+		return unbounded(re)
+	}
+}
+
+// checks if an unbounded repetition repeats another unbounded
+// repetition without a separator
+func nestedRepetition(re *syntax.Regexp) bool {
+	if unbounded(re) && repetitionOnly(re.Sub[0]) {
+		return true
+	}
+
+	for _, sub := range re.Sub {
+		if nestedRepetition(sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Nested unbounded repetitions without a separator, like (a+)+, are the typical cause of
+// catastrophic backtracking. The regexp engine of skipper matches in
+// linear time, but these expressions are still expensive to evaluate,
+// and they usually mean a mistake, or a copy from a configuration
+// made for a backtracking engine.
+func checkBacktrackingRegexp(r *eskip.Route) []string {
+	var messages []string
+	rxs, where := regexps(r)
+	for i, rx := range rxs {
+		re, err := syntax.Parse(rx, syntax.Perl)
+		if err != nil {
+			continue
+		}
+
+		if nestedRepetition(re) {
+			messages = append(messages, fmt.Sprintf("nested repetition in %s: %s", where[i], rx))
+		}
+	}
+
+	return messages
+}
+
+// Without a filter producing the response, a shunt route always
+// responds with 404 Not Found.
+func checkShuntWithoutResponse(r *eskip.Route) []string {
+	if !r.Shunt || hasFilter(r, responseFilters...) {
+		return nil
+	}
+
+	return []string{"shunt route without a filter producing the response, it always responds with 404"}
+}
+
+// Checks the routes with the provided rules, and returns the findings
+// in the order of the routes and the rules. When rules is nil, the
+// DefaultRules are used.
+func Lint(routes []*eskip.Route, rules []Rule) []Finding {
+	if rules == nil {
+		rules = DefaultRules
+	}
+
+	var findings []Finding
+	for _, r := range routes {
+		for _, rule := range rules {
+			for _, m := range rule.Check(r) {
+				findings = append(findings, Finding{
+					RouteId:  r.Id,
+					Rule:     rule.Name,
+					Severity: rule.Severity,
+					Message:  m,
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// Returns the highest severity of the findings, and false if there
+// are no findings.
+func MaxSeverity(findings []Finding) (Severity, bool) {
+	if len(findings) == 0 {
+		return Info, false
+	}
+
+	max := Info
+	for _, f := range findings {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+
+	return max, true
+}
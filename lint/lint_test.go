@@ -0,0 +1,113 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		routes   string
+		expected []Finding
+	}{{
+		"no problems",
+		`route1: Path("/") -> deadline("3s") -> "https://www.example.org";
+		route2: Path("/static") -> static("/", "/var/www") -> <shunt>;
+		route3: Path("/health") -> healthcheck() -> <shunt>`,
+		nil,
+	}, {
+		"missing timeout",
+		`route1: Path("/") -> "https://www.example.org"`,
+		[]Finding{{"route1", MissingTimeoutName, Warning, "route forwarding to a backend without a deadline filter"}},
+	}, {
+		"invalid regexp",
+		`route1: PathRegexp(/[/) -> static("/", "/var/www") -> <shunt>`,
+		[]Finding{{"route1", InvalidRegexpName, Error, "invalid regular expression in PathRegexp: error parsing regexp: missing closing ]: `[`"}},
+	}, {
+		"backtracking regexps",
+		`route1: Host(/(a+)+[.]example[.]org/) && HeaderRegexp("X-Foo", /(.*)*/) -> deadline("3s") -> "https://www.example.org"`,
+		[]Finding{
+			{"route1", BacktrackingRegexpName, Warning, "nested repetition in Host: (a+)+[.]example[.]org"},
+			{"route1", BacktrackingRegexpName, Warning, `nested repetition in HeaderRegexp("X-Foo"): (.*)*`},
+		},
+	}, {
+		"repetition with separator",
+		`route1: Host(/^([a-z]+[.])+example[.]org$/) -> deadline("3s") -> "https://www.example.org"`,
+		nil,
+	}, {
+		"shunt without response",
+		`route1: Path("/") -> requestHeader("X-Foo", "bar") -> <shunt>`,
+		[]Finding{{"route1", ShuntWithoutResponseName, Info, "shunt route without a filter producing the response, it always responds with 404"}},
+	}} {
+		routes, err := eskip.Parse(ti.routes)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		findings := Lint(routes, nil)
+		if len(findings) != len(ti.expected) {
+			t.Error(ti.msg, "invalid number of findings", findings)
+			continue
+		}
+
+		for i, f := range findings {
+			if f != ti.expected[i] {
+				t.Error(ti.msg, "invalid finding", f, ti.expected[i])
+			}
+		}
+	}
+}
+
+func TestLintCustomRules(t *testing.T) {
+	rules := []Rule{{
+		Name:     "no-method",
+		Severity: Error,
+		Check: func(r *eskip.Route) []string {
+			if r.Method == "" {
+				return []string{"route without method"}
+			}
+
+			return nil
+		},
+	}}
+
+	routes := eskip.MustParse(`route1: Method("GET") -> "https://www.example.org"; route2: Path("/") -> <shunt>`)
+	findings := Lint(routes, rules)
+	if len(findings) != 1 || findings[0].RouteId != "route2" || findings[0].Rule != "no-method" {
+		t.Error("invalid findings", findings)
+	}
+}
+
+func TestMaxSeverity(t *testing.T) {
+	if _, ok := MaxSeverity(nil); ok {
+		t.Error("failed to report no findings")
+	}
+
+	s, ok := MaxSeverity([]Finding{{Severity: Info}, {Severity: Error}, {Severity: Warning}})
+	if !ok || s != Error {
+		t.Error("invalid max severity", s)
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	f := Finding{"route1", MissingTimeoutName, Warning, "missing deadline"}
+	if s := f.String(); s != "route1: warning: missing deadline (missing-timeout)" {
+		t.Error("invalid string", s)
+	}
+}
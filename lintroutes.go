@@ -0,0 +1,53 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skipper
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/lint"
+	"github.com/zalando/skipper/routing"
+)
+
+// data client logging the lint findings of the routes loaded by the
+// wrapped client
+type lintClient struct {
+	routing.DataClient
+}
+
+func logFindings(routes []*eskip.Route) {
+	for _, f := range lint.Lint(routes, nil) {
+		switch f.Severity {
+		case lint.Error:
+			log.Error(f)
+		case lint.Warning:
+			log.Warn(f)
+		default:
+			log.Info(f)
+		}
+	}
+}
+
+func (c *lintClient) LoadAll() ([]*eskip.Route, error) {
+	routes, err := c.DataClient.LoadAll()
+	logFindings(routes)
+	return routes, err
+}
+
+func (c *lintClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	routes, deletedIds, err := c.DataClient.LoadUpdate()
+	logFindings(routes)
+	return routes, deletedIds, err
+}
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"net"
@@ -15,11 +16,42 @@ const (
 	// remote_host - - [date] "method uri protocol" status response_size "referer" "user_agent"
 	combinedLogFormat = commonLogFormat + ` "%s" "%s"`
 	// We add the duration in ms
-	accessLogFormat = combinedLogFormat + " %d\n"
+	accessLogFormat = combinedLogFormat + " %d"
+	// We add the route id, the checksum of the response body, the path
+	// template, the category of the request, the backend and the
+	// upstream duration in ms, with "-" when not known, to keep the
+	// columns fixed
+	routeLogFormat = ` "%s" "%s" "%s" "%s" "%s" %s`
+	// We add the selected headers at the end, with "-" when not set
+	headerLogFormat = ` %q`
+)
+
+// The formats of the access log.
+const (
+
+	// Apache combined log format, extended with the duration. This is
+	// the default.
+	AccessLogCombined = "combined"
+
+	// Apache combined log format, extended with the duration and the
+	// route details.
+	AccessLogExtended = "extended"
+
+	// JSON object per line.
+	AccessLogJSON = "json"
 )
 
 type accessLogFormatter struct {
-	format string
+	format       string
+	routeColumns bool
+}
+
+type jsonAccessLogFormatter struct{}
+
+// a request header selected for the access log
+type accessLogHeader struct {
+	name  string
+	value string
 }
 
 // Access log entry.
@@ -39,9 +71,35 @@ type AccessEntry struct {
 
 	// The time that the request was received.
 	RequestTime time.Time
+
+	// The id of the route that handled the request.
+	RouteId string
+
+	// The path template of the route, e.g. /users/:id, that can be
+	// used instead of the raw path to group the entries.
+	PathTemplate string
+
+	// The checksum of the response body, when checksums are enabled
+	// in the proxy.
+	Checksum string
+
+	// The category of the request, set by the classify filter.
+	Category string
+
+	// The backend that the request was forwarded to, in the form of
+	// scheme://host, when the route has a network backend.
+	Backend string
+
+	// The time spent waiting for the response of the backend.
+	BackendDuration time.Duration
 }
 
-var accessLog *logrus.Logger
+var (
+	accessLog *logrus.Logger
+
+	// the request headers selected for the access log
+	accessLogHeaders []string
+)
 
 // strip port from addresses with hostname, ipv4 or ipv6
 func stripPort(address string) string {
@@ -73,6 +131,15 @@ func remoteHost(r *http.Request) string {
 	return "-"
 }
 
+// returns a string field of the entry, or "-" when it is empty
+func fieldOrDash(e *logrus.Entry, key string) string {
+	if v, _ := e.Data[key].(string); v != "" {
+		return v
+	}
+
+	return "-"
+}
+
 func (f *accessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	keys := []string{
 		"host", "timestamp", "method", "uri", "proto",
@@ -83,10 +150,78 @@ func (f *accessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
 		values[i] = e.Data[key]
 	}
 
-	return []byte(fmt.Sprintf(f.format, values...)), nil
+	line := fmt.Sprintf(f.format, values...)
+	if f.routeColumns {
+		upstreamDuration := "-"
+		if backend, _ := e.Data["backend"].(string); backend != "" {
+			upstreamDuration = fmt.Sprint(e.Data["upstream-duration"])
+		}
+
+		line += fmt.Sprintf(
+			routeLogFormat,
+			fieldOrDash(e, "route-id"),
+			fieldOrDash(e, "checksum"),
+			fieldOrDash(e, "path-template"),
+			fieldOrDash(e, "category"),
+			fieldOrDash(e, "backend"),
+			upstreamDuration)
+	}
+
+	headers, _ := e.Data["headers"].([]accessLogHeader)
+	for _, h := range headers {
+		v := h.value
+		if v == "" {
+			v = "-"
+		}
+
+		line += fmt.Sprintf(headerLogFormat, v)
+	}
+
+	return []byte(line + "\n"), nil
 }
 
-// Logs an access event in Apache combined log format (with a minor customization with the duration).
+// formats the entries as JSON objects, leaving out the empty optional
+// fields
+func (f *jsonAccessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	o := make(map[string]interface{})
+	for _, key := range []string{"method", "uri", "proto", "status", "response-size", "duration"} {
+		o[key] = e.Data[key]
+	}
+
+	if t, ok := e.Data["request-time"].(time.Time); ok {
+		o["timestamp"] = t.Format(time.RFC3339Nano)
+	}
+
+	o["host"] = e.Data["host"]
+	for _, key := range []string{"referer", "user-agent", "route-id", "checksum", "path-template", "category", "backend"} {
+		if v, _ := e.Data[key].(string); v != "" {
+			o[key] = v
+		}
+	}
+
+	if backend, _ := e.Data["backend"].(string); backend != "" {
+		o["upstream-duration"] = e.Data["upstream-duration"]
+	}
+
+	if headers, _ := e.Data["headers"].([]accessLogHeader); len(headers) > 0 {
+		h := make(map[string]string)
+		for _, hi := range headers {
+			h[hi.name] = hi.value
+		}
+
+		o["headers"] = h
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// Logs an access event in Apache combined log format (with a minor customization with the duration),
+// or in JSON format, depending on the initialization options.
 func LogAccess(entry *AccessEntry) {
 	if accessLog == nil || entry == nil {
 		return
@@ -105,6 +240,7 @@ func LogAccess(entry *AccessEntry) {
 	responseSize := entry.ResponseSize
 	duration := int64(entry.Duration / time.Millisecond)
 
+	var headers []accessLogHeader
 	if entry.Request != nil {
 		host = remoteHost(entry.Request)
 		method = entry.Request.Method
@@ -114,15 +250,32 @@ func LogAccess(entry *AccessEntry) {
 		userAgent = entry.Request.UserAgent()
 	}
 
+	for _, name := range accessLogHeaders {
+		var value string
+		if entry.Request != nil {
+			value = entry.Request.Header.Get(name)
+		}
+
+		headers = append(headers, accessLogHeader{name, value})
+	}
+
 	accessLog.WithFields(logrus.Fields{
-		"timestamp":     ts,
-		"host":          host,
-		"method":        method,
-		"uri":           uri,
-		"proto":         proto,
-		"referer":       referer,
-		"user-agent":    userAgent,
-		"status":        status,
-		"response-size": responseSize,
-		"duration":      duration}).Infoln()
+		"request-time":      entry.RequestTime,
+		"timestamp":         ts,
+		"host":              host,
+		"method":            method,
+		"uri":               uri,
+		"proto":             proto,
+		"referer":           referer,
+		"user-agent":        userAgent,
+		"status":            status,
+		"response-size":     responseSize,
+		"duration":          duration,
+		"route-id":          entry.RouteId,
+		"checksum":          entry.Checksum,
+		"path-template":     entry.PathTemplate,
+		"category":          entry.Category,
+		"backend":           entry.Backend,
+		"upstream-duration": int64(entry.BackendDuration / time.Millisecond),
+		"headers":           headers}).Infoln()
 }
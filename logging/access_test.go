@@ -31,8 +31,12 @@ func testAccessEntry() *AccessEntry {
 }
 
 func testAccessLog(t *testing.T, entry *AccessEntry, expectedOutput string) {
+	testAccessLogFormat(t, AccessLogCombined, entry, expectedOutput)
+}
+
+func testAccessLogFormat(t *testing.T, format string, entry *AccessEntry, expectedOutput string) {
 	var buf bytes.Buffer
-	Init(Options{AccessLogOutput: &buf})
+	Init(Options{AccessLogOutput: &buf, AccessLogFormat: format})
 	LogAccess(entry)
 	got := buf.String()
 	if got != "" {
@@ -83,3 +87,85 @@ func TestMissingHostFallback(t *testing.T) {
 	entry.Request.RemoteAddr = ""
 	testAccessLog(t, entry, `- - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 418 2326 "" "" 42`)
 }
+
+func TestAccessLogRouteInfo(t *testing.T) {
+	entry := testAccessEntry()
+	entry.RouteId = "route1"
+	entry.Checksum = "1c291ca3"
+	entry.PathTemplate = "/users/:id"
+	testAccessLogFormat(t, AccessLogExtended, entry, logOutput+` "route1" "1c291ca3" "/users/:id" "-" "-" -`)
+}
+
+func TestAccessLogCategory(t *testing.T) {
+	entry := testAccessEntry()
+	entry.RouteId = "route1"
+	entry.PathTemplate = "/checkout"
+	entry.Category = "checkout"
+	testAccessLogFormat(t, AccessLogExtended, entry, logOutput+` "route1" "-" "/checkout" "checkout" "-" -`)
+}
+
+func TestAccessLogBackend(t *testing.T) {
+	entry := testAccessEntry()
+	entry.RouteId = "route1"
+	entry.PathTemplate = "/"
+	entry.Backend = "https://www.example.org"
+	entry.BackendDuration = 36 * time.Millisecond
+	testAccessLogFormat(t, AccessLogExtended, entry, logOutput+` "route1" "-" "/" "-" "https://www.example.org" 36`)
+}
+
+func TestAccessLogCombinedWithoutRouteInfo(t *testing.T) {
+	entry := testAccessEntry()
+	entry.RouteId = "route1"
+	entry.PathTemplate = "/"
+	entry.Backend = "https://www.example.org"
+	testAccessLog(t, entry, logOutput)
+}
+
+func TestAccessLogFixedColumns(t *testing.T) {
+	entry := testAccessEntry()
+	entry.Backend = "https://www.example.org"
+	entry.BackendDuration = 36 * time.Millisecond
+	testAccessLogFormat(t, AccessLogExtended, entry, logOutput+` "-" "-" "-" "-" "https://www.example.org" 36`)
+}
+
+func TestAccessLogHeaders(t *testing.T) {
+	entry := testAccessEntry()
+	entry.Request.Header.Set("X-Request-Id", "abc\"42")
+
+	var buf bytes.Buffer
+	Init(Options{AccessLogOutput: &buf, AccessLogHeaders: []string{"X-Request-Id", "X-Missing"}})
+	defer Init(Options{})
+
+	LogAccess(entry)
+	expected := logOutput + ` "abc\"42" "-"` + "\n"
+	if buf.String() != expected {
+		t.Error("got wrong access log.")
+		t.Log("expected:", expected)
+		t.Log("got     :", buf.String())
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	entry := testAccessEntry()
+	entry.RouteId = "route1"
+	entry.Backend = "https://www.example.org"
+	entry.BackendDuration = 36 * time.Millisecond
+	entry.Request.Header.Set("X-Request-Id", "abc")
+
+	var buf bytes.Buffer
+	Init(Options{
+		AccessLogOutput:  &buf,
+		AccessLogFormat:  AccessLogJSON,
+		AccessLogHeaders: []string{"X-Request-Id"}})
+	defer Init(Options{})
+
+	LogAccess(entry)
+	expected := `{"backend":"https://www.example.org","duration":42,"headers":{"X-Request-Id":"abc"},` +
+		`"host":"127.0.0.1","method":"GET","proto":"HTTP/1.1","response-size":2326,"route-id":"route1",` +
+		`"status":418,"timestamp":"2000-10-10T13:55:36-07:00","upstream-duration":36,"uri":"/apache_pb.gif"}` + "\n"
+	if buf.String() != expected {
+		t.Error("got wrong access log.")
+		t.Log("expected:", expected)
+		t.Log("got     :", buf.String())
+	}
+}
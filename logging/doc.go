@@ -1,6 +1,6 @@
 /*
 Package logging implements application log instrumentation and Apache
-combined access log.
+combined or JSON access log.
 
 Application Log
 
@@ -29,16 +29,48 @@ The access log prints HTTP access information in the Apache combined
 access log format. To output entries, use the logging.Access method.
 Note that by default, skipper uses the loggingHandler to wrap the
 central proxy handler, and automatically provides access logging.
+The entries are extended with the duration of the request in
+milliseconds, and the values of the request headers selected with the
+AccessLogHeaders option, quoted, in the configured order.
+
+With the AccessLogFormat option set to "extended", the duration is
+followed by these columns, always in the same order, with "-" when the
+value is not known: the id of the matching route, the CRC-32 checksum
+of the response body, when enabled in the proxy, the path template of
+the route, the category of the request, the backend and the upstream
+latency. The path template is the
+path condition of the route, e.g. /users/:id, or the value set by the
+pathTemplate filter, and it can be used to group the entries without
+the high cardinality of the raw paths. The category is set by the
+classify filter. The backend is the scheme and host of the network
+backend that the request was forwarded to, and the upstream latency is
+the time in milliseconds spent waiting for its response headers. The
+selected headers are appended after them, e.g.:
+
+    10.0.0.1 - - [01/Jun/2016:10:00:00 +0000] "GET /users/1 HTTP/1.1" 200 512 "" "curl/7.43.0" 12 "api" "-" "/users/:id" "-" "https://api.example.org" 10 "abc"
+
+With the AccessLogFormat option set to "json", each entry is printed as
+a JSON object on a single line, with the same fields, e.g.:
+
+    {"backend":"https://api.example.org","duration":12,"headers":
+    {"X-Request-Id":"abc"},"host":"10.0.0.1","method":"GET","proto":
+    "HTTP/1.1","response-size":512,"route-id":"api","status":200,
+    "timestamp":"2016-06-01T10:00:00Z","upstream-duration":10,"uri":
+    "/users/1"}
+
+The empty optional fields are left out.
 
 During initialization, it is possible to redirect the access log output
-from the default /dev/stderr to another file, or completely disable the
-access log.
+from the default /dev/stderr to another file or to any io.Writer, or
+completely disable the access log.
 
 Output Files
 
-To set a custom file output for the application log or the access log is
-currently not recommended in production environment, because neither the
-proper handling of system errors, or a log rolling mechanism is
-implemented at the current stage.
+To write the access log to a file, use the RotatingFile type. It appends
+to the file, and, when configured with a maximum size, it renames the
+file before the size would be exceeded, keeping the configured number of
+older files with the suffixes .1, .2, etc. Writing the application log
+to a custom file is currently not recommended in production
+environment, because no log rolling mechanism is implemented for it.
 */
 package logging
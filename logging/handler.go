@@ -30,6 +30,13 @@ func (lh *loggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		StatusCode:   lw.code,
 		RequestTime:  now,
 		Duration:     dur,
+		RouteId:      lw.routeId,
+		PathTemplate: lw.pathTemplate,
+		Checksum:     lw.checksum,
+		Category:     lw.category,
+
+		Backend:         lw.backend,
+		BackendDuration: lw.backendTime,
 	}
 	LogAccess(entry)
 }
@@ -29,6 +29,15 @@ type Options struct {
 
 	// When set, no access log is printed.
 	AccessLogDisabled bool
+
+	// Format of the access log entries, AccessLogCombined,
+	// AccessLogExtended or AccessLogJSON. Defaults to
+	// AccessLogCombined.
+	AccessLogFormat string
+
+	// Request headers whose values are included in the access log
+	// entries.
+	AccessLogHeaders []string
 }
 
 func (f *prefixFormatter) Format(e *logrus.Entry) ([]byte, error) {
@@ -51,9 +60,17 @@ func initApplicationLog(prefix string, output io.Writer) {
 	}
 }
 
-func initAccessLog(output io.Writer) {
+func initAccessLog(format string, output io.Writer) {
 	l := logrus.New()
-	l.Formatter = &accessLogFormatter{accessLogFormat}
+	switch format {
+	case AccessLogJSON:
+		l.Formatter = &jsonAccessLogFormatter{}
+	case AccessLogExtended:
+		l.Formatter = &accessLogFormatter{accessLogFormat, true}
+	default:
+		l.Formatter = &accessLogFormatter{accessLogFormat, false}
+	}
+
 	l.Out = output
 	l.Level = logrus.InfoLevel
 	accessLog = l
@@ -70,6 +87,7 @@ func Init(o Options) {
 			o.AccessLogOutput = os.Stderr
 		}
 
-		initAccessLog(o.AccessLogOutput)
+		accessLogHeaders = o.AccessLogHeaders
+		initAccessLog(o.AccessLogFormat, o.AccessLogOutput)
 	}
 }
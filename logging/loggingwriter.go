@@ -1,11 +1,25 @@
 package logging
 
-import "net/http"
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+var errHijackNotSupported = errors.New("hijacking not supported by the response writer")
 
 type loggingWriter struct {
-	writer http.ResponseWriter
-	code   int
-	bytes  int64
+	writer       http.ResponseWriter
+	code         int
+	bytes        int64
+	routeId      string
+	pathTemplate string
+	checksum     string
+	category     string
+	backend      string
+	backendTime  time.Duration
 }
 
 func (lw *loggingWriter) Write(data []byte) (count int, err error) {
@@ -29,3 +43,36 @@ func (lw *loggingWriter) Header() http.Header {
 func (lw *loggingWriter) Flush() {
 	lw.writer.(http.Flusher).Flush()
 }
+
+// Used by the proxy to take over the client connection, when the backend
+// accepted an upgrade request, e.g. a websocket request.
+func (lw *loggingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := lw.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackNotSupported
+	}
+
+	conn, brw, err := h.Hijack()
+	if err == nil {
+		lw.code = http.StatusSwitchingProtocols
+	}
+
+	return conn, brw, err
+}
+
+// Used by the proxy to report the route, the path template, the
+// checksum of the response body and the category of the request for the
+// access log.
+func (lw *loggingWriter) SetRouteInfo(routeId, pathTemplate, checksum, category string) {
+	lw.routeId = routeId
+	lw.pathTemplate = pathTemplate
+	lw.checksum = checksum
+	lw.category = category
+}
+
+// Used by the proxy to report the backend that the request was forwarded
+// to, and the time spent waiting for its response.
+func (lw *loggingWriter) SetBackendInfo(backend string, d time.Duration) {
+	lw.backend = backend
+	lw.backendTime = d
+}
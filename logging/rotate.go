@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var errFileClosed = errors.New("file closed")
+
+// RotatingFile is an io.WriteCloser appending to a file, that rotates
+// the file when its size would exceed a limit. On rotation, the file is
+// renamed with the suffix .1, the existing backups are shifted by one,
+// and the oldest backup above the configured count is dropped.
+type RotatingFile struct {
+	mx         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingFile opens or creates the file at path for appending. When
+// maxSize is 0, the file is never rotated. When maxBackups is 0, the
+// rotated content is discarded.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		os.Remove(backupName(f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i > 0; i-- {
+			err := os.Rename(backupName(f.path, i), backupName(f.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if err := os.Rename(f.path, backupName(f.path, 1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return f.open()
+}
+
+// Write appends p to the file, rotating it first when the size limit
+// would be exceeded. A single write is never split between files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.file == nil {
+		return 0, errFileClosed
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file regardless of its size.
+func (f *RotatingFile) Rotate() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.file == nil {
+		return errFileClosed
+	}
+
+	return f.rotate()
+}
+
+// Close closes the underlying file.
+func (f *RotatingFile) Close() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
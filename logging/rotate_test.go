@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skipper-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "access.log")
+	f, err := NewRotatingFile(p, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	for _, line := range []string{"0123\n", "4567\n", "89ab\n", "cdef\n", "ghij\n", "klmn\n", "opqr\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]string{
+		p:        "opqr\n",
+		p + ".1": "ghij\nklmn\n",
+		p + ".2": "89ab\ncdef\n",
+	} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if string(b) != expected {
+			t.Error("invalid file content", name, string(b))
+		}
+	}
+
+	if _, err := os.Stat(p + ".3"); !os.IsNotExist(err) {
+		t.Error("failed to drop the oldest backup")
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skipper-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(p, []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewRotatingFile(p, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Write([]byte("bar\n"))
+	f.Close()
+
+	if _, err := f.Write([]byte("baz\n")); err == nil {
+		t.Error("failed to fail after close")
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil || string(b) != "foo\nbar\n" {
+		t.Error("failed to append", err, string(b))
+	}
+}
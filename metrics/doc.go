@@ -21,6 +21,90 @@ metrics and other systems if you aggregate them later in some monitoring system.
 You can also enable some Go garbage collector and runtime metrics using EnableDebugGcMetrics and EnableRuntimeMetrics,
 respectively.
 
+Besides the timers, the size of the response bodies is collected per route, and the truncated responses are counted
+per route and reason: "closedearly", when the backend closed the connection before sending the complete body, and
+"lengthmismatch", when the body didn't match the Content-Length header.
+
+The response times are also measured per path template, e.g. response.200.GET.path./users/:id, when the route has a
+path condition or the path template is set by the pathTemplate filter, so that the metrics can be grouped by the path
+patterns without the cardinality of the raw paths. When the request was classified by the classify filter, the response
+times are measured per category, too, e.g. response.200.POST.category.checkout.
+
+When the proxy is configured with a body buffering threshold, the filters reading the request or response bodies
+beyond it are counted per filter and direction, e.g. filter.compressRequest.buffered.request.
+
+When the in-flight requests or the open backend connections are capped, their current number is reported by the
+saturation.inflightrequests and saturation.backendconnections gauges, while the requests rejected due to the caps
+are counted by rejected.inflightrequests and rejected.backendconnections.
+
+When a shadow routing table is evaluated for comparison, the results are counted by shadowrouting.same,
+shadowrouting.route, when only the matched route differs from the live one, and shadowrouting.backend, when the
+backend differs, too.
+
+The results of the synthetic checks are counted by synthetic.<name>.passed and synthetic.<name>.failed, and the
+duration of their internal requests is measured by synthetic.<name>.latency.
+
+The active upgraded connections, e.g. websocket connections, are reported per route by the upgrades.<route>.active
+gauge, and their durations are measured per protocol and route, e.g. upgrades.websocket.<route>.duration. The upgrade
+requests rejected, because the route reached the cap set by the websocketLimits filter, are counted by
+upgrades.<route>.rejected. The bytes sent over the upgraded connections are measured by the side that sent them, by
+upgrades.client.<route>.bytes and upgrades.backend.<route>.bytes, and the connections closed by the idle timeout
+are counted by upgrades.<route>.idletimeout.
+
+The time that the responses of a route spend waiting for their share of the global or the route's response bandwidth
+is measured by bandwidth.<route>.wait.
+
+The requests rejected by the rate limits are counted per group by ratelimit.<group>.rejected.
+
+The circuit breakers count their openings by circuitbreaker.<key>.opened, and the requests rejected while they are open
+by circuitbreaker.<key>.rejected, where the key is the backend host or the route id, depending on the scope of the
+breaker.
+
+The ejections of the load balancer members, by consecutive failed requests, are counted per route by
+loadbalancer.<route>.ejected.
+
+The health of the backend hosts checked by the active health checks is reported by the healthcheck.<host>.healthy
+gauges, 1 when healthy and 0 when down, and the hosts marked down are counted by healthcheck.<host>.down.
+
+The requests handled by the cache filter are counted per route by cache.<route>.hit, cache.<route>.stale,
+cache.<route>.revalidated and cache.<route>.miss.
+
+The requests copied to a shadow backend by the mirror filter are counted per route by mirror.<route>.sent,
+mirror.<route>.skipped, when the concurrency limit was reached, and mirror.<route>.failed.
+
+The retried backend requests are counted per route by retries.<route>, and the requests not retried, because the retry
+budget was exhausted, by retries.<route>.budgetexhausted.
+
+The backend requests are also measured per backend host, e.g. backendhost.api.example.org. The open client
+connections of the proxy listener are reported by the connections.active gauge. The processing of the routing table
+updates is measured by routingupdate, the number of the active routes is reported by the routes gauge, and the route
+definitions rejected during the updates are counted by routingupdate.failed.
+
+Prometheus
+
+With the PrometheusListener option, the measurements are served in the Prometheus text exposition format on the
+/metrics endpoint of a dedicated listener, either instead of, or in addition to the built-in JSON listener. The
+durations are reported in seconds, in histograms, and the well-known keys are mapped to metric names with labels,
+e.g.:
+
+	skipper_requests_total{code="200",method="GET",route="foo"}
+	skipper_response_duration_seconds_bucket{code="200",method="GET",route="foo",le="0.1"}
+	skipper_backend_host_duration_seconds_count{host="api.example.org"}
+	skipper_filter_duration_seconds_sum{filter="compress",phase="response"}
+	skipper_active_connections
+	skipper_routing_update_duration_seconds_count
+
+The rest of the keys are exposed with a name derived from the key, e.g. skipper_retries_foo_total. The embedding
+applications can create the Prometheus backend with NewPrometheus, and pass it in the Prometheus option, to gather its
+metric families for their own endpoint, or to register their own collectors in it.
+
+Custom Metrics
+
+The measurements can be reported to other systems, by implementing the Metrics interface, and setting it in
+Options.Custom, or in the CustomMetrics field of the skipper options. In this case, the built-in registry and the
+listener are not started. The implementations receive the same keys as listed above, without the prefix, and they
+need to be safe for concurrent use.
+
 REST API
 
 This listener accepts GET requests on the /metrics endpoint like any other REST api. A request to "/metrics" should
@@ -5,12 +5,37 @@ import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/skipper/upgrade"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type skipperMetrics map[string]interface{}
 
+// Metrics is the interface of the metrics backends. The proxy, the
+// routing and the filters report their measurements with the functions
+// of this package, that format the keys, and pass the measurements to
+// the backend set with Init. Custom implementations can ship the
+// metrics to other systems.
+type Metrics interface {
+
+	// Records a duration, e.g. a response time.
+	UpdateTimer(key string, d time.Duration)
+
+	// Records a value in a distribution, e.g. a response size.
+	UpdateHistogram(key string, value int64)
+
+	// Sets the current value of a gauge.
+	UpdateGauge(key string, value int64)
+
+	// Increments a counter by one.
+	IncCounter(key string)
+}
+
 // Options for initializing metrics collection.
 type Options struct {
 	// Network address where the current metrics values
@@ -29,6 +54,26 @@ type Options struct {
 	// If set, Go runtime metrics are collected in
 	// addition to the http traffic metrics.
 	EnableRuntimeMetrics bool
+
+	// Custom metrics implementation. If set, the measurements are
+	// reported to it, and the other options are ignored.
+	Custom Metrics
+
+	// When set, listening is retried while the address is held by
+	// the previous process of an in-place upgrade, draining its
+	// connections until this timeout.
+	UpgradeDrainTimeout time.Duration
+
+	// Network address where the metrics are served in the Prometheus
+	// text exposition format, on the /metrics endpoint. It can be set
+	// together with Listener.
+	PrometheusListener string
+
+	// Prometheus backend receiving the measurements, e.g. one whose
+	// families are merged into the metrics of an embedding
+	// application. When not set, and PrometheusListener is set, a new
+	// one is created.
+	Prometheus *Prometheus
 }
 
 const (
@@ -39,17 +84,154 @@ const (
 	KeyFilterResponse  = "filter.%s.response"
 	KeyFiltersResponse = "allfilters.response.%s"
 	KeyResponse        = "response.%d.%s.skipper.%s"
+	KeyResponseSize    = "responsesize.%s"
+	KeyTruncated       = "truncated.%s.%s"
+	KeyRouteExpired    = "routeexpired.%s"
+	KeyPathResponse    = "response.%d.%s.path.%s"
+	KeyCatResponse     = "response.%d.%s.category.%s"
+	KeyUnmatched       = "unmatched.%s"
+	KeyFilterBuffered  = "filter.%s.buffered.%s"
+	KeySaturation      = "saturation.%s"
+	KeyRejected        = "rejected.%s"
+	KeyCanaryVerdict   = "canary.%s.verdict"
+	KeyCanarySuccess   = "canary.%s.%s.successrate"
+	KeyCanaryLatency   = "canary.%s.%s.latency"
+	KeyCanaryRollback  = "canary.%s.rollback"
+	KeyShadowRouting   = "shadowrouting.%s"
+	KeySyntheticPassed = "synthetic.%s.passed"
+	KeySyntheticFailed = "synthetic.%s.failed"
+	KeySyntheticTime   = "synthetic.%s.latency"
+	KeyUpgradesActive  = "upgrades.%s.active"
+	KeyUpgradeDuration = "upgrades.%s.%s.duration"
+	KeyUpgradeRejected = "upgrades.%s.rejected"
+	KeyUpgradeBytes    = "upgrades.%s.%s.bytes"
+	KeyUpgradeIdle     = "upgrades.%s.idletimeout"
+	KeyBandwidthWait   = "bandwidth.%s.wait"
+	KeyRatelimited     = "ratelimit.%s.rejected"
+	KeyBreakerOpened   = "circuitbreaker.%s.opened"
+	KeyBreakerRejected = "circuitbreaker.%s.rejected"
+	KeyLBEjected       = "loadbalancer.%s.ejected"
+	KeyHealthCheck     = "healthcheck.%s.healthy"
+	KeyHealthCheckDown = "healthcheck.%s.down"
+	KeyRetry           = "retries.%s"
+	KeyRetryExhausted  = "retries.%s.budgetexhausted"
+	KeyChaosInjected   = "chaos.%s.%s"
+	KeyMirror          = "mirror.%s.%s"
+	KeyCache           = "cache.%s.%s"
+	KeyBackendHost     = "backendhost.%s"
+	KeyConnections     = "connections.active"
+	KeyRoutingUpdate   = "routingupdate"
+	KeyRoutingFailed   = "routingupdate.failed"
+	KeyRoutes          = "routes"
+
+	// Host label used for the unmatched requests, when the number of
+	// the tracked hosts reached the limit.
+	UnmatchedOtherHost = "_other"
 
 	statsRefreshDuration = time.Duration(5 * time.Second)
 
 	defaultReservoirSize = 1024
+
+	// the maximum number of different hosts tracked for the unmatched
+	// requests, to limit the cardinality
+	maxUnmatchedHosts = 1024
 )
 
-var reg metrics.Registry
+var (
+	reg     metrics.Registry
+	backend Metrics
+)
+
+// the built-in metrics backend, collecting the measurements in a
+// go-metrics registry, exposed by the metrics listener
+type registryMetrics struct{}
+
+// reports the measurements to multiple backends
+type multiMetrics []Metrics
+
+var (
+	unmatchedMx    sync.Mutex
+	unmatchedHosts = make(map[string]bool)
+
+	// the number of the open client connections
+	activeConnections int64
+)
+
+func (m multiMetrics) UpdateTimer(key string, d time.Duration) {
+	for _, mi := range m {
+		mi.UpdateTimer(key, d)
+	}
+}
+
+func (m multiMetrics) UpdateHistogram(key string, v int64) {
+	for _, mi := range m {
+		mi.UpdateHistogram(key, v)
+	}
+}
+
+func (m multiMetrics) UpdateGauge(key string, v int64) {
+	for _, mi := range m {
+		mi.UpdateGauge(key, v)
+	}
+}
+
+func (m multiMetrics) IncCounter(key string) {
+	for _, mi := range m {
+		mi.IncCounter(key)
+	}
+}
+
+func listenAndServe(name, address string, h http.Handler, drainTimeout time.Duration) {
+	if drainTimeout > 0 {
+		go func() {
+			if err := upgrade.ListenAndServeRetry(address, h, drainTimeout); err != nil {
+				log.Errorf("%s listener: %v", name, err)
+			}
+		}()
+	} else {
+		go http.ListenAndServe(address, h)
+	}
+}
+
+// starts the Prometheus listener, if configured, and returns the
+// Prometheus backend, or nil
+func initPrometheus(o Options) Metrics {
+	p := o.Prometheus
+	if p == nil && o.PrometheusListener == "" {
+		return nil
+	}
+
+	if p == nil {
+		p = NewPrometheus()
+	}
+
+	if o.PrometheusListener != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", p)
+		log.Infof("prometheus metrics listener on %s/metrics", o.PrometheusListener)
+		listenAndServe("prometheus metrics", o.PrometheusListener, mux, o.UpgradeDrainTimeout)
+	}
+
+	return p
+}
 
 // Initializes the collection of metrics.
 func Init(o Options) {
+	if o.Custom != nil {
+		log.Infoln("Metrics are reported to a custom implementation")
+		reg = nil
+		backend = o.Custom
+		return
+	}
+
+	prometheus := initPrometheus(o)
 	if o.Listener == "" {
+		if prometheus != nil {
+			reg = nil
+			backend = prometheus
+			return
+		}
+
 		log.Infoln("Metrics are disabled")
 		return
 	}
@@ -67,8 +249,13 @@ func Init(o Options) {
 
 	handler := &metricsHandler{registry: r, options: o}
 	log.Infof("metrics listener on %s/metrics", o.Listener)
-	go http.ListenAndServe(o.Listener, handler)
+	listenAndServe("metrics", o.Listener, handler, o.UpgradeDrainTimeout)
+
 	reg = r
+	backend = registryMetrics{}
+	if prometheus != nil {
+		backend = multiMetrics{registryMetrics{}, prometheus}
+	}
 }
 
 func createTimer() metrics.Timer {
@@ -82,12 +269,79 @@ func getTimer(key string) metrics.Timer {
 	return reg.GetOrRegister(key, createTimer).(metrics.Timer)
 }
 
-func updateTimer(key string, d time.Duration) {
+func (registryMetrics) UpdateTimer(key string, d time.Duration) {
 	if t := getTimer(key); t != nil {
 		t.Update(d)
 	}
 }
 
+func createHistogram() metrics.Histogram {
+	return metrics.NewHistogram(metrics.NewUniformSample(defaultReservoirSize))
+}
+
+func getHistogram(key string) metrics.Histogram {
+	if reg == nil {
+		return nil
+	}
+	return reg.GetOrRegister(key, createHistogram).(metrics.Histogram)
+}
+
+func (registryMetrics) UpdateHistogram(key string, v int64) {
+	if h := getHistogram(key); h != nil {
+		h.Update(v)
+	}
+}
+
+func getGauge(key string) metrics.Gauge {
+	if reg == nil {
+		return nil
+	}
+	return reg.GetOrRegister(key, metrics.NewGauge).(metrics.Gauge)
+}
+
+func getCounter(key string) metrics.Counter {
+	if reg == nil {
+		return nil
+	}
+	return reg.GetOrRegister(key, metrics.NewCounter).(metrics.Counter)
+}
+
+func (registryMetrics) UpdateGauge(key string, v int64) {
+	if g := getGauge(key); g != nil {
+		g.Update(v)
+	}
+}
+
+func (registryMetrics) IncCounter(key string) {
+	if c := getCounter(key); c != nil {
+		c.Inc(1)
+	}
+}
+
+func updateTimer(key string, d time.Duration) {
+	if backend != nil {
+		backend.UpdateTimer(key, d)
+	}
+}
+
+func updateHistogram(key string, v int64) {
+	if backend != nil {
+		backend.UpdateHistogram(key, v)
+	}
+}
+
+func updateGauge(key string, v int64) {
+	if backend != nil {
+		backend.UpdateGauge(key, v)
+	}
+}
+
+func incCounter(key string) {
+	if backend != nil {
+		backend.IncCounter(key)
+	}
+}
+
 func measureSince(key string, start time.Time) {
 	d := time.Since(start)
 	go updateTimer(key, d)
@@ -109,6 +363,34 @@ func MeasureBackend(routeId string, start time.Time) {
 	measureSince(fmt.Sprintf(KeyProxyBackend, routeId), start)
 }
 
+// Measures the duration of a backend request by the host of the
+// backend.
+func MeasureBackendHost(host string, start time.Time) {
+	measureSince(fmt.Sprintf(KeyBackendHost, host), start)
+}
+
+// Tracks the number of the open client connections. It can be set as
+// the ConnState hook of an http.Server.
+func ConnState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		updateGauge(KeyConnections, atomic.AddInt64(&activeConnections, 1))
+	case http.StateHijacked, http.StateClosed:
+		updateGauge(KeyConnections, atomic.AddInt64(&activeConnections, -1))
+	}
+}
+
+// Measures the duration of processing an update of the routing table,
+// and reports the number of the active routes, and the number of the
+// route definitions that were rejected.
+func MeasureRoutingUpdate(start time.Time, routes int, failed int) {
+	measureSince(KeyRoutingUpdate, start)
+	updateGauge(KeyRoutes, int64(routes))
+	for i := 0; i < failed; i++ {
+		incCounter(KeyRoutingFailed)
+	}
+}
+
 func MeasureFilterResponse(filterName string, start time.Time) {
 	measureSince(fmt.Sprintf(KeyFilterResponse, filterName), start)
 }
@@ -121,6 +403,259 @@ func MeasureResponse(code int, method string, routeId string, start time.Time) {
 	measureSince(fmt.Sprintf(KeyResponse, code, method, routeId), start)
 }
 
+// Statistics of the responses of a route, aggregated over the status
+// codes and the methods.
+type RouteStats struct {
+
+	// The number of the responses since the start.
+	Count int64
+
+	// The responses per second, as a one-minute moving average.
+	Rate float64
+
+	// The mean response time of the sampled responses.
+	Mean time.Duration
+}
+
+// Returns the response statistics of the routes, by route id, as
+// measured by MeasureResponse. It returns nil, when the metrics are
+// disabled, or they are reported to a custom implementation.
+func ResponseStats() map[string]RouteStats {
+	if reg == nil {
+		return nil
+	}
+
+	stats := make(map[string]RouteStats)
+	sums := make(map[string]float64)
+	reg.Each(func(name string, i interface{}) {
+		t, ok := i.(metrics.Timer)
+		if !ok {
+			return
+		}
+
+		// response.<code>.<method>.skipper.<route id>
+		parts := strings.SplitN(name, ".", 5)
+		if len(parts) != 5 || parts[0] != "response" || parts[3] != "skipper" {
+			return
+		}
+
+		ts := t.Snapshot()
+		id := parts[4]
+		s := stats[id]
+		s.Count += ts.Count()
+		s.Rate += ts.Rate1()
+		stats[id] = s
+		sums[id] += ts.Mean() * float64(ts.Count())
+	})
+
+	for id, s := range stats {
+		if s.Count > 0 {
+			s.Mean = time.Duration(sums[id] / float64(s.Count))
+			stats[id] = s
+		}
+	}
+
+	return stats
+}
+
+// Measures the response time by the path template of the route, e.g.
+// /users/:id, instead of the route id, so that the routes serving the
+// same path pattern can be grouped without the cardinality of the raw
+// paths.
+func MeasurePathResponse(code int, method string, pathTemplate string, start time.Time) {
+	measureSince(fmt.Sprintf(KeyPathResponse, code, method, pathTemplate), start)
+}
+
+// Measures the response time by the category of the request, set by the
+// classify filter, e.g. checkout or search.
+func MeasureCategoryResponse(code int, method string, category string, start time.Time) {
+	measureSince(fmt.Sprintf(KeyCatResponse, code, method, category), start)
+}
+
+// Records the number of bytes of the response body sent to the client.
+func MeasureResponseSize(routeId string, size int64) {
+	go updateHistogram(fmt.Sprintf(KeyResponseSize, routeId), size)
+}
+
+// Counts a truncated response. The reason tells whether the backend
+// closed the connection early, or the body didn't match the
+// Content-Length header.
+func IncTruncated(routeId string, reason string) {
+	go incCounter(fmt.Sprintf(KeyTruncated, reason, routeId))
+}
+
+// Counts a request that didn't match any route, by the host of the
+// request. At most 1024 different hosts are tracked, the requests with
+// further hosts are counted with the host "_other".
+func IncUnmatched(host string) {
+	unmatchedMx.Lock()
+	if !unmatchedHosts[host] {
+		if len(unmatchedHosts) < maxUnmatchedHosts {
+			unmatchedHosts[host] = true
+		} else {
+			host = UnmatchedOtherHost
+		}
+	}
+	unmatchedMx.Unlock()
+
+	go incCounter(fmt.Sprintf(KeyUnmatched, host))
+}
+
+// Counts a filter reading a request or response body, indicated by the
+// direction, beyond the buffering threshold of the proxy.
+func IncFilterBuffered(filterName string, direction string) {
+	go incCounter(fmt.Sprintf(KeyFilterBuffered, filterName, direction))
+}
+
+// Records the current usage of a capped resource of the proxy, e.g. the
+// in-flight requests or the open backend connections.
+func UpdateSaturation(resource string, used int64) {
+	updateGauge(fmt.Sprintf(KeySaturation, resource), used)
+}
+
+// Counts a request rejected, because the cap of a resource was reached.
+func IncRejected(resource string) {
+	go incCounter(fmt.Sprintf(KeyRejected, resource))
+}
+
+// Records the verdict of the last analysis window of a canary group: 1
+// when the canary passed, -1 when it failed, and 0 when the window was
+// inconclusive.
+func UpdateCanaryVerdict(group string, verdict int64) {
+	updateGauge(fmt.Sprintf(KeyCanaryVerdict, group), verdict)
+}
+
+// Records the success rate, in per mille, and the mean latency, in
+// microseconds, of a variant of a canary group, measured in the last
+// analysis window.
+func UpdateCanaryVariant(group string, variant string, successRate float64, latency time.Duration) {
+	updateGauge(fmt.Sprintf(KeyCanarySuccess, group, variant), int64(successRate*1000))
+	updateGauge(fmt.Sprintf(KeyCanaryLatency, group, variant), int64(latency/time.Microsecond))
+}
+
+// Counts a canary rolled back, because it failed the analysis.
+func IncCanaryRollback(group string) {
+	go incCounter(fmt.Sprintf(KeyCanaryRollback, group))
+}
+
+// Counts a route dropped from the routing table because it expired.
+func IncRouteExpired(routeId string) {
+	go incCounter(fmt.Sprintf(KeyRouteExpired, routeId))
+}
+
+// Counts the result of comparing the route matched by the live routing
+// table with the one matched by the shadow table: "same", "route" when
+// only the route differs, or "backend" when the backend differs.
+func IncShadowRouting(result string) {
+	go incCounter(fmt.Sprintf(KeyShadowRouting, result))
+}
+
+// Records the result and the duration of a synthetic check.
+func MeasureSyntheticCheck(name string, passed bool, d time.Duration) {
+	key := KeySyntheticFailed
+	if passed {
+		key = KeySyntheticPassed
+	}
+
+	go incCounter(fmt.Sprintf(key, name))
+	go updateTimer(fmt.Sprintf(KeySyntheticTime, name), d)
+}
+
+// Records the number of the active upgraded connections of a route.
+func UpdateUpgradesActive(routeId string, active int64) {
+	updateGauge(fmt.Sprintf(KeyUpgradesActive, routeId), active)
+}
+
+// Records the duration of an upgraded connection of a route, per
+// protocol, e.g. websocket.
+func MeasureUpgrade(protocol string, routeId string, d time.Duration) {
+	go updateTimer(fmt.Sprintf(KeyUpgradeDuration, protocol, routeId), d)
+}
+
+// Counts an upgrade request rejected, because the route reached the cap
+// of its upgraded connections.
+func IncUpgradeRejected(routeId string) {
+	go incCounter(fmt.Sprintf(KeyUpgradeRejected, routeId))
+}
+
+// Records the number of bytes sent over an upgraded connection of a
+// route, by the side that sent them, client or backend.
+func MeasureUpgradeBytes(routeId string, sender string, n int64) {
+	go updateHistogram(fmt.Sprintf(KeyUpgradeBytes, sender, routeId), n)
+}
+
+// Counts an upgraded connection closed, because no data was sent in
+// either direction during the idle timeout.
+func IncUpgradeIdleTimeout(routeId string) {
+	go incCounter(fmt.Sprintf(KeyUpgradeIdle, routeId))
+}
+
+// Records the time that a response of a route spent waiting for its
+// share of the response bandwidth.
+func MeasureBandwidthWait(routeId string, d time.Duration) {
+	go updateTimer(fmt.Sprintf(KeyBandwidthWait, routeId), d)
+}
+
+// Counts a request rejected by the rate limit of a group.
+func IncRatelimited(group string) {
+	go incCounter(fmt.Sprintf(KeyRatelimited, group))
+}
+
+// Counts the openings of a circuit breaker, identified by the backend
+// host or the route id, depending on its scope.
+func IncCircuitBreakerOpened(key string) {
+	go incCounter(fmt.Sprintf(KeyBreakerOpened, key))
+}
+
+// Counts a request rejected by an open circuit breaker.
+func IncCircuitBreakerRejected(key string) {
+	go incCounter(fmt.Sprintf(KeyBreakerRejected, key))
+}
+
+// Counts the ejections of the load balancer members of a route, by
+// failed requests or failed health checks.
+func IncLoadBalancerEjected(routeId string) {
+	go incCounter(fmt.Sprintf(KeyLBEjected, routeId))
+}
+
+// Records the health of a backend host, checked by the active health
+// checks: 1 when healthy, 0 when down.
+func UpdateHealthCheck(host string, healthy int64) {
+	updateGauge(fmt.Sprintf(KeyHealthCheck, host), healthy)
+}
+
+// Counts a backend host marked down by the active health checks.
+func IncHealthCheckDown(host string) {
+	go incCounter(fmt.Sprintf(KeyHealthCheckDown, host))
+}
+
+// Counts a request of a route handled by the cache filter, by the
+// result: hit, stale, revalidated or miss.
+func IncCache(routeId string, result string) {
+	go incCounter(fmt.Sprintf(KeyCache, routeId, result))
+}
+
+// Counts a retried backend request of a route.
+func IncRetry(routeId string) {
+	go incCounter(fmt.Sprintf(KeyRetry, routeId))
+}
+
+// Counts a backend request of a route that was not retried, because the
+// retry budget was exhausted.
+func IncRetryBudgetExhausted(routeId string) {
+	go incCounter(fmt.Sprintf(KeyRetryExhausted, routeId))
+}
+
+func IncChaosInjected(routeId string, fault string) {
+	go incCounter(fmt.Sprintf(KeyChaosInjected, routeId, fault))
+}
+
+// Counts a request of a route copied by the mirror filter, by its
+// result: sent, skipped because of the concurrency limit, or failed.
+func IncMirror(routeId string, result string) {
+	go incCounter(fmt.Sprintf(KeyMirror, routeId, result))
+}
+
 // This listener is used to expose the collected metrics.
 func (sm skipperMetrics) MarshalJSON() ([]byte, error) {
 	data := make(map[string]map[string]interface{})
@@ -128,6 +663,9 @@ func (sm skipperMetrics) MarshalJSON() ([]byte, error) {
 		values := make(map[string]interface{})
 		var metricsFamily string
 		switch m := metric.(type) {
+		case metrics.Counter:
+			metricsFamily = "counters"
+			values["count"] = m.Count()
 		case metrics.Gauge:
 			metricsFamily = "gauges"
 			values["value"] = m.Value()
@@ -7,6 +7,7 @@ import (
 	"github.com/rcrowley/go-metrics"
 	"net/http"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -112,6 +113,29 @@ var proxyMetricsTests = []proxyMetricTest{
 	// T7 - Measure response
 	{fmt.Sprintf(KeyResponse, http.StatusOK, "GET", "norf"),
 		func() { MeasureResponse(http.StatusOK, "GET", "norf", time.Now()) }},
+	// T8 - Measure response size
+	{fmt.Sprintf(KeyResponseSize, "qux"), func() { MeasureResponseSize("qux", 42) }},
+	// T9 - Count truncated response
+	{fmt.Sprintf(KeyTruncated, "closedearly", "quux"), func() { IncTruncated("quux", "closedearly") }},
+	// T10 - Count expired route
+	{fmt.Sprintf(KeyRouteExpired, "norf"), func() { IncRouteExpired("norf") }},
+	// T11 - Measure response by path template
+	{fmt.Sprintf(KeyPathResponse, http.StatusOK, "GET", "/users/:id"),
+		func() { MeasurePathResponse(http.StatusOK, "GET", "/users/:id", time.Now()) }},
+	// T12 - Count unmatched request
+	{fmt.Sprintf(KeyUnmatched, "www.example.org"), func() { IncUnmatched("www.example.org") }},
+	// T13 - Count buffering filter
+	{fmt.Sprintf(KeyFilterBuffered, "compressRequest", "request"), func() { IncFilterBuffered("compressRequest", "request") }},
+	// T14 - Record the saturation of a resource
+	{fmt.Sprintf(KeySaturation, "inflightrequests"), func() { UpdateSaturation("inflightrequests", 42) }},
+	// T15 - Count rejected request
+	{fmt.Sprintf(KeyRejected, "backendconnections"), func() { IncRejected("backendconnections") }},
+	// T16 - Record canary verdict
+	{fmt.Sprintf(KeyCanaryVerdict, "checkout"), func() { UpdateCanaryVerdict("checkout", 1) }},
+	// T17 - Count canary rollback
+	{fmt.Sprintf(KeyCanaryRollback, "checkout"), func() { IncCanaryRollback("checkout") }},
+	// T18 - Record the health of a backend host
+	{fmt.Sprintf(KeyHealthCheck, "api.example.org"), func() { UpdateHealthCheck("api.example.org", 1) }},
 }
 
 func TestProxyMetrics(t *testing.T) {
@@ -135,6 +159,7 @@ type serializationTest struct {
 
 var serializationTests = []serializationTest{
 	{metrics.NewGauge, serializationResult{"gauges": {"test": {"value": 0.0}}}},
+	{metrics.NewCounter, serializationResult{"counters": {"test": {"count": 0.0}}}},
 	{metrics.NewTimer, serializationResult{"timers": {"test": {"15m.rate": 0.0, "1m.rate": 0.0, "5m.rate": 0.0,
 		"75%": 0.0, "95%": 0.0, "99%": 0.0, "99.9%": 0.0, "count": 0.0, "max": 0.0, "mean": 0.0, "mean.rate": 0.0,
 		"median": 0.0, "min": 0.0, "stddev": 0.0}}}},
@@ -160,3 +185,112 @@ func TestMetricSerialization(t *testing.T) {
 
 	}
 }
+
+func TestUnmatchedHostsLimited(t *testing.T) {
+	unmatchedMx.Lock()
+	unmatchedHosts = make(map[string]bool)
+	for i := 0; i < maxUnmatchedHosts; i++ {
+		unmatchedHosts[fmt.Sprintf("host%d.example.org", i)] = true
+	}
+	unmatchedMx.Unlock()
+
+	defer func() {
+		unmatchedMx.Lock()
+		unmatchedHosts = make(map[string]bool)
+		unmatchedMx.Unlock()
+	}()
+
+	Init(Options{Listener: ":0"})
+	IncUnmatched("host0.example.org")
+	IncUnmatched("new.example.org")
+
+	for i := 0; i < 100; i++ {
+		known := reg.Get(fmt.Sprintf(KeyUnmatched, "host0.example.org"))
+		other := reg.Get(fmt.Sprintf(KeyUnmatched, UnmatchedOtherHost))
+		if known != nil && other != nil {
+			if reg.Get(fmt.Sprintf(KeyUnmatched, "new.example.org")) != nil {
+				t.Error("failed to limit the hosts")
+			}
+
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Error("failed to count the unmatched requests")
+}
+
+type recordingMetrics struct {
+	mx   sync.Mutex
+	keys map[string]string
+}
+
+func (m *recordingMetrics) record(kind, key string) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.keys[key] = kind
+}
+
+func (m *recordingMetrics) UpdateTimer(key string, _ time.Duration) { m.record("timer", key) }
+func (m *recordingMetrics) UpdateHistogram(key string, _ int64)     { m.record("histogram", key) }
+func (m *recordingMetrics) UpdateGauge(key string, _ int64)         { m.record("gauge", key) }
+func (m *recordingMetrics) IncCounter(key string)                   { m.record("counter", key) }
+
+func TestCustomMetrics(t *testing.T) {
+	m := &recordingMetrics{keys: make(map[string]string)}
+	Init(Options{Listener: ":0", Custom: m})
+	defer Init(Options{Listener: ":0"})
+
+	if reg != nil {
+		t.Error("Custom metrics should not create a registry")
+	}
+
+	MeasureBackend("foo", time.Now())
+	MeasureResponseSize("foo", 42)
+	UpdateSaturation("inflightrequests", 42)
+	IncRouteExpired("foo")
+	time.Sleep(20 * time.Millisecond)
+
+	expected := map[string]string{
+		fmt.Sprintf(KeyProxyBackend, "foo"):            "timer",
+		fmt.Sprintf(KeyResponseSize, "foo"):            "histogram",
+		fmt.Sprintf(KeySaturation, "inflightrequests"): "gauge",
+		fmt.Sprintf(KeyRouteExpired, "foo"):            "counter"}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if !reflect.DeepEqual(m.keys, expected) {
+		t.Error("failed to report to the custom metrics", m.keys)
+	}
+}
+
+func TestResponseStats(t *testing.T) {
+	useNil := metrics.UseNilMetrics
+	metrics.UseNilMetrics = false
+	defer func() { metrics.UseNilMetrics = useNil }()
+
+	Init(Options{Custom: &recordingMetrics{keys: make(map[string]string)}})
+	if ResponseStats() != nil {
+		t.Error("unexpected stats with custom metrics")
+	}
+
+	Init(Options{Listener: ":0"})
+	updateTimer(fmt.Sprintf(KeyResponse, http.StatusOK, "GET", "foo"), 10*time.Millisecond)
+	updateTimer(fmt.Sprintf(KeyResponse, http.StatusNotFound, "POST", "foo"), 30*time.Millisecond)
+	updateTimer(fmt.Sprintf(KeyResponse, http.StatusOK, "GET", "bar"), 20*time.Millisecond)
+	updateTimer(fmt.Sprintf(KeyPathResponse, http.StatusOK, "GET", "baz"), 20*time.Millisecond)
+
+	stats := ResponseStats()
+	if len(stats) != 2 {
+		t.Fatal("invalid stats", stats)
+	}
+
+	if s := stats["foo"]; s.Count != 2 || s.Mean != 20*time.Millisecond {
+		t.Error("invalid stats of foo", s)
+	}
+
+	if s := stats["bar"]; s.Count != 1 || s.Mean != 20*time.Millisecond {
+		t.Error("invalid stats of bar", s)
+	}
+}
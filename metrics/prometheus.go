@@ -0,0 +1,426 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The types of the metric families.
+const (
+	PrometheusCounter   = "counter"
+	PrometheusGauge     = "gauge"
+	PrometheusHistogram = "histogram"
+)
+
+// the content type of the text exposition format
+const prometheusContentType = "text/plain; version=0.0.4"
+
+var (
+	// the bucket upper bounds of the durations, in seconds
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// the bucket upper bounds of the sizes, in bytes
+	sizeBuckets = []float64{1 << 8, 1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24}
+
+	invalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+)
+
+// A label of a series.
+type PrometheusLabel struct {
+	Name  string
+	Value string
+}
+
+// A bucket of a histogram series, counting the values less than or
+// equal to the upper bound.
+type PrometheusBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// A series of a metric family, identified by its labels.
+type PrometheusSeries struct {
+	Labels []PrometheusLabel
+
+	// The value of a counter or a gauge.
+	Value float64
+
+	// The cumulative buckets, the sum and the count of a histogram.
+	Buckets []PrometheusBucket
+	Sum     float64
+	Count   uint64
+}
+
+// A metric family, in the Prometheus data model.
+type PrometheusFamily struct {
+	Name   string
+	Help   string
+	Type   string
+	Series []*PrometheusSeries
+}
+
+// PrometheusCollector is implemented by the sources of additional
+// metric families, exposed together with the ones of skipper.
+type PrometheusCollector interface {
+	Collect() []*PrometheusFamily
+}
+
+// maps the keys of the measurements to metric families and labels
+type prometheusMapping struct {
+	rx     *regexp.Regexp
+	name   string
+	help   string
+	labels []string
+
+	// for timers, the name of a counter counting the measurements with
+	// the same labels, when set
+	counter     string
+	counterHelp string
+}
+
+func mapping(rx, name, help string, labels ...string) *prometheusMapping {
+	return &prometheusMapping{rx: regexp.MustCompile(rx), name: name, help: help, labels: labels}
+}
+
+var (
+	timerMappings = []*prometheusMapping{
+		mapping(`^routelookup$`, "skipper_route_lookup_duration_seconds", "Duration of the route lookups."),
+		mapping(`^filter\.([^.]+)\.(request|response)$`, "skipper_filter_duration_seconds",
+			"Duration of the filter executions.", "filter", "phase"),
+		mapping(`^allfilters\.(request|response)\.(.+)$`, "skipper_route_filters_duration_seconds",
+			"Duration of the execution of all the filters of a route.", "phase", "route"),
+		mapping(`^backend\.(.+)$`, "skipper_backend_duration_seconds",
+			"Duration of the backend requests, by route.", "route"),
+		mapping(`^backendhost\.(.+)$`, "skipper_backend_host_duration_seconds",
+			"Duration of the backend requests, by backend host.", "host"),
+		{
+			rx:          regexp.MustCompile(`^response\.(\d+)\.([^.]+)\.skipper\.(.+)$`),
+			name:        "skipper_response_duration_seconds",
+			help:        "Duration of the responses, by route.",
+			labels:      []string{"code", "method", "route"},
+			counter:     "skipper_requests_total",
+			counterHelp: "Number of the served requests, by route.",
+		},
+		mapping(`^response\.(\d+)\.([^.]+)\.path\.(.+)$`, "skipper_path_response_duration_seconds",
+			"Duration of the responses, by path template.", "code", "method", "path"),
+		mapping(`^response\.(\d+)\.([^.]+)\.category\.(.+)$`, "skipper_category_response_duration_seconds",
+			"Duration of the responses, by request category.", "code", "method", "category"),
+		mapping(`^routingupdate$`, "skipper_routing_update_duration_seconds",
+			"Duration of processing the updates of the routing table."),
+	}
+
+	histogramMappings = []*prometheusMapping{
+		mapping(`^responsesize\.(.+)$`, "skipper_response_size_bytes", "Size of the response bodies.", "route"),
+	}
+
+	gaugeMappings = []*prometheusMapping{
+		mapping(`^connections\.active$`, "skipper_active_connections", "Number of the open client connections."),
+		mapping(`^routes$`, "skipper_routes", "Number of the routes in the routing table."),
+		mapping(`^healthcheck\.(.+)\.healthy$`, "skipper_backend_healthy",
+			"Health of the backend hosts checked by the active health checks, 1 when healthy, 0 when down.", "host"),
+	}
+
+	counterMappings = []*prometheusMapping{
+		mapping(`^routingupdate\.failed$`, "skipper_routing_update_failures_total",
+			"Number of the route definitions rejected during the routing updates."),
+		mapping(`^healthcheck\.(.+)\.down$`, "skipper_backend_health_check_down_total",
+			"Number of the times that the backend hosts were marked down by the active health checks.", "host"),
+	}
+)
+
+// a resolved series, with the family that it belongs to
+type prometheusRef struct {
+	family *PrometheusFamily
+	series *PrometheusSeries
+}
+
+// Prometheus is a metrics backend, keeping the measurements as metric
+// families in the Prometheus data model, and serving them in the text
+// exposition format. The well-known keys are mapped to metric names
+// with labels, e.g. response.200.GET.skipper.foo to
+// skipper_response_duration_seconds{code="200",method="GET",route="foo"},
+// while the rest of the keys are exposed with the name derived from the
+// key. It can be merged into the metrics of an embedding application,
+// by gathering its families, or by registering the collectors of the
+// application in it.
+type Prometheus struct {
+	mx         sync.Mutex
+	families   map[string]*PrometheusFamily
+	refs       map[string][]prometheusRef
+	collectors []PrometheusCollector
+}
+
+// Creates an empty Prometheus backend.
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		families: make(map[string]*PrometheusFamily),
+		refs:     make(map[string][]prometheusRef)}
+}
+
+// Registers an additional source of metric families, exposed together
+// with the measurements of skipper.
+func (p *Prometheus) Register(c PrometheusCollector) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.collectors = append(p.collectors, c)
+}
+
+// derives a valid metric name from a key
+func prometheusName(key, suffix string) string {
+	return "skipper_" + invalidNameChars.ReplaceAllString(key, "_") + suffix
+}
+
+func newSeries(typ string, labels []PrometheusLabel, buckets []float64) *PrometheusSeries {
+	s := &PrometheusSeries{Labels: labels}
+	if typ == PrometheusHistogram {
+		for _, b := range buckets {
+			s.Buckets = append(s.Buckets, PrometheusBucket{UpperBound: b})
+		}
+	}
+
+	return s
+}
+
+// creates a series with the provided labels in a family, creating the
+// family if necessary. Expects the lock to be held.
+func (p *Prometheus) series(name, help, typ string, labels []PrometheusLabel, buckets []float64) prometheusRef {
+	f := p.families[name]
+	if f == nil {
+		f = &PrometheusFamily{Name: name, Help: help, Type: typ}
+		p.families[name] = f
+	}
+
+	s := newSeries(typ, labels, buckets)
+	f.Series = append(f.Series, s)
+	return prometheusRef{f, s}
+}
+
+// resolves the series that a key is reported to, caching the result.
+// Expects the lock to be held.
+func (p *Prometheus) resolve(kind, key, typ, suffix string, mappings []*prometheusMapping, buckets []float64) []prometheusRef {
+	cacheKey := kind + ":" + key
+	if refs, ok := p.refs[cacheKey]; ok {
+		return refs
+	}
+
+	var refs []prometheusRef
+	for _, m := range mappings {
+		values := m.rx.FindStringSubmatch(key)
+		if values == nil {
+			continue
+		}
+
+		var labels []PrometheusLabel
+		for i, name := range m.labels {
+			labels = append(labels, PrometheusLabel{name, values[i+1]})
+		}
+
+		refs = append(refs, p.series(m.name, m.help, typ, labels, buckets))
+		if m.counter != "" {
+			refs = append(refs, p.series(m.counter, m.counterHelp, PrometheusCounter, labels, nil))
+		}
+
+		break
+	}
+
+	if refs == nil {
+		refs = append(refs, p.series(prometheusName(key, suffix), "", typ, nil, buckets))
+	}
+
+	p.refs[cacheKey] = refs
+	return refs
+}
+
+func observe(s *PrometheusSeries, v float64) {
+	for i := range s.Buckets {
+		if v <= s.Buckets[i].UpperBound {
+			s.Buckets[i].Count++
+		}
+	}
+
+	s.Sum += v
+	s.Count++
+}
+
+func (p *Prometheus) update(refs []prometheusRef, v float64) {
+	for _, r := range refs {
+		switch r.family.Type {
+		case PrometheusHistogram:
+			observe(r.series, v)
+		case PrometheusCounter:
+			r.series.Value++
+		default:
+			r.series.Value = v
+		}
+	}
+}
+
+// Records a duration in a histogram, in seconds.
+func (p *Prometheus) UpdateTimer(key string, d time.Duration) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	refs := p.resolve("timer", key, PrometheusHistogram, "_duration_seconds", timerMappings, durationBuckets)
+	p.update(refs, d.Seconds())
+}
+
+// Records a value in a histogram.
+func (p *Prometheus) UpdateHistogram(key string, v int64) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	refs := p.resolve("histogram", key, PrometheusHistogram, "", histogramMappings, sizeBuckets)
+	p.update(refs, float64(v))
+}
+
+// Sets the value of a gauge.
+func (p *Prometheus) UpdateGauge(key string, v int64) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	refs := p.resolve("gauge", key, PrometheusGauge, "", gaugeMappings, nil)
+	p.update(refs, float64(v))
+}
+
+// Increments a counter.
+func (p *Prometheus) IncCounter(key string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	refs := p.resolve("counter", key, PrometheusCounter, "_total", counterMappings, nil)
+	p.update(refs, 1)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelsString(labels []PrometheusLabel) string {
+	var s []string
+	for _, l := range labels {
+		s = append(s, l.Name+`="`+labelValueEscaper.Replace(l.Value)+`"`)
+	}
+
+	return strings.Join(s, ",")
+}
+
+type seriesByLabels []*PrometheusSeries
+
+func (s seriesByLabels) Len() int      { return len(s) }
+func (s seriesByLabels) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s seriesByLabels) Less(i, j int) bool {
+	return labelsString(s[i].Labels) < labelsString(s[j].Labels)
+}
+
+type familiesByName []*PrometheusFamily
+
+func (f familiesByName) Len() int           { return len(f) }
+func (f familiesByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f familiesByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+
+func copySeries(s *PrometheusSeries) *PrometheusSeries {
+	c := *s
+	c.Labels = append([]PrometheusLabel(nil), s.Labels...)
+	c.Buckets = append([]PrometheusBucket(nil), s.Buckets...)
+	return &c
+}
+
+// Returns a copy of the current metric families, including the ones of
+// the registered collectors, sorted by their names, and their series
+// sorted by their labels.
+func (p *Prometheus) Gather() []*PrometheusFamily {
+	p.mx.Lock()
+	var families []*PrometheusFamily
+	for _, f := range p.families {
+		c := &PrometheusFamily{Name: f.Name, Help: f.Help, Type: f.Type}
+		for _, s := range f.Series {
+			c.Series = append(c.Series, copySeries(s))
+		}
+
+		families = append(families, c)
+	}
+
+	collectors := p.collectors
+	p.mx.Unlock()
+
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+
+	for _, f := range families {
+		sort.Sort(seriesByLabels(f.Series))
+	}
+
+	sort.Sort(familiesByName(families))
+	return families
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeSample(w io.Writer, name string, labels []PrometheusLabel, extra string, v string) {
+	ls := labelsString(labels)
+	if extra != "" {
+		if ls != "" {
+			ls += ","
+		}
+
+		ls += extra
+	}
+
+	if ls != "" {
+		ls = "{" + ls + "}"
+	}
+
+	fmt.Fprintf(w, "%s%s %s\n", name, ls, v)
+}
+
+// Writes metric families in the Prometheus text exposition format.
+func WritePrometheusText(w io.Writer, families []*PrometheusFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, f.Help)
+		}
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Series {
+			if f.Type != PrometheusHistogram {
+				writeSample(bw, f.Name, s.Labels, "", formatFloat(s.Value))
+				continue
+			}
+
+			for _, b := range s.Buckets {
+				writeSample(bw, f.Name+"_bucket", s.Labels, `le="`+formatFloat(b.UpperBound)+`"`, strconv.FormatUint(b.Count, 10))
+			}
+
+			writeSample(bw, f.Name+"_bucket", s.Labels, `le="+Inf"`, strconv.FormatUint(s.Count, 10))
+			writeSample(bw, f.Name+"_sum", s.Labels, "", formatFloat(s.Sum))
+			writeSample(bw, f.Name+"_count", s.Labels, "", strconv.FormatUint(s.Count, 10))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Serves the metric families in the text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	if r.Method == "GET" {
+		WritePrometheusText(w, p.Gather())
+	}
+}
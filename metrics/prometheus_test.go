@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func findSeries(families []*PrometheusFamily, name string, labels ...string) (*PrometheusFamily, *PrometheusSeries) {
+	for _, f := range families {
+		if f.Name != name {
+			continue
+		}
+
+		for _, s := range f.Series {
+			var ls []string
+			for _, l := range s.Labels {
+				ls = append(ls, l.Name+"="+l.Value)
+			}
+
+			if strings.Join(ls, ",") == strings.Join(labels, ",") {
+				return f, s
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func TestPrometheusMapsKeys(t *testing.T) {
+	p := NewPrometheus()
+	p.UpdateTimer("response.200.GET.skipper.foo", 50*time.Millisecond)
+	p.UpdateTimer("response.200.GET.skipper.foo", 3*time.Second)
+	p.UpdateTimer("filter.compress.response", time.Millisecond)
+	p.UpdateTimer("backendhost.api.example.org", time.Millisecond)
+	p.UpdateHistogram("responsesize.foo", 2048)
+	p.UpdateGauge("connections.active", 3)
+	p.IncCounter("retries.foo")
+	p.IncCounter("retries.foo")
+
+	families := p.Gather()
+	f, s := findSeries(families, "skipper_response_duration_seconds", "code=200", "method=GET", "route=foo")
+	if f == nil || f.Type != PrometheusHistogram || s.Count != 2 || s.Sum != 3.05 {
+		t.Fatal("invalid response histogram", s)
+	}
+
+	for _, b := range s.Buckets {
+		var expected uint64
+		switch {
+		case b.UpperBound >= 5:
+			expected = 2
+		case b.UpperBound >= .05:
+			expected = 1
+		}
+
+		if b.Count != expected {
+			t.Error("invalid bucket", b.UpperBound, b.Count)
+		}
+	}
+
+	if f, s := findSeries(families, "skipper_requests_total", "code=200", "method=GET", "route=foo"); f == nil || f.Type != PrometheusCounter || s.Value != 2 {
+		t.Error("invalid request counter", s)
+	}
+
+	if _, s := findSeries(families, "skipper_filter_duration_seconds", "filter=compress", "phase=response"); s == nil || s.Count != 1 {
+		t.Error("invalid filter histogram")
+	}
+
+	if _, s := findSeries(families, "skipper_backend_host_duration_seconds", "host=api.example.org"); s == nil || s.Count != 1 {
+		t.Error("invalid backend host histogram")
+	}
+
+	if _, s := findSeries(families, "skipper_response_size_bytes", "route=foo"); s == nil || s.Sum != 2048 {
+		t.Error("invalid response size histogram")
+	}
+
+	if f, s := findSeries(families, "skipper_active_connections"); f == nil || f.Type != PrometheusGauge || s.Value != 3 {
+		t.Error("invalid connections gauge")
+	}
+
+	if f, s := findSeries(families, "skipper_retries_foo_total"); f == nil || f.Type != PrometheusCounter || s.Value != 2 {
+		t.Error("invalid generic counter")
+	}
+}
+
+type testCollector struct{}
+
+func (testCollector) Collect() []*PrometheusFamily {
+	return []*PrometheusFamily{{
+		Name:   "app_jobs_total",
+		Type:   PrometheusCounter,
+		Series: []*PrometheusSeries{{Value: 7}}}}
+}
+
+func TestPrometheusText(t *testing.T) {
+	p := NewPrometheus()
+	p.Register(testCollector{})
+	p.UpdateTimer("routelookup", 2*time.Millisecond)
+	p.UpdateGauge("unmatched.x\"y", 1)
+
+	var b bytes.Buffer
+	if err := WritePrometheusText(&b, p.Gather()); err != nil {
+		t.Fatal(err)
+	}
+
+	text := b.String()
+	for _, line := range []string{
+		"# TYPE app_jobs_total counter\napp_jobs_total 7\n",
+		"# HELP skipper_route_lookup_duration_seconds Duration of the route lookups.\n# TYPE skipper_route_lookup_duration_seconds histogram\n",
+		`skipper_route_lookup_duration_seconds_bucket{le="0.005"} 1` + "\n",
+		`skipper_route_lookup_duration_seconds_bucket{le="+Inf"} 1` + "\n",
+		"skipper_route_lookup_duration_seconds_sum 0.002\n",
+		"skipper_route_lookup_duration_seconds_count 1\n",
+		"skipper_unmatched_x_y 1\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("missing %q in:\n%s", line, text)
+		}
+	}
+
+	if strings.Index(text, "app_jobs_total") > strings.Index(text, "skipper_route_lookup") {
+		t.Error("families not sorted")
+	}
+
+	if got := labelsString([]PrometheusLabel{{"path", "a\\b\"c\nd"}}); got != `path="a\\b\"c\nd"` {
+		t.Error("invalid label escaping", got)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	p := NewPrometheus()
+	p.IncCounter("routingupdate.failed")
+
+	r, _ := http.NewRequest("GET", "http://localhost/metrics", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != prometheusContentType ||
+		!strings.Contains(w.Body.String(), "skipper_routing_update_failures_total 1\n") {
+		t.Error("failed to serve the metrics", w.Code, w.Body.String())
+	}
+}
+
+func TestPrometheusBackend(t *testing.T) {
+	prevReg, prevBackend := reg, backend
+	defer func() { reg, backend = prevReg, prevBackend }()
+
+	p := NewPrometheus()
+	Init(Options{Prometheus: p})
+	ConnState(nil, http.StateNew)
+	ConnState(nil, http.StateNew)
+	ConnState(nil, http.StateClosed)
+	MeasureRoutingUpdate(time.Now(), 42, 0)
+
+	if _, s := findSeries(p.Gather(), "skipper_active_connections"); s == nil || s.Value != 1 {
+		t.Error("invalid active connections", s)
+	}
+
+	if _, s := findSeries(p.Gather(), "skipper_routes"); s == nil || s.Value != 42 {
+		t.Error("invalid number of routes", s)
+	}
+}
@@ -31,6 +31,10 @@ The structure of the user credentials document:
 The GetToken method ignores the expiration date and makes a new request to the
 OAuth2 service on every call, so storing the token, if necessary, is the
 responsibility of the calling code.
+
+For browser sessions, the SessionRefresher refreshes the short-lived
+access tokens with the refresh token grant before they expire, allowing
+only a single refresh at a time for the same session.
 */
 package oauth
 
@@ -60,10 +64,11 @@ type userCredentials struct {
 }
 
 type authResponse struct {
-	Scope       string `json:"scope"`
-	ExpiresIn   int32  `json:"expires_in"`
-	TokenType   string `json:"token_type"`
-	AccessToken string `json:"access_token"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int32  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 // An OAuthClient implements authentication to an OAuth2 service.
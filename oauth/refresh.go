@@ -0,0 +1,209 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	refreshGrantType = "refresh_token"
+
+	// The default time before the expiry of an access token, when it
+	// is already refreshed.
+	DefaultRefreshMargin = 30 * time.Second
+
+	// The default time while the result of a refresh is reused for the
+	// requests of the same session still presenting the old refresh
+	// token, e.g. the parallel requests of a browser.
+	DefaultRefreshGracePeriod = 10 * time.Second
+)
+
+// Error returned when the access token of a session needs to be
+// refreshed, but there is no refresh token.
+var ErrNoRefreshToken = errors.New("no refresh token")
+
+// The tokens of a browser session.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+
+	// Zero when the expiry of the access token is unknown.
+	Expiry time.Time
+}
+
+// the result of a refresh, shared by the concurrent requests of a
+// session
+type sessionRefresh struct {
+	refreshToken string
+	done         chan struct{}
+	token        *Token
+	err          error
+	expires      time.Time
+}
+
+// Refreshes the tokens of browser sessions with the refresh token grant,
+// allowing only a single refresh at a time for the same session.
+type SessionRefresher struct {
+	client      *OAuthClient
+	margin      time.Duration
+	gracePeriod time.Duration
+	now         func() time.Time
+	mx          sync.Mutex
+	refreshes   map[string]*sessionRefresh
+}
+
+// Returns a new authentication token using a refresh token. The client
+// credentials are loaded the same way as in GetToken. When the response
+// doesn't contain a new refresh token, the current one is kept.
+func (oc *OAuthClient) RefreshToken(refreshToken string) (*Token, error) {
+	cc, err := oc.getClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := url.Values{}
+	parameters.Add("grant_type", refreshGrantType)
+	parameters.Add("refresh_token", refreshToken)
+	if oc.permissionScopes != "" {
+		parameters.Add("scope", oc.permissionScopes)
+	}
+
+	req, err := http.NewRequest("POST", oc.oauthUrl, strings.NewReader(parameters.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(cc.Id, cc.Secret)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rsp, err := oc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to refresh token: %s", rsp.Status)
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var ar authResponse
+	if err := json.Unmarshal(body, &ar); err != nil {
+		return nil, err
+	}
+
+	t := &Token{AccessToken: ar.AccessToken, RefreshToken: ar.RefreshToken}
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+
+	if ar.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(ar.ExpiresIn) * time.Second)
+	}
+
+	return t, nil
+}
+
+// Creates a session refresher. The access tokens are refreshed, when
+// they expire within margin. The result of a refresh is reused during
+// gracePeriod for the requests of the same session, still presenting the
+// old refresh token. When zero, the defaults are used.
+func NewSessionRefresher(client *OAuthClient, margin, gracePeriod time.Duration) *SessionRefresher {
+	if margin <= 0 {
+		margin = DefaultRefreshMargin
+	}
+
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultRefreshGracePeriod
+	}
+
+	return &SessionRefresher{
+		client:      client,
+		margin:      margin,
+		gracePeriod: gracePeriod,
+		now:         time.Now,
+		refreshes:   make(map[string]*sessionRefresh)}
+}
+
+// removes the completed refreshes whose grace period is over
+func (r *SessionRefresher) cleanup(now time.Time) {
+	for id, s := range r.refreshes {
+		if !s.expires.IsZero() && now.After(s.expires) {
+			delete(r.refreshes, id)
+		}
+	}
+}
+
+// Returns a valid token for a session. When the access token expires
+// within the margin, it is refreshed with the refresh token. The
+// concurrent calls for the same session wait for the same refresh, and
+// the calls presenting the old refresh token shortly after a refresh get
+// the refreshed token, so that a rotated refresh token is not used
+// twice. The caller is responsible for storing the returned token in the
+// session, when it differs from the current one.
+func (r *SessionRefresher) Token(session string, current *Token) (*Token, error) {
+	now := r.now()
+	if current.Expiry.IsZero() || now.Add(r.margin).Before(current.Expiry) {
+		return current, nil
+	}
+
+	if current.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	r.mx.Lock()
+	r.cleanup(now)
+	if s, ok := r.refreshes[session]; ok && s.refreshToken == current.RefreshToken {
+		r.mx.Unlock()
+		<-s.done
+		return s.token, s.err
+	}
+
+	s := &sessionRefresh{refreshToken: current.RefreshToken, done: make(chan struct{})}
+	r.refreshes[session] = s
+	r.mx.Unlock()
+
+	token, err := r.client.RefreshToken(current.RefreshToken)
+
+	r.mx.Lock()
+	s.token, s.err = token, err
+	if err != nil {
+
+		// failed refreshes are not reused by the later calls
+		if r.refreshes[session] == s {
+			delete(r.refreshes, session)
+		}
+	} else {
+		s.expires = r.now().Add(r.gracePeriod)
+	}
+
+	r.mx.Unlock()
+	close(s.done)
+	return token, err
+}
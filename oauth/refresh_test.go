@@ -0,0 +1,206 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issues a new access and refresh token for every refresh, and rejects
+// the refresh tokens that were already used
+type refreshServer struct {
+	refreshes int32
+	delay     time.Duration
+	mx        sync.Mutex
+	used      map[string]bool
+}
+
+func (s *refreshServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(s.delay)
+
+	id, secret, _ := r.BasicAuth()
+	if id != "theclientid" || secret != "clientsecret" || r.FormValue("grant_type") != refreshGrantType {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mx.Lock()
+	rt := r.FormValue("refresh_token")
+	if rt == "" || s.used[rt] {
+		s.mx.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.used[rt] = true
+	s.mx.Unlock()
+
+	n := atomic.AddInt32(&s.refreshes, 1)
+	json.NewEncoder(w).Encode(&authResponse{
+		AccessToken:  fmt.Sprintf("access%d", n),
+		RefreshToken: fmt.Sprintf("refresh%d", n),
+		ExpiresIn:    60})
+}
+
+func newRefreshServer(delay time.Duration) (*refreshServer, *httptest.Server) {
+	s := &refreshServer{delay: delay, used: make(map[string]bool)}
+	return s, httptest.NewServer(s)
+}
+
+func expiredToken() *Token {
+	return &Token{
+		AccessToken:  "access0",
+		RefreshToken: "refresh0",
+		Expiry:       time.Now().Add(-time.Second)}
+}
+
+func TestRefreshToken(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s := newRefreshServer(0)
+	defer s.Close()
+
+	token, err := New("", s.URL, "").RefreshToken("refresh0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "access1" || token.RefreshToken != "refresh1" {
+		t.Error("invalid token", token)
+	}
+
+	if token.Expiry.Before(time.Now().Add(50*time.Second)) || token.Expiry.After(time.Now().Add(70*time.Second)) {
+		t.Error("invalid expiry", token.Expiry)
+	}
+
+	if _, err := New("", s.URL, "").RefreshToken("refresh0"); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestSessionRefresherKeepsValidToken(t *testing.T) {
+	r := NewSessionRefresher(New("", "", ""), 0, 0)
+	for _, token := range []*Token{
+		{AccessToken: "access0"},
+		{AccessToken: "access0", Expiry: time.Now().Add(time.Hour)},
+	} {
+		if rt, err := r.Token("session1", token); err != nil || rt != token {
+			t.Error("failed to keep the valid token", rt, err)
+		}
+	}
+}
+
+func TestSessionRefresherNoRefreshToken(t *testing.T) {
+	r := NewSessionRefresher(New("", "", ""), 0, 0)
+	if _, err := r.Token("session1", &Token{Expiry: time.Now()}); err != ErrNoRefreshToken {
+		t.Error("failed to fail", err)
+	}
+}
+
+func TestSessionRefresherConcurrentRefresh(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, s := newRefreshServer(30 * time.Millisecond)
+	defer s.Close()
+
+	r := NewSessionRefresher(New("", s.URL, ""), 0, 0)
+
+	const requests = 8
+	var wg sync.WaitGroup
+	tokens := make([]*Token, requests)
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = r.Token("session1", expiredToken())
+		}(i)
+	}
+
+	wg.Wait()
+
+	// late request with the old refresh token, within the grace period
+	late, lateErr := r.Token("session1", expiredToken())
+
+	if n := atomic.LoadInt32(&rs.refreshes); n != 1 {
+		t.Error("invalid number of refreshes", n)
+	}
+
+	for i := range tokens {
+		if errs[i] != nil || tokens[i].AccessToken != "access1" {
+			t.Error("invalid token", tokens[i], errs[i])
+		}
+	}
+
+	if lateErr != nil || late.AccessToken != "access1" {
+		t.Error("failed to reuse the refreshed token", late, lateErr)
+	}
+}
+
+func TestSessionRefresherSeparateSessions(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, s := newRefreshServer(0)
+	defer s.Close()
+
+	r := NewSessionRefresher(New("", s.URL, ""), 0, 0)
+	t1, err := r.Token("session1", expiredToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t2, err := r.Token("session2", &Token{RefreshToken: "other", Expiry: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if t1.AccessToken == t2.AccessToken || atomic.LoadInt32(&rs.refreshes) != 2 {
+		t.Error("failed to refresh the sessions separately", t1, t2)
+	}
+}
+
+func TestSessionRefresherGracePeriodOver(t *testing.T) {
+	if err := setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s := newRefreshServer(0)
+	defer s.Close()
+
+	r := NewSessionRefresher(New("", s.URL, ""), 0, time.Millisecond)
+	if _, err := r.Token("session1", expiredToken()); err != nil {
+		t.Fatal(err)
+	}
+
+	r.now = func() time.Time { return time.Now().Add(time.Second) }
+
+	// the old refresh token was already used, so the server rejects it
+	if _, err := r.Token("session1", expiredToken()); err == nil {
+		t.Error("failed to fail")
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLBMaxFails     = 3
+	defaultLBEjectTimeout = 30 * time.Second
+
+	// the interval of resolving the DNS names of the members
+	lbResolveInterval = 30 * time.Second
+)
+
+// an address of a configured member. The members configured with a DNS
+// name have one for each of their resolved IP addresses.
+type lbMember struct {
+	scheme string
+
+	// the network address, host:port
+	host string
+
+	// the DNS name of the configured member, when the address was
+	// resolved from it, used as the TLS server name and as the Host
+	// header of the health checks
+	serverName string
+
+	// the backend requests in progress, until the response headers
+	// are received
+	inFlight int64
+
+	// protected by the lock of the load balancer
+	fails        int
+	ejectedUntil time.Time
+}
+
+// a configured member, with an IP address, or with a DNS name resolved
+// to the addresses
+type lbTarget struct {
+	scheme   string
+	hostname string
+	port     string
+	resolve  bool
+}
+
+// the state of the load balancer of a route
+type balancer struct {
+	mx         sync.Mutex
+	routeId    string
+	config     filters.LoadBalancerSettings
+	settings   filters.LoadBalancerSettings
+	targets    []lbTarget
+	members    []*lbMember
+	next       int
+	resolvedAt time.Time
+	resolving  bool
+	lookup     func(string) ([]string, error)
+	health     *healthcheck.Checker
+}
+
+// the load balancers of the routes
+type balancers struct {
+	mx        sync.Mutex
+	balancers map[string]*balancer
+	lookup    func(string) ([]string, error)
+	health    *healthcheck.Checker
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "https", "grpc":
+		return "443"
+	default:
+		return "80"
+	}
+}
+
+func parseLBTarget(member string) (lbTarget, bool) {
+	u, err := url.Parse(member)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return lbTarget{}, false
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, defaultPort(u.Scheme)
+	}
+
+	return lbTarget{
+		scheme:   u.Scheme,
+		hostname: host,
+		port:     port,
+		resolve:  net.ParseIP(host) == nil}, true
+}
+
+// the members with a DNS name are used with the name until it is
+// resolved
+func (t lbTarget) unresolved() *lbMember {
+	return &lbMember{scheme: t.scheme, host: net.JoinHostPort(t.hostname, t.port)}
+}
+
+// tells whether a member was created from the target, resolved or not
+func (t lbTarget) owns(m *lbMember) bool {
+	if m.scheme != t.scheme {
+		return false
+	}
+
+	if m.host == net.JoinHostPort(t.hostname, t.port) {
+		return true
+	}
+
+	_, port, err := net.SplitHostPort(m.host)
+	return err == nil && port == t.port && m.serverName == t.hostname
+}
+
+func sameLoadBalancerSettings(s1, s2 filters.LoadBalancerSettings) bool {
+	if s1.Algorithm != s2.Algorithm ||
+		s1.HealthCheckPath != s2.HealthCheckPath ||
+		s1.MaxFails != s2.MaxFails ||
+		s1.EjectTimeout != s2.EjectTimeout ||
+		len(s1.Members) != len(s2.Members) {
+		return false
+	}
+
+	for i := range s1.Members {
+		if s1.Members[i] != s2.Members[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// the settings are stored as configured, and with the defaults applied.
+// The invalid member addresses are ignored.
+func newBalancer(routeId string, s filters.LoadBalancerSettings, lookup func(string) ([]string, error), health *healthcheck.Checker) *balancer {
+	config := s
+	if s.MaxFails <= 0 {
+		s.MaxFails = defaultLBMaxFails
+	}
+
+	if s.EjectTimeout <= 0 {
+		s.EjectTimeout = defaultLBEjectTimeout
+	}
+
+	b := &balancer{
+		routeId:  routeId,
+		config:   config,
+		settings: s,
+		lookup:   lookup,
+		health:   health}
+	for _, m := range s.Members {
+		t, ok := parseLBTarget(m)
+		if !ok {
+			log.Errorf("invalid load balancer member in route %s: %s", routeId, m)
+			continue
+		}
+
+		b.targets = append(b.targets, t)
+		b.members = append(b.members, t.unresolved())
+	}
+
+	return b
+}
+
+// resolves the DNS names of the members. The state of the members
+// that are still resolved to the same address is kept. When a name
+// cannot be resolved, its previous members are kept.
+func (b *balancer) resolve() {
+	b.mx.Lock()
+	current := b.members
+	previous := make(map[string]*lbMember)
+	for _, m := range current {
+		previous[m.scheme+"://"+m.host] = m
+	}
+
+	targets := b.targets
+	b.mx.Unlock()
+
+	var members []*lbMember
+	for _, t := range targets {
+		if !t.resolve {
+			m, ok := previous[t.scheme+"://"+net.JoinHostPort(t.hostname, t.port)]
+			if !ok {
+				m = t.unresolved()
+			}
+
+			members = append(members, m)
+			continue
+		}
+
+		addrs, err := b.lookup(t.hostname)
+		if err != nil || len(addrs) == 0 {
+			log.Errorf("failed to resolve the load balancer member %s in route %s: %v", t.hostname, b.routeId, err)
+			for _, m := range current {
+				if t.owns(m) {
+					members = append(members, m)
+				}
+			}
+
+			continue
+		}
+
+		for _, a := range addrs {
+			host := net.JoinHostPort(a, t.port)
+			m, ok := previous[t.scheme+"://"+host]
+			if !ok {
+				m = &lbMember{scheme: t.scheme, host: host, serverName: t.hostname}
+			}
+
+			members = append(members, m)
+		}
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if len(members) > 0 {
+		b.members = members
+	}
+
+	b.resolving = false
+}
+
+func (b *balancer) needsResolve(now time.Time) bool {
+	if b.resolving {
+		return false
+	}
+
+	for _, t := range b.targets {
+		if t.resolve {
+			return b.resolvedAt.IsZero() || now.Sub(b.resolvedAt) >= lbResolveInterval
+		}
+	}
+
+	return false
+}
+
+// tells whether a member is neither ejected, nor marked down by the
+// health checks. The members are checked with the health check path of
+// the load balancer, or, when it has none, with the default path of the
+// health checks. Expects the lock to be held.
+func (b *balancer) available(m *lbMember, now time.Time) bool {
+	return !now.Before(m.ejectedUntil) && b.health.Healthy(healthcheck.Target{
+		Backend:    m.scheme + "://" + m.host,
+		ServerName: m.serverName,
+		Path:       b.settings.HealthCheckPath})
+}
+
+// selects the member of a request, preferring the available ones, and
+// the ones different from the excluded host, e.g. of a retried request.
+// When none of the members are available, it selects from all of them.
+func (b *balancer) pick(exclude string, now time.Time) *lbMember {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.needsResolve(now) {
+		b.resolving = true
+		b.resolvedAt = now
+		go b.resolve()
+	}
+
+	var candidates, fallback []*lbMember
+	for _, m := range b.members {
+		if !b.available(m, now) {
+			continue
+		}
+
+		fallback = append(fallback, m)
+		if m.host != exclude {
+			candidates = append(candidates, m)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = fallback
+	}
+
+	if len(candidates) == 0 {
+		candidates = b.members
+	}
+
+	var m *lbMember
+	switch {
+	case len(candidates) == 1:
+		m = candidates[0]
+	case b.settings.Algorithm == filters.PowerOfTwoChoices:
+		i := rand.Intn(len(candidates))
+		j := rand.Intn(len(candidates) - 1)
+		if j >= i {
+			j++
+		}
+
+		m = candidates[i]
+		if atomic.LoadInt64(&candidates[j].inFlight) < atomic.LoadInt64(&m.inFlight) {
+			m = candidates[j]
+		}
+	default:
+		m = candidates[b.next%len(candidates)]
+		b.next++
+	}
+
+	atomic.AddInt64(&m.inFlight, 1)
+	return m
+}
+
+// records the result of a request to a member. When counted is false,
+// e.g. when the request failed because of a proxy limit, only the
+// requests in progress are updated. The member is ejected after the
+// consecutive failures reached the limit.
+func (b *balancer) done(m *lbMember, success, counted bool, now time.Time) {
+	atomic.AddInt64(&m.inFlight, -1)
+	if !counted {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if success {
+		m.fails = 0
+		return
+	}
+
+	m.fails++
+	if m.fails >= b.settings.MaxFails {
+		m.fails = 0
+		m.ejectedUntil = now.Add(b.settings.EjectTimeout)
+		metrics.IncLoadBalancerEjected(b.routeId)
+		log.Warnf("load balancer member %s://%s of route %s ejected", m.scheme, m.host, b.routeId)
+	}
+}
+
+func newBalancers(health *healthcheck.Checker) *balancers {
+	return &balancers{
+		balancers: make(map[string]*balancer),
+		lookup:    net.LookupHost,
+		health:    health}
+}
+
+// returns the load balancer of a request, set by the filters, or nil.
+// When the settings of a load balancer changed, e.g. because the route
+// was updated, the load balancer is replaced.
+func (bs *balancers) get(c *filterContext, routeId string) *balancer {
+	s, ok := c.stateBag[filters.LoadBalancerKey].(filters.LoadBalancerSettings)
+	if !ok || len(s.Members) == 0 {
+		return nil
+	}
+
+	bs.mx.Lock()
+	defer bs.mx.Unlock()
+
+	b, ok := bs.balancers[routeId]
+	if ok && sameLoadBalancerSettings(b.config, s) {
+		return b
+	}
+
+	b = newBalancer(routeId, s, bs.lookup, bs.health)
+	if len(b.members) == 0 {
+		delete(bs.balancers, routeId)
+		return nil
+	}
+
+	bs.balancers[routeId] = b
+	return b
+}
+
+// drops the load balancers of the removed routes, registered as a route
+// change listener of the routing
+func (bs *balancers) routeChanges(c routing.RouteChanges) {
+	bs.mx.Lock()
+	defer bs.mx.Unlock()
+	for _, id := range c.Removed {
+		delete(bs.balancers, id)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testBalancer(algorithm filters.LoadBalancerAlgorithm, members ...string) *balancer {
+	return newBalancer("route1", filters.LoadBalancerSettings{Algorithm: algorithm, Members: members}, nil, nil)
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	b := testBalancer(filters.RoundRobin, "http://10.0.0.1:8080", "http://10.0.0.2:8080", "https://10.0.0.3")
+	now := time.Now()
+	for _, expected := range []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:443", "10.0.0.1:8080"} {
+		m := b.pick("", now)
+		if m.host != expected {
+			t.Error("invalid member", m.host, expected)
+		}
+
+		b.done(m, true, true, now)
+	}
+}
+
+func TestPowerOfTwoChoicesBalancer(t *testing.T) {
+	b := testBalancer(filters.PowerOfTwoChoices, "http://10.0.0.1", "http://10.0.0.2")
+	now := time.Now()
+	busy := b.pick("", now)
+	for i := 0; i < 10; i++ {
+		m := b.pick("", now)
+		if m == busy {
+			t.Fatal("failed to select the less loaded member")
+		}
+
+		b.done(m, true, true, now)
+	}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	b := testBalancer(filters.RoundRobin, "http://10.0.0.1", "http://10.0.0.2")
+	now := time.Now()
+	failing, other := b.members[0], b.members[1]
+	for i := 0; i < defaultLBMaxFails; i++ {
+		m := b.pick(other.host, now)
+		if m != failing {
+			t.Fatal("failed to select the member")
+		}
+
+		b.done(m, false, true, now)
+	}
+
+	for i := 0; i < 4; i++ {
+		m := b.pick("", now)
+		if m == failing {
+			t.Fatal("failed to eject the member")
+		}
+
+		b.done(m, true, true, now)
+	}
+
+	found := false
+	for i := 0; i < 4; i++ {
+		if b.pick("", now.Add(defaultLBEjectTimeout)) == failing {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Error("failed to restore the member after the eject timeout")
+	}
+}
+
+func TestBalancerAllEjected(t *testing.T) {
+	b := testBalancer(filters.RoundRobin, "http://10.0.0.1")
+	now := time.Now()
+	for i := 0; i < defaultLBMaxFails; i++ {
+		b.done(b.pick("", now), false, true, now)
+	}
+
+	if m := b.pick("", now); m != b.members[0] {
+		t.Error("failed to fall back to the ejected members")
+	}
+}
+
+func TestBalancerExclude(t *testing.T) {
+	b := testBalancer(filters.RoundRobin, "http://10.0.0.1", "http://10.0.0.2")
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		if m := b.pick("10.0.0.1:80", now); m.host != "10.0.0.2:80" {
+			t.Error("failed to exclude the member", m.host)
+		}
+	}
+}
+
+func TestBalancerResolve(t *testing.T) {
+	addresses := []string{"10.0.0.1", "10.0.0.2"}
+	var lookupErr error
+	b := newBalancer("route1", filters.LoadBalancerSettings{
+		Members: []string{"https://api.internal", "http://10.0.1.1:8080"},
+	}, func(name string) ([]string, error) {
+		if name != "api.internal" {
+			t.Error("invalid name", name)
+		}
+
+		return addresses, lookupErr
+	}, nil)
+
+	if len(b.members) != 2 || b.members[0].host != "api.internal:443" {
+		t.Fatal("failed to use the unresolved member")
+	}
+
+	b.resolve()
+	if len(b.members) != 3 ||
+		b.members[0].host != "10.0.0.1:443" || b.members[0].serverName != "api.internal" ||
+		b.members[1].host != "10.0.0.2:443" || b.members[2].host != "10.0.1.1:8080" {
+		t.Fatal("failed to resolve the members", b.members)
+	}
+
+	kept := b.members[1]
+	addresses = []string{"10.0.0.2", "10.0.0.3"}
+	b.resolve()
+	if len(b.members) != 3 || b.members[0] != kept || b.members[1].host != "10.0.0.3:443" {
+		t.Error("failed to keep the state of the resolved members", b.members)
+	}
+
+	lookupErr = errors.New("lookup failed")
+	b.resolve()
+	if len(b.members) != 3 || b.members[0] != kept || b.members[1].host != "10.0.0.3:443" {
+		t.Error("failed to keep the members when the lookup fails", b.members)
+	}
+}
+
+func TestBalancersReplacedOnChange(t *testing.T) {
+	bs := newBalancers(nil)
+	c := &filterContext{stateBag: make(map[string]interface{})}
+	if bs.get(c, "route1") != nil {
+		t.Error("unexpected load balancer")
+	}
+
+	c.stateBag[filters.LoadBalancerKey] = filters.LoadBalancerSettings{Members: []string{"http://10.0.0.1"}}
+	b := bs.get(c, "route1")
+	if b == nil || bs.get(c, "route1") != b {
+		t.Error("failed to reuse the load balancer")
+	}
+
+	c.stateBag[filters.LoadBalancerKey] = filters.LoadBalancerSettings{Members: []string{"http://10.0.0.1", "http://10.0.0.2"}}
+	if bs.get(c, "route1") == b {
+		t.Error("failed to replace the load balancer")
+	}
+}
+
+func TestBalancersDroppedWithRemovedRoutes(t *testing.T) {
+	bs := newBalancers(nil)
+	c := &filterContext{stateBag: map[string]interface{}{
+		filters.LoadBalancerKey: filters.LoadBalancerSettings{Members: []string{"http://10.0.0.1"}}}}
+	b1 := bs.get(c, "route1")
+	bs.get(c, "route2")
+
+	bs.routeChanges(routing.RouteChanges{Updated: []string{"route1"}, Removed: []string{"route2"}})
+	if len(bs.balancers) != 1 || bs.balancers["route1"] != b1 {
+		t.Error("failed to drop the load balancer of the removed route", bs.balancers)
+	}
+}
+
+func TestLoadBalancerFilter(t *testing.T) {
+	hits := make(map[string]int)
+	member := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+		}))
+	}
+
+	m1, m2 := member("m1"), member("m2")
+	defer m1.Close()
+	defer m2.Close()
+
+	p, _ := bodyLimitProxy(t, fmt.Sprintf(`loadBalancer("roundRobin", "%s", "%s")`, m1.URL, m2.URL), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request to the route backend")
+	}))
+
+	for i := 0; i < 4; i++ {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Error("failed to forward the request", w.Code)
+		}
+	}
+
+	if hits["m1"] != 2 || hits["m2"] != 2 {
+		t.Error("failed to balance the requests", hits)
+	}
+}
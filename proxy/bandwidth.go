@@ -0,0 +1,212 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/metrics"
+	"sync"
+	"time"
+)
+
+// the smallest chunk of a response body written in one step, when the
+// bandwidth is shared by many streams
+const minBandwidthChunk = 512
+
+// token bucket shared by the response streams. The tokens are reserved
+// before writing, and the balance can go below zero, in which case the
+// writer waits until the reserved tokens are refilled. Since every
+// stream reserves at most its fair share of the burst at a time, the
+// streams ready to write take turns, while the ones blocked by a slow
+// client don't consume the bandwidth of the others.
+type bandwidthBucket struct {
+	mx      sync.Mutex
+	rate    int64
+	tokens  float64
+	last    time.Time
+	streams int
+}
+
+// the global and the per-route buckets
+type bandwidth struct {
+	global *bandwidthBucket
+	mx     sync.Mutex
+	routes map[string]*bandwidthBucket
+}
+
+// a response stream written within the limits of one or more buckets
+type bandwidthStream struct {
+	to      flusherWriter
+	buckets []*bandwidthBucket
+	wait    time.Duration
+}
+
+func newBandwidthBucket(rate int64) *bandwidthBucket {
+	return &bandwidthBucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// allows bursts of up to one second
+func (b *bandwidthBucket) burst() float64 {
+	return float64(b.rate)
+}
+
+// the number of bytes a stream can reserve at a time
+func (b *bandwidthBucket) share() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	s := b.rate / int64(b.streams)
+	if s < minBandwidthChunk {
+		return minBandwidthChunk
+	}
+
+	return int(s)
+}
+
+func (b *bandwidthBucket) addStream(d int) {
+	b.mx.Lock()
+	b.streams += d
+	b.mx.Unlock()
+}
+
+// reserves n tokens, and returns how long the caller needs to wait
+// before using them
+func (b *bandwidthBucket) reserve(n int, now time.Time) time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+		if b.tokens > b.burst() {
+			b.tokens = b.burst()
+		}
+
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// the global bucket is nil, when the global bandwidth is not limited
+func newBandwidth(global int64) *bandwidth {
+	b := &bandwidth{routes: make(map[string]*bandwidthBucket)}
+	if global > 0 {
+		b.global = newBandwidthBucket(global)
+	}
+
+	return b
+}
+
+// returns the bucket of a route, and registers the stream. When the
+// rate of the route changed, e.g. because the route was updated, the
+// bucket takes the new rate. The buckets are kept after the streams
+// are finished, so that the subsequent requests can't exceed the
+// bandwidth by getting a new burst.
+func (b *bandwidth) routeBucket(routeId string, rate int64) *bandwidthBucket {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	rb, ok := b.routes[routeId]
+	if !ok {
+		rb = newBandwidthBucket(rate)
+		b.routes[routeId] = rb
+	}
+
+	rb.mx.Lock()
+	rb.rate = rate
+	rb.mx.Unlock()
+
+	rb.addStream(1)
+	return rb
+}
+
+// wraps the response writer, when either the global or the route's
+// bandwidth is limited. The returned function needs to be called when
+// the response is finished, and it reports the time spent waiting for
+// the bandwidth.
+func (b *bandwidth) stream(to flusherWriter, routeId string, routeRate int64) (flusherWriter, func()) {
+	if b.global == nil && routeRate <= 0 {
+		return to, func() {}
+	}
+
+	s := &bandwidthStream{to: to}
+	if b.global != nil {
+		b.global.addStream(1)
+		s.buckets = append(s.buckets, b.global)
+	}
+
+	var rb *bandwidthBucket
+	if routeRate > 0 {
+		rb = b.routeBucket(routeId, routeRate)
+		s.buckets = append(s.buckets, rb)
+	}
+
+	return s, func() {
+		if b.global != nil {
+			b.global.addStream(-1)
+		}
+
+		if rb != nil {
+			rb.addStream(-1)
+		}
+
+		metrics.MeasureBandwidthWait(routeId, s.wait)
+	}
+}
+
+// writes the buffer in chunks of the fair share, waiting for the
+// reserved tokens of all the buckets
+func (s *bandwidthStream) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := len(p)
+		for _, b := range s.buckets {
+			if share := b.share(); share < n {
+				n = share
+			}
+		}
+
+		var wait time.Duration
+		now := time.Now()
+		for _, b := range s.buckets {
+			if d := b.reserve(n, now); d > wait {
+				wait = d
+			}
+		}
+
+		if wait > 0 {
+			time.Sleep(wait)
+			s.wait += wait
+		}
+
+		w, err := s.to.Write(p[:n])
+		written += w
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (s *bandwidthStream) Flush() {
+	s.to.Flush()
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type bufferFlusher struct {
+	bytes.Buffer
+	writes int
+}
+
+func (b *bufferFlusher) Write(p []byte) (int, error) {
+	b.writes++
+	return b.Buffer.Write(p)
+}
+
+func (b *bufferFlusher) Flush() {}
+
+func TestBandwidthBucketReserve(t *testing.T) {
+	b := newBandwidthBucket(1000)
+	now := b.last
+	if d := b.reserve(1000, now); d != 0 {
+		t.Error("failed to take the burst", d)
+	}
+
+	if d := b.reserve(500, now); d != 500*time.Millisecond {
+		t.Error("invalid wait", d)
+	}
+
+	if d := b.reserve(500, now.Add(time.Second)); d != 0 {
+		t.Error("failed to refill", d)
+	}
+
+	if d := b.reserve(100, now.Add(time.Hour)); d != 0 || b.tokens != 900 {
+		t.Error("failed to cap the burst", d, b.tokens)
+	}
+}
+
+func TestBandwidthNotLimited(t *testing.T) {
+	to := &bufferFlusher{}
+	s, finish := newBandwidth(0).stream(to, "route", 0)
+	defer finish()
+	if s != to {
+		t.Error("unexpected wrapping of the response")
+	}
+}
+
+func TestBandwidthFairShare(t *testing.T) {
+	b := newBandwidth(1 << 20)
+	var streams []flusherWriter
+	var finish []func()
+	for i := 0; i < 4; i++ {
+		s, f := b.stream(&bufferFlusher{}, "route", 0)
+		streams = append(streams, s)
+		finish = append(finish, f)
+	}
+
+	if share := b.global.share(); share != 1<<18 {
+		t.Error("invalid share", share)
+	}
+
+	to := &bufferFlusher{}
+	s, _ := b.stream(to, "route", 0)
+	if n, err := s.Write(make([]byte, 1<<18)); n != 1<<18 || err != nil || to.writes != 2 {
+		t.Error("failed to write in chunks", n, err, to.writes)
+	}
+
+	for _, f := range finish {
+		f()
+	}
+
+	if b.global.streams != 1 {
+		t.Error("failed to release the streams", b.global.streams)
+	}
+}
+
+func TestBandwidthRouteBuckets(t *testing.T) {
+	b := newBandwidth(0)
+	_, finish1 := b.stream(&bufferFlusher{}, "route", 2048)
+	_, finish2 := b.stream(&bufferFlusher{}, "route", 4096)
+	if len(b.routes) != 1 || b.routes["route"].rate != 4096 || b.routes["route"].streams != 2 {
+		t.Error("failed to share the route bucket")
+	}
+
+	finish1()
+	finish2()
+	if b.routes["route"].streams != 0 {
+		t.Error("failed to release the streams")
+	}
+}
+
+func TestBandwidthLimitsTheStreams(t *testing.T) {
+	b := newBandwidth(0)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, finish := b.stream(&bufferFlusher{}, "route", 8192)
+			defer finish()
+			s.Write(make([]byte, 8192))
+		}()
+	}
+
+	wg.Wait()
+
+	// the burst of the bucket covers the first 8192 bytes
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Error("failed to limit the bandwidth", d)
+	}
+}
+
+func TestResponseBandwidthFilter(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 3072)
+	p, _ := bodyLimitProxy(t, "responseBandwidth(1024)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	start := time.Now()
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if !bytes.Equal(w.Body.Bytes(), body) {
+		t.Error("failed to stream the body")
+	}
+
+	if d := time.Since(start); d < 1900*time.Millisecond {
+		t.Error("failed to limit the bandwidth", d)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/metrics"
+	"io"
+)
+
+// Error returned when a filter reads more from a request or response
+// body than the body buffering limit allows.
+var ErrBodyBufferingLimit = errors.New("body buffering limit exceeded")
+
+// counts the bytes that the filters read from a body, while they are
+// executed. Reading the body in a filter means buffering it, because
+// the body needs to be passed on. Reading it after the filters, e.g.
+// when a filter wraps the body with a streaming reader, is not counted.
+type bodyGuard struct {
+	body       io.ReadCloser
+	routeId    string
+	direction  string
+	threshold  int64
+	limit      int64
+	filtering  bool
+	filterRead int64
+	exceeded   bool
+}
+
+// returns nil, when there is no body or neither the threshold nor the
+// limit is set
+func newBodyGuard(body io.ReadCloser, routeId, direction string, threshold, limit int64) *bodyGuard {
+	if body == nil || threshold <= 0 && limit <= 0 {
+		return nil
+	}
+
+	return &bodyGuard{
+		body:      body,
+		routeId:   routeId,
+		direction: direction,
+		threshold: threshold,
+		limit:     limit,
+		filtering: true}
+}
+
+func (g *bodyGuard) Read(p []byte) (int, error) {
+	n, err := g.body.Read(p)
+	if !g.filtering {
+		return n, err
+	}
+
+	g.filterRead += int64(n)
+	if g.limit > 0 && g.filterRead > g.limit {
+		g.exceeded = true
+		return n, ErrBodyBufferingLimit
+	}
+
+	return n, err
+}
+
+func (g *bodyGuard) Close() error {
+	return g.body.Close()
+}
+
+// reports the filter, when it read more than the threshold from the
+// body, and returns false, when it exceeded the limit
+func (g *bodyGuard) checkFilter(filterName string) bool {
+	if g == nil {
+		return true
+	}
+
+	n := g.filterRead
+	g.filterRead = 0
+	if g.threshold > 0 && n > g.threshold {
+		log.Warnf(
+			"filter %s buffered %d bytes of the %s body, route: %s",
+			filterName, n, g.direction, g.routeId)
+		metrics.IncFilterBuffered(filterName, g.direction)
+	}
+
+	return !g.exceeded
+}
+
+// stops counting, after the filters were executed
+func (g *bodyGuard) release() {
+	if g != nil {
+		g.filtering = false
+	}
+}
+
+func (g *bodyGuard) limitExceeded() bool {
+	return g != nil && g.exceeded
+}
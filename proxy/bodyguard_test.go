@@ -0,0 +1,76 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBodyGuardDisabled(t *testing.T) {
+	body := ioutil.NopCloser(bytes.NewBufferString("Hello World!"))
+	if newBodyGuard(body, "route", "request", 0, 0) != nil {
+		t.Error("failed to disable the guard")
+	}
+
+	if newBodyGuard(nil, "route", "request", 4, 8) != nil {
+		t.Error("failed to ignore the missing body")
+	}
+
+	var g *bodyGuard
+	if !g.checkFilter("filter") || g.limitExceeded() {
+		t.Error("invalid state of the disabled guard")
+	}
+
+	g.release()
+}
+
+func TestBodyGuardCountsFilterReads(t *testing.T) {
+	g := newBodyGuard(ioutil.NopCloser(bytes.NewBufferString("Hello World!")), "route", "request", 4, 8)
+
+	b := make([]byte, 5)
+	if n, err := g.Read(b); n != 5 || err != nil {
+		t.Error("failed to read", n, err)
+	}
+
+	if !g.checkFilter("first") {
+		t.Error("unexpected limit")
+	}
+
+	if n, err := g.Read(b); n != 5 || err != nil {
+		t.Error("failed to count the reads per filter", n, err)
+	}
+
+	if !g.checkFilter("second") {
+		t.Error("unexpected limit")
+	}
+
+	g.release()
+	if b, err := ioutil.ReadAll(g); err != nil || string(b) != "d!" {
+		t.Error("failed to stream the body after the filters", string(b), err)
+	}
+}
+
+func TestBodyGuardLimit(t *testing.T) {
+	g := newBodyGuard(ioutil.NopCloser(bytes.NewBufferString("Hello World!")), "route", "response", 0, 8)
+	if _, err := ioutil.ReadAll(g); err != ErrBodyBufferingLimit {
+		t.Error("failed to limit the read", err)
+	}
+
+	if g.checkFilter("filter") || !g.limitExceeded() {
+		t.Error("failed to report the exceeded limit")
+	}
+}
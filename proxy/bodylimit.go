@@ -0,0 +1,90 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	// Error passed to the error handler, when the request body exceeded
+	// the size limit set by the filters.
+	ErrRequestBodySizeLimit = errors.New("request body size limit exceeded")
+
+	// Error passed to the error handler, when the response body exceeded
+	// the size limit set by the filters.
+	ErrResponseBodySizeLimit = errors.New("response body size limit exceeded")
+)
+
+// counts the bytes read from a body, and fails, when the limit is
+// exceeded
+type sizeLimitedBody struct {
+	body     io.ReadCloser
+	limit    int64
+	read     int64
+	err      error
+	exceeded bool
+}
+
+func newSizeLimitedBody(body io.ReadCloser, limit int64, err error) *sizeLimitedBody {
+	return &sizeLimitedBody{body: body, limit: limit, err: err}
+}
+
+func (b *sizeLimitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, b.err
+	}
+
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		// the bytes within the limit are returned first, and the
+		// error with the next read
+		b.exceeded = true
+		n -= int(b.read - b.limit)
+		if n > 0 {
+			return n, nil
+		}
+
+		return 0, b.err
+	}
+
+	return n, err
+}
+
+func (b *sizeLimitedBody) Close() error {
+	return b.body.Close()
+}
+
+func (b *sizeLimitedBody) limitExceeded() bool {
+	return b != nil && b.exceeded
+}
+
+// closes the client connection, when possible, so that the client
+// doesn't take a response aborted in the middle of the body for a
+// complete one
+func abortResponse(w http.ResponseWriter) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+
+	conn, _, err := h.Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
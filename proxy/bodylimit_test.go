@@ -0,0 +1,121 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSizeLimitedBody(t *testing.T) {
+	b := newSizeLimitedBody(ioutil.NopCloser(strings.NewReader("foobarbaz")), 6, ErrRequestBodySizeLimit)
+	content, err := ioutil.ReadAll(b)
+	if err != ErrRequestBodySizeLimit || string(content) != "foobar" || !b.limitExceeded() {
+		t.Error("failed to limit the body", string(content), err)
+	}
+
+	b = newSizeLimitedBody(ioutil.NopCloser(strings.NewReader("foobar")), 6, ErrRequestBodySizeLimit)
+	content, err = ioutil.ReadAll(b)
+	if err != nil || string(content) != "foobar" || b.limitExceeded() {
+		t.Error("failed to read the body", string(content), err)
+	}
+}
+
+func bodyLimitProxy(t *testing.T, filter string, backend http.Handler) (http.Handler, *error) {
+	s := httptest.NewServer(backend)
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`limited: Path("/") -> %s -> "%s"`, filter, s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handledErr := new(error)
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error, _ *routing.Route) {
+			*handledErr = err
+			w.WriteHeader(http.StatusTeapot)
+		}})
+
+	delay()
+	return p, handledErr
+}
+
+// a body of unknown length
+type streamBody struct{ io.Reader }
+
+func TestRequestBodySizeLimit(t *testing.T) {
+	p, handledErr := bodyLimitProxy(t, "maxRequestBodySize(6)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+
+	for _, ti := range []struct {
+		body string
+		err  error
+	}{
+		{"foo", nil},
+		{"foobar", nil},
+		{"foobarbaz", ErrRequestBodySizeLimit},
+		{strings.Repeat("foobarbaz", 1<<16), ErrRequestBodySizeLimit},
+	} {
+		*handledErr = nil
+		r, _ := http.NewRequest("POST", "https://www.example.org/", streamBody{bytes.NewBufferString(ti.body)})
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if *handledErr != ti.err {
+			t.Error("unexpected result", len(ti.body), w.Code, *handledErr)
+		}
+	}
+}
+
+func TestResponseBodySizeLimit(t *testing.T) {
+	p, handledErr := bodyLimitProxy(t, "maxResponseBodySize(6)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") == "true" {
+			w.Write([]byte("foo"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("barbaz"))
+			return
+		}
+
+		w.Header().Set("Content-Length", "9")
+		w.Write([]byte("foobarbaz"))
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot || *handledErr != ErrResponseBodySizeLimit {
+		t.Error("failed to reject the response", w.Code, *handledErr)
+	}
+
+	*handledErr = nil
+	r, _ = http.NewRequest("GET", "https://www.example.org/?stream=true", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "foobar" || *handledErr != nil {
+		t.Error("failed to abort the response", w.Code, w.Body.String(), *handledErr)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerTimeout          = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// Error passed to the error handler, when a request is rejected without
+// a backend roundtrip, because the circuit breaker of the backend is
+// open.
+var ErrCircuitBreakerOpen = errors.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// the state of a circuit breaker of a backend host or a route. The
+// generation changes on every state change, so that the results of the
+// requests started in an earlier state are ignored.
+type breaker struct {
+	mx         sync.Mutex
+	key        string
+	config     filters.CircuitBreakerSettings
+	settings   filters.CircuitBreakerSettings
+	state      breakerState
+	generation int
+	failures   int
+	outcomes   []bool
+	next       int
+	openUntil  time.Time
+	probes     int
+	succeeded  int
+}
+
+// the breakers of the hosts and the routes are kept separately
+type breakerKey struct {
+	scope filters.BreakerScope
+	name  string
+}
+
+// the circuit breakers of the proxy
+type breakers struct {
+	defaults filters.CircuitBreakerSettings
+	mx       sync.Mutex
+	breakers map[breakerKey]*breaker
+}
+
+// the settings are stored as configured, and with the defaults applied
+func newBreaker(key string, s filters.CircuitBreakerSettings) *breaker {
+	config := s
+	if s.Timeout <= 0 {
+		s.Timeout = defaultBreakerTimeout
+	}
+
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	b := &breaker{key: key, config: config, settings: s}
+	if s.Type == filters.RateBreaker {
+		b.outcomes = make([]bool, s.Window)
+	}
+
+	return b
+}
+
+func (b *breaker) setState(s breakerState) {
+	b.state = s
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	b.succeeded = 0
+	for i := range b.outcomes {
+		b.outcomes[i] = false
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.setState(breakerOpen)
+	b.openUntil = now.Add(b.settings.Timeout)
+	metrics.IncCircuitBreakerOpened(b.key)
+	log.Warnf("circuit breaker %s opened", b.key)
+}
+
+// returns whether a request can be sent to the backend, and the
+// generation of the breaker, that needs to be passed to done
+func (b *breaker) allow(now time.Time) (bool, int) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return false, 0
+		}
+
+		b.setState(breakerHalfOpen)
+	}
+
+	if b.state == breakerHalfOpen {
+		if b.probes >= b.settings.HalfOpenRequests {
+			return false, 0
+		}
+
+		b.probes++
+	}
+
+	return true, b.generation
+}
+
+// records the result of a request. The closed breaker opens when the
+// failures reach the limit of its policy. The half-open breaker opens
+// again on the first failed probe, and closes when all the probes
+// succeeded.
+func (b *breaker) done(generation int, success bool, now time.Time) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case breakerClosed:
+		if b.settings.Type == filters.RateBreaker {
+			b.outcomes[b.next] = !success
+			b.next = (b.next + 1) % len(b.outcomes)
+			b.failures = 0
+			for _, failed := range b.outcomes {
+				if failed {
+					b.failures++
+				}
+			}
+		} else if success {
+			b.failures = 0
+		} else {
+			b.failures++
+		}
+
+		if b.failures >= b.settings.Failures {
+			b.open(now)
+		}
+	case breakerHalfOpen:
+		if !success {
+			b.open(now)
+			return
+		}
+
+		b.succeeded++
+		if b.succeeded >= b.settings.HalfOpenRequests {
+			b.setState(breakerClosed)
+			log.Infof("circuit breaker %s closed", b.key)
+		}
+	}
+}
+
+// releases the probe slot of a request that failed without reaching
+// the backend, e.g. because of a proxy limit
+func (b *breaker) cancel(generation int) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if generation == b.generation && b.state == breakerHalfOpen {
+		b.probes--
+	}
+}
+
+func newBreakers(defaults filters.CircuitBreakerSettings) *breakers {
+	return &breakers{defaults: defaults, breakers: make(map[breakerKey]*breaker)}
+}
+
+// returns the breaker of a request, from the settings of the filters
+// or the defaults, or nil, when disabled. When the settings of a
+// breaker changed, e.g. because the route was updated, the breaker is
+// replaced.
+func (bs *breakers) get(c *filterContext, routeId, host string) *breaker {
+	s, ok := c.stateBag[filters.CircuitBreakerKey].(filters.CircuitBreakerSettings)
+	if !ok {
+		s = bs.defaults
+	}
+
+	if s.Type == filters.BreakerDisabled || s.Failures <= 0 ||
+		s.Type == filters.RateBreaker && s.Window < s.Failures {
+		return nil
+	}
+
+	key := breakerKey{s.Scope, host}
+	if s.Scope == filters.RouteBreaker {
+		key.name = routeId
+	}
+
+	bs.mx.Lock()
+	defer bs.mx.Unlock()
+
+	b, ok := bs.breakers[key]
+	if !ok || b.config != s {
+		b = newBreaker(key.name, s)
+		bs.breakers[key] = b
+	}
+
+	return b
+}
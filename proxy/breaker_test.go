@@ -0,0 +1,154 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func checkBreaker(t *testing.T, b *breaker, now time.Time, results ...bool) {
+	for i, success := range results {
+		allowed, generation := b.allow(now)
+		if !allowed {
+			t.Fatal("unexpected rejection", i)
+		}
+
+		b.done(generation, success, now)
+	}
+}
+
+func TestConsecutiveBreaker(t *testing.T) {
+	b := newBreaker("foo", filters.CircuitBreakerSettings{Type: filters.ConsecutiveBreaker, Failures: 3})
+	now := time.Now()
+	checkBreaker(t, b, now, false, false, true, false, false)
+	if b.state != breakerClosed {
+		t.Error("failed to reset the failures on success")
+	}
+
+	checkBreaker(t, b, now, false)
+	if allowed, _ := b.allow(now); allowed || b.state != breakerOpen {
+		t.Error("failed to open the breaker")
+	}
+
+	if allowed, _ := b.allow(now.Add(defaultBreakerTimeout - time.Millisecond)); allowed {
+		t.Error("failed to keep the breaker open until the timeout")
+	}
+}
+
+func TestRateBreaker(t *testing.T) {
+	b := newBreaker("foo", filters.CircuitBreakerSettings{Type: filters.RateBreaker, Failures: 2, Window: 4})
+	now := time.Now()
+	checkBreaker(t, b, now, false, true, true, true, false, true, true)
+	if b.state != breakerClosed {
+		t.Error("failed to slide the window")
+	}
+
+	checkBreaker(t, b, now, false)
+	if b.state != breakerOpen {
+		t.Error("failed to open the breaker")
+	}
+}
+
+func TestHalfOpenBreaker(t *testing.T) {
+	b := newBreaker("foo", filters.CircuitBreakerSettings{
+		Type:             filters.ConsecutiveBreaker,
+		Failures:         1,
+		Timeout:          time.Second,
+		HalfOpenRequests: 2})
+	now := time.Now()
+	checkBreaker(t, b, now, false)
+
+	now = now.Add(time.Second)
+	allowed1, g1 := b.allow(now)
+	allowed2, g2 := b.allow(now)
+	if allowed3, _ := b.allow(now); !allowed1 || !allowed2 || allowed3 || b.state != breakerHalfOpen {
+		t.Fatal("failed to let through the probes")
+	}
+
+	b.cancel(g2)
+	allowed2, g2 = b.allow(now)
+	if !allowed2 {
+		t.Fatal("failed to release the probe")
+	}
+
+	b.done(g1, true, now)
+	b.done(g2, false, now)
+	if b.state != breakerOpen {
+		t.Error("failed to open the breaker again")
+	}
+
+	now = now.Add(time.Second)
+	checkBreaker(t, b, now, true, true)
+	if b.state != breakerClosed {
+		t.Error("failed to close the breaker")
+	}
+}
+
+func TestBreakerIgnoresEarlierGenerations(t *testing.T) {
+	b := newBreaker("foo", filters.CircuitBreakerSettings{Type: filters.ConsecutiveBreaker, Failures: 1})
+	now := time.Now()
+	_, early := b.allow(now)
+	checkBreaker(t, b, now, false)
+	b.done(early, true, now)
+	if b.state != breakerOpen {
+		t.Error("failed to ignore the result of an earlier request")
+	}
+}
+
+func TestBreakersScope(t *testing.T) {
+	bs := newBreakers(filters.CircuitBreakerSettings{Type: filters.ConsecutiveBreaker, Failures: 1})
+	c := &filterContext{stateBag: make(map[string]interface{})}
+	if bs.get(c, "route1", "www.example.org") != bs.get(c, "route2", "www.example.org") {
+		t.Error("failed to share the breaker of the host")
+	}
+
+	c.stateBag[filters.CircuitBreakerKey] = filters.CircuitBreakerSettings{
+		Type:     filters.ConsecutiveBreaker,
+		Failures: 1,
+		Scope:    filters.RouteBreaker}
+	if bs.get(c, "route1", "www.example.org") == bs.get(c, "route2", "www.example.org") {
+		t.Error("failed to separate the breakers of the routes")
+	}
+
+	c.stateBag[filters.CircuitBreakerKey] = filters.CircuitBreakerSettings{}
+	if bs.get(c, "route1", "www.example.org") != nil {
+		t.Error("failed to disable the breaker")
+	}
+}
+
+func TestCircuitBreakerFilter(t *testing.T) {
+	var requests int
+	p, handledErr := bodyLimitProxy(t, `circuitBreaker("consecutive", "failures", 2, "timeout", "1h")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if i < 2 && w.Code != http.StatusInternalServerError {
+			t.Error("failed to forward the request", i, w.Code)
+		}
+	}
+
+	if *handledErr != ErrCircuitBreakerOpen || requests != 2 {
+		t.Error("failed to reject the request", *handledErr, requests)
+	}
+}
@@ -30,24 +30,42 @@ Proxy Mechanism
 The incoming request is matched to the current routing tree, implemented
 in skipper/routing. The result may be a route, which will be used for
 forwarding or handling the request, or nil, in which case the proxy
-responds with 404.
+responds with 404, or, when a default backend is set, forwards the
+request to the default backend. When the request would match one or more
+routes with a different method, the proxy responds with 405, and the
+Allow header lists the methods of these routes. When the
+OptionsAutoOptions flag is set, and the request with the method OPTIONS
+doesn't match any route, the proxy responds to it itself, with 200 and
+the Allow header, without contacting the backends. The requests not
+matching any route are counted in the metrics by their host, to help
+detecting missing routes.
 
 
 2. upstream request augmentation:
 
 In case of a matched route, the request handling method of all filters
-in the route will be executed in the order they are defined. The filters
+in the route will be executed in the order they are defined, except for
+the filters in an earlier phase, e.g. authentication, which run first
+(see skipper/filters). The filters
 share a context object, that provides the in-memory representation of the
 incoming request, the outgoing response writer, the path parameters
 derived from the actual request path (see skipper/routing) and a
 free-form state bag. The filters may modify the request or pass data to
-each other using the state bag.
+each other using the state bag. Data private to a filter instance, e.g.
+a decision made on the request and needed again on the response, is
+kept in the per-instance filter state instead, so that multiple
+instances of the same filter in a route don't overwrite each other.
 
 
 3.a upstream request:
 
 The incoming and augmented request is mapped to an outgoing request and
-executed, addressing the endpoint defined by the current route.
+executed, addressing the endpoint defined by the current route. In case
+of a split backend, the endpoint is picked randomly for each request,
+according to the weights of the endpoints in the route. In case of a
+dynamic backend, the endpoint is set by the filters, and when they
+don't set it, the proxy responds with 500, passing
+ErrDynamicBackendNotSet to the error handler.
 
 
 3.b shunt:
@@ -56,6 +74,25 @@ In case the route is a 'shunt', an empty response is created with
 default 404 status.
 
 
+3.c loopback:
+
+In case the route is a 'loopback', the request, as modified by the
+filters, is matched again against the routes, and it is handled by the
+matching route from step 1. Its response is used as the response of the
+loopback route, as soon as its header was written, while its body and
+trailers are streamed. The next hop receives a copy of the request,
+and when the LoopbackHeaders parameter is set, the copy contains only
+the headers listed there, so that the headers set internally by the
+filters of the loopback route don't reach the backend of the next hop,
+and the clients can't send them directly. The filters of the two routes
+share only the state bag entries listed in the LoopbackStateBag
+parameter. To prevent loops, a request can re-enter the routing at most
+9 times, after that the proxy responds with 500, passing
+ErrLoopbackLimit to the error handler. The upgrade requests, e.g.
+websocket requests, are rejected by the loopback routes with 400,
+passing ErrLoopbackUpgrade to the error handler.
+
+
 4. downstream response augmentation:
 
 The response handling method of all filters in the current route
@@ -73,7 +110,8 @@ as 'served'.
 In case none of the filters handled the request, the response
 properties, including the status and the headers, are mapped to the
 outgoing response writer, and the response body is streamed to it, with
-continuous flushing.
+continuous flushing. The trailers of the response, received from the
+backend or added by the filters, are sent after the body.
 
 
 Routing Rules
@@ -87,6 +125,301 @@ from the external data sources, and are tested against the requests
 before the general routing tree.
 
 
+Draining Removed Backends
+
+When the OptionsDrainRemovedBackends flag is set, the proxy closes the
+idle pooled connections, when a routing table update removes a backend,
+i.e. none of the routes point to it anymore. Optionally, with the
+CancelRemovedAfter parameter, the requests that were in-flight to the
+removed backend at the time of the update, are canceled after a grace
+period, so that the decommissioned backends stop receiving traffic
+promptly.
+
+
+Error Handling
+
+By default, the proxy responds with 404 to the requests that don't match
+any route, with 405 to those that would match a route with a different
+method, and with 500, when the request to the backend fails. Embedding
+applications can render their own error responses, and emit their own
+telemetry, by setting the ErrorHandler parameter. The handler receives
+the error, ErrRouteNotFound or ErrMethodNotAllowed for the unmatched
+requests, and the route, when there was one.
+
+
+Slow Requests
+
+To help finding the filters or backends that cause hung requests, the
+proxy can report the requests that exceed a latency budget, set with the
+SlowRequestThreshold parameter. When the budget is exceeded, and the
+request is still in progress, the proxy logs a warning with the matched
+route, and the time spent in the completed stages of the request: the
+route lookup, every request and response filter, the backend roundtrip
+and the streaming of the response body, together with the stage in
+progress. When the OptionsSlowRequestProfile flag is set, the warning
+contains the stacks of the goroutines, too.
+
+
+Body Buffering
+
+Filters that read the request or the response bodies, while they are
+executed, buffer them in memory, because the body needs to be passed on
+to the backend or to the client. To protect the memory of the proxy,
+the bytes read by every filter are counted, when the
+BodyBufferingThreshold or the BodyBufferingLimit parameter is set. The
+filters reading more than the threshold are reported in the log and the
+metrics. When a filter reads more than the limit, the read fails with
+ErrBodyBufferingLimit, and the proxy responds with 413 Request Entity
+Too Large to the request, or with 502 Bad Gateway instead of the
+backend response. The bodies that are only wrapped by the filters, and
+streamed afterwards, are not affected.
+
+
+Resource Limits
+
+To prevent that a traffic spike or slow backends exhaust the goroutines
+and the file descriptors of the whole instance, the proxy accepts
+global caps. With the MaxInFlightRequests parameter, the requests
+received while the given number of requests is in progress are
+rejected with 503 Service Unavailable. With the MaxBackendConnections
+parameter, the open backend connections, including the idle pooled
+ones, are capped. When a new connection would exceed the cap, the idle
+connections are closed, and if it still doesn't fit, the request is
+rejected with 503, without dialing. The custom error
+handler receives ErrInFlightRequestsLimit or ErrBackendConnectionsLimit
+in these cases. The current usage of the capped resources is reported
+in the saturation metrics.
+
+
+Body Size Limits
+
+The filters can limit the size of the request and the response bodies,
+e.g. the maxRequestBodySize and the maxResponseBodySize filters, by
+setting the limits in the state bag. The proxy counts the bytes of the
+bodies while streaming them. When the request body exceeds its limit,
+the backend request is aborted, and the proxy responds with 413 Request
+Entity Too Large. When the Content-Length of the response exceeds the
+limit, the proxy responds with 502 Bad Gateway, while the responses of
+unknown length are aborted when the limit is exceeded, closing the
+client connection when the response writer supports it. The custom
+error handler receives ErrRequestBodySizeLimit or
+ErrResponseBodySizeLimit in these cases.
+
+
+Upgraded Connections
+
+The requests asking for a protocol upgrade, e.g. websocket or h2c, are
+sent to the backend on a dedicated connection. When the backend accepts
+the upgrade with 101 Switching Protocols, the proxy forwards the
+response, takes over the client connection, and copies the data between
+the client and the backend in both directions, until either side closes
+its connection. The UpgradeIdleTimeout parameter closes the connections
+with no data sent in either direction for the given duration, and the
+lifetime and bandwidth limits of the websocketLimits filter apply, too.
+When the response writer doesn't support taking over the connection,
+the request is answered with 502 Bad Gateway, passing
+ErrUpgradeNotSupported to the custom error handler. When the backend
+doesn't accept the upgrade, its response is handled as any other one.
+
+The upgrade requests are tracked per route, from the start of the
+backend request until the connection is closed. The number of the
+active ones is reported in the metrics, and when the backend accepts
+the upgrade, the duration of the connection and the bytes sent by
+either side are measured, and the connection is logged for auditing. The websocketLimits
+filter can cap the concurrent upgraded connections of a route, and the
+upgrade requests above the cap are rejected with 503 Service
+Unavailable, passing ErrUpgradedConnectionsLimit to the custom error
+handler.
+
+
+Circuit Breakers
+
+To prevent that a failing backend ties up the connections and the
+goroutines of the proxy, the proxy consults a circuit breaker before
+the backend roundtrip. The default breaker is set with the
+CircuitBreaker parameter, and the routes can set their own with the
+circuitBreaker filter. The consecutive breaker opens after a number of
+consecutive failed requests, while the rate breaker opens when a number
+of the last requests, in a sliding window of requests, failed. The
+failed requests are the ones where the roundtrip failed, or the backend
+responded with a 5xx status. The breakers count the failures per
+backend host, or, optionally, per route.
+
+While a breaker is open, the requests are rejected with 503 Service
+Unavailable, and the custom error handler receives
+ErrCircuitBreakerOpen. After the timeout of the breaker, it becomes
+half-open, and lets through a limited number of probe requests. When
+all of them succeed, the breaker closes, otherwise it opens again.
+
+
+Load Balancing
+
+The routes can forward the requests to a group of backends with the
+loadBalancer filter, instead of the backend of the route. The proxy
+selects the member receiving a request with round-robin, or with the
+power of two choices, taking the one of two random members with less
+backend requests in progress. The members with a DNS name are resolved
+periodically, and each of their IP addresses is balanced separately,
+while the TLS connections are verified with the name. A member is
+ejected for a timeout after consecutive failed requests, and skipped
+while the active health checks mark it down. When all the members are
+unavailable, the requests are forwarded to all of them.
+The ejections are counted per route in the metrics. The upgrade
+requests are not balanced.
+
+
+Health Checks
+
+With the HealthChecks parameter, the proxy checks the health of the
+backends actively, by probing them periodically on a health check path.
+A backend is marked down after a number of consecutive failed probes,
+and healthy again after a number of consecutive successful ones. The
+proxy skips the backends marked down when selecting one of the backends
+of a split route or the member of a load balancer, unless all of them
+are down. The routes with a single backend are probed only to report
+their health. The load balancers can set their own health check path,
+and these are checked even without the HealthChecks parameter. See the
+healthcheck package for the details.
+
+
+Retries
+
+The GET and HEAD requests without a body can be retried, when the
+backend roundtrip fails with a connection error, or, optionally, when
+the backend responds with one of a set of status codes. The default
+retries are set with the Retry parameter, and the routes can set their
+own with the retry filter. With split backends and load balancers, the
+retries prefer a different backend than the one that failed. The backend responses that
+are retried are discarded, and the last response is returned to the
+client.
+
+To prevent that the retries multiply the load on overloaded backends,
+they are limited by a retry budget: every retryable request adds a
+share to the budget, set by the RetryBudgetRatio parameter, and every
+retry takes one. The retries are counted per route in the metrics,
+together with the ones rejected by the exhausted budget.
+
+
+Backend Timeouts
+
+The backend requests can be limited by three timeouts: the timeout of
+establishing the connection, the timeout of waiting for the response
+headers, and the total timeout of the request, including the streaming
+of the response body. The defaults are set with the BackendTimeouts
+parameter, and the routes can override them with the dialTimeout,
+responseHeaderTimeout and backendTimeout filters, e.g. for slow
+reporting endpoints. When a timeout expires before the response
+headers were received, the proxy responds with 504 Gateway Timeout,
+and the custom error handler receives ErrBackendTimeout. When the
+total timeout expires while streaming the body, the response is
+aborted. The connections with different dial or response header
+timeouts are pooled separately.
+
+The pooling of the backend connections is set with the ConnectionPool
+parameter: the maximum number of the idle connections per backend host,
+the timeout of the idle connections, the period of the TCP keep-alive
+probes, or disabling the reuse of the connections altogether.
+
+
+HTTP/2 and gRPC Backends
+
+The backends with the grpc scheme, e.g. "grpc://service:8443", are
+requested over HTTP/2 with TLS, and the ones with the h2c scheme over
+cleartext HTTP/2, without an upgrade. The routes with http or https
+backends can select the protocol with the backendProtocol filter, e.g.
+backendProtocol("http2"), since the protocol of the backend can't be
+detected reliably. The request and response bodies are streamed, and
+the response trailers, e.g. the status of a gRPC call, are forwarded
+to the client. The connection specific headers are removed from the
+HTTP/2 backend requests, and the TE header is kept only with the
+trailers value. The HTTP/2 backend requests are not limited by the
+response header timeout, but the dial and the total timeouts apply.
+The upgrade requests are always sent over HTTP/1.1.
+
+
+Phase Timeouts
+
+With the PhaseTimeouts parameter, the processing of a request can be
+split into time budgets: one for the request filters, one for the
+backend request, including the retries, and one for the response
+filters. The filters receive the deadline of the current phase from
+the Context method of the filter context, and the filters that wait,
+like srvBackend waiting for the first DNS resolution, give up when it
+expires. When the budget of the request or the response filters
+expires, the rest of the filters of the phase are skipped, and the
+proxy responds with 503 Service Unavailable, passing ErrFilterTimeout
+to the custom error handler, so one slow filter cannot consume the
+whole time of a route. The remaining budget of the backend phase
+limits the total timeout of the backend requests.
+
+
+Sandboxed Routes
+
+The routes of untrusted tenants can be sandboxed by a filter
+implementing the filters.SandboxFilter interface, e.g. the one inserted
+by the quota package. The filters following it in the chain get a
+budget per request: the total time they may spend processing the
+request and the response, and the number of bytes they may read from
+the bodies. The time is measured as the wall clock time of the filter
+calls, since the Go runtime doesn't provide CPU time or allocations per
+goroutine. When a request exceeds the budget, the rest of the filters
+are skipped, the proxy responds with 503 Service Unavailable, or with
+502 Bad Gateway in the response phase, passing ErrSandboxViolation to
+the custom error handler, and reports the violation to the sandbox
+filter.
+
+
+Response Bandwidth
+
+To prevent that a few clients downloading large bodies over slow links
+monopolize the bandwidth of the proxy, the response bodies can be
+streamed within a bandwidth limit, set globally with the
+MaxResponseBandwidth parameter, or per route with the
+responseBandwidth filter. The limits are token buckets shared by the
+concurrent responses. Every stream writes at most its fair share of the
+bucket at a time, so the streams ready to write take turns, while the
+ones blocked by slow clients don't hold back the others. The body is
+read from the backend only as fast as it is written to the client, so
+the backpressure of the client reaches the backend connection, too.
+The time spent waiting for the bandwidth is measured per route.
+
+
+Error Envelope
+
+With the OptionsErrorEnvelope flag, the errors generated by the proxy
+itself, e.g. the unmatched requests, the rejected requests and the
+failed backend requests, are answered with a JSON body, so that the API
+clients can handle them programmatically:
+
+    {"error": {"status": 404, "code": "route_not_found", "message": "Not Found", "flowId": "..."}}
+
+The code identifies the error, the flow id is taken from the X-Flow-Id
+request header, and the route id is set when the error happened after
+the route lookup. When a custom error handler is set, it takes
+precedence.
+
+
+Shadow Routing
+
+To reduce the risk of large refactorings of the routes, a candidate
+routing instance can be passed to the proxy in the ShadowRouting
+parameter. Every request matched with the routing table is matched with
+the candidate routing, too, and the proxy reports in the metrics
+whether the matched route or backend would differ. The candidate
+routing has no effect on how the requests are handled.
+
+
+Expect: 100-continue
+
+The 100 Continue response to the requests with the "Expect:
+100-continue" header is sent to the client by the proxy, when it starts
+reading the request body. By default, the Expect header is passed
+through to the backends. Since some backends don't handle it correctly,
+and stall large uploads, the OptionsLocalContinue flag can be used to
+remove the header from all the forwarded requests, or the stripExpect
+filter for individual routes.
+
+
 Example
 
 The below example demonstrates creating a routing proxy as a standard
@@ -0,0 +1,131 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type idleCloser interface {
+	CloseIdleConnections()
+}
+
+// tracks the in-flight requests per backend, and drains the backends
+// removed from the routing table
+type drainer struct {
+	transport   idleCloser
+	cancelAfter time.Duration
+	mx          sync.Mutex
+	inFlight    map[string]map[*http.Request]*cancelSignal
+}
+
+func newDrainer(tr idleCloser, cancelAfter time.Duration) *drainer {
+	return &drainer{
+		transport:   tr,
+		cancelAfter: cancelAfter,
+		inFlight:    make(map[string]map[*http.Request]*cancelSignal)}
+}
+
+func backendKey(r *http.Request) string {
+	return r.URL.Scheme + "://" + r.URL.Host
+}
+
+// registers an outgoing request, with the signal canceling it
+func (d *drainer) track(r *http.Request, cancel *cancelSignal) {
+	if d.cancelAfter <= 0 {
+		return
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	key := backendKey(r)
+	if d.inFlight[key] == nil {
+		d.inFlight[key] = make(map[*http.Request]*cancelSignal)
+	}
+
+	d.inFlight[key][r] = cancel
+}
+
+// unregisters an outgoing request, after its response was streamed
+func (d *drainer) release(r *http.Request) {
+	if d.cancelAfter <= 0 {
+		return
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	key := backendKey(r)
+	delete(d.inFlight[key], r)
+	if len(d.inFlight[key]) == 0 {
+		delete(d.inFlight, key)
+	}
+}
+
+// cancels those requests after the grace period, that were in-flight
+// at the time of the removal of their backend and didn't finish since
+func (d *drainer) cancelInFlight(backends []string) {
+	cancel := make(map[*cancelSignal]bool)
+
+	d.mx.Lock()
+	for _, b := range backends {
+		for _, c := range d.inFlight[b] {
+			cancel[c] = true
+		}
+	}
+	d.mx.Unlock()
+
+	if len(cancel) == 0 {
+		return
+	}
+
+	time.AfterFunc(d.cancelAfter, func() {
+		d.mx.Lock()
+		defer d.mx.Unlock()
+
+		var canceled int
+		for _, b := range backends {
+			for r, c := range d.inFlight[b] {
+				if cancel[c] {
+					c.cancel()
+					delete(d.inFlight[b], r)
+					canceled++
+				}
+			}
+
+			if len(d.inFlight[b]) == 0 {
+				delete(d.inFlight, b)
+			}
+		}
+
+		if canceled > 0 {
+			log.Infof("canceled %d in-flight requests to removed backends", canceled)
+		}
+	})
+}
+
+// Closes the idle connections, and schedules the cancelation of the
+// in-flight requests to the removed backends. The transport doesn't
+// support closing the idle connections of a single host, so the idle
+// connections to the other backends are closed, too, and they are
+// reopened on demand.
+func (d *drainer) drain(backends []string) {
+	d.transport.CloseIdleConnections()
+	d.cancelInFlight(backends)
+}
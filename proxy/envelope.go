@@ -0,0 +1,127 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+)
+
+// The error codes of the JSON error envelope, identifying the errors
+// generated by the proxy.
+const (
+	ErrorCodeRouteNotFound            = "route_not_found"
+	ErrorCodeMethodNotAllowed         = "method_not_allowed"
+	ErrorCodeInFlightRequestsLimit    = "inflight_requests_limit"
+	ErrorCodeBackendConnectionsLimit  = "backend_connections_limit"
+	ErrorCodeBodyBufferingLimit       = "body_buffering_limit"
+	ErrorCodeLoopbackLimit            = "loopback_limit"
+	ErrorCodeUpgradedConnectionsLimit = "upgraded_connections_limit"
+	ErrorCodeRequestBodySizeLimit     = "request_body_size_limit"
+	ErrorCodeResponseBodySizeLimit    = "response_body_size_limit"
+	ErrorCodeDynamicBackendNotSet     = "dynamic_backend_not_set"
+	ErrorCodeCircuitBreakerOpen       = "circuit_breaker_open"
+	ErrorCodeBackendTimeout           = "backend_timeout"
+	ErrorCodeSandboxViolation         = "sandbox_violation"
+	ErrorCodeBackendError             = "backend_error"
+)
+
+// ErrorEnvelope is the JSON body of the responses generated by the proxy
+// for its own errors, when OptionsErrorEnvelope is set, e.g.:
+//
+//     {"error": {"status": 404, "code": "route_not_found", "message": "Not Found", "flowId": "..."}}
+type ErrorEnvelope struct {
+	Error ErrorDetails `json:"error"`
+}
+
+// The details of an error generated by the proxy.
+type ErrorDetails struct {
+
+	// The HTTP status code of the response.
+	Status int `json:"status"`
+
+	// One of the ErrorCode values.
+	Code string `json:"code"`
+
+	// The status text of the response.
+	Message string `json:"message"`
+
+	// The flow id of the request, when set.
+	FlowId string `json:"flowId,omitempty"`
+
+	// The id of the matched route, when the error happened after the
+	// route lookup.
+	RouteId string `json:"routeId,omitempty"`
+}
+
+func errorCode(err error) string {
+	switch err {
+	case ErrRouteNotFound:
+		return ErrorCodeRouteNotFound
+	case ErrMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case ErrInFlightRequestsLimit:
+		return ErrorCodeInFlightRequestsLimit
+	case ErrBackendConnectionsLimit:
+		return ErrorCodeBackendConnectionsLimit
+	case ErrBodyBufferingLimit:
+		return ErrorCodeBodyBufferingLimit
+	case ErrLoopbackLimit:
+		return ErrorCodeLoopbackLimit
+	case ErrUpgradedConnectionsLimit:
+		return ErrorCodeUpgradedConnectionsLimit
+	case ErrRequestBodySizeLimit:
+		return ErrorCodeRequestBodySizeLimit
+	case ErrResponseBodySizeLimit:
+		return ErrorCodeResponseBodySizeLimit
+	case ErrDynamicBackendNotSet:
+		return ErrorCodeDynamicBackendNotSet
+	case ErrCircuitBreakerOpen:
+		return ErrorCodeCircuitBreakerOpen
+	case ErrBackendTimeout:
+		return ErrorCodeBackendTimeout
+	case ErrSandboxViolation:
+		return ErrorCodeSandboxViolation
+	default:
+		return ErrorCodeBackendError
+	}
+}
+
+// responds with the JSON error envelope
+func serveErrorEnvelope(w http.ResponseWriter, r *http.Request, err error, rt *routing.Route, code int) {
+	e := ErrorEnvelope{ErrorDetails{
+		Status:  code,
+		Code:    errorCode(err),
+		Message: http.StatusText(code),
+		FlowId:  r.Header.Get(flowid.HeaderName)}}
+	if rt != nil {
+		e.Error.RouteId = rt.Id
+	}
+
+	b, jerr := json.Marshal(e)
+	if jerr != nil {
+		log.Error(jerr)
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
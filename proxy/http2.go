@@ -0,0 +1,143 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// identifies the HTTP/2 transports with custom settings
+type http2Key struct {
+	socketOptions    filters.SocketOptions
+	hasSocketOptions bool
+	serverName       string
+	dialTimeout      time.Duration
+	cleartext        bool
+}
+
+// the connection specific headers, that are not allowed in HTTP/2
+var connectionHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// returns the scheme of the backend request, http or https, and whether
+// it is sent over HTTP/2. The grpc backends use HTTP/2 with TLS, the h2c
+// backends cleartext HTTP/2, and the filters can select the protocol
+// for any backend.
+func backendProtocol(c *filterContext, scheme string) (string, bool) {
+	var h2 bool
+	switch scheme {
+	case "grpc":
+		scheme, h2 = "https", true
+	case "h2c":
+		scheme, h2 = "http", true
+	}
+
+	switch c.stateBag[filters.BackendProtocolKey] {
+	case "http1":
+		h2 = false
+	case "http2":
+		h2 = true
+	}
+
+	return scheme, h2
+}
+
+// removes the headers, that the HTTP/2 backend requests can't have. The
+// TE header is kept only with the value trailers, which gRPC expects.
+func stripConnectionHeaders(h http.Header) {
+	for _, name := range connectionHeaders {
+		h.Del(name)
+	}
+
+	if te := h.Get("Te"); te != "" && te != "trailers" {
+		h.Del("Te")
+	}
+}
+
+// returns a dial function for the HTTP/2 transport, that establishes the
+// TLS connections over the connections of the dial function, and fails
+// when the backend doesn't negotiate HTTP/2
+func dialHTTP2TLS(dial func(string, string) (net.Conn, error)) func(string, string, *tls.Config) (net.Conn, error) {
+	return func(network, address string, cfg *tls.Config) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tc := tls.Client(conn, cfg)
+		if err := tc.Handshake(); err != nil {
+			tc.Close()
+			return nil, err
+		}
+
+		if p := tc.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+			tc.Close()
+			return nil, fmt.Errorf("backend doesn't support HTTP/2: %s, negotiated protocol: %q", address, p)
+		}
+
+		return tc, nil
+	}
+}
+
+// returns the HTTP/2 transport for a set of socket options, a TLS server
+// name and a dial timeout, either with TLS or cleartext. The HTTP/2
+// transports don't support the response header timeout.
+func (t *transports) getHTTP2(o *filters.SocketOptions, serverName string, timeouts filters.BackendTimeouts, cleartext bool) *http2.Transport {
+	key := http2Key{
+		serverName:  serverName,
+		dialTimeout: timeouts.Dial,
+		cleartext:   cleartext}
+	if o != nil {
+		key.socketOptions, key.hasSocketOptions = *o, true
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if tr, ok := t.http2ByOptions[key]; ok {
+		return tr
+	}
+
+	dial := t.dial(o, timeouts.Dial)
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	tr := &http2.Transport{AllowHTTP: cleartext}
+	if cleartext {
+		tr.DialTLS = func(network, address string, _ *tls.Config) (net.Conn, error) {
+			return dial(network, address)
+		}
+	} else {
+		tr.TLSClientConfig = &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: t.insecure}
+		tr.DialTLS = dialHTTP2TLS(dial)
+	}
+
+	t.http2ByOptions[key] = tr
+	return tr
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"testing"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	for _, ti := range []struct {
+		scheme   string
+		protocol string
+		expected string
+		h2       bool
+	}{
+		{"http", "", "http", false},
+		{"https", "", "https", false},
+		{"grpc", "", "https", true},
+		{"h2c", "", "http", true},
+		{"http", "http2", "http", true},
+		{"https", "http2", "https", true},
+		{"grpc", "http1", "https", false},
+	} {
+		c := &filterContext{stateBag: make(map[string]interface{})}
+		if ti.protocol != "" {
+			c.stateBag[filters.BackendProtocolKey] = ti.protocol
+		}
+
+		scheme, h2 := backendProtocol(c, ti.scheme)
+		if scheme != ti.expected || h2 != ti.h2 {
+			t.Error("unexpected protocol", ti.scheme, ti.protocol, scheme, h2)
+		}
+	}
+}
+
+func TestStripConnectionHeaders(t *testing.T) {
+	h := http.Header{
+		"Connection":   []string{"keep-alive"},
+		"Keep-Alive":   []string{"timeout=5"},
+		"Upgrade":      []string{"websocket"},
+		"Te":           []string{"trailers"},
+		"Content-Type": []string{"application/grpc"}}
+	stripConnectionHeaders(h)
+	if len(h) != 2 || h.Get("Te") != "trailers" || h.Get("Content-Type") != "application/grpc" {
+		t.Error("failed to strip the connection headers", h)
+	}
+
+	h = http.Header{"Te": []string{"gzip"}}
+	stripConnectionHeaders(h)
+	if len(h) != 0 {
+		t.Error("failed to strip the TE header", h)
+	}
+}
+
+func TestHTTP2Transports(t *testing.T) {
+	tr := newTransports(true, nil, noTimeouts, ConnectionPool{})
+	t1 := tr.getHTTP2(nil, "", noTimeouts, true)
+	if t1 != tr.getHTTP2(nil, "", noTimeouts, true) || !t1.AllowHTTP {
+		t.Error("failed to reuse the cleartext transport")
+	}
+
+	t2 := tr.getHTTP2(nil, "www.example.org", noTimeouts, false)
+	if t2 == t1 || t2.AllowHTTP {
+		t.Error("failed to separate the TLS transport")
+	}
+
+	if t2.TLSClientConfig == nil ||
+		t2.TLSClientConfig.ServerName != "www.example.org" ||
+		!t2.TLSClientConfig.InsecureSkipVerify {
+		t.Error("failed to set the TLS config")
+	}
+
+	tr.CloseIdleConnections()
+}
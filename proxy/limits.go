@@ -0,0 +1,131 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"github.com/zalando/skipper/metrics"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	inFlightRequestsResource   = "inflightrequests"
+	backendConnectionsResource = "backendconnections"
+)
+
+var (
+	// Error passed to the error handler, when a request is rejected,
+	// because the number of the in-flight requests reached the cap.
+	ErrInFlightRequestsLimit = errors.New("in-flight requests limit reached")
+
+	// Error returned by the backend roundtrip, when a new connection
+	// would exceed the cap of the open backend connections.
+	ErrBackendConnectionsLimit = errors.New("backend connections limit reached")
+)
+
+// counts the used units of a capped resource, and reports the usage in
+// the metrics
+type limiter struct {
+	resource string
+	max      int64
+	used     int64
+}
+
+// returns nil, when the cap is not set
+func newLimiter(resource string, max int64) *limiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &limiter{resource: resource, max: max}
+}
+
+// takes a unit of the resource, or returns false, when the cap was
+// reached
+func (l *limiter) tryAcquire() bool {
+	used := atomic.AddInt64(&l.used, 1)
+	if used > l.max {
+		atomic.AddInt64(&l.used, -1)
+		return false
+	}
+
+	metrics.UpdateSaturation(l.resource, used)
+	return true
+}
+
+// takes a unit of the resource, or counts the rejection and returns
+// false, when the cap was reached. A nil limiter always succeeds.
+func (l *limiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+
+	if !l.tryAcquire() {
+		metrics.IncRejected(l.resource)
+		return false
+	}
+
+	return true
+}
+
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+
+	metrics.UpdateSaturation(l.resource, atomic.AddInt64(&l.used, -1))
+}
+
+// a backend connection that releases its unit of the limiter, when
+// closed
+type limitedConn struct {
+	net.Conn
+	limiter *limiter
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.limiter.release)
+	return c.Conn.Close()
+}
+
+// wraps a dial function, so that it fails fast, when the cap of the
+// open backend connections was reached. Since the idle connections
+// count, too, they are closed before failing, and the cap is checked
+// once more.
+func (l *limiter) dial(dial func(string, string) (net.Conn, error), closeIdle func()) func(string, string) (net.Conn, error) {
+	if l == nil {
+		return dial
+	}
+
+	return func(network, address string) (net.Conn, error) {
+		if !l.tryAcquire() {
+			closeIdle()
+			if !l.acquire() {
+				return nil, ErrBackendConnectionsLimit
+			}
+		}
+
+		conn, err := dial(network, address)
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+
+		return &limitedConn{Conn: conn, limiter: l}, nil
+	}
+}
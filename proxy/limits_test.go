@@ -0,0 +1,161 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	var l *limiter
+	if !l.acquire() {
+		t.Error("failed to ignore the disabled limiter")
+	}
+
+	l.release()
+
+	if newLimiter("test", 0) != nil {
+		t.Error("failed to disable the limiter")
+	}
+
+	l = newLimiter("test", 2)
+	if !l.acquire() || !l.acquire() {
+		t.Error("failed to acquire")
+	}
+
+	if l.acquire() {
+		t.Error("failed to limit")
+	}
+
+	l.release()
+	if !l.acquire() {
+		t.Error("failed to release")
+	}
+}
+
+func TestLimitedDialClosesIdleConnections(t *testing.T) {
+	l := newLimiter("test", 1)
+	var idle []net.Conn
+	dial := l.dial(func(string, string) (net.Conn, error) {
+		c, _ := net.Pipe()
+		return c, nil
+	}, func() {
+		for _, c := range idle {
+			c.Close()
+		}
+
+		idle = nil
+	})
+
+	c, err := dial("tcp", "www.example.org:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dial("tcp", "www.example.org:80"); err != ErrBackendConnectionsLimit {
+		t.Error("failed to limit the connections", err)
+	}
+
+	idle = append(idle, c)
+	c, err = dial("tcp", "www.example.org:80")
+	if err != nil {
+		t.Error("failed to close the idle connections", err)
+	}
+
+	c.Close()
+	c.Close()
+	if l.used != 0 {
+		t.Error("failed to release the connection once", l.used)
+	}
+}
+
+// starts a backend that blocks the requests until the returned function
+// is called
+func blockingBackend() (*httptest.Server, chan struct{}, func()) {
+	received := make(chan struct{}, 16)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+
+	return backend, received, func() { close(release) }
+}
+
+func testLimit(t *testing.T, params func(*Params), expectedErr error) {
+	backend, received, release := blockingBackend()
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`limited: Path("/") -> "%s"`, backend.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handledErr error
+	p := Params{
+		Routing: routing.New(routing.Options{
+			PollTimeout: sourcePollTimeout,
+			DataClients: []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error, _ *routing.Route) {
+			handledErr = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}}
+	params(&p)
+	h := WithParams(p)
+
+	delay()
+
+	done := make(chan int)
+	go func() {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		done <- w.Code
+	}()
+
+	<-received
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || handledErr != expectedErr {
+		t.Error("failed to reject the request", w.Code, handledErr)
+	}
+
+	release()
+	if code := <-done; code != http.StatusOK {
+		t.Error("failed to proxy the first request", code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Error("failed to proxy the request after the release", w.Code)
+	}
+}
+
+func TestInFlightRequestsLimit(t *testing.T) {
+	testLimit(t, func(p *Params) { p.MaxInFlightRequests = 1 }, ErrInFlightRequestsLimit)
+}
+
+func TestBackendConnectionsLimit(t *testing.T) {
+	testLimit(t, func(p *Params) { p.MaxBackendConnections = 1 }, ErrBackendConnectionsLimit)
+}
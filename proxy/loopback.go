@@ -0,0 +1,220 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the maximum number of times that a request can re-enter the routing
+// via loopback routes
+const maxLoopbacks = 9
+
+var (
+	// Passed to the error handler when a request re-entered the
+	// routing via loopback routes more times than allowed, typically
+	// due to a loop between the routes.
+	ErrLoopbackLimit = errors.New("loopback limit exceeded")
+
+	// Passed to the error handler when the filters of a route with a
+	// dynamic backend didn't set the backend address.
+	ErrDynamicBackendNotSet = errors.New("dynamic backend not set")
+
+	// Passed to the error handler when an upgrade request, e.g. a
+	// websocket request, was matched by a loopback route. The upgraded
+	// connections cannot be taken over after a loopback.
+	ErrLoopbackUpgrade = errors.New("upgrade not supported by loopback routes")
+)
+
+// the request headers and state bag entries passed to the next hop of
+// a loopback route
+type loopbackAllowlist struct {
+	headers  map[string]bool
+	stateBag []string
+}
+
+// streams the response of a request handled after a loopback. The
+// header is passed on when written, the body through a pipe, and the
+// trailers when the handling finished.
+type loopbackWriter struct {
+	header      http.Header
+	status      int
+	sentHeader  http.Header
+	trailerKeys []string
+	trailer     http.Header
+	headerSent  chan struct{}
+	pipe        *io.PipeWriter
+}
+
+// the body of the response received after a loopback. Closing it
+// waits for the handling of the loopback to finish.
+type loopbackBody struct {
+	reader   *io.PipeReader
+	writer   *loopbackWriter
+	response *http.Response
+	done     chan struct{}
+}
+
+func (w *loopbackWriter) Header() http.Header { return w.header }
+
+func (w *loopbackWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+
+	w.status = status
+	w.sentHeader = cloneHeader(w.header)
+	w.trailerKeys = w.header["Trailer"]
+	close(w.headerSent)
+}
+
+func (w *loopbackWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pipe.Write(b)
+}
+
+// the pipe is not buffered, the written data is passed on immediately
+func (w *loopbackWriter) Flush() {}
+
+// stores the trailers set after the body was written, and closes the
+// pipe
+func (w *loopbackWriter) finish() {
+	w.WriteHeader(http.StatusOK)
+	for _, k := range w.trailerKeys {
+		if v, ok := w.header[http.CanonicalHeaderKey(k)]; ok {
+			if w.trailer == nil {
+				w.trailer = make(http.Header)
+			}
+
+			w.trailer[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	w.pipe.Close()
+}
+
+// when the body was read to the end, sets the trailers of the response.
+// They are read after the pipe was closed by the writer, and set on the
+// reading side, so there is no concurrent access to the response.
+func (b *loopbackBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err == io.EOF {
+		copyHeader(b.response.Trailer, b.writer.trailer)
+	}
+
+	return n, err
+}
+
+func (b *loopbackBody) Close() error {
+	err := b.reader.Close()
+	<-b.done
+	return err
+}
+
+// when the headers are nil, all the headers are allowed
+func newLoopbackAllowlist(headers, stateBag []string) *loopbackAllowlist {
+	a := &loopbackAllowlist{stateBag: stateBag}
+	if headers != nil {
+		a.headers = make(map[string]bool)
+		for _, h := range headers {
+			a.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+
+	return a
+}
+
+// returns a copy of the request for the next hop, containing only the
+// allowed headers
+func (a *loopbackAllowlist) request(r *http.Request) *http.Request {
+	rr := *r
+	rr.URL = cloneUrl(r.URL)
+	rr.Header = make(http.Header)
+	for k, v := range r.Header {
+		if a.headers == nil || a.headers[http.CanonicalHeaderKey(k)] {
+			rr.Header[k] = v
+		}
+	}
+
+	return &rr
+}
+
+// returns the allowed entries of the state bag
+func (a *loopbackAllowlist) state(bag map[string]interface{}) map[string]interface{} {
+	s := make(map[string]interface{})
+	for _, k := range a.stateBag {
+		if v, ok := bag[k]; ok {
+			s[k] = v
+		}
+	}
+
+	return s
+}
+
+// matches the request, as modified by the filters of a loopback route,
+// against the routes again, and returns the response as soon as its
+// header was written, while the body is streamed. Only the allowed
+// headers and state bag entries are passed to the next hop.
+func (p *proxy) loopback(r *http.Request, bag map[string]interface{}, wd *watchdog, received time.Time, loopbacks int) *http.Response {
+	next := p.loopbackAllowlist.request(r)
+	state := p.loopbackAllowlist.state(bag)
+	pr, pw := io.Pipe()
+	lw := &loopbackWriter{
+		header:     make(http.Header),
+		headerSent: make(chan struct{}),
+		pipe:       pw}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer lw.finish()
+		defer func() {
+			if err := recover(); err != nil {
+				log.Error("loopback", err)
+				lw.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+
+		p.serve(lw, next, wd, received, loopbacks, state)
+	}()
+
+	<-lw.headerSent
+
+	rs := &http.Response{
+		StatusCode:    lw.status,
+		Header:        lw.sentHeader,
+		ContentLength: -1,
+		Request:       r}
+	if l, err := strconv.ParseInt(rs.Header.Get("Content-Length"), 10, 64); err == nil {
+		rs.ContentLength = l
+	}
+
+	if len(lw.trailerKeys) > 0 {
+		rs.Trailer = make(http.Header)
+		for _, k := range lw.trailerKeys {
+			rs.Trailer[http.CanonicalHeaderKey(k)] = nil
+		}
+
+		rs.Header.Del("Trailer")
+	}
+
+	rs.Body = &loopbackBody{reader: pr, writer: lw, response: rs, done: done}
+	return rs
+}
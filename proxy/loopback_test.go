@@ -0,0 +1,288 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// sets a state bag entry in the request, and a response header from a
+// state bag entry in the response, when it exists
+type (
+	stateSpec   struct{}
+	stateFilter struct{ set, key, value string }
+)
+
+func (s *stateSpec) Name() string { return "state" }
+
+func (s *stateSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &stateFilter{args[0].(string), args[1].(string), args[2].(string)}, nil
+}
+
+func (f *stateFilter) Request(ctx filters.FilterContext) {
+	if f.set == "set" {
+		ctx.StateBag()[f.key] = f.value
+	}
+}
+
+func (f *stateFilter) Response(ctx filters.FilterContext) {
+	if f.set != "set" {
+		if v, ok := ctx.StateBag()[f.key].(string); ok {
+			ctx.Response().Header.Set(f.value, v)
+		}
+	}
+}
+
+func TestLoopbackAndDynamicBackends(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Path", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Hello, world!"))
+	}))
+	defer backend.Close()
+
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		legacy: Path("/old") -> modPath(".*", "/new") -> responseHeader("X-Legacy", "true") -> <loopback>;
+		current: Path("/new") -> "%s";
+		loop: Path("/loop") -> <loopback>;
+		dynamic: Path("/dynamic") -> backendScheme("http") -> backendHost("%s") -> <dynamic>;
+		notSet: Path("/not-set") -> <dynamic>`, backend.URL, u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handled []error
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error, _ *routing.Route) {
+			handled = append(handled, err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}})
+
+	delay()
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "https://www.example.org"+path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/old")
+	if w.Code != http.StatusAccepted || w.Body.String() != "Hello, world!" ||
+		w.Header().Get("X-Backend-Path") != "/new" || w.Header().Get("X-Legacy") != "true" {
+		t.Error("failed to handle the loopback", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = serve("/dynamic")
+	if w.Code != http.StatusAccepted || w.Header().Get("X-Backend-Path") != "/dynamic" {
+		t.Error("failed to forward to the dynamic backend", w.Code, w.Header())
+	}
+
+	w = serve("/loop")
+	if w.Code != http.StatusInternalServerError || len(handled) != 1 || handled[0] != ErrLoopbackLimit {
+		t.Error("failed to stop the loop", w.Code, handled)
+	}
+
+	handled = nil
+	w = serve("/not-set")
+	if w.Code != http.StatusInternalServerError || len(handled) != 1 || handled[0] != ErrDynamicBackendNotSet {
+		t.Error("failed to fail without dynamic backend", w.Code, handled)
+	}
+}
+
+func TestLoopbackStreaming(t *testing.T) {
+	next := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-next:
+		case <-time.After(3 * time.Second):
+		}
+
+		w.Write([]byte("second\n"))
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		loopback: Path("/loopback") -> modPath(".*", "/stream") -> <loopback>;
+		stream: Path("/stream") -> "%s"`, backend.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	ps := httptest.NewServer(p)
+	defer ps.Close()
+
+	rsp, err := http.Get(ps.URL + "/loopback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+
+	// the backend sends the rest of the body only after the first
+	// line was received by the client
+	br := bufio.NewReader(rsp.Body)
+	received := make(chan string)
+	go func() {
+		l, _ := br.ReadString('\n')
+		received <- l
+	}()
+
+	select {
+	case l := <-received:
+		if l != "first\n" {
+			t.Error("invalid body", l)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the response was not streamed")
+	}
+
+	close(next)
+	if l, err := br.ReadString('\n'); err != nil || l != "second\n" {
+		t.Error("invalid body", l, err)
+	}
+}
+
+func TestLoopbackRejectsUpgrade(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		loopback: Path("/loopback") -> modPath(".*", "/static") -> <loopback>;
+		static: Path("/static") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handled []error
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error, _ *routing.Route) {
+			handled = append(handled, err)
+			w.WriteHeader(http.StatusBadRequest)
+		}})
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/loopback", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || len(handled) != 1 || handled[0] != ErrLoopbackUpgrade {
+		t.Error("failed to reject the upgrade", w.Code, handled)
+	}
+}
+
+func TestLoopbackAllowlist(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range []string{"X-Public", "X-Internal", "X-Client-Internal"} {
+			if v := r.Header.Get(h); v != "" {
+				w.Header().Set("X-Echo-"+h[2:], v)
+			}
+		}
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		hop1: Path("/hop1")
+			-> requestHeader("X-Public", "foo")
+			-> requestHeader("X-Internal", "bar")
+			-> state("set", "allowed", "baz")
+			-> state("set", "internal", "qux")
+			-> modPath(".*", "/hop2")
+			-> <loopback>;
+		hop2: Path("/hop2")
+			-> state("get", "allowed", "X-Allowed-State")
+			-> state("get", "internal", "X-Internal-State")
+			-> "%s"`, backend.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(&stateSpec{})
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: fr,
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		LoopbackHeaders:  []string{"x-public"},
+		LoopbackStateBag: []string{"allowed"}})
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/hop1", nil)
+	r.Header.Set("X-Client-Internal", "spoofed")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatal("failed to handle the request", w.Code)
+	}
+
+	h := w.Header()
+	if h.Get("X-Echo-Public") != "foo" {
+		t.Error("failed to pass the allowed header")
+	}
+
+	if h.Get("X-Echo-Internal") != "" || h.Get("X-Internal") != "" {
+		t.Error("the internal header leaked")
+	}
+
+	if h.Get("X-Echo-Client-Internal") != "" {
+		t.Error("the header sent by the client passed")
+	}
+
+	if h.Get("X-Allowed-State") != "baz" {
+		t.Error("failed to pass the allowed state bag entry")
+	}
+
+	if h.Get("X-Internal-State") != "" {
+		t.Error("the internal state bag entry leaked")
+	}
+}
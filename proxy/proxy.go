@@ -16,14 +16,21 @@ package proxy
 
 import (
 	"bytes"
-	"crypto/tls"
+	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/healthcheck"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/routing"
+	"hash/crc32"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -42,6 +49,10 @@ const (
 
 type Options uint
 
+// The id of the route used for the requests that don't match any route,
+// when a default backend is set.
+const DefaultRouteId = "__default"
+
 const (
 	OptionsNone Options = 0
 
@@ -52,8 +63,172 @@ const (
 	// Flag indicating whether filters require the preserved original
 	// metadata of the request and the response.
 	OptionsPreserveOriginal
+
+	// Flag indicating whether a CRC-32 checksum of the response
+	// bodies should be calculated and reported in the access log.
+	OptionsResponseChecksum
+
+	// Flag indicating to close the idle backend connections, when
+	// a backend is removed from the routing table.
+	OptionsDrainRemovedBackends
+
+	// Flag indicating that the proxy answers the "Expect:
+	// 100-continue" requests itself, and doesn't forward the Expect
+	// header to the backends. Without it, the header is passed
+	// through.
+	OptionsLocalContinue
+
+	// Flag indicating that the proxy answers the OPTIONS requests
+	// itself, when they don't match any route, but would match routes
+	// with other methods. The response lists the methods of these
+	// routes in the Allow header, and the backends are not contacted.
+	OptionsAutoOptions
+
+	// Flag indicating that the report of the requests exceeding the
+	// SlowRequestThreshold includes a snapshot of the goroutine stacks.
+	OptionsSlowRequestProfile
+
+	// Flag indicating that the errors generated by the proxy, e.g.
+	// the unmatched requests or the failed backend requests, are
+	// answered with a JSON body, containing the status, an error code,
+	// the flow id and the route id. See ErrorEnvelope. The custom
+	// error handler takes precedence.
+	OptionsErrorEnvelope
 )
 
+// Proxy initialization parameters.
+type Params struct {
+
+	// The routing instance used to match the incoming requests.
+	Routing *routing.Routing
+
+	// Control flags.
+	Options Options
+
+	// Custom routes matched before the general lookup tree.
+	PriorityRoutes []PriorityRoute
+
+	// When OptionsDrainRemovedBackends is set, and this value is
+	// greater than zero, the requests that are in-flight to a
+	// backend at the time of its removal from the routing table,
+	// are canceled after this grace period.
+	CancelRemovedAfter time.Duration
+
+	// The address of a backend, in the form of scheme://host, where
+	// the requests are forwarded, when they don't match any route.
+	// When not set, these requests are answered with 404 Not Found.
+	DefaultBackend string
+
+	// When set, it is called to respond to the unmatched requests and
+	// the failed backend requests, instead of the default error
+	// responses.
+	ErrorHandler ErrorHandler
+
+	// When greater than zero, the requests that spend more time in the
+	// proxy than this value are logged with the matched route and the
+	// timings of the stages of the request, e.g. the filters and the
+	// backend roundtrip, while they are still in progress.
+	SlowRequestThreshold time.Duration
+
+	// When greater than zero, the filters reading more bytes of the
+	// request or response body than this value, while they are
+	// executed, are reported in the log and the metrics. Reading a
+	// body in a filter means buffering it in memory.
+	BodyBufferingThreshold int64
+
+	// When greater than zero, the body reads of the filters fail when
+	// they exceed this number of bytes, and the proxy responds with
+	// 413 to the request, or with 502 instead of the backend response.
+	BodyBufferingLimit int64
+
+	// When greater than zero, the requests received while this number
+	// of requests is already in progress are rejected with 503 Service
+	// Unavailable.
+	MaxInFlightRequests int
+
+	// When greater than zero, the number of the open connections to
+	// the backends, including the idle pooled ones, is capped at this
+	// value. The requests that would need a new connection above the
+	// cap are rejected with 503 Service Unavailable, without dialing.
+	MaxBackendConnections int
+
+	// When set, every request matched with the routing table is
+	// matched with this candidate routing, too, only for comparison.
+	// The differences of the matched routes and backends are reported
+	// in the metrics, while the requests are handled only by the live
+	// routing.
+	ShadowRouting *routing.Routing
+
+	// The circuit breaker applied to the routes that don't set their
+	// own with the circuitBreaker filter. The breakers are consulted
+	// before the backend roundtrip, and the requests to a backend with
+	// an open breaker are rejected with 503 Service Unavailable. The
+	// zero value disables the default circuit breaker.
+	CircuitBreaker filters.CircuitBreakerSettings
+
+	// The retries applied to the routes that don't set their own with
+	// the retry filter. Only the GET and HEAD requests without a body
+	// are retried, on connection errors, or on the configured response
+	// status codes. The zero value disables the default retries.
+	Retry filters.RetrySettings
+
+	// The share of the retries to the retried backend requests, that
+	// the retry budget allows, to prevent retry storms when the
+	// backends are overloaded. Defaults to 0.2.
+	RetryBudgetRatio float64
+
+	// The number of the retries that the retry budget allows at once,
+	// before the requests replenish it. Defaults to 10.
+	RetryBudgetBurst int
+
+	// The default timeouts of the backend requests, applied to the
+	// routes that don't override them with the timeout filters. The
+	// zero fields mean no timeout. The timed out requests are answered
+	// with 504 Gateway Timeout.
+	BackendTimeouts filters.BackendTimeouts
+
+	// Settings of the pooled backend connections: the idle
+	// connections per host, their timeout and the keep-alives.
+	ConnectionPool ConnectionPool
+
+	// The active health checks of the backends. The backends of the
+	// split routes and the members of the load balancers that are
+	// marked down are skipped. When nil, only the load balancers with
+	// a health check path are checked.
+	HealthChecks *healthcheck.Checker
+
+	// The time budgets of the request filters, the backend request and
+	// the response filters of the routes. When the filters of a phase
+	// exceed their budget, the rest of the filters of the phase are
+	// skipped, and the request is answered with 503 Service
+	// Unavailable. The zero fields mean no budget.
+	PhaseTimeouts filters.PhaseTimeouts
+
+	// When greater than zero, the response bodies sent to the clients
+	// share this bandwidth, in bytes per second. The streams ready to
+	// write take turns, so that a few large downloads can't take the
+	// whole bandwidth. The routes can set their own, additional limits
+	// with the responseBandwidth filter.
+	MaxResponseBandwidth int64
+
+	// When greater than zero, the upgraded connections, e.g. websocket
+	// connections, are closed, when no data was sent in either
+	// direction for this duration.
+	UpgradeIdleTimeout time.Duration
+
+	// When not nil, only the request headers listed here are passed
+	// to the route matched again after a loopback route. The other
+	// headers, including the ones set by the filters of the loopback
+	// route or sent by the client, are removed from the request of
+	// the next hop. When nil, all the headers are passed.
+	LoopbackHeaders []string
+
+	// The state bag entries set by the filters of a loopback route,
+	// that are passed to the filters of the route matched again. The
+	// other entries are not shared between the hops.
+	LoopbackStateBag []string
+}
+
 func (o Options) Insecure() bool {
 	return o&OptionsInsecure != 0
 }
@@ -62,6 +237,79 @@ func (o Options) PreserveOriginal() bool {
 	return o&OptionsPreserveOriginal != 0
 }
 
+func (o Options) ResponseChecksum() bool {
+	return o&OptionsResponseChecksum != 0
+}
+
+func (o Options) DrainRemovedBackends() bool {
+	return o&OptionsDrainRemovedBackends != 0
+}
+
+func (o Options) LocalContinue() bool {
+	return o&OptionsLocalContinue != 0
+}
+
+func (o Options) AutoOptions() bool {
+	return o&OptionsAutoOptions != 0
+}
+
+func (o Options) SlowRequestProfile() bool {
+	return o&OptionsSlowRequestProfile != 0
+}
+
+func (o Options) ErrorEnvelope() bool {
+	return o&OptionsErrorEnvelope != 0
+}
+
+var (
+	// Reason of a truncated response when the backend closed the
+	// connection before the complete body was received.
+	ErrBackendClosedEarly = errors.New("backend closed the connection early")
+
+	// Reason of a truncated response when the length of the body
+	// sent to the client doesn't match the Content-Length header.
+	ErrContentLengthMismatch = errors.New("response body length doesn't match Content-Length")
+
+	// Passed to the error handler when a request doesn't match any
+	// route, and no default backend is set.
+	ErrRouteNotFound = errors.New("route not found")
+
+	// Passed to the error handler when a request doesn't match any
+	// route, but it would match with a different method.
+	ErrMethodNotAllowed = errors.New("method not allowed")
+)
+
+// Custom error handler, called instead of the default error response of
+// the proxy, when a request doesn't match any route, or when the request
+// to the backend fails. For the unmatched requests, the error is
+// ErrRouteNotFound or ErrMethodNotAllowed, and the route is nil. In
+// case of ErrMethodNotAllowed, the Allow header is already set on the
+// response writer.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error, route *routing.Route)
+
+// Error reported when the response body sent to the client was not
+// complete.
+type TruncatedResponseError struct {
+
+	// The id of the route handling the request.
+	RouteId string
+
+	// Either ErrBackendClosedEarly or ErrContentLengthMismatch.
+	Reason error
+
+	// The value of the Content-Length header, -1 when not set.
+	ContentLength int64
+
+	// The number of bytes sent to the client.
+	Written int64
+}
+
+func (err *TruncatedResponseError) Error() string {
+	return fmt.Sprintf(proxyErrorFmt, fmt.Sprintf(
+		"truncated response in route %s: %v, content length: %d, written: %d",
+		err.RouteId, err.Reason, err.ContentLength, err.Written))
+}
+
 // Priority routes are custom route implementations that are matched against
 // each request before the routes in the general lookup tree.
 type PriorityRoute interface {
@@ -77,16 +325,52 @@ type flusherWriter interface {
 	io.Writer
 }
 
+// implemented by the response writer of the logging package, used to
+// pass the route details to the access log
+type routeInfoWriter interface {
+	SetRouteInfo(routeId, pathTemplate, checksum, category string)
+}
+
+// implemented by the response writer of the logging package, used to
+// pass the backend and the upstream latency to the access log
+type backendInfoWriter interface {
+	SetBackendInfo(backend string, d time.Duration)
+}
+
 // a byte buffer implementing the Closer interface
 type bodyBuffer struct {
 	*bytes.Buffer
 }
 
 type proxy struct {
-	routing          *routing.Routing
-	roundTripper     http.RoundTripper
-	priorityRoutes   []PriorityRoute
-	preserveOriginal bool
+	routing            *routing.Routing
+	transports         *transports
+	priorityRoutes     []PriorityRoute
+	preserveOriginal   bool
+	responseChecksum   bool
+	localContinue      bool
+	autoOptions        bool
+	drainer            *drainer
+	defaultRoute       *routing.Route
+	errorHandler       ErrorHandler
+	errorEnvelope      bool
+	slowThreshold      time.Duration
+	slowProfile        bool
+	bufferThreshold    int64
+	bufferLimit        int64
+	inFlight           *limiter
+	shadow             *shadow
+	upgrades           *upgrades
+	upgradeIdleTimeout time.Duration
+	loopbackAllowlist  *loopbackAllowlist
+	bandwidth          *bandwidth
+	breakers           *breakers
+	balancers          *balancers
+	healthChecks       *healthcheck.Checker
+	retry              filters.RetrySettings
+	retryBudget        *retryBudget
+	timeouts           filters.BackendTimeouts
+	phaseTimeouts      filters.PhaseTimeouts
 }
 
 type filterContext struct {
@@ -96,9 +380,14 @@ type filterContext struct {
 	served           bool
 	pathParams       map[string]string
 	stateBag         map[string]interface{}
+	filterState      map[filters.Filter]map[string]interface{}
 	originalRequest  *http.Request
 	originalResponse *http.Response
 	backendUrl       string
+	watchdog         *watchdog
+	bodyGuard        *bodyGuard
+	phase            *phaseContext
+	sandbox          *sandbox
 }
 
 func (sb bodyBuffer) Close() error {
@@ -118,37 +407,85 @@ func cloneHeader(h http.Header) http.Header {
 }
 
 // copies a stream with flushing on every successful read operation
-// (similar to io.Copy but with flushing)
-func copyStream(to flusherWriter, from io.Reader) error {
+// (similar to io.Copy but with flushing), and returns the number of
+// bytes written
+func copyStream(to flusherWriter, from io.Reader) (int64, error) {
 	b := make([]byte, proxyBufferSize)
+	var written int64
 
 	for {
 		l, rerr := from.Read(b)
 		if rerr != nil && rerr != io.EOF {
-			return rerr
+			return written, rerr
 		}
 
 		if l > 0 {
-			_, werr := to.Write(b[:l])
+			n, werr := to.Write(b[:l])
+			written += int64(n)
 			if werr != nil {
-				return werr
+				return written, werr
 			}
 
 			to.Flush()
 		}
 
 		if rerr == io.EOF {
-			return nil
+			return written, nil
 		}
 	}
 }
 
+// the content length that the client expects, -1 if unknown
+func expectedLength(r *http.Request, rs *http.Response) int64 {
+	if r.Method == "HEAD" ||
+		rs.StatusCode == http.StatusNoContent ||
+		rs.StatusCode == http.StatusNotModified {
+		return -1
+	}
+
+	l, err := strconv.ParseInt(rs.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return l
+}
+
+// classifies the error of streaming the response body, returning a
+// *TruncatedResponseError when the body was not complete
+func checkTruncated(routeId string, contentLength, written int64, err error) error {
+	var reason error
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		reason = ErrBackendClosedEarly
+	case err == nil && contentLength >= 0 && written != contentLength:
+		reason = ErrContentLengthMismatch
+	default:
+		return err
+	}
+
+	return &TruncatedResponseError{
+		RouteId:       routeId,
+		Reason:        reason,
+		ContentLength: contentLength,
+		Written:       written}
+}
+
+// the key used in the metrics for the reason of a truncated response
+func truncatedMetricsKey(reason error) string {
+	if reason == ErrBackendClosedEarly {
+		return "closedearly"
+	}
+
+	return "lengthmismatch"
+}
+
 // creates an outgoing http request to be forwarded to the route endpoint
 // based on the augmented incoming request
-func mapRequest(r *http.Request, rt *routing.Route) (*http.Request, error) {
+func mapRequest(r *http.Request, scheme, host string) (*http.Request, error) {
 	u := r.URL
-	u.Scheme = rt.Scheme
-	u.Host = rt.Host
+	u.Scheme = scheme
+	u.Host = host
 
 	rr, err := http.NewRequest(r.Method, u.String(), r.Body)
 	if err != nil {
@@ -165,12 +502,86 @@ func mapRequest(r *http.Request, rt *routing.Route) (*http.Request, error) {
 // route backends. It accepts an optional list of priority routes to
 // be used for matching before the general lookup tree.
 func New(r *routing.Routing, options Options, pr ...PriorityRoute) http.Handler {
-	tr := &http.Transport{}
-	if options.Insecure() {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return WithParams(Params{
+		Routing:        r,
+		Options:        options,
+		PriorityRoutes: pr})
+}
+
+// Creates a proxy with the provided parameters.
+func WithParams(p Params) http.Handler {
+	tr := newTransports(
+		p.Options.Insecure(),
+		newLimiter(backendConnectionsResource, int64(p.MaxBackendConnections)),
+		p.BackendTimeouts,
+		p.ConnectionPool)
+
+	hc := p.HealthChecks
+	if hc == nil {
+		hc = healthcheck.New(healthcheck.Options{Insecure: p.Options.Insecure()})
 	}
 
-	return &proxy{r, tr, pr, options.PreserveOriginal()}
+	var d *drainer
+	if p.Options.DrainRemovedBackends() {
+		d = newDrainer(tr, p.CancelRemovedAfter)
+	}
+
+	lb := newBalancers(hc)
+	if p.Routing != nil {
+		if d != nil {
+			p.Routing.NotifyRemovedBackends(d.drain)
+		}
+
+		p.Routing.NotifyRouteChanges(lb.routeChanges)
+	}
+
+	return &proxy{
+		routing:            p.Routing,
+		transports:         tr,
+		priorityRoutes:     p.PriorityRoutes,
+		preserveOriginal:   p.Options.PreserveOriginal(),
+		responseChecksum:   p.Options.ResponseChecksum(),
+		localContinue:      p.Options.LocalContinue(),
+		autoOptions:        p.Options.AutoOptions(),
+		drainer:            d,
+		defaultRoute:       newDefaultRoute(p.DefaultBackend),
+		errorHandler:       p.ErrorHandler,
+		errorEnvelope:      p.Options.ErrorEnvelope(),
+		slowThreshold:      p.SlowRequestThreshold,
+		slowProfile:        p.Options.SlowRequestProfile(),
+		bufferThreshold:    p.BodyBufferingThreshold,
+		bufferLimit:        p.BodyBufferingLimit,
+		inFlight:           newLimiter(inFlightRequestsResource, int64(p.MaxInFlightRequests)),
+		shadow:             newShadow(p.ShadowRouting),
+		upgrades:           newUpgrades(),
+		upgradeIdleTimeout: p.UpgradeIdleTimeout,
+		loopbackAllowlist:  newLoopbackAllowlist(p.LoopbackHeaders, p.LoopbackStateBag),
+		bandwidth:          newBandwidth(p.MaxResponseBandwidth),
+		breakers:           newBreakers(p.CircuitBreaker),
+		balancers:          lb,
+		healthChecks:       hc,
+		retry:              p.Retry,
+		retryBudget:        newRetryBudget(p.RetryBudgetRatio, p.RetryBudgetBurst),
+		timeouts:           p.BackendTimeouts,
+		phaseTimeouts:      p.PhaseTimeouts}
+}
+
+// creates the route used for the requests that don't match any route
+func newDefaultRoute(backend string) *routing.Route {
+	if backend == "" {
+		return nil
+	}
+
+	u, err := url.Parse(backend)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		log.Errorf("invalid default backend: %s", backend)
+		return nil
+	}
+
+	return &routing.Route{
+		Route:  eskip.Route{Id: DefaultRouteId, Backend: backend},
+		Scheme: u.Scheme,
+		Host:   u.Host}
 }
 
 // calls a function with recovering from panics and logging them
@@ -189,13 +600,16 @@ func newFilterContext(
 	r *http.Request,
 	params map[string]string,
 	preserveOriginal bool,
-	route *routing.Route) *filterContext {
+	route *routing.Route,
+	start time.Time) *filterContext {
 
 	c := &filterContext{
 		w:          w,
 		req:        r,
 		pathParams: params,
-		stateBag:   make(map[string]interface{}),
+		stateBag: map[string]interface{}{
+			filters.RequestStartKey: start,
+			filters.RouteIdKey:      route.Id},
 		backendUrl: route.Backend}
 	if preserveOriginal {
 		c.originalRequest = cloneRequestMetadata(r)
@@ -252,6 +666,28 @@ func (c *filterContext) PathParam(key string) string         { return c.pathPara
 func (c *filterContext) StateBag() map[string]interface{}    { return c.stateBag }
 func (c *filterContext) BackendUrl() string                  { return c.backendUrl }
 
+func (c *filterContext) FilterState(f filters.Filter) map[string]interface{} {
+	if c.filterState == nil {
+		c.filterState = make(map[filters.Filter]map[string]interface{})
+	}
+
+	s, ok := c.filterState[f]
+	if !ok {
+		s = make(map[string]interface{})
+		c.filterState[f] = s
+	}
+
+	return s
+}
+
+func (c *filterContext) Context() filters.Context {
+	if c.phase == nil {
+		return filters.Background
+	}
+
+	return c.phase
+}
+
 func (c *filterContext) OriginalRequest() *http.Request {
 	return c.originalRequest
 }
@@ -269,43 +705,157 @@ func shunt(r *http.Request) *http.Response {
 		Request:    r}
 }
 
-// applies all filters to a request
-func (p *proxy) applyFiltersToRequest(f []*routing.RouteFilter, ctx filters.FilterContext) {
+// applies all filters to a request, until one of them marks the request
+// served
+func (p *proxy) applyFiltersToRequest(f []*routing.RouteFilter, ctx *filterContext) {
 	var start time.Time
 	for _, fi := range f {
+		ctx.watchdog.enter("request filter " + fi.Name)
 		start = time.Now()
 		callSafe(func() { fi.Request(ctx) })
 		metrics.MeasureFilterRequest(fi.Name, start)
+		if !ctx.sandbox.spend(fi, time.Since(start)) {
+			return
+		}
+
+		if !ctx.bodyGuard.checkFilter(fi.Name) || ctx.Served() || ctx.phase.expired() {
+			return
+		}
+	}
+}
+
+// returns the backend address set by the filters in the state bag, or
+// when not set, the backend address of the route, or, in case of a split
+// backend, the address of the picked backend. The scheme and the host
+// overrides set by the filters are applied to either. The excluded host
+// is avoided when picking a split backend.
+func backendAddress(c *filterContext, rt *routing.Route, exclude string, health *healthcheck.Checker) (scheme, host string) {
+	scheme, host = rt.Scheme, rt.Host
+	if len(rt.WeightedBackends) > 0 {
+		scheme, host = splitBackendAddress(rt, exclude, health)
+	} else if host != "" && health.CheckedByDefault() {
+		// the single backends are checked only to report their health,
+		// since there is no other backend to prefer
+		health.Healthy(healthcheck.Target{Backend: scheme + "://" + host})
+	}
+	if b, ok := c.stateBag[filters.BackendUrlKey].(string); ok {
+		u, err := url.Parse(b)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			log.Errorf("invalid backend address set by the filters in route %s: %s", rt.Id, b)
+		} else {
+			scheme, host = u.Scheme, u.Host
+		}
 	}
+
+	if s, ok := c.stateBag[filters.BackendSchemeKey].(string); ok {
+		scheme = s
+	}
+
+	if h, ok := c.stateBag[filters.BackendHostKey].(string); ok {
+		host = h
+	}
+
+	return scheme, host
 }
 
 // executes an http roundtrip to a route backend
-func (p *proxy) roundtrip(r *http.Request, rt *routing.Route) (*http.Response, error) {
-	rr, err := mapRequest(r, rt)
+func (p *proxy) roundtrip(c *filterContext, rt *routing.Route, scheme, host string) (*http.Response, error) {
+	if rt.Dynamic && (scheme == "" || host == "") {
+		return nil, ErrDynamicBackendNotSet
+	}
+
+	scheme, h2 := backendProtocol(c, scheme)
+	rr, err := mapRequest(c.req, scheme, host)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.roundTripper.RoundTrip(rr)
+	// the 100 Continue response is sent to the client by the server
+	// when the body is read for the first time
+	if p.localContinue && strings.EqualFold(rr.Header.Get("Expect"), "100-continue") {
+		rr.Header.Del("Expect")
+	}
+
+	var so *filters.SocketOptions
+	if o, ok := c.stateBag[filters.SocketOptionsKey].(filters.SocketOptions); ok {
+		so = &o
+	}
+
+	serverName, _ := c.stateBag[filters.TlsServerNameKey].(string)
+	timeouts := p.backendTimeouts(c)
+	total, ok := limitToPhase(timeouts.Total, c.phase)
+	if !ok {
+		return nil, ErrBackendTimeout
+	}
+
+	if h2 {
+		stripConnectionHeaders(rr.Header)
+		return p.transportRoundtrip(p.transports.getHTTP2(so, serverName, timeouts, scheme == "http"), rr, total)
+	}
+
+	tr := p.transports.get(so, serverName, timeouts)
+	return p.transportRoundtrip(tr, rr, total)
 }
 
 // applies all filters to a response in reverse order
-func (p *proxy) applyFiltersToResponse(f []*routing.RouteFilter, ctx filters.FilterContext) {
+func (p *proxy) applyFiltersToResponse(f []*routing.RouteFilter, ctx *filterContext) {
 	count := len(f)
 	var start time.Time
 	for i, _ := range f {
 		fi := f[count-1-i]
+		ctx.watchdog.enter("response filter " + fi.Name)
 		start = time.Now()
 		callSafe(func() { fi.Response(ctx) })
 		metrics.MeasureFilterResponse(fi.Name, start)
+		if !ctx.sandbox.spend(fi, time.Since(start)) {
+			return
+		}
+
+		if !ctx.bodyGuard.checkFilter(fi.Name) || ctx.phase.expired() {
+			return
+		}
 	}
 }
 
+// declares the trailers of the response in the Trailer header, so that
+// the values set after the body was written are sent to the client. The
+// trailers require chunked encoding, therefore the Content-Length is
+// dropped.
+func announceTrailers(h http.Header, trailer http.Header) {
+	if len(trailer) == 0 {
+		return
+	}
+
+	h.Del("Trailer")
+	for k := range trailer {
+		h.Add("Trailer", k)
+	}
+
+	h.Del("Content-Length")
+}
+
 func addBranding(rs *http.Response) {
 	rs.Header.Set("X-Powered-By", "Skipper")
 	rs.Header.Set("Server", "Skipper")
 }
 
+// returns the path template set by the filters in the state bag, or
+// when not set, the path condition of the route
+func pathTemplate(c *filterContext, rt *routing.Route) string {
+	if pt, ok := c.stateBag[filters.PathTemplateKey].(string); ok {
+		return pt
+	}
+
+	return rt.Path
+}
+
+// returns the category of the request set by the filters in the state
+// bag
+func requestCategory(c *filterContext) string {
+	category, _ := c.stateBag[filters.CategoryKey].(string)
+	return category
+}
+
 func (p *proxy) lookupRoute(r *http.Request) (rt *routing.Route, params map[string]string) {
 	for _, prt := range p.priorityRoutes {
 		rt, params = prt.Match(r)
@@ -314,39 +864,200 @@ func (p *proxy) lookupRoute(r *http.Request) (rt *routing.Route, params map[stri
 		}
 	}
 
-	return p.routing.Route(r)
+	rt, params = p.routing.Route(r)
+	p.shadow.evaluate(r, rt)
+	return rt, params
+}
+
+// responds with the custom error handler, when set, or with the default
+// status code, with the JSON error envelope, when enabled
+func (p *proxy) serveError(w http.ResponseWriter, r *http.Request, err error, rt *routing.Route, code int) {
+	if p.errorHandler != nil {
+		p.errorHandler(w, r, err, rt)
+		return
+	}
+
+	if p.errorEnvelope {
+		serveErrorEnvelope(w, r, err, rt, code)
+		return
+	}
+
+	http.Error(w, http.StatusText(code), code)
+}
+
+// responds to an OPTIONS request with the methods of the routes that
+// the request would match
+func serveOptions(w http.ResponseWriter, methods []string) {
+	methods = append(methods, "OPTIONS")
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
 }
 
 // http.Handler implementation
 func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+	if !p.inFlight.acquire() {
+		p.serveError(w, r, ErrInFlightRequestsLimit, nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	defer p.inFlight.release()
+
+	wd := newWatchdog(r, received, p.slowThreshold, p.slowProfile, warn)
+	defer wd.stop()
+
+	p.serve(w, r, wd, received, 0, nil)
+}
+
+// routes and serves a request. It is called again for the requests
+// handled by loopback routes, where loopbacks counts the times the
+// request re-entered the routing, and state contains the state bag
+// entries passed from the previous hop.
+func (p *proxy) serve(w http.ResponseWriter, r *http.Request, wd *watchdog, received time.Time, loopbacks int, state map[string]interface{}) {
 	start := time.Now()
 	rt, params := p.lookupRoute(r)
 	if rt == nil {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		return
+		if methods := p.routing.AllowedMethods(r); len(methods) > 0 {
+			if p.autoOptions && r.Method == "OPTIONS" {
+				serveOptions(w, methods)
+				return
+			}
+
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			p.serveError(w, r, ErrMethodNotAllowed, nil, http.StatusMethodNotAllowed)
+			return
+		}
+
+		metrics.IncUnmatched(routing.CanonicalHost(r.Host))
+		if p.defaultRoute == nil {
+			p.serveError(w, r, ErrRouteNotFound, nil, http.StatusNotFound)
+			return
+		}
+
+		rt = p.defaultRoute
 	}
 	metrics.MeasureRouteLookup(start)
+	wd.setRoute(rt.Id)
 
 	start = time.Now()
 	f := rt.Filters
-	c := newFilterContext(w, r, params, p.preserveOriginal, rt)
+	c := newFilterContext(w, r, params, p.preserveOriginal, rt, received)
+	for k, v := range state {
+		if _, exists := c.stateBag[k]; !exists {
+			c.stateBag[k] = v
+		}
+	}
+
+	c.watchdog = wd
+	c.sandbox = newSandbox(rt)
+	if c.bodyGuard = newBodyGuard(r.Body, rt.Id, "request", p.bufferThreshold, c.sandbox.bodyLimit(p.bufferLimit)); c.bodyGuard != nil {
+		r.Body = c.bodyGuard
+	}
+
+	c.phase = startPhase(p.phaseTimeouts.RequestFilters)
 	p.applyFiltersToRequest(f, c)
+	c.phase.stop()
 	metrics.MeasureAllFiltersRequest(rt.Id, start)
+	c.bodyGuard.release()
+	if c.bodyGuard.limitExceeded() {
+		c.sandbox.bodyExceeded(p.bufferLimit)
+	}
+
+	if c.sandbox.check(rt.Id) && !c.Served() {
+		p.serveError(w, r, ErrSandboxViolation, rt, http.StatusServiceUnavailable)
+		return
+	}
+
+	if c.bodyGuard.limitExceeded() && !c.Served() {
+		p.serveError(w, r, ErrBodyBufferingLimit, rt, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if c.phase.expired() && !c.Served() {
+		p.serveError(w, r, ErrFilterTimeout, rt, http.StatusServiceUnavailable)
+		return
+	}
+
+	riw, _ := w.(routeInfoWriter)
+	pt := pathTemplate(c, rt)
+	category := requestCategory(c)
+
+	// the request was handled by the filters, no backend roundtrip
+	// and response filters
+	if c.Served() {
+		if riw != nil {
+			riw.SetRouteInfo(rt.Id, pt, "", category)
+		}
+
+		return
+	}
+
+	var requestBody *sizeLimitedBody
+	if limit, ok := c.stateBag[filters.MaxRequestBodySizeKey].(int64); ok && r.Body != nil {
+		requestBody = newSizeLimitedBody(r.Body, limit, ErrRequestBodySizeLimit)
+		r.Body = requestBody
+	}
 
 	start = time.Now()
 	var (
-		rs  *http.Response
-		err error
+		rs       *http.Response
+		upgraded *upgradedBody
+		err      error
 	)
-	if rt.Shunt {
+	wd.enter("backend")
+	switch {
+	case rt.Shunt:
 		rs = shunt(r)
-	} else {
-		rs, err = p.roundtrip(r, rt)
-		if err != nil {
-			http.Error(w,
-				http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError)
+	case rt.Loopback:
+		if loopbacks >= maxLoopbacks {
+			p.serveError(w, r, ErrLoopbackLimit, rt, http.StatusInternalServerError)
+			return
+		}
+
+		if upgradeProtocol(r) != "" {
+			p.serveError(w, r, ErrLoopbackUpgrade, rt, http.StatusBadRequest)
+			return
+		}
+
+		rs = p.loopback(r, c.stateBag, wd, received, loopbacks+1)
+		defer rs.Body.Close()
+	default:
+		protocol := upgradeProtocol(r)
+		if protocol != "" {
+			up := p.upgrades.start(c, rt, protocol)
+			if up == nil {
+				p.serveError(w, r, ErrUpgradedConnectionsLimit, rt, http.StatusServiceUnavailable)
+				return
+			}
+
+			defer func() { up.finish(rs) }()
+		}
+
+		c.phase = startPhase(p.phaseTimeouts.Backend)
+		if protocol != "" {
+			rs, err = p.upgradeRoundtrip(c, rt)
+		} else {
+			rs, err = p.backendRoundtrip(c, rt, requestBody)
+		}
+
+		c.phase.stop()
+		if err == ErrCircuitBreakerOpen {
+			p.serveError(w, r, err, rt, http.StatusServiceUnavailable)
+			return
+		} else if err != nil && requestBody.limitExceeded() {
+			p.serveError(w, r, ErrRequestBodySizeLimit, rt, http.StatusRequestEntityTooLarge)
+			return
+		} else if err == ErrBackendConnectionsLimit {
+			p.serveError(w, r, err, rt, http.StatusServiceUnavailable)
+			return
+		} else if err == ErrBackendTimeout {
+			p.serveError(w, r, err, rt, http.StatusGatewayTimeout)
+			return
+		} else if err != nil {
 			log.Error(err)
+			p.serveError(w, r, err, rt, http.StatusInternalServerError)
 			return
 		}
 
@@ -355,29 +1066,136 @@ func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				log.Error(err)
 			}
+
+			if p.drainer != nil {
+				p.drainer.release(rs.Request)
+			}
 		}()
+
+		if requestBody.limitExceeded() {
+			p.serveError(w, r, ErrRequestBodySizeLimit, rt, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		upgraded, _ = rs.Body.(*upgradedBody)
 	}
 	addBranding(rs)
 	metrics.MeasureBackend(rt.Id, start)
 
+	// the shunt responses reference the incoming request
+	if !rt.Shunt && !rt.Loopback && rs.Request != nil {
+		metrics.MeasureBackendHost(rs.Request.URL.Host, start)
+		if biw, ok := w.(backendInfoWriter); ok {
+			biw.SetBackendInfo(rs.Request.URL.Scheme+"://"+rs.Request.URL.Host, time.Since(start))
+		}
+	}
+
 	start = time.Now()
+	if c.bodyGuard = newBodyGuard(rs.Body, rt.Id, "response", p.bufferThreshold, c.sandbox.bodyLimit(p.bufferLimit)); c.bodyGuard != nil {
+		rs.Body = c.bodyGuard
+	}
+
 	c.res = rs
 	if p.preserveOriginal {
 		c.originalResponse = cloneResponseMetadata(rs)
 	}
 
+	c.phase = startPhase(p.phaseTimeouts.ResponseFilters)
 	p.applyFiltersToResponse(f, c)
+	c.phase.stop()
 	metrics.MeasureAllFiltersResponse(rt.Id, start)
+	c.bodyGuard.release()
+	if c.bodyGuard.limitExceeded() {
+		c.sandbox.bodyExceeded(p.bufferLimit)
+	}
+
+	if c.sandbox.check(rt.Id) && !c.Served() {
+		p.serveError(w, r, ErrSandboxViolation, rt, http.StatusBadGateway)
+		return
+	}
+
+	if c.bodyGuard.limitExceeded() && !c.Served() {
+		p.serveError(w, r, ErrBodyBufferingLimit, rt, http.StatusBadGateway)
+		return
+	}
+
+	if c.phase.expired() && !c.Served() {
+		p.serveError(w, r, ErrFilterTimeout, rt, http.StatusServiceUnavailable)
+		return
+	}
+
+	// the backend accepted the upgrade, the connections are taken over
+	if upgraded != nil && !c.Served() {
+		if riw != nil {
+			riw.SetRouteInfo(rt.Id, pt, "", category)
+		}
+
+		wd.stop()
+		p.serveUpgraded(w, c, rt, rs, upgraded)
+		return
+	}
+
+	var responseBody *sizeLimitedBody
+	if limit, ok := c.stateBag[filters.MaxResponseBodySizeKey].(int64); ok && !c.Served() {
+		if rs.ContentLength > limit {
+			p.serveError(w, r, ErrResponseBodySizeLimit, rt, http.StatusBadGateway)
+			return
+		}
+
+		responseBody = newSizeLimitedBody(rs.Body, limit, ErrResponseBodySizeLimit)
+		rs.Body = responseBody
+	}
 
 	if !c.Served() {
+		wd.enter("response body")
 		start = time.Now()
 		copyHeader(w.Header(), rs.Header)
+		announceTrailers(w.Header(), rs.Trailer)
 		w.WriteHeader(rs.StatusCode)
-		err := copyStream(w.(flusherWriter), rs.Body)
+
+		var body io.Reader = rs.Body
+		checksum := crc32.NewIEEE()
+		if p.responseChecksum {
+			body = io.TeeReader(body, checksum)
+		}
+
+		routeBandwidth, _ := c.stateBag[filters.ResponseBandwidthKey].(int64)
+		to, finishStream := p.bandwidth.stream(w.(flusherWriter), rt.Id, routeBandwidth)
+		written, err := copyStream(to, body)
+		finishStream()
+		copyHeader(w.Header(), rs.Trailer)
+		metrics.MeasureResponseSize(rt.Id, written)
+		if riw != nil {
+			var sum string
+			if p.responseChecksum {
+				sum = fmt.Sprintf("%08x", checksum.Sum32())
+			}
+
+			riw.SetRouteInfo(rt.Id, pt, sum, category)
+		}
+
+		err = checkTruncated(rt.Id, expectedLength(r, rs), written, err)
+		if terr, ok := err.(*TruncatedResponseError); ok {
+			metrics.IncTruncated(rt.Id, truncatedMetricsKey(terr.Reason))
+		}
+
+		if responseBody.limitExceeded() {
+			abortResponse(w)
+		}
+
 		if err != nil {
 			log.Error(err)
 		} else {
 			metrics.MeasureResponse(rs.StatusCode, r.Method, rt.Id, start)
+			if pt != "" {
+				metrics.MeasurePathResponse(rs.StatusCode, r.Method, pt, start)
+			}
+
+			if category != "" {
+				metrics.MeasureCategoryResponse(rs.StatusCode, r.Method, category, start)
+			}
 		}
+	} else if riw != nil {
+		riw.SetRouteInfo(rt.Id, pt, "", category)
 	}
 }
@@ -16,17 +16,21 @@ package proxy
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/flowid"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/routing/testdataclient"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strconv"
 	"testing"
 	"time"
@@ -70,6 +74,70 @@ func (corf *preserveOriginalFilter) Response(ctx filters.FilterContext) {
 	preserveHeader(ctx.OriginalResponse().Header, ctx.Response().Header)
 }
 
+type (
+	addTrailerSpec   struct{}
+	addTrailerFilter struct{}
+)
+
+func (s *addTrailerSpec) Name() string { return "addTrailer" }
+
+func (s *addTrailerSpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
+	return &addTrailerFilter{}, nil
+}
+
+func (f *addTrailerFilter) Request(ctx filters.FilterContext) {}
+
+func (f *addTrailerFilter) Response(ctx filters.FilterContext) {
+	rsp := ctx.Response()
+	if rsp.Trailer == nil {
+		rsp.Trailer = make(http.Header)
+	}
+
+	rsp.Trailer.Set("X-Filter-Status", "done")
+}
+
+type (
+	bufferBodySpec   struct{}
+	bufferBodyFilter struct{}
+)
+
+func (s *bufferBodySpec) Name() string { return "bufferBody" }
+
+func (s *bufferBodySpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
+	return &bufferBodyFilter{}, nil
+}
+
+func (f *bufferBodyFilter) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	b, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+}
+
+func (f *bufferBodyFilter) Response(ctx filters.FilterContext) {
+	rsp := ctx.Response()
+	b, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body = ioutil.NopCloser(bytes.NewBuffer(b))
+}
+
+type (
+	filterStateSpec   struct{}
+	filterStateFilter struct{ value interface{} }
+)
+
+func (s *filterStateSpec) Name() string { return "filterState" }
+
+func (s *filterStateSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	return &filterStateFilter{args[0]}, nil
+}
+
+func (f *filterStateFilter) Request(ctx filters.FilterContext) {
+	ctx.FilterState(f)["value"] = f.value
+}
+
+func (f *filterStateFilter) Response(ctx filters.FilterContext) {
+	ctx.Response().Header.Add("X-State", fmt.Sprint(ctx.FilterState(f)["value"]))
+}
+
 func (prt *priorityRoute) Match(r *http.Request) (*routing.Route, map[string]string) {
 	if prt.match(r) {
 		return prt.route, prt.params
@@ -147,11 +215,8 @@ func TestGetRoundtrip(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -208,11 +273,8 @@ func TestPostRoundtrip(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -246,11 +308,8 @@ func TestRoute(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -295,11 +354,8 @@ func TestStreaming(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -375,11 +431,9 @@ func TestAppliesFilters(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		fr,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		FilterRegistry: fr,
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -408,11 +462,9 @@ func TestProcessesRequestWithShuntBackend(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		fr,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		FilterRegistry: fr,
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -452,11 +504,8 @@ func TestProcessesRequestWithPriorityRoute(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone, prt)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone, prt)
 
 	delay()
 
@@ -500,11 +549,8 @@ func TestProcessesRequestWithPriorityRouteOverStandard(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone, prt)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone, prt)
 
 	delay()
 
@@ -532,11 +578,8 @@ func TestFlusherImplementation(t *testing.T) {
 	}
 
 	p := New(routing.New(routing.Options{
-		nil,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsNone)
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}}), OptionsNone)
 
 	delay()
 
@@ -588,11 +631,9 @@ func TestOriginalRequestResponse(t *testing.T) {
 	fr := builtin.MakeRegistry()
 	fr.Register(&preserveOriginalSpec{})
 	p := New(routing.New(routing.Options{
-		fr,
-		routing.MatchingOptionsNone,
-		sourcePollTimeout,
-		[]routing.DataClient{dc},
-		0}), OptionsPreserveOriginal)
+		FilterRegistry: fr,
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsPreserveOriginal)
 
 	delay()
 
@@ -602,3 +643,935 @@ func TestOriginalRequestResponse(t *testing.T) {
 		t.Error("wrong response header", ok)
 	}
 }
+
+type routeInfoRecorder struct {
+	*httptest.ResponseRecorder
+	routeId      string
+	pathTemplate string
+	checksum     string
+	category     string
+}
+
+func (r *routeInfoRecorder) SetRouteInfo(routeId, pathTemplate, checksum, category string) {
+	r.routeId = routeId
+	r.pathTemplate = pathTemplate
+	r.checksum = checksum
+	r.category = category
+}
+
+func TestResponseChecksum(t *testing.T) {
+	payload := []byte("Hello World!")
+	s := startTestServer(payload, 0, voidCheck)
+	defer s.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`hello: Path("/hello") -> "%s"`, s.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, o := range []Options{OptionsNone, OptionsResponseChecksum} {
+		p := New(routing.New(routing.Options{
+			PollTimeout: sourcePollTimeout,
+			DataClients: []routing.DataClient{dc}}), o)
+
+		delay()
+
+		r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+		w := &routeInfoRecorder{ResponseRecorder: httptest.NewRecorder()}
+		p.ServeHTTP(w, r)
+
+		if w.routeId != "hello" {
+			t.Error("failed to report the route id", w.routeId)
+		}
+
+		var expected string
+		if o.ResponseChecksum() {
+			expected = fmt.Sprintf("%08x", crc32.ChecksumIEEE(payload))
+		}
+
+		if w.checksum != expected {
+			t.Error("invalid checksum", o, w.checksum, expected)
+		}
+	}
+}
+
+func TestDetectsBackendClosedEarly(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\nHello")
+		buf.Flush()
+		conn.Close()
+	}))
+	defer s.Close()
+
+	rs, err := http.Get(s.URL)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer rs.Body.Close()
+
+	w := httptest.NewRecorder()
+	written, err := copyStream(w, rs.Body)
+	err = checkTruncated("test", expectedLength(rs.Request, rs), written, err)
+	if terr, ok := err.(*TruncatedResponseError); !ok || terr.Reason != ErrBackendClosedEarly ||
+		terr.ContentLength != 42 || terr.Written != 5 {
+		t.Error("failed to detect truncated response", err)
+	}
+}
+
+func TestCheckTruncated(t *testing.T) {
+	for _, ti := range []struct {
+		msg           string
+		contentLength int64
+		written       int64
+		err           error
+		reason        error
+	}{{
+		"complete",
+		42, 42, nil, nil,
+	}, {
+		"unknown length",
+		-1, 42, nil, nil,
+	}, {
+		"closed early",
+		-1, 21, io.ErrUnexpectedEOF, ErrBackendClosedEarly,
+	}, {
+		"length mismatch",
+		42, 21, nil, ErrContentLengthMismatch,
+	}, {
+		"other error",
+		42, 21, io.ErrClosedPipe, nil,
+	}} {
+		err := checkTruncated("test", ti.contentLength, ti.written, ti.err)
+		terr, ok := err.(*TruncatedResponseError)
+		switch {
+		case ti.reason == nil && ok:
+			t.Error(ti.msg, "unexpected truncation", err)
+		case ti.reason == nil && err != ti.err:
+			t.Error(ti.msg, "unexpected error", err)
+		case ti.reason != nil && (!ok || terr.Reason != ti.reason):
+			t.Error(ti.msg, "failed to detect truncation", err)
+		}
+	}
+}
+
+func TestExpectedLengthIgnoresHead(t *testing.T) {
+	r, _ := http.NewRequest("HEAD", "https://www.example.org", nil)
+	rs := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Length": []string{"42"}}}
+	if l := expectedLength(r, rs); l != -1 {
+		t.Error("unexpected content length", l)
+	}
+
+	r.Method = "GET"
+	if l := expectedLength(r, rs); l != 42 {
+		t.Error("unexpected content length", l)
+	}
+}
+
+func TestCancelsRequestsToRemovedBackends(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-release:
+		case <-time.After(time.Second):
+		}
+	}))
+	defer s.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`hello: Path("/hello") -> "%s"`, s.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			MatchingOptions: routing.MatchingOptionsNone,
+			PollTimeout:     sourcePollTimeout,
+			DataClients:     []routing.DataClient{dc}}),
+		Options:            OptionsDrainRemovedBackends,
+		CancelRemovedAfter: 15 * time.Millisecond})
+
+	delay()
+
+	done := make(chan struct{})
+	go func() {
+		r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+		p.ServeHTTP(httptest.NewRecorder(), r)
+		close(done)
+	}()
+
+	// let the request reach the backend
+	time.Sleep(15 * time.Millisecond)
+
+	dc.Update(nil, []string{"hello"})
+	select {
+	case <-done:
+	case <-time.After(240 * time.Millisecond):
+		t.Error("failed to cancel the request to the removed backend")
+	}
+}
+
+func TestDrainingWithoutRouting(t *testing.T) {
+	defer func() {
+		if err := recover(); err != nil {
+			t.Error("failed to create the proxy without routing", err)
+		}
+	}()
+
+	WithParams(Params{Options: OptionsDrainRemovedBackends})
+}
+
+func TestDrainingKeepsRequestsWithoutGracePeriod(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(", world!"))
+	}))
+	defer s.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`hello: Path("/hello") -> "%s"`, s.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			MatchingOptions: routing.MatchingOptionsNone,
+			PollTimeout:     sourcePollTimeout,
+			DataClients:     []routing.DataClient{dc}}),
+		Options: OptionsDrainRemovedBackends})
+
+	delay()
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+		p.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	time.Sleep(15 * time.Millisecond)
+	dc.Update(nil, []string{"hello"})
+	delay()
+	close(release)
+
+	<-done
+	if w.Body.String() != "Hello, world!" {
+		t.Error("failed to complete the request", w.Body.String())
+	}
+}
+
+func TestBackendSetByFilters(t *testing.T) {
+	payload := []byte("Hello World!")
+	s := startTestServer(payload, 0, voidCheck)
+	defer s.Close()
+
+	doc := fmt.Sprintf(`hello: Path("/hello") -> consistentHash("header:X-Tenant", "%s") -> "http://route.backend.invalid"`, s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+	r.Header.Set("X-Tenant", "tenant1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Error("failed to forward the request to the backend set by the filters", w.Code)
+	}
+}
+
+func TestAuditSignature(t *testing.T) {
+	key, err := ioutil.TempFile("", "audit-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(key.Name())
+	key.WriteString("secret")
+	key.Close()
+
+	var (
+		info      *builtin.AuditInfo
+		verifyErr error
+	)
+
+	s := startTestServer(nil, 0, func(r *http.Request) {
+		info, verifyErr = builtin.VerifyAuditSignature([]byte("secret"), r, time.Minute)
+	})
+	defer s.Close()
+
+	doc := fmt.Sprintf(`audited: Path("/hello") -> auditSignature("%s", "skipper-1") -> "%s"`, key.Name(), s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/hello?foo=bar", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if verifyErr != nil {
+		t.Fatal(verifyErr)
+	}
+
+	if info.RouteId != "audited" || info.Instance != "skipper-1" {
+		t.Error("invalid audit info", info.RouteId, info.Instance)
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+	for _, ti := range []struct {
+		options        Options
+		expectReceived bool
+	}{
+		{OptionsNone, true},
+		{OptionsLocalContinue, false},
+	} {
+		var received bool
+		s := startTestServer(nil, 0, func(r *http.Request) {
+			received = r.Header.Get("Expect") != ""
+		})
+
+		dc, err := testdataclient.NewDoc(fmt.Sprintf(`Any() -> "%s"`, s.URL))
+		if err != nil {
+			t.Error(err)
+			s.Close()
+			continue
+		}
+
+		p := New(routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}), ti.options)
+
+		delay()
+
+		r, _ := http.NewRequest("POST", "https://www.example.org/upload", bytes.NewBufferString("Hello World!"))
+		r.Header.Set("Expect", "100-continue")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || received != ti.expectReceived {
+			t.Error("failed to handle the Expect header", ti.options, w.Code, received)
+		}
+
+		s.Close()
+	}
+}
+
+func TestRequestServedByFilters(t *testing.T) {
+	var backendCalled bool
+	s := startTestServer(nil, 0, func(*http.Request) { backendCalled = true })
+	defer s.Close()
+
+	doc := fmt.Sprintf(`Any() -> websocketOrigin("https://www.example.org") -> responseHeader("X-Foo", "bar") -> "%s"`, s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/socket", nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Origin", "https://evil.example.org")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden || backendCalled || w.Header().Get("X-Foo") != "" {
+		t.Error("failed to skip the backend and the response filters", w.Code, backendCalled)
+	}
+}
+
+// stopping the request filters when the request was served doesn't
+// affect the filters serving the request in the response phase, they
+// still get the backend response, and the response filters are applied
+func TestServedResponsePhase(t *testing.T) {
+	var backendCalls int
+	s := startTestServer([]byte("backend"), 0, func(*http.Request) { backendCalls++ })
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "served-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(dir+"/file.txt", []byte("static"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := fmt.Sprintf(`
+		static: Path("/static/file.txt") -> static("/static", "%s") -> responseHeader("X-Foo", "bar") -> "%s";
+		redirect: Path("/redirect") -> redirect(302, "https://www.example.org/new") -> "%s";
+		plain: Path("/plain") -> responseHeader("X-Foo", "bar") -> "%s"`, dir, s.URL, s.URL, s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	for _, test := range []struct {
+		path     string
+		status   int
+		body     string
+		header   string
+		location string
+		backend  int
+	}{
+		{"/static/file.txt", http.StatusOK, "static", "", "", 1},
+		{"/redirect", http.StatusFound, "", "", "https://www.example.org/new", 1},
+		{"/plain", http.StatusOK, "backend", "bar", "", 1},
+	} {
+		backendCalls = 0
+		r, _ := http.NewRequest("GET", "https://www.example.org"+test.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != test.status || backendCalls != test.backend ||
+			w.Header().Get("X-Foo") != test.header ||
+			w.Header().Get("Location") != test.location ||
+			test.body != "" && w.Body.String() != test.body {
+			t.Error(test.path, "unexpected response", w.Code, backendCalls, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	s := startTestServer(nil, 0, voidCheck)
+	defer s.Close()
+
+	doc := fmt.Sprintf(`
+		users: Path("/users/:id") -> "%s";
+		orders: PathRegexp("^/orders/[0-9]+$") -> pathTemplate("/orders/:id") -> "%s";
+		other: Any() -> "%s"`, s.URL, s.URL, s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	for _, ti := range []struct {
+		path     string
+		template string
+	}{
+		{"/users/42", "/users/:id"},
+		{"/orders/42", "/orders/:id"},
+		{"/other", ""},
+	} {
+		r, _ := http.NewRequest("GET", "https://www.example.org"+ti.path, nil)
+		w := &routeInfoRecorder{ResponseRecorder: httptest.NewRecorder()}
+		p.ServeHTTP(w, r)
+
+		if w.pathTemplate != ti.template {
+			t.Error("invalid path template", ti.path, w.pathTemplate, ti.template)
+		}
+	}
+}
+
+func TestRequestCategory(t *testing.T) {
+	s := startTestServer(nil, 0, voidCheck)
+	defer s.Close()
+
+	doc := fmt.Sprintf(`category: Any() -> classify("checkout", "path:/checkout", "other") -> "%s"`, s.URL)
+	dc, err := testdataclient.NewDoc(doc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	for _, ti := range []struct {
+		path     string
+		category string
+	}{
+		{"/checkout/cart", "checkout"},
+		{"/orders", "other"},
+	} {
+		r, _ := http.NewRequest("GET", "https://www.example.org"+ti.path, nil)
+		w := &routeInfoRecorder{ResponseRecorder: httptest.NewRecorder()}
+		p.ServeHTTP(w, r)
+
+		if w.category != ti.category {
+			t.Error("invalid category", ti.path, w.category, ti.category)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		get: Path("/hello") && Method("GET") -> <shunt>;
+		delete: Path("/hello") && Method("DELETE") -> <shunt>`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	for _, ti := range []struct {
+		path  string
+		code  int
+		allow string
+	}{
+		{"/hello", http.StatusMethodNotAllowed, "DELETE, GET"},
+		{"/other", http.StatusNotFound, ""},
+	} {
+		r, _ := http.NewRequest("POST", "https://www.example.org"+ti.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != ti.code {
+			t.Error("invalid status code", ti.path, w.Code, ti.code)
+		}
+
+		if w.Header().Get("Allow") != ti.allow {
+			t.Error("invalid allow header", ti.path, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestAutoOptions(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		get: Path("/hello") && Method("GET") -> "http://127.0.0.1:1";
+		delete: Path("/hello") && Method("DELETE") -> "http://127.0.0.1:1";
+		customOptions: Path("/custom") && Method("OPTIONS") -> responseHeader("Allow", "POST") -> <shunt>;
+		customPost: Path("/custom") && Method("POST") -> <shunt>`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsAutoOptions)
+
+	delay()
+
+	for _, ti := range []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{"OPTIONS", "/hello", http.StatusOK, "DELETE, GET, OPTIONS"},
+		{"POST", "/hello", http.StatusMethodNotAllowed, "DELETE, GET"},
+		{"OPTIONS", "/custom", http.StatusNotFound, "POST"},
+		{"OPTIONS", "/other", http.StatusNotFound, ""},
+	} {
+		r, _ := http.NewRequest(ti.method, "https://www.example.org"+ti.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != ti.code {
+			t.Error("invalid status code", ti.method, ti.path, w.Code, ti.code)
+		}
+
+		if w.Header().Get("Allow") != ti.allow {
+			t.Error("invalid allow header", ti.method, ti.path, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		get: Path("/hello") && Method("GET") -> <shunt>;
+		failing: Path("/failing") -> "http://127.0.0.1:1"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var (
+		handledErr   error
+		handledRoute *routing.Route
+	)
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error, rt *routing.Route) {
+			handledErr, handledRoute = err, rt
+			w.WriteHeader(http.StatusTeapot)
+		}})
+
+	delay()
+
+	for _, ti := range []struct {
+		method, path string
+		err          error
+		routeId      string
+	}{
+		{"GET", "/other", ErrRouteNotFound, ""},
+		{"POST", "/hello", ErrMethodNotAllowed, ""},
+		{"GET", "/failing", nil, "failing"},
+	} {
+		handledErr, handledRoute = nil, nil
+
+		r, _ := http.NewRequest(ti.method, "https://www.example.org"+ti.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != http.StatusTeapot {
+			t.Error("the error handler was not called", ti.path, w.Code)
+		}
+
+		if ti.err != nil && handledErr != ti.err || ti.err == nil && handledErr == nil {
+			t.Error("invalid error", ti.path, handledErr)
+		}
+
+		if ti.routeId == "" && handledRoute != nil || ti.routeId != "" && (handledRoute == nil || handledRoute.Id != ti.routeId) {
+			t.Error("invalid route", ti.path, handledRoute)
+		}
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		get: Path("/hello") && Method("GET") -> <shunt>;
+		failing: Path("/failing") -> flowId() -> "http://127.0.0.1:1"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		Options: OptionsErrorEnvelope})
+
+	delay()
+
+	for _, ti := range []struct {
+		method, path, flowId string
+		status               int
+		code, routeId        string
+	}{
+		{"GET", "/other", "", http.StatusNotFound, ErrorCodeRouteNotFound, ""},
+		{"POST", "/hello", "some-flow", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, ""},
+		{"GET", "/failing", "", http.StatusInternalServerError, ErrorCodeBackendError, "failing"},
+	} {
+		r, _ := http.NewRequest(ti.method, "https://www.example.org"+ti.path, nil)
+		if ti.flowId != "" {
+			r.Header.Set(flowid.HeaderName, ti.flowId)
+		}
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != ti.status || w.Header().Get("Content-Type") != "application/json" {
+			t.Error("invalid response", ti.path, w.Code, w.Header().Get("Content-Type"))
+			continue
+		}
+
+		var e ErrorEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Error(ti.path, err)
+			continue
+		}
+
+		if e.Error.Status != ti.status || e.Error.Code != ti.code || e.Error.Message != http.StatusText(ti.status) || e.Error.RouteId != ti.routeId {
+			t.Error("invalid envelope", ti.path, e.Error)
+		}
+
+		switch {
+		case ti.flowId != "" && e.Error.FlowId != ti.flowId:
+			t.Error("failed to set the flow id", ti.path, e.Error.FlowId)
+		case ti.path == "/failing" && e.Error.FlowId == "":
+			t.Error("failed to set the generated flow id", e.Error)
+		}
+	}
+}
+
+func TestBackendOverrides(t *testing.T) {
+	var host, serverName string
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, serverName = r.Host, r.TLS.ServerName
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		Path("/hello") ->
+		backendScheme("https") -> backendHost("%s") -> tlsServerName("public.example.org") ->
+		"http://internal.example.org"`, u.Host))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	p := New(routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsInsecure)
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Error("failed to reach the backend", w.Code)
+	}
+
+	if host != "www.example.org" {
+		t.Error("the host header was changed", host)
+	}
+
+	if serverName != "public.example.org" {
+		t.Error("failed to override the server name", serverName)
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Backend-Status")
+		w.Write([]byte("Hello World!"))
+		w.Header().Set("X-Backend-Status", "ok")
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		backend: Path("/backend") -> "%s";
+		filter: Path("/filter") -> addTrailer() -> "%s";
+		loopback: Path("/loopback") -> modPath(".*", "/filter") -> <loopback>`, backend.URL, backend.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(&addTrailerSpec{})
+	p := New(routing.New(routing.Options{
+		FilterRegistry: fr,
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	ps := httptest.NewServer(p)
+	defer ps.Close()
+
+	for _, ti := range []struct {
+		path     string
+		trailers map[string]string
+	}{
+		{"/backend", map[string]string{"X-Backend-Status": "ok"}},
+		{"/filter", map[string]string{"X-Backend-Status": "ok", "X-Filter-Status": "done"}},
+		{"/loopback", map[string]string{"X-Backend-Status": "ok", "X-Filter-Status": "done"}},
+	} {
+		rsp, err := http.Get(ps.URL + ti.path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		b, err := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if err != nil || string(b) != "Hello World!" {
+			t.Error("failed to receive the body", ti.path, err)
+		}
+
+		for k, v := range ti.trailers {
+			if rsp.Trailer.Get(k) != v {
+				t.Error("invalid trailer", ti.path, k, rsp.Trailer.Get(k))
+			}
+		}
+	}
+}
+
+func TestDefaultBackend(t *testing.T) {
+	payload := []byte("Hello World!")
+	s := startTestServer(payload, 0, voidCheck)
+	defer s.Close()
+
+	dc, err := testdataclient.NewDoc(`Path("/hello") -> <shunt>`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ti := range []struct {
+		backend string
+		code    int
+	}{
+		{"", http.StatusNotFound},
+		{"invalid", http.StatusNotFound},
+		{s.URL, http.StatusOK},
+	} {
+		p := WithParams(Params{
+			Routing: routing.New(routing.Options{
+				FilterRegistry: builtin.MakeRegistry(),
+				PollTimeout:    sourcePollTimeout,
+				DataClients:    []routing.DataClient{dc}}),
+			DefaultBackend: ti.backend})
+
+		delay()
+
+		r, _ := http.NewRequest("GET", "https://www.example.org/other", nil)
+		w := &routeInfoRecorder{ResponseRecorder: httptest.NewRecorder()}
+		p.ServeHTTP(w, r)
+
+		if w.Code != ti.code {
+			t.Error("invalid status code", ti.backend, w.Code, ti.code)
+		}
+
+		if ti.code == http.StatusOK && (w.routeId != DefaultRouteId || !bytes.Equal(w.Body.Bytes(), payload)) {
+			t.Error("failed to forward to the default backend", w.routeId)
+		}
+	}
+}
+
+func TestBodyBufferingLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			io.Copy(w, r.Body)
+			return
+		}
+
+		w.Write([]byte("Hello World!"))
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		plain: Path("/plain") -> "%s";
+		buffered: Path("/buffered") -> bufferBody() -> "%s"`, backend.URL, backend.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(&bufferBodySpec{})
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: fr,
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		BodyBufferingThreshold: 2,
+		BodyBufferingLimit:     8})
+
+	delay()
+
+	for _, ti := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"POST", "/plain", "Hello World!", http.StatusOK},
+		{"GET", "/plain", "", http.StatusOK},
+		{"POST", "/buffered", "Hello", http.StatusOK},
+		{"POST", "/buffered", "Hello World!", http.StatusRequestEntityTooLarge},
+		{"GET", "/buffered", "", http.StatusBadGateway},
+	} {
+		r, _ := http.NewRequest(ti.method, "https://www.example.org"+ti.path, bytes.NewBufferString(ti.body))
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != ti.code {
+			t.Error("invalid status code", ti.method, ti.path, ti.body, w.Code, ti.code)
+		}
+	}
+}
+
+func TestFilterState(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`Any() -> filterState("a") -> filterState("b") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(&filterStateSpec{})
+	p := New(routing.New(routing.Options{
+		FilterRegistry: fr,
+		PollTimeout:    sourcePollTimeout,
+		DataClients:    []routing.DataClient{dc}}), OptionsNone)
+
+	delay()
+
+	r, _ := http.NewRequest("GET", "https://www.example.org", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	if s := w.Header()["X-State"]; len(s) != 2 || s[0] != "b" || s[1] != "a" {
+		t.Error("failed to isolate the state of the filters", s)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudgetRatio = 0.2
+	defaultRetryBudgetBurst = 10
+
+	// the maximum number of bytes read from the body of a discarded
+	// response, so that the connection can be reused
+	maxDiscardedBody = 4096
+)
+
+// limits the retries to a share of the backend requests. Every request
+// deposits the ratio, and every retry withdraws one. The balance is
+// capped by the burst, which is also the initial balance.
+type retryBudget struct {
+	mx      sync.Mutex
+	ratio   float64
+	burst   float64
+	balance float64
+}
+
+func newRetryBudget(ratio float64, burst int) *retryBudget {
+	if ratio <= 0 {
+		ratio = defaultRetryBudgetRatio
+	}
+
+	if burst <= 0 {
+		burst = defaultRetryBudgetBurst
+	}
+
+	return &retryBudget{ratio: ratio, burst: float64(burst), balance: float64(burst)}
+}
+
+func (b *retryBudget) deposit() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.balance += b.ratio
+	if b.balance > b.burst {
+		b.balance = b.burst
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.balance < 1 {
+		return false
+	}
+
+	b.balance--
+	return true
+}
+
+// only the requests without a body and with an idempotent method are
+// retried
+func retryableRequest(r *http.Request) bool {
+	return (r.Method == "GET" || r.Method == "HEAD") && (r.Body == nil || r.ContentLength == 0)
+}
+
+// the errors of the proxy itself, that are not retried
+func retryableError(err error) bool {
+	switch err {
+	case ErrBackendConnectionsLimit, ErrDynamicBackendNotSet, ErrCircuitBreakerOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func retryableStatus(s filters.RetrySettings, status int) bool {
+	for _, si := range s.Statuses {
+		if si == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the retry settings of the filters, or the defaults
+func (p *proxy) retrySettings(c *filterContext) filters.RetrySettings {
+	if s, ok := c.stateBag[filters.RetryKey].(filters.RetrySettings); ok {
+		return s
+	}
+
+	return p.retry
+}
+
+// closes a response that is retried
+func (p *proxy) discardResponse(rs *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(rs.Body, maxDiscardedBody))
+	rs.Body.Close()
+	if p.drainer != nil {
+		p.drainer.release(rs.Request)
+	}
+}
+
+// executes the backend roundtrip of a request, through the load
+// balancer, when set by the filters, and the circuit breaker of the
+// backend. When the roundtrip fails with a connection error, or the
+// backend responds with one of the retried status codes, the idempotent
+// requests are retried, while the retry budget allows it. In case of a
+// split backend or a load balancer, the retries prefer another backend.
+func (p *proxy) backendRoundtrip(c *filterContext, rt *routing.Route, requestBody *sizeLimitedBody) (*http.Response, error) {
+	settings := p.retrySettings(c)
+	retryable := settings.Attempts > 0 && retryableRequest(c.req)
+	if retryable {
+		p.retryBudget.deposit()
+	}
+
+	lb := p.balancers.get(c, rt.Id)
+	_, serverNameSet := c.stateBag[filters.TlsServerNameKey]
+
+	var exclude string
+	for attempt := 0; ; attempt++ {
+		scheme, host := backendAddress(c, rt, exclude, p.healthChecks)
+
+		// the members resolved from a DNS name are verified with the
+		// name, unless the filters set the TLS server name
+		var member *lbMember
+		if lb != nil {
+			member = lb.pick(exclude, time.Now())
+			scheme, host = member.scheme, member.host
+			if !serverNameSet && member.serverName != "" {
+				c.stateBag[filters.TlsServerNameKey] = member.serverName
+			} else if !serverNameSet {
+				delete(c.stateBag, filters.TlsServerNameKey)
+			}
+		}
+
+		br := p.breakers.get(c, rt.Id, host)
+		var generation int
+		if br != nil {
+			var allowed bool
+			if allowed, generation = br.allow(time.Now()); !allowed {
+				if member != nil {
+					lb.done(member, false, false, time.Now())
+				}
+
+				metrics.IncCircuitBreakerRejected(br.key)
+				return nil, ErrCircuitBreakerOpen
+			}
+		}
+
+		rs, err := p.roundtrip(c, rt, scheme, host)
+		if observe, ok := c.stateBag[filters.BackendObserverKey].(filters.BackendObserver); ok {
+			observe(rs, err)
+		}
+
+		if member != nil {
+			counted := !requestBody.limitExceeded() && retryableError(err)
+			lb.done(member, err == nil && rs.StatusCode < http.StatusInternalServerError, counted, time.Now())
+		}
+		if br != nil {
+			if requestBody.limitExceeded() || !retryableError(err) {
+				br.cancel(generation)
+			} else {
+				br.done(generation, err == nil && rs.StatusCode < http.StatusInternalServerError, time.Now())
+			}
+		}
+
+		if !retryable || attempt >= settings.Attempts ||
+			err != nil && !retryableError(err) ||
+			err == nil && !retryableStatus(settings, rs.StatusCode) {
+			return rs, err
+		}
+
+		if !p.retryBudget.withdraw() {
+			metrics.IncRetryBudgetExhausted(rt.Id)
+			return rs, err
+		}
+
+		metrics.IncRetry(rt.Id)
+		if err == nil {
+			p.discardResponse(rs)
+		}
+
+		exclude = host
+	}
+}
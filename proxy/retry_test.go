@@ -0,0 +1,205 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(0.5, 2)
+	if !b.withdraw() || !b.withdraw() || b.withdraw() {
+		t.Error("failed to allow the burst")
+	}
+
+	b.deposit()
+	if b.withdraw() {
+		t.Error("failed to limit the retries")
+	}
+
+	b.deposit()
+	if !b.withdraw() {
+		t.Error("failed to replenish the budget")
+	}
+
+	for i := 0; i < 10; i++ {
+		b.deposit()
+	}
+
+	if b.balance != 2 {
+		t.Error("failed to cap the budget", b.balance)
+	}
+}
+
+func TestRetryStatus(t *testing.T) {
+	var requests int
+	p, _ := bodyLimitProxy(t, `retry(2, "5xx")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || requests != 3 {
+		t.Error("failed to retry the request", w.Code, requests)
+	}
+}
+
+func TestRetryAttemptsLimit(t *testing.T) {
+	var requests int
+	p, _ := bodyLimitProxy(t, `retry(1, "503")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || requests != 2 {
+		t.Error("failed to limit the retries", w.Code, requests)
+	}
+}
+
+func TestRetryIdempotentOnly(t *testing.T) {
+	var requests int
+	p, _ := bodyLimitProxy(t, `retry(2, "5xx")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	r, _ := http.NewRequest("POST", "https://www.example.org/", bytes.NewBufferString("foo"))
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || requests != 1 {
+		t.Error("failed to skip the retries", w.Code, requests)
+	}
+}
+
+func TestRetryAlternateBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("alive"))
+	}))
+	defer backend.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(
+		`split: Any() -> retry(1) -> <split 1 "%s", 1 "%s">`,
+		backend.URL, closed.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		RetryBudgetBurst: 100})
+
+	delay()
+
+	for i := 0; i < 30; i++ {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != "alive" {
+			t.Fatal("failed to retry with the alternate backend", i, w.Code)
+		}
+	}
+}
+
+type observerSpec struct{ results *[]string }
+
+func (s observerSpec) Name() string { return "observer" }
+
+func (s observerSpec) CreateFilter([]interface{}) (filters.Filter, error) { return s, nil }
+
+func (s observerSpec) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendObserverKey] = filters.BackendObserver(func(rsp *http.Response, err error) {
+		if err != nil {
+			*s.results = append(*s.results, "error")
+		} else {
+			*s.results = append(*s.results, strconv.Itoa(rsp.StatusCode))
+		}
+	})
+}
+
+func (s observerSpec) Response(filters.FilterContext) {}
+
+func TestBackendObserver(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, test := range []struct {
+		msg      string
+		backend  string
+		expected []string
+	}{{
+		"connection error",
+		closed.URL,
+		[]string{"error", "error"},
+	}, {
+		"response",
+		"",
+		[]string{"503", "503"},
+	}} {
+		backend := test.backend
+		if backend == "" {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer s.Close()
+			backend = s.URL
+		}
+
+		dc, err := testdataclient.NewDoc(fmt.Sprintf(`observed: Any() -> retry(1, "5xx") -> observer() -> "%s"`, backend))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []string
+		registry := builtin.MakeRegistry()
+		registry.Register(observerSpec{&results})
+		p := WithParams(Params{
+			Routing: routing.New(routing.Options{
+				FilterRegistry: registry,
+				PollTimeout:    sourcePollTimeout,
+				DataClients:    []routing.DataClient{dc}}),
+			RetryBudgetBurst: 100})
+
+		delay()
+
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		p.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(results, test.expected) {
+			t.Error(test.msg, "failed to observe the backend requests", results)
+		}
+	}
+}
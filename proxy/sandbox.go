@@ -0,0 +1,104 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"time"
+)
+
+// Passed to the error handler when the filters of a sandboxed route
+// exceeded the resource budget of the sandbox.
+var ErrSandboxViolation = errors.New("sandbox limits exceeded")
+
+// the budget of a request on a sandboxed route
+type sandbox struct {
+	filter    filters.SandboxFilter
+	index     int
+	limits    filters.SandboxLimits
+	spent     time.Duration
+	violation string
+	reported  bool
+}
+
+// returns nil, when the route is not sandboxed
+func newSandbox(rt *routing.Route) *sandbox {
+	for _, fi := range rt.Filters {
+		if sf, ok := fi.Filter.(filters.SandboxFilter); ok {
+			return &sandbox{filter: sf, index: fi.Index, limits: sf.SandboxLimits()}
+		}
+	}
+
+	return nil
+}
+
+// returns the effective body buffering limit of the request, the
+// smaller of the proxy and the sandbox limit
+func (s *sandbox) bodyLimit(limit int64) int64 {
+	if s == nil || s.limits.BodyBytes <= 0 {
+		return limit
+	}
+
+	if limit <= 0 || s.limits.BodyBytes < limit {
+		return s.limits.BodyBytes
+	}
+
+	return limit
+}
+
+// counts the time spent by a filter, when it is sandboxed, and returns
+// false, when the budget was exceeded
+func (s *sandbox) spend(fi *routing.RouteFilter, d time.Duration) bool {
+	if s == nil || fi.Index <= s.index || s.limits.FilterTime <= 0 {
+		return true
+	}
+
+	s.spent += d
+	if s.spent > s.limits.FilterTime && s.violation == "" {
+		s.violation = fmt.Sprintf("filter time budget of %v exceeded by filter %s", s.limits.FilterTime, fi.Name)
+	}
+
+	return s.violation == ""
+}
+
+// records the violation of the body buffering budget, when the sandbox
+// limit was the effective one
+func (s *sandbox) bodyExceeded(proxyLimit int64) {
+	if s == nil || s.violation != "" || s.bodyLimit(proxyLimit) != s.limits.BodyBytes {
+		return
+	}
+
+	s.violation = fmt.Sprintf("body budget of %d bytes exceeded", s.limits.BodyBytes)
+}
+
+// reports the violation, once per request, and returns true, when the
+// limits were exceeded
+func (s *sandbox) check(routeId string) bool {
+	if s == nil || s.violation == "" {
+		return false
+	}
+
+	if !s.reported {
+		s.reported = true
+		log.Errorf("sandbox violation in route %s: %s", routeId, s.violation)
+		s.filter.SandboxViolation(routeId, s.violation)
+	}
+
+	return true
+}
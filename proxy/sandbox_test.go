@@ -0,0 +1,110 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSandbox struct {
+	limits     filters.SandboxLimits
+	mx         sync.Mutex
+	violations []string
+}
+
+type sleepFilter struct{}
+
+func (s *testSandbox) Name() string                                       { return "testSandbox" }
+func (s *testSandbox) CreateFilter([]interface{}) (filters.Filter, error) { return s, nil }
+func (s *testSandbox) Request(filters.FilterContext)                      {}
+func (s *testSandbox) Response(filters.FilterContext)                     {}
+func (s *testSandbox) SandboxLimits() filters.SandboxLimits               { return s.limits }
+
+func (s *testSandbox) SandboxViolation(routeId, reason string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.violations = append(s.violations, routeId)
+}
+
+func (s *testSandbox) violationCount() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return len(s.violations)
+}
+
+func (f sleepFilter) Name() string                                       { return "sleep" }
+func (f sleepFilter) CreateFilter([]interface{}) (filters.Filter, error) { return f, nil }
+func (f sleepFilter) Request(filters.FilterContext)                      { time.Sleep(30 * time.Millisecond) }
+func (f sleepFilter) Response(filters.FilterContext)                     {}
+
+func TestSandbox(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`
+		fast: Path("/fast") -> testSandbox() -> requestHeader("X-Test", "foo") -> "%s";
+		slow: Path("/slow") -> testSandbox() -> sleep() -> "%s";
+		trusted: Path("/trusted") -> sleep() -> testSandbox() -> "%s";
+	`, backend.URL, backend.URL, backend.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb := &testSandbox{limits: filters.SandboxLimits{FilterTime: 15 * time.Millisecond}}
+	fr := builtin.MakeRegistry()
+	fr.Register(sb)
+	fr.Register(sleepFilter{})
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: fr,
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}})})
+
+	delay()
+
+	for _, ti := range []struct {
+		path       string
+		status     int
+		violations int
+	}{
+		{"/fast", http.StatusOK, 0},
+		{"/trusted", http.StatusOK, 0},
+		{"/slow", http.StatusServiceUnavailable, 1},
+		{"/slow", http.StatusServiceUnavailable, 2},
+	} {
+		r, _ := http.NewRequest("GET", "https://www.example.org"+ti.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != ti.status {
+			t.Error("invalid status code", ti.path, w.Code)
+		}
+
+		if n := sb.violationCount(); n != ti.violations {
+			t.Error("invalid number of violations", ti.path, n)
+		}
+	}
+}
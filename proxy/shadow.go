@@ -0,0 +1,112 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"strings"
+)
+
+// the results of comparing the live and the shadow lookup
+const (
+	shadowSame           = "same"
+	shadowRouteDiffers   = "route"
+	shadowBackendDiffers = "backend"
+)
+
+// evaluates a candidate routing table for every request, only to compare
+// its result with the live table, without affecting the traffic
+type shadow struct {
+	routing *routing.Routing
+	report  func(result string)
+}
+
+// returns nil, when no shadow routing is set
+func newShadow(r *routing.Routing) *shadow {
+	if r == nil {
+		return nil
+	}
+
+	return &shadow{routing: r, report: metrics.IncShadowRouting}
+}
+
+func routeBackend(rt *routing.Route) string {
+	switch {
+	case rt.Shunt:
+		return "<shunt>"
+	case rt.Loopback:
+		return "<loopback>"
+	case rt.Dynamic:
+		return "<dynamic>"
+	}
+
+	if len(rt.SplitBackends) > 0 {
+		var backends []string
+		for _, b := range rt.SplitBackends {
+			backends = append(backends, fmt.Sprintf("%d %s", b.Weight, b.Backend))
+		}
+
+		return "<split " + strings.Join(backends, ", ") + ">"
+	}
+
+	return rt.Backend
+}
+
+// compares the route matched by the live table with the route matched
+// by the shadow table. When the backends differ, the difference is
+// reported as a backend difference, even if the route ids differ, too.
+func compareShadow(live, shadowed *routing.Route) string {
+	switch {
+	case live == nil && shadowed == nil:
+		return shadowSame
+	case live == nil || shadowed == nil:
+		return shadowBackendDiffers
+	case routeBackend(live) != routeBackend(shadowed):
+		return shadowBackendDiffers
+	case live.Id != shadowed.Id:
+		return shadowRouteDiffers
+	default:
+		return shadowSame
+	}
+}
+
+// matches the request with the shadow table, and reports whether the
+// result differs from the live route
+func (s *shadow) evaluate(r *http.Request, live *routing.Route) {
+	if s == nil {
+		return
+	}
+
+	shadowed, _ := s.routing.Route(r)
+	result := compareShadow(live, shadowed)
+	if result != shadowSame {
+		var liveId, shadowId string
+		if live != nil {
+			liveId = live.Id
+		}
+
+		if shadowed != nil {
+			shadowId = shadowed.Id
+		}
+
+		log.Debugf("shadow routing differs: %s, live route: %s, shadow route: %s", result, liveId, shadowId)
+	}
+
+	s.report(result)
+}
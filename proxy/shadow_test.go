@@ -0,0 +1,159 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompareShadow(t *testing.T) {
+	route := func(id, backend string, shunt bool) *routing.Route {
+		r := &routing.Route{Backend: backend, Shunt: shunt}
+		r.Id = id
+		return r
+	}
+
+	for _, ti := range []struct {
+		msg            string
+		live, shadowed *routing.Route
+		expected       string
+	}{{
+		"both unmatched",
+		nil,
+		nil,
+		shadowSame,
+	}, {
+		"only live matched",
+		route("r1", "https://www.example.org", false),
+		nil,
+		shadowBackendDiffers,
+	}, {
+		"only shadow matched",
+		nil,
+		route("r1", "https://www.example.org", false),
+		shadowBackendDiffers,
+	}, {
+		"same",
+		route("r1", "https://www.example.org", false),
+		route("r1", "https://www.example.org", false),
+		shadowSame,
+	}, {
+		"route differs",
+		route("r1", "https://www.example.org", false),
+		route("r2", "https://www.example.org", false),
+		shadowRouteDiffers,
+	}, {
+		"backend differs",
+		route("r1", "https://www.example.org", false),
+		route("r1", "https://other.example.org", false),
+		shadowBackendDiffers,
+	}, {
+		"shunt differs",
+		route("r1", "https://www.example.org", false),
+		route("r1", "", true),
+		shadowBackendDiffers,
+	}, {
+		"both shunt",
+		route("r1", "", true),
+		route("r2", "", true),
+		shadowRouteDiffers,
+	}} {
+		if result := compareShadow(ti.live, ti.shadowed); result != ti.expected {
+			t.Error(ti.msg, "invalid result", result, ti.expected)
+		}
+	}
+}
+
+func TestShadowRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "live")
+	}))
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "` + backend.URL + `";
+		bar: Path("/bar") -> "` + backend.URL + `";
+		baz: Path("/baz") -> "` + backend.URL + `"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdc, err := testdataclient.NewDoc(`
+		foo: Path("/foo") -> "` + backend.URL + `";
+		bar2: Path("/bar") -> "` + backend.URL + `";
+		baz: Path("/baz") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := routing.New(routing.Options{
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{dc}})
+	defer live.Close()
+
+	shadowRouting := routing.New(routing.Options{
+		PollTimeout: sourcePollTimeout,
+		DataClients: []routing.DataClient{sdc}})
+	defer shadowRouting.Close()
+
+	p := WithParams(Params{Routing: live, ShadowRouting: shadowRouting}).(*proxy)
+
+	var results []string
+	p.shadow.report = func(result string) { results = append(results, result) }
+
+	delay()
+
+	for _, path := range []string{"/foo", "/bar", "/baz", "/qux"} {
+		r, err := http.NewRequest("GET", "https://www.example.org"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if path != "/qux" && (w.Code != http.StatusOK || w.Header().Get("X-Backend") != "live") {
+			t.Error("failed to serve the request with the live routing", path, w.Code)
+		}
+	}
+
+	expected := []string{shadowSame, shadowRouteDiffers, shadowBackendDiffers, shadowSame}
+	if len(results) != len(expected) {
+		t.Fatal("invalid number of results", results)
+	}
+
+	for i, r := range results {
+		if r != expected[i] {
+			t.Error("invalid result", i, r, expected[i])
+		}
+	}
+}
+
+func TestShadowRoutingDisabled(t *testing.T) {
+	rt := routing.New(routing.Options{})
+	defer rt.Close()
+
+	p := WithParams(Params{Routing: rt}).(*proxy)
+	if p.shadow != nil {
+		t.Error("failed to disable shadow routing")
+	}
+
+	// no panic
+	p.shadow.evaluate(&http.Request{}, nil)
+}
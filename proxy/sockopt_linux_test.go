@@ -0,0 +1,63 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestSetsTrafficClass(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	conn, err := dialWithOptions(filters.SocketOptions{DSCP: 46}, &net.Dialer{})("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	f, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+	defer syscall.SetNonblock(int(f.Fd()), true)
+
+	tos, err := syscall.GetsockoptInt(int(f.Fd()), syscall.IPPROTO_IP, syscall.IP_TOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tos != 46<<2 {
+		t.Error("failed to set the traffic class", tos)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+)
+
+// sets the traffic class of the IP packets. The connection is accessed
+// through a duplicated file descriptor, that shares the socket with the
+// connection, and the non-blocking mode of the socket is restored after
+// the duplication.
+func setTrafficClass(conn *net.TCPConn, tos int, ipv6 bool) error {
+	f, err := conn.File()
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	fd := int(f.Fd())
+	if ipv6 {
+		err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	} else {
+		err = syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+	}
+
+	if nerr := syscall.SetNonblock(fd, true); err == nil {
+		err = nerr
+	}
+
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/routing"
+	"math/rand"
+)
+
+// returns the sum of the weights of the split backends
+func totalWeight(backends []*routing.WeightedBackend) int {
+	var total int
+	for _, b := range backends {
+		total += b.Weight
+	}
+
+	return total
+}
+
+// picks one of the split backends, where n is in the range of
+// [0, total weight). The backends with 0 weight are never picked.
+func pickWeightedBackend(backends []*routing.WeightedBackend, n int) *routing.WeightedBackend {
+	for _, b := range backends {
+		if n < b.Weight {
+			return b
+		}
+
+		n -= b.Weight
+	}
+
+	return nil
+}
+
+// picks a backend of a route with a split backend randomly, according
+// to the weights of the backends. The backends marked down by the health
+// checks are skipped, unless all of them are down. When exclude is set,
+// e.g. the host of a failed backend when retrying, the backends with the
+// other hosts are preferred.
+func splitBackendAddress(rt *routing.Route, exclude string, health *healthcheck.Checker) (scheme, host string) {
+	backends := rt.WeightedBackends
+	var healthy []*routing.WeightedBackend
+	for _, b := range backends {
+		if health.Healthy(healthcheck.Target{Backend: b.Scheme + "://" + b.Host}) {
+			healthy = append(healthy, b)
+		}
+	}
+
+	if totalWeight(healthy) > 0 {
+		backends = healthy
+	}
+
+	if exclude != "" {
+		var others []*routing.WeightedBackend
+		for _, b := range backends {
+			if b.Host != exclude {
+				others = append(others, b)
+			}
+		}
+
+		if totalWeight(others) > 0 {
+			backends = others
+		}
+	}
+
+	total := totalWeight(backends)
+	if total <= 0 {
+		return "", ""
+	}
+
+	b := pickWeightedBackend(backends, rand.Intn(total))
+	if b == nil {
+		return "", ""
+	}
+
+	return b.Scheme, b.Host
+}
@@ -0,0 +1,130 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/healthcheck"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPickWeightedBackend(t *testing.T) {
+	backends := []*routing.WeightedBackend{
+		{Weight: 2, Host: "a"},
+		{Weight: 0, Host: "b"},
+		{Weight: 1, Host: "c"}}
+
+	if w := totalWeight(backends); w != 3 {
+		t.Error("invalid total weight", w)
+	}
+
+	for n, expected := range []string{"a", "a", "c"} {
+		if b := pickWeightedBackend(backends, n); b == nil || b.Host != expected {
+			t.Error("invalid backend picked", n, b, expected)
+		}
+	}
+
+	if b := pickWeightedBackend(backends, 3); b != nil {
+		t.Error("failed to fail", b)
+	}
+}
+
+func TestSplitBackend(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+
+	stable := backend("stable")
+	defer stable.Close()
+	canary := backend("canary")
+	defer canary.Close()
+	disabled := backend("disabled")
+	defer disabled.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(
+		`split: Any() -> <split 1 "%s", 1 "%s", 0 "%s">`,
+		stable.URL, canary.URL, disabled.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			PollTimeout: sourcePollTimeout,
+			DataClients: []routing.DataClient{dc}})})
+
+	delay()
+
+	counts := make(map[string]int)
+	for i := 0; i < 120; i++ {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatal("failed to forward the request", w.Code)
+		}
+
+		counts[w.Body.String()]++
+	}
+
+	if counts["stable"] == 0 || counts["canary"] == 0 || counts["disabled"] != 0 {
+		t.Error("invalid distribution of the requests", counts)
+	}
+}
+
+func TestSplitBackendSkipsDown(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer healthy.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	hu, _ := url.Parse(healthy.URL)
+	du, _ := url.Parse(down.URL)
+	rt := &routing.Route{WeightedBackends: []*routing.WeightedBackend{
+		{Weight: 1, Scheme: "http", Host: hu.Host},
+		{Weight: 1, Scheme: "http", Host: du.Host}}}
+
+	hc := healthcheck.New(healthcheck.Options{
+		Path:               "/health",
+		Interval:           3 * time.Millisecond,
+		UnhealthyThreshold: 1})
+	defer hc.Close()
+
+	for i := 0; i < 60 && hc.Healthy(healthcheck.Target{Backend: down.URL}); i++ {
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	for i := 0; i < 30; i++ {
+		if _, host := splitBackendAddress(rt, "", hc); host != hu.Host {
+			t.Fatal("backend marked down selected", host)
+		}
+	}
+
+	// when all the backends are down, they are all used
+	rt.WeightedBackends = rt.WeightedBackends[1:]
+	if _, host := splitBackendAddress(rt, "", hc); host != du.Host {
+		t.Error("failed to select a backend marked down, when all are down", host)
+	}
+}
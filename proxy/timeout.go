@@ -0,0 +1,219 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"github.com/zalando/skipper/filters"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Passed to the error handler when the backend request timed out, while
+// dialing, waiting for the response headers, or when the total timeout
+// of the request expired.
+var ErrBackendTimeout = errors.New("backend timeout")
+
+// Passed to the error handler when the request or the response filters
+// of a route exceeded the time budget of their phase.
+var ErrFilterTimeout = errors.New("filter timeout")
+
+// the deadline of a processing phase of a request, implementing
+// filters.Context
+type phaseContext struct {
+	deadline time.Time
+	done     chan struct{}
+	timer    *time.Timer
+}
+
+// starts a phase with a time budget. It returns nil, when the budget is
+// not set.
+func startPhase(budget time.Duration) *phaseContext {
+	if budget <= 0 {
+		return nil
+	}
+
+	pc := &phaseContext{deadline: time.Now().Add(budget), done: make(chan struct{})}
+	pc.timer = time.AfterFunc(budget, func() { close(pc.done) })
+	return pc
+}
+
+func (pc *phaseContext) Deadline() (time.Time, bool) { return pc.deadline, true }
+func (pc *phaseContext) Done() <-chan struct{}       { return pc.done }
+
+func (pc *phaseContext) Err() error {
+	select {
+	case <-pc.done:
+		return filters.ErrDeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+func (pc *phaseContext) expired() bool {
+	return pc != nil && pc.Err() != nil
+}
+
+func (pc *phaseContext) stop() {
+	if pc == nil {
+		return
+	}
+
+	pc.timer.Stop()
+}
+
+// the cancel channel of a backend request, that can be closed by
+// both the drainer and the total timeout
+type cancelSignal struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+func newCancelSignal() *cancelSignal {
+	return &cancelSignal{c: make(chan struct{})}
+}
+
+func (s *cancelSignal) cancel() {
+	s.once.Do(func() { close(s.c) })
+}
+
+// the response body of a request with a total timeout. The timer is
+// stopped when the body is closed.
+type timeoutBody struct {
+	io.ReadCloser
+	timer   *time.Timer
+	expired *int32
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && atomic.LoadInt32(b.expired) == 1 {
+		err = ErrBackendTimeout
+	}
+
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
+
+func isTimeout(err error) bool {
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+// returns the timeouts of the proxy, overridden by the ones set by the
+// filters
+func (p *proxy) backendTimeouts(c *filterContext) filters.BackendTimeouts {
+	t := p.timeouts
+	rt, ok := c.stateBag[filters.BackendTimeoutsKey].(filters.BackendTimeouts)
+	if !ok {
+		return t
+	}
+
+	if rt.Dial > 0 {
+		t.Dial = rt.Dial
+	}
+
+	if rt.ResponseHeader > 0 {
+		t.ResponseHeader = rt.ResponseHeader
+	}
+
+	if rt.Total > 0 {
+		t.Total = rt.Total
+	}
+
+	return t
+}
+
+// limits the total timeout of a backend request to the remaining budget
+// of the backend phase. It returns false, when the budget has expired.
+func limitToPhase(total time.Duration, pc *phaseContext) (time.Duration, bool) {
+	if pc == nil {
+		return total, true
+	}
+
+	remaining := pc.deadline.Sub(time.Now())
+	if remaining <= 0 {
+		return 0, false
+	}
+
+	if total <= 0 || remaining < total {
+		total = remaining
+	}
+
+	return total, true
+}
+
+// executes the backend request with the transport, canceling it when
+// the total timeout expires, or when the drainer cancels it. The
+// timeouts are reported as ErrBackendTimeout.
+func (p *proxy) transportRoundtrip(tr http.RoundTripper, rr *http.Request, total time.Duration) (*http.Response, error) {
+	var (
+		cancel  *cancelSignal
+		timer   *time.Timer
+		expired int32
+	)
+
+	if p.drainer != nil || total > 0 {
+		cancel = newCancelSignal()
+		rr.Cancel = cancel.c
+	}
+
+	if p.drainer != nil {
+		p.drainer.track(rr, cancel)
+	}
+
+	if total > 0 {
+		timer = time.AfterFunc(total, func() {
+			atomic.StoreInt32(&expired, 1)
+			cancel.cancel()
+		})
+	}
+
+	rs, err := tr.RoundTrip(rr)
+	if err != nil {
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if p.drainer != nil {
+			p.drainer.release(rr)
+		}
+
+		if atomic.LoadInt32(&expired) == 1 || isTimeout(err) {
+			err = ErrBackendTimeout
+		}
+
+		return nil, err
+	}
+
+	if timer != nil {
+		// the upgraded connections are not limited by the timeout
+		if rs.StatusCode == http.StatusSwitchingProtocols {
+			timer.Stop()
+		} else {
+			rs.Body = &timeoutBody{ReadCloser: rs.Body, timer: timer, expired: &expired}
+		}
+	}
+
+	return rs, nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// filter waiting in the request or the response phase, until the
+// deadline of the phase expires, or at most for a second
+type waitFilter struct {
+	response bool
+	canceled int32
+}
+
+func (f *waitFilter) Name() string { return "wait" }
+
+func (f *waitFilter) CreateFilter([]interface{}) (filters.Filter, error) { return f, nil }
+
+func (f *waitFilter) wait(ctx filters.FilterContext) {
+	select {
+	case <-ctx.Context().Done():
+		atomic.StoreInt32(&f.canceled, 1)
+	case <-time.After(time.Second):
+	}
+}
+
+func (f *waitFilter) Request(ctx filters.FilterContext) {
+	if !f.response {
+		f.wait(ctx)
+	}
+}
+
+func (f *waitFilter) Response(ctx filters.FilterContext) {
+	if f.response {
+		f.wait(ctx)
+	}
+}
+
+func phaseTimeoutsProxy(t *testing.T, route string, timeouts filters.PhaseTimeouts, wf *waitFilter, backend http.Handler) (http.Handler, *error) {
+	s := httptest.NewServer(backend)
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`Path("/") -> %s -> "%s"`, route, s.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(wf)
+
+	handledErr := new(error)
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: fr,
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		PhaseTimeouts: timeouts,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error, _ *routing.Route) {
+			*handledErr = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}})
+
+	delay()
+	return p, handledErr
+}
+
+func TestBackendTimeoutsOverride(t *testing.T) {
+	p := &proxy{timeouts: filters.BackendTimeouts{Dial: time.Second, Total: time.Second}}
+	c := &filterContext{stateBag: map[string]interface{}{
+		filters.BackendTimeoutsKey: filters.BackendTimeouts{ResponseHeader: time.Minute, Total: time.Minute}}}
+	if to := p.backendTimeouts(c); to != (filters.BackendTimeouts{
+		Dial:           time.Second,
+		ResponseHeader: time.Minute,
+		Total:          time.Minute}) {
+		t.Error("failed to override the timeouts", to)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	p, handledErr := bodyLimitProxy(t, `responseHeaderTimeout("30ms")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(120 * time.Millisecond)
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	p.ServeHTTP(httptest.NewRecorder(), r)
+	if *handledErr != ErrBackendTimeout {
+		t.Error("failed to time out", *handledErr)
+	}
+}
+
+func TestBackendTimeout(t *testing.T) {
+	p, handledErr := bodyLimitProxy(t, `backendTimeout("30ms")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(120 * time.Millisecond)
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	p.ServeHTTP(httptest.NewRecorder(), r)
+	if *handledErr != ErrBackendTimeout {
+		t.Error("failed to time out", *handledErr)
+	}
+}
+
+func TestBackendTimeoutAbortsBody(t *testing.T) {
+	p, _ := bodyLimitProxy(t, `backendTimeout("60ms")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+		w.(http.Flusher).Flush()
+		time.Sleep(240 * time.Millisecond)
+		w.Write([]byte("bar"))
+	}))
+
+	s := httptest.NewServer(p)
+	defer s.Close()
+
+	rs, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	b, _ := ioutil.ReadAll(rs.Body)
+	if rs.StatusCode != http.StatusOK || string(b) != "foo" {
+		t.Error("failed to abort the response body", rs.StatusCode, string(b))
+	}
+}
+
+func TestBackendTimeoutNotExpired(t *testing.T) {
+	p, handledErr := bodyLimitProxy(t, `backendTimeout("1s")`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if *handledErr != nil || w.Code != http.StatusOK || w.Body.String() != "foo" {
+		t.Error("failed to forward the request", *handledErr, w.Code)
+	}
+}
+
+func TestLimitToPhase(t *testing.T) {
+	if total, ok := limitToPhase(time.Second, nil); !ok || total != time.Second {
+		t.Error("failed to keep the total timeout", total, ok)
+	}
+
+	pc := startPhase(time.Minute)
+	defer pc.stop()
+	if total, ok := limitToPhase(0, pc); !ok || total <= 0 || total > time.Minute {
+		t.Error("failed to use the remaining budget", total, ok)
+	}
+
+	if total, ok := limitToPhase(time.Second, pc); !ok || total != time.Second {
+		t.Error("failed to keep the shorter total timeout", total, ok)
+	}
+
+	pc.deadline = time.Now().Add(-time.Millisecond)
+	if _, ok := limitToPhase(time.Second, pc); ok {
+		t.Error("failed to detect the expired budget")
+	}
+}
+
+func TestPhaseContext(t *testing.T) {
+	if startPhase(0) != nil {
+		t.Error("unexpected phase without budget")
+	}
+
+	c := &filterContext{}
+	if _, ok := c.Context().Deadline(); ok || c.Context().Done() != nil || c.Context().Err() != nil {
+		t.Error("unexpected deadline")
+	}
+
+	c.phase = startPhase(30 * time.Millisecond)
+	if d, ok := c.Context().Deadline(); !ok || d.IsZero() || c.Context().Err() != nil {
+		t.Error("failed to set the deadline")
+	}
+
+	select {
+	case <-c.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("failed to expire the phase")
+	}
+
+	if c.Context().Err() != filters.ErrDeadlineExceeded || !c.phase.expired() {
+		t.Error("invalid error", c.Context().Err())
+	}
+}
+
+func TestRequestFiltersTimeout(t *testing.T) {
+	var backendCalled int32
+	wf := &waitFilter{}
+	p, handledErr := phaseTimeoutsProxy(t, `wait() -> requestHeader("X-Test", "foo")`,
+		filters.PhaseTimeouts{RequestFilters: 30 * time.Millisecond},
+		wf,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.StoreInt32(&backendCalled, 1)
+		}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if *handledErr != ErrFilterTimeout || w.Code != http.StatusServiceUnavailable {
+		t.Error("failed to time out", *handledErr, w.Code)
+	}
+
+	if atomic.LoadInt32(&wf.canceled) != 1 {
+		t.Error("failed to cancel the filter")
+	}
+
+	if r.Header.Get("X-Test") != "" {
+		t.Error("failed to skip the rest of the filters")
+	}
+
+	if atomic.LoadInt32(&backendCalled) != 0 {
+		t.Error("unexpected backend request")
+	}
+}
+
+func TestResponseFiltersTimeout(t *testing.T) {
+	wf := &waitFilter{response: true}
+	p, handledErr := phaseTimeoutsProxy(t, `wait()`,
+		filters.PhaseTimeouts{ResponseFilters: 30 * time.Millisecond},
+		wf,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("foo"))
+		}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if *handledErr != ErrFilterTimeout || w.Code != http.StatusServiceUnavailable {
+		t.Error("failed to time out", *handledErr, w.Code)
+	}
+
+	if atomic.LoadInt32(&wf.canceled) != 1 {
+		t.Error("failed to cancel the filter")
+	}
+}
+
+func TestBackendPhaseTimeout(t *testing.T) {
+	p, handledErr := phaseTimeoutsProxy(t, `backendTimeout("1s")`,
+		filters.PhaseTimeouts{Backend: 30 * time.Millisecond},
+		&waitFilter{},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(120 * time.Millisecond)
+		}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	p.ServeHTTP(httptest.NewRecorder(), r)
+	if *handledErr != ErrBackendTimeout {
+		t.Error("failed to time out", *handledErr)
+	}
+}
+
+func TestPhaseTimeoutsNotExpired(t *testing.T) {
+	p, handledErr := phaseTimeoutsProxy(t, `responseHeader("X-Test", "foo")`,
+		filters.PhaseTimeouts{
+			RequestFilters:  time.Second,
+			Backend:         time.Second,
+			ResponseFilters: time.Second},
+		&waitFilter{},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("foo"))
+		}))
+
+	r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if *handledErr != nil || w.Code != http.StatusOK || w.Body.String() != "foo" || w.Header().Get("X-Test") != "foo" {
+		t.Error("failed to forward the request", *handledErr, w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"crypto/tls"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// identifies the transports with custom settings
+type transportKey struct {
+	socketOptions         filters.SocketOptions
+	hasSocketOptions      bool
+	serverName            string
+	dialTimeout           time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+// Settings of the pooled backend connections, applied to all the
+// backend transports.
+type ConnectionPool struct {
+
+	// The maximum number of the idle connections kept per backend
+	// host. Defaults to http.DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+
+	// The time after which the idle connections are closed. Zero means
+	// no limit.
+	IdleConnTimeout time.Duration
+
+	// The period of the TCP keep-alive probes of the backend
+	// connections. Zero means the default of the system, negative
+	// values disable the TCP keep-alives.
+	KeepAlive time.Duration
+
+	// When set, the backend connections are not reused, every request
+	// opens a new connection.
+	DisableKeepAlives bool
+}
+
+// the backend transports, one for each set of socket options, TLS
+// server name and timeouts, so that connections with different settings
+// are not shared. The HTTP/2 transports are kept separately.
+type transports struct {
+	insecure       bool
+	connections    *limiter
+	timeouts       filters.BackendTimeouts
+	pool           ConnectionPool
+	base           *http.Transport
+	mx             sync.Mutex
+	byOptions      map[transportKey]*http.Transport
+	http2ByOptions map[http2Key]*http2.Transport
+}
+
+func newTransport(insecure bool, serverName string, pool ConnectionPool) *http.Transport {
+	tr := &http.Transport{
+		MaxIdleConnsPerHost: pool.MaxIdleConnsPerHost,
+		IdleConnTimeout:     pool.IdleConnTimeout,
+		DisableKeepAlives:   pool.DisableKeepAlives}
+	if insecure || serverName != "" {
+		tr.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: insecure,
+			ServerName:         serverName}
+	}
+
+	return tr
+}
+
+// creates the backend transports. When the connections limiter is set,
+// the number of the open backend connections is capped across all the
+// transports. The dial and the response header timeouts are the
+// defaults of the transports, while the connection pool settings apply
+// to all of them.
+func newTransports(insecure bool, connections *limiter, timeouts filters.BackendTimeouts, pool ConnectionPool) *transports {
+	t := &transports{
+		insecure:       insecure,
+		connections:    connections,
+		timeouts:       timeouts,
+		pool:           pool,
+		base:           newTransport(insecure, "", pool),
+		byOptions:      make(map[transportKey]*http.Transport),
+		http2ByOptions: make(map[http2Key]*http2.Transport)}
+	t.base.Dial = t.dial(nil, timeouts.Dial)
+	t.base.ResponseHeaderTimeout = timeouts.ResponseHeader
+	return t
+}
+
+// sets the socket options on a new connection
+func applySocketOptions(conn net.Conn, o filters.SocketOptions) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if err := tcp.SetNoDelay(!o.DisableNoDelay); err != nil {
+		return err
+	}
+
+	if o.DSCP == 0 {
+		return nil
+	}
+
+	ipv6 := false
+	if a, ok := tcp.RemoteAddr().(*net.TCPAddr); ok {
+		ipv6 = a.IP.To4() == nil
+	}
+
+	return setTrafficClass(tcp, o.DSCP<<2, ipv6)
+}
+
+func dialWithOptions(o filters.SocketOptions, d *net.Dialer) func(string, string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := d.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := applySocketOptions(conn, o); err != nil {
+			log.Errorf("failed to set socket options on connection to %s: %v", address, err)
+		}
+
+		return conn, nil
+	}
+}
+
+// returns the dial function for a set of socket options and a dial
+// timeout, or nil, when the default one of the transport can be used
+func (t *transports) dial(o *filters.SocketOptions, timeout time.Duration) func(string, string) (net.Conn, error) {
+	var d func(string, string) (net.Conn, error)
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: t.pool.KeepAlive}
+	if o != nil {
+		d = dialWithOptions(*o, dialer)
+	} else if timeout > 0 || t.pool.KeepAlive != 0 || t.connections != nil {
+		d = dialer.Dial
+	}
+
+	if d == nil {
+		return nil
+	}
+
+	return t.connections.dial(d, t.CloseIdleConnections)
+}
+
+// returns the transport for a set of socket options, a TLS server name
+// and the dial and response header timeouts, or the default one when
+// neither differs from the defaults
+func (t *transports) get(o *filters.SocketOptions, serverName string, timeouts filters.BackendTimeouts) *http.Transport {
+	if o == nil && serverName == "" &&
+		timeouts.Dial == t.timeouts.Dial &&
+		timeouts.ResponseHeader == t.timeouts.ResponseHeader {
+		return t.base
+	}
+
+	key := transportKey{
+		serverName:            serverName,
+		dialTimeout:           timeouts.Dial,
+		responseHeaderTimeout: timeouts.ResponseHeader}
+	if o != nil {
+		key.socketOptions, key.hasSocketOptions = *o, true
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	tr, ok := t.byOptions[key]
+	if !ok {
+		tr = newTransport(t.insecure, serverName, t.pool)
+		tr.Dial = t.dial(o, timeouts.Dial)
+		tr.ResponseHeaderTimeout = timeouts.ResponseHeader
+
+		t.byOptions[key] = tr
+	}
+
+	return tr
+}
+
+func (t *transports) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	for _, tr := range t.byOptions {
+		tr.CloseIdleConnections()
+	}
+
+	for _, tr := range t.http2ByOptions {
+		tr.CloseIdleConnections()
+	}
+}
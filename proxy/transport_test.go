@@ -0,0 +1,99 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var noTimeouts filters.BackendTimeouts
+
+func TestTransportsBySocketOptions(t *testing.T) {
+	tr := newTransports(false, nil, noTimeouts, ConnectionPool{})
+	if tr.get(nil, "", noTimeouts) != tr.base {
+		t.Error("failed to use the default transport")
+	}
+
+	o1 := filters.SocketOptions{DSCP: 46}
+	o2 := filters.SocketOptions{DSCP: 46, DisableNoDelay: true}
+	if tr.get(&o1, "", noTimeouts) == tr.base || tr.get(&o1, "", noTimeouts) != tr.get(&filters.SocketOptions{DSCP: 46}, "", noTimeouts) {
+		t.Error("failed to reuse the transport for the same options")
+	}
+
+	if tr.get(&o1, "", noTimeouts) == tr.get(&o2, "", noTimeouts) {
+		t.Error("failed to separate the transports for different options")
+	}
+}
+
+func TestTransportsByServerName(t *testing.T) {
+	tr := newTransports(true, nil, noTimeouts, ConnectionPool{})
+	t1 := tr.get(nil, "www.example.org", noTimeouts)
+	if t1 == tr.base || t1 != tr.get(nil, "www.example.org", noTimeouts) {
+		t.Error("failed to reuse the transport for the same server name")
+	}
+
+	if t1.TLSClientConfig == nil ||
+		t1.TLSClientConfig.ServerName != "www.example.org" ||
+		!t1.TLSClientConfig.InsecureSkipVerify {
+		t.Error("failed to set the TLS config")
+	}
+
+	o := filters.SocketOptions{DSCP: 46}
+	if t1 == tr.get(nil, "api.example.org", noTimeouts) || tr.get(&o, "", noTimeouts) == tr.get(&o, "www.example.org", noTimeouts) {
+		t.Error("failed to separate the transports for different server names")
+	}
+}
+
+func TestTransportsByTimeouts(t *testing.T) {
+	defaults := filters.BackendTimeouts{Dial: time.Second, ResponseHeader: time.Second}
+	tr := newTransports(false, nil, defaults, ConnectionPool{})
+	if tr.base.ResponseHeaderTimeout != time.Second || tr.base.Dial == nil {
+		t.Error("failed to set the default timeouts")
+	}
+
+	if tr.get(nil, "", filters.BackendTimeouts{Dial: time.Second, ResponseHeader: time.Second, Total: time.Minute}) != tr.base {
+		t.Error("failed to use the default transport")
+	}
+
+	t1 := tr.get(nil, "", filters.BackendTimeouts{Dial: time.Second, ResponseHeader: time.Minute})
+	if t1 == tr.base || t1 != tr.get(nil, "", filters.BackendTimeouts{Dial: time.Second, ResponseHeader: time.Minute}) {
+		t.Error("failed to reuse the transport for the same timeouts")
+	}
+
+	if t1.ResponseHeaderTimeout != time.Minute {
+		t.Error("failed to set the response header timeout")
+	}
+
+	if t1 == tr.get(nil, "", filters.BackendTimeouts{Dial: time.Minute, ResponseHeader: time.Minute}) {
+		t.Error("failed to separate the transports for different timeouts")
+	}
+}
+
+func TestTransportsConnectionPool(t *testing.T) {
+	pool := ConnectionPool{MaxIdleConnsPerHost: 64, IdleConnTimeout: time.Minute, KeepAlive: 15 * time.Second}
+	tr := newTransports(false, nil, noTimeouts, pool)
+	for _, ti := range []*http.Transport{tr.base, tr.get(nil, "www.example.org", noTimeouts)} {
+		if ti.MaxIdleConnsPerHost != 64 || ti.IdleConnTimeout != time.Minute || ti.DisableKeepAlives {
+			t.Error("failed to apply the connection pool settings")
+		}
+
+		if ti.Dial == nil {
+			t.Error("failed to set the dialer with the keep-alive period")
+		}
+	}
+}
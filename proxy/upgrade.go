@@ -0,0 +1,418 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Error passed to the error handler, when an upgrade request is
+	// rejected, because the route reached the cap of its upgraded
+	// connections.
+	ErrUpgradedConnectionsLimit = errors.New("upgraded connections limit reached")
+
+	// Error passed to the error handler, when the backend accepted an
+	// upgrade request, but the client connection can't be taken over,
+	// because the response writer doesn't support hijacking.
+	ErrUpgradeNotSupported = errors.New("upgrade not supported by the response writer")
+)
+
+// counts the active upgraded connections per route
+type upgrades struct {
+	mx     sync.Mutex
+	active map[string]int
+}
+
+// an upgraded connection, or an upgrade in progress
+type upgrade struct {
+	upgrades *upgrades
+	protocol string
+	routeId  string
+	remote   string
+	start    time.Time
+}
+
+// an upgraded backend connection, returned as the body of the 101
+// Switching Protocols response. The reader holds the data that the
+// backend sent right after the response headers.
+type upgradedBody struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	err    error
+}
+
+// the body of a response to an upgrade request, that the backend didn't
+// accept. Closing it closes the dedicated backend connection.
+type upgradeResponseBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+// tracks the last activity of an upgraded connection in both
+// directions, for the idle timeout
+type tunnel struct {
+	idleTimeout time.Duration
+	lastActive  int64
+	idle        int32
+}
+
+// a writer that doesn't need flushing, used to limit the bandwidth of
+// the upgraded connections
+type noFlush struct {
+	io.Writer
+}
+
+// returns the protocol requested by an upgrade request, e.g. websocket
+// or h2c, or an empty string, when the request is not an upgrade
+// request
+func upgradeProtocol(r *http.Request) string {
+	var upgrade bool
+	for _, c := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(c), "upgrade") {
+			upgrade = true
+			break
+		}
+	}
+
+	if !upgrade {
+		return ""
+	}
+
+	p := strings.Split(r.Header.Get("Upgrade"), ",")[0]
+	p = strings.ToLower(strings.TrimSpace(p))
+	if i := strings.Index(p, "/"); i >= 0 {
+		p = p[:i]
+	}
+
+	return p
+}
+
+func newUpgrades() *upgrades {
+	return &upgrades{active: make(map[string]int)}
+}
+
+// starts tracking an upgrade request, or, when the route reached the cap
+// set by the filters, counts the rejection and returns nil
+func (u *upgrades) start(c *filterContext, rt *routing.Route, protocol string) *upgrade {
+	limits, _ := c.stateBag[filters.UpgradeLimitsKey].(filters.UpgradeLimits)
+
+	u.mx.Lock()
+	active := u.active[rt.Id]
+	if limits.MaxConnections > 0 && active >= limits.MaxConnections {
+		u.mx.Unlock()
+		metrics.IncUpgradeRejected(rt.Id)
+		return nil
+	}
+
+	active++
+	u.active[rt.Id] = active
+	metrics.UpdateUpgradesActive(rt.Id, int64(active))
+	u.mx.Unlock()
+
+	return &upgrade{
+		upgrades: u,
+		protocol: protocol,
+		routeId:  rt.Id,
+		remote:   c.req.RemoteAddr,
+		start:    time.Now()}
+}
+
+// stops tracking an upgrade request. When the backend accepted the
+// upgrade, the duration of the connection is measured, and the
+// connection is logged for auditing.
+func (up *upgrade) finish(rs *http.Response) {
+	u := up.upgrades
+	u.mx.Lock()
+	active := u.active[up.routeId] - 1
+	if active > 0 {
+		u.active[up.routeId] = active
+	} else {
+		delete(u.active, up.routeId)
+	}
+
+	metrics.UpdateUpgradesActive(up.routeId, int64(active))
+	u.mx.Unlock()
+
+	if rs == nil || rs.StatusCode != http.StatusSwitchingProtocols {
+		return
+	}
+
+	d := time.Since(up.start)
+	metrics.MeasureUpgrade(up.protocol, up.routeId, d)
+	log.Infof(
+		"upgraded connection closed, protocol: %s, route: %s, remote address: %s, duration: %v",
+		up.protocol, up.routeId, up.remote, d)
+}
+
+func (b *upgradedBody) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// closes the connection only once, because both the proxy and the
+// tunnel close it
+func (b *upgradedBody) Close() error {
+	b.once.Do(func() { b.err = b.Conn.Close() })
+	return b.err
+}
+
+func (b *upgradeResponseBody) Close() error {
+	err := b.ReadCloser.Close()
+	if cerr := b.conn.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (noFlush) Flush() {}
+
+// dials the backend of an upgrade request, with the socket options, the
+// TLS server name and the dial timeout of the route
+func (p *proxy) dialUpgrade(c *filterContext, scheme, host string, timeout time.Duration) (net.Conn, error) {
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := "80"
+		if scheme == "https" {
+			port = "443"
+		}
+
+		address = net.JoinHostPort(host, port)
+	}
+
+	var so *filters.SocketOptions
+	if o, ok := c.stateBag[filters.SocketOptionsKey].(filters.SocketOptions); ok {
+		so = &o
+	}
+
+	dial := p.transports.dial(so, timeout)
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	conn, err := dial("tcp", address)
+	if err != nil || scheme != "https" {
+		return conn, err
+	}
+
+	serverName, _ := c.stateBag[filters.TlsServerNameKey].(string)
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(address)
+	}
+
+	tc := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: p.transports.insecure})
+	if timeout > 0 {
+		tc.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := tc.Handshake(); err != nil {
+		tc.Close()
+		return nil, err
+	}
+
+	tc.SetDeadline(time.Time{})
+	return tc, nil
+}
+
+// sends an upgrade request to the backend on a dedicated connection,
+// because the pooled connections of the transports can't be taken over.
+// When the backend accepts the upgrade, the body of the response is the
+// upgraded connection, an *upgradedBody. The response header timeout
+// applies to sending the request and receiving the response headers.
+func (p *proxy) upgradeRoundtrip(c *filterContext, rt *routing.Route) (*http.Response, error) {
+	scheme, host := backendAddress(c, rt, "", p.healthChecks)
+	if rt.Dynamic && (scheme == "" || host == "") {
+		return nil, ErrDynamicBackendNotSet
+	}
+
+	// the upgrades are always requested over HTTP/1.1
+	scheme, _ = backendProtocol(c, scheme)
+	rr, err := mapRequest(c.req, scheme, host)
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts := p.backendTimeouts(c)
+	conn, err := p.dialUpgrade(c, scheme, host, timeouts.Dial)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeouts.ResponseHeader > 0 {
+		conn.SetDeadline(time.Now().Add(timeouts.ResponseHeader))
+	}
+
+	var rs *http.Response
+	reader := bufio.NewReader(conn)
+	if err = rr.Write(conn); err == nil {
+		rs, err = http.ReadResponse(reader, rr)
+	}
+
+	if err != nil {
+		conn.Close()
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, ErrBackendTimeout
+		}
+
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	if rs.StatusCode == http.StatusSwitchingProtocols {
+		rs.Body = &upgradedBody{Conn: conn, reader: reader}
+	} else {
+		rs.Body = &upgradeResponseBody{ReadCloser: rs.Body, conn: conn}
+	}
+
+	return rs, nil
+}
+
+func newTunnel(idleTimeout time.Duration) *tunnel {
+	return &tunnel{idleTimeout: idleTimeout, lastActive: time.Now().UnixNano()}
+}
+
+func (t *tunnel) lastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&t.lastActive))
+}
+
+// copies one direction of an upgraded connection, until either side
+// closes it, or no data was sent in either direction during the idle
+// timeout. It returns the number of the copied bytes.
+func (t *tunnel) copy(to io.Writer, from io.Reader, conn net.Conn) int64 {
+	var written int64
+	buf := make([]byte, proxyBufferSize)
+	for {
+		if t.idleTimeout > 0 {
+			conn.SetReadDeadline(t.lastActivity().Add(t.idleTimeout))
+		}
+
+		n, err := from.Read(buf)
+		if n > 0 {
+			atomic.StoreInt64(&t.lastActive, time.Now().UnixNano())
+			w, werr := to.Write(buf[:n])
+			written += int64(w)
+			if werr != nil {
+				return written
+			}
+		}
+
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() && t.idleTimeout > 0 {
+			// the other direction may have been active meanwhile
+			if time.Since(t.lastActivity()) < t.idleTimeout {
+				continue
+			}
+
+			atomic.StoreInt32(&t.idle, 1)
+			return written
+		}
+
+		if err != nil {
+			return written
+		}
+	}
+}
+
+// wraps one direction of an upgraded connection, when its bandwidth is
+// limited
+func limitUpgradeBandwidth(to io.Writer, rate int64) io.Writer {
+	if rate <= 0 {
+		return to
+	}
+
+	b := newBandwidthBucket(rate)
+	b.addStream(1)
+	return &bandwidthStream{to: noFlush{to}, buckets: []*bandwidthBucket{b}}
+}
+
+// takes over the client connection, after the backend accepted the
+// upgrade, forwards the 101 response, and copies the data between the
+// client and the backend in both directions, until either side closes
+// its connection, the idle timeout expires, or the lifetime limit of
+// the route is reached
+func (p *proxy) serveUpgraded(w http.ResponseWriter, c *filterContext, rt *routing.Route, rs *http.Response, backend *upgradedBody) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		p.serveError(w, c.req, ErrUpgradeNotSupported, rt, http.StatusBadGateway)
+		return
+	}
+
+	conn, brw, err := h.Hijack()
+	if err != nil {
+		log.Errorf("failed to take over the client connection of an upgrade, route: %s, %v", rt.Id, err)
+		p.serveError(w, c.req, ErrUpgradeNotSupported, rt, http.StatusBadGateway)
+		return
+	}
+
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			conn.Close()
+			backend.Close()
+		})
+	}
+
+	defer closeBoth()
+
+	// the deadlines of the server don't apply to the upgraded
+	// connection
+	conn.SetDeadline(time.Time{})
+	fmt.Fprintf(brw, "HTTP/1.1 %03d %s\r\n", rs.StatusCode, http.StatusText(rs.StatusCode))
+	rs.Header.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		log.Errorf("failed to send the upgrade response, route: %s, %v", rt.Id, err)
+		return
+	}
+
+	limits, _ := c.stateBag[filters.UpgradeLimitsKey].(filters.UpgradeLimits)
+	if limits.MaxLifetime > 0 {
+		timer := time.AfterFunc(limits.MaxLifetime, closeBoth)
+		defer timer.Stop()
+	}
+
+	t := newTunnel(p.upgradeIdleTimeout)
+	clientSent := make(chan int64)
+	go func() {
+		n := t.copy(limitUpgradeBandwidth(backend, limits.MaxBandwidth), brw.Reader, conn)
+		closeBoth()
+		clientSent <- n
+	}()
+
+	backendSent := t.copy(limitUpgradeBandwidth(conn, limits.MaxBandwidth), backend, backend.Conn)
+	closeBoth()
+
+	metrics.MeasureUpgradeBytes(rt.Id, "client", <-clientSent)
+	metrics.MeasureUpgradeBytes(rt.Id, "backend", backendSent)
+	if atomic.LoadInt32(&t.idle) != 0 {
+		metrics.IncUpgradeIdleTimeout(rt.Id)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accepts the websocket upgrade requests, and echoes the data received
+// on the upgraded connections
+func echoUpgradeBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+}
+
+// starts a proxy with a single route to the backend, with the route
+// filters and the idle timeout of the upgraded connections
+func upgradeProxy(t *testing.T, backendUrl, filters string, idleTimeout time.Duration) *httptest.Server {
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`upgraded: Path("/") %s -> "%s"`, filters, backendUrl))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		UpgradeIdleTimeout: idleTimeout})
+
+	delay()
+	return httptest.NewServer(p)
+}
+
+// sends an upgrade request on a new connection, and returns the
+// connection and the status of the response
+func upgradeClient(t *testing.T, proxyUrl string) (net.Conn, *bufio.Reader, int) {
+	conn, err := net.Dial("tcp", proxyUrl[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: www.example.org\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	rs, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	return conn, reader, rs.StatusCode
+}
+
+func TestUpgradeProtocol(t *testing.T) {
+	for _, ti := range []struct {
+		connection string
+		upgrade    string
+		protocol   string
+	}{
+		{"", "", ""},
+		{"keep-alive", "websocket", ""},
+		{"Upgrade", "websocket", "websocket"},
+		{"keep-alive, upgrade", "WebSocket", "websocket"},
+		{"Upgrade, HTTP2-Settings", "h2c", "h2c"},
+		{"Upgrade", "TLS/1.2, HTTP/1.1", "tls"},
+	} {
+		r := &http.Request{Header: make(http.Header)}
+		r.Header.Set("Connection", ti.connection)
+		r.Header.Set("Upgrade", ti.upgrade)
+		if p := upgradeProtocol(r); p != ti.protocol {
+			t.Error("unexpected protocol", ti.connection, ti.upgrade, p)
+		}
+	}
+}
+
+func TestUpgradedConnectionsLimit(t *testing.T) {
+	backend, received, release := blockingBackend()
+	defer backend.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(
+		`upgraded: Path("/") -> websocketLimits("connections", 1) -> "%s"`,
+		backend.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handledErr error
+	p := WithParams(Params{
+		Routing: routing.New(routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PollTimeout:    sourcePollTimeout,
+			DataClients:    []routing.DataClient{dc}}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error, _ *routing.Route) {
+			handledErr = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}})
+
+	delay()
+
+	request := func(upgrade bool) int {
+		r, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+		if upgrade {
+			r.Header.Set("Connection", "Upgrade")
+			r.Header.Set("Upgrade", "websocket")
+		}
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- request(true) }()
+	<-received
+
+	if code := request(true); code != http.StatusServiceUnavailable || handledErr != ErrUpgradedConnectionsLimit {
+		t.Error("failed to reject the upgrade request", code, handledErr)
+	}
+
+	go func() { done <- request(false) }()
+	<-received
+
+	release()
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Error("failed to proxy the request", code)
+		}
+	}
+
+	if code := request(true); code != http.StatusOK {
+		t.Error("failed to release the upgraded connection", code)
+	}
+
+	if len(p.(*proxy).upgrades.active) != 0 {
+		t.Error("failed to clean up the active connections")
+	}
+}
+
+func TestUpgradeTunnel(t *testing.T) {
+	backend := echoUpgradeBackend()
+	defer backend.Close()
+
+	ps := upgradeProxy(t, backend.URL, "", 0)
+	defer ps.Close()
+
+	conn, reader, status := upgradeClient(t, ps.URL)
+	defer conn.Close()
+
+	if status != http.StatusSwitchingProtocols {
+		t.Fatal("failed to upgrade the connection", status)
+	}
+
+	for _, msg := range []string{"Hello, world!\n", "Hello again!\n"} {
+		fmt.Fprint(conn, msg)
+		echo, err := reader.ReadString('\n')
+		if err != nil || echo != msg {
+			t.Error("failed to receive the echo", echo, err)
+		}
+	}
+}
+
+func TestUpgradeRejectedByBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer backend.Close()
+
+	ps := upgradeProxy(t, backend.URL, "", 0)
+	defer ps.Close()
+
+	conn, _, status := upgradeClient(t, ps.URL)
+	defer conn.Close()
+
+	if status != http.StatusForbidden {
+		t.Error("failed to forward the backend response", status)
+	}
+}
+
+func TestUpgradeIdleTimeout(t *testing.T) {
+	backend := echoUpgradeBackend()
+	defer backend.Close()
+
+	ps := upgradeProxy(t, backend.URL, "", 30*time.Millisecond)
+	defer ps.Close()
+
+	conn, reader, status := upgradeClient(t, ps.URL)
+	defer conn.Close()
+
+	if status != http.StatusSwitchingProtocols {
+		t.Fatal("failed to upgrade the connection", status)
+	}
+
+	fmt.Fprint(conn, "ping\n")
+	if echo, err := reader.ReadString('\n'); err != nil || echo != "ping\n" {
+		t.Fatal("failed to receive the echo", echo, err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Error("failed to close the idle connection", err)
+	}
+}
+
+func TestUpgradeMaxLifetime(t *testing.T) {
+	backend := echoUpgradeBackend()
+	defer backend.Close()
+
+	ps := upgradeProxy(t, backend.URL, `-> websocketLimits("lifetime", 30)`, 0)
+	defer ps.Close()
+
+	conn, reader, status := upgradeClient(t, ps.URL)
+	defer conn.Close()
+
+	if status != http.StatusSwitchingProtocols {
+		t.Fatal("failed to upgrade the connection", status)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Error("failed to close the connection after its lifetime", err)
+	}
+}
+
+func TestUpgradeMaxBandwidth(t *testing.T) {
+	backend := echoUpgradeBackend()
+	defer backend.Close()
+
+	ps := upgradeProxy(t, backend.URL, `-> websocketLimits("bandwidth", 1024)`, 0)
+	defer ps.Close()
+
+	conn, reader, status := upgradeClient(t, ps.URL)
+	defer conn.Close()
+
+	if status != http.StatusSwitchingProtocols {
+		t.Fatal("failed to upgrade the connection", status)
+	}
+
+	start := time.Now()
+	message := strings.Repeat("x", 2048) + "\n"
+	fmt.Fprint(conn, message)
+
+	conn.SetReadDeadline(time.Now().Add(6 * time.Second))
+	if echo, err := reader.ReadString('\n'); err != nil || echo != message {
+		t.Fatal("failed to receive the echo", len(echo), err)
+	}
+
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Error("failed to limit the bandwidth", d)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+type stageTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// tracks the stages of a request in the proxy, and reports them, when
+// the request exceeds the latency budget
+type watchdog struct {
+	mx         sync.Mutex
+	timer      *time.Timer
+	request    string
+	start      time.Time
+	routeId    string
+	stage      string
+	stageStart time.Time
+	timings    []stageTiming
+	profile    bool
+	report     func(string)
+}
+
+func warn(msg string) { log.Warn(msg) }
+
+// starts a watchdog for a request received at the start time. It
+// returns nil, when the threshold is not set.
+func newWatchdog(r *http.Request, start time.Time, threshold time.Duration, profile bool, report func(string)) *watchdog {
+	if threshold <= 0 {
+		return nil
+	}
+
+	wd := &watchdog{
+		request:    fmt.Sprintf("%s %s%s", r.Method, r.Host, r.URL.Path),
+		start:      start,
+		stage:      "route lookup",
+		stageStart: start,
+		profile:    profile,
+		report:     report}
+	wd.timer = time.AfterFunc(threshold-time.Since(start), wd.fire)
+	return wd
+}
+
+func (wd *watchdog) setRoute(id string) {
+	if wd == nil {
+		return
+	}
+
+	wd.mx.Lock()
+	defer wd.mx.Unlock()
+	wd.routeId = id
+}
+
+// closes the current stage of the request, and starts the next one
+func (wd *watchdog) enter(stage string) {
+	if wd == nil {
+		return
+	}
+
+	wd.mx.Lock()
+	defer wd.mx.Unlock()
+
+	now := time.Now()
+	wd.timings = append(wd.timings, stageTiming{wd.stage, now.Sub(wd.stageStart)})
+	wd.stage = stage
+	wd.stageStart = now
+}
+
+func (wd *watchdog) stop() {
+	if wd == nil {
+		return
+	}
+
+	wd.timer.Stop()
+}
+
+func (wd *watchdog) fire() {
+	wd.mx.Lock()
+	now := time.Now()
+	stages := make([]string, 0, len(wd.timings)+1)
+	for _, t := range wd.timings {
+		stages = append(stages, fmt.Sprintf("%s: %v", t.name, t.duration))
+	}
+
+	stages = append(stages, fmt.Sprintf("%s: %v (in progress)", wd.stage, now.Sub(wd.stageStart)))
+	msg := fmt.Sprintf(
+		"slow request: %s, route: %s, elapsed: %v, stages: %s",
+		wd.request, wd.routeId, now.Sub(wd.start), strings.Join(stages, ", "))
+	wd.mx.Unlock()
+
+	if wd.profile {
+		var b bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&b, 1)
+		msg += "\n" + b.String()
+	}
+
+	wd.report(msg)
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogDisabled(t *testing.T) {
+	r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+	wd := newWatchdog(r, time.Now(), 0, false, func(string) { t.Error("unexpected report") })
+	if wd != nil {
+		t.Error("failed to disable the watchdog")
+	}
+
+	wd.setRoute("hello")
+	wd.enter("backend")
+	wd.stop()
+}
+
+func TestWatchdogFastRequest(t *testing.T) {
+	r, _ := http.NewRequest("GET", "https://www.example.org/hello", nil)
+	reports := make(chan string, 1)
+	wd := newWatchdog(r, time.Now(), 30*time.Millisecond, false, func(msg string) { reports <- msg })
+	wd.setRoute("hello")
+	wd.enter("backend")
+	wd.stop()
+
+	select {
+	case msg := <-reports:
+		t.Error("unexpected report", msg)
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestWatchdogSlowRequest(t *testing.T) {
+	for _, profile := range []bool{false, true} {
+		r, _ := http.NewRequest("GET", "https://www.example.org/hello?secret=42", nil)
+		reports := make(chan string, 1)
+		wd := newWatchdog(r, time.Now(), 15*time.Millisecond, profile, func(msg string) { reports <- msg })
+		wd.setRoute("hello")
+		wd.enter("request filter requestHeader")
+		wd.enter("backend")
+
+		var msg string
+		select {
+		case msg = <-reports:
+		case <-time.After(120 * time.Millisecond):
+			t.Error("failed to report the slow request", profile)
+			continue
+		}
+
+		wd.stop()
+
+		for _, expected := range []string{
+			"GET www.example.org/hello,",
+			"route: hello",
+			"route lookup: ",
+			"request filter requestHeader: ",
+			"backend: ",
+			"(in progress)",
+		} {
+			if !strings.Contains(msg, expected) {
+				t.Error("missing from the report", expected, msg)
+			}
+		}
+
+		if strings.Contains(msg, "secret") {
+			t.Error("the query was reported", msg)
+		}
+
+		if strings.Contains(msg, "goroutine ") != profile {
+			t.Error("invalid goroutine profile", profile, msg)
+		}
+	}
+}
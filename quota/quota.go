@@ -0,0 +1,323 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package quota limits how many routes, and which filters, the tenants of
+a shared skipper cluster may contribute to the routing table.
+
+The tenant of a route is taken from one of its annotations, e.g.
+@team("checkout"), or, when the annotation is not set, from the prefix
+of the route id, e.g. checkout_cart for the separator "_". The routes
+exceeding the quota of their tenant, or using a filter not allowed for
+their tenant, are rejected, and the reason is logged:
+
+    checkout_cart: tenant checkout: route quota of 10 exceeded
+
+The quotas are enforced by wrapping the data clients. The routes are
+accepted in the order they are loaded, and the quota is shared by all
+the data clients wrapped with the same Policy.
+
+The filters of the when filter are checked, too, because it creates
+its inner filters from the route definition.
+
+Sandboxed Tenants
+
+The routes of untrusted tenants can be executed in a sandbox, by setting
+the sandbox limits of the tenant:
+
+    "tenants": {
+        "partner": {
+            "filters": ["setPath", "requestHeader", "responseHeader"],
+            "sandbox": {"filterTimeMs": 5, "bodyBytes": 65536}
+        }
+    }
+
+The routes of a sandboxed tenant may only use the allowed filters, and
+never the filters sending requests to other destinations than the
+backend of the route, listed in EgressFilters. The policy inserts the
+sandbox filter, see SandboxSpec, as the first filter of their routes,
+and the proxy limits the time that the filters of the tenant may spend
+on a request, and the number of bytes they may read from the request
+and the response bodies. When a request exceeds the limits, the route
+is quarantined: the violation is logged, and the route is removed from
+the routing table on the next update of its data client. It is not
+accepted again, until its definition is changed.
+*/
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// The limits of a tenant.
+type Limits struct {
+
+	// The maximum number of routes of the tenant. Zero means no limit.
+	MaxRoutes int `json:"maxRoutes"`
+
+	// The names of the filters that the routes of the tenant may use.
+	// When nil, every filter is allowed.
+	Filters []string `json:"filters"`
+
+	// When set, the routes of the tenant are sandboxed.
+	Sandbox *Sandbox `json:"sandbox"`
+}
+
+// Options of the quota policy.
+type Options struct {
+
+	// The name of the annotation holding the tenant of a route, e.g.
+	// "team".
+	TenantAnnotation string `json:"tenantAnnotation"`
+
+	// The separator between the tenant and the rest of the route id,
+	// used when the annotation is not set, e.g. "_".
+	TenantSeparator string `json:"tenantSeparator"`
+
+	// The limits of the tenants not listed in Tenants, including the
+	// routes without a tenant.
+	Default Limits `json:"default"`
+
+	// The limits of the individual tenants.
+	Tenants map[string]Limits `json:"tenants"`
+}
+
+// A Violation describes a route rejected by the policy.
+type Violation struct {
+	RouteId string
+	Tenant  string
+	Reason  string
+}
+
+// A Policy enforces the quotas on the routes of the data clients.
+type Policy struct {
+	options Options
+	mx      sync.Mutex
+
+	// the accepted route ids of every data client, with their tenants
+	accepted map[routing.DataClient]map[string]string
+
+	// the definitions of the accepted routes, by their ids
+	definitions map[string]string
+
+	// the quarantined routes, by their ids
+	quarantined map[string]*quarantine
+
+	// the ids of the quarantined routes to be deleted on the next
+	// update of their data clients
+	pending map[routing.DataClient][]string
+}
+
+// data client rejecting the routes of the wrapped client, that violate
+// the policy
+type client struct {
+	routing.DataClient
+	policy *Policy
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: tenant %s: %s", v.RouteId, v.Tenant, v.Reason)
+}
+
+// Reads the options from a JSON file, e.g.:
+//
+//     {
+//         "tenantAnnotation": "team",
+//         "tenantSeparator": "_",
+//         "default": {"maxRoutes": 10, "filters": ["setPath", "requestHeader"]},
+//         "tenants": {"checkout": {"maxRoutes": 100}}
+//     }
+func ReadOptions(path string) (Options, error) {
+	var o Options
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return o, err
+	}
+
+	err = json.Unmarshal(data, &o)
+	return o, err
+}
+
+// Creates a policy with the provided options.
+func New(o Options) *Policy {
+	return &Policy{
+		options:     o,
+		accepted:    make(map[routing.DataClient]map[string]string),
+		definitions: make(map[string]string),
+		quarantined: make(map[string]*quarantine),
+		pending:     make(map[routing.DataClient][]string)}
+}
+
+// Returns the tenant of a route, or an empty string.
+func (p *Policy) Tenant(r *eskip.Route) string {
+	if p.options.TenantAnnotation != "" {
+		if t, ok := r.Metadata[p.options.TenantAnnotation]; ok {
+			return t
+		}
+	}
+
+	if p.options.TenantSeparator != "" {
+		if i := strings.Index(r.Id, p.options.TenantSeparator); i > 0 {
+			return r.Id[:i]
+		}
+	}
+
+	return ""
+}
+
+func (p *Policy) limits(tenant string) Limits {
+	if l, ok := p.options.Tenants[tenant]; ok {
+		return l
+	}
+
+	return p.options.Default
+}
+
+// counts the accepted routes of a tenant, from all the data clients
+func (p *Policy) count(tenant string) int {
+	var n int
+	for _, ids := range p.accepted {
+		for _, t := range ids {
+			if t == tenant {
+				n++
+			}
+		}
+	}
+
+	return n
+}
+
+// checks a route that is not accepted yet
+func (p *Policy) check(r *eskip.Route) *Violation {
+	tenant := p.Tenant(r)
+	l := p.limits(tenant)
+	if q, ok := p.quarantined[r.Id]; ok {
+		if q.definition == r.String() {
+			return &Violation{r.Id, tenant, fmt.Sprintf("quarantined: %s", q.reason)}
+		}
+
+		delete(p.quarantined, r.Id)
+	}
+
+	for _, name := range filterNames(r.Filters) {
+		switch {
+		case name == SandboxName:
+			return &Violation{r.Id, tenant, fmt.Sprintf("filter not allowed: %s", name)}
+		case l.Filters != nil && !contains(l.Filters, name):
+			return &Violation{r.Id, tenant, fmt.Sprintf("filter not allowed: %s", name)}
+		case l.Sandbox != nil && contains(EgressFilters, name):
+			return &Violation{r.Id, tenant, fmt.Sprintf("egress filter not allowed in sandbox: %s", name)}
+		}
+	}
+
+	if l.MaxRoutes > 0 && p.count(tenant) >= l.MaxRoutes {
+		return &Violation{r.Id, tenant, fmt.Sprintf("route quota of %d exceeded", l.MaxRoutes)}
+	}
+
+	return nil
+}
+
+// applies the policy to the routes loaded by a data client, logs the
+// violations, and returns the accepted routes, and the ids of the
+// rejected ones
+func (p *Policy) apply(c routing.DataClient, routes []*eskip.Route, deletedIds []string, reset bool) ([]*eskip.Route, []string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	ids := p.accepted[c]
+	if ids == nil || reset {
+		for id := range ids {
+			delete(p.definitions, id)
+		}
+
+		ids = make(map[string]string)
+		p.accepted[c] = ids
+		delete(p.pending, c)
+	}
+
+	for _, id := range deletedIds {
+		delete(ids, id)
+		delete(p.definitions, id)
+	}
+
+	var (
+		accepted []*eskip.Route
+		rejected []string
+	)
+
+	for _, r := range routes {
+		delete(ids, r.Id)
+		if v := p.check(r); v != nil {
+			log.Error(v)
+			rejected = append(rejected, r.Id)
+			continue
+		}
+
+		tenant := p.Tenant(r)
+		ids[r.Id] = tenant
+		p.definitions[r.Id] = r.String()
+		if p.limits(tenant).Sandbox != nil {
+			r = sandboxed(r, tenant)
+		}
+
+		accepted = append(accepted, r)
+	}
+
+	return accepted, rejected
+}
+
+// Wraps a data client, rejecting the loaded routes that violate the
+// policy. When an updated route is rejected, its previous version is
+// deleted.
+func (p *Policy) Client(c routing.DataClient) routing.DataClient {
+	return &client{c, p}
+}
+
+func (c *client) LoadAll() ([]*eskip.Route, error) {
+	routes, err := c.DataClient.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	routes, _ = c.policy.apply(c.DataClient, routes, nil, true)
+	return routes, nil
+}
+
+func (c *client) LoadUpdate() ([]*eskip.Route, []string, error) {
+	routes, deletedIds, err := c.DataClient.LoadUpdate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	routes, rejected := c.policy.apply(c.DataClient, routes, deletedIds, false)
+	deletedIds = append(deletedIds, rejected...)
+	return routes, append(deletedIds, c.policy.takePending(c.DataClient)...), nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
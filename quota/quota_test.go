@@ -0,0 +1,189 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type testClient struct {
+	all, upsert []*eskip.Route
+	deletedIds  []string
+}
+
+func (c *testClient) LoadAll() ([]*eskip.Route, error) { return c.all, nil }
+
+func (c *testClient) LoadUpdate() ([]*eskip.Route, []string, error) {
+	return c.upsert, c.deletedIds, nil
+}
+
+func parse(t *testing.T, doc string) []*eskip.Route {
+	r, err := eskip.Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func ids(routes []*eskip.Route) []string {
+	var ids []string
+	for _, r := range routes {
+		ids = append(ids, r.Id)
+	}
+
+	return ids
+}
+
+func eqIds(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+var testOptions = Options{
+	TenantAnnotation: "team",
+	TenantSeparator:  "_",
+	Default:          Limits{MaxRoutes: 1, Filters: []string{"setPath"}},
+	Tenants:          map[string]Limits{"checkout": {MaxRoutes: 2}}}
+
+func TestTenant(t *testing.T) {
+	p := New(testOptions)
+	for _, ti := range []struct {
+		doc, tenant string
+	}{
+		{`route1: Any() -> <shunt>`, ""},
+		{`checkout_cart: Any() -> <shunt>`, "checkout"},
+		{`@team("search") checkout_cart: Any() -> <shunt>`, "search"},
+		{`_cart: Any() -> <shunt>`, ""},
+	} {
+		if tenant := p.Tenant(parse(t, ti.doc)[0]); tenant != ti.tenant {
+			t.Error("invalid tenant", ti.doc, tenant)
+		}
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	c := New(testOptions).Client(&testClient{all: parse(t, `
+		checkout_cart: Path("/cart") -> <shunt>;
+		checkout_pay: Path("/pay") -> requestHeader("X-Foo", "bar") -> <shunt>;
+		checkout_list: Path("/list") -> <shunt>;
+		search_find: Path("/find") -> setPath("/search") -> <shunt>;
+		search_list: Path("/list") -> <shunt>;
+		@team("search") query: Path("/query") -> <shunt>;
+		ads_banner: Path("/banner") -> requestHeader("X-Foo", "bar") -> <shunt>`)})
+
+	routes, err := c.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"checkout_cart", "checkout_pay", "search_find"}
+	if !eqIds(ids(routes), expected) {
+		t.Error("failed to apply the quotas", ids(routes))
+	}
+}
+
+func TestLoadUpdate(t *testing.T) {
+	tc := &testClient{all: parse(t, `search_find: Path("/find") -> <shunt>`)}
+	c := New(testOptions).Client(tc)
+	if _, err := c.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	tc.upsert = parse(t, `search_list: Path("/list") -> <shunt>`)
+	routes, deletedIds, err := c.LoadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 0 || !eqIds(deletedIds, []string{"search_list"}) {
+		t.Error("failed to reject the route over the quota", ids(routes), deletedIds)
+	}
+
+	tc.upsert, tc.deletedIds = parse(t, `search_list: Path("/list") -> <shunt>`), []string{"search_find"}
+	routes, deletedIds, err = c.LoadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !eqIds(ids(routes), []string{"search_list"}) || !eqIds(deletedIds, []string{"search_find"}) {
+		t.Error("failed to accept the route after deleting one", ids(routes), deletedIds)
+	}
+
+	tc.upsert, tc.deletedIds = parse(t, `search_list: Path("/list") -> requestHeader("X-Foo", "bar") -> <shunt>`), nil
+	routes, deletedIds, err = c.LoadUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 0 || !eqIds(deletedIds, []string{"search_list"}) {
+		t.Error("failed to delete the rejected update", ids(routes), deletedIds)
+	}
+}
+
+func TestQuotaSharedByClients(t *testing.T) {
+	p := New(testOptions)
+	c1 := p.Client(&testClient{all: parse(t, `search_find: Path("/find") -> <shunt>`)})
+	c2 := p.Client(&testClient{all: parse(t, `search_list: Path("/list") -> <shunt>`)})
+	if _, err := c1.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := c2.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 0 {
+		t.Error("failed to share the quota", ids(routes))
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	f, err := ioutil.TempFile("", "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	f.WriteString(`{
+		"tenantAnnotation": "team",
+		"default": {"maxRoutes": 10, "filters": ["setPath"]},
+		"tenants": {"checkout": {"maxRoutes": 100}}
+	}`)
+	f.Close()
+
+	o, err := ReadOptions(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.TenantAnnotation != "team" || o.Default.MaxRoutes != 10 || len(o.Default.Filters) != 1 ||
+		o.Tenants["checkout"].MaxRoutes != 100 || o.Tenants["checkout"].Filters != nil {
+		t.Error("failed to read the options", o)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/cloud"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/jwt"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/synthetic"
+	"time"
+)
+
+// The name of the filter marking the sandboxed routes.
+const SandboxName = "sandbox"
+
+// The filters sending requests to other destinations than the backend of
+// the route, or making network requests on their own. They are never
+// allowed in the routes of the sandboxed tenants, even when listed in
+// their allowed filters.
+var EgressFilters = []string{
+	builtin.BackendHostName,
+	builtin.BackendSchemeName,
+	builtin.NegotiateName,
+	builtin.FailoverName,
+	builtin.ConsistentHashName,
+	builtin.SrvBackendName,
+	builtin.CanaryName,
+	cloud.FilterName,
+	jwt.FilterName,
+	synthetic.CheckName,
+}
+
+// The resource limits of the routes of a sandboxed tenant, per request.
+type Sandbox struct {
+
+	// The total time that the filters of the route may spend
+	// processing a request and its response, in milliseconds. Zero
+	// means no limit.
+	FilterTimeMs int64 `json:"filterTimeMs"`
+
+	// The number of bytes that the filters of the route may read from
+	// the request or the response body. Zero means no limit.
+	BodyBytes int64 `json:"bodyBytes"`
+}
+
+type quarantine struct {
+	definition string
+	reason     string
+}
+
+type sandboxSpec struct {
+	policy *Policy
+}
+
+type sandboxFilter struct {
+	policy *Policy
+	limits filters.SandboxLimits
+}
+
+// returns the names of the filters, including the inner filters of the
+// when filter
+func filterNames(fs []*eskip.Filter) []string {
+	var names []string
+	for _, f := range fs {
+		names = append(names, f.Name)
+		if f.Name != builtin.WhenName || len(f.Args) < 2 {
+			continue
+		}
+
+		if chain, ok := f.Args[1].(string); ok {
+			if inner, err := eskip.ParseFilters(chain); err == nil {
+				names = append(names, filterNames(inner)...)
+			}
+		}
+	}
+
+	return names
+}
+
+// returns a copy of the route with the sandbox filter inserted
+func sandboxed(r *eskip.Route, tenant string) *eskip.Route {
+	c := *r
+	c.Filters = append([]*eskip.Filter{{Name: SandboxName, Args: []interface{}{tenant}}}, r.Filters...)
+	return &c
+}
+
+// Quarantines a route: it is deleted on the next update of its data
+// client, and it is rejected until its definition changes.
+func (p *Policy) Quarantine(routeId, reason string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	definition, ok := p.definitions[routeId]
+	if !ok {
+		// already removed
+		return
+	}
+
+	p.quarantined[routeId] = &quarantine{definition, reason}
+	delete(p.definitions, routeId)
+	for c, ids := range p.accepted {
+		if tenant, ok := ids[routeId]; ok {
+			delete(ids, routeId)
+			p.pending[c] = append(p.pending[c], routeId)
+			log.Error(&Violation{routeId, tenant, "quarantined: " + reason})
+		}
+	}
+}
+
+func (p *Policy) takePending(c routing.DataClient) []string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	ids := p.pending[c]
+	delete(p.pending, c)
+	return ids
+}
+
+// Returns the specification of the sandbox filter, that needs to be
+// registered in the filter registry of the routing, when the options
+// contain sandboxed tenants. The policy inserts the filter in the routes
+// of the sandboxed tenants, and it cannot be used in the route
+// definitions directly.
+//
+// The filter expects the tenant as its only argument. It implements the
+// filters.SandboxFilter interface, providing the limits of the tenant
+// to the proxy, and quarantining the routes violating them.
+//
+// Name: "sandbox".
+func (p *Policy) SandboxSpec() filters.Spec { return &sandboxSpec{p} }
+
+// "sandbox"
+func (s *sandboxSpec) Name() string { return SandboxName }
+
+func (s *sandboxSpec) Description() string {
+	return "Marks the routes of a sandboxed tenant. Inserted by the quota policy."
+}
+
+func (s *sandboxSpec) Schema() []filters.Arg {
+	return []filters.Arg{
+		{Name: "tenant", Type: filters.StringType},
+	}
+}
+
+func (s *sandboxSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	tenant, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	sb := s.policy.limits(tenant).Sandbox
+	if sb == nil {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &sandboxFilter{s.policy, filters.SandboxLimits{
+		FilterTime: time.Duration(sb.FilterTimeMs) * time.Millisecond,
+		BodyBytes:  sb.BodyBytes}}, nil
+}
+
+// Noop.
+func (f *sandboxFilter) Request(filters.FilterContext) {}
+
+// Noop.
+func (f *sandboxFilter) Response(filters.FilterContext) {}
+
+func (f *sandboxFilter) SandboxLimits() filters.SandboxLimits { return f.limits }
+
+// Quarantines the route.
+func (f *sandboxFilter) SandboxViolation(routeId, reason string) {
+	f.policy.Quarantine(routeId, reason)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"github.com/zalando/skipper/filters"
+	"testing"
+	"time"
+)
+
+var sandboxOptions = Options{
+	TenantSeparator: "_",
+	Tenants: map[string]Limits{
+		"partner": {
+			Filters: []string{"setPath", "when", "requestHeader", "backendHost"},
+			Sandbox: &Sandbox{FilterTimeMs: 5, BodyBytes: 1024}}}}
+
+func TestSandboxRejectsFilters(t *testing.T) {
+	p := New(sandboxOptions)
+	c := &testClient{all: parse(t, `
+		partner_ok: Any() -> setPath("/") -> "https://www.example.org";
+		partner_egress: Any() -> backendHost("internal.example.org") -> "https://www.example.org";
+		partner_nested: Any() -> when("Method(\"POST\")", "backendHost(\"internal.example.org\")") -> "https://www.example.org";
+		partner_sandbox: Any() -> sandbox("other") -> "https://www.example.org";
+		trusted_sandbox: Any() -> sandbox("partner") -> "https://www.example.org";
+		trusted_egress: Any() -> backendHost("internal.example.org") -> "https://www.example.org"`)}
+
+	routes, err := p.Client(c).LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !eqIds(ids(routes), []string{"partner_ok", "trusted_egress"}) {
+		t.Error("failed to reject the routes", ids(routes))
+	}
+}
+
+func TestSandboxInsertsFilter(t *testing.T) {
+	p := New(sandboxOptions)
+	c := &testClient{all: parse(t, `
+		partner_ok: Any() -> setPath("/") -> "https://www.example.org";
+		trusted: Any() -> setPath("/") -> "https://www.example.org"`)}
+
+	routes, err := p.Client(c).LoadAll()
+	if err != nil || len(routes) != 2 {
+		t.Fatal("failed to load the routes", err)
+	}
+
+	if len(routes[0].Filters) != 2 || routes[0].Filters[0].Name != SandboxName ||
+		routes[0].Filters[0].Args[0] != "partner" {
+		t.Error("failed to insert the sandbox filter", routes[0].String())
+	}
+
+	if len(routes[1].Filters) != 1 {
+		t.Error("unexpected sandbox filter", routes[1].String())
+	}
+
+	if len(c.all[0].Filters) != 1 {
+		t.Error("the loaded route was modified")
+	}
+}
+
+func TestSandboxFilter(t *testing.T) {
+	p := New(sandboxOptions)
+	spec := p.SandboxSpec()
+	if _, err := spec.CreateFilter([]interface{}{"trusted"}); err != filters.ErrInvalidFilterParameters {
+		t.Error("failed to fail for a tenant without sandbox")
+	}
+
+	f, err := spec.CreateFilter([]interface{}{"partner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sf, ok := f.(filters.SandboxFilter)
+	if !ok {
+		t.Fatal("not a sandbox filter")
+	}
+
+	if l := sf.SandboxLimits(); l.FilterTime != 5*time.Millisecond || l.BodyBytes != 1024 {
+		t.Error("invalid limits", l)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	p := New(sandboxOptions)
+	c := &testClient{all: parse(t, `
+		partner_foo: Any() -> setPath("/") -> "https://www.example.org";
+		partner_bar: Any() -> setPath("/") -> "https://www.example.org"`)}
+	qc := p.Client(c)
+
+	if _, err := qc.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := p.SandboxSpec().CreateFilter([]interface{}{"partner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.(filters.SandboxFilter).SandboxViolation("partner_foo", "filter time budget exceeded")
+
+	// deleted on the next update
+	_, deleted, err := qc.LoadUpdate()
+	if err != nil || !eqIds(deleted, []string{"partner_foo"}) {
+		t.Error("failed to delete the quarantined route", deleted, err)
+	}
+
+	// rejected when reloaded unchanged
+	routes, err := qc.LoadAll()
+	if err != nil || !eqIds(ids(routes), []string{"partner_bar"}) {
+		t.Error("failed to reject the quarantined route", ids(routes), err)
+	}
+
+	// accepted again when changed
+	c.upsert = parse(t, `partner_foo: Any() -> setPath("/fixed") -> "https://www.example.org"`)
+	routes, deleted, err = qc.LoadUpdate()
+	if err != nil || !eqIds(ids(routes), []string{"partner_foo"}) || len(deleted) != 0 {
+		t.Error("failed to accept the changed route", ids(routes), deleted, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	RatelimitName       = "ratelimit"
+	ClientRatelimitName = "clientRatelimit"
+	HeaderRatelimitName = "headerRatelimit"
+
+	// not defined by net/http before Go 1.6
+	statusTooManyRequests = 429
+)
+
+type limitType int
+
+const (
+	routeLimit limitType = iota
+	clientLimit
+	headerLimit
+)
+
+type spec struct {
+	typ   limitType
+	store Store
+}
+
+type filter struct {
+	store    Store
+	typ      limitType
+	group    string
+	header   string
+	settings Settings
+}
+
+func newSpec(typ limitType, s Store) filters.Spec {
+	if s == nil {
+		s = NewLocalStore()
+	}
+
+	return &spec{typ: typ, store: s}
+}
+
+// Returns a filter specification whose instances limit the rate of all
+// the requests of a group of routes, e.g.:
+//
+//     ratelimit("export", 5, "1m")
+//
+// The arguments are the name of the group, the maximum number of
+// requests, and the time window, in milliseconds or as a duration
+// string. When the store is nil, the counters are kept in memory.
+//
+// Name: "ratelimit".
+func NewRatelimit(s Store) filters.Spec { return newSpec(routeLimit, s) }
+
+// Returns a filter specification whose instances limit the rate of the
+// requests per client IP, taken with routing.ClientIP, i.e. from the
+// remote address of the connection, or, behind trusted proxies, from the
+// X-Forwarded-For header, e.g.:
+//
+//     clientRatelimit("api", 100, "1m")
+//
+// Name: "clientRatelimit".
+func NewClientRatelimit(s Store) filters.Spec { return newSpec(clientLimit, s) }
+
+// Returns a filter specification whose instances limit the rate of the
+// requests per value of a request header, e.g. per API key. The
+// requests without the header are not limited:
+//
+//     headerRatelimit("search", "Authorization", 10, "1s")
+//
+// Name: "headerRatelimit".
+func NewHeaderRatelimit(s Store) filters.Spec { return newSpec(headerLimit, s) }
+
+// "ratelimit", "clientRatelimit" or "headerRatelimit"
+func (s *spec) Name() string {
+	switch s.typ {
+	case clientLimit:
+		return ClientRatelimitName
+	case headerLimit:
+		return HeaderRatelimitName
+	default:
+		return RatelimitName
+	}
+}
+
+func (s *spec) Description() string {
+	switch s.typ {
+	case clientLimit:
+		return "Limits the rate of the requests per client IP."
+	case headerLimit:
+		return "Limits the rate of the requests per value of a request header."
+	default:
+		return "Limits the rate of all the requests of a group of routes."
+	}
+}
+
+func (s *spec) Schema() []filters.Arg {
+	schema := []filters.Arg{{Name: "group", Type: filters.StringType}}
+	if s.typ == headerLimit {
+		schema = append(schema, filters.Arg{Name: "header", Type: filters.StringType})
+	}
+
+	return append(
+		schema,
+		filters.Arg{Name: "maxHits", Type: filters.NumberType},
+		filters.Arg{Name: "timeWindow", Type: filters.DurationType})
+}
+
+// Rate limiting is admission control, so it runs before
+// authentication.
+func (s *spec) Phase() filters.Phase { return filters.PhasePreAuth }
+
+func (s *spec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != len(s.Schema()) {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{store: s.store, typ: s.typ}
+
+	var ok bool
+	if f.group, ok = config[0].(string); !ok || f.group == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	config = config[1:]
+	if s.typ == headerLimit {
+		if f.header, ok = config[0].(string); !ok || f.header == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		config = config[1:]
+	}
+
+	maxHits, ok := config[0].(float64)
+	if !ok || maxHits < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f.settings.MaxHits = int64(maxHits)
+	if f.settings.TimeWindow, ok = filters.DurationArg(config[1]); !ok || f.settings.TimeWindow <= 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return f, nil
+}
+
+// the client IP of a request. The X-Forwarded-For header is used only
+// as far as it was set by the trusted proxies, see
+// routing.SetTrustedProxies.
+func clientIP(r *http.Request) string {
+	if ip := routing.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+
+	return r.RemoteAddr
+}
+
+// the key of the counter of a request, or false, when the request is
+// not limited
+func (f *filter) key(r *http.Request) (string, bool) {
+	switch f.typ {
+	case clientLimit:
+		return f.group + keySeparator + clientIP(r), true
+	case headerLimit:
+		v := r.Header.Get(f.header)
+		return f.group + keySeparator + v, v != ""
+	default:
+		return f.group, true
+	}
+}
+
+// Counts the request, and responds with 429 Too Many Requests, when the
+// limit is exceeded.
+func (f *filter) Request(ctx filters.FilterContext) {
+	key, ok := f.key(ctx.Request())
+	if !ok {
+		return
+	}
+
+	allowed, retryAfter, err := allow(f.store, key, f.settings, time.Now())
+	if err != nil {
+		log.Errorf("ratelimit: %s: %v", f.group, err)
+		return
+	}
+
+	if allowed {
+		return
+	}
+
+	metrics.IncRatelimited(f.group)
+
+	seconds := int64(retryAfter / time.Second)
+	if retryAfter%time.Second > 0 {
+		seconds++
+	}
+
+	w := ctx.ResponseWriter()
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(statusTooManyRequests)
+	ctx.MarkServed()
+}
+
+// Noop.
+func (f *filter) Response(filters.FilterContext) {}
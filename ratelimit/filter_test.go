@@ -0,0 +1,190 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type failingStore struct{}
+
+func (failingStore) Increment(string, time.Duration, time.Time) (int64, int64, error) {
+	return 0, 0, errors.New("store failed")
+}
+
+func TestCreateFilterInvalidConfig(t *testing.T) {
+	for _, ti := range []struct {
+		spec filters.Spec
+		args []interface{}
+	}{
+		{NewRatelimit(nil), nil},
+		{NewRatelimit(nil), []interface{}{"", 10.0, "1m"}},
+		{NewRatelimit(nil), []interface{}{"foo", 0.0, "1m"}},
+		{NewRatelimit(nil), []interface{}{"foo", 10.0, "1x"}},
+		{NewRatelimit(nil), []interface{}{"foo", 10.0, 0.0}},
+		{NewClientRatelimit(nil), []interface{}{"foo", 10.0}},
+		{NewHeaderRatelimit(nil), []interface{}{"foo", 10.0, "1m"}},
+		{NewHeaderRatelimit(nil), []interface{}{"foo", "", 10.0, "1m"}},
+	} {
+		if _, err := ti.spec.CreateFilter(ti.args); err == nil {
+			t.Error("failed to fail", ti.spec.Name(), ti.args)
+		}
+	}
+}
+
+func ratelimitContext(r *http.Request) *filtertest.Context {
+	return &filtertest.Context{FResponseWriter: httptest.NewRecorder(), FRequest: r}
+}
+
+func limited(t *testing.T, f filters.Filter, r *http.Request) bool {
+	ctx := ratelimitContext(r)
+	f.Request(ctx)
+	if !ctx.Served() {
+		return false
+	}
+
+	w := ctx.FResponseWriter.(*httptest.ResponseRecorder)
+	if w.Code != statusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Error("invalid response", w.Code, w.Header())
+	}
+
+	return true
+}
+
+func TestRatelimit(t *testing.T) {
+	f, err := NewRatelimit(nil).CreateFilter([]interface{}{"foo", 2.0, "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &http.Request{Header: http.Header{}}
+	for i, expected := range []bool{false, false, true} {
+		if limited(t, f, r) != expected {
+			t.Error("invalid rate limit", i)
+		}
+	}
+}
+
+func TestClientRatelimit(t *testing.T) {
+	routing.SetTrustedProxies(routing.TrustedProxies{Hops: 1})
+	defer routing.SetTrustedProxies(routing.TrustedProxies{})
+
+	f, err := NewClientRatelimit(nil).CreateFilter([]interface{}{"foo", 1.0, 60000.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client1 := &http.Request{RemoteAddr: "10.0.0.1:4242", Header: http.Header{}}
+	client2 := &http.Request{RemoteAddr: "10.0.0.1:4343", Header: http.Header{"X-Forwarded-For": []string{"192.168.0.1, 10.0.0.2"}}}
+	if limited(t, f, client1) || limited(t, f, client2) {
+		t.Error("failed to separate the clients")
+	}
+
+	if !limited(t, f, &http.Request{RemoteAddr: "10.0.0.1:4444", Header: http.Header{}}) {
+		t.Error("failed to limit the client")
+	}
+}
+
+func TestClientRatelimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	routing.SetTrustedProxies(routing.TrustedProxies{Hops: 1})
+	defer routing.SetTrustedProxies(routing.TrustedProxies{})
+
+	f, err := NewClientRatelimit(nil).CreateFilter([]interface{}{"foo", 1.0, 60000.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spoofed := func(ip string) *http.Request {
+		return &http.Request{
+			RemoteAddr: "10.0.0.1:4242",
+			Header:     http.Header{"X-Forwarded-For": []string{ip + ", 192.168.0.1"}}}
+	}
+
+	if key, _ := f.(*filter).key(spoofed("1.1.1.1")); key != "foo"+keySeparator+"192.168.0.1" {
+		t.Error("invalid counter key", key)
+	}
+
+	if limited(t, f, spoofed("1.1.1.1")) {
+		t.Error("unexpected limit")
+	}
+
+	if !limited(t, f, spoofed("2.2.2.2")) {
+		t.Error("failed to limit the client with a spoofed X-Forwarded-For header")
+	}
+}
+
+func TestClientRatelimitWithoutTrustedProxies(t *testing.T) {
+	f, err := NewClientRatelimit(nil).CreateFilter([]interface{}{"foo", 1.0, 60000.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if limited(t, f, &http.Request{RemoteAddr: "10.0.0.1:4242", Header: http.Header{"X-Forwarded-For": []string{"1.1.1.1"}}}) {
+		t.Error("unexpected limit")
+	}
+
+	if !limited(t, f, &http.Request{RemoteAddr: "10.0.0.1:4343", Header: http.Header{"X-Forwarded-For": []string{"2.2.2.2"}}}) {
+		t.Error("failed to ignore the X-Forwarded-For header")
+	}
+}
+
+func TestHeaderRatelimit(t *testing.T) {
+	f, err := NewHeaderRatelimit(nil).CreateFilter([]interface{}{"foo", "X-Api-Key", 1.0, "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withKey := func(key string) *http.Request {
+		r := &http.Request{Header: http.Header{}}
+		if key != "" {
+			r.Header.Set("X-Api-Key", key)
+		}
+
+		return r
+	}
+
+	if limited(t, f, withKey("a")) || limited(t, f, withKey("b")) || !limited(t, f, withKey("a")) {
+		t.Error("failed to limit per key")
+	}
+
+	if limited(t, f, withKey("")) || limited(t, f, withKey("")) {
+		t.Error("unexpected limit of the requests without the header")
+	}
+}
+
+func TestRatelimitSharedByGroup(t *testing.T) {
+	spec := NewRatelimit(nil)
+	f1, _ := spec.CreateFilter([]interface{}{"foo", 1.0, "1m"})
+	f2, _ := spec.CreateFilter([]interface{}{"foo", 1.0, "1m"})
+	r := &http.Request{Header: http.Header{}}
+	if limited(t, f1, r) || !limited(t, f2, r) {
+		t.Error("failed to share the limit of the group")
+	}
+}
+
+func TestRatelimitStoreFailure(t *testing.T) {
+	f, _ := NewRatelimit(failingStore{}).CreateFilter([]interface{}{"foo", 1.0, "1m"})
+	r := &http.Request{Header: http.Header{}}
+	if limited(t, f, r) || limited(t, f, r) {
+		t.Error("failed to let the requests through")
+	}
+}
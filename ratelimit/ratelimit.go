@@ -0,0 +1,158 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package ratelimit implements filters limiting the rate of the requests
+per client, per the value of a request header, or for a whole route.
+
+The limits are defined by a group name, the maximum number of requests,
+and the time window:
+
+    api: Path("/api") -> clientRatelimit("api", 100, "1m") -> "https://api.example.org";
+
+    search: Path("/search") -> headerRatelimit("search", "Authorization", 10, "1s") -> "https://search.example.org";
+
+    export: Path("/export") -> ratelimit("export", 5, "1m") -> "https://export.example.org";
+
+The group names the counters, so the routes with the same group share
+their limits, and the counters survive the updates of the routes. The
+requests exceeding the limit are answered with 429 Too Many Requests,
+and the Retry-After header. The rejected requests are counted, too, so
+the clients retrying too early remain limited.
+
+The requests are counted in fixed time windows, and the rate is
+estimated over a sliding window, weighting the count of the previous
+window by its overlap with the sliding window. The counters are kept
+by a Store. The default one keeps them in memory, limiting the requests
+per proxy instance, while the Redis store shares them between multiple
+instances. When the store fails, the requests are let through, and the
+error is logged.
+*/
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = time.Minute
+	keySeparator  = ":"
+)
+
+// A Store keeps the request counters of the rate limits.
+type Store interface {
+
+	// Increments the counter of a key in the time window containing
+	// now, and returns the count of the current and the previous
+	// window.
+	Increment(key string, window time.Duration, now time.Time) (current, previous int64, err error)
+}
+
+// The settings of a rate limit.
+type Settings struct {
+
+	// The maximum number of requests allowed in the time window.
+	MaxHits int64
+
+	// The duration of the sliding time window.
+	TimeWindow time.Duration
+}
+
+type localCounter struct {
+	window   time.Duration
+	index    int64
+	current  int64
+	previous int64
+}
+
+type localStore struct {
+	mx        sync.Mutex
+	counters  map[string]*localCounter
+	lastSweep time.Time
+}
+
+// the index of the fixed time window containing t
+func windowIndex(t time.Time, window time.Duration) int64 {
+	return t.UnixNano() / int64(window)
+}
+
+// Returns a store keeping the counters in memory, limiting the requests
+// per proxy instance.
+func NewLocalStore() Store {
+	return &localStore{counters: make(map[string]*localCounter), lastSweep: time.Now()}
+}
+
+// removes the counters without hits in the current or the previous
+// window
+func (s *localStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+
+	for k, c := range s.counters {
+		if windowIndex(now, c.window) > c.index+1 {
+			delete(s.counters, k)
+		}
+	}
+
+	s.lastSweep = now
+}
+
+// Increments the counter in memory.
+func (s *localStore) Increment(key string, window time.Duration, now time.Time) (int64, int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.sweep(now)
+
+	index := windowIndex(now, window)
+	c, ok := s.counters[key]
+	if !ok || c.window != window {
+		c = &localCounter{window: window, index: index}
+		s.counters[key] = c
+	}
+
+	switch {
+	case index == c.index+1:
+		c.previous, c.current = c.current, 0
+	case index > c.index+1:
+		c.previous, c.current = 0, 0
+	}
+
+	if index > c.index {
+		c.index = index
+	}
+
+	c.current++
+	return c.current, c.previous, nil
+}
+
+// Counts a request for a key, and returns whether it is within the
+// limit, and when not, the time after which the client may retry.
+func allow(s Store, key string, settings Settings, now time.Time) (bool, time.Duration, error) {
+	current, previous, err := s.Increment(key, settings.TimeWindow, now)
+	if err != nil {
+		return true, 0, err
+	}
+
+	window := int64(settings.TimeWindow)
+	elapsed := now.UnixNano() % window
+	weight := float64(window-elapsed) / float64(window)
+	if float64(previous)*weight+float64(current) <= float64(settings.MaxHits) {
+		return true, 0, nil
+	}
+
+	return false, time.Duration(window - elapsed), nil
+}
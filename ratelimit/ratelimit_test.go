@@ -0,0 +1,79 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalStoreIncrement(t *testing.T) {
+	s := NewLocalStore()
+	start := time.Unix(0, 0)
+	for i, ti := range []struct {
+		at                time.Duration
+		current, previous int64
+	}{
+		{0, 1, 0},
+		{time.Second, 2, 0},
+		{time.Minute, 1, 2},
+		{time.Minute + time.Second, 2, 2},
+		{3 * time.Minute, 1, 0},
+	} {
+		current, previous, err := s.Increment("foo", time.Minute, start.Add(ti.at))
+		if err != nil || current != ti.current || previous != ti.previous {
+			t.Error("invalid counters", i, current, previous, err)
+		}
+	}
+
+	if current, _, _ := s.Increment("bar", time.Minute, start.Add(3*time.Minute)); current != 1 {
+		t.Error("failed to separate the keys")
+	}
+}
+
+func TestLocalStoreSweep(t *testing.T) {
+	s := NewLocalStore().(*localStore)
+	now := time.Now()
+	s.Increment("foo", time.Second, now)
+	s.Increment("bar", time.Hour, now)
+	s.Increment("baz", time.Second, now.Add(2*sweepInterval))
+	if _, ok := s.counters["foo"]; ok || len(s.counters) != 2 {
+		t.Error("failed to sweep the counters", len(s.counters))
+	}
+}
+
+func TestAllow(t *testing.T) {
+	s := NewLocalStore()
+	settings := Settings{MaxHits: 2, TimeWindow: time.Minute}
+	start := time.Unix(0, 0)
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := allow(s, "foo", settings, start); !ok {
+			t.Error("failed to allow", i)
+		}
+	}
+
+	if ok, retry, _ := allow(s, "foo", settings, start.Add(15*time.Second)); ok || retry != 45*time.Second {
+		t.Error("failed to limit", retry)
+	}
+
+	// the previous window is weighted by its overlap with the sliding window
+	if ok, _, _ := allow(s, "foo", settings, start.Add(70*time.Second)); ok {
+		t.Error("failed to limit in the sliding window")
+	}
+
+	if ok, _, _ := allow(s, "foo", settings, start.Add(175*time.Second)); !ok {
+		t.Error("failed to allow after the window")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRedisTimeout   = 100 * time.Millisecond
+	defaultRedisIdleConns = 16
+	redisKeyPrefix        = "skipper:ratelimit:"
+)
+
+var errRedisResponse = errors.New("ratelimit: invalid redis response")
+
+// Options of the Redis store.
+type RedisOptions struct {
+
+	// The address of the Redis server, in the form of host:port.
+	Address string
+
+	// When set, the connections are authenticated with this password.
+	Password string
+
+	// The timeout of dialing and of the commands. Defaults to 100ms.
+	Timeout time.Duration
+
+	// The maximum number of idle connections kept open. Defaults to 16.
+	MaxIdleConns int
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type redisStore struct {
+	options RedisOptions
+	idle    chan *redisConn
+}
+
+// Returns a store keeping the counters in Redis, so that multiple proxy
+// instances share the limits. The counters of a window expire after
+// the next window.
+func NewRedisStore(o RedisOptions) Store {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultRedisTimeout
+	}
+
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = defaultRedisIdleConns
+	}
+
+	return &redisStore{options: o, idle: make(chan *redisConn, o.MaxIdleConns)}
+}
+
+// writes the commands in the RESP format
+func writeCommands(w *bufio.Writer, commands ...[]string) error {
+	for _, c := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(c))
+		for _, a := range c {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+
+	return w.Flush()
+}
+
+// reads a reply, and returns its value as an integer. Nil bulk strings
+// are returned as zero.
+func readInt(r *bufio.Reader) (int64, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return 0, errRedisResponse
+	}
+
+	value := line[1 : len(line)-2]
+	switch line[0] {
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '+':
+		return 0, nil
+	case '-':
+		return 0, errors.New("ratelimit: redis: " + value)
+	case '$':
+		l, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, err
+		}
+
+		if l < 0 {
+			return 0, nil
+		}
+
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, err
+		}
+
+		return strconv.ParseInt(string(b[:l]), 10, 64)
+	default:
+		return 0, errRedisResponse
+	}
+}
+
+func (s *redisStore) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", s.options.Address, s.options.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if s.options.Password != "" {
+		if _, err := s.do(c, []string{"AUTH", s.options.Password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (s *redisStore) get() (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+		return s.dial()
+	}
+}
+
+func (s *redisStore) put(c *redisConn) {
+	select {
+	case s.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// sends the commands in a pipeline, and reads the replies
+func (s *redisStore) do(c *redisConn, commands ...[]string) ([]int64, error) {
+	c.conn.SetDeadline(time.Now().Add(s.options.Timeout))
+	if err := writeCommands(bufio.NewWriter(c.conn), commands...); err != nil {
+		return nil, err
+	}
+
+	replies := make([]int64, len(commands))
+	for i := range commands {
+		v, err := readInt(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		replies[i] = v
+	}
+
+	return replies, nil
+}
+
+// Increments the counter of the current window, sets its expiration,
+// and reads the counter of the previous window, in a single roundtrip.
+func (s *redisStore) Increment(key string, window time.Duration, now time.Time) (int64, int64, error) {
+	c, err := s.get()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	index := windowIndex(now, window)
+	current := redisKeyPrefix + key + keySeparator + strconv.FormatInt(index, 10)
+	previous := redisKeyPrefix + key + keySeparator + strconv.FormatInt(index-1, 10)
+	expire := strconv.FormatInt(int64(2*window/time.Millisecond), 10)
+	replies, err := s.do(
+		c,
+		[]string{"INCR", current},
+		[]string{"PEXPIRE", current, expire},
+		[]string{"GET", previous})
+	if err != nil {
+		c.conn.Close()
+		return 0, 0, err
+	}
+
+	s.put(c)
+	return replies[0], replies[2], nil
+}
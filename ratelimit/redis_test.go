@@ -0,0 +1,167 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a minimal redis server, supporting the commands used by the store
+type testRedis struct {
+	listener net.Listener
+	password string
+	mx       sync.Mutex
+	values   map[string]int64
+	commands []string
+}
+
+func newTestRedis(t *testing.T, password string) *testRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &testRedis{listener: l, password: password, values: make(map[string]int64)}
+	go r.serve()
+	return r
+}
+
+func (r *testRedis) serve() {
+	for {
+		c, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go r.handle(c)
+	}
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(br, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	command := make([]string, n)
+	for i := range command {
+		var l int
+		if _, err := fmt.Fscanf(br, "$%d\r\n", &l); err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+
+		command[i] = string(b[:l])
+	}
+
+	return command, nil
+}
+
+func (r *testRedis) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	authenticated := r.password == ""
+	for {
+		command, err := readCommand(br)
+		if err != nil {
+			return
+		}
+
+		r.mx.Lock()
+		r.commands = append(r.commands, command[0])
+		switch {
+		case command[0] == "AUTH":
+			authenticated = command[1] == r.password
+			fmt.Fprint(c, "+OK\r\n")
+		case !authenticated:
+			fmt.Fprint(c, "-NOAUTH Authentication required\r\n")
+		case command[0] == "INCR":
+			r.values[command[1]]++
+			fmt.Fprintf(c, ":%d\r\n", r.values[command[1]])
+		case command[0] == "PEXPIRE":
+			fmt.Fprint(c, ":1\r\n")
+		case command[0] == "GET":
+			if v, ok := r.values[command[1]]; ok {
+				s := strconv.FormatInt(v, 10)
+				fmt.Fprintf(c, "$%d\r\n%s\r\n", len(s), s)
+			} else {
+				fmt.Fprint(c, "$-1\r\n")
+			}
+		}
+
+		r.mx.Unlock()
+	}
+}
+
+func (r *testRedis) close() { r.listener.Close() }
+
+func TestRedisStoreIncrement(t *testing.T) {
+	r := newTestRedis(t, "secret")
+	defer r.close()
+
+	s := NewRedisStore(RedisOptions{Address: r.listener.Addr().String(), Password: "secret"})
+	start := time.Unix(0, 0)
+	for i, ti := range []struct {
+		at                time.Duration
+		current, previous int64
+	}{
+		{0, 1, 0},
+		{time.Second, 2, 0},
+		{time.Minute, 1, 2},
+	} {
+		current, previous, err := s.Increment("foo", time.Minute, start.Add(ti.at))
+		if err != nil || current != ti.current || previous != ti.previous {
+			t.Error("invalid counters", i, current, previous, err)
+		}
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if strings.Join(r.commands, " ") != "AUTH INCR PEXPIRE GET INCR PEXPIRE GET INCR PEXPIRE GET" {
+		t.Error("failed to reuse the connection", r.commands)
+	}
+}
+
+func TestRedisStoreError(t *testing.T) {
+	r := newTestRedis(t, "secret")
+	defer r.close()
+
+	s := NewRedisStore(RedisOptions{Address: r.listener.Addr().String(), Password: "wrong"})
+	if _, _, err := s.Increment("foo", time.Minute, time.Now()); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	r := newTestRedis(t, "")
+	r.close()
+
+	s := NewRedisStore(RedisOptions{Address: r.listener.Addr().String()})
+	if _, _, err := s.Increment("foo", time.Minute, time.Now()); err == nil {
+		t.Error("failed to fail")
+	}
+}
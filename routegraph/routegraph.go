@@ -0,0 +1,400 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package routegraph analyzes a set of routes, and builds the graph of
+the hosts, the routes and the backends, so that large route tables can
+be visualized, and the backends no longer referenced by any route can
+be identified.
+
+The graph has three kinds of nodes: the host conditions of the routes,
+the routes, and the backends. The routes without a host condition are
+connected to the node of any host, "*". The routes are connected to
+their network backends, to the weighted backends of the split
+backends, and to the backends set by filters, e.g. failover or canary.
+The loopback routes are connected back to the host nodes, whose routes
+the request is matched against again: the hosts of the loopback route
+itself, or, when the route sets the Host header with the requestHeader
+filter, the hosts matching the new value.
+
+The graph can be exported in the DOT format of Graphviz, or as JSON,
+e.g. with the eskip graph command:
+
+    eskip graph routes.eskip | dot -Tsvg > routes.svg
+*/
+package routegraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The type of a node.
+type NodeType string
+
+const (
+	HostNode    NodeType = "host"
+	RouteNode   NodeType = "route"
+	BackendNode NodeType = "backend"
+)
+
+// The type of an edge.
+type EdgeType string
+
+const (
+	// From a host to a route matching it.
+	MatchEdge EdgeType = "match"
+
+	// From a route to its backend.
+	BackendEdge EdgeType = "backend"
+
+	// From a route to a backend set by one of its filters.
+	FilterEdge EdgeType = "filter"
+
+	// From a loopback route to the hosts matched again.
+	LoopbackEdge EdgeType = "loopback"
+)
+
+// The name of the host node of the routes without a host condition.
+const AnyHost = "*"
+
+// The special backends of the routes not forwarding to a network
+// backend.
+const (
+	ShuntBackend   = "<shunt>"
+	DynamicBackend = "<dynamic>"
+)
+
+// A node of the graph.
+type Node struct {
+	Id    string   `json:"id"`
+	Type  NodeType `json:"type"`
+	Label string   `json:"label"`
+
+	// Set for the backends that are not referenced by any route.
+	Orphan bool `json:"orphan,omitempty"`
+}
+
+// A directed edge of the graph.
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Type EdgeType `json:"type"`
+
+	// E.g. the weight of a split backend, or the name of the filter
+	// setting the backend.
+	Label string `json:"label,omitempty"`
+}
+
+// The graph of the hosts, the routes and the backends.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+	nodes map[string]*Node
+	edges map[Edge]bool
+}
+
+// the filters that set backends, and their arguments containing the
+// backend addresses
+var filterBackends = map[string]func(args []interface{}) []string{
+	"failover":       failoverBackends,
+	"canary":         argBackends(2),
+	"consistentHash": argBackends(1),
+	"negotiate":      negotiateBackends,
+	"backendHost":    argBackends(0),
+}
+
+func stringArgs(args []interface{}) []string {
+	var s []string
+	for _, a := range args {
+		if as, ok := a.(string); ok {
+			s = append(s, as)
+		}
+	}
+
+	return s
+}
+
+// the string arguments starting from an index
+func argBackends(from int) func([]interface{}) []string {
+	return func(args []interface{}) []string {
+		if len(args) <= from {
+			return nil
+		}
+
+		return stringArgs(args[from:])
+	}
+}
+
+// the backends of the region groups, e.g. "eu=https://a,https://b"
+func failoverBackends(args []interface{}) []string {
+	var b []string
+	for _, g := range stringArgs(args) {
+		if i := strings.Index(g, "="); i >= 0 {
+			g = g[i+1:]
+		}
+
+		for _, gi := range strings.Split(g, ",") {
+			if gi = strings.TrimSpace(gi); gi != "" {
+				b = append(b, gi)
+			}
+		}
+	}
+
+	return b
+}
+
+// every second argument after the header name
+func negotiateBackends(args []interface{}) []string {
+	var b []string
+	for i := 2; i < len(args); i += 2 {
+		if s, ok := args[i].(string); ok {
+			b = append(b, s)
+		}
+	}
+
+	return b
+}
+
+func nodeId(t NodeType, label string) string {
+	return string(t) + ":" + label
+}
+
+func (g *Graph) node(t NodeType, label string) string {
+	id := nodeId(t, label)
+	if _, ok := g.nodes[id]; !ok {
+		n := &Node{Id: id, Type: t, Label: label}
+		g.nodes[id] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+
+	return id
+}
+
+func (g *Graph) edge(from, to string, t EdgeType, label string) {
+	e := Edge{From: from, To: to, Type: t, Label: label}
+	if g.edges[e] {
+		return
+	}
+
+	g.edges[e] = true
+	g.Edges = append(g.Edges, &e)
+}
+
+// collects the host conditions of a predicate expression, except for
+// the negated ones
+func expressionHosts(e *eskip.PredicateExpression) []string {
+	if e == nil {
+		return nil
+	}
+
+	switch e.Operator {
+	case eskip.PredicateMatch:
+		if e.Predicate.Name == "Host" {
+			return stringArgs(e.Predicate.Args)
+		}
+	case eskip.PredicateAnd, eskip.PredicateOr:
+		var h []string
+		for _, o := range e.Operands {
+			h = append(h, expressionHosts(o)...)
+		}
+
+		return h
+	}
+
+	return nil
+}
+
+func routeHosts(r *eskip.Route) []string {
+	h := append(append([]string(nil), r.HostRegexps...), expressionHosts(r.Predicate)...)
+	if len(h) == 0 {
+		h = []string{AnyHost}
+	}
+
+	return h
+}
+
+// the value of the Host header set by the requestHeader filter
+func loopbackHost(r *eskip.Route) (string, bool) {
+	var (
+		host string
+		set  bool
+	)
+
+	for _, f := range r.Filters {
+		args := stringArgs(f.Args)
+		if f.Name == "requestHeader" && len(args) == 2 && strings.EqualFold(args[0], "Host") {
+			host, set = args[1], true
+		}
+	}
+
+	return host, set
+}
+
+// returns the host nodes, whose condition matches a host
+func (g *Graph) matchingHosts(host string) []string {
+	var ids []string
+	for _, n := range g.Nodes {
+		if n.Type != HostNode {
+			continue
+		}
+
+		if n.Label == AnyHost {
+			ids = append(ids, n.Id)
+			continue
+		}
+
+		if rx, err := regexp.Compile(n.Label); err == nil && rx.MatchString(host) {
+			ids = append(ids, n.Id)
+		}
+	}
+
+	return ids
+}
+
+// Builds the graph of the routes.
+func Build(routes []*eskip.Route) *Graph {
+	g := &Graph{
+		Nodes: []*Node{},
+		Edges: []*Edge{},
+		nodes: make(map[string]*Node),
+		edges: make(map[Edge]bool)}
+
+	// the host nodes need to exist before connecting the loopbacks
+	hosts := make(map[*eskip.Route][]string)
+	for _, r := range routes {
+		for _, h := range routeHosts(r) {
+			hosts[r] = append(hosts[r], g.node(HostNode, h))
+		}
+	}
+
+	for _, r := range routes {
+		rid := g.node(RouteNode, r.Id)
+		for _, h := range hosts[r] {
+			g.edge(h, rid, MatchEdge, "")
+		}
+
+		for _, f := range r.Filters {
+			if fb, ok := filterBackends[f.Name]; ok {
+				for _, b := range fb(f.Args) {
+					g.edge(rid, g.node(BackendNode, b), FilterEdge, f.Name)
+				}
+			}
+		}
+
+		switch {
+		case r.Shunt:
+			g.edge(rid, g.node(BackendNode, ShuntBackend), BackendEdge, "")
+		case r.Dynamic:
+			g.edge(rid, g.node(BackendNode, DynamicBackend), BackendEdge, "")
+		case r.Loopback:
+			target := hosts[r]
+			if h, ok := loopbackHost(r); ok {
+				target = g.matchingHosts(h)
+			}
+
+			for _, h := range target {
+				g.edge(rid, h, LoopbackEdge, "")
+			}
+		case len(r.SplitBackends) > 0:
+			for _, b := range r.SplitBackends {
+				g.edge(rid, g.node(BackendNode, b.Backend), BackendEdge, fmt.Sprint(b.Weight))
+			}
+		default:
+			g.edge(rid, g.node(BackendNode, r.Backend), BackendEdge, "")
+		}
+	}
+
+	return g
+}
+
+// Adds the known backends that are not referenced by any route to the
+// graph, marked as orphans, and returns them, sorted.
+func (g *Graph) AddOrphans(known []string) []string {
+	var orphans []string
+	for _, b := range known {
+		id := nodeId(BackendNode, b)
+		if _, ok := g.nodes[id]; ok {
+			continue
+		}
+
+		g.node(BackendNode, b)
+		g.nodes[id].Orphan = true
+		orphans = append(orphans, b)
+	}
+
+	sort.Strings(orphans)
+	return orphans
+}
+
+func quoteDOT(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+var dotShapes = map[NodeType]string{
+	HostNode:    "box",
+	RouteNode:   "ellipse",
+	BackendNode: "component",
+}
+
+// Writes the graph in the DOT format.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	lines := []string{"digraph routes {", "  rankdir=LR;"}
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=%s, shape=%s", quoteDOT(n.Label), dotShapes[n.Type])
+		if n.Orphan {
+			attrs += ", style=dashed"
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s [%s];", quoteDOT(n.Id), attrs))
+	}
+
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+quoteDOT(e.Label))
+		}
+
+		if e.Type == LoopbackEdge || e.Type == FilterEdge {
+			attrs = append(attrs, "style=dashed")
+		}
+
+		var a string
+		if len(attrs) > 0 {
+			a = " [" + strings.Join(attrs, ", ") + "]"
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s -> %s%s;", quoteDOT(e.From), quoteDOT(e.To), a))
+	}
+
+	lines = append(lines, "}", "")
+	_, err := io.WriteString(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// Writes the graph as JSON, with the nodes and the edges.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routegraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/zalando/skipper/eskip"
+	"strings"
+	"testing"
+)
+
+const testRoutes = `
+	api: Host("^api[.]example[.]org$") -> "https://api.internal";
+	split: Host("^www[.]example[.]org$") && Path("/new")
+		-> <split 90 "https://stable.internal", 10 "https://canary.internal">;
+	legacy: Host("^www[.]example[.]org$")
+		-> requestHeader("Host", "api.example.org")
+		-> <loopback>;
+	self: Host("^self[.]example[.]org$") -> <loopback>;
+	regions: Path("/regions")
+		-> failover("eu=https://eu-1.internal,https://eu-2.internal", "us=https://us.internal")
+		-> <dynamic>;
+	health: Path("/health") -> <shunt>`
+
+func buildTestGraph(t *testing.T) *Graph {
+	routes, err := eskip.Parse(testRoutes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Build(routes)
+}
+
+func hasEdge(g *Graph, from, to string, typ EdgeType, label string) bool {
+	for _, e := range g.Edges {
+		if *e == (Edge{From: from, To: to, Type: typ, Label: label}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestBuild(t *testing.T) {
+	g := buildTestGraph(t)
+	for _, ti := range []struct {
+		from, to string
+		typ      EdgeType
+		label    string
+	}{
+		{"host:^api[.]example[.]org$", "route:api", MatchEdge, ""},
+		{"route:api", "backend:https://api.internal", BackendEdge, ""},
+		{"route:split", "backend:https://stable.internal", BackendEdge, "90"},
+		{"route:split", "backend:https://canary.internal", BackendEdge, "10"},
+		{"route:legacy", "host:^api[.]example[.]org$", LoopbackEdge, ""},
+		{"route:legacy", "host:*", LoopbackEdge, ""},
+		{"route:self", "host:^self[.]example[.]org$", LoopbackEdge, ""},
+		{"host:*", "route:regions", MatchEdge, ""},
+		{"route:regions", "backend:https://eu-2.internal", FilterEdge, "failover"},
+		{"route:regions", "backend:https://us.internal", FilterEdge, "failover"},
+		{"route:regions", "backend:<dynamic>", BackendEdge, ""},
+		{"route:health", "backend:<shunt>", BackendEdge, ""},
+	} {
+		if !hasEdge(g, ti.from, ti.to, ti.typ, ti.label) {
+			t.Error("missing edge", ti.from, ti.to, ti.typ, ti.label)
+		}
+	}
+
+	if hasEdge(g, "route:legacy", "host:^www[.]example[.]org$", LoopbackEdge, "") {
+		t.Error("unexpected loopback to the original host")
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	g := buildTestGraph(t)
+	orphans := g.AddOrphans([]string{"https://api.internal", "https://old.internal", "https://older.internal"})
+	if len(orphans) != 2 || orphans[0] != "https://old.internal" || orphans[1] != "https://older.internal" {
+		t.Error("failed to find the orphans", orphans)
+	}
+
+	if !g.nodes["backend:https://old.internal"].Orphan || g.nodes["backend:https://api.internal"].Orphan {
+		t.Error("failed to mark the orphans")
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := buildTestGraph(t)
+	g.AddOrphans([]string{"https://old.internal"})
+
+	var b bytes.Buffer
+	if err := g.WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	dot := b.String()
+	for _, s := range []string{
+		"digraph routes {",
+		`"route:api" [label="api", shape=ellipse];`,
+		`"route:split" -> "backend:https://canary.internal" [label="10"];`,
+		`"route:legacy" -> "host:^api[.]example[.]org$" [style=dashed];`,
+		`"backend:https://old.internal" [label="https://old.internal", shape=component, style=dashed];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("missing from the output: %s\n%s", s, dot)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := buildTestGraph(t).WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var g Graph
+	if err := json.Unmarshal(b.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g.Nodes) == 0 || !hasEdge(&g, "route:api", "backend:https://api.internal", BackendEdge, "") {
+		t.Error("failed to export the graph", b.String())
+	}
+}
+
+func TestEmptyJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := Build(nil).WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(b.String(), "null") {
+		t.Error("unexpected null in the output", b.String())
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package routestore defines the common interface of the storage services,
+where the skipper routes are stored under individual keys, and can be
+updated one by one, e.g. etcd, Consul or DynamoDB.
+
+A RouteStore is turned into a routing DataClient by the LoadAll and
+LoadUpdate functions of this package, which log and skip the invalid
+route expressions, instead of failing the whole update.
+
+The stores keep the route expressions with a document header, see
+eskip.WithHeader, to detect the partially written values.
+
+The stores implementing GenerationStore, currently etcd, can also
+replace the complete set of routes atomically, and roll back to the
+previous set.
+*/
+package routestore
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+	"sort"
+)
+
+// RouteInfo contains a route id, plus the loaded and parsed route or
+// the parse error in case of failure.
+type RouteInfo struct {
+
+	// The route id plus the route data or if parsing was successful.
+	eskip.Route
+
+	// The parsing error if the parsing failed.
+	ParseError error
+}
+
+// A RouteStore loads and stores the route definitions under individual
+// keys, where the keys are used as the route ids.
+type RouteStore interface {
+
+	// Returns all the route definitions currently stored, or the
+	// parsing error of the invalid ones.
+	GetInitial() ([]*RouteInfo, error)
+
+	// Returns the added or changed routes and the ids of the deleted
+	// routes since the last call to GetInitial or GetUpdates. It may
+	// block until the next change is detected.
+	GetUpdates() ([]*RouteInfo, []string, error)
+
+	// Inserts or updates a route.
+	Upsert(*eskip.Route) error
+
+	// Deletes a route. Deleting a missing route is not an error.
+	Delete(id string) error
+}
+
+// A GenerationStore can replace the complete set of the stored routes
+// atomically, so that the clients never receive a mix of the old and the
+// new routes, and it can restore the previous set.
+type GenerationStore interface {
+	RouteStore
+
+	// Stores the routes as a new generation, and activates it
+	// atomically. Returns the name of the generation.
+	Publish([]*eskip.Route) (string, error)
+
+	// Activates the previous generation. Returns its name.
+	Rollback() (string, error)
+}
+
+// Returned by the stores when storing or deleting a route without id.
+var ErrMissingRouteId = errors.New("missing route id")
+
+// Parses a single route expression, fails if more than one
+// expressions in the data, or when the document header doesn't match
+// the content, e.g. because of a partial write.
+func ParseOne(id, data string) (*eskip.Route, error) {
+	d, err := eskip.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Routes) != 1 {
+		return nil, errors.New("invalid route entry: multiple route expressions")
+	}
+
+	r := d.Routes[0]
+	r.Id = id
+	return r, nil
+}
+
+// Parses a set of route expressions, where the keys of the map are the
+// route ids. The result is ordered by the route ids.
+func ParseRoutes(data map[string]string) []*RouteInfo {
+	var ids []string
+	for id := range data {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	allInfo := make([]*RouteInfo, len(ids))
+	for i, id := range ids {
+		info := &RouteInfo{}
+
+		r, err := ParseOne(id, data[id])
+		if err == nil {
+			info.Route = *r
+		} else {
+			info.ParseError = err
+		}
+
+		info.Id = id
+		allInfo[i] = info
+	}
+
+	return allInfo
+}
+
+// Compares two versions of the stored route expressions, and returns
+// the added or changed ones and the ids of the deleted ones. Meant for
+// the stores that can only poll the complete set of routes.
+func Diff(previous, current map[string]string) (map[string]string, []string) {
+	changed := make(map[string]string)
+	for id, data := range current {
+		if p, ok := previous[id]; !ok || p != data {
+			changed[id] = data
+		}
+	}
+
+	var deleted []string
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+
+	sort.Strings(deleted)
+	return changed, deleted
+}
+
+// Converts route info to route objects logging those whose
+// parsing failed.
+func infoToRoutesLogged(info []*RouteInfo) []*eskip.Route {
+	var routes []*eskip.Route
+	for _, ri := range info {
+		if ri.ParseError == nil {
+			routes = append(routes, &ri.Route)
+		} else {
+			log.Println("error while parsing routes", ri.Id, ri.ParseError)
+		}
+	}
+
+	return routes
+}
+
+// Returns all the valid route definitions of a store, logging the
+// invalid ones. It can be used to implement the LoadAll method of the
+// routing DataClient interface.
+func LoadAll(s RouteStore) ([]*eskip.Route, error) {
+	info, err := s.GetInitial()
+	if err != nil {
+		return nil, err
+	}
+
+	return infoToRoutesLogged(info), nil
+}
+
+// Returns the valid updated routes and the deleted ids of a store,
+// logging the invalid routes. It can be used to implement the
+// LoadUpdate method of the routing DataClient interface.
+func LoadUpdate(s RouteStore) ([]*eskip.Route, []string, error) {
+	info, deleted, err := s.GetUpdates()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return infoToRoutesLogged(info), deleted, nil
+}
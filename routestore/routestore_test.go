@@ -0,0 +1,97 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routestore
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	info := ParseRoutes(map[string]string{
+		"foo": eskip.WithHeader(`Path("/foo") -> "https://foo.example.org"`),
+		"bar": eskip.WithHeader(`Path("/bar") -> <shunt>`),
+		"baz": `Path("/baz") ->`,
+		"qux": eskip.WithHeader(`Path("/qux") -> <shunt>; Path("/quux") -> <shunt>`),
+	})
+
+	if len(info) != 4 {
+		t.Fatal("invalid number of routes", len(info))
+	}
+
+	for i, expected := range []struct {
+		id    string
+		valid bool
+	}{{"bar", true}, {"baz", false}, {"foo", true}, {"qux", false}} {
+		if info[i].Id != expected.id || (info[i].ParseError == nil) != expected.valid {
+			t.Error("invalid route info", info[i].Id, info[i].ParseError)
+		}
+	}
+
+	if info[2].Path != "/foo" || info[2].Backend != "https://foo.example.org" {
+		t.Error("failed to parse the route", info[2].Route.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	changed, deleted := Diff(
+		map[string]string{"foo": "1", "bar": "1", "baz": "1"},
+		map[string]string{"foo": "1", "bar": "2", "qux": "1"})
+
+	if !reflect.DeepEqual(changed, map[string]string{"bar": "2", "qux": "1"}) {
+		t.Error("invalid changes", changed)
+	}
+
+	if !reflect.DeepEqual(deleted, []string{"baz"}) {
+		t.Error("invalid deletes", deleted)
+	}
+}
+
+type testStore struct {
+	data    map[string]string
+	updates map[string]string
+	deleted []string
+}
+
+func (s *testStore) GetInitial() ([]*RouteInfo, error) { return ParseRoutes(s.data), nil }
+
+func (s *testStore) GetUpdates() ([]*RouteInfo, []string, error) {
+	return ParseRoutes(s.updates), s.deleted, nil
+}
+
+func (s *testStore) Upsert(*eskip.Route) error { return nil }
+func (s *testStore) Delete(string) error       { return nil }
+
+func TestLoadSkipsInvalidRoutes(t *testing.T) {
+	s := &testStore{
+		data: map[string]string{
+			"foo": eskip.WithHeader(`Path("/foo") -> <shunt>`),
+			"bar": `Path("/bar") ->`},
+		updates: map[string]string{
+			"baz": eskip.WithHeader(`Path("/baz") -> <shunt>`),
+			"qux": `Path("/qux") ->`},
+		deleted: []string{"foo"}}
+
+	routes, err := LoadAll(s)
+	if err != nil || len(routes) != 1 || routes[0].Id != "foo" {
+		t.Error("failed to load the valid routes", routes, err)
+	}
+
+	routes, deleted, err := LoadUpdate(s)
+	if err != nil || len(routes) != 1 || routes[0].Id != "baz" || !reflect.DeepEqual(deleted, []string{"foo"}) {
+		t.Error("failed to load the valid updates", routes, deleted, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HostAliases maps alias hosts to the hosts that the routes expect, e.g.
+// www.example.org to example.org. The keys starting with "*." match
+// every subdomain of the rest of the key, at any depth, e.g.
+// *.example.org matches www.example.org and a.b.example.org, but not
+// example.org. The exact aliases take precedence, and from the wildcard
+// ones, the one with the longest suffix. The hosts are expected in
+// lowercase, without the port.
+type HostAliases map[string]string
+
+// Parses a comma separated list of alias=host pairs, e.g.:
+//
+//     www.example.org=example.org,*.example.net=example.net
+func ParseHostAliases(s string) (HostAliases, error) {
+	a := make(HostAliases)
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		kv := strings.Split(p, "=")
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid host alias: %s", p)
+		}
+
+		alias, host := CanonicalHost(strings.TrimSpace(kv[0])), CanonicalHost(strings.TrimSpace(kv[1]))
+		if alias == "" || host == "" || alias == "*." || strings.Contains(host, "*") ||
+			strings.Contains(strings.TrimPrefix(alias, "*."), "*") {
+			return nil, fmt.Errorf("invalid host alias: %s", p)
+		}
+
+		a[alias] = host
+	}
+
+	return a, nil
+}
+
+// Sets the alias hosts, that are replaced with the host they stand for,
+// before matching the requests. The Host header forwarded to the
+// backends is not changed. The aliases take effect immediately.
+func (r *Routing) SetHostAliases(a HostAliases) {
+	r.hostAliases.Store(a)
+}
+
+// returns the host that an alias stands for, or false, when the host is
+// not an alias
+func (a HostAliases) resolve(host string) (string, bool) {
+	if h, ok := a[host]; ok {
+		return h, true
+	}
+
+	for i := strings.Index(host, "."); i >= 0; {
+		if h, ok := a["*"+host[i:]]; ok {
+			return h, true
+		}
+
+		next := strings.Index(host[i+1:], ".")
+		if next < 0 {
+			break
+		}
+
+		i += next + 1
+	}
+
+	return "", false
+}
+
+// returns a copy of the request with the host resolved, when it is an
+// alias, otherwise the original request
+func (a HostAliases) apply(r *http.Request, o MatchingOptions) *http.Request {
+	if len(a) == 0 {
+		return r
+	}
+
+	h := r.Host
+	if !o.noCanonicalization() {
+		h = CanonicalHost(h)
+	}
+
+	h, ok := a.resolve(h)
+	if !ok {
+		return r
+	}
+
+	rr := *r
+	rr.Host = h
+	return &rr
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseHostAliases(t *testing.T) {
+	a, err := ParseHostAliases(" www.example.org=example.org, *.Example.net:80=example.net,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a) != 2 || a["www.example.org"] != "example.org" || a["*.example.net"] != "example.net" {
+		t.Error("failed to parse the aliases", a)
+	}
+
+	for _, s := range []string{
+		"www.example.org",
+		"www.example.org=",
+		"=example.org",
+		"a=b=c",
+		"*.=example.org",
+		"www.example.org=*.example.org",
+		"*.*.example.org=example.org",
+	} {
+		if _, err := ParseHostAliases(s); err == nil {
+			t.Error("failed to fail", s)
+		}
+	}
+}
+
+func TestResolveHostAliases(t *testing.T) {
+	a := HostAliases{
+		"www.example.org":   "example.org",
+		"*.example.org":     "wildcard.example.org",
+		"*.api.example.org": "api.example.org",
+	}
+
+	for _, ti := range []struct {
+		host, expected string
+		ok             bool
+	}{
+		{"www.example.org", "example.org", true},
+		{"foo.example.org", "wildcard.example.org", true},
+		{"a.b.example.org", "wildcard.example.org", true},
+		{"v1.api.example.org", "api.example.org", true},
+		{"example.org", "", false},
+		{"www.example.net", "", false},
+		{"localhost", "", false},
+	} {
+		if h, ok := a.resolve(ti.host); h != ti.expected || ok != ti.ok {
+			t.Error("invalid alias", ti.host, h, ok)
+		}
+	}
+}
+
+func TestApplyHostAliases(t *testing.T) {
+	a := HostAliases{"www.example.org": "example.org"}
+	r, _ := http.NewRequest("GET", "https://WWW.example.org:443/", nil)
+	if ar := a.apply(r, MatchingOptionsNone); ar == r || ar.Host != "example.org" || r.Host != "WWW.example.org:443" {
+		t.Error("failed to resolve the alias", ar.Host, r.Host)
+	}
+
+	if ar := a.apply(r, NoCanonicalization); ar != r {
+		t.Error("unexpected alias of the raw host")
+	}
+
+	r.Host = "example.org"
+	if ar := a.apply(r, MatchingOptionsNone); ar != r {
+		t.Error("unexpected copy of the request")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The name of the built-in predicate matching the requests received in
+// a fixed time window, e.g.
+// Between("2024-11-29T00:00Z", "2024-12-02T00:00Z").
+const BetweenName = "Between"
+
+// the accepted time formats, RFC3339 with or without the seconds
+var betweenLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00"}
+
+type betweenSpec struct {
+	now func() time.Time
+}
+
+// matches the requests from the start, inclusive, until the end,
+// exclusive
+type betweenPredicate struct {
+	from, to time.Time
+	now      func() time.Time
+}
+
+func (s *betweenSpec) Name() string { return BetweenName }
+
+func parseBetweenTime(s string) (time.Time, error) {
+	for _, l := range betweenLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time for predicate %s: %s", BetweenName, s)
+}
+
+// Creates a time window predicate with the start and the end of the
+// window.
+func (s *betweenSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(BetweenName, args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &betweenPredicate{now: s.now}
+	if p.from, err = parseBetweenTime(a[0]); err != nil {
+		return nil, err
+	}
+
+	if p.to, err = parseBetweenTime(a[1]); err != nil {
+		return nil, err
+	}
+
+	if !p.from.Before(p.to) {
+		return nil, fmt.Errorf("invalid time window for predicate %s: %s - %s", BetweenName, a[0], a[1])
+	}
+
+	return p, nil
+}
+
+func (p *betweenPredicate) Match(*http.Request) bool {
+	now := p.now()
+	return !now.Before(p.from) && now.Before(p.to)
+}
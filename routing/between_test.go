@@ -0,0 +1,64 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBetween(t *testing.T) {
+	var now time.Time
+	s := &betweenSpec{now: func() time.Time { return now }}
+	p, err := s.Create([]interface{}{"2024-11-29T00:00Z", "2024-12-02T00:00:00+01:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		utc      string
+		expected bool
+	}{
+		{"2024-11-28T23:59:59Z", false},
+		{"2024-11-29T00:00:00Z", true},
+		{"2024-12-01T22:59:59Z", true},
+		{"2024-12-01T23:00:00Z", false},
+	} {
+		now, err = time.Parse(time.RFC3339, ti.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Match(nil) != ti.expected {
+			t.Error("invalid match", ti.utc, ti.expected)
+		}
+	}
+}
+
+func TestInvalidBetween(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"2024-11-29T00:00Z"},
+		{"2024-11-29", "2024-12-02"},
+		{42, "2024-12-02T00:00Z"},
+		{"2024-12-02T00:00Z", "2024-11-29T00:00Z"},
+		{"2024-11-29T00:00Z", "2024-11-29T00:00Z"},
+		{"2024-11-29T00:00Z", "2024-12-02T00:00Z", "2024-12-03T00:00Z"},
+	} {
+		if _, err := (&betweenSpec{now: time.Now}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
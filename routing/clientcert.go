@@ -0,0 +1,156 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The name of the built-in predicate matching the fields of the verified
+// client certificate, e.g. ClientCert("cn", /^partner-/) or
+// ClientCert("san", /[.]partners[.]example[.]org$/).
+const ClientCertName = "ClientCert"
+
+type clientCertSpec struct{}
+
+// matches a field of the verified client certificate
+type clientCertPredicate struct {
+	field string
+	value *regexp.Regexp
+}
+
+// Returns the verified client certificate of a request, the leaf of the
+// first verified chain, or nil, when the client didn't present a
+// certificate, or the TLS server didn't verify it.
+func VerifiedClientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// escapes an attribute value of a distinguished name as defined in
+// RFC 4514, so that the value cannot be mistaken for further attributes.
+func escapeAttributeValue(v string) string {
+	var b []byte
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';' || c == '=':
+			b = append(b, '\\', c)
+		case i == 0 && (c == '#' || c == ' '):
+			b = append(b, '\\', c)
+		case i == len(v)-1 && c == ' ':
+			b = append(b, '\\', c)
+		case c == 0:
+			b = append(b, '\\', '0', '0')
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return string(b)
+}
+
+// Formats a distinguished name, e.g. the subject of a certificate, as
+// comma separated attributes, starting with the most specific one, e.g.
+// CN=api.example.org,OU=Platform,O=Example,C=DE. The special characters
+// of the values are escaped as defined in RFC 4514.
+func FormatDistinguishedName(n pkix.Name) string {
+	var parts []string
+	add := func(key string, values ...string) {
+		for _, v := range values {
+			parts = append(parts, key+"="+escapeAttributeValue(v))
+		}
+	}
+
+	if n.CommonName != "" {
+		add("CN", n.CommonName)
+	}
+
+	add("OU", n.OrganizationalUnit...)
+	add("O", n.Organization...)
+	add("L", n.Locality...)
+	add("ST", n.Province...)
+	add("C", n.Country...)
+	return strings.Join(parts, ",")
+}
+
+// Returns the subject alternative names of a certificate: the DNS names,
+// the email addresses and the IP addresses.
+func SubjectAltNames(c *x509.Certificate) []string {
+	names := append([]string(nil), c.DNSNames...)
+	names = append(names, c.EmailAddresses...)
+	for _, ip := range c.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	return names
+}
+
+func (s *clientCertSpec) Name() string { return ClientCertName }
+
+// Creates a client certificate predicate with the name of the field,
+// cn, subject, issuer or san, and a regular expression matching its
+// value. In case of san, any of the alternative names can match.
+func (s *clientCertSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(ClientCertName, args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a[0] {
+	case "cn", "subject", "issuer", "san":
+	default:
+		return nil, fmt.Errorf("invalid field for predicate %s: %s", ClientCertName, a[0])
+	}
+
+	rx, err := regexp.Compile(a[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientCertPredicate{field: a[0], value: rx}, nil
+}
+
+func (p *clientCertPredicate) Match(req *http.Request) bool {
+	c := VerifiedClientCertificate(req)
+	if c == nil {
+		return false
+	}
+
+	switch p.field {
+	case "cn":
+		return p.value.MatchString(c.Subject.CommonName)
+	case "subject":
+		return p.value.MatchString(FormatDistinguishedName(c.Subject))
+	case "issuer":
+		return p.value.MatchString(FormatDistinguishedName(c.Issuer))
+	default:
+		for _, n := range SubjectAltNames(c) {
+			if p.value.MatchString(n) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
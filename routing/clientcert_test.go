@@ -0,0 +1,143 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func clientCert(cn string, dnsNames ...string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   cn,
+			Organization: []string{"Example"},
+			Country:      []string{"DE"}},
+		Issuer:      pkix.Name{CommonName: "Example CA"},
+		DNSNames:    dnsNames,
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}
+}
+
+func TestFormatDistinguishedName(t *testing.T) {
+	if n := FormatDistinguishedName(clientCert("partner-a").Subject); n != "CN=partner-a,O=Example,C=DE" {
+		t.Error("invalid distinguished name", n)
+	}
+}
+
+func TestFormatDistinguishedNameEscapesValues(t *testing.T) {
+	for _, ti := range []struct {
+		cn       string
+		expected string
+	}{{
+		"x,O=Trusted Partner",
+		`CN=x\,O\=Trusted Partner,O=Example,C=DE`,
+	}, {
+		`a+b;"c"<d>\e`,
+		`CN=a\+b\;\"c\"\<d\>\\e,O=Example,C=DE`,
+	}, {
+		"#partner ",
+		`CN=\#partner\ ,O=Example,C=DE`,
+	}, {
+		" partner",
+		`CN=\ partner,O=Example,C=DE`,
+	}} {
+		if n := FormatDistinguishedName(clientCert(ti.cn).Subject); n != ti.expected {
+			t.Error("invalid distinguished name", ti.cn, n)
+		}
+	}
+}
+
+func TestClientCertSubjectNotForgedByCommonName(t *testing.T) {
+	p, err := (&clientCertSpec{}).Create([]interface{}{"subject", "(^|,)O=Trusted Partner(,|$)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &http.Request{TLS: &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{clientCert("x,O=Trusted Partner")}}}}
+	if p.Match(req) {
+		t.Error("the common name forged the organization of the subject")
+	}
+}
+
+func TestMatchClientCert(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		partner: Path("/foo") && ClientCert("cn", /^partner-/) -> "https://partner.example.org";
+		subject: Path("/foo") && ClientCert("subject", /O=Example/) -> "https://subject.example.org";
+		san: Path("/bar") && ClientCert("san", /[.]internal$/) -> "https://san.example.org";
+		ip: Path("/baz") && ClientCert("san", /^10[.]/) -> "https://ip.example.org";
+		issuer: Path("/baz") && ClientCert("issuer", /^CN=Other CA$/) -> "https://issuer.example.org";
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org";
+		baz: Path("/baz") -> "https://baz.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, ti := range []struct {
+		path     string
+		cert     *x509.Certificate
+		verified bool
+		expected string
+	}{
+		{"/foo", nil, false, "foo"},
+		{"/foo", clientCert("partner-a"), false, "foo"},
+		{"/foo", clientCert("partner-a"), true, "partner"},
+		{"/foo", clientCert("other"), true, "subject"},
+		{"/bar", clientCert("svc", "svc.internal"), true, "san"},
+		{"/bar", clientCert("svc", "svc.example.org"), true, "bar"},
+		{"/baz", clientCert("svc"), true, "ip"},
+	} {
+		req, err := newRequest("GET", ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ti.cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{ti.cert}}
+			if ti.verified {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{ti.cert}}
+			}
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.path, ti.cert, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidClientCert(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"cn"},
+		{42, "foo"},
+		{"serial", "foo"},
+		{"cn", "["},
+		{"cn", "foo", "bar"},
+	} {
+		if _, err := (&clientCertSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
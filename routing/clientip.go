@@ -0,0 +1,191 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The name of the built-in predicate matching the address of the client
+// to a list of IP addresses and CIDR ranges, e.g.
+// ClientIP("10.0.0.0/8", "192.168.1.5").
+const ClientIPName = "ClientIP"
+
+var errNoClientIPs = errors.New("missing client IP")
+
+// A list of IP ranges, used to match the address of the clients.
+type IPRanges []*net.IPNet
+
+// Parses a list of IP addresses and CIDR ranges, e.g. "10.0.0.0/8" or
+// "192.168.1.5". The single addresses are treated as ranges containing
+// only the address itself.
+func ParseIPRanges(s []string) (IPRanges, error) {
+	if len(s) == 0 {
+		return nil, errNoClientIPs
+	}
+
+	r := make(IPRanges, len(s))
+	for i, si := range s {
+		if !strings.Contains(si, "/") {
+			ip := net.ParseIP(si)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: si}
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			r[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(si)
+		if err != nil {
+			return nil, err
+		}
+
+		r[i] = n
+	}
+
+	return r, nil
+}
+
+// Tells whether any of the ranges contains the IP address.
+func (r IPRanges) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range r {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The proxies in front of skipper, e.g. load balancers, whose addresses
+// are skipped, when taking the address of the client from the
+// X-Forwarded-For header. See ClientIP.
+type TrustedProxies struct {
+
+	// The number of the proxies in front of skipper, e.g. 1, when
+	// skipper runs behind a single load balancer. The remote address
+	// of the connection and the last Hops-1 addresses of the
+	// X-Forwarded-For header are considered to be these proxies.
+	Hops int
+
+	// The addresses of the trusted proxies.
+	Ranges IPRanges
+}
+
+var (
+	trustedProxiesMx sync.RWMutex
+	trustedProxies   TrustedProxies
+)
+
+// Sets the proxies trusted by ClientIP. By default, no proxies are
+// trusted, and the X-Forwarded-For header is ignored.
+func SetTrustedProxies(p TrustedProxies) {
+	trustedProxiesMx.Lock()
+	defer trustedProxiesMx.Unlock()
+	trustedProxies = p
+}
+
+// Returns the IP address of the client of a request. It takes the
+// remote address of the connection, and the addresses of the
+// X-Forwarded-For header, from right to left, and returns the first
+// one that doesn't belong to a trusted proxy, see SetTrustedProxies.
+// When all of them are trusted, it returns the left-most address.
+// Returns nil, when the address cannot be parsed.
+//
+// Since the clients can set the X-Forwarded-For header themselves, only
+// the addresses appended by the trusted proxies are used. Without
+// trusted proxies, the remote address of the connection is returned.
+func ClientIP(r *http.Request) net.IP {
+	h, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		h = r.RemoteAddr
+	}
+
+	trustedProxiesMx.RLock()
+	tp := trustedProxies
+	trustedProxiesMx.RUnlock()
+
+	if tp.Hops <= 0 && len(tp.Ranges) == 0 {
+		return net.ParseIP(h)
+	}
+
+	// the addresses starting from the nearest one
+	addrs := []string{h}
+	ff := r.Header["X-Forwarded-For"]
+	for i := len(ff) - 1; i >= 0; i-- {
+		fi := strings.Split(ff[i], ",")
+		for j := len(fi) - 1; j >= 0; j-- {
+			addrs = append(addrs, strings.TrimSpace(fi[j]))
+		}
+	}
+
+	var ip net.IP
+	for i, a := range addrs {
+		ip = net.ParseIP(a)
+		if i < tp.Hops || tp.Ranges.Contains(ip) {
+			continue
+		}
+
+		return ip
+	}
+
+	return ip
+}
+
+// matches the client address of the request to the ranges
+func matchClientIP(req *http.Request, r IPRanges) bool {
+	return r.Contains(ClientIP(req))
+}
+
+type clientIPSpec struct{}
+
+// matches the client address of the request to the ranges
+type clientIPPredicate IPRanges
+
+func (s *clientIPSpec) Name() string { return ClientIPName }
+
+// Creates a client IP predicate with one or more IP addresses and CIDR
+// ranges.
+func (s *clientIPSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(ClientIPName, args, 1, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ParseIPRanges(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientIPPredicate(r), nil
+}
+
+func (p clientIPPredicate) Match(req *http.Request) bool {
+	return matchClientIP(req, IPRanges(p))
+}
@@ -0,0 +1,235 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseIPRanges(t *testing.T) {
+	for _, ti := range []struct {
+		title string
+		ips   []string
+		fail  bool
+		in    []string
+		out   []string
+	}{{
+		title: "empty",
+		fail:  true,
+	}, {
+		title: "invalid address",
+		ips:   []string{"10.0.0.256"},
+		fail:  true,
+	}, {
+		title: "invalid range",
+		ips:   []string{"10.0.0.0/33"},
+		fail:  true,
+	}, {
+		title: "single addresses",
+		ips:   []string{"192.168.1.5", "2001:db8::1"},
+		in:    []string{"192.168.1.5", "::ffff:192.168.1.5", "2001:db8::1"},
+		out:   []string{"192.168.1.6", "2001:db8::2"},
+	}, {
+		title: "ranges",
+		ips:   []string{"10.0.0.0/8", "2001:db8::/32"},
+		in:    []string{"10.1.2.3", "2001:db8:1::1"},
+		out:   []string{"11.0.0.1", "2001:db9::1"},
+	}} {
+		r, err := ParseIPRanges(ti.ips)
+		if ti.fail {
+			if err == nil {
+				t.Error(ti.title, "failed to fail")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Error(ti.title, err)
+			continue
+		}
+
+		for _, ip := range ti.in {
+			if !r.Contains(net.ParseIP(ip)) {
+				t.Error(ti.title, "failed to contain", ip)
+			}
+		}
+
+		for _, ip := range ti.out {
+			if r.Contains(net.ParseIP(ip)) {
+				t.Error(ti.title, "unexpectedly contains", ip)
+			}
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseIPRanges([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer SetTrustedProxies(TrustedProxies{})
+
+	for _, ti := range []struct {
+		title      string
+		proxies    TrustedProxies
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{{
+		title:      "remote address",
+		remoteAddr: "192.168.1.5:38123",
+		expected:   "192.168.1.5",
+	}, {
+		title:      "remote address without port",
+		remoteAddr: "192.168.1.5",
+		expected:   "192.168.1.5",
+	}, {
+		title:      "ipv6 remote address",
+		remoteAddr: "[2001:db8::1]:38123",
+		expected:   "2001:db8::1",
+	}, {
+		title:      "forwarded address ignored without trusted proxies",
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "203.0.113.7",
+		expected:   "10.0.0.1",
+	}, {
+		title:      "forwarded address of a single trusted hop",
+		proxies:    TrustedProxies{Hops: 1},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  " 203.0.113.7 , 203.0.113.8",
+		expected:   "203.0.113.8",
+	}, {
+		title:      "forwarded address of multiple trusted hops",
+		proxies:    TrustedProxies{Hops: 2},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "198.51.100.1, 203.0.113.7, 10.0.0.2",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "spoofed forwarded address",
+		proxies:    TrustedProxies{Hops: 1},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "10.0.0.5, 203.0.113.7",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "right-most untrusted address",
+		proxies:    TrustedProxies{Ranges: trusted},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "198.51.100.1, 203.0.113.7, 10.0.0.2",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "multiple forwarded headers",
+		proxies:    TrustedProxies{Ranges: trusted},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "198.51.100.1, 203.0.113.7\n10.0.0.3, 10.0.0.2",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "untrusted remote address",
+		proxies:    TrustedProxies{Ranges: trusted},
+		remoteAddr: "203.0.113.7:38123",
+		forwarded:  "198.51.100.1",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "all trusted",
+		proxies:    TrustedProxies{Ranges: trusted},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "10.0.0.3, 10.0.0.2",
+		expected:   "10.0.0.3",
+	}, {
+		title:      "less forwarded addresses than trusted hops",
+		proxies:    TrustedProxies{Hops: 3},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "203.0.113.7",
+		expected:   "203.0.113.7",
+	}, {
+		title:      "invalid forwarded address",
+		proxies:    TrustedProxies{Hops: 1},
+		remoteAddr: "10.0.0.1:38123",
+		forwarded:  "unknown",
+	}, {
+		title:      "invalid remote address",
+		remoteAddr: "pipe",
+	}} {
+		SetTrustedProxies(ti.proxies)
+		req := &http.Request{RemoteAddr: ti.remoteAddr, Header: make(http.Header)}
+		for _, f := range strings.Split(ti.forwarded, "\n") {
+			if f != "" {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+		}
+
+		ip := ClientIP(req)
+		if ti.expected == "" {
+			if ip != nil {
+				t.Error(ti.title, "unexpected address", ip)
+			}
+
+			continue
+		}
+
+		if !ip.Equal(net.ParseIP(ti.expected)) {
+			t.Error(ti.title, "invalid address", ip, ti.expected)
+		}
+	}
+}
+
+func TestMatchClientIP(t *testing.T) {
+	m, err := docToMatcher(`
+		internal: Path("/admin") && ClientIP("10.0.0.0/8", "192.168.1.5") -> "https://internal.example.org";
+		external: Path("/admin") && !ClientIP("10.0.0.0/8", "192.168.1.0/24") -> "https://external.example.org";
+		fallback: Path("/admin") -> "https://fallback.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"10.1.2.3:38123", "internal"},
+		{"192.168.1.5:38123", "internal"},
+		{"203.0.113.7:38123", "external"},
+		{"192.168.1.6:38123", "fallback"},
+	} {
+		req, err := http.NewRequest("GET", "https://www.example.org/admin", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = ti.remoteAddr
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("failed to match", ti.remoteAddr, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidClientIPPredicate(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{"10.0.0.0/8", 42},
+		{"10.0.0.0/33"},
+		{"localhost"},
+	} {
+		if _, err := (&clientIPSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+const (
+
+	// The name of the built-in predicate matching the TLS version of
+	// the client connection, e.g. ClientTLSVersion("1.2").
+	ClientTLSVersionName = "ClientTLSVersion"
+
+	// The name of the built-in predicate matching the requests whose
+	// client presented a certificate on the TLS connection, e.g.
+	// ClientCertificate().
+	ClientCertificateName = "ClientCertificate"
+)
+
+// the TLS versions accepted by the ClientTLSVersion predicate
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12}
+
+type clientTLSVersionSpec struct{}
+
+// matches the TLS version of the client connection. Plain HTTP requests
+// don't match.
+type clientTLSVersionPredicate uint16
+
+type clientCertificateSpec struct{}
+
+// matches when the client presented a certificate on the TLS connection
+type clientCertificatePredicate struct{}
+
+func (s *clientTLSVersionSpec) Name() string { return ClientTLSVersionName }
+
+// Creates a TLS version predicate with one of the versions 1.0, 1.1 or
+// 1.2.
+func (s *clientTLSVersionSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(ClientTLSVersionName, args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := tlsVersions[a[0]]
+	if !ok {
+		return nil, fmt.Errorf("invalid client TLS version: %s", a[0])
+	}
+
+	return clientTLSVersionPredicate(v), nil
+}
+
+func (p clientTLSVersionPredicate) Match(req *http.Request) bool {
+	return req.TLS != nil && req.TLS.Version == uint16(p)
+}
+
+func (s *clientCertificateSpec) Name() string { return ClientCertificateName }
+
+// Creates a client certificate predicate. It doesn't take arguments.
+func (s *clientCertificateSpec) Create(args []interface{}) (Predicate, error) {
+	if _, err := predicateArgs(ClientCertificateName, args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return clientCertificatePredicate{}, nil
+}
+
+func (p clientCertificatePredicate) Match(req *http.Request) bool {
+	return req.TLS != nil && len(req.TLS.PeerCertificates) > 0
+}
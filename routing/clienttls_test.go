@@ -0,0 +1,69 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+)
+
+func TestClientTLSPredicates(t *testing.T) {
+	tls12, err := (&clientTLSVersionSpec{}).Create([]interface{}{"1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := (&clientCertificateSpec{}).Create(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		tls         *tls.ConnectionState
+		version     bool
+		certificate bool
+	}{
+		{nil, false, false},
+		{&tls.ConnectionState{Version: tls.VersionTLS11}, false, false},
+		{&tls.ConnectionState{Version: tls.VersionTLS12}, true, false},
+		{&tls.ConnectionState{
+			Version:          tls.VersionTLS12,
+			PeerCertificates: []*x509.Certificate{{}}}, true, true},
+	} {
+		req := &http.Request{TLS: ti.tls}
+		if tls12.Match(req) != ti.version || cert.Match(req) != ti.certificate {
+			t.Error("invalid match", ti.tls, ti.version, ti.certificate)
+		}
+	}
+}
+
+func TestInvalidClientTLSPredicates(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{1.2},
+		{"2.0"},
+		{"1.1", "1.2"},
+	} {
+		if _, err := (&clientTLSVersionSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+
+	if _, err := (&clientCertificateSpec{}).Create([]interface{}{"required"}); err == nil {
+		t.Error("failed to fail with arguments")
+	}
+}
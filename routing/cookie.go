@@ -0,0 +1,62 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// The name of the built-in predicate matching the request cookies, e.g.
+// Cookie("session") or Cookie("session", /^a/).
+const CookieName = "Cookie"
+
+type cookieSpec struct{}
+
+// matches the presence of a cookie, or, when a regexp is set, the value
+// of the cookie
+type cookiePredicate struct {
+	name  string
+	value *regexp.Regexp
+}
+
+func (s *cookieSpec) Name() string { return CookieName }
+
+// Creates a cookie predicate with the name of the cookie, and an optional
+// regular expression matching its value.
+func (s *cookieSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(CookieName, args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &cookiePredicate{name: a[0]}
+	if len(a) == 2 {
+		if p.value, err = regexp.Compile(a[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *cookiePredicate) Match(req *http.Request) bool {
+	c, err := req.Cookie(p.name)
+	if err != nil {
+		return false
+	}
+
+	return p.value == nil || p.value.MatchString(c.Value)
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMatchCookie(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		a: Path("/foo") && Cookie("session", /^a/) -> "https://a.example.org";
+		session: Path("/foo") && Cookie("session") -> "https://session.example.org";
+		either: Path("/bar") && (Cookie("foo") || Cookie("bar", /^baz$/)) -> "https://either.example.org";
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, ti := range []struct {
+		path     string
+		cookies  []*http.Cookie
+		expected string
+	}{
+		{"/foo", nil, "foo"},
+		{"/foo", []*http.Cookie{{Name: "other", Value: "abc"}}, "foo"},
+		{"/foo", []*http.Cookie{{Name: "session", Value: "abc"}}, "a"},
+		{"/foo", []*http.Cookie{{Name: "session", Value: "bcd"}}, "session"},
+		{"/foo", []*http.Cookie{{Name: "session", Value: ""}}, "session"},
+		{"/bar", []*http.Cookie{{Name: "foo", Value: "qux"}}, "either"},
+		{"/bar", []*http.Cookie{{Name: "bar", Value: "baz"}}, "either"},
+		{"/bar", []*http.Cookie{{Name: "bar", Value: "bazz"}}, "bar"},
+	} {
+		req, err := newRequest("GET", ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range ti.cookies {
+			req.AddCookie(c)
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.path, ti.cookies, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidCookie(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{"session", 42},
+		{"session", "["},
+		{"session", "foo", "bar"},
+	} {
+		if _, err := (&cookieSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the built-in predicate matching the requests received
+// while a cron expression is active, e.g. Cron("* 9-16 * * MON-FRI"), or
+// Cron("0 2 * * SUN", "30m", "Europe/Berlin").
+const CronName = "Cron"
+
+// the cron fields, in the order of the expression
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{0, 59, nil},
+	{0, 23, nil},
+	{1, 31, nil},
+	{1, 12, []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{0, 7, []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// the minutes, hours, days of the month, months and days of the week
+// matched by the expression, as bit sets
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// the day conditions are combined with or, when both are restricted
+	domAny, dowAny bool
+}
+
+type cronSpec struct {
+	now func() time.Time
+}
+
+// matches the requests during the minutes matching the schedule, or,
+// when the duration is set, for the duration after them
+type cronPredicate struct {
+	schedule cronSchedule
+	duration time.Duration
+	location *time.Location
+	now      func() time.Time
+}
+
+func (s *cronSpec) Name() string { return CronName }
+
+// parses a value of a cron field, either a number or a name
+func parseCronValue(f cronField, s string) (int, error) {
+	for i, n := range f.names {
+		if strings.EqualFold(s, n) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid cron value: %s", s)
+	}
+
+	return v, nil
+}
+
+// parses a cron field, a comma separated list of values, ranges and
+// steps, e.g. 9-17, */15 or MON,WED,FRI
+func parseCronField(f cronField, s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rangeStep := strings.SplitN(item, "/", 2)
+		step := 1
+		if len(rangeStep) == 2 {
+			var err error
+			if step, err = strconv.Atoi(rangeStep[1]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid cron step: %s", item)
+			}
+		}
+
+		from, to := f.min, f.max
+		if rangeStep[0] != "*" {
+			fromTo := strings.SplitN(rangeStep[0], "-", 2)
+			var err error
+			if from, err = parseCronValue(f, fromTo[0]); err != nil {
+				return 0, err
+			}
+
+			to = from
+			if len(fromTo) == 2 {
+				if to, err = parseCronValue(f, fromTo[1]); err != nil {
+					return 0, err
+				}
+			} else if len(rangeStep) == 2 {
+				to = f.max
+			}
+
+			if to < from {
+				return 0, fmt.Errorf("invalid cron range: %s", item)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// parses a cron expression with five fields: minute, hour, day of the
+// month, month and day of the week
+func parseCron(s string) (cronSchedule, error) {
+	var c cronSchedule
+	fields := strings.Fields(s)
+	if len(fields) != len(cronFields) {
+		return c, fmt.Errorf("invalid cron expression: %s", s)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, fi := range fields {
+		b, err := parseCronField(cronFields[i], fi)
+		if err != nil {
+			return c, err
+		}
+
+		bits[i] = b
+	}
+
+	c.minute, c.hour, c.dom, c.month, c.dow = bits[0], bits[1], bits[2], bits[3], bits[4]
+
+	// both 0 and 7 mean Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAny, c.dowAny = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// returns the minute before the start of a period containing t. When
+// the local start is ambiguous, due to a daylight saving time change,
+// and it resolves after t, it steps back only a minute.
+func cronBefore(t, start time.Time) time.Time {
+	if start.After(t) {
+		return t.Add(-time.Minute)
+	}
+
+	return start.Add(-time.Minute)
+}
+
+// returns the start of the latest minute not after t, that matches the
+// schedule, or false, when there is none since the limit. It skips the
+// non-matching months, days and hours at once.
+func (c *cronSchedule) prev(t, limit time.Time) (time.Time, bool) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute)
+	for !t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = cronBefore(t, time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc))
+		case !c.matchDay(t):
+			t = cronBefore(t, time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = cronBefore(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc))
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Creates a cron predicate with the cron expression, and optionally the
+// duration for which the predicate stays active after the matching
+// minutes, and the IANA timezone of the expression, UTC by default.
+func (s *cronSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(CronName, args, 1, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := parseCron(a[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &cronPredicate{schedule: c, duration: time.Minute, location: time.UTC, now: s.now}
+	if len(a) > 1 {
+		if p.duration, err = time.ParseDuration(a[1]); err != nil {
+			return nil, err
+		}
+
+		if p.duration < time.Minute {
+			return nil, fmt.Errorf("invalid duration for predicate %s: %s", CronName, a[1])
+		}
+	}
+
+	if len(a) > 2 {
+		if p.location, err = time.LoadLocation(a[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *cronPredicate) Match(*http.Request) bool {
+	now := p.now().In(p.location)
+	_, ok := p.schedule.prev(now, now.Add(-p.duration).Add(time.Nanosecond))
+	return ok
+}
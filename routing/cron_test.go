@@ -0,0 +1,174 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	for _, ti := range []struct {
+		msg      string
+		args     []interface{}
+		utc      string
+		expected bool
+	}{{
+		msg:      "every minute",
+		args:     []interface{}{"* * * * *"},
+		utc:      "2024-01-08T03:17:42Z",
+		expected: true,
+	}, {
+		msg:      "business hours",
+		args:     []interface{}{"* 9-16 * * MON-FRI"},
+		utc:      "2024-01-08T16:59:00Z",
+		expected: true,
+	}, {
+		msg:  "business hours, evening",
+		args: []interface{}{"* 9-16 * * MON-FRI"},
+		utc:  "2024-01-08T17:00:00Z",
+	}, {
+		msg:  "business hours, weekend",
+		args: []interface{}{"* 9-16 * * MON-FRI"},
+		utc:  "2024-01-13T10:00:00Z",
+	}, {
+		msg:      "single minute",
+		args:     []interface{}{"0 9-17 * * MON-FRI"},
+		utc:      "2024-01-08T10:00:59Z",
+		expected: true,
+	}, {
+		msg:  "single minute, passed",
+		args: []interface{}{"0 9-17 * * MON-FRI"},
+		utc:  "2024-01-08T10:01:00Z",
+	}, {
+		msg:      "duration",
+		args:     []interface{}{"0 2 * * SUN", "30m"},
+		utc:      "2024-01-14T02:29:59Z",
+		expected: true,
+	}, {
+		msg:  "duration, passed",
+		args: []interface{}{"0 2 * * SUN", "30m"},
+		utc:  "2024-01-14T02:30:00Z",
+	}, {
+		msg:      "duration over midnight and month",
+		args:     []interface{}{"0 22 31 * *", "4h"},
+		utc:      "2024-02-01T01:30:00Z",
+		expected: true,
+	}, {
+		msg:      "sunday as 7",
+		args:     []interface{}{"*/15 * * * 7"},
+		utc:      "2024-01-14T12:45:00Z",
+		expected: true,
+	}, {
+		msg:  "steps",
+		args: []interface{}{"*/15 * * * 7"},
+		utc:  "2024-01-14T12:46:00Z",
+	}, {
+		msg:      "day of month or day of week",
+		args:     []interface{}{"* * 1 * MON"},
+		utc:      "2024-01-08T12:00:00Z",
+		expected: true,
+	}, {
+		msg:  "neither day of month nor day of week",
+		args: []interface{}{"* * 1 * MON"},
+		utc:  "2024-01-09T12:00:00Z",
+	}, {
+		msg:      "months",
+		args:     []interface{}{"* * * NOV-DEC *"},
+		utc:      "2024-12-24T12:00:00Z",
+		expected: true,
+	}, {
+		msg:      "timezone",
+		args:     []interface{}{"* 9-17 * * *", "1m", "Europe/Berlin"},
+		utc:      "2024-07-01T07:00:00Z",
+		expected: true,
+	}, {
+		msg:  "timezone, outside",
+		args: []interface{}{"* 9-17 * * *", "1m", "Europe/Berlin"},
+		utc:  "2024-07-01T16:00:00Z",
+	}, {
+		msg:      "duration over the end of daylight saving time",
+		args:     []interface{}{"30 2 * * *", "2h", "Europe/Berlin"},
+		utc:      "2024-10-27T02:00:00Z",
+		expected: true,
+	}, {
+		msg:  "never in the limit",
+		args: []interface{}{"0 0 29 2 *", "48h"},
+		utc:  "2025-03-15T00:00:00Z",
+	}} {
+		now, err := time.Parse(time.RFC3339, ti.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := &cronSpec{now: func() time.Time { return now }}
+		p, err := s.Create(ti.args)
+		if err != nil {
+			t.Error(ti.msg, err)
+			continue
+		}
+
+		if p.Match(nil) != ti.expected {
+			t.Error(ti.msg, "invalid match", ti.utc, ti.expected)
+		}
+	}
+}
+
+func TestCronRoute(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		campaign: Path("/") && (Cron("* * * * *") || Between("2024-11-29T00:00Z", "2024-12-02T00:00Z")) -> "https://campaign.example.org";
+		shop: Path("/") -> "https://shop.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	req, err := newRequest("GET", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := m.match(req); r == nil || r.Id != "campaign" {
+		t.Error("failed to match the scheduled route", r)
+	}
+}
+
+func TestInvalidCron(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{"* * * *"},
+		{"* * * * * *"},
+		{"60 * * * *"},
+		{"* 24 * * *"},
+		{"* * 0 * *"},
+		{"* * * 13 *"},
+		{"* * * * 8"},
+		{"* * * * FOO"},
+		{"17-9 * * * *"},
+		{"*/0 * * * *"},
+		{"* * * * *", "foo"},
+		{"* * * * *", "30s"},
+		{"* * * * *", "1h", "No/Such_Zone"},
+		{"* * * * *", "1h", "UTC", "foo"},
+	} {
+		if _, err := (&cronSpec{now: time.Now}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
@@ -17,9 +17,12 @@ package routing
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
 	"net/url"
+	"sort"
 	"time"
 )
 
@@ -40,44 +43,58 @@ type incomingData struct {
 }
 
 // continously receives route definitions from a data client on the the output channel.
-// The function does not return. When started, it request for the whole current set of
-// routes, and continues polling for the subsequent updates. When a communication error
-// occurs, it re-requests the whole valid set, and continues polling. Currently, the
-// routes with the same id coming from different sources are merged in an
-// undeterministic way, but this may change in the future.
-func receiveFromClient(c DataClient, pollTimeout time.Duration, out chan<- *incomingData) {
-	receiveInitial := func() {
+// The function returns only when the quit channel is closed. When started, it request
+// for the whole current set of routes, and continues polling for the subsequent updates.
+// When a communication error occurs, it re-requests the whole valid set, and continues
+// polling.
+func receiveFromClient(c DataClient, pollTimeout time.Duration, out chan<- *incomingData, quit <-chan struct{}) {
+	receiveInitial := func() bool {
 		for {
 			routes, err := c.LoadAll()
 			if err != nil {
 				log.Error("error while receiveing initial data;", err)
-				time.Sleep(pollTimeout)
-				continue
+				select {
+				case <-time.After(pollTimeout):
+					continue
+				case <-quit:
+					return false
+				}
 			}
 
-			out <- &incomingData{incomingReset, c, routes, nil}
-			return
+			select {
+			case out <- &incomingData{incomingReset, c, routes, nil}:
+				return true
+			case <-quit:
+				return false
+			}
 		}
 	}
 
-	receiveUpdates := func() {
+	receiveUpdates := func() bool {
 		for {
-			time.Sleep(pollTimeout)
+			select {
+			case <-time.After(pollTimeout):
+			case <-quit:
+				return false
+			}
+
 			routes, deletedIds, err := c.LoadUpdate()
 			if err != nil {
 				log.Error("error while receiving update;", err)
-				return
+				return true
 			}
 
 			if len(routes) > 0 || len(deletedIds) > 0 {
-				out <- &incomingData{incomingUpdate, c, routes, deletedIds}
+				select {
+				case out <- &incomingData{incomingUpdate, c, routes, deletedIds}:
+				case <-quit:
+					return false
+				}
 			}
 		}
 	}
 
-	for {
-		receiveInitial()
-		receiveUpdates()
+	for receiveInitial() && receiveUpdates() {
 	}
 }
 
@@ -103,11 +120,13 @@ func applyIncoming(defs routeDefs, d *incomingData) routeDefs {
 	return defs
 }
 
-// merges the route definitions from multiple data clients by route id
-func mergeDefs(defsByClient map[DataClient]routeDefs) []*eskip.Route {
+// merges the route definitions from multiple data clients by route id.
+// When the same id is provided by multiple clients, the definition from
+// the client that comes later in the list of clients is used.
+func mergeDefs(clients []DataClient, defsByClient map[DataClient]routeDefs) []*eskip.Route {
 	mergeById := make(routeDefs)
-	for _, defs := range defsByClient {
-		for id, def := range defs {
+	for _, c := range clients {
+		for id, def := range defsByClient[c] {
 			mergeById[id] = def
 		}
 	}
@@ -126,21 +145,32 @@ func mergeDefs(defsByClient map[DataClient]routeDefs) []*eskip.Route {
 //
 // The active set of routes from last successful update are used until the
 // next successful update.
-func receiveRouteDefs(o Options) <-chan []*eskip.Route {
+func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan []*eskip.Route {
 	in := make(chan *incomingData)
 	out := make(chan []*eskip.Route)
 	defsByClient := make(map[DataClient]routeDefs)
 
 	for _, c := range o.DataClients {
-		go receiveFromClient(c, o.PollTimeout, in)
+		go receiveFromClient(c, o.PollTimeout, in, quit)
 	}
 
 	go func() {
 		for {
-			incoming := <-in
+			var incoming *incomingData
+			select {
+			case incoming = <-in:
+			case <-quit:
+				return
+			}
+
 			c := incoming.client
 			defsByClient[c] = applyIncoming(defsByClient[c], incoming)
-			out <- mergeDefs(defsByClient)
+
+			select {
+			case out <- mergeDefs(o.DataClients, defsByClient):
+			case <-quit:
+				return
+			}
 		}
 	}()
 
@@ -150,7 +180,7 @@ func receiveRouteDefs(o Options) <-chan []*eskip.Route {
 // splits the backend address of a route definition into separate
 // scheme and host variables.
 func splitBackend(r *eskip.Route) (string, string, error) {
-	if r.Shunt {
+	if r.Shunt || r.Loopback || r.Dynamic || len(r.SplitBackends) > 0 {
 		return "", "", nil
 	}
 
@@ -162,19 +192,56 @@ func splitBackend(r *eskip.Route) (string, string, error) {
 	return bu.Scheme, bu.Host, nil
 }
 
+// preprocesses the weighted backends of a route with a split backend
+func weightedBackends(r *eskip.Route) ([]*WeightedBackend, error) {
+	var wbs []*WeightedBackend
+	for _, b := range r.SplitBackends {
+		bu, err := url.ParseRequestURI(b.Backend)
+		if err != nil {
+			return nil, err
+		}
+
+		wbs = append(wbs, &WeightedBackend{Weight: b.Weight, Scheme: bu.Scheme, Host: bu.Host})
+	}
+
+	return wbs, nil
+}
+
 // creates a filter instance based on its definition and its
-// specification in the filter registry.
+// specification in the filter registry. When the specification
+// declares a schema, the arguments are validated before creating the
+// filter.
 func createFilter(fr filters.Registry, def *eskip.Filter) (filters.Filter, error) {
 	spec, ok := fr[def.Name]
 	if !ok {
 		return nil, fmt.Errorf("filter not found: '%s'", def.Name)
 	}
 
+	if ss, ok := spec.(filters.SpecWithSchema); ok {
+		if err := filters.ValidateArgs(def.Name, ss.Schema(), def.Args); err != nil {
+			return nil, err
+		}
+	}
+
 	return spec.CreateFilter(def.Args)
 }
 
+// sorts the filters of a route by their phase, keeping the order of
+// the definitions within the same phase
+type filtersByPhase struct {
+	filters  []*RouteFilter
+	registry filters.Registry
+}
+
+func (fp filtersByPhase) Len() int      { return len(fp.filters) }
+func (fp filtersByPhase) Swap(i, j int) { fp.filters[i], fp.filters[j] = fp.filters[j], fp.filters[i] }
+
+func (fp filtersByPhase) Less(i, j int) bool {
+	return fp.registry.Phase(fp.filters[i].Name) < fp.registry.Phase(fp.filters[j].Name)
+}
+
 // creates filter instances based on their definition
-// and the filter registry.
+// and the filter registry, ordered by their phase.
 func createFilters(fr filters.Registry, defs []*eskip.Filter) ([]*RouteFilter, error) {
 	var fs []*RouteFilter
 	for i, def := range defs {
@@ -186,29 +253,41 @@ func createFilters(fr filters.Registry, defs []*eskip.Filter) ([]*RouteFilter, e
 		fs = append(fs, &RouteFilter{f, def.Name, i})
 	}
 
+	sort.Stable(filtersByPhase{fs, fr})
 	return fs, nil
 }
 
 // processes a route definition for the routing table
-func processRouteDef(fr filters.Registry, def *eskip.Route) (*Route, error) {
+func processRouteDef(fr filters.Registry, pr PredicateRegistry, def *eskip.Route) (*Route, error) {
 	scheme, host, err := splitBackend(def)
 	if err != nil {
 		return nil, err
 	}
 
+	wbs, err := weightedBackends(def)
+	if err != nil {
+		return nil, err
+	}
+
 	fs, err := createFilters(fr, def.Filters)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Route{*def, scheme, host, fs}, nil
+	return &Route{
+		Route:            *def,
+		Scheme:           scheme,
+		Host:             host,
+		Filters:          fs,
+		WeightedBackends: wbs,
+		predicates:       pr}, nil
 }
 
 // processes a set of route definitions for the routing table
-func processRouteDefs(fr filters.Registry, defs []*eskip.Route) []*Route {
+func processRouteDefs(fr filters.Registry, pr PredicateRegistry, defs []*eskip.Route) []*Route {
 	var routes []*Route
 	for _, def := range defs {
-		route, err := processRouteDef(fr, def)
+		route, err := processRouteDef(fr, pr, def)
 		if err == nil {
 			routes = append(routes, route)
 		} else {
@@ -219,19 +298,116 @@ func processRouteDefs(fr filters.Registry, defs []*eskip.Route) []*Route {
 	return routes
 }
 
+// the backend addresses, in the form of scheme://host, that the routes
+// point to
+func routeBackends(routes []*Route) map[string]bool {
+	backends := make(map[string]bool)
+	for _, r := range routes {
+		if r.Shunt || r.Loopback || r.Dynamic {
+			continue
+		}
+
+		if len(r.WeightedBackends) == 0 {
+			backends[r.Scheme+"://"+r.Host] = true
+		}
+
+		for _, b := range r.WeightedBackends {
+			backends[b.Scheme+"://"+b.Host] = true
+		}
+	}
+
+	return backends
+}
+
+// the definitions of the processed routes by their ids
+func activeDefs(routes []*Route) routeDefs {
+	defs := make(routeDefs)
+	for _, r := range routes {
+		defs[r.Id] = &r.Route
+	}
+
+	return defs
+}
+
+// drops the expired routes, and returns the time of the next expiration
+// among the remaining routes, or zero if none of them expires. The
+// routes that were not expired before are counted in the metrics.
+func dropExpired(defs []*eskip.Route, now time.Time, expiredBefore map[string]bool) ([]*eskip.Route, time.Time, map[string]bool) {
+	var (
+		valid   []*eskip.Route
+		next    time.Time
+		expired = make(map[string]bool)
+	)
+
+	for _, d := range defs {
+		// the invalid expiration times are rejected when processing
+		// the route
+		validUntil, err := ValidUntil(d)
+		if err != nil || validUntil.IsZero() {
+			valid = append(valid, d)
+			continue
+		}
+
+		if !now.Before(validUntil) {
+			expired[d.Id] = true
+			if !expiredBefore[d.Id] {
+				log.Infof("route expired: %s", d.Id)
+				metrics.IncRouteExpired(d.Id)
+			}
+
+			continue
+		}
+
+		valid = append(valid, d)
+		if next.IsZero() || validUntil.Before(next) {
+			next = validUntil
+		}
+	}
+
+	return valid, next, expired
+}
+
 // receives the next version of the routing table on the output channel,
-// when an update is received on one of the data clients.
-func receiveRouteMatcher(o Options, out chan<- *matcher) {
-	updates := receiveRouteDefs(o)
+// when an update is received on one of the data clients, or when a
+// route expires. It returns when the quit channel is closed.
+func receiveRouteMatcher(o Options, c clock.Clock, out chan<- *routeTable, quit <-chan struct{}) {
+	updates := receiveRouteDefs(o, quit)
+	var (
+		defs    []*eskip.Route
+		expired map[string]bool
+		expiry  <-chan time.Time
+		state   = &routeState{}
+	)
+
 	for {
-		defs := <-updates
-		routes := processRouteDefs(o.FilterRegistry, defs)
-		m, errs := newMatcher(routes, o.MatchingOptions)
-		for _, err := range errs {
-			log.Error(err)
+		var isExpiry bool
+		select {
+		case defs = <-updates:
+		case <-expiry:
+			isExpiry = true
+		case <-quit:
+			return
+		}
+
+		now := c.Now()
+		valid, next, e := dropExpired(defs, now, expired)
+		expired = e
+
+		expiry = nil
+		if !next.IsZero() {
+			expiry = c.After(next.Sub(now))
 		}
 
+		var routes []*Route
+		start := time.Now()
+		state, routes = state.next(o, valid)
+		metrics.MeasureRoutingUpdate(start, len(routes), state.rejected)
+
 		log.Println("route settings received")
-		out <- m
+		select {
+		case out <- &routeTable{state.matcher, routeBackends(routes), activeDefs(routes), isExpiry}:
+		case <-quit:
+			return
+		}
 	}
 }
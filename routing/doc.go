@@ -30,6 +30,38 @@ met.
 (The regular expression conditions for the path, 'PathRegexp', are
 applied only in step 2.)
 
+In step 2, the routes whose Host condition requires a single, exact host,
+e.g. Host(/^www[.]example[.]org$/), are looked up by the request host.
+The routes whose PathRegexp condition requires a literal prefix, e.g.
+PathRegexp("^/api/v1/"), are looked up in a radix tree by the
+prefixes of the request path. Only these and the routes without such
+conditions are evaluated, so that the lookup time doesn't grow with the
+number of the indexed routes.
+The cheap conditions, like Method or Header, and the literal substrings
+required by the regular expressions are checked first, and the regular
+expressions are evaluated only when these match.
+
+
+Route Precedence
+
+When multiple routes match a request, the precedence is deterministic,
+and it doesn't depend on the order of the route definitions:
+
+1. Routes with a Path condition matching the request path take
+precedence over the routes without a Path condition. When multiple path
+conditions match, a fixed path wins over a path with wildcards, and a
+path with simple wildcards wins over a free wildcard.
+
+2. Among the routes with the same path condition, or without a path
+condition, the route with more conditions wins.
+
+3. When the number of conditions is equal, the route with the
+lexicographically lower id wins.
+
+The routing.Explain function can be used to see which route of a set of
+definitions matches a request, and in what order the routes were
+evaluated.
+
 The matching conditions and the built-in filters that use regular
 expressions, use the go stdlib regexp, which uses re2:
 
@@ -58,6 +90,137 @@ HeaderRegexp("Key", "^Value$").
 must be present in the request and one of the associated values must
 match the expression.
 
+- ClientTLSVersion: the TLS version of the client connection, one of
+"1.0", "1.1" or "1.2". Requests received over plain HTTP don't match.
+
+- ClientCertificate: the client must present a certificate on the TLS
+connection. The routing only checks the presence of the certificate, it
+is verified by the TLS server, depending on its configuration.
+
+- ClientIP: a list of IP addresses and CIDR ranges, one of which must
+contain the address of the client. The address is taken from the
+X-Forwarded-For header only when trusted proxies are set, skipping the
+addresses of the trusted proxies. See ClientIP and SetTrustedProxies.
+
+The TLS conditions are evaluated on the connection state of the
+incoming request, so they match only when the proxy handler is served
+over TLS, e.g. with the TLS options of the skipper command, or embedded
+in an http.Server started with ListenAndServeTLS.
+
+- ValidUntil: the expiration time of the route. The expired routes are
+dropped from the routing table, when they expire, or when they are
+received from the data clients after their expiration. The number of
+expired routes is counted in the metrics, with the route id. The time
+of the expiration is read from the system clock, or, when the routing
+is created with NewWithClock, from the provided clock, e.g. a
+clock.Fake in tests.
+
+- Cookie: the request must have a cookie with the given name, and,
+when a regular expression is set, its value must match it, e.g.
+Cookie("session", /^a/).
+
+- QueryParam: the request must have a query parameter with the given
+name, and, when a value is set, one of its values must be equal to it,
+e.g. QueryParam("debug", "1").
+
+- Traffic: the request is matched randomly with the given chance,
+between 0 and 1, e.g. Traffic(0.05). Used for canarying, together with
+a route that has the same conditions without Traffic, which receives
+the rest of the requests. The selection is not sticky, consecutive
+requests of the same client may be routed differently.
+
+- Schedule: the request must be received during one of the recurring
+weekly windows, given in the local time of an IANA timezone, e.g.
+Schedule("Europe/Berlin", "Mon-Fri 09:00-18:00", "Sat 10:00-14:00").
+The windows may list weekdays and ranges of them, separated by commas,
+or apply to every day when no weekday is set, and end on the next day
+when the end is not after the start, e.g. "Fri 22:00-02:00". They are
+evaluated on the local wall clock of the zone, so they follow the
+daylight saving time changes. The time is read from the system clock.
+
+- Between: the request must be received in a fixed time window, from
+the start, inclusive, until the end, exclusive, given in RFC3339 format,
+with or without the seconds, e.g.
+Between("2024-11-29T00:00Z", "2024-12-02T00:00Z"). Unlike with
+ValidUntil, the route stays in the routing table outside of the window.
+
+- Cron: the request must be received during a minute matching a cron
+expression with five fields, minute, hour, day of the month, month and
+day of the week, e.g. Cron("* 9-16 * * MON-FRI"). The fields accept
+lists, ranges, steps and the names of the months and the weekdays. When
+both day fields are restricted, either of them needs to match. An
+optional duration keeps the predicate active after each matching minute,
+and an optional IANA timezone sets the local time of the expression,
+UTC by default, e.g. Cron("0 2 * * SUN", "30m", "Europe/Berlin").
+
+- ClientCert: a field of the verified client certificate, cn, subject,
+issuer or san, and a regular expression matching its value, e.g.
+ClientCert("cn", /^partner-/). The subject and the issuer are matched
+in the form of CN=name,OU=unit,O=organization,L=locality,ST=province,C=country,
+omitting the unset attributes, while in case of san, any of the DNS
+names, email addresses or IP addresses can match. Unlike
+ClientCertificate, it matches only the certificates verified by the TLS
+server, i.e. when the listener requires or accepts verified client
+certificates, see VerifiedClientCertificate.
+
+The built-in time conditions allow activating the maintenance or
+campaign routes automatically, without updating the route definitions
+at the time of the change.
+
+The Cookie, QueryParam, Traffic, Schedule, Between, Cron and ClientCert
+conditions are implemented as predicates available without registration, and, like the custom
+predicates, they are evaluated after the rest of the conditions, and
+can be used in predicate expressions.
+
+- Custom predicates: the conditions implemented outside of the routing,
+registered with the PredicateRegistry option, and referenced in the
+route definitions by their name, e.g. Country("DE"). They are created
+for each route with the PredicateSpec, and evaluated after the built-in
+conditions. Each custom predicate counts as a condition in the
+precedence of the routes. The routes referencing an unknown predicate
+are rejected.
+
+
+Canonicalization
+
+Before matching, the request host and path are canonicalized, so that
+equivalent URLs match the same routes. The port and the trailing dot
+are stripped from the host, and it is converted to lowercase, therefore
+the Host conditions should expect lowercase hosts without the port. In
+the path, the duplicate slashes are collapsed and the dot segments are
+resolved. The canonicalization can be disabled with the
+NoCanonicalization matching option.
+
+After the canonicalization, the alias hosts set with SetHostAliases are
+replaced with the host they stand for, e.g. www.example.org
+with example.org, so that the routes don't need to list every alias in
+their Host conditions. The aliases starting with "*." match every
+subdomain. The replaced host is used only for matching, the requests
+are forwarded with their original Host header.
+
+
+Trailing Slashes
+
+By default, the path of a request needs to match the Path condition of
+a route exactly, including the trailing slash. The IgnoreTrailingSlash
+matching option makes the routes match the paths both with and without
+the trailing slash, while the RedirectTrailingSlash option makes the
+routing answer the requests in the other form with a redirect to the
+path of the route: 301 for GET and HEAD requests, and 308 for the
+other methods, preserving the query. The individual routes can
+override the global policy with the TrailingSlash condition, taking
+"strict", "match" or "redirect". The routes with free form wildcards
+at the end of the path match the trailing slash as part of the
+wildcard parameter.
+
+
+Predicate Expressions
+
+The conditions combined with the || and ! operators in the route
+definitions, e.g. Host(/^a[.]/) || Host(/^b[.]/), are evaluated after
+the other conditions of the route matched, and count as a single
+condition in the precedence of the routes. In these expressions, the
+path condition matches the request path exactly, without wildcards.
 
 Wildcards
 
@@ -84,12 +247,36 @@ updates, and, if an update is received, generates a new lookup tree. In
 case of communication failure during polling, it reloads the whole set
 of routes from the failing client.
 
+The new lookup tree is derived from the previous one: only the changed
+route definitions are processed again, and only the leaves sharing a
+path with a changed route are re-sorted. The unchanged routes keep their
+filter instances, and the previous lookup tree is left intact for the
+requests still being routed with it.
+
 The active set of routes from the last successful update are used until
 the next successful update happens.
 
-Currently, the routes with the same id coming from different sources are
-merged in an undeterministic way, but this behavior may change in the
-future.
+When the routes with the same id come from different sources, the route
+from the data client that comes later in the list of data clients is
+used.
+
+The applications embedding the routing can be notified about the changes
+of the active routes, by registering a function with
+NotifyRouteChanges. It receives the ids of the added, updated and
+removed routes after each update of the routing table.
+
+Large, risky changes of the routes can be activated gradually, by
+setting a TableRollout with SetTableRollout. In this case, a new version
+of the routing table is used first only for the given percentage of the
+requests, consistently by their flow id, and it is activated for all
+requests after the configured duration, or when PromoteTable is called.
+RollbackTable drops the new version.
+
+To compare the routing behavior of the versions on live traffic, the
+last few versions of the routing table can be retained, by setting a
+TablePinning with SetTablePinning. The requests of the trusted clients
+can then select a retained version, or the candidate of a rollout, with
+the configured header.
 
 For a full description of the route definitions, see the documentation
 of the skipper/eskip package.
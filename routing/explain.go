@@ -0,0 +1,172 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"net/http"
+)
+
+// The result of evaluating a condition of a route.
+type Condition struct {
+
+	// The name of the condition, e.g. Method or Header, or Predicate
+	// for the predicate expression of the route.
+	Name string
+
+	// Tells whether the request fulfilled the condition.
+	Passed bool
+}
+
+// A route evaluated while matching a request.
+type Candidate struct {
+
+	// The evaluated route definition.
+	Route *eskip.Route
+
+	// The name of the first condition that the request didn't fulfil,
+	// e.g. Method or Header, or Predicate for the predicate expression
+	// of the route. Empty when the route matched.
+	Mismatch string
+
+	// All the conditions of the route, in the order of their
+	// evaluation, including the ones after the first failing one.
+	Conditions []*Condition
+}
+
+// Explanation of how a request was matched against a set of routes.
+type Explanation struct {
+
+	// The matching route, or nil if none of the routes matched.
+	Match *eskip.Route
+
+	// The wildcard parameters of the path condition in the matching
+	// route.
+	Params map[string]string
+
+	// The routes evaluated for the request, in the order of their
+	// precedence. The routes that were not reached during the evaluation,
+	// because a previous route already matched, are not included.
+	Candidates []*Candidate
+
+	// The filters of the matching route, in the order that they would
+	// be executed.
+	Filters []*eskip.Filter
+}
+
+// returns the definition of a route, from the provided definitions if
+// any, or otherwise the one embedded in the route
+func routeDef(defs map[*Route]*eskip.Route, r *Route) *eskip.Route {
+	if defs == nil {
+		return &r.Route
+	}
+
+	return defs[r]
+}
+
+func explainLeaves(
+	e *Explanation,
+	defs map[*Route]*eskip.Route,
+	leaves leafMatchers,
+	req *http.Request,
+	path string) bool {
+
+	for _, l := range leaves {
+		c := &Candidate{
+			Route:      routeDef(defs, l.route),
+			Conditions: leafConditions(l, req, path)}
+		for _, ci := range c.Conditions {
+			if !ci.Passed {
+				c.Mismatch = ci.Name
+				break
+			}
+		}
+
+		e.Candidates = append(e.Candidates, c)
+		if c.Mismatch == "" {
+			e.Match = c.Route
+			for _, f := range l.route.Filters {
+				e.Filters = append(e.Filters, c.Route.Filters[f.Index])
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// explains the matching of a request, without executing the filters or
+// forwarding the request
+func (m *matcher) explain(req *http.Request, defs map[*Route]*eskip.Route) *Explanation {
+	e := &Explanation{}
+	req = m.normalizeHost(req)
+	path := m.normalizePath(req)
+	leaves, params := matchPathTree(m, path)
+	if explainLeaves(e, defs, leaves, req, path) {
+		e.Params = params
+		return e
+	}
+
+	explainLeaves(e, defs, m.rootLeaves, req, path)
+	return e
+}
+
+// Explains which route of a set of route definitions matches a request,
+// and in what order the routes were evaluated. It applies the same
+// precedence rules as the routing. It returns an error if any of the
+// route definitions are invalid. The filters in the routes are not
+// created, and they are reported in the order of their definition.
+func Explain(defs []*eskip.Route, req *http.Request, o MatchingOptions) (*Explanation, error) {
+	routes := make([]*Route, len(defs))
+	routeDefs := make(map[*Route]*eskip.Route)
+	for i, def := range defs {
+		scheme, host, err := splitBackend(def)
+		if err != nil {
+			return nil, &definitionError{def.Id, i, err}
+		}
+
+		wbs, err := weightedBackends(def)
+		if err != nil {
+			return nil, &definitionError{def.Id, i, err}
+		}
+
+		var fs []*RouteFilter
+		for j, f := range def.Filters {
+			fs = append(fs, &RouteFilter{Name: f.Name, Index: j})
+		}
+
+		routes[i] = &Route{Route: *def, Scheme: scheme, Host: host, Filters: fs, WeightedBackends: wbs}
+		routeDefs[routes[i]] = def
+	}
+
+	m, errs := newMatcher(routes, o)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return m.explain(req, routeDefs), nil
+}
+
+// Explains which route of the routing table active for all requests
+// matches a request, applying the host aliases and the matching options
+// of the routing. It evaluates the live routing table, including the
+// custom predicates, and reports the filters in the order of their
+// execution, but it doesn't execute them, and doesn't forward the
+// request. The returned error is always nil.
+func (r *Routing) Explain(req *http.Request) (*Explanation, error) {
+	req = r.hostAliases.Load().(HostAliases).apply(req, r.matchingOptions)
+	return r.tables.Load().(*activeTables).stable.explain(req, nil), nil
+}
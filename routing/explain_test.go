@@ -0,0 +1,172 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"net/http"
+	"testing"
+)
+
+const explainDoc = `
+	api: Path("/api/:resource") -> "https://api.example.org";
+	apiPost: Path("/api/:resource") && Method("POST") -> "https://api-post.example.org";
+	html: Header("Accept", "text/html") -> "https://ui.example.org";
+	catchAll: Any() -> <shunt>`
+
+func explain(t *testing.T, method, path string, header http.Header) *routing.Explanation {
+	routes, err := eskip.Parse(explainDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(method, "https://www.example.org"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header = header
+	e, err := routing.Explain(routes, req, routing.MatchingOptionsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestExplainPathMatch(t *testing.T) {
+	e := explain(t, "GET", "/api/users", http.Header{})
+	if e.Match == nil || e.Match.Id != "api" || e.Params["resource"] != "users" {
+		t.Error("failed to match path route")
+	}
+
+	if len(e.Candidates) != 2 ||
+		e.Candidates[0].Route.Id != "apiPost" || e.Candidates[0].Mismatch != "Method" ||
+		e.Candidates[1].Route.Id != "api" || e.Candidates[1].Mismatch != "" {
+		t.Error("invalid candidates")
+	}
+}
+
+func TestExplainFallsBackToRootRoutes(t *testing.T) {
+	e := explain(t, "GET", "/index.html", http.Header{"Accept": []string{"text/html"}})
+	if e.Match == nil || e.Match.Id != "html" || len(e.Candidates) != 1 {
+		t.Error("failed to match root route")
+	}
+
+	e = explain(t, "GET", "/index.html", http.Header{})
+	if e.Match == nil || e.Match.Id != "catchAll" || len(e.Candidates) != 2 ||
+		e.Candidates[0].Mismatch != "Header" {
+		t.Error("failed to match catch all route")
+	}
+}
+
+func TestExplainNoMatch(t *testing.T) {
+	routes, err := eskip.Parse(`Method("POST") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := routing.Explain(routes, req, routing.MatchingOptionsNone)
+	if err != nil || e.Match != nil || len(e.Candidates) != 1 {
+		t.Error("failed to explain no match")
+	}
+}
+
+func TestExplainInvalidDefinition(t *testing.T) {
+	routes, err := eskip.Parse(`invalid: PathRegexp(/[/) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := routing.Explain(routes, req, routing.MatchingOptionsNone); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestExplainConditions(t *testing.T) {
+	e := explain(t, "GET", "/api/users", http.Header{})
+	if len(e.Candidates) != 2 {
+		t.Fatal("invalid candidates")
+	}
+
+	cs := e.Candidates[0].Conditions
+	if len(cs) != 2 ||
+		cs[0].Name != "Path" || !cs[0].Passed ||
+		cs[1].Name != "Method" || cs[1].Passed {
+		t.Error("invalid conditions of the mismatching route")
+	}
+
+	routes, err := eskip.Parse(`Method("POST") && Header("X-Foo", "bar") && Host(/^www[.]example[.]org$/) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err = routing.Explain(routes, req, routing.MatchingOptionsNone)
+	if err != nil || len(e.Candidates) != 1 {
+		t.Fatal("failed to explain")
+	}
+
+	var names []string
+	var passed []bool
+	for _, c := range e.Candidates[0].Conditions {
+		names = append(names, c.Name)
+		passed = append(passed, c.Passed)
+	}
+
+	if e.Candidates[0].Mismatch != "Method" ||
+		len(names) != 3 ||
+		names[0] != "Method" || passed[0] ||
+		names[1] != "Header" || passed[1] ||
+		names[2] != "Host" || !passed[2] {
+		t.Error("failed to evaluate all the conditions", names, passed)
+	}
+}
+
+func TestExplainFilters(t *testing.T) {
+	routes, err := eskip.Parse(`Any() -> setRequestHeader("X-Foo", "bar") -> status(418) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := routing.Explain(routes, req, routing.MatchingOptionsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Filters) != 2 || e.Filters[0].Name != "setRequestHeader" || e.Filters[1].Name != "status" {
+		t.Error("invalid filters", e.Filters)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"sort"
+)
+
+// Identifies the content of the active routing table, so that the
+// tables of different instances can be compared.
+type TableFingerprint struct {
+
+	// The version of the table in the instance, incremented with
+	// every update. It differs between the instances.
+	Version int
+
+	// The SHA-256 hash of the route definitions, in hex format. Equal
+	// for the tables with the same routes, independent of the order
+	// in which they were received.
+	Hash string
+
+	// The number of the routes in the table.
+	Routes int
+}
+
+func sortedIds(defs routeDefs) []string {
+	ids := make([]string, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// returns the route definitions ordered by id
+func sortedDefs(defs routeDefs) []*eskip.Route {
+	ids := sortedIds(defs)
+	routes := make([]*eskip.Route, len(ids))
+	for i, id := range ids {
+		routes[i] = defs[id]
+	}
+
+	return routes
+}
+
+// calculates the hash of the route definitions, ordered by id
+func routesHash(defs routeDefs) string {
+	h := sha256.New()
+	for _, id := range sortedIds(defs) {
+		fmt.Fprintf(h, "%s: %s;\n", id, defs[id].String())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the fingerprint of the routing table active for all requests.
+// The candidate table of a rollout in progress is not included.
+func (r *Routing) TableFingerprint() TableFingerprint {
+	return r.fingerprint.Load().(TableFingerprint)
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitFingerprint(t *testing.T, routes []*eskip.Route) routing.TableFingerprint {
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{testdataclient.New(routes)},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	for i := 0; i < 30; i++ {
+		if f := rt.TableFingerprint(); f.Version > 0 {
+			return f
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	t.Fatal("failed to apply the routes")
+	return routing.TableFingerprint{}
+}
+
+func TestTableFingerprint(t *testing.T) {
+	foo := &eskip.Route{Id: "foo", Path: "/foo", Backend: "https://foo.example.org"}
+	bar := &eskip.Route{Id: "bar", Path: "/bar", Backend: "https://bar.example.org"}
+	barChanged := &eskip.Route{Id: "bar", Path: "/bar", Backend: "https://bar2.example.org"}
+
+	f1 := waitFingerprint(t, []*eskip.Route{foo, bar})
+	f2 := waitFingerprint(t, []*eskip.Route{bar, foo})
+	f3 := waitFingerprint(t, []*eskip.Route{foo, barChanged})
+
+	if f1.Routes != 2 || f1.Version != 1 {
+		t.Error("invalid fingerprint", f1)
+	}
+
+	if f1.Hash != f2.Hash {
+		t.Error("the hash depends on the order of the routes")
+	}
+
+	if f1.Hash == f3.Hash {
+		t.Error("failed to detect the changed route")
+	}
+}
+
+func TestTableFingerprintInitial(t *testing.T) {
+	rt := routing.New(routing.Options{})
+	defer rt.Close()
+
+	if f := rt.TableFingerprint(); f.Version != 0 || f.Routes != 0 || f.Hash == "" {
+		t.Error("invalid initial fingerprint", f)
+	}
+}
+
+func TestActiveRoutes(t *testing.T) {
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{testdataclient.New([]*eskip.Route{
+			{Id: "foo", Path: "/foo", Backend: "https://foo.example.org"},
+			{Id: "bar", HostRegexps: []string{"^www[.]example[.]org$"}, Backend: "https://bar.example.org"}})},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	if len(rt.Routes()) != 0 {
+		t.Error("unexpected initial routes")
+	}
+
+	for i := 0; i < 30 && rt.TableFingerprint().Version == 0; i++ {
+		time.Sleep(pollTimeout)
+	}
+
+	routes := rt.Routes()
+	if len(routes) != 2 || routes[0].Id != "bar" || routes[1].Id != "foo" {
+		t.Error("invalid routes", routes)
+	}
+
+	req, _ := http.NewRequest("GET", "https://www.example.org/foo", nil)
+	e, err := rt.Explain(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match == nil || e.Match.Id != "foo" {
+		t.Error("invalid explanation", e.Match)
+	}
+}
@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"github.com/dimfeld/httppath"
 	"github.com/zalando/pathmux"
+	"net"
 	"net/http"
 	"regexp"
+	"regexp/syntax"
 	"sort"
+	"strings"
 )
 
 type leafMatcher struct {
@@ -29,7 +32,22 @@ type leafMatcher struct {
 	pathRxs       []*regexp.Regexp
 	headersExact  map[string]string
 	headersRegexp map[string][]*regexp.Regexp
+	predicate     predicateFunc
+	custom        []customPredicate
 	route         *Route
+
+	// the effective trailing slash policy of the route, and whether
+	// its path has a trailing slash
+	slashPolicy trailingSlashPolicy
+	slash       bool
+
+	// literal substrings required by the host and path regexps, checked
+	// before the regexps are evaluated
+	hostLiterals []string
+	pathLiterals []string
+
+	// position of the leaf in the ordered leaves
+	rank int
 }
 
 type leafMatchers []*leafMatcher
@@ -46,23 +64,132 @@ func leafWeight(l *leafMatcher) int {
 	w += len(l.headersExact)
 	w += len(l.headersRegexp)
 
+	if l.predicate != nil {
+		w++
+	}
+
+	w += len(l.custom)
 	return w
 }
 
-// Sorting of leaf matchers:
-func (ls leafMatchers) Len() int           { return len(ls) }
-func (ls leafMatchers) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
-func (ls leafMatchers) Less(i, j int) bool { return leafWeight(ls[i]) > leafWeight(ls[j]) }
+// Sorting of leaf matchers: the ones with more conditions come first, and
+// in case of equal number of conditions, the order is defined by the
+// route id, so that the precedence doesn't depend on the order of the
+// route definitions.
+func (ls leafMatchers) Len() int      { return len(ls) }
+func (ls leafMatchers) Swap(i, j int) { ls[i], ls[j] = ls[j], ls[i] }
+
+func (ls leafMatchers) Less(i, j int) bool {
+	wi, wj := leafWeight(ls[i]), leafWeight(ls[j])
+	if wi != wj {
+		return wi > wj
+	}
+
+	return ls[i].route.Id < ls[j].route.Id
+}
+
+// Index of leaf matchers by the exact host that they require, or by the
+// anchored literal prefix of their path regexps, used to pre-filter the
+// candidate leaves before evaluating the regular expressions. The leaves
+// in both the indexed and the not indexed lists are in the order of
+// their precedence.
+type leafIndex struct {
+	byHost       map[string]leafMatchers
+	byPathPrefix *prefixNode
+	rest         leafMatchers
+}
+
+// Radix tree of the leaves by the literal prefix required by their path
+// regexps. The leaves of a node are in the order of their precedence.
+// The labels of the children of a node start with different bytes.
+type prefixNode struct {
+	label    string
+	children []*prefixNode
+	leaves   leafMatchers
+}
+
+func commonPrefixLength(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+// adds a leaf under a prefix, splitting the nodes whose label only
+// partially matches the prefix
+func (n *prefixNode) insert(prefix string, l *leafMatcher) {
+	for prefix != "" {
+		var child *prefixNode
+		for _, c := range n.children {
+			if c.label[0] == prefix[0] {
+				child = c
+				break
+			}
+		}
+
+		if child == nil {
+			n.children = append(n.children, &prefixNode{label: prefix, leaves: leafMatchers{l}})
+			return
+		}
+
+		common := commonPrefixLength(child.label, prefix)
+		if common < len(child.label) {
+			split := &prefixNode{
+				label:    child.label[common:],
+				children: child.children,
+				leaves:   child.leaves}
+			child.label = child.label[:common]
+			child.children = []*prefixNode{split}
+			child.leaves = nil
+		}
+
+		n, prefix = child, prefix[common:]
+	}
+
+	n.leaves = append(n.leaves, l)
+}
+
+// appends the leaf lists of the nodes whose prefix is a prefix of the
+// path
+func (n *prefixNode) collect(path string, lists []leafMatchers) []leafMatchers {
+	for {
+		if len(n.leaves) > 0 {
+			lists = append(lists, n.leaves)
+		}
+
+		var next *prefixNode
+		for _, c := range n.children {
+			if strings.HasPrefix(path, c.label) {
+				next = c
+				break
+			}
+		}
+
+		if next == nil {
+			return lists
+		}
+
+		n, path = next, path[len(next.label):]
+	}
+}
 
 type pathMatcher struct {
 	leaves            leafMatchers
+	index             *leafIndex
 	freeWildcardParam string
 }
 
-// root structure representing the routing tree.
+// root structure representing the routing tree. The values stored in
+// the path tree are the normalized paths, used as keys to the path
+// matchers, so that a path matcher can be replaced without rebuilding
+// the tree.
 type matcher struct {
 	paths           *pathmux.Tree
+	byPath          map[string]*pathMatcher
 	rootLeaves      leafMatchers
+	rootIndex       *leafIndex
 	matchingOptions MatchingOptions
 }
 
@@ -99,6 +226,74 @@ func compileRxs(exps []string) ([]*regexp.Regexp, error) {
 	return rxs, nil
 }
 
+// returns the literal substrings that any string matching the regexps
+// must contain
+func requiredLiterals(rxs []*regexp.Regexp) []string {
+	var literals []string
+	for _, rx := range rxs {
+		if prefix, _ := rx.LiteralPrefix(); prefix != "" {
+			literals = append(literals, prefix)
+		}
+	}
+
+	return literals
+}
+
+// returns the host if a regexp matches only a single, exact host, e.g.
+// ^www[.]example[.]org$
+func exactHost(rx *regexp.Regexp) (string, bool) {
+	prefix, complete := rx.LiteralPrefix()
+	if !complete {
+		return "", false
+	}
+
+	re, err := syntax.Parse(rx.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) != 3 ||
+		re.Sub[0].Op != syntax.OpBeginText ||
+		re.Sub[1].Op != syntax.OpLiteral ||
+		re.Sub[2].Op != syntax.OpEndText {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+// returns the literal prefix of a regexp, when the regexp is anchored to
+// the beginning of the text, e.g. /api/ for ^/api/, or an empty string
+func anchoredPrefix(rx *regexp.Regexp) string {
+	re, err := syntax.Parse(rx.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 ||
+		re.Sub[0].Op != syntax.OpBeginText ||
+		re.Sub[1].Op != syntax.OpLiteral ||
+		re.Sub[1].Flags&syntax.FoldCase != 0 {
+		return ""
+	}
+
+	return string(re.Sub[1].Rune)
+}
+
+// returns the longest anchored literal prefix of the path regexps
+func pathPrefix(rxs []*regexp.Regexp) string {
+	var longest string
+	for _, rx := range rxs {
+		if p := anchoredPrefix(rx); len(p) > len(longest) {
+			longest = p
+		}
+	}
+
+	return longest
+}
+
 // canonicalizes the keys of the header conditions
 func canonicalizeHeaders(h map[string]string) map[string]string {
 	ch := make(map[string]string)
@@ -144,13 +339,76 @@ func newLeaf(r *Route) (*leafMatcher, error) {
 		allHeaderRxs[k] = headerRxs
 	}
 
+	predicate, err := compileExpression(r.Predicate, r.predicates)
+	if err != nil {
+		return nil, err
+	}
+
+	custom, err := createPredicates(r.predicates, r.CustomPredicates)
+	if err != nil {
+		return nil, err
+	}
+
+	slashPolicy, custom := splitTrailingSlashPolicy(custom)
 	return &leafMatcher{
 		method:        r.Method,
 		hostRxs:       hostRxs,
 		pathRxs:       pathRxs,
 		headersExact:  canonicalizeHeaders(r.Headers),
 		headersRegexp: canonicalizeHeaderRegexps(allHeaderRxs),
-		route:         r}, nil
+		predicate:     predicate,
+		custom:        custom,
+		route:         r,
+		slashPolicy:   slashPolicy,
+		hostLiterals:  requiredLiterals(hostRxs),
+		pathLiterals:  requiredLiterals(pathRxs)}, nil
+}
+
+// sorts the leaves by their precedence, and creates an index for them,
+// if any of the leaves requires an exact host, or a path starting with
+// a literal prefix. The leaves requiring both are indexed by the host.
+func orderLeaves(leaves leafMatchers) *leafIndex {
+	sort.Sort(leaves)
+
+	var (
+		indexed bool
+		index   = &leafIndex{byHost: make(map[string]leafMatchers)}
+	)
+
+	for i, l := range leaves {
+		l.rank = i
+
+		host, exact := "", false
+		for _, rx := range l.hostRxs {
+			if host, exact = exactHost(rx); exact {
+				break
+			}
+		}
+
+		if exact {
+			index.byHost[host] = append(index.byHost[host], l)
+			indexed = true
+			continue
+		}
+
+		if prefix := pathPrefix(l.pathRxs); prefix != "" {
+			if index.byPathPrefix == nil {
+				index.byPathPrefix = &prefixNode{}
+			}
+
+			index.byPathPrefix.insert(prefix, l)
+			indexed = true
+			continue
+		}
+
+		index.rest = append(index.rest, l)
+	}
+
+	if !indexed {
+		return nil
+	}
+
+	return index
 }
 
 // returns the free form wildcard parameter of a path
@@ -164,10 +422,54 @@ func freeWildcardParam(path string) string {
 	return param[2:]
 }
 
+// returns the key of a route path in the path tree. In case ignoring
+// trailing slashes, all paths are stored and matched without the
+// trailing slash.
+func pathKey(p string, o MatchingOptions) string {
+	p = httppath.Clean(p)
+	if o.ignoreTrailingSlash() && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
+	}
+
+	return p
+}
+
+// creates a leaf matcher for a route, and sets its trailing slash
+// policy based on the matching options.
+func newPathLeaf(r *Route, o MatchingOptions) (*leafMatcher, error) {
+	l, err := newLeaf(r)
+	if err != nil || r.Path == "" {
+		return l, err
+	}
+
+	l.slash = hasTrailingSlash(httppath.Clean(r.Path))
+	if l.slashPolicy == trailingSlashDefault {
+		l.slashPolicy = o.trailingSlashPolicy()
+	}
+
+	return l, nil
+}
+
+// creates the path tree from the path matchers. The path matchers whose
+// path cannot be added to the tree are kept, but are not reachable.
+func buildPathTree(byPath map[string]*pathMatcher) (*pathmux.Tree, []*definitionError) {
+	var errors []*definitionError
+	tree := &pathmux.Tree{}
+	for p := range byPath {
+		if err := tree.Add(p, p); err != nil {
+			errors = append(errors, &definitionError{"", -1, err})
+		}
+	}
+
+	return tree, errors
+}
+
 // constructs a matcher based on the provided definitions.
 //
 // If `ignoreTrailingSlash` is true, the matcher handles
-// paths with or without a trailing slash equally.
+// paths with or without a trailing slash equally. The routes
+// that don't set their own trailing slash policy get the one
+// defined by the matching options.
 //
 // It constructs the route definition into a trie structure
 // based on their path condition, if any, and puts the routes
@@ -184,26 +486,18 @@ func newMatcher(rs []*Route, o MatchingOptions) (*matcher, []*definitionError) {
 	pathMatchers := make(map[string]*pathMatcher)
 
 	for i, r := range rs {
-		l, err := newLeaf(r)
+		l, err := newPathLeaf(r, o)
 		if err != nil {
 			errors = append(errors, &definitionError{r.Id, i, err})
 			continue
 		}
 
-		p := r.Path
-		if p == "" {
+		if r.Path == "" {
 			rootLeaves = append(rootLeaves, l)
 			continue
 		}
 
-		// normalize path
-		// in case ignoring trailing slashes, store and match all paths
-		// without the trailing slash
-		p = httppath.Clean(p)
-		if o.ignoreTrailingSlash() && p[len(p)-1] == '/' {
-			p = p[:len(p)-1]
-		}
-
+		p := pathKey(r.Path, o)
 		pm := pathMatchers[p]
 		if pm == nil {
 			pm = &pathMatcher{freeWildcardParam: freeWildcardParam(p)}
@@ -213,40 +507,46 @@ func newMatcher(rs []*Route, o MatchingOptions) (*matcher, []*definitionError) {
 		pm.leaves = append(pm.leaves, l)
 	}
 
-	pathTree := &pathmux.Tree{}
-	for p, m := range pathMatchers {
-
-		// sort leaves during construction time, based on their priority
-		sort.Sort(m.leaves)
-
-		err := pathTree.Add(p, m)
-		if err != nil {
-			errors = append(errors, &definitionError{"", -1, err})
-		}
+	// sort leaves during construction time, based on their priority
+	for _, m := range pathMatchers {
+		m.index = orderLeaves(m.leaves)
 	}
 
+	pathTree, treeErrors := buildPathTree(pathMatchers)
+	errors = append(errors, treeErrors...)
+
 	// sort root leaves during construction time, based on their priority
-	sort.Sort(rootLeaves)
+	rootIndex := orderLeaves(rootLeaves)
 
-	return &matcher{pathTree, rootLeaves, o}, errors
+	return &matcher{pathTree, pathMatchers, rootLeaves, rootIndex, o}, errors
 }
 
 // matches a path in the path trie structure.
-func matchPathTree(tree *pathmux.Tree, path string) (leafMatchers, map[string]string) {
-	v, params := tree.Lookup(path)
+func matchPathTree(m *matcher, path string) (leafMatchers, map[string]string) {
+	pm, params := lookupPathTree(m, path)
+	if pm == nil {
+		return nil, nil
+	}
+
+	return pm.leaves, params
+}
+
+// looks up a path in the path trie structure.
+func lookupPathTree(m *matcher, path string) (*pathMatcher, map[string]string) {
+	v, params := m.paths.Lookup(path)
 	if v == nil {
 		return nil, nil
 	}
 
 	// prepend slash in case of free form wildcards path segments (`/*name`),
-	pm := v.(*pathMatcher)
+	pm := m.byPath[v.(string)]
 	if pm.freeWildcardParam != "" {
 		freeParam := params[pm.freeWildcardParam]
 		freeParam = "/" + freeParam
 		params[pm.freeWildcardParam] = freeParam
 	}
 
-	return pm.leaves, params
+	return pm, params
 }
 
 // matches the path regexp conditions in a leaf matcher.
@@ -276,16 +576,37 @@ func matchHeader(h http.Header, key string, check func(string) bool) bool {
 	return false
 }
 
-// matches a set of request headers to the fix and regexp header conditions
-func matchHeaders(exact map[string]string, hrxs map[string][]*regexp.Regexp, h http.Header) bool {
-	// todo: would be better to allow any that match, even if slower
+// checks the required literals before evaluating the regexps
+func matchLiterals(literals []string, s string) bool {
+	for _, l := range literals {
+		if !strings.Contains(s, l) {
+			return false
+		}
+	}
 
+	return true
+}
+
+// matches a set of request headers to the fix header conditions
+func matchHeadersExact(exact map[string]string, h http.Header) bool {
 	for k, v := range exact {
 		if !matchHeader(h, k, func(val string) bool { return val == v }) {
 			return false
 		}
 	}
 
+	return true
+}
+
+// matches a set of request headers to the fix and regexp header conditions
+func matchHeaders(exact map[string]string, hrxs map[string][]*regexp.Regexp, h http.Header) bool {
+	return matchHeadersExact(exact, h) && matchHeaderRegexps(hrxs, h)
+}
+
+// matches a set of request headers to the regexp header conditions
+func matchHeaderRegexps(hrxs map[string][]*regexp.Regexp, h http.Header) bool {
+	// todo: would be better to allow any that match, even if slower
+
 	for k, rxs := range hrxs {
 		for _, rx := range rxs {
 			if !matchHeader(h, k, rx.MatchString) {
@@ -297,31 +618,114 @@ func matchHeaders(exact map[string]string, hrxs map[string][]*regexp.Regexp, h h
 	return true
 }
 
-// matches a request to the conditions in a leaf matcher
-func matchLeaf(l *leafMatcher, req *http.Request, path string) bool {
+// returns the name of the first condition in a leaf matcher that
+// doesn't match the request, or an empty string if all of them match.
+//
+// The cheap conditions are checked first, and the regular expressions
+// are evaluated only when all the other conditions, and the literals
+// required by the regular expressions, match.
+func leafMismatch(l *leafMatcher, req *http.Request, path string) string {
 	if l.method != "" && l.method != req.Method {
-		return false
+		return "Method"
+	}
+
+	return leafConditionsMismatch(l, req, path)
+}
+
+// like leafMismatch, but ignoring the method condition
+func leafConditionsMismatch(l *leafMatcher, req *http.Request, path string) string {
+	if !matchHeadersExact(l.headersExact, req.Header) {
+		return "Header"
+	}
+
+	if !matchLiterals(l.hostLiterals, req.Host) {
+		return "Host"
+	}
+
+	if !matchLiterals(l.pathLiterals, path) {
+		return "PathRegexp"
 	}
 
 	if !matchRegexps(l.hostRxs, req.Host) {
-		return false
+		return "Host"
 	}
 
 	if !matchRegexps(l.pathRxs, path) {
-		return false
+		return "PathRegexp"
 	}
 
-	if !matchHeaders(l.headersExact, l.headersRegexp, req.Header) {
-		return false
+	if !matchHeaderRegexps(l.headersRegexp, req.Header) {
+		return "HeaderRegexp"
 	}
 
-	return true
+	if l.predicate != nil && !l.predicate(req, path) {
+		return "Predicate"
+	}
+
+	for _, p := range l.custom {
+		if !p.Match(req) {
+			return p.name
+		}
+	}
+
+	return ""
+}
+
+// evaluates all the conditions of a leaf, in the same order as
+// leafMismatch, without stopping at the first one that the request
+// doesn't fulfil. The Path condition is reported as passed for the
+// leaves found in the path tree.
+func leafConditions(l *leafMatcher, req *http.Request, path string) []*Condition {
+	var cs []*Condition
+	check := func(name string, passed bool) {
+		cs = append(cs, &Condition{Name: name, Passed: passed})
+	}
+
+	if l.route.Path != "" {
+		check("Path", true)
+	}
+
+	if l.method != "" {
+		check("Method", l.method == req.Method)
+	}
+
+	if len(l.headersExact) > 0 {
+		check("Header", matchHeadersExact(l.headersExact, req.Header))
+	}
+
+	if len(l.hostRxs) > 0 {
+		check("Host", matchRegexps(l.hostRxs, req.Host))
+	}
+
+	if len(l.pathRxs) > 0 {
+		check("PathRegexp", matchRegexps(l.pathRxs, path))
+	}
+
+	if len(l.headersRegexp) > 0 {
+		check("HeaderRegexp", matchHeaderRegexps(l.headersRegexp, req.Header))
+	}
+
+	if l.predicate != nil {
+		check("Predicate", l.predicate(req, path))
+	}
+
+	for _, p := range l.custom {
+		check(p.name, p.Match(req))
+	}
+
+	return cs
+}
+
+// matches a request to the conditions in a leaf matcher
+func matchLeaf(l *leafMatcher, req *http.Request, path string) bool {
+	return leafMismatch(l, req, path) == ""
 }
 
-// matches a request to a set of leaf matchers
-func matchLeaves(leaves leafMatchers, req *http.Request, path string) *leafMatcher {
+// matches a request to a set of leaf matchers. When accept is not nil,
+// only the accepted leaves are evaluated.
+func matchLeaves(leaves leafMatchers, req *http.Request, path string, accept func(*leafMatcher) bool) *leafMatcher {
 	for _, l := range leaves {
-		if matchLeaf(l, req, path) {
+		if (accept == nil || accept(l)) && matchLeaf(l, req, path) {
 			return l
 		}
 	}
@@ -329,29 +733,228 @@ func matchLeaves(leaves leafMatchers, req *http.Request, path string) *leafMatch
 	return nil
 }
 
+// matches a request to a set of leaf matchers, using the index if
+// available. The leaves indexed by the request host, the leaves indexed
+// by the prefixes of the request path, and the not indexed leaves are
+// evaluated together, in the order of their precedence.
+func matchIndexedLeaves(leaves leafMatchers, index *leafIndex, req *http.Request, path string, accept func(*leafMatcher) bool) *leafMatcher {
+	if index == nil {
+		return matchLeaves(leaves, req, path, accept)
+	}
+
+	var buf [8]leafMatchers
+	lists := append(buf[:0], index.byHost[req.Host], index.rest)
+	if index.byPathPrefix != nil {
+		lists = index.byPathPrefix.collect(path, lists)
+	}
+
+	for {
+		next := -1
+		for i, li := range lists {
+			if len(li) > 0 && (next < 0 || li[0].rank < lists[next][0].rank) {
+				next = i
+			}
+		}
+
+		if next < 0 {
+			return nil
+		}
+
+		l := lists[next][0]
+		lists[next] = lists[next][1:]
+		if (accept == nil || accept(l)) && matchLeaf(l, req, path) {
+			return l
+		}
+	}
+}
+
+// collapses the duplicate slashes in the request path and resolves the
+// dot segments, unless canonicalization is disabled
+func (m *matcher) cleanPath(r *http.Request) string {
+	path := r.URL.Path
+	if !m.matchingOptions.noCanonicalization() {
+		path = httppath.Clean(path)
+	} else if path == "" {
+		path = "/"
+	}
+
+	return path
+}
+
+// normalizes the request path before matching. In case ignoring
+// trailing slashes, returns the path without the trailing slash.
+func (m *matcher) normalizePath(r *http.Request) string {
+	return m.trimPath(m.cleanPath(r))
+}
+
+// removes the trailing slash from a clean path, in case ignoring
+// trailing slashes
+func (m *matcher) trimPath(path string) string {
+	if m.matchingOptions.ignoreTrailingSlash() && path[len(path)-1] == '/' {
+		path = path[:len(path)-1]
+	}
+
+	return path
+}
+
+// returns the leaf accept functions for the lookup of the request path
+// and for the lookup of the path with the trailing slash toggled. When
+// ignoring trailing slashes, the paths in the tree don't have a trailing
+// slash, and only the strict routes need to be excluded if the trailing
+// slash of the request differs. Otherwise, the exact lookup accepts every
+// route, and the toggled lookup only the routes that are not strict.
+func (m *matcher) slashAccept(pm *pathMatcher, clean string) (exact, toggled func(*leafMatcher) bool) {
+	toggled = func(l *leafMatcher) bool { return l.slashPolicy != trailingSlashStrict }
+	if !m.matchingOptions.ignoreTrailingSlash() || pm == nil || pm.freeWildcardParam != "" {
+		return nil, toggled
+	}
+
+	slash := hasTrailingSlash(clean)
+	exact = func(l *leafMatcher) bool { return l.slash == slash || l.slashPolicy != trailingSlashStrict }
+	return exact, toggled
+}
+
+// matches the request in the path tree, taking the trailing slash policies
+// into account. When the matching route requires a redirect to the other
+// form of the path, it returns the path to redirect to.
+func (m *matcher) matchPath(r *http.Request, clean, path string) (*leafMatcher, map[string]string, string) {
+	pm, params := lookupPathTree(m, path)
+	if pm != nil {
+		exact, _ := m.slashAccept(pm, clean)
+		if l := matchIndexedLeaves(pm.leaves, pm.index, r, path, exact); l != nil {
+			if exact != nil && l.slashPolicy == trailingSlashRedirect && l.slash != hasTrailingSlash(clean) {
+				return l, params, canonicalSlashPath(clean, l.slash)
+			}
+
+			return l, params, ""
+		}
+	}
+
+	if m.matchingOptions.ignoreTrailingSlash() || path == "/" {
+		return nil, nil, ""
+	}
+
+	pm, params = lookupPathTree(m, toggleTrailingSlash(path))
+	if pm == nil {
+		return nil, nil, ""
+	}
+
+	_, toggled := m.slashAccept(pm, clean)
+	l := matchIndexedLeaves(pm.leaves, pm.index, r, path, toggled)
+	if l == nil {
+		return nil, nil, ""
+	}
+
+	if l.slashPolicy == trailingSlashRedirect {
+		return l, params, toggleTrailingSlash(clean)
+	}
+
+	return l, params, ""
+}
+
+// Returns the host without the port, in lowercase, and without the
+// trailing dot, as used for the route matching.
+func CanonicalHost(h string) string {
+	if host, _, err := net.SplitHostPort(h); err == nil {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		h = host
+	}
+
+	return strings.TrimSuffix(strings.ToLower(h), ".")
+}
+
+// returns the request with the canonical host, unless canonicalization
+// is disabled. The request is copied only when the host changes.
+func (m *matcher) normalizeHost(r *http.Request) *http.Request {
+	if m.matchingOptions.noCanonicalization() {
+		return r
+	}
+
+	h := CanonicalHost(r.Host)
+	if h == r.Host {
+		return r
+	}
+
+	rr := *r
+	rr.Host = h
+	return &rr
+}
+
 // tries to match a request against the available definitions. If a match is found,
 // returns the associated value, and the wildcard parameters from the path definition,
 // if any.
 func (m *matcher) match(r *http.Request) (*Route, map[string]string) {
-	// normalize path before matching
-	// in case ignoring trailing slashes, match without the trailing slash
-	path := httppath.Clean(r.URL.Path)
-	if m.matchingOptions.ignoreTrailingSlash() && path[len(path)-1] == '/' {
-		path = path[:len(path)-1]
-	}
+	r = m.normalizeHost(r)
+	clean := m.cleanPath(r)
+	path := m.trimPath(clean)
 
 	// first match fixed and wildcard paths
-	leaves, params := matchPathTree(m.paths, path)
-	l := matchLeaves(leaves, r, path)
+	l, params, redirect := m.matchPath(r, clean, path)
 	if l != nil {
+		if redirect != "" {
+			return trailingSlashRedirectRoute(l.route, r, redirect), nil
+		}
+
 		return l.route, params
 	}
 
 	// if no path match, match root leaves for other conditions
-	l = matchLeaves(m.rootLeaves, r, path)
+	l = matchIndexedLeaves(m.rootLeaves, m.rootIndex, r, path, nil)
 	if l != nil {
 		return l.route, nil
 	}
 
 	return nil, nil
 }
+
+// collects the methods of those leaves that match every condition of the
+// request except for the method. When accept is not nil, only the
+// accepted leaves are evaluated.
+func appendAllowedMethods(methods []string, leaves leafMatchers, req *http.Request, path string, accept func(*leafMatcher) bool) []string {
+	for _, l := range leaves {
+		if l.method != "" && (accept == nil || accept(l)) && leafConditionsMismatch(l, req, path) == "" {
+			methods = append(methods, l.method)
+		}
+	}
+
+	return methods
+}
+
+// returns the sorted, distinct methods accepted by the routes that would
+// match the request with a different method
+func (m *matcher) allowedMethods(r *http.Request) []string {
+	r = m.normalizeHost(r)
+	clean := m.cleanPath(r)
+	path := m.trimPath(clean)
+
+	var methods []string
+	if pm, _ := lookupPathTree(m, path); pm != nil {
+		exact, _ := m.slashAccept(pm, clean)
+		methods = appendAllowedMethods(methods, pm.leaves, r, path, exact)
+	}
+
+	if !m.matchingOptions.ignoreTrailingSlash() && path != "/" {
+		if pm, _ := lookupPathTree(m, toggleTrailingSlash(path)); pm != nil {
+			_, toggled := m.slashAccept(pm, clean)
+			methods = appendAllowedMethods(methods, pm.leaves, r, path, toggled)
+		}
+	}
+
+	methods = appendAllowedMethods(methods, m.rootLeaves, r, path, nil)
+	if len(methods) == 0 {
+		return nil
+	}
+
+	sort.Strings(methods)
+	distinct := methods[:1]
+	for _, mi := range methods[1:] {
+		if mi != distinct[len(distinct)-1] {
+			distinct = append(distinct, mi)
+		}
+	}
+
+	return distinct
+}
@@ -108,7 +108,7 @@ func docToRoutes(doc string) ([]*Route, error) {
 		return nil, err
 	}
 
-	return processRouteDefs(nil, defs), nil
+	return processRouteDefs(nil, nil, defs), nil
 }
 
 // parse a routing document with a single route
@@ -195,7 +195,7 @@ func generateRoutes(paths []string) []*Route {
 		defs[i] = &eskip.Route{Id: fmt.Sprintf("route%d", i), Path: p, Backend: p}
 	}
 
-	return processRouteDefs(nil, defs)
+	return processRouteDefs(nil, nil, defs)
 }
 
 // generate requests based on a set of paths
@@ -621,7 +621,7 @@ func TestMatchLeavesFalse(t *testing.T) {
 	l0 := &leafMatcher{method: "PUT"}
 	l1 := &leafMatcher{method: "POST"}
 	req := &http.Request{Method: "GET"}
-	if matchLeaves([]*leafMatcher{l0, l1}, req, "/some/path") != nil {
+	if matchLeaves([]*leafMatcher{l0, l1}, req, "/some/path", nil) != nil {
 		t.Error("failed not to match leaves")
 	}
 }
@@ -630,20 +630,30 @@ func TestMatchLeavesTrue(t *testing.T) {
 	l0 := &leafMatcher{method: "PUT"}
 	l1 := &leafMatcher{method: "POST"}
 	req := &http.Request{Method: "PUT"}
-	if matchLeaves([]*leafMatcher{l0, l1}, req, "/some/path") != l0 {
+	if matchLeaves([]*leafMatcher{l0, l1}, req, "/some/path", nil) != l0 {
 		t.Error("failed not to match leaves")
 	}
 }
 
+// creates an empty matcher, whose paths can be set with addTestPath
+func newPathTestMatcher() *matcher {
+	return &matcher{paths: &pathmux.Tree{}, byPath: make(map[string]*pathMatcher)}
+}
+
+func addTestPath(m *matcher, p string, pm *pathMatcher) error {
+	m.byPath[p] = pm
+	return m.paths.Add(p, p)
+}
+
 func TestMatchPathTreeNoMatch(t *testing.T) {
-	tree := &pathmux.Tree{}
+	tree := newPathTestMatcher()
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
 	pm1 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	err := tree.Add("/some/path", pm0)
+	err := addTestPath(tree, "/some/path", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	err = tree.Add("/some/other/path", pm1)
+	err = addTestPath(tree, "/some/other/path", pm1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -654,14 +664,14 @@ func TestMatchPathTreeNoMatch(t *testing.T) {
 }
 
 func TestMatchPathTree(t *testing.T) {
-	tree := &pathmux.Tree{}
+	tree := newPathTestMatcher()
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
 	pm1 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	err := tree.Add("/some/path", pm0)
+	err := addTestPath(tree, "/some/path", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	err = tree.Add("/some/other/path", pm1)
+	err = addTestPath(tree, "/some/other/path", pm1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -672,14 +682,14 @@ func TestMatchPathTree(t *testing.T) {
 }
 
 func TestMatchPathTreeWithWildcards(t *testing.T) {
-	tree := &pathmux.Tree{}
+	tree := newPathTestMatcher()
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
 	pm1 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	err := tree.Add("/some/path/:param0/:param1", pm0)
+	err := addTestPath(tree, "/some/path/:param0/:param1", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	err = tree.Add("/some/other/path/*_", pm1)
+	err = addTestPath(tree, "/some/other/path/*_", pm1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -692,12 +702,12 @@ func TestMatchPathTreeWithWildcards(t *testing.T) {
 
 func TestMatchPath(t *testing.T) {
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	tree := &pathmux.Tree{}
-	err := tree.Add("/some/path", pm0)
+	tree := newPathTestMatcher()
+	err := addTestPath(tree, "/some/path", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	m := &matcher{paths: tree}
+	m := tree
 	req := &http.Request{URL: &url.URL{Path: "/some/path"}}
 	r, p := m.match(req)
 	if r != pm0.leaves[0].route || len(p) != 0 {
@@ -707,12 +717,12 @@ func TestMatchPath(t *testing.T) {
 
 func TestMatchPathResolved(t *testing.T) {
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	tree := &pathmux.Tree{}
-	err := tree.Add("/some/path", pm0)
+	tree := newPathTestMatcher()
+	err := addTestPath(tree, "/some/path", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	m := &matcher{paths: tree}
+	m := tree
 	req := &http.Request{URL: &url.URL{Path: "/some/some-other/../path"}}
 	r, p := m.match(req)
 	if r != pm0.leaves[0].route || len(p) != 0 {
@@ -722,12 +732,12 @@ func TestMatchPathResolved(t *testing.T) {
 
 func TestMatchWrongMethod(t *testing.T) {
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{method: "PUT"}}}
-	tree := &pathmux.Tree{}
-	err := tree.Add("/some/path/*_", pm0)
+	tree := newPathTestMatcher()
+	err := addTestPath(tree, "/some/path/*_", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	m := &matcher{paths: tree}
+	m := tree
 	req := &http.Request{Method: "GET", URL: &url.URL{Path: "/some/some-other/../path"}}
 	r, p := m.match(req)
 	if r != nil || len(p) != 0 {
@@ -736,14 +746,14 @@ func TestMatchWrongMethod(t *testing.T) {
 }
 
 func TestMatchTopLeaves(t *testing.T) {
-	tree := &pathmux.Tree{}
+	tree := newPathTestMatcher()
 	l := &leafMatcher{method: "PUT"}
 	pm := &pathMatcher{leaves: leafMatchers{l}}
-	err := tree.Add("/*", pm)
+	err := addTestPath(tree, "/*", pm)
 	if err != nil {
 		t.Error(err)
 	}
-	m := &matcher{paths: tree}
+	m := tree
 	req := &http.Request{Method: "PUT", URL: &url.URL{Path: "/some/some-other/../path"}}
 	r, _ := m.match(req)
 	if r != l.route {
@@ -752,18 +762,18 @@ func TestMatchTopLeaves(t *testing.T) {
 }
 
 func TestMatchWildcardPaths(t *testing.T) {
-	tree := &pathmux.Tree{}
+	tree := newPathTestMatcher()
 	pm0 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
 	pm1 := &pathMatcher{leaves: []*leafMatcher{&leafMatcher{}}}
-	err := tree.Add("/some/path/:param0/:param1", pm0)
+	err := addTestPath(tree, "/some/path/:param0/:param1", pm0)
 	if err != nil {
 		t.Error(err)
 	}
-	err = tree.Add("/some/other/path/*_", pm1)
+	err = addTestPath(tree, "/some/other/path/*_", pm1)
 	if err != nil {
 		t.Error(err)
 	}
-	rm := &matcher{paths: tree}
+	rm := tree
 	req := &http.Request{URL: &url.URL{Path: "/some/path/and/params"}}
 	r, p := rm.match(req)
 	if r != pm0.leaves[0].route || len(p) != 2 ||
@@ -1131,3 +1141,440 @@ func BenchmarkConstructionMass(b *testing.B) {
 		}
 	}
 }
+
+func TestMatchPrecedenceIndependentOfOrder(t *testing.T) {
+	rs, err := docToRoutes(`
+		route1: Method("GET") -> "https://route1.example.org";
+		route0: Host(/example/) -> "https://route0.example.org";
+		route2: Method("GET") && Host(/example/) -> "https://route2.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := &http.Request{Method: "GET", Host: "www.example.org", URL: &url.URL{Path: "/some/path"}}
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 0, 2}, {1, 2, 0}} {
+		m, errs := newMatcher([]*Route{rs[order[0]], rs[order[1]], rs[order[2]]}, MatchingOptionsNone)
+		if len(errs) != 0 {
+			t.Error(errs)
+			return
+		}
+
+		if r, _ := m.match(req); r == nil || r.Id != "route2" {
+			t.Error("failed to match the route with the most conditions", order)
+		}
+	}
+
+	for _, order := range [][]int{{0, 1}, {1, 0}} {
+		m, errs := newMatcher([]*Route{rs[order[0]], rs[order[1]]}, MatchingOptionsNone)
+		if len(errs) != 0 {
+			t.Error(errs)
+			return
+		}
+
+		if r, _ := m.match(req); r == nil || r.Id != "route0" {
+			t.Error("failed to match the route with the lower id", order)
+		}
+	}
+}
+
+func TestExactHost(t *testing.T) {
+	for rx, host := range map[string]string{
+		`^www[.]example[.]org$`: "www.example.org",
+		`^www\.example\.org$`:   "www.example.org",
+		`^www.example.org$`:     "",
+		`www[.]example[.]org`:   "",
+		`^www[.]example[.]org`:  "",
+		`(?i)^www[.]example$`:   "",
+		`^a$|^b$`:               "",
+	} {
+		h, ok := exactHost(regexp.MustCompile(rx))
+		if ok != (host != "") || h != host {
+			t.Error("failed to detect exact host", rx, h, ok)
+		}
+	}
+}
+
+func TestMatchLiteralsBeforeRegexps(t *testing.T) {
+	rs, err := docToRoutes(`Host(/example[.]org$/) && PathRegexp(/^\/api/) -> "https://www.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	l, err := newLeaf(rs[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(l.hostLiterals) != 1 || l.hostLiterals[0] != "example.org" ||
+		len(l.pathLiterals) != 1 || l.pathLiterals[0] != "/api" {
+		t.Error("failed to extract literals", l.hostLiterals, l.pathLiterals)
+	}
+
+	req := &http.Request{Host: "www.example.com", URL: &url.URL{Path: "/api"}}
+	if leafMismatch(l, req, "/api") != "Host" {
+		t.Error("failed to not match host literal")
+	}
+}
+
+func TestMatchHostIndexPrecedence(t *testing.T) {
+	rs, err := docToRoutes(`
+		exactHost: Host(/^www[.]example[.]org$/) -> "https://exact.example.org";
+		hostAndMethod: Host(/example/) && Method("GET") -> "https://method.example.org";
+		exactOther: Host(/^www[.]example[.]com$/) -> "https://other.example.org";
+		exactPath: Path("/some/path") && Host(/^www[.]example[.]org$/) -> "https://path.example.org";
+		catchAll: Any() -> "https://catchall.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	m, errs := newMatcher(rs, MatchingOptionsNone)
+	if len(errs) != 0 {
+		t.Error(errs)
+		return
+	}
+
+	if m.rootIndex == nil || len(m.rootIndex.byHost) != 2 || len(m.rootIndex.rest) != 2 {
+		t.Error("failed to index routes by host")
+	}
+
+	for _, ti := range []struct {
+		method, host, path, route string
+	}{
+		{"GET", "www.example.org", "/", "hostAndMethod"},
+		{"POST", "www.example.org", "/", "exactHost"},
+		{"POST", "www.example.com", "/", "exactOther"},
+		{"POST", "api.example.org", "/", "catchAll"},
+		{"GET", "api.example.org", "/", "hostAndMethod"},
+		{"POST", "www.example.org", "/some/path", "exactPath"},
+		{"POST", "www.example.com", "/some/path", "exactOther"},
+	} {
+		req := &http.Request{Method: ti.method, Host: ti.host, URL: &url.URL{Path: ti.path}}
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.route {
+			t.Error("failed to match", ti.method, ti.host, ti.path, ti.route)
+		}
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	for _, ti := range []struct {
+		host, canonical string
+	}{
+		{"www.example.org", "www.example.org"},
+		{"WWW.Example.ORG", "www.example.org"},
+		{"www.example.org:8080", "www.example.org"},
+		{"www.example.org.", "www.example.org"},
+		{"WWW.example.org.:443", "www.example.org"},
+		{"[::1]:8080", "[::1]"},
+		{"127.0.0.1:9090", "127.0.0.1"},
+		{"", ""},
+	} {
+		if h := CanonicalHost(ti.host); h != ti.canonical {
+			t.Error("invalid canonical host", ti.host, h, ti.canonical)
+		}
+	}
+}
+
+func TestMatchCanonicalized(t *testing.T) {
+	rs, err := docToRoutes(`
+		exactHost: Host(/^www[.]example[.]org$/) -> "https://exact.example.org";
+		path: Path("/some/path") -> "https://path.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, ti := range []struct {
+		options           MatchingOptions
+		host, path, route string
+	}{
+		{MatchingOptionsNone, "WWW.Example.org:8080", "/", "exactHost"},
+		{MatchingOptionsNone, "www.example.org.", "/", "exactHost"},
+		{MatchingOptionsNone, "api.example.org", "//some/./other/../path", "path"},
+		{NoCanonicalization, "WWW.Example.org:8080", "/", ""},
+		{NoCanonicalization, "api.example.org", "//some/./other/../path", ""},
+		{NoCanonicalization, "www.example.org", "/some/path", "path"},
+	} {
+		m, errs := newMatcher(rs, ti.options)
+		if len(errs) != 0 {
+			t.Error(errs)
+			return
+		}
+
+		req := &http.Request{Method: "GET", Host: ti.host, URL: &url.URL{Path: ti.path}}
+		r, _ := m.match(req)
+		if ti.route == "" && r != nil || ti.route != "" && (r == nil || r.Id != ti.route) {
+			t.Error("failed to match", ti.options, ti.host, ti.path, ti.route)
+		}
+
+		if req.Host != ti.host {
+			t.Error("the request was modified")
+		}
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	rs, err := docToRoutes(`
+		get: Path("/users/:id") && Method("GET") -> "https://users.example.org";
+		put: Path("/users/:id") && Method("PUT") -> "https://users.example.org";
+		putAdmin: Path("/users/:id") && Method("DELETE") && Header("X-Admin", "true") -> "https://users.example.org";
+		post: PathRegexp(/^\/orders/) && Method("POST") -> "https://orders.example.org";
+		getOrders: PathRegexp(/^\/orders/) && Method("GET") -> "https://orders.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	m, errs := newMatcher(rs, MatchingOptionsNone)
+	if len(errs) != 0 {
+		t.Error(errs)
+		return
+	}
+
+	for _, ti := range []struct {
+		method, path string
+		allowed      []string
+	}{
+		{"POST", "/users/42", []string{"GET", "PUT"}},
+		{"PATCH", "/orders/42", []string{"GET", "POST"}},
+		{"GET", "/other", nil},
+	} {
+		req := &http.Request{Method: ti.method, URL: &url.URL{Path: ti.path}, Header: make(http.Header)}
+		if r, _ := m.match(req); r != nil {
+			t.Error("unexpected match", ti.path, r.Id)
+		}
+
+		allowed := m.allowedMethods(req)
+		if len(allowed) != len(ti.allowed) {
+			t.Error("invalid allowed methods", ti.path, allowed)
+			continue
+		}
+
+		for i, a := range allowed {
+			if a != ti.allowed[i] {
+				t.Error("invalid allowed methods", ti.path, allowed)
+			}
+		}
+	}
+}
+
+const benchmarkHostCount = 200000
+
+var (
+	benchmarkHostMatcher  *matcher
+	benchmarkHostRequests []*http.Request
+)
+
+func initHostMatcher(b *testing.B) {
+	if benchmarkHostMatcher != nil {
+		return
+	}
+
+	routes := make([]*Route, benchmarkHostCount)
+	for i := 0; i < benchmarkHostCount; i++ {
+		routes[i] = &Route{
+			Route: eskip.Route{
+				Id:          fmt.Sprintf("route%d", i),
+				HostRegexps: []string{fmt.Sprintf("^host-%d[.]example[.]org$", i)},
+				PathRegexps: []string{"^/api/"},
+				Backend:     fmt.Sprintf("https://backend-%d.example.org", i)},
+			Scheme: "https",
+			Host:   fmt.Sprintf("backend-%d.example.org", i)}
+	}
+
+	m, errs := newMatcher(routes, MatchingOptionsNone)
+	if len(errs) != 0 {
+		b.Fatal(errs)
+	}
+
+	benchmarkHostMatcher = m
+	for i := 0; i < 1000; i++ {
+		benchmarkHostRequests = append(benchmarkHostRequests, &http.Request{
+			Method: "GET",
+			Host:   fmt.Sprintf("host-%d.example.org", i*benchmarkHostCount/1000),
+			URL:    &url.URL{Path: "/api/resource"}})
+	}
+}
+
+func BenchmarkHostIndex200k(b *testing.B) {
+	initHostMatcher(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := benchmarkHostRequests[i%len(benchmarkHostRequests)]
+		if r, _ := benchmarkHostMatcher.match(req); r == nil {
+			b.Fatal("failed to match", req.Host)
+		}
+	}
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	for _, ti := range []struct {
+		rx     string
+		prefix string
+	}{
+		{"^/api/v1/", "/api/v1/"},
+		{"^/api$", "/api"},
+		{"^/api/.*[.]html$", "/api/"},
+		{"/api", ""},
+		{"^/api|^/other", ""},
+		{"(?m)^/api", ""},
+		{"(?i)^/api", ""},
+		{"^", ""},
+		{".*", ""},
+	} {
+		if p := anchoredPrefix(regexp.MustCompile(ti.rx)); p != ti.prefix {
+			t.Errorf("invalid prefix of %s: %q", ti.rx, p)
+		}
+	}
+}
+
+func TestPathPrefixIndex(t *testing.T) {
+	m, err := docToMatcher(`
+		api: PathRegexp("^/api/") -> "https://api.example.org";
+		apiPost: PathRegexp("^/api/") && Method("POST") -> "https://api-post.example.org";
+		apiV1: PathRegexp("^/api/v1/") && PathRegexp("users") -> "https://api-v1.example.org";
+		apiVersion: PathRegexp("^/api/v[0-9]+/") && Header("X-Version", "2") -> "https://api-version.example.org";
+		assets: PathRegexp("^/assets") && PathRegexp("[.]css$") -> "https://assets.example.org";
+		anywhere: PathRegexp("/users/") -> "https://anywhere.example.org";
+		host: Host("^www[.]example[.]org$") && PathRegexp("^/api/") -> "https://host.example.org";
+		catchAll: Any() -> "https://catchall.example.org";
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.rootIndex == nil || m.rootIndex.byPathPrefix == nil {
+		t.Fatal("failed to index the path prefixes")
+	}
+
+	for _, ti := range []struct {
+		method string
+		host   string
+		path   string
+		header string
+		id     string
+	}{
+		{"GET", "api.example.org", "/api/foo", "", "api"},
+		{"POST", "api.example.org", "/api/foo", "", "apiPost"},
+		{"GET", "api.example.org", "/api/v1/users", "", "apiV1"},
+		{"GET", "api.example.org", "/api/v1/orders", "", "api"},
+		{"GET", "api.example.org", "/api/v2/orders", "2", "apiVersion"},
+		{"GET", "api.example.org", "/assets/main.css", "", "assets"},
+		{"GET", "api.example.org", "/assets/main.js", "", "catchAll"},
+		{"GET", "api.example.org", "/other/users/42", "", "anywhere"},
+		{"GET", "www.example.org", "/api/foo", "", "host"},
+		{"GET", "api.example.org", "/ap", "", "catchAll"},
+	} {
+		req, err := http.NewRequest(ti.method, "https://"+ti.host+ti.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ti.header != "" {
+			req.Header.Set("X-Version", ti.header)
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.id {
+			t.Error("invalid match", ti.path, ti.id, r)
+		}
+
+		// the index must not change the precedence
+		if l := matchLeaves(m.rootLeaves, req, m.normalizePath(req), nil); l == nil || l.route != r {
+			t.Error("the index changed the precedence", ti.path)
+		}
+	}
+}
+
+func TestPrefixNodeSplit(t *testing.T) {
+	root := &prefixNode{}
+	leaves := make(map[string]*leafMatcher)
+	for i, p := range []string{"/api/v1/", "/api/v2/", "/api/", "/assets", "/a"} {
+		leaves[p] = &leafMatcher{rank: i}
+		root.insert(p, leaves[p])
+	}
+
+	for _, ti := range []struct {
+		path     string
+		prefixes []string
+	}{
+		{"/api/v1/users", []string{"/a", "/api/", "/api/v1/"}},
+		{"/api/v3/users", []string{"/a", "/api/"}},
+		{"/assets/main.css", []string{"/a", "/assets"}},
+		{"/other", nil},
+	} {
+		lists := root.collect(ti.path, nil)
+		if len(lists) != len(ti.prefixes) {
+			t.Error("invalid number of leaf lists", ti.path, len(lists))
+			continue
+		}
+
+		for i, p := range ti.prefixes {
+			if len(lists[i]) != 1 || lists[i][0] != leaves[p] {
+				t.Error("invalid leaves", ti.path, p)
+			}
+		}
+	}
+}
+
+const benchmarkPrefixCount = 10000
+
+var benchmarkPrefixMatchers = make(map[string]*matcher)
+
+// creates routes with a path regexp per service, anchored or not
+func initPrefixMatcher(b *testing.B, format string) *matcher {
+	if m, ok := benchmarkPrefixMatchers[format]; ok {
+		return m
+	}
+
+	routes := make([]*Route, benchmarkPrefixCount)
+	for i := 0; i < benchmarkPrefixCount; i++ {
+		routes[i] = &Route{
+			Route: eskip.Route{
+				Id:          fmt.Sprintf("route%d", i),
+				PathRegexps: []string{fmt.Sprintf(format, i)},
+				Backend:     fmt.Sprintf("https://backend-%d.example.org", i)},
+			Scheme: "https",
+			Host:   fmt.Sprintf("backend-%d.example.org", i)}
+	}
+
+	m, errs := newMatcher(routes, MatchingOptionsNone)
+	if len(errs) != 0 {
+		b.Fatal(errs)
+	}
+
+	benchmarkPrefixMatchers[format] = m
+	return m
+}
+
+func benchmarkPathRegexps(b *testing.B, format string) {
+	m := initPrefixMatcher(b, format)
+	var requests []*http.Request
+	for i := 0; i < 1000; i++ {
+		requests = append(requests, &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Path: fmt.Sprintf("/service-%d/resource", i*benchmarkPrefixCount/1000)}})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := requests[i%len(requests)]
+		if r, _ := m.match(req); r == nil {
+			b.Fatal("failed to match", req.URL.Path)
+		}
+	}
+}
+
+// path regexps with an anchored prefix, looked up in the prefix tree
+func BenchmarkPathPrefixIndex10k(b *testing.B) {
+	benchmarkPathRegexps(b, "^/service-%d/")
+}
+
+// path regexps without an anchor, evaluated one by one
+func BenchmarkPathRegexpUnindexed10k(b *testing.B) {
+	benchmarkPathRegexps(b, "/service-%d/")
+}
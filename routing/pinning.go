@@ -0,0 +1,151 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// The header values pinning a request to the table before the current
+// one, or to the candidate of a rollout in progress.
+const (
+	PinPreviousTable  = "previous"
+	PinCandidateTable = "candidate"
+)
+
+// Settings of pinning the requests to a specific version of the routing
+// table, for debugging. The versions of the applied routing tables are
+// numbered incrementally, starting with 1, and the last few of them are
+// retained in memory. The requests from the trusted clients, with the
+// pinning header set to a retained version, e.g. X-Routing-Table: 41,
+// or to "previous", are matched with that version of the table, instead
+// of the current one. With "candidate", they are matched with the
+// candidate table of a rollout in progress. Allows comparing the old and
+// the new routing behavior on live traffic during migrations.
+//
+// The requests pinning to an unknown version are routed with the current
+// table. The pinning is disabled, when any of the fields is not set.
+type TablePinning struct {
+
+	// The name of the request header selecting the table version.
+	Header string
+
+	// The number of the previous table versions retained, in addition
+	// to the current one.
+	Retain int
+
+	// The addresses of the clients allowed to pin their requests. The
+	// client address is the remote address of the connection, and it
+	// is taken from the X-Forwarded-For header only behind trusted
+	// proxies, so that the clients cannot claim a trusted address by
+	// setting the header. See ClientIP and SetTrustedProxies.
+	TrustedClients IPRanges
+}
+
+// a retained version of the routing table
+type tableSnapshot struct {
+	version int
+	matcher *matcher
+}
+
+func (p TablePinning) enabled() bool {
+	return p.Header != "" && p.Retain > 0 && len(p.TrustedClients) > 0
+}
+
+// Sets the pinning settings. Only the tables applied after the call are
+// retained for pinning.
+func (r *Routing) SetTablePinning(p TablePinning) {
+	r.tablePinning.Store(p)
+}
+
+func (r *Routing) getTablePinning() TablePinning {
+	p, _ := r.tablePinning.Load().(TablePinning)
+	return p
+}
+
+// Returns the version of the current routing table, or 0, when no routes
+// were applied yet.
+func (r *Routing) TableVersion() int {
+	return r.tableVersion.Load().(int)
+}
+
+// records a newly applied table, dropping the versions not retained
+func (r *Routing) storeSnapshot(version int, m *matcher) {
+	r.tableVersion.Store(version)
+
+	p := r.getTablePinning()
+	if !p.enabled() {
+		r.snapshots.Store([]tableSnapshot(nil))
+		return
+	}
+
+	previous := r.snapshots.Load().([]tableSnapshot)
+	s := append([]tableSnapshot{{version, m}}, previous...)
+	if len(s) > p.Retain+1 {
+		s = s[:p.Retain+1]
+	}
+
+	r.snapshots.Store(s)
+}
+
+// returns the table version that the request is pinned to, or nil, when
+// the request is not pinned, or the version is not retained
+func (r *Routing) pinnedMatcher(req *http.Request) *matcher {
+	p := r.getTablePinning()
+	if !p.enabled() {
+		return nil
+	}
+
+	v := req.Header.Get(p.Header)
+	if v == "" || !matchClientIP(req, p.TrustedClients) {
+		return nil
+	}
+
+	s := r.snapshots.Load().([]tableSnapshot)
+	switch v {
+	case PinCandidateTable:
+		return r.tables.Load().(*activeTables).candidate
+	case PinPreviousTable:
+		if len(s) > 1 {
+			return s[1].matcher
+		}
+
+		return nil
+	}
+
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return nil
+	}
+
+	for _, si := range s {
+		if si.version == version {
+			return si.matcher
+		}
+	}
+
+	return nil
+}
+
+// returns the table for matching the request: the pinned one, when set,
+// or otherwise the current one or the candidate of a rollout
+func (r *Routing) matcher(req *http.Request) *matcher {
+	if m := r.pinnedMatcher(req); m != nil {
+		return m
+	}
+
+	return r.tables.Load().(*activeTables).matcher(req)
+}
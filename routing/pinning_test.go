@@ -0,0 +1,157 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitTableVersion(t *testing.T, rt *routing.Routing, version int) {
+	for i := 0; i < 30; i++ {
+		if rt.TableVersion() == version {
+			return
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	t.Fatal("failed to apply the table version", version, rt.TableVersion())
+}
+
+func TestTablePinning(t *testing.T) {
+	dc := testdataclient.New([]*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://v1.example.org"}})
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{dc},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	trusted, err := routing.ParseIPRanges([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.SetTablePinning(routing.TablePinning{Header: "X-Routing-Table", Retain: 1, TrustedClients: trusted})
+	waitTableVersion(t, rt, 1)
+
+	<-waitUpdate(dc, []*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://v2.example.org"}}, nil, false)
+	waitTableVersion(t, rt, 2)
+
+	<-waitUpdate(dc, []*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://v3.example.org"}}, nil, false)
+	waitTableVersion(t, rt, 3)
+
+	for _, ti := range []struct {
+		msg, remoteAddr, pin string
+		forwarded            string
+		expected             string
+	}{
+		{"not pinned", "10.0.0.1:1234", "", "", "https://v3.example.org"},
+		{"untrusted", "192.168.0.1:1234", "2", "", "https://v3.example.org"},
+		{"spoofed", "192.168.0.1:1234", "2", "10.0.0.1", "https://v3.example.org"},
+		{"pinned", "10.0.0.1:1234", "2", "", "https://v2.example.org"},
+		{"pinned current", "10.0.0.1:1234", "3", "", "https://v3.example.org"},
+		{"previous", "10.0.0.1:1234", "previous", "", "https://v2.example.org"},
+		{"not retained", "10.0.0.1:1234", "1", "", "https://v3.example.org"},
+		{"unknown", "10.0.0.1:1234", "42", "", "https://v3.example.org"},
+		{"no candidate", "10.0.0.1:1234", "candidate", "", "https://v3.example.org"},
+	} {
+		req, err := http.NewRequest("GET", "https://www.example.com/some-path", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.RemoteAddr = ti.remoteAddr
+		if ti.pin != "" {
+			req.Header.Set("X-Routing-Table", ti.pin)
+		}
+
+		if ti.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", ti.forwarded)
+		}
+
+		r, _ := rt.Route(req)
+		if r == nil || r.Backend != ti.expected {
+			t.Error(ti.msg, "invalid route", r, ti.expected)
+		}
+	}
+}
+
+func TestTablePinningBehindTrustedProxy(t *testing.T) {
+	dc := testdataclient.New([]*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://v1.example.org"}})
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{dc},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	trusted, err := routing.ParseIPRanges([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routing.SetTrustedProxies(routing.TrustedProxies{Hops: 1})
+	defer routing.SetTrustedProxies(routing.TrustedProxies{})
+
+	rt.SetTablePinning(routing.TablePinning{Header: "X-Routing-Table", Retain: 1, TrustedClients: trusted})
+	waitTableVersion(t, rt, 1)
+
+	<-waitUpdate(dc, []*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://v2.example.org"}}, nil, false)
+	waitTableVersion(t, rt, 2)
+
+	for _, ti := range []struct {
+		msg, forwarded string
+		expected       string
+	}{
+		{"trusted client", "10.0.0.1", "https://v1.example.org"},
+		{"untrusted client", "192.168.0.1", "https://v2.example.org"},
+		{"spoofed", "10.0.0.1, 192.168.0.1", "https://v2.example.org"},
+	} {
+		req, err := http.NewRequest("GET", "https://www.example.com/some-path", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the remote address of the load balancer
+		req.RemoteAddr = "172.16.0.1:1234"
+		req.Header.Set("X-Routing-Table", "previous")
+		req.Header.Set("X-Forwarded-For", ti.forwarded)
+		r, _ := rt.Route(req)
+		if r == nil || r.Backend != ti.expected {
+			t.Error(ti.msg, "invalid route", r, ti.expected)
+		}
+	}
+}
+
+func TestTablePinningCandidate(t *testing.T) {
+	trusted, err := routing.ParseIPRanges([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, _ := startRollout(t, clock.System, routing.TableRollout{Percentage: 1})
+	defer rt.Close()
+
+	rt.SetTablePinning(routing.TablePinning{Header: "X-Routing-Table", Retain: 1, TrustedClients: trusted})
+	req := rolloutRequest(t, "/some-other", 0)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("X-Routing-Table", "candidate")
+	if r, _ := rt.Route(req); r == nil || r.Id != "route2" {
+		t.Error("failed to pin the request to the candidate", r)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dimfeld/httppath"
+	"github.com/zalando/skipper/eskip"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PredicateSpec is the specification of a custom predicate, that can be
+// referenced in the route definitions by its name, like the built-in
+// predicates, e.g. JWTClaim("tenant", "acme"), both as a condition of
+// the route and in the predicate expressions. The names of the built-in
+// predicates cannot be overridden.
+type PredicateSpec interface {
+
+	// The name of the predicate, as used in the route definitions.
+	Name() string
+
+	// Creates a predicate instance with the arguments from a route
+	// definition. An error invalidates the route.
+	Create(args []interface{}) (Predicate, error)
+}
+
+// Predicate instances are created for the routes referencing their
+// specification, and evaluated during the route lookup.
+type Predicate interface {
+
+	// Tells whether a request matches the predicate.
+	Match(*http.Request) bool
+}
+
+// Registry of the custom predicate specifications, used when processing
+// the route definitions.
+type PredicateRegistry map[string]PredicateSpec
+
+// a custom predicate instance of a route, with its name
+type customPredicate struct {
+	name string
+	Predicate
+}
+
+// Registers a predicate specification.
+func (r PredicateRegistry) Register(s PredicateSpec) {
+	r[s.Name()] = s
+}
+
+// Returns the names of the registered predicates, ordered by name.
+func (r PredicateRegistry) Names() []string {
+	var names []string
+	for name := range r {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// the built-in predicates without a dedicated field in the routes,
+// available without registration
+var builtinPredicates = PredicateRegistry{
+	CookieName:            &cookieSpec{},
+	QueryParamName:        &queryParamSpec{},
+	TrafficName:           &trafficSpec{random: rand.Float64},
+	ScheduleName:          &scheduleSpec{now: time.Now},
+	BetweenName:           &betweenSpec{now: time.Now},
+	CronName:              &cronSpec{now: time.Now},
+	ClientCertName:        &clientCertSpec{},
+	ClientTLSVersionName:  &clientTLSVersionSpec{},
+	ClientCertificateName: &clientCertificateSpec{},
+	ClientIPName:          &clientIPSpec{},
+	TrailingSlashName:     &trailingSlashSpec{},
+	ValidUntilName:        &validUntilSpec{}}
+
+func isBuiltinPredicate(name string) bool {
+	for _, p := range eskip.Predicates {
+		if p == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the specification of a predicate without a dedicated field in
+// the routes, the built-in ones taking precedence over the registry
+func lookupPredicate(pr PredicateRegistry, name string) (PredicateSpec, bool) {
+	if spec, ok := builtinPredicates[name]; ok {
+		return spec, true
+	}
+
+	if isBuiltinPredicate(name) {
+		return nil, false
+	}
+
+	spec, ok := pr[name]
+	return spec, ok
+}
+
+// creates a custom predicate instance based on its definition and its
+// specification in the registry
+func createPredicate(pr PredicateRegistry, def *eskip.Predicate) (Predicate, error) {
+	spec, ok := lookupPredicate(pr, def.Name)
+	if !ok {
+		return nil, fmt.Errorf("predicate not found: '%s'", def.Name)
+	}
+
+	return spec.Create(def.Args)
+}
+
+// returns the string arguments of a predicate, between min and max of
+// them
+func predicateArgs(name string, args []interface{}, min, max int) ([]string, error) {
+	if len(args) < min || len(args) > max {
+		return nil, fmt.Errorf("invalid number of arguments for predicate %s: %d", name, len(args))
+	}
+
+	s := make([]string, len(args))
+	for i, a := range args {
+		si, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid argument for predicate %s: %v", name, a)
+		}
+
+		s[i] = si
+	}
+
+	return s, nil
+}
+
+func createPredicates(pr PredicateRegistry, defs []*eskip.Predicate) ([]customPredicate, error) {
+	var ps []customPredicate
+	for _, def := range defs {
+		p, err := createPredicate(pr, def)
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, customPredicate{def.Name, p})
+	}
+
+	return ps, nil
+}
+
+// evaluates a predicate expression of a route for a request and its
+// normalized path
+type predicateFunc func(req *http.Request, path string) bool
+
+// returns the string arguments of a predicate in an expression
+func expressionArgs(p *eskip.Predicate, n int) ([]string, error) {
+	if len(p.Args) != n {
+		return nil, fmt.Errorf("invalid number of arguments for predicate %s: %d, expected: %d", p.Name, len(p.Args), n)
+	}
+
+	args := make([]string, n)
+	for i, a := range p.Args {
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid argument for predicate %s: %v", p.Name, a)
+		}
+
+		args[i] = s
+	}
+
+	return args, nil
+}
+
+// compiles a single predicate of an expression. The path condition
+// matches the path exactly, wildcards are not supported in expressions.
+// The names without a dedicated field are looked up in the built-in and
+// the custom predicates.
+func compilePredicate(p *eskip.Predicate, pr PredicateRegistry) (predicateFunc, error) {
+	n := 1
+	switch p.Name {
+	case "Any":
+		n = 0
+	case "Header", "HeaderRegexp":
+		n = 2
+	case "Path", "Host", "PathRegexp", "Method":
+	case TrailingSlashName, ValidUntilName:
+		return nil, fmt.Errorf("unsupported predicate in expression: %s", p.Name)
+	default:
+		if _, ok := lookupPredicate(pr, p.Name); !ok {
+			return nil, fmt.Errorf("unsupported predicate in expression: %s", p.Name)
+		}
+
+		cp, err := createPredicate(pr, p)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(req *http.Request, _ string) bool { return cp.Match(req) }, nil
+	}
+
+	args, err := expressionArgs(p, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var rx *regexp.Regexp
+	switch p.Name {
+	case "Host", "PathRegexp":
+		rx, err = regexp.Compile(args[0])
+	case "HeaderRegexp":
+		rx, err = regexp.Compile(args[1])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Name {
+	case "Any":
+		return func(*http.Request, string) bool { return true }, nil
+	case "Path":
+		if strings.Contains(args[0], "/:") || strings.Contains(args[0], "/*") {
+			return nil, fmt.Errorf("wildcards are not supported in path predicate expressions: %s", args[0])
+		}
+
+		return func(_ *http.Request, path string) bool { return path == args[0] }, nil
+	case "Host":
+		return func(req *http.Request, _ string) bool { return rx.MatchString(req.Host) }, nil
+	case "PathRegexp":
+		return func(_ *http.Request, path string) bool { return rx.MatchString(path) }, nil
+	case "Method":
+		return func(req *http.Request, _ string) bool { return req.Method == args[0] }, nil
+	case "Header":
+		key := http.CanonicalHeaderKey(args[0])
+		return func(req *http.Request, _ string) bool {
+			return matchHeader(req.Header, key, func(v string) bool { return v == args[1] })
+		}, nil
+	default:
+		key := http.CanonicalHeaderKey(args[0])
+		return func(req *http.Request, _ string) bool {
+			return matchHeader(req.Header, key, rx.MatchString)
+		}, nil
+	}
+}
+
+// Compiles a standalone predicate expression, e.g. one parsed with
+// eskip.ParsePredicateExpression, into a function telling whether a
+// request matches it. It allows evaluating route conditions outside of
+// the route lookup, e.g. in filters. The path conditions are checked
+// against the cleaned request path.
+func CompileExpression(e *eskip.PredicateExpression) (func(*http.Request) bool, error) {
+	if e == nil {
+		return nil, errors.New("invalid predicate expression: missing expression")
+	}
+
+	f, err := compileExpression(e, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(req *http.Request) bool {
+		return f(req, httppath.Clean(req.URL.Path))
+	}, nil
+}
+
+// compiles a predicate expression of a route, or returns nil, when the
+// route has no expression
+func compileExpression(e *eskip.PredicateExpression, pr PredicateRegistry) (predicateFunc, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	if e.Operator == eskip.PredicateMatch {
+		if e.Predicate == nil {
+			return nil, fmt.Errorf("invalid predicate expression: missing predicate")
+		}
+
+		return compilePredicate(e.Predicate, pr)
+	}
+
+	operands := make([]predicateFunc, len(e.Operands))
+	for i, o := range e.Operands {
+		f, err := compileExpression(o, pr)
+		if err != nil {
+			return nil, err
+		}
+
+		operands[i] = f
+	}
+
+	switch {
+	case e.Operator == eskip.PredicateNot && len(operands) == 1:
+		return func(req *http.Request, path string) bool { return !operands[0](req, path) }, nil
+	case e.Operator == eskip.PredicateAnd && len(operands) > 0:
+		return func(req *http.Request, path string) bool {
+			for _, o := range operands {
+				if !o(req, path) {
+					return false
+				}
+			}
+
+			return true
+		}, nil
+	case e.Operator == eskip.PredicateOr && len(operands) > 0:
+		return func(req *http.Request, path string) bool {
+			for _, o := range operands {
+				if o(req, path) {
+					return true
+				}
+			}
+
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid predicate expression: %v", e.Operator)
+	}
+}
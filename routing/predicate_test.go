@@ -0,0 +1,307 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/zalando/skipper/eskip"
+	"net/http"
+	"testing"
+)
+
+type tenantSpec struct{}
+
+type tenantPredicate string
+
+func (s *tenantSpec) Name() string { return "Tenant" }
+
+func (s *tenantSpec) Create(args []interface{}) (Predicate, error) {
+	if len(args) != 1 {
+		return nil, errors.New("invalid number of arguments")
+	}
+
+	tenant, ok := args[0].(string)
+	if !ok {
+		return nil, errors.New("invalid argument")
+	}
+
+	return tenantPredicate(tenant), nil
+}
+
+func (p tenantPredicate) Match(req *http.Request) bool {
+	return req.Header.Get("X-Tenant") == string(p)
+}
+
+func customPredicateMatcher(doc string) (*matcher, []*definitionError, error) {
+	defs, err := eskip.Parse(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr := make(PredicateRegistry)
+	pr.Register(&tenantSpec{})
+	m, errs := newMatcher(processRouteDefs(nil, pr, defs), MatchingOptionsNone)
+	return m, errs, nil
+}
+
+func TestMatchPredicateExpressions(t *testing.T) {
+	m, err := docToMatcher(`
+		hosts: Path("/foo") && (Host(/^a[.]example[.]org$/) || Host(/^b[.]example[.]org$/)) -> "https://hosts.example.org";
+		notGet: Path("/foo") && !Method("GET") -> "https://notget.example.org";
+		headers: Header("X-Foo", "bar") || HeaderRegexp("X-Bar", /^baz/) -> "https://headers.example.org";
+		paths: Path("/bar") || Path("/baz") || PathRegexp(/^\/qux\//) -> "https://paths.example.org";
+		notAllowed: Path("/allow") && Not(Host(/^a[.]example[.]org$/) || Host(/^b[.]example[.]org$/)) -> "https://notallowed.example.org";
+		fallback: Any() -> "https://fallback.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		method, host, path string
+		header             http.Header
+		expected           string
+	}{
+		{"GET", "a.example.org", "/foo", nil, "hosts"},
+		{"GET", "b.example.org", "/foo", nil, "hosts"},
+		{"GET", "c.example.org", "/foo", nil, "fallback"},
+		{"POST", "c.example.org", "/foo", nil, "notGet"},
+		{"GET", "c.example.org", "/x", http.Header{"X-Foo": []string{"bar"}}, "headers"},
+		{"GET", "c.example.org", "/x", http.Header{"X-Bar": []string{"bazz"}}, "headers"},
+		{"GET", "c.example.org", "/x", http.Header{"X-Bar": []string{"qux"}}, "fallback"},
+		{"GET", "c.example.org", "/bar", nil, "paths"},
+		{"GET", "c.example.org", "/baz", nil, "paths"},
+		{"GET", "c.example.org", "/qux/1", nil, "paths"},
+		{"GET", "c.example.org", "/quux", nil, "fallback"},
+		{"GET", "a.example.org", "/allow", nil, "fallback"},
+		{"GET", "c.example.org", "/allow", nil, "notAllowed"},
+	} {
+		req, err := newRequest(ti.method, ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Host = ti.host
+		if ti.header != nil {
+			req.Header = ti.header
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.method, ti.host, ti.path, r, ti.expected)
+		}
+	}
+}
+
+func TestPredicateExpressionPrecedence(t *testing.T) {
+	m, err := docToMatcher(`
+		plain: Path("/foo") -> "https://plain.example.org";
+		expression: Path("/foo") && (Method("GET") || Method("HEAD")) -> "https://expression.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := newRequest("GET", "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := m.match(req); r == nil || r.Id != "expression" {
+		t.Error("failed to prefer the route with the expression", r)
+	}
+}
+
+func TestInvalidPredicateExpressions(t *testing.T) {
+	for _, doc := range []string{
+		`Path("/foo") || Path("/bar/:id") -> <shunt>`,
+		`Host(/[/) || Host(/a/) -> <shunt>`,
+		`Custom("a") || Host(/a/) -> <shunt>`,
+		`ValidUntil("2016-01-01T00:00:00Z") || Host(/a/) -> <shunt>`,
+		`Method(42) || Host(/a/) -> <shunt>`,
+		`Header("X-Foo") || Host(/a/) -> <shunt>`,
+		`ClientTLSVersion("1.2", "1.1") || Host(/a/) -> <shunt>`,
+		`ClientTLSVersion("2.0") || Host(/a/) -> <shunt>`,
+		`ClientTLSVersion("2.0") -> <shunt>`,
+	} {
+		defs, err := eskip.Parse(doc)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if _, err := newLeaf(&Route{Route: *defs[0]}); err == nil {
+			t.Error("failed to fail", doc)
+		}
+	}
+}
+
+func TestExplainPredicateMismatch(t *testing.T) {
+	defs, err := eskip.Parse(`r: Host(/^a[.]/) || Host(/^b[.]/) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://c.example.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Explain(defs, req, MatchingOptionsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match != nil || len(e.Candidates) != 1 || e.Candidates[0].Mismatch != "Predicate" {
+		t.Error("failed to explain the mismatch", e.Candidates)
+	}
+}
+
+func TestMatchClientTLS(t *testing.T) {
+	m, err := docToMatcher(`
+		upgrade: ClientTLSVersion("1.0") || ClientTLSVersion("1.1") -> <shunt>;
+		admin: Path("/admin") && ClientCertificate() -> "https://admin.example.org";
+		tls12: Path("/admin") && ClientTLSVersion("1.2") -> "https://tls12.example.org";
+		fallback: Any() -> "https://fallback.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		path     string
+		tls      *tls.ConnectionState
+		expected string
+	}{
+		{"/foo", nil, "fallback"},
+		{"/admin", nil, "fallback"},
+		{"/foo", &tls.ConnectionState{Version: tls.VersionTLS10}, "upgrade"},
+		{"/foo", &tls.ConnectionState{Version: tls.VersionTLS11}, "upgrade"},
+		{"/foo", &tls.ConnectionState{Version: tls.VersionTLS12}, "fallback"},
+		{"/admin", &tls.ConnectionState{Version: tls.VersionTLS12}, "tls12"},
+		{"/admin", &tls.ConnectionState{
+			Version:          tls.VersionTLS12,
+			PeerCertificates: []*x509.Certificate{{}}}, "admin"},
+	} {
+		req, err := newRequest("GET", ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.TLS = ti.tls
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.path, ti.tls, r, ti.expected)
+		}
+	}
+}
+
+func TestExplainClientTLSMismatch(t *testing.T) {
+	defs, err := eskip.Parse(`r: ClientCertificate() -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Explain(defs, req, MatchingOptionsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Match != nil || len(e.Candidates) != 1 || e.Candidates[0].Mismatch != "ClientCertificate" {
+		t.Error("failed to explain the mismatch", e.Candidates)
+	}
+}
+
+func TestMatchCustomPredicates(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		acme: Path("/foo") && Tenant("acme") -> "https://acme.example.org";
+		either: Path("/bar") && (Tenant("foo") || Tenant("bar")) -> "https://either.example.org";
+		foo: Path("/foo") -> "https://foo.example.org";
+		bar: Path("/bar") -> "https://bar.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, ti := range []struct {
+		path, tenant string
+		expected     string
+	}{
+		{"/foo", "acme", "acme"},
+		{"/foo", "other", "foo"},
+		{"/foo", "", "foo"},
+		{"/bar", "foo", "either"},
+		{"/bar", "bar", "either"},
+		{"/bar", "acme", "bar"},
+	} {
+		req, err := newRequest("GET", ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-Tenant", ti.tenant)
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.path, ti.tenant, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidCustomPredicates(t *testing.T) {
+	for _, doc := range []string{
+		`Unknown("foo") -> <shunt>`,
+		`Tenant("foo", "bar") -> <shunt>`,
+		`Tenant(42) || Path("/foo") -> <shunt>`,
+		`Unknown("foo") || Path("/foo") -> <shunt>`,
+	} {
+		_, errs, err := customPredicateMatcher(doc)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(errs) == 0 {
+			t.Error("failed to fail", doc)
+		}
+	}
+}
+
+func TestExplainCustomPredicateMismatch(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`r: Path("/foo") && Tenant("acme") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	req, err := newRequest("GET", "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves, _ := matchPathTree(m, "/foo")
+	if len(leaves) != 1 || leafMismatch(leaves[0], req, "/foo") != "Tenant" {
+		t.Error("failed to report the custom predicate mismatch")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import "net/http"
+
+// The name of the built-in predicate matching the query parameters of
+// the request, e.g. QueryParam("debug") or QueryParam("debug", "1").
+const QueryParamName = "QueryParam"
+
+type queryParamSpec struct{}
+
+// matches the presence of a query parameter, or, when the value is set,
+// any of its values exactly
+type queryParamPredicate struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+func (s *queryParamSpec) Name() string { return QueryParamName }
+
+// Creates a query parameter predicate with the name of the parameter,
+// and an optional value that it needs to match exactly.
+func (s *queryParamSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(QueryParamName, args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParamPredicate{name: a[0]}
+	if len(a) == 2 {
+		p.value, p.hasValue = a[1], true
+	}
+
+	return p, nil
+}
+
+func (p *queryParamPredicate) Match(req *http.Request) bool {
+	v, ok := req.URL.Query()[p.name]
+	if !ok {
+		return false
+	}
+
+	if !p.hasValue {
+		return true
+	}
+
+	for _, vi := range v {
+		if vi == p.value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import "testing"
+
+func TestMatchQueryParam(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		debug: Path("/foo") && QueryParam("debug", "1") -> "https://debug.example.org";
+		trace: Path("/foo") && QueryParam("trace") -> "https://trace.example.org";
+		foo: Path("/foo") -> "https://foo.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, ti := range []struct {
+		url      string
+		expected string
+	}{
+		{"/foo", "foo"},
+		{"/foo?debug=1", "debug"},
+		{"/foo?debug=0&debug=1", "debug"},
+		{"/foo?debug=10", "foo"},
+		{"/foo?debug", "foo"},
+		{"/foo?trace", "trace"},
+		{"/foo?trace=", "trace"},
+		{"/foo?trace=true&debug=0", "trace"},
+	} {
+		req, err := newRequest("GET", ti.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.url, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidQueryParam(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{42},
+		{"debug", 1.0},
+		{"debug", "1", "2"},
+	} {
+		if _, err := (&queryParamSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/zalando/skipper/filters/flowid"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Settings of the gradual activation of the routing table updates. When
+// the percentage is set, a new version of the routing table, received
+// from the data clients, is activated only for the given percentage of
+// the requests, as a candidate, while the rest of the requests are
+// routed with the previous table. The requests are assigned to the
+// tables consistently by their flow id, or by the client address, when
+// they have no flow id.
+//
+// The candidate is activated for all requests, when the duration
+// elapses, or when PromoteTable is called. It can be dropped with
+// RollbackTable. When a further update is received during the rollout,
+// it replaces the candidate, without restarting the duration.
+//
+// The first routing table, and the updates caused only by route
+// expiration, are activated immediately. During a rollout, the routes
+// expiring in the previous table remain active for its requests, until
+// the candidate is promoted or dropped. The route changes and the
+// removed backends are notified when a table is fully activated.
+type TableRollout struct {
+
+	// The percentage of the requests, between 0 and 100, routed with
+	// the candidate table. Zero disables the rollout, and the updates
+	// are activated immediately.
+	Percentage float64
+
+	// The time after which the candidate table is activated for all
+	// requests. Zero means that the candidate needs to be promoted
+	// explicitly with PromoteTable.
+	Duration time.Duration
+}
+
+// the tables used for routing, the candidate is set only during a
+// rollout
+type activeTables struct {
+	stable     *matcher
+	candidate  *matcher
+	percentage float64
+}
+
+// the key assigning a request to the candidate or the stable table
+func rolloutKey(req *http.Request) string {
+	if id := req.Header.Get(flowid.HeaderName); id != "" {
+		return id
+	}
+
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+
+	return req.RemoteAddr
+}
+
+// selects the table for the request
+func (t *activeTables) matcher(req *http.Request) *matcher {
+	if t.candidate == nil {
+		return t.stable
+	}
+
+	// buckets of 0.01 percent
+	bucket := float64(crc32.ChecksumIEEE([]byte(rolloutKey(req)))%10000) / 100
+	if bucket < t.percentage {
+		return t.candidate
+	}
+
+	return t.stable
+}
+
+// Sets the rollout settings of the routing table updates. It doesn't
+// affect a rollout already in progress.
+func (r *Routing) SetTableRollout(tr TableRollout) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.tableRollout = tr
+}
+
+func (r *Routing) getTableRollout() TableRollout {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.tableRollout
+}
+
+// Activates the candidate routing table for all requests, when a rollout
+// is in progress.
+func (r *Routing) PromoteTable() {
+	select {
+	case r.promote <- true:
+	case <-r.quit:
+	}
+}
+
+// Drops the candidate routing table, when a rollout is in progress. The
+// previous table remains active for all requests, until the next
+// update.
+func (r *Routing) RollbackTable() {
+	select {
+	case r.promote <- false:
+	case <-r.quit:
+	}
+}
+
+// Tells whether a rollout is in progress, i.e. whether a candidate
+// routing table is active for a part of the requests.
+func (r *Routing) RolloutInProgress() bool {
+	return r.tables.Load().(*activeTables).candidate != nil
+}
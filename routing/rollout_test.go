@@ -0,0 +1,177 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing_test
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/clock"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const rolloutFlows = 200
+
+func rolloutRequest(t *testing.T, path string, flow int) *http.Request {
+	req, err := http.NewRequest("GET", "https://www.example.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(flowid.HeaderName, fmt.Sprintf("flow-%d", flow))
+	return req
+}
+
+// counts the flows routed to path
+func countRouted(t *testing.T, rt *routing.Routing, path string) int {
+	n := 0
+	for i := 0; i < rolloutFlows; i++ {
+		if r, _ := rt.Route(rolloutRequest(t, path, i)); r != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func waitCount(t *testing.T, rt *routing.Routing, path string, check func(int) bool) int {
+	var n int
+	for i := 0; i < 30; i++ {
+		if n = countRouted(t, rt, path); check(n) {
+			break
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	return n
+}
+
+func startRollout(t *testing.T, c clock.Clock, tr routing.TableRollout) (*routing.Routing, *testdataclient.Client) {
+	dc := testdataclient.New([]*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://www.example.org"}})
+	rt := routing.NewWithClock(routing.Options{
+		UpdateBuffer: 0,
+		DataClients:  []routing.DataClient{dc},
+		PollTimeout:  pollTimeout}, c)
+	rt.SetTableRollout(tr)
+
+	if n := waitCount(t, rt, "/some-path", func(n int) bool { return n == rolloutFlows }); n != rolloutFlows {
+		t.Fatal("failed to apply the initial table")
+	}
+
+	<-waitUpdate(dc, []*eskip.Route{{Id: "route2", Path: "/some-other", Backend: "https://other.example.org"}}, nil, false)
+	if n := waitCount(t, rt, "/some-other", func(n int) bool { return n > 0 }); n == 0 {
+		t.Fatal("failed to start the rollout")
+	}
+
+	return rt, dc
+}
+
+func TestTableRolloutPercentage(t *testing.T) {
+	rt, _ := startRollout(t, clock.System, routing.TableRollout{Percentage: 30})
+	defer rt.Close()
+
+	if !rt.RolloutInProgress() {
+		t.Error("failed to report the rollout")
+	}
+
+	n := countRouted(t, rt, "/some-other")
+	if n < rolloutFlows/10 || n > rolloutFlows/2 {
+		t.Error("invalid share of the candidate table", n)
+	}
+
+	if m := countRouted(t, rt, "/some-path"); m != rolloutFlows {
+		t.Error("failed to keep the routes present in both tables", m)
+	}
+
+	for i := 0; i < rolloutFlows; i++ {
+		r1, _ := rt.Route(rolloutRequest(t, "/some-other", i))
+		r2, _ := rt.Route(rolloutRequest(t, "/some-other", i))
+		if (r1 == nil) != (r2 == nil) {
+			t.Error("inconsistent table selection for the same flow id")
+		}
+	}
+}
+
+func TestTableRolloutPromote(t *testing.T) {
+	rt, _ := startRollout(t, clock.System, routing.TableRollout{Percentage: 30})
+	defer rt.Close()
+
+	rt.PromoteTable()
+	if n := waitCount(t, rt, "/some-other", func(n int) bool { return n == rolloutFlows }); n != rolloutFlows {
+		t.Error("failed to promote the candidate table", n)
+	}
+
+	if rt.RolloutInProgress() {
+		t.Error("failed to finish the rollout")
+	}
+}
+
+func TestTableRolloutRollback(t *testing.T) {
+	rt, _ := startRollout(t, clock.System, routing.TableRollout{Percentage: 30})
+	defer rt.Close()
+
+	rt.RollbackTable()
+	if n := waitCount(t, rt, "/some-other", func(n int) bool { return n == 0 }); n != 0 {
+		t.Error("failed to drop the candidate table", n)
+	}
+
+	if m := countRouted(t, rt, "/some-path"); m != rolloutFlows {
+		t.Error("failed to keep the stable table", m)
+	}
+}
+
+func TestTableRolloutReplacesCandidate(t *testing.T) {
+	rt, dc := startRollout(t, clock.System, routing.TableRollout{Percentage: 30})
+	defer rt.Close()
+
+	<-waitUpdate(dc, []*eskip.Route{{Id: "route3", Path: "/third", Backend: "https://other.example.org"}}, nil, false)
+	n := waitCount(t, rt, "/third", func(n int) bool { return n > 0 })
+	if n == 0 || n == rolloutFlows {
+		t.Error("failed to replace the candidate table", n)
+	}
+
+	if m := countRouted(t, rt, "/some-other"); m != n {
+		t.Error("failed to keep the previous candidate routes", m, n)
+	}
+}
+
+func TestTableRolloutDuration(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	rt, _ := startRollout(t, c, routing.TableRollout{Percentage: 30, Duration: time.Hour})
+	defer rt.Close()
+
+	if n := countRouted(t, rt, "/some-other"); n == rolloutFlows {
+		t.Error("candidate table promoted too early")
+	}
+
+	c.Add(time.Hour)
+	if n := waitCount(t, rt, "/some-other", func(n int) bool { return n == rolloutFlows }); n != rolloutFlows {
+		t.Error("failed to promote the candidate table after the duration", n)
+	}
+}
+
+func TestTableRolloutDisabled(t *testing.T) {
+	rt, _ := startRollout(t, clock.System, routing.TableRollout{})
+	defer rt.Close()
+
+	if n := countRouted(t, rt, "/some-other"); n != rolloutFlows {
+		t.Error("failed to apply the update to all requests", n)
+	}
+}
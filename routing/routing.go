@@ -16,9 +16,12 @@ package routing
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/clock"
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
 	"net/http"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -32,12 +35,42 @@ const (
 
 	// Ignore trailing slash in paths.
 	IgnoreTrailingSlash MatchingOptions = 1 << iota
+
+	// Match the raw host and path of the requests, without
+	// canonicalization.
+	NoCanonicalization
+
+	// Redirect the requests whose path differs from the route path
+	// only in a trailing slash to the path of the route. Takes
+	// precedence over IgnoreTrailingSlash.
+	RedirectTrailingSlash
 )
 
 func (o MatchingOptions) ignoreTrailingSlash() bool {
 	return o&IgnoreTrailingSlash > 0
 }
 
+func (o MatchingOptions) noCanonicalization() bool {
+	return o&NoCanonicalization > 0
+}
+
+func (o MatchingOptions) redirectTrailingSlash() bool {
+	return o&RedirectTrailingSlash > 0
+}
+
+// returns the trailing slash policy of the routes that don't set their
+// own
+func (o MatchingOptions) trailingSlashPolicy() trailingSlashPolicy {
+	switch {
+	case o.redirectTrailingSlash():
+		return trailingSlashRedirect
+	case o.ignoreTrailingSlash():
+		return trailingSlashMatch
+	default:
+		return trailingSlashStrict
+	}
+}
+
 // DataClient instances provide data sources for
 // route definitions.
 type DataClient interface {
@@ -79,6 +112,12 @@ type Options struct {
 	// 0, until the performance benefit is verified
 	// by benchmarks.)
 	UpdateBuffer int
+
+	// Registry containing the custom predicate
+	// specifications, that can be referenced in the
+	// route definitions in addition to the built-in
+	// predicates.
+	PredicateRegistry PredicateRegistry
 }
 
 // Filter contains extensions to generic filter
@@ -101,42 +140,290 @@ type Route struct {
 
 	// The preprocessed filter instances.
 	Filters []*RouteFilter
+
+	// The backends of a route with a split backend, with their scheme
+	// and host.
+	WeightedBackends []*WeightedBackend
+
+	// the registry used to create the custom predicates of the route
+	predicates PredicateRegistry
+}
+
+// A backend of a route with a split backend.
+type WeightedBackend struct {
+
+	// The relative weight of the backend.
+	Weight int
+
+	// The backend scheme and host.
+	Scheme, Host string
+}
+
+// a version of the routing table
+type routeTable struct {
+	matcher  *matcher
+	backends map[string]bool
+	defs     routeDefs
+
+	// set when the table was created due to route expiration
+	expiry bool
+}
+
+// The changes of the active routing table, passed to the functions
+// registered with NotifyRouteChanges. The route ids are sorted.
+type RouteChanges struct {
+
+	// The ids of the routes that were not in the previous routing
+	// table.
+	Added []string
+
+	// The ids of the routes whose definition has changed.
+	Updated []string
+
+	// The ids of the routes that were removed, or that expired.
+	Removed []string
 }
 
 // Routing ('router') instance providing live
 // updatable request matching.
 type Routing struct {
-	matcher atomic.Value
+	tables          atomic.Value
+	hostAliases     atomic.Value
+	tablePinning    atomic.Value
+	tableVersion    atomic.Value
+	fingerprint     atomic.Value
+	routes          atomic.Value
+	snapshots       atomic.Value
+	matchingOptions MatchingOptions
+
+	mx               sync.Mutex
+	backendListeners []func([]string)
+	changeListeners  []func(RouteChanges)
+	tableRollout     TableRollout
+
+	promote   chan bool
+	quit      chan struct{}
+	closeOnce sync.Once
 }
 
 // Initializes a new routing instance, and starts listening for route
 // definition updates.
 func New(o Options) *Routing {
-	r := &Routing{}
+	return NewWithClock(o, clock.System)
+}
+
+// Initializes a new routing instance, that uses the provided clock for
+// the expiration of the routes, e.g. a fake clock in tests.
+func NewWithClock(o Options, c clock.Clock) *Routing {
+	r := &Routing{
+		matchingOptions: o.MatchingOptions,
+		promote:         make(chan bool),
+		quit:            make(chan struct{})}
 	initialMatcher, _ := newMatcher(nil, MatchingOptionsNone)
-	r.matcher.Store(initialMatcher)
-	r.startReceivingUpdates(o)
+	r.tables.Store(&activeTables{stable: initialMatcher})
+	r.hostAliases.Store(HostAliases(nil))
+	r.tableVersion.Store(0)
+	r.fingerprint.Store(TableFingerprint{Hash: routesHash(nil)})
+	r.routes.Store([]*eskip.Route(nil))
+	r.snapshots.Store([]tableSnapshot(nil))
+	r.startReceivingUpdates(o, clock.OrSystem(c))
 	return r
 }
 
-func (r *Routing) startReceivingUpdates(o Options) {
-	c := make(chan *matcher)
-	go receiveRouteMatcher(o, c)
+// Registers a function that is called after those routing table
+// updates, that removed backends, i.e. no route points to them anymore.
+// The removed backends are passed in the form of scheme://host. The
+// function is called synchronously with the updates, and it should
+// return quickly.
+func (r *Routing) NotifyRemovedBackends(f func(backends []string)) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.backendListeners = append(r.backendListeners, f)
+}
+
+func (r *Routing) notifyRemovedBackends(removed []string) {
+	r.mx.Lock()
+	listeners := r.backendListeners
+	r.mx.Unlock()
+
+	for _, l := range listeners {
+		l(removed)
+	}
+}
+
+// Registers a function that is called after every routing table update,
+// that added, changed or removed routes, with the ids of the affected
+// routes. It can be used by embedding applications, e.g. for cache
+// invalidation. The first call, after the initial routes were received,
+// lists all routes as added, unless the function was registered later.
+// The function is called synchronously with the updates, and it should
+// return quickly.
+func (r *Routing) NotifyRouteChanges(f func(RouteChanges)) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.changeListeners = append(r.changeListeners, f)
+}
+
+func (r *Routing) notifyRouteChanges(c RouteChanges) {
+	r.mx.Lock()
+	listeners := r.changeListeners
+	r.mx.Unlock()
+
+	for _, l := range listeners {
+		l(c)
+	}
+}
+
+func routeChanges(previous, current routeDefs) RouteChanges {
+	var c RouteChanges
+	for id, def := range current {
+		if p, ok := previous[id]; !ok {
+			c.Added = append(c.Added, id)
+		} else if !eskip.Eq(p, def) {
+			c.Updated = append(c.Updated, id)
+		}
+	}
+
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			c.Removed = append(c.Removed, id)
+		}
+	}
+
+	sort.Strings(c.Added)
+	sort.Strings(c.Updated)
+	sort.Strings(c.Removed)
+	return c
+}
+
+func (c RouteChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+func removedBackends(previous, current map[string]bool) []string {
+	var removed []string
+	for b := range previous {
+		if !current[b] {
+			removed = append(removed, b)
+		}
+	}
+
+	return removed
+}
+
+func (r *Routing) startReceivingUpdates(o Options, clk clock.Clock) {
+	c := make(chan *routeTable)
+	go receiveRouteMatcher(o, clk, c, r.quit)
 	go func() {
-		for {
-			m := <-c
-			r.matcher.Store(m)
+		var (
+			backends  map[string]bool
+			defs      routeDefs
+			candidate *routeTable
+			promote   <-chan time.Time
+			version   int
+		)
+
+		// activates a table for all requests
+		apply := func(t *routeTable) {
+			r.tables.Store(&activeTables{stable: t.matcher})
+			version++
+			r.storeSnapshot(version, t.matcher)
+			r.routes.Store(sortedDefs(t.defs))
+			r.fingerprint.Store(TableFingerprint{
+				Version: version,
+				Hash:    routesHash(t.defs),
+				Routes:  len(t.defs)})
 			log.Println("route settings applied")
+
+			if removed := removedBackends(backends, t.backends); len(removed) > 0 {
+				r.notifyRemovedBackends(removed)
+			}
+
+			backends = t.backends
+
+			if changes := routeChanges(defs, t.defs); !changes.empty() {
+				r.notifyRouteChanges(changes)
+			}
+
+			defs = t.defs
+			candidate, promote = nil, nil
+		}
+
+		for {
+			select {
+			case t := <-c:
+				rollout := r.getTableRollout()
+				switch {
+				case candidate != nil:
+					candidate = t
+					r.tables.Store(&activeTables{
+						stable:     r.tables.Load().(*activeTables).stable,
+						candidate:  t.matcher,
+						percentage: rollout.Percentage})
+					log.Println("route settings replaced the candidate of the rollout")
+				case defs == nil || t.expiry || rollout.Percentage <= 0:
+					apply(t)
+				default:
+					candidate = t
+					r.tables.Store(&activeTables{
+						stable:     r.tables.Load().(*activeTables).stable,
+						candidate:  t.matcher,
+						percentage: rollout.Percentage})
+					if rollout.Duration > 0 {
+						promote = clk.After(rollout.Duration)
+					}
+
+					log.Printf("route settings applied to %g%% of the requests", rollout.Percentage)
+				}
+			case <-promote:
+				apply(candidate)
+			case p := <-r.promote:
+				switch {
+				case candidate == nil:
+				case p:
+					apply(candidate)
+				default:
+					r.tables.Store(&activeTables{stable: r.tables.Load().(*activeTables).stable})
+					candidate, promote = nil, nil
+					log.Println("route settings rolled back")
+				}
+			case <-r.quit:
+				return
+			}
 		}
 	}()
 }
 
+// Stops polling the data clients for route definition updates. The
+// last routing table remains in effect.
+func (r *Routing) Close() {
+	r.closeOnce.Do(func() {
+		close(r.quit)
+	})
+}
+
 // Matches a request in the current routing tree.
 //
 // If the request matches a route, returns the route and a map of
 // parameters constructed from the wildcard parameters in the path
 // condition if any. If there is no match, it returns nil.
 func (r *Routing) Route(req *http.Request) (*Route, map[string]string) {
-	m := r.matcher.Load().(*matcher)
-	return m.match(req)
+	req = r.hostAliases.Load().(HostAliases).apply(req, r.matchingOptions)
+	return r.matcher(req).match(req)
+}
+
+// Returns the definitions of the routes in the routing table active for
+// all requests, sorted by id. The candidate table of a rollout in
+// progress is not included. The returned routes must not be modified.
+func (r *Routing) Routes() []*eskip.Route {
+	return r.routes.Load().([]*eskip.Route)
+}
+
+// Returns the methods accepted by the routes that would match the request
+// if it had a different method, sorted. When the request doesn't match
+// any route, and the returned list is not empty, the request can be
+// answered with 405 Method Not Allowed instead of 404 Not Found.
+func (r *Routing) AllowedMethods(req *http.Request) []string {
+	req = r.hostAliases.Load().(HostAliases).apply(req, r.matchingOptions)
+	return r.matcher(req).allowedMethods(req)
 }
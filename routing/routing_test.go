@@ -15,12 +15,14 @@
 package routing_test
 
 import (
+	"github.com/zalando/skipper/clock"
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/filtertest"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/routing/testdataclient"
 	"net/http"
+	"sort"
 	"testing"
 	"time"
 )
@@ -373,3 +375,314 @@ func TestProcessesFilterDefinitions(t *testing.T) {
 		t.Error("test timeout")
 	}
 }
+
+type phasedFilter struct {
+	filtertest.Filter
+	phase filters.Phase
+}
+
+func (spec *phasedFilter) Phase() filters.Phase { return spec.phase }
+
+func TestOrdersFiltersByPhase(t *testing.T) {
+	fr := make(filters.Registry)
+	fr.Register(&filtertest.Filter{FilterName: "route1"})
+	fr.Register(&filtertest.Filter{FilterName: "route2"})
+	fr.Register(&phasedFilter{filtertest.Filter{FilterName: "auth"}, filters.PhaseAuth})
+	fr.Register(&phasedFilter{filtertest.Filter{FilterName: "preAuth"}, filters.PhasePreAuth})
+	fr.Register(&phasedFilter{filtertest.Filter{FilterName: "postAuth"}, filters.PhasePostAuth})
+
+	dc, err := testdataclient.NewDoc(`
+		Path("/some-path") -> route1() -> postAuth() -> auth() -> route2() -> preAuth() -> <shunt>`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rt := routing.New(routing.Options{
+		UpdateBuffer:   0,
+		DataClients:    []routing.DataClient{dc},
+		PollTimeout:    pollTimeout,
+		FilterRegistry: fr})
+
+	req, err := http.NewRequest("GET", "https://www.example.com/some-path", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	select {
+	case r := <-waitRoute(rt, req):
+		expected := []string{"preAuth", "auth", "postAuth", "route1", "route2"}
+		if len(r.Filters) != len(expected) {
+			t.Error("failed to process filters")
+			return
+		}
+
+		for i, f := range r.Filters {
+			if f.Name != expected[i] {
+				t.Error("invalid filter order", i, f.Name, expected[i])
+			}
+		}
+	case <-time.After(30 * pollTimeout):
+		t.Error("test timeout")
+	}
+}
+
+func TestNotifiesRemovedBackends(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		route1: Path("/one") -> "https://one.example.org";
+		route2: Path("/two") -> "https://two.example.org";
+		route3: Path("/three") -> "https://two.example.org";
+		route4: Path("/shunt") -> <shunt>`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rt := routing.New(routing.Options{
+		UpdateBuffer: 0,
+		DataClients:  []routing.DataClient{dc},
+		PollTimeout:  pollTimeout})
+
+	removed := make(chan []string, 1)
+	rt.NotifyRemovedBackends(func(backends []string) { removed <- backends })
+
+	req, err := http.NewRequest("GET", "https://www.example.com/two", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 30; i++ {
+		if r, _ := rt.Route(req); r != nil {
+			break
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	dc.Update(nil, []string{"route2", "route4"})
+	select {
+	case <-removed:
+		t.Error("unexpected notification, the backend is still in use")
+	case <-time.After(6 * pollTimeout):
+	}
+
+	dc.Update(nil, []string{"route1", "route3"})
+	select {
+	case backends := <-removed:
+		sort.Strings(backends)
+		if len(backends) != 2 ||
+			backends[0] != "https://one.example.org" ||
+			backends[1] != "https://two.example.org" {
+			t.Error("invalid removed backends", backends)
+		}
+	case <-time.After(6 * pollTimeout):
+		t.Error("test timeout")
+	}
+}
+
+func TestNotifiesRouteChanges(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		route1: Path("/one") -> "https://one.example.org";
+		route2: Path("/two") -> "https://two.example.org"`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rt := routing.New(routing.Options{
+		UpdateBuffer: 0,
+		DataClients:  []routing.DataClient{dc},
+		PollTimeout:  pollTimeout})
+
+	changes := make(chan routing.RouteChanges, 3)
+	rt.NotifyRouteChanges(func(c routing.RouteChanges) { changes <- c })
+
+	req, err := http.NewRequest("GET", "https://www.example.com/two", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 30; i++ {
+		if r, _ := rt.Route(req); r != nil {
+			break
+		}
+
+		time.Sleep(pollTimeout)
+	}
+
+	// the initial routes may have been received before the registration
+	select {
+	case <-changes:
+	case <-time.After(pollTimeout):
+	}
+
+	if err := dc.UpdateDoc(`
+		route1: Path("/one") -> "https://new.example.org";
+		route3: Path("/three") -> "https://three.example.org"`, []string{"route2"}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	select {
+	case c := <-changes:
+		if len(c.Added) != 1 || c.Added[0] != "route3" ||
+			len(c.Updated) != 1 || c.Updated[0] != "route1" ||
+			len(c.Removed) != 1 || c.Removed[0] != "route2" {
+			t.Error("invalid route changes", c)
+		}
+	case <-time.After(6 * pollTimeout):
+		t.Error("test timeout")
+	}
+}
+
+func TestDropsExpiredRoutes(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	validUntil := func(t time.Time) []*eskip.Predicate {
+		return []*eskip.Predicate{{Name: routing.ValidUntilName, Args: []interface{}{t.Format(time.RFC3339Nano)}}}
+	}
+
+	dc := testdataclient.New([]*eskip.Route{{
+		Id:               "expired",
+		Path:             "/expired",
+		Backend:          "https://www.example.org",
+		CustomPredicates: validUntil(c.Now().Add(-time.Hour)),
+	}, {
+		Id:               "expiring",
+		Path:             "/expiring",
+		Backend:          "https://www.example.org",
+		CustomPredicates: validUntil(c.Now().Add(time.Hour)),
+	}, {
+		Id:      "permanent",
+		Path:    "/permanent",
+		Backend: "https://www.example.org",
+	}})
+
+	rt := routing.NewWithClock(routing.Options{
+		UpdateBuffer: 0,
+		DataClients:  []routing.DataClient{dc},
+		PollTimeout:  pollTimeout}, c)
+	defer rt.Close()
+
+	route := func(path string) *routing.Route {
+		req, err := http.NewRequest("GET", "https://www.example.com"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, _ := rt.Route(req)
+		return r
+	}
+
+	for i := 0; i < 30 && (route("/permanent") == nil || c.Timers() == 0); i++ {
+		time.Sleep(pollTimeout)
+	}
+
+	if route("/expired") != nil {
+		t.Error("failed to drop expired route")
+	}
+
+	if route("/expiring") == nil {
+		t.Error("failed to route to the route before its expiration")
+	}
+
+	c.Add(time.Hour)
+	for i := 0; i < 30 && route("/expiring") != nil; i++ {
+		time.Sleep(pollTimeout)
+	}
+
+	if route("/expiring") != nil {
+		t.Error("failed to drop the route after its expiration")
+	}
+
+	if route("/permanent") == nil {
+		t.Error("failed to keep the route without expiration")
+	}
+}
+
+func TestSplitBackendRoute(t *testing.T) {
+	dc, err := testdataclient.NewDoc(`
+		split: Path("/split") -> <split 90 "https://stable.example.org", 10 "http://canary.example.org:9090">;
+		invalid: Path("/invalid") -> <split 90 "https://stable.example.org", 10 "canary">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{dc},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	req, err := http.NewRequest("GET", "https://www.example.com/split", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r *routing.Route
+	select {
+	case r = <-waitRoute(rt, req):
+	case <-time.After(30 * pollTimeout):
+		t.Fatal("test timeout")
+	}
+
+	if r.Scheme != "" || r.Host != "" || len(r.WeightedBackends) != 2 ||
+		*r.WeightedBackends[0] != (routing.WeightedBackend{Weight: 90, Scheme: "https", Host: "stable.example.org"}) ||
+		*r.WeightedBackends[1] != (routing.WeightedBackend{Weight: 10, Scheme: "http", Host: "canary.example.org:9090"}) {
+		t.Error("failed to process the split backend", r.WeightedBackends)
+	}
+
+	req, err = http.NewRequest("GET", "https://www.example.com/invalid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := rt.Route(req); r != nil {
+		t.Error("failed to reject the invalid split backend")
+	}
+}
+
+func TestMatchesHostAliases(t *testing.T) {
+	dc := testdataclient.New(nil)
+	rt := routing.New(routing.Options{
+		DataClients: []routing.DataClient{dc},
+		PollTimeout: pollTimeout})
+	defer rt.Close()
+
+	// signaled when the routing table with the route was applied
+	added := make(chan struct{}, 1)
+	rt.NotifyRouteChanges(func(c routing.RouteChanges) {
+		if len(c.Added) > 0 {
+			select {
+			case added <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	rt.SetHostAliases(routing.HostAliases{"*.example.org": "example.org"})
+	req, err := http.NewRequest("GET", "https://www.example.org/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go dc.Update([]*eskip.Route{{
+		Id:          "route1",
+		HostRegexps: []string{"^example[.]org$"},
+		Backend:     "https://backend.example.org"}}, nil)
+
+	select {
+	case <-added:
+	case <-time.After(30 * pollTimeout):
+		t.Fatal("failed to receive the route")
+	}
+
+	if r, _ := rt.Route(req); r == nil {
+		t.Error("failed to match the alias")
+	}
+
+	if req.Host != "www.example.org" {
+		t.Error("unexpected change of the request host", req.Host)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the built-in predicate matching the requests during
+// recurring weekly windows, in the local time of an IANA timezone, e.g.
+// Schedule("Europe/Berlin", "Mon-Fri 09:00-18:00", "Sat 10:00-14:00").
+const ScheduleName = "Schedule"
+
+const minutesPerDay = 24 * 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday}
+
+type scheduleSpec struct {
+	now func() time.Time
+}
+
+// a daily window, in minutes of the local day, on the selected days of
+// the week. When the end is not after the start, the window ends on the
+// next day.
+type scheduleWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+// matches the requests received during any of the windows
+type schedulePredicate struct {
+	location *time.Location
+	windows  []scheduleWindow
+	now      func() time.Time
+}
+
+func (s *scheduleSpec) Name() string { return ScheduleName }
+
+// parses a weekday or a range of weekdays, e.g. Mon or Fri-Mon
+func parseWeekdays(s string, days *[7]bool) error {
+	fromTo := strings.SplitN(s, "-", 2)
+	from, ok := weekdays[strings.ToLower(fromTo[0])]
+	if !ok {
+		return fmt.Errorf("invalid weekday: %s", fromTo[0])
+	}
+
+	to := from
+	if len(fromTo) == 2 {
+		if to, ok = weekdays[strings.ToLower(fromTo[1])]; !ok {
+			return fmt.Errorf("invalid weekday: %s", fromTo[1])
+		}
+	}
+
+	for d := from; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == to {
+			return nil
+		}
+	}
+}
+
+// parses a local time of the day, in minutes, from 00:00 to 24:00
+func parseDayMinutes(s string) (int, error) {
+	hm := strings.Split(s, ":")
+	if len(hm) != 2 || len(hm[0]) != 2 || len(hm[1]) != 2 {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+
+	h, err := strconv.Atoi(hm[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+
+	m, err := strconv.Atoi(hm[1])
+	if err != nil || h < 0 || m < 0 || m > 59 || h*60+m > minutesPerDay {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// parses a window, e.g. "Mon-Fri 09:00-18:00", "Sat,Sun 10:00-14:00" or
+// "Fri 22:00-02:00". Without the weekdays, the window applies to every
+// day.
+func parseScheduleWindow(s string) (scheduleWindow, error) {
+	var w scheduleWindow
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		for i := range w.days {
+			w.days[i] = true
+		}
+	case 2:
+		for _, d := range strings.Split(fields[0], ",") {
+			if err := parseWeekdays(d, &w.days); err != nil {
+				return w, err
+			}
+		}
+	default:
+		return w, fmt.Errorf("invalid schedule window: %s", s)
+	}
+
+	startEnd := strings.Split(fields[len(fields)-1], "-")
+	if len(startEnd) != 2 {
+		return w, fmt.Errorf("invalid schedule window: %s", s)
+	}
+
+	var err error
+	if w.start, err = parseDayMinutes(startEnd[0]); err != nil {
+		return w, err
+	}
+
+	if w.end, err = parseDayMinutes(startEnd[1]); err != nil {
+		return w, err
+	}
+
+	if w.start == w.end || w.start == minutesPerDay {
+		return w, fmt.Errorf("invalid schedule window: %s", s)
+	}
+
+	return w, nil
+}
+
+// Creates a schedule predicate with the name of an IANA timezone, and
+// one or more windows in the local time of the zone.
+func (s *scheduleSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(ScheduleName, args, 2, len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(a[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p := &schedulePredicate{location: loc, now: s.now}
+	for _, ai := range a[1:] {
+		w, err := parseScheduleWindow(ai)
+		if err != nil {
+			return nil, err
+		}
+
+		p.windows = append(p.windows, w)
+	}
+
+	return p, nil
+}
+
+// The windows are evaluated on the local wall clock of the zone, so the
+// opening hours don't shift with the daylight saving time.
+func (w scheduleWindow) match(day time.Weekday, minute int) bool {
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+
+	return w.days[day] && minute >= w.start || w.days[(day+6)%7] && minute < w.end
+}
+
+func (p *schedulePredicate) Match(*http.Request) bool {
+	t := p.now().In(p.location)
+	day, minute := t.Weekday(), t.Hour()*60+t.Minute()
+	for _, w := range p.windows {
+		if w.match(day, minute) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleWindows(t *testing.T) {
+	var now time.Time
+	s := &scheduleSpec{now: func() time.Time { return now }}
+	p, err := s.Create([]interface{}{
+		"Europe/Berlin",
+		"Mon-Fri 09:00-18:00",
+		"Sat,Sun 10:00-14:00",
+		"Fri 22:00-02:00",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		utc      string
+		expected bool
+	}{
+		// Monday, CET
+		{"2024-01-08T07:59:00Z", false},
+		{"2024-01-08T08:00:00Z", true},
+		{"2024-01-08T16:59:00Z", true},
+		{"2024-01-08T17:00:00Z", false},
+
+		// Friday night, crossing into Saturday
+		{"2024-01-12T20:59:00Z", false},
+		{"2024-01-12T21:00:00Z", true},
+		{"2024-01-13T00:59:00Z", true},
+		{"2024-01-13T01:00:00Z", false},
+
+		// Sunday
+		{"2024-01-14T09:30:00Z", true},
+		{"2024-01-14T13:00:00Z", false},
+
+		// Sunday, before and after the switch to daylight saving time
+		{"2024-03-24T08:59:00Z", false},
+		{"2024-03-24T09:00:00Z", true},
+		{"2024-03-31T07:59:00Z", false},
+		{"2024-03-31T08:00:00Z", true},
+		{"2024-03-31T11:59:00Z", true},
+		{"2024-03-31T12:00:00Z", false},
+
+		// Monday, CEST
+		{"2024-07-01T07:00:00Z", true},
+		{"2024-07-01T16:00:00Z", false},
+	} {
+		now, err = time.Parse(time.RFC3339, ti.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Match(nil) != ti.expected {
+			t.Error("invalid match", ti.utc, ti.expected)
+		}
+	}
+}
+
+func TestScheduleEveryDay(t *testing.T) {
+	now := time.Date(2024, 1, 10, 23, 30, 0, 0, time.UTC)
+	s := &scheduleSpec{now: func() time.Time { return now }}
+	p, err := s.Create([]interface{}{"UTC", "23:00-24:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Match(nil) {
+		t.Error("failed to match")
+	}
+}
+
+func TestScheduleRoute(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		open: Path("/shop") && Schedule("UTC", "Mon-Sun 00:00-24:00") -> "https://open.example.org";
+		shop: Path("/shop") -> "https://closed.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	req, err := newRequest("GET", "/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, _ := m.match(req); r == nil || r.Id != "open" {
+		t.Error("failed to match the scheduled route", r)
+	}
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"Europe/Berlin"},
+		{42, "09:00-18:00"},
+		{"No/Such_Zone", "09:00-18:00"},
+		{"Europe/Berlin", 42},
+		{"Europe/Berlin", "Mon-Fri"},
+		{"Europe/Berlin", "Mon-Fri 09:00"},
+		{"Europe/Berlin", "Monday 09:00-18:00"},
+		{"Europe/Berlin", "Mon-Foo 09:00-18:00"},
+		{"Europe/Berlin", "Mon 9:00-18:00"},
+		{"Europe/Berlin", "Mon 09:60-18:00"},
+		{"Europe/Berlin", "Mon 09:00-24:01"},
+		{"Europe/Berlin", "Mon 09:00-09:00"},
+		{"Europe/Berlin", "Mon 24:00-09:00"},
+		{"Europe/Berlin", "Mon 09:00-18:00 extra"},
+	} {
+		if _, err := (&scheduleSpec{now: time.Now}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
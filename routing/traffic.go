@@ -0,0 +1,56 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// The name of the built-in predicate matching a random share of the
+// requests, e.g. Traffic(0.05). Used for canarying, together with a route
+// without the predicate, that receives the rest of the requests.
+const TrafficName = "Traffic"
+
+type trafficSpec struct {
+	random func() float64
+}
+
+// matches the requests with the given chance
+type trafficPredicate struct {
+	chance float64
+	random func() float64
+}
+
+func (s *trafficSpec) Name() string { return TrafficName }
+
+// Creates a traffic predicate with the chance of matching a request,
+// between 0 and 1.
+func (s *trafficSpec) Create(args []interface{}) (Predicate, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments for predicate %s: %d", TrafficName, len(args))
+	}
+
+	c, ok := args[0].(float64)
+	if !ok || c < 0 || c > 1 {
+		return nil, fmt.Errorf("invalid argument for predicate %s: %v", TrafficName, args[0])
+	}
+
+	return &trafficPredicate{chance: c, random: s.random}, nil
+}
+
+func (p *trafficPredicate) Match(*http.Request) bool {
+	return p.random() < p.chance
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import "testing"
+
+func TestTrafficChance(t *testing.T) {
+	var rnd float64
+	s := &trafficSpec{random: func() float64 { return rnd }}
+	p, err := s.Create([]interface{}{0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ti := range []struct {
+		random   float64
+		expected bool
+	}{
+		{0, true},
+		{0.049, true},
+		{0.05, false},
+		{0.5, false},
+	} {
+		rnd = ti.random
+		if p.Match(nil) != ti.expected {
+			t.Error("invalid match", ti.random, ti.expected)
+		}
+	}
+}
+
+func TestTrafficCanary(t *testing.T) {
+	m, errs, err := customPredicateMatcher(`
+		none: Path("/none") && Traffic(0) -> "https://canary.example.org";
+		all: Path("/all") && Traffic(1) -> "https://canary.example.org";
+		noneStable: Path("/none") -> "https://stable.example.org";
+		allStable: Path("/all") -> "https://stable.example.org"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, ti := range []struct {
+		path     string
+		expected string
+	}{
+		{"/none", "noneStable"},
+		{"/all", "all"},
+	} {
+		req, err := newRequest("GET", ti.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, _ := m.match(req)
+		if r == nil || r.Id != ti.expected {
+			t.Error("invalid match", ti.path, r, ti.expected)
+		}
+	}
+}
+
+func TestInvalidTraffic(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"0.05"},
+		{-0.1},
+		{1.5},
+		{0.05, 0.1},
+	} {
+		if _, err := (&trafficSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+}
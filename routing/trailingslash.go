@@ -0,0 +1,161 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The name of the built-in predicate setting the trailing slash policy
+// of a route, e.g. TrailingSlash("redirect").
+const TrailingSlashName = "TrailingSlash"
+
+// how a route treats the requests whose path differs from the route
+// path only in a trailing slash
+type trailingSlashPolicy int
+
+const (
+	trailingSlashDefault trailingSlashPolicy = iota
+	trailingSlashStrict
+	trailingSlashMatch
+	trailingSlashRedirect
+)
+
+// the policies accepted by the TrailingSlash predicate
+var trailingSlashPolicies = map[string]trailingSlashPolicy{
+	"strict":   trailingSlashStrict,
+	"match":    trailingSlashMatch,
+	"redirect": trailingSlashRedirect}
+
+type trailingSlashSpec struct{}
+
+func (s *trailingSlashSpec) Name() string { return TrailingSlashName }
+
+// Creates a trailing slash policy with one of the policies strict, match
+// or redirect.
+func (s *trailingSlashSpec) Create(args []interface{}) (Predicate, error) {
+	a, err := predicateArgs(TrailingSlashName, args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := trailingSlashPolicies[a[0]]
+	if !ok {
+		return nil, fmt.Errorf("invalid trailing slash policy: %s", a[0])
+	}
+
+	return p, nil
+}
+
+// The policy doesn't restrict the matching requests, it is applied by
+// the matcher, when looking up the path.
+func (p trailingSlashPolicy) Match(*http.Request) bool { return true }
+
+// returns the trailing slash policy set by the predicates of a route, or
+// the default, and the rest of the predicates, without the ones that
+// don't restrict the matching requests, TrailingSlash and ValidUntil
+func splitTrailingSlashPolicy(ps []customPredicate) (trailingSlashPolicy, []customPredicate) {
+	var (
+		policy     = trailingSlashDefault
+		conditions []customPredicate
+	)
+
+	for _, p := range ps {
+		switch pt := p.Predicate.(type) {
+		case trailingSlashPolicy:
+			if policy == trailingSlashDefault {
+				policy = pt
+			}
+		case validUntilPredicate:
+		default:
+			conditions = append(conditions, p)
+		}
+	}
+
+	return policy, conditions
+}
+
+// tells whether a path ends with a slash, not counting the root path
+func hasTrailingSlash(path string) bool {
+	return len(path) > 1 && path[len(path)-1] == '/'
+}
+
+// returns the path with the trailing slash added or removed. The root
+// path is returned unchanged.
+func toggleTrailingSlash(path string) string {
+	switch {
+	case path == "/":
+		return path
+	case hasTrailingSlash(path):
+		return path[:len(path)-1]
+	default:
+		return path + "/"
+	}
+}
+
+// returns the request path in the form of the route path
+func canonicalSlashPath(path string, slash bool) string {
+	path = strings.TrimSuffix(path, "/")
+	if slash {
+		path += "/"
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	return path
+}
+
+// not available as a constant in net/http of the supported Go versions
+const statusPermanentRedirect = 308
+
+// filter answering the requests with a redirect to the path with the
+// canonical trailing slash
+type trailingSlashRedirectFilter struct {
+	location string
+}
+
+// Responds with 301 for GET and HEAD requests, and 308 for the other
+// methods, to preserve the method and the body.
+func (f *trailingSlashRedirectFilter) Request(ctx filters.FilterContext) {
+	code := http.StatusMovedPermanently
+	if m := ctx.Request().Method; m != "GET" && m != "HEAD" {
+		code = statusPermanentRedirect
+	}
+
+	w := ctx.ResponseWriter()
+	w.Header().Set("Location", f.location)
+	w.WriteHeader(code)
+	ctx.MarkServed()
+}
+
+func (f *trailingSlashRedirectFilter) Response(filters.FilterContext) {}
+
+// returns a shunt route with the id of the matched route, that redirects
+// the request to the path with the canonical trailing slash
+func trailingSlashRedirectRoute(r *Route, req *http.Request, path string) *Route {
+	u := &url.URL{Path: path, RawQuery: req.URL.RawQuery}
+	return &Route{
+		Route: eskip.Route{Id: r.Id, Shunt: true},
+		Filters: []*RouteFilter{{
+			Filter: &trailingSlashRedirectFilter{location: u.String()},
+			Name:   "trailingSlashRedirect"}}}
+}
@@ -0,0 +1,242 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const trailingSlashRoutes = `
+	defaultPolicy: Path("/default") -> "https://default.example.org";
+	strict: Path("/strict/") && TrailingSlash("strict") -> "https://strict.example.org";
+	match: Path("/match") && TrailingSlash("match") -> "https://match.example.org";
+	redirect: Path("/redirect/") && TrailingSlash("redirect") -> "https://redirect.example.org";
+	wildcard: Path("/items/:id") && TrailingSlash("redirect") -> "https://items.example.org";
+	free: Path("/files/*name") -> "https://files.example.org";
+	root: Path("/") -> "https://root.example.org"`
+
+func TestTrailingSlashPolicies(t *testing.T) {
+	for _, ti := range []struct {
+		title    string
+		options  MatchingOptions
+		method   string
+		path     string
+		expected string
+		location string
+		code     int
+	}{{
+		title:    "exact",
+		method:   "GET",
+		path:     "/default",
+		expected: "defaultPolicy",
+	}, {
+		title:  "strict by default",
+		method: "GET",
+		path:   "/default/",
+	}, {
+		title:    "match by global option",
+		options:  IgnoreTrailingSlash,
+		method:   "GET",
+		path:     "/default/",
+		expected: "defaultPolicy",
+	}, {
+		title:    "redirect by global option",
+		options:  RedirectTrailingSlash,
+		method:   "GET",
+		path:     "/default/",
+		expected: "defaultPolicy",
+		location: "/default",
+		code:     http.StatusMovedPermanently,
+	}, {
+		title:    "redirect takes precedence over ignoring",
+		options:  IgnoreTrailingSlash | RedirectTrailingSlash,
+		method:   "GET",
+		path:     "/default/",
+		expected: "defaultPolicy",
+		location: "/default",
+		code:     http.StatusMovedPermanently,
+	}, {
+		title:  "strict route",
+		method: "GET",
+		path:   "/strict",
+	}, {
+		title:   "strict route overrides the global option",
+		options: IgnoreTrailingSlash,
+		method:  "GET",
+		path:    "/strict",
+	}, {
+		title:    "strict route matches exactly when ignoring",
+		options:  IgnoreTrailingSlash,
+		method:   "GET",
+		path:     "/strict/",
+		expected: "strict",
+	}, {
+		title:    "match route",
+		method:   "GET",
+		path:     "/match/",
+		expected: "match",
+	}, {
+		title:    "redirect route",
+		method:   "GET",
+		path:     "/redirect?foo=bar",
+		expected: "redirect",
+		location: "/redirect/?foo=bar",
+		code:     http.StatusMovedPermanently,
+	}, {
+		title:    "redirect route when ignoring",
+		options:  IgnoreTrailingSlash,
+		method:   "HEAD",
+		path:     "/redirect",
+		expected: "redirect",
+		location: "/redirect/",
+		code:     http.StatusMovedPermanently,
+	}, {
+		title:    "redirect preserving the method",
+		method:   "POST",
+		path:     "/redirect",
+		expected: "redirect",
+		location: "/redirect/",
+		code:     statusPermanentRedirect,
+	}, {
+		title:    "redirect route exact",
+		method:   "GET",
+		path:     "/redirect/",
+		expected: "redirect",
+	}, {
+		title:    "redirect with wildcard",
+		method:   "GET",
+		path:     "/items/42/",
+		expected: "wildcard",
+		location: "/items/42",
+		code:     http.StatusMovedPermanently,
+	}, {
+		title:    "free wildcard keeps the slash",
+		options:  RedirectTrailingSlash,
+		method:   "GET",
+		path:     "/files/a/b/",
+		expected: "free",
+	}, {
+		title:    "root",
+		options:  RedirectTrailingSlash,
+		method:   "GET",
+		path:     "/",
+		expected: "root",
+	}} {
+		m, err := docToMatcherOpts(trailingSlashRoutes, ti.options)
+		if err != nil {
+			t.Fatal(ti.title, err)
+		}
+
+		req, err := http.NewRequest(ti.method, "https://www.example.org"+ti.path, nil)
+		if err != nil {
+			t.Fatal(ti.title, err)
+		}
+
+		r, _ := m.match(req)
+		if ti.expected == "" {
+			if r != nil {
+				t.Error(ti.title, "unexpected match", r.Id)
+			}
+
+			continue
+		}
+
+		if r == nil || r.Id != ti.expected {
+			t.Error(ti.title, "failed to match", r, ti.expected)
+			continue
+		}
+
+		if ti.location == "" {
+			if r.Shunt {
+				t.Error(ti.title, "unexpected redirect")
+			}
+
+			continue
+		}
+
+		if !r.Shunt || len(r.Filters) != 1 {
+			t.Error(ti.title, "failed to redirect")
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		ctx := &filtertest.Context{FRequest: req, FResponseWriter: w}
+		r.Filters[0].Request(ctx)
+		if !ctx.FServed || w.Code != ti.code || w.Header().Get("Location") != ti.location {
+			t.Error(ti.title, "invalid redirect", ctx.FServed, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestTrailingSlashAllowedMethods(t *testing.T) {
+	m, err := docToMatcher(`
+		get: Path("/foo/") && Method("GET") && TrailingSlash("match") -> <shunt>;
+		put: Path("/foo") && Method("PUT") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("DELETE", "https://www.example.org/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := m.allowedMethods(req)
+	if len(methods) != 2 || methods[0] != "GET" || methods[1] != "PUT" {
+		t.Error("invalid allowed methods", methods)
+	}
+}
+
+func TestInvalidTrailingSlashPolicy(t *testing.T) {
+	defs, err := eskip.Parse(`Path("/foo") && TrailingSlash("sometimes") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newLeaf(&Route{Route: *defs[0]}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestTrailingSlashInExpression(t *testing.T) {
+	defs, err := eskip.Parse(`Path("/foo") && (TrailingSlash("match") || Method("GET")) -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newLeaf(&Route{Route: *defs[0]}); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestTrailingSlashIsNotCondition(t *testing.T) {
+	defs, err := eskip.Parse(`Path("/foo") && TrailingSlash("redirect") -> <shunt>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := newLeaf(&Route{Route: *defs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.slashPolicy != trailingSlashRedirect || len(l.custom) != 0 || leafWeight(l) != 0 {
+		t.Error("invalid leaf", l.slashPolicy, len(l.custom), leafWeight(l))
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"crypto/sha256"
+	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/eskip"
+)
+
+// a processed route of the current routing table, together with the
+// definition that it was created from, and the hash of its definition
+type routeEntry struct {
+	def   *eskip.Route
+	hash  [sha256.Size]byte
+	route *Route
+}
+
+// the processed routes of the current routing table by their ids, and
+// the matcher created from them. It is kept between the updates, so
+// that only the changed route definitions need to be processed again.
+type routeState struct {
+	entries map[string]*routeEntry
+	matcher *matcher
+
+	// the number of the changed route definitions rejected while
+	// creating the state
+	rejected int
+}
+
+func defHash(def *eskip.Route) [sha256.Size]byte {
+	return sha256.Sum256([]byte(def.String()))
+}
+
+// tells whether a route definition is the same as the one that an
+// existing entry was created from. The data clients typically keep the
+// definition instances of the unchanged routes between updates, and
+// for the others, only the hashes of the definitions are compared. The
+// hash of the definition is returned, when it was calculated.
+func (e *routeEntry) sameDef(def *eskip.Route) (bool, [sha256.Size]byte) {
+	if e.def == def {
+		return true, e.hash
+	}
+
+	h := defHash(def)
+	return h == e.hash, h
+}
+
+// creates the next state from the current set of route definitions.
+// The unchanged routes, including their filter instances, are taken
+// over from the previous state, and the matcher is updated only with
+// the changed routes. The previous state is not modified.
+func (s *routeState) next(o Options, defs []*eskip.Route) (*routeState, []*Route) {
+	var (
+		routes []*Route
+		added  []*Route
+		n      = &routeState{entries: make(map[string]*routeEntry, len(defs))}
+	)
+
+	for _, def := range defs {
+		var hash [sha256.Size]byte
+		if e, ok := s.entries[def.Id]; ok {
+			var same bool
+			if same, hash = e.sameDef(def); same {
+				n.entries[def.Id] = &routeEntry{def, hash, e.route}
+				routes = append(routes, e.route)
+				continue
+			}
+		} else {
+			hash = defHash(def)
+		}
+
+		r, err := processRouteDef(o.FilterRegistry, o.PredicateRegistry, def)
+		if err != nil {
+			log.Error(err)
+			n.rejected++
+			continue
+		}
+
+		n.entries[def.Id] = &routeEntry{def, hash, r}
+		routes = append(routes, r)
+		added = append(added, r)
+	}
+
+	var removed []*Route
+	for id, e := range s.entries {
+		if ne, ok := n.entries[id]; !ok || ne.route != e.route {
+			removed = append(removed, e.route)
+		}
+	}
+
+	var errs []*definitionError
+	switch {
+	case s.matcher == nil:
+		n.matcher, errs = newMatcher(routes, o.MatchingOptions)
+	case len(added) == 0 && len(removed) == 0:
+		n.matcher = s.matcher
+	default:
+		n.matcher, errs = s.matcher.update(removed, added)
+	}
+
+	for _, err := range errs {
+		log.Error(err)
+	}
+
+	n.rejected += len(errs)
+	return n, n.dropFailed(routes, errs)
+}
+
+// removes the routes that the matcher failed to accept from the entries,
+// so that they are not reported as active, and their definitions are
+// processed again with the next update. Returns the remaining routes.
+func (s *routeState) dropFailed(routes []*Route, errs []*definitionError) []*Route {
+	failed := make(map[string]bool)
+	for _, err := range errs {
+		if err.Id != "" {
+			failed[err.Id] = true
+			delete(s.entries, err.Id)
+		}
+	}
+
+	if len(failed) == 0 {
+		return routes
+	}
+
+	var kept []*Route
+	for _, r := range routes {
+		if !failed[r.Id] {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept
+}
+
+// returns the leaves without the ones of the dropped routes, and with
+// the added ones. The kept leaves are copied, because their rank is
+// reset when they are ordered, while the original leaves may be in use.
+func mergeLeaves(leaves leafMatchers, dropped map[*Route]bool, added leafMatchers) leafMatchers {
+	var merged leafMatchers
+	for _, l := range leaves {
+		if dropped[l.route] {
+			continue
+		}
+
+		c := *l
+		merged = append(merged, &c)
+	}
+
+	return append(merged, added...)
+}
+
+// creates a new matcher from the current one, without the removed
+// routes, and with the added ones. The current matcher is not modified,
+// and the path matchers not affected by the change are shared between
+// the two. Only the leaves with the same path as a changed route are
+// ordered again, and the path tree is rebuilt only when the set of the
+// paths changes.
+func (m *matcher) update(removed, added []*Route) (*matcher, []*definitionError) {
+	var (
+		errors    []*definitionError
+		rootDirty bool
+		rootAdded leafMatchers
+		o         = m.matchingOptions
+		dropped   = make(map[*Route]bool)
+		dirty     = make(map[string]leafMatchers)
+	)
+
+	for _, r := range removed {
+		dropped[r] = true
+		if r.Path == "" {
+			rootDirty = true
+			continue
+		}
+
+		p := pathKey(r.Path, o)
+		// mark the path as changed
+		dirty[p] = dirty[p]
+	}
+
+	for i, r := range added {
+		l, err := newPathLeaf(r, o)
+		if err != nil {
+			errors = append(errors, &definitionError{r.Id, i, err})
+			continue
+		}
+
+		if r.Path == "" {
+			rootDirty = true
+			rootAdded = append(rootAdded, l)
+			continue
+		}
+
+		p := pathKey(r.Path, o)
+		dirty[p] = append(dirty[p], l)
+	}
+
+	next := &matcher{
+		paths:           m.paths,
+		byPath:          make(map[string]*pathMatcher, len(m.byPath)),
+		rootLeaves:      m.rootLeaves,
+		rootIndex:       m.rootIndex,
+		matchingOptions: o}
+
+	for p, pm := range m.byPath {
+		next.byPath[p] = pm
+	}
+
+	if rootDirty {
+		next.rootLeaves = mergeLeaves(m.rootLeaves, dropped, rootAdded)
+		next.rootIndex = orderLeaves(next.rootLeaves)
+	}
+
+	var pathsChanged bool
+	for p, addedLeaves := range dirty {
+		var leaves leafMatchers
+		current, exists := next.byPath[p]
+		if exists {
+			leaves = current.leaves
+		}
+
+		leaves = mergeLeaves(leaves, dropped, addedLeaves)
+		if len(leaves) == 0 {
+			if exists {
+				delete(next.byPath, p)
+				pathsChanged = true
+			}
+
+			continue
+		}
+
+		pathsChanged = pathsChanged || !exists
+		next.byPath[p] = &pathMatcher{
+			leaves:            leaves,
+			index:             orderLeaves(leaves),
+			freeWildcardParam: freeWildcardParam(p)}
+	}
+
+	if pathsChanged {
+		var treeErrors []*definitionError
+		next.paths, treeErrors = buildPathTree(next.byPath)
+		errors = append(errors, treeErrors...)
+	}
+
+	return next, errors
+}
@@ -0,0 +1,223 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func updateTestDef(id string, shape int) *eskip.Route {
+	r := &eskip.Route{Id: id, Backend: fmt.Sprintf("https://%s.example.org", id)}
+	host := fmt.Sprintf("^h%d[.]example[.]org$", shape%5)
+	switch shape % 4 {
+	case 0:
+		r.Path = fmt.Sprintf("/p%d", shape%17)
+		r.Method = []string{"GET", "POST"}[shape%2]
+	case 1:
+		r.Path = fmt.Sprintf("/p%d/:id", shape%17)
+		r.HostRegexps = []string{host}
+	case 2:
+		r.PathRegexps = []string{fmt.Sprintf("^/r%d/", shape%13)}
+	case 3:
+		r.HostRegexps = []string{host}
+		r.Method = "GET"
+	}
+
+	return r
+}
+
+func updateTestRequests() []*http.Request {
+	var reqs []*http.Request
+	for i := 0; i < 17; i++ {
+		for _, m := range []string{"GET", "POST"} {
+			for _, p := range []string{"/p%d", "/p%d/x", "/r%d/x", "/"} {
+				reqs = append(reqs, &http.Request{
+					Method: m,
+					Host:   fmt.Sprintf("h%d.example.org", i%5),
+					URL:    &url.URL{Path: fmt.Sprintf(p, i%13)}})
+			}
+		}
+	}
+
+	return reqs
+}
+
+func matchedIds(m *matcher, reqs []*http.Request) []string {
+	var ids []string
+	for _, req := range reqs {
+		r, _ := m.match(req)
+		if r == nil {
+			ids = append(ids, "")
+			continue
+		}
+
+		ids = append(ids, r.Id)
+	}
+
+	return ids
+}
+
+func checkMatchedIds(t *testing.T, step int, got, expected []string) {
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("step %d, request %d: expected %q, got %q", step, i, expected[i], got[i])
+			return
+		}
+	}
+}
+
+func TestIncrementalUpdate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	reqs := updateTestRequests()
+	defs := make(map[string]*eskip.Route)
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("route%d", i)
+		defs[id] = updateTestDef(id, i)
+	}
+
+	var (
+		state    = &routeState{}
+		previous []string
+		next     = 200
+	)
+
+	for step := 0; step < 60; step++ {
+		if step > 0 {
+			for i := 0; i < 1+rnd.Intn(5); i++ {
+				id := fmt.Sprintf("route%d", rnd.Intn(next))
+				switch rnd.Intn(3) {
+				case 0:
+					delete(defs, id)
+				case 1:
+					defs[id] = updateTestDef(id, rnd.Intn(100))
+				default:
+					id = fmt.Sprintf("route%d", next)
+					defs[id] = updateTestDef(id, rnd.Intn(100))
+					next++
+				}
+			}
+		}
+
+		var all []*eskip.Route
+		for _, d := range defs {
+			all = append(all, d)
+		}
+
+		prevMatcher := state.matcher
+		state, _ = state.next(Options{}, all)
+
+		full, errs := newMatcher(processRouteDefs(nil, nil, all), MatchingOptionsNone)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+
+		expected := matchedIds(full, reqs)
+		checkMatchedIds(t, step, matchedIds(state.matcher, reqs), expected)
+
+		if prevMatcher != nil {
+			checkMatchedIds(t, step, matchedIds(prevMatcher, reqs), previous)
+		}
+
+		previous = expected
+	}
+}
+
+func TestIncrementalUpdateKeepsUnchangedRoutes(t *testing.T) {
+	r0 := updateTestDef("route0", 0)
+	r1 := updateTestDef("route1", 1)
+	s0, _ := (&routeState{}).next(Options{}, []*eskip.Route{r0, r1})
+
+	// an equal definition in a new instance
+	r0Copy := *r0
+	r1Changed := updateTestDef("route1", 2)
+	s1, routes := s0.next(Options{}, []*eskip.Route{&r0Copy, r1Changed})
+	if len(routes) != 2 {
+		t.Fatal("invalid number of routes", len(routes))
+	}
+
+	if s1.entries["route0"].route != s0.entries["route0"].route {
+		t.Error("failed to keep the unchanged route")
+	}
+
+	if s1.entries["route1"].route == s0.entries["route1"].route {
+		t.Error("failed to replace the changed route")
+	}
+
+	s2, _ := s1.next(Options{}, []*eskip.Route{&r0Copy, r1Changed})
+	if s2.matcher != s1.matcher {
+		t.Error("failed to keep the matcher without changes")
+	}
+}
+
+func TestIncrementalUpdateDropsFailedRoutes(t *testing.T) {
+	r0 := updateTestDef("route0", 0)
+	s0, _ := (&routeState{}).next(Options{}, []*eskip.Route{r0})
+
+	invalid := &eskip.Route{Id: "invalid", HostRegexps: []string{"["}, Backend: "https://invalid.example.org"}
+	s1, routes := s0.next(Options{}, []*eskip.Route{r0, invalid})
+	if len(routes) != 1 || routes[0].Id != "route0" {
+		t.Error("failed to drop the failed route", routes)
+	}
+
+	if _, ok := s1.entries["invalid"]; ok || s1.rejected != 1 {
+		t.Error("failed to drop the entry of the failed route", s1.rejected)
+	}
+
+	// the failed definition is processed again
+	s2, routes := s1.next(Options{}, []*eskip.Route{r0, invalid})
+	if len(routes) != 1 || s2.rejected != 1 {
+		t.Error("failed to process the failed route again", len(routes), s2.rejected)
+	}
+
+	fixed := &eskip.Route{Id: "invalid", HostRegexps: []string{"^fixed[.]example[.]org$"}, Backend: "https://invalid.example.org"}
+	s3, routes := s2.next(Options{}, []*eskip.Route{r0, fixed})
+	if len(routes) != 2 || s3.rejected != 0 || s3.entries["invalid"] == nil {
+		t.Error("failed to accept the fixed route", len(routes), s3.rejected)
+	}
+}
+
+func benchmarkUpdate(b *testing.B, update func(*routeState, []*eskip.Route) *routeState) {
+	var defs []*eskip.Route
+	for i := 0; i < 10000; i++ {
+		defs = append(defs, updateTestDef(fmt.Sprintf("route%d", i), i))
+	}
+
+	state := update(&routeState{}, defs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(defs)
+		defs[j] = updateTestDef(defs[j].Id, i)
+		state = update(state, defs)
+	}
+}
+
+func BenchmarkIncrementalUpdate10k(b *testing.B) {
+	benchmarkUpdate(b, func(s *routeState, defs []*eskip.Route) *routeState {
+		n, _ := s.next(Options{}, defs)
+		return n
+	})
+}
+
+func BenchmarkFullRebuild10k(b *testing.B) {
+	benchmarkUpdate(b, func(s *routeState, defs []*eskip.Route) *routeState {
+		n, _ := (&routeState{}).next(Options{}, defs)
+		return n
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"net/http"
+	"time"
+)
+
+// The name of the built-in predicate setting the time after which the
+// route is not valid anymore, in RFC3339 format, e.g.
+// ValidUntil("2016-01-01T00:00:00Z").
+const ValidUntilName = "ValidUntil"
+
+type validUntilSpec struct{}
+
+// the expiration of a route
+type validUntilPredicate time.Time
+
+func parseValidUntil(args []interface{}) (time.Time, error) {
+	a, err := predicateArgs(ValidUntilName, args, 1, 1)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, a[0])
+}
+
+func (s *validUntilSpec) Name() string { return ValidUntilName }
+
+// Creates the expiration of a route with the time in RFC3339 format.
+func (s *validUntilSpec) Create(args []interface{}) (Predicate, error) {
+	t, err := parseValidUntil(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return validUntilPredicate(t), nil
+}
+
+// The expiration doesn't restrict the matching requests, the expired
+// routes are dropped from the routing table.
+func (p validUntilPredicate) Match(*http.Request) bool { return true }
+
+// Returns the time set by the ValidUntil predicate of a route, after
+// which the route is not valid anymore, or zero, when the route doesn't
+// expire.
+func ValidUntil(r *eskip.Route) (time.Time, error) {
+	for _, p := range r.CustomPredicates {
+		if p.Name == ValidUntilName {
+			return parseValidUntil(p.Args)
+		}
+	}
+
+	return time.Time{}, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"testing"
+	"time"
+)
+
+func TestValidUntil(t *testing.T) {
+	r := eskip.MustParse(`Path("/campaign") && ValidUntil("2016-01-01T12:00:00+01:00") -> "https://www.example.org"`)
+	v, err := ValidUntil(r[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Equal(time.Date(2016, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Error("failed to get valid until", v)
+	}
+
+	r = eskip.MustParse(`Path("/permanent") -> "https://www.example.org"`)
+	if v, err := ValidUntil(r[0]); err != nil || !v.IsZero() {
+		t.Error("invalid valid until of a permanent route", v, err)
+	}
+}
+
+func TestInvalidValidUntil(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"tomorrow"},
+		{42},
+		{"2016-01-01T00:00:00Z", "2017-01-01T00:00:00Z"},
+	} {
+		if _, err := (&validUntilSpec{}).Create(args); err == nil {
+			t.Error("failed to fail", args)
+		}
+	}
+
+	r := &eskip.Route{CustomPredicates: []*eskip.Predicate{{Name: ValidUntilName, Args: []interface{}{"tomorrow"}}}}
+	if _, err := ValidUntil(r); err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestDropExpiredKeepsInvalidExpiration(t *testing.T) {
+	now := time.Now()
+	defs := eskip.MustParse(`
+		expired: ValidUntil("2016-01-01T00:00:00Z") -> <shunt>;
+		invalid: ValidUntil("tomorrow") -> <shunt>;
+		expiring: ValidUntil("` + now.Add(time.Hour).Format(time.RFC3339) + `") -> <shunt>`)
+
+	valid, next, expired := dropExpired(defs, now, nil)
+	if len(valid) != 2 || valid[0].Id != "invalid" || valid[1].Id != "expiring" ||
+		!next.Equal(now.Add(time.Hour).Truncate(time.Second)) || !expired["expired"] {
+		t.Error("invalid expiration", valid, next, expired)
+	}
+}
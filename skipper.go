@@ -15,18 +15,32 @@
 package skipper
 
 import (
+	"crypto/tls"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/zalando/skipper/admin"
+	"github.com/zalando/skipper/cache"
+	"github.com/zalando/skipper/certs"
+	"github.com/zalando/skipper/chaos"
+	"github.com/zalando/skipper/consul"
+	"github.com/zalando/skipper/dashboard"
+	"github.com/zalando/skipper/dynamodb"
+	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/eskipfile"
+	"github.com/zalando/skipper/eskipurl"
 	"github.com/zalando/skipper/etcd"
 	"github.com/zalando/skipper/filters"
-	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/healthcheck"
 	"github.com/zalando/skipper/innkeeper"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/oauth"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/quota"
 	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/upgrade"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -44,15 +58,111 @@ type Options struct {
 	// Network address that skipper should listen on.
 	Address string
 
-	// List of custom filter specifications.
+	// When set, the proxy serves on this listener, instead of listening
+	// on Address, e.g. when the embedding application creates the
+	// listener itself. The in-place upgrades are disabled with it.
+	Listener net.Listener
+
+	// Enables the in-place upgrades of the binary: on SIGUSR2, the
+	// listener socket is passed to a new process started from the
+	// same path. Supported only on Unix like systems.
+	GracefulUpgrade bool
+
+	// Time to wait for the open connections when draining, before
+	// closing them. The connections are drained when receiving
+	// SIGTERM, with or without the in-place upgrades. Defaults to
+	// upgrade.DefaultDrainTimeout.
+	DrainTimeout time.Duration
+
+	// Time to keep accepting new connections after receiving SIGTERM,
+	// before draining. During the delay, the healthcheck filter
+	// responds with 503 Service Unavailable, to let the load balancers
+	// take the instance out of rotation.
+	ShutdownDelay time.Duration
+
+	// Opens the proxy listener with SO_REUSEPORT, so that a new skipper
+	// instance can listen on the same address while the old one is
+	// still serving or draining. Supported only on Unix like systems.
+	ReusePort bool
+
+	// Certificate and key file pairs of the proxy listener. When set,
+	// or when ACMEHosts is set, the listener serves TLS, selecting the
+	// certificate by the server name of the clients (SNI). The first
+	// pair is used for the clients without a matching server name.
+	TLSCertificates []certs.Pair
+
+	// The interval of checking the certificate files for changes, and
+	// reloading them. Defaults to certs.DefaultReloadInterval.
+	// Negative values disable the reloading.
+	TLSReloadInterval time.Duration
+
+	// Hosts whose certificates are obtained and renewed automatically
+	// with ACME, e.g. from Let's Encrypt, used when no certificate pair
+	// matches the server name.
+	ACMEHosts []string
+
+	// Directory where the ACME account and the certificates are kept
+	// across restarts.
+	ACMECacheDir string
+
+	// Contact email of the ACME account.
+	ACMEEmail string
+
+	// Defines whether the TLS listener requests or requires client
+	// certificates, and whether it verifies them. Only the verified
+	// certificates are matched by the ClientCert predicate.
+	TLSClientAuth tls.ClientAuthType
+
+	// Certificate authorities, in PEM files, used to verify the client
+	// certificates. When not set, the system roots are used.
+	TLSClientCAFiles []string
+
+	// List of custom filter specifications. Their names must not
+	// collide with the names of the built-in filters.
 	CustomFilters []filters.Spec
 
+	// When set, it is used as the base filter registry, instead of the
+	// registry of the built-in filters, e.g. to restrict the filters
+	// available to the routes. The filters enabled by the other
+	// options, and the custom filters are added to a copy of it, and
+	// their names must not collide with the names already registered.
+	FilterRegistry filters.Registry
+
+	// List of custom predicate specifications, that can be referenced
+	// in the route definitions like the built-in predicates. Their
+	// names must not collide with the names of the built-in
+	// predicates.
+	CustomPredicates []routing.PredicateSpec
+
 	// Urls of nodes in an etcd cluster, storing route definitions.
 	EtcdUrls []string
 
 	// Path prefix for skipper related data in the etcd storage.
 	EtcdPrefix string
 
+	// Address of the Consul HTTP API, e.g. http://localhost:8500, when
+	// the route definitions are stored in the Consul key/value store.
+	ConsulAddress string
+
+	// Key prefix for skipper related data in Consul. The routes are
+	// stored under <prefix>/routes/. Defaults to "skipper".
+	ConsulPrefix string
+
+	// ACL token for the Consul requests.
+	ConsulToken string
+
+	// Name of the DynamoDB table storing the route definitions. The
+	// AWS credentials are taken from the standard environment variables.
+	DynamoDBTable string
+
+	// AWS region of the DynamoDB table. Defaults to the AWS_REGION
+	// environment variable.
+	DynamoDBRegion string
+
+	// Endpoint of the DynamoDB API, e.g. for DynamoDB local. Defaults to
+	// the endpoint of the region.
+	DynamoDBEndpoint string
+
 	// API endpoint of the Innkeeper service, storing route definitions.
 	InnkeeperUrl string
 
@@ -76,19 +186,259 @@ type Options struct {
 	// The whitespace separated list of OAuth2 scopes.
 	OAuthScope string
 
-	// File containing static route definitions.
+	// File containing static route definitions, or a compiled route
+	// table created with the eskip compile command.
 	RoutesFile string
 
+	// Directory containing eskip files, with the .eskip extension, or
+	// compiled route tables, with the .eskipc extension. The changes
+	// of the files are detected on every poll of the data clients, and
+	// applied without a restart. An invalid file keeps its previous
+	// routes active, and the error is logged with the file name and
+	// the position.
+	RoutesDirectory string
+
+	// URL of an eskip document, or a compiled route table, served over
+	// HTTP or HTTPS. The document is polled with conditional requests,
+	// using its ETag, and the changes are applied incrementally.
+	RoutesURL string
+
+	// Additional headers sent with the requests for RoutesURL, e.g. the
+	// Authorization header.
+	RoutesURLHeaders map[string]string
+
+	// File containing a candidate set of route definitions. When set,
+	// every request is matched with these routes, too, only for
+	// comparison, and the differences from the live routes are
+	// reported in the metrics. The requests are handled only by the
+	// live routes.
+	ShadowRoutesFile string
+
+	// Additional data clients, used together with the ones created
+	// from the above options.
+	CustomDataClients []routing.DataClient
+
+	// Filters, in eskip format, prepended to the filters of every
+	// route, from every data client. The effective routes can be
+	// reviewed with the eskip effective command.
+	DefaultFilters string
+
+	// When set, the routes loaded from the data clients are checked
+	// with the default lint rules, and the findings are logged. The
+	// same checks are available with the eskip lint command.
+	LintRoutes bool
+
+	// JSON file containing the route and filter quotas of the tenants,
+	// when skipper is shared by multiple teams. The routes violating
+	// the quotas are rejected, and the reason is logged. The routes of
+	// the untrusted tenants can be sandboxed, with limited filter time
+	// and body buffering per request. (See the skipper/quota package.)
+	QuotaFile string
+
+	// Definitions of the groups of backend instances discovered from
+	// the cloud provider metadata APIs, which the routes can reference
+	// with the cloudBackend filter. See the cloud package for the
+	// format.
+	CloudBackends string
+
+	// Interval of refreshing the discovered cloud backends. Defaults
+	// to cloud.DefaultRefreshInterval.
+	CloudRefreshInterval time.Duration
+
+	// Interval of refreshing the key sets used by the jwtValidation
+	// filter. Defaults to jwt.DefaultRefreshInterval.
+	JwksRefreshInterval time.Duration
+
+	// When set, the chaos experiments of the routes are disabled at
+	// startup. They can be enabled and disabled at runtime on the
+	// /admin/chaos endpoint of the support listener, when the admin
+	// token is set.
+	ChaosDisabled bool
+
+	// When set, the web UI listing the routes with their traffic
+	// statistics is served on the /dashboard/ endpoint of the support
+	// listener. See the dashboard package.
+	Dashboard bool
+
+	// When set, the admin API is served on the /admin/ endpoint of the
+	// support listener, accepting the requests with this bearer token.
+	// See the admin package.
+	AdminToken string
+
+	// When set, the admin API accepts temporary route upserts and
+	// deletes, kept only in memory.
+	AdminMutableRoutes bool
+
+	// Address of a Redis server, in the form of host:port, keeping the
+	// counters of the rate limit filters, so that they are shared by
+	// the skipper instances. When not set, the counters are kept in
+	// memory, per instance.
+	RatelimitRedisAddress string
+
+	// The size limit of the responses stored in memory by the cache
+	// filter, in bytes. Defaults to cache.DefaultLocalStoreSize.
+	CacheSize int64
+
+	// When set, the cache filter keeps the responses in this store,
+	// e.g. in an external system shared by the skipper instances,
+	// instead of in memory.
+	CacheStore cache.Store
+
 	// Polling timeout of the routing data sources.
 	SourcePollTimeout time.Duration
 
+	// When greater than zero, the new versions of the routing table
+	// are activated first only for this percentage of the requests,
+	// consistently by flow id. See routing.TableRollout.
+	TableRolloutPercentage float64
+
+	// Time after which a new version of the routing table, activated
+	// for a percentage of the requests, is activated for all
+	// requests. Zero means that it needs to be promoted via the
+	// routing instance.
+	TableRolloutDuration time.Duration
+
+	// When set, together with TablePinningRetain and
+	// TablePinningTrustedClients, the requests of the trusted clients
+	// can be pinned with this header to a previous version of the
+	// routing table, for debugging. See routing.TablePinning.
+	TablePinningHeader string
+
+	// The number of the previous routing table versions retained for
+	// pinning.
+	TablePinningRetain int
+
+	// Comma separated list of IP addresses and CIDR ranges of the
+	// clients allowed to pin their requests to a routing table version.
+	TablePinningTrustedClients string
+
+	// The number of the proxies, e.g. load balancers, in front of
+	// skipper. The client address of the requests, used by the
+	// ClientIP condition, the clientIP filters, the client rate limits
+	// and the table pinning, is taken from the X-Forwarded-For header,
+	// skipping the addresses of this many proxies. See
+	// routing.TrustedProxies.
+	TrustedProxyHops int
+
+	// Comma separated list of IP addresses and CIDR ranges of the
+	// proxies in front of skipper, whose addresses are skipped, when
+	// taking the client address from the X-Forwarded-For header.
+	TrustedProxies string
+
 	// Flags controlling the proxy behavior.
 	ProxyOptions proxy.Options
 
+	// When the proxy option to drain the removed backends is set,
+	// and this value is greater than zero, the requests in-flight to
+	// a removed backend are canceled after this grace period.
+	CancelRemovedBackendsAfter time.Duration
+
+	// The address of a backend, in the form of scheme://host, where
+	// the requests are forwarded, when they don't match any route.
+	// When not set, these requests are answered with 404 Not Found.
+	DefaultBackend string
+
+	// Custom handler for the unmatched requests and the failed backend
+	// requests, used instead of the default error responses of the
+	// proxy.
+	ProxyErrorHandler proxy.ErrorHandler
+
+	// When greater than zero, the requests spending more time in the
+	// proxy than this value are logged with the timings of their
+	// stages.
+	SlowRequestThreshold time.Duration
+
+	// When greater than zero, the filters reading more bytes of the
+	// request or response bodies than this value are reported.
+	BodyBufferingThreshold int64
+
+	// When greater than zero, the filters can't read more bytes of
+	// the request or response bodies than this value, and the
+	// affected requests are aborted.
+	BodyBufferingLimit int64
+
+	// When greater than zero, the requests exceeding this number of
+	// in-flight requests are rejected with 503.
+	MaxInFlightRequests int
+
+	// When greater than zero, the number of the open backend
+	// connections is capped at this value, and the requests needing
+	// further connections are rejected with 503.
+	MaxBackendConnections int
+
+	// When greater than zero, the response bodies share this
+	// bandwidth, in bytes per second, divided fairly between the
+	// concurrent streams.
+	MaxResponseBandwidth int64
+
+	// When greater than zero, the upgraded connections, e.g. websocket
+	// connections, are closed after this idle duration.
+	UpgradeIdleTimeout time.Duration
+
+	// When not nil, only these request headers are passed to the next
+	// hop of the loopback routes.
+	LoopbackHeaders []string
+
+	// The state bag entries passed to the next hop of the loopback
+	// routes.
+	LoopbackStateBag []string
+
+	// The default circuit breaker of the backends, applied to the
+	// routes not setting their own with the circuitBreaker filter. The
+	// zero value disables it.
+	CircuitBreaker filters.CircuitBreakerSettings
+
+	// The default retries of the idempotent requests, applied to the
+	// routes not setting their own with the retry filter. The zero
+	// value disables them.
+	Retry filters.RetrySettings
+
+	// The share of the retries to the retried requests allowed by the
+	// retry budget. Defaults to 0.2.
+	RetryBudgetRatio float64
+
+	// The default timeouts of the backend requests, applied to the
+	// routes not overriding them with the timeout filters. The zero
+	// fields mean no timeout.
+	BackendTimeouts filters.BackendTimeouts
+
+	// Settings of the pooled backend connections: the idle
+	// connections per host, their timeout and the keep-alives.
+	BackendConnectionPool proxy.ConnectionPool
+
+	// The active health checks of the backends: the health check path,
+	// the interval and the timeout of the probes, and the thresholds of
+	// marking the backends down and healthy again. When the path is
+	// empty, only the load balancers with their own health check path
+	// are checked.
+	BackendHealthCheck healthcheck.Options
+
+	// The time budgets of the request filters, the backend request and
+	// the response filters of the routes. The zero fields mean no
+	// budget.
+	PhaseTimeouts filters.PhaseTimeouts
+
 	// Flag indicating to ignore trailing slashes in paths during route
 	// lookup.
 	IgnoreTrailingSlash bool
 
+	// The global trailing slash policy of the route lookup, applied to
+	// the routes not setting their own with the TrailingSlash
+	// condition: "strict", "match" or "redirect". When empty,
+	// IgnoreTrailingSlash decides between strict and match.
+	TrailingSlash string
+
+	// Flag indicating to match the raw host and path of the requests.
+	// By default, the port and the trailing dot are stripped from the
+	// host, and it is converted to lowercase, while the duplicate
+	// slashes and the dot segments are resolved in the path.
+	NoCanonicalization bool
+
+	// Comma separated list of host aliases, replaced with the host they
+	// stand for before the route matching, e.g.
+	// 'www.example.org=example.org,*.example.net=example.net'.
+	HostAliases string
+
 	// Priority routes that are matched against the requests before
 	// the standard routes from the data clients.
 	PriorityRoutes []proxy.PriorityRoute
@@ -101,6 +451,12 @@ type Options struct {
 	// Network address for the /metrics endpoint
 	MetricsListener string
 
+	// Network address for the /about endpoint, describing the version
+	// and the capabilities of the instance, for the /fingerprint
+	// endpoint, identifying the active routes and the options. When not
+	// set, the endpoints are disabled.
+	SupportListener string
+
 	// Skipper provides a set of metrics with different keys which are exposed via HTTP in JSON
 	// You can customize those key names with your own prefix
 	MetricsPrefix string
@@ -111,6 +467,18 @@ type Options struct {
 	// Flag that enables reporting of the Go runtime statistics exported in runtime and specifically runtime.MemStats
 	EnableRuntimeMetrics bool
 
+	// Custom metrics implementation, e.g. for shipping the metrics to a proprietary system. When set, the
+	// built-in metrics listener is not started.
+	CustomMetrics metrics.Metrics
+
+	// Network address for the /metrics endpoint in the Prometheus text exposition format. It can be set
+	// together with MetricsListener.
+	PrometheusListener string
+
+	// Prometheus backend receiving the measurements, e.g. one that the embedding application merges into
+	// its own metrics. When not set, and PrometheusListener is set, a new one is created.
+	PrometheusMetrics *metrics.Prometheus
+
 	// Output file for the application log. Default value: /dev/stderr.
 	//
 	// When /dev/stderr or /dev/stdout is passed in, it will be resolved
@@ -133,14 +501,49 @@ type Options struct {
 	// Warning: passing an arbitrary file will try to open for append
 	// it on start and use it, or fail on start, but the current
 	// implementation doesn't support any more proper handling
-	// of temporary failures or log-rolling.
+	// of temporary failures. The file can be rotated by size, see
+	// AccessLogMaxSize.
 	AccessLogOutput string
 
+	// Custom sink for the access log. When set, it takes precedence
+	// over AccessLogOutput.
+	AccessLogWriter io.Writer
+
 	// Disables the access log.
 	AccessLogDisabled bool
+
+	// Format of the access log, "combined", "extended" or "json".
+	// Default value: "combined".
+	AccessLogFormat string
+
+	// Request headers whose values are included in the access log.
+	AccessLogHeaders []string
+
+	// When the access log is written to a file, and this value is
+	// greater than zero, the file is rotated when its size would
+	// exceed this many bytes.
+	AccessLogMaxSize int64
+
+	// The number of rotated access log files to keep.
+	AccessLogMaxBackups int
+}
+
+// creates the quota policy, when the quota file is set
+func createQuotaPolicy(o Options) (*quota.Policy, error) {
+	if o.QuotaFile == "" {
+		return nil, nil
+	}
+
+	qo, err := quota.ReadOptions(o.QuotaFile)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return quota.New(qo), nil
 }
 
-func createDataClients(o Options, auth innkeeper.Authentication) ([]routing.DataClient, error) {
+func createDataClients(o Options, auth innkeeper.Authentication, policy *quota.Policy) ([]routing.DataClient, error) {
 	var clients []routing.DataClient
 
 	if o.RoutesFile != "" {
@@ -153,6 +556,29 @@ func createDataClients(o Options, auth innkeeper.Authentication) ([]routing.Data
 		clients = append(clients, f)
 	}
 
+	if o.RoutesDirectory != "" {
+		d, err := eskipfile.OpenDir(o.RoutesDirectory)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+
+		clients = append(clients, d)
+	}
+
+	if o.RoutesURL != "" {
+		u, err := eskipurl.New(eskipurl.Options{
+			URL:      o.RoutesURL,
+			Headers:  o.RoutesURLHeaders,
+			Insecure: o.ProxyOptions.Insecure()})
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+
+		clients = append(clients, u)
+	}
+
 	if o.InnkeeperUrl != "" {
 		ic, err := innkeeper.New(innkeeper.Options{
 			o.InnkeeperUrl, o.ProxyOptions.Insecure(), auth,
@@ -169,6 +595,58 @@ func createDataClients(o Options, auth innkeeper.Authentication) ([]routing.Data
 		clients = append(clients, etcd.New(o.EtcdUrls, o.EtcdPrefix))
 	}
 
+	if o.ConsulAddress != "" {
+		clients = append(clients, consul.New(consul.Options{
+			Address: o.ConsulAddress,
+			Prefix:  o.ConsulPrefix,
+			Token:   o.ConsulToken}))
+	}
+
+	if o.DynamoDBTable != "" {
+		d, err := dynamodb.New(dynamodb.Options{
+			Table:    o.DynamoDBTable,
+			Region:   o.DynamoDBRegion,
+			Endpoint: o.DynamoDBEndpoint})
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+
+		clients = append(clients, d)
+	}
+
+	clients = append(clients, o.CustomDataClients...)
+
+	// the chaos filters of the annotations are subject to the quota
+	// policy, too
+	for i, c := range clients {
+		clients[i] = chaos.Client(c)
+	}
+
+	if policy != nil {
+		for i, c := range clients {
+			clients[i] = policy.Client(c)
+		}
+	}
+
+	if o.DefaultFilters != "" {
+		fs, err := eskip.ParseFilters(o.DefaultFilters)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+
+		for i, c := range clients {
+			clients[i] = &defaultFiltersClient{c, fs}
+		}
+	}
+
+	if o.LintRoutes {
+		for i, c := range clients {
+			clients[i] = &lintClient{c}
+		}
+	}
+
 	return clients, nil
 }
 
@@ -194,6 +672,23 @@ func getLogOutput(name string) (io.Writer, error) {
 	return os.OpenFile(name, os.O_APPEND, os.ModeAppend)
 }
 
+func getAccessLogOutput(o Options) (io.Writer, error) {
+	if o.AccessLogWriter != nil {
+		return o.AccessLogWriter, nil
+	}
+
+	if o.AccessLogOutput == "" {
+		return nil, nil
+	}
+
+	name := path.Clean(o.AccessLogOutput)
+	if name == "/dev/stdout" || name == "/dev/stderr" {
+		return getLogOutput(name)
+	}
+
+	return logging.NewRotatingFile(name, o.AccessLogMaxSize, o.AccessLogMaxBackups)
+}
+
 func initLog(o Options) error {
 	var (
 		logOutput       io.Writer
@@ -208,8 +703,14 @@ func initLog(o Options) error {
 		}
 	}
 
-	if !o.AccessLogDisabled && o.AccessLogOutput != "" {
-		accessLogOutput, err = getLogOutput(o.AccessLogOutput)
+	switch o.AccessLogFormat {
+	case "", logging.AccessLogCombined, logging.AccessLogExtended, logging.AccessLogJSON:
+	default:
+		return fmt.Errorf("invalid access log format: %s", o.AccessLogFormat)
+	}
+
+	if !o.AccessLogDisabled {
+		accessLogOutput, err = getAccessLogOutput(o)
 		if err != nil {
 			return err
 		}
@@ -219,11 +720,36 @@ func initLog(o Options) error {
 		ApplicationLogPrefix: o.ApplicationLogPrefix,
 		ApplicationLogOutput: logOutput,
 		AccessLogOutput:      accessLogOutput,
-		AccessLogDisabled:    o.AccessLogDisabled})
+		AccessLogDisabled:    o.AccessLogDisabled,
+		AccessLogFormat:      o.AccessLogFormat,
+		AccessLogHeaders:     o.AccessLogHeaders})
 
 	return nil
 }
 
+// returns the TLS configuration of the proxy listener, or nil, when
+// neither certificates nor ACME hosts are set. The certificate store
+// keeps reloading the changed certificates while the process runs.
+func initTLS(o Options) (*tls.Config, error) {
+	if len(o.TLSCertificates) == 0 && len(o.ACMEHosts) == 0 {
+		return nil, nil
+	}
+
+	s, err := certs.New(certs.Options{
+		Pairs:          o.TLSCertificates,
+		ReloadInterval: o.TLSReloadInterval,
+		ACMEHosts:      o.ACMEHosts,
+		ACMECacheDir:   o.ACMECacheDir,
+		ACMEEmail:      o.ACMEEmail,
+		ClientAuth:     o.TLSClientAuth,
+		ClientCAFiles:  o.TLSClientCAFiles})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.TLSConfig(), nil
+}
+
 // Run skipper.
 func Run(o Options) error {
 	// init log
@@ -232,67 +758,87 @@ func Run(o Options) error {
 		return err
 	}
 
+	var upgradeDrainTimeout time.Duration
+	if o.GracefulUpgrade {
+		upgradeDrainTimeout = o.DrainTimeout
+		if upgradeDrainTimeout <= 0 {
+			upgradeDrainTimeout = upgrade.DefaultDrainTimeout
+		}
+	}
+
 	// init metrics
 	metrics.Init(metrics.Options{
 		Listener:             o.MetricsListener,
 		Prefix:               o.MetricsPrefix,
 		EnableDebugGcMetrics: o.EnableDebugGcMetrics,
 		EnableRuntimeMetrics: o.EnableRuntimeMetrics,
+		Custom:               o.CustomMetrics,
+		UpgradeDrainTimeout:  upgradeDrainTimeout,
+		PrometheusListener:   o.PrometheusListener,
+		Prometheus:           o.PrometheusMetrics,
 	})
 
-	// create authentication for Innkeeper
-	auth := createInnkeeperAuthentication(o)
-
-	// create data client
-	dataClients, err := createDataClients(o, auth)
+	// create the proxy handler, and start receiving the routes
+	h, err := NewHandler(o)
 	if err != nil {
 		return err
 	}
 
-	if len(dataClients) == 0 {
-		log.Warning("no route source specified")
-	}
+	h.Start()
+	defer h.Close()
+
+	if o.SupportListener != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/about", h.AboutHandler())
+		mux.Handle("/fingerprint", h.FingerprintHandler())
+		mux.Handle("/routes/match", dashboard.ExplainHandler(h.Routing()))
+		if o.Dashboard {
+			d := dashboard.New(dashboard.Options{Routing: h.Routing()})
+			defer d.Close()
+			mux.Handle("/dashboard/", d)
+		}
 
-	// create a filter registry with the available filter specs registered,
-	// and register the custom filters
-	registry := builtin.MakeRegistry()
-	for _, f := range o.CustomFilters {
-		registry.Register(f)
-	}
+		if o.AdminToken != "" {
+			mux.Handle("/admin/", http.StripPrefix("/admin", admin.New(admin.Options{
+				Routing:      h.Routing(),
+				Token:        o.AdminToken,
+				Overrides:    h.overrides,
+				HealthChecks: h.healthChecks,
+				Chaos:        h.ChaosSwitch()})))
+		}
 
-	// create routing
-	// create the proxy instance
-	var mo routing.MatchingOptions
-	if o.IgnoreTrailingSlash {
-		mo = routing.IgnoreTrailingSlash
+		log.Infof("support listener on %s/about", o.SupportListener)
+		if o.GracefulUpgrade {
+			go upgrade.ListenAndServeRetry(o.SupportListener, mux, upgradeDrainTimeout)
+		} else {
+			go http.ListenAndServe(o.SupportListener, mux)
+		}
 	}
 
-	// ensure a non-zero poll timeout
-	if o.SourcePollTimeout <= 0 {
-		o.SourcePollTimeout = defaultSourcePollTimeout
-	}
+	// create the access log handler
+	loggingHandler := logging.NewHandler(h)
 
-	// check for dev mode, and set update buffer of the routes
-	updateBuffer := defaultRoutingUpdateBuffer
-	if o.DevMode {
-		updateBuffer = 0
+	tlsConfig, err := initTLS(o)
+	if err != nil {
+		return err
 	}
 
-	// create a routing engine
-	routing := routing.New(routing.Options{
-		registry,
-		mo,
-		o.SourcePollTimeout,
-		dataClients,
-		updateBuffer})
-
-	// create the proxy
-	proxy := proxy.New(routing, o.ProxyOptions, o.PriorityRoutes...)
-
-	// create the access log handler
-	loggingHandler := logging.NewHandler(proxy)
-
 	// start the http server
-	log.Infof("proxy listener on %v", o.Address)
-	return http.ListenAndServe(o.Address, loggingHandler)
+	if o.Listener != nil {
+		log.Infof("proxy listener on %v", o.Listener.Addr())
+	} else {
+		log.Infof("proxy listener on %v", o.Address)
+	}
+
+	return upgrade.ListenAndServe(upgrade.Options{
+		Address:        o.Address,
+		Listener:       o.Listener,
+		Handler:        loggingHandler,
+		DrainTimeout:   o.DrainTimeout,
+		ConnState:      metrics.ConnState,
+		TLSConfig:      tlsConfig,
+		DisableUpgrade: !o.GracefulUpgrade,
+		ReusePort:      o.ReusePort,
+		ShutdownDelay:  o.ShutdownDelay,
+		OnShutdown:     h.Shutdown})
 }
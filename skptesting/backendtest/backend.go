@@ -0,0 +1,221 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package backendtest provides a scriptable backend server for tests, that
+simulates misbehaving upstream services deterministically: slow or
+failing responses, status code sequences, connection resets and slow
+bodies.
+
+The backend follows a script of behaviors. Every request is served with
+the next behavior of the script, and when the script is exhausted, the
+last behavior is repeated:
+
+    b := backendtest.New(
+        backendtest.Behavior{Status: 503},
+        backendtest.Behavior{Status: 503},
+        backendtest.Behavior{Latency: 2 * time.Second},
+        backendtest.Behavior{Reset: true})
+    defer b.Close()
+
+The address of the backend, b.URL, can be used in the route documents of
+the skptesting package, or with any other proxy under test.
+*/
+package backendtest
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Describes how the backend responds to a single request.
+type Behavior struct {
+
+	// The status code of the response. Default: 200.
+	Status int
+
+	// Additional response headers.
+	Header http.Header
+
+	// The content of the response body.
+	Body []byte
+
+	// Time to wait before sending the response header.
+	Latency time.Duration
+
+	// When set, the body is sent in chunks of this size, with the
+	// BodyDelay between them. Default: the whole body at once.
+	ChunkSize int
+
+	// Time to wait before every chunk of the body.
+	BodyDelay time.Duration
+
+	// When set, the connection is reset without sending a response.
+	Reset bool
+
+	// When positive, the response header is sent with the full content
+	// length, but the connection is closed after sending this many bytes
+	// of the body, and the rest of the body is never sent.
+	ResetAfter int
+}
+
+// A received request, with its body read.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// A backend server following a script of behaviors.
+type Backend struct {
+	*httptest.Server
+
+	mx       sync.Mutex
+	script   []Behavior
+	next     int
+	requests []*Request
+}
+
+// Returns the behaviors responding with the provided status codes in
+// sequence, e.g. Statuses(503, 503, 200) for a backend that recovers
+// after two failures.
+func Statuses(codes ...int) []Behavior {
+	s := make([]Behavior, len(codes))
+	for i, c := range codes {
+		s[i] = Behavior{Status: c}
+	}
+
+	return s
+}
+
+// Starts a backend following the script. Without behaviors, it responds
+// with 200 OK to every request.
+func New(script ...Behavior) *Backend {
+	if len(script) == 0 {
+		script = []Behavior{{}}
+	}
+
+	b := &Backend{script: script}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+	return b
+}
+
+// records the request, and returns the next behavior of the script
+func (b *Backend) nextBehavior(r *http.Request, body []byte) Behavior {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.requests = append(b.requests, &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header,
+		Body:   body})
+
+	bh := b.script[b.next]
+	if b.next < len(b.script)-1 {
+		b.next++
+	}
+
+	return bh
+}
+
+// closes the connection, without lingering, so that the client receives
+// a reset
+func reset(w http.ResponseWriter) {
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+
+	conn, _, err := h.Hijack()
+	if err != nil {
+		return
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+
+	conn.Close()
+}
+
+func (b *Backend) serve(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+	bh := b.nextBehavior(r, body.Bytes())
+
+	time.Sleep(bh.Latency)
+	if bh.Reset {
+		reset(w)
+		return
+	}
+
+	for k, v := range bh.Header {
+		w.Header()[k] = v
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(bh.Body)))
+	status := bh.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	w.WriteHeader(status)
+
+	content := bh.Body
+	if bh.ResetAfter > 0 && bh.ResetAfter < len(content) {
+		content = content[:bh.ResetAfter]
+	}
+
+	chunkSize := bh.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = len(content)
+	}
+
+	for len(content) > 0 {
+		time.Sleep(bh.BodyDelay)
+
+		n := chunkSize
+		if n > len(content) {
+			n = len(content)
+		}
+
+		if _, err := w.Write(content[:n]); err != nil {
+			return
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		content = content[n:]
+	}
+
+	if bh.ResetAfter > 0 && bh.ResetAfter < len(bh.Body) {
+		reset(w)
+	}
+}
+
+// Returns the requests received so far, in the order of their arrival.
+func (b *Backend) Requests() []*Request {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return append([]*Request(nil), b.requests...)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusSequence(t *testing.T) {
+	b := New(Statuses(503, 502, 200)...)
+	defer b.Close()
+
+	for _, expected := range []int{503, 502, 200, 200} {
+		rsp, err := http.Get(b.URL + "/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rsp.Body.Close()
+		if rsp.StatusCode != expected {
+			t.Error("unexpected status", rsp.StatusCode, expected)
+		}
+	}
+
+	if r := b.Requests(); len(r) != 4 || r[0].Method != "GET" || r[0].Path != "/foo" {
+		t.Error("failed to record the requests", len(r))
+	}
+}
+
+func TestDefaultBehavior(t *testing.T) {
+	b := New()
+	defer b.Close()
+
+	rsp, err := http.Post(b.URL, "text/plain", bytes.NewBufferString("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Error("unexpected status", rsp.StatusCode)
+	}
+
+	if r := b.Requests(); len(r) != 1 || string(r[0].Body) != "Hello" {
+		t.Error("failed to record the request body")
+	}
+}
+
+func TestHeaderAndBody(t *testing.T) {
+	b := New(Behavior{
+		Status: http.StatusCreated,
+		Header: http.Header{"X-Foo": []string{"bar"}},
+		Body:   []byte("Hello, world!")})
+	defer b.Close()
+
+	rsp, err := http.Get(b.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.StatusCode != http.StatusCreated || rsp.Header.Get("X-Foo") != "bar" || string(body) != "Hello, world!" {
+		t.Error("unexpected response", rsp.StatusCode, rsp.Header, string(body))
+	}
+}
+
+func TestLatency(t *testing.T) {
+	b := New(Behavior{Latency: 60 * time.Millisecond})
+	defer b.Close()
+
+	c := &http.Client{Timeout: 15 * time.Millisecond}
+	if _, err := c.Get(b.URL); err == nil {
+		t.Error("failed to delay the response")
+	}
+}
+
+func TestSlowBody(t *testing.T) {
+	b := New(Behavior{Body: []byte("Hello"), ChunkSize: 1, BodyDelay: 6 * time.Millisecond})
+	defer b.Close()
+
+	start := time.Now()
+	rsp, err := http.Get(b.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "Hello" || time.Since(start) < 30*time.Millisecond {
+		t.Error("failed to send the body slowly", string(body), time.Since(start))
+	}
+}
+
+func TestReset(t *testing.T) {
+	b := New(Behavior{Reset: true})
+	defer b.Close()
+
+	if rsp, err := http.Get(b.URL); err == nil {
+		rsp.Body.Close()
+		t.Error("failed to reset the connection")
+	}
+}
+
+func TestResetAfter(t *testing.T) {
+	b := New(Behavior{Body: []byte("Hello, world!"), ResetAfter: 5})
+	defer b.Close()
+
+	rsp, err := http.Get(b.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err == nil || string(body) != "Hello" {
+		t.Error("failed to cut the body", err, string(body))
+	}
+}
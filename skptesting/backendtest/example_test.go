@@ -0,0 +1,43 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendtest_test
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/skptesting/backendtest"
+	"net/http"
+)
+
+func Example() {
+	// a backend failing twice before recovering
+	b := backendtest.New(backendtest.Statuses(503, 503, 200)...)
+	defer b.Close()
+
+	for i := 0; i < 3; i++ {
+		rsp, err := http.Get(b.URL)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		rsp.Body.Close()
+		fmt.Println(rsp.StatusCode)
+	}
+
+	// Output:
+	// 503
+	// 503
+	// 200
+}
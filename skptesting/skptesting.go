@@ -0,0 +1,507 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package skptesting provides a test harness for route documents and custom
+filters.
+
+It starts an in-process skipper proxy from an eskip document, and provides
+client helpers to make requests to it. The result of every request made
+through the helpers contains, besides the response, the id of the route
+that matched the request, and the names of the filters that were executed
+while processing it.
+
+A test example:
+
+    s, err := skptesting.New(`hello: Path("/hello") -> healthcheck() -> <shunt>`, skptesting.Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    defer s.Close()
+
+    rs, err := s.Get("/hello")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if rs.RouteId != "hello" || !rs.Executed("healthcheck") {
+        t.Error("failed to route")
+    }
+
+To test the routes and the filters against slow, failing or otherwise
+misbehaving backends, see the skptesting/backendtest package.
+*/
+package skptesting
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Header used to correlate the requests made through the client
+	// helpers with the traces recorded by the proxy. It is removed from
+	// the request before it is forwarded to the backend.
+	TraceHeader = "X-Skptesting-Trace"
+
+	traceFilterName    = "skptestingTrace"
+	probeRouteId       = "skptestingProbe"
+	probeHeader        = "X-Skptesting-Probe"
+	defaultReadTimeout = 3 * time.Second
+	pollTimeout        = 3 * time.Millisecond
+	traceStateKey      = "skptesting:trace"
+)
+
+// Error returned when the routes are not applied by the routing within the
+// configured timeout.
+var ErrRoutesNotReady = errors.New("routes not ready")
+
+// Options for the test server.
+type Options struct {
+
+	// Custom filter specifications registered in addition to the
+	// built-in filters.
+	CustomFilters []filters.Spec
+
+	// Flags controlling the proxy behavior.
+	ProxyOptions proxy.Options
+
+	// Flags controlling the route matching.
+	MatchingOptions routing.MatchingOptions
+
+	// Maximum time to wait for the routes to be applied. Default: 3s.
+	ReadyTimeout time.Duration
+}
+
+// Contains the response and the trace information of a request made
+// through the client helpers.
+type Result struct {
+
+	// The response received from the proxy. Its body is already read and
+	// closed, the content is available in the Body field.
+	Response *http.Response
+
+	// The content of the response body.
+	Body []byte
+
+	// The id of the route that matched the request. Empty if no route
+	// matched.
+	RouteId string
+
+	// The names of the filters executed for the request, in the order of
+	// their execution.
+	Filters []string
+}
+
+// An in-process skipper instance used in tests.
+type Server struct {
+
+	// The URL of the running proxy, e.g. http://127.0.0.1:45678.
+	URL string
+
+	routing  *routing.Routing
+	server   *httptest.Server
+	client   *http.Client
+	mx       sync.Mutex
+	traces   map[string]*trace
+	sequence int
+}
+
+type trace struct {
+	mx      sync.Mutex
+	routeId string
+	filters []string
+}
+
+// wraps all filter specifications to record the filter execution. The
+// phase and the description are always forwarded, because their
+// defaults match the absence of the optional interfaces, while the
+// schema and the signature are forwarded by the variants below, only
+// when the wrapped specification implements them.
+type tracingSpec struct {
+	filters.Spec
+}
+
+type tracingSchemaSpec struct {
+	*tracingSpec
+}
+
+type tracingSignatureSpec struct {
+	*tracingSpec
+}
+
+type tracingSchemaSignatureSpec struct {
+	tracingSchemaSpec
+}
+
+type tracingFilter struct {
+	filters.Filter
+	name string
+}
+
+// forwards the sandbox limits of the wrapped filter
+type tracingSandboxFilter struct {
+	*tracingFilter
+}
+
+// specification of the filter prepended to every route
+type traceSpec struct {
+	server *Server
+}
+
+// filter prepended to every route, identifying the route, and registering
+// the trace of the request
+type traceFilter struct {
+	server  *Server
+	routeId string
+}
+
+// Returns true if the filter with the given name was executed.
+func (r *Result) Executed(name string) bool {
+	for _, f := range r.Filters {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *trace) add(name string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.filters = append(t.filters, name)
+}
+
+func (t *trace) executed() []string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return append([]string(nil), t.filters...)
+}
+
+// wraps a specification, keeping the optional interfaces that it
+// implements.
+func wrapSpec(spec filters.Spec) filters.Spec {
+	ts := &tracingSpec{spec}
+	_, schema := spec.(filters.SpecWithSchema)
+	_, signature := spec.(filters.SignatureSpec)
+	switch {
+	case schema && signature:
+		return tracingSchemaSignatureSpec{tracingSchemaSpec{ts}}
+	case schema:
+		return tracingSchemaSpec{ts}
+	case signature:
+		return tracingSignatureSpec{ts}
+	default:
+		return ts
+	}
+}
+
+func (s *tracingSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	f, err := s.Spec.CreateFilter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &tracingFilter{f, s.Name()}
+	if _, ok := f.(filters.SandboxFilter); ok {
+		return tracingSandboxFilter{tf}, nil
+	}
+
+	return tf, nil
+}
+
+func (s *tracingSpec) Phase() filters.Phase {
+	if ps, ok := s.Spec.(filters.PhasedSpec); ok {
+		return ps.Phase()
+	}
+
+	return filters.PhaseRoute
+}
+
+func (s *tracingSpec) Description() string {
+	if ds, ok := s.Spec.(filters.DescribedSpec); ok {
+		return ds.Description()
+	}
+
+	return ""
+}
+
+func (s tracingSchemaSpec) Schema() []filters.Arg {
+	return s.Spec.(filters.SpecWithSchema).Schema()
+}
+
+func (s tracingSignatureSpec) Signature() string {
+	return s.Spec.(filters.SignatureSpec).Signature()
+}
+
+func (s tracingSchemaSignatureSpec) Signature() string {
+	return s.Spec.(filters.SignatureSpec).Signature()
+}
+
+func (f tracingSandboxFilter) SandboxLimits() filters.SandboxLimits {
+	return f.Filter.(filters.SandboxFilter).SandboxLimits()
+}
+
+func (f tracingSandboxFilter) SandboxViolation(routeId, reason string) {
+	f.Filter.(filters.SandboxFilter).SandboxViolation(routeId, reason)
+}
+
+func (f *tracingFilter) Request(ctx filters.FilterContext) {
+	if t, ok := ctx.StateBag()[traceStateKey].(*trace); ok {
+		t.add(f.name)
+	}
+
+	f.Filter.Request(ctx)
+}
+
+func (s *traceSpec) Name() string { return traceFilterName }
+
+// the trace filter runs before the filters of all phases
+func (s *traceSpec) Phase() filters.Phase { return filters.PhasePreAuth }
+
+func (s *traceSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	id, ok := config[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &traceFilter{s.server, id}, nil
+}
+
+func (f *traceFilter) Request(ctx filters.FilterContext) {
+	t := &trace{routeId: f.routeId}
+	ctx.StateBag()[traceStateKey] = t
+
+	req := ctx.Request()
+	key := req.Header.Get(TraceHeader)
+	req.Header.Del(TraceHeader)
+	if key == "" {
+		return
+	}
+
+	f.server.mx.Lock()
+	defer f.server.mx.Unlock()
+	f.server.traces[key] = t
+}
+
+func (f *traceFilter) Response(filters.FilterContext) {}
+
+// creates the registry with the built-in and the custom filters, wrapped
+// with the tracing filters.
+func (s *Server) createRegistry(custom []filters.Spec) filters.Registry {
+	original := builtin.MakeRegistry()
+	for _, spec := range custom {
+		original.Register(spec)
+	}
+
+	r := make(filters.Registry)
+	for name, spec := range original {
+		r[name] = wrapSpec(spec)
+	}
+
+	r.Register(&traceSpec{s})
+	return r
+}
+
+// checks the filters of the routes upfront, so that the routing doesn't
+// just drop the invalid routes.
+func validateRoutes(r filters.Registry, routes []*eskip.Route) error {
+	for _, route := range routes {
+		for _, f := range route.Filters {
+			spec, ok := r[f.Name]
+			if !ok {
+				return fmt.Errorf("%s: filter not found: '%s'", route.Id, f.Name)
+			}
+
+			if ss, ok := spec.(filters.SpecWithSchema); ok {
+				if err := filters.ValidateArgs(f.Name, ss.Schema(), f.Args); err != nil {
+					return fmt.Errorf("%s: %v", route.Id, err)
+				}
+			}
+
+			if _, err := spec.CreateFilter(f.Args); err != nil {
+				return fmt.Errorf("%s: %s: %v", route.Id, f.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// prepends the trace filter to each route, and appends the probe route
+// used to detect when the routes were applied.
+func (s *Server) prepareRoutes(routes []*eskip.Route) []*eskip.Route {
+	prepared := make([]*eskip.Route, 0, len(routes)+1)
+	for _, r := range routes {
+		rc := *r
+		rc.Filters = append(
+			[]*eskip.Filter{{Name: traceFilterName, Args: []interface{}{r.Id}}},
+			r.Filters...)
+		prepared = append(prepared, &rc)
+	}
+
+	return append(prepared, &eskip.Route{
+		Id:      probeRouteId,
+		Headers: map[string]string{probeHeader: "true"},
+		Shunt:   true})
+}
+
+func (s *Server) waitReady(timeout time.Duration) error {
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: "/"},
+		Header: http.Header{probeHeader: []string{"true"}}}
+
+	to := time.After(timeout)
+	for {
+		if r, _ := s.routing.Route(req); r != nil {
+			return nil
+		}
+
+		select {
+		case <-to:
+			return ErrRoutesNotReady
+		case <-time.After(pollTimeout):
+		}
+	}
+}
+
+// Creates and starts a new test server with the routes in the eskip
+// document. It returns an error when the document cannot be parsed, when
+// a route references a missing filter or an invalid filter configuration,
+// or when the routes are not applied within the timeout.
+func New(doc string, o Options) (*Server, error) {
+	routes, err := eskip.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{traces: make(map[string]*trace)}
+	registry := s.createRegistry(o.CustomFilters)
+	if err := validateRoutes(registry, routes); err != nil {
+		return nil, err
+	}
+
+	s.routing = routing.New(routing.Options{
+		FilterRegistry:  registry,
+		MatchingOptions: o.MatchingOptions,
+		PollTimeout:     pollTimeout,
+		DataClients:     []routing.DataClient{testdataclient.New(s.prepareRoutes(routes))}})
+
+	timeout := o.ReadyTimeout
+	if timeout <= 0 {
+		timeout = defaultReadTimeout
+	}
+
+	if err := s.waitReady(timeout); err != nil {
+		return nil, err
+	}
+
+	s.server = httptest.NewServer(proxy.New(s.routing, o.ProxyOptions))
+	s.URL = s.server.URL
+	s.client = &http.Client{}
+	return s, nil
+}
+
+// Creates a request to the test server. The path can contain a query.
+func (s *Server) NewRequest(method, path string, body io.Reader) (*http.Request, error) {
+	return http.NewRequest(method, s.URL+path, body)
+}
+
+func (s *Server) nextTraceKey() string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.sequence++
+	return strconv.Itoa(s.sequence)
+}
+
+func (s *Server) takeTrace(key string) *trace {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	t := s.traces[key]
+	delete(s.traces, key)
+	return t
+}
+
+// Makes a request to the test server, and returns the response with the
+// matched route and the executed filters.
+func (s *Server) Do(req *http.Request) (*Result, error) {
+	key := s.nextTraceKey()
+	req.Header.Set(TraceHeader, key)
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{Response: rsp, Body: body}
+	if t := s.takeTrace(key); t != nil {
+		r.RouteId = t.routeId
+		r.Filters = t.executed()
+	}
+
+	return r, nil
+}
+
+// Makes a GET request to the test server.
+func (s *Server) Get(path string) (*Result, error) {
+	req, err := s.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Do(req)
+}
+
+// Returns the id of the route matching the request without executing
+// it, or an empty string if no route matches.
+func (s *Server) Match(req *http.Request) string {
+	r, _ := s.routing.Route(req)
+	if r == nil || r.Id == probeRouteId {
+		return ""
+	}
+
+	return r.Id
+}
+
+// Stops the test server.
+func (s *Server) Close() {
+	s.server.Close()
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skptesting
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type echoPath struct{}
+
+func (s *echoPath) Name() string                                         { return "echoPath" }
+func (s *echoPath) CreateFilter(_ []interface{}) (filters.Filter, error) { return s, nil }
+func (f *echoPath) Response(_ filters.FilterContext)                     {}
+
+func (f *echoPath) Request(ctx filters.FilterContext) {
+	ctx.Request().Header.Set("X-Echo", ctx.Request().URL.Path)
+}
+
+type phasedSpec struct {
+	name  string
+	phase filters.Phase
+}
+
+func (s *phasedSpec) Name() string                                         { return s.name }
+func (s *phasedSpec) Phase() filters.Phase                                 { return s.phase }
+func (s *phasedSpec) CreateFilter(_ []interface{}) (filters.Filter, error) { return s, nil }
+func (s *phasedSpec) Request(filters.FilterContext)                        {}
+func (s *phasedSpec) Response(filters.FilterContext)                       {}
+
+// accepts any arguments on creation, but declares a schema
+type schemaSpec struct{}
+
+func (s *schemaSpec) Name() string                                         { return "withSchema" }
+func (s *schemaSpec) CreateFilter(_ []interface{}) (filters.Filter, error) { return &phasedSpec{}, nil }
+
+func (s *schemaSpec) Schema() []filters.Arg {
+	return []filters.Arg{{Name: "value", Type: filters.StringType}}
+}
+
+func TestInvalidDocument(t *testing.T) {
+	_, err := New("trallala", Options{})
+	if err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestMissingFilter(t *testing.T) {
+	_, err := New(`Any() -> missingFilter() -> <shunt>`, Options{})
+	if err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestInvalidFilterConfig(t *testing.T) {
+	_, err := New(`Any() -> requestHeader("X-Foo") -> <shunt>`, Options{})
+	if err == nil {
+		t.Error("failed to fail")
+	}
+}
+
+func TestMatchedRouteAndFilters(t *testing.T) {
+	s, err := New(`
+		health: Path("/health") -> healthcheck() -> <shunt>;
+		other: Any() -> <shunt>`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	rs, err := s.Get("/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.Response.StatusCode != http.StatusOK {
+		t.Error("invalid status code", rs.Response.StatusCode)
+	}
+
+	if rs.RouteId != "health" {
+		t.Error("invalid route matched", rs.RouteId)
+	}
+
+	if len(rs.Filters) != 1 || !rs.Executed("healthcheck") {
+		t.Error("invalid filters executed", rs.Filters)
+	}
+
+	rs, err = s.Get("/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.RouteId != "other" || len(rs.Filters) != 0 {
+		t.Error("invalid route matched", rs.RouteId, rs.Filters)
+	}
+}
+
+func TestNoRouteMatched(t *testing.T) {
+	s, err := New(`Path("/hello") -> <shunt>`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	rs, err := s.Get("/world")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.Response.StatusCode != http.StatusNotFound || rs.RouteId != "" {
+		t.Error("failed to not match")
+	}
+
+	req, err := s.NewRequest("GET", "/world", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Match(req) != "" {
+		t.Error("failed to not match")
+	}
+}
+
+func TestCustomFilterWithBackend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(TraceHeader) != "" {
+			t.Error("trace header forwarded")
+		}
+
+		w.Write([]byte(r.Header.Get("X-Echo")))
+	}))
+	defer backend.Close()
+
+	s, err := New(
+		fmt.Sprintf(`echo: Path("/echo") -> echoPath() -> "%s"`, backend.URL),
+		Options{CustomFilters: []filters.Spec{&echoPath{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	req, err := s.NewRequest("GET", "/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Match(req) != "echo" {
+		t.Error("failed to match route")
+	}
+
+	rs, err := s.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(rs.Body) != "/echo" {
+		t.Error("invalid response body", string(rs.Body))
+	}
+
+	if rs.RouteId != "echo" || !rs.Executed("echoPath") {
+		t.Error("invalid trace", rs.RouteId, rs.Filters)
+	}
+}
+
+func TestFilterPhasesAsInProduction(t *testing.T) {
+	const doc = `phased: Any() -> route1() -> preAuth() -> route2() -> auth() -> <shunt>`
+	specs := []filters.Spec{
+		&phasedSpec{"route1", filters.PhaseRoute},
+		&phasedSpec{"preAuth", filters.PhasePreAuth},
+		&phasedSpec{"route2", filters.PhaseRoute},
+		&phasedSpec{"auth", filters.PhaseAuth},
+	}
+
+	registry := make(filters.Registry)
+	for _, spec := range specs {
+		registry.Register(spec)
+	}
+
+	routes, err := eskip.Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: registry,
+		PollTimeout:    pollTimeout,
+		DataClients:    []routing.DataClient{testdataclient.New(routes)}})
+	defer rt.Close()
+
+	req, _ := http.NewRequest("GET", "https://www.example.org/", nil)
+	var production []string
+	to := time.After(defaultReadTimeout)
+	for production == nil {
+		if r, _ := rt.Route(req); r != nil {
+			for _, f := range r.Filters {
+				production = append(production, f.Name)
+			}
+
+			break
+		}
+
+		select {
+		case <-to:
+			t.Fatal("failed to receive the routes")
+		case <-time.After(pollTimeout):
+		}
+	}
+
+	s, err := New(doc, Options{CustomFilters: specs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	rs, err := s.Get("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rs.Filters, production) {
+		t.Error("filter order differs from production", rs.Filters, production)
+	}
+}
+
+func TestFilterSchemaValidated(t *testing.T) {
+	o := Options{CustomFilters: []filters.Spec{&schemaSpec{}}}
+	if _, err := New(`Any() -> withSchema(42) -> <shunt>`, o); err == nil {
+		t.Error("failed to validate the filter arguments with the schema")
+	}
+
+	s, err := New(`Any() -> withSchema("foo") -> <shunt>`, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+}
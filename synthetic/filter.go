@@ -0,0 +1,198 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synthetic
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/filters"
+	"net/http"
+	"time"
+)
+
+const (
+	// The name of the filter running a check.
+	CheckName = "syntheticCheck"
+
+	// The name of the filter responding with the results of the checks.
+	StatusName = "syntheticStatus"
+)
+
+type checkSpec struct {
+	monitor *Monitor
+}
+
+type checkFilter struct {
+	monitor *Monitor
+	check   *Check
+}
+
+type statusSpec struct {
+	monitor *Monitor
+}
+
+type statusFilter struct {
+	monitor *Monitor
+}
+
+// Returns a filter specification whose instances run a check with the
+// provided monitor, and respond with the result. Instances expect the
+// name of the check, the path or the URL of the internal request, and
+// optionally pairs of expectation or request parameters:
+//
+//     status  - the expected status code
+//     latency - the maximum duration of the request in milliseconds
+//     body    - a string that the response body needs to contain
+//     method  - the method of the request, default: GET
+//     host    - the Host header of the request
+//
+// E.g.:
+//
+//     syntheticCheck("checkout", "/checkout/cart", "status", 200, "latency", 300)
+//
+// Name: "syntheticCheck".
+func NewCheck(m *Monitor) filters.Spec {
+	return &checkSpec{m}
+}
+
+// Returns a filter specification whose instances respond with the
+// results of the last runs of the checks of the provided monitor, in
+// JSON format. The response status is 200 when every check passed, and
+// 503 otherwise. Instances don't expect any parameters.
+//
+// Name: "syntheticStatus".
+func NewStatus(m *Monitor) filters.Spec {
+	return &statusSpec{m}
+}
+
+// "syntheticCheck"
+func (spec *checkSpec) Name() string { return CheckName }
+
+func (spec *checkSpec) Description() string {
+	return "Runs a synthetic check with an internal request, and responds with the result."
+}
+
+func (spec *checkSpec) Signature() string {
+	return "name string, url string, [name string, value, ...]"
+}
+
+func (spec *checkSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) < 2 || len(config)%2 != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := config[0].(string)
+	if !ok || name == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	u, ok := config[1].(string)
+	if !ok || u == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	c := &Check{Name: name, URL: u}
+	for i := 2; i < len(config); i += 2 {
+		key, ok := config[i].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		switch key {
+		case "status", "latency":
+			v, ok := config[i+1].(float64)
+			if !ok || v <= 0 {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			if key == "status" {
+				c.Status = int(v)
+			} else {
+				c.Latency = time.Duration(v) * time.Millisecond
+			}
+		case "body", "method", "host":
+			v, ok := config[i+1].(string)
+			if !ok {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			switch key {
+			case "body":
+				c.Body = v
+			case "method":
+				c.Method = v
+			default:
+				c.Host = v
+			}
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	return &checkFilter{spec.monitor, c}, nil
+}
+
+// responds with a JSON document, and marks the request served
+func respond(ctx filters.FilterContext, passed bool, v interface{}) {
+	status := http.StatusOK
+	if !passed {
+		status = http.StatusServiceUnavailable
+	}
+
+	w := ctx.ResponseWriter()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+	ctx.MarkServed()
+}
+
+// Runs the check, and responds with the result.
+func (f *checkFilter) Request(ctx filters.FilterContext) {
+	r := f.monitor.Run(f.check, ctx.Request())
+	respond(ctx, r.Passed, r)
+}
+
+// Noop.
+func (f *checkFilter) Response(filters.FilterContext) {}
+
+// "syntheticStatus"
+func (spec *statusSpec) Name() string { return StatusName }
+
+func (spec *statusSpec) Description() string {
+	return "Responds with the results of the synthetic checks."
+}
+
+func (spec *statusSpec) Signature() string { return "" }
+
+func (spec *statusSpec) CreateFilter(config []interface{}) (filters.Filter, error) {
+	if len(config) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &statusFilter{spec.monitor}, nil
+}
+
+// Responds with the results of the checks.
+func (f *statusFilter) Request(ctx filters.FilterContext) {
+	results := f.monitor.Results()
+	passed := true
+	for _, r := range results {
+		passed = passed && r.Passed
+	}
+
+	respond(ctx, passed, results)
+}
+
+// Noop.
+func (f *statusFilter) Response(filters.FilterContext) {}
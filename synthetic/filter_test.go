@@ -0,0 +1,163 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synthetic
+
+import (
+	"encoding/json"
+	"github.com/zalando/skipper/filters/filtertest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateCheck(t *testing.T) {
+	spec := NewCheck(New(nil))
+	for _, ti := range []struct {
+		msg    string
+		config []interface{}
+		fail   bool
+	}{{
+		"no args",
+		nil,
+		true,
+	}, {
+		"no url",
+		[]interface{}{"test"},
+		true,
+	}, {
+		"invalid name",
+		[]interface{}{42.0, "/foo"},
+		true,
+	}, {
+		"missing value",
+		[]interface{}{"test", "/foo", "status"},
+		true,
+	}, {
+		"unknown expectation",
+		[]interface{}{"test", "/foo", "header", "foo"},
+		true,
+	}, {
+		"invalid status",
+		[]interface{}{"test", "/foo", "status", "200"},
+		true,
+	}, {
+		"invalid latency",
+		[]interface{}{"test", "/foo", "latency", -3.0},
+		true,
+	}, {
+		"name and url",
+		[]interface{}{"test", "/foo"},
+		false,
+	}, {
+		"all options",
+		[]interface{}{
+			"test", "/foo",
+			"status", 200.0,
+			"latency", 300.0,
+			"body", "bar",
+			"method", "HEAD",
+			"host", "www.example.org",
+		},
+		false,
+	}} {
+		_, err := spec.CreateFilter(ti.config)
+		if ti.fail && err == nil {
+			t.Error(ti.msg, "failed to fail")
+		} else if !ti.fail && err != nil {
+			t.Error(ti.msg, err)
+		}
+	}
+}
+
+func filterContext() *filtertest.Context {
+	return &filtertest.Context{
+		FResponseWriter: httptest.NewRecorder(),
+		FRequest:        trigger(""),
+		FStateBag:       make(map[string]interface{})}
+}
+
+func TestCheckAndStatus(t *testing.T) {
+	h := &testHandler{status: http.StatusOK, body: "shopping cart"}
+	m := New(h)
+
+	status, err := NewStatus(m).CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(config ...interface{}) {
+		f, err := NewCheck(m).CreateFilter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := filterContext()
+		f.Request(ctx)
+		if !ctx.Served() {
+			t.Error("failed to serve the check")
+		}
+	}
+
+	respond := func() (int, []*Result) {
+		ctx := filterContext()
+		status.Request(ctx)
+		if !ctx.Served() {
+			t.Error("failed to serve the status")
+		}
+
+		rsp := ctx.FResponseWriter.(*httptest.ResponseRecorder)
+		var results []*Result
+		if err := json.Unmarshal(rsp.Body.Bytes(), &results); err != nil {
+			t.Fatal(err)
+		}
+
+		return rsp.Code, results
+	}
+
+	check("cart", "/cart", "body", "cart")
+	if code, results := respond(); code != http.StatusOK || len(results) != 1 || !results[0].Passed {
+		t.Error("unexpected status", code, results)
+	}
+
+	check("basket", "/basket", "body", "basket")
+	if code, results := respond(); code != http.StatusServiceUnavailable ||
+		len(results) != 2 || results[0].Passed || !results[1].Passed {
+		t.Error("unexpected status", code, results)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	f, err := NewCheck(New(&testHandler{status: http.StatusNotFound})).CreateFilter([]interface{}{
+		"test", "/foo", "status", 200.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := filterContext()
+	f.Request(ctx)
+	rsp := ctx.FResponseWriter.(*httptest.ResponseRecorder)
+	if rsp.Code != http.StatusServiceUnavailable {
+		t.Error("invalid status code", rsp.Code)
+	}
+
+	var r Result
+	if err := json.Unmarshal(rsp.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Name != "test" || r.Passed || r.Status != http.StatusNotFound || r.Reason == "" {
+		t.Error("invalid result", r)
+	}
+}
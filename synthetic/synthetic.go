@@ -0,0 +1,207 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package synthetic implements synthetic monitoring of the routes: checks
+that send internal requests through the routing and the filters of the
+proxy, and assert on the responses.
+
+A check is defined by a route containing the syntheticCheck filter. When
+a request matches the route, the filter sends the internal request, e.g.
+to a critical route, compares the response with the expectations, and
+responds with the result:
+
+    checkCheckout: Path("/synthetic/checkout")
+      -> syntheticCheck("checkout", "/checkout/cart", "status", 200, "latency", 300, "body", "cart")
+      -> <shunt>;
+
+The checks run on demand, so they can be scheduled by any external
+prober, e.g. the health checks of a load balancer. The response status
+is 200 when the check passed, and 503 when it failed. The results of
+the last runs of all the checks are available from routes containing
+the syntheticStatus filter:
+
+    syntheticStatus: Path("/synthetic") -> syntheticStatus() -> <shunt>;
+
+Besides, the results are reported in the metrics, as the
+synthetic.<name>.passed and synthetic.<name>.failed counters, and the
+synthetic.<name>.latency timer.
+
+The internal requests are marked with the X-Skipper-Synthetic header.
+Checks receiving a request with this header fail, so that a check
+cannot call itself, directly or indirectly.
+*/
+package synthetic
+
+import (
+	"fmt"
+	"github.com/zalando/skipper/metrics"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header set on the internal requests of the checks, containing the name
+// of the check.
+const Header = "X-Skipper-Synthetic"
+
+// The expectations of a check, and the request that it sends.
+type Check struct {
+
+	// The name of the check, used in the metrics and in the results.
+	Name string
+
+	// The method of the internal request. Default: GET.
+	Method string
+
+	// The path of the internal request, or an absolute URL.
+	URL string
+
+	// The Host header of the internal request. When not set, the host of
+	// the URL, or the host of the request triggering the check is used.
+	Host string
+
+	// The expected status code. Zero means any status below 500.
+	Status int
+
+	// The maximum duration of the internal request. Zero means no limit.
+	Latency time.Duration
+
+	// A string that the response body needs to contain.
+	Body string
+}
+
+// The result of a check run.
+type Result struct {
+	Name      string    `json:"name"`
+	Passed    bool      `json:"passed"`
+	Status    int       `json:"status"`
+	LatencyMs int64     `json:"latencyMs"`
+	Reason    string    `json:"reason,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Runs the checks through an http.Handler, typically the skipper proxy,
+// and keeps the result of the last run of every check.
+type Monitor struct {
+	handler http.Handler
+	mx      sync.Mutex
+	results map[string]*Result
+}
+
+// Creates a monitor sending the internal requests to the handler.
+func New(h http.Handler) *Monitor {
+	return &Monitor{handler: h, results: make(map[string]*Result)}
+}
+
+// creates the internal request of a check, triggered by a request
+func (c *Check) request(trigger *http.Request) (*http.Request, error) {
+	method := c.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	u := c.URL
+	if strings.HasPrefix(u, "/") {
+		u = "http://" + trigger.Host + u
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Host != "" {
+		req.Host = c.Host
+	}
+
+	req.RemoteAddr = trigger.RemoteAddr
+	req.Header.Set(Header, c.Name)
+	return req, nil
+}
+
+// verifies the response of a check, and returns the reason of the
+// failure, or an empty string
+func (c *Check) verify(rsp *httptest.ResponseRecorder, d time.Duration) string {
+	switch {
+	case c.Status == 0 && rsp.Code >= 500:
+		return fmt.Sprintf("unexpected status: %d", rsp.Code)
+	case c.Status != 0 && rsp.Code != c.Status:
+		return fmt.Sprintf("unexpected status: %d, expected: %d", rsp.Code, c.Status)
+	case c.Latency > 0 && d > c.Latency:
+		return fmt.Sprintf("latency exceeded: %v, limit: %v", d, c.Latency)
+	case c.Body != "" && !strings.Contains(rsp.Body.String(), c.Body):
+		return fmt.Sprintf("body doesn't contain: %s", c.Body)
+	default:
+		return ""
+	}
+}
+
+// Runs a check, triggered by the provided request, and stores and
+// returns the result.
+func (m *Monitor) Run(c *Check, trigger *http.Request) *Result {
+	r := &Result{Name: c.Name, Time: time.Now()}
+	if trigger.Header.Get(Header) != "" {
+		r.Reason = "check triggered by a synthetic request"
+		return m.store(r)
+	}
+
+	req, err := c.request(trigger)
+	if err != nil {
+		r.Reason = err.Error()
+		return m.store(r)
+	}
+
+	rsp := httptest.NewRecorder()
+	m.handler.ServeHTTP(rsp, req)
+	d := time.Since(r.Time)
+
+	r.Status = rsp.Code
+	r.LatencyMs = int64(d / time.Millisecond)
+	r.Reason = c.verify(rsp, d)
+	r.Passed = r.Reason == ""
+	metrics.MeasureSyntheticCheck(c.Name, r.Passed, d)
+	return m.store(r)
+}
+
+func (m *Monitor) store(r *Result) *Result {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.results[r.Name] = r
+	return r
+}
+
+// Returns the result of the last run of every check, ordered by the
+// name of the checks.
+func (m *Monitor) Results() []*Result {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	var names []string
+	for n := range m.results {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+	results := make([]*Result, len(names))
+	for i, n := range names {
+		r := *m.results[n]
+		results[i] = &r
+	}
+
+	return results
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synthetic
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+type testHandler struct {
+	status   int
+	body     string
+	delay    time.Duration
+	requests []*http.Request
+}
+
+func (h *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.requests = append(h.requests, r)
+	time.Sleep(h.delay)
+	w.WriteHeader(h.status)
+	w.Write([]byte(h.body))
+}
+
+func trigger(header string) *http.Request {
+	r, err := http.NewRequest("GET", "http://www.example.org/synthetic", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	if header != "" {
+		r.Header.Set(Header, header)
+	}
+
+	return r
+}
+
+func TestRun(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		handler *testHandler
+		check   *Check
+		trigger *http.Request
+		passed  bool
+	}{{
+		"any non-server-error status passes by default",
+		&testHandler{status: http.StatusNotFound},
+		&Check{Name: "test", URL: "/foo"},
+		trigger(""),
+		true,
+	}, {
+		"server error fails by default",
+		&testHandler{status: http.StatusInternalServerError},
+		&Check{Name: "test", URL: "/foo"},
+		trigger(""),
+		false,
+	}, {
+		"expected status",
+		&testHandler{status: http.StatusTeapot},
+		&Check{Name: "test", URL: "/foo", Status: http.StatusTeapot},
+		trigger(""),
+		true,
+	}, {
+		"unexpected status",
+		&testHandler{status: http.StatusOK},
+		&Check{Name: "test", URL: "/foo", Status: http.StatusTeapot},
+		trigger(""),
+		false,
+	}, {
+		"latency exceeded",
+		&testHandler{status: http.StatusOK, delay: 30 * time.Millisecond},
+		&Check{Name: "test", URL: "/foo", Latency: 3 * time.Millisecond},
+		trigger(""),
+		false,
+	}, {
+		"body contains",
+		&testHandler{status: http.StatusOK, body: "shopping cart"},
+		&Check{Name: "test", URL: "/foo", Body: "cart"},
+		trigger(""),
+		true,
+	}, {
+		"body doesn't contain",
+		&testHandler{status: http.StatusOK, body: "shopping basket"},
+		&Check{Name: "test", URL: "/foo", Body: "cart"},
+		trigger(""),
+		false,
+	}, {
+		"triggered by a synthetic request",
+		&testHandler{status: http.StatusOK},
+		&Check{Name: "test", URL: "/foo"},
+		trigger("other"),
+		false,
+	}} {
+		m := New(ti.handler)
+		r := m.Run(ti.check, ti.trigger)
+		if r.Passed != ti.passed {
+			t.Error(ti.msg, "unexpected result", r.Passed, r.Reason)
+		}
+
+		if r.Passed && r.Reason != "" || !r.Passed && r.Reason == "" {
+			t.Error(ti.msg, "invalid reason", r.Reason)
+		}
+
+		if ti.trigger.Header.Get(Header) != "" && len(ti.handler.requests) != 0 {
+			t.Error(ti.msg, "check loop not prevented")
+		}
+	}
+}
+
+func TestInternalRequest(t *testing.T) {
+	h := &testHandler{status: http.StatusOK}
+	m := New(h)
+	m.Run(&Check{Name: "test", URL: "/foo?bar=baz", Method: "HEAD", Host: "api.example.org"}, trigger(""))
+	if len(h.requests) != 1 {
+		t.Fatal("failed to send the internal request")
+	}
+
+	r := h.requests[0]
+	if r.Method != "HEAD" || r.URL.Path != "/foo" || r.URL.RawQuery != "bar=baz" ||
+		r.Host != "api.example.org" || r.Header.Get(Header) != "test" {
+		t.Error("invalid internal request", r.Method, r.URL, r.Host, r.Header)
+	}
+}
+
+func TestResults(t *testing.T) {
+	m := New(&testHandler{status: http.StatusOK})
+	m.Run(&Check{Name: "b", URL: "/b"}, trigger(""))
+	m.Run(&Check{Name: "a", URL: "/a", Status: http.StatusNotFound}, trigger(""))
+	m.Run(&Check{Name: "b", URL: "/b", Status: http.StatusNotFound}, trigger(""))
+
+	results := m.Results()
+	if len(results) != 2 || results[0].Name != "a" || results[1].Name != "b" {
+		t.Fatal("invalid results", results)
+	}
+
+	if results[0].Passed || results[1].Passed || results[1].Status != http.StatusOK {
+		t.Error("failed to store the last results")
+	}
+
+	results[0].Passed = true
+	if m.Results()[0].Passed {
+		t.Error("results not copied")
+	}
+}
+
+func TestResultsEmpty(t *testing.T) {
+	if len(New(nil).Results()) != 0 {
+		t.Error("unexpected results")
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package upgrade implements serving HTTP with in-place binary upgrades,
+without dropping the connections of the clients.
+
+When the upgrade is triggered by the SIGUSR2 signal, the running process
+starts a new process from the binary at the same path, passing the
+listener socket to it as an inherited file descriptor. The new process
+accepts the connections from the same socket, so no connections are
+refused during the handover, and once it is serving, it signals the old
+process with SIGTERM. The old process then stops accepting connections,
+and drains the ones already open: the idle ones are closed, while the
+active ones are closed after the current request was served. The
+connections still open after the drain timeout are closed forcibly.
+
+E.g. upgrading a single instance:
+
+	cp skipper-new /usr/local/bin/skipper
+	kill -USR2 $(pidof -s skipper)
+
+When the process is supervised, e.g. by systemd, the supervisor needs
+to be prepared for the change of the main process id.
+
+The upgrades are supported only on Unix like systems.
+
+Independent of the in-place upgrades, the server drains the connections
+when it receives SIGTERM, e.g. when it is stopped by a supervisor or by
+a container orchestrator during a rolling deployment. Optionally, it
+keeps accepting new connections for a shutdown delay before draining,
+to let the load balancers in front of it notice that it is shutting
+down, e.g. by failing health checks, and stop sending new requests to
+it.
+
+With the ReusePort option, the listener socket is opened with
+SO_REUSEPORT, so that a new process, started independently and not by
+the in-place upgrade, can listen on the same address, while the old
+process is still serving or draining. The kernel distributes the new
+connections between the listening processes.
+*/
+package upgrade
+
+import (
+	"crypto/tls"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The environment variable used to pass the file descriptor of the
+// inherited listener socket to the new process.
+const ListenerFdKey = "SKIPPER_LISTENER_FD"
+
+// The default time to wait for the open connections before closing
+// them, when draining the old process.
+const DefaultDrainTimeout = 30 * time.Second
+
+// additional time to wait for the previous process to exit, after its
+// drain timeout
+const exitMargin = 10 * time.Second
+
+var listenRetryInterval = 100 * time.Millisecond
+
+// Options for ListenAndServe.
+type Options struct {
+
+	// Network address to listen on, when the listener is not
+	// inherited from a previous process.
+	Address string
+
+	// When set, the server serves on this listener, instead of
+	// listening on Address, or on the inherited listener. The
+	// listener is not handed over to a new process, so the in-place
+	// upgrades are disabled.
+	Listener net.Listener
+
+	// The handler serving the requests.
+	Handler http.Handler
+
+	// Time to wait for the open connections when draining. Defaults
+	// to DefaultDrainTimeout.
+	DrainTimeout time.Duration
+
+	// Optional hook called when a client connection changes its
+	// state, like http.Server.ConnState.
+	ConnState func(net.Conn, http.ConnState)
+
+	// When set, the connections are served with TLS. The listener
+	// handed over to the new process is the underlying TCP listener.
+	TLSConfig *tls.Config
+
+	// When set, SIGUSR2 doesn't start a new process, and only the
+	// draining on SIGTERM is enabled. On the platforms not supporting
+	// the upgrades, the draining is triggered by os.Interrupt.
+	DisableUpgrade bool
+
+	// When set, the listener socket is opened with SO_REUSEPORT,
+	// allowing other processes to listen on the same address. It is
+	// supported only on Unix like systems.
+	ReusePort bool
+
+	// Time to keep accepting new connections after receiving SIGTERM,
+	// before draining.
+	ShutdownDelay time.Duration
+
+	// Optional hook called when SIGTERM is received, before the
+	// shutdown delay, e.g. to fail the health checks.
+	OnShutdown func()
+}
+
+type server struct {
+	mx        sync.Mutex
+	server    *http.Server
+	listener  net.Listener
+	conns     map[net.Conn]http.ConnState
+	draining  bool
+	drained   chan struct{}
+	connState func(net.Conn, http.ConnState)
+}
+
+var errUnsupported = errors.New("in-place upgrade is not supported on this platform")
+
+// returns the listener inherited from the previous process, when
+// there is one, or otherwise creates a new listener.
+func listen(address string, reusePort bool) (net.Listener, bool, error) {
+	fdString := os.Getenv(ListenerFdKey)
+	if fdString == "" && reusePort {
+		l, err := listenReusePort(address)
+		return l, false, err
+	}
+
+	if fdString == "" {
+		l, err := net.Listen("tcp", address)
+		return l, false, err
+	}
+
+	// unset, so that it is not passed on to the unrelated child
+	// processes
+	os.Unsetenv(ListenerFdKey)
+
+	fd, err := strconv.Atoi(fdString)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	return l, true, err
+}
+
+func newServer(l net.Listener, h http.Handler) *server {
+	s := &server{
+		listener: l,
+		conns:    make(map[net.Conn]http.ConnState),
+		drained:  make(chan struct{}),
+	}
+
+	s.server = &http.Server{Handler: h, ConnState: s.trackConn}
+	return s
+}
+
+func (s *server) trackConn(c net.Conn, state http.ConnState) {
+	if s.connState != nil {
+		s.connState(c, state)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, c)
+	case http.StateIdle:
+		if s.draining {
+			c.Close()
+		}
+
+		s.conns[c] = state
+	default:
+		s.conns[c] = state
+	}
+
+	s.checkDrained()
+}
+
+// expects the lock to be held
+func (s *server) checkDrained() {
+	if !s.draining || len(s.conns) > 0 {
+		return
+	}
+
+	select {
+	case <-s.drained:
+	default:
+		close(s.drained)
+	}
+}
+
+func (s *server) serve() error {
+	err := s.server.Serve(s.listener)
+
+	s.mx.Lock()
+	draining := s.draining
+	s.mx.Unlock()
+
+	if draining {
+		return nil
+	}
+
+	return err
+}
+
+// stops accepting new connections, closes the idle ones and waits
+// until the active ones are closed, or the timeout is reached, when
+// the remaining connections are closed.
+func (s *server) drain(timeout time.Duration) {
+	s.mx.Lock()
+	s.draining = true
+	s.server.SetKeepAlivesEnabled(false)
+	s.listener.Close()
+	for c, state := range s.conns {
+		if state == http.StateIdle {
+			c.Close()
+		}
+	}
+
+	s.checkDrained()
+	s.mx.Unlock()
+
+	select {
+	case <-s.drained:
+		return
+	case <-time.After(timeout):
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	log.Warnf("closing %d connections after the drain timeout", len(s.conns))
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+func drainTimeoutOrDefault(t time.Duration) time.Duration {
+	if t <= 0 {
+		return DefaultDrainTimeout
+	}
+
+	return t
+}
+
+// ListenAndServeRetry serves HTTP on the address, like
+// http.ListenAndServe, but when it fails to listen, it retries until
+// the drain timeout of the previous process has passed. It is meant for
+// the additional listeners, e.g. for the metrics, that are not handed
+// over during the upgrade, and become free only when the previous
+// process exits.
+func ListenAndServeRetry(address string, h http.Handler, drainTimeout time.Duration) error {
+	deadline := time.Now().Add(drainTimeoutOrDefault(drainTimeout) + exitMargin)
+	for {
+		l, err := net.Listen("tcp", address)
+		if err == nil {
+			return http.Serve(l, h)
+		}
+
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(listenRetryInterval)
+	}
+}
+
+// calls the shutdown hook, keeps serving during the shutdown delay, and
+// drains the connections
+func (s *server) shutdown(o Options) {
+	if o.OnShutdown != nil {
+		o.OnShutdown()
+	}
+
+	if o.ShutdownDelay > 0 {
+		log.Infof("shutting down in %v", o.ShutdownDelay)
+		time.Sleep(o.ShutdownDelay)
+	}
+
+	log.Info("draining connections")
+	s.drain(drainTimeoutOrDefault(o.DrainTimeout))
+	log.Info("connections drained")
+}
+
+// ListenAndServe serves HTTP on the listener inherited from the previous
+// process, on a new one, or on the one set in the options, and, unless
+// disabled, hands over the listener to a new process when receiving
+// SIGUSR2. It returns nil after the listener was handed over, or when it
+// received SIGTERM, and the open connections were drained.
+func ListenAndServe(o Options) error {
+	upgradeSignal, termSignal, err := notifySignals(!o.DisableUpgrade && o.Listener == nil)
+	if err != nil {
+		return err
+	}
+
+	l := o.Listener
+	var inherited bool
+	if l == nil {
+		l, inherited, err = listen(o.Address, o.ReusePort)
+		if err != nil {
+			return err
+		}
+	}
+
+	sl := l
+	if o.TLSConfig != nil {
+		sl = tls.NewListener(l, o.TLSConfig)
+	}
+
+	s := newServer(sl, o.Handler)
+	s.connState = o.ConnState
+	served := make(chan error, 1)
+	go func() { served <- s.serve() }()
+
+	if inherited {
+		log.Infof("serving on the inherited listener %v", l.Addr())
+		if err := notifyParent(); err != nil {
+			log.Error("failed to notify the previous process: ", err)
+		}
+	}
+
+	for {
+		select {
+		case err := <-served:
+			return err
+		case <-upgradeSignal:
+			log.Info("upgrade requested, starting a new process")
+			if pid, err := startProcess(l); err != nil {
+				log.Error("failed to start a new process: ", err)
+			} else {
+				log.Infof("started a new process: %d", pid)
+			}
+		case <-termSignal:
+			s.shutdown(o)
+			return <-served
+		}
+	}
+}
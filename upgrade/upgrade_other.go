@@ -0,0 +1,40 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package upgrade
+
+import (
+	"net"
+	"os"
+	"os/signal"
+)
+
+func notifySignals(enableUpgrade bool) (<-chan os.Signal, <-chan os.Signal, error) {
+	if enableUpgrade {
+		return nil, nil, errUnsupported
+	}
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt)
+	return nil, term, nil
+}
+
+func listenReusePort(string) (net.Listener, error) { return nil, errUnsupported }
+
+func notifyParent() error { return errUnsupported }
+
+func startProcess(net.Listener) (int, error) { return 0, errUnsupported }
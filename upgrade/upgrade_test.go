@@ -0,0 +1,300 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListenNew(t *testing.T) {
+	os.Unsetenv(ListenerFdKey)
+	l, inherited, err := listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	if inherited {
+		t.Error("unexpected inherited listener")
+	}
+}
+
+func TestListenInherited(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(ListenerFdKey, strconv.Itoa(int(f.Fd())))
+	defer os.Unsetenv(ListenerFdKey)
+
+	il, inherited, err := listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer il.Close()
+	if !inherited {
+		t.Error("failed to inherit the listener")
+	}
+
+	if il.Addr().String() != l.Addr().String() {
+		t.Error("invalid address", il.Addr(), l.Addr())
+	}
+
+	if os.Getenv(ListenerFdKey) != "" {
+		t.Error("failed to unset the environment variable")
+	}
+}
+
+func TestDrainWaitsForActiveRequests(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	s := newServer(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.Write([]byte("Hello, world!"))
+	}))
+
+	served := make(chan error, 1)
+	go func() { served <- s.serve() }()
+
+	responded := make(chan string, 1)
+	go func() {
+		rsp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			responded <- err.Error()
+			return
+		}
+
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		responded <- string(b)
+	}()
+
+	<-received
+	drained := make(chan struct{})
+	go func() {
+		s.drain(time.Minute)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("drained before the request was served")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error("failed to stop accepting connections")
+	}
+
+	close(release)
+	if body := <-responded; body != "Hello, world!" {
+		t.Error("failed to serve the active request", body)
+	}
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Error("failed to drain")
+	}
+
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s := newServer(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+
+	go s.serve()
+	go http.Get("http://" + l.Addr().String())
+
+	<-received
+	start := time.Now()
+	s.drain(30 * time.Millisecond)
+	if d := time.Since(start); d < 30*time.Millisecond || d > time.Second {
+		t.Error("invalid drain duration", d)
+	}
+}
+
+func TestListenAndServeRetry(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	go ListenAndServeRetry(address, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}), time.Minute)
+
+	time.Sleep(3 * listenRetryInterval)
+	l.Close()
+
+	var body string
+	for i := 0; i < 30; i++ {
+		rsp, err := http.Get("http://" + address)
+		if err != nil {
+			time.Sleep(listenRetryInterval)
+			continue
+		}
+
+		b, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		body = string(b)
+		break
+	}
+
+	if body != "Hello, world!" {
+		t.Error("failed to serve after the address was released")
+	}
+}
+
+func TestListenReusePort(t *testing.T) {
+	os.Unsetenv(ListenerFdKey)
+	l, _, err := listen("127.0.0.1:0", true)
+	if err == errUnsupported {
+		t.Skip(err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+	l2, _, err := listen(l.Addr().String(), true)
+	if err != nil {
+		t.Fatal("failed to listen on the same address", err)
+	}
+
+	defer l2.Close()
+	if l2.Addr().String() != l.Addr().String() {
+		t.Error("invalid address", l2.Addr(), l.Addr())
+	}
+}
+
+func TestShutdownDelay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}))
+
+	served := make(chan error, 1)
+	go func() { served <- s.serve() }()
+
+	notified := make(chan struct{})
+	shutdown := make(chan struct{})
+	go func() {
+		s.shutdown(Options{
+			ShutdownDelay: 90 * time.Millisecond,
+			DrainTimeout:  time.Second,
+			OnShutdown:    func() { close(notified) }})
+		close(shutdown)
+	}()
+
+	<-notified
+	rsp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to serve during the shutdown delay", err)
+	}
+
+	rsp.Body.Close()
+
+	select {
+	case <-shutdown:
+		t.Fatal("shut down before the delay")
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("failed to shut down")
+	}
+
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListenAndServeListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- ListenAndServe(Options{
+			Address:  "invalid address",
+			Listener: l,
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("Hello, world!"))
+			})})
+	}()
+
+	rsp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to serve on the listener", err)
+	}
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil || string(b) != "Hello, world!" {
+		t.Error("invalid response", string(b), err)
+	}
+
+	l.Close()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Error("failed to stop serving after the listener was closed")
+	}
+}
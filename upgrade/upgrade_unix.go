@@ -0,0 +1,147 @@
+// Copyright 2015 Zalando SE
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package upgrade
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+func notifySignals(enableUpgrade bool) (<-chan os.Signal, <-chan os.Signal, error) {
+	var upgrade chan os.Signal
+	if enableUpgrade {
+		upgrade = make(chan os.Signal, 1)
+		signal.Notify(upgrade, syscall.SIGUSR2)
+	}
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	return upgrade, term, nil
+}
+
+// signals the process that passed the listener, that it can stop
+// accepting connections.
+func notifyParent() error {
+	return syscall.Kill(os.Getppid(), syscall.SIGTERM)
+}
+
+// starts the binary found at the path of the current one, with the
+// same arguments, passing the listener socket as the first extra file.
+func startProcess(l net.Listener) (int, error) {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return 0, errors.New("listener doesn't support the handover")
+	}
+
+	f, err := tl.File()
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{f}
+
+	// the extra files start after stdin, stdout and stderr
+	cmd.Env = append(os.Environ(), ListenerFdKey+"="+strconv.Itoa(3))
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	// release the resources once the new process exits
+	go cmd.Wait()
+	return cmd.Process.Pid, nil
+}
+
+// creates a TCP listener with SO_REUSEPORT set. When the address has no
+// IP, it listens on all the IPv6 and IPv4 addresses, when IPv6 is
+// available.
+func listenReusePort(address string) (net.Listener, error) {
+	a, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		family int
+		sa     syscall.Sockaddr
+	)
+
+	if ip4 := a.IP.To4(); ip4 != nil || a.IP == nil && !supportsIPv6() {
+		sa4 := &syscall.SockaddrInet4{Port: a.Port}
+		copy(sa4.Addr[:], ip4)
+		family, sa = syscall.AF_INET, sa4
+	} else {
+		sa6 := &syscall.SockaddrInet6{Port: a.Port}
+		copy(sa6.Addr[:], a.IP.To16())
+		family, sa = syscall.AF_INET6, sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	// the file takes the ownership of the socket, and closes it when
+	// the listener was created from it
+	syscall.CloseOnExec(fd)
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		return nil, os.NewSyscallError("listen", err)
+	}
+
+	return net.FileListener(f)
+}
+
+func supportsIPv6() bool {
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return false
+	}
+
+	syscall.Close(fd)
+	return true
+}